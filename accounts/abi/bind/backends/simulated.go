@@ -55,7 +55,7 @@ import (
 var _ bind.ContractBackend = (*SimulatedBackend)(nil)
 
 var (
-	errBlockNumberUnsupported  = errors.New("simulatedBackend cannot access blocks other than the latest block")
+	errBlockNumberUnsupported  = errors.New("simulatedBackend cannot access blocks after the pending block")
 	errBlockDoesNotExist       = errors.New("block does not exist in blockchain")
 	errTransactionDoesNotExist = errors.New("transaction does not exist")
 )
@@ -469,11 +469,24 @@ func (b *SimulatedBackend) CallContract(ctx context.Context, call ethereum.CallM
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	block, s := b.pendingBlock, state.New(state.NewPlainStateReader(b.database))
 	if blockNumber != nil && blockNumber.Cmp(b.pendingBlock.Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+		// The past blocks are executed on top of the historical state after them
+		if blockNumber.Cmp(b.prependBlock.Number()) > 0 {
+			return nil, errBlockNumberUnsupported
+		}
+		var err error
+		if block, err = b.blockByNumberNoLock(ctx, blockNumber); err != nil {
+			return nil, err
+		}
+		dbtx, err := b.database.Begin(ctx, ethdb.RO)
+		if err != nil {
+			return nil, err
+		}
+		defer dbtx.Rollback()
+		s = b.stateByBlockNumber(dbtx, blockNumber)
 	}
-	s := state.New(state.NewPlainStateReader(b.database))
-	res, err := b.callContract(ctx, call, b.pendingBlock, s)
+	res, err := b.callContract(ctx, call, block, s)
 	if err != nil {
 		return nil, err
 	}
@@ -824,6 +837,20 @@ func (m callMsg) Value() *uint256.Int          { return m.CallMsg.Value }
 func (m callMsg) Data() []byte                 { return m.CallMsg.Data }
 func (m callMsg) AccessList() types.AccessList { return m.CallMsg.AccessList }
 
+func (m callMsg) FeeCap() *uint256.Int {
+	if m.CallMsg.FeeCap == nil {
+		return m.CallMsg.GasPrice
+	}
+	return m.CallMsg.FeeCap
+}
+
+func (m callMsg) Tip() *uint256.Int {
+	if m.CallMsg.Tip == nil {
+		return m.CallMsg.GasPrice
+	}
+	return m.CallMsg.Tip
+}
+
 // filterBackend implements filters.Backend to support filtering for logs without
 // taking bloom-bits acceleration structures into account.
 type filterBackend struct {
@@ -1019,6 +1019,58 @@ func TestSimulatedBackend_PendingAndCallContract(t *testing.T) {
 	}
 }
 
+func TestSimulatedBackend_CallContractAtBlock(t *testing.T) {
+	testAddr := crypto.PubkeyToAddress(testKey.PublicKey)
+	sim := simTestBackend(testAddr)
+	defer sim.Close()
+	bgCtx := context.Background()
+
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Errorf("could not get code at test addr: %v", err)
+	}
+	contractAuth, _ := bind.NewKeyedTransactorWithChainID(testKey, big.NewInt(1337))
+	addr, _, _, err := bind.DeployContract(contractAuth, parsed, common.FromHex(abiBin), sim)
+	if err != nil {
+		t.Errorf("could not deploy contract: %v", err)
+	}
+	sim.Commit()
+	sim.Commit()
+
+	input, err := parsed.Pack("receive", []byte("X"))
+	if err != nil {
+		t.Errorf("could not pack receive function on contract: %v", err)
+	}
+	call := ethereum.CallMsg{
+		From: testAddr,
+		To:   &addr,
+		Data: input,
+	}
+
+	// the contract is deployed in block 1
+	res, err := sim.CallContract(bgCtx, call, big.NewInt(1))
+	if err != nil {
+		t.Errorf("could not call receive method on contract at block 1: %v", err)
+	}
+	if !bytes.Equal(res, expectedReturn) {
+		t.Errorf("response from calling contract at block 1 was expected to be 'hello world' instead received %v", string(res))
+	}
+
+	// and does not exist in the genesis state
+	res, err = sim.CallContract(bgCtx, call, big.NewInt(0))
+	if err != nil {
+		t.Errorf("could not call contract address at block 0: %v", err)
+	}
+	if len(res) != 0 {
+		t.Errorf("result of contract call at block 0 was expected to be empty: %v", res)
+	}
+
+	// the blocks after the pending one are not known
+	if _, err = sim.CallContract(bgCtx, call, big.NewInt(5)); err != errBlockNumberUnsupported {
+		t.Errorf("expected error %v, got %v", errBlockNumberUnsupported, err)
+	}
+}
+
 // This test is based on the following contract:
 /*
 contract Reverter {
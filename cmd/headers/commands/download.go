@@ -1,22 +1,33 @@
 package commands
 
 import (
+	"fmt"
+
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/cmd/headers/download"
 	"github.com/spf13/cobra"
 )
 
 var (
-	combined bool   // Whether downloader also includes sentry
-	timeout  int    // Timeout for delivery requests
-	window   int    // Size of sliding window for downloading block bodies
-	chain    string // Name of the network to connect to
+	combined    bool     // Whether downloader also includes sentry
+	timeout     int      // Timeout for delivery requests
+	window      int      // Size of sliding window for downloading block bodies
+	lookahead   int      // How many blocks ahead of the execution the block bodies are prefetched
+	prefetchMem string   // Memory limit for the prefetched block bodies
+	chain       string   // Name of the network to connect to
+	sentryAddrs []string // Addresses of the sentries <host>:<port>
+	txpoolAddr  string   // Address of the transaction pool <host>:<port>
 )
 
 func init() {
-	downloadCmd.Flags().StringVar(&sentryAddr, "sentryAddr", "localhost:9091", "sentry address <host>:<port>")
+	downloadCmd.Flags().StringSliceVar(&sentryAddrs, "sentryAddr", []string{"localhost:9091"}, "comma separated sentry addresses <host>:<port>,<host>:<port>")
+	downloadCmd.Flags().StringVar(&coreAddr, "coreAddr", "", "address <host>:<port> to serve the control API on, which attaches and detaches sentries at runtime")
+	downloadCmd.Flags().StringVar(&txpoolAddr, "txpoolAddr", "", "address <host>:<port> of the transaction pool to import the gossiped transactions into, e.g. the private API of turbo-geth")
 	downloadCmd.Flags().BoolVar(&combined, "combined", false, "run downloader and sentry in the same process")
 	downloadCmd.Flags().IntVar(&timeout, "timeout", 30, "timeout for devp2p delivery requests, in seconds")
 	downloadCmd.Flags().IntVar(&window, "window", 65536, "size of sliding window for downloading block bodies, block")
+	downloadCmd.Flags().IntVar(&lookahead, "bodies.lookahead", 8192, "how many blocks ahead of the execution the block bodies are prefetched while the other stages run, 0 to turn prefetching off")
+	downloadCmd.Flags().StringVar(&prefetchMem, "bodies.prefetch.memory", "256MB", "memory limit for the prefetched block bodies")
 	downloadCmd.Flags().StringVar(&chain, "chain", "mainnet", "Name of the network (mainnet, testnets) to connect to")
 
 	// Options below are only used in the combined mode
@@ -35,11 +46,15 @@ var downloadCmd = &cobra.Command{
 	Use:   "download",
 	Short: "Download headers backwards",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		var prefetchMemory datasize.ByteSize
+		if err := prefetchMemory.UnmarshalText([]byte(prefetchMem)); err != nil {
+			return fmt.Errorf("parsing bodies.prefetch.memory: %w", err)
+		}
 		db := openDatabase(chaindata)
 		defer db.Close()
 		if combined {
-			return download.Combined(natSetting, port, staticPeers, discovery, netRestrict, db, timeout, window, chain)
+			return download.Combined(natSetting, port, staticPeers, discovery, netRestrict, db, timeout, window, lookahead, prefetchMemory, chain)
 		}
-		return download.Download(sentryAddr, coreAddr, db, timeout, window, chain)
+		return download.Download(sentryAddrs, coreAddr, txpoolAddr, db, timeout, window, lookahead, prefetchMemory, chain)
 	},
 }
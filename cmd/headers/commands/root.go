@@ -7,7 +7,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/debug"
@@ -76,7 +75,7 @@ func withChaindata(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&chaindata, "chaindata", "", "path to the db")
 	must(cmd.MarkFlagDirname("chaindata"))
 	must(cmd.MarkFlagRequired("chaindata"))
-	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx")
+	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx, or another backend compiled in with the build tags")
 }
 
 func withLmdbFlags(cmd *cobra.Command) {
@@ -90,33 +89,20 @@ func openDatabase(path string) *ethdb.ObjectDatabase {
 }
 
 func openKV(path string, exclusive bool) ethdb.KV {
-	if database == "mdbx" {
-		opts := ethdb.NewMDBX().Path(path)
-		if exclusive {
-			opts = opts.Exclusive()
-		}
-		if mapSizeStr != "" {
-			var mapSize datasize.ByteSize
-			must(mapSize.UnmarshalText([]byte(mapSizeStr)))
-			opts = opts.MapSize(mapSize)
-		}
-		if freelistReuse > 0 {
-			opts = opts.MaxFreelistReuse(uint(freelistReuse))
-		}
-		return opts.MustOpen()
-	}
-
-	opts := ethdb.NewLMDB().Path(path)
-	if exclusive {
-		opts = opts.Exclusive()
+	backend := database
+	if backend == "" {
+		backend = "lmdb"
 	}
+	opts := ethdb.BackendOpts{Path: path, Exclusive: exclusive}
 	if mapSizeStr != "" {
-		var mapSize datasize.ByteSize
-		must(mapSize.UnmarshalText([]byte(mapSizeStr)))
-		opts = opts.MapSize(mapSize)
+		must(opts.MapSize.UnmarshalText([]byte(mapSizeStr)))
 	}
 	if freelistReuse > 0 {
-		opts = opts.MaxFreelistReuse(uint(freelistReuse))
+		opts.MaxFreelistReuse = uint(freelistReuse)
+	}
+	kv, err := ethdb.OpenBackend(backend, opts)
+	if err != nil {
+		panic(err)
 	}
-	return opts.MustOpen()
+	return kv
 }
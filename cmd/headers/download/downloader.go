@@ -5,13 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/c2h5oh/datasize"
-	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
@@ -25,6 +23,8 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces"
 	proto_sentry "github.com/ledgerwatch/turbo-geth/gointerfaces/sentry"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
+	proto_types "github.com/ledgerwatch/turbo-geth/gointerfaces/types"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/rlp"
@@ -41,7 +41,7 @@ const (
 	estHeaderRlpSize  = 500             // Approximate size of an RLP encoded block header
 )
 
-func grpcSentryClient(ctx context.Context, sentryAddr string) (proto_sentry.SentryClient, error) {
+func grpcSentryClient(ctx context.Context, sentryAddr string) (*grpc.ClientConn, error) {
 	log.Info("Starting Sentry client", "connecting to sentry", sentryAddr)
 	// CREATING GRPC CLIENT CONNECTION
 	var dialOpts []grpc.DialOption
@@ -59,94 +59,49 @@ func grpcSentryClient(ctx context.Context, sentryAddr string) (proto_sentry.Sent
 	if err != nil {
 		return nil, fmt.Errorf("creating client connection to sentry P2P: %w", err)
 	}
-	return proto_sentry.NewSentryClient(conn), nil
+	return conn, nil
 }
 
-// Download creates and starts standalone downloader
-func Download(sentryAddr string, coreAddr string, db ethdb.Database, timeout, window int, chain string) error {
-	ctx := rootContext()
-
-	sentryClient, err := grpcSentryClient(ctx, sentryAddr)
+func grpcTxPoolClient(ctx context.Context, txpoolAddr string) (txpool.TxpoolClient, error) {
+	log.Info("Starting TxPool client", "connecting to txpool", txpoolAddr)
+	conn, err := grpc.DialContext(ctx, txpoolAddr,
+		grpc.WithInsecure(),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig, MinConnectTimeout: 10 * time.Minute}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(int(16*datasize.MB))),
+	)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("creating client connection to txpool: %w", err)
 	}
+	return txpool.NewTxpoolClient(conn), nil
+}
 
-	controlServer, err1 := NewControlServer(db, sentryClient, window, chain)
-	if err1 != nil {
-		return fmt.Errorf("create core P2P server: %w", err1)
-	}
+// Download creates and starts standalone downloader, connected to the sentries at sentryAddrs.
+// If coreAddr is set, more sentries can be attached (and detached) at runtime via the SentryControl
+// service served on it. If txpoolAddr is set, the transactions gossiped by the peers of the sentries
+// are imported into the transaction pool served on it
+func Download(sentryAddrs []string, coreAddr string, txpoolAddr string, db ethdb.Database, timeout, window, lookahead int, prefetchMemory datasize.ByteSize, chain string) error {
+	ctx := rootContext()
 
-	// TODO: Make a reconnection loop
-	statusMsg := &proto_sentry.StatusData{
-		NetworkId:       controlServer.networkId,
-		TotalDifficulty: gointerfaces.ConvertUint256IntToH256(controlServer.headTd),
-		BestHash:        gointerfaces.ConvertHashToH256(controlServer.headHash),
-		MaxBlock:        controlServer.headHeight,
-		ForkData: &proto_sentry.Forks{
-			Genesis: gointerfaces.ConvertHashToH256(controlServer.genesisHash),
-			Forks:   controlServer.forks,
-		},
+	controlServer, err := NewControlServer(ctx, db, window, chain)
+	if err != nil {
+		return fmt.Errorf("create core P2P server: %w", err)
 	}
-	callCtx, cancelFn := context.WithCancel(ctx)
-	if _, err = sentryClient.SetStatus(callCtx, statusMsg, &grpc.EmptyCallOption{}); err != nil {
-		cancelFn()
-		return fmt.Errorf("setting initial status message: %w", err)
-	}
-	cancelFn()
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-			callCtx, cancelFn = context.WithCancel(ctx)
-			receiveClient, err2 := sentryClient.ReceiveMessages(callCtx, &empty.Empty{}, &grpc.EmptyCallOption{})
-			if err2 != nil {
-				log.Error("Receive messages failed", "error", err2)
-			} else {
-				inreq, err := receiveClient.Recv()
-				for ; err == nil; inreq, err = receiveClient.Recv() {
-					if err1 := controlServer.handleInboundMessage(ctx, inreq); err1 != nil {
-						log.Error("Handling incoming message", "error", err1)
-					}
-				}
-				if err != nil && !errors.Is(err, io.EOF) {
-					log.Error("Receive loop terminated", "error", err)
-				}
-			}
-			cancelFn()
-			// Wait before trying to reconnect to prevent log flooding
-			time.Sleep(2 * time.Second)
+	controlServer.bd.SetPrefetchLimits(lookahead, prefetchMemory)
+	if txpoolAddr != "" {
+		if controlServer.txPool, err = grpcTxPoolClient(ctx, txpoolAddr); err != nil {
+			return err
 		}
-	}()
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-			}
-			callCtx, cancelFn = context.WithCancel(ctx)
-			receiveUploadClient, err3 := sentryClient.ReceiveUploadMessages(callCtx, &empty.Empty{}, &grpc.EmptyCallOption{})
-			if err3 != nil {
-				log.Error("Receive upload messages failed", "error", err3)
-			} else {
-				inreq, err := receiveUploadClient.Recv()
-				for ; err == nil; inreq, err = receiveUploadClient.Recv() {
-					if err1 := controlServer.handleInboundMessage(ctx, inreq); err1 != nil {
-						log.Error("Handling incoming message", "error", err1)
-					}
-				}
-				if err != nil && !errors.Is(err, io.EOF) {
-					log.Error("Receive upload loop terminated", "error", err)
-				}
-			}
-			cancelFn()
-			// Wait before trying to reconnect to prevent log flooding
-			time.Sleep(2 * time.Second)
+	}
+	for _, sentryAddr := range sentryAddrs {
+		if _, err = controlServer.AttachSentry(ctx, &proto_sentry.SentryAddress{Address: sentryAddr}); err != nil {
+			return err
 		}
-	}()
+	}
+	if coreAddr != "" {
+		if err = grpcControlServer(ctx, coreAddr, controlServer); err != nil {
+			return err
+		}
+	}
 
 	if err := stages.StageLoop(
 		ctx,
@@ -168,75 +123,31 @@ func Download(sentryAddr string, coreAddr string, db ethdb.Database, timeout, wi
 }
 
 // Combined creates and starts sentry and downloader in the same process
-func Combined(natSetting string, port int, staticPeers []string, discovery bool, netRestrict string, db ethdb.Database, timeout, window int, chain string) error {
+func Combined(natSetting string, port int, staticPeers []string, discovery bool, netRestrict string, db ethdb.Database, timeout, window, lookahead int, prefetchMemory datasize.ByteSize, chain string) error {
 	ctx := rootContext()
 
 	sentryServer := &SentryServerImpl{
+		ctx:             ctx,
 		receiveCh:       make(chan StreamMsg, 1024),
 		receiveUploadCh: make(chan StreamMsg, 1024),
+		receiveTxCh:     make(chan StreamMsg, 1024),
 	}
+	sentryServer.natSetting = natSetting
+	sentryServer.port = port
+	sentryServer.staticPeers = staticPeers
+	sentryServer.discovery = discovery
+	sentryServer.netRestrict = netRestrict
 	sentryClient := &SentryClientDirect{}
 	sentryClient.SetServer(sentryServer)
-	controlServer, err := NewControlServer(db, sentryClient, window, chain)
+	controlServer, err := NewControlServer(ctx, db, window, chain)
 	if err != nil {
 		return fmt.Errorf("create core P2P server: %w", err)
 	}
-	sentryServer.p2pServer, err = p2pServer(ctx, sentryServer, controlServer.genesisHash, natSetting, port, staticPeers, discovery, netRestrict)
-	if err != nil {
+	controlServer.bd.SetPrefetchLimits(lookahead, prefetchMemory)
+	// The p2p server of the sentry is started by the first status message
+	if err = controlServer.addSentry(directSentryAddr, sentryClient, nil); err != nil {
 		return err
 	}
-	statusMsg := &proto_sentry.StatusData{
-		NetworkId:       controlServer.networkId,
-		TotalDifficulty: gointerfaces.ConvertUint256IntToH256(controlServer.headTd),
-		BestHash:        gointerfaces.ConvertHashToH256(controlServer.headHash),
-		MaxBlock:        controlServer.headHeight,
-		ForkData: &proto_sentry.Forks{
-			Genesis: gointerfaces.ConvertHashToH256(controlServer.genesisHash),
-			Forks:   controlServer.forks,
-		},
-	}
-	callCtx, cancelFn := context.WithCancel(ctx)
-	if _, err = sentryClient.SetStatus(callCtx, statusMsg, &grpc.EmptyCallOption{}); err != nil {
-		cancelFn()
-		return fmt.Errorf("setting initial status message: %w", err)
-	}
-	cancelFn()
-	callCtx, cancelFn = context.WithCancel(ctx)
-	receiveClient, err2 := sentryClient.ReceiveMessages(callCtx, &empty.Empty{}, &grpc.EmptyCallOption{})
-	if err2 != nil {
-		cancelFn()
-		return fmt.Errorf("receive messages failed: %w", err2)
-	}
-	cancelFn()
-	go func() {
-		inreq, err := receiveClient.Recv()
-		for ; err == nil; inreq, err = receiveClient.Recv() {
-			if err1 := controlServer.handleInboundMessage(ctx, inreq); err1 != nil {
-				log.Error("Handling incoming message", "error", err1)
-			}
-		}
-		if err != nil && !errors.Is(err, io.EOF) {
-			log.Error("Receive loop terminated", "error", err)
-		}
-	}()
-	callCtx, cancelFn = context.WithCancel(ctx)
-	receiveUploadClient, err3 := sentryClient.ReceiveUploadMessages(callCtx, &empty.Empty{}, &grpc.EmptyCallOption{})
-	if err3 != nil {
-		cancelFn()
-		return fmt.Errorf("receive upload messages failed: %w", err3)
-	}
-	cancelFn()
-	go func() {
-		inreq, err := receiveUploadClient.Recv()
-		for ; err == nil; inreq, err = receiveUploadClient.Recv() {
-			if err1 := controlServer.handleInboundMessage(ctx, inreq); err1 != nil {
-				log.Error("Handling incoming message", "error", err1)
-			}
-		}
-		if err != nil && !errors.Is(err, io.EOF) {
-			log.Error("Receive loop terminated", "error", err)
-		}
-	}()
 
 	if err := stages.StageLoop(
 		ctx,
@@ -257,10 +168,16 @@ func Combined(natSetting string, port int, staticPeers []string, discovery bool,
 }
 
 type ControlServerImpl struct {
+	proto_sentry.UnimplementedSentryControlServer
+	ctx                  context.Context
 	lock                 sync.RWMutex
 	hd                   *headerdownload.HeaderDownload
 	bd                   *bodydownload.BodyDownload
-	sentryClient         proto_sentry.SentryClient
+	sentriesLock         sync.RWMutex
+	sentries             map[string]*sentryConn // attached sentries by address
+	nextSentry           uint32                 // sentry to send the next request to, to spread the requests
+	peerSentries         sync.Map               // sentry client by the id of the peer, to send the requests to the chosen peers
+	txPool               txpool.TxpoolClient    // nil if the gossiped transactions are not imported
 	requestWakeUpHeaders chan struct{}
 	requestWakeUpBodies  chan struct{}
 	headHeight           uint64
@@ -274,7 +191,7 @@ type ControlServerImpl struct {
 	db                   ethdb.Database
 }
 
-func NewControlServer(db ethdb.Database, sentryClient proto_sentry.SentryClient, window int, chain string) (*ControlServerImpl, error) {
+func NewControlServer(ctx context.Context, db ethdb.Database, window int, chain string) (*ControlServerImpl, error) {
 	ethashConfig := &ethash.Config{
 		CachesInMem:      1,
 		CachesLockMmap:   false,
@@ -307,7 +224,7 @@ func NewControlServer(db ethdb.Database, sentryClient proto_sentry.SentryClient,
 	if chainConfig, _, _, err = core.SetupGenesisBlock(db, genesis, false /* history */, false /* overwrite */); err != nil {
 		return nil, fmt.Errorf("setup genesis block: %w", err)
 	}
-	engine := ethconfig.CreateConsensusEngine(chainConfig, ethashConfig, nil, false, db)
+	engine := ethconfig.CreateConsensusEngine(chainConfig, ethashConfig, nil, false, ethconfig.Defaults.HeimdallURL, db)
 	hd := headerdownload.NewHeaderDownload(
 		512,       /* anchorLimit */
 		1024*1024, /* tipLimit */
@@ -320,7 +237,7 @@ func NewControlServer(db ethdb.Database, sentryClient proto_sentry.SentryClient,
 
 	hd.SetPreverifiedHashes(preverifiedHashes, preverifiedHeight)
 	bd := bodydownload.NewBodyDownload(window /* outstandingLimit */)
-	cs := &ControlServerImpl{hd: hd, bd: bd, sentryClient: sentryClient, requestWakeUpHeaders: make(chan struct{}, 1), requestWakeUpBodies: make(chan struct{}, 1), db: db}
+	cs := &ControlServerImpl{ctx: ctx, hd: hd, bd: bd, sentries: make(map[string]*sentryConn), requestWakeUpHeaders: make(chan struct{}, 1), requestWakeUpBodies: make(chan struct{}, 1), db: db}
 	cs.chainConfig = chainConfig
 	cs.forks = forkid.GatherForks(cs.chainConfig)
 	cs.genesisHash = genesisHash
@@ -330,13 +247,10 @@ func NewControlServer(db ethdb.Database, sentryClient proto_sentry.SentryClient,
 	return cs, err
 }
 
-func (cs *ControlServerImpl) updateHead(ctx context.Context, height uint64, hash common.Hash, td *uint256.Int) {
-	cs.lock.Lock()
-	defer cs.lock.Unlock()
-	cs.headHeight = height
-	cs.headHash = hash
-	cs.headTd = td
-	statusMsg := &proto_sentry.StatusData{
+func (cs *ControlServerImpl) statusData() *proto_sentry.StatusData {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return &proto_sentry.StatusData{
 		NetworkId:       cs.networkId,
 		TotalDifficulty: gointerfaces.ConvertUint256IntToH256(cs.headTd),
 		BestHash:        gointerfaces.ConvertHashToH256(cs.headHash),
@@ -346,14 +260,23 @@ func (cs *ControlServerImpl) updateHead(ctx context.Context, height uint64, hash
 			Forks:   cs.forks,
 		},
 	}
-	//nolint:govet
-	callCtx, _ := context.WithCancel(ctx)
-	if _, err := cs.sentryClient.SetStatus(callCtx, statusMsg, &grpc.EmptyCallOption{}); err != nil {
-		log.Error("Update status message for the sentry", "error", err)
+}
+
+func (cs *ControlServerImpl) updateHead(ctx context.Context, height uint64, hash common.Hash, td *uint256.Int) {
+	cs.lock.Lock()
+	cs.headHeight = height
+	cs.headHash = hash
+	cs.headTd = td
+	cs.lock.Unlock()
+	statusMsg := cs.statusData()
+	for _, sentry := range cs.getSentries() {
+		if _, err := sentry.client.SetStatus(ctx, statusMsg, &grpc.EmptyCallOption{}); err != nil {
+			log.Error("Update status message for the sentry", "sentry", sentry.addr, "error", err)
+		}
 	}
 }
 
-func (cs *ControlServerImpl) newBlockHashes(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) newBlockHashes(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	var request eth.NewBlockHashesPacket
 	if err := rlp.DecodeBytes(inreq.Data, &request); err != nil {
 		return fmt.Errorf("decode NewBlockHashes: %v", err)
@@ -379,7 +302,7 @@ func (cs *ControlServerImpl) newBlockHashes(ctx context.Context, inreq *proto_se
 			}
 			//nolint:govet
 			callCtx, _ := context.WithCancel(ctx)
-			_, err = cs.sentryClient.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
+			_, err = sentry.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
 			if err != nil {
 				return fmt.Errorf("send header request: %v", err)
 			}
@@ -388,7 +311,7 @@ func (cs *ControlServerImpl) newBlockHashes(ctx context.Context, inreq *proto_se
 	return nil
 }
 
-func (cs *ControlServerImpl) blockHeaders(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) blockHeaders(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	rlpStream := rlp.NewStream(bytes.NewReader(inreq.Data), uint64(len(inreq.Data)))
 	_, err := rlpStream.List()
 	if err != nil {
@@ -415,19 +338,23 @@ func (cs *ControlServerImpl) blockHeaders(ctx context.Context, inreq *proto_sent
 			heighestBlock = h.Number.Uint64()
 		}
 	}
+	peerID := gointerfaces.ConvertH512ToBytes(inreq.PeerId)
+	cs.peerSentries.Store(string(peerID), sentry)
+	cs.hd.DeliveredHeaders(peerID, headers)
 	if segments, penalty, err := cs.hd.SplitIntoSegments(headersRaw, headers); err == nil {
 		if penalty == headerdownload.NoPenalty {
 			for _, segment := range segments {
 				cs.hd.ProcessSegment(segment, false /* newBlock */)
 			}
 		} else {
+			cs.hd.RemovePeer(peerID)
 			outreq := proto_sentry.PenalizePeerRequest{
 				PeerId:  inreq.PeerId,
 				Penalty: proto_sentry.PenaltyKind_Kick, // TODO: Extend penalty kinds
 			}
 			//nolint:govet
 			callCtx, _ := context.WithCancel(ctx)
-			if _, err1 := cs.sentryClient.PenalizePeer(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
+			if _, err1 := sentry.PenalizePeer(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
 				log.Error("Could not send penalty", "err", err1)
 			}
 		}
@@ -440,14 +367,14 @@ func (cs *ControlServerImpl) blockHeaders(ctx context.Context, inreq *proto_sent
 	}
 	//nolint:govet
 	callCtx, _ := context.WithCancel(ctx)
-	if _, err1 := cs.sentryClient.PeerMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
+	if _, err1 := sentry.PeerMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
 		log.Error("Could not send min block for peer", "err", err1)
 	}
 	//log.Info("HeadersMsg processed")
 	return nil
 }
 
-func (cs *ControlServerImpl) newBlock(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) newBlock(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	// Extract header from the block
 	rlpStream := rlp.NewStream(bytes.NewReader(inreq.Data), uint64(len(inreq.Data)))
 	_, err := rlpStream.List() // Now stream is at the beginning of the block record
@@ -467,17 +394,21 @@ func (cs *ControlServerImpl) newBlock(ctx context.Context, inreq *proto_sentry.I
 	if err := rlp.DecodeBytes(inreq.Data, &request); err != nil {
 		return fmt.Errorf("decode NewBlockMsg: %v", err)
 	}
+	peerID := gointerfaces.ConvertH512ToBytes(inreq.PeerId)
 	if segments, penalty, err := cs.hd.SingleHeaderAsSegment(headerRaw, request.Block.Header()); err == nil {
 		if penalty == headerdownload.NoPenalty {
 			cs.hd.ProcessSegment(segments[0], true /* newBlock */) // There is only one segment in this case
+			cs.peerSentries.Store(string(peerID), sentry)
+			cs.hd.UpdatePeerHeight(peerID, request.Block.NumberU64())
 		} else {
+			cs.hd.RemovePeer(peerID)
 			outreq := proto_sentry.PenalizePeerRequest{
 				PeerId:  inreq.PeerId,
 				Penalty: proto_sentry.PenaltyKind_Kick, // TODO: Extend penalty kinds
 			}
 			//nolint:govet
 			callCtx, _ := context.WithCancel(ctx)
-			if _, err1 := cs.sentryClient.PenalizePeer(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
+			if _, err1 := sentry.PenalizePeer(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
 				log.Error("Could not send penalty", "err", err1)
 			}
 		}
@@ -491,7 +422,7 @@ func (cs *ControlServerImpl) newBlock(ctx context.Context, inreq *proto_sentry.I
 	}
 	//nolint:govet
 	callCtx, _ := context.WithCancel(ctx)
-	if _, err1 := cs.sentryClient.PeerMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
+	if _, err1 := sentry.PeerMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{}); err1 != nil {
 		log.Error("Could not send min block for peer", "err", err1)
 	}
 	log.Info(fmt.Sprintf("NewBlockMsg{blockNumber: %d} from [%s]", request.Block.NumberU64(), gointerfaces.ConvertH512ToBytes(inreq.PeerId)))
@@ -512,6 +443,64 @@ func (cs *ControlServerImpl) blockBodies(inreq *proto_sentry.InboundMessage) err
 	return nil
 }
 
+func (cs *ControlServerImpl) newPooledTransactionHashes(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
+	if cs.txPool == nil {
+		return nil
+	}
+	var announced eth.NewPooledTransactionHashesPacket
+	if err := rlp.DecodeBytes(inreq.Data, &announced); err != nil {
+		return fmt.Errorf("decode NewPooledTransactionHashes: %v", err)
+	}
+	hashes := &txpool.TxHashes{Hashes: make([]*proto_types.H256, len(announced))}
+	for i := range announced {
+		hashes.Hashes[i] = gointerfaces.ConvertHashToH256(announced[i])
+	}
+	unknown, err := cs.txPool.FindUnknownTransactions(ctx, hashes, &grpc.EmptyCallOption{})
+	if err != nil {
+		return fmt.Errorf("find unknown transactions: %v", err)
+	}
+	if len(unknown.Hashes) == 0 {
+		return nil
+	}
+	request := make(eth.GetPooledTransactionsPacket, len(unknown.Hashes))
+	for i, h := range unknown.Hashes {
+		request[i] = gointerfaces.ConvertH256ToHash(h)
+	}
+	b, err := rlp.EncodeToBytes(request)
+	if err != nil {
+		return fmt.Errorf("encode pooled transactions request: %v", err)
+	}
+	outreq := proto_sentry.SendMessageByIdRequest{
+		PeerId: inreq.PeerId,
+		Data: &proto_sentry.OutboundMessageData{
+			Id:   proto_sentry.MessageId_GetPooledTransactions,
+			Data: b,
+		},
+	}
+	if _, err = sentry.SendMessageById(ctx, &outreq, &grpc.EmptyCallOption{}); err != nil {
+		return fmt.Errorf("send pooled transactions request: %v", err)
+	}
+	return nil
+}
+
+func (cs *ControlServerImpl) transactions(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+	if cs.txPool == nil {
+		return nil
+	}
+	var txs []rlp.RawValue
+	if err := rlp.DecodeBytes(inreq.Data, &txs); err != nil {
+		return fmt.Errorf("decode %s: %v", inreq.Id, err)
+	}
+	request := &txpool.ImportRequest{Txs: make([][]byte, len(txs))}
+	for i := range txs {
+		request.Txs[i] = txs[i]
+	}
+	if _, err := cs.txPool.ImportTransactions(ctx, request, &grpc.EmptyCallOption{}); err != nil {
+		return fmt.Errorf("import transactions: %v", err)
+	}
+	return nil
+}
+
 func getAncestor(db ethdb.Database, hash common.Hash, number, ancestor uint64, maxNonCanonical *uint64) (common.Hash, uint64) {
 	if ancestor > number {
 		return common.Hash{}, 0
@@ -641,7 +630,7 @@ func queryHeaders(db ethdb.Database, query *eth.GetBlockHeadersPacket) ([]*types
 	return headers, nil
 }
 
-func (cs *ControlServerImpl) getBlockHeaders(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) getBlockHeaders(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	var query eth.GetBlockHeadersPacket
 	if err := rlp.DecodeBytes(inreq.Data, &query); err != nil {
 		return fmt.Errorf("decoding GetBlockHeader: %v, data: %x", err, inreq.Data)
@@ -657,13 +646,14 @@ func (cs *ControlServerImpl) getBlockHeaders(ctx context.Context, inreq *proto_s
 	outreq := proto_sentry.SendMessageByIdRequest{
 		PeerId: inreq.PeerId,
 		Data: &proto_sentry.OutboundMessageData{
-			Id:   proto_sentry.MessageId_BlockHeaders,
-			Data: b,
+			Id:        proto_sentry.MessageId_BlockHeaders,
+			Data:      b,
+			RequestId: inreq.RequestId,
 		},
 	}
 	//nolint:govet
 	callCtx, _ := context.WithCancel(ctx)
-	_, err = cs.sentryClient.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
+	_, err = sentry.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
 	if err != nil {
 		return fmt.Errorf("send header response: %v", err)
 	}
@@ -671,7 +661,7 @@ func (cs *ControlServerImpl) getBlockHeaders(ctx context.Context, inreq *proto_s
 	return nil
 }
 
-func (cs *ControlServerImpl) getBlockBodies(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) getBlockBodies(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	// Decode the retrieval message
 	msgStream := rlp.NewStream(bytes.NewReader(inreq.Data), uint64(len(inreq.Data)))
 	if _, err := msgStream.List(); err != nil {
@@ -713,13 +703,14 @@ func (cs *ControlServerImpl) getBlockBodies(ctx context.Context, inreq *proto_se
 	outreq := proto_sentry.SendMessageByIdRequest{
 		PeerId: inreq.PeerId,
 		Data: &proto_sentry.OutboundMessageData{
-			Id:   proto_sentry.MessageId_BlockBodies,
-			Data: b,
+			Id:        proto_sentry.MessageId_BlockBodies,
+			Data:      b,
+			RequestId: inreq.RequestId,
 		},
 	}
 	//nolint:govet
 	callCtx, _ := context.WithCancel(ctx)
-	_, err = cs.sentryClient.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
+	_, err = sentry.SendMessageById(callCtx, &outreq, &grpc.EmptyCallOption{})
 	if err != nil {
 		return fmt.Errorf("send bodies response: %v", err)
 	}
@@ -727,7 +718,7 @@ func (cs *ControlServerImpl) getBlockBodies(ctx context.Context, inreq *proto_se
 	return nil
 }
 
-func (cs *ControlServerImpl) handleInboundMessage(ctx context.Context, inreq *proto_sentry.InboundMessage) error {
+func (cs *ControlServerImpl) handleInboundMessage(ctx context.Context, inreq *proto_sentry.InboundMessage, sentry proto_sentry.SentryClient) error {
 	defer func() {
 		select {
 		case cs.requestWakeUpHeaders <- struct{}{}:
@@ -740,17 +731,21 @@ func (cs *ControlServerImpl) handleInboundMessage(ctx context.Context, inreq *pr
 	}()
 	switch inreq.Id {
 	case proto_sentry.MessageId_NewBlockHashes:
-		return cs.newBlockHashes(ctx, inreq)
+		return cs.newBlockHashes(ctx, inreq, sentry)
 	case proto_sentry.MessageId_BlockHeaders:
-		return cs.blockHeaders(ctx, inreq)
+		return cs.blockHeaders(ctx, inreq, sentry)
 	case proto_sentry.MessageId_NewBlock:
-		return cs.newBlock(ctx, inreq)
+		return cs.newBlock(ctx, inreq, sentry)
 	case proto_sentry.MessageId_BlockBodies:
 		return cs.blockBodies(inreq)
 	case proto_sentry.MessageId_GetBlockHeaders:
-		return cs.getBlockHeaders(ctx, inreq)
+		return cs.getBlockHeaders(ctx, inreq, sentry)
 	case proto_sentry.MessageId_GetBlockBodies:
-		return cs.getBlockBodies(ctx, inreq)
+		return cs.getBlockBodies(ctx, inreq, sentry)
+	case proto_sentry.MessageId_NewPooledTransactionHashes:
+		return cs.newPooledTransactionHashes(ctx, inreq, sentry)
+	case proto_sentry.MessageId_Transactions, proto_sentry.MessageId_PooledTransactions:
+		return cs.transactions(ctx, inreq)
 	default:
 		return fmt.Errorf("not implemented for message Id: %s", inreq.Id)
 	}
@@ -772,28 +767,22 @@ func (cs *ControlServerImpl) sendHeaderRequest(ctx context.Context, req *headerd
 		log.Error("Could not encode header request", "err", err)
 		return nil
 	}
-	minBlock := req.Number
-	if !req.Reverse {
-		minBlock = req.Number + req.Length*req.Skip
-	}
-	outreq := proto_sentry.SendMessageByMinBlockRequest{
-		MinBlock: minBlock,
-		Data: &proto_sentry.OutboundMessageData{
-			Id:   proto_sentry.MessageId_GetBlockHeaders,
-			Data: bytes,
-		},
+	data := &proto_sentry.OutboundMessageData{
+		Id:   proto_sentry.MessageId_GetBlockHeaders,
+		Data: bytes,
 	}
-	//nolint:govet
-	callCtx, _ := context.WithCancel(ctx)
-	sentPeers, err1 := cs.sentryClient.SendMessageByMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{})
-	if err1 != nil {
-		log.Error("Could not send header request", "err", err1)
-		return nil
+	// Prefer the best scored idle peer, the sentries pick a peer on their own if there is none
+	if peer := cs.hd.SelectPeer(req); peer != nil {
+		if cs.sendMessageToPeer(ctx, peer, data) {
+			return peer
+		}
+		cs.hd.RemovePeer(peer)
 	}
-	if sentPeers == nil || len(sentPeers.Peers) == 0 {
-		return nil
+	outreq := proto_sentry.SendMessageByMinBlockRequest{
+		MinBlock: req.MinBlock(),
+		Data:     data,
 	}
-	return gointerfaces.ConvertH512ToBytes(sentPeers.Peers[0])
+	return cs.sendMessageByMinBlock(ctx, &outreq)
 }
 
 func (cs *ControlServerImpl) sendBodyRequest(ctx context.Context, req *bodydownload.BodyRequest) []byte {
@@ -812,24 +801,16 @@ func (cs *ControlServerImpl) sendBodyRequest(ctx context.Context, req *bodydownl
 			Data: bytes,
 		},
 	}
-	//nolint:govet
-	callCtx, _ := context.WithCancel(ctx)
-	sentPeers, err1 := cs.sentryClient.SendMessageByMinBlock(callCtx, &outreq, &grpc.EmptyCallOption{})
-	if err1 != nil {
-		log.Error("Could not send block bodies request", "err", err1)
-		return nil
-	}
-	if sentPeers == nil || len(sentPeers.Peers) == 0 {
-		return nil
-	}
-	return gointerfaces.ConvertH512ToBytes(sentPeers.Peers[0])
+	return cs.sendMessageByMinBlock(ctx, &outreq)
 }
 
 func (cs *ControlServerImpl) penalise(ctx context.Context, peer []byte) {
 	penalizeReq := proto_sentry.PenalizePeerRequest{PeerId: gointerfaces.ConvertBytesToH512(peer), Penalty: proto_sentry.PenaltyKind_Kick}
-	//nolint:govet
-	callCtx, _ := context.WithCancel(ctx)
-	if _, err := cs.sentryClient.PenalizePeer(callCtx, &penalizeReq, &grpc.EmptyCallOption{}); err != nil {
-		log.Error("Could not penalise", "peer", peer, "error", err)
+	cs.peerSentries.Delete(string(peer))
+	// The peer is only known to the sentry it is connected to, the other sentries ignore the penalty
+	for _, sentry := range cs.getSentries() {
+		if _, err := sentry.client.PenalizePeer(ctx, &penalizeReq, &grpc.EmptyCallOption{}); err != nil {
+			log.Error("Could not penalise", "sentry", sentry.addr, "peer", peer, "error", err)
+		}
 	}
 }
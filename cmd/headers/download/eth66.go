@@ -0,0 +1,129 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/ledgerwatch/turbo-geth/eth/protocols/eth"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// requestResponses maps the messages carrying a request id since eth/66 to the codes of the
+// responses, the responses map to themselves
+var requestResponses = map[uint64]uint64{
+	eth.GetBlockHeadersMsg:       eth.BlockHeadersMsg,
+	eth.BlockHeadersMsg:          eth.BlockHeadersMsg,
+	eth.GetBlockBodiesMsg:        eth.BlockBodiesMsg,
+	eth.BlockBodiesMsg:           eth.BlockBodiesMsg,
+	eth.GetNodeDataMsg:           eth.NodeDataMsg,
+	eth.NodeDataMsg:              eth.NodeDataMsg,
+	eth.GetReceiptsMsg:           eth.ReceiptsMsg,
+	eth.ReceiptsMsg:              eth.ReceiptsMsg,
+	eth.GetPooledTransactionsMsg: eth.PooledTransactionsMsg,
+	eth.PooledTransactionsMsg:    eth.PooledTransactionsMsg,
+}
+
+// peerMetrics are the metrics of the peers speaking one version of the eth protocol
+type peerMetrics struct {
+	peers   metrics.Gauge
+	ingress metrics.Meter
+	egress  metrics.Meter
+}
+
+var versionMetrics = map[uint]*peerMetrics{}
+
+func init() {
+	for _, version := range []uint{eth.ETH65, eth.ETH66} {
+		versionMetrics[version] = &peerMetrics{
+			peers:   metrics.NewRegisteredGauge(fmt.Sprintf("sentry/eth%d/peers", version), nil),
+			ingress: metrics.NewRegisteredMeter(fmt.Sprintf("sentry/eth%d/ingress", version), nil),
+			egress:  metrics.NewRegisteredMeter(fmt.Sprintf("sentry/eth%d/egress", version), nil),
+		}
+	}
+}
+
+// peerRW is the message stream of a peer together with the version of the eth protocol negotiated
+// with it. The messages of the sentry are always in the eth/65 format, for the eth/66 peers the
+// request ids are added to the outgoing messages and removed from the incoming ones.
+type peerRW struct {
+	p2p.MsgReadWriter
+	version uint
+	metrics *peerMetrics
+}
+
+func newPeerRW(rw p2p.MsgReadWriter, version uint) *peerRW {
+	return &peerRW{MsgReadWriter: rw, version: version, metrics: versionMetrics[version]}
+}
+
+// readMsg reads the next message from the peer, removing the request id from the eth/66 messages.
+// The request id is returned to be put into the response to the message, it is 0 for the messages
+// without one
+func (p *peerRW) readMsg() (p2p.Msg, uint64, []byte, error) {
+	msg, err := p.ReadMsg()
+	if err != nil {
+		return msg, 0, nil, err
+	}
+	p.metrics.ingress.Mark(1)
+	if msg.Size > eth.ProtocolMaxMsgSize {
+		msg.Discard()
+		return msg, 0, nil, fmt.Errorf("message is too large %d, limit %d", msg.Size, eth.ProtocolMaxMsgSize)
+	}
+	b := make([]byte, msg.Size)
+	_, err = io.ReadFull(msg.Payload, b)
+	msg.Discard()
+	if err != nil {
+		return msg, 0, nil, fmt.Errorf("reading msg into bytes: %w", err)
+	}
+	if _, ok := requestResponses[msg.Code]; p.version < eth.ETH66 || !ok {
+		return msg, 0, b, nil
+	}
+	requestId, payload, err := unwrapRequestId(b)
+	if err != nil {
+		return msg, 0, nil, fmt.Errorf("message %d: %w", msg.Code, err)
+	}
+	return msg, requestId, payload, nil
+}
+
+// writeMsg sends the message to the peer, adding the request id for the eth/66 peers. The requests
+// get new ids, the responses get the id of the request they answer, as returned by readMsg
+func (p *peerRW) writeMsg(code uint64, requestId uint64, data []byte) error {
+	if response, ok := requestResponses[code]; ok && p.version >= eth.ETH66 {
+		if response != code {
+			requestId = rand.Uint64() //nolint:gosec
+		}
+		var err error
+		if data, err = wrapRequestId(requestId, data); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteMsg(p2p.Msg{Code: code, Size: uint32(len(data)), Payload: bytes.NewReader(data)}); err != nil {
+		return err
+	}
+	p.metrics.egress.Mark(1)
+	return nil
+}
+
+// wrapRequestId turns the RLP encoded eth/65 message into the eth/66 one: [request_id, message]
+func wrapRequestId(requestId uint64, payload []byte) ([]byte, error) {
+	return rlp.EncodeToBytes([]rlp.RawValue{rlp.AppendUint64(nil, requestId), payload})
+}
+
+// unwrapRequestId splits the RLP encoded eth/66 message into the request id and the eth/65 message
+func unwrapRequestId(b []byte) (uint64, []byte, error) {
+	content, _, err := rlp.SplitList(b)
+	if err != nil {
+		return 0, nil, fmt.Errorf("eth/66 message is not a list: %w", err)
+	}
+	requestId, payload, err := rlp.SplitUint64(content)
+	if err != nil {
+		return 0, nil, fmt.Errorf("eth/66 request id: %w", err)
+	}
+	if _, _, rest, err := rlp.Split(payload); err != nil || len(rest) > 0 {
+		return 0, nil, fmt.Errorf("eth/66 message must have exactly two elements")
+	}
+	return requestId, payload, nil
+}
@@ -0,0 +1,150 @@
+package download
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/eth/protocols/eth"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapRequestId(t *testing.T) {
+	query := &eth.GetBlockHeadersPacket{Origin: eth.HashOrNumber{Number: 100}, Amount: 10, Skip: 1}
+	payload, err := rlp.EncodeToBytes(query)
+	require.NoError(t, err)
+	for _, requestId := range []uint64{0, 1, 127, 128, 1 << 40, ^uint64(0)} {
+		b, err := wrapRequestId(requestId, payload)
+		require.NoError(t, err)
+		// The same encoding as the one of the eth/66 packets
+		expected, err := rlp.EncodeToBytes(&eth.GetBlockHeadersPacket66{RequestId: requestId, GetBlockHeadersPacket: query})
+		require.NoError(t, err)
+		assert.Equal(t, expected, b)
+
+		id, unwrapped, err := unwrapRequestId(b)
+		require.NoError(t, err)
+		assert.Equal(t, requestId, id)
+		assert.Equal(t, payload, unwrapped)
+	}
+}
+
+func TestUnwrapRequestId(t *testing.T) {
+	hashes := []common.Hash{{1}, {2}}
+	b, err := rlp.EncodeToBytes(&eth.GetBlockBodiesPacket66{RequestId: 42, GetBlockBodiesPacket: hashes})
+	require.NoError(t, err)
+	requestId, payload, err := unwrapRequestId(b)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), requestId)
+	var decoded eth.GetBlockBodiesPacket
+	require.NoError(t, rlp.DecodeBytes(payload, &decoded))
+	assert.Equal(t, eth.GetBlockBodiesPacket(hashes), decoded)
+
+	for name, msg := range map[string]interface{}{
+		"not a list":     uint64(42),
+		"id not integer": []interface{}{[]uint{1}, hashes},
+		"no message":     []interface{}{uint64(42)},
+		"extra element":  []interface{}{uint64(42), hashes, hashes},
+	} {
+		b, err := rlp.EncodeToBytes(msg)
+		require.NoError(t, err)
+		_, _, err = unwrapRequestId(b)
+		assert.Error(t, err, name)
+	}
+}
+
+// peerRWPipe connects peerRW of the given version to the message stream of the remote peer
+func peerRWPipe(t *testing.T, version uint) (*peerRW, p2p.MsgReadWriter) {
+	local, remote := p2p.MsgPipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	return newPeerRW(local, version), remote
+}
+
+// sendAsync writes the message to the pipe without waiting for it to be read
+func sendAsync(t *testing.T, rw p2p.MsgWriter, code uint64, data interface{}) {
+	errc := make(chan error, 1)
+	go func() { errc <- p2p.Send(rw, code, data) }()
+	t.Cleanup(func() { require.NoError(t, <-errc) })
+}
+
+func readRemote(t *testing.T, rw p2p.MsgReader, code uint64) []byte {
+	msg, err := rw.ReadMsg()
+	require.NoError(t, err)
+	require.Equal(t, code, msg.Code)
+	b, err := ioutil.ReadAll(msg.Payload)
+	require.NoError(t, err)
+	return b
+}
+
+func TestPeerRWResponsesCarryRequestIds(t *testing.T) {
+	p, remote := peerRWPipe(t, eth.ETH66)
+	// Read three requests of the peer and answer them in a different order, leaving one unanswered
+	var requestIds []uint64
+	for _, id := range []uint64{7, 8, 9} {
+		query := &eth.GetBlockHeadersPacket{Origin: eth.HashOrNumber{Number: id}, Amount: 1}
+		sendAsync(t, remote, eth.GetBlockHeadersMsg, &eth.GetBlockHeadersPacket66{RequestId: id, GetBlockHeadersPacket: query})
+		msg, requestId, b, err := p.readMsg()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(eth.GetBlockHeadersMsg), msg.Code)
+		var decoded eth.GetBlockHeadersPacket
+		require.NoError(t, rlp.DecodeBytes(b, &decoded))
+		assert.Equal(t, *query, decoded)
+		requestIds = append(requestIds, requestId)
+	}
+	assert.Equal(t, []uint64{7, 8, 9}, requestIds)
+
+	for _, id := range []uint64{9, 7} {
+		b, err := rlp.EncodeToBytes(eth.BlockHeadersPacket{})
+		require.NoError(t, err)
+		errc := make(chan error, 1)
+		go func(id uint64) { errc <- p.writeMsg(eth.BlockHeadersMsg, id, b) }(id)
+		var response eth.BlockHeadersPacket66
+		require.NoError(t, rlp.DecodeBytes(readRemote(t, remote, eth.BlockHeadersMsg), &response))
+		require.NoError(t, <-errc)
+		assert.Equal(t, id, response.RequestId)
+	}
+}
+
+func TestPeerRWRequestsGetNewIds(t *testing.T) {
+	p, remote := peerRWPipe(t, eth.ETH66)
+	payload, err := rlp.EncodeToBytes(eth.GetBlockBodiesPacket{{1}})
+	require.NoError(t, err)
+	errc := make(chan error, 1)
+	// The id passed with a request is not the id of any request of the peer, a new one is generated
+	go func() { errc <- p.writeMsg(eth.GetBlockBodiesMsg, 0, payload) }()
+	_, unwrapped, err := unwrapRequestId(readRemote(t, remote, eth.GetBlockBodiesMsg))
+	require.NoError(t, err)
+	require.NoError(t, <-errc)
+	assert.Equal(t, payload, unwrapped)
+
+	// The response of the peer keeps its id, it is not the request of the peer
+	sendAsync(t, remote, eth.BlockBodiesMsg, &eth.BlockBodiesPacket66{RequestId: 5})
+	_, requestId, b, err := p.readMsg()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), requestId)
+	var bodies eth.BlockBodiesPacket
+	require.NoError(t, rlp.DecodeBytes(b, &bodies))
+	assert.Empty(t, bodies)
+}
+
+func TestPeerRWEth65(t *testing.T) {
+	p, remote := peerRWPipe(t, eth.ETH65)
+	query := &eth.GetBlockHeadersPacket{Origin: eth.HashOrNumber{Number: 1}, Amount: 1}
+	sendAsync(t, remote, eth.GetBlockHeadersMsg, query)
+	_, requestId, b, err := p.readMsg()
+	require.NoError(t, err)
+	assert.Zero(t, requestId)
+	expected, err := rlp.EncodeToBytes(query)
+	require.NoError(t, err)
+	assert.Equal(t, expected, b)
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.writeMsg(eth.BlockHeadersMsg, 7, expected) }()
+	assert.Equal(t, expected, readRemote(t, remote, eth.BlockHeadersMsg))
+	require.NoError(t, <-errc)
+}
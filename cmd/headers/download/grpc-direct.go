@@ -2,6 +2,7 @@ package download
 
 import (
 	"context"
+	"io"
 
 	"github.com/golang/protobuf/ptypes/empty"
 	proto_sentry "github.com/ledgerwatch/turbo-geth/gointerfaces/sentry"
@@ -73,7 +74,10 @@ type SentryReceiveClientDirect struct {
 }
 
 func (c *SentryReceiveClientDirect) Recv() (*proto_sentry.InboundMessage, error) {
-	m := <-c.messageCh
+	m, ok := <-c.messageCh
+	if !ok {
+		return nil, io.EOF
+	}
 	return m, nil
 }
 
@@ -0,0 +1,213 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	proto_sentry "github.com/ledgerwatch/turbo-geth/gointerfaces/sentry"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"google.golang.org/grpc"
+)
+
+// directSentryAddr is the address of the sentry running in the same process as the downloader
+const directSentryAddr = "direct"
+
+// sentryConn is a sentry attached to the control server
+type sentryConn struct {
+	addr   string
+	client proto_sentry.SentryClient
+	conn   *grpc.ClientConn // nil for the sentry in the same process
+	cancel context.CancelFunc
+}
+
+// getSentries returns the attached sentries, ordered by the address
+func (cs *ControlServerImpl) getSentries() []*sentryConn {
+	cs.sentriesLock.RLock()
+	defer cs.sentriesLock.RUnlock()
+	sentries := make([]*sentryConn, 0, len(cs.sentries))
+	for _, sentry := range cs.sentries {
+		sentries = append(sentries, sentry)
+	}
+	sort.Slice(sentries, func(i, j int) bool { return sentries[i].addr < sentries[j].addr })
+	return sentries
+}
+
+// addSentry sends the current status to the sentry and starts receiving the messages from it
+func (cs *ControlServerImpl) addSentry(addr string, client proto_sentry.SentryClient, conn *grpc.ClientConn) error {
+	if _, err := client.SetStatus(cs.ctx, cs.statusData(), &grpc.EmptyCallOption{}); err != nil {
+		return fmt.Errorf("setting initial status message for sentry %s: %w", addr, err)
+	}
+	ctx, cancel := context.WithCancel(cs.ctx)
+	sentry := &sentryConn{addr: addr, client: client, conn: conn, cancel: cancel}
+	cs.sentriesLock.Lock()
+	if _, ok := cs.sentries[addr]; ok {
+		cs.sentriesLock.Unlock()
+		cancel()
+		return fmt.Errorf("sentry %s is already attached", addr)
+	}
+	cs.sentries[addr] = sentry
+	cs.sentriesLock.Unlock()
+
+	go cs.receiveLoop(ctx, sentry, "messages", func(ctx context.Context) (proto_sentry.Sentry_ReceiveMessagesClient, error) {
+		return client.ReceiveMessages(ctx, &empty.Empty{}, &grpc.EmptyCallOption{})
+	})
+	go cs.receiveLoop(ctx, sentry, "upload messages", func(ctx context.Context) (proto_sentry.Sentry_ReceiveMessagesClient, error) {
+		return client.ReceiveUploadMessages(ctx, &empty.Empty{}, &grpc.EmptyCallOption{})
+	})
+	if cs.txPool != nil {
+		go cs.receiveLoop(ctx, sentry, "tx messages", func(ctx context.Context) (proto_sentry.Sentry_ReceiveMessagesClient, error) {
+			return client.ReceiveTxMessages(ctx, &empty.Empty{}, &grpc.EmptyCallOption{})
+		})
+	}
+	log.Info("Sentry attached", "sentry", addr)
+	return nil
+}
+
+// receiveLoop handles the messages of the stream opened by receive, reopening it
+// when it breaks, until the sentry is detached
+func (cs *ControlServerImpl) receiveLoop(ctx context.Context, sentry *sentryConn, name string,
+	receive func(ctx context.Context) (proto_sentry.Sentry_ReceiveMessagesClient, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		receiveClient, err := receive(ctx)
+		if err != nil {
+			log.Error("Receive "+name+" failed", "sentry", sentry.addr, "error", err)
+		} else {
+			inreq, err := receiveClient.Recv()
+			for ; err == nil; inreq, err = receiveClient.Recv() {
+				if err1 := cs.handleInboundMessage(ctx, inreq, sentry.client); err1 != nil {
+					log.Error("Handling incoming message", "sentry", sentry.addr, "error", err1)
+				}
+			}
+			if err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Error("Receive "+name+" loop terminated", "sentry", sentry.addr, "error", err)
+			}
+		}
+		// Wait before trying to reconnect to prevent log flooding
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// AttachSentry implements proto_sentry.SentryControlServer
+func (cs *ControlServerImpl) AttachSentry(_ context.Context, req *proto_sentry.SentryAddress) (*empty.Empty, error) {
+	conn, err := grpcSentryClient(cs.ctx, req.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err = cs.addSentry(req.Address, proto_sentry.NewSentryClient(conn), conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &empty.Empty{}, nil
+}
+
+// DetachSentry implements proto_sentry.SentryControlServer
+func (cs *ControlServerImpl) DetachSentry(_ context.Context, req *proto_sentry.SentryAddress) (*empty.Empty, error) {
+	cs.sentriesLock.Lock()
+	sentry, ok := cs.sentries[req.Address]
+	delete(cs.sentries, req.Address)
+	cs.sentriesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("sentry %s is not attached", req.Address)
+	}
+	sentry.cancel()
+	if sentry.conn != nil {
+		if err := sentry.conn.Close(); err != nil {
+			return nil, err
+		}
+	}
+	log.Info("Sentry detached", "sentry", req.Address)
+	return &empty.Empty{}, nil
+}
+
+// Sentries implements proto_sentry.SentryControlServer
+func (cs *ControlServerImpl) Sentries(context.Context, *empty.Empty) (*proto_sentry.SentryAddresses, error) {
+	sentries := cs.getSentries()
+	reply := &proto_sentry.SentryAddresses{Addresses: make([]string, len(sentries))}
+	for i, sentry := range sentries {
+		reply.Addresses[i] = sentry.addr
+	}
+	return reply, nil
+}
+
+// sendMessageByMinBlock sends the request to a peer of one of the sentries, trying the sentries in turns
+// so the requests are spread over all of them. It returns the id of the peer, or nil if no peer was found
+func (cs *ControlServerImpl) sendMessageByMinBlock(ctx context.Context, outreq *proto_sentry.SendMessageByMinBlockRequest) []byte {
+	sentries := cs.getSentries()
+	if len(sentries) == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&cs.nextSentry, 1))
+	for i := range sentries {
+		sentry := sentries[(start+i)%len(sentries)]
+		sentPeers, err := sentry.client.SendMessageByMinBlock(ctx, outreq, &grpc.EmptyCallOption{})
+		if err != nil {
+			log.Error("Could not send request", "sentry", sentry.addr, "message", outreq.Data.Id, "err", err)
+			continue
+		}
+		if sentPeers != nil && len(sentPeers.Peers) > 0 {
+			peer := gointerfaces.ConvertH512ToBytes(sentPeers.Peers[0])
+			cs.peerSentries.Store(string(peer), sentry.client)
+			return peer
+		}
+	}
+	return nil
+}
+
+// sendMessageToPeer sends the request to the peer through the sentry the peer is connected to.
+// It returns false if the sentry of the peer is not known, or the peer is gone
+func (cs *ControlServerImpl) sendMessageToPeer(ctx context.Context, peer []byte, data *proto_sentry.OutboundMessageData) bool {
+	client, ok := cs.peerSentries.Load(string(peer))
+	if !ok {
+		return false
+	}
+	outreq := proto_sentry.SendMessageByIdRequest{PeerId: gointerfaces.ConvertBytesToH512(peer), Data: data}
+	sentPeers, err := client.(proto_sentry.SentryClient).SendMessageById(ctx, &outreq, &grpc.EmptyCallOption{})
+	if err != nil || sentPeers == nil || len(sentPeers.Peers) == 0 {
+		cs.peerSentries.Delete(string(peer))
+		return false
+	}
+	return true
+}
+
+// grpcControlServer serves the SentryControl service on addr, so the sentries can be attached and detached at runtime
+func grpcControlServer(ctx context.Context, addr string, cs *ControlServerImpl) error {
+	log.Info("Starting Sentry control server", "on", addr)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not create Sentry control listener: %w, addr=%s", err, addr)
+	}
+	grpcServer := grpc.NewServer(
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(grpc_recovery.StreamServerInterceptor())),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(grpc_recovery.UnaryServerInterceptor())),
+	)
+	proto_sentry.RegisterSentryControlServer(grpcServer, cs)
+	go func() {
+		if err1 := grpcServer.Serve(lis); err1 != nil {
+			log.Error("Sentry control server fail", "err", err1)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		grpcServer.Stop()
+	}()
+	return nil
+}
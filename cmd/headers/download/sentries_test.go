@@ -0,0 +1,282 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/eth/protocols/eth"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	proto_sentry "github.com/ledgerwatch/turbo-geth/gointerfaces/sentry"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
+	proto_types "github.com/ledgerwatch/turbo-geth/gointerfaces/types"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// fakeSentry is a sentry client recording the calls of the control server. The messages written to inbound and
+// txInbound are received by the control server as if they came from the peers
+type fakeSentry struct {
+	proto_sentry.SentryClient        // the calls which are not faked panic
+	peer                      []byte // returned by SendMessageByMinBlock, no peer is found if nil
+	fail                      bool   // SendMessageByMinBlock fails
+	inbound                   chan *proto_sentry.InboundMessage
+	txInbound                 chan *proto_sentry.InboundMessage
+
+	lock       sync.Mutex
+	statuses   int
+	byMinBlock []*proto_sentry.SendMessageByMinBlockRequest
+	byId       []*proto_sentry.SendMessageByIdRequest
+	streams    int // open receive streams
+}
+
+func newFakeSentry(peer []byte) *fakeSentry {
+	return &fakeSentry{
+		peer:      peer,
+		inbound:   make(chan *proto_sentry.InboundMessage),
+		txInbound: make(chan *proto_sentry.InboundMessage),
+	}
+}
+
+func (s *fakeSentry) SetStatus(context.Context, *proto_sentry.StatusData, ...grpc.CallOption) (*empty.Empty, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.statuses++
+	return &empty.Empty{}, nil
+}
+
+func (s *fakeSentry) SendMessageByMinBlock(_ context.Context, in *proto_sentry.SendMessageByMinBlockRequest, _ ...grpc.CallOption) (*proto_sentry.SentPeers, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.byMinBlock = append(s.byMinBlock, in)
+	if s.fail {
+		return nil, errors.New("sentry is down")
+	}
+	if s.peer == nil {
+		return &proto_sentry.SentPeers{}, nil
+	}
+	return &proto_sentry.SentPeers{Peers: []*proto_types.H512{gointerfaces.ConvertBytesToH512(s.peer)}}, nil
+}
+
+func (s *fakeSentry) SendMessageById(_ context.Context, in *proto_sentry.SendMessageByIdRequest, _ ...grpc.CallOption) (*proto_sentry.SentPeers, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.byId = append(s.byId, in)
+	return &proto_sentry.SentPeers{Peers: []*proto_types.H512{in.PeerId}}, nil
+}
+
+func (s *fakeSentry) ReceiveMessages(ctx context.Context, _ *empty.Empty, _ ...grpc.CallOption) (proto_sentry.Sentry_ReceiveMessagesClient, error) {
+	return s.stream(ctx, s.inbound), nil
+}
+
+func (s *fakeSentry) ReceiveUploadMessages(ctx context.Context, _ *empty.Empty, _ ...grpc.CallOption) (proto_sentry.Sentry_ReceiveUploadMessagesClient, error) {
+	return s.stream(ctx, nil), nil
+}
+
+func (s *fakeSentry) ReceiveTxMessages(ctx context.Context, _ *empty.Empty, _ ...grpc.CallOption) (proto_sentry.Sentry_ReceiveTxMessagesClient, error) {
+	return s.stream(ctx, s.txInbound), nil
+}
+
+func (s *fakeSentry) stream(ctx context.Context, messages chan *proto_sentry.InboundMessage) *fakeStream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.streams++
+	return &fakeStream{ctx: ctx, messages: messages, sentry: s}
+}
+
+func (s *fakeSentry) openStreams() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.streams
+}
+
+func (s *fakeSentry) sentById() []*proto_sentry.SendMessageByIdRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*proto_sentry.SendMessageByIdRequest(nil), s.byId...)
+}
+
+// fakeStream delivers the messages until the context of the stream is canceled
+type fakeStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	messages chan *proto_sentry.InboundMessage
+	sentry   *fakeSentry
+}
+
+func (s *fakeStream) Recv() (*proto_sentry.InboundMessage, error) {
+	select {
+	case msg := <-s.messages:
+		return msg, nil
+	case <-s.ctx.Done():
+		s.sentry.lock.Lock()
+		s.sentry.streams--
+		s.sentry.lock.Unlock()
+		return nil, s.ctx.Err()
+	}
+}
+
+// fakeTxPool knows the transactions of the known hashes and records the imported ones
+type fakeTxPool struct {
+	txpool.TxpoolClient
+	known    map[common.Hash]bool
+	imported chan [][]byte
+}
+
+func (p *fakeTxPool) FindUnknownTransactions(_ context.Context, in *txpool.TxHashes, _ ...grpc.CallOption) (*txpool.TxHashes, error) {
+	unknown := &txpool.TxHashes{}
+	for _, h := range in.Hashes {
+		if !p.known[gointerfaces.ConvertH256ToHash(h)] {
+			unknown.Hashes = append(unknown.Hashes, h)
+		}
+	}
+	return unknown, nil
+}
+
+func (p *fakeTxPool) ImportTransactions(_ context.Context, in *txpool.ImportRequest, _ ...grpc.CallOption) (*txpool.ImportReply, error) {
+	p.imported <- in.Txs
+	return &txpool.ImportReply{}, nil
+}
+
+func newTestControlServer(t *testing.T, txPool txpool.TxpoolClient) *ControlServerImpl {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &ControlServerImpl{
+		ctx:                  ctx,
+		sentries:             make(map[string]*sentryConn),
+		txPool:               txPool,
+		requestWakeUpHeaders: make(chan struct{}, 1),
+		requestWakeUpBodies:  make(chan struct{}, 1),
+		headTd:               uint256.NewInt(),
+	}
+}
+
+func sentryAddresses(t *testing.T, cs *ControlServerImpl) []string {
+	reply, err := cs.Sentries(context.Background(), &empty.Empty{})
+	require.NoError(t, err)
+	return reply.Addresses
+}
+
+func TestAttachDetachSentries(t *testing.T) {
+	cs := newTestControlServer(t, &fakeTxPool{})
+	b, a := newFakeSentry(nil), newFakeSentry(nil)
+	require.NoError(t, cs.addSentry("b:9091", b, nil))
+	require.NoError(t, cs.addSentry("a:9091", a, nil))
+	assert.Error(t, cs.addSentry("a:9091", newFakeSentry(nil), nil))
+	assert.Equal(t, []string{"a:9091", "b:9091"}, sentryAddresses(t, cs))
+
+	// The sentries get the status and the control server receives the messages, the upload messages and the
+	// transactions from them
+	assert.Equal(t, 1, a.statuses)
+	assert.Equal(t, 1, b.statuses)
+	require.Eventually(t, func() bool { return a.openStreams() == 3 && b.openStreams() == 3 }, 5*time.Second, 10*time.Millisecond)
+	cs.updateHead(context.Background(), 10, common.Hash{1}, uint256.NewInt().SetUint64(100))
+	assert.Equal(t, 2, a.statuses)
+	assert.Equal(t, 2, b.statuses)
+
+	// The detached sentry doesn't get anything anymore, its streams are closed
+	_, err := cs.DetachSentry(context.Background(), &proto_sentry.SentryAddress{Address: "a:9091"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b:9091"}, sentryAddresses(t, cs))
+	require.Eventually(t, func() bool { return a.openStreams() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, b.openStreams())
+	cs.updateHead(context.Background(), 11, common.Hash{2}, uint256.NewInt().SetUint64(200))
+	assert.Equal(t, 2, a.statuses)
+	assert.Equal(t, 3, b.statuses)
+	_, err = cs.DetachSentry(context.Background(), &proto_sentry.SentryAddress{Address: "a:9091"})
+	assert.Error(t, err)
+
+	// The address is free to be attached again
+	require.NoError(t, cs.addSentry("a:9091", newFakeSentry(nil), nil))
+	assert.Equal(t, []string{"a:9091", "b:9091"}, sentryAddresses(t, cs))
+}
+
+func TestSendMessageByMinBlockSpreadsRequests(t *testing.T) {
+	cs := newTestControlServer(t, nil)
+	sentries := []*fakeSentry{newFakeSentry([]byte{1}), newFakeSentry([]byte{2}), newFakeSentry([]byte{3})}
+	for i, sentry := range sentries {
+		require.NoError(t, cs.addSentry(string(rune('a'+i)), sentry, nil))
+	}
+	outreq := &proto_sentry.SendMessageByMinBlockRequest{Data: &proto_sentry.OutboundMessageData{Id: proto_sentry.MessageId_GetBlockHeaders}}
+	peers := map[byte]int{}
+	for i := 0; i < 6; i++ {
+		peer := cs.sendMessageByMinBlock(context.Background(), outreq)
+		require.Len(t, peer, 64)
+		peers[peer[0]]++
+	}
+	// Each of the sentries gets a third of the requests
+	assert.Equal(t, map[byte]int{1: 2, 2: 2, 3: 2}, peers)
+	for _, sentry := range sentries {
+		assert.Len(t, sentry.byMinBlock, 2)
+	}
+
+	// The requests to the chosen peer go to the sentry the peer was found by
+	peer := cs.sendMessageByMinBlock(context.Background(), outreq)
+	data := &proto_sentry.OutboundMessageData{Id: proto_sentry.MessageId_GetBlockBodies}
+	require.True(t, cs.sendMessageToPeer(context.Background(), peer, data))
+	for _, sentry := range sentries {
+		if sentry.peer[0] == peer[0] {
+			require.Len(t, sentry.byId, 1)
+			assert.Equal(t, peer, gointerfaces.ConvertH512ToBytes(sentry.byId[0].PeerId))
+		} else {
+			assert.Empty(t, sentry.byId)
+		}
+	}
+	assert.False(t, cs.sendMessageToPeer(context.Background(), make([]byte, 64), data))
+
+	// The sentries failing or without the peers are skipped
+	sentries[0].fail = true
+	sentries[1].peer = nil
+	for i := 0; i < 3; i++ {
+		peer := cs.sendMessageByMinBlock(context.Background(), outreq)
+		require.Len(t, peer, 64)
+		assert.Equal(t, byte(3), peer[0])
+	}
+	sentries[2].peer = nil
+	assert.Nil(t, cs.sendMessageByMinBlock(context.Background(), outreq))
+	assert.Nil(t, newTestControlServer(t, nil).sendMessageByMinBlock(context.Background(), outreq))
+}
+
+func TestForwardTransactions(t *testing.T) {
+	known, unknown := common.Hash{1}, common.Hash{2}
+	pool := &fakeTxPool{known: map[common.Hash]bool{known: true}, imported: make(chan [][]byte, 1)}
+	cs := newTestControlServer(t, pool)
+	a, b := newFakeSentry(nil), newFakeSentry(nil)
+	require.NoError(t, cs.addSentry("a", a, nil))
+	require.NoError(t, cs.addSentry("b", b, nil))
+
+	// The unknown announced transactions are requested from the announcing peer through its sentry
+	announced, err := rlp.EncodeToBytes(eth.NewPooledTransactionHashesPacket{known, unknown})
+	require.NoError(t, err)
+	peer := gointerfaces.ConvertBytesToH512(append([]byte{7}, make([]byte, 63)...))
+	b.txInbound <- &proto_sentry.InboundMessage{Id: proto_sentry.MessageId_NewPooledTransactionHashes, PeerId: peer, Data: announced}
+	require.Eventually(t, func() bool { return len(b.sentById()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	request := b.sentById()[0]
+	assert.Equal(t, proto_sentry.MessageId_GetPooledTransactions, request.Data.Id)
+	assert.Equal(t, gointerfaces.ConvertH512ToBytes(peer), gointerfaces.ConvertH512ToBytes(request.PeerId))
+	var requested eth.GetPooledTransactionsPacket
+	require.NoError(t, rlp.DecodeBytes(request.Data.Data, &requested))
+	assert.Equal(t, eth.GetPooledTransactionsPacket{unknown}, requested)
+	assert.Empty(t, a.sentById())
+
+	// The gossiped and the requested transactions are imported into the pool
+	txs := []rlp.RawValue{{0xc1, 0x01}, {0xc1, 0x02}}
+	for _, id := range []proto_sentry.MessageId{proto_sentry.MessageId_Transactions, proto_sentry.MessageId_PooledTransactions} {
+		data, err := rlp.EncodeToBytes(txs)
+		require.NoError(t, err)
+		a.txInbound <- &proto_sentry.InboundMessage{Id: id, PeerId: peer, Data: data}
+		select {
+		case imported := <-pool.imported:
+			assert.Equal(t, [][]byte{txs[0], txs[1]}, imported, id.String())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s are not imported", id)
+		}
+	}
+}
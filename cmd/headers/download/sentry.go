@@ -1,16 +1,13 @@
 package download
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"os/signal"
 	"runtime"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -126,39 +123,47 @@ func makeP2PServer(
 			p2pConfig.BootstrapNodes = append(p2pConfig.BootstrapNodes, node)
 		}
 	}
-	pMap := map[string]p2p.Protocol{
-		eth.ProtocolName: {
-			Name:           eth.ProtocolName,
-			Version:        eth.ProtocolVersions[1],
-			Length:         17,
-			DialCandidates: dialCandidates,
+	ethProtocol := func(version uint) p2p.Protocol {
+		return p2p.Protocol{
+			Name:    eth.ProtocolName,
+			Version: version,
+			Length:  17,
 			Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
 				peerID := peer.ID().String()
-				log.Info(fmt.Sprintf("[%s] Start with peer", peerID))
-				peerRwMap.Store(peerID, rw)
+				log.Info(fmt.Sprintf("[%s] Start with peer", peerID), "version", version)
+				prw := newPeerRW(rw, version)
+				peerRwMap.Store(peerID, prw)
+				prw.metrics.peers.Inc(1)
 				if err := runPeer(
 					ctx,
 					peerHeightMap,
 					peerTimeMap,
 					peerRwMap,
 					peer,
-					rw,
-					eth.ProtocolVersions[1], // version == eth65
-					eth.ProtocolVersions[2], // minVersion == eth64
+					prw,
+					version,
+					eth.ETH64, // minVersion
 					ss,
 				); err != nil {
 					log.Info(fmt.Sprintf("[%s] Error while running peer: %v", peerID, err))
 				}
+				prw.metrics.peers.Dec(1)
 				peerHeightMap.Delete(peerID)
 				peerTimeMap.Delete(peerID)
 				peerRwMap.Delete(peerID)
 				return nil
 			},
-		},
+		}
+	}
+	// eth/66 and eth/65 run side by side, the highest version supported by the peer is used
+	eth66, eth65 := ethProtocol(eth.ETH66), ethProtocol(eth.ETH65)
+	eth66.DialCandidates = dialCandidates
+	pMap := map[string][]p2p.Protocol{
+		eth.ProtocolName: {eth66, eth65},
 	}
 
 	for _, protocolName := range protocols {
-		p2pConfig.Protocols = append(p2pConfig.Protocols, pMap[protocolName])
+		p2pConfig.Protocols = append(p2pConfig.Protocols, pMap[protocolName]...)
 	}
 	return &p2p.Server{Config: p2pConfig}, nil
 }
@@ -173,7 +178,7 @@ func runPeer(
 	peerTimeMap *sync.Map,
 	peerRwMap *sync.Map,
 	peer *p2p.Peer,
-	rw p2p.MsgReadWriter,
+	rw *peerRW,
 	version uint,
 	minVersion uint,
 	ss *SentryServerImpl,
@@ -237,47 +242,26 @@ func runPeer(
 		if _, ok := peerRwMap.Load(peerID); !ok {
 			return fmt.Errorf("peer has been penalized")
 		}
-		msg, err = rw.ReadMsg()
+		msg, requestId, b, err := rw.readMsg()
 		if err != nil {
-			return fmt.Errorf("reading message: %v", err)
-		}
-		if msg.Size > eth.ProtocolMaxMsgSize {
-			msg.Discard()
-			return fmt.Errorf("message is too large %d, limit %d", msg.Size, eth.ProtocolMaxMsgSize)
+			return fmt.Errorf("reading message: %w", err)
 		}
 		switch msg.Code {
 		case eth.StatusMsg:
-			msg.Discard()
 			// Status messages should never arrive after the handshake
 			return fmt.Errorf("uncontrolled status message")
 		case eth.GetBlockHeadersMsg:
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receiveUpload(&StreamMsg{b, peerID, "GetBlockHeadersMsg", proto_sentry.MessageId_GetBlockHeaders})
+			ss.receiveUpload(&StreamMsg{b, peerID, "GetBlockHeadersMsg", proto_sentry.MessageId_GetBlockHeaders, requestId})
 		case eth.BlockHeadersMsg:
 			// Peer responded or sent message - reset the "back off" timer
 			peerTimeMap.Store(peerID, time.Now().Unix())
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receive(&StreamMsg{b, peerID, "BlockHeadersMsg", proto_sentry.MessageId_BlockHeaders})
+			ss.receive(&StreamMsg{b, peerID, "BlockHeadersMsg", proto_sentry.MessageId_BlockHeaders, requestId})
 		case eth.GetBlockBodiesMsg:
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receiveUpload(&StreamMsg{b, peerID, "GetBlockBodiesMsg", proto_sentry.MessageId_GetBlockBodies})
+			ss.receiveUpload(&StreamMsg{b, peerID, "GetBlockBodiesMsg", proto_sentry.MessageId_GetBlockBodies, requestId})
 		case eth.BlockBodiesMsg:
 			// Peer responded or sent message - reset the "back off" timer
 			peerTimeMap.Store(peerID, time.Now().Unix())
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receive(&StreamMsg{b, peerID, "BlockBodiesMsg", proto_sentry.MessageId_BlockBodies})
+			ss.receive(&StreamMsg{b, peerID, "BlockBodiesMsg", proto_sentry.MessageId_BlockBodies, requestId})
 		case eth.GetNodeDataMsg:
 			//log.Info(fmt.Sprintf("[%s] GetNodeData", peerID))
 		case eth.GetReceiptsMsg:
@@ -285,52 +269,20 @@ func runPeer(
 		case eth.ReceiptsMsg:
 			//log.Info(fmt.Sprintf("[%s] ReceiptsMsg", peerID))
 		case eth.NewBlockHashesMsg:
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receive(&StreamMsg{b, peerID, "NewBlockHashesMsg", proto_sentry.MessageId_NewBlockHashes})
+			ss.receive(&StreamMsg{b, peerID, "NewBlockHashesMsg", proto_sentry.MessageId_NewBlockHashes, requestId})
 		case eth.NewBlockMsg:
-			b := make([]byte, msg.Size)
-			if _, err := io.ReadFull(msg.Payload, b); err != nil {
-				log.Error(fmt.Sprintf("%s: reading msg into bytes: %v", peerID, err))
-			}
-			ss.receive(&StreamMsg{b, peerID, "NewBlockMsg", proto_sentry.MessageId_NewBlock})
+			ss.receive(&StreamMsg{b, peerID, "NewBlockMsg", proto_sentry.MessageId_NewBlock, requestId})
 		case eth.NewPooledTransactionHashesMsg:
-			var hashes []common.Hash
-			if err := msg.Decode(&hashes); err != nil {
-				return fmt.Errorf("decode NewPooledTransactionHashesMsg %v: %v", msg, err)
-			}
-			var hashesStr strings.Builder
-			for _, hash := range hashes {
-				if hashesStr.Len() > 0 {
-					hashesStr.WriteString(",")
-				}
-				hashesStr.WriteString(fmt.Sprintf("%x-%x", hash[:4], hash[28:]))
-			}
-			//log.Info(fmt.Sprintf("[%s] NewPooledTransactionHashesMsg {%s}", peerID, hashesStr.String()))
+			ss.receiveTx(&StreamMsg{b, peerID, "NewPooledTransactionHashesMsg", proto_sentry.MessageId_NewPooledTransactionHashes, requestId})
 		case eth.GetPooledTransactionsMsg:
 			//log.Info(fmt.Sprintf("[%s] GetPooledTransactionsMsg", peerID)
 		case eth.TransactionsMsg:
-			var txs []*types.Transaction
-			if err := msg.Decode(&txs); err != nil {
-				return fmt.Errorf("decode TransactionMsg %v: %v", msg, err)
-			}
-			var hashesStr strings.Builder
-			for _, tx := range txs {
-				if hashesStr.Len() > 0 {
-					hashesStr.WriteString(",")
-				}
-				hash := tx.Hash()
-				hashesStr.WriteString(fmt.Sprintf("%x-%x", hash[:4], hash[28:]))
-			}
-			//log.Info(fmt.Sprintf("[%s] TransactionMsg {%s}", peerID, hashesStr.String()))
+			ss.receiveTx(&StreamMsg{b, peerID, "TransactionsMsg", proto_sentry.MessageId_Transactions, requestId})
 		case eth.PooledTransactionsMsg:
-			//log.Info(fmt.Sprintf("[%s] PooledTransactionsMsg", peerID)
+			ss.receiveTx(&StreamMsg{b, peerID, "PooledTransactionsMsg", proto_sentry.MessageId_PooledTransactions, requestId})
 		default:
 			log.Error(fmt.Sprintf("[%s] Unknown message code: %d", peerID, msg.Code))
 		}
-		msg.Discard()
 	}
 }
 
@@ -390,8 +342,10 @@ func grpcSentryServer(ctx context.Context, sentryAddr string) (*SentryServerImpl
 	}
 	grpcServer = grpc.NewServer(opts...)
 	sentryServer := &SentryServerImpl{
+		ctx:             ctx,
 		receiveCh:       make(chan StreamMsg, 1024),
 		receiveUploadCh: make(chan StreamMsg, 1024),
+		receiveTxCh:     make(chan StreamMsg, 1024),
 	}
 	proto_sentry.RegisterSentryServer(grpcServer, sentryServer)
 	if metrics.Enabled {
@@ -459,10 +413,11 @@ func Sentry(natSetting string, port int, sentryAddr string, coreAddr string, sta
 }
 
 type StreamMsg struct {
-	b       []byte
-	peerID  string
-	msgName string
-	msgId   proto_sentry.MessageId
+	b         []byte
+	peerID    string
+	msgName   string
+	msgId     proto_sentry.MessageId
+	requestId uint64 // id of the eth/66 request, for the response to the message
 }
 
 type SentryServerImpl struct {
@@ -480,6 +435,7 @@ type SentryServerImpl struct {
 	p2pServer       *p2p.Server
 	receiveCh       chan StreamMsg
 	receiveUploadCh chan StreamMsg
+	receiveTxCh     chan StreamMsg
 	lock            sync.RWMutex
 }
 
@@ -530,7 +486,7 @@ func (ss *SentryServerImpl) SendMessageByMinBlock(_ context.Context, inreq *prot
 		return &proto_sentry.SentPeers{}, nil
 	}
 	rwRaw, _ := ss.peerRwMap.Load(peerID)
-	rw, _ := rwRaw.(p2p.MsgReadWriter)
+	rw, _ := rwRaw.(*peerRW)
 	if rw == nil {
 		ss.peerHeightMap.Delete(peerID)
 		ss.peerTimeMap.Delete(peerID)
@@ -546,7 +502,7 @@ func (ss *SentryServerImpl) SendMessageByMinBlock(_ context.Context, inreq *prot
 	default:
 		return &proto_sentry.SentPeers{}, fmt.Errorf("sendMessageByMinBlock not implemented for message Id: %s", inreq.Data.Id)
 	}
-	if err := rw.WriteMsg(p2p.Msg{Code: msgcode, Size: uint32(len(inreq.Data.Data)), Payload: bytes.NewReader(inreq.Data.Data)}); err != nil {
+	if err := rw.writeMsg(msgcode, inreq.Data.RequestId, inreq.Data.Data); err != nil {
 		ss.peerHeightMap.Delete(peerID)
 		ss.peerTimeMap.Delete(peerID)
 		ss.peerRwMap.Delete(peerID)
@@ -562,7 +518,7 @@ func (ss *SentryServerImpl) SendMessageById(_ context.Context, inreq *proto_sent
 	if !ok {
 		return &proto_sentry.SentPeers{}, fmt.Errorf("peer not found: %s", inreq.PeerId)
 	}
-	rw, _ := rwRaw.(p2p.MsgReadWriter)
+	rw, _ := rwRaw.(*peerRW)
 	var msgcode uint64
 	switch inreq.Data.Id {
 	case proto_sentry.MessageId_GetBlockHeaders:
@@ -571,10 +527,12 @@ func (ss *SentryServerImpl) SendMessageById(_ context.Context, inreq *proto_sent
 		msgcode = eth.BlockHeadersMsg
 	case proto_sentry.MessageId_BlockBodies:
 		msgcode = eth.BlockBodiesMsg
+	case proto_sentry.MessageId_GetPooledTransactions:
+		msgcode = eth.GetPooledTransactionsMsg
 	default:
 		return &proto_sentry.SentPeers{}, fmt.Errorf("sendMessageById not implemented for message Id: %s", inreq.Data.Id)
 	}
-	if err := rw.WriteMsg(p2p.Msg{Code: msgcode, Size: uint32(len(inreq.Data.Data)), Payload: bytes.NewReader(inreq.Data.Data)}); err != nil {
+	if err := rw.writeMsg(msgcode, inreq.Data.RequestId, inreq.Data.Data); err != nil {
 		ss.peerHeightMap.Delete(peerID)
 		ss.peerTimeMap.Delete(peerID)
 		ss.peerRwMap.Delete(peerID)
@@ -639,9 +597,10 @@ func (ss *SentryServerImpl) ReceiveMessages(_ *emptypb.Empty, server proto_sentr
 	ss.recreateReceive()
 	for streamMsg := range ss.receiveCh {
 		outreq := proto_sentry.InboundMessage{
-			PeerId: gointerfaces.ConvertBytesToH512([]byte(streamMsg.peerID)),
-			Id:     streamMsg.msgId,
-			Data:   streamMsg.b,
+			PeerId:    gointerfaces.ConvertBytesToH512([]byte(streamMsg.peerID)),
+			Id:        streamMsg.msgId,
+			Data:      streamMsg.b,
+			RequestId: streamMsg.requestId,
 		}
 		if err := server.Send(&outreq); err != nil {
 			log.Error("Sending msg to core P2P failed", "msg", streamMsg.msgName, "error", err)
@@ -676,9 +635,10 @@ func (ss *SentryServerImpl) ReceiveUploadMessages(_ *emptypb.Empty, server proto
 	ss.recreateReceiveUpload()
 	for streamMsg := range ss.receiveUploadCh {
 		outreq := proto_sentry.InboundMessage{
-			PeerId: gointerfaces.ConvertBytesToH512([]byte(streamMsg.peerID)),
-			Id:     streamMsg.msgId,
-			Data:   streamMsg.b,
+			PeerId:    gointerfaces.ConvertBytesToH512([]byte(streamMsg.peerID)),
+			Id:        streamMsg.msgId,
+			Data:      streamMsg.b,
+			RequestId: streamMsg.requestId,
 		}
 		if err := server.Send(&outreq); err != nil {
 			log.Error("Sending msg to core P2P failed", "msg", streamMsg.msgName, "error", err)
@@ -689,3 +649,39 @@ func (ss *SentryServerImpl) ReceiveUploadMessages(_ *emptypb.Empty, server proto
 	log.Warn("Finished receive upload messages")
 	return nil
 }
+
+func (ss *SentryServerImpl) receiveTx(msg *StreamMsg) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	select {
+	case ss.receiveTxCh <- *msg:
+	default:
+		// TODO make a warning about dropped messages
+	}
+}
+
+func (ss *SentryServerImpl) recreateReceiveTx() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	// Close previous channel and recreate
+	close(ss.receiveTxCh)
+	ss.receiveTxCh = make(chan StreamMsg, 1024)
+}
+
+func (ss *SentryServerImpl) ReceiveTxMessages(_ *emptypb.Empty, server proto_sentry.Sentry_ReceiveTxMessagesServer) error {
+	ss.recreateReceiveTx()
+	for streamMsg := range ss.receiveTxCh {
+		outreq := proto_sentry.InboundMessage{
+			PeerId:    gointerfaces.ConvertBytesToH512([]byte(streamMsg.peerID)),
+			Id:        streamMsg.msgId,
+			Data:      streamMsg.b,
+			RequestId: streamMsg.requestId,
+		}
+		if err := server.Send(&outreq); err != nil {
+			log.Error("Sending msg to core P2P failed", "msg", streamMsg.msgName, "error", err)
+			return err
+		}
+	}
+	log.Warn("Finished receive tx messages")
+	return nil
+}
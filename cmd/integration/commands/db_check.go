@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/spf13/cobra"
+)
+
+var fix bool
+
+func init() {
+	withChaindata(cmdDbCheck)
+	withLmdbFlags(cmdDbCheck)
+	cmdDbCheck.Flags().BoolVar(&fix, "fix", false, "repair the inconsistencies found: fix them in place or reset the stages to rebuild by the next sync")
+	rootCmd.AddCommand(cmdDbCheck)
+}
+
+var cmdDbCheck = &cobra.Command{
+	Use:     "db_check",
+	Short:   "Cross-validate the buckets of the database: history indices, changesets, hashed state, tx lookup and intermediate hashes",
+	Example: "go run ./cmd/integration db_check --chaindata ~/tg/tg/chaindata --fix",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, true)
+		defer db.Close()
+
+		if err := dbCheck(db, ctx); err != nil {
+			log.Error("Error", "err", err)
+			return err
+		}
+		return nil
+	},
+}
+
+// dbCheckResets are the resets of the stages, which repair the issues found by the check
+var dbCheckResets = []struct {
+	stages []stages.SyncStage
+	reset  func(db ethdb.Database) error
+}{
+	{[]stages.SyncStage{stages.AccountHistoryIndex, stages.StorageHistoryIndex}, func(db ethdb.Database) error { return resetHistory(db) }},
+	{[]stages.SyncStage{stages.TxLookup}, func(db ethdb.Database) error { return resetTxLookup(db) }},
+	{[]stages.SyncStage{stages.HashState}, stagedsync.ResetHashState},
+	{[]stages.SyncStage{stages.IntermediateHashes}, stagedsync.ResetIH},
+}
+
+func dbCheck(db ethdb.Database, ctx context.Context) error {
+	issues, err := integrity.DB(db, ctx.Done())
+	if err != nil {
+		return err
+	}
+	if len(issues) == 0 {
+		log.Info("No inconsistencies found")
+		return nil
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if !fix {
+		log.Warn("Inconsistencies found, run with --fix to repair them", "issues", len(issues))
+		return nil
+	}
+
+	tx, err := db.Begin(ctx, ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	toReset := make(map[string]bool)
+	for _, issue := range issues {
+		if issue.Fix != nil {
+			log.Info("Fixing", "check", issue.Check)
+			if err = issue.Fix(tx); err != nil {
+				return fmt.Errorf("fixing %s: %w", issue.Check, err)
+			}
+		}
+		for _, stage := range issue.Reset {
+			toReset[string(stage)] = true
+		}
+	}
+	for _, r := range dbCheckResets {
+		for _, stage := range r.stages {
+			if toReset[string(stage)] {
+				log.Info("Resetting", "stage", string(stage))
+				if err = r.reset(tx); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Info("Repaired, the next sync rebuilds the reset stages")
+	return nil
+}
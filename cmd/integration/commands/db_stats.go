@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/spf13/cobra"
+)
+
+var growthSince time.Duration
+
+func init() {
+	withChaindata(cmdDbStats)
+	cmdDbStats.Flags().DurationVar(&growthSince, "since", 0, "show the growth of the buckets since the stats the node persisted this long ago, see --db.stats.interval")
+	rootCmd.AddCommand(cmdDbStats)
+}
+
+var cmdDbStats = &cobra.Command{
+	Use:     "db_stats",
+	Short:   "Print the key counts and the sizes of the buckets of the database, the largest first",
+	Example: "go run ./cmd/integration db_stats --chaindata ~/tg/tg/chaindata --since 168h",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := openDatabase(chaindata, false)
+		defer db.Close()
+		return db.KV().View(utils.RootContext(), func(tx ethdb.Tx) error {
+			return printDbStats(tx)
+		})
+	},
+}
+
+func printDbStats(tx ethdb.Tx) error {
+	stats, err := ethdb.BucketsStat(tx)
+	if err != nil {
+		return err
+	}
+	var before map[string]ethdb.BucketStats
+	if growthSince > 0 {
+		since := uint64(time.Now().Add(-growthSince).Unix())
+		persisted, err := ethdb.ReadDBStats(tx, since, stats.Time)
+		if err != nil {
+			return err
+		}
+		if len(persisted) == 0 {
+			return fmt.Errorf("no stats persisted since %s", time.Unix(int64(since), 0))
+		}
+		fmt.Printf("Growth since %s\n", time.Unix(int64(persisted[0].Time), 0))
+		before = make(map[string]ethdb.BucketStats, len(persisted[0].Buckets))
+		for _, bucket := range persisted[0].Buckets {
+			before[bucket.Bucket] = bucket
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprint(w, "bucket\tentries\tsize\tbranch\tleaf\toverflow\t")
+	if before != nil {
+		fmt.Fprint(w, "+entries\t+size\t")
+	}
+	fmt.Fprintln(w)
+	for _, bucket := range stats.Buckets {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%d\t", bucket.Bucket, bucket.Entries, datasize.ByteSize(bucket.Size).HR(), bucket.BranchPages, bucket.LeafPages, bucket.OverflowPages)
+		if before != nil {
+			prev := before[bucket.Bucket]
+			fmt.Fprintf(w, "%d\t%s\t", int64(bucket.Entries-prev.Entries), signedSize(int64(bucket.Size-prev.Size)))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "\nfile\t%s\t\n", datasize.ByteSize(stats.FileSize).HR())
+	fmt.Fprintf(w, "used\t%s\t\n", datasize.ByteSize(stats.UsedSize).HR())
+	fmt.Fprintf(w, "max\t%s\t\n", datasize.ByteSize(stats.MaxSize).HR())
+	fmt.Fprintf(w, "free pages\t%d (%s)\t\n", stats.FreePages, datasize.ByteSize(stats.FreePages*stats.PageSize).HR())
+	fmt.Fprintf(w, "disk free\t%s\t\n", datasize.ByteSize(stats.DiskFree).HR())
+	return nil
+}
+
+func signedSize(size int64) string {
+	if size < 0 {
+		return "-" + datasize.ByteSize(-size).HR()
+	}
+	return datasize.ByteSize(size).HR()
+}
@@ -3,12 +3,14 @@ package commands
 import (
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/node"
 	"github.com/spf13/cobra"
 )
 
 var (
 	chaindata          string
+	coldChaindata      string
 	database           string
 	snapshotMode       string
 	snapshotDir        string
@@ -24,7 +26,9 @@ var (
 	datadir            string
 	mapSizeStr         string
 	freelistReuse      int
+	durabilityStr      string
 	migration          string
+	dryRun             bool
 	integritySlow      bool
 	integrityFast      bool
 	silkwormPath       string
@@ -43,7 +47,8 @@ func withChaindata(cmd *cobra.Command) {
 	must(cmd.MarkFlagRequired("chaindata"))
 	cmd.Flags().StringVar(&snapshotMode, "snapshotMode", "", "set of snapshots to use")
 	cmd.Flags().StringVar(&snapshotDir, "snapshotDir", "", "snapshot dir")
-	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx")
+	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx, or another backend compiled in with the build tags")
+	cmd.Flags().StringVar(&coldChaindata, "chaindata.cold", "", "path to the cold db keeping the history buckets of --chaindata, usually <datadir.cold>/chaindata")
 }
 
 func withMining(cmd *cobra.Command) {
@@ -67,6 +72,7 @@ func withFile(cmd *cobra.Command) {
 func withLmdbFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&mapSizeStr, "lmdb.mapSize", "", "map size for LMDB")
 	cmd.Flags().IntVar(&freelistReuse, "maxFreelistReuse", 0, "Find a big enough contiguous page range for large values in freelist is hard just allocate new pages and even don't try to search if value is bigger than this limit. Measured in pages.")
+	cmd.Flags().StringVar(&durabilityStr, "db.durability", ethdb.DefaultDurability.String(), "fsync policy of the commits: paranoid|safe|fast|unsafe, only MDBX supports the levels other than paranoid")
 }
 
 func withReferenceChaindata(cmd *cobra.Command) {
@@ -103,7 +109,7 @@ func withDatadir2(cmd *cobra.Command) {
 	cmd.Flags().String(utils.DataDirFlag.Name, utils.DataDirFlag.Value.String(), utils.DataDirFlag.Usage)
 	must(cmd.MarkFlagDirname(utils.DataDirFlag.Name))
 	must(cmd.MarkFlagRequired(utils.DataDirFlag.Name))
-	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx")
+	cmd.Flags().StringVar(&database, "database", "", "lmdb|mdbx, or another backend compiled in with the build tags")
 }
 
 func withDatadir(cmd *cobra.Command) {
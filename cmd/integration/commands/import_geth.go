@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/gethimport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gethChaindata  string
+	genesisFile    string
+	storageModeStr string
+	execute        bool
+)
+
+func init() {
+	withChaindata(cmdImportGeth)
+	withLmdbFlags(cmdImportGeth)
+	withBlock(cmdImportGeth)
+	withDatadir(cmdImportGeth)
+	withBatchSize(cmdImportGeth)
+	cmdImportGeth.Flags().StringVar(&gethChaindata, "geth.chaindata", "", "path to the chaindata of go-ethereum, usually <datadir>/geth/chaindata, with the freezer in its ancient subdirectory")
+	must(cmdImportGeth.MarkFlagDirname("geth.chaindata"))
+	must(cmdImportGeth.MarkFlagRequired("geth.chaindata"))
+	cmdImportGeth.Flags().StringVar(&genesisFile, "genesis", "", "genesis spec (json) of the chain, only needed for the networks other than mainnet, ropsten, rinkeby and goerli")
+	cmdImportGeth.Flags().StringVar(&storageModeStr, "storage-mode", ethdb.DefaultStorageMode.ToString(), "storage mode of the new database, the same as --storage-mode of turbo-geth")
+	cmdImportGeth.Flags().BoolVar(&execute, "execute", false, "execute the imported blocks to build the state, otherwise the next sync of turbo-geth executes them")
+	rootCmd.AddCommand(cmdImportGeth)
+}
+
+var cmdImportGeth = &cobra.Command{
+	Use:     "import_geth",
+	Short:   "Import the headers, the bodies and the receipts from the chaindata of go-ethereum, optionally executing them to build the state",
+	Example: "go run ./cmd/integration import_geth --geth.chaindata ~/.ethereum/geth/chaindata --chaindata ~/tg/tg/chaindata --execute",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, true)
+		defer db.Close()
+
+		if err := importGeth(db, ctx); err != nil {
+			log.Error("Error", "err", err)
+			return err
+		}
+		return nil
+	},
+}
+
+func importGeth(db ethdb.Database, ctx context.Context) error {
+	sm, err := ethdb.StorageModeFromString(storageModeStr)
+	if err != nil {
+		return err
+	}
+	if err = ethdb.SetStorageModeIfNotExist(db, sm); err != nil {
+		return err
+	}
+	cfg := gethimport.Config{ToBlock: block}
+	if genesisFile != "" {
+		data, err := ioutil.ReadFile(genesisFile)
+		if err != nil {
+			return err
+		}
+		cfg.Genesis = new(core.Genesis)
+		if err = json.Unmarshal(data, cfg.Genesis); err != nil {
+			return fmt.Errorf("invalid genesis file: %w", err)
+		}
+	}
+	if _, err = gethimport.Import(ctx, gethChaindata, db, cfg); err != nil {
+		return err
+	}
+	if !execute {
+		return nil
+	}
+	var batchSize datasize.ByteSize
+	must(batchSize.UnmarshalText([]byte(batchSizeStr)))
+	return gethimport.Execute(ctx, db, path.Join(datadir, etl.TmpDirName), batchSize)
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	moveBuckets string
+	moveTo      string
+)
+
+func init() {
+	withChaindata(cmdMoveBuckets)
+	must(cmdMoveBuckets.MarkFlagRequired("chaindata.cold"))
+	cmdMoveBuckets.Flags().StringVar(&moveBuckets, "buckets", strings.Join(ethdb.DefaultColdBuckets, ","), "comma separated buckets to move")
+	cmdMoveBuckets.Flags().StringVar(&moveTo, "to", "cold", "cold|hot")
+	rootCmd.AddCommand(cmdMoveBuckets)
+}
+
+var cmdMoveBuckets = &cobra.Command{
+	Use:     "move_buckets",
+	Short:   "Move the buckets from --chaindata to the cold db of --chaindata.cold, or back, and record which buckets the node finds in the cold db",
+	Example: "go run ./cmd/integration move_buckets --chaindata ~/tg/tg/chaindata --chaindata.cold /mnt/hdd/tg/chaindata --buckets r,log --to cold",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		var toCold bool
+		switch moveTo {
+		case "cold":
+			toCold = true
+		case "hot":
+		default:
+			return fmt.Errorf("unknown --to: %s, expected cold|hot", moveTo)
+		}
+		hot := openBackendKV(chaindata, true)
+		defer hot.Close()
+		cold := openBackendKV(coldChaindata, true)
+		defer cold.Close()
+		return ethdb.MoveBuckets(ctx, hot, cold, strings.Split(moveBuckets, ","), toCold)
+	},
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reindexShards     int
+	reindexIndex      string
+	reindexChunkLimit string
+)
+
+func init() {
+	withChaindata(cmdReindexHistory)
+	withDatadir(cmdReindexHistory)
+	cmdReindexHistory.Flags().IntVar(&reindexShards, "shards", 0, "number of the goroutines reading the changesets, the number of CPUs if 0")
+	cmdReindexHistory.Flags().StringVar(&reindexIndex, "index", "all", "accounts|storage|all")
+	cmdReindexHistory.Flags().StringVar(&reindexChunkLimit, "chunk.limit", "", "size the bitmaps of the index are cut at, the default of the sync if empty")
+	rootCmd.AddCommand(cmdReindexHistory)
+}
+
+var cmdReindexHistory = &cobra.Command{
+	Use:     "reindex_history",
+	Short:   "Drop the AccountsHistory/StorageHistory indices and regenerate them from the changesets",
+	Example: "go run ./cmd/integration reindex_history --chaindata ~/tg/tg/chaindata --datadir ~/tg --shards 8",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, true)
+		defer db.Close()
+		return reindexHistory(db, ctx.Done())
+	},
+}
+
+func reindexHistory(db ethdb.Database, quit <-chan struct{}) error {
+	var changesetBuckets []string
+	switch reindexIndex {
+	case "accounts":
+		changesetBuckets = []string{dbutils.PlainAccountChangeSetBucket}
+	case "storage":
+		changesetBuckets = []string{dbutils.PlainStorageChangeSetBucket}
+	case "all":
+		changesetBuckets = []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket}
+	default:
+		return fmt.Errorf("unknown index: %s, expected accounts|storage|all", reindexIndex)
+	}
+	cfg := stagedsync.ReindexHistoryConfig{Shards: reindexShards}
+	if reindexChunkLimit != "" {
+		var chunkLimit datasize.ByteSize
+		must(chunkLimit.UnmarshalText([]byte(reindexChunkLimit)))
+		cfg.ChunkLimit = chunkLimit.Bytes()
+	}
+	tmpdir := path.Join(datadir, etl.TmpDirName)
+	for _, changesetBucket := range changesetBuckets {
+		if err := stagedsync.ReindexHistory("reindex_history", db, changesetBucket, cfg, tmpdir, quit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repairFrom      uint64
+	repairTo        uint64
+	repairWorkers   int
+	repairCheckOnly bool
+)
+
+func init() {
+	withChaindata(cmdRepairReceipts)
+	cmdRepairReceipts.Flags().Uint64Var(&repairFrom, "from", 1, "first block of the repaired range")
+	cmdRepairReceipts.Flags().Uint64Var(&repairTo, "to", 0, "last block of the repaired range, 0 for the latest executed block")
+	cmdRepairReceipts.Flags().IntVar(&repairWorkers, "workers", 0, "number of the goroutines re-executing the blocks, the number of CPUs if 0")
+	cmdRepairReceipts.Flags().BoolVar(&repairCheckOnly, "check", false, "only list the blocks with the missing or the corrupt receipts")
+	rootCmd.AddCommand(cmdRepairReceipts)
+}
+
+var cmdRepairReceipts = &cobra.Command{
+	Use:     "repair_receipts",
+	Short:   "Re-execute the blocks of the range and rewrite their receipts, logs and log index where they are missing or corrupt",
+	Example: "go run ./cmd/integration repair_receipts --chaindata ~/tg/tg/chaindata --from 4370000 --to 4380000",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, !repairCheckOnly)
+		defer db.Close()
+		to := repairTo
+		if to == 0 {
+			var err error
+			if to, err = stages.GetStageProgress(db, stages.Execution); err != nil {
+				return err
+			}
+		}
+		repair, err := integrity.RepairReceipts(ctx, db, integrity.ReceiptsConfig{Workers: repairWorkers, CheckOnly: repairCheckOnly}, repairFrom, to)
+		if err != nil {
+			return err
+		}
+		verb := "Repaired"
+		if repairCheckOnly {
+			verb = "To repair"
+		}
+		fmt.Printf("Re-executed %d blocks. %s: %d blocks\n", repair.Blocks, verb, len(repair.Repaired))
+		for _, blockNum := range repair.Repaired {
+			fmt.Printf("\t%d\n", blockNum)
+		}
+		return nil
+	},
+}
@@ -82,6 +82,9 @@ func resetState(db ethdb.Database, _ context.Context) error {
 	if err := resetExec(db); err != nil {
 		return err
 	}
+	if err := resetBlockWitnesses(db); err != nil {
+		return err
+	}
 	if err := stagedsync.ResetHashState(db); err != nil {
 		return err
 	}
@@ -100,6 +103,12 @@ func resetState(db ethdb.Database, _ context.Context) error {
 	if err := resetTxLookup(db); err != nil {
 		return err
 	}
+	if err := resetAccountRanks(db); err != nil {
+		return err
+	}
+	if err := resetTokenTransfers(db); err != nil {
+		return err
+	}
 	if err := resetTxPool(db); err != nil {
 		return err
 	}
@@ -152,6 +161,8 @@ func resetExec(db rawdb.DatabaseWriter) error {
 		dbutils.PlainContractCodeBucket,
 		dbutils.BlockReceiptsPrefix,
 		dbutils.Log,
+		dbutils.BorReceipts,
+		dbutils.BorTxLookup,
 		dbutils.IncarnationMapBucket,
 		dbutils.CodeBucket,
 	); err != nil {
@@ -166,6 +177,52 @@ func resetExec(db rawdb.DatabaseWriter) error {
 	return nil
 }
 
+func resetBlockWitnesses(db rawdb.DatabaseWriter) error {
+	if err := db.(ethdb.BucketsMigrator).ClearBuckets(
+		dbutils.BlockWitness,
+	); err != nil {
+		return err
+	}
+	if err := stages.SaveStageProgress(db, stages.BlockWitnesses, 0); err != nil {
+		return err
+	}
+	if err := stages.SaveStageUnwind(db, stages.BlockWitnesses, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resetAccountRanks(db rawdb.DatabaseWriter) error {
+	if err := db.(ethdb.BucketsMigrator).ClearBuckets(
+		dbutils.BalanceRank,
+		dbutils.CodeSizeRank,
+	); err != nil {
+		return err
+	}
+	if err := stages.SaveStageProgress(db, stages.AccountRanks, 0); err != nil {
+		return err
+	}
+	if err := stages.SaveStageUnwind(db, stages.AccountRanks, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resetTokenTransfers(db rawdb.DatabaseWriter) error {
+	if err := db.(ethdb.BucketsMigrator).ClearBuckets(
+		dbutils.TokenTransferIndex,
+	); err != nil {
+		return err
+	}
+	if err := stages.SaveStageProgress(db, stages.TokenTransfers, 0); err != nil {
+		return err
+	}
+	if err := stages.SaveStageUnwind(db, stages.TokenTransfers, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
 func resetHistory(db rawdb.DatabaseWriter) error {
 	if err := db.(ethdb.BucketsMigrator).ClearBuckets(
 		dbutils.AccountsHistoryBucket,
@@ -1,7 +1,10 @@
 package commands
 
 import (
-	"github.com/c2h5oh/datasize"
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/debug"
@@ -63,36 +66,50 @@ func openDatabase(path string, applyMigrations bool) *ethdb.ObjectDatabase {
 	return openDatabase2(path, applyMigrations, snapshotDir, mode)
 }
 
+// openKV opens the db, combined with the cold db of --chaindata.cold if it keeps buckets in one
 func openKV(path string, exclusive bool) ethdb.KV {
-	if database == "mdbx" {
-		opts := ethdb.NewMDBX().Path(path)
-		if exclusive {
-			opts = opts.Exclusive()
-		}
-		if mapSizeStr != "" {
-			var mapSize datasize.ByteSize
-			must(mapSize.UnmarshalText([]byte(mapSizeStr)))
-			opts = opts.MapSize(mapSize)
-		}
-		if freelistReuse > 0 {
-			opts = opts.MaxFreelistReuse(uint(freelistReuse))
-		}
-		return opts.MustOpen()
+	kv := openBackendKV(path, exclusive)
+	var coldBuckets []string
+	if err := kv.View(context.Background(), func(tx ethdb.Tx) (err error) {
+		coldBuckets, err = ethdb.ReadColdBuckets(tx)
+		return err
+	}); err != nil {
+		panic(err)
+	}
+	if coldBuckets == nil {
+		return kv
 	}
+	if path != chaindata || coldChaindata == "" {
+		panic(fmt.Errorf("%s keeps the buckets %s in a cold db, set --chaindata.cold", path, strings.Join(coldBuckets, ",")))
+	}
+	tiered, err := ethdb.NewTieredKV(context.Background(), kv, openBackendKV(coldChaindata, exclusive), coldBuckets)
+	if err != nil {
+		panic(err)
+	}
+	return tiered
+}
 
-	opts := ethdb.NewLMDB().Path(path)
-	if exclusive {
-		opts = opts.Exclusive()
+func openBackendKV(path string, exclusive bool) ethdb.KV {
+	backend := database
+	if backend == "" {
+		backend = "lmdb"
 	}
+	opts := ethdb.BackendOpts{Path: path, Exclusive: exclusive}
 	if mapSizeStr != "" {
-		var mapSize datasize.ByteSize
-		must(mapSize.UnmarshalText([]byte(mapSizeStr)))
-		opts = opts.MapSize(mapSize)
+		must(opts.MapSize.UnmarshalText([]byte(mapSizeStr)))
 	}
 	if freelistReuse > 0 {
-		opts = opts.MaxFreelistReuse(uint(freelistReuse))
+		opts.MaxFreelistReuse = uint(freelistReuse)
+	}
+	if durabilityStr != "" {
+		var err error
+		opts.Durability, err = ethdb.DurabilityFromString(durabilityStr)
+		must(err)
+	}
+	kv, err := ethdb.OpenBackend(backend, opts)
+	if err != nil {
+		panic(err)
 	}
-	kv := opts.MustOpen()
 	metrics.AddCallback(kv.CollectMetrics)
 	return kv
 }
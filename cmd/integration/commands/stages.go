@@ -3,10 +3,12 @@ package commands
 import (
 	"context"
 	"fmt"
+	"os"
 	"path"
 	"runtime"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 	"unsafe"
 
@@ -206,9 +208,15 @@ var cmdRemoveMigration = &cobra.Command{
 }
 
 var cmdRunMigrations = &cobra.Command{
-	Use:   "run_migrations",
-	Short: "",
+	Use:     "run_migrations",
+	Short:   "Apply the pending migrations of the database, or estimate them with --dry-run",
+	Example: "go run ./cmd/integration run_migrations --chaindata ~/tg/tg/chaindata --dry-run",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun {
+			db := openDatabase(chaindata, false)
+			defer db.Close()
+			return printMigrationsEstimate(db)
+		}
 		db := openDatabase(chaindata, true)
 		defer db.Close()
 		// Nothing to do, migrations will be applied automatically
@@ -307,6 +315,7 @@ func init() {
 	withChaindata(cmdRunMigrations)
 	withLmdbFlags(cmdRunMigrations)
 	withDatadir(cmdRunMigrations)
+	cmdRunMigrations.Flags().BoolVar(&dryRun, "dry-run", false, "only print the rows, the bytes and the time each pending migration is estimated to take")
 	rootCmd.AddCommand(cmdRunMigrations)
 }
 
@@ -635,6 +644,24 @@ func printAppliedMigrations(db ethdb.Database, _ context.Context) error {
 	return nil
 }
 
+func printMigrationsEstimate(db ethdb.Database) error {
+	estimates, err := migrations.NewMigrator().DryRun(db)
+	if err != nil {
+		return err
+	}
+	if len(estimates) == 0 {
+		fmt.Println("No pending migrations")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 8, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "migration\trows\tsize\ttime\t")
+	for _, e := range estimates {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t\n", e.Name, e.Rows, datasize.ByteSize(e.Bytes).HR(), e.Time.Round(time.Second))
+	}
+	return nil
+}
+
 func removeMigration(db rawdb.DatabaseDeleter, _ context.Context) error {
 	if err := db.Delete(dbutils.Migrations, []byte(migration), nil); err != nil {
 		return err
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/spf13/cobra"
+)
+
+var (
+	txLookupWorkers int
+	txLookupPercent float64
+)
+
+func init() {
+	withChaindata(cmdRebuildTxLookup)
+	withDatadir(cmdRebuildTxLookup)
+	cmdRebuildTxLookup.Flags().IntVar(&txLookupWorkers, "workers", 0, "number of the goroutines reading the blocks, the number of CPUs if 0")
+	rootCmd.AddCommand(cmdRebuildTxLookup)
+
+	withChaindata(cmdVerifyTxLookup)
+	cmdVerifyTxLookup.Flags().IntVar(&txLookupWorkers, "workers", 0, "number of the goroutines reading the blocks, the number of CPUs if 0")
+	cmdVerifyTxLookup.Flags().Float64Var(&txLookupPercent, "percent", 1, "percentage of the canonical blocks to check, picked at random")
+	rootCmd.AddCommand(cmdVerifyTxLookup)
+}
+
+var cmdRebuildTxLookup = &cobra.Command{
+	Use:     "rebuild_tx_lookup",
+	Short:   "Drop the transaction lookup index and re-derive it from the bodies of the canonical blocks",
+	Example: "go run ./cmd/integration rebuild_tx_lookup --chaindata ~/tg/tg/chaindata --datadir ~/tg --workers 8",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, true)
+		defer db.Close()
+		return stagedsync.RebuildTxLookup("rebuild_tx_lookup", db, txLookupWorkers, path.Join(datadir, etl.TmpDirName), ctx.Done(), nil)
+	},
+}
+
+var cmdVerifyTxLookup = &cobra.Command{
+	Use:     "verify_tx_lookup",
+	Short:   "Check the transaction lookup entries of a sample of the canonical blocks",
+	Example: "go run ./cmd/integration verify_tx_lookup --chaindata ~/tg/tg/chaindata --percent 5",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := utils.RootContext()
+		db := openDatabase(chaindata, false)
+		defer db.Close()
+		sample, err := integrity.VerifyTxLookup(ctx, db, txLookupPercent, txLookupWorkers)
+		if err != nil {
+			return err
+		}
+		fmt.Println(sample)
+		for _, e := range sample.Examples {
+			fmt.Printf("\t%s\n", e)
+		}
+		if !sample.OK() {
+			return fmt.Errorf("the transaction lookup index is inconsistent, rebuild it with rebuild_tx_lookup")
+		}
+		return nil
+	},
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"runtime"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/codecache"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/debug"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/node"
 	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/turbo/archive"
+	"github.com/ledgerwatch/turbo-geth/turbo/segments"
 	"github.com/ledgerwatch/turbo-geth/turbo/snapshotsync"
 	"github.com/spf13/cobra"
 )
@@ -22,6 +28,9 @@ type Flags struct {
 	Chaindata            string
 	SnapshotDir          string
 	SnapshotMode         string
+	AncientDir           string
+	ChangesetsArchive    string
+	ChangesetsCacheDir   string
 	HttpListenAddress    string
 	TLSCertfile          string
 	TLSCACert            string
@@ -29,12 +38,24 @@ type Flags struct {
 	HttpPort             int
 	HttpCORSDomain       []string
 	HttpVirtualHost      []string
+	HttpMsgpack          bool
 	API                  []string
 	Gascap               uint64
 	MaxTraces            uint64
+	TraceWorkers         int
 	TraceType            string
 	WebsocketEnabled     bool
 	RpcAllowListFilePath string
+	ParanoidReads        bool
+	StaleBlocks          uint64
+	ReceiptsCache        int
+	StateCache           int
+	CodeCacheSize        string
+	LogsLimit            int
+	PendingInterval      time.Duration
+	StallThreshold       time.Duration
+	StallDir             string
+	StallKeep            int
 }
 
 var rootCmd = &cobra.Command{
@@ -59,6 +80,9 @@ func RootCommand() (*cobra.Command, *Flags) {
 	rootCmd.PersistentFlags().StringVar(&cfg.PrivateApiAddr, "private.api.addr", "127.0.0.1:9090", "private api network address, for example: 127.0.0.1:9090, empty string means not to start the listener. do not expose to public network. serves remote database interface")
 	rootCmd.PersistentFlags().StringVar(&cfg.Chaindata, "chaindata", "", "path to the database")
 	rootCmd.PersistentFlags().StringVar(&cfg.SnapshotDir, "snapshotDir", "", "path to snapshot dir(only for chaindata mode)")
+	rootCmd.PersistentFlags().StringVar(&cfg.AncientDir, "ancient.dir", "", "path to the segment files of the ancient blocks moved out of the database by the node with --ancient.threshold, usually <datadir>/tg/ancient (must be local)")
+	rootCmd.PersistentFlags().StringVar(&cfg.ChangesetsArchive, "changesets.archive", "", "URL of the archive of the old changesets moved out of the database by the node with --changesets.archive.threshold, s3://bucket/prefix or a directory, the historical queries of the archived blocks fetch them from it")
+	rootCmd.PersistentFlags().StringVar(&cfg.ChangesetsCacheDir, "changesets.archive.cache.dir", "", "directory of the cache of the changesets fetched from --changesets.archive, none if empty")
 	rootCmd.PersistentFlags().StringVar(&cfg.SnapshotMode, "snapshot-mode", "", `Configures the storage mode of the app(only for chaindata mode):
 * h - use headers snapshot
 * b - use bodies snapshot
@@ -72,11 +96,23 @@ func RootCommand() (*cobra.Command, *Flags) {
 	rootCmd.PersistentFlags().IntVar(&cfg.HttpPort, "http.port", node.DefaultHTTPPort, "HTTP-RPC server listening port")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.HttpCORSDomain, "http.corsdomain", []string{}, "Comma separated list of domains from which to accept cross origin requests (browser enforced)")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.HttpVirtualHost, "http.vhosts", node.DefaultConfig.HTTPVirtualHosts, "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.")
+	rootCmd.PersistentFlags().BoolVar(&cfg.HttpMsgpack, "http.msgpack", false, "Send MessagePack instead of JSON responses to the HTTP clients which accept application/msgpack")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.API, "http.api", []string{"eth", "tg"}, "API's offered over the HTTP-RPC interface")
 	rootCmd.PersistentFlags().Uint64Var(&cfg.Gascap, "rpc.gascap", 25000000, "Sets a cap on gas that can be used in eth_call/estimateGas")
 	rootCmd.PersistentFlags().Uint64Var(&cfg.MaxTraces, "trace.maxtraces", 200, "Sets a limit on traces that can be returned in trace_filter")
+	rootCmd.PersistentFlags().IntVar(&cfg.TraceWorkers, "trace.workers", runtime.NumCPU(), "Number of the blocks re-executed in parallel by trace_filter, trace_block and trace_replayBlockTransactions, each with its own read transaction")
 	rootCmd.PersistentFlags().StringVar(&cfg.TraceType, "trace.type", "parity", "Specify the type of tracing [geth|parity*] (experimental)")
 	rootCmd.PersistentFlags().BoolVar(&cfg.WebsocketEnabled, "ws", false, "Enable Websockets")
+	rootCmd.PersistentFlags().BoolVar(&cfg.ParanoidReads, "rpc.paranoid", false, "Validate the bodies and the receipts read from the database against the roots of their headers before returning them, to detect the corrupted data")
+	rootCmd.PersistentFlags().Uint64Var(&cfg.StaleBlocks, "rpc.staleblocks", 1024, "Number of the recent blocks, the blocks reorged out within which are kept and served by eth_getBlockByHash with \"canonical\": false (0 disables, needs --private.api.addr)")
+	rootCmd.PersistentFlags().IntVar(&cfg.StateCache, "rpc.state.cache", 10000, "Number of the accounts of the latest state eth_call keeps in the cache of the recently read state, with the room for 4 times as many storage slots (0 disables the cache)")
+	rootCmd.PersistentFlags().StringVar(&cfg.CodeCacheSize, "codecache.size", "64MB", "Size of the cache of the contract code and its JUMPDEST analysis shared by the calls and the tracing, keyed by the code hash (0 disables the cache)")
+	rootCmd.PersistentFlags().IntVar(&cfg.ReceiptsCache, "rpc.receipts.cache", 256, "Number of the blocks to cache the receipts of, which are regenerated by re-executing the blocks because the node doesn't store them, e.g. with --prune.receipts (0 disables the cache)")
+	rootCmd.PersistentFlags().IntVar(&cfg.LogsLimit, "rpc.logs.limit", 10000, "Maximum number of the logs eth_getLogs and tg_getLogs return for one call, the rest is paged by the returned continuation (0 is no limit)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.PendingInterval, "rpc.pending.interval", 3*time.Second, "Interval of rebuilding the pending block from the transaction pool, besides the new heads, for \"pending\" in eth_getBlockByNumber, eth_call and eth_estimateGas (0 disables, then \"pending\" is the latest block, needs --private.api.addr)")
+	rootCmd.PersistentFlags().DurationVar(&cfg.StallThreshold, "stall.threshold", 0, "Capture the goroutine, heap and CPU profiles into --stall.dir when an RPC call takes longer than this (0 disables)")
+	rootCmd.PersistentFlags().StringVar(&cfg.StallDir, "stall.dir", "stalls", "Directory of the profiles of the stalled RPC calls")
+	rootCmd.PersistentFlags().IntVar(&cfg.StallKeep, "stall.keep", 10, "Number of the last stalls the profiles are kept of in --stall.dir")
 	rootCmd.PersistentFlags().StringVar(&cfg.RpcAllowListFilePath, "rpc.accessList", "", "Specify granular (method-by-method) API allowlist")
 
 	if err := rootCmd.MarkPersistentFlagFilename("rpc.accessList", "json"); err != nil {
@@ -110,6 +146,31 @@ func OpenDB(cfg Flags) (ethdb.KV, core.ApiBackend, error) {
 			db = kv
 		}
 	}
+	var codeCacheSize datasize.ByteSize
+	if errSize := codeCacheSize.UnmarshalText([]byte(cfg.CodeCacheSize)); errSize != nil {
+		return nil, nil, fmt.Errorf("invalid --codecache.size: %w", errSize)
+	}
+	codecache.Shared.SetSize(codeCacheSize)
+	var ancients ethdb.AncientReader
+	if cfg.AncientDir != "" {
+		store, errOpen := segments.OpenStore(cfg.AncientDir)
+		if errOpen != nil {
+			return nil, nil, fmt.Errorf("could not open the ancient segments: %w", errOpen)
+		}
+		ancients = store
+	}
+	var changesets ethdb.ChangesetArchive
+	if cfg.ChangesetsArchive != "" {
+		store, errOpen := archive.OpenStore(cfg.ChangesetsArchive)
+		if errOpen != nil {
+			return nil, nil, fmt.Errorf("could not open the changesets archive: %w", errOpen)
+		}
+		reader, errOpen := archive.NewReader(store, cfg.ChangesetsCacheDir, 4*datasize.GB, 0)
+		if errOpen != nil {
+			return nil, nil, errOpen
+		}
+		changesets = reader
+	}
 	if cfg.PrivateApiAddr != "" {
 		var remoteKv ethdb.KV
 		remoteKv, err = ethdb.NewRemote().Path(cfg.PrivateApiAddr).Open(cfg.TLSCertfile, cfg.TLSKeyFile, cfg.TLSCACert)
@@ -123,6 +184,12 @@ func OpenDB(cfg Flags) (ethdb.KV, core.ApiBackend, error) {
 	} else {
 		return nil, nil, fmt.Errorf("either remote db or lmdb must be specified")
 	}
+	if ancients != nil && db != nil {
+		db = ethdb.NewAncientsKV(db, ancients)
+	}
+	if db != nil {
+		db = ethdb.NewChangesetsKV(db, stages.ReadPruneProgress, changesets)
+	}
 
 	return db, ethBackend, err
 }
@@ -143,7 +210,11 @@ func StartRpcServer(ctx context.Context, cfg Flags, rpcAPI []rpc.API) error {
 		return fmt.Errorf("could not start register RPC apis: %w", err)
 	}
 
-	httpHandler := node.NewHTTPHandlerStack(srv, cfg.HttpCORSDomain, cfg.HttpVirtualHost)
+	var rpcHandler http.Handler = srv
+	if cfg.HttpMsgpack {
+		rpcHandler = node.NewMsgpackHandler(srv)
+	}
+	httpHandler := node.NewHTTPHandlerStack(rpcHandler, cfg.HttpCORSDomain, cfg.HttpVirtualHost)
 	var wsHandler http.Handler
 	if cfg.WebsocketEnabled {
 		wsHandler = srv.WebsocketHandler([]string{"*"})
@@ -1,9 +1,11 @@
 package commands
 
 import (
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/cli"
 	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/rpc"
 )
@@ -11,13 +13,31 @@ import (
 // APIList describes the list of available RPC apis
 func APIList(db ethdb.Database, eth core.ApiBackend, filters *filters.Filters, cfg cli.Flags, customAPIList []rpc.API) []rpc.API {
 	var defaultAPIList []rpc.API
+	paranoidReads = cfg.ParanoidReads
+	var receiptsCache *lru.Cache
+	if cfg.ReceiptsCache > 0 {
+		receiptsCache, _ = lru.New(cfg.ReceiptsCache)
+	}
 
+	tracker, staleBlocks := trackReorgs(db, filters, cfg.StaleBlocks)
 	ethImpl := NewEthAPI(db, eth, cfg.Gascap, filters)
-	tgImpl := NewTgAPI(db)
+	ethImpl.staleBlocks = staleBlocks
+	ethImpl.receiptsCache = receiptsCache
+	ethImpl.logsLimit = cfg.LogsLimit
+	ethImpl.pending = buildPending(db, eth, filters, cfg.PendingInterval)
+	if cfg.StateCache > 0 {
+		ethImpl.stateCache, _ = state.NewReadCacheOfAccounts(cfg.StateCache)
+	}
+	tgImpl := NewTgAPI(db, eth, cfg.Gascap, tracker)
+	tgImpl.logsLimit = cfg.LogsLimit
+	tgImpl.receiptsCache = receiptsCache
 	netImpl := NewNetAPIImpl(eth)
 	debugImpl := NewPrivateDebugAPI(db, cfg.Gascap)
 	traceImpl := NewTraceAPI(db, &cfg)
 	web3Impl := NewWeb3APIImpl()
+	txpoolImpl := NewTxPoolAPI(eth)
+	otsImpl := NewOtterscanAPI(db)
+	otsImpl.receiptsCache = receiptsCache
 	dbImpl := NewDBAPIImpl()   /* deprecated */
 	shhImpl := NewSHHAPIImpl() /* deprecated */
 
@@ -51,6 +71,13 @@ func APIList(db ethdb.Database, eth core.ApiBackend, filters *filters.Filters, c
 				Service:   Web3API(web3Impl),
 				Version:   "1.0",
 			})
+		case "txpool":
+			defaultAPIList = append(defaultAPIList, rpc.API{
+				Namespace: "txpool",
+				Public:    true,
+				Service:   TxPoolAPI(txpoolImpl),
+				Version:   "1.0",
+			})
 		case "trace":
 			defaultAPIList = append(defaultAPIList, rpc.API{
 				Namespace: "trace",
@@ -79,6 +106,13 @@ func APIList(db ethdb.Database, eth core.ApiBackend, filters *filters.Filters, c
 				Service:   TgAPI(tgImpl),
 				Version:   "1.0",
 			})
+		case "ots":
+			defaultAPIList = append(defaultAPIList, rpc.API{
+				Namespace: "ots",
+				Public:    true,
+				Service:   OtterscanAPI(otsImpl),
+				Version:   "1.0",
+			})
 		}
 	}
 
@@ -2,10 +2,13 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
@@ -23,12 +26,14 @@ import (
 // PrivateDebugAPI Exposed RPC endpoints for debugging use
 type PrivateDebugAPI interface {
 	StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex uint64, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error)
-	TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig) (interface{}, error)
-	AccountRange(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, start []byte, maxResults int, nocode, nostorage, incompletes bool) (state.IteratorDump, error)
+	TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig, stream *rpc.Stream) error
+	AccountRange(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, start []byte, maxResults int, nocode, nostorage, incompletes bool, end *common.Address, stream *rpc.Stream) error
 	GetModifiedAccountsByNumber(ctx context.Context, startNum rpc.BlockNumber, endNum *rpc.BlockNumber) ([]common.Address, error)
 	GetModifiedAccountsByHash(_ context.Context, startHash common.Hash, endHash *common.Hash) ([]common.Address, error)
 	TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig) (interface{}, error)
 	AccountAt(ctx context.Context, blockHash common.Hash, txIndex uint64, account common.Address) (*AccountResult, error)
+	Preimage(ctx context.Context, hash common.Hash) (hexutil.Bytes, error)
+	DbStats(ctx context.Context, fromTime, toTime *hexutil.Uint64) ([]*ethdb.DBStats, error)
 }
 
 // PrivateDebugAPIImpl is implementation of the PrivateDebugAPI interface based on remote Db access
@@ -58,7 +63,7 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 
 	bc := adapter.NewBlockGetter(tx)
 	cc := adapter.NewChainContext(tx)
-	genesis, err := rawdb.ReadBlockByNumber(tx, 0)
+	genesis, err := readBlockByNumber(tx, 0)
 	if err != nil {
 		return StorageRangeResult{}, err
 	}
@@ -74,11 +79,13 @@ func (api *PrivateDebugAPIImpl) StorageRangeAt(ctx context.Context, blockHash co
 	return StorageRangeAt(stateReader, contractAddress, keyStart, maxResult)
 }
 
-// AccountRange implements debug_accountRange. Returns a range of accounts involved in the given block range
-func (api *PrivateDebugAPIImpl) AccountRange(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, startKey []byte, maxResults int, excludeCode, excludeStorage, excludeMissingPreimages bool) (state.IteratorDump, error) {
+// AccountRange implements debug_accountRange. Returns a range of accounts involved in the given block range.
+// Accounts are streamed to the client one by one, together with their storage. The optional end address bounds the
+// range, the accounts from it on are not walked.
+func (api *PrivateDebugAPIImpl) AccountRange(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, startKey []byte, maxResults int, excludeCode, excludeStorage, excludeMissingPreimages bool, end *common.Address, stream *rpc.Stream) error {
 	tx, err := api.dbReader.Begin(ctx, ethdb.RO)
 	if err != nil {
-		return state.IteratorDump{}, err
+		return err
 	}
 	defer tx.Rollback()
 
@@ -86,26 +93,26 @@ func (api *PrivateDebugAPIImpl) AccountRange(ctx context.Context, blockNrOrHash
 
 	if number, ok := blockNrOrHash.Number(); ok {
 		if number == rpc.PendingBlockNumber {
-			return state.IteratorDump{}, fmt.Errorf("accountRange for pending block not supported")
+			return fmt.Errorf("accountRange for pending block not supported")
 		}
 		if number == rpc.LatestBlockNumber {
 			var err error
 
 			blockNumber, err = stages.GetStageProgress(tx, stages.Execution)
 			if err != nil {
-				return state.IteratorDump{}, fmt.Errorf("last block has not found: %w", err)
+				return fmt.Errorf("last block has not found: %w", err)
 			}
 		} else {
 			blockNumber = uint64(number)
 		}
 
 	} else if hash, ok := blockNrOrHash.Hash(); ok {
-		block, err1 := rawdb.ReadBlockByHash(tx, hash)
+		block, err1 := readBlockByHash(tx, hash)
 		if err1 != nil {
-			return state.IteratorDump{}, err1
+			return err1
 		}
 		if block == nil {
-			return state.IteratorDump{}, fmt.Errorf("block %s not found", hash.Hex())
+			return fmt.Errorf("block %s not found", hash.Hex())
 		}
 		blockNumber = block.NumberU64()
 	}
@@ -114,24 +121,50 @@ func (api *PrivateDebugAPIImpl) AccountRange(ctx context.Context, blockNrOrHash
 		maxResults = eth.AccountRangeMaxResults
 	}
 
-	dumper := state.NewDumper(tx.(ethdb.HasTx).Tx(), blockNumber)
-	res, err := dumper.IteratorDump(excludeCode, excludeStorage, excludeMissingPreimages, common.BytesToAddress(startKey), maxResults)
-	if err != nil {
-		return state.IteratorDump{}, err
-	}
-
 	hash, err := rawdb.ReadCanonicalHash(tx, blockNumber)
 	if err != nil {
-		return state.IteratorDump{}, err
+		return err
 	}
+	var root string
 	if hash != (common.Hash{}) {
 		header := rawdb.ReadHeader(tx, hash, blockNumber)
 		if header != nil {
-			res.Root = header.Root.String()
+			root = header.Root.String()
+		}
+	}
+
+	stream.BeginObject()
+	if err = stream.Field("root", root); err != nil {
+		return err
+	}
+	stream.Key("accounts")
+	stream.BeginObject()
+	dumper := state.NewDumper(tx.(ethdb.HasTx).Tx(), blockNumber)
+	next, err := dumper.DumpToCollector(&streamDump{stream}, excludeCode, excludeStorage, excludeMissingPreimages, common.BytesToAddress(startKey), end, maxResults)
+	if err != nil {
+		return err
+	}
+	stream.EndObject()
+	if next != nil {
+		if err = stream.Field("next", next); err != nil {
+			return err
 		}
 	}
+	stream.EndObject()
+	return stream.Err()
+}
 
-	return res, nil
+// streamDump is a state.DumpCollector writing accounts directly into the RPC stream,
+// in the same format as state.IteratorDump
+type streamDump struct {
+	stream *rpc.Stream
+}
+
+func (d *streamDump) OnRoot(common.Hash) {}
+
+func (d *streamDump) OnAccount(addr common.Address, account state.DumpAccount) {
+	d.stream.Key(hexutil.Encode(addr[:]))
+	d.stream.Value(account) //nolint:errcheck
 }
 
 // GetModifiedAccountsByNumber implements debug_getModifiedAccountsByNumber. Returns a list of accounts modified in the given block.
@@ -179,7 +212,7 @@ func (api *PrivateDebugAPIImpl) GetModifiedAccountsByHash(ctx context.Context, s
 	}
 	defer tx.Rollback()
 
-	startBlock, err := rawdb.ReadBlockByHash(tx, startHash)
+	startBlock, err := readBlockByHash(tx, startHash)
 	if err != nil {
 		return nil, err
 	}
@@ -190,7 +223,7 @@ func (api *PrivateDebugAPIImpl) GetModifiedAccountsByHash(ctx context.Context, s
 	endNum := startNum // allows for single parameter calls
 
 	if endHash != nil {
-		endBlock, err := rawdb.ReadBlockByHash(tx, *endHash)
+		endBlock, err := readBlockByHash(tx, *endHash)
 		if err != nil {
 			return nil, err
 		}
@@ -216,7 +249,7 @@ func (api *PrivateDebugAPIImpl) AccountAt(ctx context.Context, blockHash common.
 
 	bc := adapter.NewBlockGetter(tx)
 	cc := adapter.NewChainContext(tx)
-	genesis, err := rawdb.ReadBlockByNumber(tx, 0)
+	genesis, err := readBlockByNumber(tx, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -237,6 +270,64 @@ func (api *PrivateDebugAPIImpl) AccountAt(ctx context.Context, blockHash common.
 	return result, nil
 }
 
+// Preimage implements debug_preimage. Returns the preimage of the keccak hash of an address or a storage key, which
+// the node records with the p storage mode.
+func (api *PrivateDebugAPIImpl) Preimage(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	tx, err := api.dbReader.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	preimage, err := tx.Get(dbutils.PreimagePrefix, hash[:])
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	if len(preimage) == 0 {
+		return nil, errors.New("unknown preimage")
+	}
+	return common.CopyBytes(preimage), nil
+}
+
+// DbStats implements debug_dbStats. Without the times returns the current key counts and sizes of the buckets and
+// the free pages of the database, taken on the spot from the local database and the last persisted by the node
+// (every --db.stats.interval) from the remote one. With the times returns the persisted stats taken between them,
+// unix seconds, inclusive and optional, to chart the growth of the buckets
+func (api *PrivateDebugAPIImpl) DbStats(ctx context.Context, fromTime, toTime *hexutil.Uint64) ([]*ethdb.DBStats, error) {
+	tx, err := api.dbReader.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if fromTime != nil || toTime != nil {
+		from, to := uint64(0), uint64(math.MaxUint64)
+		if fromTime != nil {
+			from = uint64(*fromTime)
+		}
+		if toTime != nil {
+			to = uint64(*toTime)
+		}
+		stats, err := ethdb.ReadDBStats(tx.(ethdb.HasTx).Tx(), from, to)
+		if err != nil {
+			return nil, err
+		}
+		return append([]*ethdb.DBStats{}, stats...), nil
+	}
+
+	stats, err := ethdb.BucketsStat(tx.(ethdb.HasTx).Tx())
+	if errors.Is(err, ethdb.ErrBucketsStatNotSupported) {
+		stats, err = ethdb.ReadLatestDBStats(tx.(ethdb.HasTx).Tx())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, errors.New("the stats of the database are not persisted yet, see --db.stats.interval of the node")
+	}
+	return []*ethdb.DBStats{stats}, nil
+}
+
 type AccountResult struct {
 	Balance  hexutil.Big    `json:"balance"`
 	Nonce    hexutil.Uint64 `json:"nonce"`
@@ -1,12 +1,17 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/eth/tracers"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/rpc"
 )
 
 var debugTraceTransactionTests = []struct {
@@ -38,11 +43,19 @@ func TestTraceTransaction(t *testing.T) {
 	}
 	api := NewPrivateDebugAPI(db, 0)
 	for _, tt := range debugTraceTransactionTests {
-		result, err1 := api.TraceTransaction(context.Background(), common.HexToHash(tt.txHash), &tracers.TraceConfig{})
+		var buf bytes.Buffer
+		stream := rpc.NewStream(&buf)
+		err1 := api.TraceTransaction(context.Background(), common.HexToHash(tt.txHash), &tracers.TraceConfig{}, stream)
 		if err1 != nil {
 			t.Errorf("traceTransaction %s: %v", tt.txHash, err1)
 		}
-		er := result.(*ethapi.ExecutionResult)
+		if err = stream.Flush(); err != nil {
+			t.Fatalf("flushing stream: %v", err)
+		}
+		var er ethapi.ExecutionResult
+		if err = json.Unmarshal(buf.Bytes(), &er); err != nil {
+			t.Fatalf("parsing result of traceTransaction %s: %v", tt.txHash, err)
+		}
 		if er.Gas != tt.gas {
 			t.Errorf("wrong gas for transaction %s, got %d, expected %d", tt.txHash, er.Gas, tt.gas)
 		}
@@ -63,11 +76,19 @@ func TestTraceTransactionNoRefund(t *testing.T) {
 	api := NewPrivateDebugAPI(db, 0)
 	for _, tt := range debugTraceTransactionNoRefundTests {
 		var norefunds bool = true
-		result, err1 := api.TraceTransaction(context.Background(), common.HexToHash(tt.txHash), &tracers.TraceConfig{NoRefunds: &norefunds})
+		var buf bytes.Buffer
+		stream := rpc.NewStream(&buf)
+		err1 := api.TraceTransaction(context.Background(), common.HexToHash(tt.txHash), &tracers.TraceConfig{NoRefunds: &norefunds}, stream)
 		if err1 != nil {
 			t.Errorf("traceTransaction %s: %v", tt.txHash, err1)
 		}
-		er := result.(*ethapi.ExecutionResult)
+		if err = stream.Flush(); err != nil {
+			t.Fatalf("flushing stream: %v", err)
+		}
+		var er ethapi.ExecutionResult
+		if err = json.Unmarshal(buf.Bytes(), &er); err != nil {
+			t.Fatalf("parsing result of traceTransaction %s: %v", tt.txHash, err)
+		}
 		if er.Gas != tt.gas {
 			t.Errorf("wrong gas for transaction %s, got %d, expected %d", tt.txHash, er.Gas, tt.gas)
 		}
@@ -79,3 +100,27 @@ func TestTraceTransactionNoRefund(t *testing.T) {
 		}
 	}
 }
+
+func TestPreimage(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	api := NewPrivateDebugAPI(db, 0)
+	address := common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+	hash := crypto.Keccak256Hash(address[:])
+	if _, err = api.Preimage(context.Background(), hash); err == nil {
+		t.Errorf("expected the unknown preimage")
+	}
+	if err = db.Put(dbutils.PreimagePrefix, hash[:], address[:]); err != nil {
+		t.Fatal(err)
+	}
+	preimage, err := api.Preimage(context.Background(), hash)
+	if err != nil {
+		t.Fatalf("preimage: %v", err)
+	}
+	if !bytes.Equal(preimage, address[:]) {
+		t.Errorf("wrong preimage %x, expected %x", preimage, address)
+	}
+}
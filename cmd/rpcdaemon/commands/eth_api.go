@@ -5,13 +5,17 @@ import (
 	"math/big"
 	"sync"
 
+	lru "github.com/hashicorp/golang-lru"
 	rpcfilters "github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/eth/pending"
+	"github.com/ledgerwatch/turbo-geth/eth/reorgs"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/params"
@@ -33,7 +37,8 @@ type EthAPI interface {
 
 	// Receipt related (see ./eth_receipts.go)
 	GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error)
-	GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error)
+	GetBorBlockReceipt(ctx context.Context, blockHash common.Hash) (map[string]interface{}, error)
+	GetLogs(ctx context.Context, crit filters.FilterCriteria, stream *rpc.Stream) error
 
 	// Uncle related (see ./eth_uncles.go)
 	GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error)
@@ -42,7 +47,7 @@ type EthAPI interface {
 	GetUncleCountByBlockHash(ctx context.Context, hash common.Hash) (*hexutil.Uint, error)
 
 	// Filter related (see ./eth_filters.go)
-	NewPendingTransactionFilter(_ context.Context) (hexutil.Uint64, error)
+	NewPendingTransactionFilter(_ context.Context, crit *filters.PendingTxCriteria) (hexutil.Uint64, error)
 	NewBlockFilter(_ context.Context) (hexutil.Uint64, error)
 	NewFilter(_ context.Context, filter interface{}) (hexutil.Uint64, error)
 	UninstallFilter(_ context.Context, index hexutil.Uint64) (bool, error)
@@ -61,6 +66,8 @@ type EthAPI interface {
 	ChainId(ctx context.Context) (hexutil.Uint64, error) /* called eth_protocolVersion elsewhere */
 	ProtocolVersion(_ context.Context) (hexutil.Uint, error)
 	GasPrice(_ context.Context) (*hexutil.Big, error)
+	MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error)
+	FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*ethapi.FeeHistoryResult, error)
 
 	// Sending related (see ./eth_call.go)
 	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]ethapi.Account) (hexutil.Bytes, error)
@@ -90,6 +97,7 @@ type BaseAPI struct {
 	_chainConfig    *params.ChainConfig
 	_genesis        *types.Block
 	_genesisSetOnce sync.Once
+	receiptsCache   *lru.Cache // Receipts regenerated by re-executing the blocks, by the block hash, nil if off
 }
 
 func (api *BaseAPI) chainConfig(db ethdb.Database) (*params.ChainConfig, error) {
@@ -133,6 +141,10 @@ type APIImpl struct {
 	chainContext core.ChainContext
 	GasCap       uint64
 	filters      *rpcfilters.Filters
+	staleBlocks  *reorgs.StaleBlocks // Blocks reorged out recently, nil without the connection to turbo-geth
+	logsLimit    int                 // Maximum number of the logs returned by eth_getLogs, 0 is no limit
+	pending      *pending.Builder    // Builder of the pending block, nil when "pending" is the latest block
+	stateCache   *state.ReadCache    // Recently read latest state of eth_call, nil if off
 }
 
 // NewEthAPI returns APIImpl instance
@@ -148,33 +160,41 @@ func NewEthAPI(db ethdb.Database, eth core.ApiBackend, gascap uint64, filters *r
 
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
-	BlockHash        *common.Hash    `json:"blockHash"`
-	BlockNumber      *hexutil.Big    `json:"blockNumber"`
-	From             common.Address  `json:"from"`
-	Gas              hexutil.Uint64  `json:"gas"`
-	GasPrice         *hexutil.Big    `json:"gasPrice"`
-	Hash             common.Hash     `json:"hash"`
-	Input            hexutil.Bytes   `json:"input"`
-	Nonce            hexutil.Uint64  `json:"nonce"`
-	R                *hexutil.Big    `json:"r"`
-	S                *hexutil.Big    `json:"s"`
-	To               *common.Address `json:"to"`
-	TransactionIndex *hexutil.Uint64 `json:"transactionIndex"`
-	V                *hexutil.Big    `json:"v"`
-	Value            *hexutil.Big    `json:"value"`
+	BlockHash        *common.Hash      `json:"blockHash"`
+	BlockNumber      *hexutil.Big      `json:"blockNumber"`
+	From             common.Address    `json:"from"`
+	Gas              hexutil.Uint64    `json:"gas"`
+	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	FeeCap           *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	Tip              *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Hash             common.Hash       `json:"hash"`
+	Input            hexutil.Bytes     `json:"input"`
+	Nonce            hexutil.Uint64    `json:"nonce"`
+	To               *common.Address   `json:"to"`
+	TransactionIndex *hexutil.Uint64   `json:"transactionIndex"`
+	Value            *hexutil.Big      `json:"value"`
+	Type             hexutil.Uint64    `json:"type"`
+	Accesses         *types.AccessList `json:"accessList,omitempty"`
+	ChainID          *hexutil.Big      `json:"chainId,omitempty"`
+	V                *hexutil.Big      `json:"v"`
+	R                *hexutil.Big      `json:"r"`
+	S                *hexutil.Big      `json:"s"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
 // representation, with the given location metadata set (if available).
-func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
+// The base fee of the block, if known, is used to report the effective gas
+// price of dynamic fee transactions.
+func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64, baseFee *big.Int) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
-		signer = types.NewEIP155Signer(tx.ChainId().ToBig())
+		signer = types.LatestSignerForChainID(tx.ChainId().ToBig())
 	}
 	from, _ := types.Sender(signer, tx)
 	v, r, s := tx.RawSignatureValues()
 
 	result := &RPCTransaction{
+		Type:     hexutil.Uint64(tx.Type()),
 		From:     from,
 		Gas:      hexutil.Uint64(tx.Gas()),
 		GasPrice: (*hexutil.Big)(tx.GasPrice().ToBig()),
@@ -192,5 +212,30 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
 		result.TransactionIndex = (*hexutil.Uint64)(&index)
 	}
+	switch tx.Type() {
+	case types.AccessListTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId().ToBig())
+	case types.DynamicFeeTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId().ToBig())
+		result.FeeCap = (*hexutil.Big)(tx.FeeCap().ToBig())
+		result.Tip = (*hexutil.Big)(tx.Tip().ToBig())
+		// The effective gas price is only known for included transactions
+		if baseFee != nil && blockHash != (common.Hash{}) {
+			price := new(big.Int).Add(tx.Tip().ToBig(), baseFee)
+			if price.Cmp(result.FeeCap.ToInt()) > 0 {
+				price.Set(result.FeeCap.ToInt())
+			}
+			result.GasPrice = (*hexutil.Big)(price)
+		}
+	}
 	return result
 }
+
+// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
+func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+	return newRPCTransaction(tx, common.Hash{}, 0, 0, nil)
+}
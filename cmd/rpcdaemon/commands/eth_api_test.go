@@ -2,9 +2,16 @@ package commands
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/reorgs"
+	"github.com/ledgerwatch/turbo-geth/rpc"
 )
 
 func TestGetTransactionReceipt(t *testing.T) {
@@ -18,3 +25,79 @@ func TestGetTransactionReceipt(t *testing.T) {
 		t.Errorf("calling GetTransactionReceipt with empty hash: %v", err)
 	}
 }
+
+func TestNewRPCTransactionAccessList(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x0d3ab14bbad3d99f4203bd7a11acb94882050e7e")
+	accesses := types.AccessList{{Address: to, StorageKeys: []common.Hash{{0x01}}}}
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	tx := types.MustSignNewTx(key, signer, &types.AccessListTx{
+		ChainID:    uint256.NewInt().SetUint64(1),
+		Nonce:      1,
+		GasPrice:   uint256.NewInt().SetUint64(10),
+		Gas:        50000,
+		To:         &to,
+		Value:      uint256.NewInt(),
+		AccessList: accesses,
+	})
+	result := newRPCTransaction(tx, common.Hash{0x02}, 5, 0, nil)
+	if result.Type != types.AccessListTxType {
+		t.Errorf("type: have %d, want %d", result.Type, types.AccessListTxType)
+	}
+	if result.From != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("sender: have %x, want %x", result.From, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	if result.ChainID == nil || result.ChainID.ToInt().Uint64() != 1 {
+		t.Errorf("chain id: have %v, want 1", result.ChainID)
+	}
+	if result.Accesses == nil || len(*result.Accesses) != 1 || (*result.Accesses)[0].Address != to {
+		t.Errorf("access list: have %v, want %v", result.Accesses, accesses)
+	}
+}
+
+func TestGetStaleBlockByHash(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	api := NewEthAPI(db, nil, 5000000, nil)
+	ctx := context.Background()
+	block, err := readBlockByNumber(db, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := block.Hash()
+	fields, err := api.GetBlockByHash(ctx, rpc.BlockNumberOrHashWithHash(hash, false), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["canonical"]; ok {
+		t.Errorf("canonical block marked with %v", fields["canonical"])
+	}
+
+	// Block 5 is reorged out, but still in the database
+	if err = rawdb.WriteCanonicalHash(db, common.Hash{1}, 5); err != nil {
+		t.Fatal(err)
+	}
+	if fields, err = api.GetBlockByHash(ctx, rpc.BlockNumberOrHashWithHash(hash, false), false); err != nil {
+		t.Fatal(err)
+	}
+	if fields["canonical"] != false {
+		t.Errorf("block reorged out marked with %v", fields["canonical"])
+	}
+
+	// The block reorged out which is not in the database is only served from the stale blocks
+	stale := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(5), Extra: []byte("stale")})
+	if _, err = api.GetBlockByHash(ctx, rpc.BlockNumberOrHashWithHash(stale.Hash(), false), false); err == nil {
+		t.Errorf("expected the stale block not to be found")
+	}
+	api.staleBlocks = reorgs.NewStaleBlocks(10)
+	api.staleBlocks.Add(stale, big.NewInt(100))
+	if fields, err = api.GetBlockByHash(ctx, rpc.BlockNumberOrHashWithHash(stale.Hash(), false), false); err != nil {
+		t.Fatal(err)
+	}
+	if fields["hash"] != stale.Hash() || fields["canonical"] != false {
+		t.Errorf("stale block served as %x, canonical %v", fields["hash"], fields["canonical"])
+	}
+}
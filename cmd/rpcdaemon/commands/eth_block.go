@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"fmt"
+	"math/big"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
@@ -20,13 +21,28 @@ func (api *APIImpl) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber
 	}
 	defer tx.Rollback()
 
+	if number == rpc.PendingBlockNumber && api.pending != nil {
+		pendingBlock, err := api.pending.Pending(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		response, err := ethapi.RPCMarshalBlock(pendingBlock.Block, true, fullTx, nil)
+		if err == nil {
+			// Pending blocks need to nil out a few fields
+			for _, field := range []string{"hash", "nonce", "miner"} {
+				response[field] = nil
+			}
+		}
+		return response, err
+	}
+
 	blockNum, err := getBlockNumber(number, tx)
 	if err != nil {
 		return nil, err
 	}
 	additionalFields := make(map[string]interface{})
 
-	block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+	block, err := readBlockByNumber(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -71,19 +87,31 @@ func (api *APIImpl) GetBlockByHash(ctx context.Context, numberOrHash rpc.BlockNu
 
 	additionalFields := make(map[string]interface{})
 
-	block, err := rawdb.ReadBlockByHash(tx, hash)
+	block, err := readBlockByHash(tx, hash)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	var td *big.Int
+	if block != nil {
+		if td, err = rawdb.ReadTd(tx, hash, block.NumberU64()); err != nil {
+			return nil, err
+		}
+		canonicalHash, err := rawdb.ReadCanonicalHash(tx, block.NumberU64())
+		if err != nil {
+			return nil, err
+		}
+		if canonicalHash != hash {
+			additionalFields["canonical"] = false
+		}
+	} else if stale := api.staleBlocks.Get(hash); stale != nil {
+		// Reorged out of the canonical chain recently, and not in the database anymore
+		block, td = stale.Block, stale.Td
+		additionalFields["canonical"] = false
+	} else {
 		return nil, fmt.Errorf("block not found: %x", hash)
 	}
 	number := block.NumberU64()
 
-	td, err := rawdb.ReadTd(tx, hash, number)
-	if err != nil {
-		return nil, err
-	}
 	additionalFields["totalDifficulty"] = (*hexutil.Big)(td)
 	response, err := ethapi.RPCMarshalBlock(block, true, fullTx, additionalFields)
 
@@ -109,14 +137,14 @@ func (api *APIImpl) GetBlockTransactionCountByNumber(ctx context.Context, blockN
 		return nil, err
 	}
 
-	block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+	count, ok, err := getTxCount(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
-	if block == nil {
+	if !ok {
 		return nil, fmt.Errorf("block not found: %d", blockNum)
 	}
-	n := hexutil.Uint(len(block.Transactions()))
+	n := hexutil.Uint(count)
 	return &n, nil
 }
 
@@ -128,7 +156,25 @@ func (api *APIImpl) GetBlockTransactionCountByHash(ctx context.Context, blockHas
 	}
 	defer tx.Rollback()
 
-	block, err := rawdb.ReadBlockByHash(tx, blockHash)
+	// Only the canonical blocks are in the index of the counts
+	if blockNum := rawdb.ReadHeaderNumber(tx, blockHash); blockNum != nil {
+		canonicalHash, err := rawdb.ReadCanonicalHash(tx, *blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if canonicalHash == blockHash {
+			count, ok, err := getTxCount(tx, *blockNum)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				n := hexutil.Uint(count)
+				return &n, nil
+			}
+		}
+	}
+
+	block, err := readBlockByHash(tx, blockHash)
 	if err != nil {
 		return nil, err
 	}
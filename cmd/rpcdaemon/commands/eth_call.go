@@ -12,6 +12,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/pending"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
@@ -34,9 +35,26 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 		return nil, err
 	}
 
-	result, err := transactions.DoCall(ctx, args, dbtx, blockNrOrHash, overrides, api.GasCap, chainConfig)
-	if err != nil {
-		return nil, err
+	var result *core.ExecutionResult
+	if num, ok := blockNrOrHash.Number(); ok && num == rpc.PendingBlockNumber && api.pending != nil {
+		pendingBlock, err := api.pending.Pending(ctx, dbtx)
+		if err != nil {
+			return nil, err
+		}
+		result, err = transactions.DoCallOnState(ctx, args, dbtx, pendingBlock.StateReader(dbtx), pendingBlock.Block.Header(), false, overrides, api.GasCap, chainConfig)
+		if err != nil {
+			return nil, err
+		}
+	} else if num, ok := blockNrOrHash.Number(); ok && num == rpc.LatestBlockNumber && api.stateCache != nil {
+		result, err = api.callOnCachedLatest(ctx, args, dbtx, overrides, chainConfig)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		result, err = transactions.DoCall(ctx, args, dbtx, blockNrOrHash, overrides, api.GasCap, chainConfig)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// If the result contains a revert reason, try to unpack and return it.
@@ -47,7 +65,26 @@ func (api *APIImpl) Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHas
 	return result.Return(), result.Err
 }
 
+// callOnCachedLatest executes the call on top of the latest executed block, reading its state through the state cache
+// shared by the calls
+func (api *APIImpl) callOnCachedLatest(ctx context.Context, args ethapi.CallArgs, dbtx ethdb.Database, overrides *map[common.Address]ethapi.Account, chainConfig *params.ChainConfig) (*core.ExecutionResult, error) {
+	blockNumber, err := stages.GetStageProgress(dbtx, stages.Execution)
+	if err != nil {
+		return nil, fmt.Errorf("getting latest block number: %w", err)
+	}
+	header := rawdb.ReadHeaderByNumber(dbtx, blockNumber)
+	if header == nil {
+		return nil, fmt.Errorf("block %d not found", blockNumber)
+	}
+	stateReader, err := api.stateCache.Reader(dbtx, state.NewPlainStateReader(dbtx), blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return transactions.DoCallOnState(ctx, args, dbtx, stateReader, header, false, overrides, api.GasCap, chainConfig)
+}
+
 // EstimateGas implements eth_estimateGas. Returns an estimate of how much gas is necessary to allow the transaction to complete. The transaction will not be added to the blockchain.
+// The estimation is done on top of the pending block when the pending block builder is on, otherwise on top of the latest block.
 func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexutil.Uint64, error) {
 	dbtx, err := api.db.Begin(ctx, ethdb.RO)
 	if err != nil {
@@ -55,6 +92,13 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexu
 	}
 	defer dbtx.Rollback()
 
+	var pendingBlock *pending.Block
+	if api.pending != nil {
+		if pendingBlock, err = api.pending.Pending(ctx, dbtx); err != nil {
+			return 0, err
+		}
+	}
+
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
 		lo  uint64 = params.TxGas - 1
@@ -74,6 +118,8 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexu
 	// Determine the highest gas limit can be used during the estimation.
 	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
 		hi = uint64(*args.Gas)
+	} else if pendingBlock != nil {
+		hi = pendingBlock.Block.GasLimit()
 	} else {
 		// Retrieve the block to act as the gas ceiling
 		var blockNumber uint64
@@ -86,7 +132,10 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexu
 	}
 	// Recap the highest gas limit with account's available balance.
 	if args.GasPrice != nil && args.GasPrice.ToInt().Uint64() != 0 {
-		stateReader := state.NewPlainStateReader(dbtx)
+		var stateReader state.StateReader = state.NewPlainStateReader(dbtx)
+		if pendingBlock != nil {
+			stateReader = pendingBlock.StateReader(dbtx)
+		}
 		state := state.New(stateReader)
 		if state == nil {
 			return 0, fmt.Errorf("can't get the current state")
@@ -123,7 +172,13 @@ func (api *APIImpl) EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexu
 	executable := func(gas uint64) (bool, *core.ExecutionResult, error) {
 		args.Gas = (*hexutil.Uint64)(&gas)
 
-		result, err := transactions.DoCall(ctx, args, dbtx, rpc.BlockNumberOrHash{BlockNumber: &lastBlockNum}, nil, api.GasCap, chainConfig)
+		var result *core.ExecutionResult
+		var err error
+		if pendingBlock != nil {
+			result, err = transactions.DoCallOnState(ctx, args, dbtx, pendingBlock.StateReader(dbtx), pendingBlock.Block.Header(), false, nil, api.GasCap, chainConfig)
+		} else {
+			result, err = transactions.DoCall(ctx, args, dbtx, rpc.BlockNumberOrHash{BlockNumber: &lastBlockNum}, nil, api.GasCap, chainConfig)
+		}
 		if err != nil {
 			if errors.Is(err, core.ErrIntrinsicGas) {
 				// Special case, raise gas limit
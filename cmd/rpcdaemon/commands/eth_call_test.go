@@ -2,10 +2,20 @@ package commands
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/pending"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestEstimateGas(t *testing.T) {
@@ -23,3 +33,61 @@ func TestEstimateGas(t *testing.T) {
 		t.Errorf("calling EstimateGas: %v", err)
 	}
 }
+
+func TestCallPending(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{0x42}
+	acc, err := state.NewPlainStateReader(db).ReadAccountData(sender)
+	require.NoError(t, err)
+	txn, err := types.SignTx(types.NewTransaction(acc.Nonce, to, uint256.NewInt().SetUint64(1000), 21000, new(uint256.Int), nil), types.HomesteadSigner{}, key)
+	require.NoError(t, err)
+
+	api := NewEthAPI(db, nil, 5000000, nil)
+	api.pending = pending.NewBuilder(db, func(context.Context) (map[common.Address]types.Transactions, error) {
+		return map[common.Address]types.Transactions{sender: {txn}}, nil
+	}, common.Address{})
+	block, err := api.GetBlockByNumber(ctx, rpc.PendingBlockNumber, false)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{txn.Hash()}, block["transactions"])
+	assert.Nil(t, block["hash"])
+
+	// Only the pending state has the ethers to send
+	value := (*hexutil.Big)(big.NewInt(1000))
+	args := ethapi.CallArgs{From: &to, To: &sender, Value: value}
+	latest := rpc.LatestBlockNumber
+	_, err = api.Call(ctx, args, rpc.BlockNumberOrHash{BlockNumber: &latest}, nil)
+	assert.Error(t, err)
+	pendingNumber := rpc.PendingBlockNumber
+	_, err = api.Call(ctx, args, rpc.BlockNumberOrHash{BlockNumber: &pendingNumber}, nil)
+	assert.NoError(t, err)
+	gas, err := api.EstimateGas(ctx, args)
+	require.NoError(t, err)
+	assert.Equal(t, hexutil.Uint64(21000), gas)
+}
+
+func TestCallStateCache(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{0x42}
+
+	api := NewEthAPI(db, nil, 5000000, nil)
+	api.stateCache, err = state.NewReadCacheOfAccounts(16)
+	require.NoError(t, err)
+	latest := rpc.BlockNumberOrHash{BlockNumber: new(rpc.BlockNumber)}
+	*latest.BlockNumber = rpc.LatestBlockNumber
+	value := (*hexutil.Big)(big.NewInt(1000))
+	// The second calls read the cached state, the same as the first ones
+	for i := 0; i < 2; i++ {
+		_, err = api.Call(ctx, ethapi.CallArgs{From: &sender, To: &to, Value: value}, latest, nil)
+		assert.NoError(t, err)
+		_, err = api.Call(ctx, ethapi.CallArgs{From: &to, To: &sender, Value: value}, latest, nil)
+		assert.Error(t, err)
+	}
+}
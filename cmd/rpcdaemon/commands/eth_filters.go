@@ -2,17 +2,24 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rpc"
 )
 
-// NewPendingTransactionFilter new transaction filter
-func (api *APIImpl) NewPendingTransactionFilter(_ context.Context) (hexutil.Uint64, error) {
-	return 0, fmt.Errorf(NotImplemented, "eth_newPendingTransactionFilter")
+// NewPendingTransactionFilter implements eth_newPendingTransactionFilter. Creates a filter collecting the hashes of the
+// transactions entering the pending state, only the ones matching the optional criteria
+func (api *APIImpl) NewPendingTransactionFilter(_ context.Context, crit *filters.PendingTxCriteria) (hexutil.Uint64, error) {
+	if api.filters == nil {
+		return 0, rpc.ErrNotificationsUnsupported
+	}
+	return hexutil.Uint64(api.filters.NewPendingTxsFilter(crit)), nil
 }
 
 // NewBlockFilter new transaction filter
@@ -25,15 +32,28 @@ func (api *APIImpl) NewFilter(_ context.Context, filter interface{}) (hexutil.Ui
 	return 0, fmt.Errorf(NotImplemented, "eth_newFilter")
 }
 
-// UninstallFilter new transaction filter
+// UninstallFilter implements eth_uninstallFilter. Removes the pending transaction filter, returns false if there is no such filter
 func (api *APIImpl) UninstallFilter(_ context.Context, index hexutil.Uint64) (bool, error) {
-	return false, fmt.Errorf(NotImplemented, "eth_uninstallFilter")
+	if api.filters == nil {
+		return false, fmt.Errorf(NotImplemented, "eth_uninstallFilter")
+	}
+	return api.filters.UninstallFilter(uint64(index)), nil
 }
 
-// GetFilterChanges implements eth_getFilterChanges. Polling method for a previously-created filter, which returns an array of logs which occurred since last poll.
+// GetFilterChanges implements eth_getFilterChanges. Polling method for a previously-created pending transaction filter, which returns the hashes of the transactions which entered the pending state since last poll.
 func (api *APIImpl) GetFilterChanges(_ context.Context, index hexutil.Uint64) ([]interface{}, error) {
-	var stub []interface{}
-	return stub, fmt.Errorf(NotImplemented, "eth_getFilterChanges")
+	if api.filters == nil {
+		return nil, fmt.Errorf(NotImplemented, "eth_getFilterChanges")
+	}
+	hashes, ok := api.filters.PendingTxsFilterChanges(uint64(index))
+	if !ok {
+		return nil, errors.New("filter not found")
+	}
+	changes := make([]interface{}, len(hashes))
+	for i, h := range hashes {
+		changes[i] = h
+	}
+	return changes, nil
 }
 
 // NewHeads send a notification each time a new (header) block is appended to the chain.
@@ -68,3 +88,42 @@ func (api *APIImpl) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
 
 	return rpcSub, nil
 }
+
+// NewPendingTransactions send a notification each time a transaction enters the pending state, only for the ones
+// matching the optional criteria
+func (api *APIImpl) NewPendingTransactions(ctx context.Context, crit *filters.PendingTxCriteria) (*rpc.Subscription, error) {
+	if api.filters == nil {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		txHashes := make(chan []common.Hash, 128)
+		id := api.filters.SubscribePendingTxs(crit, txHashes)
+
+		for {
+			select {
+			case hashes := <-txHashes:
+				for _, h := range hashes {
+					err := notifier.Notify(rpcSub.ID, h)
+					if err != nil {
+						log.Warn("error while notifying subscription", "err", err)
+					}
+				}
+			case <-rpcSub.Err():
+				api.filters.Unsubscribe(id)
+				return
+			case <-notifier.Closed():
+				api.filters.Unsubscribe(id)
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
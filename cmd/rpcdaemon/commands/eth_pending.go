@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/filters"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/pending"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// buildPending starts the builder of the pending block from the transaction pool of turbo-geth, rebuilding it on
+// the new heads and every interval. The pool and the heads only come with the connection to the private API,
+// without it or with the zero interval there is no builder and "pending" is the latest block
+func buildPending(db ethdb.Database, eth core.ApiBackend, ff *filters.Filters, interval time.Duration) *pending.Builder {
+	if eth == nil || ff == nil || interval == 0 {
+		return nil
+	}
+	coinbase, err := eth.Etherbase(context.Background())
+	if err != nil {
+		log.Debug("Building the pending blocks without the etherbase", "err", err)
+		coinbase = common.Address{}
+	}
+	builder := pending.NewBuilder(db, func(ctx context.Context) (map[common.Address]types.Transactions, error) {
+		txs, _, err := eth.TxPoolContent(ctx, nil)
+		return txs, err
+	}, coinbase)
+	heads := make(chan *types.Header, 8)
+	ff.SubscribeNewHeads(heads)
+	go builder.Run(heads, interval, nil)
+	return builder
+}
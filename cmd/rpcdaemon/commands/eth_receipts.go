@@ -17,16 +17,33 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
 	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
 	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
 )
 
-func getReceipts(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, number uint64, hash common.Hash) (types.Receipts, error) {
+// getReceipts reads the stored receipts of the block, or regenerates them by re-executing the block on top of the
+// historical state when they are not stored. The regenerated receipts are cached in api.receiptsCache
+func (api *BaseAPI) getReceipts(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, number uint64, hash common.Hash) (types.Receipts, error) {
 	if cached := rawdb.ReadReceipts(tx, hash, number); cached != nil {
+		if err := validateReceipts(tx, cached, hash, number); err != nil {
+			return nil, err
+		}
 		return cached, nil
 	}
+	if api.receiptsCache != nil {
+		if receipts, ok := api.receiptsCache.Get(hash); ok {
+			return receipts.(types.Receipts), nil
+		}
+	}
 
-	block := rawdb.ReadBlock(tx, hash, number)
+	block, err := readBlock(tx, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found: %d %x", number, hash)
+	}
 
 	cc := adapter.NewChainContext(tx)
 	bc := adapter.NewBlockGetter(tx)
@@ -46,112 +63,61 @@ func getReceipts(ctx context.Context, tx ethdb.Database, chainConfig *params.Cha
 		if err != nil {
 			return nil, err
 		}
+		receipt.BlockHash = hash
 		receipts = append(receipts, receipt)
 	}
+	if err = validateReceipts(tx, receipts, hash, number); err != nil {
+		return nil, err
+	}
+	if api.receiptsCache != nil {
+		api.receiptsCache.Add(hash, receipts)
+	}
 
 	return receipts, nil
 }
 
 // GetLogs implements eth_getLogs. Returns an array of logs matching a given filter object.
-func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error) {
-	var begin, end uint64
-	var logs []*types.Log //nolint:prealloc
-
+// The blocks are found by the cheapest plan of planLogs. Without --rpc.logs.limit the logs are streamed to the client
+// block by block, instead of being collected in memory first. With the limit, the logs up to it are collected first,
+// the query matching more logs fails with the limit exceeded error telling where to continue from
+func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria, stream *rpc.Stream) error {
 	tx, beginErr := api.db.Begin(ctx, ethdb.RO)
 	if beginErr != nil {
-		return returnLogs(logs), beginErr
+		return beginErr
 	}
 	defer tx.Rollback()
 
-	if crit.BlockHash != nil {
-		number := rawdb.ReadHeaderNumber(tx, *crit.BlockHash)
-		if number == nil {
-			return nil, fmt.Errorf("block not found: %x", *crit.BlockHash)
-		}
-		begin = *number
-		end = *number
-	} else {
-		// Convert the RPC block numbers into internal representations
-		latest, err := getLatestBlockNumber(tx)
-		if err != nil {
-			return nil, err
-		}
-
-		begin = latest
-		if crit.FromBlock != nil {
-			begin = crit.FromBlock.Uint64()
-		}
-		end = latest
-		if crit.ToBlock != nil {
-			end = crit.ToBlock.Uint64()
-		}
-	}
-
-	blockNumbers := roaring.New()
-	blockNumbers.AddRange(begin, end+1) // [min,max)
-
-	topicsBitmap, err := getTopicsBitmap(tx, crit.Topics, uint32(begin), uint32(end))
+	begin, end, err := logsRange(tx, crit)
 	if err != nil {
-		return nil, err
-	}
-	if topicsBitmap != nil {
-		if blockNumbers == nil {
-			blockNumbers = topicsBitmap
-		} else {
-			blockNumbers.And(topicsBitmap)
-		}
+		return err
 	}
-
-	var addrBitmap *roaring.Bitmap
-	for _, addr := range crit.Addresses {
-		m, err := bitmapdb.Get(tx, dbutils.LogAddressIndex, addr[:], uint32(begin), uint32(end))
-		if err != nil {
-			return nil, err
-		}
-		if addrBitmap == nil {
-			addrBitmap = m
-		} else {
-			addrBitmap = roaring.Or(addrBitmap, m)
-		}
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return err
 	}
-
-	if addrBitmap != nil {
-		if blockNumbers == nil {
-			blockNumbers = addrBitmap
-		} else {
-			blockNumbers.And(addrBitmap)
+	if api.logsLimit == 0 {
+		stream.BeginArray()
+		if _, err = api.streamLogs(ctx, tx, cc, crit, begin, end, nil, 0, func(log *types.Log) error {
+			return stream.Value(log)
+		}); err != nil {
+			return err
 		}
+		stream.EndArray()
+		return nil
 	}
-
-	if blockNumbers.GetCardinality() == 0 {
-		return returnLogs(logs), nil
-	}
-
-	cc, err := api.chainConfig(tx)
+	// The error can't follow the logs which reached the client already
+	logs := make([]*types.Log, 0)
+	next, err := api.streamLogs(ctx, tx, cc, crit, begin, end, nil, api.logsLimit, func(log *types.Log) error {
+		logs = append(logs, log)
+		return nil
+	})
 	if err != nil {
-		return returnLogs(logs), err
+		return err
 	}
-	for _, blockNToMatch := range blockNumbers.ToArray() {
-		blockHash, err := rawdb.ReadCanonicalHash(tx, uint64(blockNToMatch))
-		if err != nil {
-			return returnLogs(logs), err
-		}
-		if blockHash == (common.Hash{}) {
-			return returnLogs(logs), fmt.Errorf("block not found %d", uint64(blockNToMatch))
-		}
-		receipts, err := getReceipts(ctx, tx, cc, uint64(blockNToMatch), blockHash)
-		if err != nil {
-			return returnLogs(logs), err
-		}
-		unfiltered := make([]*types.Log, 0, len(receipts))
-		for _, receipt := range receipts {
-			unfiltered = append(unfiltered, receipt.Logs...)
-		}
-		unfiltered = filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics)
-		logs = append(logs, unfiltered...)
+	if next != nil {
+		return &logsLimitError{limit: api.logsLimit, next: next}
 	}
-
-	return returnLogs(logs), nil
+	return stream.Value(logs)
 }
 
 // The Topic list restricts matches to particular event topics. Each event has a list
@@ -202,15 +168,26 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 
 	// Retrieve the transaction and assemble its EVM context
 	txn, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(tx, hash)
-	if txn == nil {
-		return nil, nil
-	}
-
 	cc, err := api.chainConfig(tx)
 	if err != nil {
 		return nil, err
 	}
-	receipts, err := getReceipts(ctx, tx, cc, blockNumber, blockHash)
+	if txn == nil {
+		if cc.Bor == nil {
+			return nil, nil
+		}
+		// The bor system transactions aren't in the bodies, they have their own lookup
+		number, err := rawdb.ReadBorTxLookupEntry(tx, hash)
+		if err != nil || number == nil {
+			return nil, err
+		}
+		canonicalHash, err := rawdb.ReadCanonicalHash(tx, *number)
+		if err != nil {
+			return nil, err
+		}
+		return api.borBlockReceipt(ctx, tx, cc, *number, canonicalHash)
+	}
+	receipts, err := api.getReceipts(ctx, tx, cc, blockNumber, blockHash)
 	if err != nil {
 		return nil, fmt.Errorf("getReceipts error: %v", err)
 	}
@@ -219,11 +196,69 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 	}
 	receipt := receipts[txIndex]
 
+	return marshalReceipt(receipt, txn, blockHash, blockNumber, txIndex), nil
+}
+
+// GetBorBlockReceipt implements eth_getBorBlockReceipt. Returns the receipt of the bor system transaction committing
+// the state sync events of the block, nil if the block committed none.
+func (api *APIImpl) GetBorBlockReceipt(ctx context.Context, blockHash common.Hash) (map[string]interface{}, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	if cc.Bor == nil {
+		return nil, nil
+	}
+	number := rawdb.ReadHeaderNumber(tx, blockHash)
+	if number == nil {
+		return nil, nil
+	}
+	return api.borBlockReceipt(ctx, tx, cc, *number, blockHash)
+}
+
+// borBlockReceipt returns the fields of the receipt of the bor system transaction of the block, which follows the
+// receipts of its transactions
+func (api *APIImpl) borBlockReceipt(ctx context.Context, tx ethdb.Database, cc *params.ChainConfig, number uint64, hash common.Hash) (map[string]interface{}, error) {
+	receipts, err := api.getReceipts(ctx, tx, cc, number, hash)
+	if err != nil {
+		return nil, fmt.Errorf("getReceipts error: %v", err)
+	}
+	receipt := rawdb.ReadBorReceipt(tx, hash, number, receipts)
+	if receipt == nil {
+		return nil, nil
+	}
+	fields := map[string]interface{}{
+		"blockHash":         hash,
+		"blockNumber":       hexutil.Uint64(number),
+		"transactionHash":   receipt.TxHash,
+		"transactionIndex":  hexutil.Uint64(receipt.TransactionIndex),
+		"from":              common.Address{},
+		"to":                common.Address{},
+		"gasUsed":           hexutil.Uint64(0),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"contractAddress":   nil,
+		"logs":              receipt.Logs,
+		"logsBloom":         receipt.Bloom,
+		"status":            hexutil.Uint(receipt.Status),
+		"type":              hexutil.Uint(0),
+	}
+	return fields, nil
+}
+
+// marshalReceipt returns the fields of the receipt of eth_getTransactionReceipt
+func marshalReceipt(receipt *types.Receipt, txn *types.Transaction, blockHash common.Hash, blockNumber uint64, txIndex uint64) map[string]interface{} {
 	var signer types.Signer = types.FrontierSigner{}
 	if txn.Protected() {
-		signer = types.NewEIP155Signer(txn.ChainId().ToBig())
+		signer = types.LatestSignerForChainID(txn.ChainId().ToBig())
 	}
 	from, _ := types.Sender(signer, txn)
+	hash := txn.Hash()
 
 	// Fill in the derived information in the logs
 	if receipt.Logs != nil {
@@ -248,6 +283,7 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 		"contractAddress":   nil,
 		"logs":              receipt.Logs,
 		"logsBloom":         types.CreateBloom(types.Receipts{receipt}),
+		"type":              hexutil.Uint(txn.Type()),
 	}
 
 	// Assign receipt status or post state.
@@ -263,7 +299,7 @@ func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash)
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	return fields
 }
 
 func includes(addresses []common.Address, a common.Address) bool {
@@ -311,10 +347,3 @@ Logs:
 	}
 	return ret
 }
-
-func returnLogs(logs []*types.Log) []*types.Log {
-	if logs == nil {
-		return []*types.Log{}
-	}
-	return logs
-}
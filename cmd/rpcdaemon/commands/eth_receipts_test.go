@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/accounts/abi/bind"
+	"github.com/ledgerwatch/turbo-geth/accounts/abi/bind/backends"
+	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/commands/contracts"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReceiptsPruned(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	receiptsCache, err := lru.New(16)
+	require.NoError(t, err)
+	api := &BaseAPI{receiptsCache: receiptsCache}
+	cc, err := api.chainConfig(db)
+	require.NoError(t, err)
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	for n := uint64(1); n <= 10; n++ {
+		hash, err := rawdb.ReadCanonicalHash(tx, n)
+		require.NoError(t, err)
+		stored, err := api.getReceipts(context.Background(), tx, cc, n, hash)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+
+		require.NoError(t, rawdb.DeleteReceipts(tx, n))
+		require.Nil(t, rawdb.ReadReceipts(tx, hash, n))
+		regenerated, err := api.getReceipts(context.Background(), tx, cc, n, hash)
+		require.NoError(t, err)
+		require.Len(t, regenerated, len(stored))
+		for i := range stored {
+			// The blooms are not stored, they are only in the regenerated receipts
+			r := *regenerated[i]
+			assert.Equal(t, types.CreateBloom(types.Receipts{&r}), r.Bloom)
+			r.Bloom = stored[i].Bloom
+			assert.Equal(t, *stored[i], r, "block %d receipt %d", n, i)
+		}
+
+		cached, ok := receiptsCache.Get(hash)
+		require.True(t, ok)
+		again, err := api.getReceipts(context.Background(), tx, cc, n, hash)
+		require.NoError(t, err)
+		assert.Equal(t, cached, again)
+	}
+}
+
+// createLogsTestDb generates the chain deploying Poly in the block 1, emitting 2 logs in the block 2 and 1 in the block 3
+func createLogsTestDb(t *testing.T) (ethdb.Database, common.Address) {
+	db := ethdb.NewMemDatabase()
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	gspec := &core.Genesis{
+		Config: params.AllEthashProtocolChanges,
+		Alloc:  core.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: big.NewInt(9000000000000000000)}},
+	}
+	_, genesisHash, _, err := core.SetupGenesisBlock(db, gspec, true, false)
+	require.NoError(t, err)
+	genesis := rawdb.ReadBlock(db, genesisHash, 0)
+	engine := ethash.NewFaker()
+	contractBackend := backends.NewSimulatedBackendWithConfig(gspec.Alloc, gspec.Config, gspec.GasLimit)
+	transactOpts, _ := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	var polyAddr common.Address
+	var poly *contracts.Poly
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, engine, db, 3, func(i int, block *core.BlockGen) {
+		var tx *types.Transaction
+		var err error
+		switch i {
+		case 0:
+			polyAddr, tx, poly, err = contracts.DeployPoly(transactOpts, contractBackend)
+			require.NoError(t, err)
+			block.AddTx(tx)
+		case 1:
+			for salt := int64(0); salt < 2; salt++ {
+				tx, err = poly.Deploy(transactOpts, big.NewInt(salt))
+				require.NoError(t, err)
+				block.AddTx(tx)
+			}
+		case 2:
+			tx, err = poly.Deploy(transactOpts, big.NewInt(2))
+			require.NoError(t, err)
+			block.AddTx(tx)
+		}
+		contractBackend.Commit()
+	}, true)
+	require.NoError(t, err)
+	_, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, engine, blocks, true /* rootCheck */)
+	require.NoError(t, err)
+	return db, polyAddr
+}
+
+func TestGetLogsPlanAndLimit(t *testing.T) {
+	db, poly := createLogsTestDb(t)
+	defer db.Close()
+	ctx := context.Background()
+	crit := filters.FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(3), Addresses: []common.Address{poly}}
+
+	for _, tt := range []struct {
+		crit filters.FilterCriteria
+		plan string
+	}{
+		{filters.FilterCriteria{}, "scan"},
+		{crit, "addresses"},
+		{filters.FilterCriteria{Topics: [][]common.Hash{{common.Hash{1}}}}, "topics"},
+		{filters.FilterCriteria{Addresses: []common.Address{poly}, Topics: [][]common.Hash{{common.Hash{1}}}}, "topics"},
+	} {
+		plan, err := planLogs(db, tt.crit, 0, 3)
+		require.NoError(t, err)
+		assert.Equal(t, tt.plan, plan.String(), "%+v", tt.crit)
+	}
+
+	var buf bytes.Buffer
+	stream := rpc.NewStream(&buf)
+	require.NoError(t, NewEthAPI(db, nil, 0, nil).GetLogs(ctx, crit, stream))
+	require.NoError(t, stream.Flush())
+	var all []*types.Log
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &all))
+	require.Len(t, all, 3)
+
+	ethAPI := NewEthAPI(db, nil, 0, nil)
+	ethAPI.logsLimit = 2
+	buf.Reset()
+	stream = rpc.NewStream(&buf)
+	err := ethAPI.GetLogs(ctx, crit, stream)
+	var limitErr *logsLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, -32005, limitErr.ErrorCode())
+	assert.Equal(t, &logsContinuation{Block: 3}, limitErr.next)
+	require.NoError(t, stream.Flush())
+	assert.Zero(t, buf.Len(), "the logs are written before the error")
+
+	// tg_getLogs pages through the same logs by the continuation
+	tgAPI := NewTgAPI(db, nil, 0, nil)
+	tgAPI.logsLimit = 1 // The continuations point into the middle of the block 2, then to the block 3
+	var paged []*types.Log
+	var continuation *hexutil.Bytes
+	for i := 0; ; i++ {
+		require.LessOrEqual(t, i, len(all))
+		buf.Reset()
+		stream := rpc.NewStream(&buf)
+		require.NoError(t, tgAPI.GetLogs(ctx, crit, continuation, stream))
+		require.NoError(t, stream.Flush())
+		var page struct {
+			Logs         []*types.Log   `json:"logs"`
+			Continuation *hexutil.Bytes `json:"continuation"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &page))
+		paged = append(paged, page.Logs...)
+		if page.Continuation == nil {
+			break
+		}
+		require.Len(t, page.Logs, 1)
+		continuation = page.Continuation
+	}
+	assert.Equal(t, all, paged)
+	assert.Error(t, tgAPI.GetLogs(ctx, crit, &hexutil.Bytes{1}, rpc.NewStream(&buf)))
+}
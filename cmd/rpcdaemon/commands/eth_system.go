@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
@@ -12,6 +13,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/eth/protocols/eth"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/rpc"
@@ -81,6 +83,23 @@ func (api *APIImpl) GasPrice(ctx context.Context) (*hexutil.Big, error) {
 	return (*hexutil.Big)(price), err
 }
 
+// MaxPriorityFeePerGas implements eth_maxPriorityFeePerGas. Returns a suggestion for the tip (priority fee) per gas in wei.
+func (api *APIImpl) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	oracle := gasprice.NewOracle(api, ethconfig.Defaults.GPO)
+	tipcap, err := oracle.SuggestTipCap(ctx)
+	return (*hexutil.Big)(tipcap), err
+}
+
+// FeeHistory implements eth_feeHistory. Returns the base fees, gas used ratios and the tips at the given percentiles for a range of blocks.
+func (api *APIImpl) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*ethapi.FeeHistoryResult, error) {
+	oracle := gasprice.NewOracle(api, ethconfig.Defaults.GPO)
+	oldest, reward, baseFee, gasUsed, err := oracle.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	return ethapi.NewFeeHistoryResult(oldest, reward, baseFee, gasUsed), nil
+}
+
 // HeaderByNumber is necessary for gasprice.OracleBackend implementation
 func (api *APIImpl) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
 	tx, err := api.db.Begin(ctx, ethdb.RO)
@@ -114,7 +133,7 @@ func (api *APIImpl) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (
 		return nil, err
 	}
 
-	block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+	block, err := readBlockByNumber(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +143,25 @@ func (api *APIImpl) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (
 	return block, nil
 }
 
+// GetReceipts is necessary for gasprice.OracleBackend implementation
+func (api *APIImpl) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	number := rawdb.ReadHeaderNumber(tx, hash)
+	if number == nil {
+		return nil, fmt.Errorf("block not found: %x", hash)
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	return api.getReceipts(ctx, tx, chainConfig, *number, hash)
+}
+
 // ChainConfig is necessary for gasprice.OracleBackend implementation
 func (api *APIImpl) ChainConfig() *params.ChainConfig {
 	tx, err := api.db.Begin(context.TODO(), ethdb.RO)
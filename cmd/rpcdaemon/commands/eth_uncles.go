@@ -26,7 +26,7 @@ func (api *APIImpl) GetUncleByBlockNumberAndIndex(ctx context.Context, number rp
 	if err != nil {
 		return nil, err
 	}
-	block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+	block, err := readBlockByNumber(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +58,7 @@ func (api *APIImpl) GetUncleByBlockHashAndIndex(ctx context.Context, hash common
 	}
 	defer tx.Rollback()
 
-	block, err := rawdb.ReadBlockByHash(tx, hash)
+	block, err := readBlockByHash(tx, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +98,7 @@ func (api *APIImpl) GetUncleCountByBlockNumber(ctx context.Context, number rpc.B
 		return &n, err
 	}
 
-	block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+	block, err := readBlockByNumber(tx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +117,7 @@ func (api *APIImpl) GetUncleCountByBlockHash(ctx context.Context, hash common.Ha
 	}
 	defer tx.Rollback()
 
-	block, err := rawdb.ReadBlockByHash(tx, hash)
+	block, err := readBlockByHash(tx, hash)
 	if err != nil {
 		return &n, err
 	}
@@ -0,0 +1,272 @@
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// logsBitmapLoadCost is the cost of loading one block number of an index bitmap, relative to reading the receipts of
+// one block. The plans of the log queries are compared in the units of the receipts read
+const logsBitmapLoadCost = 1.0 / 16
+
+// logsPlan is the way the blocks with the logs matching the criteria are found in the range: by the intersection of
+// the bitmaps of the addresses and/or the topics, or by the sequential scan of the receipts of all the blocks
+type logsPlan struct {
+	UseAddresses bool
+	UseTopics    bool
+	Blocks       float64 // estimated number of the blocks whose receipts are read
+	Cost         float64
+}
+
+func (p logsPlan) String() string {
+	switch {
+	case p.UseAddresses && p.UseTopics:
+		return "addresses+topics"
+	case p.UseAddresses:
+		return "addresses"
+	case p.UseTopics:
+		return "topics"
+	}
+	return "scan"
+}
+
+// planLogs chooses the cheapest plan of the log query in [begin, end]. The selectivity of the indices is estimated
+// from the cardinalities of the bitmaps of the addresses and the topics in the range, the alternatives of a topic
+// position are assumed to be disjoint and the positions and the addresses to be independent
+func planLogs(tx ethdb.Getter, crit filters.FilterCriteria, begin, end uint64) (logsPlan, error) {
+	blocks := float64(end - begin + 1)
+	scan := logsPlan{Blocks: blocks, Cost: blocks}
+
+	var addrCardinality uint64
+	for _, addr := range crit.Addresses {
+		c, err := bitmapdb.Cardinality(tx, dbutils.LogAddressIndex, addr[:], uint32(begin), uint32(end))
+		if err != nil {
+			return logsPlan{}, err
+		}
+		addrCardinality += c
+	}
+	addrBlocks := minFloat(blocks, float64(addrCardinality))
+
+	var topicsCardinality uint64
+	topicsBlocks := blocks
+	var useTopics bool
+	for _, sub := range crit.Topics {
+		if len(sub) == 0 {
+			continue
+		}
+		useTopics = true
+		var subCardinality uint64
+		for _, topic := range sub {
+			c, err := bitmapdb.Cardinality(tx, dbutils.LogTopicIndex, topic[:], uint32(begin), uint32(end))
+			if err != nil {
+				return logsPlan{}, err
+			}
+			subCardinality += c
+		}
+		topicsCardinality += subCardinality
+		topicsBlocks *= minFloat(blocks, float64(subCardinality)) / blocks
+	}
+
+	plans := []logsPlan{scan}
+	if len(crit.Addresses) > 0 {
+		plans = append(plans, logsPlan{UseAddresses: true, Blocks: addrBlocks, Cost: addrBlocks + logsBitmapLoadCost*float64(addrCardinality)})
+	}
+	if useTopics {
+		plans = append(plans, logsPlan{UseTopics: true, Blocks: topicsBlocks, Cost: topicsBlocks + logsBitmapLoadCost*float64(topicsCardinality)})
+	}
+	if len(crit.Addresses) > 0 && useTopics {
+		both := addrBlocks * topicsBlocks / blocks
+		plans = append(plans, logsPlan{UseAddresses: true, UseTopics: true, Blocks: both, Cost: both + logsBitmapLoadCost*float64(addrCardinality+topicsCardinality)})
+	}
+	best := plans[0]
+	for _, p := range plans[1:] {
+		if p.Cost < best.Cost {
+			best = p
+		}
+	}
+	return best, nil
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// blocks returns the candidate blocks of the plan in [begin, end]
+func (p logsPlan) blocks(tx ethdb.Getter, crit filters.FilterCriteria, begin, end uint64) (*roaring.Bitmap, error) {
+	blockNumbers := roaring.New()
+	blockNumbers.AddRange(begin, end+1) // [min,max)
+	if p.UseTopics {
+		topicsBitmap, err := getTopicsBitmap(tx, crit.Topics, uint32(begin), uint32(end))
+		if err != nil {
+			return nil, err
+		}
+		if topicsBitmap != nil {
+			blockNumbers.And(topicsBitmap)
+		}
+	}
+	if p.UseAddresses {
+		var addrBitmap *roaring.Bitmap
+		for _, addr := range crit.Addresses {
+			m, err := bitmapdb.Get(tx, dbutils.LogAddressIndex, addr[:], uint32(begin), uint32(end))
+			if err != nil {
+				return nil, err
+			}
+			if addrBitmap == nil {
+				addrBitmap = m
+			} else {
+				addrBitmap = roaring.Or(addrBitmap, m)
+			}
+		}
+		blockNumbers.And(addrBitmap)
+	}
+	return blockNumbers, nil
+}
+
+// logsContinuation is the position of the first log not returned by a log query which reached the limit: the block
+// and the number of the matching logs of the block already returned
+type logsContinuation struct {
+	Block uint64
+	Skip  uint32
+}
+
+// Encode returns the opaque token of the continuation
+func (c *logsContinuation) Encode() hexutil.Bytes {
+	token := make([]byte, 12)
+	binary.BigEndian.PutUint64(token, c.Block)
+	binary.BigEndian.PutUint32(token[8:], c.Skip)
+	return token
+}
+
+func decodeLogsContinuation(token hexutil.Bytes) (*logsContinuation, error) {
+	if len(token) != 12 {
+		return nil, fmt.Errorf("invalid continuation %s", token)
+	}
+	return &logsContinuation{Block: binary.BigEndian.Uint64(token), Skip: binary.BigEndian.Uint32(token[8:])}, nil
+}
+
+// logsLimitError is returned by eth_getLogs when the query matches more logs than the limit, instead of the logs
+type logsLimitError struct {
+	limit int
+	next  *logsContinuation
+}
+
+func (e *logsLimitError) Error() string {
+	return fmt.Sprintf("query returned more than %d logs, continue from the block %d or with tg_getLogs and the continuation %s", e.limit, e.next.Block, e.next.Encode())
+}
+
+// ErrorCode is the limit exceeded error of EIP-1474
+func (e *logsLimitError) ErrorCode() int { return -32005 }
+
+func (e *logsLimitError) ErrorData() interface{} {
+	return map[string]interface{}{"fromBlock": hexutil.Uint64(e.next.Block), "continuation": e.next.Encode()}
+}
+
+// logsRange resolves the range of the blocks of the criteria
+func logsRange(tx ethdb.Getter, crit filters.FilterCriteria) (uint64, uint64, error) {
+	if crit.BlockHash != nil {
+		number := rawdb.ReadHeaderNumber(tx, *crit.BlockHash)
+		if number == nil {
+			return 0, 0, fmt.Errorf("block not found: %x", *crit.BlockHash)
+		}
+		return *number, *number, nil
+	}
+	// Convert the RPC block numbers into internal representations
+	latest, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	begin, end := latest, latest
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Uint64()
+	}
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Uint64()
+	}
+	return begin, end, nil
+}
+
+// streamLogs passes the logs matching the criteria in [begin, end], starting from the continuation if it isn't nil,
+// to the emit function. When the limit is reached, it returns the continuation of the first log not emitted. The
+// limit 0 is no limit
+func (api *BaseAPI) streamLogs(ctx context.Context, tx ethdb.Database, cc *params.ChainConfig, crit filters.FilterCriteria, begin, end uint64, from *logsContinuation, limit int, emit func(*types.Log) error) (*logsContinuation, error) {
+	var skip uint32
+	if from != nil {
+		if from.Block < begin || from.Block > end {
+			return nil, fmt.Errorf("continuation from the block %d out of the range [%d, %d]", from.Block, begin, end)
+		}
+		begin, skip = from.Block, from.Skip
+	}
+	if begin > end {
+		return nil, nil
+	}
+	plan, err := planLogs(tx, crit, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("Planned the log query", "from", begin, "to", end, "plan", plan, "blocks", plan.Blocks, "cost", plan.Cost)
+	blockNumbers, err := plan.blocks(tx, crit, begin, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var emitted int
+	iter := blockNumbers.Iterator()
+	for iter.HasNext() {
+		blockNToMatch := uint64(iter.Next())
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		blockHash, err := rawdb.ReadCanonicalHash(tx, blockNToMatch)
+		if err != nil {
+			return nil, err
+		}
+		if blockHash == (common.Hash{}) {
+			return nil, fmt.Errorf("block not found %d", blockNToMatch)
+		}
+		receipts, err := api.getReceipts(ctx, tx, cc, blockNToMatch, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		unfiltered := make([]*types.Log, 0, len(receipts))
+		for _, receipt := range receipts {
+			unfiltered = append(unfiltered, receipt.Logs...)
+		}
+		matched := filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics)
+		if blockNToMatch == begin {
+			if int(skip) > len(matched) {
+				skip = uint32(len(matched))
+			}
+			matched = matched[skip:]
+		} else {
+			skip = 0
+		}
+		for i, l := range matched {
+			if limit > 0 && emitted == limit {
+				return &logsContinuation{Block: blockNToMatch, Skip: skip + uint32(i)}, nil
+			}
+			if err = emit(l); err != nil {
+				return nil, err
+			}
+			emitted++
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// OtterscanAPILevel is the level of the ots_ API the block explorers check with ots_getApiLevel before using it
+const OtterscanAPILevel = 1
+
+// OtterscanAPI Otterscan compatible routines, so that the block explorers can run directly against the node without
+// an external indexer
+type OtterscanAPI interface {
+	GetApiLevel() uint8
+
+	// Search related (see ./ots_search.go)
+	SearchTransactionsBefore(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error)
+	SearchTransactionsAfter(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error)
+
+	// Contracts related (see ./ots_contracts.go)
+	GetContractCreator(ctx context.Context, addr common.Address) (*ContractCreator, error)
+
+	// Tracing related (see ./ots_trace.go)
+	GetInternalOperations(ctx context.Context, hash common.Hash) ([]*InternalOperation, error)
+	GetTransactionError(ctx context.Context, hash common.Hash) (hexutil.Bytes, error)
+}
+
+// OtterscanImpl is implementation of the OtterscanAPI interface
+type OtterscanImpl struct {
+	*BaseAPI
+	db ethdb.Database
+}
+
+// NewOtterscanAPI returns OtterscanImpl instance
+func NewOtterscanAPI(db ethdb.Database) *OtterscanImpl {
+	return &OtterscanImpl{
+		BaseAPI: &BaseAPI{},
+		db:      db,
+	}
+}
+
+// GetApiLevel implements ots_getApiLevel. Returns the level of the ots_ API
+func (api *OtterscanImpl) GetApiLevel() uint8 {
+	return OtterscanAPILevel
+}
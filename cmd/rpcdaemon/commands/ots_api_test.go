@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOtterscanAPI(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	api := NewOtterscanAPI(db)
+	assert.Equal(t, uint8(OtterscanAPILevel), api.GetApiLevel())
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	deployer := crypto.PubkeyToAddress(key.PublicKey)
+	// The token contract deployed in the block 3, minted in the block 4 and transferred in the block 5
+	token := crypto.CreateAddress(deployer, 2)
+	blockTx := func(blockNum uint64, i int) *types.Transaction {
+		hash, err := rawdb.ReadCanonicalHash(db, blockNum)
+		require.NoError(t, err)
+		return rawdb.ReadBlock(db, hash, blockNum).Transactions()[i]
+	}
+	hashes := func(page *TransactionsWithReceipts) []common.Hash {
+		var hashes []common.Hash
+		for i, txn := range page.Txs {
+			assert.Equal(t, txn.Hash, page.Receipts[i]["transactionHash"])
+			assert.Contains(t, page.Receipts[i], "timestamp")
+			hashes = append(hashes, txn.Hash)
+		}
+		return hashes
+	}
+
+	page, err := api.SearchTransactionsBefore(ctx, token, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{blockTx(5, 0).Hash(), blockTx(4, 0).Hash()}, hashes(page))
+	assert.True(t, page.FirstPage)
+	assert.False(t, page.LastPage)
+	page, err = api.SearchTransactionsBefore(ctx, token, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{blockTx(3, 0).Hash()}, hashes(page))
+	assert.False(t, page.FirstPage)
+	assert.True(t, page.LastPage)
+
+	page, err = api.SearchTransactionsAfter(ctx, token, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{blockTx(4, 0).Hash(), blockTx(3, 0).Hash()}, hashes(page))
+	assert.False(t, page.FirstPage)
+	assert.True(t, page.LastPage)
+	page, err = api.SearchTransactionsAfter(ctx, token, 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []common.Hash{blockTx(5, 0).Hash()}, hashes(page))
+	assert.True(t, page.FirstPage)
+	_, err = api.SearchTransactionsAfter(ctx, token, 0, 0)
+	assert.Error(t, err)
+
+	creator, err := api.GetContractCreator(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, &ContractCreator{Tx: blockTx(3, 0).Hash(), Creator: deployer}, creator)
+	creator, err = api.GetContractCreator(ctx, deployer)
+	require.NoError(t, err)
+	assert.Nil(t, creator)
+
+	// The block 10 deploys a contract with CREATE2 and calls it to self-destruct
+	destruct := blockTx(10, 0)
+	poly := *destruct.To()
+	ops, err := api.GetInternalOperations(ctx, destruct.Hash())
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, OpCreate2, ops[0].Type)
+	assert.Equal(t, poly, ops[0].From)
+	assert.Equal(t, OpSelfDestruct, ops[1].Type)
+	assert.Equal(t, ops[0].To, ops[1].From)
+	ops, err = api.GetInternalOperations(ctx, blockTx(1, 0).Hash())
+	require.NoError(t, err)
+	assert.Empty(t, ops)
+
+	revert, err := api.GetTransactionError(ctx, destruct.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, hexutil.Bytes(nil), revert)
+	_, err = api.GetTransactionError(ctx, common.Hash{1})
+	assert.Error(t, err)
+}
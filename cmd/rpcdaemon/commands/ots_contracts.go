@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+// ContractCreator is the transaction which created a contract, and the address which executed the creation: the
+// sender of the transaction or the factory contract
+type ContractCreator struct {
+	Tx      common.Hash    `json:"hash"`
+	Creator common.Address `json:"creator"`
+}
+
+// GetContractCreator implements ots_getContractCreator. Returns nil if there is no contract at the address. The
+// creation block is found by the binary search over the blocks of the history index of the account, so the node has
+// to keep the history of the state, and the first creation is found if the contract was re-created at the address
+func (api *OtterscanImpl) GetContractCreator(ctx context.Context, addr common.Address) (*ContractCreator, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	acc, err := state.NewPlainStateReader(tx).ReadAccountData(addr)
+	if err != nil {
+		return nil, err
+	}
+	if acc == nil || acc.IsEmptyCodeHash() {
+		return nil, nil
+	}
+	latest, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := bitmapdb.Get64(tx, dbutils.AccountsHistoryBucket, addr[:], 0, latest)
+	if err != nil {
+		return nil, err
+	}
+	blocks := changes.ToArray()
+	var searchErr error
+	i := sort.Search(len(blocks), func(i int) bool {
+		acc, err := state.NewPlainDBState(tx, blocks[i]).ReadAccountData(addr)
+		if err != nil {
+			searchErr = err
+		}
+		return acc != nil && !acc.IsEmptyCodeHash()
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if i == len(blocks) {
+		return nil, fmt.Errorf("creation of the contract %x not found in the history of the account", addr)
+	}
+	return api.contractCreator(ctx, tx, addr, blocks[i])
+}
+
+// contractCreator re-executes the block to find the transaction creating the contract
+func (api *OtterscanImpl) contractCreator(ctx context.Context, tx ethdb.Database, addr common.Address, blockNum uint64) (*ContractCreator, error) {
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	block, err := readBlock(tx, hash, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found: %d", blockNum)
+	}
+	cc := adapter.NewChainContext(tx)
+	bc := adapter.NewBlockGetter(tx)
+	_, _, _, ibs, dbstate, err := transactions.ComputeTxEnv(ctx, bc, chainConfig, cc, tx.(ethdb.HasTx).Tx(), hash, 0)
+	if err != nil {
+		return nil, err
+	}
+	tracer := &creationTracer{address: addr}
+	header := block.Header()
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	var usedGas = new(uint64)
+	for i, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), hash, i)
+		if _, err = core.ApplyTransaction(chainConfig, cc, nil, gp, ibs, dbstate, header, txn, usedGas, vm.Config{Debug: true, Tracer: tracer}); err != nil {
+			return nil, err
+		}
+		if tracer.creator != nil {
+			return &ContractCreator{Tx: txn.Hash(), Creator: *tracer.creator}, nil
+		}
+	}
+	return nil, fmt.Errorf("creation of the contract %x not found in the block %d", addr, blockNum)
+}
+
+// creationTracer records the address which executed the creation of the contract
+type creationTracer struct {
+	address common.Address
+	creator *common.Address
+}
+
+func (t *creationTracer) CaptureStart(depth int, from common.Address, to common.Address, precompile bool, create bool, callType vm.CallType, input []byte, gas uint64, value *big.Int) error {
+	if create && to == t.address && t.creator == nil {
+		t.creator = &from
+	}
+	return nil
+}
+func (t *creationTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *creationTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *creationTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+func (t *creationTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+}
+func (t *creationTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *creationTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// TransactionsWithReceipts is a page of the transactions touching an address, from the newest to the oldest, with
+// their receipts. FirstPage is set on the page of the newest transactions, LastPage on the page of the oldest ones
+type TransactionsWithReceipts struct {
+	Txs       []*RPCTransaction        `json:"txs"`
+	Receipts  []map[string]interface{} `json:"receipts"`
+	FirstPage bool                     `json:"firstPage"`
+	LastPage  bool                     `json:"lastPage"`
+}
+
+// SearchTransactionsBefore implements ots_searchTransactionsBefore. Returns the page of the transactions touching the
+// address in the blocks before the block, 0 is the latest block. The page has at least pageSize transactions, unless
+// it is the last one, and always complete blocks
+func (api *OtterscanImpl) SearchTransactionsBefore(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	if pageSize == 0 {
+		return nil, fmt.Errorf("invalid page size: 0")
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latest, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	page := &TransactionsWithReceipts{Txs: []*RPCTransaction{}, Receipts: []map[string]interface{}{}, FirstPage: blockNum == 0}
+	to := latest
+	if blockNum != 0 {
+		if blockNum == 1 {
+			page.LastPage = true
+			return page, nil
+		}
+		if blockNum-1 < to {
+			to = blockNum - 1
+		}
+	}
+	blocks, err := addressBlocks(tx, addr, 0, to)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	it := blocks.ReverseIterator()
+	for it.HasNext() && len(page.Txs) < int(pageSize) {
+		if err = api.appendAddressTxs(ctx, tx, chainConfig, addr, it.Next(), page); err != nil {
+			return nil, err
+		}
+	}
+	page.LastPage = !it.HasNext()
+	return page, nil
+}
+
+// SearchTransactionsAfter implements ots_searchTransactionsAfter. Returns the page of the transactions touching the
+// address in the blocks after the block, 0 is before the genesis. The page has at least pageSize transactions, unless
+// it is the first one, and always complete blocks
+func (api *OtterscanImpl) SearchTransactionsAfter(ctx context.Context, addr common.Address, blockNum uint64, pageSize uint16) (*TransactionsWithReceipts, error) {
+	if pageSize == 0 {
+		return nil, fmt.Errorf("invalid page size: 0")
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	latest, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	page := &TransactionsWithReceipts{Txs: []*RPCTransaction{}, Receipts: []map[string]interface{}{}, LastPage: blockNum == 0}
+	from := uint64(0)
+	if blockNum != 0 {
+		from = blockNum + 1
+	}
+	if from > latest {
+		page.FirstPage = true
+		return page, nil
+	}
+	blocks, err := addressBlocks(tx, addr, from, latest)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	// The blocks are collected from the oldest, and appended to the page from the newest
+	var blockPages []*TransactionsWithReceipts
+	var count int
+	it := blocks.Iterator()
+	for it.HasNext() && count < int(pageSize) {
+		blockPage := &TransactionsWithReceipts{}
+		if err = api.appendAddressTxs(ctx, tx, chainConfig, addr, it.Next(), blockPage); err != nil {
+			return nil, err
+		}
+		blockPages = append(blockPages, blockPage)
+		count += len(blockPage.Txs)
+	}
+	page.FirstPage = !it.HasNext()
+	for i := len(blockPages) - 1; i >= 0; i-- {
+		page.Txs = append(page.Txs, blockPages[i].Txs...)
+		page.Receipts = append(page.Receipts, blockPages[i].Receipts...)
+	}
+	return page, nil
+}
+
+// addressBlocks returns the blocks in the range which may have transactions touching the address: the blocks in
+// which its account or its storage changed, it called or was called, or it emitted logs
+func addressBlocks(tx ethdb.Getter, addr common.Address, from, to uint64) (*roaring64.Bitmap, error) {
+	blocks, err := bitmapdb.Get64(tx, dbutils.AccountsHistoryBucket, addr[:], from, to)
+	if err != nil {
+		return nil, err
+	}
+	storageBlocks, err := storageHistory(tx, addr, from, to)
+	if err != nil {
+		return nil, err
+	}
+	blocks.Or(storageBlocks)
+	for _, bucket := range []string{dbutils.CallFromIndex, dbutils.CallToIndex, dbutils.LogAddressIndex} {
+		m, err := bitmapdb.Get(tx, bucket, addr[:], uint32(from), uint32(to))
+		if err != nil {
+			return nil, err
+		}
+		it := m.Iterator()
+		for it.HasNext() {
+			blocks.Add(uint64(it.Next()))
+		}
+	}
+	blocks.RemoveRange(0, from)
+	blocks.RemoveRange(to+1, ^uint64(0))
+	return blocks, nil
+}
+
+// appendAddressTxs appends the transactions of the block touching the address to the page, from the last one
+func (api *BaseAPI) appendAddressTxs(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, addr common.Address, blockNum uint64, page *TransactionsWithReceipts) error {
+	block, indices, err := addressTxIndices(ctx, tx, chainConfig, addr, blockNum)
+	if err != nil {
+		return err
+	}
+	receipts, err := api.getReceipts(ctx, tx, chainConfig, blockNum, block.Hash())
+	if err != nil {
+		return fmt.Errorf("getReceipts error: %v", err)
+	}
+	// The transactions emitting the logs of the address, e.g. through the internal calls missing from the call-trace
+	// index, touched it too
+	touched := make(map[int]struct{}, len(indices))
+	for _, i := range indices {
+		touched[i] = struct{}{}
+	}
+	for i, receipt := range receipts {
+		for _, l := range receipt.Logs {
+			if l.Address == addr {
+				touched[i] = struct{}{}
+				break
+			}
+		}
+	}
+	indices = indices[:0]
+	for i := range touched {
+		indices = append(indices, i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(indices)))
+
+	txs := block.Transactions()
+	for _, i := range indices {
+		if i >= len(receipts) {
+			return fmt.Errorf("block has less receipts than expected: %d <= %d, block: %d", len(receipts), i, blockNum)
+		}
+		receipt := marshalReceipt(receipts[i], txs[i], block.Hash(), blockNum, uint64(i))
+		receipt["timestamp"] = block.Time()
+		page.Txs = append(page.Txs, newRPCTransaction(txs[i], block.Hash(), blockNum, uint64(i), block.BaseFee()))
+		page.Receipts = append(page.Receipts, receipt)
+	}
+	return nil
+}
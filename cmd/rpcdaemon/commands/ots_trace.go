@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+// OperationType is the type of an internal operation of a transaction
+type OperationType int
+
+const (
+	OpTransfer     OperationType = 0
+	OpSelfDestruct OperationType = 1
+	OpCreate       OperationType = 2
+	OpCreate2      OperationType = 3
+)
+
+// InternalOperation is a transfer of ethers, a self-destruct or a contract creation done by a transaction at the depth
+// greater than 0, so it doesn't show in the transaction itself. The operations of the reverted calls are included
+type InternalOperation struct {
+	Type  OperationType  `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+// GetInternalOperations implements ots_getInternalOperations. Returns the internal operations of the transaction in
+// the order of their execution
+func (api *OtterscanImpl) GetInternalOperations(ctx context.Context, hash common.Hash) ([]*InternalOperation, error) {
+	tracer := &operationsTracer{ops: []*InternalOperation{}}
+	if _, err := api.executeTransaction(ctx, hash, tracer); err != nil {
+		return nil, err
+	}
+	return tracer.ops, nil
+}
+
+// GetTransactionError implements ots_getTransactionError. Returns the revert data of the failed transaction, which
+// is empty for the successful transactions and for the failures without the data, e.g. out of gas
+func (api *OtterscanImpl) GetTransactionError(ctx context.Context, hash common.Hash) (hexutil.Bytes, error) {
+	result, err := api.executeTransaction(ctx, hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Revert(), nil
+}
+
+// executeTransaction re-executes the transaction on top of the state of its block before it
+func (api *OtterscanImpl) executeTransaction(ctx context.Context, hash common.Hash, tracer vm.Tracer) (*core.ExecutionResult, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	txn, blockHash, _, txIndex := rawdb.ReadTransaction(tx, hash)
+	if txn == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	getter := adapter.NewBlockGetter(tx)
+	chainContext := adapter.NewChainContext(tx)
+	msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, getter, chainConfig, chainContext, tx.(ethdb.HasTx).Tx(), blockHash, txIndex)
+	if err != nil {
+		return nil, err
+	}
+	vmConfig := vm.Config{}
+	if tracer != nil {
+		vmConfig = vm.Config{Debug: true, Tracer: tracer}
+	}
+	evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vmConfig)
+	return core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */)
+}
+
+// operationsTracer records the internal operations of a transaction
+type operationsTracer struct {
+	ops []*InternalOperation
+}
+
+func (t *operationsTracer) CaptureStart(depth int, from common.Address, to common.Address, precompile bool, create bool, callType vm.CallType, input []byte, gas uint64, value *big.Int) error {
+	if depth == 0 {
+		return nil
+	}
+	switch {
+	case callType == vm.CREATET:
+		t.ops = append(t.ops, &InternalOperation{Type: OpCreate, From: from, To: to, Value: (*hexutil.Big)(value)})
+	case callType == vm.CREATE2T:
+		t.ops = append(t.ops, &InternalOperation{Type: OpCreate2, From: from, To: to, Value: (*hexutil.Big)(value)})
+	case callType == vm.CALLT && value.Sign() > 0:
+		t.ops = append(t.ops, &InternalOperation{Type: OpTransfer, From: from, To: to, Value: (*hexutil.Big)(value)})
+	}
+	return nil
+}
+func (t *operationsTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *operationsTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *operationsTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+func (t *operationsTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+	t.ops = append(t.ops, &InternalOperation{Type: OpSelfDestruct, From: from, To: to, Value: (*hexutil.Big)(value)})
+}
+func (t *operationsTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *operationsTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// paranoidReads makes the bodies and the receipts read by the RPC methods validated against the roots stored in
+// their headers before they are returned, so that the data corrupted on the disk is not served silently.
+// It is set once by APIList from the --rpc.paranoid flag
+var paranoidReads bool
+
+var paranoidFailures = metrics.NewRegisteredCounter("rpc/paranoid/failures", nil)
+
+// readBlockByNumber reads the canonical block, validating its body in the paranoid mode
+func readBlockByNumber(db ethdb.Database, number uint64) (*types.Block, error) {
+	block, err := rawdb.ReadBlockByNumber(db, number)
+	if err != nil || block == nil {
+		return block, err
+	}
+	if err = validateBody(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// readBlockByHash reads the block, validating its body in the paranoid mode
+func readBlockByHash(db ethdb.Database, hash common.Hash) (*types.Block, error) {
+	block, err := rawdb.ReadBlockByHash(db, hash)
+	if err != nil || block == nil {
+		return block, err
+	}
+	if err = validateBody(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// readBlock reads the block, validating its body in the paranoid mode
+func readBlock(db ethdb.Getter, hash common.Hash, number uint64) (*types.Block, error) {
+	block := rawdb.ReadBlock(db, hash, number)
+	if block == nil {
+		return nil, nil
+	}
+	if err := validateBody(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// validateBody checks that the transactions and the uncles of the block match the roots of its header
+func validateBody(block *types.Block) error {
+	if !paranoidReads {
+		return nil
+	}
+	if hash := types.DeriveSha(block.Transactions()); hash != block.TxHash() {
+		return paranoidFailure("transactions root", block.NumberU64(), block.Hash(), hash, block.TxHash())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return paranoidFailure("uncles hash", block.NumberU64(), block.Hash(), hash, block.UncleHash())
+	}
+	return nil
+}
+
+// validateReceipts checks that the receipts of the block match the receipts root of its header
+func validateReceipts(db ethdb.Getter, receipts types.Receipts, hash common.Hash, number uint64) error {
+	if !paranoidReads {
+		return nil
+	}
+	header := rawdb.ReadHeader(db, hash, number)
+	if header == nil {
+		return fmt.Errorf("header not found: %d %x", number, hash)
+	}
+	if root := types.DeriveSha(receipts); root != header.ReceiptHash {
+		return paranoidFailure("receipts root", number, hash, root, header.ReceiptHash)
+	}
+	return nil
+}
+
+func paranoidFailure(what string, number uint64, hash, have, want common.Hash) error {
+	paranoidFailures.Inc(1)
+	log.Error("Data read from the database does not match the header", "what", what, "number", number, "hash", hash, "have", have, "want", want)
+	return fmt.Errorf("%s of block %d %x is %x instead of %x, the database may be corrupted", what, number, hash, have, want)
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+)
+
+func TestParanoidReads(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	paranoidReads = true
+	defer func() { paranoidReads = false }()
+
+	for n := uint64(0); n <= 10; n++ {
+		if _, err = readBlockByNumber(db, n); err != nil {
+			t.Fatalf("block %d: %v", n, err)
+		}
+	}
+	block, err := readBlockByNumber(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions()) == 0 {
+		t.Fatalf("expected transactions in block 1")
+	}
+
+	// The first transaction of the block is replaced with the one of another block
+	other, err := readBlockByNumber(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Transactions()) == 0 {
+		t.Fatalf("expected transactions in block 2")
+	}
+	_, baseTxId, _ := rawdb.ReadBodyWithoutTransactions(db, block.Hash(), 1)
+	_, otherBaseTxId, _ := rawdb.ReadBodyWithoutTransactions(db, other.Hash(), 2)
+	enc, err := db.Get(dbutils.EthTx, dbutils.EncodeBlockNumber(otherBaseTxId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(dbutils.EthTx, dbutils.EncodeBlockNumber(baseTxId), common.CopyBytes(enc)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readBlockByHash(db, block.Hash()); err == nil || !strings.Contains(err.Error(), "transactions root") {
+		t.Errorf("expected the transactions root mismatch, got %v", err)
+	}
+
+	paranoidReads = false
+	if _, err = readBlockByHash(db, block.Hash()); err != nil {
+		t.Errorf("unexpected error without the paranoid mode: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/rpc"
@@ -33,3 +34,20 @@ func getLatestBlockNumber(dbReader ethdb.Getter) (uint64, error) {
 
 	return blockNum, nil
 }
+
+// getTxCount returns the number of the transactions of the canonical block, from the index of the counts unless the
+// bodies are validated in the paranoid mode, false if the block is not found
+func getTxCount(db ethdb.Database, blockNum uint64) (uint32, bool, error) {
+	if !paranoidReads {
+		count, ok, err := rawdb.ReadTxCount(db, blockNum)
+		if err != nil || ok {
+			return count, ok, err
+		}
+	}
+	// Not indexed yet, e.g. the block is downloaded before the index existed and frozen already
+	block, err := readBlockByNumber(db, blockNum)
+	if err != nil || block == nil {
+		return 0, false, err
+	}
+	return uint32(len(block.Transactions())), true, nil
+}
@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/eth/stateanalysis"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/rpchelper"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+)
+
+// MaxAccountsAt is the maximum number of the addresses tg_getAccountsAt accepts in one call
+const MaxAccountsAt = 10000
+
+// AccountAt is the account as of a block, the accounts which do not exist are all zeroes with the empty code hash
+type AccountAt struct {
+	Address     common.Address `json:"address"`
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Balance     *hexutil.Big   `json:"balance"`
+	CodeHash    common.Hash    `json:"codeHash"`
+	Incarnation hexutil.Uint64 `json:"incarnation"`
+}
+
+// GetAccountsAt implements tg_getAccountsAt. Returns the accounts of the addresses as of the block, in the order of
+// the addresses. All of them are read in one transaction, so that the snapshots of many addresses (e.g. for the
+// airdrops) are consistent and do not need an archive call per address
+func (api *TgImpl) GetAccountsAt(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, addresses []common.Address) ([]*AccountAt, error) {
+	if len(addresses) > MaxAccountsAt {
+		return nil, fmt.Errorf("too many addresses: %d, at most %d are allowed", len(addresses), MaxAccountsAt)
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	blockNumber, _, err := rpchelper.GetBlockNumber(blockNrOrHash, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := adapter.NewStateReader(tx.(ethdb.HasTx).Tx(), blockNumber)
+	results := make([]*AccountAt, 0, len(addresses))
+	for _, address := range addresses {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		acc, err := reader.ReadAccountData(address)
+		if err != nil {
+			return nil, fmt.Errorf("reading account %x at block %d: %w", address, blockNumber, err)
+		}
+		if acc == nil {
+			empty := accounts.NewAccount()
+			acc = &empty
+		}
+		results = append(results, &AccountAt{
+			Address:     address,
+			Nonce:       hexutil.Uint64(acc.Nonce),
+			Balance:     (*hexutil.Big)(acc.Balance.ToBig()),
+			CodeHash:    acc.CodeHash,
+			Incarnation: hexutil.Uint64(acc.Incarnation),
+		})
+	}
+	return results, nil
+}
+
+// AccountInfo is the account as of a block with the metadata of its code and storage. The storage root is only
+// available for the accounts without storage, and at the block the intermediate hashes are at, as the storage roots
+// are not kept in the history
+type AccountInfo struct {
+	AccountAt
+	Exists      bool           `json:"exists"`
+	CodeSize    hexutil.Uint64 `json:"codeSize"`
+	StorageRoot *common.Hash   `json:"storageRoot"` // nil when not available at the block
+}
+
+// GetAccount implements tg_getAccount. Returns the balance, nonce, code hash, code size and incarnation of the account
+// as of the block, resolved by the changesets for the past blocks, and its storage root when it is available
+func (api *TgImpl) GetAccount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*AccountInfo, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	blockNumber, hash, err := rpchelper.GetBlockNumber(blockNrOrHash, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := adapter.NewStateReader(tx.(ethdb.HasTx).Tx(), blockNumber)
+	acc, err := reader.ReadAccountData(address)
+	if err != nil {
+		return nil, fmt.Errorf("reading account %x at block %d: %w", address, blockNumber, err)
+	}
+	info := &AccountInfo{Exists: acc != nil}
+	if acc == nil {
+		empty := accounts.NewAccount()
+		acc = &empty
+	}
+	info.AccountAt = AccountAt{
+		Address:     address,
+		Nonce:       hexutil.Uint64(acc.Nonce),
+		Balance:     (*hexutil.Big)(acc.Balance.ToBig()),
+		CodeHash:    acc.CodeHash,
+		Incarnation: hexutil.Uint64(acc.Incarnation),
+	}
+	if !acc.IsEmptyCodeHash() {
+		codeSize, err := reader.ReadAccountCodeSize(address, acc.Incarnation, acc.CodeHash)
+		if err != nil {
+			return nil, fmt.Errorf("reading code of account %x: %w", address, err)
+		}
+		info.CodeSize = hexutil.Uint64(codeSize)
+	}
+	if info.StorageRoot, err = api.storageRoot(tx, address, acc, blockNumber, hash); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// storageRoot is the storage root of the account as of the block, nil if it isn't available
+func (api *TgImpl) storageRoot(tx ethdb.Database, address common.Address, acc *accounts.Account, blockNumber uint64, hash common.Hash) (*common.Hash, error) {
+	// Only the contracts have storage
+	if acc.Incarnation == 0 {
+		root := trie.EmptyRoot
+		return &root, nil
+	}
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	// The storage roots of the other state commitments are not those of the hexary trie
+	if chainConfig.StateCommitment != "" {
+		return nil, nil
+	}
+	ihProgress, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if ihProgress != blockNumber {
+		return nil, nil
+	}
+	header := rawdb.ReadHeader(tx, hash, blockNumber)
+	if header == nil {
+		return nil, fmt.Errorf("header %d %x not found", blockNumber, hash)
+	}
+	addrHash := crypto.Keccak256Hash(address[:])
+	mp, err := trie.GenerateMultiproof(tx.(ethdb.HasTx).Tx(), header.Root, []common.Hash{addrHash}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("storage root of account %x: %w", address, err)
+	}
+	proven, err := mp.Account(addrHash)
+	if err != nil || proven == nil {
+		return nil, err
+	}
+	return &proven.Root, nil
+}
+
+// ContractStats is the storage and the code metrics of a contract in the latest state
+type ContractStats struct {
+	Address      common.Address `json:"address"`
+	Incarnation  hexutil.Uint64 `json:"incarnation"`
+	Slots        hexutil.Uint64 `json:"slots"`
+	StorageBytes hexutil.Uint64 `json:"storageBytes"`
+	CodeSize     hexutil.Uint64 `json:"codeSize"`
+	LastModified hexutil.Uint64 `json:"lastModified"` // 0 if the account isn't in the history index
+	Block        hexutil.Uint64 `json:"block"`        // latest executed block
+}
+
+// ContractStats implements tg_contractStats. Returns the number of the storage slots, the size of the storage values
+// and of the code, and the last block modifying the contract in the latest state, nil if the address isn't a contract
+func (api *TgImpl) ContractStats(ctx context.Context, address common.Address) (*ContractStats, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := stateanalysis.GetContractStats(tx.(ethdb.HasTx).Tx(), address)
+	if err != nil || stats == nil {
+		return nil, err
+	}
+	return &ContractStats{
+		Address:      stats.Address,
+		Incarnation:  hexutil.Uint64(stats.Incarnation),
+		Slots:        hexutil.Uint64(stats.Slots),
+		StorageBytes: hexutil.Uint64(stats.StorageBytes),
+		CodeSize:     hexutil.Uint64(stats.CodeSize),
+		LastModified: hexutil.Uint64(stats.LastModified),
+		Block:        hexutil.Uint64(executed),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+)
+
+func TestGetAccountsAt(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	ethApi := NewEthAPI(db, nil, 5000000, nil)
+	api := NewTgAPI(db, nil, 5000000, nil)
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	addresses := []common.Address{crypto.PubkeyToAddress(key.PublicKey), {1}, {0xff}}
+	for _, number := range []rpc.BlockNumber{0, 1, 2, 6, rpc.LatestBlockNumber} {
+		block := rpc.BlockNumberOrHashWithNumber(number)
+		results, err := api.GetAccountsAt(ctx, block, addresses)
+		if err != nil {
+			t.Fatalf("block %d: %v", number, err)
+		}
+		if len(results) != len(addresses) {
+			t.Fatalf("block %d: %d results for %d addresses", number, len(results), len(addresses))
+		}
+		for i, address := range addresses {
+			balance, err := ethApi.GetBalance(ctx, address, block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonce, err := ethApi.GetTransactionCount(ctx, address, block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := results[i]; r.Address != address || r.Balance.ToInt().Cmp(balance.ToInt()) != 0 || r.Nonce != *nonce {
+				t.Errorf("block %d, %x: balance %s, nonce %d instead of %s, %d", number, address, r.Balance, r.Nonce, balance, *nonce)
+			}
+		}
+		if results[2].CodeHash != crypto.Keccak256Hash(nil) {
+			t.Errorf("block %d: non-existent account has code hash %x", number, results[2].CodeHash)
+		}
+	}
+
+	if _, err = api.GetAccountsAt(ctx, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), make([]common.Address, MaxAccountsAt+1)); err == nil {
+		t.Errorf("expected the error for too many addresses")
+	}
+}
+
+func TestGetAccount(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	api := NewTgAPI(db, nil, 5000000, nil)
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	// The token deployed in the block 3
+	token := crypto.CreateAddress(address, 2)
+
+	info, err := api.GetAccount(ctx, token, rpc.BlockNumberOrHashWithNumber(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Exists || info.CodeSize != 0 || info.StorageRoot == nil || *info.StorageRoot != trie.EmptyRoot {
+		t.Errorf("block 2: token before its deployment: %+v", info)
+	}
+
+	info, err = api.GetAccount(ctx, token, rpc.BlockNumberOrHashWithNumber(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Exists || info.CodeSize == 0 || info.Incarnation != 1 {
+		t.Errorf("block 5: token: %+v", info)
+	}
+	// The storage roots are only available at the head
+	if info.StorageRoot != nil {
+		t.Errorf("block 5: storage root %x of the token in the history", *info.StorageRoot)
+	}
+
+	info, err = api.GetAccount(ctx, token, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.StorageRoot == nil || *info.StorageRoot == trie.EmptyRoot {
+		t.Errorf("latest: token has no storage root: %+v", info)
+	}
+
+	info, err = api.GetAccount(ctx, address, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Exists || info.CodeSize != 0 || info.CodeHash != crypto.Keccak256Hash(nil) || info.StorageRoot == nil || *info.StorageRoot != trie.EmptyRoot {
+		t.Errorf("latest: %x: %+v", address, info)
+	}
+}
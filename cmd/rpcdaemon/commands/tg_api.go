@@ -4,8 +4,13 @@ import (
 	"context"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/eth/reorgs"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/rpc"
 )
 
@@ -17,27 +22,62 @@ type TgAPI interface {
 	// Blocks related (see ./tg_blocks.go)
 	GetHeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	GetHeaderByHash(_ context.Context, hash common.Hash) (*types.Header, error)
+	GetBlockTransactionCounts(ctx context.Context, fromBlock rpc.BlockNumber, toBlock rpc.BlockNumber) ([]hexutil.Uint, error)
+	GetBlockWitness(ctx context.Context, number rpc.BlockNumber) (hexutil.Bytes, error)
+
+	// Accounts related (see ./tg_accounts.go)
+	GetAccountsAt(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, addresses []common.Address) ([]*AccountAt, error)
+	GetAccount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*AccountInfo, error)
+	ContractStats(ctx context.Context, address common.Address) (*ContractStats, error)
+
+	// Rankings related (see ./tg_ranks.go)
+	AccountsByBalance(ctx context.Context, offset, count hexutil.Uint64) (*RankedAccounts, error)
+	AccountsByCodeSize(ctx context.Context, offset, count hexutil.Uint64) (*RankedAccounts, error)
+
+	// History related (see ./tg_history.go)
+	GetAddressHistory(ctx context.Context, address common.Address, req AddressHistoryRequest) (*AddressHistory, error)
+
+	// Token transfers related (see ./tg_tokens.go)
+	GetTokenTransfers(ctx context.Context, address common.Address, req TokenTransfersRequest) (*TokenTransfers, error)
 
 	// Receipt related (see ./tg_receipts.go)
 	GetLogsByHash(ctx context.Context, hash common.Hash) ([][]*types.Log, error)
+	GetLogs(ctx context.Context, crit filters.FilterCriteria, continuation *hexutil.Bytes, stream *rpc.Stream) error
 	//GetLogsByNumber(ctx context.Context, number rpc.BlockNumber) ([][]*types.Log, error)
 
 	// Issuance / reward related (see ./tg_issuance.go)
 	// BlockReward(ctx context.Context, blockNr rpc.BlockNumber) (Issuance, error)
 	// UncleReward(ctx context.Context, blockNr rpc.BlockNumber) (Issuance, error)
 	Issuance(ctx context.Context, blockNr rpc.BlockNumber) (Issuance, error)
+
+	// Reorgs related (see ./tg_reorgs.go)
+	ReorgStats(ctx context.Context) (*ReorgStats, error)
+	BlockReorgs(ctx context.Context, number rpc.BlockNumber) ([]*BlockReorgs, error)
+
+	// Mining related (see ./tg_mining.go)
+	BuildBlock(ctx context.Context, parentHash common.Hash, txHashes *[]common.Hash) (*BuiltBlock, error)
+
+	// Gas estimation related (see ./tg_estimate.go)
+	EstimateGasBatch(ctx context.Context, args []ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, chain *bool) ([]*GasEstimate, error)
 }
 
 // TgImpl is implementation of the TgAPI interface
 type TgImpl struct {
 	*BaseAPI
-	db ethdb.Database
+	db         ethdb.Database
+	ethBackend core.ApiBackend
+	reorgs     *reorgs.Tracker // nil without the connection to turbo-geth
+	gasCap     uint64
+	logsLimit  int // Maximum number of the logs returned by tg_getLogs, 0 is no limit
 }
 
 // NewTgAPI returns TgImpl instance
-func NewTgAPI(db ethdb.Database) *TgImpl {
+func NewTgAPI(db ethdb.Database, eth core.ApiBackend, gascap uint64, tracker *reorgs.Tracker) *TgImpl {
 	return &TgImpl{
-		BaseAPI: &BaseAPI{},
-		db:      db,
+		BaseAPI:    &BaseAPI{},
+		db:         db,
+		ethBackend: eth,
+		reorgs:     tracker,
+		gasCap:     gascap,
 	}
 }
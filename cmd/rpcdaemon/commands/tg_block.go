@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -45,3 +46,86 @@ func (api *TgImpl) GetHeaderByHash(ctx context.Context, hash common.Hash) (*type
 
 	return header, nil
 }
+
+// MaxBlockTransactionCounts is the maximum number of the blocks tg_getBlockTransactionCounts counts in one call
+const MaxBlockTransactionCounts = 10000
+
+// GetBlockTransactionCounts implements tg_getBlockTransactionCounts. Returns the numbers of the transactions of the
+// canonical blocks fromBlock..toBlock without reading their bodies, e.g. for the explorers rendering the lists of
+// the blocks. The range is cut at the latest block.
+func (api *TgImpl) GetBlockTransactionCounts(ctx context.Context, fromBlock rpc.BlockNumber, toBlock rpc.BlockNumber) ([]hexutil.Uint, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	from, err := getBlockNumber(fromBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getBlockNumber(toBlock, tx)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	if to > latest {
+		to = latest
+	}
+	if from > to {
+		return []hexutil.Uint{}, nil
+	}
+	if to-from >= MaxBlockTransactionCounts {
+		return nil, fmt.Errorf("too many blocks: %d, the maximum is %d", to-from+1, MaxBlockTransactionCounts)
+	}
+
+	var indexed []uint32
+	if !paranoidReads {
+		if indexed, err = rawdb.ReadTxCounts(tx, from, to); err != nil {
+			return nil, err
+		}
+	}
+	counts := make([]hexutil.Uint, 0, to-from+1)
+	for _, count := range indexed {
+		counts = append(counts, hexutil.Uint(count))
+	}
+	// The blocks from the first one which is not indexed on are counted one by one
+	for blockNum := from + uint64(len(counts)); blockNum <= to; blockNum++ {
+		count, ok, err := getTxCount(tx, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("block not found: %d", blockNum)
+		}
+		counts = append(counts, hexutil.Uint(count))
+	}
+	return counts, nil
+}
+
+// GetBlockWitness implements tg_getBlockWitness. Returns the serialized stateless witness of the canonical block: the
+// trie nodes and the codes of the state before the block, which are read or changed by its execution. The witnesses
+// are stored by turbo-geth with `w` in --storage-mode, for the blocks executed at the tip of the chain.
+func (api *TgImpl) GetBlockWitness(ctx context.Context, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blockNum, err := getBlockNumber(number, tx)
+	if err != nil {
+		return nil, err
+	}
+	witness, err := rawdb.ReadBlockWitness(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if witness == nil {
+		return nil, fmt.Errorf("witness of block %d not found", blockNum)
+	}
+	return witness, nil
+}
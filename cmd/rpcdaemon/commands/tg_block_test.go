@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+func TestGetBlockTransactionCounts(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	ethApi := NewEthAPI(db, nil, 5000000, nil)
+	api := NewTgAPI(db, nil, 5000000, nil)
+	if indexed, err := rawdb.ReadTxCounts(db, 0, 10); err != nil || len(indexed) != 11 {
+		t.Fatalf("expected the bodies stage to index 11 blocks, got %d: %v", len(indexed), err)
+	}
+
+	check := func() {
+		t.Helper()
+		counts, err := api.GetBlockTransactionCounts(ctx, 0, rpc.LatestBlockNumber)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 11 {
+			t.Fatalf("expected the counts of 11 blocks, got %d", len(counts))
+		}
+		for i, count := range counts {
+			block, err := rawdb.ReadBlockByNumber(db, uint64(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(count) != len(block.Transactions()) {
+				t.Errorf("block %d: count %d instead of %d", i, count, len(block.Transactions()))
+			}
+			byNumber, err := ethApi.GetBlockTransactionCountByNumber(ctx, rpc.BlockNumber(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			byHash, err := ethApi.GetBlockTransactionCountByHash(ctx, block.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *byNumber != count || *byHash != count {
+				t.Errorf("block %d: count %d by number, %d by hash instead of %d", i, *byNumber, *byHash, count)
+			}
+		}
+	}
+	check()
+
+	// The blocks which are not indexed are counted from their bodies
+	for _, blockNum := range []uint64{4, 5, 10} {
+		if err = db.Delete(dbutils.BlockTxCount, dbutils.EncodeBlockNumber(blockNum), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+
+	counts, err := api.GetBlockTransactionCounts(ctx, 8, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 3 {
+		t.Errorf("expected the range to be cut at the latest block, got %d counts", len(counts))
+	}
+	if _, err = api.GetBlockTransactionCounts(ctx, 0, MaxBlockTransactionCounts); err != nil {
+		t.Errorf("expected the range to be cut before the limit: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/turbo/rpchelper"
+	"github.com/ledgerwatch/turbo-geth/turbo/shards"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+// MaxEstimateGasBatch is the max number of the transactions estimated by one call of tg_estimateGasBatch
+const MaxEstimateGasBatch = 100
+
+// GasEstimate is the estimation of one transaction of tg_estimateGasBatch: the gas, or the reason of the failure
+type GasEstimate struct {
+	Gas    *hexutil.Uint64 `json:"gas,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Revert hexutil.Bytes   `json:"revert,omitempty"` // data returned by the reverted execution
+}
+
+// EstimateGasBatch implements tg_estimateGasBatch. Estimates the gas of the transactions against the same state,
+// of the given block or of the latest one. If chain is true, the transactions depend on each other, like in the
+// bundle: every one is estimated on top of the effects of the previous ones, except the failed ones, which are skipped.
+// The failure of one transaction is reported in its estimation, and doesn't fail the others
+func (api *TgImpl) EstimateGasBatch(ctx context.Context, args []ethapi.CallArgs, blockNrOrHash *rpc.BlockNumberOrHash, chain *bool) ([]*GasEstimate, error) {
+	if len(args) > MaxEstimateGasBatch {
+		return nil, fmt.Errorf("too many transactions %d, the limit is %d", len(args), MaxEstimateGasBatch)
+	}
+	dbtx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	chainConfig, err := api.chainConfig(dbtx)
+	if err != nil {
+		return nil, err
+	}
+	if blockNrOrHash == nil {
+		var num = rpc.LatestBlockNumber
+		blockNrOrHash = &rpc.BlockNumberOrHash{BlockNumber: &num}
+	}
+	blockNumber, hash, err := rpchelper.GetBlockNumber(*blockNrOrHash, dbtx)
+	if err != nil {
+		return nil, err
+	}
+	var stateReader state.StateReader
+	if num, ok := blockNrOrHash.Number(); ok && num == rpc.LatestBlockNumber {
+		stateReader = state.NewPlainStateReader(dbtx)
+	} else {
+		stateReader = state.NewPlainDBState(dbtx, blockNumber)
+	}
+	header := rawdb.ReadHeader(dbtx, hash, blockNumber)
+	if header == nil {
+		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
+	}
+
+	// The effects of the chained transactions are kept in the cache on top of the pinned state
+	stateCache := shards.NewStateCache(32, 0 /* no limit */)
+	noop := state.NewNoopWriter()
+	cachedWriter := state.NewCachedWriter(noop, stateCache)
+	estimator := &gasEstimator{
+		dbtx:             dbtx,
+		header:           header,
+		requireCanonical: blockNrOrHash.RequireCanonical,
+		chainConfig:      chainConfig,
+		gasCap:           api.gasCap,
+		reader:           state.NewCachedReader(stateReader, stateCache),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	estimates := make([]*GasEstimate, len(args))
+	for i := range args {
+		estimate := &GasEstimate{}
+		estimates[i] = estimate
+		gas, result, err := estimator.estimate(ctx, args[i])
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("estimation of the transaction %d aborted: %w", i, ctxErr)
+		}
+		if err != nil {
+			estimate.Error = err.Error()
+			if result != nil && len(result.Revert()) > 0 {
+				estimate.Error = ethapi.NewRevertError(result).Error()
+				estimate.Revert = result.Revert()
+			}
+			continue
+		}
+		estimate.Gas = (*hexutil.Uint64)(&gas)
+		if chain == nil || !*chain {
+			continue
+		}
+
+		ibs, _, err := estimator.execute(args[i], gas)
+		if err != nil {
+			return nil, fmt.Errorf("applying the transaction %d: %w", i, err)
+		}
+		if err = ibs.FinalizeTx(ctx, noop); err != nil {
+			return nil, err
+		}
+		if err = ibs.CommitBlock(ctx, cachedWriter); err != nil {
+			return nil, err
+		}
+	}
+	return estimates, nil
+}
+
+// gasEstimator executes the messages on top of the state for the estimation of their gas
+type gasEstimator struct {
+	dbtx             ethdb.Database
+	header           *types.Header
+	requireCanonical bool
+	chainConfig      *params.ChainConfig
+	gasCap           uint64
+	reader           state.StateReader
+}
+
+// execute applies the message with the given gas to the fresh state, which is returned with the changes
+func (e *gasEstimator) execute(args ethapi.CallArgs, gas uint64) (*state.IntraBlockState, *core.ExecutionResult, error) {
+	args.Gas = (*hexutil.Uint64)(&gas)
+	msg := args.ToMessage(e.gasCap, e.header.BaseFee)
+	ibs := state.New(e.reader)
+	blockCtx, txCtx := transactions.GetEvmContext(msg, e.header, e.requireCanonical, e.dbtx)
+	evm := vm.NewEVM(blockCtx, txCtx, ibs, e.chainConfig, vm.Config{NoBaseFee: true})
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()), true /* refunds */, false /* gasBailout */)
+	return ibs, result, err
+}
+
+// estimate finds the lowest gas the message succeeds with by the binary search, like eth_estimateGas. Fails if the
+// message can't succeed with any gas up to the allowance, the result is returned if the execution failed
+func (e *gasEstimator) estimate(ctx context.Context, args ethapi.CallArgs) (uint64, *core.ExecutionResult, error) {
+	// Use zero address if sender unspecified.
+	if args.From == nil {
+		args.From = new(common.Address)
+	}
+	lo, hi := params.TxGas-1, e.header.GasLimit
+	if args.Gas != nil && uint64(*args.Gas) >= params.TxGas {
+		hi = uint64(*args.Gas)
+	}
+	// Recap the highest gas limit with account's available balance.
+	if args.GasPrice != nil && args.GasPrice.ToInt().Sign() != 0 {
+		available := state.New(e.reader).GetBalance(*args.From).ToBig()
+		if args.Value != nil {
+			if args.Value.ToInt().Cmp(available) >= 0 {
+				return 0, nil, core.ErrInsufficientFundsForTransfer
+			}
+			available.Sub(available, args.Value.ToInt())
+		}
+		if allowance := new(big.Int).Div(available, args.GasPrice.ToInt()); allowance.IsUint64() && hi > allowance.Uint64() {
+			hi = allowance.Uint64()
+		}
+	}
+	if e.gasCap != 0 && hi > e.gasCap {
+		hi = e.gasCap
+	}
+	cap := hi
+
+	failed := func(gas uint64) (bool, *core.ExecutionResult, error) {
+		if err := ctx.Err(); err != nil {
+			return true, nil, err
+		}
+		_, result, err := e.execute(args, gas)
+		if err != nil {
+			if errors.Is(err, core.ErrIntrinsicGas) {
+				// Special case, raise gas limit
+				return true, nil, nil
+			}
+			return true, nil, err
+		}
+		return result.Failed(), result, nil
+	}
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		midFailed, _, err := failed(mid)
+		if err != nil {
+			return 0, nil, err
+		}
+		if midFailed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	// Reject the transaction as invalid if it still fails at the highest allowance
+	if hi == cap {
+		capFailed, result, err := failed(hi)
+		if err != nil {
+			return 0, nil, err
+		}
+		if capFailed {
+			if result != nil && !errors.Is(result.Err, vm.ErrOutOfGas) {
+				return 0, result, result.Err
+			}
+			return 0, nil, fmt.Errorf("gas required exceeds allowance (%d)", cap)
+		}
+	}
+	return hi, nil, nil
+}
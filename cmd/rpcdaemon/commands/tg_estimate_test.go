@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestEstimateGasBatch(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	defer db.Close()
+	api := NewTgAPI(db, nil, 5000000, nil)
+	var (
+		from     = common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")
+		fresh    = common.Address{0xfe} // has no balance until the first transfer
+		to       = common.Address{0xff}
+		ether    = (*hexutil.Big)(big.NewInt(params.Ether))
+		reverted = hexutil.Bytes{0x60, 0x00, 0x60, 0x00, 0xfd} // PUSH1 0 PUSH1 0 REVERT
+	)
+	batch := []ethapi.CallArgs{
+		{From: &from, To: &fresh, Value: ether},
+		{From: &fresh, To: &to, Value: (*hexutil.Big)(big.NewInt(params.Ether / 2))},
+		{From: &from, Data: &reverted},
+	}
+
+	for _, chain := range []bool{false, true} {
+		chain := chain
+		estimates, err := api.EstimateGasBatch(context.Background(), batch, nil, &chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(estimates) != len(batch) {
+			t.Fatalf("expected %d estimates, got %d", len(batch), len(estimates))
+		}
+		if estimates[0].Gas == nil || uint64(*estimates[0].Gas) != params.TxGas || estimates[0].Error != "" {
+			t.Errorf("chain %t: unexpected estimate of the transfer: %+v", chain, estimates[0])
+		}
+		// The transfer from the fresh account depends on the previous one
+		if chain && (estimates[1].Gas == nil || uint64(*estimates[1].Gas) != params.TxGas) {
+			t.Errorf("expected the chained transfer to succeed: %+v", estimates[1])
+		}
+		if !chain && (estimates[1].Gas != nil || !strings.Contains(estimates[1].Error, "insufficient")) {
+			t.Errorf("expected the transfer without the funds to fail: %+v", estimates[1])
+		}
+		if estimates[2].Gas != nil || !strings.HasPrefix(estimates[2].Error, "execution reverted") {
+			t.Errorf("chain %t: expected the creation to revert: %+v", chain, estimates[2])
+		}
+	}
+
+	// Nothing is written by the chained transfers
+	chain := true
+	estimates, err := api.EstimateGasBatch(context.Background(), batch[1:2], nil, &chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimates[0].Gas != nil {
+		t.Errorf("expected the transfer without the funds to fail: %+v", estimates[0])
+	}
+
+	if _, err = api.EstimateGasBatch(context.Background(), make([]ethapi.CallArgs, MaxEstimateGasBatch+1), nil, nil); err == nil {
+		t.Error("expected the batch over the limit to fail")
+	}
+}
@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+// MaxAddressHistoryPage is the maximum number of the blocks tg_getAddressHistory returns in one page
+const MaxAddressHistoryPage = 1000
+
+// AddressHistoryRequest represents the arguments for tg_getAddressHistory
+type AddressHistoryRequest struct {
+	FromBlock *hexutil.Uint64 `json:"fromBlock"` // default = 0
+	ToBlock   *hexutil.Uint64 `json:"toBlock"`   // default = latest
+	Count     *hexutil.Uint64 `json:"count"`     // default = MaxAddressHistoryPage
+	WithTxs   bool            `json:"withTxs"`
+}
+
+// AddressHistoryBlock is a block in which the account or the storage of the address changed, with the hashes of
+// its transactions which touched the address when they are requested
+type AddressHistoryBlock struct {
+	Number  hexutil.Uint64 `json:"number"`
+	Account bool           `json:"account"`
+	Storage bool           `json:"storage"`
+	Txs     []common.Hash  `json:"txs,omitempty"`
+}
+
+// AddressHistory is a page of the blocks in which the address changed, NextBlock is the fromBlock of the next page
+// and is nil on the last page
+type AddressHistory struct {
+	Blocks    []*AddressHistoryBlock `json:"blocks"`
+	NextBlock *hexutil.Uint64        `json:"nextBlock"`
+}
+
+// GetAddressHistory implements tg_getAddressHistory. Returns the ascending page of the numbers of the blocks in which
+// the account or the storage of the address changed, read from the history indices, so the node has to keep the
+// history of the state. The transactions touching the address are those sent by it, sent to it or creating it, and
+// those calling it in the blocks the call-trace index has for it, which are found by re-executing the blocks
+func (api *TgImpl) GetAddressHistory(ctx context.Context, address common.Address, req AddressHistoryRequest) (*AddressHistory, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var from uint64
+	if req.FromBlock != nil {
+		from = uint64(*req.FromBlock)
+	}
+	to, err := getLatestBlockNumber(tx)
+	if err != nil {
+		return nil, err
+	}
+	if req.ToBlock != nil && uint64(*req.ToBlock) < to {
+		to = uint64(*req.ToBlock)
+	}
+	count := uint64(MaxAddressHistoryPage)
+	if req.Count != nil {
+		if *req.Count == 0 || *req.Count > MaxAddressHistoryPage {
+			return nil, fmt.Errorf("invalid count: %d, it has to be from 1 to %d", *req.Count, MaxAddressHistoryPage)
+		}
+		count = uint64(*req.Count)
+	}
+	history := &AddressHistory{Blocks: []*AddressHistoryBlock{}}
+	if from > to {
+		return history, nil
+	}
+
+	accountBlocks, err := bitmapdb.Get64(tx, dbutils.AccountsHistoryBucket, address[:], from, to)
+	if err != nil {
+		return nil, err
+	}
+	storageBlocks, err := storageHistory(tx, address, from, to)
+	if err != nil {
+		return nil, err
+	}
+	blocks := roaring64.Or(accountBlocks, storageBlocks)
+	blocks.RemoveRange(0, from)
+	blocks.RemoveRange(to+1, ^uint64(0))
+
+	var chainConfig *params.ChainConfig
+	if req.WithTxs {
+		if chainConfig, err = api.chainConfig(tx); err != nil {
+			return nil, err
+		}
+	}
+	it := blocks.Iterator()
+	for it.HasNext() {
+		blockNum := it.Next()
+		if uint64(len(history.Blocks)) == count {
+			next := hexutil.Uint64(blockNum)
+			history.NextBlock = &next
+			break
+		}
+		block := &AddressHistoryBlock{
+			Number:  hexutil.Uint64(blockNum),
+			Account: accountBlocks.Contains(blockNum),
+			Storage: storageBlocks.Contains(blockNum),
+		}
+		if req.WithTxs {
+			if block.Txs, err = addressTxs(ctx, tx, chainConfig, address, blockNum); err != nil {
+				return nil, err
+			}
+		}
+		history.Blocks = append(history.Blocks, block)
+	}
+	return history, nil
+}
+
+// storageHistory is the union of the history bitmaps of all the storage slots of the address in the range of blocks
+func storageHistory(tx ethdb.Getter, address common.Address, from, to uint64) (*roaring64.Bitmap, error) {
+	var chunks []*roaring64.Bitmap
+	var lastSlot []byte
+	var slotDone bool
+	if err := tx.Walk(dbutils.StorageHistoryBucket, address[:], 8*common.AddressLength, func(k, v []byte) (bool, error) {
+		// The key is the address, the slot and the last block of the chunk
+		slot := k[common.AddressLength : len(k)-8]
+		if !bytes.Equal(slot, lastSlot) {
+			lastSlot = append(lastSlot[:0], slot...)
+			slotDone = false
+		}
+		chunkEnd := binary.BigEndian.Uint64(k[len(k)-8:])
+		if slotDone || chunkEnd < from {
+			return true, nil
+		}
+		bm := roaring64.New()
+		if _, err := bm.ReadFrom(bytes.NewReader(v)); err != nil {
+			return false, err
+		}
+		chunks = append(chunks, bm)
+		slotDone = chunkEnd >= to
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return roaring64.New(), nil
+	}
+	return roaring64.FastOr(chunks...), nil
+}
+
+// addressTxs returns the hashes of the transactions of the block which touched the address
+func addressTxs(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, address common.Address, blockNum uint64) ([]common.Hash, error) {
+	block, indices, err := addressTxIndices(ctx, tx, chainConfig, address, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []common.Hash
+	for _, i := range indices {
+		hashes = append(hashes, block.Transactions()[i].Hash())
+	}
+	return hashes, nil
+}
+
+// addressTxIndices returns the canonical block and the ascending indices of its transactions which touched the address
+func addressTxIndices(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, address common.Address, blockNum uint64) (*types.Block, []int, error) {
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := readBlock(tx, hash, blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("block not found: %d", blockNum)
+	}
+	called, err := calledInBlock(tx, address, blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	if called {
+		indices, err := tracedAddressTxs(ctx, tx, chainConfig, address, block)
+		return block, indices, err
+	}
+
+	senders, err := rawdb.ReadSenders(tx, hash, blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	var indices []int
+	for i, txn := range block.Transactions() {
+		var sender common.Address
+		if i < len(senders) {
+			sender = senders[i]
+		}
+		touched := sender == address
+		if to := txn.To(); to != nil {
+			touched = touched || *to == address
+		} else {
+			touched = touched || crypto.CreateAddress(sender, txn.Nonce()) == address
+		}
+		if touched {
+			indices = append(indices, i)
+		}
+	}
+	return block, indices, nil
+}
+
+// calledInBlock reports whether the call-trace index has the address as the caller or the callee in the block
+func calledInBlock(tx ethdb.Getter, address common.Address, blockNum uint64) (bool, error) {
+	for _, bucket := range []string{dbutils.CallFromIndex, dbutils.CallToIndex} {
+		m, err := bitmapdb.Get(tx, bucket, address[:], uint32(blockNum), uint32(blockNum))
+		if err != nil {
+			return false, err
+		}
+		if m.Contains(uint32(blockNum)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// tracedAddressTxs re-executes the block to find the indices of its transactions which called the address, or were
+// called by it, at any depth
+func tracedAddressTxs(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, address common.Address, block *types.Block) ([]int, error) {
+	cc := adapter.NewChainContext(tx)
+	bc := adapter.NewBlockGetter(tx)
+	_, _, _, ibs, dbstate, err := transactions.ComputeTxEnv(ctx, bc, chainConfig, cc, tx.(ethdb.HasTx).Tx(), block.Hash(), 0)
+	if err != nil {
+		return nil, err
+	}
+	tracer := &addressTracer{address: address}
+	header := block.Header()
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	var usedGas = new(uint64)
+	var indices []int
+	for i, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		tracer.touched = false
+		if _, err = core.ApplyTransaction(chainConfig, cc, nil, gp, ibs, dbstate, header, txn, usedGas, vm.Config{Debug: true, Tracer: tracer}); err != nil {
+			return nil, err
+		}
+		if tracer.touched {
+			indices = append(indices, i)
+		}
+	}
+	return indices, nil
+}
+
+// addressTracer records whether the address was the caller or the callee of any of the calls of the transaction
+type addressTracer struct {
+	address common.Address
+	touched bool
+}
+
+func (t *addressTracer) CaptureStart(depth int, from common.Address, to common.Address, precompile bool, create bool, callType vm.CallType, input []byte, gas uint64, value *big.Int) error {
+	if from == t.address || to == t.address {
+		t.touched = true
+	}
+	return nil
+}
+func (t *addressTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *addressTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *addressTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+func (t *addressTracer) CaptureSelfDestruct(from common.Address, to common.Address, value *big.Int) {
+	if from == t.address || to == t.address {
+		t.touched = true
+	}
+}
+func (t *addressTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+func (t *addressTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
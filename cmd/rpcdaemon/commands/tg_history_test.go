@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAddressHistory(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	api := NewTgAPI(db, nil, 5000000, nil)
+
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	// The token contract deployed in the block 3, minted in the block 4 and transferred in the block 5
+	token := crypto.CreateAddress(crypto.PubkeyToAddress(key.PublicKey), 2)
+	txHash := func(blockNum uint64, i int) common.Hash {
+		hash, err := rawdb.ReadCanonicalHash(db, blockNum)
+		require.NoError(t, err)
+		return rawdb.ReadBlock(db, hash, blockNum).Transactions()[i].Hash()
+	}
+
+	history, err := api.GetAddressHistory(ctx, token, AddressHistoryRequest{WithTxs: true})
+	require.NoError(t, err)
+	assert.Nil(t, history.NextBlock)
+	assert.Equal(t, []*AddressHistoryBlock{
+		{Number: 3, Account: true, Storage: true, Txs: []common.Hash{txHash(3, 0)}},
+		{Number: 4, Account: true, Storage: true, Txs: []common.Hash{txHash(4, 0)}},
+		{Number: 5, Account: true, Storage: true, Txs: []common.Hash{txHash(5, 0)}},
+	}, history.Blocks)
+
+	// Paging
+	count, from := hexutil.Uint64(2), hexutil.Uint64(4)
+	history, err = api.GetAddressHistory(ctx, token, AddressHistoryRequest{Count: &count})
+	require.NoError(t, err)
+	require.Len(t, history.Blocks, 2)
+	assert.Equal(t, hexutil.Uint64(4), history.Blocks[1].Number)
+	assert.Nil(t, history.Blocks[1].Txs)
+	require.NotNil(t, history.NextBlock)
+	assert.Equal(t, hexutil.Uint64(5), *history.NextBlock)
+	history, err = api.GetAddressHistory(ctx, token, AddressHistoryRequest{FromBlock: &from, ToBlock: &from})
+	require.NoError(t, err)
+	require.Len(t, history.Blocks, 1)
+	assert.Equal(t, hexutil.Uint64(4), history.Blocks[0].Number)
+	count = MaxAddressHistoryPage + 1
+	_, err = api.GetAddressHistory(ctx, token, AddressHistoryRequest{Count: &count})
+	assert.Error(t, err)
+
+	// The transactions calling the address in the blocks of the call-trace index are found by the re-execution
+	theAddr := common.Address{1}
+	history, err = api.GetAddressHistory(ctx, theAddr, AddressHistoryRequest{WithTxs: true})
+	require.NoError(t, err)
+	require.Len(t, history.Blocks, 2)
+	assert.Equal(t, []common.Hash{txHash(1, 0)}, history.Blocks[0].Txs)
+	tx, err := db.Begin(ctx, ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	var buf bytes.Buffer
+	_, err = roaring.BitmapOf(1, 2).WriteTo(&buf)
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(dbutils.CallToIndex, append(common.CopyBytes(theAddr[:]), 0xff, 0xff, 0xff, 0xff), buf.Bytes()))
+	require.NoError(t, tx.Commit())
+	traced, err := api.GetAddressHistory(ctx, theAddr, AddressHistoryRequest{WithTxs: true})
+	require.NoError(t, err)
+	assert.Equal(t, history, traced)
+}
@@ -41,7 +41,7 @@ func (api *TgImpl) Issuance(ctx context.Context, blockNr rpc.BlockNumber) (Issua
 	}
 	defer tx.Rollback()
 
-	genesis, err := rawdb.ReadBlockByNumber(tx, 0)
+	genesis, err := readBlockByNumber(tx, 0)
 	if err != nil {
 		return Issuance{}, err
 	}
@@ -79,7 +79,7 @@ func (api *TgImpl) getBlockByRPCNumber(db ethdb.Database, blockNr rpc.BlockNumbe
 	if err != nil {
 		return nil, err
 	}
-	return rawdb.ReadBlockByNumber(db, blockNum)
+	return readBlockByNumber(db, blockNum)
 }
 
 // Issuance structure to return information about issuance
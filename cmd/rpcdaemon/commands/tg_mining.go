@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter/ethapi"
+)
+
+// BuiltBlock is the block assembled by tg_buildBlock, with the receipts of its transactions
+type BuiltBlock struct {
+	Block    map[string]interface{}   `json:"block"`
+	Receipts []map[string]interface{} `json:"receipts"`
+	GasUsed  hexutil.Uint64           `json:"gasUsed"`
+	GasLimit hexutil.Uint64           `json:"gasLimit"`
+}
+
+// BuildBlock implements tg_buildBlock. Runs the assembly pipeline of the miner on top of the parent, which has to be
+// the head of the executed chain: selects the pending transactions of the pool, executes them and calculates the
+// state root. The block is neither sealed nor broadcast, so the pool policies and the gas limit settings can be
+// tested safely. Only the transactions of txHashes are selected if they are given, otherwise all the pending ones
+func (api *TgImpl) BuildBlock(ctx context.Context, parentHash common.Hash, txHashes *[]common.Hash) (*BuiltBlock, error) {
+	if api.ethBackend == nil {
+		return nil, fmt.Errorf("building blocks needs the connection to turbo-geth")
+	}
+	var selection []common.Hash
+	if txHashes != nil {
+		if len(*txHashes) == 0 {
+			return nil, fmt.Errorf("empty selection of transactions")
+		}
+		selection = *txHashes
+	}
+	block, receipts, err := api.ethBackend.BuildBlock(ctx, parentHash, selection)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	chainConfig, err := api.chainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(chainConfig, block.Number())
+	senders := make([]common.Address, len(block.Transactions()))
+	for i, txn := range block.Transactions() {
+		if senders[i], err = types.Sender(signer, txn); err != nil {
+			return nil, err
+		}
+	}
+	if err = receipts.DeriveFields(block.Hash(), block.NumberU64(), block.Transactions(), senders); err != nil {
+		return nil, err
+	}
+
+	fields, err := ethapi.RPCMarshalBlock(block, true, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &BuiltBlock{
+		Block:    fields,
+		Receipts: make([]map[string]interface{}, len(receipts)),
+		GasUsed:  hexutil.Uint64(block.GasUsed()),
+		GasLimit: hexutil.Uint64(block.GasLimit()),
+	}
+	for i, receipt := range receipts {
+		result.Receipts[i] = marshalReceipt(receipt, block.Transactions()[i], block.Hash(), block.NumberU64(), uint64(i))
+	}
+	return result, nil
+}
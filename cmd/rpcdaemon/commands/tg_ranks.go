@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/eth/stateanalysis"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// MaxAccountRanksPage is the maximum number of the accounts tg_accountsByBalance and tg_accountsByCodeSize return
+// in one page
+const MaxAccountRanksPage = 1000
+
+// RankedAccount is an account of the rankings by the balance or by the code size, Balance is only set in the
+// ranking by the balance, CodeSize and CodeHash in the ranking by the code size
+type RankedAccount struct {
+	Rank     hexutil.Uint64  `json:"rank"` // 0 is the largest
+	Address  common.Address  `json:"address"`
+	Balance  *hexutil.Big    `json:"balance,omitempty"`
+	CodeSize *hexutil.Uint64 `json:"codeSize,omitempty"`
+	CodeHash *common.Hash    `json:"codeHash,omitempty"`
+}
+
+// RankedAccounts is a page of the ranking of the accounts as of the block
+type RankedAccounts struct {
+	Block    hexutil.Uint64   `json:"block"`
+	Accounts []*RankedAccount `json:"accounts"`
+}
+
+// AccountsByBalance implements tg_accountsByBalance. Returns the page of the accounts of the latest state with the
+// largest balances, count of them after the offset largest ones. Needs `k` in --storage-mode
+func (api *TgImpl) AccountsByBalance(ctx context.Context, offset, count hexutil.Uint64) (*RankedAccounts, error) {
+	if count == 0 || count > MaxAccountRanksPage {
+		return nil, fmt.Errorf("invalid count: %d, it has to be from 1 to %d", count, MaxAccountRanksPage)
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	block, err := accountRanksProgress(tx)
+	if err != nil {
+		return nil, err
+	}
+	page, err := stateanalysis.TopBalances(tx.(ethdb.HasTx).Tx(), uint64(offset), uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	result := &RankedAccounts{Block: hexutil.Uint64(block), Accounts: make([]*RankedAccount, len(page))}
+	for i, r := range page {
+		result.Accounts[i] = &RankedAccount{
+			Rank:    offset + hexutil.Uint64(i),
+			Address: r.Address,
+			Balance: (*hexutil.Big)(r.Balance.ToBig()),
+		}
+	}
+	return result, nil
+}
+
+// AccountsByCodeSize implements tg_accountsByCodeSize. Returns the page of the contracts of the latest state with the
+// largest code, count of them after the offset largest ones. Needs `k` in --storage-mode
+func (api *TgImpl) AccountsByCodeSize(ctx context.Context, offset, count hexutil.Uint64) (*RankedAccounts, error) {
+	if count == 0 || count > MaxAccountRanksPage {
+		return nil, fmt.Errorf("invalid count: %d, it has to be from 1 to %d", count, MaxAccountRanksPage)
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	block, err := accountRanksProgress(tx)
+	if err != nil {
+		return nil, err
+	}
+	page, err := stateanalysis.TopCodeSizes(tx.(ethdb.HasTx).Tx(), uint64(offset), uint64(count))
+	if err != nil {
+		return nil, err
+	}
+	result := &RankedAccounts{Block: hexutil.Uint64(block), Accounts: make([]*RankedAccount, len(page))}
+	for i, r := range page {
+		size, hash := hexutil.Uint64(r.CodeSize), r.CodeHash
+		result.Accounts[i] = &RankedAccount{
+			Rank:     offset + hexutil.Uint64(i),
+			Address:  r.Address,
+			CodeSize: &size,
+			CodeHash: &hash,
+		}
+	}
+	return result, nil
+}
+
+// accountRanksProgress is the block of the rankings, the rankings are empty until the first cycle of the stage
+func accountRanksProgress(tx ethdb.Getter) (uint64, error) {
+	block, err := stages.GetStageProgress(tx, stages.AccountRanks)
+	if err != nil {
+		return 0, err
+	}
+	if block == 0 {
+		return 0, errors.New("the accounts are not ranked, the node needs `k` in --storage-mode")
+	}
+	return block, nil
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rpc"
 )
 
 // GetLogsByHash implements tg_getLogsByHash. Returns an array of arrays of logs generated by the transactions in the block given by the block's hash.
@@ -28,7 +31,7 @@ func (api *TgImpl) GetLogsByHash(ctx context.Context, hash common.Hash) ([][]*ty
 		return nil, err
 	}
 
-	receipts, err := getReceipts(ctx, tx, chainConfig, *number, hash)
+	receipts, err := api.getReceipts(ctx, tx, chainConfig, *number, hash)
 	if err != nil {
 		return nil, fmt.Errorf("getReceipts error: %v", err)
 	}
@@ -40,6 +43,53 @@ func (api *TgImpl) GetLogsByHash(ctx context.Context, hash common.Hash) ([][]*ty
 	return logs, nil
 }
 
+// GetLogs implements tg_getLogs. Streams the object {"logs": [...], "continuation": ...} with the logs matching the
+// filter object like eth_getLogs, up to --rpc.logs.limit of them. The continuation is null when all the logs were
+// returned, otherwise the same filter object with the continuation returns the next page
+func (api *TgImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria, continuation *hexutil.Bytes, stream *rpc.Stream) error {
+	var from *logsContinuation
+	if continuation != nil {
+		var err error
+		if from, err = decodeLogsContinuation(*continuation); err != nil {
+			return err
+		}
+	}
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	begin, end, err := logsRange(tx, crit)
+	if err != nil {
+		return err
+	}
+	cc, err := api.chainConfig(tx)
+	if err != nil {
+		return err
+	}
+	stream.BeginObject()
+	stream.Key("logs")
+	stream.BeginArray()
+	next, err := api.streamLogs(ctx, tx, cc, crit, begin, end, from, api.logsLimit, func(log *types.Log) error {
+		return stream.Value(log)
+	})
+	if err != nil {
+		return err
+	}
+	stream.EndArray()
+	if next != nil {
+		err = stream.Field("continuation", next.Encode())
+	} else {
+		err = stream.Field("continuation", nil)
+	}
+	if err != nil {
+		return err
+	}
+	stream.EndObject()
+	return nil
+}
+
 // GetLogsByNumber implements tg_getLogsByHash. Returns all the logs that appear in a block given the block's hash.
 // func (api *TgImpl) GetLogsByNumber(ctx context.Context, number rpc.BlockNumber) ([][]*types.Log, error) {
 // 	tx, err := api.db.Begin(ctx, false)
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/filters"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/reorgs"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// ReorgStats is the summary of the reorgs seen since the daemon started
+type ReorgStats struct {
+	Since    time.Time                 `json:"since"`    // Time the tracking started at, the windows do not reach before it
+	Head     hexutil.Uint64            `json:"head"`     // Highest canonical block
+	MaxDepth map[string]hexutil.Uint64 `json:"maxDepth"` // Maximum reorg depth by the time window
+	Reorgs   []*Reorg                  `json:"reorgs"`   // Reorgs in the longest window
+}
+
+// Reorg is a reorganisation of the canonical chain, ForkBlock is the highest block the old and the new chains share
+type Reorg struct {
+	Time      time.Time      `json:"time"`
+	ForkBlock hexutil.Uint64 `json:"forkBlock"`
+	Depth     hexutil.Uint64 `json:"depth"`
+}
+
+// BlockReorgs is how many times a recent block has been reorged out of the canonical chain and back into it
+type BlockReorgs struct {
+	Hash        common.Hash `json:"hash"`
+	Canonical   bool        `json:"canonical"`
+	ReorgedOut  int         `json:"reorgedOut"`
+	ReorgedBack int         `json:"reorgedBack"`
+}
+
+// trackReorgs feeds the new headers sent by turbo-geth to the reorg tracker. The headers only come
+// with the connection to the private API, without it there is nothing to track. The blocks reorged out
+// within the window of the recent blocks are read while they are still in the database, and kept for
+// eth_getBlockByHash
+func trackReorgs(db ethdb.Database, ff *filters.Filters, staleWindow uint64) (*reorgs.Tracker, *reorgs.StaleBlocks) {
+	if ff == nil {
+		return nil, nil
+	}
+	tracker := reorgs.NewTracker(reorgs.DefaultRecentBlocks)
+	var staleBlocks *reorgs.StaleBlocks
+	if staleWindow > 0 {
+		staleBlocks = reorgs.NewStaleBlocks(staleWindow)
+	}
+	heads := make(chan *types.Header, 8)
+	ff.SubscribeNewHeads(heads)
+	go func() {
+		for h := range heads {
+			reorgedOut := tracker.OnNewHeader(h)
+			if staleBlocks == nil {
+				continue
+			}
+			for _, hash := range reorgedOut {
+				if err := keepStaleBlock(db, staleBlocks, hash); err != nil {
+					log.Warn("Could not keep the block reorged out", "hash", hash, "err", err)
+				}
+			}
+			staleBlocks.Remove(h.Hash())
+			staleBlocks.SetHead(h.Number.Uint64())
+		}
+	}()
+	return tracker, staleBlocks
+}
+
+func keepStaleBlock(db ethdb.Database, staleBlocks *reorgs.StaleBlocks, hash common.Hash) error {
+	block, err := rawdb.ReadBlockByHash(db, hash)
+	if err != nil {
+		return err
+	}
+	if block == nil {
+		return fmt.Errorf("block not found")
+	}
+	td, err := rawdb.ReadTd(db, hash, block.NumberU64())
+	if err != nil {
+		return err
+	}
+	staleBlocks.Add(block, td)
+	return nil
+}
+
+var errNoReorgTracker = fmt.Errorf("reorgs are only tracked with the connection to the private API of turbo-geth (--private.api.addr)")
+
+// ReorgStats implements tg_reorgStats. Returns the maximum depth of the reorgs over the time windows, and the reorgs
+// of the longest window, so that the number of the confirmations can be chosen from the data of the own node
+func (api *TgImpl) ReorgStats(_ context.Context) (*ReorgStats, error) {
+	if api.reorgs == nil {
+		return nil, errNoReorgTracker
+	}
+	head, since := api.reorgs.Head()
+	stats := &ReorgStats{Since: since, Head: hexutil.Uint64(head), MaxDepth: make(map[string]hexutil.Uint64), Reorgs: []*Reorg{}}
+	for _, w := range reorgs.Windows {
+		stats.MaxDepth[w.Name] = hexutil.Uint64(api.reorgs.MaxDepth(w.Duration))
+	}
+	for _, r := range api.reorgs.Reorgs(reorgs.Windows[len(reorgs.Windows)-1].Duration) {
+		stats.Reorgs = append(stats.Reorgs, &Reorg{Time: r.Time, ForkBlock: hexutil.Uint64(r.ForkBlock), Depth: hexutil.Uint64(r.Depth)})
+	}
+	return stats, nil
+}
+
+// BlockReorgs implements tg_blockReorgs. Returns the recent blocks at the height, the canonical one and the ones
+// reorged out, with how many times each of them has been reorged out and back
+func (api *TgImpl) BlockReorgs(_ context.Context, number rpc.BlockNumber) ([]*BlockReorgs, error) {
+	if api.reorgs == nil {
+		return nil, errNoReorgTracker
+	}
+	height := uint64(number)
+	if number < 0 {
+		height, _ = api.reorgs.Head()
+	}
+	results := []*BlockReorgs{}
+	for _, hash := range api.reorgs.Hashes(height) {
+		out, back, canonical := api.reorgs.BlockReorgs(hash)
+		results = append(results, &BlockReorgs{Hash: hash, Canonical: canonical, ReorgedOut: out, ReorgedBack: back})
+	}
+	return results, nil
+}
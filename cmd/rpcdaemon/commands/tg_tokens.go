@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/turbo/tokens"
+)
+
+// MaxTokenTransfersPage is the maximum number of the blocks tg_getTokenTransfers returns the transfers of in one page
+const MaxTokenTransfersPage = 1000
+
+// TokenTransfersRequest represents the arguments for tg_getTokenTransfers
+type TokenTransfersRequest struct {
+	FromBlock *hexutil.Uint64 `json:"fromBlock"` // default = 0
+	ToBlock   *hexutil.Uint64 `json:"toBlock"`   // default = latest indexed
+	Count     *hexutil.Uint64 `json:"count"`     // blocks, default = MaxTokenTransfersPage
+	Token     *common.Address `json:"token"`     // default = all the tokens
+}
+
+// TokenTransfer is an ERC-20 or an ERC-721 transfer, Value is the amount of the ERC-20 tokens and the id of the
+// ERC-721 token
+type TokenTransfer struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	TxHash      common.Hash    `json:"transactionHash"`
+	TxIndex     hexutil.Uint   `json:"transactionIndex"`
+	LogIndex    hexutil.Uint   `json:"logIndex"`
+	Token       common.Address `json:"token"`
+	Standard    string         `json:"standard"`
+	From        common.Address `json:"from"`
+	To          common.Address `json:"to"`
+	Value       *hexutil.Big   `json:"value"`
+}
+
+// TokenTransfers is a page of the token transfers of the address, NextBlock is the fromBlock of the next page and is
+// nil on the last page
+type TokenTransfers struct {
+	Transfers []*TokenTransfer `json:"transfers"`
+	NextBlock *hexutil.Uint64  `json:"nextBlock"`
+}
+
+// GetTokenTransfers implements tg_getTokenTransfers. Returns the ascending page of the ERC-20 and the ERC-721
+// transfers sent or received by the address, the blocks of the transfers are read from the token transfer index, so
+// the node has to keep it with `e` in --storage-mode
+func (api *TgImpl) GetTokenTransfers(ctx context.Context, address common.Address, req TokenTransfersRequest) (*TokenTransfers, error) {
+	tx, err := api.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	to, err := stages.GetStageProgress(tx, stages.TokenTransfers)
+	if err != nil {
+		return nil, err
+	}
+	if to == 0 {
+		return nil, errors.New("the token transfers are not indexed, the node needs `e` in --storage-mode")
+	}
+	var from uint64
+	if req.FromBlock != nil {
+		from = uint64(*req.FromBlock)
+	}
+	if req.ToBlock != nil && uint64(*req.ToBlock) < to {
+		to = uint64(*req.ToBlock)
+	}
+	count := uint64(MaxTokenTransfersPage)
+	if req.Count != nil {
+		if *req.Count == 0 || *req.Count > MaxTokenTransfersPage {
+			return nil, fmt.Errorf("invalid count: %d, it has to be from 1 to %d", *req.Count, MaxTokenTransfersPage)
+		}
+		count = uint64(*req.Count)
+	}
+	result := &TokenTransfers{Transfers: []*TokenTransfer{}}
+	if from > to {
+		return result, nil
+	}
+
+	blocks, err := bitmapdb.Get(tx, dbutils.TokenTransferIndex, address[:], uint32(from), uint32(to))
+	if err != nil {
+		return nil, err
+	}
+	blocks.RemoveRange(0, from)
+	blocks.RemoveRange(to+1, uint64(^uint32(0))+1)
+	var pageBlocks uint64
+	it := blocks.Iterator()
+	for it.HasNext() {
+		blockNum := uint64(it.Next())
+		if pageBlocks == count {
+			next := hexutil.Uint64(blockNum)
+			result.NextBlock = &next
+			break
+		}
+		transfers, err := blockTokenTransfers(tx, address, req.Token, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		result.Transfers = append(result.Transfers, transfers...)
+		pageBlocks++
+	}
+	return result, nil
+}
+
+// blockTokenTransfers returns the token transfers of the block sent or received by the address, read from its logs
+func blockTokenTransfers(tx ethdb.Database, address common.Address, token *common.Address, blockNum uint64) ([]*TokenTransfer, error) {
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	block, err := readBlock(tx, hash, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found: %d", blockNum)
+	}
+	var transfers []*TokenTransfer
+	var logIndex uint
+	if err = tx.Walk(dbutils.Log, dbutils.EncodeBlockNumber(blockNum), 8*8, func(k, v []byte) (bool, error) {
+		txIndex := binary.BigEndian.Uint32(k[8:])
+		if int(txIndex) >= len(block.Transactions()) {
+			return false, fmt.Errorf("logs of the transaction %d out of the %d transactions of the block %d", txIndex, len(block.Transactions()), blockNum)
+		}
+		var logs types.Logs
+		if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
+			return false, fmt.Errorf("receipt unmarshal failed: %w, block=%d", err, blockNum)
+		}
+		for _, l := range logs {
+			transfer := tokens.ParseTransfer(l)
+			if transfer != nil && (transfer.From == address || transfer.To == address) && (token == nil || *token == transfer.Token) {
+				transfers = append(transfers, &TokenTransfer{
+					BlockNumber: hexutil.Uint64(blockNum),
+					TxHash:      block.Transactions()[txIndex].Hash(),
+					TxIndex:     hexutil.Uint(txIndex),
+					LogIndex:    hexutil.Uint(logIndex),
+					Token:       transfer.Token,
+					Standard:    transfer.Standard,
+					From:        transfer.From,
+					To:          transfer.To,
+					Value:       (*hexutil.Big)(transfer.Value.ToBig()),
+				})
+			}
+			logIndex++
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/turbo/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTokenTransfers(t *testing.T) {
+	db, err := createTestDb()
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+	api := NewTgAPI(db, nil, 5000000, nil)
+
+	wallet, other, token := common.Address{0xaa}, common.Address{0xbb}, common.Address{0xcc}
+	_, err = api.GetTokenTransfers(ctx, wallet, TokenTransfersRequest{})
+	assert.Error(t, err, "the index isn't built")
+
+	// The test token doesn't emit the events, the logs of its mint in the block 4 and its transfer in the block 5
+	// are replaced by the transfers of the wallet
+	transfer := func(from, to common.Address, value byte) *types.Log {
+		data := make([]byte, 32)
+		data[31] = value
+		return &types.Log{Address: token, Topics: []common.Hash{tokens.TransferTopic, from.Hash(), to.Hash()}, Data: data}
+	}
+	tx, err := db.Begin(ctx, ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	for blockNum, logs := range map[uint64]types.Logs{
+		4: {transfer(common.Address{}, wallet, 10)},
+		5: {{Address: token, Topics: []common.Hash{common.HexToHash("0x01")}}, transfer(wallet, other, 3), transfer(other, other, 1)},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, cbor.Marshal(&buf, logs))
+		require.NoError(t, tx.Put(dbutils.Log, dbutils.LogKey(blockNum, 0), buf.Bytes()))
+	}
+	require.NoError(t, stagedsync.SpawnTokenTransfersStage(&stagedsync.StageState{Stage: stages.TokenTransfers}, tx, "", nil))
+	require.NoError(t, tx.Commit())
+
+	txHash := func(blockNum uint64) common.Hash {
+		hash, err := rawdb.ReadCanonicalHash(db, blockNum)
+		require.NoError(t, err)
+		return rawdb.ReadBlock(db, hash, blockNum).Transactions()[0].Hash()
+	}
+	transfers, err := api.GetTokenTransfers(ctx, wallet, TokenTransfersRequest{})
+	require.NoError(t, err)
+	assert.Nil(t, transfers.NextBlock)
+	assert.Equal(t, []*TokenTransfer{
+		{BlockNumber: 4, TxHash: txHash(4), Token: token, Standard: tokens.ERC20, To: wallet, Value: (*hexutil.Big)(big.NewInt(10))},
+		{BlockNumber: 5, TxHash: txHash(5), LogIndex: 1, Token: token, Standard: tokens.ERC20, From: wallet, To: other, Value: (*hexutil.Big)(big.NewInt(3))},
+	}, transfers.Transfers)
+
+	// Paging
+	count := hexutil.Uint64(1)
+	transfers, err = api.GetTokenTransfers(ctx, wallet, TokenTransfersRequest{Count: &count})
+	require.NoError(t, err)
+	require.Len(t, transfers.Transfers, 1)
+	require.NotNil(t, transfers.NextBlock)
+	assert.Equal(t, hexutil.Uint64(5), *transfers.NextBlock)
+	transfers, err = api.GetTokenTransfers(ctx, wallet, TokenTransfersRequest{FromBlock: transfers.NextBlock})
+	require.NoError(t, err)
+	require.Len(t, transfers.Transfers, 1)
+	assert.Equal(t, hexutil.Uint64(5), transfers.Transfers[0].BlockNumber)
+
+	// Filtered by the token
+	transfers, err = api.GetTokenTransfers(ctx, other, TokenTransfersRequest{Token: &wallet})
+	require.NoError(t, err)
+	assert.Empty(t, transfers.Transfers)
+	transfers, err = api.GetTokenTransfers(ctx, other, TokenTransfersRequest{Token: &token})
+	require.NoError(t, err)
+	assert.Len(t, transfers.Transfers, 2)
+}
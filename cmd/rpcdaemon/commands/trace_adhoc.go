@@ -20,6 +20,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rpc"
 	"github.com/ledgerwatch/turbo-geth/turbo/rpchelper"
@@ -41,20 +42,24 @@ const (
 
 // TraceCallParam (see SendTxArgs -- this allows optional prams plus don't use MixedcaseAddress
 type TraceCallParam struct {
-	From     *common.Address `json:"from"`
-	To       *common.Address `json:"to"`
-	Gas      *hexutil.Uint64 `json:"gas"`
-	GasPrice *hexutil.Big    `json:"gasPrice"`
-	Value    *hexutil.Big    `json:"value"`
-	Data     hexutil.Bytes   `json:"data"`
+	From                 *common.Address   `json:"from"`
+	To                   *common.Address   `json:"to"`
+	Gas                  *hexutil.Uint64   `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas"`
+	Value                *hexutil.Big      `json:"value"`
+	Data                 hexutil.Bytes     `json:"data"`
+	AccessList           *types.AccessList `json:"accessList"`
 }
 
 // TraceCallResult is the response to `trace_call` method
 type TraceCallResult struct {
-	Output    hexutil.Bytes                        `json:"output"`
-	StateDiff map[common.Address]*StateDiffAccount `json:"stateDiff"`
-	Trace     []*ParityTrace                       `json:"trace"`
-	VmTrace   *TraceCallVmTrace                    `json:"vmTrace"`
+	Output          hexutil.Bytes                        `json:"output"`
+	StateDiff       map[common.Address]*StateDiffAccount `json:"stateDiff"`
+	Trace           []*ParityTrace                       `json:"trace"`
+	VmTrace         *TraceCallVmTrace                    `json:"vmTrace"`
+	TransactionHash *common.Hash                         `json:"transactionHash,omitempty"` // only in trace_replayBlockTransactions
 }
 
 // StateDiffAccount is the part of `trace_call` response that is under "stateDiff" tag
@@ -89,8 +94,9 @@ type StateDiffStorage struct {
 type TraceCallVmTrace struct {
 }
 
-// ToMessage converts CallArgs to the Message type used by the core evm
-func (args *TraceCallParam) ToMessage(globalGasCap uint64) types.Message {
+// ToMessage converts CallArgs to the Message type used by the core evm.
+// baseFee is the EIP-1559 base fee of the block the call is executed on, nil before London.
+func (args *TraceCallParam) ToMessage(globalGasCap uint64, baseFee *big.Int) types.Message {
 	// Set sender address or use zero address if none specified.
 	var addr common.Address
 	if args.From != nil {
@@ -109,10 +115,7 @@ func (args *TraceCallParam) ToMessage(globalGasCap uint64) types.Message {
 		log.Warn("Caller gas above allowance, capping", "requested", gas, "cap", globalGasCap)
 		gas = globalGasCap
 	}
-	gasPrice := new(uint256.Int)
-	if args.GasPrice != nil {
-		gasPrice.SetFromBig(args.GasPrice.ToInt())
-	}
+	gasPrice, feeCap, tip := ethapi.CallFees(args.GasPrice, args.MaxFeePerGas, args.MaxPriorityFeePerGas, baseFee)
 
 	value := new(uint256.Int)
 	if args.Value != nil {
@@ -124,7 +127,11 @@ func (args *TraceCallParam) ToMessage(globalGasCap uint64) types.Message {
 		input = args.Data
 	}
 
-	msg := types.NewMessage(addr, args.To, 0 /* nonce */, value, gas, gasPrice, input, types.AccessList{}, false /* checkNonce */)
+	var accessList types.AccessList
+	if args.AccessList != nil {
+		accessList = *args.AccessList
+	}
+	msg := types.NewMessage(addr, args.To, 0 /* nonce */, value, gas, gasPrice, feeCap, tip, input, accessList, false /* checkNonce */)
 	return msg
 }
 
@@ -502,11 +509,11 @@ func (api *TraceAPIImpl) Call(ctx context.Context, args TraceCallParam, traceTyp
 	}
 
 	// Get a new instance of the EVM.
-	msg := args.ToMessage(api.gasCap)
+	msg := args.ToMessage(api.gasCap, header.BaseFee)
 
 	blockCtx, txCtx := transactions.GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, dbtx)
 
-	evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: traceTypeTrace, Tracer: &ot})
+	evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: traceTypeTrace, Tracer: &ot, NoBaseFee: true})
 
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
@@ -649,13 +656,13 @@ func (api *TraceAPIImpl) CallMany(ctx context.Context, calls json.RawMessage, bl
 		}
 
 		// Get a new instance of the EVM.
-		msg := args.ToMessage(api.gasCap)
+		msg := args.ToMessage(api.gasCap, header.BaseFee)
 
 		blockCtx, txCtx := transactions.GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, dbtx)
 		ibs := state.New(cachedReader)
 		// Create initial IntraBlockState, we will compare it with ibs (IntraBlockState after the transaction)
 
-		evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: traceTypeTrace, Tracer: &ot})
+		evm := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: traceTypeTrace, Tracer: &ot, NoBaseFee: true})
 
 		gp := new(core.GasPool).AddGas(msg.Gas())
 		var execResult *core.ExecutionResult
@@ -713,10 +720,77 @@ func (api *TraceAPIImpl) RawTransaction(ctx context.Context, txHash common.Hash,
 	return stub, fmt.Errorf(NotImplemented, "trace_rawTransaction")
 }
 
-// ReplayBlockTransactions implements trace_replayBlockTransactions.
+// ReplayBlockTransactions implements trace_replayBlockTransactions. The block is replayed once, the transactions are
+// traced in turn on the state left by the preceding ones
 func (api *TraceAPIImpl) ReplayBlockTransactions(ctx context.Context, blockNr rpc.BlockNumber, traceTypes []string) ([]interface{}, error) {
-	var stub []interface{}
-	return stub, fmt.Errorf(NotImplemented, "trace_replayBlockTransactions")
+	dbtx, err := api.dbReader.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	chainConfig, err := api.chainConfig(dbtx)
+	if err != nil {
+		return nil, err
+	}
+	blockNum, err := getBlockNumber(blockNr, dbtx)
+	if err != nil {
+		return nil, err
+	}
+	var traceTypeTrace, traceTypeStateDiff bool
+	for _, traceType := range traceTypes {
+		switch traceType {
+		case TraceTypeTrace:
+			traceTypeTrace = true
+		case TraceTypeStateDiff:
+			traceTypeStateDiff = true
+		case TraceTypeVmTrace:
+			return nil, fmt.Errorf("vmTrace not implemented yet")
+		default:
+			return nil, fmt.Errorf("unrecognized trace type: %s", traceType)
+		}
+	}
+
+	replayed, err := api.replayer.replay(ctx, chainConfig, []replayRequest{{blockNum: blockNum}}, func(ctx context.Context, env *txReplayEnv) (interface{}, error) {
+		traceResult := &TraceCallResult{Trace: []*ParityTrace{}}
+		var ot OeTracer
+		if traceTypeTrace {
+			ot.r = traceResult
+			ot.traceAddr = []int{}
+		}
+		var initialIbs *state.IntraBlockState
+		if traceTypeStateDiff {
+			initialIbs = env.ibs.Copy()
+		}
+		evm := vm.NewEVM(env.blockCtx, env.txCtx, env.ibs, env.chainConfig, vm.Config{Debug: traceTypeTrace, Tracer: &ot})
+		execResult, err := core.ApplyMessage(evm, env.msg, new(core.GasPool).AddGas(env.msg.Gas()), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, err
+		}
+		traceResult.Output = execResult.ReturnData
+		if !traceTypeStateDiff {
+			return traceResult, env.finalize(ctx, env.reader)
+		}
+		sdMap := make(map[common.Address]*StateDiffAccount)
+		traceResult.StateDiff = sdMap
+		sd := &StateDiff{sdMap: sdMap}
+		if err = env.finalize(ctx, sd); err != nil {
+			return nil, err
+		}
+		sd.CompareStates(initialIbs, env.ibs)
+		return traceResult, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(replayed[0].txs))
+	for _, t := range replayed[0].txs {
+		traceResult := t.result.(*TraceCallResult)
+		txHash := t.txn.Hash()
+		traceResult.TransactionHash = &txHash
+		results = append(results, traceResult)
+	}
+	return results, nil
 }
 
 // ReplayTransaction implements trace_replayTransaction.
@@ -31,6 +31,7 @@ type TraceAPI interface {
 type TraceAPIImpl struct {
 	*BaseAPI
 	dbReader  ethdb.Database
+	replayer  *blockReplayer
 	maxTraces uint64
 	traceType string
 	gasCap    uint64
@@ -41,6 +42,7 @@ func NewTraceAPI(dbReader ethdb.Database, cfg *cli.Flags) *TraceAPIImpl {
 	return &TraceAPIImpl{
 		BaseAPI:   &BaseAPI{},
 		dbReader:  dbReader,
+		replayer:  &blockReplayer{db: dbReader, workers: cfg.TraceWorkers},
 		maxTraces: cfg.MaxTraces,
 		traceType: cfg.TraceType,
 		gasCap:    cfg.Gascap,
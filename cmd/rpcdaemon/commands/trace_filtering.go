@@ -101,11 +101,12 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 	}
 	defer tx.Rollback()
 
-	var filteredHashes []common.Hash
-	// TODO(tjayrush): Parity intersperses block/uncle reward traces with transaction call traces. We need to be able to tell the
-	// difference. I do that with this boolean array. This will be re-written shortly. For now, we use this simple boolean flag.
-	// Eventually, we will fill the ParityTrace array directly as we go (and we can probably even do better than that)
-	var traceTypes []bool
+	// The selected transactions are traced by the replays of their blocks. TODO(tjayrush): Parity intersperses
+	// block/uncle reward traces with transaction call traces, the reward traces of the block follow the ones of its
+	// transactions if the request is flagged in rewards
+	var requests []replayRequest
+	var rewards []bool
+	var filtered uint64
 	var maxTracesCount uint64
 	var offset uint64
 	var skipped uint64
@@ -168,7 +169,7 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 			}
 
 			for _, num := range blockNumbers {
-				block, err := rawdb.ReadBlockByNumber(tx, num)
+				block, err := readBlockByNumber(tx, num)
 				if err != nil {
 					return nil, err
 				}
@@ -176,9 +177,10 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 				if errSenders != nil {
 					return nil, errSenders
 				}
+				replay := replayRequest{blockNum: num, txs: []int{}}
 				for i, txn := range block.Transactions() {
-					if uint64(len(filteredHashes)) == maxTracesCount {
-						if uint64(len(filteredHashes)) == api.maxTraces {
+					if filtered == maxTracesCount {
+						if filtered == api.maxTraces {
 							return nil, fmt.Errorf("too many traces found")
 						}
 						return nil, nil
@@ -196,31 +198,36 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 							continue
 						}
 						if bytes.Equal(senders[i].Bytes(), addrBytes) {
-							filteredHashes = append(filteredHashes, txn.Hash())
-							traceTypes = append(traceTypes, false)
+							replay.txs = append(replay.txs, i)
+							filtered++
 						}
 					} else if bytes.Equal(to.Bytes(), addrBytes) {
 						if skipped < offset {
 							skipped++
 							continue
 						}
-						filteredHashes = append(filteredHashes, txn.Hash())
-						traceTypes = append(traceTypes, false)
+						replay.txs = append(replay.txs, i)
+						filtered++
 					}
 				}
+				if len(replay.txs) > 0 {
+					requests = append(requests, replay)
+					rewards = append(rewards, false)
+				}
 				// TODO(tjayrush): Parity does not (for some unknown reason) include blockReward traces here
 			}
 		}
 	} else if req.FromBlock != nil || req.ToBlock != nil { // iterate over blocks
 
 		for blockNum := fromBlock; blockNum < toBlock+1; blockNum++ {
-			block, err := rawdb.ReadBlockByNumber(tx, blockNum)
+			block, err := readBlockByNumber(tx, blockNum)
 			if err != nil {
 				return nil, err
 			}
-			for _, txn := range block.Transactions() {
-				if uint64(len(filteredHashes)) == maxTracesCount {
-					if uint64(len(filteredHashes)) == api.maxTraces {
+			replay := replayRequest{blockNum: blockNum, txs: []int{}}
+			for i := range block.Transactions() {
+				if filtered == maxTracesCount {
+					if filtered == api.maxTraces {
 						return nil, fmt.Errorf("too many traces found")
 					}
 					return nil, nil
@@ -229,25 +236,28 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 					skipped++
 					continue
 				}
-				filteredHashes = append(filteredHashes, txn.Hash())
-				traceTypes = append(traceTypes, false)
+				replay.txs = append(replay.txs, i)
+				filtered++
 			}
 			// TODO(tjayrush): Need much, much better testing surrounding offset and count especially when including block rewards
+			reward := true
 			if skipped < offset {
 				skipped++
-				continue
+				reward = false
+			} else {
+				filtered++
+			}
+			if len(replay.txs) > 0 || reward {
+				// We need to intersperse block reward traces to match Parity
+				requests = append(requests, replay)
+				rewards = append(rewards, reward)
 			}
-			// We need to intersperse block reward traces to match Parity
-			filteredHashes = append(filteredHashes, block.Hash())
-			traceTypes = append(traceTypes, true)
 		}
 	} else {
 		return nil, fmt.Errorf("invalid parameters")
 	}
 
-	getter := adapter.NewBlockGetter(tx)
-	chainContext := adapter.NewChainContext(tx)
-	genesis, err := rawdb.ReadBlockByNumber(tx, 0)
+	genesis, err := readBlockByNumber(tx, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -257,16 +267,34 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 		return nil, err
 	}
 	traceType := "callTracer" // nolint: goconst
+	replayed, err := api.replayer.replay(ctx, chainConfig, requests, func(ctx context.Context, env *txReplayEnv) (interface{}, error) {
+		trace, err := transactions.TraceTx(ctx, env.msg, env.blockCtx, env.txCtx, env.ibs, &tracers.TraceConfig{Tracer: &traceType}, env.chainConfig)
+		if err != nil {
+			return nil, err
+		}
+		return trace, env.finalize(ctx, env.reader)
+	})
+	if err != nil {
+		return nil, err
+	}
 	traces := ParityTraces{}
 
-	for i, txOrBlockHash := range filteredHashes {
-		if traceTypes[i] {
-			// In this case, we're processing a block (or uncle) reward trace. The hash is a block hash
-			// Because Geth does not return blockReward or uncleReward traces, we must create them here
-			block, err := rawdb.ReadBlockByHash(tx, txOrBlockHash)
-			if err != nil {
-				return nil, err
+	for i, r := range replayed {
+		block := r.block
+		for _, t := range r.txs {
+			traceJSON, ok := t.result.(json.RawMessage)
+			if !ok {
+				return nil, fmt.Errorf("unknown type in trace_filter")
 			}
+			var gethTrace GethTrace
+			jsonStr, _ := traceJSON.MarshalJSON()
+			json.Unmarshal(jsonStr, &gethTrace) // nolint:errcheck
+			converted := api.convertToParityTrace(gethTrace, block.Hash(), block.NumberU64(), t.txn, uint64(t.index), []int{})
+			traces = append(traces, converted...)
+		}
+		if rewards[i] {
+			// In this case, we're processing a block (or uncle) reward trace
+			// Because Geth does not return blockReward or uncleReward traces, we must create them here
 			minerReward, uncleRewards := ethash.AccumulateRewards(chainConfig, block.Header(), block.Uncles())
 			fmt.Printf("%v\n", minerReward)
 			var tr ParityTrace
@@ -294,26 +322,6 @@ func (api *TraceAPIImpl) Filter(ctx context.Context, req TraceFilterRequest) (Pa
 					traces = append(traces, tr)
 				}
 			}
-		} else {
-			// In this case, we're processing a transaction hash
-			txn, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(tx, txOrBlockHash)
-			msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, getter, chainConfig, chainContext, tx.(ethdb.HasTx).Tx(), blockHash, txIndex)
-			if err != nil {
-				return nil, err
-			}
-			trace, err := transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, &tracers.TraceConfig{Tracer: &traceType}, chainConfig)
-			if err != nil {
-				return nil, err
-			}
-			traceJSON, ok := trace.(json.RawMessage)
-			if !ok {
-				return nil, fmt.Errorf("unknown type in trace_filter")
-			}
-			var gethTrace GethTrace
-			jsonStr, _ := traceJSON.MarshalJSON()
-			json.Unmarshal(jsonStr, &gethTrace) // nolint:errcheck
-			converted := api.convertToParityTrace(gethTrace, blockHash, blockNumber, txn, txIndex, []int{})
-			traces = append(traces, converted...)
 		}
 	}
 	return traces, nil
@@ -356,7 +364,7 @@ func isAddressInFilter(addr *common.Address, filter []*common.Address) bool {
 func (api *TraceAPIImpl) getTransactionTraces(tx ethdb.Database, ctx context.Context, txHash common.Hash) (ParityTraces, error) {
 	getter := adapter.NewBlockGetter(tx)
 	chainContext := adapter.NewChainContext(tx)
-	genesis, err := rawdb.ReadBlockByNumber(tx, 0)
+	genesis, err := readBlockByNumber(tx, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"golang.org/x/sync/errgroup"
+)
+
+// replayRequest selects the transactions of the block to trace
+type replayRequest struct {
+	blockNum uint64
+	txs      []int // the ascending indices of the transactions, all of them if nil
+}
+
+// replayedTx is the result of the tracer of the transaction
+type replayedTx struct {
+	index  int
+	txn    *types.Transaction
+	result interface{}
+}
+
+// replayedBlock is the replay of the block of the request, with the results of its selected transactions in order
+type replayedBlock struct {
+	block *types.Block
+	txs   []replayedTx
+}
+
+// txReplayEnv is the environment of the selected transaction, the state is the one after the preceding transactions
+// of the block
+type txReplayEnv struct {
+	chainConfig *params.ChainConfig
+	block       *types.Block
+	msg         core.Message
+	blockCtx    vm.BlockContext
+	txCtx       vm.TxContext
+	ibs         *state.IntraBlockState
+	reader      *adapter.StateReader
+}
+
+// finalize finalizes the transaction applied to the state into the writer
+func (env *txReplayEnv) finalize(ctx context.Context, writer state.StateWriter) error {
+	return env.ibs.FinalizeTx(env.chainConfig.WithEIPsFlags(ctx, env.block.Number()), writer)
+}
+
+// txTracer applies the selected transaction to the state of the environment with its tracer, finalizes it and
+// returns the result of the tracer
+type txTracer func(ctx context.Context, env *txReplayEnv) (interface{}, error)
+
+// blockReplayer re-executes the historical blocks in parallel. The requests are shared by the workers, each of which
+// replays the blocks with its own read transaction and the historical reader of the state of the parent block, so
+// tracing a range takes about the time of its longest blocks instead of their sum. A block is replayed once, however
+// many of its transactions are traced, and only up to the last of them
+type blockReplayer struct {
+	db      ethdb.Database
+	workers int
+}
+
+// replay replays the blocks of the requests, the results are in the order of the requests
+func (r *blockReplayer) replay(ctx context.Context, chainConfig *params.ChainConfig, requests []replayRequest, traceTx txTracer) ([]replayedBlock, error) {
+	results := make([]replayedBlock, len(requests))
+	workers := r.workers
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	var next int64 = -1
+	g, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			tx, err := r.db.Begin(ctx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			for {
+				n := int(atomic.AddInt64(&next, 1))
+				if n >= len(requests) {
+					return nil
+				}
+				if results[n], err = replayBlock(ctx, tx, chainConfig, requests[n], traceTx); err != nil {
+					return err
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func replayBlock(ctx context.Context, tx ethdb.Database, chainConfig *params.ChainConfig, req replayRequest, traceTx txTracer) (replayedBlock, error) {
+	block, err := readBlockByNumber(tx, req.blockNum)
+	if err != nil {
+		return replayedBlock{}, err
+	}
+	if block == nil {
+		return replayedBlock{}, fmt.Errorf("block %d not found", req.blockNum)
+	}
+	replayed := replayedBlock{block: block}
+	txs := block.Transactions()
+	last := len(txs) - 1
+	if req.txs != nil {
+		if len(req.txs) == 0 {
+			return replayed, nil
+		}
+		last = req.txs[len(req.txs)-1]
+	}
+	if last < 0 {
+		return replayed, nil
+	}
+	if last >= len(txs) {
+		return replayedBlock{}, fmt.Errorf("transaction index %d out of range for block %d", last, req.blockNum)
+	}
+
+	reader := adapter.NewStateReader(tx.(ethdb.HasTx).Tx(), block.NumberU64()-1)
+	ibs := state.New(reader)
+	chainContext := adapter.NewChainContext(tx)
+	signer := types.MakeSigner(chainConfig, block.Number())
+	blockCtx := core.NewEVMBlockContext(block.Header(), chainContext, nil)
+	selected := req.txs
+	for idx, txn := range txs[:last+1] {
+		select {
+		default:
+		case <-ctx.Done():
+			return replayedBlock{}, ctx.Err()
+		}
+		ibs.Prepare(txn.Hash(), block.Hash(), idx)
+		msg, _ := txn.AsMessage(signer, block.BaseFee())
+		txCtx := core.NewEVMTxContext(msg)
+		if req.txs == nil || (len(selected) > 0 && selected[0] == idx) {
+			if req.txs != nil {
+				selected = selected[1:]
+			}
+			env := &txReplayEnv{chainConfig: chainConfig, block: block, msg: msg, blockCtx: blockCtx, txCtx: txCtx, ibs: ibs, reader: reader}
+			result, err := traceTx(ctx, env)
+			if err != nil {
+				return replayedBlock{}, fmt.Errorf("tracing transaction %x: %w", txn.Hash(), err)
+			}
+			replayed.txs = append(replayed.txs, replayedTx{index: idx, txn: txn, result: result})
+			continue
+		}
+		vmenv := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{})
+		if _, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(txn.Gas()), true /* refunds */, false /* gasBailout */); err != nil {
+			return replayedBlock{}, fmt.Errorf("transaction %x failed: %w", txn.Hash(), err)
+		}
+		if err = ibs.FinalizeTx(chainConfig.WithEIPsFlags(ctx, block.Number()), reader); err != nil {
+			return replayedBlock{}, err
+		}
+	}
+	return replayed, nil
+}
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/cli"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+func TestFilterReplaysInParallel(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	head := rawdb.ReadCurrentHeader(db).Number.Uint64()
+	from, to := hexutil.Uint64(0), hexutil.Uint64(head)
+	count := uint64(1000)
+	req := TraceFilterRequest{FromBlock: &from, ToBlock: &to, Count: &count}
+
+	serial, err := NewTraceAPI(db, &cli.Flags{TraceWorkers: 1, MaxTraces: 1000}).Filter(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := NewTraceAPI(db, &cli.Flags{TraceWorkers: 4, MaxTraces: 1000})
+	parallel, err := api.Filter(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(serial, parallel) {
+		t.Fatalf("parallel traces differ from the serial ones")
+	}
+
+	if len(parallel) != int(head)+1 {
+		t.Errorf("%d traces of %d block rewards", len(parallel), head+1)
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	chainConfig, err := (&BaseAPI{}).chainConfig(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceType := "callTracer"
+	config := &tracers.TraceConfig{Tracer: &traceType}
+
+	// All the transactions of every block, and every other transaction of the blocks
+	head := rawdb.ReadCurrentHeader(db).Number.Uint64()
+	var requests []replayRequest
+	for n := uint64(0); n <= head; n++ {
+		requests = append(requests, replayRequest{blockNum: n})
+		block, err := readBlockByNumber(tx, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := []int{}
+		for i := 1; i < len(block.Transactions()); i += 2 {
+			selected = append(selected, i)
+		}
+		requests = append(requests, replayRequest{blockNum: n, txs: selected})
+	}
+	replayer := &blockReplayer{db: db, workers: 4}
+	replayed, err := replayer.replay(context.Background(), chainConfig, requests, func(ctx context.Context, env *txReplayEnv) (interface{}, error) {
+		trace, err := transactions.TraceTx(ctx, env.msg, env.blockCtx, env.txCtx, env.ibs, config, env.chainConfig)
+		if err != nil {
+			return nil, err
+		}
+		return trace, env.finalize(ctx, env.reader)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replays of the blocks trace as the replays of the single transactions
+	getter, chainContext := adapter.NewBlockGetter(tx), adapter.NewChainContext(tx)
+	var traced int
+	for i, r := range replayed {
+		req := requests[i]
+		if r.block.NumberU64() != req.blockNum {
+			t.Fatalf("request %d: replayed block %d instead of %d", i, r.block.NumberU64(), req.blockNum)
+		}
+		want := len(r.block.Transactions())
+		if req.txs != nil {
+			want = len(req.txs)
+		}
+		if len(r.txs) != want {
+			t.Fatalf("block %d: %d traced transactions instead of %d", req.blockNum, len(r.txs), want)
+		}
+		for j, replayedTx := range r.txs {
+			if req.txs != nil && replayedTx.index != req.txs[j] {
+				t.Fatalf("block %d: traced transaction %d instead of %d", req.blockNum, replayedTx.index, req.txs[j])
+			}
+			msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(context.Background(), getter, chainConfig, chainContext, tx.(ethdb.HasTx).Tx(), r.block.Hash(), uint64(replayedTx.index))
+			if err != nil {
+				t.Fatal(err)
+			}
+			trace, err := transactions.TraceTx(context.Background(), msg, blockCtx, txCtx, ibs, config, chainConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have, want := untimed(t, replayedTx.result), untimed(t, trace); have != want {
+				t.Errorf("block %d, transaction %d: traced\n%s\ninstead of\n%s", req.blockNum, replayedTx.index, have, want)
+			}
+			traced++
+		}
+	}
+	if traced == 0 {
+		t.Fatal("no transactions in the test chain")
+	}
+}
+
+// untimed returns the call trace without the execution times
+func untimed(t *testing.T, trace interface{}) string {
+	var gethTrace GethTrace
+	if err := json.Unmarshal(trace.(json.RawMessage), &gethTrace); err != nil {
+		t.Fatal(err)
+	}
+	var strip func(*GethTrace)
+	strip = func(trace *GethTrace) {
+		trace.Time = ""
+		for _, call := range trace.Calls {
+			strip(call)
+		}
+	}
+	strip(&gethTrace)
+	b, _ := json.Marshal(gethTrace)
+	return string(b)
+}
+
+func TestReplayBlockTransactions(t *testing.T) {
+	db, err := createTestDb()
+	if err != nil {
+		t.Fatalf("create test db: %v", err)
+	}
+	api := NewTraceAPI(db, &cli.Flags{TraceWorkers: 2})
+	head := rawdb.ReadCurrentHeader(db).Number.Uint64()
+	for n := uint64(1); n <= head; n++ {
+		block, err := rawdb.ReadBlockByNumber(db, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		senders, err := rawdb.ReadSenders(db, block.Hash(), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := api.ReplayBlockTransactions(context.Background(), rpc.BlockNumber(n), []string{TraceTypeTrace, TraceTypeStateDiff})
+		if err != nil {
+			t.Fatalf("block %d: %v", n, err)
+		}
+		if len(results) != len(block.Transactions()) {
+			t.Fatalf("block %d: %d results of %d transactions", n, len(results), len(block.Transactions()))
+		}
+		for i, result := range results {
+			traceResult := result.(*TraceCallResult)
+			txn := block.Transactions()[i]
+			if *traceResult.TransactionHash != txn.Hash() {
+				t.Errorf("block %d: result %d of transaction %x", n, i, *traceResult.TransactionHash)
+			}
+			if len(traceResult.Trace) == 0 {
+				t.Errorf("block %d: no trace of transaction %d", n, i)
+			}
+			if _, ok := traceResult.StateDiff[senders[i]]; !ok {
+				t.Errorf("block %d: no state diff of the sender of transaction %d", n, i)
+			}
+		}
+	}
+	if _, err = api.ReplayBlockTransactions(context.Background(), rpc.BlockNumber(1), []string{TraceTypeVmTrace}); err == nil {
+		t.Error("expected vmTrace to be refused")
+	}
+}
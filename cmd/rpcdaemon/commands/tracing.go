@@ -17,32 +17,33 @@ import (
 )
 
 // TraceTransaction implements debug_traceTransaction. Returns Geth style transaction traces.
-func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig) (interface{}, error) {
+// Struct logs are streamed to the client while the transaction is being re-executed.
+func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash common.Hash, config *tracers.TraceConfig, stream *rpc.Stream) error {
 	tx, err := api.dbReader.Begin(ctx, ethdb.RO)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
 
 	// Retrieve the transaction and assemble its EVM context
 	txn, blockHash, _, txIndex := rawdb.ReadTransaction(tx, hash)
 	if txn == nil {
-		return nil, fmt.Errorf("transaction %#x not found", hash)
+		return fmt.Errorf("transaction %#x not found", hash)
 	}
 	getter := adapter.NewBlockGetter(tx)
 	chainContext := adapter.NewChainContext(tx)
 
 	chainConfig, err := api.chainConfig(tx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	msg, blockCtx, txCtx, ibs, _, err := transactions.ComputeTxEnv(ctx, getter, chainConfig, chainContext, tx.(ethdb.HasTx).Tx(), blockHash, txIndex)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// Trace the transaction and return
-	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig)
+	return transactions.TraceTxStream(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig, stream)
 }
 
 func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *tracers.TraceConfig) (interface{}, error) {
@@ -72,7 +73,7 @@ func (api *PrivateDebugAPIImpl) TraceCall(ctx context.Context, args ethapi.CallA
 		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
 	}
 	ibs := state.New(stateReader)
-	msg := args.ToMessage(api.GasCap)
+	msg := args.ToMessage(api.GasCap, header.BaseFee)
 	blockCtx, txCtx := transactions.GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, dbtx)
 	// Trace the transaction and return
 	return transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, chainConfig)
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// TxPoolAPI the interface for the txpool_ RPC commands
+type TxPoolAPI interface {
+	Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error)
+	ContentFrom(ctx context.Context, addr common.Address) (map[string]map[string]*RPCTransaction, error)
+	Status(ctx context.Context) (map[string]hexutil.Uint, error)
+	Inspect(ctx context.Context) (map[string]map[string]map[string]string, error)
+}
+
+// TxPoolAPIImpl data structure to store things needed for txpool_ commands
+type TxPoolAPIImpl struct {
+	*BaseAPI
+	ethBackend core.ApiBackend
+}
+
+// NewTxPoolAPI returns TxPoolAPIImpl instance
+func NewTxPoolAPI(eth core.ApiBackend) *TxPoolAPIImpl {
+	return &TxPoolAPIImpl{
+		BaseAPI:    &BaseAPI{},
+		ethBackend: eth,
+	}
+}
+
+// Content implements txpool_content. Returns the pending and queued transactions, grouped by sender and nonce.
+func (api *TxPoolAPIImpl) Content(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error) {
+	if api.ethBackend == nil {
+		// We're running in --chaindata mode or otherwise cannot get the backend
+		return nil, fmt.Errorf(NotAvailableChainData, "txpool_content")
+	}
+	pending, queued, err := api.ethBackend.TxPoolContent(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]map[string]*RPCTransaction),
+		"queued":  make(map[string]map[string]*RPCTransaction),
+	}
+	// Flatten the pending transactions
+	for account, txs := range pending {
+		dump := make(map[string]*RPCTransaction)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+		}
+		content["pending"][account.Hex()] = dump
+	}
+	// Flatten the queued transactions
+	for account, txs := range queued {
+		dump := make(map[string]*RPCTransaction)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+		}
+		content["queued"][account.Hex()] = dump
+	}
+	return content, nil
+}
+
+// ContentFrom implements txpool_contentFrom. Returns the pending and queued transactions of the given sender, grouped by nonce.
+func (api *TxPoolAPIImpl) ContentFrom(ctx context.Context, addr common.Address) (map[string]map[string]*RPCTransaction, error) {
+	if api.ethBackend == nil {
+		// We're running in --chaindata mode or otherwise cannot get the backend
+		return nil, fmt.Errorf(NotAvailableChainData, "txpool_contentFrom")
+	}
+	pending, queued, err := api.ethBackend.TxPoolContent(ctx, &addr)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]*RPCTransaction),
+		"queued":  make(map[string]*RPCTransaction),
+	}
+	for _, tx := range pending[addr] {
+		content["pending"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	for _, tx := range queued[addr] {
+		content["queued"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	return content, nil
+}
+
+// Status implements txpool_status. Returns the number of pending and queued transactions in the pool.
+func (api *TxPoolAPIImpl) Status(ctx context.Context) (map[string]hexutil.Uint, error) {
+	if api.ethBackend == nil {
+		// We're running in --chaindata mode or otherwise cannot get the backend
+		return nil, fmt.Errorf(NotAvailableChainData, "txpool_status")
+	}
+	pending, queued, err := api.ethBackend.TxPoolStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]hexutil.Uint{
+		"pending": hexutil.Uint(pending),
+		"queued":  hexutil.Uint(queued),
+	}, nil
+}
+
+// Inspect implements txpool_inspect. Returns a textual summary of the pending and queued transactions, grouped by sender and nonce.
+func (api *TxPoolAPIImpl) Inspect(ctx context.Context) (map[string]map[string]map[string]string, error) {
+	if api.ethBackend == nil {
+		// We're running in --chaindata mode or otherwise cannot get the backend
+		return nil, fmt.Errorf(NotAvailableChainData, "txpool_inspect")
+	}
+	pending, queued, err := api.ethBackend.TxPoolContent(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]map[string]map[string]string{
+		"pending": make(map[string]map[string]string),
+		"queued":  make(map[string]map[string]string),
+	}
+	// Define a formatter to flatten a transaction into a string
+	var format = func(tx *types.Transaction) string {
+		if to := tx.To(); to != nil {
+			return fmt.Sprintf("%s: %v wei + %v gas × %v wei", tx.To().Hex(), tx.Value(), tx.Gas(), tx.GasPrice())
+		}
+		return fmt.Sprintf("contract creation: %v wei + %v gas × %v wei", tx.Value(), tx.Gas(), tx.GasPrice())
+	}
+	// Flatten the pending transactions
+	for account, txs := range pending {
+		dump := make(map[string]string)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+		}
+		content["pending"][account.Hex()] = dump
+	}
+	// Flatten the queued transactions
+	for account, txs := range queued {
+		dump := make(map[string]string)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
+		}
+		content["queued"][account.Hex()] = dump
+	}
+	return content, nil
+}
@@ -8,22 +8,45 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	ethfilters "github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces/remote"
 	"github.com/ledgerwatch/turbo-geth/log"
 )
 
+// filterTimeout is the time after which the polling filters which are not polled are uninstalled
+const filterTimeout = 5 * time.Minute
+
 type Filters struct {
 	mu sync.RWMutex
 
-	headsSubs map[string]chan *types.Header
+	headsSubs      map[string]chan *types.Header
+	pendingTxsSubs map[string]pendingTxsSub
+
+	pendingTxsFiltersMu sync.Mutex
+	pendingTxsFilters   map[uint64]*pendingTxsFilter
+	lastFilterId        uint64
+}
+
+// pendingTxsSub receives the hashes of the pending transactions matching the criteria, all of them if crit is nil
+type pendingTxsSub struct {
+	crit *ethfilters.PendingTxCriteria
+	out  chan []common.Hash
+}
+
+// pendingTxsFilter collects the hashes of the pending transactions of the subscription until they are polled
+type pendingTxsFilter struct {
+	subId    string
+	hashes   []common.Hash
+	lastPoll time.Time
 }
 
 func New(ethBackend core.ApiBackend) *Filters {
 	log.Info("rpc filters: subscribing to tg events")
 
-	ff := &Filters{headsSubs: make(map[string]chan *types.Header)}
+	ff := newFilters()
 
 	go func() {
 		var err error
@@ -36,9 +59,30 @@ func New(ethBackend core.ApiBackend) *Filters {
 		}
 	}()
 
+	go func() {
+		var err error
+		for i := 0; i < 10; i++ {
+			err = ethBackend.SubscribePendingTxs(context.Background(), ff.OnNewPendingTxs)
+			if err != nil {
+				log.Warn("rpc filters: error subscribing to pending transactions", "err", err)
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+
+	go ff.timeoutLoop()
+
 	return ff
 }
 
+func newFilters() *Filters {
+	return &Filters{
+		headsSubs:         make(map[string]chan *types.Header),
+		pendingTxsSubs:    make(map[string]pendingTxsSub),
+		pendingTxsFilters: make(map[uint64]*pendingTxsFilter),
+	}
+}
+
 func (ff *Filters) SubscribeNewHeads(out chan *types.Header) string {
 	ff.mu.Lock()
 	defer ff.mu.Unlock()
@@ -47,10 +91,102 @@ func (ff *Filters) SubscribeNewHeads(out chan *types.Header) string {
 	return id
 }
 
+// SubscribePendingTxs sends the hashes of the new pending transactions matching the criteria to out, all of them if
+// crit is nil
+func (ff *Filters) SubscribePendingTxs(crit *ethfilters.PendingTxCriteria, out chan []common.Hash) string {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	id := generateSubscriptionID()
+	ff.pendingTxsSubs[id] = pendingTxsSub{crit: crit, out: out}
+	return id
+}
+
 func (ff *Filters) Unsubscribe(id string) {
 	ff.mu.Lock()
 	defer ff.mu.Unlock()
 	delete(ff.headsSubs, id)
+	delete(ff.pendingTxsSubs, id)
+}
+
+// NewPendingTxsFilter installs the polling filter collecting the hashes of the new pending transactions matching the
+// criteria, all of them if crit is nil. It is uninstalled if it's not polled within filterTimeout
+func (ff *Filters) NewPendingTxsFilter(crit *ethfilters.PendingTxCriteria) uint64 {
+	hashes := make(chan []common.Hash, 128)
+	filter := &pendingTxsFilter{subId: ff.SubscribePendingTxs(crit, hashes), lastPoll: time.Now()}
+	ff.pendingTxsFiltersMu.Lock()
+	ff.lastFilterId++
+	id := ff.lastFilterId
+	ff.pendingTxsFilters[id] = filter
+	ff.pendingTxsFiltersMu.Unlock()
+
+	go func() {
+		for h := range hashes {
+			ff.pendingTxsFiltersMu.Lock()
+			filter.hashes = append(filter.hashes, h...)
+			ff.pendingTxsFiltersMu.Unlock()
+		}
+	}()
+	return id
+}
+
+// PendingTxsFilterChanges returns the hashes collected by the filter since the last poll, false if there is no such
+// filter
+func (ff *Filters) PendingTxsFilterChanges(id uint64) ([]common.Hash, bool) {
+	ff.pendingTxsFiltersMu.Lock()
+	defer ff.pendingTxsFiltersMu.Unlock()
+	filter, ok := ff.pendingTxsFilters[id]
+	if !ok {
+		return nil, false
+	}
+	hashes := filter.hashes
+	filter.hashes = nil
+	filter.lastPoll = time.Now()
+	return hashes, true
+}
+
+// UninstallFilter removes the polling filter, it returns false if there is no such filter
+func (ff *Filters) UninstallFilter(id uint64) bool {
+	ff.pendingTxsFiltersMu.Lock()
+	filter, ok := ff.pendingTxsFilters[id]
+	delete(ff.pendingTxsFilters, id)
+	ff.pendingTxsFiltersMu.Unlock()
+	if ok {
+		ff.unsubscribeFilter(filter)
+	}
+	return ok
+}
+
+// unsubscribeFilter ends the subscription of the removed filter, closing its channel once nothing can send to it
+func (ff *Filters) unsubscribeFilter(filter *pendingTxsFilter) {
+	ff.mu.Lock()
+	sub := ff.pendingTxsSubs[filter.subId]
+	delete(ff.pendingTxsSubs, filter.subId)
+	ff.mu.Unlock()
+	close(sub.out)
+}
+
+// timeoutLoop uninstalls the filters which are not polled within filterTimeout
+func (ff *Filters) timeoutLoop() {
+	ticker := time.NewTicker(filterTimeout / 5)
+	defer ticker.Stop()
+	for range ticker.C {
+		ff.uninstallExpired(time.Now().Add(-filterTimeout))
+	}
+}
+
+func (ff *Filters) uninstallExpired(before time.Time) {
+	var expired []*pendingTxsFilter
+	ff.pendingTxsFiltersMu.Lock()
+	for id, filter := range ff.pendingTxsFilters {
+		if filter.lastPoll.Before(before) {
+			expired = append(expired, filter)
+			delete(ff.pendingTxsFilters, id)
+		}
+	}
+	ff.pendingTxsFiltersMu.Unlock()
+	for _, filter := range expired {
+		ff.unsubscribeFilter(filter)
+	}
 }
 
 func (ff *Filters) OnNewEvent(event *remote.SubscribeReply) {
@@ -75,6 +211,46 @@ func (ff *Filters) OnNewEvent(event *remote.SubscribeReply) {
 	}
 }
 
+// OnNewPendingTxs sends the hashes of the transactions to the subscriptions whose criteria they match. The hashes
+// are dropped for the subscriptions which don't keep up, so that a stuck subscriber doesn't block the others and
+// the unsubscribing
+func (ff *Filters) OnNewPendingTxs(txs types.Transactions) {
+	ff.mu.RLock()
+	defer ff.mu.RUnlock()
+	if len(ff.pendingTxsSubs) == 0 {
+		return
+	}
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	for id, sub := range ff.pendingTxsSubs {
+		if sub.crit == nil {
+			sendPendingTxs(id, sub.out, hashes)
+			continue
+		}
+		var matched []common.Hash
+		for i, tx := range txs {
+			if sub.crit.Matches(tx) {
+				matched = append(matched, hashes[i])
+			}
+		}
+		if len(matched) > 0 {
+			sendPendingTxs(id, sub.out, matched)
+		}
+	}
+}
+
+// sendPendingTxs sends the hashes without blocking, it is called under the read lock of the subscriptions which
+// keeps the channel from being closed
+func sendPendingTxs(id string, out chan []common.Hash, hashes []common.Hash) {
+	select {
+	case out <- hashes:
+	default:
+		log.Warn("rpc filters: pending transactions subscriber is too slow, dropping", "id", id, "txs", len(hashes))
+	}
+}
+
 func generateSubscriptionID() string {
 	var id [32]byte
 
@@ -0,0 +1,103 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	ethfilters "github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	target = common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268")
+	other  = common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+	testTxs = types.Transactions{
+		types.NewTransaction(0, target, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb, 0x01}),
+		types.NewTransaction(1, other, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+		types.NewTransaction(2, target, uint256.NewInt().SetUint64(1), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+	}
+	testCrit = &ethfilters.PendingTxCriteria{To: []common.Address{target}, Selector: []byte{0xa9, 0x05, 0x9c, 0xbb}}
+)
+
+func TestPendingTxsSubscriptionCriteria(t *testing.T) {
+	ff := newFilters()
+	all, matching := make(chan []common.Hash, 1), make(chan []common.Hash, 1)
+	ff.SubscribePendingTxs(nil, all)
+	id := ff.SubscribePendingTxs(testCrit, matching)
+
+	ff.OnNewPendingTxs(testTxs)
+	assert.Equal(t, []common.Hash{testTxs[0].Hash(), testTxs[1].Hash(), testTxs[2].Hash()}, <-all)
+	assert.Equal(t, []common.Hash{testTxs[0].Hash(), testTxs[2].Hash()}, <-matching)
+
+	// Nothing is sent if no transaction matches
+	ff.OnNewPendingTxs(testTxs[1:2])
+	assert.Equal(t, []common.Hash{testTxs[1].Hash()}, <-all)
+	assert.Empty(t, matching)
+
+	ff.Unsubscribe(id)
+	ff.OnNewPendingTxs(testTxs[:1])
+	<-all
+	assert.Empty(t, matching)
+}
+
+func TestPendingTxsSlowSubscriber(t *testing.T) {
+	ff := newFilters()
+	stuck, all := make(chan []common.Hash), make(chan []common.Hash, 1)
+	stuckId := ff.SubscribePendingTxs(nil, stuck)
+	ff.SubscribePendingTxs(nil, all)
+
+	// The subscriber which doesn't read neither blocks the others nor its unsubscribing
+	ff.OnNewPendingTxs(testTxs)
+	assert.Len(t, <-all, 3)
+	ff.Unsubscribe(stuckId)
+	ff.OnNewPendingTxs(testTxs[:1])
+	assert.Len(t, <-all, 1)
+}
+
+func TestPendingTxsFilterCriteria(t *testing.T) {
+	ff := newFilters()
+	id := ff.NewPendingTxsFilter(testCrit)
+
+	ff.OnNewPendingTxs(testTxs)
+	ff.OnNewPendingTxs(testTxs[1:2])
+	ff.OnNewPendingTxs(testTxs[:1])
+	var hashes []common.Hash
+	require.Eventually(t, func() bool {
+		changes, ok := ff.PendingTxsFilterChanges(id)
+		require.True(t, ok)
+		hashes = append(hashes, changes...)
+		return len(hashes) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []common.Hash{testTxs[0].Hash(), testTxs[2].Hash(), testTxs[0].Hash()}, hashes)
+
+	// The changes are returned once
+	changes, ok := ff.PendingTxsFilterChanges(id)
+	assert.True(t, ok)
+	assert.Empty(t, changes)
+
+	assert.True(t, ff.UninstallFilter(id))
+	assert.False(t, ff.UninstallFilter(id))
+	_, ok = ff.PendingTxsFilterChanges(id)
+	assert.False(t, ok)
+	ff.OnNewPendingTxs(testTxs)
+}
+
+func TestPendingTxsFilterTimeout(t *testing.T) {
+	ff := newFilters()
+	polled, expired := ff.NewPendingTxsFilter(nil), ff.NewPendingTxsFilter(nil)
+	_, ok := ff.PendingTxsFilterChanges(polled)
+	require.True(t, ok)
+	ff.pendingTxsFilters[expired].lastPoll = time.Now().Add(-2 * filterTimeout)
+
+	ff.uninstallExpired(time.Now().Add(-filterTimeout))
+	_, ok = ff.PendingTxsFilterChanges(polled)
+	assert.True(t, ok)
+	_, ok = ff.PendingTxsFilterChanges(expired)
+	assert.False(t, ok)
+	assert.Len(t, ff.pendingTxsSubs, 1)
+}
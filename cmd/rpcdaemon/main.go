@@ -7,6 +7,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/commands"
 	"github.com/ledgerwatch/turbo-geth/cmd/rpcdaemon/filters"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/common/fdlimit"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -24,6 +25,12 @@ func main() {
 		}
 		defer db.Close()
 
+		if cfg.StallThreshold > 0 {
+			watchdog := debug.NewStallWatchdog(cfg.StallDir, cfg.StallThreshold, cfg.StallKeep)
+			debug.SetStallWatchdog(watchdog)
+			go watchdog.Run(cmd.Context().Done())
+		}
+
 		var ff *filters.Filters
 		if backend != nil {
 			ff = filters.New(backend)
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/execproof"
+	"github.com/spf13/cobra"
+)
+
+var (
+	proofsDir   string
+	proofsSrc   string
+	proofTo     uint64
+	signerKey   string
+	signersList string
+)
+
+func init() {
+	withChaindata(executionProofExportCmd)
+	withBlock(executionProofExportCmd)
+	executionProofExportCmd.Flags().Uint64Var(&proofTo, "to", 0, "last block of the range of the proof")
+	executionProofExportCmd.Flags().StringVar(&signerKey, "key", "", "file of the hex encoded private key to sign the proof with")
+	executionProofExportCmd.Flags().StringVar(&proofsDir, "proofs", "execproofs", "directory where the proof is written to")
+	must(executionProofExportCmd.MarkFlagRequired("key"))
+	rootCmd.AddCommand(executionProofExportCmd)
+
+	executionProofImportCmd.Flags().StringVar(&proofsSrc, "src", "", "directory of the proofs to import")
+	executionProofImportCmd.Flags().StringVar(&proofsDir, "proofs", "execproofs", "directory of the proofs of the node, see --execution.proofs")
+	executionProofImportCmd.Flags().StringVar(&signersList, "signers", "", "comma separated list of the addresses of the trusted signers")
+	must(executionProofImportCmd.MarkFlagRequired("src"))
+	rootCmd.AddCommand(executionProofImportCmd)
+}
+
+var executionProofExportCmd = &cobra.Command{
+	Use:     "execution_proof_export",
+	Short:   "Export the signed proof of the execution of the blocks from --block to --to, for the nodes to fast-forward their execution by",
+	Example: "go run cmd/snapshots/generator/main.go execution_proof_export --block 11000001 --to 11100000 --key nodekey --chaindata /media/b00ris/nvme/tgstaged/tg/chaindata/ --proofs /media/b00ris/nvme/execproofs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := crypto.LoadECDSA(signerKey)
+		if err != nil {
+			return err
+		}
+		db := ethdb.MustOpen(chaindata)
+		defer db.Close()
+		a, err := execproof.Export(cmd.Context(), db, block, proofTo, key, proofsDir)
+		if err != nil {
+			return err
+		}
+		log.Info("Execution proof exported", "from", a.FromBlock, "to", a.ToBlock, "signer", crypto.PubkeyToAddress(key.PublicKey), "data", a.DataHash)
+		return nil
+	},
+}
+
+var executionProofImportCmd = &cobra.Command{
+	Use:     "execution_proof_import",
+	Short:   "Verify the execution proofs of the trusted signers and import them into the proofs directory of the node",
+	Example: "go run cmd/snapshots/generator/main.go execution_proof_import --src /media/b00ris/nvme/execproofs --proofs /media/b00ris/nvme/tgstaged/execproofs --signers 0x8a1f9a8f95be41cd7ccb6168179afb4504aefe38",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var signers []common.Address
+		for _, signer := range strings.Split(signersList, ",") {
+			if signer = strings.TrimSpace(signer); signer == "" {
+				continue
+			}
+			if !common.IsHexAddress(signer) {
+				return fmt.Errorf("invalid signer address: %s", signer)
+			}
+			signers = append(signers, common.HexToAddress(signer))
+		}
+		store, err := execproof.OpenStore(proofsDir, signers)
+		if err != nil {
+			return err
+		}
+		attestations, err := execproof.ReadAttestations(proofsSrc)
+		if err != nil {
+			return err
+		}
+		for _, a := range attestations {
+			if err = store.Import(proofsSrc, a); err != nil {
+				return fmt.Errorf("importing execution proof %s: %w", a.Name(), err)
+			}
+			log.Info("Execution proof imported", "from", a.FromBlock, "to", a.ToBlock)
+		}
+		return nil
+	},
+}
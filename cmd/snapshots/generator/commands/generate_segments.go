@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/spf13/cobra"
+
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/snapshotsync"
+	trnt "github.com/ledgerwatch/turbo-geth/turbo/snapshotsync/bittorrent"
+)
+
+var outputDir string
+
+func init() {
+	withChaindata(generateSegmentsCmd)
+	withBlock(generateSegmentsCmd)
+	generateSegmentsCmd.Flags().StringVar(&outputDir, "output", "snapshots", "directory where the headers, bodies and state snapshots are written to, and seeded from")
+	rootCmd.AddCommand(generateSegmentsCmd)
+}
+
+var generateSegmentsCmd = &cobra.Command{
+	Use:     "segments",
+	Short:   "Generate headers, bodies and state snapshots at the epoch boundary, ready to be seeded",
+	Example: "go run cmd/snapshots/generator/main.go segments --block 11000000 --chaindata /media/b00ris/nvme/tgstaged/tg/chaindata/ --output /media/b00ris/nvme/snapshots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return GenerateSegments(cmd.Context(), chaindata, outputDir, block)
+	},
+}
+
+// GenerateSegments produces the snapshots of the headers, bodies and state at the epoch boundary block, so that
+// the snapshots of the nodes generating them independently are identical. The snapshots are made read only, and
+// their info hashes are printed to be published with the release
+func GenerateSegments(ctx context.Context, dbPath, outputDir string, toBlock uint64) error {
+	if !snapshotsync.IsEpochBlock(toBlock) {
+		return fmt.Errorf("block %d is not at the epoch boundary, the closest one is %d", toBlock, snapshotsync.EpochBlock(toBlock))
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	generators := []struct {
+		tp       snapshotsync.SnapshotType
+		generate func(ctx context.Context, dbPath, snapshotPath string, toBlock uint64, snapshotDir string, snapshotMode string) error
+	}{
+		{snapshotsync.SnapshotType_headers, HeaderSnapshot},
+		{snapshotsync.SnapshotType_bodies, BodySnapshot},
+		{snapshotsync.SnapshotType_state, GenerateStateSnapshot},
+	}
+	for _, g := range generators {
+		path := snapshotsync.SegmentPath(outputDir, g.tp)
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s snapshot already exists in %s", g.tp, path)
+		}
+		log.Info("Generating snapshot", "type", g.tp, "block", toBlock, "path", path)
+		if err := g.generate(ctx, dbPath, path, toBlock, "", ""); err != nil {
+			return fmt.Errorf("generating %s snapshot: %w", g.tp, err)
+		}
+		if err := snapshotsync.MakeImmutable(path); err != nil {
+			return err
+		}
+
+		info, err := trnt.BuildInfoBytesForLMDBSnapshot(path)
+		if err != nil {
+			return err
+		}
+		mi := &metainfo.MetaInfo{}
+		if mi.InfoBytes, err = bencode.Marshal(info); err != nil {
+			return err
+		}
+		log.Info("Snapshot generated", "type", g.tp, "block", toBlock, "infohash", mi.HashInfoBytes().String())
+	}
+	return nil
+}
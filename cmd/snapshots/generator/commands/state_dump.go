@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/snapshotsync"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dumpDir   string
+	chunkSize uint64
+)
+
+func init() {
+	withChaindata(stateExportCmd)
+	withBlock(stateExportCmd)
+	stateExportCmd.Flags().StringVar(&dumpDir, "dump", "statedump", "directory where the chunks of the state dump and its manifest are written to")
+	stateExportCmd.Flags().Uint64Var(&chunkSize, "chunkSize", snapshotsync.DefaultDumpChunkSize, "size of the chunk files in bytes")
+	rootCmd.AddCommand(stateExportCmd)
+
+	withChaindata(stateImportCmd)
+	stateImportCmd.Flags().StringVar(&dumpDir, "dump", "statedump", "directory of the state dump")
+	rootCmd.AddCommand(stateImportCmd)
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:     "state_export",
+	Short:   "Export the state at the block into the chunked dump, verified against the state root of the block",
+	Example: "go run cmd/snapshots/generator/main.go state_export --block 11000000 --chaindata /media/b00ris/nvme/tgstaged/tg/chaindata/ --dump /media/b00ris/nvme/statedump",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := ethdb.MustOpen(chaindata)
+		defer db.Close()
+		m, err := snapshotsync.ExportState(cmd.Context(), db, block, dumpDir, chunkSize)
+		if err != nil {
+			return err
+		}
+		if err = snapshotsync.VerifyStateDump(cmd.Context(), dumpDir, m.StateRoot, os.TempDir()); err != nil {
+			return err
+		}
+		log.Info("State dump verified", "dir", dumpDir, "root", m.StateRoot)
+		return nil
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:     "state_import",
+	Short:   "Import the state dump into the database which has the headers, but no state yet",
+	Example: "go run cmd/snapshots/generator/main.go state_import --chaindata /media/b00ris/nvme/tgstaged/tg/chaindata/ --dump /media/b00ris/nvme/statedump",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := ethdb.MustOpen(chaindata)
+		defer db.Close()
+		return snapshotsync.ImportState(cmd.Context(), db, dumpDir, os.TempDir())
+	},
+}
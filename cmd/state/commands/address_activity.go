@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fromBlock   uint64
+	activityCsv string
+	tmpdir      string
+)
+
+func init() {
+	withChaindata(addressActivityCmd)
+	addressActivityCmd.Flags().Uint64Var(&fromBlock, "from", 1, "first block of the analysed range")
+	addressActivityCmd.Flags().Uint64Var(&block, "to", 0, "last block of the analysed range, 0 for the latest executed block")
+	addressActivityCmd.Flags().IntVar(&top, "top", 100, "number of the most active addresses to report")
+	addressActivityCmd.Flags().StringVar(&activityCsv, "csv", "", "path where to write the activity of all the changed addresses, empty string means not to write it")
+	must(addressActivityCmd.MarkFlagFilename("csv", "csv"))
+	addressActivityCmd.Flags().StringVar(&tmpdir, "tmpdir", os.TempDir(), "directory for the temporary files sorting the changes")
+	rootCmd.AddCommand(addressActivityCmd)
+}
+
+var addressActivityCmd = &cobra.Command{
+	Use:   "addressActivity",
+	Short: "Addresses changed the most over a block range, from the account and storage changesets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stats.AddressActivityStats(rootContext(), chaindata, fromBlock, block, top, activityCsv, tmpdir)
+	},
+}
@@ -1,24 +1,22 @@
 package commands
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"os/signal"
-	"sort"
+	"runtime"
 	"syscall"
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
-	"github.com/ledgerwatch/turbo-geth/common/changeset"
-	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -29,6 +27,7 @@ var (
 	historyfile   string
 	nocheck       bool
 	writeReceipts bool
+	workers       int
 )
 
 func init() {
@@ -37,6 +36,7 @@ func init() {
 	checkChangeSetsCmd.Flags().StringVar(&historyfile, "historyfile", "", "path to the file where the changesets and history are expected to be. If omitted, the same as --chaindata")
 	checkChangeSetsCmd.Flags().BoolVar(&nocheck, "nocheck", false, "set to turn off the changeset checking and only execute transaction (for performance testing)")
 	checkChangeSetsCmd.Flags().BoolVar(&writeReceipts, "writeReceipts", false, "set to turn on writing receipts as the execution ongoing")
+	checkChangeSetsCmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "number of the goroutines re-executing the blocks in parallel, only without --nocheck and --writeReceipts")
 	rootCmd.AddCommand(checkChangeSetsCmd)
 }
 
@@ -44,10 +44,67 @@ var checkChangeSetsCmd = &cobra.Command{
 	Use:   "checkChangeSets",
 	Short: "Re-executes historical transactions in read-only mode and checks that their outputs match the database ChangeSets",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if !nocheck && !writeReceipts {
+			return CheckChangeSetsParallel(genesis, block, chaindata, historyfile, workers)
+		}
 		return CheckChangeSets(genesis, block, chaindata, historyfile, nocheck, writeReceipts)
 	},
 }
 
+// CheckChangeSetsParallel re-executes historical transactions in read-only mode, up to the executed and indexed block,
+// in the workers running in parallel, and checks that their outputs match the database ChangeSets.
+func CheckChangeSetsParallel(genesis *core.Genesis, blockNum uint64, chaindata string, historyfile string, workers int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			fmt.Println("interrupted, please wait for cleanup...")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	startTime := time.Now()
+	chainDb := ethdb.MustOpen(chaindata)
+	defer chainDb.Close()
+	cfg := integrity.ChangeSetsConfig{ChainConfig: genesis.Config, Workers: workers}
+	if len(historyfile) != 0 && historyfile != chaindata {
+		historyDb := ethdb.MustOpen(historyfile)
+		defer historyDb.Close()
+		cfg.History = historyDb
+	}
+
+	to, err := stages.GetStageProgress(chainDb, stages.Execution)
+	if err != nil {
+		return err
+	}
+	for _, stage := range []stages.SyncStage{stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		progress, err := stages.GetStageProgress(chainDb, stage)
+		if err != nil {
+			return err
+		}
+		if progress < to {
+			to = progress
+		}
+	}
+	diffs, err := integrity.CheckChangeSets(ctx, chainDb, cfg, blockNum, to)
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Println(diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("check change set failed: %d differences", len(diffs))
+	}
+	log.Info("Checked", "blocks", fmt.Sprintf("%d-%d", blockNum, to), "workers", workers, "next time specify --block", to+1, "duration", time.Since(startTime))
+	return nil
+}
+
 // CheckChangeSets re-executes historical transactions in read-only mode
 // and checks that their outputs match the database ChangeSets.
 func CheckChangeSets(genesis *core.Genesis, blockNum uint64, chaindata string, historyfile string, nocheck bool, writeReceipts bool) error {
@@ -147,61 +204,16 @@ func CheckChangeSets(genesis *core.Genesis, blockNum uint64, chaindata string, h
 		}
 
 		if !nocheck {
-			accountChanges, err := csw.GetAccountChanges()
+			diffs, err := integrity.DiffChangeSets(historyTx, blockNum, csw)
 			if err != nil {
 				return err
 			}
-			sort.Sort(accountChanges)
-			i := 0
-			match := true
-			err = changeset.Walk(historyDb, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(blockN uint64, k, v []byte) (bool, error) {
-				c := accountChanges.Changes[i]
-				if bytes.Equal(c.Key, k) && bytes.Equal(c.Value, v) {
-					i++
-					return true, nil
+			if len(diffs) > 0 {
+				for _, diff := range diffs {
+					fmt.Println(diff)
 				}
-
-				match = false
-				fmt.Printf("Unexpected account changes in block %d\n", blockNum)
-				fmt.Printf("In the database: ======================\n")
-				fmt.Printf("%d: 0x%x: %x\n", i, k, v)
-				fmt.Printf("Expected: ==========================\n")
-				fmt.Printf("%d: 0x%x %x\n", i, c.Key, c.Value)
-				return false, nil
-			})
-			if err != nil {
-				return err
-			}
-
-			if !match {
 				return fmt.Errorf("check change set failed")
 			}
-
-			i = 0
-			expectedStorageChanges, err := csw.GetStorageChanges()
-			if err != nil {
-				return err
-			}
-			if expectedStorageChanges == nil {
-				expectedStorageChanges = changeset.NewChangeSet()
-			}
-			sort.Sort(expectedStorageChanges)
-			err = changeset.Walk(historyDb, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(blockN uint64, k, v []byte) (bool, error) {
-				c := expectedStorageChanges.Changes[i]
-				i++
-				if bytes.Equal(c.Key, k) && bytes.Equal(c.Value, v) {
-					return false, nil
-				}
-
-				fmt.Printf("Unexpected storage changes in block %d\nIn the database: ======================\n", blockNum)
-				fmt.Printf("0x%x: %x\n", k, v)
-				fmt.Printf("Expected: ==========================\n")
-				fmt.Printf("0x%x %x\n", c.Key, c.Value)
-				return true, fmt.Errorf("check change set failed")
-			})
-			if err != nil {
-				return err
-			}
 		}
 
 		blockNum++
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stats"
+	"github.com/spf13/cobra"
+)
+
+var contractsCsv string
+
+func init() {
+	withChaindata(contractStatsCmd)
+	contractStatsCmd.Flags().IntVar(&top, "top", 100, "number of the contracts with the largest storage to report")
+	contractStatsCmd.Flags().StringVar(&contractsCsv, "csv", "", "path where to write the stats of all the contracts, empty string means not to write them")
+	must(contractStatsCmd.MarkFlagFilename("csv", "csv"))
+	contractStatsCmd.Flags().StringVar(&tmpdir, "tmpdir", os.TempDir(), "directory for the temporary files sorting the contracts")
+	rootCmd.AddCommand(contractStatsCmd)
+}
+
+var contractStatsCmd = &cobra.Command{
+	Use:   "contractStats",
+	Short: "Storage slots, storage size, code size and last modification of the contracts in the latest state",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stats.ContractStats(rootContext(), chaindata, top, contractsCsv, tmpdir)
+	},
+}
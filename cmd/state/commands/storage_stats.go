@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stats"
+	"github.com/spf13/cobra"
+)
+
+var top int
+
+func init() {
+	withChaindata(storageStatsCmd)
+	storageStatsCmd.Flags().Uint64Var(&block, "block", 0, "state after this block is analysed, 0 for the latest state")
+	storageStatsCmd.Flags().IntVar(&top, "top", 100, "number of the largest values and the biggest accounts to report")
+	rootCmd.AddCommand(storageStatsCmd)
+}
+
+var storageStatsCmd = &cobra.Command{
+	Use:   "storageStats",
+	Short: "Largest storage values and accounts with the most storage slots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stats.StorageStats(rootContext(), chaindata, block, top)
+	},
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/tracetest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	traceTxs     []string
+	traceTracers []string
+	tracesDir    string
+)
+
+func init() {
+	withChaindata(recordTracesCmd)
+	recordTracesCmd.Flags().StringSliceVar(&traceTxs, "txs", nil, "hashes of the transactions to record")
+	recordTracesCmd.Flags().StringSliceVar(&traceTracers, "tracers", tracetest.DefaultTracers, "tracers to record the golden traces of, "+tracetest.StructLogger+" is the default struct logger")
+	recordTracesCmd.Flags().StringVar(&tracesDir, "dir", "testdata", "directory the fixtures are written to")
+	must(recordTracesCmd.MarkFlagRequired("txs"))
+	rootCmd.AddCommand(recordTracesCmd)
+
+	checkTracesCmd.Flags().StringVar(&tracesDir, "dir", "testdata", "directory of the recorded fixtures")
+	rootCmd.AddCommand(checkTracesCmd)
+}
+
+var recordTracesCmd = &cobra.Command{
+	Use:   "recordTraces",
+	Short: "Record transactions with their golden traces, to be replayed by checkTraces or by the golden tests",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db := ethdb.MustOpen(chaindata)
+		defer db.Close()
+		if err := os.MkdirAll(tracesDir, 0755); err != nil {
+			return err
+		}
+		for _, hash := range traceTxs {
+			f, err := tracetest.RecordFromDB(rootContext(), db, common.HexToHash(hash), traceTracers)
+			if err != nil {
+				return fmt.Errorf("recording %s: %w", hash, err)
+			}
+			path := filepath.Join(tracesDir, f.Hash()+".json")
+			if err = tracetest.WriteFixture(path, f); err != nil {
+				return err
+			}
+			log.Info("Recorded", "tx", f.Hash(), "path", path)
+		}
+		return nil
+	},
+}
+
+var checkTracesCmd = &cobra.Command{
+	Use:   "checkTraces",
+	Short: "Replay the recorded transactions through the tracers and compare the traces with the golden ones",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		paths, err := tracetest.FixturePaths(tracesDir)
+		if err != nil {
+			return err
+		}
+		var failed int
+		for _, path := range paths {
+			f, err := tracetest.ReadFixture(path)
+			if err != nil {
+				return err
+			}
+			diffs, err := f.Check(rootContext())
+			if err != nil {
+				return fmt.Errorf("replaying %s: %w", path, err)
+			}
+			if len(diffs) > 0 {
+				failed++
+				log.Error("Traces differ from the golden ones", "tx", f.Hash(), "path", path, "diffs", "\n"+strings.Join(diffs, "\n"))
+				continue
+			}
+			log.Info("Traces match", "tx", f.Hash(), "tracers", strings.Join(f.Tracers(), ","))
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d transactions differ from the golden traces", failed, len(paths))
+		}
+		log.Info("All traces match", "transactions", len(paths))
+		return nil
+	},
+}
@@ -0,0 +1,220 @@
+package stats
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// AddressActivity is the number of the changes of an account and of its storage over a range of blocks
+type AddressActivity struct {
+	Address        common.Address
+	Blocks         uint64 // number of the blocks changing the account or its storage
+	AccountChanges uint64
+	StorageChanges uint64 // number of the changed storage slots, summed over the blocks
+}
+
+// Changes is the total number of the changes of the account and of its storage
+func (a *AddressActivity) Changes() uint64 {
+	return a.AccountChanges + a.StorageChanges
+}
+
+// ActivityReport summarises the changes of the state over a range of blocks
+type ActivityReport struct {
+	Addresses      uint64            // number of the changed addresses
+	AccountChanges uint64            // number of the account changes
+	StorageChanges uint64            // number of the storage changes
+	Top            []AddressActivity // most active addresses, ordered by the number of the changes descending
+}
+
+const (
+	accountChange byte = iota
+	storageChange
+)
+
+// activityHeap is a min-heap of the addresses by the number of the changes
+type activityHeap []AddressActivity
+
+func (h activityHeap) Len() int { return len(h) }
+func (h activityHeap) Less(i, j int) bool {
+	if h[i].Changes() != h[j].Changes() {
+		return h[i].Changes() < h[j].Changes()
+	}
+	return bytes.Compare(h[i].Address[:], h[j].Address[:]) > 0
+}
+func (h activityHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *activityHeap) Push(x interface{}) { *h = append(*h, x.(AddressActivity)) }
+func (h *activityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// CollectAddressActivity counts the changes of every address in the account and storage changesets of the
+// blocks from..to (inclusive) and keeps the top most active addresses. The changes are sorted by the address
+// through the ETL collector spilling to tmpdir, so the memory use doesn't depend on the number of the addresses.
+// If csvOut is not nil, the activity of all the changed addresses is written into it, ordered by the address.
+func CollectAddressActivity(ctx context.Context, db ethdb.Database, from, to uint64, top int, tmpdir string, csvOut io.Writer) (*ActivityReport, error) {
+	if top < 1 {
+		return nil, fmt.Errorf("number of the top addresses must be positive, got %d", top)
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range %d-%d", from, to)
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	collector := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		kind := []byte{accountChange}
+		if bucket == dbutils.PlainStorageChangeSetBucket {
+			kind = []byte{storageChange}
+		}
+		fromDBFormat := changeset.FromDBFormat(changeset.Mapper[bucket].KeySize)
+		// The key of the collector is {address}{block number}, the changes of an address come together and by the block
+		key := make([]byte, common.AddressLength+8)
+		if err := db.Walk(bucket, dbutils.EncodeBlockNumber(from), 0, func(dbKey, dbValue []byte) (bool, error) {
+			if err := common.Stopped(ctx.Done()); err != nil {
+				return false, err
+			}
+			blockNum, k, _ := fromDBFormat(dbKey, dbValue)
+			if blockNum > to {
+				return false, nil
+			}
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("Collecting address activity", "bucket", bucket, "block", blockNum)
+			}
+			copy(key, k[:common.AddressLength])
+			binary.BigEndian.PutUint64(key[common.AddressLength:], blockNum)
+			return true, collector.Collect(key, kind)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		report    ActivityReport
+		most      = make(activityHeap, 0, top+1)
+		current   AddressActivity
+		lastBlock uint64
+		csvWriter *csv.Writer
+	)
+	if csvOut != nil {
+		csvWriter = csv.NewWriter(csvOut)
+		if err := csvWriter.Write([]string{"address", "blocks", "account_changes", "storage_changes"}); err != nil {
+			return nil, err
+		}
+	}
+	flush := func() error {
+		if current.Blocks == 0 {
+			return nil
+		}
+		report.Addresses++
+		heap.Push(&most, current)
+		if most.Len() > top {
+			heap.Pop(&most)
+		}
+		if csvWriter == nil {
+			return nil
+		}
+		return csvWriter.Write([]string{
+			current.Address.Hex(),
+			strconv.FormatUint(current.Blocks, 10),
+			strconv.FormatUint(current.AccountChanges, 10),
+			strconv.FormatUint(current.StorageChanges, 10),
+		})
+	}
+	if err := collector.Load("addressActivity", db, "" /* no bucket, only aggregating */, func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+		if current.Blocks == 0 || !bytes.Equal(k[:common.AddressLength], current.Address[:]) {
+			if err := flush(); err != nil {
+				return err
+			}
+			current = AddressActivity{Address: common.BytesToAddress(k[:common.AddressLength])}
+		}
+		if blockNum := binary.BigEndian.Uint64(k[common.AddressLength:]); current.Blocks == 0 || blockNum != lastBlock {
+			current.Blocks++
+			lastBlock = blockNum
+		}
+		if v[0] == accountChange {
+			current.AccountChanges++
+			report.AccountChanges++
+		} else {
+			current.StorageChanges++
+			report.StorageChanges++
+		}
+		return nil
+	}, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Top = make([]AddressActivity, most.Len())
+	for i := len(report.Top) - 1; i >= 0; i-- {
+		report.Top[i] = heap.Pop(&most).(AddressActivity)
+	}
+	return &report, nil
+}
+
+// AddressActivityStats prints the addresses changed the most in the blocks from..to, 0 as the last block
+// means the latest executed one. The activity of all the changed addresses is written into csvFile, if given
+func AddressActivityStats(ctx context.Context, chaindata string, from, to uint64, top int, csvFile string, tmpdir string) error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+	startTime := time.Now()
+
+	executed, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return err
+	}
+	if to == 0 || to > executed {
+		to = executed
+	}
+
+	var csvOut io.Writer
+	if csvFile != "" {
+		f, err := os.Create(csvFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint
+		csvOut = f
+	}
+	report, err := CollectAddressActivity(ctx, db, from, to, top, tmpdir, csvOut)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Blocks %d-%d: %d addresses, %d account changes, %d storage changes, took %s\n", from, to, report.Addresses, report.AccountChanges, report.StorageChanges, time.Since(startTime))
+	fmt.Printf("\nMost active addresses:\n")
+	for _, a := range report.Top {
+		fmt.Printf("%x %d changes (%d account, %d storage) in %d blocks\n", a.Address, a.Changes(), a.AccountChanges, a.StorageChanges, a.Blocks)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectAddressActivity(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+
+	var (
+		busy     = common.HexToAddress("0x0a")
+		contract = common.HexToAddress("0x0b")
+		once     = common.HexToAddress("0x0c")
+		late     = common.HexToAddress("0x0d")
+	)
+	for blockNum := uint64(1); blockNum <= 4; blockNum++ {
+		ibs := state.New(state.NewPlainStateReader(db))
+		ibs.AddBalance(busy, uint256.NewInt().SetUint64(1))
+		switch blockNum {
+		case 1:
+			ibs.CreateAccount(contract, true)
+			ibs.SetCode(contract, []byte{0x00})
+			ibs.AddBalance(once, uint256.NewInt().SetUint64(1))
+		case 2:
+			for i := byte(1); i <= 3; i++ {
+				ibs.SetState(contract, &common.Hash{i}, *uint256.NewInt().SetUint64(uint64(i)))
+			}
+		case 4:
+			ibs.AddBalance(late, uint256.NewInt().SetUint64(1))
+		}
+		w := state.NewPlainStateWriter(db, db, blockNum)
+		require.NoError(t, ibs.CommitBlock(ctx, w))
+		require.NoError(t, w.WriteChangeSets())
+	}
+
+	var csvOut bytes.Buffer
+	report, err := CollectAddressActivity(ctx, db, 1, 3, 2, t.TempDir(), &csvOut)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), report.Addresses)
+	assert.Equal(t, uint64(3+2+1), report.AccountChanges) // the storage changes touch the account too
+	assert.Equal(t, uint64(3), report.StorageChanges)
+	assert.Equal(t, []AddressActivity{
+		{Address: contract, Blocks: 2, AccountChanges: 2, StorageChanges: 3},
+		{Address: busy, Blocks: 3, AccountChanges: 3},
+	}, report.Top)
+
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "address,blocks,account_changes,storage_changes", lines[0])
+	assert.Equal(t, busy.Hex()+",3,3,0", lines[1])
+	assert.Equal(t, once.Hex()+",1,1,0", lines[3])
+
+	_, err = CollectAddressActivity(ctx, db, 3, 2, 2, t.TempDir(), nil)
+	assert.Error(t, err)
+}
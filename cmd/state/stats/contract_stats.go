@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/eth/stateanalysis"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// ContractStats prints the contracts with the largest storage in the latest state. The stats of all the contracts
+// are written into csvFile, if given, ordered by the storage size descending
+func ContractStats(ctx context.Context, chaindata string, top int, csvFile string, tmpdir string) error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+	startTime := time.Now()
+
+	var walker func(stats *stateanalysis.ContractStats) error
+	var csvWriter *csv.Writer
+	if csvFile != "" {
+		f, err := os.Create(csvFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint
+		csvWriter = csv.NewWriter(f)
+		if err = csvWriter.Write([]string{"address", "incarnation", "slots", "storage_bytes", "code_size", "last_modified"}); err != nil {
+			return err
+		}
+		walker = func(stats *stateanalysis.ContractStats) error {
+			return csvWriter.Write([]string{
+				stats.Address.Hex(),
+				strconv.FormatUint(stats.Incarnation, 10),
+				strconv.FormatUint(stats.Slots, 10),
+				strconv.FormatUint(stats.StorageBytes, 10),
+				strconv.FormatUint(stats.CodeSize, 10),
+				strconv.FormatUint(stats.LastModified, 10),
+			})
+		}
+	}
+	report, err := stateanalysis.CollectContracts(ctx, db, top, tmpdir, walker)
+	if err != nil {
+		return err
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err = csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Contracts at block %d: %d contracts, %d slots, %d bytes of storage values, %d bytes of code, took %s\n", report.Block, report.Contracts, report.Slots, report.StorageBytes, report.CodeBytes, time.Since(startTime))
+	fmt.Printf("\nContracts with the largest storage:\n")
+	for _, c := range report.Top {
+		fmt.Printf("%x %d slots, %d bytes of storage, %d bytes of code, last modified at block %d\n", c.Address, c.Slots, c.StorageBytes, c.CodeSize, c.LastModified)
+	}
+	return nil
+}
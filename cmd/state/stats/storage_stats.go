@@ -0,0 +1,260 @@
+package stats
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// StorageItem is a non-empty storage slot of a contract
+type StorageItem struct {
+	Address     common.Address
+	Incarnation uint64
+	Location    common.Hash
+	Value       []byte // without leading zeroes, as stored in the database
+}
+
+// AccountSlots is the number of non-empty storage slots of a contract
+type AccountSlots struct {
+	Address common.Address
+	Slots   uint64
+}
+
+// StorageReport summarises the storage of all the contracts in the state
+type StorageReport struct {
+	Accounts  uint64         // number of the accounts with non-empty storage
+	Slots     uint64         // number of the non-empty storage slots
+	Bytes     uint64         // total size of the storage values
+	Largest   []StorageItem  // largest storage values, ordered by the size descending
+	MostSlots []AccountSlots // accounts with the most slots, ordered by the number of slots descending
+}
+
+// WalkStorage calls walker for every non-empty storage slot of the current incarnations of the
+// contracts in the state after the given block, ordered by the address and the location.
+// The latest state is read straight from the plain state, older states are reconstructed from history.
+// The item passed to the walker is reused, it must be copied to be retained.
+func WalkStorage(tx ethdb.Tx, block uint64, latest bool, walker func(item *StorageItem) (bool, error)) error {
+	if latest {
+		return walkLatestStorage(tx, walker)
+	}
+	var item StorageItem
+	return state.WalkAsOfAccounts(tx, common.Address{}, block+1, func(k, v []byte) (bool, error) {
+		incarnation, err := accounts.StorageView(v).Incarnation()
+		if err != nil {
+			return false, fmt.Errorf("decoding account %x: %w", k, err)
+		}
+		if incarnation == 0 {
+			return true, nil
+		}
+		goOn := true
+		copy(item.Address[:], k)
+		item.Incarnation = incarnation
+		if err := state.WalkAsOfStorage(tx, item.Address, incarnation, common.Hash{}, block+1, func(_, loc, vs []byte) (bool, error) {
+			if len(vs) == 0 {
+				return true, nil
+			}
+			copy(item.Location[:], loc)
+			item.Value = vs
+			var err error
+			goOn, err = walker(&item)
+			return goOn, err
+		}); err != nil {
+			return false, err
+		}
+		return goOn, nil
+	})
+}
+
+func walkLatestStorage(tx ethdb.Tx, walker func(item *StorageItem) (bool, error)) error {
+	c := tx.Cursor(dbutils.PlainStateBucket)
+	defer c.Close()
+	var item StorageItem
+	// Storage of the old incarnations can still be in the plain state, the keys of the
+	// storage go right after the key of its account, so the account is always seen first
+	var incarnation uint64
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if len(k) == common.AddressLength {
+			var acc accounts.Account
+			if err = acc.DecodeForStorage(v); err != nil {
+				return fmt.Errorf("decoding account %x: %w", k, err)
+			}
+			copy(item.Address[:], k)
+			incarnation = acc.Incarnation
+			continue
+		}
+		if len(v) == 0 || !bytes.Equal(k[:common.AddressLength], item.Address[:]) {
+			continue
+		}
+		if item.Incarnation = binary.BigEndian.Uint64(k[common.AddressLength:]); item.Incarnation != incarnation {
+			continue
+		}
+		copy(item.Location[:], k[common.AddressLength+common.IncarnationLength:])
+		item.Value = v
+		goOn, err := walker(&item)
+		if err != nil || !goOn {
+			return err
+		}
+	}
+	return nil
+}
+
+// itemHeap is a min-heap of the storage items by the size of the value
+type itemHeap []StorageItem
+
+func (h itemHeap) Len() int { return len(h) }
+func (h itemHeap) Less(i, j int) bool {
+	if len(h[i].Value) != len(h[j].Value) {
+		return len(h[i].Value) < len(h[j].Value)
+	}
+	// Of the values of the same size, the ones with the lower keys are kept
+	if c := bytes.Compare(h[i].Address[:], h[j].Address[:]); c != 0 {
+		return c > 0
+	}
+	return bytes.Compare(h[i].Location[:], h[j].Location[:]) > 0
+}
+func (h itemHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x interface{}) { *h = append(*h, x.(StorageItem)) }
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// slotsHeap is a min-heap of the accounts by the number of storage slots
+type slotsHeap []AccountSlots
+
+func (h slotsHeap) Len() int { return len(h) }
+func (h slotsHeap) Less(i, j int) bool {
+	if h[i].Slots != h[j].Slots {
+		return h[i].Slots < h[j].Slots
+	}
+	return bytes.Compare(h[i].Address[:], h[j].Address[:]) > 0
+}
+func (h slotsHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slotsHeap) Push(x interface{}) { *h = append(*h, x.(AccountSlots)) }
+func (h *slotsHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// CollectStorageStats walks the storage of the state after the given block and keeps the top
+// largest values and the top accounts with the most slots, so only O(top) items are held in memory
+func CollectStorageStats(ctx context.Context, tx ethdb.Tx, block uint64, latest bool, top int) (*StorageReport, error) {
+	if top < 1 {
+		return nil, fmt.Errorf("number of the top items must be positive, got %d", top)
+	}
+	var (
+		report  StorageReport
+		largest = make(itemHeap, 0, top+1)
+		most    = make(slotsHeap, 0, top+1)
+		current AccountSlots
+		logger  = time.NewTicker(30 * time.Second)
+	)
+	defer logger.Stop()
+	flush := func() {
+		if current.Slots == 0 {
+			return
+		}
+		report.Accounts++
+		heap.Push(&most, current)
+		if most.Len() > top {
+			heap.Pop(&most)
+		}
+	}
+	if err := WalkStorage(tx, block, latest, func(item *StorageItem) (bool, error) {
+		select {
+		default:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-logger.C:
+			log.Info("Collecting storage stats", "address", fmt.Sprintf("%x", item.Address), "accounts", report.Accounts, "slots", report.Slots)
+		}
+		if item.Address != current.Address {
+			flush()
+			current = AccountSlots{Address: item.Address}
+		}
+		current.Slots++
+		report.Slots++
+		report.Bytes += uint64(len(item.Value))
+		if largest.Len() < top || len(item.Value) > len(largest[0].Value) {
+			cpy := *item
+			cpy.Value = common.CopyBytes(item.Value)
+			heap.Push(&largest, cpy)
+			if largest.Len() > top {
+				heap.Pop(&largest)
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	flush()
+
+	report.Largest = make([]StorageItem, largest.Len())
+	for i := len(report.Largest) - 1; i >= 0; i-- {
+		report.Largest[i] = heap.Pop(&largest).(StorageItem)
+	}
+	report.MostSlots = make([]AccountSlots, most.Len())
+	for i := len(report.MostSlots) - 1; i >= 0; i-- {
+		report.MostSlots[i] = heap.Pop(&most).(AccountSlots)
+	}
+	return &report, nil
+}
+
+// StorageStats prints the largest storage values and the accounts with the most storage slots
+// in the state after the given block, 0 means the latest state
+func StorageStats(ctx context.Context, chaindata string, block uint64, top int) error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+	startTime := time.Now()
+
+	executed, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return err
+	}
+	if block > executed {
+		return fmt.Errorf("block %d is not executed yet, the latest executed block is %d", block, executed)
+	}
+	latest := block == 0 || block == executed
+	if latest {
+		block = executed
+	}
+
+	var report *StorageReport
+	if err = db.KV().View(ctx, func(tx ethdb.Tx) error {
+		report, err = CollectStorageStats(ctx, tx, block, latest, top)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("Storage at block %d: %d accounts, %d slots, %d bytes of values, took %s\n", block, report.Accounts, report.Slots, report.Bytes, time.Since(startTime))
+	fmt.Printf("\nLargest storage values:\n")
+	for _, item := range report.Largest {
+		fmt.Printf("%x %x %d bytes\n", item.Address, item.Location, len(item.Value))
+	}
+	fmt.Printf("\nAccounts with the most storage slots:\n")
+	for _, acc := range report.MostSlots {
+		fmt.Printf("%x %d slots\n", acc.Address, acc.Slots)
+	}
+	return nil
+}
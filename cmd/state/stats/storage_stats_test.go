@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectStorageStats(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+
+	var (
+		small  = common.HexToAddress("0x0a")
+		big    = common.HexToAddress("0x0b")
+		wide   = common.HexToAddress("0x0c")
+		wiped  = common.HexToAddress("0x0d")
+		noCode = common.HexToAddress("0x0e")
+	)
+	ibs := state.New(state.NewPlainStateReader(db))
+	for _, addr := range []common.Address{small, big, wide, wiped} {
+		ibs.CreateAccount(addr, true)
+		ibs.SetCode(addr, []byte{0x00})
+	}
+	ibs.AddBalance(noCode, uint256.NewInt().SetUint64(1))
+	ibs.SetState(small, &common.Hash{0x01}, *uint256.NewInt().SetUint64(1))
+	ibs.SetState(big, &common.Hash{0x01}, *uint256.NewInt().SetBytes(common.FromHex("0xffffffffffffffffffffffffffffffff")))
+	for i := byte(1); i <= 3; i++ {
+		ibs.SetState(wide, &common.Hash{i}, *uint256.NewInt().SetUint64(0x1234))
+	}
+	ibs.SetState(wiped, &common.Hash{0x01}, *uint256.NewInt().SetUint64(0xffffffff))
+	require.NoError(t, ibs.CommitBlock(ctx, state.NewPlainStateWriter(db, db, 1)))
+
+	// The storage of the self-destructed contract doesn't count
+	ibs = state.New(state.NewPlainStateReader(db))
+	ibs.Suicide(wiped)
+	require.NoError(t, ibs.CommitBlock(ctx, state.NewPlainStateWriter(db, db, 2)))
+
+	var report *StorageReport
+	require.NoError(t, db.KV().View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		report, err = CollectStorageStats(ctx, tx, 2, true, 2)
+		return err
+	}))
+	assert.Equal(t, uint64(3), report.Accounts)
+	assert.Equal(t, uint64(5), report.Slots)
+	assert.Equal(t, uint64(1+16+2*3), report.Bytes)
+
+	require.Len(t, report.Largest, 2)
+	assert.Equal(t, big, report.Largest[0].Address)
+	assert.Equal(t, 16, len(report.Largest[0].Value))
+	assert.Equal(t, wide, report.Largest[1].Address)
+	assert.Equal(t, common.Hash{0x01}, report.Largest[1].Location)
+
+	assert.Equal(t, []AccountSlots{{Address: wide, Slots: 3}, {Address: small, Slots: 1}}, report.MostSlots)
+}
@@ -4,14 +4,27 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"unsafe"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/codecache"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/archive"
 	turbocli "github.com/ledgerwatch/turbo-geth/turbo/cli"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+	"github.com/ledgerwatch/turbo-geth/turbo/execproof"
 	"github.com/ledgerwatch/turbo-geth/turbo/node"
+	"github.com/ledgerwatch/turbo-geth/turbo/segments"
 	"github.com/ledgerwatch/turbo-geth/turbo/silkworm"
+	"github.com/ledgerwatch/turbo-geth/turbo/slotwatch"
 	"github.com/urfave/cli"
 )
 
@@ -41,24 +54,117 @@ func runTurboGeth(cliCtx *cli.Context) {
 		}
 	}
 
+	var diffChecker *difftest.Checker
+	if t8nPath := cliCtx.String(turbocli.DiffT8nFlag.Name); t8nPath != "" {
+		diffChecker = difftest.NewChecker(&difftest.T8n{Path: t8nPath}, filepath.Join(cliCtx.GlobalString(utils.DataDirFlag.Name), "difftest"))
+	}
+
+	var executionProofs *execproof.Store
+	if dir := cliCtx.String(turbocli.ExecutionProofsFlag.Name); dir != "" {
+		var signers []common.Address
+		for _, signer := range strings.Split(cliCtx.String(turbocli.ExecutionProofSignersFlag.Name), ",") {
+			if signer = strings.TrimSpace(signer); signer == "" {
+				continue
+			}
+			if !common.IsHexAddress(signer) {
+				panic(fmt.Errorf("invalid signer of the execution proofs: %s", signer))
+			}
+			signers = append(signers, common.HexToAddress(signer))
+		}
+		var err error
+		if executionProofs, err = execproof.OpenStore(dir, signers); err != nil {
+			panic(fmt.Errorf("failed to open the execution proofs: %v", err))
+		}
+	}
+
+	var readCache *state.ReadCache
+	if size := cliCtx.Int(turbocli.StateReadCacheFlag.Name); size > 0 {
+		var err error
+		if readCache, err = state.NewReadCacheOfAccounts(size); err != nil {
+			panic(err)
+		}
+	}
+
+	var codeCacheSize datasize.ByteSize
+	if err := codeCacheSize.UnmarshalText([]byte(cliCtx.String(turbocli.CodeCacheSizeFlag.Name))); err != nil {
+		panic(fmt.Errorf("invalid %s: %v", turbocli.CodeCacheSizeFlag.Name, err))
+	}
+	codecache.Shared.SetSize(codeCacheSize)
+
+	var freezer *segments.Freezer
+	var ancients ethdb.AncientReader
+	if threshold := cliCtx.Uint64(turbocli.AncientThresholdFlag.Name); threshold > 0 {
+		store, err := segments.OpenStore(filepath.Join(cliCtx.GlobalString(utils.DataDirFlag.Name), "tg", "ancient"))
+		if err != nil {
+			panic(fmt.Errorf("failed to open the ancient segments: %v", err))
+		}
+		defer store.Close()
+		if freezer, err = segments.NewFreezer(store, threshold); err != nil {
+			panic(err)
+		}
+		ancients = store
+	}
+
+	var archiver *archive.Archiver
+	var changesets ethdb.ChangesetArchive
+	if url := cliCtx.String(turbocli.ChangesetsArchiveFlag.Name); url != "" {
+		store, err := archive.OpenStore(url)
+		if err != nil {
+			panic(fmt.Errorf("failed to open the changesets archive: %v", err))
+		}
+		var cacheSize datasize.ByteSize
+		if err = cacheSize.UnmarshalText([]byte(cliCtx.String(turbocli.ChangesetsArchiveCacheFlag.Name))); err != nil {
+			panic(fmt.Errorf("invalid %s: %v", turbocli.ChangesetsArchiveCacheFlag.Name, err))
+		}
+		reader, err := archive.NewReader(store, filepath.Join(cliCtx.GlobalString(utils.DataDirFlag.Name), "tg", "changesets-cache"), cacheSize, 0)
+		if err != nil {
+			panic(err)
+		}
+		defer reader.Close()
+		changesets = reader
+		if threshold := cliCtx.Uint64(turbocli.ChangesetsArchiveThresholdFlag.Name); threshold > 0 {
+			if archiver, err = archive.NewArchiver(store, threshold); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	retentions, err := stagedsync.ParseRetentions(cliCtx.String(turbocli.RetentionFlag.Name))
+	if err != nil {
+		panic(err)
+	}
+	if blocks := cliCtx.Uint64(turbocli.PruneReceiptsFlag.Name); blocks > 0 {
+		retentions = append(retentions, stagedsync.Retention{Bucket: dbutils.BlockReceiptsPrefix, Blocks: blocks}, stagedsync.Retention{Bucket: dbutils.Log, Blocks: blocks})
+	}
+
+	var slotWatcher *slotwatch.Watcher
+	if path := cliCtx.String(turbocli.SlotWatchConfigFlag.Name); path != "" {
+		watches, err := slotwatch.LoadWatches(path)
+		if err != nil {
+			panic(fmt.Errorf("failed to load the slot watches: %v", err))
+		}
+		slotWatcher = slotwatch.NewWatcher(watches, cliCtx.String(turbocli.SlotWatchWebhookFlag.Name))
+		defer slotWatcher.Close()
+	}
+
 	// creating staged sync with all default parameters
 	sync := stagedsync.New(
 		stagedsync.DefaultStages(),
 		stagedsync.DefaultUnwindOrder(),
-		stagedsync.OptionalParameters{SilkwormExecutionFunc: silkwormExecutionFunc},
+		stagedsync.OptionalParameters{SilkwormExecutionFunc: silkwormExecutionFunc, DiffChecker: diffChecker, ExecutionProofs: executionProofs, ReadCache: readCache, Prefetch: cliCtx.Bool(turbocli.StatePrefetchFlag.Name), ParallelWorkers: cliCtx.Int(turbocli.ExecutionParallelFlag.Name), Freezer: freezer, Archiver: archiver, Retentions: retentions, SlotWatcher: slotWatcher},
 	)
 
 	ctx := utils.RootContext()
 
 	// initializing the node and providing the current git commit there
 	log.Info("Build info", "git_branch", gitBranch, "git_commit", gitCommit)
-	tg := node.New(cliCtx, sync, node.Params{GitCommit: gitCommit, GitBranch: gitBranch})
+	tg := node.New(cliCtx, sync, node.Params{GitCommit: gitCommit, GitBranch: gitBranch, Ancients: ancients, Changesets: changesets})
 	tg.SetP2PListenFunc(func(network, addr string) (net.Listener, error) {
 		var lc net.ListenConfig
 		return lc.Listen(ctx, network, addr)
 	})
 	// running the node
-	err := tg.Serve()
+	err = tg.Serve()
 
 	if err != nil {
 		log.Error("error while serving a turbo-geth node", "err", err)
@@ -21,6 +21,7 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path"
@@ -39,6 +40,8 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/fdlimit"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/aura"
+	"github.com/ledgerwatch/turbo-geth/consensus/bor"
 	"github.com/ledgerwatch/turbo-geth/consensus/clique"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
@@ -111,11 +114,20 @@ var (
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
 	}
+	ShutdownTimeoutFlag = cli.DurationFlag{
+		Name:  "shutdown.timeout",
+		Usage: "Maximum time to wait for the sync stages and other services to stop and for the databases to close on shutdown (0 = wait indefinitely)",
+		Value: node.DefaultShutdownTimeout,
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Explicitly set network id (integer)(For testnets: use --ropsten, --rinkeby, --goerli instead)",
 		Value: ethconfig.Defaults.NetworkID,
 	}
+	ChainFlag = cli.StringFlag{
+		Name:  "chain",
+		Usage: "Name of the preset network to join: mainnet, ropsten, rinkeby, goerli, yolov3, bor-mainnet (Polygon) or mumbai (Polygon testnet)",
+	}
 	MainnetFlag = cli.BoolFlag{
 		Name:  "mainnet",
 		Usage: "Ethereum mainnet",
@@ -219,6 +231,18 @@ var (
 		Name:  "override.berlin",
 		Usage: "Manually specify Berlin fork-block, overriding the bundled setting",
 	}
+	OverrideLondonFlag = cli.Uint64Flag{
+		Name:  "override.london",
+		Usage: "Manually specify London fork-block, overriding the bundled setting",
+	}
+	OverrideEIPsFlag = cli.StringFlag{
+		Name:  "override.eips",
+		Usage: "Comma separated EIP activations out of the forks, in the form <eip>=<block> (supported: " + strings.Join(vm.ActivateableEips(), ", ") + ")",
+	}
+	OverrideConfigFlag = cli.StringFlag{
+		Name:  "override.config",
+		Usage: "JSON file with the fields of the chain config to override, e.g. {\"londonBlock\": 100}. Applied before the other overrides",
+	}
 	DownloadOnlyFlag = cli.BoolFlag{
 		Name:  "download-only",
 		Usage: "Run in download only mode - only fetch blocks but not process them",
@@ -227,6 +251,24 @@ var (
 		Name:  "debug-protocol",
 		Usage: "Enable the DBG (debug) protocol",
 	}
+	SnapServeFlag = cli.BoolFlag{
+		Name:  "snap.serve",
+		Usage: "Serve the state of the last block with intermediate hashes to the peers over the snap/1 protocol",
+	}
+	// Bor settings
+	HeimdallURLFlag = cli.StringFlag{
+		Name:  "bor.heimdall",
+		Usage: "URL of the Heimdall REST server the bor spans and state sync events are fetched from",
+		Value: ethconfig.Defaults.HeimdallURL,
+	}
+	WithoutHeimdallFlag = cli.BoolFlag{
+		Name:  "bor.withoutheimdall",
+		Usage: "Run bor without Heimdall, with the validators of the genesis (for the devnets)",
+	}
+	ExternalConsensusFlag = cli.StringFlag{
+		Name:  "consensus.external",
+		Usage: "Address of the gRPC server of the external consensus engine the consensus rules are delegated to",
+	}
 	// Ethash settings
 	EthashCachesInMemoryFlag = cli.IntFlag{
 		Name:  "ethash.cachesinmem",
@@ -255,10 +297,9 @@ var (
 		Name:  "txpool.nolocals",
 		Usage: "Disables price exemptions for locally submitted transactions",
 	}
-	TxPoolJournalFlag = cli.StringFlag{
+	TxPoolJournalFlag = cli.BoolTFlag{
 		Name:  "txpool.journal",
-		Usage: "Disk journal for local transaction to survive node restarts",
-		Value: core.DefaultTxPoolConfig.Journal,
+		Usage: "Journal local transactions in the database to survive node restarts (use --txpool.journal=false to disable)",
 	}
 	TxPoolRejournalFlag = cli.DurationFlag{
 		Name:  "txpool.rejournal",
@@ -295,6 +336,11 @@ var (
 		Usage: "Maximum number of non-executable transaction slots for all accounts",
 		Value: ethconfig.Defaults.TxPool.GlobalQueue,
 	}
+	TxPoolAccountQueueSizeFlag = cli.Uint64Flag{
+		Name:  "txpool.accountqueuesize",
+		Usage: "Maximum total size in bytes of non-executable transactions permitted per account",
+		Value: ethconfig.Defaults.TxPool.AccountQueueSize,
+	}
 	TxPoolLifetimeFlag = cli.DurationFlag{
 		Name:  "txpool.lifetime",
 		Usage: "Maximum amount of time non-executable transaction are queued",
@@ -672,7 +718,8 @@ var MetricFlags = []cli.Flag{MetricsEnabledFlag, MetricsEnabledExpensiveFlag, Me
 // then a subdirectory of the specified datadir will be used.
 func MakeDataDir(ctx *cli.Context) string {
 	if path := ctx.GlobalString(DataDirFlag.Name); path != "" {
-		if ctx.GlobalBool(RopstenFlag.Name) {
+		switch chain := ChainName(ctx); chain {
+		case params.RopstenChainName:
 			// Maintain compatibility with older Geth configurations storing the
 			// Ropsten database in `testnet` instead of `ropsten`.
 			legacyPath := filepath.Join(path, "testnet")
@@ -680,15 +727,10 @@ func MakeDataDir(ctx *cli.Context) string {
 				return legacyPath
 			}
 			return filepath.Join(path, "ropsten")
-		}
-		if ctx.GlobalBool(RinkebyFlag.Name) {
-			return filepath.Join(path, "rinkeby")
-		}
-		if ctx.GlobalBool(GoerliFlag.Name) {
-			return filepath.Join(path, "goerli")
-		}
-		if ctx.GlobalBool(YoloV3Flag.Name) {
+		case params.YoloV3ChainName:
 			return filepath.Join(path, "yolo-v3")
+		case params.RinkebyChainName, params.GoerliChainName, params.BorMainnetChainName, params.MumbaiChainName:
+			return filepath.Join(path, chain)
 		}
 		return path
 	}
@@ -734,21 +776,49 @@ func setNodeUserIdentCobra(f *pflag.FlagSet, cfg *node.Config) {
 	}
 }
 
+// ChainName returns the name of the preset network selected by --chain or by the flag of the network, e.g. --goerli,
+// it is empty if none is selected
+func ChainName(ctx *cli.Context) string {
+	if ctx.GlobalIsSet(ChainFlag.Name) {
+		return ctx.GlobalString(ChainFlag.Name)
+	}
+	for _, flag := range []cli.BoolFlag{MainnetFlag, RopstenFlag, RinkebyFlag, GoerliFlag, YoloV3Flag} {
+		if ctx.GlobalBool(flag.Name) {
+			return flag.Name
+		}
+	}
+	return ""
+}
+
+// bootnodes returns the bootstrap nodes of the preset network, the mainnet ones by default
+func bootnodes(chain string) []string {
+	switch chain {
+	case params.RopstenChainName:
+		return params.RopstenBootnodes
+	case params.RinkebyChainName:
+		return params.RinkebyBootnodes
+	case params.GoerliChainName:
+		return params.GoerliBootnodes
+	case params.YoloV3ChainName:
+		return params.YoloV3Bootnodes
+	case params.BorMainnetChainName:
+		return params.BorMainnetBootnodes
+	case params.MumbaiChainName:
+		return params.MumbaiBootnodes
+	default:
+		return params.MainnetBootnodes
+	}
+}
+
 // setBootstrapNodes creates a list of bootstrap nodes from the command line
 // flags, reverting to pre-configured ones if none have been specified.
 func setBootstrapNodes(ctx *cli.Context, cfg *p2p.Config) {
 	urls := params.MainnetBootnodes
-	switch {
+	switch chain := ChainName(ctx); {
 	case ctx.GlobalIsSet(BootnodesFlag.Name):
 		urls = SplitAndTrim(ctx.GlobalString(BootnodesFlag.Name))
-	case ctx.GlobalBool(RopstenFlag.Name):
-		urls = params.RopstenBootnodes
-	case ctx.GlobalBool(RinkebyFlag.Name):
-		urls = params.RinkebyBootnodes
-	case ctx.GlobalBool(GoerliFlag.Name):
-		urls = params.GoerliBootnodes
-	case ctx.GlobalBool(YoloV3Flag.Name):
-		urls = params.YoloV3Bootnodes
+	case chain != "" && chain != params.MainnetChainName:
+		urls = bootnodes(chain)
 	case cfg.BootstrapNodes != nil:
 		return // already set, don't apply defaults.
 	}
@@ -770,17 +840,11 @@ func setBootstrapNodes(ctx *cli.Context, cfg *p2p.Config) {
 // flags, reverting to pre-configured ones if none have been specified.
 func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 	urls := params.MainnetBootnodes
-	switch {
+	switch chain := ChainName(ctx); {
 	case ctx.GlobalIsSet(BootnodesFlag.Name):
 		urls = SplitAndTrim(ctx.GlobalString(BootnodesFlag.Name))
-	case ctx.GlobalBool(RopstenFlag.Name):
-		urls = params.RopstenBootnodes
-	case ctx.GlobalBool(RinkebyFlag.Name):
-		urls = params.RinkebyBootnodes
-	case ctx.GlobalBool(GoerliFlag.Name):
-		urls = params.GoerliBootnodes
-	case ctx.GlobalBool(YoloV3Flag.Name):
-		urls = params.YoloV3Bootnodes
+	case chain != "" && chain != params.MainnetChainName:
+		urls = bootnodes(chain)
 	case cfg.BootstrapNodesV5 != nil:
 		return // already set, don't apply defaults.
 	}
@@ -907,6 +971,9 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	SetP2PConfig(ctx, &cfg.P2P)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
+	if ctx.GlobalIsSet(ShutdownTimeoutFlag.Name) {
+		cfg.ShutdownTimeout = ctx.GlobalDuration(ShutdownTimeoutFlag.Name)
+	}
 }
 func SetNodeConfigCobra(cmd *cobra.Command, cfg *node.Config) {
 	flags := cmd.Flags()
@@ -921,12 +988,13 @@ func setDataDir(ctx *cli.Context, cfg *node.Config) {
 		cfg.DataDir = ctx.GlobalString(DataDirFlag.Name)
 	case ctx.GlobalBool(DeveloperFlag.Name):
 		cfg.DataDir = "" // unless explicitly requested, use memory databases
-	case ctx.GlobalBool(RinkebyFlag.Name) && cfg.DataDir == node.DefaultDataDir():
-		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "rinkeby")
-	case ctx.GlobalBool(GoerliFlag.Name) && cfg.DataDir == node.DefaultDataDir():
-		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "goerli")
-	case ctx.GlobalBool(YoloV3Flag.Name) && cfg.DataDir == node.DefaultDataDir():
-		cfg.DataDir = filepath.Join(node.DefaultDataDir(), "yolo-v3")
+	case cfg.DataDir == node.DefaultDataDir():
+		switch chain := ChainName(ctx); chain {
+		case params.YoloV3ChainName:
+			cfg.DataDir = filepath.Join(node.DefaultDataDir(), "yolo-v3")
+		case params.RinkebyChainName, params.GoerliChainName, params.BorMainnetChainName, params.MumbaiChainName:
+			cfg.DataDir = filepath.Join(node.DefaultDataDir(), chain)
+		}
 	}
 }
 func setDataDirCobra(f *pflag.FlagSet, cfg *node.Config) {
@@ -992,7 +1060,7 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
 	}
 	if ctx.GlobalIsSet(TxPoolJournalFlag.Name) {
-		cfg.Journal = ctx.GlobalString(TxPoolJournalFlag.Name)
+		cfg.Journal = ctx.GlobalBoolT(TxPoolJournalFlag.Name)
 	}
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
@@ -1015,6 +1083,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolGlobalQueueFlag.Name) {
 		cfg.GlobalQueue = ctx.GlobalUint64(TxPoolGlobalQueueFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolAccountQueueSizeFlag.Name) {
+		cfg.AccountQueueSize = ctx.GlobalUint64(TxPoolAccountQueueSizeFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
@@ -1140,6 +1211,44 @@ func setWhitelist(ctx *cli.Context, cfg *eth.Config) {
 	}
 }
 
+func setOverrides(ctx *cli.Context, cfg *eth.Config) {
+	overrides := &params.ChainOverrides{}
+	if file := ctx.GlobalString(OverrideConfigFlag.Name); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			Fatalf("Failed to read the chain config overrides: %v", err)
+		}
+		overrides.Config = data
+	}
+	if ctx.GlobalIsSet(OverrideBerlinFlag.Name) {
+		overrides.Berlin = new(big.Int).SetUint64(ctx.GlobalUint64(OverrideBerlinFlag.Name))
+	}
+	if ctx.GlobalIsSet(OverrideLondonFlag.Name) {
+		overrides.London = new(big.Int).SetUint64(ctx.GlobalUint64(OverrideLondonFlag.Name))
+	}
+	if eips := ctx.GlobalString(OverrideEIPsFlag.Name); eips != "" {
+		overrides.ExtraEIPs = make(map[int]*big.Int)
+		for _, entry := range strings.Split(eips, ",") {
+			parts := strings.Split(entry, "=")
+			if len(parts) != 2 {
+				Fatalf("Invalid EIP override: %s", entry)
+			}
+			eip, err := strconv.Atoi(parts[0])
+			if err != nil || !vm.ValidEip(eip) {
+				Fatalf("Invalid EIP %s, supported: %s", parts[0], strings.Join(vm.ActivateableEips(), ", "))
+			}
+			block, err := strconv.ParseUint(parts[1], 0, 64)
+			if err != nil {
+				Fatalf("Invalid activation block %s of EIP%d: %v", parts[1], eip, err)
+			}
+			overrides.ExtraEIPs[eip] = new(big.Int).SetUint64(block)
+		}
+	}
+	if overrides.Config != nil || overrides.Berlin != nil || overrides.London != nil || overrides.ExtraEIPs != nil {
+		cfg.Overrides = overrides
+	}
+}
+
 // CheckExclusive verifies that only a single instance of the provided flags was
 // set by the user. Each flag might optionally be followed by a string type to
 // specialize it further.
@@ -1184,7 +1293,7 @@ func CheckExclusive(ctx *cli.Context, args ...interface{}) {
 // SetEthConfig applies eth-related command line flags to the config.
 func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	// Avoid conflicting network flags
-	CheckExclusive(ctx, MainnetFlag, DeveloperFlag, RopstenFlag, RinkebyFlag, GoerliFlag, YoloV3Flag)
+	CheckExclusive(ctx, ChainFlag, MainnetFlag, DeveloperFlag, RopstenFlag, RinkebyFlag, GoerliFlag, YoloV3Flag)
 	CheckExclusive(ctx, MinerSigningKeyFlag, MinerEtherbaseFlag)
 	setEtherbase(ctx, cfg)
 	setGPO(ctx, &cfg.GPO)
@@ -1192,6 +1301,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	setEthash(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
+	setOverrides(ctx, cfg)
 
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkID = ctx.GlobalUint64(NetworkIdFlag.Name)
@@ -1215,6 +1325,10 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	cfg.DownloadOnly = ctx.GlobalBoolT(DownloadOnlyFlag.Name)
 
 	cfg.EnableDebugProtocol = ctx.GlobalBool(DebugProtocolFlag.Name)
+	cfg.ServeSnap = ctx.GlobalBool(SnapServeFlag.Name)
+	cfg.HeimdallURL = ctx.GlobalString(HeimdallURLFlag.Name)
+	cfg.WithoutHeimdall = ctx.GlobalBool(WithoutHeimdallFlag.Name)
+	cfg.ExternalConsensus = ctx.GlobalString(ExternalConsensusFlag.Name)
 	log.Info("Enabling recording of key preimages since archive mode is used")
 
 	cfg.ArchiveSyncInterval = ctx.GlobalInt(ArchiveSyncInterval.Name)
@@ -1261,36 +1375,48 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		}
 	}
 	// Override any default configs for hard coded networks.
-	switch {
-	case ctx.GlobalBool(MainnetFlag.Name):
+	switch chain := ChainName(ctx); {
+	case chain == params.MainnetChainName:
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = 1
 		}
 		cfg.Genesis = core.DefaultGenesisBlock()
 		SetDNSDiscoveryDefaults(cfg, params.MainnetGenesisHash)
-	case ctx.GlobalBool(RopstenFlag.Name):
+	case chain == params.RopstenChainName:
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = 3
 		}
 		cfg.Genesis = core.DefaultRopstenGenesisBlock()
 		SetDNSDiscoveryDefaults(cfg, params.RopstenGenesisHash)
-	case ctx.GlobalBool(RinkebyFlag.Name):
+	case chain == params.RinkebyChainName:
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = 4
 		}
 		cfg.Genesis = core.DefaultRinkebyGenesisBlock()
 		SetDNSDiscoveryDefaults(cfg, params.RinkebyGenesisHash)
-	case ctx.GlobalBool(GoerliFlag.Name):
+	case chain == params.GoerliChainName:
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = 5
 		}
 		cfg.Genesis = core.DefaultGoerliGenesisBlock()
 		SetDNSDiscoveryDefaults(cfg, params.GoerliGenesisHash)
-	case ctx.GlobalBool(YoloV3Flag.Name):
+	case chain == params.YoloV3ChainName:
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = new(big.Int).SetBytes([]byte("yolov3x")).Uint64() // "yolov3x"
 		}
 		cfg.Genesis = core.DefaultYoloV3GenesisBlock()
+	case chain == params.BorMainnetChainName:
+		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
+			cfg.NetworkID = 137
+		}
+		cfg.Genesis = core.DefaultBorMainnetGenesisBlock()
+	case chain == params.MumbaiChainName:
+		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
+			cfg.NetworkID = 80001
+		}
+		cfg.Genesis = core.DefaultMumbaiGenesisBlock()
+	case chain != "":
+		Fatalf("Unknown --%s %q", ChainFlag.Name, chain)
 	case ctx.GlobalBool(DeveloperFlag.Name):
 		if !ctx.GlobalIsSet(NetworkIdFlag.Name) {
 			cfg.NetworkID = 1337
@@ -1379,15 +1505,19 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) *ethdb.ObjectDatabase
 
 func MakeGenesis(ctx *cli.Context) *core.Genesis {
 	var genesis *core.Genesis
-	switch {
-	case ctx.GlobalBool(RopstenFlag.Name):
+	switch chain := ChainName(ctx); {
+	case chain == params.RopstenChainName:
 		genesis = core.DefaultRopstenGenesisBlock()
-	case ctx.GlobalBool(RinkebyFlag.Name):
+	case chain == params.RinkebyChainName:
 		genesis = core.DefaultRinkebyGenesisBlock()
-	case ctx.GlobalBool(GoerliFlag.Name):
+	case chain == params.GoerliChainName:
 		genesis = core.DefaultGoerliGenesisBlock()
-	case ctx.GlobalBool(YoloV3Flag.Name):
+	case chain == params.YoloV3ChainName:
 		genesis = core.DefaultYoloV3GenesisBlock()
+	case chain == params.BorMainnetChainName:
+		genesis = core.DefaultBorMainnetGenesisBlock()
+	case chain == params.MumbaiChainName:
+		genesis = core.DefaultMumbaiGenesisBlock()
 	case ctx.GlobalBool(DeveloperFlag.Name):
 		Fatalf("Developer chains are ephemeral")
 	}
@@ -1405,6 +1535,14 @@ func MakeChain(ctx *cli.Context, stack *node.Node, readOnly bool) (chainConfig *
 	var engine consensus.Engine
 	if config.Clique != nil {
 		engine = clique.New(config.Clique, chainDb)
+	} else if config.Aura != nil {
+		engine = aura.New(config.Aura, chainDb)
+	} else if config.Bor != nil {
+		var heimdall bor.HeimdallClient
+		if !ctx.GlobalBool(WithoutHeimdallFlag.Name) {
+			heimdall = bor.NewHeimdallClient(ctx.GlobalString(HeimdallURLFlag.Name))
+		}
+		engine = bor.New(config, chainDb, heimdall)
 	} else {
 		engine = ethash.NewFaker()
 		if !ctx.GlobalBool(FakePoWFlag.Name) {
@@ -1462,6 +1600,8 @@ func CobraFlags(cmd *cobra.Command, urfaveCliFlags []cli.Flag) {
 			flags.String(f.Name, f.Value, f.Usage)
 		case cli.BoolFlag:
 			flags.Bool(f.Name, false, f.Usage)
+		case cli.Float64Flag:
+			flags.Float64(f.Name, f.Value, f.Usage)
 		default:
 			panic(fmt.Errorf("unexpected type: %T", flag))
 		}
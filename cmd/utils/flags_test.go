@@ -18,8 +18,13 @@
 package utils
 
 import (
+	"flag"
 	"reflect"
 	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/urfave/cli"
 )
 
 func Test_SplitTagsFlag(t *testing.T) {
@@ -62,3 +67,44 @@ func Test_SplitTagsFlag(t *testing.T) {
 		})
 	}
 }
+
+func Test_ChainName(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		chain     string
+		bootnodes []string
+	}{
+		{"default", nil, "", params.MainnetBootnodes},
+		{"mainnet flag", []string{"--mainnet"}, params.MainnetChainName, params.MainnetBootnodes},
+		{"goerli flag", []string{"--goerli"}, params.GoerliChainName, params.GoerliBootnodes},
+		{"chain", []string{"--chain", "ropsten"}, params.RopstenChainName, params.RopstenBootnodes},
+		{"bor mainnet", []string{"--chain", "bor-mainnet"}, params.BorMainnetChainName, params.BorMainnetBootnodes},
+		{"mumbai", []string{"--chain", "mumbai"}, params.MumbaiChainName, params.MumbaiBootnodes},
+		{"bootnodes", []string{"--chain", "mumbai", "--bootnodes", params.GoerliBootnodes[0]}, params.MumbaiChainName, params.GoerliBootnodes[:1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := flag.NewFlagSet("test", flag.ContinueOnError)
+			for _, f := range []cli.Flag{ChainFlag, MainnetFlag, GoerliFlag, RopstenFlag, RinkebyFlag, YoloV3Flag, BootnodesFlag} {
+				f.Apply(set)
+			}
+			if err := set.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			ctx := cli.NewContext(nil, set, nil)
+			if got := ChainName(ctx); got != tt.chain {
+				t.Errorf("ChainName() = %q, want %q", got, tt.chain)
+			}
+			var cfg p2p.Config
+			setBootstrapNodes(ctx, &cfg)
+			var got []string
+			for _, node := range cfg.BootstrapNodes {
+				got = append(got, node.URLv4())
+			}
+			if !reflect.DeepEqual(got, tt.bootnodes) {
+				t.Errorf("bootstrap nodes = %v, want %v", got, tt.bootnodes)
+			}
+		})
+	}
+}
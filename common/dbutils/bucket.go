@@ -159,6 +159,13 @@ var (
 	BlockReceiptsPrefix = "r"      // block_num_u64 + hash -> block receipts
 	Log                 = "log"    // block_num_u64 + hash -> block receipts
 
+	// Number of the transactions of the canonical blocks, to count and page them without decoding the bodies
+	BlockTxCount = "block_tx_count" // block_num_u64 -> tx_amount_u32
+
+	// Stateless witnesses of the canonical blocks: the trie nodes and the codes of the state before the block, which
+	// are read or changed by its execution, see trie.Witness
+	BlockWitness = "block_witness" // block_num_u64 -> witness
+
 	// Stores bitmap indices - in which block numbers saw logs of given 'address' or 'topic'
 	// [addr or topic] + [2 bytes inverted shard number] -> bitmap(blockN)
 	// indices are sharded - because some bitmaps are >1Mb and when new incoming blocks process it
@@ -178,7 +185,7 @@ var (
 	TxLookupPrefix  = "l" // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	BloomBitsPrefix = "B" // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 
-	PreimagePrefix = "secure-key-"      // preimagePrefix + hash -> preimage
+	PreimagePrefix = "secure-key-"      // preimagePrefix + hash -> preimage, of the addresses and the storage keys with the p storage mode
 	ConfigPrefix   = "ethereum-config-" // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
@@ -191,7 +198,18 @@ var (
 	SyncStageUnwind     = "SSU2"
 	SyncStageUnwindOld1 = "SSU"
 
-	CliqueBucket = "clique-"
+	// Voting snapshots of clique at the checkpoints: block_num_u64 + block_hash -> json(snapshot). Keyed by the
+	// number to delete the snapshots of the unwound blocks with the range deletion
+	CliqueSnapshot   = "clique_snapshot"
+	CliqueBucketOld1 = "clique-" // block_hash -> json(snapshot)
+
+	// Validator set snapshots of bor at the checkpoints: block_num_u64 + block_hash -> json(snapshot)
+	BorSnapshot = "bor_snapshot"
+
+	// Logs of the state sync events committed by the bor blocks, the receipt of the system transaction which isn't
+	// in the body: block_num_u64 -> logs
+	BorReceipts = "bor_receipt"
+	BorTxLookup = "bor_tx_lookup" // bor_tx_hash -> block_num_u64
 
 	// this bucket stored in separated database
 	InodesBucket = "inodes"
@@ -216,6 +234,22 @@ var (
 
 	Sequence = "sequence" // tbl_name -> seq_u64
 
+	// Local transactions of the transaction pool, to survive node restarts
+	TxPoolJournal = "txpool_journal" // tx_hash -> journaled_at_unix_u64 + rlp(tx)
+
+	// Alert states of the storage slot watches, to not repeat the alerts after the restarts, see slotwatch.AlertState
+	SlotWatchState = "slot_watch_state" // watch_name -> triggered_u8 + block_num_u64 + value
+
+	// Rankings of the accounts in the latest state with the k storage mode, the inverted numbers sort the largest
+	// first. The accounts with the zero balance and without the code are not ranked
+	BalanceRank  = "balance_rank"   // inverted_balance_u256 + address -> balance
+	CodeSizeRank = "code_size_rank" // inverted_code_size_u64 + address -> code_hash
+
+	// Blocks of the ERC-20 and the ERC-721 transfers sent or received by the address, with the e storage mode
+	TokenTransferIndex = "token_transfer_index" // address + chunk_last_block_u32 -> bitmap(block_num)
+
+	// Snapshots of the sizes of the buckets, taken periodically to chart the growth of the database, see ethdb.DBStats
+	DBStats = "db_stats" // time_unix_u64 -> cbor(ethdb.DBStats)
 )
 
 // Keys
@@ -231,6 +265,16 @@ var (
 	StorageModeTxIndex = []byte("smTxIndex")
 	//StorageModeCallTraces - does not build index of call traces
 	StorageModeCallTraces = []byte("smCallTraces")
+	//StorageModeBlockWitnesses - does node save the stateless witnesses of the blocks
+	StorageModeBlockWitnesses = []byte("smBlockWitnesses")
+	//StorageModePreimages - does node record the keccak preimages of the addresses and the storage keys
+	StorageModePreimages = []byte("smPreimages")
+	//StorageModeAccountRanks - does node maintain the rankings of the accounts by the balance and by the code size
+	StorageModeAccountRanks = []byte("smAccountRanks")
+	//StorageModeTokenTransfers - does node build the index of the token transfers of the addresses
+	StorageModeTokenTransfers = []byte("smTokenTransfers")
+	//ColdBucketsKey - buckets the node keeps in the cold database on another volume, see ethdb.TieredKV
+	ColdBucketsKey = []byte("coldBuckets")
 
 	HeadHeaderKey = "LastHeader"
 
@@ -266,7 +310,10 @@ var Buckets = []string{
 	BloomBitsIndexPrefix,
 	DatabaseInfoBucket,
 	IncarnationMapBucket,
-	CliqueBucket,
+	CliqueSnapshot,
+	BorSnapshot,
+	BorReceipts,
+	BorTxLookup,
 	SyncStageProgress,
 	SyncStageUnwind,
 	PlainStateBucket,
@@ -299,6 +346,14 @@ var Buckets = []string{
 	HeaderCanonicalBucket,
 	HeadersBucket,
 	HeaderTDBucket,
+	TxPoolJournal,
+	BlockTxCount,
+	BlockWitness,
+	SlotWatchState,
+	BalanceRank,
+	CodeSizeRank,
+	TokenTransferIndex,
+	DBStats,
 }
 
 // DeprecatedBuckets - list of buckets which can be programmatically deleted - for example after migration
@@ -309,6 +364,7 @@ var DeprecatedBuckets = []string{
 	PlainStateBucketOld1,
 	IntermediateTrieHashBucketOld1,
 	HeaderPrefixOld,
+	CliqueBucketOld1,
 }
 
 type CustomComparator string
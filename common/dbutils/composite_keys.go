@@ -3,6 +3,7 @@ package dbutils
 import (
 	"encoding/binary"
 
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
 )
 
@@ -49,7 +50,30 @@ func BloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 }
 
 // AddrHash + KeyHash
-// Only for trie
+// Only for trie// BalanceRankKey = inverted balance (uint256 big endian) + address, the largest balance sorts first
+func BalanceRankKey(balance *uint256.Int, address common.Address) []byte {
+	key := make([]byte, 32+common.AddressLength)
+	balance.WriteToSlice(key[:32])
+	for i := 0; i < 32; i++ {
+		key[i] = ^key[i]
+	}
+	copy(key[32:], address[:])
+	return key
+}
+
+// CodeSizeRankKey = inverted code size (uint64 big endian) + address, the largest code sorts first
+func CodeSizeRankKey(codeSize uint64, address common.Address) []byte {
+	key := make([]byte, 8+common.AddressLength)
+	binary.BigEndian.PutUint64(key, ^codeSize)
+	copy(key[8:], address[:])
+	return key
+}
+
+// ParseCodeSizeRankKey returns the code size and the address of the key of CodeSizeRank
+func ParseCodeSizeRankKey(key []byte) (uint64, common.Address) {
+	return ^binary.BigEndian.Uint64(key), common.BytesToAddress(key[8:])
+}
+
 func GenerateCompositeTrieKey(addressHash common.Hash, seckey common.Hash) []byte {
 	compositeKey := make([]byte, 0, common.HashLength+common.HashLength)
 	compositeKey = append(compositeKey, addressHash[:]...)
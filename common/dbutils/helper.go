@@ -1,6 +1,7 @@
 package dbutils
 
-// EncodeTimestamp has the property: if a < b, then Encoding(a) < Encoding(b) lexicographically
+// EncodeTimestamp has the property: if a < b, then Encoding(a) < Encoding(b) lexicographically.
+// The timestamps have to be below 2^53, the 3 bits of the length can not encode the 8 bytes long ones
 func EncodeTimestamp(timestamp uint64) []byte {
 	var suffix []byte
 	var limit uint64 = 32
@@ -0,0 +1,116 @@
+package dbutils
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// KeyLayoutsVersion is the version of the KeyLayouts table. Changing the layout of a key makes the databases written
+// with the old layout silently misread, so every change of the table has to bump the version, and the fingerprint
+// of the table pinned by TestKeyLayoutsVersion, together with a migration of the affected buckets
+const KeyLayoutsVersion = 5
+
+// KeyField is a field of a composite key, the big-endian numbers are named with their _u64/_u32/_u16 suffix
+type KeyField struct {
+	Name string
+	Size int
+}
+
+// KeyLayout is the layout of the composite keys of a bucket, Kind tells apart the layouts of the buckets which
+// keep several kinds of the keys, e.g. the accounts and the storage of the PlainState
+type KeyLayout struct {
+	Bucket string
+	Kind   string
+	Fields []KeyField
+}
+
+var (
+	blockNumField     = KeyField{"block_num_u64", 8}
+	blockHashField    = KeyField{"block_hash", common.HashLength}
+	addressField      = KeyField{"address", common.AddressLength}
+	addressHashField  = KeyField{"address_hash", common.HashLength}
+	incarnationField  = KeyField{"incarnation_u64", common.IncarnationLength}
+	slotField         = KeyField{"slot", common.HashLength}
+	slotHashField     = KeyField{"slot_hash", common.HashLength}
+	chunkField        = KeyField{"chunk_last_block_u64", 8}
+	chunk32Field      = KeyField{"chunk_last_block_u32", 4}
+	txHashField       = KeyField{"tx_hash", common.HashLength}
+	logTopicField     = KeyField{"topic", common.HashLength}
+	txIndexField      = KeyField{"tx_index_u32", 4}
+	bloomBitField     = KeyField{"bit_u16", 2}
+	bloomSectionField = KeyField{"section_u64", 8}
+	balanceRankField  = KeyField{"inverted_balance_u256", 32}
+	codeSizeRankField = KeyField{"inverted_code_size_u64", 8}
+)
+
+// KeyLayouts are the layouts of the composite keys written by the helpers of this package and by the changesets
+// and the history indices, they are the reference of the property and the fuzz tests of the helpers
+var KeyLayouts = []KeyLayout{
+	{HeadersBucket, "", []KeyField{blockNumField, blockHashField}},
+	{BlockBodyPrefix, "", []KeyField{blockNumField, blockHashField}},
+	{HeaderCanonicalBucket, "", []KeyField{blockNumField}},
+	{HeaderNumberBucket, "", []KeyField{blockHashField}},
+	{BlockReceiptsPrefix, "", []KeyField{blockNumField}},
+	{Log, "", []KeyField{blockNumField, txIndexField}},
+	{BloomBitsPrefix, "", []KeyField{bloomBitField, bloomSectionField, blockHashField}},
+	{TxLookupPrefix, "", []KeyField{txHashField}},
+	{PlainStateBucket, "account", []KeyField{addressField}},
+	{PlainStateBucket, "storage", []KeyField{addressField, incarnationField, slotField}},
+	{HashedAccountsBucket, "", []KeyField{addressHashField}},
+	{HashedStorageBucket, "", []KeyField{addressHashField, incarnationField, slotHashField}},
+	{IncarnationMapBucket, "", []KeyField{addressField}},
+	{PlainAccountChangeSetBucket, "", []KeyField{blockNumField}},
+	{PlainStorageChangeSetBucket, "", []KeyField{blockNumField, addressField, incarnationField}},
+	{AccountsHistoryBucket, "", []KeyField{addressField, chunkField}},
+	{StorageHistoryBucket, "", []KeyField{addressField, slotField, chunkField}},
+	{LogAddressIndex, "", []KeyField{addressField, chunk32Field}},
+	{LogTopicIndex, "", []KeyField{logTopicField, chunk32Field}},
+	{CallFromIndex, "", []KeyField{addressField, chunk32Field}},
+	{CallToIndex, "", []KeyField{addressField, chunk32Field}},
+	{CliqueSnapshot, "", []KeyField{blockNumField, blockHashField}},
+	{BorSnapshot, "", []KeyField{blockNumField, blockHashField}},
+	{BorReceipts, "", []KeyField{blockNumField}},
+	{BorTxLookup, "", []KeyField{txHashField}},
+	{BalanceRank, "", []KeyField{balanceRankField, addressField}},
+	{CodeSizeRank, "", []KeyField{codeSizeRankField, addressField}},
+	{TokenTransferIndex, "", []KeyField{addressField, chunk32Field}},
+}
+
+// Size is the size of the keys of the layout
+func (l KeyLayout) Size() int {
+	var size int
+	for _, f := range l.Fields {
+		size += f.Size
+	}
+	return size
+}
+
+// Split splits the key into the fields of the layout
+func (l KeyLayout) Split(key []byte) ([][]byte, error) {
+	if len(key) != l.Size() {
+		return nil, fmt.Errorf("key %x of %s%s has %d bytes, %d expected", key, l.Bucket, l.kindSuffix(), len(key), l.Size())
+	}
+	fields := make([][]byte, len(l.Fields))
+	for i, f := range l.Fields {
+		fields[i], key = key[:f.Size], key[f.Size:]
+	}
+	return fields, nil
+}
+
+func (l KeyLayout) kindSuffix() string {
+	if l.Kind == "" {
+		return ""
+	}
+	return " (" + l.Kind + ")"
+}
+
+// FindKeyLayout returns the layout of the keys of the bucket of the kind, nil if it isn't in KeyLayouts
+func FindKeyLayout(bucket, kind string) *KeyLayout {
+	for i := range KeyLayouts {
+		if KeyLayouts[i].Bucket == bucket && KeyLayouts[i].Kind == kind {
+			return &KeyLayouts[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package dbutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"testing/quick"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/stretchr/testify/require"
+)
+
+// keyLayoutsFingerprints are the fingerprints of the KeyLayouts table by its version
+var keyLayoutsFingerprints = map[int]string{
+	1: "a1c9bbd1735f0807288f6633e47b796caad214015c429e78fa7edf579e7efaf3",
+	2: "040f794280e9cac5c931f660a2aaf5abb915dc566834a4183368e9c818300525",
+	3: "0bbf0e53f32c30b9bc1283fe4bb63f9989af99f94f191d2d6f097d3443c37a83",
+	4: "8d97011e2a61dfdc2eca4062f545be291b20fd3157d7d626b40d9d01f5cf9c25",
+	5: "bc29b9a478f549bd5a6e45aa463460be7f4a389630b835f79f7422e243a998e1",
+}
+
+func TestKeyLayoutsVersion(t *testing.T) {
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%v", KeyLayouts))))
+	require.Equal(t, keyLayoutsFingerprints[KeyLayoutsVersion], fingerprint,
+		"KeyLayouts changed, bump KeyLayoutsVersion, pin the new fingerprint and migrate the affected buckets")
+	for _, l := range KeyLayouts {
+		require.Contains(t, Buckets, l.Bucket)
+		require.Equal(t, &l, FindKeyLayout(l.Bucket, l.Kind))
+	}
+}
+
+// requireLayout checks that the key has the layout of the bucket and returns its fields
+func requireLayout(t *testing.T, key []byte, bucket, kind string) [][]byte {
+	l := FindKeyLayout(bucket, kind)
+	require.NotNil(t, l, bucket)
+	fields, err := l.Split(key)
+	require.NoError(t, err)
+	return fields
+}
+
+func TestStorageKeysProperties(t *testing.T) {
+	plain := func(address common.Address, incarnation uint64, slot common.Hash) bool {
+		key := PlainGenerateCompositeStorageKey(address[:], incarnation, slot[:])
+		fields := requireLayout(t, key, PlainStateBucket, "storage")
+		a, inc, s := PlainParseCompositeStorageKey(key)
+		prefix := PlainGenerateStoragePrefix(address[:], incarnation)
+		pa, pinc := PlainParseStoragePrefix(prefix)
+		return a == address && inc == incarnation && s == slot &&
+			bytes.Equal(fields[0], address[:]) && binary.BigEndian.Uint64(fields[1]) == incarnation && bytes.Equal(fields[2], slot[:]) &&
+			bytes.HasPrefix(key, prefix) && pa == address && pinc == incarnation
+	}
+	require.NoError(t, quick.Check(plain, nil))
+
+	hashed := func(addrHash common.Hash, incarnation uint64, slotHash common.Hash) bool {
+		key := GenerateCompositeStorageKey(addrHash, incarnation, slotHash)
+		fields := requireLayout(t, key, HashedStorageBucket, "")
+		h, inc, s := ParseCompositeStorageKey(key)
+		prefix := GenerateStoragePrefix(addrHash[:], incarnation)
+		ph, pinc := ParseStoragePrefix(prefix)
+		return h == addrHash && inc == incarnation && s == slotHash &&
+			bytes.Equal(fields[0], addrHash[:]) && binary.BigEndian.Uint64(fields[1]) == incarnation && bytes.Equal(fields[2], slotHash[:]) &&
+			bytes.Equal(key, GenerateCompositeStoragePrefix(addrHash[:], incarnation, slotHash[:])) &&
+			bytes.HasPrefix(key, prefix) && ph == addrHash && pinc == incarnation
+	}
+	require.NoError(t, quick.Check(hashed, nil))
+}
+
+func TestHistoryChunkKeysProperties(t *testing.T) {
+	storage := func(address common.Address, incarnation uint64, slot common.Hash, blockNum uint64) bool {
+		key := PlainGenerateCompositeStorageKey(address[:], incarnation, slot[:])
+		withoutInc := CompositeKeyWithoutIncarnation(key)
+		chunkKey := IndexChunkKey(key, blockNum)
+		fields := requireLayout(t, chunkKey, StorageHistoryBucket, "")
+		chunkKey32 := IndexChunkKey32(key, uint32(blockNum))
+		return bytes.Equal(withoutInc, append(common.CopyBytes(address[:]), slot[:]...)) &&
+			bytes.Equal(fields[0], address[:]) && bytes.Equal(fields[1], slot[:]) && binary.BigEndian.Uint64(fields[2]) == blockNum &&
+			bytes.Equal(chunkKey32[:len(withoutInc)], withoutInc) && binary.BigEndian.Uint32(chunkKey32[len(withoutInc):]) == uint32(blockNum)
+	}
+	require.NoError(t, quick.Check(storage, nil))
+
+	account := func(address common.Address, blockNum uint64) bool {
+		chunkKey := IndexChunkKey(address[:], blockNum)
+		fields := requireLayout(t, chunkKey, AccountsHistoryBucket, "")
+		current := CurrentChunkKey(address[:])
+		return bytes.Equal(fields[0], address[:]) && binary.BigEndian.Uint64(fields[1]) == blockNum &&
+			bytes.Equal(CompositeKeyWithoutIncarnation(address[:]), address[:]) &&
+			// The current chunk is the last one of the address
+			bytes.Compare(chunkKey, current) <= 0
+	}
+	require.NoError(t, quick.Check(account, nil))
+
+	hashed := func(addrHash common.Hash, incarnation uint64, slotHash common.Hash, blockNum uint64) bool {
+		key := GenerateCompositeStorageKey(addrHash, incarnation, slotHash)
+		chunkKey := IndexChunkKey(key, blockNum)
+		return bytes.Equal(chunkKey[:2*common.HashLength], CompositeKeyWithoutIncarnation(key)) &&
+			binary.BigEndian.Uint64(chunkKey[2*common.HashLength:]) == blockNum
+	}
+	require.NoError(t, quick.Check(hashed, nil))
+}
+
+// The keys of the blocks sort in the order of the block numbers, the sync relies on it to walk the ranges of blocks
+func TestBlockKeysOrderProperties(t *testing.T) {
+	blocks := func(a, b uint64, hashA, hashB common.Hash) bool {
+		requireLayout(t, HeaderKey(a, hashA), HeadersBucket, "")
+		requireLayout(t, BlockBodyKey(a, hashA), BlockBodyPrefix, "")
+		requireLayout(t, ReceiptsKey(a), BlockReceiptsPrefix, "")
+		order := bytes.Compare(EncodeBlockNumber(a), EncodeBlockNumber(b))
+		return sign(order) == compareUint64(a, b) &&
+			bytes.Equal(ReceiptsKey(a), EncodeBlockNumber(a)) &&
+			(a == b || sign(bytes.Compare(HeaderKey(a, hashA), HeaderKey(b, hashB))) == order) &&
+			(a == b || sign(bytes.Compare(BlockBodyKey(a, hashA), BlockBodyKey(b, hashB))) == order)
+	}
+	require.NoError(t, quick.Check(blocks, nil))
+
+	logs := func(a, b uint64, txA, txB uint32) bool {
+		fields := requireLayout(t, LogKey(a, txA), Log, "")
+		expected := compareUint64(a, b)
+		if expected == 0 {
+			expected = compareUint64(uint64(txA), uint64(txB))
+		}
+		return binary.BigEndian.Uint64(fields[0]) == a && binary.BigEndian.Uint32(fields[1]) == txA &&
+			sign(bytes.Compare(LogKey(a, txA), LogKey(b, txB))) == expected
+	}
+	require.NoError(t, quick.Check(logs, nil))
+
+	bloomBits := func(bit uint16, section uint64, hash common.Hash) bool {
+		fields := requireLayout(t, BloomBitsKey(uint(bit), section, hash), BloomBitsPrefix, "")
+		return binary.BigEndian.Uint16(fields[0]) == bit && binary.BigEndian.Uint64(fields[1]) == section && bytes.Equal(fields[2], hash[:])
+	}
+	require.NoError(t, quick.Check(bloomBits, nil))
+}
+
+// The rankings are walked from the first key, the largest numbers have to sort first
+func TestRankKeysOrderProperties(t *testing.T) {
+	balances := func(a, b [4]uint64, addrA, addrB common.Address) bool {
+		balanceA, balanceB := uint256.Int(a), uint256.Int(b)
+		keyA, keyB := BalanceRankKey(&balanceA, addrA), BalanceRankKey(&balanceB, addrB)
+		fields := requireLayout(t, keyA, BalanceRank, "")
+		return bytes.Equal(fields[1], addrA[:]) &&
+			(balanceA.Eq(&balanceB) || sign(bytes.Compare(keyA, keyB)) == -balanceA.Cmp(&balanceB))
+	}
+	require.NoError(t, quick.Check(balances, nil))
+
+	codeSizes := func(a, b uint64, addrA, addrB common.Address) bool {
+		keyA, keyB := CodeSizeRankKey(a, addrA), CodeSizeRankKey(b, addrB)
+		requireLayout(t, keyA, CodeSizeRank, "")
+		size, address := ParseCodeSizeRankKey(keyA)
+		return size == a && address == addrA && (a == b || sign(bytes.Compare(keyA, keyB)) == -compareUint64(a, b))
+	}
+	require.NoError(t, quick.Check(codeSizes, nil))
+}
+
+func TestTimestampProperties(t *testing.T) {
+	roundTrip := func(a, b uint64, rest []byte) bool {
+		// The timestamps are at most 53 bits long
+		a, b = a>>11, b>>11
+		encA, encB := EncodeTimestamp(a), EncodeTimestamp(b)
+		decoded, suffix := DecodeTimestamp(append(common.CopyBytes(encA), rest...))
+		composite, encodedTS := CompositeKeySuffix(rest, a)
+		return decoded == a && bytes.Equal(suffix, rest) &&
+			sign(bytes.Compare(encA, encB)) == compareUint64(a, b) &&
+			bytes.Equal(encodedTS, encA) && bytes.Equal(composite, append(common.CopyBytes(rest), encA...))
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestNextSubtreeProperties(t *testing.T) {
+	next := func(in []byte) bool {
+		out, ok := NextSubtree(in)
+		if !ok {
+			return len(bytes.TrimLeft(in, "\xff")) == 0
+		}
+		// The next subtree is the first key after all the keys with the prefix
+		return bytes.Compare(in, out) < 0 && !bytes.HasPrefix(out, in)
+	}
+	require.NoError(t, quick.Check(next, nil))
+	require.True(t, next([]byte{0xff, 0xff}))
+	require.True(t, next([]byte{0x01, 0xff}))
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func sign(c int) int {
+	switch {
+	case c < 0:
+		return -1
+	case c > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,191 @@
+package debug
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// StallWatchdog captures the goroutine, the heap and the CPU profiles into its directory when a unit of work (a stage
+// run, an RPC call) runs longer than the threshold, so the reports of the hangs come with the profiles of the moment
+// they hung. It keeps the profiles of the last few stalls
+type StallWatchdog struct {
+	dir         string
+	keep        int
+	threshold   int64 // time.Duration, atomic, 0 disables the capture
+	cpuDuration time.Duration
+
+	lock   sync.Mutex
+	nextID uint64
+	work   map[uint64]*stallWork
+}
+
+type stallWork struct {
+	name     string
+	started  time.Time
+	reported bool
+}
+
+// NewStallWatchdog creates the watchdog writing the profiles into dir and keeping the last keep captures
+func NewStallWatchdog(dir string, threshold time.Duration, keep int) *StallWatchdog {
+	return &StallWatchdog{
+		dir:         dir,
+		keep:        keep,
+		threshold:   int64(threshold),
+		cpuDuration: 10 * time.Second,
+		work:        map[uint64]*stallWork{},
+	}
+}
+
+// SetThreshold changes the time the work has to run for to be a stall, 0 disables the capture
+func (w *StallWatchdog) SetThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&w.threshold, int64(threshold))
+}
+
+// Threshold returns the time the work has to run for to be a stall
+func (w *StallWatchdog) Threshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.threshold))
+}
+
+// Begin registers the start of the work, the returned function registers its end
+func (w *StallWatchdog) Begin(name string) func() {
+	w.lock.Lock()
+	id := w.nextID
+	w.nextID++
+	w.work[id] = &stallWork{name: name, started: time.Now()}
+	w.lock.Unlock()
+	return func() {
+		w.lock.Lock()
+		delete(w.work, id)
+		w.lock.Unlock()
+	}
+}
+
+// Run checks the running work every second until quit is closed, every work is captured once however long it stalls
+func (w *StallWatchdog) Run(quit <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case now := <-ticker.C:
+			stalled := w.stalled(now)
+			if len(stalled) == 0 {
+				continue
+			}
+			log.Warn("Stall detected, capturing the profiles", "work", strings.Join(stalled, ", "), "dir", w.dir)
+			if err := w.capture(now, stalled); err != nil {
+				log.Warn("Capturing the profiles of the stall failed", "err", err)
+			}
+		}
+	}
+}
+
+// stalled returns the descriptions of the work running longer than the threshold which isn't captured yet
+func (w *StallWatchdog) stalled(now time.Time) []string {
+	threshold := w.Threshold()
+	if threshold <= 0 {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var stalled []string
+	for _, work := range w.work {
+		if !work.reported && now.Sub(work.started) > threshold {
+			work.reported = true
+			stalled = append(stalled, fmt.Sprintf("%s (running for %s)", work.name, now.Sub(work.started).Round(time.Second)))
+		}
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// capture writes the profiles into a new directory named after the time, e.g. <dir>/20210512-101500, and removes
+// the oldest captures
+func (w *StallWatchdog) capture(now time.Time, stalled []string) error {
+	dir := filepath.Join(w.dir, now.UTC().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "stalled.txt"), []byte(strings.Join(stalled, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := writeProfile(filepath.Join(dir, "goroutine.txt"), func(f *os.File) error { return pprof.Lookup("goroutine").WriteTo(f, 2) }); err != nil {
+		return err
+	}
+	if err := writeProfile(filepath.Join(dir, "heap.pprof"), func(f *os.File) error { return pprof.Lookup("heap").WriteTo(f, 0) }); err != nil {
+		return err
+	}
+	if err := writeProfile(filepath.Join(dir, "cpu.pprof"), func(f *os.File) error {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return nil // the CPU is already profiled, e.g. with --pprof.cpuprofile
+		}
+		time.Sleep(w.cpuDuration)
+		pprof.StopCPUProfile()
+		return nil
+	}); err != nil {
+		return err
+	}
+	return w.rotate()
+}
+
+// rotate removes the oldest captures beyond the kept ones, their names sort by time
+func (w *StallWatchdog) rotate() error {
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	var captures []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			captures = append(captures, entry.Name())
+		}
+	}
+	sort.Strings(captures)
+	for len(captures) > w.keep {
+		if err := os.RemoveAll(filepath.Join(w.dir, captures[0])); err != nil {
+			return err
+		}
+		captures = captures[1:]
+	}
+	return nil
+}
+
+func writeProfile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var stallWatchdog atomic.Value // *StallWatchdog
+
+// SetStallWatchdog installs the watchdog BeginWork registers the work with
+func SetStallWatchdog(w *StallWatchdog) {
+	stallWatchdog.Store(w)
+}
+
+// BeginWork registers the start of the work with the installed watchdog, the returned function registers its end.
+// Without the watchdog or with its capture disabled it does nothing
+func BeginWork(name string) func() {
+	w, _ := stallWatchdog.Load().(*StallWatchdog)
+	if w == nil || w.Threshold() <= 0 {
+		return func() {}
+	}
+	return w.Begin(name)
+}
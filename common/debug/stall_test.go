@@ -0,0 +1,40 @@
+package debug
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStallWatchdog(t *testing.T) {
+	dir := t.TempDir()
+	w := NewStallWatchdog(dir, time.Minute, 1)
+	w.cpuDuration = time.Millisecond
+
+	end := w.Begin("stage Execution")
+	w.Begin("rpc eth_call")
+	now := time.Now()
+	assert.Empty(t, w.stalled(now))
+	stalled := w.stalled(now.Add(2 * time.Minute))
+	assert.Len(t, stalled, 2)
+	assert.Empty(t, w.stalled(now.Add(3*time.Minute)), "every work is reported once")
+	end()
+	w.Begin("stage Senders")
+	w.SetThreshold(0)
+	assert.Empty(t, w.stalled(now.Add(2*time.Minute)))
+
+	// Only the last capture is kept
+	require.NoError(t, w.capture(now, stalled))
+	require.NoError(t, w.capture(now.Add(time.Hour), stalled))
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, now.Add(time.Hour).UTC().Format("20060102-150405"), entries[0].Name())
+	for _, name := range []string{"stalled.txt", "goroutine.txt", "heap.pprof", "cpu.pprof"} {
+		assert.FileExists(t, filepath.Join(dir, entries[0].Name(), name))
+	}
+}
@@ -28,6 +28,7 @@ type Buffer interface {
 	Put(k, v []byte)
 	Get(i int) sortableBufferEntry
 	Len() int
+	Size() int
 	Reset()
 	GetEntries() []sortableBufferEntry
 	Sort()
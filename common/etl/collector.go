@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -32,6 +33,7 @@ type Collector struct {
 	dataProviders   []dataProvider
 	allFlushed      bool
 	autoClean       bool
+	memory          *Reservation // memory held by the buffer, accounted in Memory
 }
 
 // NewCollectorFromFiles creates collector from existing files (left over from previous unsuccessful loading)
@@ -55,7 +57,7 @@ func NewCollectorFromFiles(tmpdir string) (*Collector, error) {
 		}
 		dataProviders[i] = &dataProvider
 	}
-	return &Collector{dataProviders: dataProviders, allFlushed: true, autoClean: false}, nil
+	return &Collector{dataProviders: dataProviders, allFlushed: true, autoClean: false, memory: Memory.NewReservation()}, nil
 }
 
 // NewCriticalCollector does not clean up temporary files if loading has failed
@@ -66,8 +68,9 @@ func NewCriticalCollector(tmpdir string, sortableBuffer Buffer) *Collector {
 }
 
 func NewCollector(tmpdir string, sortableBuffer Buffer) *Collector {
-	c := &Collector{autoClean: true}
+	c := &Collector{autoClean: true, memory: Memory.NewReservation()}
 	encoder := codec.NewEncoder(nil, &cbor)
+	var accounted uint64 // part of the buffer size already reserved in Memory
 
 	c.flushBuffer = func(currentKey []byte, canStoreInRam bool) error {
 		if sortableBuffer.Len() == 0 {
@@ -81,6 +84,8 @@ func NewCollector(tmpdir string, sortableBuffer Buffer) *Collector {
 			c.allFlushed = true
 		} else {
 			provider, err = FlushToDisk(encoder, currentKey, sortableBuffer, tmpdir)
+			c.memory.ReleaseAll()
+			accounted = 0
 		}
 		if err != nil {
 			return err
@@ -93,7 +98,18 @@ func NewCollector(tmpdir string, sortableBuffer Buffer) *Collector {
 
 	c.extractNextFunc = func(originalK, k []byte, v []byte) error {
 		sortableBuffer.Put(common.CopyBytes(k), common.CopyBytes(v))
-		if sortableBuffer.CheckFlushSize() {
+		// The buffer is accounted in steps to keep the shared accountant off the hot path.
+		// When the memory limit is exceeded, the buffer is spilled to disk early.
+		var spill bool
+		if size := uint64(sortableBuffer.Size()); size >= accounted+memoryAccountingStep {
+			c.memory.Grow(size - accounted)
+			accounted = size
+			spill = accounted >= uint64(minSpillSize) && c.memory.accountant.Exceeded()
+			if spill && !sortableBuffer.CheckFlushSize() {
+				log.Debug("Memory limit exceeded, spilling ETL buffer to disk", "buffer", datasize.ByteSize(accounted).HumanReadable(), "used", c.memory.accountant.Used().HumanReadable())
+			}
+		}
+		if spill || sortableBuffer.CheckFlushSize() {
 			if err := c.flushBuffer(originalK, false); err != nil {
 				return err
 			}
@@ -109,12 +125,14 @@ func (c *Collector) Collect(k, v []byte) error {
 
 func (c *Collector) Load(logPrefix string, db ethdb.Database, toBucket string, loadFunc LoadFunc, args TransformArgs) (err error) {
 	defer func() {
+		c.memory.ReleaseAll()
 		if c.autoClean {
 			c.Close(logPrefix)
 		}
 	}()
 	if !c.allFlushed {
-		if err := c.flushBuffer(nil, true); err != nil {
+		// The last buffer stays in RAM for the loading, unless the memory is short
+		if err := c.flushBuffer(nil, !c.memory.accountant.Exceeded()); err != nil {
 			return err
 		}
 	}
@@ -126,6 +144,7 @@ func (c *Collector) Load(logPrefix string, db ethdb.Database, toBucket string, l
 }
 
 func (c *Collector) Close(logPrefix string) {
+	c.memory.ReleaseAll()
 	disposeProviders(logPrefix, c.dataProviders)
 }
 
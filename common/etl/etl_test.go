@@ -7,7 +7,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -427,3 +429,61 @@ func compareBucketsDouble(t *testing.T, db ethdb.Database, b1, b2 string) {
 	assert.NoError(t, err)
 	assert.Equal(t, b1Map, b2Map)
 }
+
+func TestCollectorSpillsOverMemoryLimit(t *testing.T) {
+	memory := Memory
+	defer func() { Memory = memory }()
+	Memory = NewMemoryAccountant(datasize.MB)
+
+	// The buffer is far below its optimal size, but the memory limit makes it spill to disk
+	collector := NewCollector("", NewSortableBuffer(BufferOptimalSize))
+	value := make([]byte, datasize.MB)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, collector.Collect([]byte(fmt.Sprintf("key-%02d", i)), value))
+	}
+	assert.Equal(t, 1, len(collector.dataProviders))
+	_, ok := collector.dataProviders[0].(*fileDataProvider)
+	assert.True(t, ok)
+	assert.True(t, Memory.Used() < minSpillSize)
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	destBucket := dbutils.Buckets[1]
+	assert.NoError(t, collector.Load("logPrefix", db, destBucket, IdentityLoadFunc, TransformArgs{}))
+	assert.Equal(t, datasize.ByteSize(0), Memory.Used())
+	count := 0
+	assert.NoError(t, db.Walk(destBucket, nil, 0, func(k, v []byte) (bool, error) {
+		count++
+		return true, nil
+	}))
+	assert.Equal(t, 20, count)
+}
+
+func TestMemoryReservationWait(t *testing.T) {
+	memory := NewMemoryAccountant(100)
+	r1, r2 := memory.NewReservation(), memory.NewReservation()
+	r1.Grow(80)
+	// A reservation holding nothing always gets through
+	assert.NoError(t, r2.Wait(50, nil))
+	assert.True(t, memory.Exceeded())
+
+	done := make(chan error)
+	go func() { done <- r2.Wait(10, nil) }()
+	select {
+	case <-done:
+		t.Fatal("reservation is not waiting for the memory")
+	case <-time.After(50 * time.Millisecond):
+	}
+	r1.Release(80)
+	assert.NoError(t, <-done)
+	assert.Equal(t, datasize.ByteSize(60), memory.Used())
+
+	quit := make(chan struct{})
+	close(quit)
+	r1.Grow(50)
+	assert.Equal(t, common.ErrStopped, r2.Wait(10, quit))
+	r1.ReleaseAll()
+	r2.ReleaseAll()
+	assert.Equal(t, datasize.ByteSize(0), memory.Used())
+	assert.False(t, memory.Exceeded())
+}
@@ -0,0 +1,152 @@
+package etl
+
+import (
+	"sync"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// Memory is the accountant shared by the buffers of all the stages: the ETL collectors,
+// the bitmaps collected from the changesets and the batches of the senders recovery.
+// The limit is set by the --mem.limit flag, 0 means no limit.
+var Memory = NewMemoryAccountant(0)
+
+// minSpillSize is the smallest buffer a collector spills to disk because the memory limit
+// is exceeded, so the collectors holding little memory don't produce lots of tiny files
+const minSpillSize = 16 * datasize.MB
+
+// memoryAccountingStep is how much a collector buffer grows before the growth is accounted
+const memoryAccountingStep = uint64(datasize.MB)
+
+// MemoryAccountant keeps track of the memory held by the stage buffers against a global limit.
+// When the limit is exceeded, the collectors spill their buffers to disk before they reach
+// their optimal size, and the batches wait for the memory held by them to be released.
+type MemoryAccountant struct {
+	lock     sync.Mutex
+	limit    uint64
+	used     uint64
+	released chan struct{} // closed and replaced every time some memory is released
+}
+
+func NewMemoryAccountant(limit datasize.ByteSize) *MemoryAccountant {
+	return &MemoryAccountant{limit: uint64(limit), released: make(chan struct{})}
+}
+
+// SetLimit changes the limit, 0 means no limit
+func (a *MemoryAccountant) SetLimit(limit datasize.ByteSize) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.limit = uint64(limit)
+	a.notify()
+}
+
+// Limit returns the limit, 0 means no limit
+func (a *MemoryAccountant) Limit() datasize.ByteSize {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return datasize.ByteSize(a.limit)
+}
+
+// Used returns the amount of memory held by all the reservations
+func (a *MemoryAccountant) Used() datasize.ByteSize {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return datasize.ByteSize(a.used)
+}
+
+// Exceeded returns whether the reservations hold more memory than the limit
+func (a *MemoryAccountant) Exceeded() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.limit > 0 && a.used > a.limit
+}
+
+// NewReservation creates an empty reservation, the part of the memory held by one buffer
+func (a *MemoryAccountant) NewReservation() *Reservation {
+	return &Reservation{accountant: a}
+}
+
+// notify wakes up the reservations waiting for the memory, must be called under the lock
+func (a *MemoryAccountant) notify() {
+	close(a.released)
+	a.released = make(chan struct{})
+}
+
+// Reservation is the part of the memory budget held by one buffer.
+// It is not safe for concurrent use, except for Wait and Release called from different goroutines.
+type Reservation struct {
+	accountant *MemoryAccountant
+	held       uint64
+}
+
+// Exceeded returns whether the reservations of the accountant hold more memory than the limit
+func (r *Reservation) Exceeded() bool {
+	return r.accountant.Exceeded()
+}
+
+// Held returns the amount of memory held by the reservation
+func (r *Reservation) Held() uint64 {
+	r.accountant.lock.Lock()
+	defer r.accountant.lock.Unlock()
+	return r.held
+}
+
+// Grow accounts n more bytes held by the buffer, even if the limit gets exceeded.
+// The buffer is expected to check Exceeded and spill or shrink itself.
+func (r *Reservation) Grow(n uint64) {
+	a := r.accountant
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.used += n
+	r.held += n
+}
+
+// Wait accounts n more bytes held by the buffer, blocking while they don't fit into the limit.
+// A reservation which holds nothing is never blocked, so a single item always gets through
+// and a batch waiting for its own items to be released shrinks down to one item at worst.
+func (r *Reservation) Wait(n uint64, quit <-chan struct{}) error {
+	a := r.accountant
+	for {
+		a.lock.Lock()
+		if a.limit == 0 || a.used+n <= a.limit || r.held == 0 {
+			a.used += n
+			r.held += n
+			a.lock.Unlock()
+			return nil
+		}
+		released := a.released
+		a.lock.Unlock()
+		select {
+		case <-released:
+		case <-quit:
+			return common.ErrStopped
+		}
+	}
+}
+
+// Release gives n bytes held by the buffer back
+func (r *Reservation) Release(n uint64) {
+	a := r.accountant
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if n > r.held {
+		n = r.held
+	}
+	a.used -= n
+	r.held -= n
+	a.notify()
+}
+
+// ReleaseAll gives all the memory held by the buffer back
+func (r *Reservation) ReleaseAll() {
+	a := r.accountant
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if r.held == 0 {
+		return
+	}
+	a.used -= r.held
+	r.held = 0
+	a.notify()
+}
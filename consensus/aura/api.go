@@ -0,0 +1,63 @@
+package aura
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// API is a user facing RPC API to inspect the validators and the finality of the Authority Round and to take the
+// reports of the misbehaving validators.
+type API struct {
+	chain consensus.ChainHeaderReader
+	aura  *AuRa
+}
+
+// GetValidators retrieves the validators of the given block, in the order of their turns.
+func (api *API) GetValidators(number *rpc.BlockNumber) ([]common.Address, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil || header.Number.Sign() == 0 {
+		return nil, errUnknownBlock
+	}
+	return api.aura.validators.Validators(header.Number.Uint64(), header.ParentHash)
+}
+
+// FinalizedBlock is the last block sealed or followed by more than half of the validators
+type FinalizedBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+// GetFinalized retrieves the last finalized block, nil before the first one is finalized.
+func (api *API) GetFinalized() *FinalizedBlock {
+	number, hash, ok := api.aura.finality.finalized()
+	if !ok {
+		return nil
+	}
+	return &FinalizedBlock{Number: hexutil.Uint64(number), Hash: hash}
+}
+
+// ReportCall is a report of a misbehaving validator with the call of the reporting contract to send it with
+type ReportCall struct {
+	Report
+	Data hexutil.Bytes `json:"data"`
+}
+
+// TakeReports retrieves the reports of the misbehaving validators collected by the verification and forgets them.
+// The validators of the reporting contracts send the calls to report them.
+func (api *API) TakeReports() []ReportCall {
+	reports := api.aura.reports.take()
+	calls := make([]ReportCall, len(reports))
+	for i := range reports {
+		calls[i] = ReportCall{Report: reports[i], Data: reports[i].CallData()}
+	}
+	return calls
+}
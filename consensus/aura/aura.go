@@ -0,0 +1,551 @@
+// Package aura implements the Authority Round proof-of-authority consensus engine of OpenEthereum, used by xDai and
+// the POA networks. The time is divided in the steps of a fixed duration and the validators take turns to seal the
+// blocks, one step each. The step and the signature of the author are the two seal fields of the header, in place of
+// the mix digest and the nonce.
+//
+// The validators are the fixed list, the list returned by a contract, or the sets switched to at the blocks. The
+// lists of the contracts are read from the state by the execution of the blocks, so the headers downloaded ahead of
+// the execution are only checked against the contract validators known from the executed blocks. A block is final
+// once more than half of the validators have sealed it or its descendants, the engine refuses the headers reverting
+// the finalized blocks, which bounds the unwinds of the staged sync.
+package aura
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	inmemorySignatures = 4096 // Number of recent block authors to keep in memory
+	inmemoryValidators = 128  // Number of the recent validator lists of the contracts to keep in memory
+)
+
+var (
+	// maxScore is the base of the score of the blocks in the difficulty, U128::max of OpenEthereum
+	maxScore = new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 128), common.Big1)
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+)
+
+// Various error messages to mark blocks invalid.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a block
+	// that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidSeal is returned if the seal fields of the header aren't the step and the
+	// 65 bytes signature.
+	errInvalidSeal = errors.New("seal fields are not the step and the signature")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidStep is returned if the step of a block isn't greater than the step of its parent.
+	errInvalidStep = errors.New("step not greater than the parent's step")
+
+	// errFutureStep is returned if the step of a block is more than one step ahead of the local time.
+	errFutureStep = errors.New("step in the future")
+
+	// errWrongDifficulty is returned if the difficulty of a block isn't the score of its step.
+	errWrongDifficulty = errors.New("wrong difficulty")
+
+	// errUnauthorizedSigner is returned if a header isn't signed by the proposer of its step.
+	errUnauthorizedSigner = errors.New("unauthorized signer")
+
+	// errFinalityReverted is returned if a header is on a fork below the finalized block.
+	errFinalityReverted = errors.New("fork below the finalized block")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer common.Address, message []byte) ([]byte, error)
+
+// AuRa is the Authority Round proof-of-authority consensus engine
+type AuRa struct {
+	config     *params.AuRaConfig // Consensus engine configuration parameters
+	db         ethdb.Database     // Database the engine was created for, not used by the verification
+	validators validatorSet       // Validators by the blocks
+
+	signatures *lru.ARCCache // Authors of the recent blocks to speed up the verification
+	finality   *rollingFinality
+	reports    *reporter
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer fields
+
+	now func() time.Time // Local time, replaced by the tests
+}
+
+// New creates an AuRa proof-of-authority consensus engine with the validators of the config
+func New(config *params.AuRaConfig, db ethdb.Database) *AuRa {
+	conf := *config
+	if conf.StepDuration == 0 {
+		conf.StepDuration = 5
+	}
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	return &AuRa{
+		config:     &conf,
+		db:         db,
+		validators: newValidatorSet(conf.Validators),
+		signatures: signatures,
+		finality:   newRollingFinality(),
+		reports:    newReporter(),
+		now:        time.Now,
+	}
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the signature in the seal of the header.
+func (a *AuRa) Author(header *types.Header) (common.Address, error) {
+	hash := header.Hash()
+	if address, known := a.signatures.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	_, signature, err := headerSeal(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	a.signatures.Add(hash, signer)
+	return signer, nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (a *AuRa) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return a.verifyHeader(chain, header, nil, seal)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (a *AuRa) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (func(), <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+	wg := &sync.WaitGroup{}
+	cancel := func() {
+		close(abort)
+		wg.Wait()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, header := range headers {
+			err := a.verifyHeader(chain, header, headers[:i], seals[i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return cancel, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database.
+func (a *AuRa) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, seal bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	step, _, err := headerSeal(header)
+	if err != nil {
+		return err
+	}
+	// Don't waste time checking blocks from the future, one step of the clock drift is tolerated
+	if step > a.currentStep()+1 {
+		return errFutureStep
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in PoA
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Verify that the gas limit is <= 2^63-1
+	cap := uint64(0x7fffffffffffffff)
+	if header.GasLimit > cap {
+		return fmt.Errorf("invalid gasLimit: have %v, max %v", header.GasLimit, cap)
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	if err = misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	// The genesis has no seal, its step is 0
+	var parentStep uint64
+	if number > 1 {
+		if parentStep, _, err = headerSeal(parent); err != nil {
+			return err
+		}
+	}
+	if step <= parentStep {
+		return errInvalidStep
+	}
+	if header.Difficulty == nil || header.Difficulty.Cmp(calcScore(parentStep, step)) != 0 {
+		return errWrongDifficulty
+	}
+	if header.Time <= parent.Time {
+		return fmt.Errorf("invalid timestamp: have %d, parent %d", header.Time, parent.Time)
+	}
+	// Verify the base fee, which must be present only after the EIP-1559 fork
+	if !chain.Config().IsLondon(header.Number) {
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+		if err = verifyGasLimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err = misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		return err
+	}
+	if err = a.verifyFinality(chain, header); err != nil {
+		return err
+	}
+	if !seal {
+		return nil
+	}
+	return a.verifySeal(header, parent, parentStep, step)
+}
+
+// verifyFinality checks that the header isn't on a fork of the canonical chain below the finalized block
+func (a *AuRa) verifyFinality(chain consensus.ChainHeaderReader, header *types.Header) error {
+	finalized, finalizedHash, ok := a.finality.finalized()
+	number := header.Number.Uint64()
+	if !ok || number > finalized {
+		return nil
+	}
+	if number == finalized {
+		if header.Hash() != finalizedHash {
+			return errFinalityReverted
+		}
+		return nil
+	}
+	if canonical := chain.GetHeaderByNumber(number); canonical != nil && canonical.Hash() != header.Hash() {
+		return errFinalityReverted
+	}
+	return nil
+}
+
+// verifySeal checks that the header is signed by the proposer of its step, reporting the validators which missed
+// their steps since the parent and the ones which signed two blocks in a step, and tracks the finality
+func (a *AuRa) verifySeal(header, parent *types.Header, parentStep, step uint64) error {
+	number := header.Number.Uint64()
+	validators, err := a.validators.Validators(number, header.ParentHash)
+	if err != nil {
+		return err
+	}
+	signer, err := a.Author(header)
+	if err != nil {
+		return err
+	}
+	if validators == nil {
+		log.Trace("Validators of the block not known yet, not verifying the proposer", "number", number)
+		return nil
+	}
+	if proposer := validators[step%uint64(len(validators))]; signer != proposer {
+		return errUnauthorizedSigner
+	}
+	a.reports.signed(header, signer, step)
+	// The step of the genesis is 0, the steps before the first block aren't missed
+	for missed := parentStep + 1; number > 1 && missed < step && missed < parentStep+uint64(len(validators)); missed++ {
+		a.reports.benign(validators[missed%uint64(len(validators))], number)
+	}
+	a.finality.push(parent.Hash(), header, signer, len(validators))
+	return nil
+}
+
+// verifyGasLimit checks that the gas limit changed from the parent's within the bounds of the protocol
+func verifyGasLimit(parentGasLimit, gasLimit uint64) error {
+	diff := int64(parentGasLimit) - int64(gasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parentGasLimit / params.GasLimitBoundDivisor
+	if uint64(diff) >= limit || gasLimit < params.MinGasLimit {
+		return fmt.Errorf("invalid gas limit: have %d, want %d += %d", gasLimit, parentGasLimit, limit)
+	}
+	return nil
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (a *AuRa) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing the step of the header and its score for running the
+// transactions on top. The signature is set by Seal
+func (a *AuRa) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	var parentStep uint64
+	if number > 1 {
+		var err error
+		if parentStep, _, err = headerSeal(parent); err != nil {
+			return err
+		}
+	}
+	step := a.currentStep()
+	if step <= parentStep {
+		step = parentStep + 1
+	}
+	header.Time = step * a.config.StepDuration
+	if header.Time <= parent.Time {
+		header.Time = parent.Time + 1
+	}
+	header.Difficulty = calcScore(parentStep, step)
+	header.MixDigest = common.Hash{}
+	header.Nonce = types.BlockNonce{}
+	return setSeal(header, step, make([]byte, crypto.SignatureLength))
+}
+
+// Finalize implements consensus.Engine, crediting the block reward to the author and reading the validators of the
+// next block from the contract
+func (a *AuRa) Finalize(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) {
+	if a.config.BlockReward != nil && header.Number.Sign() > 0 {
+		reward, _ := uint256.FromBig(a.config.BlockReward)
+		state.AddBalance(header.Coinbase, reward)
+	}
+	header.UncleHash = types.CalcUncleHash(nil)
+	if err := a.validators.onBlock(chainConfig, header, state); err != nil {
+		log.Warn("Could not read the validators of the next block", "number", header.Number, "err", err)
+	}
+}
+
+// FinalizeAndAssemble implements consensus.Engine, crediting the block reward and returning the final block.
+func (a *AuRa) FinalizeAndAssemble(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	a.Finalize(chainConfig, header, state, txs, uncles)
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+// Authorize injects a private key into the consensus engine to mint new blocks
+// with.
+func (a *AuRa) Authorize(signer common.Address, signFn SignerFn) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.signer = signer
+	a.signFn = signFn
+}
+
+// Seal implements consensus.Engine, signing the block when the local signer is the proposer of its step, at the
+// beginning of the step
+func (a *AuRa) Seal(ctx consensus.Cancel, chain consensus.ChainHeaderReader, block *types.Block, results chan<- consensus.ResultWithContext, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Don't hold the signer fields for the entire sealing procedure
+	a.lock.RLock()
+	signer, signFn := a.signer, a.signFn
+	a.lock.RUnlock()
+
+	step, _, err := headerSeal(header)
+	if err != nil {
+		return err
+	}
+	validators, err := a.validators.Validators(number, header.ParentHash)
+	if err != nil {
+		return err
+	}
+	if len(validators) == 0 {
+		return errUnauthorizedSigner
+	}
+	if validators[step%uint64(len(validators))] != signer {
+		log.Trace("Not the proposer of the step", "step", step, "number", number)
+		return nil
+	}
+	sighash, err := signFn(signer, AuRaRLP(header))
+	if err != nil {
+		return err
+	}
+	if err = setSeal(header, step, sighash); err != nil {
+		return err
+	}
+	delay := time.Unix(int64(step*a.config.StepDuration), 0).Sub(a.now()) // nolint: gosimple
+	log.Trace("Waiting for the step to sign and propagate", "delay", common.PrettyDuration(delay))
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		select {
+		case results <- consensus.ResultWithContext{Cancel: ctx, Block: block.WithSeal(header)}:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
+		}
+	}()
+	return nil
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm, it returns the score of the next step after the parent's
+func (a *AuRa) CalcDifficulty(chain consensus.ChainHeaderReader, _, _ uint64, _, parentNumber *big.Int, parentHash, _ common.Hash) *big.Int {
+	var parentStep uint64
+	if parentNumber.Sign() > 0 {
+		parent := chain.GetHeader(parentHash, parentNumber.Uint64())
+		if parent == nil {
+			return nil
+		}
+		var err error
+		if parentStep, _, err = headerSeal(parent); err != nil {
+			return nil
+		}
+	}
+	step := a.currentStep()
+	if step <= parentStep {
+		step = parentStep + 1
+	}
+	return calcScore(parentStep, step)
+}
+
+// calcScore returns the score of the block in the step after the parent in the parent step: U128::max plus the
+// parent step minus the step, so the chains skipping fewer steps are heavier
+func calcScore(parentStep, step uint64) *big.Int {
+	score := new(big.Int).Add(maxScore, new(big.Int).SetUint64(parentStep))
+	return score.Sub(score, new(big.Int).SetUint64(step))
+}
+
+func (a *AuRa) currentStep() uint64 {
+	return uint64(a.now().Unix()) / a.config.StepDuration
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (a *AuRa) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// Close implements consensus.Engine. It's a noop for aura as there are no background threads.
+func (a *AuRa) Close() error {
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API of the validators, the finality and the
+// reports of the misbehaviour.
+func (a *AuRa) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "aura",
+		Version:   "1.0",
+		Service:   &API{chain: chain, aura: a},
+		Public:    false,
+	}}
+}
+
+// headerSeal returns the step and the signature of the seal of the header
+func headerSeal(header *types.Header) (uint64, []byte, error) {
+	if len(header.Seal) != 2 {
+		return 0, nil, errInvalidSeal
+	}
+	var step uint64
+	if err := rlp.DecodeBytes(header.Seal[0], &step); err != nil {
+		return 0, nil, errInvalidSeal
+	}
+	var signature []byte
+	if err := rlp.DecodeBytes(header.Seal[1], &signature); err != nil || len(signature) != crypto.SignatureLength {
+		return 0, nil, errInvalidSeal
+	}
+	return step, signature, nil
+}
+
+func setSeal(header *types.Header, step uint64, signature []byte) error {
+	encodedStep, err := rlp.EncodeToBytes(step)
+	if err != nil {
+		return err
+	}
+	encodedSignature, err := rlp.EncodeToBytes(signature)
+	if err != nil {
+		return err
+	}
+	header.Seal = []rlp.RawValue{encodedStep, encodedSignature}
+	return nil
+}
+
+// SealHash returns the hash of a block prior to it being sealed, the bare hash of OpenEthereum.
+func SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+	encodeSigHeader(hasher, header)
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+// AuRaRLP returns the rlp bytes which needs to be signed for the proof-of-authority
+// sealing. The RLP to sign consists of the entire header apart from the seal fields.
+func AuRaRLP(header *types.Header) []byte {
+	b := new(bytes.Buffer)
+	encodeSigHeader(b, header)
+	return b.Bytes()
+}
+
+func encodeSigHeader(w io.Writer, header *types.Header) {
+	enc := []interface{}{
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		header.Extra,
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	if err := rlp.Encode(w, enc); err != nil {
+		panic("can't encode: " + err.Error())
+	}
+}
@@ -0,0 +1,195 @@
+package aura
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// testChain is the chain of the headers verified by the tests
+type testChain struct {
+	config    *params.ChainConfig
+	headers   map[common.Hash]*types.Header
+	canonical map[uint64]*types.Header
+}
+
+func (c *testChain) Config() *params.ChainConfig { return c.config }
+func (c *testChain) CurrentHeader() *types.Header {
+	return c.canonical[uint64(len(c.canonical)-1)]
+}
+func (c *testChain) GetHeader(hash common.Hash, _ uint64) *types.Header { return c.headers[hash] }
+func (c *testChain) GetHeaderByNumber(number uint64) *types.Header      { return c.canonical[number] }
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header     { return c.headers[hash] }
+
+func (c *testChain) insert(header *types.Header) {
+	c.headers[header.Hash()] = header
+	c.canonical[header.Number.Uint64()] = header
+}
+
+// sealHeader makes the child of the parent in the step, sealed with the key
+func sealHeader(t *testing.T, parent *types.Header, parentStep, step uint64, key *ecdsa.PrivateKey) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		UncleHash:  uncleHash,
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       step * 5,
+		Difficulty: calcScore(parentStep, step),
+		Extra:      []byte("aura"),
+	}
+	signature, err := crypto.Sign(SealHash(header).Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = setSeal(header, step, signature); err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestAuRaVerification(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	validators := make([]common.Address, len(keys))
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		validators[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	engine := New(&params.AuRaConfig{StepDuration: 5, Validators: &params.ValidatorSetConfig{List: validators}}, db)
+	engine.now = func() time.Time { return time.Unix(1000*5, 0) }
+
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(131072), GasLimit: 8000000}
+	chain := &testChain{config: params.TestChainConfig, headers: map[common.Hash]*types.Header{}, canonical: map[uint64]*types.Header{}}
+	chain.insert(genesis)
+
+	// The steps 100..103 are sealed in turns, the step 104 is missed
+	var headers []*types.Header
+	parent, parentStep := genesis, uint64(0)
+	for _, step := range []uint64{100, 101, 102, 103, 105} {
+		header := sealHeader(t, parent, parentStep, step, keys[step%3])
+		headers = append(headers, header)
+		parent, parentStep = header, step
+	}
+	seals := make([]bool, len(headers))
+	for i := range seals {
+		seals[i] = true
+	}
+	_, results := engine.VerifyHeaders(chain, headers, seals)
+	for i := range headers {
+		if err := <-results; err != nil {
+			t.Fatalf("header %d: %v", i, err)
+		}
+		chain.insert(headers[i])
+	}
+	if author, err := engine.Author(headers[0]); err != nil || author != validators[100%3] {
+		t.Errorf("author %x, want %x: %v", author, validators[100%3], err)
+	}
+
+	// Two distinct signers of three finalize the oldest block
+	finalized, finalizedHash, ok := engine.finality.finalized()
+	if !ok || finalized != 4 || finalizedHash != headers[3].Hash() {
+		t.Errorf("finalized %d %x, want 4 %x", finalized, finalizedHash, headers[3].Hash())
+	}
+	reports := engine.reports.take()
+	if len(reports) != 1 || reports[0].Malicious || reports[0].Validator != validators[104%3] || reports[0].Block != 5 {
+		t.Errorf("expected the benign report of the missed step 104, got %+v", reports)
+	}
+
+	tip, tipStep := headers[4], uint64(105)
+	tests := []struct {
+		name   string
+		header func() *types.Header
+		err    error
+	}{
+		{"wrong proposer", func() *types.Header { return sealHeader(t, tip, tipStep, 106, keys[0]) }, errUnauthorizedSigner},
+		{"same step", func() *types.Header { return sealHeader(t, tip, tipStep, 105, keys[105%3]) }, errInvalidStep},
+		{"future step", func() *types.Header { return sealHeader(t, tip, tipStep, 1002, keys[1002%3]) }, errFutureStep},
+		{"wrong difficulty", func() *types.Header {
+			header := sealHeader(t, tip, tipStep, 106, keys[106%3])
+			header.Difficulty = calcScore(tipStep, 107)
+			return header
+		}, errWrongDifficulty},
+		{"fork below finality", func() *types.Header { return sealHeader(t, headers[1], 101, 104, keys[104%3]) }, errFinalityReverted},
+		{"no seal", func() *types.Header {
+			header := sealHeader(t, tip, tipStep, 106, keys[106%3])
+			header.Seal = header.Seal[:1]
+			return header
+		}, errInvalidSeal},
+	}
+	for _, tt := range tests {
+		if err := engine.VerifyHeader(chain, tt.header(), true); !errors.Is(err, tt.err) {
+			t.Errorf("%s: have %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	// The proposer of the step 105 seals another block in the step
+	double := sealHeader(t, headers[3], 103, 105, keys[105%3])
+	double.Extra = []byte("double")
+	signature, _ := crypto.Sign(SealHash(double).Bytes(), keys[105%3])
+	if err := setSeal(double, 105, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifyHeader(chain, double, true); err != nil {
+		t.Fatal(err)
+	}
+	reports = engine.reports.take()
+	if len(reports) != 2 || !reports[0].Malicious || reports[0].Validator != validators[105%3] {
+		t.Fatalf("expected the malicious report of the step 105, got %+v", reports)
+	}
+	var proof []*types.Header
+	if err := rlp.DecodeBytes(reports[0].Proof, &proof); err != nil || len(proof) != 2 || proof[0].Hash() != headers[4].Hash() || proof[1].Hash() != double.Hash() {
+		t.Errorf("wrong proof of the double signing: %v", err)
+	}
+	if data := reports[0].CallData(); !equalPrefix(data, reportMaliciousSelector) || len(data)%32 != 4 {
+		t.Errorf("wrong call of the malicious report %x", data)
+	}
+}
+
+func equalPrefix(data, prefix []byte) bool {
+	return len(data) >= len(prefix) && string(data[:len(prefix)]) == string(prefix)
+}
+
+func TestMultiValidatorSet(t *testing.T) {
+	first, second := []common.Address{{1}}, []common.Address{{2}, {3}}
+	set := newValidatorSet(&params.ValidatorSetConfig{Multi: map[uint64]*params.ValidatorSetConfig{
+		0:  {List: first},
+		10: {List: second},
+	}})
+	for number, want := range map[uint64][]common.Address{1: first, 10: first, 11: second, 100: second} {
+		have, err := set.Validators(number, common.Hash{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(have) != len(want) || have[0] != want[0] {
+			t.Errorf("block %d: validators %x, want %x", number, have, want)
+		}
+	}
+}
+
+func TestDecodeAddresses(t *testing.T) {
+	// getValidators() returning [0x01.., 0x02..]
+	ret := make([]byte, 4*32)
+	ret[31] = 0x20
+	ret[63] = 2
+	ret[64+31], ret[96+31] = 1, 2
+	addresses, err := decodeAddresses(ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses) != 2 || addresses[0] != common.HexToAddress("0x01") || addresses[1] != common.HexToAddress("0x02") {
+		t.Errorf("decoded %x", addresses)
+	}
+	if _, err = decodeAddresses(ret[:3*32]); err == nil {
+		t.Errorf("decoded the truncated list")
+	}
+}
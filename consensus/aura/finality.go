@@ -0,0 +1,78 @@
+package aura
+
+import (
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// maxUnfinalized bounds the blocks tracked by the finality while less than half of the validators seal
+const maxUnfinalized = 4096
+
+type finalityEntry struct {
+	number uint64
+	hash   common.Hash
+	signer common.Address
+}
+
+// rollingFinality tracks the chain of the verified blocks which aren't final yet, the RollingFinality of
+// OpenEthereum: the oldest block is final when the distinct signers of it and its descendants are more than half of
+// the validators. The chain restarts from the block which doesn't extend it, the finalized block stays
+type rollingFinality struct {
+	lock      sync.Mutex
+	headers   []finalityEntry // ascending
+	signCount map[common.Address]int
+
+	last          common.Hash // the block the next one has to extend
+	hasFinalized  bool
+	finalizedNum  uint64
+	finalizedHash common.Hash
+}
+
+func newRollingFinality() *rollingFinality {
+	return &rollingFinality{signCount: make(map[common.Address]int)}
+}
+
+// push adds the block sealed by the signer, finalizing the oldest blocks
+func (f *rollingFinality) push(parentHash common.Hash, header *types.Header, signer common.Address, validators int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	hash := header.Hash()
+	if hash == f.last {
+		return
+	}
+	if len(f.headers) > 0 && parentHash != f.last {
+		f.headers, f.signCount = nil, make(map[common.Address]int)
+	}
+	f.headers = append(f.headers, finalityEntry{number: header.Number.Uint64(), hash: hash, signer: signer})
+	f.signCount[signer]++
+	f.last = hash
+	for len(f.signCount)*2 > validators {
+		f.finalize()
+	}
+	for len(f.headers) > maxUnfinalized {
+		f.pop()
+	}
+}
+
+func (f *rollingFinality) finalize() {
+	oldest := f.pop()
+	f.hasFinalized, f.finalizedNum, f.finalizedHash = true, oldest.number, oldest.hash
+}
+
+func (f *rollingFinality) pop() finalityEntry {
+	oldest := f.headers[0]
+	f.headers = f.headers[1:]
+	if f.signCount[oldest.signer]--; f.signCount[oldest.signer] == 0 {
+		delete(f.signCount, oldest.signer)
+	}
+	return oldest
+}
+
+// finalized returns the last finalized block, ok is false until a block is finalized
+func (f *rollingFinality) finalized() (number uint64, hash common.Hash, ok bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.finalizedNum, f.finalizedHash, f.hasFinalized
+}
@@ -0,0 +1,121 @@
+package aura
+
+import (
+	"encoding/binary"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+const (
+	maxPendingReports = 1024 // Number of the newest reports kept until they are taken
+	inmemorySteps     = 4096 // Number of the recent steps remembered to detect the double signing
+)
+
+var (
+	reportBenignSelector    = crypto.Keccak256([]byte("reportBenign(address,uint256)"))[:4]
+	reportMaliciousSelector = crypto.Keccak256([]byte("reportMalicious(address,uint256,bytes)"))[:4]
+)
+
+// Report is a misbehaviour of a validator: a missed step, benign, or two blocks sealed in a step, malicious, with the
+// RLP list of the two headers as the proof
+type Report struct {
+	Validator common.Address `json:"validator"`
+	Block     uint64         `json:"block"`
+	Malicious bool           `json:"malicious"`
+	Proof     hexutil.Bytes  `json:"proof,omitempty"`
+}
+
+// CallData returns the call of reportBenign(address,uint256) or reportMalicious(address,uint256,bytes) of the
+// reporting validator contract, sent by a validator
+func (r *Report) CallData() []byte {
+	data := make([]byte, 4, 4+3*32+32+len(r.Proof)+31)
+	if r.Malicious {
+		copy(data, reportMaliciousSelector)
+	} else {
+		copy(data, reportBenignSelector)
+	}
+	data = append(data, common.LeftPadBytes(r.Validator[:], 32)...)
+	data = append(data, uint256Word(r.Block)...)
+	if !r.Malicious {
+		return data
+	}
+	data = append(data, uint256Word(3*32)...) // offset of the proof
+	data = append(data, uint256Word(uint64(len(r.Proof)))...)
+	data = append(data, r.Proof...)
+	if rem := len(r.Proof) % 32; rem != 0 {
+		data = append(data, make([]byte, 32-rem)...)
+	}
+	return data
+}
+
+func uint256Word(x uint64) []byte {
+	word := make([]byte, 32)
+	binary.BigEndian.PutUint64(word[24:], x)
+	return word
+}
+
+// reporter collects the reports of the verified headers until they are taken
+type reporter struct {
+	lock    sync.Mutex
+	pending []Report
+	steps   *lru.ARCCache // signer + step -> the header sealed in the step
+}
+
+func newReporter() *reporter {
+	steps, _ := lru.NewARC(inmemorySteps)
+	return &reporter{steps: steps}
+}
+
+// signed records the header sealed by the signer in the step, reporting the signer when it sealed another header in
+// the same step
+func (r *reporter) signed(header *types.Header, signer common.Address, step uint64) {
+	key := make([]byte, common.AddressLength+8)
+	copy(key, signer[:])
+	binary.BigEndian.PutUint64(key[common.AddressLength:], step)
+	previous, ok := r.steps.Get(string(key))
+	if !ok {
+		r.steps.Add(string(key), header)
+		return
+	}
+	if previous.(*types.Header).Hash() == header.Hash() {
+		return
+	}
+	proof, err := rlp.EncodeToBytes([]*types.Header{previous.(*types.Header), header})
+	if err != nil {
+		log.Warn("Could not encode the proof of the double signing", "err", err)
+		return
+	}
+	log.Warn("Validator sealed two blocks in a step", "validator", signer, "step", step, "number", header.Number)
+	r.add(Report{Validator: signer, Block: header.Number.Uint64(), Malicious: true, Proof: proof})
+}
+
+// benign reports the validator which missed its step before the block
+func (r *reporter) benign(validator common.Address, number uint64) {
+	log.Debug("Validator missed its step", "validator", validator, "number", number)
+	r.add(Report{Validator: validator, Block: number})
+}
+
+func (r *reporter) add(report Report) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.pending = append(r.pending, report)
+	if len(r.pending) > maxPendingReports {
+		r.pending = r.pending[len(r.pending)-maxPendingReports:]
+	}
+}
+
+// take returns the pending reports and forgets them
+func (r *reporter) take() []Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	reports := r.pending
+	r.pending = nil
+	return reports
+}
@@ -0,0 +1,167 @@
+package aura
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// systemAddress is the caller of the system calls of the engine to the validator contracts, as in OpenEthereum
+var systemAddress = common.HexToAddress("0xfffffffffffffffffffffffffffffffffffffffe")
+
+// getValidatorsSelector is the selector of getValidators() returning address[]
+var getValidatorsSelector = crypto.Keccak256([]byte("getValidators()"))[:4]
+
+// validatorSet is the set of the validators by the blocks
+type validatorSet interface {
+	// Validators returns the validators of the block with the number and the parent in the order of their turns,
+	// nil when the set is read from a contract by the execution of the parent which didn't happen yet
+	Validators(number uint64, parentHash common.Hash) ([]common.Address, error)
+
+	// onBlock is called by the execution of the block with the state after it, the validators of its children are
+	// read from the state
+	onBlock(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState) error
+}
+
+func newValidatorSet(config *params.ValidatorSetConfig) validatorSet {
+	switch {
+	case config == nil:
+		return &listSet{}
+	case len(config.Multi) > 0:
+		multi := &multiSet{sets: make(map[uint64]validatorSet, len(config.Multi))}
+		for after, set := range config.Multi {
+			multi.transitions = append(multi.transitions, after)
+			multi.sets[after] = newValidatorSet(set)
+		}
+		sort.Slice(multi.transitions, func(i, j int) bool { return multi.transitions[i] < multi.transitions[j] })
+		return multi
+	case config.SafeContract != nil:
+		return newContractSet(*config.SafeContract)
+	case config.Contract != nil:
+		return newContractSet(*config.Contract)
+	}
+	return &listSet{validators: config.List}
+}
+
+// listSet is the fixed list of the validators
+type listSet struct {
+	validators []common.Address
+}
+
+func (s *listSet) Validators(uint64, common.Hash) ([]common.Address, error) {
+	return s.validators, nil
+}
+
+func (s *listSet) onBlock(*params.ChainConfig, *types.Header, *state.IntraBlockState) error {
+	return nil
+}
+
+// multiSet switches between the sets after the blocks of the transitions
+type multiSet struct {
+	transitions []uint64 // ascending
+	sets        map[uint64]validatorSet
+}
+
+// set returns the set of the block with the number, the one of the last transition at or before its parent
+func (s *multiSet) set(number uint64) validatorSet {
+	i := sort.Search(len(s.transitions), func(i int) bool { return s.transitions[i] >= number })
+	if i == 0 {
+		// The first set also applies before its transition
+		return s.sets[s.transitions[0]]
+	}
+	return s.sets[s.transitions[i-1]]
+}
+
+func (s *multiSet) Validators(number uint64, parentHash common.Hash) ([]common.Address, error) {
+	return s.set(number).Validators(number, parentHash)
+}
+
+func (s *multiSet) onBlock(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState) error {
+	// The child of the block is the one the set applies to
+	return s.set(header.Number.Uint64()+1).onBlock(chainConfig, header, state)
+}
+
+// contractSet is the list returned by getValidators() of the contract, read with the state after the parent of the
+// block. The lists are known for the recently executed blocks
+type contractSet struct {
+	address common.Address
+	lists   *lru.ARCCache // block hash -> the validators of its children
+}
+
+func newContractSet(address common.Address) *contractSet {
+	lists, _ := lru.NewARC(inmemoryValidators)
+	return &contractSet{address: address, lists: lists}
+}
+
+func (s *contractSet) Validators(_ uint64, parentHash common.Hash) ([]common.Address, error) {
+	if list, ok := s.lists.Get(parentHash); ok {
+		return list.([]common.Address), nil
+	}
+	return nil, nil
+}
+
+func (s *contractSet) onBlock(chainConfig *params.ChainConfig, header *types.Header, ibs *state.IntraBlockState) error {
+	ret, err := systemCall(chainConfig, header, ibs, s.address, getValidatorsSelector)
+	if err != nil {
+		return err
+	}
+	list, err := decodeAddresses(ret)
+	if err != nil {
+		return err
+	}
+	s.lists.Add(header.Hash(), list)
+	return nil
+}
+
+// systemCall calls the contract from the system address without changing the state
+func systemCall(chainConfig *params.ChainConfig, header *types.Header, ibs *state.IntraBlockState, contract common.Address, data []byte) ([]byte, error) {
+	blockCtx := vm.BlockContext{
+		CanTransfer: func(vm.IntraBlockState, common.Address, *uint256.Int) bool { return true },
+		Transfer:    func(vm.IntraBlockState, common.Address, common.Address, *uint256.Int, bool) {},
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Coinbase:    header.Coinbase,
+		GasLimit:    math.MaxUint64,
+		BlockNumber: new(big.Int).Set(header.Number),
+		Time:        new(big.Int).SetUint64(header.Time),
+		Difficulty:  new(big.Int).Set(header.Difficulty),
+		BaseFee:     header.BaseFee,
+	}
+	evm := vm.NewEVM(blockCtx, vm.TxContext{Origin: systemAddress, GasPrice: new(big.Int)}, ibs, chainConfig, vm.Config{NoBaseFee: true})
+	ret, _, err := evm.StaticCall(vm.AccountRef(systemAddress), contract, data, math.MaxUint64/2)
+	if err != nil {
+		return nil, fmt.Errorf("system call to %x: %w", contract, err)
+	}
+	return ret, nil
+}
+
+// decodeAddresses decodes the ABI encoding of address[]
+func decodeAddresses(ret []byte) ([]common.Address, error) {
+	if len(ret) < 64 {
+		return nil, fmt.Errorf("address[] of %d bytes", len(ret))
+	}
+	offset := new(big.Int).SetBytes(ret[:32])
+	if !offset.IsUint64() || offset.Uint64()+32 > uint64(len(ret)) {
+		return nil, fmt.Errorf("address[] offset %d out of %d bytes", offset, len(ret))
+	}
+	data := ret[offset.Uint64():]
+	count := binary.BigEndian.Uint64(data[24:32])
+	if new(big.Int).SetBytes(data[:24]).Sign() != 0 || count > uint64(len(data)-32)/32 {
+		return nil, fmt.Errorf("address[] of %x elements out of %d bytes", data[:32], len(ret))
+	}
+	addresses := make([]common.Address, count)
+	for i := range addresses {
+		copy(addresses[i][:], data[32+32*i+12:32+32*(i+1)])
+	}
+	return addresses, nil
+}
@@ -0,0 +1,81 @@
+package bor
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// API is a user facing RPC API to inspect the validators and the producers of the bor chain.
+type API struct {
+	chain consensus.ChainHeaderReader
+	bor   *Bor
+}
+
+// header retrieves the requested header, the current one if none is requested.
+func (api *API) header(number *rpc.BlockNumber) (*types.Header, error) {
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return header, nil
+}
+
+// GetSnapshot retrieves the validator set snapshot at a given block.
+func (api *API) GetSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.bor.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// GetAuthor retrieves the producer of a given block.
+func (api *API) GetAuthor(number *rpc.BlockNumber) (*common.Address, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	author, err := api.bor.Author(header)
+	if err != nil {
+		return nil, err
+	}
+	return &author, nil
+}
+
+// GetSigners retrieves the list of the validators at the specified block.
+func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
+	snap, err := api.GetSnapshot(number)
+	if err != nil {
+		return nil, err
+	}
+	return snap.signers(), nil
+}
+
+// GetCurrentProposer retrieves the proposer of the block following the current one.
+func (api *API) GetCurrentProposer() (common.Address, error) {
+	snap, err := api.GetSnapshot(nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	proposer := snap.ValidatorSet.GetProposer()
+	if proposer == nil {
+		return common.Address{}, errUnauthorizedProposer
+	}
+	return proposer.Address, nil
+}
+
+// GetCurrentValidators retrieves the validators of the current block with their voting powers and priorities.
+func (api *API) GetCurrentValidators() ([]*Validator, error) {
+	snap, err := api.GetSnapshot(nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ValidatorSet.Copy().Validators, nil
+}
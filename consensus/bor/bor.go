@@ -0,0 +1,785 @@
+// Package bor implements the proof-of-stake consensus engine of Polygon: the
+// validators of the spans are selected by Heimdall, the producer of a sprint
+// is the validator with the highest priority and the state sync events of the
+// root chain are committed by the system calls at the start of every sprint.
+package bor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+)
+
+// Bor protocol constants.
+var (
+	extraVanity = 32                     // Fixed number of extra-data prefix bytes reserved for signer vanity
+	extraSeal   = crypto.SignatureLength // Fixed number of extra-data suffix bytes reserved for signer seal
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a block
+	// that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errMissingVanity is returned if a block's extra-data section is shorter than
+	// 32 bytes, which is required to store the signer vanity.
+	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
+
+	// errMissingSignature is returned if a block's extra-data section doesn't seem
+	// to contain a 65 byte secp256k1 signature.
+	errMissingSignature = errors.New("extra-data 65 byte signature suffix missing")
+
+	// errExtraValidators is returned if a block which isn't the last of a sprint
+	// contains validator data in its extra-data field.
+	errExtraValidators = errors.New("non-sprint-end block contains extra validator list")
+
+	// errInvalidSpanValidators is returned if the last block of a sprint contains an
+	// invalid list of validators (i.e. non divisible by 40 bytes).
+	errInvalidSpanValidators = errors.New("invalid validator list on sprint end block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is non-zero.
+	errInvalidMixDigest = errors.New("non-zero mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is missing.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errWrongDifficulty is returned if the difficulty of a block doesn't match the
+	// succession of the signer.
+	errWrongDifficulty = errors.New("wrong difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errBlockTooSoon is returned if a block is sealed before the delay of the
+	// succession of its signer.
+	errBlockTooSoon = errors.New("block sealed too soon")
+
+	// errInvalidVotingChain is returned if the validator set is attempted to be
+	// modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorizedSigner is returned if a header is signed by a non-validator.
+	errUnauthorizedSigner = errors.New("unauthorized signer")
+
+	// errUnauthorizedProposer is returned if the validator set has no proposer.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+)
+
+// SignerFn hashes and signs the data to be signed by a backing account.
+type SignerFn func(signer common.Address, message []byte) ([]byte, error)
+
+// ecrecover extracts the Ethereum account address from a signed header.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := header.Hash()
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data
+	if len(header.Extra) < extraSeal {
+		return common.Address{}, errMissingSignature
+	}
+	signature := header.Extra[len(header.Extra)-extraSeal:]
+
+	// Recover the public key and the Ethereum address
+	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// CalcProducerDelay returns the minimal delay of the block after its parent: the producer delay at the start of a
+// sprint and the period otherwise, plus the backup multiplier for every turn the signer is behind the proposer
+func CalcProducerDelay(number uint64, succession int, c *params.BorConfig) uint64 {
+	delay := c.Period
+	if c.IsSprintStart(number) {
+		delay = c.ProducerDelay
+	}
+	if succession > 0 {
+		delay += uint64(succession) * c.BackupMultiplier
+	}
+	return delay
+}
+
+// Bor is the proof-of-stake consensus engine of Polygon
+type Bor struct {
+	chainConfig *params.ChainConfig // Chain configuration the system calls are executed with
+	config      *params.BorConfig   // Consensus engine configuration parameters
+	db          ethdb.Database      // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+
+	heimdall HeimdallClient     // Client of Heimdall, nil when running without it
+	ctx      context.Context    // Context of the requests to Heimdall, cancelled by Close
+	cancel   context.CancelFunc // Cancels the requests to Heimdall
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer fields
+
+	// The fields below are for testing only
+	fakeDiff bool // Skip difficulty verifications
+}
+
+// New creates a Bor consensus engine. Without the Heimdall client the validators are taken from the genesis and
+// neither the spans nor the state sync events are committed, which only suits the devnets
+func New(chainConfig *params.ChainConfig, db ethdb.Database, heimdall HeimdallClient) *Bor {
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Bor{
+		chainConfig: chainConfig,
+		config:      chainConfig.Bor,
+		db:          db,
+		recents:     recents,
+		signatures:  signatures,
+		heimdall:    heimdall,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the signature in the header's extra-data section.
+func (c *Bor) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, c.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (c *Bor) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return c.verifyHeader(chain, header, nil)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (c *Bor) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (func(), <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+	wg := &sync.WaitGroup{}
+	cancel := func() {
+		close(abort)
+		wg.Wait()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, header := range headers {
+			err := c.verifyHeader(chain, header, headers[:i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return cancel, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database.
+func (c *Bor) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	// Check that the extra-data contains both the vanity and signature
+	if len(header.Extra) < extraVanity {
+		return errMissingVanity
+	}
+	if len(header.Extra) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	// Ensure that the extra-data contains the validators at the end of a sprint, but none otherwise
+	sprintEnd := c.config.IsSprintStart(number + 1)
+	validatorsBytes := len(header.Extra) - extraVanity - extraSeal
+	if !sprintEnd && validatorsBytes != 0 {
+		return errExtraValidators
+	}
+	if sprintEnd && validatorsBytes%validatorHeaderBytesLength != 0 {
+		return errInvalidSpanValidators
+	}
+	// Ensure that the mix digest is zero as we don't have fork protection currently
+	if header.MixDigest != (common.Hash{}) {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in PoS
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	// Ensure that the block's difficulty is set (checked against the succession by the seal)
+	if number > 0 && header.Difficulty == nil {
+		return errInvalidDifficulty
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return c.verifyCascadingFields(chain, header, parents)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers.
+func (c *Bor) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	if parent.Time+c.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gasUsed: have %d, gasLimit %d", header.GasUsed, header.GasLimit)
+	}
+	// Verify the base fee, which must be present only after the EIP-1559 fork
+	if !chain.Config().IsLondon(header.Number) {
+		if header.BaseFee != nil {
+			return fmt.Errorf("invalid baseFee before fork: have %d, want <nil>", header.BaseFee)
+		}
+	} else if err := misc.VerifyEip1559Header(chain.Config(), parent, header); err != nil {
+		return err
+	}
+	// All basic checks passed, verify the seal and return
+	return c.verifySeal(chain, header, parent, parents)
+}
+
+// snapshot retrieves the validator set snapshot at a given point in time.
+func (c *Bor) snapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := c.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(c.config, c.signatures, c.db, number, hash); err == nil {
+				log.Trace("Loaded snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at the genesis, snapshot the validators of the first span
+		if number == 0 {
+			genesis := chain.GetHeaderByNumber(0)
+			if genesis != nil {
+				genesisHash := genesis.Hash()
+				validators, err := c.genesisValidators(genesis)
+				if err != nil {
+					return nil, err
+				}
+				if snap, err = newSnapshot(c.config, c.signatures, 0, genesisHash, validators); err != nil {
+					return nil, err
+				}
+				if err = snap.store(c.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored genesis snapshot to disk", "hash", genesisHash)
+				break
+			}
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	c.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(c.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// genesisValidators returns the validators of the first span: fetched from Heimdall, or the ones in the extra-data of
+// the genesis when running without it
+func (c *Bor) genesisValidators(genesis *types.Header) ([]*Validator, error) {
+	if c.heimdall == nil {
+		if len(genesis.Extra) < extraVanity+extraSeal {
+			return nil, nil
+		}
+		return ParseValidators(genesis.Extra[extraVanity : len(genesis.Extra)-extraSeal])
+	}
+	span, err := c.heimdall.Span(c.ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	validators := make([]*Validator, len(span.ValidatorSet.Validators))
+	for i, v := range span.ValidatorSet.Validators {
+		validators[i] = NewValidator(v.Address, v.VotingPower)
+	}
+	return validators, nil
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (c *Bor) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// verifySeal checks whether the signature contained in the header satisfies the
+// consensus protocol requirements: the signer is a validator, the block isn't
+// sealed before the turn of the signer and its difficulty matches the turn.
+func (c *Bor) verifySeal(chain consensus.ChainHeaderReader, header, parent *types.Header, parents []*types.Header) error {
+	// Verifying the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// Resolve the authorization key and check against validators
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return err
+	}
+	if !snap.ValidatorSet.HasAddress(signer) {
+		return errUnauthorizedSigner
+	}
+	succession, err := snap.succession(signer)
+	if err != nil {
+		return err
+	}
+	if parent.Time+CalcProducerDelay(number, succession, c.config) > header.Time {
+		return fmt.Errorf("%w: block %d, signer succession %d", errBlockTooSoon, number, succession)
+	}
+	// Ensure that the difficulty corresponds to the succession of the signer
+	if !c.fakeDiff && header.Difficulty.Uint64() != snap.difficulty(signer) {
+		return errWrongDifficulty
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (c *Bor) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	c.lock.RLock()
+	signer := c.signer
+	c.lock.RUnlock()
+
+	// Set the correct difficulty
+	header.Difficulty = new(big.Int).SetUint64(snap.difficulty(signer))
+
+	// Ensure the extra data has all its components, the validators of the next sprint at the end of a sprint
+	if len(header.Extra) < extraVanity {
+		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
+	}
+	header.Extra = header.Extra[:extraVanity]
+	if c.config.IsSprintStart(number + 1) {
+		for _, v := range snap.ValidatorSet.Validators {
+			header.Extra = append(header.Extra, v.HeaderBytes()...)
+		}
+	}
+	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+
+	// Mix digest is reserved for now, set to empty
+	header.MixDigest = common.Hash{}
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	var succession int
+	if signer != (common.Address{}) {
+		if succession, err = snap.succession(signer); err != nil {
+			return err
+		}
+	}
+	header.Time = parent.Time + CalcProducerDelay(number, succession, c.config)
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, committing the span and the state sync
+// events at the start of a sprint, reading the ancestors from the database.
+func (c *Bor) Finalize(config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) {
+	if err := c.FinalizeChain(c.getHeader, config, header, state, txs, uncles); err != nil {
+		log.Error("Could not finalize the block", "number", header.Number, "err", err)
+	}
+}
+
+// FinalizeChain implements consensus.ChainFinalizer. At the start of a sprint it
+// commits the next span when the current one ends and the state sync events
+// recorded by Heimdall before the start of the previous sprint. The codes of the
+// genesis contracts are replaced at the blocks of the config. No block rewards
+// are given, the fees go to the producer as the coinbase.
+func (c *Bor) FinalizeChain(getHeader func(hash common.Hash, number uint64) *types.Header, _ *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) error {
+	number := header.Number.Uint64()
+	if number > 0 && c.config.IsSprintStart(number) && c.heimdall != nil {
+		if err := c.checkAndCommitSpan(header, state); err != nil {
+			return fmt.Errorf("committing span at block %d: %w", number, err)
+		}
+		if err := c.commitStates(getHeader, header, state, len(txs)); err != nil {
+			return fmt.Errorf("committing state sync events at block %d: %w", number, err)
+		}
+	}
+	if err := c.changeContractCodeIfNeeded(number, state); err != nil {
+		return fmt.Errorf("changing contract code at block %d: %w", number, err)
+	}
+	header.UncleHash = types.CalcUncleHash(nil)
+	return nil
+}
+
+// FinalizeAndAssemble implements consensus.Engine, finalizing the block and
+// returning it assembled for sealing.
+func (c *Bor) FinalizeAndAssemble(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	if err := c.FinalizeChain(c.getHeader, chainConfig, header, state, txs, uncles); err != nil {
+		return nil, err
+	}
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+func (c *Bor) getHeader(hash common.Hash, number uint64) *types.Header {
+	return rawdb.ReadHeader(c.db, hash, number)
+}
+
+// needToCommitSpan returns whether the block is the first of the last sprint of the span, the next span is committed
+// there. The first span is committed at the start of the second sprint
+func (c *Bor) needToCommitSpan(span *Span, number uint64) bool {
+	if span.EndBlock == 0 {
+		return true
+	}
+	return span.EndBlock > c.config.Sprint && span.EndBlock-c.config.Sprint+1 == number
+}
+
+// checkAndCommitSpan commits the next span fetched from Heimdall to the validator set contract when the block
+// starts the last sprint of the current one
+func (c *Bor) checkAndCommitSpan(header *types.Header, ibs *state.IntraBlockState) error {
+	span, err := c.currentSpan(header, ibs)
+	if err != nil {
+		return err
+	}
+	if !c.needToCommitSpan(span, header.Number.Uint64()) {
+		return nil
+	}
+	next, err := c.heimdall.Span(c.ctx, span.ID+1)
+	if err != nil {
+		return err
+	}
+	if next.ChainID != c.chainConfig.ChainID.String() {
+		return fmt.Errorf("chain id of span %d: have %s, want %s", next.ID, next.ChainID, c.chainConfig.ChainID)
+	}
+	log.Debug("Committing span", "number", header.Number, "span", next.ID, "start", next.StartBlock, "end", next.EndBlock)
+	return c.commitSpan(header, ibs, next)
+}
+
+// commitStates commits the state sync events recorded by Heimdall before the time of the first block of the previous
+// sprint. Their logs belong to the bor system transaction of the block, which follows its transactions
+func (c *Bor) commitStates(getHeader func(hash common.Hash, number uint64) *types.Header, header *types.Header, ibs *state.IntraBlockState, txCount int) error {
+	number := header.Number.Uint64()
+	lastStateID, err := c.lastStateID(header, ibs)
+	if err != nil {
+		return err
+	}
+	ancestor := header
+	for ancestor != nil && ancestor.Number.Uint64() > number-c.config.Sprint {
+		ancestor = getHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+	}
+	if ancestor == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	to := time.Unix(int64(ancestor.Time), 0)
+
+	events, err := c.heimdall.StateSyncEvents(c.ctx, lastStateID+1, to.Unix())
+	if err != nil {
+		return err
+	}
+	if limit, ok := c.config.OverrideStateSyncRecords[strconv.FormatUint(number, 10)]; ok && limit < len(events) {
+		events = events[:limit]
+	}
+	ibs.Prepare(types.ComputeBorTxHash(number, header.Hash()), header.Hash(), txCount)
+
+	chainID := c.chainConfig.ChainID.String()
+	for _, event := range events {
+		if event.ID <= lastStateID {
+			continue
+		}
+		if event.ID != lastStateID+1 || event.ChainID != chainID || !event.Time.Before(to) {
+			log.Error("Invalid state sync event, skipping the rest", "number", number, "id", event.ID,
+				"expected", lastStateID+1, "chainID", event.ChainID, "time", event.Time, "to", to)
+			break
+		}
+		if err = c.commitState(header, ibs, event); err != nil {
+			return err
+		}
+		lastStateID++
+	}
+	return nil
+}
+
+// changeContractCodeIfNeeded replaces the codes of the contracts allocated at the block by the config
+func (c *Bor) changeContractCodeIfNeeded(number uint64, ibs *state.IntraBlockState) error {
+	alloc, ok := c.config.BlockAlloc[strconv.FormatUint(number, 10)]
+	if !ok {
+		return nil
+	}
+	var accounts map[common.Address]struct {
+		Code hexutil.Bytes `json:"code"`
+	}
+	if err := json.Unmarshal(alloc, &accounts); err != nil {
+		return err
+	}
+	for address, account := range accounts {
+		log.Info("Changing contract code", "number", number, "address", address)
+		ibs.SetCode(address, account.Code)
+	}
+	return nil
+}
+
+// Authorize injects a private key into the consensus engine to mint new blocks
+// with.
+func (c *Bor) Authorize(signer common.Address, signFn SignerFn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.signer = signer
+	c.signFn = signFn
+}
+
+// Seal implements consensus.Engine, attempting to create a sealed block using
+// the local signing credentials.
+func (c *Bor) Seal(ctx consensus.Cancel, chain consensus.ChainHeaderReader, block *types.Block, results chan<- consensus.ResultWithContext, stop <-chan struct{}) error {
+	header := block.Header()
+
+	// Sealing the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// For 0-period chains, refuse to seal empty blocks (no reward but would spin sealing)
+	if c.config.Period == 0 && len(block.Transactions()) == 0 {
+		log.Info("Sealing paused, waiting for transactions")
+		return nil
+	}
+	// Don't hold the signer fields for the entire sealing procedure
+	c.lock.RLock()
+	signer, signFn := c.signer, c.signFn
+	c.lock.RUnlock()
+
+	// Bail out if we're unauthorized to sign a block
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if !snap.ValidatorSet.HasAddress(signer) {
+		return errUnauthorizedSigner
+	}
+	// The time of the header is already delayed by the succession of the signer
+	delay := time.Until(time.Unix(int64(header.Time), 0))
+
+	sighash, err := signFn(signer, BorRLP(header))
+	if err != nil {
+		return err
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
+	// Wait until sealing is terminated or delay timeout.
+	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
+	go func() {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		select {
+		case results <- consensus.ResultWithContext{Cancel: ctx, Block: block.WithSeal(header)}:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
+		}
+	}()
+
+	return nil
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
+// of the block sealed by the local signer: the number of the validators for the
+// proposer and one less for every turn the signer is behind it.
+func (c *Bor) CalcDifficulty(chain consensus.ChainHeaderReader, _, _ uint64, _, parentNumber *big.Int, parentHash, _ common.Hash) *big.Int {
+	snap, err := c.snapshot(chain, parentNumber.Uint64(), parentHash, nil)
+	if err != nil {
+		return nil
+	}
+	c.lock.RLock()
+	signer := c.signer
+	c.lock.RUnlock()
+	return new(big.Int).SetUint64(snap.difficulty(signer))
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (c *Bor) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// Close implements consensus.Engine, cancelling the pending requests to Heimdall.
+func (c *Bor) Close() error {
+	c.cancel()
+	return nil
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to inspect
+// the validators.
+func (c *Bor) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "bor",
+		Version:   "1.0",
+		Service:   &API{chain: chain, bor: c},
+		Public:    false,
+	}}
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+	encodeSigHeader(hasher, header)
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+// BorRLP returns the rlp bytes which needs to be signed for the bor sealing. The
+// RLP to sign consists of the entire header apart from the 65 byte signature
+// contained at the end of the extra data.
+func BorRLP(header *types.Header) []byte {
+	b := new(bytes.Buffer)
+	encodeSigHeader(b, header)
+	return b.Bytes()
+}
+
+func encodeSigHeader(w io.Writer, header *types.Header) {
+	enc := []interface{}{
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		header.Extra[:len(header.Extra)-crypto.SignatureLength], // Yes, this will panic if extra is too short
+		header.MixDigest,
+		header.Nonce,
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	if err := rlp.Encode(w, enc); err != nil {
+		panic("can't encode: " + err.Error())
+	}
+}
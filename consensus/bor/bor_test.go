@@ -0,0 +1,329 @@
+package bor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// testChain is the chain of the headers verified by the tests
+type testChain struct {
+	config    *params.ChainConfig
+	headers   map[common.Hash]*types.Header
+	canonical map[uint64]*types.Header
+}
+
+func (c *testChain) Config() *params.ChainConfig { return c.config }
+func (c *testChain) CurrentHeader() *types.Header {
+	return c.canonical[uint64(len(c.canonical)-1)]
+}
+func (c *testChain) GetHeader(hash common.Hash, _ uint64) *types.Header { return c.headers[hash] }
+func (c *testChain) GetHeaderByNumber(number uint64) *types.Header      { return c.canonical[number] }
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header     { return c.headers[hash] }
+
+func (c *testChain) insert(header *types.Header) {
+	c.headers[header.Hash()] = header
+	c.canonical[header.Number.Uint64()] = header
+}
+
+// sealHeader sets the signature of the key in the extra-data of the header
+func sealHeader(t *testing.T, header *types.Header, key *ecdsa.PrivateKey) {
+	signature, err := crypto.Sign(SealHash(header).Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], signature)
+}
+
+func TestValidatorSetProposerRotation(t *testing.T) {
+	addresses := []common.Address{common.HexToAddress("0x1"), common.HexToAddress("0x2"), common.HexToAddress("0x3")}
+	set, err := NewValidatorSet([]*Validator{
+		NewValidator(addresses[2], 1),
+		NewValidator(addresses[0], 1),
+		NewValidator(addresses[1], 2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range set.Validators {
+		if v.Address != addresses[i] {
+			t.Fatalf("validator %d: have %x, want %x", i, v.Address, addresses[i])
+		}
+	}
+	// The validator with the double voting power proposes twice in the four turns
+	proposed := map[common.Address]int{}
+	for i := 0; i < 4; i++ {
+		proposed[set.GetProposer().Address]++
+		set.IncrementProposerPriority(1)
+	}
+	if proposed[addresses[0]] != 1 || proposed[addresses[1]] != 2 || proposed[addresses[2]] != 1 {
+		t.Fatalf("proposals: have %v", proposed)
+	}
+
+	// The removed validators leave the set, the added ones don't propose right away
+	updated, err := updatedValidatorSet(set, []*Validator{NewValidator(addresses[1], 2), NewValidator(common.HexToAddress("0x4"), 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.HasAddress(addresses[0]) || updated.HasAddress(addresses[2]) || !updated.HasAddress(common.HexToAddress("0x4")) {
+		t.Fatalf("validators: have %v", updated.Validators)
+	}
+	if updated.TotalVotingPower() != 3 {
+		t.Fatalf("total voting power: have %d, want 3", updated.TotalVotingPower())
+	}
+	if _, added := updated.GetByAddress(common.HexToAddress("0x4")); added.ProposerPriority >= 0 {
+		t.Fatalf("priority of the added validator: have %d, want negative", added.ProposerPriority)
+	}
+	if set.HasAddress(common.HexToAddress("0x4")) {
+		t.Fatal("the update modified the original set")
+	}
+}
+
+func TestParseValidators(t *testing.T) {
+	validators := []*Validator{NewValidator(common.HexToAddress("0x1"), 10), NewValidator(common.HexToAddress("0x2"), 1<<40)}
+	var validatorsBytes []byte
+	for _, v := range validators {
+		validatorsBytes = append(validatorsBytes, v.HeaderBytes()...)
+	}
+	if len(validatorsBytes) != 2*validatorHeaderBytesLength {
+		t.Fatalf("length: have %d, want %d", len(validatorsBytes), 2*validatorHeaderBytesLength)
+	}
+	parsed, err := ParseValidators(validatorsBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range parsed {
+		if v.Address != validators[i].Address || v.VotingPower != validators[i].VotingPower {
+			t.Fatalf("validator %d: have %x %d, want %x %d", i, v.Address, v.VotingPower, validators[i].Address, validators[i].VotingPower)
+		}
+	}
+	if _, err = ParseValidators(validatorsBytes[1:]); !errors.Is(err, errInvalidSpanValidators) {
+		t.Fatalf("error: have %v, want %v", err, errInvalidSpanValidators)
+	}
+}
+
+func TestCalcProducerDelay(t *testing.T) {
+	config := &params.BorConfig{Period: 2, ProducerDelay: 6, Sprint: 64, BackupMultiplier: 2}
+	for _, tt := range []struct {
+		number     uint64
+		succession int
+		delay      uint64
+	}{
+		{1, 0, 2},
+		{1, 2, 6},
+		{64, 0, 6},
+		{128, 1, 8},
+	} {
+		if delay := CalcProducerDelay(tt.number, tt.succession, config); delay != tt.delay {
+			t.Errorf("block %d, succession %d: have %d, want %d", tt.number, tt.succession, delay, tt.delay)
+		}
+	}
+}
+
+func TestNeedToCommitSpan(t *testing.T) {
+	engine := &Bor{config: &params.BorConfig{Sprint: 64}}
+	for _, tt := range []struct {
+		span   Span
+		number uint64
+		commit bool
+	}{
+		{Span{ID: 0, StartBlock: 0, EndBlock: 0}, 64, true},
+		{Span{ID: 0, StartBlock: 0, EndBlock: 255}, 64, false},
+		{Span{ID: 0, StartBlock: 0, EndBlock: 255}, 192, true},
+		{Span{ID: 1, StartBlock: 256, EndBlock: 6655}, 6592, true},
+		{Span{ID: 1, StartBlock: 256, EndBlock: 6655}, 6528, false},
+	} {
+		if commit := engine.needToCommitSpan(&tt.span, tt.number); commit != tt.commit {
+			t.Errorf("span %+v, block %d: have %t, want %t", tt.span, tt.number, commit, tt.commit)
+		}
+	}
+}
+
+func TestBorVerification(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	byAddress := map[common.Address]*ecdsa.PrivateKey{}
+	genesisExtra := make([]byte, extraVanity)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		address := crypto.PubkeyToAddress(keys[i].PublicKey)
+		byAddress[address] = keys[i]
+		genesisExtra = append(genesisExtra, NewValidator(address, 1).HeaderBytes()...)
+	}
+	genesisExtra = append(genesisExtra, make([]byte, extraSeal)...)
+
+	config := *params.TestChainConfig
+	config.Bor = &params.BorConfig{Period: 2, ProducerDelay: 4, Sprint: 4, BackupMultiplier: 2}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	engine := New(&config, db, nil)
+	defer engine.Close()
+
+	genesis := &types.Header{Number: new(big.Int), Difficulty: big.NewInt(1), GasLimit: 8000000, Extra: genesisExtra}
+	chain := &testChain{config: &config, headers: map[common.Hash]*types.Header{}, canonical: map[uint64]*types.Header{}}
+	chain.insert(genesis)
+
+	// makeHeader makes the child of the parent sealed by the validator of the succession
+	makeHeader := func(parent *types.Header, succession int) (*types.Header, *ecdsa.PrivateKey) {
+		snap, err := engine.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proposerIndex, _ := snap.ValidatorSet.GetByAddress(snap.ValidatorSet.GetProposer().Address)
+		signer := snap.ValidatorSet.Validators[(proposerIndex+succession)%len(snap.ValidatorSet.Validators)].Address
+		number := parent.Number.Uint64() + 1
+		extra := make([]byte, extraVanity)
+		if config.Bor.IsSprintStart(number + 1) {
+			for _, v := range snap.ValidatorSet.Validators {
+				extra = append(extra, v.HeaderBytes()...)
+			}
+		}
+		return &types.Header{
+			ParentHash: parent.Hash(),
+			UncleHash:  uncleHash,
+			Number:     new(big.Int).SetUint64(number),
+			GasLimit:   parent.GasLimit,
+			Time:       parent.Time + CalcProducerDelay(number, succession, config.Bor),
+			Difficulty: new(big.Int).SetUint64(snap.difficulty(signer)),
+			Extra:      append(extra, make([]byte, extraSeal)...),
+		}, byAddress[signer]
+	}
+
+	// Two sprints sealed by the proposers, the last block of each one carries the validators
+	var headers []*types.Header
+	parent := genesis
+	for i := 0; i < 8; i++ {
+		header, key := makeHeader(parent, 0)
+		sealHeader(t, header, key)
+		chain.insert(header)
+		headers = append(headers, header)
+		parent = header
+	}
+	for i, header := range headers {
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("header %d: %v", i+1, err)
+		}
+	}
+	if headers[3].Difficulty.Uint64() != 3 {
+		t.Fatalf("difficulty of the proposer: have %d, want 3", headers[3].Difficulty)
+	}
+
+	// The backup validator has to wait for the proposer
+	backup, key := makeHeader(parent, 1)
+	sealHeader(t, backup, key)
+	if err := engine.VerifyHeader(chain, backup, true); err != nil {
+		t.Fatalf("backup header: %v", err)
+	}
+	if backup.Difficulty.Uint64() != 2 {
+		t.Fatalf("difficulty of the backup: have %d, want 2", backup.Difficulty)
+	}
+	early, key := makeHeader(parent, 1)
+	early.Time = parent.Time + config.Bor.Period
+	sealHeader(t, early, key)
+	if err := engine.VerifyHeader(chain, early, true); !errors.Is(err, errBlockTooSoon) {
+		t.Fatalf("early header: have %v, want %v", err, errBlockTooSoon)
+	}
+
+	wrongDifficulty, key := makeHeader(parent, 0)
+	wrongDifficulty.Difficulty = big.NewInt(1)
+	sealHeader(t, wrongDifficulty, key)
+	if err := engine.VerifyHeader(chain, wrongDifficulty, true); !errors.Is(err, errWrongDifficulty) {
+		t.Fatalf("wrong difficulty: have %v, want %v", err, errWrongDifficulty)
+	}
+
+	outsider, _ := makeHeader(parent, 0)
+	outsiderKey, _ := crypto.GenerateKey()
+	sealHeader(t, outsider, outsiderKey)
+	if err := engine.VerifyHeader(chain, outsider, true); !errors.Is(err, errUnauthorizedSigner) {
+		t.Fatalf("outsider: have %v, want %v", err, errUnauthorizedSigner)
+	}
+
+	extraValidators, key := makeHeader(parent, 0)
+	extraValidators.Extra = append(append(make([]byte, extraVanity), NewValidator(common.HexToAddress("0x1"), 1).HeaderBytes()...), make([]byte, extraSeal)...)
+	sealHeader(t, extraValidators, key)
+	if err := engine.VerifyHeader(chain, extraValidators, true); !errors.Is(err, errExtraValidators) {
+		t.Fatalf("extra validators: have %v, want %v", err, errExtraValidators)
+	}
+}
+
+func TestHeimdallClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bor/span/1":
+			fmt.Fprint(w, `{"height":"100","result":{"span_id":1,"start_block":256,"end_block":6655,
+				"validator_set":{"validators":[{"ID":3,"signer":"0x0000000000000000000000000000000000000003","power":10,"accum":-5}]},
+				"selected_producers":[{"ID":3,"signer":"0x0000000000000000000000000000000000000003","power":10}],
+				"bor_chain_id":"137"}}`)
+		case "/clerk/event-record/list":
+			query := r.URL.Query()
+			if query.Get("to-time") != "1600000000" || query.Get("limit") != "50" {
+				http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+				return
+			}
+			var from, count int
+			fmt.Sscan(query.Get("from-id"), &from)
+			if from == 1 {
+				count = stateSyncEventsLimit
+			} else {
+				count = 2
+			}
+			fmt.Fprint(w, `{"height":"100","result":[`)
+			for i := 0; i < count; i++ {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"id":%d,"contract":"0x0000000000000000000000000000000000000005","data":"0x01","tx_hash":"0x0000000000000000000000000000000000000000000000000000000000000006","log_index":0,"bor_chain_id":"137","record_time":"2020-09-13T12:26:40Z"}`, from+i)
+			}
+			fmt.Fprint(w, `]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHeimdallClient(server.URL + "/")
+	span, err := client.Span(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span.ID != 1 || span.StartBlock != 256 || span.EndBlock != 6655 || span.ChainID != "137" {
+		t.Fatalf("span: have %+v", span)
+	}
+	if len(span.ValidatorSet.Validators) != 1 || span.ValidatorSet.Validators[0].VotingPower != 10 || span.SelectedProducers[0].Address != common.HexToAddress("0x3") {
+		t.Fatalf("validators of the span: have %+v", span.ValidatorSet)
+	}
+
+	events, err := client.StateSyncEvents(context.Background(), 1, 1600000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != stateSyncEventsLimit+2 {
+		t.Fatalf("events: have %d, want %d", len(events), stateSyncEventsLimit+2)
+	}
+	for i, event := range events {
+		if event.ID != uint64(i+1) {
+			t.Fatalf("event %d: have id %d", i, event.ID)
+		}
+	}
+	if !events[0].Time.Equal(time.Unix(1600000000, 0)) || events[0].Contract != common.HexToAddress("0x5") {
+		t.Fatalf("event: have %+v", events[0])
+	}
+
+	// The failed requests are retried until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err = client.Span(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("missing span: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,169 @@
+package bor
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/accounts/abi"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// The methods of the genesis contracts called by the engine
+const (
+	validatorSetABI = `[
+	{"name":"commitSpan","type":"function","stateMutability":"nonpayable","outputs":[],"inputs":[
+		{"name":"newSpan","type":"uint256"},{"name":"startBlock","type":"uint256"},{"name":"endBlock","type":"uint256"},
+		{"name":"validatorBytes","type":"bytes"},{"name":"producerBytes","type":"bytes"}]},
+	{"name":"getCurrentSpan","type":"function","stateMutability":"view","inputs":[],"outputs":[
+		{"name":"number","type":"uint256"},{"name":"startBlock","type":"uint256"},{"name":"endBlock","type":"uint256"}]}
+]`
+	stateReceiverABI = `[
+	{"name":"commitState","type":"function","stateMutability":"nonpayable","outputs":[{"name":"success","type":"bool"}],"inputs":[
+		{"name":"syncTime","type":"uint256"},{"name":"recordBytes","type":"bytes"}]},
+	{"name":"lastStateId","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]}
+]`
+)
+
+var (
+	// systemAddress is the caller of the system calls of the engine to the genesis contracts
+	systemAddress = common.HexToAddress("0xfffffffffffffffffffffffffffffffffffffffe")
+
+	validatorSet  = mustParseABI(validatorSetABI)
+	stateReceiver = mustParseABI(stateReceiverABI)
+)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// systemCall calls the genesis contract from the system address with the state of the block. The gas isn't limited,
+// the changes of a failed call are reverted by the EVM
+func systemCall(chainConfig *params.ChainConfig, header *types.Header, ibs *state.IntraBlockState, contract common.Address, data []byte, static bool) ([]byte, error) {
+	blockCtx := vm.BlockContext{
+		CanTransfer: func(vm.IntraBlockState, common.Address, *uint256.Int) bool { return true },
+		Transfer:    func(vm.IntraBlockState, common.Address, common.Address, *uint256.Int, bool) {},
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Coinbase:    header.Coinbase,
+		GasLimit:    math.MaxUint64,
+		BlockNumber: new(big.Int).Set(header.Number),
+		Time:        new(big.Int).SetUint64(header.Time),
+		Difficulty:  new(big.Int).Set(header.Difficulty),
+		BaseFee:     header.BaseFee,
+	}
+	evm := vm.NewEVM(blockCtx, vm.TxContext{Origin: systemAddress, GasPrice: new(big.Int)}, ibs, chainConfig, vm.Config{NoBaseFee: true})
+	var (
+		ret []byte
+		err error
+	)
+	if static {
+		ret, _, err = evm.StaticCall(vm.AccountRef(systemAddress), contract, data, math.MaxUint64/2)
+	} else {
+		ret, _, err = evm.Call(vm.AccountRef(systemAddress), contract, data, math.MaxUint64/2, new(uint256.Int), false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("system call to %x: %w", contract, err)
+	}
+	return ret, nil
+}
+
+// currentSpan returns the last span committed to the validator set contract
+func (c *Bor) currentSpan(header *types.Header, ibs *state.IntraBlockState) (*Span, error) {
+	data, err := validatorSet.Pack("getCurrentSpan")
+	if err != nil {
+		return nil, err
+	}
+	ret, err := systemCall(c.chainConfig, header, ibs, c.config.ValidatorContract, data, true)
+	if err != nil {
+		return nil, err
+	}
+	var span struct {
+		Number     *big.Int
+		StartBlock *big.Int
+		EndBlock   *big.Int
+	}
+	if err = validatorSet.UnpackIntoInterface(&span, "getCurrentSpan", ret); err != nil {
+		return nil, err
+	}
+	return &Span{ID: span.Number.Uint64(), StartBlock: span.StartBlock.Uint64(), EndBlock: span.EndBlock.Uint64()}, nil
+}
+
+// commitSpan commits the span with its validators and producers to the validator set contract
+func (c *Bor) commitSpan(header *types.Header, ibs *state.IntraBlockState, span *HeimdallSpan) error {
+	validators := make([]MinimalVal, len(span.ValidatorSet.Validators))
+	for i, v := range span.ValidatorSet.Validators {
+		validators[i] = v.MinimalVal()
+	}
+	validatorBytes, err := rlp.EncodeToBytes(validators)
+	if err != nil {
+		return err
+	}
+	producers := make([]MinimalVal, len(span.SelectedProducers))
+	for i := range span.SelectedProducers {
+		producers[i] = span.SelectedProducers[i].MinimalVal()
+	}
+	producerBytes, err := rlp.EncodeToBytes(producers)
+	if err != nil {
+		return err
+	}
+	data, err := validatorSet.Pack("commitSpan",
+		new(big.Int).SetUint64(span.ID),
+		new(big.Int).SetUint64(span.StartBlock),
+		new(big.Int).SetUint64(span.EndBlock),
+		validatorBytes,
+		producerBytes,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err = systemCall(c.chainConfig, header, ibs, c.config.ValidatorContract, data, false); err != nil {
+		// The failed system calls don't invalidate the block, as in bor
+		log.Warn("Could not commit the span", "number", header.Number, "span", span.ID, "err", err)
+	}
+	return nil
+}
+
+// lastStateID returns the id of the last state sync event committed to the state receiver contract
+func (c *Bor) lastStateID(header *types.Header, ibs *state.IntraBlockState) (uint64, error) {
+	data, err := stateReceiver.Pack("lastStateId")
+	if err != nil {
+		return 0, err
+	}
+	ret, err := systemCall(c.chainConfig, header, ibs, c.config.StateReceiverContract, data, true)
+	if err != nil {
+		return 0, err
+	}
+	var id *big.Int
+	if err = stateReceiver.UnpackIntoInterface(&id, "lastStateId", ret); err != nil {
+		return 0, err
+	}
+	return id.Uint64(), nil
+}
+
+// commitState commits the state sync event to the state receiver contract, which calls the receiver of the event
+func (c *Bor) commitState(header *types.Header, ibs *state.IntraBlockState, event *EventRecordWithTime) error {
+	recordBytes, err := rlp.EncodeToBytes(&event.EventRecord)
+	if err != nil {
+		return err
+	}
+	data, err := stateReceiver.Pack("commitState", big.NewInt(event.Time.Unix()), recordBytes)
+	if err != nil {
+		return err
+	}
+	if _, err = systemCall(c.chainConfig, header, ibs, c.config.StateReceiverContract, data, false); err != nil {
+		log.Warn("Could not commit the state sync event", "number", header.Number, "id", event.ID, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package bor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	stateSyncEventsLimit = 50 // Number of the state sync events fetched per request
+
+	heimdallTimeout    = 5 * time.Second // Timeout of a request to Heimdall
+	heimdallRetryDelay = 5 * time.Second // Delay between the retries of the failed requests
+)
+
+// Span is the range of the blocks sealed by the producers selected from the validators
+type Span struct {
+	ID         uint64 `json:"span_id"`
+	StartBlock uint64 `json:"start_block"`
+	EndBlock   uint64 `json:"end_block"`
+}
+
+// HeimdallSpan is the span with its validators and producers, as committed by Heimdall
+type HeimdallSpan struct {
+	Span
+	ValidatorSet      ValidatorSet `json:"validator_set"`
+	SelectedProducers []Validator  `json:"selected_producers"`
+	ChainID           string       `json:"bor_chain_id"`
+}
+
+// EventRecord is a state sync event, the data of a contract of the root chain to commit to the contract of the
+// receiver
+type EventRecord struct {
+	ID       uint64         `json:"id"`
+	Contract common.Address `json:"contract"`
+	Data     hexutil.Bytes  `json:"data"`
+	TxHash   common.Hash    `json:"tx_hash"`
+	LogIndex uint64         `json:"log_index"`
+	ChainID  string         `json:"bor_chain_id"`
+}
+
+// EventRecordWithTime is the state sync event with the time Heimdall recorded it
+type EventRecordWithTime struct {
+	EventRecord
+	Time time.Time `json:"record_time"`
+}
+
+// HeimdallClient fetches the spans and the state sync events from Heimdall, the chain of the Polygon validators
+type HeimdallClient interface {
+	// Span fetches the span with the id
+	Span(ctx context.Context, id uint64) (*HeimdallSpan, error)
+
+	// StateSyncEvents fetches the state sync events starting from the id, recorded before the time, in the order
+	// of their ids
+	StateSyncEvents(ctx context.Context, fromID uint64, to int64) ([]*EventRecordWithTime, error)
+}
+
+// heimdallResponse is the envelope of the responses of the REST server of Heimdall
+type heimdallResponse struct {
+	Height string          `json:"height"`
+	Result json.RawMessage `json:"result"`
+}
+
+type heimdallClient struct {
+	url    string
+	client http.Client
+}
+
+// NewHeimdallClient creates the client of the REST server of Heimdall at the url
+func NewHeimdallClient(urlString string) HeimdallClient {
+	return &heimdallClient{
+		url:    strings.TrimRight(urlString, "/"),
+		client: http.Client{Timeout: heimdallTimeout},
+	}
+}
+
+func (h *heimdallClient) Span(ctx context.Context, id uint64) (*HeimdallSpan, error) {
+	var span HeimdallSpan
+	if err := h.fetchWithRetry(ctx, fmt.Sprintf("bor/span/%d", id), nil, &span); err != nil {
+		return nil, err
+	}
+	return &span, nil
+}
+
+func (h *heimdallClient) StateSyncEvents(ctx context.Context, fromID uint64, to int64) ([]*EventRecordWithTime, error) {
+	var events []*EventRecordWithTime
+	for {
+		query := url.Values{}
+		query.Set("from-id", fmt.Sprint(fromID))
+		query.Set("to-time", fmt.Sprint(to))
+		query.Set("limit", fmt.Sprint(stateSyncEventsLimit))
+		var page []*EventRecordWithTime
+		if err := h.fetchWithRetry(ctx, "clerk/event-record/list", query, &page); err != nil {
+			return nil, err
+		}
+		events = append(events, page...)
+		if len(page) < stateSyncEventsLimit {
+			break
+		}
+		fromID += stateSyncEventsLimit
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+// fetchWithRetry fetches the result of the path until it succeeds or the context is done, the blocks can't be
+// executed without it
+func (h *heimdallClient) fetchWithRetry(ctx context.Context, path string, query url.Values, result interface{}) error {
+	u := h.url + "/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	for {
+		err := h.fetch(ctx, u, result)
+		if err == nil {
+			return nil
+		}
+		log.Warn("Could not fetch from Heimdall, retrying", "url", u, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(heimdallRetryDelay):
+		}
+	}
+}
+
+func (h *heimdallClient) fetch(ctx context.Context, u string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s: %s", res.Status, body)
+	}
+	var response heimdallResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	return json.Unmarshal(response.Result, result)
+}
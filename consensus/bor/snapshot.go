@@ -0,0 +1,181 @@
+package bor
+
+import (
+	"encoding/json"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// Snapshot is the validator set of the span at a given point in time.
+type Snapshot struct {
+	config   *params.BorConfig // Consensus engine parameters to fine tune behavior
+	sigcache *lru.ARCCache     // Cache of recent block signatures to speed up ecrecover
+
+	Number       uint64                    `json:"number"`       // Block number where the snapshot was created
+	Hash         common.Hash               `json:"hash"`         // Block hash where the snapshot was created
+	ValidatorSet *ValidatorSet             `json:"validatorSet"` // Validator set at this moment
+	Recents      map[uint64]common.Address `json:"recents"`      // Set of recent signers of the sprint
+}
+
+// newSnapshot creates a new snapshot with the specified startup parameters. This
+// method does not initialize the set of recent signers, so only ever use it for
+// the genesis block.
+func newSnapshot(config *params.BorConfig, sigcache *lru.ARCCache, number uint64, hash common.Hash, validators []*Validator) (*Snapshot, error) {
+	set, err := NewValidatorSet(validators)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		config:       config,
+		sigcache:     sigcache,
+		Number:       number,
+		Hash:         hash,
+		ValidatorSet: set,
+		Recents:      make(map[uint64]common.Address),
+	}, nil
+}
+
+// loadSnapshot loads an existing snapshot from the database.
+func loadSnapshot(config *params.BorConfig, sigcache *lru.ARCCache, db ethdb.Database, number uint64, hash common.Hash) (*Snapshot, error) {
+	blob, err := db.Get(dbutils.BorSnapshot, dbutils.HeaderKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(blob, snap); err != nil {
+		return nil, err
+	}
+	snap.config = config
+	snap.sigcache = sigcache
+
+	return snap, nil
+}
+
+// store inserts the snapshot into the database.
+//nolint:interfacer
+func (s *Snapshot) store(db ethdb.Database) error {
+	blob, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.Put(dbutils.BorSnapshot, dbutils.HeaderKey(s.Number, s.Hash), blob)
+}
+
+// copy creates a deep copy of the snapshot.
+func (s *Snapshot) copy() *Snapshot {
+	cpy := &Snapshot{
+		config:       s.config,
+		sigcache:     s.sigcache,
+		Number:       s.Number,
+		Hash:         s.Hash,
+		ValidatorSet: s.ValidatorSet.Copy(),
+		Recents:      make(map[uint64]common.Address),
+	}
+	for block, signer := range s.Recents {
+		cpy.Recents[block] = signer
+	}
+	return cpy
+}
+
+// apply creates a new authorization snapshot by applying the given headers to
+// the original one.
+func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
+	// Allow passing in no headers for cleaner code
+	if len(headers) == 0 {
+		return s, nil
+	}
+	// Sanity check that the headers can be applied
+	for i := 0; i < len(headers)-1; i++ {
+		if headers[i+1].Number.Uint64() != headers[i].Number.Uint64()+1 {
+			return nil, errInvalidVotingChain
+		}
+	}
+	if headers[0].Number.Uint64() != s.Number+1 {
+		return nil, errInvalidVotingChain
+	}
+	snap := s.copy()
+
+	for _, header := range headers {
+		number := header.Number.Uint64()
+
+		// Delete the oldest signer from the recent list to allow it signing again
+		if number >= s.config.Sprint {
+			delete(snap.Recents, number-s.config.Sprint)
+		}
+		signer, err := ecrecover(header, s.sigcache)
+		if err != nil {
+			return nil, err
+		}
+		if !snap.ValidatorSet.HasAddress(signer) {
+			return nil, errUnauthorizedSigner
+		}
+		if _, err = snap.succession(signer); err != nil {
+			return nil, err
+		}
+		snap.Recents[number] = signer
+
+		// The last block of the sprint carries the validators of the next one, the next proposer is selected
+		if (number+1)%s.config.Sprint == 0 {
+			newVals, err := ParseValidators(header.Extra[extraVanity : len(header.Extra)-extraSeal])
+			if err != nil {
+				return nil, err
+			}
+			set, err := updatedValidatorSet(snap.ValidatorSet, newVals)
+			if err != nil {
+				log.Error("Could not apply the validators of the next sprint", "number", number, "err", err)
+				set = snap.ValidatorSet.Copy()
+			}
+			set.IncrementProposerPriority(1)
+			snap.ValidatorSet = set
+		}
+	}
+	snap.Number += uint64(len(headers))
+	snap.Hash = headers[len(headers)-1].Hash()
+
+	return snap, nil
+}
+
+// succession returns how far the signer is from the proposer in the turns of the sprint, 0 for the proposer
+func (s *Snapshot) succession(signer common.Address) (int, error) {
+	proposer := s.ValidatorSet.GetProposer()
+	if proposer == nil {
+		return -1, errUnauthorizedProposer
+	}
+	proposerIndex, _ := s.ValidatorSet.GetByAddress(proposer.Address)
+	if proposerIndex == -1 {
+		return -1, errUnauthorizedProposer
+	}
+	signerIndex, _ := s.ValidatorSet.GetByAddress(signer)
+	if signerIndex == -1 {
+		return -1, errUnauthorizedSigner
+	}
+	if signerIndex < proposerIndex {
+		signerIndex += len(s.ValidatorSet.Validators)
+	}
+	return signerIndex - proposerIndex, nil
+}
+
+// signers retrieves the list of the validators in the order of their addresses.
+func (s *Snapshot) signers() []common.Address {
+	sigs := make([]common.Address, len(s.ValidatorSet.Validators))
+	for i, v := range s.ValidatorSet.Validators {
+		sigs[i] = v.Address
+	}
+	return sigs
+}
+
+// difficulty returns the difficulty of the block sealed by the signer: the number of the validators for the proposer
+// and one less for every turn the signer is behind it
+func (s *Snapshot) difficulty(signer common.Address) uint64 {
+	succession, err := s.succession(signer)
+	if err != nil {
+		return 1
+	}
+	return uint64(len(s.ValidatorSet.Validators) - succession)
+}
@@ -0,0 +1,364 @@
+package bor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+const (
+	// maxTotalVotingPower bounds the voting power of the set, so that the priorities don't overflow
+	maxTotalVotingPower = int64(math.MaxInt64) / 8
+
+	// priorityWindowSizeFactor bounds the spread of the priorities to the factor of the total voting power
+	priorityWindowSizeFactor = 2
+
+	// validatorHeaderBytesLength is the length of a validator in the extra of the last block of a sprint: the
+	// address and the voting power
+	validatorHeaderBytesLength = common.AddressLength + 20
+)
+
+// Validator is a validator of a span with its voting power and its priority to propose
+type Validator struct {
+	ID               uint64         `json:"ID"`
+	Address          common.Address `json:"signer"`
+	VotingPower      int64          `json:"power"`
+	ProposerPriority int64          `json:"accum"`
+}
+
+// NewValidator creates a validator without the priority
+func NewValidator(address common.Address, votingPower int64) *Validator {
+	return &Validator{Address: address, VotingPower: votingPower}
+}
+
+// Copy returns a copy of the validator
+func (v *Validator) Copy() *Validator {
+	cpy := *v
+	return &cpy
+}
+
+// cmp returns the validator with the higher priority, or the lower address of the two with the same priority
+func (v *Validator) cmp(other *Validator) *Validator {
+	switch {
+	case v == nil:
+		return other
+	case other == nil:
+		return v
+	case v.ProposerPriority > other.ProposerPriority:
+		return v
+	case v.ProposerPriority < other.ProposerPriority:
+		return other
+	case bytes.Compare(v.Address[:], other.Address[:]) <= 0:
+		return v
+	}
+	return other
+}
+
+// HeaderBytes returns the encoding of the validator in the extra of the last block of a sprint
+func (v *Validator) HeaderBytes() []byte {
+	result := make([]byte, validatorHeaderBytesLength)
+	copy(result, v.Address[:])
+	power := big.NewInt(v.VotingPower).Bytes()
+	copy(result[validatorHeaderBytesLength-len(power):], power)
+	return result
+}
+
+// MinimalVal is the validator as committed to the validator set contract
+type MinimalVal struct {
+	ID          uint64
+	VotingPower uint64
+	Signer      common.Address
+}
+
+// MinimalVal returns the validator as committed to the validator set contract
+func (v *Validator) MinimalVal() MinimalVal {
+	return MinimalVal{ID: v.ID, VotingPower: uint64(v.VotingPower), Signer: v.Address}
+}
+
+// ParseValidators decodes the validators in the extra of the last block of a sprint
+func ParseValidators(validatorsBytes []byte) ([]*Validator, error) {
+	if len(validatorsBytes)%validatorHeaderBytesLength != 0 {
+		return nil, errInvalidSpanValidators
+	}
+	result := make([]*Validator, len(validatorsBytes)/validatorHeaderBytesLength)
+	for i := range result {
+		b := validatorsBytes[i*validatorHeaderBytesLength:]
+		power := new(big.Int).SetBytes(b[common.AddressLength:validatorHeaderBytesLength])
+		if !power.IsInt64() {
+			return nil, fmt.Errorf("voting power %d of validator %x out of range", power, b[:common.AddressLength])
+		}
+		result[i] = NewValidator(common.BytesToAddress(b[:common.AddressLength]), power.Int64())
+	}
+	return result, nil
+}
+
+// ValidatorSet is the set of the validators sorted by the address, the proposer is the validator with the highest
+// priority, as in Tendermint: every block increments the priorities by the voting powers and the proposer pays the
+// total voting power back
+type ValidatorSet struct {
+	Validators []*Validator `json:"validators"`
+	Proposer   *Validator   `json:"proposer"`
+
+	totalVotingPower int64
+}
+
+// NewValidatorSet creates the set of the validators and selects its proposer
+func NewValidatorSet(validators []*Validator) (*ValidatorSet, error) {
+	vals := &ValidatorSet{}
+	changes := make([]*Validator, len(validators))
+	for i, v := range validators {
+		changes[i] = v.Copy()
+	}
+	if err := vals.UpdateWithChangeSet(changes); err != nil {
+		return nil, err
+	}
+	if len(vals.Validators) > 0 {
+		vals.IncrementProposerPriority(1)
+	}
+	return vals, nil
+}
+
+// Copy returns a deep copy of the set
+func (vals *ValidatorSet) Copy() *ValidatorSet {
+	cpy := &ValidatorSet{Validators: make([]*Validator, len(vals.Validators)), totalVotingPower: vals.totalVotingPower}
+	for i, v := range vals.Validators {
+		cpy.Validators[i] = v.Copy()
+	}
+	if vals.Proposer != nil {
+		cpy.Proposer = vals.Proposer.Copy()
+	}
+	return cpy
+}
+
+// GetByAddress returns the index and the validator of the address, -1 and nil if it isn't in the set
+func (vals *ValidatorSet) GetByAddress(address common.Address) (int, *Validator) {
+	i := sort.Search(len(vals.Validators), func(i int) bool {
+		return bytes.Compare(vals.Validators[i].Address[:], address[:]) >= 0
+	})
+	if i < len(vals.Validators) && vals.Validators[i].Address == address {
+		return i, vals.Validators[i].Copy()
+	}
+	return -1, nil
+}
+
+// HasAddress returns whether the address is a validator of the set
+func (vals *ValidatorSet) HasAddress(address common.Address) bool {
+	i, _ := vals.GetByAddress(address)
+	return i >= 0
+}
+
+// GetProposer returns a copy of the current proposer
+func (vals *ValidatorSet) GetProposer() *Validator {
+	if len(vals.Validators) == 0 {
+		return nil
+	}
+	if vals.Proposer == nil {
+		vals.Proposer = vals.mostPriority()
+	}
+	return vals.Proposer.Copy()
+}
+
+// TotalVotingPower returns the sum of the voting powers of the validators
+func (vals *ValidatorSet) TotalVotingPower() int64 {
+	if vals.totalVotingPower == 0 {
+		for _, v := range vals.Validators {
+			vals.totalVotingPower += v.VotingPower
+		}
+	}
+	return vals.totalVotingPower
+}
+
+// IncrementProposerPriority increments the priorities of the validators the number of times and selects the proposer
+func (vals *ValidatorSet) IncrementProposerPriority(times int) {
+	if len(vals.Validators) == 0 || times <= 0 {
+		return
+	}
+	vals.rescalePriorities(priorityWindowSizeFactor * vals.TotalVotingPower())
+	vals.shiftByAvgProposerPriority()
+	var proposer *Validator
+	for i := 0; i < times; i++ {
+		for _, v := range vals.Validators {
+			v.ProposerPriority = safeAddClip(v.ProposerPriority, v.VotingPower)
+		}
+		proposer = vals.mostPriority()
+		proposer.ProposerPriority = safeSubClip(proposer.ProposerPriority, vals.TotalVotingPower())
+	}
+	vals.Proposer = proposer
+}
+
+// mostPriority returns the validator with the highest priority
+func (vals *ValidatorSet) mostPriority() *Validator {
+	var res *Validator
+	for _, v := range vals.Validators {
+		res = res.cmp(v)
+	}
+	return res
+}
+
+// rescalePriorities divides the priorities so that their spread is within the diffMax
+func (vals *ValidatorSet) rescalePriorities(diffMax int64) {
+	if diffMax <= 0 || len(vals.Validators) == 0 {
+		return
+	}
+	max, min := int64(math.MinInt64), int64(math.MaxInt64)
+	for _, v := range vals.Validators {
+		if v.ProposerPriority > max {
+			max = v.ProposerPriority
+		}
+		if v.ProposerPriority < min {
+			min = v.ProposerPriority
+		}
+	}
+	diff := max - min
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > diffMax {
+		ratio := (diff + diffMax - 1) / diffMax
+		for _, v := range vals.Validators {
+			v.ProposerPriority /= ratio
+		}
+	}
+}
+
+// shiftByAvgProposerPriority centers the priorities around zero
+func (vals *ValidatorSet) shiftByAvgProposerPriority() {
+	if len(vals.Validators) == 0 {
+		return
+	}
+	sum := new(big.Int)
+	for _, v := range vals.Validators {
+		sum.Add(sum, big.NewInt(v.ProposerPriority))
+	}
+	avg := sum.Div(sum, big.NewInt(int64(len(vals.Validators)))).Int64()
+	for _, v := range vals.Validators {
+		v.ProposerPriority = safeSubClip(v.ProposerPriority, avg)
+	}
+}
+
+// UpdateWithChangeSet applies the changes of the voting powers to the set, the validators with no voting power are
+// removed. The added validators start with the lowest priority so that they don't propose right away
+func (vals *ValidatorSet) UpdateWithChangeSet(changes []*Validator) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	sorted := make([]*Validator, len(changes))
+	copy(sorted, changes)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Address[:], sorted[j].Address[:]) < 0 })
+
+	updates := make(map[common.Address]*Validator, len(sorted))
+	tvpAfterUpdates := vals.TotalVotingPower()
+	for i, c := range sorted {
+		if i > 0 && sorted[i-1].Address == c.Address {
+			return fmt.Errorf("duplicate validator %x in the changes", c.Address)
+		}
+		if c.VotingPower < 0 {
+			return fmt.Errorf("negative voting power %d of validator %x", c.VotingPower, c.Address)
+		}
+		_, existing := vals.GetByAddress(c.Address)
+		if c.VotingPower == 0 && existing == nil {
+			return fmt.Errorf("removed validator %x not in the set", c.Address)
+		}
+		if c.VotingPower > 0 {
+			if existing != nil {
+				tvpAfterUpdates -= existing.VotingPower
+			}
+			tvpAfterUpdates += c.VotingPower
+			if tvpAfterUpdates > maxTotalVotingPower {
+				return fmt.Errorf("total voting power of the set exceeds %d", maxTotalVotingPower)
+			}
+		}
+		updates[c.Address] = c
+	}
+
+	validators := make([]*Validator, 0, len(vals.Validators)+len(updates))
+	for _, v := range vals.Validators {
+		if _, changed := updates[v.Address]; !changed {
+			validators = append(validators, v)
+		}
+	}
+	for _, c := range sorted {
+		if c.VotingPower == 0 {
+			continue
+		}
+		updated := c.Copy()
+		if _, existing := vals.GetByAddress(c.Address); existing != nil {
+			updated.ProposerPriority = existing.ProposerPriority
+		} else {
+			updated.ProposerPriority = -(tvpAfterUpdates + (tvpAfterUpdates >> 3))
+		}
+		validators = append(validators, updated)
+	}
+	if len(validators) == 0 {
+		return errors.New("applying the changes results in an empty set")
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Address[:], validators[j].Address[:]) < 0
+	})
+	vals.Validators = validators
+	vals.totalVotingPower = 0
+	if vals.Proposer != nil {
+		if _, proposer := vals.GetByAddress(vals.Proposer.Address); proposer == nil {
+			vals.Proposer = nil
+		}
+	}
+
+	vals.rescalePriorities(priorityWindowSizeFactor * vals.TotalVotingPower())
+	vals.shiftByAvgProposerPriority()
+	return nil
+}
+
+// updatedValidatorSet applies the validators of the next span in the extra of the last block of a sprint to the set:
+// the validators which aren't in the span are removed and the voting powers of the others are updated
+func updatedValidatorSet(old *ValidatorSet, newVals []*Validator) (*ValidatorSet, error) {
+	vals := old.Copy()
+	next := make(map[common.Address]*Validator, len(newVals))
+	for _, v := range newVals {
+		next[v.Address] = v
+	}
+	changes := make([]*Validator, 0, len(vals.Validators)+len(newVals))
+	for _, v := range vals.Validators {
+		change := v.Copy()
+		if n, ok := next[v.Address]; ok {
+			change.VotingPower = n.VotingPower
+			delete(next, v.Address)
+		} else {
+			change.VotingPower = 0
+		}
+		changes = append(changes, change)
+	}
+	for _, v := range newVals {
+		if _, added := next[v.Address]; added {
+			changes = append(changes, v.Copy())
+		}
+	}
+	if err := vals.UpdateWithChangeSet(changes); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+func safeAddClip(a, b int64) int64 {
+	if b > 0 && a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	if b < 0 && a < math.MinInt64-b {
+		return math.MinInt64
+	}
+	return a + b
+}
+
+func safeSubClip(a, b int64) int64 {
+	if b > 0 && a < math.MinInt64+b {
+		return math.MinInt64
+	}
+	if b < 0 && a > math.MaxInt64+b {
+		return math.MaxInt64
+	}
+	return a - b
+}
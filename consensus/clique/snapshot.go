@@ -88,8 +88,8 @@ func newSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, number uin
 }
 
 // loadSnapshot loads an existing snapshot from the database.
-func loadSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, db ethdb.Database, hash common.Hash) (*Snapshot, error) {
-	blob, err := db.Get(dbutils.CliqueBucket, hash[:])
+func loadSnapshot(config *params.CliqueConfig, sigcache *lru.ARCCache, db ethdb.Database, number uint64, hash common.Hash) (*Snapshot, error) {
+	blob, err := db.Get(dbutils.CliqueSnapshot, dbutils.HeaderKey(number, hash))
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +110,7 @@ func (s *Snapshot) store(db ethdb.Database) error {
 	if err != nil {
 		return err
 	}
-	return db.Put(dbutils.CliqueBucket, s.Hash[:], blob)
+	return db.Put(dbutils.CliqueSnapshot, dbutils.HeaderKey(s.Number, s.Hash), blob)
 }
 
 // copy creates a deep copy of the snapshot, though not the individual votes.
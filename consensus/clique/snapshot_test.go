@@ -26,6 +26,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/crypto"
@@ -514,3 +515,46 @@ func TestClique(t *testing.T) {
 		db.Close()
 	}
 }
+
+// Tests that the snapshots are stored by the number and the hash, so the snapshots of the different forks at the same
+// checkpoint don't collide, and that the unwind deletes the snapshots of the unwound blocks only.
+func TestSnapshotStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	config := &params.CliqueConfig{Epoch: epochLength}
+	signers := []common.Address{{1}}
+	snaps := []*Snapshot{
+		newSnapshot(config, nil, 0, common.Hash{0}, signers),
+		newSnapshot(config, nil, checkpointInterval, common.Hash{1}, signers),
+		newSnapshot(config, nil, 2*checkpointInterval, common.Hash{2}, signers),
+		newSnapshot(config, nil, 2*checkpointInterval, common.Hash{3}, signers), // fork
+	}
+	for _, snap := range snaps {
+		if err := snap.store(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, snap := range snaps {
+		loaded, err := loadSnapshot(config, nil, db, snap.Number, snap.Hash)
+		if err != nil {
+			t.Fatalf("snapshot %d %x: %v", snap.Number, snap.Hash, err)
+		}
+		if loaded.Number != snap.Number || loaded.Hash != snap.Hash {
+			t.Errorf("loaded snapshot %d %x, want %d %x", loaded.Number, loaded.Hash, snap.Number, snap.Hash)
+		}
+	}
+	if _, err := loadSnapshot(config, nil, db, checkpointInterval, common.Hash{2}); err == nil {
+		t.Errorf("loaded the snapshot by the hash at the wrong number")
+	}
+
+	if err := rawdb.DeleteNewerCliqueSnapshots(db, 2*checkpointInterval); err != nil {
+		t.Fatal(err)
+	}
+	for i, snap := range snaps {
+		_, err := loadSnapshot(config, nil, db, snap.Number, snap.Hash)
+		if deleted := snap.Number >= 2*checkpointInterval; deleted != (err != nil) {
+			t.Errorf("snapshot %d: deleted %t, have error %v", i, deleted, err)
+		}
+	}
+}
@@ -117,6 +117,16 @@ type Engine interface {
 	Close() error
 }
 
+// ChainFinalizer is implemented by the engines whose finalization reads the
+// ancestors of the block and can fail, e.g. bor, which commits the state sync
+// events fetched from Heimdall. The block execution uses FinalizeChain instead
+// of Finalize when the engine implements it.
+type ChainFinalizer interface {
+	// FinalizeChain runs the post-transaction state modifications like Finalize,
+	// the ancestors of the block are read with getHeader.
+	FinalizeChain(getHeader func(hash common.Hash, number uint64) *types.Header, config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) error
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
@@ -0,0 +1,358 @@
+// Package external implements the consensus engine delegating the consensus rules
+// to an external process over gRPC. It allows to experiment with the new consensus
+// algorithms, e.g. the merge with the beacon chain, without modifying the node.
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	proto_consensus "github.com/ledgerwatch/turbo-geth/gointerfaces/consensus"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"google.golang.org/grpc"
+)
+
+const (
+	inmemoryVerifications = 4096             // Number of recent header verification results to keep in memory
+	callTimeout           = 10 * time.Second // Timeout of the calls to the engine, except the sealing
+)
+
+// verification is the key of the cached header verification results
+type verification struct {
+	hash common.Hash
+	seal bool
+}
+
+// External is the consensus engine delegating the consensus rules to the
+// ConsensusEngine gRPC service of an external process.
+type External struct {
+	client proto_consensus.ConsensusEngineClient
+	close  func() error // Closes the connection to the engine, nil if it isn't owned by the engine
+
+	verifications *lru.ARCCache // Verification results of the recent headers, the engine is asked once per header
+}
+
+// New creates the consensus engine calling the given client.
+func New(client proto_consensus.ConsensusEngineClient) *External {
+	verifications, _ := lru.NewARC(inmemoryVerifications)
+	return &External{
+		client:        client,
+		verifications: verifications,
+	}
+}
+
+// Dial connects to the engine served at the given address, the connection is
+// closed with the engine.
+func Dial(addr string) (*External, error) {
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("creating client connection to the consensus engine: %w", err)
+	}
+	e := New(proto_consensus.NewConsensusEngineClient(conn))
+	e.close = conn.Close
+	return e, nil
+}
+
+// engineError converts the error reported by the engine, empty when there is none.
+func engineError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// Author implements consensus.Engine, returning the account the engine reports
+// as the minter of the block.
+func (e *External) Author(header *types.Header) (common.Address, error) {
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.Author(ctx, &proto_consensus.AuthorRequest{Header: enc})
+	if err != nil {
+		return common.Address{}, err
+	}
+	return gointerfaces.ConvertH160toAddress(reply.Author), nil
+}
+
+// VerifyHeader implements consensus.Engine, checking the header with its parent
+// against the rules of the engine. The results reported by the engine are cached,
+// the transport errors are not.
+func (e *External) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	key := verification{hash: header.Hash(), seal: seal}
+	if res, ok := e.verifications.Get(key); ok {
+		if res == nil {
+			return nil
+		}
+		return res.(error)
+	}
+	// The header verified with the seal is valid without it too
+	if !seal {
+		if res, ok := e.verifications.Get(verification{hash: key.hash, seal: true}); ok && res == nil {
+			return nil
+		}
+	}
+	req := &proto_consensus.VerifyHeaderRequest{Seal: seal}
+	var err error
+	if req.Header, err = rlp.EncodeToBytes(header); err != nil {
+		return err
+	}
+	if number := header.Number.Uint64(); number > 0 {
+		parent := chain.GetHeader(header.ParentHash, number-1)
+		if parent == nil {
+			return consensus.ErrUnknownAncestor
+		}
+		if req.Parent, err = rlp.EncodeToBytes(parent); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.VerifyHeader(ctx, req)
+	if err != nil {
+		return fmt.Errorf("verifying the header %d by the external engine: %w", header.Number.Uint64(), err)
+	}
+	if err = engineError(reply.Error); err != nil {
+		e.verifications.Add(key, err)
+		return err
+	}
+	e.verifications.Add(key, nil)
+	return nil
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (e *External) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (func(), <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+	wg := &sync.WaitGroup{}
+	cancel := func() {
+		close(abort)
+		wg.Wait()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, header := range headers {
+			err := e.VerifyHeader(chain, header, seals[i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return cancel, results
+}
+
+// VerifyUncles implements consensus.Engine, checking the uncles of the block
+// against the rules of the engine.
+func (e *External) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.VerifyUncles(ctx, &proto_consensus.VerifyUnclesRequest{Block: enc})
+	if err != nil {
+		return fmt.Errorf("verifying the uncles of the block %d by the external engine: %w", block.NumberU64(), err)
+	}
+	return engineError(reply.Error)
+}
+
+// Prepare implements consensus.Engine, replacing the header with the one
+// prepared by the engine.
+func (e *External) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	req := &proto_consensus.PrepareRequest{}
+	var err error
+	if req.Header, err = rlp.EncodeToBytes(header); err != nil {
+		return err
+	}
+	if req.Parent, err = rlp.EncodeToBytes(parent); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.Prepare(ctx, req)
+	if err != nil {
+		return fmt.Errorf("preparing the header %d by the external engine: %w", header.Number.Uint64(), err)
+	}
+	prepared := new(types.Header)
+	if err = rlp.DecodeBytes(reply.Header, prepared); err != nil {
+		return fmt.Errorf("decoding the prepared header: %w", err)
+	}
+	*header = *prepared
+	return nil
+}
+
+// Finalize implements consensus.Engine, crediting the rewards reported by the
+// engine. The failures are logged, the block execution uses FinalizeChain.
+func (e *External) Finalize(config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) {
+	if err := e.FinalizeChain(nil, config, header, state, txs, uncles); err != nil {
+		log.Error("Could not finalize the block by the external engine", "number", header.Number, "err", err)
+	}
+}
+
+// FinalizeChain implements consensus.ChainFinalizer, crediting the rewards reported
+// by the engine and replacing the header with the finalized one.
+func (e *External) FinalizeChain(_ func(hash common.Hash, number uint64) *types.Header, config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) error {
+	req := &proto_consensus.FinalizeRequest{
+		Transactions: make([][]byte, len(txs)),
+		Uncles:       make([][]byte, len(uncles)),
+	}
+	var err error
+	if req.Header, err = rlp.EncodeToBytes(header); err != nil {
+		return err
+	}
+	for i, tx := range txs {
+		if req.Transactions[i], err = tx.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	for i, uncle := range uncles {
+		if req.Uncles[i], err = rlp.EncodeToBytes(uncle); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.Finalize(ctx, req)
+	if err != nil {
+		return fmt.Errorf("finalizing the block %d by the external engine: %w", header.Number.Uint64(), err)
+	}
+	for _, reward := range reply.Rewards {
+		state.AddBalance(gointerfaces.ConvertH160toAddress(reward.Address), gointerfaces.ConvertH256ToUint256Int(reward.Amount))
+	}
+	if len(reply.Header) > 0 {
+		finalized := new(types.Header)
+		if err = rlp.DecodeBytes(reply.Header, finalized); err != nil {
+			return fmt.Errorf("decoding the finalized header: %w", err)
+		}
+		*header = *finalized
+	}
+	return nil
+}
+
+// FinalizeAndAssemble implements consensus.Engine, finalizing the block with the
+// engine and assembling it.
+func (e *External) FinalizeAndAssemble(config *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	if err := e.FinalizeChain(nil, config, header, state, txs, uncles); err != nil {
+		return nil, err
+	}
+	return types.NewBlock(header, txs, uncles, receipts), nil
+}
+
+// Seal implements consensus.Engine, asking the engine to seal the block in the
+// background. The call is cancelled when the sealing is stopped.
+func (e *External) Seal(ctx consensus.Cancel, chain consensus.ChainHeaderReader, block *types.Block, results chan<- consensus.ResultWithContext, stop <-chan struct{}) error {
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	sealCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-sealCtx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		reply, err := e.client.Seal(sealCtx, &proto_consensus.SealRequest{Block: enc})
+		if err != nil {
+			if sealCtx.Err() == nil {
+				log.Warn("Could not seal the block by the external engine", "number", block.NumberU64(), "err", err)
+			}
+			return
+		}
+		if len(reply.Block) == 0 {
+			return
+		}
+		sealed := new(types.Block)
+		if err = rlp.DecodeBytes(reply.Block, sealed); err != nil {
+			log.Warn("Could not decode the block sealed by the external engine", "number", block.NumberU64(), "err", err)
+			return
+		}
+		select {
+		case results <- consensus.ResultWithContext{Cancel: ctx, Block: sealed}:
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", e.SealHash(block.Header()))
+		}
+	}()
+	return nil
+}
+
+// SealHash implements consensus.Engine, returning the hash of the header prior
+// to it being sealed as computed by the engine.
+func (e *External) SealHash(header *types.Header) common.Hash {
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return common.Hash{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.SealHash(ctx, &proto_consensus.SealHashRequest{Header: enc})
+	if err != nil {
+		log.Warn("Could not compute the seal hash by the external engine", "number", header.Number, "err", err)
+		return common.Hash{}
+	}
+	return gointerfaces.ConvertH256ToHash(reply.Hash)
+}
+
+// CalcDifficulty implements consensus.Engine, returning the difficulty of the
+// block following the parent as computed by the engine, nil if it fails.
+func (e *External) CalcDifficulty(chain consensus.ChainHeaderReader, time, _ uint64, _, parentNumber *big.Int, parentHash, _ common.Hash) *big.Int {
+	parent := chain.GetHeader(parentHash, parentNumber.Uint64())
+	if parent == nil {
+		return nil
+	}
+	enc, err := rlp.EncodeToBytes(parent)
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	reply, err := e.client.CalcDifficulty(ctx, &proto_consensus.CalcDifficultyRequest{Parent: enc, Time: time})
+	if err != nil {
+		log.Warn("Could not compute the difficulty by the external engine", "number", parentNumber.Uint64()+1, "err", err)
+		return nil
+	}
+	return gointerfaces.ConvertH256ToUint256Int(reply.Difficulty).ToBig()
+}
+
+// APIs implements consensus.Engine, the external engine serves its own APIs.
+func (e *External) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	return nil
+}
+
+// Close implements consensus.Engine, closing the connection to the engine if
+// it was dialed by the engine.
+func (e *External) Close() error {
+	if e.close == nil {
+		return nil
+	}
+	return e.close()
+}
@@ -0,0 +1,162 @@
+package external
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	proto_consensus "github.com/ledgerwatch/turbo-geth/gointerfaces/consensus"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testEngine rejects the headers with the "bad" extra-data, rewards the coinbase with
+// an ether and seals the blocks with the nonce 1
+type testEngine struct {
+	proto_consensus.UnimplementedConsensusEngineServer
+	verifications int32
+}
+
+func (e *testEngine) VerifyHeader(_ context.Context, req *proto_consensus.VerifyHeaderRequest) (*proto_consensus.VerifyHeaderReply, error) {
+	atomic.AddInt32(&e.verifications, 1)
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(req.Header, header); err != nil {
+		return nil, err
+	}
+	if string(header.Extra) == "bad" {
+		return &proto_consensus.VerifyHeaderReply{Error: "bad extra-data"}, nil
+	}
+	return &proto_consensus.VerifyHeaderReply{}, nil
+}
+
+func (e *testEngine) Finalize(_ context.Context, req *proto_consensus.FinalizeRequest) (*proto_consensus.FinalizeReply, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(req.Header, header); err != nil {
+		return nil, err
+	}
+	header.MixDigest = common.HexToHash("0x1")
+	enc, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	return &proto_consensus.FinalizeReply{
+		Header: enc,
+		Rewards: []*proto_consensus.Reward{{
+			Address: gointerfaces.ConvertAddressToH160(header.Coinbase),
+			Amount:  gointerfaces.ConvertUint256IntToH256(uint256.NewInt().SetUint64(params.Ether)),
+		}},
+	}, nil
+}
+
+func (e *testEngine) Seal(_ context.Context, req *proto_consensus.SealRequest) (*proto_consensus.SealReply, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(req.Block, block); err != nil {
+		return nil, err
+	}
+	header := block.Header()
+	header.Nonce = types.EncodeNonce(1)
+	enc, err := rlp.EncodeToBytes(block.WithSeal(header))
+	if err != nil {
+		return nil, err
+	}
+	return &proto_consensus.SealReply{Block: enc}, nil
+}
+
+// testChain is the chain of the headers verified by the tests
+type testChain struct {
+	headers map[common.Hash]*types.Header
+}
+
+func (c *testChain) Config() *params.ChainConfig                        { return params.AllEthashProtocolChanges }
+func (c *testChain) CurrentHeader() *types.Header                       { return nil }
+func (c *testChain) GetHeader(hash common.Hash, _ uint64) *types.Header { return c.headers[hash] }
+func (c *testChain) GetHeaderByNumber(uint64) *types.Header             { return nil }
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header     { return c.headers[hash] }
+
+// newTestExternal serves the engine in memory and returns the consensus engine calling it
+func newTestExternal(t *testing.T, engine proto_consensus.ConsensusEngineServer) *External {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	proto_consensus.RegisterConsensusEngineServer(server, engine)
+	go server.Serve(listener) //nolint:errcheck
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	require.NoError(t, err)
+	e := New(proto_consensus.NewConsensusEngineClient(conn))
+	e.close = conn.Close
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestVerifyHeaderCached(t *testing.T) {
+	engine := &testEngine{}
+	e := newTestExternal(t, engine)
+
+	genesis := &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)}
+	chain := &testChain{headers: map[common.Hash]*types.Header{genesis.Hash(): genesis}}
+	good := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Difficulty: big.NewInt(1)}
+	bad := &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1), Difficulty: big.NewInt(1), Extra: []byte("bad")}
+
+	require.NoError(t, e.VerifyHeader(chain, good, true))
+	require.NoError(t, e.VerifyHeader(chain, good, true))
+	// The header valid with the seal is valid without it
+	require.NoError(t, e.VerifyHeader(chain, good, false))
+	require.EqualValues(t, 1, atomic.LoadInt32(&engine.verifications))
+
+	require.EqualError(t, e.VerifyHeader(chain, bad, true), "bad extra-data")
+	require.EqualError(t, e.VerifyHeader(chain, bad, true), "bad extra-data")
+	require.EqualValues(t, 2, atomic.LoadInt32(&engine.verifications))
+
+	orphan := &types.Header{ParentHash: common.HexToHash("0x1"), Number: big.NewInt(1), Difficulty: big.NewInt(1)}
+	require.Equal(t, consensus.ErrUnknownAncestor, e.VerifyHeader(chain, orphan, true))
+	require.EqualValues(t, 2, atomic.LoadInt32(&engine.verifications))
+}
+
+func TestVerifyHeaderTransportErrorNotCached(t *testing.T) {
+	e := newTestExternal(t, &proto_consensus.UnimplementedConsensusEngineServer{})
+
+	genesis := &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)}
+	chain := &testChain{headers: map[common.Hash]*types.Header{}}
+	require.Error(t, e.VerifyHeader(chain, genesis, true))
+	require.Equal(t, 0, e.verifications.Len())
+}
+
+func TestFinalizeAndSeal(t *testing.T) {
+	e := newTestExternal(t, &testEngine{})
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	coinbase := common.HexToAddress("0xc0ffee")
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), Coinbase: coinbase}
+	ibs := state.New(state.NewPlainStateReader(db))
+	block, err := e.FinalizeAndAssemble(params.AllEthashProtocolChanges, header, ibs, nil, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, common.HexToHash("0x1"), block.MixDigest())
+	require.Equal(t, uint256.NewInt().SetUint64(params.Ether), ibs.GetBalance(coinbase))
+
+	results := make(chan consensus.ResultWithContext, 1)
+	require.NoError(t, e.Seal(consensus.NewCancel(), nil, block, results, make(chan struct{})))
+	select {
+	case result := <-results:
+		require.Equal(t, types.EncodeNonce(1), result.Block.Header().Nonce)
+		require.Equal(t, block.Header().Root, result.Block.Header().Root)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the block was not sealed")
+	}
+}
@@ -0,0 +1,81 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/math"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var errMissingBaseFee = errors.New("header is missing baseFee")
+
+// VerifyGaslimit verifies the header gas limit according to the parent gas limit,
+// it must not change by 1/1024 or more and must not be less than the minimum.
+func VerifyGaslimit(parentGasLimit, headerGasLimit uint64) error {
+	diff := int64(parentGasLimit) - int64(headerGasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	limit := parentGasLimit / params.GasLimitBoundDivisor
+	if uint64(diff) >= limit || headerGasLimit < params.MinGasLimit {
+		return fmt.Errorf("invalid gas limit: have %d, want %d += %d", headerGasLimit, parentGasLimit, limit)
+	}
+	return nil
+}
+
+// VerifyEip1559Header verifies the header attributes which were changed in EIP-1559:
+// the gas limit (which is doubled at the fork block to keep the gas target) and the base fee.
+func VerifyEip1559Header(config *params.ChainConfig, parent, header *types.Header) error {
+	parentGasLimit := parent.GasLimit
+	if !config.IsLondon(parent.Number) {
+		parentGasLimit = parent.GasLimit * config.ElasticityMultiplier(header.Number)
+	}
+	if err := VerifyGaslimit(parentGasLimit, header.GasLimit); err != nil {
+		return err
+	}
+	if header.BaseFee == nil {
+		return errMissingBaseFee
+	}
+	if expected := CalcBaseFee(config, parent); header.BaseFee.Cmp(expected) != 0 {
+		return fmt.Errorf("invalid baseFee: have %s, want %s, parentBaseFee %s, parentGasUsed %d",
+			header.BaseFee, expected, parent.BaseFee, parent.GasUsed)
+	}
+	return nil
+}
+
+// CalcBaseFee calculates the base fee of the block following the parent. The base fee
+// goes up (by at most 1/8 on mainnet) when the parent used more than its gas target (half
+// of the gas limit on mainnet), and goes down when it used less. The fee market parameters
+// of the chain config in effect at the block are used.
+func CalcBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	// The first EIP-1559 block gets the initial base fee
+	if !config.IsLondon(parent.Number) {
+		return config.InitialBaseFee()
+	}
+
+	number := new(big.Int).Add(parent.Number, common.Big1)
+	var (
+		parentGasTarget          = parent.GasLimit / config.ElasticityMultiplier(number)
+		parentGasTargetBig       = new(big.Int).SetUint64(parentGasTarget)
+		baseFeeChangeDenominator = new(big.Int).SetUint64(config.BaseFeeChangeDenominator(number))
+	)
+	if parent.GasUsed == parentGasTarget {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+	if parent.GasUsed > parentGasTarget {
+		gasUsedDelta := new(big.Int).SetUint64(parent.GasUsed - parentGasTarget)
+		x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+		y := x.Div(x, parentGasTargetBig)
+		baseFeeDelta := math.BigMax(x.Div(y, baseFeeChangeDenominator), common.Big1)
+		return x.Add(parent.BaseFee, baseFeeDelta)
+	}
+	gasUsedDelta := new(big.Int).SetUint64(parentGasTarget - parent.GasUsed)
+	x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+	y := x.Div(x, parentGasTargetBig)
+	baseFeeDelta := x.Div(y, baseFeeChangeDenominator)
+	return math.BigMax(x.Sub(parent.BaseFee, baseFeeDelta), common.Big0)
+}
@@ -0,0 +1,145 @@
+package misc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// londonConfig returns a copy of the test chain config with London activated at block 5
+func londonConfig() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.LondonBlock = big.NewInt(5)
+	return &config
+}
+
+func TestBlockGasLimits(t *testing.T) {
+	initial := new(big.Int).SetUint64(params.InitialBaseFee)
+
+	for i, tc := range []struct {
+		pGasLimit uint64
+		pNum      int64
+		gasLimit  uint64
+		ok        bool
+	}{
+		// Transition block, the parent gas limit is doubled
+		{10000000, 4, 20000000, true},
+		{10000000, 4, 20019530, true},
+		{10000000, 4, 20019531, false},
+		{10000000, 4, 19980470, true},
+		{10000000, 4, 19980469, false},
+		// After the transition
+		{20000000, 5, 20000000, true},
+		{20000000, 5, 20019530, true},
+		{20000000, 5, 20019531, false},
+		{20000000, 5, 19980470, true},
+		{20000000, 5, 19980469, false},
+		{40000000, 5, 40039061, true},
+		{40000000, 5, 40039062, false},
+		{40000000, 5, 39960939, true},
+		{40000000, 5, 39960938, false},
+	} {
+		parent := &types.Header{
+			GasUsed:  tc.pGasLimit / 2,
+			GasLimit: tc.pGasLimit,
+			BaseFee:  initial,
+			Number:   big.NewInt(tc.pNum),
+		}
+		header := &types.Header{
+			GasUsed:  tc.gasLimit / 2,
+			GasLimit: tc.gasLimit,
+			BaseFee:  initial,
+			Number:   big.NewInt(tc.pNum + 1),
+		}
+		err := VerifyEip1559Header(londonConfig(), parent, header)
+		if tc.ok && err != nil {
+			t.Errorf("test %d: expected valid header: %s", i, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("test %d: expected invalid header", i)
+		}
+	}
+}
+
+func TestMissingBaseFee(t *testing.T) {
+	parent := &types.Header{GasLimit: 10000000, Number: big.NewInt(4)}
+	header := &types.Header{GasLimit: 20000000, Number: big.NewInt(5)}
+	if err := VerifyEip1559Header(londonConfig(), parent, header); err != errMissingBaseFee {
+		t.Errorf("expected %v, got %v", errMissingBaseFee, err)
+	}
+}
+
+func TestCalcBaseFee(t *testing.T) {
+	tests := []struct {
+		parentBaseFee   int64
+		parentGasLimit  uint64
+		parentGasUsed   uint64
+		expectedBaseFee int64
+	}{
+		{params.InitialBaseFee, 20000000, 10000000, params.InitialBaseFee}, // usage == target
+		{params.InitialBaseFee, 20000000, 9000000, 987500000},              // usage below target
+		{params.InitialBaseFee, 20000000, 11000000, 1012500000},            // usage above target
+		{params.InitialBaseFee, 20000000, 20000000, 1125000000},            // full block
+		{params.InitialBaseFee, 20000000, 0, 875000000},                    // empty block
+		{7, 20000000, 10000001, 8},                                         // increase by at least one
+	}
+	for i, test := range tests {
+		parent := &types.Header{
+			Number:   big.NewInt(5),
+			GasLimit: test.parentGasLimit,
+			GasUsed:  test.parentGasUsed,
+			BaseFee:  big.NewInt(test.parentBaseFee),
+		}
+		if have, want := CalcBaseFee(londonConfig(), parent), big.NewInt(test.expectedBaseFee); have.Cmp(want) != 0 {
+			t.Errorf("test %d: have %d  want %d, ", i, have, want)
+		}
+	}
+
+	// The first London block gets the initial base fee
+	parent := &types.Header{Number: big.NewInt(4), GasLimit: 10000000, GasUsed: 10000000}
+	if have := CalcBaseFee(londonConfig(), parent); have.Uint64() != params.InitialBaseFee {
+		t.Errorf("fork block: have %d want %d", have, params.InitialBaseFee)
+	}
+}
+
+func TestCalcBaseFeeCustomFeeMarket(t *testing.T) {
+	config := londonConfig()
+	config.FeeMarket = &params.FeeMarketConfig{ElasticityMultiplier: 4, BaseFeeChangeDenominator: 16, InitialBaseFee: big.NewInt(7)}
+	scheduled := londonConfig()
+	scheduled.FeeMarket = &params.FeeMarketConfig{Block: big.NewInt(8), ElasticityMultiplier: 4, BaseFeeChangeDenominator: 16, InitialBaseFee: big.NewInt(7)}
+
+	tests := []struct {
+		config          *params.ChainConfig
+		parentNumber    int64
+		parentGasUsed   uint64
+		expectedBaseFee int64
+	}{
+		{config, 4, 0, 7}, // the initial base fee of the fork block
+		{config, 5, 5000000, params.InitialBaseFee},    // usage == target of the quarter of the gas limit
+		{config, 5, 20000000, 1187500000},              // full block, up by 3/16
+		{scheduled, 4, 0, params.InitialBaseFee},       // the mainnet initial base fee before the switch
+		{scheduled, 6, 5000000, 937500000},             // the mainnet target of the half of the gas limit before the switch
+		{scheduled, 7, 5000000, params.InitialBaseFee}, // the block of the switch
+		{scheduled, 8, 20000000, 1187500000},           // after the switch
+	}
+	for i, test := range tests {
+		parent := &types.Header{
+			Number:   big.NewInt(test.parentNumber),
+			GasLimit: 20000000,
+			GasUsed:  test.parentGasUsed,
+			BaseFee:  new(big.Int).SetUint64(params.InitialBaseFee),
+		}
+		if have, want := CalcBaseFee(test.config, parent), big.NewInt(test.expectedBaseFee); have.Cmp(want) != 0 {
+			t.Errorf("test %d: have %d  want %d, ", i, have, want)
+		}
+	}
+
+	// The gas limit is multiplied by the elasticity at the fork block to keep the gas target
+	parent := &types.Header{Number: big.NewInt(4), GasLimit: 10000000}
+	header := &types.Header{Number: big.NewInt(5), GasLimit: 40000000, BaseFee: big.NewInt(7)}
+	if err := VerifyEip1559Header(config, parent, header); err != nil {
+		t.Errorf("fork block: %v", err)
+	}
+}
@@ -1903,7 +1903,9 @@ func (bc *BlockChain) doneJob() {
 }
 
 // ExecuteBlockEphemerally runs a block from provided stateReader and
-// writes the result to the provided stateWriter
+// writes the result to the provided stateWriter. Besides the receipts of the
+// transactions it returns the receipt of the bor system transaction, nil when
+// the block committed no state sync events
 func ExecuteBlockEphemerally(
 	chainConfig *params.ChainConfig,
 	vmConfig *vm.Config,
@@ -1912,7 +1914,7 @@ func ExecuteBlockEphemerally(
 	block *types.Block,
 	stateReader state.StateReader,
 	stateWriter state.WriterWithChangeSets,
-) (types.Receipts, error) {
+) (types.Receipts, *types.Receipt, error) {
 	defer blockExecutionTimer.UpdateSince(time.Now())
 	defer blockExecutionNumber.Update(block.Number().Int64())
 	block.Uncles()
@@ -1932,7 +1934,7 @@ func ExecuteBlockEphemerally(
 		}
 		receipt, err := ApplyTransaction(chainConfig, chainContext, nil, gp, ibs, noop, header, tx, usedGas, *vmConfig)
 		if err != nil {
-			return nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+			return nil, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
 		}
 		//fmt.Printf("Tx Hash: %x, gas used: %d\n", tx.Hash(), receipt.GasUsed)
 		if !vmConfig.NoReceipts {
@@ -1940,6 +1942,27 @@ func ExecuteBlockEphemerally(
 		}
 	}
 
+	borReceipt, err := finishBlockExecution(chainConfig, vmConfig, chainContext, engine, block, ibs, stateWriter, receipts, *usedGas)
+	if err != nil {
+		return nil, nil, err
+	}
+	return receipts, borReceipt, nil
+}
+
+// finishBlockExecution verifies the results of the executed transactions of the block against its header and
+// finalizes the block, it returns the receipt of the state sync events of bor if any
+func finishBlockExecution(
+	chainConfig *params.ChainConfig,
+	vmConfig *vm.Config,
+	chainContext ChainContext,
+	engine consensus.Engine,
+	block *types.Block,
+	ibs *state.IntraBlockState,
+	stateWriter state.WriterWithChangeSets,
+	receipts types.Receipts,
+	usedGas uint64,
+) (*types.Receipt, error) {
+	header := block.Header()
 	if chainConfig.IsByzantium(header.Number) && !vmConfig.NoReceipts {
 		receiptSha := types.DeriveSha(receipts)
 		if receiptSha != block.Header().ReceiptHash {
@@ -1948,12 +1971,12 @@ func ExecuteBlockEphemerally(
 	}
 
 	if !vmConfig.ReadOnly {
-		if err := FinalizeBlockExecution(engine, block.Header(), block.Transactions(), block.Uncles(), stateWriter, chainConfig, ibs); err != nil {
+		if err := FinalizeBlockExecution(engine, chainContext.GetHeader, block.Header(), block.Transactions(), block.Uncles(), stateWriter, chainConfig, ibs); err != nil {
 			return nil, err
 		}
 	}
-	if *usedGas != header.GasUsed {
-		return nil, fmt.Errorf("gas used by execution: %d, in header: %d", *usedGas, header.GasUsed)
+	if usedGas != header.GasUsed {
+		return nil, fmt.Errorf("gas used by execution: %d, in header: %d", usedGas, header.GasUsed)
 	}
 	if !vmConfig.NoReceipts {
 		bloom := types.CreateBloom(receipts)
@@ -1962,12 +1985,25 @@ func ExecuteBlockEphemerally(
 		}
 	}
 
-	return receipts, nil
+	// The state sync events committed by bor are the logs of its system transaction, which follows the block's ones
+	var borReceipt *types.Receipt
+	if chainConfig.Bor != nil && !vmConfig.NoReceipts && !vmConfig.ReadOnly {
+		if logs := ibs.GetLogs(types.ComputeBorTxHash(block.NumberU64(), block.Hash())); len(logs) > 0 {
+			borReceipt = types.NewBorReceipt(block.NumberU64(), block.Hash(), receipts, logs)
+		}
+	}
+	return borReceipt, nil
 }
 
-func FinalizeBlockExecution(engine consensus.Engine, header *types.Header, txs types.Transactions, uncles []*types.Header, stateWriter state.WriterWithChangeSets, cc *params.ChainConfig, ibs *state.IntraBlockState) error {
+func FinalizeBlockExecution(engine consensus.Engine, getHeader func(hash common.Hash, number uint64) *types.Header, header *types.Header, txs types.Transactions, uncles []*types.Header, stateWriter state.WriterWithChangeSets, cc *params.ChainConfig, ibs *state.IntraBlockState) error {
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	engine.Finalize(cc, header, ibs, txs, uncles)
+	if finalizer, ok := engine.(consensus.ChainFinalizer); ok {
+		if err := finalizer.FinalizeChain(getHeader, cc, header, ibs, txs, uncles); err != nil {
+			return fmt.Errorf("finalizing block %d failed: %w", header.Number.Uint64(), err)
+		}
+	} else {
+		engine.Finalize(cc, header, ibs, txs, uncles)
+	}
 
 	ctx := cc.WithEIPsFlags(context.Background(), header.Number)
 	if err := ibs.CommitBlock(ctx, stateWriter); err != nil {
@@ -204,7 +204,8 @@ func InsertBodyChain(logPrefix string, ctx context.Context, db ethdb.Database, c
 	)
 }
 
-// InsertBodies is insertChain with execute=false and ommission of blockchain object
+// InsertBodies is insertChain with execute=false and ommission of blockchain object. The numbers of the
+// transactions of the blocks are indexed if they are the new canonical ones
 func InsertBodies(
 	logPrefix string,
 	ctx context.Context,
@@ -247,6 +248,11 @@ func InsertBodies(
 		if err != nil {
 			return true, err
 		}
+		if newCanonical {
+			if err = rawdb.WriteTxCount(batch, block.NumberU64(), uint32(len(block.Transactions()))); err != nil {
+				return true, err
+			}
+		}
 
 		log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(),
 			"uncles", len(block.Uncles()), "txs", len(block.Transactions()), "gas", block.GasUsed(),
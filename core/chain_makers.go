@@ -31,6 +31,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/ledgerwatch/turbo-geth/turbo/verkle"
 )
 
 // BlockGen creates blocks for testing.
@@ -305,17 +306,31 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, engine conse
 				}
 				fmt.Printf("===============================\n")
 			}
-			var hashCollector func(keyHex []byte, _, _, _ uint16, hashes []byte, rootHash []byte) error
-			var storageHashCollector func(addrWithInc []byte, keyHex []byte, _, _, _ uint16, hashes []byte, rootHash []byte) error
-			unfurl := trie.NewRetainList(0)
-			loader := trie.NewFlatDBTrieLoader("GenerateChain")
-			if err := loader.Reset(unfurl, hashCollector, storageHashCollector, false); err != nil {
-				return nil, nil, fmt.Errorf("call to FlatDbSubTrieLoader.Reset: %w", err)
-			}
-			if hash, err := loader.CalcTrieRoot(tx, []byte{}, nil); err == nil {
+			if config.IsVerkle() {
+				hash, err := verkle.ComputeRoot(tx.(ethdb.HasTx).Tx(), nil)
+				if err != nil {
+					return nil, nil, fmt.Errorf("call to verkle.ComputeRoot: %w", err)
+				}
+				b.header.Root = hash
+			} else if config.IsBinaryTrie() {
+				hash, err := trie.CalcBinaryRoot(tx.(ethdb.HasTx).Tx(), nil)
+				if err != nil {
+					return nil, nil, fmt.Errorf("call to CalcBinaryRoot: %w", err)
+				}
 				b.header.Root = hash
 			} else {
-				return nil, nil, fmt.Errorf("call to CalcTrieRoot: %w", err)
+				var hashCollector func(keyHex []byte, _, _, _ uint16, hashes []byte, rootHash []byte) error
+				var storageHashCollector func(addrWithInc []byte, keyHex []byte, _, _, _ uint16, hashes []byte, rootHash []byte) error
+				unfurl := trie.NewRetainList(0)
+				loader := trie.NewFlatDBTrieLoader("GenerateChain")
+				if err := loader.Reset(unfurl, hashCollector, storageHashCollector, false); err != nil {
+					return nil, nil, fmt.Errorf("call to FlatDbSubTrieLoader.Reset: %w", err)
+				}
+				if hash, err := loader.CalcTrieRoot(tx, []byte{}, nil); err == nil {
+					b.header.Root = hash
+				} else {
+					return nil, nil, fmt.Errorf("call to CalcTrieRoot: %w", err)
+				}
 			}
 
 			// Recreating block to make sure Root makes it into the header
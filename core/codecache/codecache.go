@@ -0,0 +1,134 @@
+// Package codecache keeps the code of the contracts and the results of its JUMPDEST analysis by the code hash,
+// shared by all the readers of the state in the process: the execution of the blocks, the tracing and the calls
+package codecache
+
+import (
+	"math"
+	"sync"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// DefaultSize is the size of the Shared cache unless it is changed by SetSize
+const DefaultSize = 64 * datasize.MB
+
+var (
+	codeHit      = metrics.NewRegisteredCounter("codecache/code/hit", nil)
+	codeMiss     = metrics.NewRegisteredCounter("codecache/code/miss", nil)
+	analysisHit  = metrics.NewRegisteredCounter("codecache/analysis/hit", nil)
+	analysisMiss = metrics.NewRegisteredCounter("codecache/analysis/miss", nil)
+)
+
+// Shared is the cache of the process
+var Shared = New(DefaultSize)
+
+type entry struct {
+	code     []byte
+	analysis []uint64
+}
+
+func (e *entry) size() int {
+	return len(e.code) + 8*len(e.analysis)
+}
+
+// Cache is the LRU cache of the code and its analysis bounded by their total size. The code with the given hash
+// never changes, so the entries are never invalidated. The cached slices are shared by the readers, they must not be
+// modified. The cache is safe for the concurrent use
+type Cache struct {
+	lock  sync.Mutex
+	lru   *simplelru.LRU // common.Hash -> *entry
+	used  int
+	limit int
+}
+
+// New creates the cache of the given size, the cache of zero size keeps nothing
+func New(size datasize.ByteSize) *Cache {
+	c := &Cache{limit: int(size)}
+	c.lru, _ = simplelru.NewLRU(math.MaxInt32, func(_, value interface{}) {
+		c.used -= value.(*entry).size()
+	})
+	return c
+}
+
+// SetSize changes the size of the cache, evicting the least recently used entries over it
+func (c *Cache) SetSize(size datasize.ByteSize) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.limit = int(size)
+	c.evict()
+}
+
+// Code returns the code of the hash if cached
+func (c *Cache) Code(hash common.Hash) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if v, ok := c.lru.Get(hash); ok && v.(*entry).code != nil {
+		codeHit.Inc(1)
+		return v.(*entry).code, true
+	}
+	codeMiss.Inc(1)
+	return nil, false
+}
+
+// AddCode caches the code of the hash, the code is copied
+func (c *Cache) AddCode(hash common.Hash, code []byte) {
+	if len(code) == 0 || len(code) > c.limit {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.update(hash, func(e *entry) {
+		if e.code == nil {
+			e.code = common.CopyBytes(code)
+		}
+	})
+}
+
+// Analysis returns the JUMPDEST analysis of the code of the hash if cached
+func (c *Cache) Analysis(hash common.Hash) ([]uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if v, ok := c.lru.Get(hash); ok && v.(*entry).analysis != nil {
+		analysisHit.Inc(1)
+		return v.(*entry).analysis, true
+	}
+	analysisMiss.Inc(1)
+	return nil, false
+}
+
+// AddAnalysis caches the JUMPDEST analysis of the code of the hash, the analysis is not copied
+func (c *Cache) AddAnalysis(hash common.Hash, analysis []uint64) {
+	if analysis == nil || 8*len(analysis) > c.limit {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.update(hash, func(e *entry) {
+		if e.analysis == nil {
+			e.analysis = analysis
+		}
+	})
+}
+
+// update applies the change to the entry of the hash, created if not cached, and accounts for its new size
+func (c *Cache) update(hash common.Hash, change func(e *entry)) {
+	e := &entry{}
+	if v, ok := c.lru.Get(hash); ok {
+		e = v.(*entry)
+	} else {
+		c.lru.Add(hash, e)
+	}
+	before := e.size()
+	change(e)
+	c.used += e.size() - before
+	c.evict()
+}
+
+func (c *Cache) evict() {
+	for c.used > c.limit && c.lru.Len() > 0 {
+		c.lru.RemoveOldest()
+	}
+}
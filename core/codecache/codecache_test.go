@@ -0,0 +1,81 @@
+package codecache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+func TestCache(t *testing.T) {
+	c := New(100)
+	code := []byte{1, 2, 3}
+	c.AddCode(common.Hash{1}, code)
+	code[0] = 0
+	if cached, ok := c.Code(common.Hash{1}); !ok || !bytes.Equal(cached, []byte{1, 2, 3}) {
+		t.Fatalf("code %x, %t", cached, ok)
+	}
+	if _, ok := c.Analysis(common.Hash{1}); ok {
+		t.Fatal("the analysis is not added yet")
+	}
+	c.AddAnalysis(common.Hash{1}, []uint64{7})
+	if analysis, ok := c.Analysis(common.Hash{1}); !ok || len(analysis) != 1 || analysis[0] != 7 {
+		t.Fatalf("analysis %v, %t", analysis, ok)
+	}
+	if _, ok := c.Code(common.Hash{2}); ok {
+		t.Fatal("the code of the unknown hash")
+	}
+	c.AddCode(common.Hash{2}, nil)
+	if _, ok := c.Code(common.Hash{2}); ok {
+		t.Fatal("the empty code is cached")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := New(100)
+	for i := byte(0); i < 4; i++ {
+		c.AddCode(common.Hash{i}, make([]byte, 30))
+	}
+	if _, ok := c.Code(common.Hash{0}); ok {
+		t.Error("the least recently used code is kept over the size")
+	}
+	for i := byte(1); i < 4; i++ {
+		if _, ok := c.Code(common.Hash{i}); !ok {
+			t.Errorf("code %d is evicted", i)
+		}
+	}
+	// The code larger than the whole cache is not cached and evicts nothing
+	c.AddCode(common.Hash{4}, make([]byte, 101))
+	if _, ok := c.Code(common.Hash{4}); ok {
+		t.Error("the code over the size is cached")
+	}
+	if _, ok := c.Code(common.Hash{1}); !ok {
+		t.Error("the code over the size evicted the cached one")
+	}
+	// The analysis counts towards the size of the entry
+	c.AddAnalysis(common.Hash{1}, make([]uint64, 5))
+	if _, ok := c.Code(common.Hash{2}); ok {
+		t.Error("the least recently used code is kept over the size")
+	}
+
+	// Code 3 is now the least recently used one
+	c.SetSize(70)
+	if _, ok := c.Code(common.Hash{3}); ok {
+		t.Error("the least recently used code is kept over the new size")
+	}
+	if _, ok := c.Code(common.Hash{1}); !ok {
+		t.Error("the entry within the new size is evicted")
+	}
+}
+
+func TestCacheZeroSize(t *testing.T) {
+	c := New(0)
+	c.AddCode(common.Hash{1}, []byte{1})
+	c.AddAnalysis(common.Hash{1}, []uint64{1})
+	if _, ok := c.Code(common.Hash{1}); ok {
+		t.Error("the code is cached")
+	}
+	if _, ok := c.Analysis(common.Hash{1}); ok {
+		t.Error("the analysis is cached")
+	}
+}
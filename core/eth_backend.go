@@ -12,6 +12,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces/remote"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rlp"
 	"google.golang.org/grpc/status"
@@ -31,6 +32,20 @@ type ApiBackend interface {
 	SubmitWork(ctx context.Context, nonce types.BlockNonce, hash, digest common.Hash) (bool, error)
 	SubmitHashRate(ctx context.Context, rate hexutil.Uint64, id common.Hash) (bool, error)
 	GetHashRate(ctx context.Context) (uint64, error)
+
+	// TxPoolContent returns the pending and queued transactions grouped by sender, only the ones of the given sender if it isn't nil
+	TxPoolContent(ctx context.Context, sender *common.Address) (map[common.Address]types.Transactions, map[common.Address]types.Transactions, error)
+	TxPoolStatus(ctx context.Context) (pending int, queued int, err error)
+	// SubscribePendingTxs calls cb with the transactions as soon as they become executable, until the stream ends
+	SubscribePendingTxs(ctx context.Context, cb func(types.Transactions)) error
+
+	// BuildBlock assembles the block the miner would build on top of the parent, without sealing or broadcasting it.
+	// Only the pending transactions of txHashes are selected, all of them if it is empty
+	BuildBlock(ctx context.Context, parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error)
+
+	// InsertBlocks validates the blocks built by an external source, which have to form a chain extending a known
+	// block, and imports them through the staged sync. It returns whether they became the canonical chain
+	InsertBlocks(ctx context.Context, blocks []*types.Block) (bool, error)
 }
 
 type EthBackend interface {
@@ -38,6 +53,8 @@ type EthBackend interface {
 	Etherbase() (common.Address, error)
 	NetVersion() (uint64, error)
 	IsMining() bool
+	BuildBlock(parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error)
+	InsertBlocks(blocks []*types.Block) (bool, error)
 }
 
 type EthBackendImpl struct {
@@ -84,15 +101,61 @@ func (back *EthBackendImpl) GetHashRate(ctx context.Context) (uint64, error) {
 func (back *EthBackendImpl) Mining(ctx context.Context) (bool, error) {
 	return back.eth.IsMining(), nil
 }
+func (back *EthBackendImpl) TxPoolContent(_ context.Context, sender *common.Address) (map[common.Address]types.Transactions, map[common.Address]types.Transactions, error) {
+	if sender == nil {
+		pending, queued := back.eth.TxPool().Content()
+		return pending, queued, nil
+	}
+	pending, queued := make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions)
+	senderPending, senderQueued := back.eth.TxPool().ContentFrom(*sender)
+	if len(senderPending) > 0 {
+		pending[*sender] = senderPending
+	}
+	if len(senderQueued) > 0 {
+		queued[*sender] = senderQueued
+	}
+	return pending, queued, nil
+}
+func (back *EthBackendImpl) TxPoolStatus(_ context.Context) (int, int, error) {
+	pending, queued := back.eth.TxPool().Stats()
+	return pending, queued, nil
+}
+
+func (back *EthBackendImpl) SubscribePendingTxs(ctx context.Context, cb func(types.Transactions)) error {
+	ch := make(chan NewTxsEvent, 256)
+	sub := back.eth.TxPool().SubscribeNewTxsEvent(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			cb(ev.Txs)
+		case err := <-sub.Err(): // closed with nil when the pool stops
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (back *EthBackendImpl) BuildBlock(_ context.Context, parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error) {
+	return back.eth.BuildBlock(parentHash, txHashes)
+}
+
+func (back *EthBackendImpl) InsertBlocks(_ context.Context, blocks []*types.Block) (bool, error) {
+	return back.eth.InsertBlocks(blocks)
+}
 
 type RemoteBackend struct {
 	remoteEthBackend remote.ETHBACKENDClient
+	remoteTxPool     txpool.TxpoolClient
 	log              log.Logger
 }
 
 func NewRemoteBackend(kv ethdb.KV) *RemoteBackend {
+	conn := kv.(*ethdb.RemoteKV).GrpcConn()
 	return &RemoteBackend{
-		remoteEthBackend: remote.NewETHBACKENDClient(kv.(*ethdb.RemoteKV).GrpcConn()),
+		remoteEthBackend: remote.NewETHBACKENDClient(conn),
+		remoteTxPool:     txpool.NewTxpoolClient(conn),
 		log:              log.New("remote_db"),
 	}
 }
@@ -155,6 +218,32 @@ func (back *RemoteBackend) Subscribe(ctx context.Context, onNewEvent func(*remot
 	return nil
 }
 
+func (back *RemoteBackend) SubscribePendingTxs(ctx context.Context, onNewTxs func(types.Transactions)) error {
+	subscription, err := back.remoteTxPool.OnPending(ctx, &txpool.OnPendingRequest{})
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return errors.New(s.Message())
+		}
+		return err
+	}
+	for {
+		reply, err := subscription.Recv()
+		if err == io.EOF {
+			log.Info("rpcdaemon: the pending transactions channel was closed")
+			break
+		}
+		if err != nil {
+			return err
+		}
+		txs, err := decodeTransactions(reply.Txs)
+		if err != nil {
+			return err
+		}
+		onNewTxs(txs)
+	}
+	return nil
+}
+
 func (back *RemoteBackend) GetWork(ctx context.Context) ([4]string, error) {
 	var res [4]string
 	repl, err := back.remoteEthBackend.GetWork(ctx, &remote.GetWorkRequest{})
@@ -215,3 +304,92 @@ func (back *RemoteBackend) GetHashRate(ctx context.Context) (uint64, error) {
 	}
 	return repl.HashRate, err
 }
+
+func (back *RemoteBackend) TxPoolContent(ctx context.Context, sender *common.Address) (map[common.Address]types.Transactions, map[common.Address]types.Transactions, error) {
+	req := &txpool.ContentRequest{}
+	if sender != nil {
+		req.Sender = gointerfaces.ConvertAddressToH160(*sender)
+	}
+	repl, err := back.remoteTxPool.Content(ctx, req)
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, nil, errors.New(s.Message())
+		}
+		return nil, nil, err
+	}
+	pending := make(map[common.Address]types.Transactions, len(repl.Senders))
+	queued := make(map[common.Address]types.Transactions, len(repl.Senders))
+	for _, senderTxs := range repl.Senders {
+		addr := gointerfaces.ConvertH160toAddress(senderTxs.Sender)
+		if pending[addr], err = decodeTransactions(senderTxs.Pending); err != nil {
+			return nil, nil, err
+		}
+		if queued[addr], err = decodeTransactions(senderTxs.Queued); err != nil {
+			return nil, nil, err
+		}
+	}
+	return pending, queued, nil
+}
+
+func (back *RemoteBackend) TxPoolStatus(ctx context.Context) (int, int, error) {
+	repl, err := back.remoteTxPool.Status(ctx, &txpool.StatusRequest{})
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return 0, 0, errors.New(s.Message())
+		}
+		return 0, 0, err
+	}
+	return int(repl.PendingCount), int(repl.QueuedCount), nil
+}
+
+func (back *RemoteBackend) BuildBlock(ctx context.Context, parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error) {
+	req := &remote.BuildBlockRequest{ParentHash: gointerfaces.ConvertHashToH256(parentHash)}
+	for _, hash := range txHashes {
+		req.TxHashes = append(req.TxHashes, gointerfaces.ConvertHashToH256(hash))
+	}
+	repl, err := back.remoteEthBackend.BuildBlock(ctx, req)
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, nil, errors.New(s.Message())
+		}
+		return nil, nil, err
+	}
+	block := new(types.Block)
+	if err = rlp.DecodeBytes(repl.Block, block); err != nil {
+		return nil, nil, err
+	}
+	var receipts types.Receipts
+	if err = rlp.DecodeBytes(repl.Receipts, &receipts); err != nil {
+		return nil, nil, err
+	}
+	return block, receipts, nil
+}
+
+func (back *RemoteBackend) InsertBlocks(ctx context.Context, blocks []*types.Block) (bool, error) {
+	req := &remote.InsertBlocksRequest{Blocks: make([][]byte, len(blocks))}
+	for i, block := range blocks {
+		var err error
+		if req.Blocks[i], err = rlp.EncodeToBytes(block); err != nil {
+			return false, err
+		}
+	}
+	repl, err := back.remoteEthBackend.InsertBlocks(ctx, req)
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return false, errors.New(s.Message())
+		}
+		return false, err
+	}
+	return repl.Canonical, nil
+}
+
+func decodeTransactions(encoded [][]byte) (types.Transactions, error) {
+	txs := make(types.Transactions, len(encoded))
+	for i, enc := range encoded {
+		txs[i] = new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, txs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
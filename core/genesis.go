@@ -19,6 +19,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"embed"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -36,11 +37,13 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/ledgerwatch/turbo-geth/rlp"
 	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/ledgerwatch/turbo-geth/turbo/verkle"
 )
 
 //go:generate gencodec -type Genesis -field-override genesisSpecMarshaling -out gen_genesis.go
@@ -159,7 +162,10 @@ func SetupGenesisBlock(db ethdb.Database, genesis *Genesis, history bool, overwr
 	return SetupGenesisBlockWithOverride(db, genesis, nil, history, overwrite)
 }
 
-func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, overrideBerlin *big.Int, history bool, overwrite bool) (*params.ChainConfig, common.Hash, *state.IntraBlockState, error) {
+// SetupGenesisBlockWithOverride is SetupGenesisBlock with the forks of the chain config rescheduled by the overrides.
+// The overrides apply to the stored config of the chains without the bundled config too. Unlike the config of the
+// genesis, the overrides incompatible with the already executed blocks are an error rather than a rewind.
+func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, overrides *params.ChainOverrides, history bool, overwrite bool) (*params.ChainConfig, common.Hash, *state.IntraBlockState, error) {
 	var stateDB *state.IntraBlockState
 	if genesis != nil && genesis.Config == nil {
 		return params.AllEthashProtocolChanges, common.Hash{}, stateDB, ErrGenesisNoConfig
@@ -197,16 +203,27 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 	}
 	// Get the existing chain configuration.
 	newcfg := genesis.configOrDefault(stored)
-	if overrideBerlin != nil {
-		newcfg.BerlinBlock = overrideBerlin
-	}
-	if err := newcfg.CheckConfigForkOrder(); err != nil {
-		return newcfg, common.Hash{}, nil, err
-	}
 	storedcfg, err := rawdb.ReadChainConfig(db, stored)
 	if err != nil {
 		return newcfg, common.Hash{}, nil, err
 	}
+	// Special case: don't change the existing config of a non-mainnet chain if no new
+	// config is supplied. These chains would get AllProtocolChanges (and a compat error)
+	// if we just continued here.
+	if !overwrite && storedcfg != nil && genesis == nil && stored != params.MainnetGenesisHash {
+		if overrides == nil {
+			return storedcfg, stored, stateDB, nil
+		}
+		newcfg = storedcfg
+	}
+	if overrides != nil {
+		if newcfg, err = overrides.Apply(newcfg); err != nil {
+			return storedcfg, common.Hash{}, nil, err
+		}
+	}
+	if err := newcfg.CheckConfigForkOrder(); err != nil {
+		return newcfg, common.Hash{}, nil, err
+	}
 	if overwrite || storedcfg == nil {
 		log.Warn("Found genesis block without chain config")
 		err1 := rawdb.WriteChainConfig(db, stored, newcfg)
@@ -215,11 +232,14 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		}
 		return newcfg, stored, stateDB, nil
 	}
-	// Special case: don't change the existing config of a non-mainnet chain if no new
-	// config is supplied. These chains would get AllProtocolChanges (and a compat error)
-	// if we just continued here.
-	if genesis == nil && stored != params.MainnetGenesisHash {
-		return storedcfg, stored, stateDB, nil
+	if overrides != nil {
+		executed, err1 := stages.GetStageProgress(db, stages.Execution)
+		if err1 != nil {
+			return newcfg, common.Hash{}, nil, err1
+		}
+		if compatErr := storedcfg.CheckCompatible(newcfg, executed); compatErr != nil && executed != 0 {
+			return newcfg, stored, stateDB, fmt.Errorf("chain config overrides contradict the blocks executed up to %d: %w", executed, compatErr)
+		}
 	}
 	// Check config compatibility and write the config. Compatibility errors
 	// are returned to the caller unless we're already at block zero.
@@ -252,11 +272,41 @@ func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 		return params.GoerliChainConfig
 	case ghash == params.YoloV3GenesisHash:
 		return params.YoloV3ChainConfig
+	case ghash == params.BorMainnetGenesisHash:
+		return params.BorMainnetChainConfig
+	case ghash == params.MumbaiGenesisHash:
+		return params.MumbaiChainConfig
 	default:
 		return params.AllEthashProtocolChanges
 	}
 }
 
+// verkleRoot is the root of the verkle tree of the allocations, the tree keys are derived from the plain addresses,
+// so it is built from the allocations rather than from the hashed state
+func (g *Genesis) verkleRoot() common.Hash {
+	tree := verkle.NewTree()
+	for addr, account := range g.Alloc {
+		balance, _ := uint256.FromBig(account.Balance)
+		codeHash := crypto.Keccak256Hash(account.Code)
+		tree.UpdateAccount(addr, account.Nonce, balance, codeHash, len(account.Code))
+		tree.UpdateCode(addr, account.Code)
+		for key, value := range account.Storage {
+			tree.UpdateStorage(addr, key, common.TrimLeftZeroes(value[:]))
+		}
+	}
+	return tree.Root()
+}
+
+// binaryRoot is the root of the binary trie of the hashed state of the allocations
+func binaryRoot(db ethdb.Database) (common.Hash, error) {
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer tx.Rollback()
+	return trie.CalcBinaryRoot(tx.(ethdb.HasTx).Tx(), nil)
+}
+
 // ToBlock creates the genesis block and writes state of a genesis specification
 // to the given database (or discards it if nil).
 func (g *Genesis) ToBlock(db ethdb.Database, history bool) (*types.Block, *state.IntraBlockState, error) {
@@ -291,8 +341,14 @@ func (g *Genesis) ToBlock(db ethdb.Database, history bool) (*types.Block, *state
 	if err != nil {
 		return nil, nil, err
 	}
-	root, err := trie.CalcRoot("genesis", tmpDB)
-	if err != nil {
+	var root common.Hash
+	if g.Config != nil && g.Config.IsVerkle() {
+		root = g.verkleRoot()
+	} else if g.Config != nil && g.Config.IsBinaryTrie() {
+		if root, err = binaryRoot(tmpDB); err != nil {
+			return nil, nil, err
+		}
+	} else if root, err = trie.CalcRoot("genesis", tmpDB); err != nil {
 		return nil, nil, err
 	}
 	head := &types.Header{
@@ -314,6 +370,9 @@ func (g *Genesis) ToBlock(db ethdb.Database, history bool) (*types.Block, *state
 	if g.Difficulty == nil {
 		head.Difficulty = params.GenesisDifficulty
 	}
+	if g.Config != nil && g.Config.IsLondon(head.Number) {
+		head.BaseFee = g.Config.InitialBaseFee()
+	}
 
 	return types.NewBlock(head, nil, nil, nil), statedb, nil
 }
@@ -375,6 +434,9 @@ func (g *Genesis) Commit(db ethdb.Database, history bool) (*types.Block, *state.
 	if err := rawdb.WriteCanonicalHash(tx, block.Hash(), block.NumberU64()); err != nil {
 		return nil, nil, err
 	}
+	if err := rawdb.WriteTxCount(tx, block.NumberU64(), uint32(len(block.Transactions()))); err != nil {
+		return nil, nil, err
+	}
 	rawdb.WriteHeadBlockHash(tx, block.Hash())
 	rawdb.WriteHeadFastBlockHash(tx, block.Hash())
 	if err := rawdb.WriteHeadHeaderHash(tx, block.Hash()); err != nil {
@@ -483,6 +545,28 @@ func DefaultYoloV3GenesisBlock() *Genesis {
 	}
 }
 
+// DefaultBorMainnetGenesisBlock returns the main Polygon network genesis block.
+func DefaultBorMainnetGenesisBlock() *Genesis {
+	return &Genesis{
+		Config:     params.BorMainnetChainConfig,
+		Timestamp:  1590824836,
+		GasLimit:   10000000,
+		Difficulty: big.NewInt(1),
+		Alloc:      readPrealloc("allocs/bor_mainnet.json"),
+	}
+}
+
+// DefaultMumbaiGenesisBlock returns the Mumbai network genesis block.
+func DefaultMumbaiGenesisBlock() *Genesis {
+	return &Genesis{
+		Config:     params.MumbaiChainConfig,
+		Timestamp:  1558348305,
+		GasLimit:   10000000,
+		Difficulty: big.NewInt(1),
+		Alloc:      readPrealloc("allocs/mumbai.json"),
+	}
+}
+
 // DeveloperGenesisBlock returns the 'geth --dev' genesis block.
 func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 	// Override the default period to the user requested one
@@ -510,6 +594,24 @@ func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 	}
 }
 
+//go:embed allocs
+var allocs embed.FS
+
+// readPrealloc reads the genesis allocation with the code and the storage of the accounts, the "alloc" of the genesis
+// JSON, from the allocs directory
+func readPrealloc(filename string) GenesisAlloc {
+	f, err := allocs.Open(filename)
+	if err != nil {
+		panic(fmt.Sprintf("Could not open genesis preallocation for %s: %v", filename, err))
+	}
+	defer f.Close()
+	ga := make(GenesisAlloc)
+	if err := json.NewDecoder(f).Decode(&ga); err != nil {
+		panic(fmt.Sprintf("Could not parse genesis preallocation for %s: %v", filename, err))
+	}
+	return ga
+}
+
 func decodePrealloc(data string) GenesisAlloc {
 	var p []struct{ Addr, Balance *big.Int }
 	if err := rlp.NewStream(strings.NewReader(data), 0).Decode(&p); err != nil {
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var (
+	// ParallelMergedTxs counts the transactions executed in parallel and merged without the re-execution
+	ParallelMergedTxs = metrics.NewRegisteredCounter("chain/execution/parallel/merged", nil)
+	// ParallelReexecutedTxs counts the transactions executed again after the conflict with the earlier ones
+	ParallelReexecutedTxs = metrics.NewRegisteredCounter("chain/execution/parallel/reexecuted", nil)
+	// parallelMergedPercent is the percentage of the transactions of the last block merged without the re-execution
+	parallelMergedPercent = metrics.NewRegisteredGauge("chain/execution/parallel/merged_percent", nil)
+)
+
+// speculativeTx is the result of the transaction executed on its own state of the start of the block
+type speculativeTx struct {
+	ibs     *state.IntraBlockState
+	reads   *state.TxReadSet
+	receipt *types.Receipt
+	usedGas uint64
+	err     error
+}
+
+// ExecuteBlockInParallel executes the block like ExecuteBlockEphemerally, with its transactions executed in parallel
+// by the workers first, every one speculatively on its own state of the start of the block. The transactions are then
+// merged in their order into the state of the block, the ones which read the accounts changed by the earlier
+// transactions are executed again on the state of the block. The reads of the state by the workers are serialized,
+// the readers of the database are not safe for the concurrent use. The transactions merged and executed again are
+// counted by the ParallelMergedTxs and ParallelReexecutedTxs metrics, chain/execution/parallel/merged_percent is the
+// share of the merged ones in the last block.
+// The block is executed serially if it has less than 2 transactions, with the tracer or on the DAO fork.
+//
+// The read and write sets of the transactions are tracked by the IntraBlockState, not over the ethdb.OverlayKV: the
+// overlay and the transaction under it are for one goroutine, and the state of the start of the block is read by the
+// StateReader of the stage, which is not the KV of the overlay. The sets are of the accounts, not of the storage
+// slots, so every transaction which reads or writes the storage of the contract changed by an earlier transaction of
+// the block is executed again, e.g. all the transfers of the same token but the first one. The blocks of such
+// transactions are executed slower than serially, by the cost of the speculative execution
+func ExecuteBlockInParallel(
+	chainConfig *params.ChainConfig,
+	vmConfig *vm.Config,
+	chainContext ChainContext,
+	engine consensus.Engine,
+	block *types.Block,
+	stateReader state.StateReader,
+	stateWriter state.WriterWithChangeSets,
+	workers int,
+) (types.Receipts, *types.Receipt, error) {
+	txs := block.Transactions()
+	header := block.Header()
+	daoFork := chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0
+	if workers < 2 || len(txs) < 2 || vmConfig.Debug || daoFork {
+		return ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter)
+	}
+	defer blockExecutionTimer.UpdateSince(time.Now())
+	defer blockExecutionNumber.Update(block.Number().Int64())
+	block.Uncles()
+
+	var lock sync.Mutex
+	lockedContext := &lockedChainContext{lock: &lock, ChainContext: chainContext}
+	coinbase := NewEVMBlockContext(header, lockedContext, nil).Coinbase
+	speculative := make([]speculativeTx, len(txs))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(txs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			noop := state.NewNoopWriter()
+			for i := int(atomic.AddInt64(&next, 1)); i < len(txs); i = int(atomic.AddInt64(&next, 1)) {
+				s := &speculative[i]
+				s.reads = state.NewTxReadSet(&lockedReader{lock: &lock, r: stateReader})
+				s.ibs = state.New(s.reads)
+				s.ibs.SetTracer(s.reads)
+				s.ibs.Prepare(txs[i].Hash(), block.Hash(), i)
+				gp := new(GasPool).AddGas(block.GasLimit())
+				s.receipt, s.err = ApplyTransaction(chainConfig, lockedContext, &coinbase, gp, s.ibs, noop, header, txs[i], &s.usedGas, *vmConfig)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ibs := state.New(stateReader)
+	ctx := chainConfig.WithEIPsFlags(context.Background(), header.Number)
+	noop := state.NewNoopWriter()
+	var receipts types.Receipts
+	usedGas := new(uint64)
+	gp := new(GasPool).AddGas(block.GasLimit())
+	var merged int64
+	for i, tx := range txs {
+		if !vmConfig.NoReceipts {
+			ibs.Prepare(tx.Hash(), block.Hash(), i)
+		}
+		s := &speculative[i]
+		var receipt *types.Receipt
+		// The gas pool of the block has to have the room for the gas limit of the transaction, like for the serial execution
+		if s.err == nil && gp.Gas() >= tx.Gas() && ibs.MergeTx(s.ibs, s.reads, coinbase) {
+			if err := ibs.FinalizeTx(ctx, noop); err != nil {
+				return nil, nil, err
+			}
+			if err := gp.SubGas(s.usedGas); err != nil {
+				return nil, nil, err
+			}
+			*usedGas += s.usedGas
+			if receipt = s.receipt; receipt != nil {
+				receipt.CumulativeGasUsed = *usedGas
+			}
+			merged++
+		} else {
+			var err error
+			if receipt, err = ApplyTransaction(chainConfig, chainContext, nil, gp, ibs, noop, header, tx, usedGas, *vmConfig); err != nil {
+				return nil, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+			}
+			ParallelReexecutedTxs.Inc(1)
+		}
+		speculative[i] = speculativeTx{}
+		if !vmConfig.NoReceipts {
+			receipts = append(receipts, receipt)
+		}
+	}
+
+	ParallelMergedTxs.Inc(merged)
+	parallelMergedPercent.Update(merged * 100 / int64(len(txs)))
+
+	borReceipt, err := finishBlockExecution(chainConfig, vmConfig, chainContext, engine, block, ibs, stateWriter, receipts, *usedGas)
+	if err != nil {
+		return nil, nil, err
+	}
+	return receipts, borReceipt, nil
+}
+
+// lockedReader serializes the reads of the state shared by the workers
+type lockedReader struct {
+	lock *sync.Mutex
+	r    state.StateReader
+}
+
+func (r *lockedReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.r.ReadAccountData(address)
+}
+
+func (r *lockedReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.r.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *lockedReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.r.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (r *lockedReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.r.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (r *lockedReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.r.ReadAccountIncarnation(address)
+}
+
+// lockedChainContext serializes the reads of the headers by BLOCKHASH of the workers with the reads of the state
+type lockedChainContext struct {
+	lock *sync.Mutex
+	ChainContext
+}
+
+func (c *lockedChainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.ChainContext.GetHeader(hash, number)
+}
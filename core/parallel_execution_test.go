@@ -0,0 +1,131 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestExecuteBlockInParallel(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 6)
+	alloc := GenesisAlloc{}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	// The counter increments its slot 0 and logs, the logger only logs
+	counter, logger, coinbase := common.Address{0xc0}, common.Address{0x10}, common.Address{0xcb}
+	alloc[counter] = GenesisAccount{Balance: new(big.Int), Code: common.FromHex("0x60005460010160005560006000a0")}
+	alloc[logger] = GenesisAccount{Balance: new(big.Int), Code: common.FromHex("0x60006000a0")}
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	signer := types.LatestSigner(gspec.Config)
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	blocks, _, err := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *BlockGen) {
+		b.SetCoinbase(coinbase)
+		add := func(key *ecdsa.PrivateKey, to common.Address, value uint64) {
+			sender := crypto.PubkeyToAddress(key.PublicKey)
+			tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(value), 100000, uint256.NewInt().SetUint64(1), nil), signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.AddTx(tx)
+		}
+		// Independent transfers
+		add(keys[0], common.Address{1, byte(i)}, 1000)
+		add(keys[1], common.Address{2, byte(i)}, 1000)
+		// The second transaction of the sender and the second call of the counter conflict
+		add(keys[2], common.Address{3}, 1000)
+		add(keys[2], common.Address{3}, 1000)
+		add(keys[3], counter, 0)
+		add(keys[4], counter, 0)
+		// The independent logs follow the ones of the counter
+		add(keys[5], logger, 0)
+		if i == 1 {
+			// The transfer to the coinbase observes it
+			add(keys[0], coinbase, 1000)
+		}
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(parallel bool) (ethdb.Database, []types.Receipts) {
+		db := ethdb.NewMemDatabase()
+		gspec.MustCommit(db)
+		cc := &TinyChainContext{}
+		cc.SetDB(db)
+		cc.SetEngine(ethash.NewFaker())
+		var receipts []types.Receipts
+		for _, block := range blocks {
+			r := state.NewPlainStateReader(db)
+			w := state.NewPlainStateWriter(db, db, block.NumberU64())
+			var blockReceipts types.Receipts
+			var err error
+			if parallel {
+				blockReceipts, _, err = ExecuteBlockInParallel(gspec.Config, &vm.Config{}, cc, cc.Engine(), block, r, w, 4)
+			} else {
+				blockReceipts, _, err = ExecuteBlockEphemerally(gspec.Config, &vm.Config{}, cc, cc.Engine(), block, r, w)
+			}
+			if err != nil {
+				t.Fatalf("block %d, parallel %t: %v", block.NumberU64(), parallel, err)
+			}
+			receipts = append(receipts, blockReceipts)
+		}
+		return db, receipts
+	}
+	serialDB, serialReceipts := execute(false)
+	defer serialDB.Close()
+	parallelDB, parallelReceipts := execute(true)
+	defer parallelDB.Close()
+
+	for i := range blocks {
+		for j, receipt := range serialReceipts[i] {
+			other := parallelReceipts[i][j]
+			if other.Status != receipt.Status || other.CumulativeGasUsed != receipt.CumulativeGasUsed || other.GasUsed != receipt.GasUsed || len(other.Logs) != len(receipt.Logs) {
+				t.Fatalf("block %d, receipt %d: %+v instead of %+v", i+1, j, other, receipt)
+			}
+			for k, l := range receipt.Logs {
+				if other.Logs[k].Index != l.Index || other.Logs[k].TxIndex != l.TxIndex || other.Logs[k].Address != l.Address {
+					t.Errorf("block %d, receipt %d, log %d: %+v instead of %+v", i+1, j, k, other.Logs[k], l)
+				}
+			}
+		}
+	}
+	for _, bucket := range []string{dbutils.PlainStateBucket, dbutils.PlainContractCodeBucket, dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		serial, parallel := walkBucket(t, serialDB, bucket), walkBucket(t, parallelDB, bucket)
+		if len(serial) != len(parallel) {
+			t.Fatalf("%s: %d records instead of %d", bucket, len(parallel), len(serial))
+		}
+		for i := range serial {
+			if serial[i] != parallel[i] {
+				t.Errorf("%s: %s instead of %s", bucket, parallel[i], serial[i])
+			}
+		}
+	}
+}
+
+func walkBucket(t *testing.T, db ethdb.Database, bucket string) []string {
+	var records []string
+	if err := db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		records = append(records, fmt.Sprintf("%x:%x", k, v))
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
@@ -0,0 +1,36 @@
+package rawdb
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// Kinds of the data of the ancient blocks, moved out of the database into the immutable segment files
+const (
+	AncientHeaders  = "headers"
+	AncientBodies   = "bodies"   // RLP of types.Body, with the transactions
+	AncientReceipts = "receipts" // Receipts as stored in BlockReceiptsPrefix, the logs stay in the database
+)
+
+// readAncient returns the data of the block if it is canonical and frozen, the database passes it through to
+// its ancient store (see ethdb.AncientsKV). The canonical hashes stay in the database, so they tell if the hash
+// is the one of the frozen block
+func readAncient(db databaseReader, kind string, hash common.Hash, number uint64) []byte {
+	ancients, ok := db.(ethdb.AncientReader)
+	if !ok {
+		return nil
+	}
+	data, err := ancients.Ancient(kind, number)
+	if err != nil {
+		log.Error("Failed to read ancient block", "kind", kind, "number", number, "hash", hash, "err", err)
+		return nil
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if canonical, err := ReadCanonicalHash(db, number); err != nil || canonical != hash {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,94 @@
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// WriteBorReceipt stores the logs of the state sync events of the bor block, the receipt of its system transaction,
+// and the lookup of the transaction
+func WriteBorReceipt(db ethdb.Putter, number uint64, hash common.Hash, logs []*types.Log) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 1024))
+	if err := cbor.Marshal(buf, logs); err != nil {
+		return fmt.Errorf("encode bor receipt for block %d: %w", number, err)
+	}
+	if err := db.Put(dbutils.BorReceipts, dbutils.ReceiptsKey(number), buf.Bytes()); err != nil {
+		return fmt.Errorf("writing bor receipt for block %d: %w", number, err)
+	}
+	txHash := types.ComputeBorTxHash(number, hash)
+	if err := db.Put(dbutils.BorTxLookup, txHash[:], dbutils.EncodeBlockNumber(number)); err != nil {
+		return fmt.Errorf("writing bor tx lookup for block %d: %w", number, err)
+	}
+	return nil
+}
+
+// ReadBorReceipt retrieves the receipt of the system transaction of the bor block, following the receipts of its
+// transactions, nil if the block committed no state sync events
+func ReadBorReceipt(db ethdb.Getter, hash common.Hash, number uint64, receipts types.Receipts) *types.Receipt {
+	data, err := db.Get(dbutils.BorReceipts, dbutils.ReceiptsKey(number))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		log.Error("ReadBorReceipt failed", "err", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var logs []*types.Log
+	if err := cbor.Unmarshal(&logs, bytes.NewReader(data)); err != nil {
+		log.Error("bor receipt unmarshal failed", "hash", hash, "err", err)
+		return nil
+	}
+	return types.NewBorReceipt(number, hash, receipts, logs)
+}
+
+// ReadBorTxLookupEntry retrieves the number of the block of the bor system transaction
+func ReadBorTxLookupEntry(db ethdb.Getter, txHash common.Hash) (*uint64, error) {
+	data, err := db.Get(dbutils.BorTxLookup, txHash[:])
+	if err != nil {
+		if errors.Is(err, ethdb.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number, nil
+}
+
+// DeleteNewerBorReceipts removes the bor receipts of the given block and the newer ones with their lookups, the
+// canonical hashes of the blocks have to be still there
+func DeleteNewerBorReceipts(db ethdb.Database, number uint64) error {
+	if err := db.Walk(dbutils.BorReceipts, dbutils.ReceiptsKey(number), 0, func(k, v []byte) (bool, error) {
+		blockNum := binary.BigEndian.Uint64(k)
+		hash, err := ReadCanonicalHash(db, blockNum)
+		if err != nil {
+			return false, err
+		}
+		txHash := types.ComputeBorTxHash(blockNum, hash)
+		if err = db.Delete(dbutils.BorTxLookup, txHash[:], nil); err != nil {
+			return false, err
+		}
+		return true, db.Delete(dbutils.BorReceipts, k, nil)
+	}); err != nil {
+		return fmt.Errorf("delete newer bor receipts failed: %d, %w", number, err)
+	}
+	return nil
+}
+
+// DeleteNewerBorSnapshots removes the bor validator set snapshots of the given block and the newer ones, of all the
+// forks
+func DeleteNewerBorSnapshots(db ethdb.Database, number uint64) error {
+	if err := db.Walk(dbutils.BorSnapshot, dbutils.EncodeBlockNumber(number), 0, func(k, v []byte) (bool, error) {
+		return true, db.Delete(dbutils.BorSnapshot, k, nil)
+	}); err != nil {
+		return fmt.Errorf("delete newer bor snapshots failed: %d, %w", number, err)
+	}
+	return nil
+}
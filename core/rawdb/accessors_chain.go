@@ -198,13 +198,16 @@ func ReadHeaderRLP(db databaseReader, hash common.Hash, number uint64) rlp.RawVa
 	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
 		log.Error("ReadHeaderRLP failed", "err", err)
 	}
+	if len(data) == 0 {
+		data = readAncient(db, AncientHeaders, hash, number)
+	}
 	return data
 }
 
 // HasHeader verifies the existence of a block header corresponding to the hash.
 func HasHeader(db databaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.HeadersBucket, dbutils.HeaderKey(number, hash)); !has || err != nil {
-		return false
+		return len(readAncient(db, AncientHeaders, hash, number)) > 0
 	}
 	return true
 }
@@ -357,7 +360,7 @@ func WriteBodyRLP(db DatabaseWriter, hash common.Hash, number uint64, rlp rlp.Ra
 // HasBody verifies the existence of a block body corresponding to the hash.
 func HasBody(db databaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, hash)); !has || err != nil {
-		return false
+		return len(readAncient(db, AncientBodies, hash, number)) > 0
 	}
 	return true
 }
@@ -366,7 +369,7 @@ func HasBody(db databaseReader, hash common.Hash, number uint64) bool {
 func ReadBody(db ethdb.Getter, hash common.Hash, number uint64) *types.Body {
 	body, baseTxId, txAmount := ReadBodyWithoutTransactions(db, hash, number)
 	if body == nil {
-		return nil
+		return readAncientBody(db, hash, number)
 	}
 	var err error
 	body.Transactions, err = ReadTransactions(db, baseTxId, txAmount)
@@ -393,6 +396,20 @@ func ReadBodyWithoutTransactions(db ethdb.Getter, hash common.Hash, number uint6
 	return body, bodyForStorage.BaseTxId, bodyForStorage.TxAmount
 }
 
+// readAncientBody reads the body of the frozen block, the transactions of which are stored with it
+func readAncientBody(db databaseReader, hash common.Hash, number uint64) *types.Body {
+	data := readAncient(db, AncientBodies, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(data, body); err != nil {
+		log.Error("Invalid ancient block body RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return body
+}
+
 func ReadSenders(db databaseReader, hash common.Hash, number uint64) ([]common.Address, error) {
 	data, err := db.Get(dbutils.Senders, dbutils.BlockBodyKey(number, hash))
 	if err != nil {
@@ -453,6 +470,104 @@ func DeleteBody(db DatabaseDeleter, hash common.Hash, number uint64) {
 	}
 }
 
+// ReadTxCount retrieves the number of the transactions of the canonical block from the index, false if the block
+// is not indexed
+func ReadTxCount(db databaseReader, number uint64) (uint32, bool, error) {
+	data, err := db.Get(dbutils.BlockTxCount, dbutils.EncodeBlockNumber(number))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return 0, false, fmt.Errorf("failed ReadTxCount: %w, number=%d", err, number)
+	}
+	if len(data) != 4 {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint32(data), true, nil
+}
+
+// ReadTxCounts retrieves the numbers of the transactions of the canonical blocks from..to, up to the first block
+// which is not indexed
+func ReadTxCounts(db ethdb.Getter, from, to uint64) ([]uint32, error) {
+	var counts []uint32
+	next := from
+	if err := db.Walk(dbutils.BlockTxCount, dbutils.EncodeBlockNumber(from), 0, func(k, v []byte) (bool, error) {
+		if binary.BigEndian.Uint64(k) != next || next > to {
+			return false, nil
+		}
+		counts = append(counts, binary.BigEndian.Uint32(v))
+		next++
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed ReadTxCounts: %w, from=%d, to=%d", err, from, to)
+	}
+	return counts, nil
+}
+
+// WriteTxCount stores the number of the transactions of the canonical block in the index
+func WriteTxCount(db DatabaseWriter, number uint64, count uint32) error {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, count)
+	if err := db.Put(dbutils.BlockTxCount, dbutils.EncodeBlockNumber(number), v); err != nil {
+		return fmt.Errorf("failed to store tx count: %w, number=%d", err, number)
+	}
+	return nil
+}
+
+// DeleteNewerTxCounts removes the numbers of the transactions of the given block and the newer ones from the index
+func DeleteNewerTxCounts(db ethdb.Database, number uint64) error {
+	if err := db.Walk(dbutils.BlockTxCount, dbutils.EncodeBlockNumber(number), 0, func(k, v []byte) (bool, error) {
+		if err := db.Delete(dbutils.BlockTxCount, k, nil); err != nil {
+			return false, err
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("delete newer tx counts failed: %d, %w", number, err)
+	}
+	return nil
+}
+
+// ReadBlockWitness retrieves the serialized stateless witness of the canonical block, nil if it is not stored
+func ReadBlockWitness(db databaseReader, number uint64) ([]byte, error) {
+	data, err := db.Get(dbutils.BlockWitness, dbutils.EncodeBlockNumber(number))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, fmt.Errorf("failed ReadBlockWitness: %w, number=%d", err, number)
+	}
+	return data, nil
+}
+
+// WriteBlockWitness stores the serialized stateless witness of the canonical block
+func WriteBlockWitness(db DatabaseWriter, number uint64, witness []byte) error {
+	if err := db.Put(dbutils.BlockWitness, dbutils.EncodeBlockNumber(number), witness); err != nil {
+		return fmt.Errorf("failed to store block witness: %w, number=%d", err, number)
+	}
+	return nil
+}
+
+// DeleteNewerBlockWitnesses removes the stateless witnesses of the given block and the newer ones
+func DeleteNewerBlockWitnesses(db ethdb.Database, number uint64) error {
+	if err := db.Walk(dbutils.BlockWitness, dbutils.EncodeBlockNumber(number), 0, func(k, v []byte) (bool, error) {
+		if err := db.Delete(dbutils.BlockWitness, k, nil); err != nil {
+			return false, err
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("delete newer block witnesses failed: %d, %w", number, err)
+	}
+	return nil
+}
+
+// DeleteNewerCliqueSnapshots removes the clique voting snapshots of the given block and the newer ones, of all the
+// forks. The snapshots of the blocks which become canonical again are recomputed from the older checkpoints
+func DeleteNewerCliqueSnapshots(db ethdb.Database, number uint64) error {
+	if err := db.Walk(dbutils.CliqueSnapshot, dbutils.EncodeBlockNumber(number), 0, func(k, v []byte) (bool, error) {
+		if err := db.Delete(dbutils.CliqueSnapshot, k, nil); err != nil {
+			return false, err
+		}
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("delete newer clique snapshots failed: %d, %w", number, err)
+	}
+	return nil
+}
+
 // ReadTdRLP retrieves a block's total difficulty corresponding to the hash in RLP encoding.
 func ReadTdRLP(db databaseReader, hash common.Hash, number uint64) rlp.RawValue {
 	//data, _ := db.Ancient(freezerDifficultyTable, number)
@@ -510,7 +625,7 @@ func DeleteTd(db DatabaseDeleter, hash common.Hash, number uint64) error {
 // to a block.
 func HasReceipts(db databaseReader, hash common.Hash, number uint64) bool {
 	if has, err := db.Has(dbutils.BlockReceiptsPrefix, dbutils.ReceiptsKey(number)); !has || err != nil {
-		return false
+		return len(readAncient(db, AncientReceipts, hash, number)) > 0
 	}
 	return true
 }
@@ -524,6 +639,9 @@ func ReadRawReceipts(db ethdb.Getter, hash common.Hash, number uint64) types.Rec
 	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
 		log.Error("ReadRawReceipts failed", "err", err)
 	}
+	if len(data) == 0 {
+		data = readAncient(db, AncientReceipts, hash, number)
+	}
 	if len(data) == 0 {
 		return nil
 	}
@@ -514,3 +514,45 @@ func checkReceiptsRLP(have, want types.Receipts) error {
 	}
 	return nil
 }
+
+func TestBorReceiptStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	hash := common.BytesToHash([]byte{0x03, 0x14})
+	if err := WriteCanonicalHash(db, hash, 64); err != nil {
+		t.Fatal(err)
+	}
+	receipts := types.Receipts{
+		{CumulativeGasUsed: 21000, Logs: []*types.Log{{Address: common.HexToAddress("0x1")}}},
+		{CumulativeGasUsed: 42000, Logs: []*types.Log{{Address: common.HexToAddress("0x2")}, {Address: common.HexToAddress("0x3")}}},
+	}
+	logs := []*types.Log{{Address: common.HexToAddress("0x1001"), Topics: []common.Hash{{1}}, Data: []byte{1, 2}}}
+	if err := WriteBorReceipt(db, 64, hash, logs); err != nil {
+		t.Fatal(err)
+	}
+
+	txHash := types.ComputeBorTxHash(64, hash)
+	number, err := ReadBorTxLookupEntry(db, txHash)
+	require.NoError(t, err)
+	require.NotNil(t, number)
+	require.Equal(t, uint64(64), *number)
+
+	receipt := ReadBorReceipt(db, hash, 64, receipts)
+	require.NotNil(t, receipt)
+	require.Equal(t, txHash, receipt.TxHash)
+	require.Equal(t, uint(2), receipt.TransactionIndex)
+	require.Equal(t, uint64(42000), receipt.CumulativeGasUsed)
+	require.Len(t, receipt.Logs, 1)
+	require.Equal(t, uint(3), receipt.Logs[0].Index)
+	require.Equal(t, txHash, receipt.Logs[0].TxHash)
+	require.True(t, receipt.Bloom.Test(common.HexToAddress("0x1001").Bytes()))
+
+	if err = DeleteNewerBorReceipts(db, 64); err != nil {
+		t.Fatal(err)
+	}
+	require.Nil(t, ReadBorReceipt(db, hash, 64, receipts))
+	number, err = ReadBorTxLookupEntry(db, txHash)
+	require.NoError(t, err)
+	require.Nil(t, number)
+}
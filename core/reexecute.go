@@ -0,0 +1,316 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+)
+
+// ReExecutionResult is the outcome of the re-execution of a stored block by ReExecuteBlock
+type ReExecutionResult struct {
+	// StateRoot is the root of the state after the block. It's zero if it isn't computed: the state trie is only
+	// of the head state, so the root is computed for the head block whose re-executed state matches the stored one
+	StateRoot    common.Hash
+	ReceiptsRoot common.Hash
+	GasUsed      uint64
+	Bloom        types.Bloom
+	Receipts     types.Receipts
+	// Diffs are the values computed by the re-execution which differ from the stored ones
+	Diffs []*ReExecutionDiff
+}
+
+// Kinds of the values compared by ReExecuteBlock
+const (
+	DiffStateRoot    = "stateRoot"
+	DiffReceiptsRoot = "receiptsRoot"
+	DiffGasUsed      = "gasUsed"
+	DiffBloom        = "logsBloom"
+	DiffReceipt      = "receipt"
+	DiffAccount      = "account"
+	DiffStorage      = "storage"
+)
+
+// ReExecutionDiff is a value computed by the re-execution of a block which differs from the stored one
+type ReExecutionDiff struct {
+	What string
+	// Key is the index of the receipt (4 bytes, big endian) or the plain state key of the account or the storage,
+	// nil for the fields of the header
+	Key []byte
+	// Computed and Stored are the RLP of the receipts, the storage encoding of the accounts, the values of the
+	// storage, the big endian gas used and the hashes. Nil if the account or the storage doesn't exist
+	Computed []byte
+	Stored   []byte
+}
+
+func (d *ReExecutionDiff) String() string {
+	return fmt.Sprintf("%s %x: computed %x, stored %x", d.What, d.Key, d.Computed, d.Stored)
+}
+
+// ReExecuteBlock re-executes the canonical block blockNum against the historical state as of its parent, without
+// writing to the database, and compares the outcome with the stored header, receipts and state after the block.
+// The chain config is read from the database, the engine finalizes the block, e.g. applies the block rewards.
+// The stored state after the block is read from the history, the block must be executed and indexed.
+func ReExecuteBlock(tx ethdb.Database, engine consensus.Engine, blockNum uint64) (*ReExecutionResult, error) {
+	if blockNum == 0 {
+		return nil, fmt.Errorf("the genesis block isn't executed")
+	}
+	for _, stage := range []stages.SyncStage{stages.Execution, stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		progress, err := stages.GetStageProgress(tx, stage)
+		if err != nil {
+			return nil, err
+		}
+		if blockNum > progress {
+			return nil, fmt.Errorf("can't re-execute block %d above the progress of %s: %d", blockNum, stage, progress)
+		}
+	}
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := rawdb.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if chainConfig == nil {
+		return nil, fmt.Errorf("chain config not found")
+	}
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlock(tx, blockHash, blockNum)
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", blockNum)
+	}
+	header := block.Header()
+	cc := &TinyChainContext{}
+	cc.SetDB(tx)
+	cc.SetEngine(engine)
+
+	// The same as ExecuteBlockEphemerally, the mismatches are the differences rather than the errors
+	ibs := state.New(state.NewPlainDBState(tx, blockNum-1))
+	writes := newStateWritesRecorder()
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	result := &ReExecutionResult{}
+	gp := new(GasPool).AddGas(block.GasLimit())
+	noop := state.NewNoopWriter()
+	for i, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), blockHash, i)
+		receipt, err := ApplyTransaction(chainConfig, cc, nil, gp, ibs, noop, header, txn, &result.GasUsed, vm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("re-executing tx %x of block %d: %w", txn.Hash(), blockNum, err)
+		}
+		result.Receipts = append(result.Receipts, receipt)
+	}
+	if err = FinalizeBlockExecution(engine, cc.GetHeader, header, block.Transactions(), block.Uncles(), writes, chainConfig, ibs); err != nil {
+		return nil, err
+	}
+	result.ReceiptsRoot = types.DeriveSha(result.Receipts)
+	result.Bloom = types.CreateBloom(result.Receipts)
+
+	if result.GasUsed != header.GasUsed {
+		result.Diffs = append(result.Diffs, &ReExecutionDiff{What: DiffGasUsed, Computed: dbutils.EncodeBlockNumber(result.GasUsed), Stored: dbutils.EncodeBlockNumber(header.GasUsed)})
+	}
+	// The receipts of the blocks before Byzantium commit to the intermediate state roots, which aren't computed
+	if chainConfig.IsByzantium(header.Number) && result.ReceiptsRoot != header.ReceiptHash {
+		result.Diffs = append(result.Diffs, &ReExecutionDiff{What: DiffReceiptsRoot, Computed: result.ReceiptsRoot.Bytes(), Stored: header.ReceiptHash.Bytes()})
+	}
+	if result.Bloom != header.Bloom {
+		result.Diffs = append(result.Diffs, &ReExecutionDiff{What: DiffBloom, Computed: result.Bloom.Bytes(), Stored: header.Bloom.Bytes()})
+	}
+	receiptDiffs, err := diffReceipts(tx, block, result.Receipts, chainConfig.IsByzantium(header.Number))
+	if err != nil {
+		return nil, err
+	}
+	result.Diffs = append(result.Diffs, receiptDiffs...)
+	stateDiffs, err := writes.diff(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	result.Diffs = append(result.Diffs, stateDiffs...)
+
+	trieProgress, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if len(stateDiffs) == 0 && trieProgress == blockNum {
+		if result.StateRoot, err = trie.CalcRoot("", tx); err != nil {
+			return nil, err
+		}
+		if result.StateRoot != header.Root {
+			result.Diffs = append(result.Diffs, &ReExecutionDiff{What: DiffStateRoot, Computed: result.StateRoot.Bytes(), Stored: header.Root.Bytes()})
+		}
+	}
+	return result, nil
+}
+
+// diffReceipts compares the consensus encoding of the receipts with the stored ones, if the receipts are stored
+func diffReceipts(tx ethdb.Database, block *types.Block, receipts types.Receipts, byzantium bool) ([]*ReExecutionDiff, error) {
+	stored := rawdb.ReadRawReceipts(tx, block.Hash(), block.NumberU64())
+	if stored == nil {
+		return nil, nil
+	}
+	var diffs []*ReExecutionDiff
+	for i, receipt := range receipts {
+		var storedEnc []byte
+		if i < len(stored) {
+			// The type and the bloom aren't stored, they are derived from the transaction and the logs
+			storedReceipt := stored[i]
+			storedReceipt.Type = receipt.Type
+			storedReceipt.Bloom = types.CreateBloom(types.Receipts{storedReceipt})
+			if !byzantium {
+				storedReceipt.PostState = receipt.PostState
+			}
+			var err error
+			if storedEnc, err = rlp.EncodeToBytes(storedReceipt); err != nil {
+				return nil, err
+			}
+		}
+		enc, err := rlp.EncodeToBytes(receipt)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(enc, storedEnc) {
+			diffs = append(diffs, &ReExecutionDiff{What: DiffReceipt, Key: receiptKey(i), Computed: enc, Stored: storedEnc})
+		}
+	}
+	for i := len(receipts); i < len(stored); i++ {
+		enc, err := rlp.EncodeToBytes(stored[i])
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, &ReExecutionDiff{What: DiffReceipt, Key: receiptKey(i), Stored: enc})
+	}
+	return diffs, nil
+}
+
+func receiptKey(i int) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(i))
+	return key[:]
+}
+
+// stateWritesRecorder is the state writer recording the values written by the execution of a block, by their plain
+// state keys. The deleted accounts and the zeroed storage are nil
+type stateWritesRecorder struct {
+	values map[string][]byte
+}
+
+func newStateWritesRecorder() *stateWritesRecorder {
+	return &stateWritesRecorder{values: make(map[string][]byte)}
+}
+
+func (w *stateWritesRecorder) UpdateAccountData(_ context.Context, address common.Address, _, account *accounts.Account) error {
+	value := make([]byte, account.EncodingLengthForStorage())
+	account.EncodeForStorage(value)
+	w.values[string(address[:])] = value
+	return nil
+}
+
+func (w *stateWritesRecorder) UpdateAccountCode(common.Address, uint64, common.Hash, []byte) error {
+	return nil
+}
+
+func (w *stateWritesRecorder) DeleteAccount(_ context.Context, address common.Address, _ *accounts.Account) error {
+	w.values[string(address[:])] = nil
+	return nil
+}
+
+func (w *stateWritesRecorder) WriteAccountStorage(_ context.Context, address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	if *original == *value {
+		return nil
+	}
+	w.values[string(dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, key.Bytes()))] = value.Bytes()
+	return nil
+}
+
+func (w *stateWritesRecorder) CreateContract(common.Address) error { return nil }
+func (w *stateWritesRecorder) WriteChangeSets() error              { return nil }
+func (w *stateWritesRecorder) WriteHistory() error                 { return nil }
+
+// diff compares the recorded values with the stored state after the block. The keys in the stored changesets of the
+// block which aren't written by the re-execution are expected to keep the values they had before the block
+func (w *stateWritesRecorder) diff(tx ethdb.Database, blockNum uint64) ([]*ReExecutionDiff, error) {
+	computed := make(map[string][]byte, len(w.values))
+	for k, v := range w.values {
+		computed[k] = v
+	}
+	before := state.NewPlainDBState(tx, blockNum-1)
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		if err := changeset.Walk(tx, bucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, _ []byte) (bool, error) {
+			if _, ok := computed[string(k)]; ok {
+				return true, nil
+			}
+			v, err := readPlainStateValue(before, k)
+			if err != nil {
+				return false, err
+			}
+			computed[string(k)] = v
+			return true, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(computed))
+	for k := range computed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	after := state.NewPlainDBState(tx, blockNum)
+	var diffs []*ReExecutionDiff
+	for _, k := range keys {
+		stored, err := readPlainStateValue(after, []byte(k))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(computed[k], stored) {
+			what := DiffAccount
+			if len(k) != common.AddressLength {
+				what = DiffStorage
+			}
+			diffs = append(diffs, &ReExecutionDiff{What: what, Key: []byte(k), Computed: computed[k], Stored: stored})
+		}
+	}
+	return diffs, nil
+}
+
+// readPlainStateValue reads the storage encoding of the account or the value of the storage by its plain state key
+func readPlainStateValue(r *state.PlainDBState, key []byte) ([]byte, error) {
+	if len(key) == common.AddressLength {
+		account, err := r.ReadAccountData(common.BytesToAddress(key))
+		if err != nil || account == nil {
+			return nil, err
+		}
+		value := make([]byte, account.EncodingLengthForStorage())
+		account.EncodeForStorage(value)
+		return value, nil
+	}
+	address := common.BytesToAddress(key[:common.AddressLength])
+	incarnation := binary.BigEndian.Uint64(key[common.AddressLength:])
+	location := common.BytesToHash(key[common.AddressLength+common.IncarnationLength:])
+	value, err := r.ReadAccountStorage(address, incarnation, &location)
+	if err != nil || len(value) == 0 {
+		return nil, err
+	}
+	return value, nil
+}
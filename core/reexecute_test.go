@@ -0,0 +1,95 @@
+package core_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestReExecuteBlock(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 5, func(i int, b *core.BlockGen) {
+		var tx *types.Transaction
+		if i%2 == 0 {
+			tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+		} else {
+			// The contract storing 1 in its slot 0, for the changes of the storage
+			tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), common.FromHex("0x600160005500"))
+		}
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, block := range blocks {
+		result, err := core.ReExecuteBlock(db, ethash.NewFaker(), block.NumberU64())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Diffs) != 0 {
+			t.Fatalf("block %d: expected no differences, got %v", block.NumberU64(), result.Diffs)
+		}
+		if result.GasUsed != block.GasUsed() || result.ReceiptsRoot != block.ReceiptHash() || len(result.Receipts) != 1 {
+			t.Errorf("block %d: unexpected result %+v", block.NumberU64(), result)
+		}
+		// The root is only computed for the head
+		if head := block.NumberU64() == uint64(len(blocks)); head && result.StateRoot != block.Root() || !head && result.StateRoot != (common.Hash{}) {
+			t.Errorf("block %d: unexpected state root %x", block.NumberU64(), result.StateRoot)
+		}
+	}
+	if _, err = core.ReExecuteBlock(db, ethash.NewFaker(), uint64(len(blocks))+1); err == nil {
+		t.Fatal("expected the re-execution above the executed block to fail")
+	}
+
+	// The balance of the recipient corrupted after the head block, which transfers to it
+	enc, err := db.Get(dbutils.PlainStateBucket, to.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := common.CopyBytes(enc)
+	corrupted[len(corrupted)-1]++
+	if err = db.Put(dbutils.PlainStateBucket, to.Bytes(), corrupted); err != nil {
+		t.Fatal(err)
+	}
+	result, err := core.ReExecuteBlock(db, ethash.NewFaker(), uint64(len(blocks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diffs) != 1 {
+		t.Fatalf("expected 1 difference, got %v", result.Diffs)
+	}
+	if diff := result.Diffs[0]; diff.What != core.DiffAccount || common.BytesToAddress(diff.Key) != to || string(diff.Stored) != string(corrupted) {
+		t.Errorf("unexpected difference %v", diff)
+	}
+	if result.StateRoot != (common.Hash{}) {
+		t.Errorf("unexpected state root %x of the corrupted state", result.StateRoot)
+	}
+}
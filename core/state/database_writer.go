@@ -42,3 +42,21 @@ func (pw *PreimageWriter) savePreimage(save bool, hash []byte, preimage []byte)
 	}
 	return pw.db.Put(dbutils.PreimagePrefix, hash, preimage)
 }
+
+// WritePreimages saves the preimages of the hashes of the addresses and the storage keys changed in the changesets
+// of the writer, by which the hashed state is keyed
+func WritePreimages(db ethdb.GetterPutter, csw *ChangeSetWriter) error {
+	pw := &PreimageWriter{db: db, savePreimages: true}
+	for address := range csw.accountChanges {
+		if _, err := pw.HashAddress(address, true); err != nil {
+			return err
+		}
+	}
+	for compositeKey := range csw.storageChanges {
+		key := common.BytesToHash([]byte(compositeKey)[common.AddressLength+common.IncarnationLength:])
+		if _, err := pw.HashKey(&key, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
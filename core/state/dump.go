@@ -134,7 +134,9 @@ func NewDumper(db ethdb.Tx, blockNumber uint64) *Dumper {
 	}
 }
 
-func (d *Dumper) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, _ bool, startAddress common.Address, maxResults int) (nextKey []byte, err error) {
+// DumpToCollector passes the accounts from startAddress up to, not including, endAddress (no bound if nil) to the
+// collector, at most maxResults of them (no limit if zero). Returns the address to continue from if the limit is hit
+func (d *Dumper) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, _ bool, startAddress common.Address, endAddress *common.Address, maxResults int) (nextKey []byte, err error) {
 	var emptyCodeHash = crypto.Keccak256Hash(nil)
 	var emptyHash = common.Hash{}
 	var accountList []*DumpAccount
@@ -144,17 +146,8 @@ func (d *Dumper) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, _
 	c.OnRoot(emptyHash) // We do not calculate the root
 
 	var acc accounts.Account
-	numberOfResults := 0
-
-	if err = WalkAsOfAccounts(d.db, startAddress, d.blockNumber+1, func(k, v []byte) (bool, error) {
-		if maxResults > 0 && numberOfResults >= maxResults {
-			if nextKey == nil {
-				nextKey = make([]byte, len(k))
-			}
-			copy(nextKey, k)
-			return false, nil
-		}
 
+	if nextKey, err = WalkAsOfAccountsRange(d.db, startAddress, endAddress, maxResults, d.blockNumber+1, func(k, v []byte) (bool, error) {
 		if len(k) > 32 {
 			return true, nil
 		}
@@ -173,8 +166,6 @@ func (d *Dumper) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, _
 		accountList = append(accountList, &account)
 		addrList = append(addrList, common.BytesToAddress(k))
 		incarnationList = append(incarnationList, acc.Incarnation)
-
-		numberOfResults++
 		return true, nil
 	}); err != nil {
 		return nil, err
@@ -235,7 +226,7 @@ func (d *Dumper) RawDump(excludeCode, excludeStorage, excludeMissingPreimages bo
 		Accounts: make(map[common.Address]DumpAccount),
 	}
 	//nolint:errcheck
-	d.DumpToCollector(dump, excludeCode, excludeStorage, excludeMissingPreimages, common.Address{}, 0)
+	d.DumpToCollector(dump, excludeCode, excludeStorage, excludeMissingPreimages, common.Address{}, nil, 0)
 	return *dump
 }
 
@@ -252,7 +243,7 @@ func (d *Dumper) Dump(excludeCode, excludeStorage, excludeMissingPreimages bool)
 // IterativeDump dumps out accounts as json-objects, delimited by linebreaks on stdout
 func (d *Dumper) IterativeDump(excludeCode, excludeStorage, excludeMissingPreimages bool, output *json.Encoder) {
 	//nolint:errcheck
-	d.DumpToCollector(iterativeDump{output}, excludeCode, excludeStorage, excludeMissingPreimages, common.Address{}, 0)
+	d.DumpToCollector(iterativeDump{output}, excludeCode, excludeStorage, excludeMissingPreimages, common.Address{}, nil, 0)
 }
 
 // IteratorDump dumps out a batch of accounts starts with the given start key
@@ -261,7 +252,7 @@ func (d *Dumper) IteratorDump(excludeCode, excludeStorage, excludeMissingPreimag
 		Accounts: make(map[common.Address]DumpAccount),
 	}
 	var err error
-	iterator.Next, err = d.DumpToCollector(iterator, excludeCode, excludeStorage, excludeMissingPreimages, start, maxResults)
+	iterator.Next, err = d.DumpToCollector(iterator, excludeCode, excludeStorage, excludeMissingPreimages, start, nil, maxResults)
 	return *iterator, err
 }
 
@@ -18,6 +18,45 @@ import (
 //MaxChangesetsSearch -
 const MaxChangesetsSearch = 256
 
+// changesetsTx returns the transaction the changesets of the block are read from: tx, or the one of the archive if
+// they are pruned, which has to be rolled back then. Only the ethdb.ChangesetsReader transactions know the pruned
+// changesets
+func changesetsTx(tx ethdb.Tx, bucket string, blockNum uint64) (ethdb.Tx, bool, error) {
+	reader, ok := tx.(ethdb.ChangesetsReader)
+	if !ok {
+		return tx, false, nil
+	}
+	prunedTo, err := reader.ChangesetsPrunedTo(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	if blockNum >= prunedTo {
+		return tx, false, nil
+	}
+	archived, err := reader.ArchivedChangesets(bucket, blockNum)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s of block %d, the ones from block %d are kept: %w", bucket, blockNum, prunedTo, err)
+	}
+	return archived, true, nil
+}
+
+// checkChangesetsKept fails the walks of the history as of the block whose changesets are pruned, the walks read
+// them from the database only
+func checkChangesetsKept(tx ethdb.Tx, bucket string, timestamp uint64) error {
+	reader, ok := tx.(ethdb.ChangesetsReader)
+	if !ok {
+		return nil
+	}
+	prunedTo, err := reader.ChangesetsPrunedTo(bucket)
+	if err != nil {
+		return err
+	}
+	if timestamp < prunedTo {
+		return fmt.Errorf("%w: %s of block %d, the ones from block %d are kept", ethdb.ErrChangesetsPruned, bucket, timestamp, prunedTo)
+	}
+	return nil
+}
+
 func GetAsOf(tx ethdb.Tx, storage bool, key []byte, timestamp uint64) ([]byte, error) {
 	var dat []byte
 	v, err := FindByHistory(tx, storage, key, timestamp)
@@ -79,9 +118,15 @@ func FindByHistory(tx ethdb.Tx, storage bool, key []byte, timestamp uint64) ([]b
 	var data []byte
 	if ok {
 		csBucket := dbutils.ChangeSetByIndexBucket(storage)
-		c := tx.CursorDupSort(csBucket)
+		csTx, archived, err := changesetsTx(tx, csBucket, changeSetBlock)
+		if err != nil {
+			return nil, err
+		}
+		if archived {
+			defer csTx.Rollback()
+		}
+		c := csTx.CursorDupSort(csBucket)
 		defer c.Close()
-		var err error
 		if storage {
 			data, err = changeset.Mapper[csBucket].WalkerAdapter(c).(changeset.StorageChangeSetPlain).FindWithIncarnation(changeSetBlock, key)
 		} else {
@@ -129,6 +174,10 @@ func WalkAsOfStorage(tx ethdb.Tx, address common.Address, incarnation uint64, st
 	binary.BigEndian.PutUint64(startkey[common.AddressLength:], incarnation)
 	copy(startkey[common.AddressLength+common.IncarnationLength:], startLocation.Bytes())
 
+	if err := checkChangesetsKept(tx, dbutils.PlainStorageChangeSetBucket, timestamp); err != nil {
+		return err
+	}
+
 	var startkeyNoInc = make([]byte, common.AddressLength+common.HashLength)
 	copy(startkeyNoInc, address.Bytes())
 	copy(startkeyNoInc[common.AddressLength:], startLocation.Bytes())
@@ -242,7 +291,20 @@ func WalkAsOfStorage(tx ethdb.Tx, address common.Address, incarnation uint64, st
 	return nil
 }
 
+// WalkAsOfAccounts walks the accounts as of the timestamp from startAddress. The values are in the storage encoding,
+// the walkers reading a few fields of every account read them with accounts.StorageView instead of decoding it
 func WalkAsOfAccounts(tx ethdb.Tx, startAddress common.Address, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
+	_, err := WalkAsOfAccountsRange(tx, startAddress, nil, 0, timestamp, walker)
+	return err
+}
+
+// WalkAsOfAccountsRange walks the accounts as of the timestamp from startAddress up to, not including, endAddress
+// (no bound if nil), and stops after limit accounts are passed to the walker (no limit if zero). Returns the address
+// of the next account in the range if the walk is stopped by the limit, to continue from, nil otherwise
+func WalkAsOfAccountsRange(tx ethdb.Tx, startAddress common.Address, endAddress *common.Address, limit int, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) ([]byte, error) {
+	if err := checkChangesetsKept(tx, dbutils.PlainAccountChangeSetBucket, timestamp); err != nil {
+		return nil, err
+	}
 	mainCursor := tx.Cursor(dbutils.PlainStateBucket)
 	defer mainCursor.Close()
 	ahCursor := tx.Cursor(dbutils.AccountsHistoryBucket)
@@ -260,25 +322,36 @@ func WalkAsOfAccounts(tx ethdb.Tx, startAddress common.Address, timestamp uint64
 
 	k, v, err1 := mainCursor.Seek(startAddress.Bytes())
 	if err1 != nil {
-		return err1
+		return nil, err1
 	}
 	for k != nil && len(k) > common.AddressLength {
 		k, v, err1 = mainCursor.Next()
 		if err1 != nil {
-			return err1
+			return nil, err1
 		}
 	}
 	hK, tsEnc, _, hV, err2 := hCursor.Seek()
 	if err2 != nil {
-		return err2
+		return nil, err2
 	}
 	for hK != nil && binary.BigEndian.Uint64(tsEnc) < timestamp {
 		hK, tsEnc, _, hV, err2 = hCursor.Next()
 		if err2 != nil {
-			return err2
+			return nil, err2
 		}
 	}
 
+	var next []byte
+	var walked int
+	emit := func(k, v []byte) (bool, error) {
+		if limit > 0 && walked >= limit {
+			next = common.CopyBytes(k)
+			return false, nil
+		}
+		walked++
+		return walker(k, v)
+	}
+
 	goOn := true
 	var err error
 	for goOn {
@@ -287,13 +360,22 @@ func WalkAsOfAccounts(tx ethdb.Tx, startAddress common.Address, timestamp uint64
 		if br {
 			break
 		}
+		if endAddress != nil { // the next account is the smaller of the keys
+			key := k
+			if cmp > 0 {
+				key = hK
+			}
+			if bytes.Compare(key, endAddress[:]) >= 0 {
+				break
+			}
+		}
 		if cmp < 0 {
-			goOn, err = walker(k, v)
+			goOn, err = emit(k, v)
 		} else {
 			index := roaring64.New()
 			_, err = index.ReadFrom(bytes.NewReader(hV))
 			if err != nil {
-				return err
+				return nil, err
 			}
 			found, ok := bitmapdb.SeekInBitmap64(index, timestamp)
 			changeSetBlock := found
@@ -303,32 +385,32 @@ func WalkAsOfAccounts(tx ethdb.Tx, startAddress common.Address, timestamp uint64
 				kData := csKey
 				data, err3 := csCursor.SeekBothRange(csKey, hK)
 				if err3 != nil {
-					return err3
+					return nil, err3
 				}
 				if !bytes.Equal(kData, csKey) || !bytes.HasPrefix(data, hK) {
-					return fmt.Errorf("inconsistent account history and changesets, kData %x, csKey %x, data %x, hK %x", kData, csKey, data, hK)
+					return nil, fmt.Errorf("inconsistent account history and changesets, kData %x, csKey %x, data %x, hK %x", kData, csKey, data, hK)
 				}
 				data = data[common.AddressLength:]
 				if len(data) > 0 { // Skip accounts did not exist
-					goOn, err = walker(hK, data)
+					goOn, err = emit(hK, data)
 				}
 			} else if cmp == 0 {
-				goOn, err = walker(k, v)
+				goOn, err = emit(k, v)
 			}
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if goOn {
 			if cmp <= 0 {
 				k, v, err1 = mainCursor.Next()
 				if err1 != nil {
-					return err1
+					return nil, err1
 				}
 				for k != nil && len(k) > common.AddressLength {
 					k, v, err1 = mainCursor.Next()
 					if err1 != nil {
-						return err1
+						return nil, err1
 					}
 				}
 			}
@@ -337,12 +419,11 @@ func WalkAsOfAccounts(tx ethdb.Tx, startAddress common.Address, timestamp uint64
 				for hK != nil && (bytes.Equal(hK0, hK) || binary.BigEndian.Uint64(tsEnc) < timestamp) {
 					hK, tsEnc, _, hV, err1 = hCursor.Next()
 					if err1 != nil {
-						return err1
+						return nil, err1
 					}
 				}
 			}
 		}
 	}
-	return err
-
+	return next, err
 }
@@ -963,6 +963,67 @@ func TestWalkAsOfAccountPlain(t *testing.T) {
 	assertChangesEquals(t, block6, block6Expected)
 }
 
+func TestWalkAsOfAccountsRange(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tds := NewTrieDbState(common.Hash{}, db, 1)
+	emptyAcc := accounts.NewAccount()
+	block3Acc := emptyAcc.SelfCopy()
+	block3Acc.Nonce = 3
+	block3Acc.Initialised = true
+	block5Acc := emptyAcc.SelfCopy()
+	block5Acc.Nonce = 5
+	block5Acc.Initialised = true
+
+	addrs := make([]common.Address, 7)
+	var block3 []accData
+	for i := range addrs {
+		addrs[i] = common.Address{byte(i + 1)}
+		if i < 6 {
+			block3 = append(block3, accData{addr: addrs[i], oldVal: &emptyAcc, newVal: block3Acc})
+		}
+	}
+	writeBlockData(t, tds, 3, block3)
+	writeBlockData(t, tds, 5, []accData{
+		{addr: addrs[2], oldVal: block3Acc, newVal: nil},
+		{addr: addrs[4], oldVal: block3Acc, newVal: block5Acc},
+		{addr: addrs[6], oldVal: &emptyAcc, newVal: block5Acc},
+	})
+
+	tx, err := db.KV().Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	walk := func(start common.Address, end *common.Address, limit int, timestamp uint64) ([]common.Address, []byte) {
+		var walked []common.Address
+		next, err := WalkAsOfAccountsRange(tx, start, end, limit, timestamp, func(k, _ []byte) (bool, error) {
+			walked = append(walked, common.BytesToAddress(k))
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return walked, next
+	}
+
+	// The deleted account is skipped, the limit is hit before the end of the range
+	walked, next := walk(addrs[1], &addrs[5], 2, 6)
+	assert.Equal(t, []common.Address{addrs[1], addrs[3]}, walked)
+	assert.Equal(t, addrs[4].Bytes(), next)
+	walked, next = walk(common.BytesToAddress(next), &addrs[5], 2, 6)
+	assert.Equal(t, []common.Address{addrs[4]}, walked)
+	assert.Nil(t, next)
+
+	// As of the block before, the deleted account is read from the history
+	walked, next = walk(addrs[1], nil, 3, 4)
+	assert.Equal(t, []common.Address{addrs[1], addrs[2], addrs[3]}, walked)
+	assert.Equal(t, addrs[4].Bytes(), next)
+	walked, next = walk(addrs[4], nil, 0, 4)
+	assert.Equal(t, []common.Address{addrs[4], addrs[5]}, walked)
+	assert.Nil(t, next)
+}
+
 func TestWalkAsOfAccountPlain_WithChunks(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 	defer db.Close()
@@ -1263,6 +1324,71 @@ type accData struct {
 	newVal *accounts.Account
 }
 
+type testChangesetArchive struct {
+	kv ethdb.KV
+}
+
+func (a testChangesetArchive) Changesets(bucket string, blockNum uint64) (ethdb.Tx, error) {
+	return a.kv.Begin(context.Background())
+}
+
+func TestFindByHistoryPrunedChangesets(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	archived := ethdb.NewMemDatabase()
+	defer archived.Close()
+	addr := common.Address{1}
+	block1Acc, block3Acc, block5Acc := accounts.NewAccount(), accounts.NewAccount(), accounts.NewAccount()
+	block1Acc.Nonce, block3Acc.Nonce, block5Acc.Nonce = 1, 3, 5
+	block1Acc.Initialised, block3Acc.Initialised, block5Acc.Initialised = true, true, true
+	for _, d := range []ethdb.Database{db, archived} {
+		writeBlockData(t, NewTrieDbState(common.Hash{}, d, 1), 3, []accData{{addr: addr, oldVal: &block1Acc, newVal: &block3Acc}})
+	}
+	writeBlockData(t, NewTrieDbState(common.Hash{}, db, 1), 5, []accData{{addr: addr, oldVal: &block3Acc, newVal: &block5Acc}})
+
+	getAsOf := func(kv ethdb.KV, timestamp uint64) ([]byte, error) {
+		tx, err := kv.Begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		return GetAsOf(tx, false /* storage */, addr[:], timestamp)
+	}
+	want, err := getAsOf(db.KV(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, want)
+
+	// The changesets of the blocks before 5 are moved into the archive
+	if err = db.KV().Update(context.Background(), func(tx ethdb.RwTx) error {
+		c := tx.RwCursorDupSort(dbutils.PlainAccountChangeSetBucket)
+		defer c.Close()
+		if _, _, err = c.SeekExact(dbutils.EncodeBlockNumber(3)); err != nil {
+			return err
+		}
+		return c.DeleteCurrentDuplicates()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pruneProgress := func(ethdb.Tx, string) (uint64, error) { return 5, nil }
+
+	// Without the archive the pruned changesets are an error, the kept ones are read from the database
+	pruned := ethdb.NewChangesetsKV(db.KV(), pruneProgress, nil)
+	_, err = getAsOf(pruned, 3)
+	assert.ErrorIs(t, err, ethdb.ErrChangesetsPruned)
+	_, err = getAsOf(pruned, 4)
+	assert.NoError(t, err)
+	err = pruned.View(context.Background(), func(tx ethdb.Tx) error {
+		return WalkAsOfAccounts(tx, common.Address{}, 3, func(_, _ []byte) (bool, error) { return true, nil })
+	})
+	assert.ErrorIs(t, err, ethdb.ErrChangesetsPruned)
+
+	v, err := getAsOf(ethdb.NewChangesetsKV(db.KV(), pruneProgress, testChangesetArchive{archived.KV()}), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, want, v)
+}
+
 func writeBlockData(t *testing.T, tds *TrieDbState, blockNum uint64, data []accData) {
 	tds.SetBlockNr(blockNum)
 	var blockWriter = tds.PlainStateWriter()
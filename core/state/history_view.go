@@ -0,0 +1,170 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// DefaultHistoryViewRenewal is the age of the read transaction of the HistoryView after which it is renewed,
+// well below ethdb.DefaultReadTxWarn
+const DefaultHistoryViewRenewal = time.Minute
+
+// ErrHistoryViewReorged is returned by the HistoryView whose block is not canonical anymore
+var ErrHistoryViewReorged = errors.New("block of the history view is not canonical anymore")
+
+// HistoryView is the state as of the given block for the long readers, e.g. the analytics walking all the
+// accounts. A read transaction open for long prevents the reuse of the pages freed after its start, so the view
+// doesn't hold one: the state as of the indexed block is read from the history, which is only appended by the
+// execution of the next blocks, so the transaction is renewed every renewal period and the reads of the new one
+// return the same. The renewal fails with ErrHistoryViewReorged if the block was unwound meanwhile.
+// The view is not safe for the concurrent use.
+type HistoryView struct {
+	db      ethdb.Database
+	blockNr uint64
+	hash    common.Hash
+	renewal time.Duration
+
+	tx      ethdb.DbWithPendingMutations
+	reader  *PlainDBState
+	started time.Time
+	err     error // the failure of the renewal, the view is unusable after it
+}
+
+// NewHistoryView opens the view of the state as of the canonical block blockNr, which must be in the history
+// index already. The renewal is DefaultHistoryViewRenewal if zero
+func NewHistoryView(ctx context.Context, db ethdb.Database, blockNr uint64, renewal time.Duration) (*HistoryView, error) {
+	if renewal == 0 {
+		renewal = DefaultHistoryViewRenewal
+	}
+	v := &HistoryView{db: db, blockNr: blockNr, renewal: renewal}
+	if err := v.begin(ctx); err != nil {
+		return nil, err
+	}
+	for _, stage := range []stages.SyncStage{stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		progress, err := stages.GetStageProgress(v.tx, stage)
+		if err != nil {
+			v.Close()
+			return nil, err
+		}
+		if progress < blockNr {
+			v.Close()
+			return nil, fmt.Errorf("block %d is not in the history yet, %s is at %d", blockNr, stage, progress)
+		}
+	}
+	hash, err := rawdb.ReadCanonicalHash(v.tx, blockNr)
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+	if hash == (common.Hash{}) {
+		v.Close()
+		return nil, fmt.Errorf("canonical block %d not found", blockNr)
+	}
+	v.hash = hash
+	return v, nil
+}
+
+func (v *HistoryView) begin(ctx context.Context) error {
+	tx, err := v.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return err
+	}
+	v.tx, v.started = tx, time.Now()
+	v.reader = NewPlainDBState(tx, v.blockNr)
+	return nil
+}
+
+// BlockNumber is the block the state is viewed as of
+func (v *HistoryView) BlockNumber() uint64 {
+	return v.blockNr
+}
+
+// Renew replaces the read transaction of the view by a new one, and checks that the block is still canonical
+func (v *HistoryView) Renew(ctx context.Context) error {
+	if v.err != nil {
+		return v.err
+	}
+	v.tx.Rollback()
+	if v.err = v.begin(ctx); v.err != nil {
+		v.tx = nil
+		return v.err
+	}
+	hash, err := rawdb.ReadCanonicalHash(v.tx, v.blockNr)
+	if err == nil && hash != v.hash {
+		err = fmt.Errorf("%w: block %d is %x, was %x", ErrHistoryViewReorged, v.blockNr, hash, v.hash)
+	}
+	if err != nil {
+		v.err = err
+		v.Close()
+	}
+	return err
+}
+
+// Close rolls back the read transaction of the view
+func (v *HistoryView) Close() {
+	if v.tx != nil {
+		v.tx.Rollback()
+		v.tx = nil
+	}
+	if v.err == nil {
+		v.err = errors.New("history view is closed")
+	}
+}
+
+// current renews the read transaction if it is older than the renewal period
+func (v *HistoryView) current() (*PlainDBState, error) {
+	if v.err == nil && time.Since(v.started) >= v.renewal {
+		if err := v.Renew(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+	return v.reader, v.err
+}
+
+func (v *HistoryView) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadAccountData(address)
+}
+
+func (v *HistoryView) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadAccountStorage(address, incarnation, key)
+}
+
+func (v *HistoryView) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	r, err := v.current()
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (v *HistoryView) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	r, err := v.current()
+	if err != nil {
+		return 0, err
+	}
+	return r.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (v *HistoryView) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	r, err := v.current()
+	if err != nil {
+		return 0, err
+	}
+	return r.ReadAccountIncarnation(address)
+}
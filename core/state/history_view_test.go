@@ -0,0 +1,100 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestHistoryView(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+	addr := common.Address{1}
+
+	// The balance of the account is the number of the block
+	var prev *accounts.Account
+	writeBlock := func(blockNr uint64) {
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance = *uint256.NewInt().SetUint64(blockNr)
+		original := prev
+		if original == nil {
+			empty := accounts.NewAccount()
+			original = &empty
+		}
+		w := NewPlainStateWriter(db, db, blockNr)
+		if err := w.UpdateAccountData(ctx, addr, original, &acc); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteChangeSets(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteHistory(); err != nil {
+			t.Fatal(err)
+		}
+		if err := rawdb.WriteCanonicalHash(db, common.Hash{byte(blockNr)}, blockNr); err != nil {
+			t.Fatal(err)
+		}
+		for _, stage := range []stages.SyncStage{stages.Execution, stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+			if err := stages.SaveStageProgress(db, stage, blockNr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		prev = &acc
+	}
+	balanceAt := func(r StateReader) (uint64, error) {
+		acc, err := r.ReadAccountData(addr)
+		if err != nil {
+			return 0, err
+		}
+		return acc.Balance.Uint64(), nil
+	}
+	for blockNr := uint64(1); blockNr <= 3; blockNr++ {
+		writeBlock(blockNr)
+	}
+
+	if _, err := NewHistoryView(ctx, db, 4, 0); err == nil {
+		t.Fatal("expected the view of the block not in the history to fail")
+	}
+	view, err := NewHistoryView(ctx, db, 2, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+	if balance, err := balanceAt(view); err != nil || balance != 2 {
+		t.Fatalf("expected balance 2, got %d %v", balance, err)
+	}
+
+	// The view reads the same after the renewal, though the next blocks are executed meanwhile
+	renewed := view.tx
+	writeBlock(4)
+	if balance, err := balanceAt(view); err != nil || balance != 2 {
+		t.Fatalf("expected balance 2 after the renewal, got %d %v", balance, err)
+	}
+	if view.tx == renewed {
+		t.Error("expected the transaction to be renewed")
+	}
+	if balance, _ := balanceAt(NewPlainStateReader(db)); balance != 4 {
+		t.Errorf("expected the latest balance 4, got %d", balance)
+	}
+
+	// The block of the view is reorged
+	if err := rawdb.WriteCanonicalHash(db, common.Hash{0xff}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := balanceAt(view); !errors.Is(err, ErrHistoryViewReorged) {
+		t.Fatalf("expected ErrHistoryViewReorged, got %v", err)
+	}
+	if err := view.Renew(ctx); !errors.Is(err, ErrHistoryViewReorged) {
+		t.Errorf("expected the reorged view to stay unusable, got %v", err)
+	}
+}
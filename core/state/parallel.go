@@ -0,0 +1,138 @@
+package state
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+// TxReadSet is the reader of the state of the transaction executed speculatively on its own IntraBlockState, it
+// records the accounts the transaction reads. It is also the tracer of the IntraBlockState, to tell the accounts
+// observed by the transaction from the accounts it only adds to, like the coinbase
+type TxReadSet struct {
+	r        StateReader
+	accounts map[common.Address]struct{} // read from r
+	storage  map[common.Address]struct{} // the storage or the code read from r
+	observed map[common.Address]struct{} // observed by the execution, e.g. by BALANCE or EXTCODEHASH
+}
+
+func NewTxReadSet(r StateReader) *TxReadSet {
+	return &TxReadSet{
+		r:        r,
+		accounts: make(map[common.Address]struct{}),
+		storage:  make(map[common.Address]struct{}),
+		observed: make(map[common.Address]struct{}),
+	}
+}
+
+func (s *TxReadSet) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	s.accounts[address] = struct{}{}
+	return s.r.ReadAccountData(address)
+}
+
+func (s *TxReadSet) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	s.accounts[address] = struct{}{}
+	s.storage[address] = struct{}{}
+	return s.r.ReadAccountStorage(address, incarnation, key)
+}
+
+func (s *TxReadSet) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	s.accounts[address] = struct{}{}
+	s.storage[address] = struct{}{}
+	return s.r.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (s *TxReadSet) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	s.accounts[address] = struct{}{}
+	s.storage[address] = struct{}{}
+	return s.r.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (s *TxReadSet) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	s.accounts[address] = struct{}{}
+	s.storage[address] = struct{}{}
+	return s.r.ReadAccountIncarnation(address)
+}
+
+func (s *TxReadSet) CaptureAccountRead(account common.Address) error {
+	s.observed[account] = struct{}{}
+	return nil
+}
+
+func (s *TxReadSet) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// MergeTx moves the changes of the transaction executed on its own state tx, finalized by FinalizeTx, into sdb. The
+// transaction was executed on the state of the start of the block, reading it through reads, so it is merged only if
+// none of the accounts it read or changed are changed in sdb by the earlier transactions of the block. The coinbase
+// only added to by the transaction, e.g. by its fee, is the exception, the increment of its balance is added in sdb.
+// The journal of sdb is left to be finalized by FinalizeTx. It returns false if the transaction conflicts with the
+// earlier ones, sdb is not changed then
+func (sdb *IntraBlockState) MergeTx(tx *IntraBlockState, reads *TxReadSet, coinbase common.Address) bool {
+	var coinbaseDelta *uint256.Int
+	if obj, ok := tx.stateObjects[coinbase]; ok && onlyAddedTo(obj, reads) {
+		if _, dirty := tx.stateObjectsDirty[coinbase]; dirty {
+			coinbaseDelta = new(uint256.Int).Sub(&obj.data.Balance, &obj.original.Balance)
+		} else {
+			coinbaseDelta = new(uint256.Int)
+		}
+	}
+
+	sdb.Lock()
+	for _, touched := range []map[common.Address]struct{}{reads.accounts, tx.stateObjectsDirty} {
+		for addr := range touched {
+			if addr == coinbase && coinbaseDelta != nil {
+				continue
+			}
+			if _, dirty := sdb.stateObjectsDirty[addr]; dirty {
+				sdb.Unlock()
+				return false
+			}
+		}
+	}
+	for addr := range tx.stateObjectsDirty {
+		if addr == coinbase && coinbaseDelta != nil {
+			continue
+		}
+		obj := tx.stateObjects[addr]
+		obj.db = sdb
+		sdb.stateObjects[addr] = obj
+		sdb.stateObjectsDirty[addr] = struct{}{}
+		delete(sdb.nilAccounts, addr)
+	}
+	for hash, logs := range tx.logs {
+		for _, l := range logs {
+			l.Index += sdb.logSize
+		}
+		sdb.logs[hash] = append(sdb.logs[hash], logs...)
+		sdb.logSize += uint(len(logs))
+	}
+	for hash, preimage := range tx.preimages {
+		sdb.preimages[hash] = preimage
+	}
+	sdb.Unlock()
+
+	if _, dirty := tx.stateObjectsDirty[coinbase]; dirty && coinbaseDelta != nil {
+		sdb.AddBalance(coinbase, coinbaseDelta)
+	}
+	return true
+}
+
+// onlyAddedTo tells if the transaction neither observed the account nor changed anything but its balance
+func onlyAddedTo(obj *stateObject, reads *TxReadSet) bool {
+	if _, ok := reads.observed[obj.address]; ok {
+		return false
+	}
+	if _, ok := reads.storage[obj.address]; ok {
+		return false
+	}
+	originalCodeHash := obj.original.CodeHash
+	if originalCodeHash == (common.Hash{}) {
+		originalCodeHash = emptyCodeHashH
+	}
+	return !obj.suicided && !obj.created && !obj.dirtyCode && len(obj.dirtyStorage) == 0 &&
+		obj.data.Nonce == obj.original.Nonce &&
+		obj.data.Incarnation == obj.original.Incarnation &&
+		obj.data.CodeHash == originalCodeHash
+}
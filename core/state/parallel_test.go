@@ -0,0 +1,63 @@
+package state
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestMergeTx(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	coinbase, changed, other := common.Address{0xcb}, common.Address{1}, common.Address{2}
+	ctx := params.TestChainConfig.WithEIPsFlags(context.Background(), big.NewInt(1))
+
+	// The earlier transaction of the block changed the account and paid the fee
+	ibs := New(NewPlainStateReader(db))
+	ibs.AddBalance(changed, uint256.NewInt().SetUint64(10))
+	ibs.AddBalance(coinbase, uint256.NewInt().SetUint64(1))
+	if err := ibs.FinalizeTx(ctx, NewNoopWriter()); err != nil {
+		t.Fatal(err)
+	}
+
+	speculate := func(addr common.Address) (*IntraBlockState, *TxReadSet) {
+		reads := NewTxReadSet(NewPlainStateReader(db))
+		tx := New(reads)
+		tx.SetTracer(reads)
+		tx.AddBalance(addr, uint256.NewInt().SetUint64(5))
+		tx.AddBalance(coinbase, uint256.NewInt().SetUint64(2))
+		if err := tx.FinalizeTx(ctx, NewNoopWriter()); err != nil {
+			t.Fatal(err)
+		}
+		return tx, reads
+	}
+	if tx, reads := speculate(changed); ibs.MergeTx(tx, reads, coinbase) {
+		t.Error("the transaction reading the changed account is merged")
+	}
+	if tx, reads := speculate(other); !ibs.MergeTx(tx, reads, coinbase) {
+		t.Error("the independent transaction is not merged")
+	}
+	if balance := ibs.GetBalance(other); balance.Uint64() != 5 {
+		t.Errorf("balance of the merged account %d", balance.Uint64())
+	}
+	if balance := ibs.GetBalance(coinbase); balance.Uint64() != 3 {
+		t.Errorf("balance of the coinbase %d, the fees are not added up", balance.Uint64())
+	}
+
+	// The transaction observing the coinbase conflicts with the fees of the earlier ones
+	reads := NewTxReadSet(NewPlainStateReader(db))
+	tx := New(reads)
+	tx.SetTracer(reads)
+	tx.GetBalance(coinbase)
+	if err := tx.FinalizeTx(ctx, NewNoopWriter()); err != nil {
+		t.Fatal(err)
+	}
+	if ibs.MergeTx(tx, reads, coinbase) {
+		t.Error("the transaction observing the coinbase is merged")
+	}
+}
@@ -221,11 +221,7 @@ func (dbs *PlainDBState) ReadAccountCode(address common.Address, incarnation uin
 	if bytes.Equal(codeHash[:], emptyCodeHash) {
 		return nil, nil
 	}
-	code, err := tx.GetOne(dbutils.CodeBucket, codeHash[:])
-	if len(code) == 0 {
-		return nil, nil
-	}
-	return code, err
+	return readCode(codeHash, tx.GetOne)
 }
 
 func (dbs *PlainDBState) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
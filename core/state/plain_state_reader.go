@@ -7,6 +7,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/codecache"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
@@ -57,10 +58,21 @@ func (r *PlainStateReader) ReadAccountCode(address common.Address, incarnation u
 	if bytes.Equal(codeHash.Bytes(), emptyCodeHash) {
 		return nil, nil
 	}
-	code, err := r.db.Get(dbutils.CodeBucket, codeHash.Bytes())
+	return readCode(codeHash, r.db.Get)
+}
+
+// readCode reads the code of the hash through the shared code cache
+func readCode(codeHash common.Hash, get func(bucket string, key []byte) ([]byte, error)) ([]byte, error) {
+	if code, ok := codecache.Shared.Code(codeHash); ok {
+		return code, nil
+	}
+	code, err := get(dbutils.CodeBucket, codeHash[:])
 	if len(code) == 0 {
 		return nil, nil
 	}
+	if err == nil {
+		codecache.Shared.AddCode(codeHash, code)
+	}
 	return code, err
 }
 
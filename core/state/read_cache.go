@@ -0,0 +1,238 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// MaxReadCacheAdvance is the number of the blocks the ReadCache walks the changesets of to advance, the cache is
+// purged instead if it is further behind
+const MaxReadCacheAdvance = 128
+
+var (
+	readCacheAccountHit  = metrics.NewRegisteredCounter("state/readcache/account/hit", nil)
+	readCacheAccountMiss = metrics.NewRegisteredCounter("state/readcache/account/miss", nil)
+	readCacheStorageHit  = metrics.NewRegisteredCounter("state/readcache/storage/hit", nil)
+	readCacheStorageMiss = metrics.NewRegisteredCounter("state/readcache/storage/miss", nil)
+)
+
+type storageCacheKey struct {
+	address     common.Address
+	incarnation uint64
+	location    common.Hash
+}
+
+// ReadCache keeps the recently read accounts and storage of the state after a block, for the readers of the
+// following blocks, e.g. the execution of the next block or the calls on top of the latest one. The accounts and the
+// storage changed by the new blocks are dropped by their changesets when the cache advances to them. The code is
+// cached by the base readers in the codecache.Shared cache. The caches are LRU bounded by the number of the entries.
+// The cache is safe for the concurrent use
+type ReadCache struct {
+	lock       sync.RWMutex
+	accounts   *lru.Cache // common.Address -> *accounts.Account, nil if absent
+	storage    *lru.Cache // storageCacheKey -> []byte
+	block      uint64
+	hash       common.Hash // canonical hash of the block, the cache is purged if it changes
+	generation uint64      // incremented on every change of the state cached, 0 before the first block
+}
+
+// NewReadCache creates the cache of the given numbers of the accounts and the storage slots
+func NewReadCache(accountsSize, storageSize int) (*ReadCache, error) {
+	c := &ReadCache{}
+	var err error
+	if c.accounts, err = lru.New(accountsSize); err != nil {
+		return nil, fmt.Errorf("accounts cache: %w", err)
+	}
+	if c.storage, err = lru.New(storageSize); err != nil {
+		return nil, fmt.Errorf("storage cache: %w", err)
+	}
+	return c, nil
+}
+
+// NewReadCacheOfAccounts creates the cache of the given number of the accounts, with the room for 4 storage slots per
+// account
+func NewReadCacheOfAccounts(accountsSize int) (*ReadCache, error) {
+	return NewReadCache(accountsSize, 4*accountsSize)
+}
+
+// Reader returns the reader of the state after the block through the cache, r reads the same state from the
+// transaction tx. The cache is advanced to the block first, by the changesets of the blocks in between read from tx.
+// The readers of the state older than the cached one, e.g. of the transactions started before the latest block, read
+// r directly
+func (c *ReadCache) Reader(tx ethdb.Getter, r StateReader, block uint64) (StateReader, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation > 0 && block < c.block {
+		return r, nil
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, block)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.generation == 0:
+		c.purge()
+	case block == c.block:
+		if hash == c.hash {
+			return &readCacheReader{r: r, c: c, generation: c.generation}, nil
+		}
+		c.purge()
+	default:
+		// The cached block must be still canonical for its changesets to lead to the new one
+		cachedHash, err := rawdb.ReadCanonicalHash(tx, c.block)
+		if err != nil {
+			return nil, err
+		}
+		if cachedHash != c.hash || block-c.block > MaxReadCacheAdvance {
+			c.purge()
+		} else if err = c.invalidate(tx, c.block+1, block); err != nil {
+			c.purge()
+			c.generation++
+			return nil, err
+		}
+	}
+	c.block, c.hash = block, hash
+	c.generation++
+	return &readCacheReader{r: r, c: c, generation: c.generation}, nil
+}
+
+// ReaderAt returns the reader of the state after the block through the cache if the cache is at the block, r reads
+// the same state from the transaction tx. Unlike Reader, it never moves the cache, the readers of any other block, e.g.
+// of the state committed before the block the cache is at, read r directly
+func (c *ReadCache) ReaderAt(tx ethdb.Getter, r StateReader, block uint64) (StateReader, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.generation == 0 || block != c.block {
+		return r, nil
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, block)
+	if err != nil {
+		return nil, err
+	}
+	if hash != c.hash {
+		return r, nil
+	}
+	return &readCacheReader{r: r, c: c, generation: c.generation}, nil
+}
+
+// Purge drops all the cached state
+func (c *ReadCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.purge()
+	c.generation++
+}
+
+func (c *ReadCache) purge() {
+	c.accounts.Purge()
+	c.storage.Purge()
+}
+
+// invalidate drops the accounts and the storage changed by the blocks from, to inclusive
+func (c *ReadCache) invalidate(tx ethdb.Getter, from, to uint64) error {
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		fromDBFormat := changeset.FromDBFormat(common.AddressLength)
+		if err := tx.Walk(bucket, dbutils.EncodeBlockNumber(from), 0, func(dbKey, dbValue []byte) (bool, error) {
+			blockNum, k, _ := fromDBFormat(dbKey, dbValue)
+			if blockNum > to {
+				return false, nil
+			}
+			if bucket == dbutils.PlainAccountChangeSetBucket {
+				c.accounts.Remove(common.BytesToAddress(k))
+				return true, nil
+			}
+			var key storageCacheKey
+			copy(key.address[:], k)
+			key.incarnation = binary.BigEndian.Uint64(k[common.AddressLength:])
+			copy(key.location[:], k[common.AddressLength+common.IncarnationLength:])
+			c.storage.Remove(key)
+			return true, nil
+		}); err != nil {
+			return fmt.Errorf("walking %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// readCacheReader reads the state of its generation through the cache, the cache is bypassed after it changes
+type readCacheReader struct {
+	r          StateReader
+	c          *ReadCache
+	generation uint64
+}
+
+// current locks the cache for reading if it is still of the generation of the reader
+func (cr *readCacheReader) current() bool {
+	cr.c.lock.RLock()
+	if cr.c.generation != cr.generation {
+		cr.c.lock.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (cr *readCacheReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	if !cr.current() {
+		return cr.r.ReadAccountData(address)
+	}
+	defer cr.c.lock.RUnlock()
+	if v, ok := cr.c.accounts.Get(address); ok {
+		readCacheAccountHit.Inc(1)
+		if a := v.(*accounts.Account); a != nil {
+			return a.SelfCopy(), nil
+		}
+		return nil, nil
+	}
+	readCacheAccountMiss.Inc(1)
+	a, err := cr.r.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		cr.c.accounts.Add(address, (*accounts.Account)(nil))
+		return nil, nil
+	}
+	cr.c.accounts.Add(address, a.SelfCopy())
+	return a, nil
+}
+
+func (cr *readCacheReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if !cr.current() {
+		return cr.r.ReadAccountStorage(address, incarnation, key)
+	}
+	defer cr.c.lock.RUnlock()
+	k := storageCacheKey{address: address, incarnation: incarnation, location: *key}
+	if v, ok := cr.c.storage.Get(k); ok {
+		readCacheStorageHit.Inc(1)
+		return v.([]byte), nil
+	}
+	readCacheStorageMiss.Inc(1)
+	v, err := cr.r.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	cr.c.storage.Add(k, common.CopyBytes(v))
+	return v, nil
+}
+
+func (cr *readCacheReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	return cr.r.ReadAccountCode(address, incarnation, codeHash)
+}
+
+func (cr *readCacheReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	return cr.r.ReadAccountCodeSize(address, incarnation, codeHash)
+}
+
+func (cr *readCacheReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	return cr.r.ReadAccountIncarnation(address)
+}
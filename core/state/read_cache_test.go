@@ -0,0 +1,130 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestReadCache(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+	changed, unchanged := common.Address{1}, common.Address{2}
+	location := common.Hash{3}
+
+	// The balance of the changed account and its storage slot are the number of the block
+	var prev *accounts.Account
+	writeBlock := func(blockNr uint64, hash common.Hash) {
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance = *uint256.NewInt().SetUint64(blockNr)
+		acc.Incarnation = 1
+		original := prev
+		if original == nil {
+			empty := accounts.NewAccount()
+			original = &empty
+		}
+		w := NewPlainStateWriter(db, db, blockNr)
+		if err := w.UpdateAccountData(ctx, changed, original, &acc); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteAccountStorage(ctx, changed, 1, &location, uint256.NewInt().SetUint64(blockNr-1), uint256.NewInt().SetUint64(blockNr)); err != nil {
+			t.Fatal(err)
+		}
+		if blockNr == 1 {
+			if err := w.UpdateAccountData(ctx, unchanged, original, &acc); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.WriteChangeSets(); err != nil {
+			t.Fatal(err)
+		}
+		if err := rawdb.WriteCanonicalHash(db, hash, blockNr); err != nil {
+			t.Fatal(err)
+		}
+		prev = &acc
+	}
+	read := func(r StateReader) (uint64, uint64, bool) {
+		acc, err := r.ReadAccountData(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slot, err := r.ReadAccountStorage(changed, 1, &location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := r.ReadAccountData(unchanged)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return acc.Balance.Uint64(), new(uint256.Int).SetBytes(slot).Uint64(), other != nil
+	}
+
+	cache, err := NewReadCacheOfAccounts(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeBlock(1, common.Hash{1})
+	r, err := cache.Reader(db, NewPlainStateReader(db), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance, slot, found := read(r); balance != 1 || slot != 1 || !found {
+		t.Fatalf("block 1: balance %d, slot %d, found %t", balance, slot, found)
+	}
+	// Read from the cache, the unchanged account is gone from the database without a changeset
+	if err = db.Delete(dbutils.PlainStateBucket, unchanged[:], nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := read(r); !found {
+		t.Fatal("the cached account is read from the database")
+	}
+
+	// The changesets of the new block drop the changed account and slot
+	writeBlock(2, common.Hash{2})
+	if r, err = cache.Reader(db, NewPlainStateReader(db), 2); err != nil {
+		t.Fatal(err)
+	}
+	if balance, slot, found := read(r); balance != 2 || slot != 2 || !found {
+		t.Fatalf("block 2: balance %d, slot %d, found %t", balance, slot, found)
+	}
+	// The readers of the older state bypass the cache
+	old, err := cache.Reader(db, NewPlainStateReader(db), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := old.(*PlainStateReader); !ok {
+		t.Errorf("the reader of the older block reads through the cache")
+	}
+	// ReaderAt does not move the cache
+	if old, err = cache.ReaderAt(db, NewPlainStateReader(db), 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := old.(*PlainStateReader); !ok {
+		t.Errorf("the reader of another block reads through the cache")
+	}
+	if r, err = cache.ReaderAt(db, NewPlainStateReader(db), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.(*readCacheReader); !ok {
+		t.Errorf("the reader of the cached block bypasses the cache")
+	}
+
+	// The block replaced by a reorg drops the whole cache
+	if err = rawdb.WriteCanonicalHash(db, common.Hash{0x22}, 2); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = cache.Reader(db, NewPlainStateReader(db), 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, found := read(r); found {
+		t.Error("the cache is kept after the reorg")
+	}
+}
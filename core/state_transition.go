@@ -51,6 +51,8 @@ type StateTransition struct {
 	msg        Message
 	gas        uint64
 	gasPrice   *uint256.Int
+	feeCap     *uint256.Int
+	tip        *uint256.Int
 	initialGas uint64
 	value      *uint256.Int
 	data       []byte
@@ -64,6 +66,8 @@ type Message interface {
 	To() *common.Address
 
 	GasPrice() *uint256.Int
+	FeeCap() *uint256.Int
+	Tip() *uint256.Int
 	Gas() uint64
 	Value() *uint256.Int
 
@@ -156,6 +160,8 @@ func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition
 		evm:      evm,
 		msg:      msg,
 		gasPrice: msg.GasPrice(),
+		feeCap:   msg.FeeCap(),
+		tip:      msg.Tip(),
 		value:    msg.Value(),
 		data:     msg.Data(),
 		state:    evm.IntraBlockState,
@@ -187,7 +193,17 @@ func (st *StateTransition) to() common.Address {
 func (st *StateTransition) buyGas(gasBailout bool) error {
 	mgval := new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.gasPrice.ToBig())
 	gasCost, overflow := uint256.FromBig(mgval)
-	if have, want := st.state.GetBalance(st.msg.From()), mgval; overflow || st.state.GetBalance(st.msg.From()).Lt(gasCost) {
+	// After EIP-1559 the sender must be able to pay the fee cap for all the gas and
+	// the value, even though only the effective gas price is charged
+	balanceCheck := mgval
+	if st.evm.ChainConfig().IsLondon(st.evm.Context.BlockNumber) {
+		balanceCheck = new(big.Int).Mul(new(big.Int).SetUint64(st.msg.Gas()), st.feeCap.ToBig())
+		balanceCheck.Add(balanceCheck, st.value.ToBig())
+		if !overflow {
+			_, overflow = uint256.FromBig(balanceCheck)
+		}
+	}
+	if have, want := st.state.GetBalance(st.msg.From()), balanceCheck; overflow || have.ToBig().Cmp(want) < 0 {
 		if !gasBailout {
 			return fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, st.msg.From().Hex(), have, want)
 		}
@@ -216,6 +232,20 @@ func (st *StateTransition) preCheck(gasBailout bool) error {
 				st.msg.From().Hex(), msgNonce, stNonce)
 		}
 	}
+	// Make sure that the transaction fee cap and tip are consistent and cover the base fee.
+	// Zero-priced calls may skip the checks if the EVM is configured so.
+	if st.evm.ChainConfig().IsLondon(st.evm.Context.BlockNumber) {
+		if !st.evm.Config().NoBaseFee || !st.feeCap.IsZero() || !st.tip.IsZero() {
+			if st.feeCap.Lt(st.tip) {
+				return fmt.Errorf("%w: address %v, tip: %s, feeCap: %s", ErrTipAboveFeeCap,
+					st.msg.From().Hex(), st.tip, st.feeCap)
+			}
+			if baseFee := st.evm.Context.BaseFee; baseFee != nil && st.feeCap.ToBig().Cmp(baseFee) < 0 {
+				return fmt.Errorf("%w: address %v, feeCap: %s baseFee: %s", ErrFeeCapTooLow,
+					st.msg.From().Hex(), st.feeCap, baseFee)
+			}
+		}
+	}
 	return st.buyGas(gasBailout)
 }
 
@@ -237,7 +267,8 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 	// applying the message. The rules include these clauses
 	//
 	// 1. the nonce of the message caller is correct
-	// 2. caller has enough balance to cover transaction fee(gaslimit * gasprice)
+	// 2. caller has enough balance to cover transaction fee(gaslimit * gasprice),
+	//    and the fee cap covers the base fee after EIP-1559
 	// 3. the amount of gas required is available in the block
 	// 4. the purchased gas is enough to cover intrinsic usage
 	// 5. there is no overflow when calculating intrinsic gas
@@ -295,7 +326,19 @@ func (st *StateTransition) TransitionDb(refunds bool, gasBailout bool) (*Executi
 	if refunds {
 		st.refundGas()
 	}
-	st.state.AddBalance(st.evm.Context.Coinbase, new(uint256.Int).Mul(new(uint256.Int).SetUint64(st.gasUsed()), st.gasPrice))
+	// After EIP-1559 the base fee part of the gas price is burnt, only the tip goes to the miner
+	effectiveTip := st.gasPrice
+	if st.evm.ChainConfig().IsLondon(st.evm.Context.BlockNumber) && st.evm.Context.BaseFee != nil {
+		baseFee, _ := uint256.FromBig(st.evm.Context.BaseFee)
+		effectiveTip = new(uint256.Int)
+		if st.feeCap.Gt(baseFee) {
+			effectiveTip.Sub(st.feeCap, baseFee)
+			if st.tip.Lt(effectiveTip) {
+				effectiveTip.Set(st.tip)
+			}
+		}
+	}
+	st.state.AddBalance(st.evm.Context.Coinbase, new(uint256.Int).Mul(new(uint256.Int).SetUint64(st.gasUsed()), effectiveTip))
 
 	return &ExecutionResult{
 		UsedGas:    st.gasUsed(),
@@ -17,164 +17,232 @@
 package core
 
 import (
+	"encoding/binary"
 	"errors"
-	"io"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rlp"
 )
 
 // errNoActiveJournal is returned if a transaction is attempted to be inserted
-// into the journal, but no such file is currently open.
+// into the journal, but the journal is not rotated yet.
 var errNoActiveJournal = errors.New("no active journal")
 
-// devNull is a WriteCloser that just discards anything written into it. Its
-// goal is to allow the transaction journal to write into a fake journal when
-// loading transactions on startup without printing warnings due to no file
-// being read for write.
-type devNull struct{}
-
-func (*devNull) Write(p []byte) (n int, err error) { return len(p), nil }
-func (*devNull) Close() error                      { return nil }
-
-// txJournal is a rotating log of transactions with the aim of storing locally
-// created transactions to allow non-executed ones to survive node restarts.
+// txJournal is a log of transactions kept in the database with the aim of storing
+// locally created transactions to allow non-executed ones to survive node restarts.
+// Inserted transactions are buffered in memory and written by flush, so adding
+// transactions to the pool never waits for the database.
 type txJournal struct {
-	path   string         // Filesystem path to store the transactions at
-	writer io.WriteCloser // Output stream to write new transactions into
+	db       ethdb.Database
+	lifetime time.Duration // Time after which journaled transactions are pruned, 0 keeps them forever
+
+	mu       sync.Mutex
+	active   bool                               // Whether the journal accepts new transactions
+	loading  bool                               // Whether the journal is being loaded, insertions are discarded
+	inserted map[common.Hash]*types.Transaction // Transactions to be written by the next flush
 }
 
-// newTxJournal creates a new transaction journal to
-func newTxJournal(path string) *txJournal {
+// newTxJournal creates a new transaction journal on top of the database
+func newTxJournal(db ethdb.Database, lifetime time.Duration) *txJournal {
 	return &txJournal{
-		path: path,
+		db:       db,
+		lifetime: lifetime,
+		inserted: make(map[common.Hash]*types.Transaction),
 	}
 }
 
-// load parses a transaction journal dump from disk, loading its contents into
-// the specified pool.
-func (journal *txJournal) load(add func([]*types.Transaction) []error) error {
-	// Skip the parsing if the journal file doesn't exist at all
-	if _, err := os.Stat(journal.path); os.IsNotExist(err) {
-		return nil
-	}
-	// Open the journal for loading any past transactions
-	input, err := os.Open(journal.path)
+// encodeJournalEntry encodes the transaction prefixed with the time it's been journaled at
+func encodeJournalEntry(tx *types.Transaction, at time.Time) ([]byte, error) {
+	enc, err := rlp.EncodeToBytes(tx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer input.Close()
+	v := make([]byte, 8+len(enc))
+	binary.BigEndian.PutUint64(v, uint64(at.Unix()))
+	copy(v[8:], enc)
+	return v, nil
+}
 
-	// Temporarily discard any journal additions (don't double add on load)
-	journal.writer = new(devNull)
-	defer func() { journal.writer = nil }()
-
-	// Inject all transactions from the journal into the pool
-	stream := rlp.NewStream(input, 0)
-	total, dropped := 0, 0
-
-	// Create a method to load a limited batch of transactions and bump the
-	// appropriate progress counters. Then use this method to load all the
-	// journaled transactions in small-ish batches.
-	loadBatch := func(txs types.Transactions) {
-		for _, err := range add(txs) {
-			if err != nil {
-				log.Debug("Failed to add journaled transaction", "err", err)
-				dropped++
-			}
-		}
+// expired reports whether the journal entry is older than the lifetime of the journal
+func (journal *txJournal) expired(v []byte, now time.Time) bool {
+	if journal.lifetime == 0 || len(v) < 8 {
+		return false
 	}
+	return now.Sub(time.Unix(int64(binary.BigEndian.Uint64(v)), 0)) > journal.lifetime
+}
+
+// load reads the transaction journal from the database, loading its contents into
+// the specified pool. Expired and undecodable entries are pruned.
+func (journal *txJournal) load(add func([]*types.Transaction) []error) error {
+	// Temporarily discard any journal additions (don't double add on load)
+	journal.mu.Lock()
+	journal.loading = true
+	journal.mu.Unlock()
+	defer func() {
+		journal.mu.Lock()
+		journal.loading = false
+		journal.mu.Unlock()
+	}()
+
 	var (
-		failure error
-		batch   types.Transactions
+		now    = time.Now()
+		txs    types.Transactions
+		pruned [][]byte
 	)
-	for {
-		// Parse the next transaction and terminate on error
+	if err := journal.db.Walk(dbutils.TxPoolJournal, nil, 0, func(k, v []byte) (bool, error) {
+		if journal.expired(v, now) {
+			pruned = append(pruned, common.CopyBytes(k))
+			return true, nil
+		}
+		if len(v) < 8 {
+			log.Debug("Failed to decode journaled transaction", "hash", common.BytesToHash(k), "err", "entry too short")
+			pruned = append(pruned, common.CopyBytes(k))
+			return true, nil
+		}
 		tx := new(types.Transaction)
-		if err = stream.Decode(tx); err != nil {
-			if err != io.EOF {
-				failure = err
-			}
-			if batch.Len() > 0 {
-				loadBatch(batch)
-			}
-			break
+		if err := rlp.DecodeBytes(v[8:], tx); err != nil {
+			log.Debug("Failed to decode journaled transaction", "hash", common.BytesToHash(k), "err", err)
+			pruned = append(pruned, common.CopyBytes(k))
+			return true, nil
 		}
-		// New transaction parsed, queue up for later, import if threshold is reached
-		total++
-
-		if batch = append(batch, tx); batch.Len() > 1024 {
-			loadBatch(batch)
-			batch = batch[:0]
+		txs = append(txs, tx)
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range pruned {
+		if err := journal.db.Delete(dbutils.TxPoolJournal, k, nil); err != nil {
+			return err
 		}
 	}
-	log.Info("Loaded local transaction journal", "transactions", total, "dropped", dropped)
 
-	return failure
+	// Inject all transactions from the journal into the pool in small-ish batches
+	dropped := 0
+	for start := 0; start < len(txs); start += 1024 {
+		end := start + 1024
+		if end > len(txs) {
+			end = len(txs)
+		}
+		for _, err := range add(txs[start:end]) {
+			if err != nil {
+				log.Debug("Failed to add journaled transaction", "err", err)
+				dropped++
+			}
+		}
+	}
+	log.Info("Loaded local transaction journal", "transactions", len(txs), "dropped", dropped, "pruned", len(pruned))
+	return nil
 }
 
-// insert adds the specified transaction to the local disk journal.
+// insert adds the specified transaction to the local journal, it's written to
+// the database by the next flush.
 func (journal *txJournal) insert(tx *types.Transaction) error {
-	if journal.writer == nil {
-		return errNoActiveJournal
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+
+	if journal.loading {
+		return nil
 	}
-	if err := rlp.Encode(journal.writer, tx); err != nil {
-		return err
+	if !journal.active {
+		return errNoActiveJournal
 	}
+	journal.inserted[tx.Hash()] = tx
 	return nil
 }
 
-// rotate regenerates the transaction journal based on the current contents of
-// the transaction pool.
-func (journal *txJournal) rotate(all map[common.Address]types.Transactions) error {
-	// Close the current journal (if any is open)
-	if journal.writer != nil {
-		if err := journal.writer.Close(); err != nil {
+// flush writes the transactions inserted since the last flush into the database.
+func (journal *txJournal) flush() error {
+	journal.mu.Lock()
+	inserted := journal.inserted
+	journal.inserted = make(map[common.Hash]*types.Transaction)
+	journal.mu.Unlock()
+
+	if len(inserted) == 0 {
+		return nil
+	}
+	batch := journal.db.NewBatch()
+	defer batch.Rollback()
+	now := time.Now()
+	for hash, tx := range inserted {
+		v, err := encodeJournalEntry(tx, now)
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(dbutils.TxPoolJournal, common.CopyBytes(hash[:]), v); err != nil {
 			return err
 		}
-		journal.writer = nil
-	}
-	// Generate a new journal with the contents of the current pool
-	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return err
 	}
-	journaled := 0
+	return batch.Commit()
+}
+
+// rotate regenerates the transaction journal based on the current contents of
+// the transaction pool. The transactions which left the pool (e.g. mined or
+// replaced) and the ones older than the lifetime of the journal are pruned.
+func (journal *txJournal) rotate(all map[common.Address]types.Transactions) error {
+	journal.mu.Lock()
+	keep := journal.inserted
+	journal.inserted = make(map[common.Hash]*types.Transaction)
+	journal.active = true
+	journal.mu.Unlock()
+
 	for _, txs := range all {
 		for _, tx := range txs {
-			if err = rlp.Encode(replacement, tx); err != nil {
-				replacement.Close()
-				return err
-			}
+			keep[tx.Hash()] = tx
 		}
-		journaled += len(txs)
 	}
-	replacement.Close()
-
-	// Replace the live journal with the newly generated one
-	if err = os.Rename(journal.path+".new", journal.path); err != nil {
+	batch := journal.db.NewBatch()
+	defer batch.Rollback()
+
+	now := time.Now()
+	pruned := 0
+	if err := journal.db.Walk(dbutils.TxPoolJournal, nil, 0, func(k, v []byte) (bool, error) {
+		hash := common.BytesToHash(k)
+		_, ok := keep[hash]
+		if ok && !journal.expired(v, now) {
+			// Already journaled, the original time is kept
+			delete(keep, hash)
+			return true, nil
+		}
+		// Expired transactions stay in the pool, but are not journaled anymore
+		delete(keep, hash)
+		pruned++
+		return true, batch.Delete(dbutils.TxPoolJournal, k, nil)
+	}); err != nil {
 		return err
 	}
-	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
-	if err != nil {
+	for hash, tx := range keep {
+		v, err := encodeJournalEntry(tx, now)
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(dbutils.TxPoolJournal, common.CopyBytes(hash[:]), v); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
 		return err
 	}
-	journal.writer = sink
-	log.Info("Regenerated local transaction journal", "transactions", journaled, "accounts", len(all))
+	journaled := 0
+	for _, txs := range all {
+		journaled += len(txs)
+	}
+	log.Info("Regenerated local transaction journal", "transactions", journaled, "accounts", len(all), "pruned", pruned)
 
 	return nil
 }
 
-// close flushes the transaction journal contents to disk and closes the file.
+// close flushes the transaction journal contents to the database and deactivates it.
 func (journal *txJournal) close() error {
-	var err error
+	err := journal.flush()
 
-	if journal.writer != nil {
-		err = journal.writer.Close()
-		journal.writer = nil
-	}
+	journal.mu.Lock()
+	journal.active = false
+	journal.mu.Unlock()
 	return err
 }
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/u256"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Tests that the journal prunes the transactions which left the pool and the expired ones.
+func TestTransactionJournalPruning(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	tx0 := pricedTransaction(0, 100000, u256.Num1, key)
+	tx1 := pricedTransaction(1, 100000, u256.Num1, key)
+	tx2 := pricedTransaction(2, 100000, u256.Num1, key)
+
+	journal := newTxJournal(db, time.Hour)
+	if err := journal.insert(tx0); err != errNoActiveJournal {
+		t.Fatalf("insert into inactive journal: have %v, want %v", err, errNoActiveJournal)
+	}
+	if err := journal.rotate(map[common.Address]types.Transactions{from: {tx0, tx1}}); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	// Inserted transactions are only written on flush
+	if err := journal.insert(tx2); err != nil {
+		t.Fatalf("failed to insert transaction: %v", err)
+	}
+	if have := journaled(t, db); len(have) != 2 {
+		t.Fatalf("journaled transactions before flush: have %d, want 2", len(have))
+	}
+	if err := journal.close(); err != nil {
+		t.Fatalf("failed to close journal: %v", err)
+	}
+	if have := journaled(t, db); len(have) != 3 {
+		t.Fatalf("journaled transactions after flush: have %d, want 3", len(have))
+	}
+
+	// The mined transaction is pruned on rotation
+	if err := journal.rotate(map[common.Address]types.Transactions{from: {tx1, tx2}}); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	have := journaled(t, db)
+	if _, ok := have[tx0.Hash()]; ok || len(have) != 2 {
+		t.Fatalf("mined transaction is not pruned: %d transactions", len(have))
+	}
+
+	// All the transactions are loaded back
+	var loaded []*types.Transaction
+	add := func(txs []*types.Transaction) []error {
+		loaded = append(loaded, txs...)
+		return make([]error, len(txs))
+	}
+	if err := journal.load(add); err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if len(loaded) != 2 {
+		t.Fatalf("loaded transactions: have %d, want 2", len(loaded))
+	}
+
+	// Expired transactions are not loaded and pruned
+	journal = newTxJournal(db, time.Nanosecond)
+	time.Sleep(time.Second)
+	loaded = nil
+	if err := journal.load(add); err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if len(loaded) != 0 {
+		t.Fatalf("loaded expired transactions: have %d, want 0", len(loaded))
+	}
+	if have := journaled(t, db); len(have) != 0 {
+		t.Fatalf("expired transactions are not pruned: %d transactions", len(have))
+	}
+}
+
+func journaled(t *testing.T, db ethdb.Database) map[common.Hash]struct{} {
+	hashes := make(map[common.Hash]struct{})
+	if err := db.Walk(dbutils.TxPoolJournal, nil, 0, func(k, v []byte) (bool, error) {
+		hashes[common.BytesToHash(k)] = struct{}{}
+		return true, nil
+	}); err != nil {
+		t.Fatalf("failed to walk journal: %v", err)
+	}
+	return hashes
+}
@@ -355,6 +355,18 @@ func (l *txList) Cap(threshold int) types.Transactions {
 	return l.txs.Cap(threshold)
 }
 
+// CapSize places a hard limit on the total size of the items in bytes, returning
+// all transactions exceeding that limit. The lowest nonce'd transactions are kept.
+func (l *txList) CapSize(limit uint64) types.Transactions {
+	var size uint64
+	for i, tx := range l.txs.flatten() {
+		if size += uint64(tx.Size()); size > limit {
+			return l.txs.Cap(i)
+		}
+	}
+	return nil
+}
+
 // Remove deletes a transaction from the maintained list, returning whether the
 // transaction was found, and also returning any transaction invalidated due to
 // the deletion (strict mode only).
@@ -406,34 +418,51 @@ func (l *txList) LastElement() *types.Transaction {
 }
 
 // priceHeap is a heap.Interface implementation over transactions for retrieving
-// price-sorted transactions to discard when the pool fills up.
-type priceHeap []*types.Transaction
+// price-sorted transactions to discard when the pool fills up. The transactions are
+// sorted by the effective tip they pay with the base fee of the next block.
+type priceHeap struct {
+	baseFee *uint256.Int // Base fee of the next block, nil before EIP-1559, the heap is re-sorted when it changes
+	list    []*types.Transaction
+}
 
-func (h priceHeap) Len() int      { return len(h) }
-func (h priceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *priceHeap) Len() int      { return len(h.list) }
+func (h *priceHeap) Swap(i, j int) { h.list[i], h.list[j] = h.list[j], h.list[i] }
 
-func (h priceHeap) Less(i, j int) bool {
+func (h *priceHeap) Less(i, j int) bool {
 	// Sort primarily by price, returning the cheaper one
-	switch h[i].GasPriceCmp(h[j]) {
+	switch h.cmp(h.list[i], h.list[j]) {
 	case -1:
 		return true
 	case 1:
 		return false
 	}
 	// If the prices match, stabilize via nonces (high nonce is worse)
-	return h[i].Nonce() > h[j].Nonce()
+	return h.list[i].Nonce() > h.list[j].Nonce()
+}
+
+// cmp compares the transactions by the effective tip, then by the fee cap and the tip
+func (h *priceHeap) cmp(a, b *types.Transaction) int {
+	if h.baseFee != nil {
+		if c := a.EffectiveTipCmp(b, h.baseFee); c != 0 {
+			return c
+		}
+	}
+	if c := a.FeeCapCmp(b); c != 0 {
+		return c
+	}
+	return a.TipCmp(b)
 }
 
 func (h *priceHeap) Push(x interface{}) {
-	*h = append(*h, x.(*types.Transaction))
+	h.list = append(h.list, x.(*types.Transaction))
 }
 
 func (h *priceHeap) Pop() interface{} {
-	old := *h
+	old := h.list
 	n := len(old)
 	x := old[n-1]
 	old[n-1] = nil
-	*h = old[0 : n-1]
+	h.list = old[0 : n-1]
 	return x
 }
 
@@ -469,43 +498,19 @@ func (l *txPricedList) Put(tx *types.Transaction, local bool) {
 func (l *txPricedList) Removed(count int) {
 	// Bump the stale counter, but exit if still too low (< 25%)
 	l.stales += count
-	if l.stales <= len(*l.remotes)/4 {
+	if l.stales <= l.remotes.Len()/4 {
 		return
 	}
 	// Seems we've reached a critical number of stale transactions, reheap
 	l.Reheap()
 }
 
-// Cap finds all the transactions below the given price threshold, drops them
-// from the priced list and returns them for further removal from the entire pool.
-//
-// Note: only remote transactions will be considered for eviction.
-func (l *txPricedList) Cap(threshold *uint256.Int) types.Transactions {
-	drop := make(types.Transactions, 0, 128) // Remote underpriced transactions to drop
-	for len(*l.remotes) > 0 {
-		// Discard stale transactions if found during cleanup
-		cheapest := (*l.remotes)[0]
-		if l.all.GetRemote(cheapest.Hash()) == nil { // Removed or migrated
-			heap.Pop(l.remotes)
-			l.stales--
-			continue
-		}
-		// Stop the discards if we've reached the threshold
-		if cheapest.GasPriceIntCmp(threshold) >= 0 {
-			break
-		}
-		heap.Pop(l.remotes)
-		drop = append(drop, cheapest)
-	}
-	return drop
-}
-
 // Underpriced checks whether a transaction is cheaper than (or as cheap as) the
 // lowest priced (remote) transaction currently being tracked.
 func (l *txPricedList) Underpriced(tx *types.Transaction) bool {
 	// Discard stale price points if found at the heap start
-	for len(*l.remotes) > 0 {
-		head := []*types.Transaction(*l.remotes)[0]
+	for l.remotes.Len() > 0 {
+		head := l.remotes.list[0]
 		if l.all.GetRemote(head.Hash()) == nil { // Removed or migrated
 			l.stales--
 			heap.Pop(l.remotes)
@@ -514,13 +519,12 @@ func (l *txPricedList) Underpriced(tx *types.Transaction) bool {
 		break
 	}
 	// Check if the transaction is underpriced or not
-	if len(*l.remotes) == 0 {
+	if l.remotes.Len() == 0 {
 		return false // There is no remote transaction at all.
 	}
 	// If the remote transaction is even cheaper than the
 	// cheapest one tracked locally, reject it.
-	cheapest := []*types.Transaction(*l.remotes)[0]
-	return cheapest.GasPriceCmp(tx) >= 0
+	return l.remotes.cmp(l.remotes.list[0], tx) >= 0
 }
 
 // Discard finds a number of most underpriced transactions, removes them from the
@@ -529,7 +533,7 @@ func (l *txPricedList) Underpriced(tx *types.Transaction) bool {
 // Note local transaction won't be considered for eviction.
 func (l *txPricedList) Discard(slots int, force bool) (types.Transactions, bool) {
 	drop := make(types.Transactions, 0, slots) // Remote underpriced transactions to drop
-	for len(*l.remotes) > 0 && slots > 0 {
+	for l.remotes.Len() > 0 && slots > 0 {
 		// Discard stale transactions if found during cleanup
 		tx := heap.Pop(l.remotes).(*types.Transaction)
 		if l.all.GetRemote(tx.Hash()) == nil { // Removed or migrated
@@ -552,12 +556,19 @@ func (l *txPricedList) Discard(slots int, force bool) (types.Transactions, bool)
 
 // Reheap forcibly rebuilds the heap based on the current remote transaction set.
 func (l *txPricedList) Reheap() {
-	reheap := make(priceHeap, 0, l.all.RemoteCount())
+	reheap := &priceHeap{baseFee: l.remotes.baseFee, list: make([]*types.Transaction, 0, l.all.RemoteCount())}
 
-	l.stales, l.remotes = 0, &reheap
+	l.stales, l.remotes = 0, reheap
 	l.all.Range(func(hash common.Hash, tx *types.Transaction, local bool) bool {
-		*l.remotes = append(*l.remotes, tx)
+		l.remotes.list = append(l.remotes.list, tx)
 		return true
 	}, false, true) // Only iterate remotes
 	heap.Init(l.remotes)
 }
+
+// SetBaseFee updates the base fee of the next block the transactions are sorted with
+// and re-sorts them.
+func (l *txPricedList) SetBaseFee(baseFee *uint256.Int) {
+	l.remotes.baseFee = baseFee
+	l.Reheap()
+}
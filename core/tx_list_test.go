@@ -69,3 +69,47 @@ func BenchmarkTxListAdd(t *testing.B) {
 		list.Filter(priceLimit, DefaultTxPoolConfig.PriceBump)
 	}
 }
+
+// Tests that the priced list sorts the transactions by the effective tip with the base fee
+// of the next block, rather than by the gas price (the fee cap).
+func TestTxPricedListEffectiveTip(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	var (
+		legacy  = pricedTransaction(0, 100000, newInt(60), key)                 // Pays the tip of 20 with the base fee of 40
+		lowTip  = dynamicFeeTransaction(1, 100000, newInt(100), newInt(5), key) // Pays the tip of 5
+		highTip = dynamicFeeTransaction(2, 100000, newInt(50), newInt(30), key) // Pays the tip of 10
+	)
+	all := newTxLookup()
+	priced := newTxPricedList(all)
+	for _, tx := range []*types.Transaction{legacy, lowTip, highTip} {
+		all.Add(tx, false)
+		priced.Put(tx, false)
+	}
+	discard := func() []*types.Transaction {
+		drop, _ := priced.Discard(3, true)
+		for _, tx := range drop {
+			priced.Put(tx, false)
+		}
+		return drop
+	}
+	// Without the base fee the transactions are sorted by the fee cap
+	if drop := discard(); drop[0] != highTip || drop[1] != legacy || drop[2] != lowTip {
+		t.Errorf("wrong order without the base fee: %v", drop)
+	}
+	priced.SetBaseFee(newInt(40))
+	if drop := discard(); drop[0] != lowTip || drop[1] != highTip || drop[2] != legacy {
+		t.Errorf("wrong order with the base fee: %v", drop)
+	}
+	// The transactions which don't cover the base fee are the cheapest ones
+	priced.SetBaseFee(newInt(55))
+	if drop := discard(); drop[0] != highTip || drop[1] != legacy || drop[2] != lowTip {
+		t.Errorf("wrong order with the base fee above the fee cap: %v", drop)
+	}
+	priced.SetBaseFee(newInt(40))
+	if !priced.Underpriced(dynamicFeeTransaction(0, 100000, newInt(100), newInt(5), key)) {
+		t.Error("transaction with the price of the cheapest one is not underpriced")
+	}
+	if priced.Underpriced(dynamicFeeTransaction(0, 100000, newInt(46), newInt(6), key)) {
+		t.Error("transaction with the higher effective tip is underpriced")
+	}
+}
@@ -27,6 +27,8 @@ import (
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/prque"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -88,8 +90,9 @@ var (
 )
 
 var (
-	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
-	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
+	evictionInterval     = time.Minute     // Time interval to check for evictable transactions
+	statsReportInterval  = 8 * time.Second // Time interval to report transaction pool stats
+	journalFlushInterval = time.Second     // Time interval to write new local transactions into the journal
 )
 
 var (
@@ -133,7 +136,7 @@ const (
 type TxPoolConfig struct {
 	Locals    []common.Address // Addresses that should be treated by default as local
 	NoLocals  bool             // Whether local transaction handling should be disabled
-	Journal   string           // Journal of local transactions to survive node restarts
+	Journal   bool             // Whether to journal local transactions in the database to survive node restarts
 	Rejournal time.Duration    // Time interval to regenerate the local transaction journal
 
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
@@ -144,6 +147,8 @@ type TxPoolConfig struct {
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
+	AccountQueueSize uint64 // Maximum total size in bytes of the non-executable transactions permitted per account
+
 	Lifetime    time.Duration // Maximum amount of time non-executable transaction are queued
 	StartOnInit bool
 }
@@ -151,7 +156,7 @@ type TxPoolConfig struct {
 // DefaultTxPoolConfig contains the default configurations for the transaction
 // pool.
 var DefaultTxPoolConfig = TxPoolConfig{
-	Journal:   "transactions.rlp",
+	Journal:   true,
 	Rejournal: time.Hour,
 
 	PriceLimit: 1,
@@ -162,6 +167,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	AccountQueue: 64,
 	GlobalQueue:  1024,
 
+	AccountQueueSize: 16 * txSlotSize,
+
 	Lifetime: 3 * time.Hour,
 }
 
@@ -197,6 +204,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool global queue", "provided", conf.GlobalQueue, "updated", DefaultTxPoolConfig.GlobalQueue)
 		conf.GlobalQueue = DefaultTxPoolConfig.GlobalQueue
 	}
+	if conf.AccountQueueSize < txMaxSize {
+		log.Warn("Sanitizing invalid txpool account queue size", "provided", conf.AccountQueueSize, "updated", DefaultTxPoolConfig.AccountQueueSize)
+		conf.AccountQueueSize = DefaultTxPoolConfig.AccountQueueSize
+	}
 	if conf.Lifetime < 1 {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
@@ -226,6 +237,7 @@ type TxPool struct {
 
 	istanbul bool // Fork indicator whether we are in the istanbul stage.
 	eip2718  bool // Fork indicator whether we are using EIP-2718 type transactions.
+	eip1559  bool // Fork indicator whether we are using EIP-1559 type transactions.
 
 	pendingNonces *txNoncer              // Pending state tracking virtual nonces
 	currentState  *state.IntraBlockState // Current state in the blockchain head
@@ -254,6 +266,7 @@ type TxPool struct {
 
 type txpoolResetRequest struct {
 	oldHead, newHead *types.Header
+	accounts         *accountSet // Accounts to revalidate, nil to revalidate the whole pool
 }
 
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
@@ -301,8 +314,8 @@ func (pool *TxPool) Start(gasLimit uint64, headNumber uint64) error {
 	go pool.scheduleReorgLoop()
 
 	// If local transactions and journaling is enabled, load from disk
-	if !pool.config.NoLocals && pool.config.Journal != "" {
-		pool.journal = newTxJournal(pool.config.Journal)
+	if !pool.config.NoLocals && pool.config.Journal {
+		pool.journal = newTxJournal(pool.chaindb, pool.config.Lifetime)
 
 		if err := pool.journal.load(pool.AddLocals); err != nil {
 			log.Warn("Failed to load transaction journal", "err", err)
@@ -330,13 +343,15 @@ func (pool *TxPool) loop() {
 	var (
 		prevPending, prevQueued, prevStales int
 		// Start the stats reporting and transaction eviction tickers
-		report  = time.NewTicker(statsReportInterval)
-		evict   = time.NewTicker(evictionInterval)
-		journal = time.NewTicker(pool.config.Rejournal)
+		report       = time.NewTicker(statsReportInterval)
+		evict        = time.NewTicker(evictionInterval)
+		journal      = time.NewTicker(pool.config.Rejournal)
+		journalFlush = time.NewTicker(journalFlushInterval)
 	)
 	defer report.Stop()
 	defer evict.Stop()
 	defer journal.Stop()
+	defer journalFlush.Stop()
 
 	for {
 		select {
@@ -381,33 +396,70 @@ func (pool *TxPool) loop() {
 		case <-journal.C:
 			if pool.journal != nil {
 				pool.mu.Lock()
-				if err := pool.journal.rotate(pool.local()); err != nil {
+				local := pool.local()
+				pool.mu.Unlock()
+				if err := pool.journal.rotate(local); err != nil {
 					log.Warn("Failed to rotate local tx journal", "err", err)
 				}
-				pool.mu.Unlock()
+			}
+
+		// Write new local transactions into the journal
+		case <-journalFlush.C:
+			if pool.journal != nil {
+				if err := pool.journal.flush(); err != nil {
+					log.Warn("Failed to flush local tx journal", "err", err)
+				}
 			}
 		}
 	}
 }
 
-func (pool *TxPool) resetHead(blockGasLimit uint64, blockNumber uint64) {
+// resetHead switches the pool to the state of the new head, returning whether the
+// block gas limit went down compared to the previous head
+func (pool *TxPool) resetHead(blockGasLimit uint64, blockNumber uint64) bool {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 	pool.currentState = state.New(state.NewPlainStateReader(pool.chaindb))
 	pool.pendingNonces = newTxNoncer(pool.currentState)
+	lowered := blockGasLimit < pool.currentMaxGas
 	pool.currentMaxGas = blockGasLimit
 
 	// Update all fork indicator by next pending block number.
 	next := big.NewInt(int64(blockNumber + 1))
 	pool.istanbul = pool.chainconfig.IsIstanbul(next)
 	pool.eip2718 = pool.chainconfig.IsBerlin(next)
+	pool.eip1559 = pool.chainconfig.IsLondon(next)
+
+	// Sort the transactions by the effective tip with the base fee of the next block
+	var baseFee *uint256.Int
+	if pool.eip1559 {
+		if head := rawdb.ReadHeaderByNumber(pool.chaindb, blockNumber); head != nil {
+			baseFee, _ = uint256.FromBig(misc.CalcBaseFee(pool.chainconfig, head))
+		}
+	}
+	pool.priced.SetBaseFee(baseFee)
+	return lowered
 }
 
+// ResetHead switches the pool to the new head and revalidates all the transactions
 func (pool *TxPool) ResetHead(blockGasLimit uint64, blockNumber uint64) {
 	pool.resetHead(blockGasLimit, blockNumber)
 	<-pool.requestReset(nil, nil)
 }
 
+// ResetHeadAccounts switches the pool to the new head, revalidating only the transactions
+// of the accounts whose state changed since the previous head (taken from the account changesets).
+// The parked future transactions of those accounts are promoted once the nonce of the sender
+// advanced, the rest of the pool is left as is. If the block gas limit went down, it can invalidate
+// the transactions of any account, so the whole pool is revalidated like in ResetHead.
+func (pool *TxPool) ResetHeadAccounts(blockGasLimit uint64, blockNumber uint64, changed []common.Address) {
+	if pool.resetHead(blockGasLimit, blockNumber) {
+		<-pool.requestReset(nil, nil)
+		return
+	}
+	<-pool.requestResetAccounts(newAccountSet(pool.signer, changed...))
+}
+
 // Stop terminates the transaction pool.
 func (pool *TxPool) Stop() {
 	// Unsubscribe all subscriptions registered from txpool
@@ -420,7 +472,9 @@ func (pool *TxPool) Stop() {
 	pool.wg.Wait()
 
 	if pool.journal != nil {
-		pool.journal.close()
+		if err := pool.journal.close(); err != nil {
+			log.Warn("Failed to flush local tx journal", "err", err)
+		}
 	}
 
 	pool.isStarted = false
@@ -434,6 +488,11 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// Signer returns the signer the pool recovers the senders of the transactions with.
+func (pool *TxPool) Signer() types.Signer {
+	return pool.signer
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *uint256.Int {
 	pool.mu.RLock()
@@ -449,12 +508,45 @@ func (pool *TxPool) SetGasPrice(price *uint256.Int) {
 	defer pool.mu.Unlock()
 
 	pool.gasPrice = price
-	for _, tx := range pool.priced.Cap(price) {
-		pool.RemoveTx(tx.Hash(), false)
+	// The minimal price applies to the tip, which the priced list isn't sorted by
+	for _, tx := range pool.all.RemotesBelowTip(price) {
+		pool.removeTxLocked(tx.Hash(), false)
 	}
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// TxPoolLimits are the settings of the transaction pool which can be changed
+// while it runs.
+type TxPoolLimits struct {
+	AccountSlots uint64
+	GlobalSlots  uint64
+	AccountQueue uint64
+	GlobalQueue  uint64
+	Lifetime     time.Duration
+}
+
+// Limits returns the current limits of the transaction pool.
+func (pool *TxPool) Limits() TxPoolLimits {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return TxPoolLimits{pool.config.AccountSlots, pool.config.GlobalSlots, pool.config.AccountQueue, pool.config.GlobalQueue, pool.config.Lifetime}
+}
+
+// SetLimits updates the limits of the running transaction pool, the pool is
+// truncated to the new limits on the next promotion.
+func (pool *TxPool) SetLimits(limits TxPoolLimits) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	config := pool.config
+	config.AccountSlots, config.GlobalSlots, config.AccountQueue, config.GlobalQueue = limits.AccountSlots, limits.GlobalSlots, limits.AccountQueue, limits.GlobalQueue
+	config.Lifetime = limits.Lifetime
+	pool.config = config.sanitize()
+	log.Info("Transaction pool limits updated", "accountslots", pool.config.AccountSlots, "globalslots", pool.config.GlobalSlots,
+		"accountqueue", pool.config.AccountQueue, "globalqueue", pool.config.GlobalQueue, "lifetime", pool.config.Lifetime)
+}
+
 // Nonce returns the next nonce of an account, with all transactions executable
 // by the pool already applied on top.
 func (pool *TxPool) Nonce(addr common.Address) uint64 {
@@ -504,6 +596,23 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool, returning the
+// pending as well as queued transactions of this address, sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	var queued types.Transactions
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -551,6 +660,10 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if !pool.eip2718 && tx.Type() != types.LegacyTxType {
 		return ErrTxTypeNotSupported
 	}
+	// Reject dynamic fee transactions until EIP-1559 activates.
+	if !pool.eip1559 && tx.Type() == types.DynamicFeeTxType {
+		return ErrTxTypeNotSupported
+	}
 	// Reject transactions over defined size to prevent DOS attacks
 	if uint64(tx.Size()) > txMaxSize {
 		return ErrOversizedData
@@ -564,13 +677,17 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if pool.currentMaxGas < tx.Gas() {
 		return ErrGasLimit
 	}
+	// Ensure the tip doesn't exceed the fee cap, the rest of the fee cap is left for the base fee
+	if tx.FeeCap().Cmp(tx.Tip()) < 0 {
+		return ErrTipAboveFeeCap
+	}
 	// Make sure the transaction is signed properly.
 	from, err := types.Sender(pool.signer, tx)
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+	// Drop non-local transactions under our own minimal accepted gas price or tip
+	if !local && pool.gasPrice.Cmp(tx.Tip()) > 0 {
 		return ErrUnderpriced
 	}
 	// Ensure the transaction adheres to nonce ordering
@@ -987,7 +1104,18 @@ func (pool *TxPool) removeTxLocked(hash common.Hash, outofbound bool) {
 // The returned channel is closed when the reset has occurred.
 func (pool *TxPool) requestReset(oldHead *types.Header, newHead *types.Header) chan struct{} {
 	select {
-	case pool.reqResetCh <- &txpoolResetRequest{oldHead, newHead}:
+	case pool.reqResetCh <- &txpoolResetRequest{oldHead: oldHead, newHead: newHead}:
+		return <-pool.reorgDoneCh
+	case <-pool.reorgShutdownCh:
+		return pool.reorgShutdownCh
+	}
+}
+
+// requestResetAccounts requests a revalidation of the given accounts after a head change.
+// The returned channel is closed when the reset has occurred.
+func (pool *TxPool) requestResetAccounts(accounts *accountSet) chan struct{} {
+	select {
+	case pool.reqResetCh <- &txpoolResetRequest{accounts: accounts}:
 		return <-pool.reorgDoneCh
 	case <-pool.reorgShutdownCh:
 		return pool.reorgShutdownCh
@@ -1026,12 +1154,13 @@ func (pool *TxPool) scheduleReorgLoop() {
 		dirtyAccounts *accountSet
 		queuedEvents  = make(map[common.Address]*txSortedMap)
 		reset         bool
+		resetAccounts *accountSet // nil while resetting the whole pool
 	)
 	for {
 		// Launch next background reorg if needed
 		if curDone == nil && launchNextRun {
 			// Run the background reorg and announcements
-			go pool.runReorg(nextDone, dirtyAccounts, queuedEvents, reset)
+			go pool.runReorg(nextDone, dirtyAccounts, queuedEvents, reset, resetAccounts)
 
 			// Prepare everything for the next round of reorg
 			curDone, nextDone = nextDone, make(chan struct{})
@@ -1039,13 +1168,23 @@ func (pool *TxPool) scheduleReorgLoop() {
 
 			dirtyAccounts = nil
 			reset = false
+			resetAccounts = nil
 			queuedEvents = make(map[common.Address]*txSortedMap)
 		}
 
 		select {
 
-		case <-pool.reqResetCh:
+		case req := <-pool.reqResetCh:
 			// Reset request: update head if request is already pending.
+			// A reset of the whole pool absorbs the resets of the accounts.
+			switch {
+			case req.accounts == nil || (reset && resetAccounts == nil):
+				resetAccounts = nil
+			case resetAccounts == nil:
+				resetAccounts = req.accounts
+			default:
+				resetAccounts.merge(req.accounts)
+			}
 			reset = true
 			launchNextRun = true
 			pool.reorgDoneCh <- nextDone
@@ -1083,10 +1222,10 @@ func (pool *TxPool) scheduleReorgLoop() {
 }
 
 // runReorg runs reset and promoteExecutables on behalf of scheduleReorgLoop.
-func (pool *TxPool) runReorg(done chan struct{}, dirtyAccounts *accountSet, events map[common.Address]*txSortedMap, reset bool) {
+func (pool *TxPool) runReorg(done chan struct{}, dirtyAccounts *accountSet, events map[common.Address]*txSortedMap, reset bool, resetAccounts *accountSet) {
 	defer close(done)
 
-	var promoteAddrs []common.Address
+	var promoteAddrs, demoteAddrs []common.Address
 	if dirtyAccounts != nil && !reset {
 		// Only dirty accounts need to be promoted, unless we're resetting.
 		// For resets, all addresses in the tx queue will be promoted and
@@ -1102,10 +1241,24 @@ func (pool *TxPool) runReorg(done chan struct{}, dirtyAccounts *accountSet, even
 				delete(events, addr)
 			}
 		}
-		// Reset needs promote for all addresses
-		promoteAddrs = make([]common.Address, 0, len(pool.queue))
-		for addr := range pool.queue {
-			promoteAddrs = append(promoteAddrs, addr)
+		if resetAccounts == nil {
+			// Reset needs promote and demote for all addresses
+			promoteAddrs = make([]common.Address, 0, len(pool.queue))
+			for addr := range pool.queue {
+				promoteAddrs = append(promoteAddrs, addr)
+			}
+			demoteAddrs = make([]common.Address, 0, len(pool.pending))
+			for addr := range pool.pending {
+				demoteAddrs = append(demoteAddrs, addr)
+			}
+		} else {
+			// Only the accounts with the changed state can have transactions which became
+			// executable or invalid, plus the dirty accounts which sent new transactions
+			if dirtyAccounts != nil {
+				resetAccounts.merge(dirtyAccounts)
+			}
+			promoteAddrs = resetAccounts.intersect(pool.queue)
+			demoteAddrs = resetAccounts.intersect(pool.pending)
 		}
 	}
 	// Check for pending transactions for every account that sent new ones
@@ -1114,7 +1267,7 @@ func (pool *TxPool) runReorg(done chan struct{}, dirtyAccounts *accountSet, even
 	// remove any transaction that has been included in the block or was invalidated
 	// because of another transaction (e.g. higher gas price).
 	if reset {
-		pool.demoteUnexecutables()
+		pool.demoteUnexecutables(demoteAddrs)
 	}
 
 	// Ensure pool.queue and pool.pending sizes stay within the configured limits.
@@ -1189,6 +1342,9 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		var caps types.Transactions
 		if !pool.locals.contains(addr) {
 			caps = list.Cap(int(pool.config.AccountQueue))
+			// The parked transactions of an account also share a byte budget, so a few
+			// large future transactions can't hold as much memory as the full slot count
+			caps = append(caps, list.CapSize(pool.config.AccountQueueSize)...)
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
@@ -1346,9 +1502,13 @@ func (pool *TxPool) truncateQueue() {
 // demoteUnexecutables removes invalid and processed transactions from the pools
 // executable/pending queue and any subsequent transactions that become unexecutable
 // are moved back into the future queue.
-func (pool *TxPool) demoteUnexecutables() {
+func (pool *TxPool) demoteUnexecutables(accounts []common.Address) {
 	// Iterate over all accounts and demote any non-executable transactions
-	for addr, list := range pool.pending {
+	for _, addr := range accounts {
+		list := pool.pending[addr]
+		if list == nil {
+			continue // Just in case someone calls with a non existing account
+		}
 		nonce := pool.currentState.GetNonce(addr)
 
 		// Drop all transactions that are deemed too old (low nonce)
@@ -1550,6 +1710,26 @@ func (as *accountSet) merge(other *accountSet) {
 	as.cache = nil
 }
 
+// intersect returns the accounts of the set that have a transaction list in lists,
+// iterating over the smaller of the two.
+func (as *accountSet) intersect(lists map[common.Address]*txList) []common.Address {
+	var accounts []common.Address
+	if len(as.accounts) < len(lists) {
+		for addr := range as.accounts {
+			if _, ok := lists[addr]; ok {
+				accounts = append(accounts, addr)
+			}
+		}
+		return accounts
+	}
+	for addr := range lists {
+		if as.contains(addr) {
+			accounts = append(accounts, addr)
+		}
+	}
+	return accounts
+}
+
 // txLookup is used internally by Backend to track transactions while allowing lookup without
 // mutex contention.
 //
@@ -1644,6 +1824,18 @@ func (t *txLookup) LocalCount() int {
 }
 
 // RemoteCount returns the current number of remote transactions in the lookup.
+// RemotesBelowTip finds all remote transactions below the given tip threshold.
+func (t *txLookup) RemotesBelowTip(threshold *uint256.Int) types.Transactions {
+	var found types.Transactions
+	t.Range(func(hash common.Hash, tx *types.Transaction, local bool) bool {
+		if tx.Tip().Lt(threshold) {
+			found = append(found, tx)
+		}
+		return true
+	}, false, true) // Only iterate remotes
+	return found
+}
+
 func (t *txLookup) RemoteCount() int {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -20,10 +20,8 @@ import (
 	"context"
 	"crypto/ecdsa"
 	"fmt"
-	"io/ioutil"
 	"math/big"
 	"math/rand"
-	"os"
 	"runtime"
 	"testing"
 	"time"
@@ -32,6 +30,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/u256"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/crypto"
@@ -46,7 +45,7 @@ var testTxPoolConfig TxPoolConfig
 
 func init() {
 	testTxPoolConfig = DefaultTxPoolConfig
-	testTxPoolConfig.Journal = ""
+	testTxPoolConfig.Journal = false
 	testTxPoolConfig.StartOnInit = true
 }
 
@@ -266,6 +265,68 @@ func TestInvalidTransactions(t *testing.T) {
 	}
 }
 
+func dynamicFeeTransaction(nonce uint64, gaslimit uint64, feeCap, tip *uint256.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	chainID, _ := uint256.FromBig(params.TestChainConfig.ChainID)
+	tx, _ := types.SignNewTx(key, types.NewLondonSigner(params.TestChainConfig.ChainID), &types.DynamicFeeTx{
+		ChainID: chainID,
+		Nonce:   nonce,
+		Tip:     tip,
+		FeeCap:  feeCap,
+		Gas:     gaslimit,
+		To:      &common.Address{},
+		Value:   uint256.NewInt().SetUint64(100),
+	})
+	return tx
+}
+
+func TestDynamicFeeTransactions(t *testing.T) {
+	// Dynamic fee transactions are rejected before the London fork
+	pool, key, clear := setupTxPool()
+	tx := dynamicFeeTransaction(0, 100000, newInt(2), newInt(1), key)
+	if err := pool.AddRemote(tx); err == nil {
+		t.Error("expected dynamic fee transaction to be rejected before London")
+	}
+	clear()
+
+	diskdb := ethdb.NewMemDatabase()
+	defer diskdb.Close()
+	config := *params.TestChainConfig
+	config.LondonBlock = big.NewInt(0)
+	// The head used its gas target, the next block has the same base fee
+	head := &types.Header{Number: big.NewInt(0), GasLimit: 10000000, GasUsed: 5000000, BaseFee: big.NewInt(params.InitialBaseFee)}
+	rawdb.WriteHeader(context.Background(), diskdb, head)
+	if err := rawdb.WriteCanonicalHash(diskdb, head.Hash(), 0); err != nil {
+		t.Fatal(err)
+	}
+	txCacher := NewTxSenderCacher(runtime.NumCPU())
+	defer txCacher.Close()
+	pool = NewTxPool(testTxPoolConfig, &config, diskdb, txCacher)
+	//nolint:errcheck
+	pool.Start(1000000000, 0)
+	defer pool.Stop()
+	if baseFee := pool.priced.remotes.baseFee; baseFee == nil || baseFee.Uint64() != params.InitialBaseFee {
+		t.Errorf("transactions sorted with the base fee %v, want %d", baseFee, params.InitialBaseFee)
+	}
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, uint256.NewInt().SetUint64(0xffffffffffffff))
+
+	tx = dynamicFeeTransaction(0, 100000, newInt(1), newInt(2), key)
+	if err := pool.AddRemote(tx); err != ErrTipAboveFeeCap {
+		t.Error("expected", ErrTipAboveFeeCap, "got", err)
+	}
+	// The minimal gas price of the pool applies to the tip
+	pool.gasPrice = newInt(10)
+	tx = dynamicFeeTransaction(0, 100000, newInt(100), newInt(5), key)
+	if err := pool.AddRemote(tx); err != ErrUnderpriced {
+		t.Error("expected", ErrUnderpriced, "got", err)
+	}
+	tx = dynamicFeeTransaction(0, 100000, newInt(100), newInt(10), key)
+	if err := pool.AddRemote(tx); err != nil {
+		t.Error("expected", nil, "got", err)
+	}
+}
+
 func newInt(value int64) *uint256.Int {
 	v, _ := uint256.FromBig(big.NewInt(value))
 	return v
@@ -763,6 +824,87 @@ func TestTransactionQueueAccountLimiting(t *testing.T) {
 	}
 }
 
+// Tests that if the total size of the queued transactions of a single account goes
+// above the byte budget, the higher transactions are dropped even below the slot limit.
+func TestTransactionQueueAccountSizeLimiting(t *testing.T) {
+	// Create a test account and fund it
+	pool, key, clear := setupTxPool()
+	defer clear()
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(account, uint256.NewInt().SetUint64(params.Ether))
+
+	// Queue up large transactions, only the ones fitting into the budget are kept
+	size := uint64(3 * txSlotSize)
+	fit := int(testTxPoolConfig.AccountQueueSize / (size + 1024))
+	for i := 1; i <= fit+2; i++ {
+		if err := pool.addRemoteSync(pricedDataTransaction(uint64(i), 2000000, u256.Num1, key, size)); err != nil {
+			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
+		}
+	}
+	if pool.queue[account].Len() != fit {
+		t.Errorf("queue size mismatch: have %d, want %d", pool.queue[account].Len(), fit)
+	}
+	if nonce := pool.queue[account].LastElement().Nonce(); nonce != uint64(fit) {
+		t.Errorf("highest queued nonce mismatch: have %d, want %d", nonce, fit)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the parked future transactions are promoted once the changed state shows that
+// the nonce of the sender advanced, while the accounts without changes are not revalidated.
+func TestTransactionQueueResurrection(t *testing.T) {
+	pool, key, clear := setupTxPool()
+	defer clear()
+	keyB, _ := crypto.GenerateKey()
+	a, b := crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(keyB.PublicKey)
+
+	commitState := func(update func(ibs *state.IntraBlockState)) {
+		ibs := state.New(state.NewPlainStateReader(pool.chaindb))
+		update(ibs)
+		if err := ibs.CommitBlock(context.Background(), state.NewPlainStateWriter(pool.chaindb, nil, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitState(func(ibs *state.IntraBlockState) {
+		ibs.AddBalance(a, uint256.NewInt().SetUint64(params.Ether))
+		ibs.AddBalance(b, uint256.NewInt().SetUint64(params.Ether))
+	})
+	pool.ResetHeadAccounts(1000000000, 1, []common.Address{a, b})
+
+	// Park the future transactions of both accounts
+	if err := pool.addRemoteSync(transaction(1, 100000, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(transaction(1, 100000, keyB)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 2 {
+		t.Fatalf("pool stats mismatch: have %d/%d, want 0/2", pending, queued)
+	}
+	// The nonces of both accounts advance, but only the change of the first one is reported
+	commitState(func(ibs *state.IntraBlockState) {
+		ibs.SetNonce(a, 1)
+		ibs.SetNonce(b, 1)
+	})
+	pool.ResetHeadAccounts(1000000000, 2, []common.Address{a})
+	if pool.pending[a] == nil || pool.pending[a].Len() != 1 {
+		t.Errorf("transaction of the changed account not promoted")
+	}
+	if pool.queue[b] == nil || pool.queue[b].Len() != 1 {
+		t.Errorf("transaction of the unchanged account revalidated")
+	}
+	// A lower gas limit revalidates the whole pool
+	pool.ResetHeadAccounts(999999999, 3, nil)
+	if pending, queued := pool.Stats(); pending != 2 || queued != 0 {
+		t.Errorf("pool stats mismatch: have %d/%d, want 2/0", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // Tests that if the transaction count belonging to multiple accounts go above
 // some threshold, the higher transactions are dropped to prevent DOS attacks.
 //
@@ -990,6 +1132,36 @@ func TestTransactionPendingLimiting(t *testing.T) {
 	}
 }
 
+// Tests that the content of the pool can be retrieved for a single sender.
+func TestTransactionContentFrom(t *testing.T) {
+	pool, key, clear := setupTxPool()
+	defer clear()
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(account, uint256.NewInt().SetUint64(1000000))
+
+	other, _ := crypto.GenerateKey()
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), uint256.NewInt().SetUint64(1000000))
+
+	// Two executable and one gapped transaction of the account, one of another account
+	for _, tx := range []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key), transaction(3, 100000, key), transaction(0, 100000, other)} {
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	pending, queued := pool.ContentFrom(account)
+	if len(pending) != 2 || pending[0].Nonce() != 0 || pending[1].Nonce() != 1 {
+		t.Errorf("pending transactions mismatch: have %v", pending)
+	}
+	if len(queued) != 1 || queued[0].Nonce() != 3 {
+		t.Errorf("queued transactions mismatch: have %v", queued)
+	}
+
+	unknown, _ := crypto.GenerateKey()
+	if pending, queued = pool.ContentFrom(crypto.PubkeyToAddress(unknown.PublicKey)); len(pending) != 0 || len(queued) != 0 {
+		t.Errorf("unknown sender has transactions: pending %d, queued %d", len(pending), len(queued))
+	}
+}
+
 // Tests that if the transaction count belonging to multiple accounts go above
 // some hard threshold, the higher transactions are dropped to prevent DOS
 // attacks.
@@ -1717,31 +1889,19 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
-// Tests that local transactions are journaled to disk, but remote transactions
+// Tests that local transactions are journaled to the database, but remote transactions
 // get discarded between restarts.
 func TestTransactionJournaling(t *testing.T)         { testTransactionJournaling(t, false) }
 func TestTransactionJournalingNoLocals(t *testing.T) { testTransactionJournaling(t, true) }
 
 func testTransactionJournaling(t *testing.T, nolocals bool) {
-	// Create a temporary file for the journal
-	file, err := ioutil.TempFile("", "")
-	if err != nil {
-		t.Fatalf("failed to create temporary journal: %v", err)
-	}
-	journal := file.Name()
-	defer os.Remove(journal)
-
-	// Clean up the temporary file, we only need the path for now
-	file.Close()
-	os.Remove(journal)
-
 	// Create the original pool to inject transaction into the journal
 	db := ethdb.NewMemDatabase()
 	defer db.Close()
 
 	config := testTxPoolConfig
 	config.NoLocals = nolocals
-	config.Journal = journal
+	config.Journal = true
 	config.Rejournal = time.Second
 
 	txCacher := NewTxSenderCacher(runtime.NumCPU())
@@ -1965,7 +2125,7 @@ func benchmarkPendingDemotion(b *testing.B, size int) {
 	// Benchmark the speed of pool validation
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		pool.demoteUnexecutables()
+		pool.demoteUnexecutables([]common.Address{account})
 	}
 }
 
@@ -101,6 +101,8 @@ func (tx *AccessListTx) accessList() AccessList { return tx.AccessList }
 func (tx *AccessListTx) data() []byte           { return tx.Data }
 func (tx *AccessListTx) gas() uint64            { return tx.Gas }
 func (tx *AccessListTx) gasPrice() *uint256.Int { return tx.GasPrice }
+func (tx *AccessListTx) tip() *uint256.Int      { return tx.GasPrice }
+func (tx *AccessListTx) feeCap() *uint256.Int   { return tx.GasPrice }
 func (tx *AccessListTx) value() *uint256.Int    { return tx.Value }
 func (tx *AccessListTx) nonce() uint64          { return tx.Nonce }
 func (tx *AccessListTx) to() *common.Address    { return tx.To }
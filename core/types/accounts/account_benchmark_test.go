@@ -381,3 +381,30 @@ func BenchmarkIsEmptyRoot(b *testing.B) {
 
 	fmt.Fprint(ioutil.Discard, isEmpty)
 }
+
+func BenchmarkStorageViewIncarnation(b *testing.B) {
+	acc := &Account{
+		Nonce:       2,
+		Balance:     *new(uint256.Int).SetUint64(1000),
+		Incarnation: 1,
+		CodeHash:    common.BytesToHash(crypto.Keccak256([]byte{1, 2, 3})),
+	}
+	encodedAccount := make([]byte, acc.EncodingLengthForStorage())
+	acc.EncodeForStorage(encodedAccount)
+
+	b.Run("Decode", func(b *testing.B) {
+		var decodedAccount Account
+		for i := 0; i < b.N; i++ {
+			if err := decodedAccount.DecodeForStorage(encodedAccount); err != nil {
+				b.Fatal("cant decode the account", err, encodedAccount)
+			}
+		}
+	})
+	b.Run("View", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := StorageView(encodedAccount).Incarnation(); err != nil {
+				b.Fatal("cant decode the incarnation", err, encodedAccount)
+			}
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package accounts
+
+import (
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// The bits of the fieldset of the storage encoding, in the order of the fields
+const (
+	fieldNonce       byte = 1
+	fieldBalance     byte = 2
+	fieldIncarnation byte = 4
+	fieldCodeHash    byte = 8
+)
+
+var fieldNames = [...]string{
+	fieldNonce:       "Nonce",
+	fieldBalance:     "Balance",
+	fieldIncarnation: "Incarnation",
+	fieldCodeHash:    "CodeHash",
+}
+
+// StorageView is the account in the storage encoding of EncodeForStorage, whose fields are decoded on demand. The
+// walks of the state and the stages mostly read the incarnation or the code hash of every account, the view reads
+// them without decoding the rest. The view points at the encoding, it is valid as long as the encoding is
+type StorageView []byte
+
+// field returns the bytes of the field, nil if the field is not set
+func (v StorageView) field(field byte) ([]byte, error) {
+	if len(v) == 0 || v[0]&field == 0 {
+		return nil, nil
+	}
+	pos := 1
+	for f := fieldNonce; f <= field; f <<= 1 {
+		if v[0]&f == 0 {
+			continue
+		}
+		if pos >= len(v) {
+			return nil, fmt.Errorf("malformed CBOR for Account.%s: no length", fieldNames[f])
+		}
+		decodeLength := int(v[pos])
+		if len(v) < pos+decodeLength+1 {
+			return nil, fmt.Errorf(
+				"malformed CBOR for Account.%s: %s, Length %d",
+				fieldNames[f], v[pos+1:], decodeLength)
+		}
+		if f == field {
+			return v[pos+1 : pos+decodeLength+1], nil
+		}
+		pos += decodeLength + 1
+	}
+	return nil, nil
+}
+
+func (v StorageView) Nonce() (uint64, error) {
+	enc, err := v.field(fieldNonce)
+	if err != nil {
+		return 0, err
+	}
+	return bytesToUint64(enc), nil
+}
+
+func (v StorageView) Balance() (uint256.Int, error) {
+	var balance uint256.Int
+	enc, err := v.field(fieldBalance)
+	if err != nil {
+		return balance, err
+	}
+	balance.SetBytes(enc)
+	return balance, nil
+}
+
+func (v StorageView) Incarnation() (uint64, error) {
+	enc, err := v.field(fieldIncarnation)
+	if err != nil {
+		return 0, err
+	}
+	return bytesToUint64(enc), nil
+}
+
+// CodeHash returns the code hash of the account, the hash of the empty code if it has no code
+func (v StorageView) CodeHash() (common.Hash, error) {
+	enc, err := v.field(fieldCodeHash)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if enc == nil {
+		return emptyCodeHash, nil
+	}
+	if len(enc) != 32 {
+		return common.Hash{}, fmt.Errorf("codehash should be 32 bytes long, got %d instead", len(enc))
+	}
+	return common.BytesToHash(enc), nil
+}
+
+func (v StorageView) IsEmptyCodeHash() (bool, error) {
+	codeHash, err := v.CodeHash()
+	if err != nil {
+		return false, err
+	}
+	return codeHash == emptyCodeHash || codeHash == (common.Hash{}), nil
+}
+
+// Decode decodes all the fields of the account
+func (v StorageView) Decode(a *Account) error {
+	return a.DecodeForStorage(v)
+}
@@ -0,0 +1,74 @@
+package accounts
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+func TestStorageView(t *testing.T) {
+	codeHash := common.HexToHash("0x0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	for i, a := range []Account{
+		{},
+		{Nonce: 1},
+		{Balance: *uint256.NewInt().SetUint64(1000000)},
+		{Incarnation: 2},
+		{CodeHash: codeHash},
+		{Nonce: 1 << 40, Incarnation: 300, CodeHash: codeHash},
+		{Nonce: 100, Balance: *uint256.NewInt().Lsh(uint256.NewInt().SetOne(), 200), Incarnation: 1, CodeHash: emptyCodeHash},
+	} {
+		enc := make([]byte, a.EncodingLengthForStorage())
+		a.EncodeForStorage(enc)
+		var want Account
+		if err := want.DecodeForStorage(enc); err != nil {
+			t.Fatal(err)
+		}
+
+		v := StorageView(enc)
+		nonce, err := v.Nonce()
+		if err != nil || nonce != want.Nonce {
+			t.Errorf("account %d: nonce %d, %v instead of %d", i, nonce, err, want.Nonce)
+		}
+		balance, err := v.Balance()
+		if err != nil || balance.Cmp(&want.Balance) != 0 {
+			t.Errorf("account %d: balance %d, %v instead of %d", i, &balance, err, &want.Balance)
+		}
+		incarnation, err := v.Incarnation()
+		if err != nil || incarnation != want.Incarnation {
+			t.Errorf("account %d: incarnation %d, %v instead of %d", i, incarnation, err, want.Incarnation)
+		}
+		hash, err := v.CodeHash()
+		if err != nil || hash != want.CodeHash {
+			t.Errorf("account %d: code hash %x, %v instead of %x", i, hash, err, want.CodeHash)
+		}
+		empty, err := v.IsEmptyCodeHash()
+		if err != nil || empty != want.IsEmptyCodeHash() {
+			t.Errorf("account %d: empty code hash %t, %v", i, empty, err)
+		}
+	}
+
+	if _, err := StorageView(nil).Incarnation(); err != nil {
+		t.Errorf("the empty encoding: %v", err)
+	}
+}
+
+func TestStorageViewMalformed(t *testing.T) {
+	a := Account{Nonce: 1000, Incarnation: 1, CodeHash: common.HexToHash("0x01")}
+	enc := make([]byte, a.EncodingLengthForStorage())
+	a.EncodeForStorage(enc)
+	// The truncated nonce is found by the reads of the later fields
+	v := StorageView(enc[:2])
+	if _, err := v.Incarnation(); err == nil {
+		t.Error("expected the error of the truncated nonce")
+	}
+	// The fields before the truncated one are read
+	v = StorageView(enc[:len(enc)-1])
+	if incarnation, err := v.Incarnation(); err != nil || incarnation != 1 {
+		t.Errorf("incarnation %d, %v", incarnation, err)
+	}
+	if _, err := v.CodeHash(); err == nil {
+		t.Error("expected the error of the truncated code hash")
+	}
+}
@@ -19,6 +19,7 @@ package types
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -83,12 +84,89 @@ type Header struct {
 	Extra       []byte         `json:"extraData"        gencodec:"required"`
 	MixDigest   common.Hash    `json:"mixHash"`
 	Nonce       BlockNonce     `json:"nonce"`
+
+	// BaseFee was added by EIP-1559 and is ignored in legacy headers.
+	BaseFee *big.Int `json:"baseFeePerGas" rlp:"optional"`
+
+	// Seal are the seal fields of the engines which don't seal with the MixDigest and the Nonce, e.g. the step and
+	// the signature of AuRa. When set, they are encoded in place of the MixDigest and the Nonce
+	Seal []rlp.RawValue `json:"-" rlp:"-"`
+}
+
+// headerSealFields is the number of the fields of the Seal, the AuRa step and signature
+const headerSealFields = 2
+
+// headerRLP is the encoding of the headers sealed with the MixDigest and the Nonce
+type headerRLP Header
+
+// EncodeRLP encodes the header with the Seal fields in place of the MixDigest and the Nonce when it has them. It has
+// the value receiver for the headers encoded by value
+func (h Header) EncodeRLP(w io.Writer) error {
+	if h.Seal == nil {
+		return rlp.Encode(w, (*headerRLP)(&h))
+	}
+	fields := []interface{}{h.ParentHash, h.UncleHash, h.Coinbase, h.Root, h.TxHash, h.ReceiptHash, h.Bloom,
+		h.Difficulty, h.Number, h.GasLimit, h.GasUsed, h.Time, h.Extra}
+	for _, f := range h.Seal {
+		fields = append(fields, f)
+	}
+	if h.BaseFee != nil {
+		fields = append(fields, h.BaseFee)
+	}
+	return rlp.Encode(w, fields)
+}
+
+// DecodeRLP decodes the header, telling the Seal fields apart from the MixDigest and the Nonce by the size of the
+// field after the Extra: the MixDigest is the string of 32 bytes, the step of AuRa is at most 8 bytes
+func (h *Header) DecodeRLP(s *rlp.Stream) error {
+	if _, err := s.List(); err != nil {
+		return err
+	}
+	var dec Header
+	for _, f := range []interface{}{&dec.ParentHash, &dec.UncleHash, &dec.Coinbase, &dec.Root, &dec.TxHash,
+		&dec.ReceiptHash, &dec.Bloom, &dec.Difficulty, &dec.Number, &dec.GasLimit, &dec.GasUsed, &dec.Time, &dec.Extra} {
+		if err := s.Decode(f); err != nil {
+			return err
+		}
+	}
+	_, size, err := s.Kind()
+	if err != nil {
+		return err
+	}
+	if size == common.HashLength {
+		if err = s.Decode(&dec.MixDigest); err != nil {
+			return err
+		}
+		if err = s.Decode(&dec.Nonce); err != nil {
+			return err
+		}
+	} else {
+		dec.Seal = make([]rlp.RawValue, headerSealFields)
+		for i := range dec.Seal {
+			if dec.Seal[i], err = s.Raw(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, _, err = s.Kind(); err == nil {
+		if err = s.Decode(&dec.BaseFee); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, rlp.EOL) {
+		return err
+	}
+	if err = s.ListEnd(); err != nil {
+		return err
+	}
+	*h = dec
+	return nil
 }
 
 // field type overrides for gencodec
 type headerMarshaling struct {
 	Difficulty *hexutil.Big
 	Number     *hexutil.Big
+	BaseFee    *hexutil.Big
 	GasLimit   hexutil.Uint64
 	GasUsed    hexutil.Uint64
 	Time       hexutil.Uint64
@@ -119,10 +197,20 @@ func (h *Header) SanityCheck() error {
 		return fmt.Errorf("too large block number: bitlen %d", h.Number.BitLen())
 	}
 	if h.Difficulty != nil {
-		if diffLen := h.Difficulty.BitLen(); diffLen > 80 {
+		// The score of AuRa in the difficulty is close to 2^128
+		maxDiffLen := 80
+		if h.Seal != nil {
+			maxDiffLen = 129
+		}
+		if diffLen := h.Difficulty.BitLen(); diffLen > maxDiffLen {
 			return fmt.Errorf("too large block difficulty: bitlen %d", diffLen)
 		}
 	}
+	if h.BaseFee != nil {
+		if bfLen := h.BaseFee.BitLen(); bfLen > 256 {
+			return fmt.Errorf("too large base fee: bitlen %d", bfLen)
+		}
+	}
 	if eLen := len(h.Extra); eLen > 100*1024 {
 		return fmt.Errorf("too large block extradata: size %d", eLen)
 	}
@@ -279,10 +367,19 @@ func CopyHeader(h *Header) *Header {
 	if cpy.Number = new(big.Int); h.Number != nil {
 		cpy.Number.Set(h.Number)
 	}
+	if h.BaseFee != nil {
+		cpy.BaseFee = new(big.Int).Set(h.BaseFee)
+	}
 	if len(h.Extra) > 0 {
 		cpy.Extra = make([]byte, len(h.Extra))
 		copy(cpy.Extra, h.Extra)
 	}
+	if h.Seal != nil {
+		cpy.Seal = make([]rlp.RawValue, len(h.Seal))
+		for i, f := range h.Seal {
+			cpy.Seal[i] = common.CopyBytes(f)
+		}
+	}
 	return &cpy
 }
 
@@ -349,6 +446,14 @@ func (b *Block) ReceiptHash() common.Hash { return b.header.ReceiptHash }
 func (b *Block) UncleHash() common.Hash   { return b.header.UncleHash }
 func (b *Block) Extra() []byte            { return common.CopyBytes(b.header.Extra) }
 
+// BaseFee returns the EIP-1559 base fee of the block, or nil for the blocks before London.
+func (b *Block) BaseFee() *big.Int {
+	if b.header.BaseFee == nil {
+		return nil
+	}
+	return new(big.Int).Set(b.header.BaseFee)
+}
+
 func (b *Block) Header() *Header { return CopyHeader(b.header) }
 
 // Body returns the non-header content of the block.
@@ -132,6 +132,89 @@ func TestEIP2718BlockEncoding(t *testing.T) {
 	}
 }
 
+// Tests that the base fee is encoded only in the headers which have it, so that the
+// hashes of the legacy headers don't change.
+func TestHeaderBaseFeeEncoding(t *testing.T) {
+	legacy := &Header{Difficulty: big.NewInt(131072), Number: big.NewInt(1), GasLimit: 3141592, Extra: []byte("test")}
+	enc, err := rlp.EncodeToBytes(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec Header
+	if err = rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.BaseFee != nil {
+		t.Errorf("legacy header decoded with base fee %v", dec.BaseFee)
+	}
+	if dec.Hash() != legacy.Hash() {
+		t.Errorf("legacy header hash mismatch: have %x, want %x", dec.Hash(), legacy.Hash())
+	}
+
+	london := CopyHeader(legacy)
+	london.BaseFee = big.NewInt(params.InitialBaseFee)
+	if london.Hash() == legacy.Hash() {
+		t.Fatal("base fee is not included in the header hash")
+	}
+	if enc, err = rlp.EncodeToBytes(london); err != nil {
+		t.Fatal(err)
+	}
+	dec = Header{}
+	if err = rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.BaseFee == nil || dec.BaseFee.Cmp(london.BaseFee) != 0 {
+		t.Errorf("wrong base fee: have %v, want %v", dec.BaseFee, london.BaseFee)
+	}
+	if dec.Hash() != london.Hash() {
+		t.Errorf("header hash mismatch: have %x, want %x", dec.Hash(), london.Hash())
+	}
+}
+
+func TestHeaderSealEncoding(t *testing.T) {
+	step, _ := rlp.EncodeToBytes(uint64(322697893))
+	signature, _ := rlp.EncodeToBytes(bytes.Repeat([]byte{0xab}, 65))
+	sealed := &Header{Difficulty: big.NewInt(131072), Number: big.NewInt(1), GasLimit: 3141592, Extra: []byte("test"),
+		Seal: []rlp.RawValue{step, signature}}
+	for _, baseFee := range []*big.Int{nil, big.NewInt(params.InitialBaseFee)} {
+		sealed.BaseFee = baseFee
+		enc, err := rlp.EncodeToBytes(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dec Header
+		if err = rlp.DecodeBytes(enc, &dec); err != nil {
+			t.Fatal(err)
+		}
+		if len(dec.Seal) != 2 || !bytes.Equal(dec.Seal[0], step) || !bytes.Equal(dec.Seal[1], signature) {
+			t.Errorf("wrong seal: have %x", dec.Seal)
+		}
+		if (dec.BaseFee == nil) != (baseFee == nil) || (baseFee != nil && dec.BaseFee.Cmp(baseFee) != 0) {
+			t.Errorf("wrong base fee: have %v, want %v", dec.BaseFee, baseFee)
+		}
+		if dec.Hash() != sealed.Hash() {
+			t.Errorf("header hash mismatch: have %x, want %x", dec.Hash(), sealed.Hash())
+		}
+	}
+
+	unsealed := CopyHeader(sealed)
+	unsealed.Seal = nil
+	if unsealed.Hash() == sealed.Hash() {
+		t.Fatal("seal is not included in the header hash")
+	}
+
+	// The fields after the seal and the base fee are rejected
+	sealed.Seal = append(sealed.Seal, step)
+	enc, err := rlp.EncodeToBytes(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec Header
+	if err = rlp.DecodeBytes(enc, &dec); err == nil {
+		t.Fatal("decoded the header with an extra field")
+	}
+}
+
 func TestUncleHash(t *testing.T) {
 	uncles := make([]*Header, 0)
 	h := CalcUncleHash(uncles)
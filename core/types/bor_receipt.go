@@ -0,0 +1,54 @@
+package types
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// borReceiptPrefix is the prefix of the key deriving the hash of the system transaction of a bor block
+var borReceiptPrefix = []byte("matic-bor-receipt-")
+
+// ComputeBorTxHash returns the hash of the system transaction committing the state sync events of the bor block. The
+// transaction isn't in the body, the hash is derived from the block, as bor does
+func ComputeBorTxHash(number uint64, hash common.Hash) common.Hash {
+	key := make([]byte, len(borReceiptPrefix)+8+common.HashLength)
+	copy(key, borReceiptPrefix)
+	binary.BigEndian.PutUint64(key[len(borReceiptPrefix):], number)
+	copy(key[len(borReceiptPrefix)+8:], hash[:])
+	return crypto.Keccak256Hash(key)
+}
+
+// NewBorReceipt returns the receipt of the system transaction of the bor block with the logs of the state sync
+// events, following the receipts of the transactions of the block. It uses no gas and its logs continue the indices
+// of the logs of the block
+func NewBorReceipt(number uint64, hash common.Hash, receipts Receipts, logs []*Log) *Receipt {
+	txHash := ComputeBorTxHash(number, hash)
+	receipt := &Receipt{
+		Status:           ReceiptStatusSuccessful,
+		Logs:             logs,
+		TxHash:           txHash,
+		BlockHash:        hash,
+		BlockNumber:      new(big.Int).SetUint64(number),
+		TransactionIndex: uint(len(receipts)),
+	}
+	var logIndex uint
+	for _, r := range receipts {
+		logIndex += uint(len(r.Logs))
+	}
+	if len(receipts) > 0 {
+		receipt.CumulativeGasUsed = receipts[len(receipts)-1].CumulativeGasUsed
+	}
+	for _, l := range logs {
+		l.BlockNumber = number
+		l.BlockHash = hash
+		l.TxHash = txHash
+		l.TxIndex = receipt.TransactionIndex
+		l.Index = logIndex
+		logIndex++
+	}
+	receipt.Bloom = CreateBloom(Receipts{receipt})
+	return receipt
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// DynamicFeeTx is the data of EIP-1559 dynamic fee transactions.
+type DynamicFeeTx struct {
+	ChainID    *uint256.Int    // destination chain ID
+	Nonce      uint64          // nonce of sender account
+	Tip        *uint256.Int    // maximum priority fee per gas paid to the miner (maxPriorityFeePerGas)
+	FeeCap     *uint256.Int    // maximum total fee per gas, including the base fee (maxFeePerGas)
+	Gas        uint64          // gas limit
+	To         *common.Address `rlp:"nil"` // nil means contract creation
+	Value      *uint256.Int    // wei amount
+	Data       []byte          // contract invocation input data
+	AccessList AccessList      // EIP-2930 access list
+	V, R, S    *uint256.Int    // signature values
+}
+
+// copy creates a deep copy of the transaction data and initializes all fields.
+func (tx *DynamicFeeTx) copy() TxData {
+	cpy := &DynamicFeeTx{
+		Nonce: tx.Nonce,
+		To:    tx.To, // TODO: copy pointed-to address
+		Data:  common.CopyBytes(tx.Data),
+		Gas:   tx.Gas,
+		// These are copied below.
+		AccessList: make(AccessList, len(tx.AccessList)),
+		Value:      new(uint256.Int),
+		ChainID:    new(uint256.Int),
+		Tip:        new(uint256.Int),
+		FeeCap:     new(uint256.Int),
+		V:          new(uint256.Int),
+		R:          new(uint256.Int),
+		S:          new(uint256.Int),
+	}
+	copy(cpy.AccessList, tx.AccessList)
+	if tx.Value != nil {
+		cpy.Value.Set(tx.Value)
+	}
+	if tx.ChainID != nil {
+		cpy.ChainID.Set(tx.ChainID)
+	}
+	if tx.Tip != nil {
+		cpy.Tip.Set(tx.Tip)
+	}
+	if tx.FeeCap != nil {
+		cpy.FeeCap.Set(tx.FeeCap)
+	}
+	if tx.V != nil {
+		cpy.V.Set(tx.V)
+	}
+	if tx.R != nil {
+		cpy.R.Set(tx.R)
+	}
+	if tx.S != nil {
+		cpy.S.Set(tx.S)
+	}
+	return cpy
+}
+
+// accessors for innerTx.
+
+func (tx *DynamicFeeTx) txType() byte           { return DynamicFeeTxType }
+func (tx *DynamicFeeTx) chainID() *uint256.Int  { return tx.ChainID }
+func (tx *DynamicFeeTx) protected() bool        { return true } //nolint:unused
+func (tx *DynamicFeeTx) accessList() AccessList { return tx.AccessList }
+func (tx *DynamicFeeTx) data() []byte           { return tx.Data }
+func (tx *DynamicFeeTx) gas() uint64            { return tx.Gas }
+func (tx *DynamicFeeTx) gasPrice() *uint256.Int { return tx.FeeCap }
+func (tx *DynamicFeeTx) tip() *uint256.Int      { return tx.Tip }
+func (tx *DynamicFeeTx) feeCap() *uint256.Int   { return tx.FeeCap }
+func (tx *DynamicFeeTx) value() *uint256.Int    { return tx.Value }
+func (tx *DynamicFeeTx) nonce() uint64          { return tx.Nonce }
+func (tx *DynamicFeeTx) to() *common.Address    { return tx.To }
+
+func (tx *DynamicFeeTx) rawSignatureValues() (v, r, s *uint256.Int) {
+	return tx.V, tx.R, tx.S
+}
+
+func (tx *DynamicFeeTx) setSignatureValues(chainID, v, r, s *uint256.Int) {
+	tx.ChainID, tx.V, tx.R, tx.S = chainID, v, r, s
+}
@@ -97,6 +97,8 @@ func (tx *LegacyTx) accessList() AccessList { return nil }
 func (tx *LegacyTx) data() []byte           { return tx.Data }
 func (tx *LegacyTx) gas() uint64            { return tx.Gas }
 func (tx *LegacyTx) gasPrice() *uint256.Int { return tx.GasPrice }
+func (tx *LegacyTx) tip() *uint256.Int      { return tx.GasPrice }
+func (tx *LegacyTx) feeCap() *uint256.Int   { return tx.GasPrice }
 func (tx *LegacyTx) value() *uint256.Int    { return tx.Value }
 func (tx *LegacyTx) nonce() uint64          { return tx.Nonce }
 func (tx *LegacyTx) to() *common.Address    { return tx.To }
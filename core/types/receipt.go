@@ -141,7 +141,7 @@ func (r *Receipt) EncodeRLP(w io.Writer) error {
 		return rlp.Encode(w, data)
 	}
 	// It's an EIP-2718 typed TX receipt.
-	if r.Type != AccessListTxType {
+	if r.Type != AccessListTxType && r.Type != DynamicFeeTxType {
 		return ErrTxTypeNotSupported
 	}
 	buf := new(bytes.Buffer)
@@ -177,7 +177,7 @@ func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
 			return errEmptyTypedReceipt
 		}
 		r.Type = b[0]
-		if r.Type == AccessListTxType {
+		if r.Type == AccessListTxType || r.Type == DynamicFeeTxType {
 			var dec receiptRLP
 			if err := rlp.DecodeBytes(b[1:], &dec); err != nil {
 				return err
@@ -342,9 +342,9 @@ func (rs Receipts) EncodeIndex(i int, w *bytes.Buffer) {
 		if err := rlp.Encode(w, data); err != nil {
 			panic(err)
 		}
-	case AccessListTxType:
+	case AccessListTxType, DynamicFeeTxType:
 		//nolint:errcheck
-		w.WriteByte(AccessListTxType)
+		w.WriteByte(r.Type)
 		if err := rlp.Encode(w, data); err != nil {
 			panic(err)
 		}
@@ -279,6 +279,32 @@ func TestTypedReceiptEncodingDecoding(t *testing.T) {
 	}
 }
 
+func TestDynamicFeeReceiptEncodingDecoding(t *testing.T) {
+	receipt := &Receipt{
+		Type:              DynamicFeeTxType,
+		Status:            ReceiptStatusSuccessful,
+		CumulativeGasUsed: 21000,
+		Logs:              []*Log{},
+	}
+	enc, err := rlp.EncodeToBytes(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dec Receipt
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.Type != DynamicFeeTxType || dec.Status != ReceiptStatusSuccessful || dec.CumulativeGasUsed != 21000 {
+		t.Fatalf("decoded receipt mismatch: type %d, status %d, cumulative gas %d", dec.Type, dec.Status, dec.CumulativeGasUsed)
+	}
+	// The consensus encoding used for the receipts root is prefixed with the type
+	var buf bytes.Buffer
+	Receipts{receipt}.EncodeIndex(0, &buf)
+	if buf.Len() == 0 || buf.Bytes()[0] != DynamicFeeTxType {
+		t.Fatalf("receipt not prefixed with its type: %x", buf.Bytes())
+	}
+}
+
 func clearComputedFieldsOnReceipts(t *testing.T, receipts Receipts) {
 	t.Helper()
 
@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"container/heap"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +37,7 @@ var (
 	ErrUnexpectedProtection = errors.New("transaction type does not supported EIP-155 protected signatures")
 	ErrInvalidTxType        = errors.New("transaction type not valid in this context")
 	ErrTxTypeNotSupported   = errors.New("transaction type not supported")
+	ErrFeeCapTooLow         = errors.New("fee cap less than base fee")
 	errEmptyTypedTx         = errors.New("empty typed transaction bytes")
 )
 
@@ -42,6 +45,7 @@ var (
 const (
 	LegacyTxType = iota
 	AccessListTxType
+	DynamicFeeTxType
 )
 
 // Transaction is an Ethereum transaction.
@@ -64,7 +68,7 @@ func NewTx(inner TxData) *Transaction {
 
 // TxData is the underlying data of a transaction.
 //
-// This is implemented by LegacyTx and AccessListTx.
+// This is implemented by LegacyTx, AccessListTx and DynamicFeeTx.
 type TxData interface {
 	txType() byte // returns the type ID
 	copy() TxData // creates a deep copy and initializes all fields
@@ -74,6 +78,8 @@ type TxData interface {
 	data() []byte
 	gas() uint64
 	gasPrice() *uint256.Int
+	tip() *uint256.Int
+	feeCap() *uint256.Int
 	value() *uint256.Int
 	nonce() uint64
 	to() *common.Address
@@ -175,6 +181,10 @@ func (tx *Transaction) decodeTyped(b []byte) (TxData, error) {
 		var inner AccessListTx
 		err := rlp.DecodeBytes(b[1:], &inner)
 		return &inner, err
+	case DynamicFeeTxType:
+		var inner DynamicFeeTx
+		err := rlp.DecodeBytes(b[1:], &inner)
+		return &inner, err
 	default:
 		return nil, ErrTxTypeNotSupported
 	}
@@ -255,9 +265,36 @@ func (tx *Transaction) AccessList() AccessList { return tx.inner.accessList() }
 // Gas returns the gas limit of the transaction.
 func (tx *Transaction) Gas() uint64 { return tx.inner.gas() }
 
-// GasPrice returns the gas price of the transaction.
+// GasPrice returns the gas price of the transaction. For EIP-1559 transactions it is the fee cap.
 func (tx *Transaction) GasPrice() *uint256.Int { return new(uint256.Int).Set(tx.inner.gasPrice()) }
 
+// Tip returns the maximum priority fee per gas of the transaction. For transactions
+// without a separate tip it is the gas price.
+func (tx *Transaction) Tip() *uint256.Int { return new(uint256.Int).Set(tx.inner.tip()) }
+
+// FeeCap returns the maximum total fee per gas of the transaction. For transactions
+// without a separate fee cap it is the gas price.
+func (tx *Transaction) FeeCap() *uint256.Int { return new(uint256.Int).Set(tx.inner.feeCap()) }
+
+// EffectiveTip returns the fee per gas which goes to the miner of a block with the given
+// base fee: min(tip, feeCap - baseFee). A nil base fee means that EIP-1559 is not active,
+// then the effective tip is the whole tip. ErrFeeCapTooLow is returned (along with a zero
+// tip) if the fee cap doesn't cover the base fee.
+func (tx *Transaction) EffectiveTip(baseFee *uint256.Int) (*uint256.Int, error) {
+	if baseFee == nil {
+		return tx.Tip(), nil
+	}
+	feeCap := tx.inner.feeCap()
+	if feeCap.Lt(baseFee) {
+		return new(uint256.Int), ErrFeeCapTooLow
+	}
+	tip := new(uint256.Int).Sub(feeCap, baseFee)
+	if tx.inner.tip().Lt(tip) {
+		tip.Set(tx.inner.tip())
+	}
+	return tip, nil
+}
+
 // Value returns the ether amount of the transaction.
 func (tx *Transaction) Value() *uint256.Int { return new(uint256.Int).Set(tx.inner.value()) }
 
@@ -276,7 +313,7 @@ func (tx *Transaction) To() *common.Address {
 	return &cpy
 }
 
-// Cost returns gas * gasPrice + value.
+// Cost returns gas * gasPrice + value, i.e. the maximum amount the transaction may charge the sender.
 func (tx *Transaction) Cost() *uint256.Int {
 	total := new(uint256.Int).Mul(tx.GasPrice(), new(uint256.Int).SetUint64(tx.Gas()))
 	total.Add(total, tx.Value())
@@ -301,6 +338,24 @@ func (tx *Transaction) GasPriceIntCmp(other *uint256.Int) int {
 	return tx.inner.gasPrice().Cmp(other)
 }
 
+// FeeCapCmp compares the fee caps of two transactions.
+func (tx *Transaction) FeeCapCmp(other *Transaction) int {
+	return tx.inner.feeCap().Cmp(other.inner.feeCap())
+}
+
+// TipCmp compares the tips of two transactions.
+func (tx *Transaction) TipCmp(other *Transaction) int {
+	return tx.inner.tip().Cmp(other.inner.tip())
+}
+
+// EffectiveTipCmp compares the effective tips of two transactions with the given base fee.
+// The transactions whose fee cap doesn't cover the base fee have the zero effective tip.
+func (tx *Transaction) EffectiveTipCmp(other *Transaction, baseFee *uint256.Int) int {
+	tip, _ := tx.EffectiveTip(baseFee)
+	otherTip, _ := other.EffectiveTip(baseFee)
+	return tip.Cmp(otherTip)
+}
+
 // Hash returns the transaction hash.
 func (tx *Transaction) Hash() common.Hash {
 	if hash := tx.hash.Load(); hash != nil {
@@ -392,30 +447,49 @@ func (s TxByNonce) Len() int           { return len(s) }
 func (s TxByNonce) Less(i, j int) bool { return s[i].Nonce() < s[j].Nonce() }
 func (s TxByNonce) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
+// TxWithMinerFee wraps a transaction with its effective miner tip, so that the
+// tip doesn't have to be recalculated on every comparison.
+type TxWithMinerFee struct {
+	tx       *Transaction
+	minerFee *uint256.Int
+}
+
+// NewTxWithMinerFee creates a wrapped transaction, calculating the effective miner
+// tip if a base fee is provided. It returns ErrFeeCapTooLow if the fee cap of the
+// transaction doesn't cover the base fee.
+func NewTxWithMinerFee(tx *Transaction, baseFee *uint256.Int) (*TxWithMinerFee, error) {
+	minerFee, err := tx.EffectiveTip(baseFee)
+	if err != nil {
+		return nil, err
+	}
+	return &TxWithMinerFee{tx: tx, minerFee: minerFee}, nil
+}
+
 // TxByPriceAndTime implements both the sort and the heap interface, making it useful
 // for all at once sorting as well as individually adding and removing elements.
-type TxByPriceAndTime Transactions
+type TxByPriceAndTime []*TxWithMinerFee
 
 func (s TxByPriceAndTime) Len() int { return len(s) }
 func (s TxByPriceAndTime) Less(i, j int) bool {
 	// If the prices are equal, use the time the transaction was first seen for
 	// deterministic sorting
-	cmp := s[i].GasPrice().Cmp(s[j].GasPrice())
+	cmp := s[i].minerFee.Cmp(s[j].minerFee)
 	if cmp == 0 {
-		return s[i].time.Before(s[j].time)
+		return s[i].tx.time.Before(s[j].tx.time)
 	}
 	return cmp > 0
 }
 func (s TxByPriceAndTime) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 func (s *TxByPriceAndTime) Push(x interface{}) {
-	*s = append(*s, x.(*Transaction))
+	*s = append(*s, x.(*TxWithMinerFee))
 }
 
 func (s *TxByPriceAndTime) Pop() interface{} {
 	old := *s
 	n := len(old)
 	x := old[n-1]
+	old[n-1] = nil
 	*s = old[0 : n-1]
 	return x
 }
@@ -424,17 +498,19 @@ func (s *TxByPriceAndTime) Pop() interface{} {
 // transactions in a profit-maximizing sorted order, while supporting removing
 // entire batches of transactions for non-executable accounts.
 type TransactionsByPriceAndNonce struct {
-	txs    map[common.Address]Transactions // Per account nonce-sorted list of transactions
-	heads  TxByPriceAndTime                // Next transaction for each unique account (price heap)
-	signer Signer                          // Signer for the set of transactions
+	txs     map[common.Address]Transactions // Per account nonce-sorted list of transactions
+	heads   TxByPriceAndTime                // Next transaction for each unique account (price heap)
+	signer  Signer                          // Signer for the set of transactions
+	baseFee *uint256.Int                    // Current base fee, nil before EIP-1559
 }
 
 // NewTransactionsByPriceAndNonce creates a transaction set that can retrieve
-// price sorted transactions in a nonce-honouring way.
+// price sorted transactions in a nonce-honouring way. The transactions are ordered
+// by the effective miner tip at the given base fee, which is nil before EIP-1559.
 //
 // Note, the input map is reowned so the caller should not interact any more with
 // if after providing it to the constructor.
-func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transactions) *TransactionsByPriceAndNonce {
+func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transactions, baseFee *uint256.Int) *TransactionsByPriceAndNonce {
 	// Initialize a price and received time based heap with the head transactions
 	heads := make(TxByPriceAndTime, 0, len(txs))
 	for from, accTxs := range txs {
@@ -443,16 +519,23 @@ func NewTransactionsByPriceAndNonce(signer Signer, txs map[common.Address]Transa
 			delete(txs, from)
 			continue
 		}
-		heads = append(heads, accTxs[0])
+		wrapped, err := NewTxWithMinerFee(accTxs[0], baseFee)
+		// Remove transactions which can't pay the base fee, with all the following ones
+		if err != nil {
+			delete(txs, from)
+			continue
+		}
+		heads = append(heads, wrapped)
 		txs[from] = accTxs[1:]
 	}
 	heap.Init(&heads)
 
 	// Assemble and return the transaction set
 	return &TransactionsByPriceAndNonce{
-		txs:    txs,
-		heads:  heads,
-		signer: signer,
+		txs:     txs,
+		heads:   heads,
+		signer:  signer,
+		baseFee: baseFee,
 	}
 }
 
@@ -465,18 +548,20 @@ func (t *TransactionsByPriceAndNonce) Peek() *Transaction {
 	if len(t.heads) == 0 {
 		return nil
 	}
-	return t.heads[0]
+	return t.heads[0].tx
 }
 
 // Shift replaces the current best head with the next one from the same account.
 func (t *TransactionsByPriceAndNonce) Shift() {
-	acc, _ := Sender(t.signer, t.heads[0])
+	acc, _ := Sender(t.signer, t.heads[0].tx)
 	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
-		t.heads[0], t.txs[acc] = txs[0], txs[1:]
-		heap.Fix(&t.heads, 0)
-	} else {
-		heap.Pop(&t.heads)
+		if wrapped, err := NewTxWithMinerFee(txs[0], t.baseFee); err == nil {
+			t.heads[0], t.txs[acc] = wrapped, txs[1:]
+			heap.Fix(&t.heads, 0)
+			return
+		}
 	}
+	heap.Pop(&t.heads)
 }
 
 // Pop removes the best transaction, *not* replacing it with the next one from
@@ -496,37 +581,63 @@ type Message struct {
 	amount     uint256.Int
 	gasLimit   uint64
 	gasPrice   uint256.Int
+	feeCap     uint256.Int
+	tip        uint256.Int
 	data       []byte
 	accessList AccessList
 	checkNonce bool
 }
 
-func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *uint256.Int, gasLimit uint64, gasPrice *uint256.Int, data []byte, accessList AccessList, checkNonce bool) Message {
-	return Message{
+func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *uint256.Int, gasLimit uint64, gasPrice *uint256.Int, feeCap, tip *uint256.Int, data []byte, accessList AccessList, checkNonce bool) Message {
+	m := Message{
 		from:       from,
 		to:         to,
 		nonce:      nonce,
 		amount:     *amount,
 		gasLimit:   gasLimit,
 		gasPrice:   *gasPrice,
+		feeCap:     *gasPrice,
+		tip:        *gasPrice,
 		data:       data,
 		accessList: accessList,
 		checkNonce: checkNonce,
 	}
+	if feeCap != nil {
+		m.feeCap.Set(feeCap)
+	}
+	if tip != nil {
+		m.tip.Set(tip)
+	}
+	return m
 }
 
-// AsMessage returns the transaction as a core.Message.
-func (tx *Transaction) AsMessage(s Signer) (Message, error) {
+// AsMessage returns the transaction as a core.Message. If the base fee is given
+// (EIP-1559 is active), the gas price of the message is the effective gas price
+// min(tip + baseFee, feeCap) which the sender pays.
+func (tx *Transaction) AsMessage(s Signer, baseFee *big.Int) (Message, error) {
 	msg := Message{
 		nonce:      tx.Nonce(),
 		gasLimit:   tx.Gas(),
 		gasPrice:   *tx.GasPrice(),
+		feeCap:     *tx.FeeCap(),
+		tip:        *tx.Tip(),
 		to:         tx.To(),
 		amount:     *tx.Value(),
 		data:       tx.Data(),
 		accessList: tx.AccessList(),
 		checkNonce: true,
 	}
+	if baseFee != nil {
+		fee, overflow := uint256.FromBig(baseFee)
+		if overflow {
+			return msg, fmt.Errorf("base fee %v does not fit in 256 bits", baseFee)
+		}
+		if overflow = fee.AddOverflow(fee, &msg.tip); !overflow && fee.Lt(&msg.feeCap) {
+			msg.gasPrice.Set(fee)
+		} else {
+			msg.gasPrice.Set(&msg.feeCap)
+		}
+	}
 
 	var err error
 	msg.from, err = Sender(s, tx)
@@ -536,6 +647,8 @@ func (tx *Transaction) AsMessage(s Signer) (Message, error) {
 func (m Message) From() common.Address   { return m.from }
 func (m Message) To() *common.Address    { return m.to }
 func (m Message) GasPrice() *uint256.Int { return &m.gasPrice }
+func (m Message) FeeCap() *uint256.Int   { return &m.feeCap }
+func (m Message) Tip() *uint256.Int      { return &m.tip }
 func (m Message) Value() *uint256.Int    { return &m.amount }
 func (m Message) Gas() uint64            { return m.gasLimit }
 func (m Message) Nonce() uint64          { return m.nonce }
@@ -28,6 +28,10 @@ type txJSON struct {
 	ChainID    *hexutil.Big `json:"chainId,omitempty"`
 	AccessList *AccessList  `json:"accessList,omitempty"`
 
+	// Dynamic fee transaction fields:
+	Tip    *hexutil.Big `json:"maxPriorityFeePerGas,omitempty"`
+	FeeCap *hexutil.Big `json:"maxFeePerGas,omitempty"`
+
 	// Only used for encoding:
 	Hash common.Hash `json:"hash"`
 }
@@ -63,6 +67,19 @@ func (tx *Transaction) MarshalJSON() ([]byte, error) {
 		enc.V = (*hexutil.Big)(txInner.V.ToBig())
 		enc.R = (*hexutil.Big)(txInner.R.ToBig())
 		enc.S = (*hexutil.Big)(txInner.S.ToBig())
+	case *DynamicFeeTx:
+		enc.ChainID = (*hexutil.Big)(txInner.ChainID.ToBig())
+		enc.AccessList = &txInner.AccessList
+		enc.Nonce = (*hexutil.Uint64)(&txInner.Nonce)
+		enc.Gas = (*hexutil.Uint64)(&txInner.Gas)
+		enc.Tip = (*hexutil.Big)(txInner.Tip.ToBig())
+		enc.FeeCap = (*hexutil.Big)(txInner.FeeCap.ToBig())
+		enc.Value = (*hexutil.Big)(txInner.Value.ToBig())
+		enc.Data = (*hexutil.Bytes)(&txInner.Data)
+		enc.To = tx.To()
+		enc.V = (*hexutil.Big)(txInner.V.ToBig())
+		enc.R = (*hexutil.Big)(txInner.R.ToBig())
+		enc.S = (*hexutil.Big)(txInner.S.ToBig())
 	}
 	return json.Marshal(&enc)
 }
@@ -210,6 +227,85 @@ func (tx *Transaction) UnmarshalJSON(input []byte) error {
 			}
 		}
 
+	case DynamicFeeTxType:
+		var itx DynamicFeeTx
+		inner = &itx
+		// Access list is optional for now.
+		if dec.AccessList != nil {
+			itx.AccessList = *dec.AccessList
+		}
+		if dec.ChainID == nil {
+			return errors.New("missing required field 'chainId' in transaction")
+		}
+		var overflow bool
+		itx.ChainID, overflow = uint256.FromBig(dec.ChainID.ToInt())
+		if overflow {
+			return errors.New("'chainId' in transaction does not fit in 256 bits")
+		}
+		if dec.To != nil {
+			itx.To = dec.To
+		}
+		if dec.Nonce == nil {
+			return errors.New("missing required field 'nonce' in transaction")
+		}
+		itx.Nonce = uint64(*dec.Nonce)
+		if dec.Tip == nil {
+			return errors.New("missing required field 'maxPriorityFeePerGas' in transaction")
+		}
+		itx.Tip, overflow = uint256.FromBig(dec.Tip.ToInt())
+		if overflow {
+			return errors.New("'maxPriorityFeePerGas' in transaction does not fit in 256 bits")
+		}
+		if dec.FeeCap == nil {
+			return errors.New("missing required field 'maxFeePerGas' in transaction")
+		}
+		itx.FeeCap, overflow = uint256.FromBig(dec.FeeCap.ToInt())
+		if overflow {
+			return errors.New("'maxFeePerGas' in transaction does not fit in 256 bits")
+		}
+		if dec.Gas == nil {
+			return errors.New("missing required field 'gas' in transaction")
+		}
+		itx.Gas = uint64(*dec.Gas)
+		if dec.Value == nil {
+			return errors.New("missing required field 'value' in transaction")
+		}
+		itx.Value, overflow = uint256.FromBig(dec.Value.ToInt())
+		if overflow {
+			return errors.New("'value' in transaction does not fit in 256 bits")
+		}
+		if dec.Data == nil {
+			return errors.New("missing required field 'input' in transaction")
+		}
+		itx.Data = *dec.Data
+		if dec.V == nil {
+			return errors.New("missing required field 'v' in transaction")
+		}
+		itx.V, overflow = uint256.FromBig(dec.V.ToInt())
+		if overflow {
+			return errors.New("'v' in transaction does not fit in 256 bits")
+		}
+		if dec.R == nil {
+			return errors.New("missing required field 'r' in transaction")
+		}
+		itx.R, overflow = uint256.FromBig(dec.R.ToInt())
+		if overflow {
+			return errors.New("'r' in transaction does not fit in 256 bits")
+		}
+		if dec.S == nil {
+			return errors.New("missing required field 's' in transaction")
+		}
+		itx.S, overflow = uint256.FromBig(dec.S.ToInt())
+		if overflow {
+			return errors.New("'s' in transaction does not fit in 256 bits")
+		}
+		withSignature := itx.V.Sign() != 0 || itx.R.Sign() != 0 || itx.S.Sign() != 0
+		if withSignature {
+			if err := sanityCheckSignature(itx.V, itx.R, itx.S, false); err != nil {
+				return err
+			}
+		}
+
 	default:
 		return ErrTxTypeNotSupported
 	}
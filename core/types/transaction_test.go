@@ -283,7 +283,7 @@ func TestTransactionPriceNonceSort(t *testing.T) {
 		}
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(signer, groups)
+	txset := NewTransactionsByPriceAndNonce(signer, groups, nil)
 
 	txs := Transactions{}
 	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
@@ -335,7 +335,7 @@ func TestTransactionTimeSort(t *testing.T) {
 		groups[addr] = append(groups[addr], tx)
 	}
 	// Sort the transactions and cross check the nonce ordering
-	txset := NewTransactionsByPriceAndNonce(signer, groups)
+	txset := NewTransactionsByPriceAndNonce(signer, groups, nil)
 
 	txs := Transactions{}
 	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
@@ -362,6 +362,82 @@ func TestTransactionTimeSort(t *testing.T) {
 	}
 }
 
+// Tests that with a base fee the transactions are sorted by their effective miner tip,
+// and that the transactions which can't pay the base fee are dropped with all the
+// following transactions of the same account.
+func TestTransactionEffectiveTipSort(t *testing.T) {
+	signer := NewLondonSigner(common.Big1)
+	baseFee := uint256.NewInt().SetUint64(10)
+
+	// tip, feeCap and expected effective tip for each account
+	fees := [][3]uint64{
+		{5, 100, 5},  // tip is below the cap
+		{50, 20, 10}, // fee cap limits the tip
+		{1, 12, 1},
+		{7, 9, 0}, // fee cap is below the base fee, dropped
+	}
+	keys := make([]*ecdsa.PrivateKey, len(fees))
+	groups := map[common.Address]Transactions{}
+	for i, fee := range fees {
+		keys[i], _ = crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(keys[i].PublicKey)
+		for nonce := uint64(0); nonce < 2; nonce++ {
+			tx := MustSignNewTx(keys[i], signer, &DynamicFeeTx{
+				ChainID: uint256.NewInt().SetUint64(1),
+				Nonce:   nonce,
+				Gas:     21000,
+				Tip:     uint256.NewInt().SetUint64(fee[0]),
+				FeeCap:  uint256.NewInt().SetUint64(fee[1]),
+			})
+			groups[addr] = append(groups[addr], tx)
+		}
+	}
+	txset := NewTransactionsByPriceAndNonce(signer, groups, baseFee)
+
+	var tips []uint64
+	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+		tip, err := tx.EffectiveTip(baseFee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tips = append(tips, tip.Uint64())
+		txset.Shift()
+	}
+	if want := []uint64{10, 10, 5, 5, 1, 1}; !reflect.DeepEqual(tips, want) {
+		t.Errorf("wrong effective tips order: have %v, want %v", tips, want)
+	}
+}
+
+// Tests that the gas price of the message is the tip on top of the base fee capped by the fee
+// cap, also when the tip is too large to be added to the base fee.
+func TestAsMessageGasPrice(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := NewLondonSigner(common.Big1)
+	maxTip := new(uint256.Int).SetAllOne()
+	for _, c := range []struct {
+		tip, feeCap *uint256.Int
+		want        uint64
+	}{
+		{uint256.NewInt().SetUint64(5), uint256.NewInt().SetUint64(100), 15},
+		{uint256.NewInt().SetUint64(50), uint256.NewInt().SetUint64(20), 20},
+		{maxTip, uint256.NewInt().SetUint64(20), 20},
+	} {
+		tx := MustSignNewTx(key, signer, &DynamicFeeTx{
+			ChainID: uint256.NewInt().SetUint64(1),
+			Gas:     21000,
+			Tip:     c.tip,
+			FeeCap:  c.feeCap,
+		})
+		msg, err := tx.AsMessage(signer, big.NewInt(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := msg.GasPrice().Uint64(); have != c.want {
+			t.Errorf("tip %v, fee cap %v: gas price %d, want %d", c.tip, c.feeCap, have, c.want)
+		}
+	}
+}
+
 // TestTransactionCoding tests serializing/de-serializing to/from rlp and JSON.
 func TestTransactionCoding(t *testing.T) {
 	key, err := crypto.GenerateKey()
@@ -369,14 +445,14 @@ func TestTransactionCoding(t *testing.T) {
 		t.Fatalf("could not generate key: %v", err)
 	}
 	var (
-		signer    = NewEIP2930Signer(common.Big1)
+		signer    = NewLondonSigner(common.Big1)
 		addr      = common.HexToAddress("0x0000000000000000000000000000000000000001")
 		recipient = common.HexToAddress("095e7baea6a6c7c4c2dfeb977efac326af552d87")
 		accesses  = AccessList{{Address: addr, StorageKeys: []common.Hash{{0}}}}
 	)
 	for i := uint64(0); i < 500; i++ {
 		var txdata TxData
-		switch i % 5 {
+		switch i % 6 {
 		case 0:
 			// Legacy tx.
 			txdata = &LegacyTx{
@@ -424,6 +500,18 @@ func TestTransactionCoding(t *testing.T) {
 				GasPrice:   uint256.NewInt().SetUint64(10),
 				AccessList: accesses,
 			}
+		case 5:
+			// Dynamic fee tx with access list.
+			txdata = &DynamicFeeTx{
+				ChainID:    uint256.NewInt().SetUint64(1),
+				Nonce:      i,
+				To:         &recipient,
+				Gas:        123457,
+				Tip:        uint256.NewInt().SetUint64(2),
+				FeeCap:     uint256.NewInt().SetUint64(10),
+				AccessList: accesses,
+				Data:       []byte("abcdef"),
+			}
 		}
 		tx, err := SignNewTx(key, signer, txdata)
 		if err != nil {
@@ -446,6 +534,14 @@ func TestTransactionCoding(t *testing.T) {
 		if err = assertEqual(parsedTx, tx); err != nil {
 			t.Fatal(err)
 		}
+
+		from, err := Sender(signer, parsedTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := crypto.PubkeyToAddress(key.PublicKey); from != want {
+			t.Fatalf("tx %d: sender mismatch: have %x, want %x", i, from, want)
+		}
 	}
 }
 
@@ -20,6 +20,7 @@ import (
 	"github.com/holiman/uint256"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/codecache"
 )
 
 // ContractRef is a reference to the contract's backing object
@@ -116,9 +117,14 @@ func (c *Contract) isCode(udest uint64) bool {
 		// Does parent context have the analysis?
 		analysis, exist := c.jumpdests[c.CodeHash]
 		if !exist {
-			// Do the analysis and save in parent context
+			// Is it in the cache shared by all the executions?
+			if analysis, exist = codecache.Shared.Analysis(c.CodeHash); !exist {
+				// Do the analysis and save in the shared cache
+				analysis = codeBitmap(c.Code)
+				codecache.Shared.AddAnalysis(c.CodeHash, analysis)
+			}
+			// Save in parent context
 			// We do not need to store it in c.analysis
-			analysis = codeBitmap(c.Code)
 			c.jumpdests[c.CodeHash] = analysis
 		}
 		// Also stash it in current contract for faster access
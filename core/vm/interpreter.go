@@ -36,6 +36,7 @@ type Config struct {
 	TraceJumpDest           bool   // Print transaction hashes where jumpdest analysis was useful
 	NoReceipts              bool   // Do not calculate receipts
 	ReadOnly                bool   // Do no perform any block finalisation
+	NoBaseFee               bool   // Allows zero-priced calls (eth_call, eth_estimateGas) below the EIP-1559 base fee
 
 	ExtraEips []int // Additional EIPS that are to be enabled
 }
@@ -85,7 +86,7 @@ type EVMInterpreter struct {
 
 	jt *JumpTable // EVM instruction table
 
-	hasher    keccakState // Keccak256 hasher instance shared across opcodes
+	hasher    keccakState // Keccak256 hasher instance shared across opcodes, from keccakPool for the outermost call
 	hasherBuf common.Hash // Keccak256 hasher result array shared across opcodes
 
 	readOnly   bool   // Whether to throw on stateful modifications
@@ -113,7 +114,14 @@ func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
 	default:
 		jt = &frontierInstructionSet
 	}
-	if len(cfg.ExtraEips) > 0 {
+	if eips := evm.chainConfig.ActiveExtraEIPs(evm.Context.BlockNumber); len(eips) > 0 || len(cfg.ExtraEips) > 0 {
+		// The instruction sets are shared, the EIPs are enabled on the copy
+		jt = copyJumpTable(jt)
+		for _, eip := range eips {
+			if err := EnableEIP(eip, jt); err != nil {
+				log.Error("EIP activation failed", "eip", eip, "error", err)
+			}
+		}
 		for i, eip := range cfg.ExtraEips {
 			if err := EnableEIP(eip, jt); err != nil {
 				// Disable it, so caller can check if it's activated or not
@@ -158,14 +166,12 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	}
 
 	var (
-		op          OpCode        // current opcode
-		mem         = NewMemory() // bound memory
-		locStack    = stack.New()
-		callContext = &callCtx{
-			memory:   mem,
-			stack:    locStack,
-			contract: contract,
-		}
+		op          OpCode // current opcode
+		depth       = in.evm.depth
+		frame       = getFrame(depth, contract)
+		mem         = frame.ctx.memory // bound memory
+		locStack    = frame.ctx.stack
+		callContext = &frame.ctx
 		// For optimisation reason we're using uint64 as the program counter.
 		// It's theoretically possible to go above 2^64. The YP defines the PC
 		// to be uint256. Practically much less so feasible.
@@ -181,7 +187,12 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	// so that it get's executed _after_: the capturestate needs the stacks before
 	// they are returned to the pools
 	defer func() {
-		stack.ReturnNormalStack(locStack)
+		in.returnData = nil // points at the buffer of the frame
+		putFrame(depth, frame)
+		if depth == 1 && in.hasher != nil {
+			keccakPool.Put(in.hasher)
+			in.hasher = nil
+		}
 	}()
 	contract.Input = input
 
@@ -283,7 +294,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		// if the operation clears the return data (e.g. it has returning data)
 		// set the last return to the result of the operation.
 		if operation.returns {
-			in.returnData = common.CopyBytes(res)
+			in.returnData = frame.setReturnData(res)
 		}
 
 		switch {
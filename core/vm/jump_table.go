@@ -69,6 +69,18 @@ var (
 // JumpTable contains the EVM opcodes supported at a given fork.
 type JumpTable [256]*operation
 
+// copyJumpTable returns the deep copy of the jump table, for the enablers of the EIPs to modify
+func copyJumpTable(jt *JumpTable) *JumpTable {
+	var cpy JumpTable
+	for i, op := range jt {
+		if op != nil {
+			opCopy := *op
+			cpy[i] = &opCopy
+		}
+	}
+	return &cpy
+}
+
 // newBerlinInstructionSet returns the frontier, homestead, byzantium,
 // contantinople, istanbul, petersburg and berlin instructions.
 func newBerlinInstructionSet() JumpTable {
@@ -139,6 +139,8 @@ type StructLogger struct {
 
 	storage map[common.Address]Storage
 	logs    []StructLog
+	count   int
+	onLog   func(*StructLog) error
 	output  []byte
 	err     error
 }
@@ -154,6 +156,15 @@ func NewStructLogger(cfg *LogConfig) *StructLogger {
 	return logger
 }
 
+// NewStreamingStructLogger returns a logger which doesn't accumulate the captured logs,
+// but passes each of them to onLog as soon as it is captured. It keeps the memory usage
+// of very long traces flat. StructLogs of such logger is always empty.
+func NewStreamingStructLogger(cfg *LogConfig, onLog func(*StructLog) error) *StructLogger {
+	logger := NewStructLogger(cfg)
+	logger.onLog = onLog
+	return logger
+}
+
 // CaptureStart implements the Tracer interface to initialize the tracing operation.
 func (l *StructLogger) CaptureStart(depth int, from common.Address, to common.Address, precompile bool, create bool, calltype CallType, input []byte, gas uint64, value *big.Int) error {
 	return nil
@@ -164,7 +175,7 @@ func (l *StructLogger) CaptureStart(depth int, from common.Address, to common.Ad
 // CaptureState also tracks SLOAD/SSTORE ops to track storage change.
 func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *stack.Stack, rData []byte, contract *Contract, depth int, err error) error {
 	// check if already accumulated the specified number of logs
-	if l.cfg.Limit != 0 && l.cfg.Limit <= len(l.logs) {
+	if l.cfg.Limit != 0 && l.cfg.Limit <= l.count {
 		return errTraceLimitReached
 	}
 
@@ -216,6 +227,10 @@ func (l *StructLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost ui
 	}
 	// create a new snapshot of the EVM.
 	log := StructLog{pc, op, gas, cost, mem, memory.Len(), stck, rdata, storage, depth, env.IntraBlockState.GetRefund(), err}
+	l.count++
+	if l.onLog != nil {
+		return l.onLog(&log)
+	}
 	l.logs = append(l.logs, log)
 	return nil
 }
@@ -0,0 +1,80 @@
+package vm
+
+import (
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// pooledDepths is the number of the pools of the frames, the calls from this depth on share the last one
+	pooledDepths = 16
+	// maxPooledBuffer is the capacity of the memory or of the return data beyond which the buffer is dropped with
+	// the frame, so that the pools don't hold the buffers of the rare large calls
+	maxPooledBuffer = 64 * 1024
+)
+
+// frame is the per-call state of the interpreter, reused by the calls of the later transactions: the memory, the
+// stack, the buffer of the data returned to the call and the context pointing at them
+type frame struct {
+	ctx        callCtx
+	memory     Memory
+	stack      stack.Stack
+	returnData []byte
+}
+
+// framePools keep the frames of the finished calls by their depth, the calls at the same depth tend to grow the
+// memory and the stack to the same sizes
+var framePools [pooledDepths]sync.Pool
+
+var keccakPool = sync.Pool{
+	New: func() interface{} {
+		return sha3.NewLegacyKeccak256().(keccakState)
+	},
+}
+
+func framePool(depth int) *sync.Pool {
+	if depth >= pooledDepths {
+		depth = pooledDepths - 1
+	}
+	return &framePools[depth]
+}
+
+// getFrame returns the frame of the call of the contract at the depth
+func getFrame(depth int, contract *Contract) *frame {
+	f, ok := framePool(depth).Get().(*frame)
+	if !ok {
+		f = &frame{stack: stack.Stack{Data: make([]uint256.Int, 0, 16)}}
+		f.ctx.memory = &f.memory
+		f.ctx.stack = &f.stack
+	}
+	f.ctx.contract = contract
+	return f
+}
+
+// putFrame resets the frame of the finished call and returns it to the pool of the depth. The frame is not used
+// after, nothing returned by the call can point at its memory
+func putFrame(depth int, f *frame) {
+	if cap(f.memory.store) > maxPooledBuffer {
+		f.memory.store = nil
+	} else {
+		f.memory.store = f.memory.store[:0]
+	}
+	f.memory.lastGasCost = 0
+	if cap(f.returnData) > maxPooledBuffer {
+		f.returnData = nil
+	} else {
+		f.returnData = f.returnData[:0]
+	}
+	f.stack.Reset()
+	f.ctx.contract = nil
+	framePool(depth).Put(f)
+}
+
+// setReturnData keeps the data returned to the call in the buffer of its frame
+func (f *frame) setReturnData(data []byte) []byte {
+	f.returnData = append(f.returnData[:0], data...)
+	return f.returnData
+}
@@ -17,10 +17,12 @@
 package runtime
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -128,6 +130,59 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// TestNestedCallsConcurrently runs the calls returning the data of the nested calls in parallel, the frames of the
+// interpreter are shared through the pools by the goroutines
+func TestNestedCallsConcurrently(t *testing.T) {
+	callee := common.HexToAddress("0xbb")
+	caller := common.HexToAddress("0xaa")
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			db := ethdb.NewMemDatabase()
+			defer db.Close()
+			state := state.New(state.NewTrieDbState(common.Hash{}, db, 0))
+			// Returns its input
+			state.SetCode(callee, []byte{
+				byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD),
+				byte(vm.PUSH1), 0, byte(vm.MSTORE),
+				byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+			})
+			// Calls the callee with its input plus one, returns the input of the call and the data returned by it
+			state.SetCode(caller, []byte{
+				byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD),
+				byte(vm.PUSH1), 1, byte(vm.ADD),
+				byte(vm.PUSH1), 0, byte(vm.MSTORE),
+				byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+				byte(vm.PUSH1), 0xbb, byte(vm.GAS), byte(vm.CALL),
+				byte(vm.POP),
+				byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 32, byte(vm.RETURNDATACOPY),
+				byte(vm.PUSH1), 64, byte(vm.PUSH1), 0, byte(vm.RETURN),
+			})
+			for i := 0; i < 200; i++ {
+				x := big.NewInt(int64(g*1000 + i))
+				ret, _, err := Call(caller, common.LeftPadBytes(x.Bytes(), 32), &Config{State: state})
+				if err != nil {
+					errs <- err
+					return
+				}
+				want := common.LeftPadBytes(x.Add(x, common.Big1).Bytes(), 32)
+				if !bytes.Equal(ret, append(append([]byte{}, want...), want...)) {
+					errs <- fmt.Errorf("goroutine %d, call %d: returned %x", g, i, ret)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sync/atomic"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/consensus"
@@ -45,6 +46,9 @@ type EthAPIBackend struct {
 	allowUnprotectedTxs bool
 	eth                 *Ethereum
 	gpo                 *gasprice.Oracle
+
+	rpcGasCap   atomic.Value // uint64 overriding the config once set
+	rpcTxFeeCap atomic.Value // float64 overriding the config once set
 }
 
 // ChainConfig returns the active chain configuration.
@@ -253,12 +257,14 @@ func (b *EthAPIBackend) GetTd(ctx context.Context, hash common.Hash) *big.Int {
 	return b.eth.blockchain.GetTdByHash(hash)
 }
 
-func (b *EthAPIBackend) GetEVM(ctx context.Context, msg core.Message, state *state.IntraBlockState, header *types.Header) (*vm.EVM, func() error, error) {
+func (b *EthAPIBackend) GetEVM(ctx context.Context, msg core.Message, state *state.IntraBlockState, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
 	vmError := func() error { return nil }
-
+	if vmConfig == nil {
+		vmConfig = b.eth.blockchain.GetVMConfig()
+	}
 	txContext := core.NewEVMTxContext(msg)
 	context := core.NewEVMBlockContext(header, b.eth.BlockChain(), nil)
-	return vm.NewEVM(context, txContext, state, b.eth.blockchain.Config(), *b.eth.blockchain.GetVMConfig()), vmError, nil
+	return vm.NewEVM(context, txContext, state, b.eth.blockchain.Config(), *vmConfig), vmError, nil
 }
 
 func (b *EthAPIBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
@@ -338,6 +344,14 @@ func (b *EthAPIBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *EthAPIBackend) SuggestTipCap(ctx context.Context) (*big.Int, error) {
+	return b.gpo.SuggestTipCap(ctx)
+}
+
+func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error) {
+	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+}
+
 func (b *EthAPIBackend) ChainDb() ethdb.Database {
 	return b.eth.ChainDb()
 }
@@ -355,13 +369,29 @@ func (b *EthAPIBackend) UnprotectedAllowed() bool {
 }
 
 func (b *EthAPIBackend) RPCGasCap() uint64 {
+	if gasCap, ok := b.rpcGasCap.Load().(uint64); ok {
+		return gasCap
+	}
 	return b.eth.config.RPCGasCap
 }
 
+// SetRPCGasCap changes the gas cap of the eth_call and the like of the running node, 0 is no cap
+func (b *EthAPIBackend) SetRPCGasCap(gasCap uint64) {
+	b.rpcGasCap.Store(gasCap)
+}
+
 func (b *EthAPIBackend) RPCTxFeeCap() float64 {
+	if feeCap, ok := b.rpcTxFeeCap.Load().(float64); ok {
+		return feeCap
+	}
 	return b.eth.config.RPCTxFeeCap
 }
 
+// SetRPCTxFeeCap changes the fee cap of the transactions sent through the RPC of the running node, 0 is no cap
+func (b *EthAPIBackend) SetRPCTxFeeCap(feeCap float64) {
+	b.rpcTxFeeCap.Store(feeCap)
+}
+
 func (b *EthAPIBackend) BloomStatus() (uint64, uint64) {
 	return 0, 0
 }
@@ -40,8 +40,11 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/etl"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/aura"
+	"github.com/ledgerwatch/turbo-geth/consensus/bor"
 	"github.com/ledgerwatch/turbo-geth/consensus/clique"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/consensus/external"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/bloombits"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
@@ -49,11 +52,13 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/eth/downloader"
+	"github.com/ledgerwatch/turbo-geth/eth/engineapi"
 	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
 	"github.com/ledgerwatch/turbo-geth/eth/ethutils"
 	"github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/eth/gasprice"
 	"github.com/ledgerwatch/turbo-geth/eth/protocols/eth"
+	"github.com/ledgerwatch/turbo-geth/eth/protocols/snap"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -61,6 +66,8 @@ import (
 	"github.com/ledgerwatch/turbo-geth/event"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/migrations"
 	"github.com/ledgerwatch/turbo-geth/miner"
 	"github.com/ledgerwatch/turbo-geth/node"
 	"github.com/ledgerwatch/turbo-geth/p2p"
@@ -90,9 +97,13 @@ type Ethereum struct {
 	snapDialCandidates enode.Iterator
 
 	// DB interfaces
-	chainDb    ethdb.Database // Block chain database
-	chainKV    ethdb.KV       // Same as chainDb, but different interface
-	privateAPI *grpc.Server
+	chainDb       ethdb.Database // Block chain database
+	chainKV       ethdb.KV       // Same as chainDb, but different interface
+	privateAPI    *grpc.Server
+	quitDBMetrics chan struct{} // Stops the collection of the database metrics and stats
+	tmpdir        string
+
+	txLookupRebuild txLookupRebuild // Rebuild of the transaction lookup index started by admin_rebuildTxLookup
 
 	eventMux *event.TypeMux
 	engine   consensus.Engine
@@ -157,7 +168,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 	}
 
-	chainConfig, genesisHash, _, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideBerlin, config.StorageMode.History, false /* overwrite */)
+	chainConfig, genesisHash, _, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.Overrides, config.StorageMode.History, false /* overwrite */)
 
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -282,15 +293,39 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 	}
 
+	heimdallURL := config.HeimdallURL
+	if config.WithoutHeimdall {
+		heimdallURL = ""
+	}
+	var engine consensus.Engine
+	if config.ExternalConsensus != "" {
+		if engine, err = external.Dial(config.ExternalConsensus); err != nil {
+			return nil, err
+		}
+	} else {
+		engine = ethconfig.CreateConsensusEngine(chainConfig, &config.Ethash, config.Miner.Notify, config.Miner.Noverify, heimdallURL, chainDb)
+	}
+
+	chainKV := chainDb.(ethdb.HasKV).KV()
+	if config.Ancients != nil {
+		// The readers of the blocks fall through to the ancient store, the metrics and the space watch
+		// stay on the database itself
+		chainDb.(ethdb.HasKV).SetKV(ethdb.NewAncientsKV(chainKV, config.Ancients))
+	}
+	// The lookups of the history tell the pruned changesets, and fetch them from the archive if there is one
+	chainDb.(ethdb.HasKV).SetKV(ethdb.NewChangesetsKV(chainDb.(ethdb.HasKV).KV(), stages.ReadPruneProgress, config.Changesets))
+
 	eth := &Ethereum{
 		config:        config,
 		chainDb:       chainDb,
-		chainKV:       chainDb.(ethdb.HasKV).KV(),
+		chainKV:       chainKV,
 		eventMux:      stack.EventMux(),
-		engine:        ethconfig.CreateConsensusEngine(chainConfig, &config.Ethash, config.Miner.Notify, config.Miner.Noverify, chainDb),
+		engine:        engine,
 		networkID:     config.NetworkID,
 		etherbase:     config.Miner.Etherbase,
 		bloomRequests: make(chan chan *bloombits.Retrieval),
+		quitDBMetrics: make(chan struct{}),
+		tmpdir:        tmpdir,
 		p2pServer:     stack.Server(),
 		torrentClient: torrentClient,
 		chainConfig:   chainConfig,
@@ -329,6 +364,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if !reflect.DeepEqual(sm, config.StorageMode) {
 		return nil, errors.New("mode is " + config.StorageMode.ToString() + " original mode is " + sm.ToString())
 	}
+	if sm.Preimages {
+		// The preimages of the state written before the recording, once
+		backfill := &migrations.Migrator{Migrations: []migrations.Migration{migrations.PreimagesBackfill}}
+		if err = backfill.Apply(chainDb, tmpdir); err != nil {
+			return nil, err
+		}
+	}
 
 	vmConfig, cacheConfig := BlockchainRuntimeConfig(config)
 	txCacher := core.NewTxSenderCacher(runtime.NumCPU())
@@ -356,13 +398,6 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		}
 	}
 
-	if config.TxPool.Journal != "" {
-		config.TxPool.Journal, err = stack.ResolvePath(config.TxPool.Journal)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, chainDb, txCacher)
 
 	stagedSync := config.StagedSync
@@ -386,46 +421,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		ethashApi = casted.APIs(nil)[1].Service.(*ethash.API)
 	}
 	if stack.Config().PrivateApiAddr != "" {
-		if stack.Config().TLSConnection {
-			// load peer cert/key, ca cert
-			var creds credentials.TransportCredentials
-
-			if stack.Config().TLSCACert != "" {
-				var peerCert tls.Certificate
-				var caCert []byte
-				peerCert, err = tls.LoadX509KeyPair(stack.Config().TLSCertFile, stack.Config().TLSKeyFile)
-				if err != nil {
-					log.Error("load peer cert/key error:%v", err)
-					return nil, err
-				}
-				caCert, err = ioutil.ReadFile(stack.Config().TLSCACert)
-				if err != nil {
-					log.Error("read ca cert file error:%v", err)
-					return nil, err
-				}
-				caCertPool := x509.NewCertPool()
-				caCertPool.AppendCertsFromPEM(caCert)
-				creds = credentials.NewTLS(&tls.Config{
-					Certificates: []tls.Certificate{peerCert},
-					ClientCAs:    caCertPool,
-					ClientAuth:   tls.RequireAndVerifyClientCert,
-				})
-			} else {
-				creds, err = credentials.NewServerTLSFromFile(stack.Config().TLSCertFile, stack.Config().TLSKeyFile)
-			}
-
-			if err != nil {
-				return nil, err
-			}
-			eth.privateAPI, err = remotedbserver.StartGrpc(chainDb.(ethdb.HasKV).KV(), eth, ethashApi, stack.Config().PrivateApiAddr, stack.Config().PrivateApiRateLimit, &creds, eth.events)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			eth.privateAPI, err = remotedbserver.StartGrpc(chainDb.(ethdb.HasKV).KV(), eth, ethashApi, stack.Config().PrivateApiAddr, stack.Config().PrivateApiRateLimit, nil, eth.events)
-			if err != nil {
-				return nil, err
-			}
+		creds, err := privateAPICredentials(stack.Config())
+		if err != nil {
+			return nil, err
+		}
+		eth.privateAPI, err = remotedbserver.StartGrpc(chainDb.(ethdb.HasKV).KV(), eth, ethashApi, stack.Config().PrivateApiAddr, stack.Config().PrivateApiRateLimit, creds, eth.events)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -451,10 +453,11 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	eth.snapDialCandidates, _ = setupDiscovery(eth.config.SnapDiscoveryURLs) //nolint:staticcheck
 	eth.handler.SetTmpDir(tmpdir)
 	eth.handler.SetBatchSize(config.CacheSize, config.BatchSize)
+	eth.handler.SetDurability(stack.Config().Durability, stack.Config().BulkDurability)
 	eth.handler.SetStagedSync(stagedSync)
 	eth.handler.SetMining(mining)
 
-	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), stack.Config().AllowUnprotectedTxs, eth, nil}
+	eth.APIBackend = &EthAPIBackend{extRPCEnabled: stack.Config().ExtRPCEnabled(), allowUnprotectedTxs: stack.Config().AllowUnprotectedTxs, eth: eth}
 	gpoParams := config.GPO
 	if gpoParams.Default == nil {
 		gpoParams.Default = config.Miner.GasPrice
@@ -466,7 +469,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 
 	if config.SyncMode != downloader.StagedSync {
-		eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), stack.Config().AllowUnprotectedTxs, eth, nil}
+		eth.APIBackend = &EthAPIBackend{extRPCEnabled: stack.Config().ExtRPCEnabled(), allowUnprotectedTxs: stack.Config().AllowUnprotectedTxs, eth: eth}
 		gpoParams := config.GPO
 		if gpoParams.Default == nil {
 			gpoParams.Default = config.Miner.GasPrice
@@ -495,6 +498,40 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	return eth, nil
 }
 
+// privateAPICredentials loads the TLS credentials of the private API, nil if TLS is not enabled
+func privateAPICredentials(cfg *node.Config) (*credentials.TransportCredentials, error) {
+	if !cfg.TLSConnection {
+		return nil, nil
+	}
+	// load peer cert/key, ca cert
+	var creds credentials.TransportCredentials
+	if cfg.TLSCACert != "" {
+		peerCert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Error("load peer cert/key error:%v", err)
+			return nil, err
+		}
+		caCert, err := ioutil.ReadFile(cfg.TLSCACert)
+		if err != nil {
+			log.Error("read ca cert file error:%v", err)
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+		creds = credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{peerCert},
+			ClientCAs:    caCertPool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+	} else {
+		var err error
+		if creds, err = credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	return &creds, nil
+}
+
 func BlockchainRuntimeConfig(config *ethconfig.Config) (vm.Config, *core.CacheConfig) {
 	var (
 		vmConfig = vm.Config{
@@ -582,6 +619,11 @@ func (s *Ethereum) APIs() []rpc.API {
 		//	Version:   "1.0",
 		//	Service:   NewPrivateAdminAPI(s),
 		//},
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   &PrivateTxLookupAPI{eth: s},
+		},
 		//{
 		//	Namespace: "debug",
 		//	Version:   "1.0",
@@ -592,6 +634,12 @@ func (s *Ethereum) APIs() []rpc.API {
 		//	Version:   "1.0",
 		//	Service:   NewPrivateDebugAPI(s),
 		//},
+		{
+			Namespace:     "engine",
+			Version:       "1.0",
+			Service:       engineapi.NewAPI(s.chainDb, s.chainConfig, s.engine, s.config.StorageMode),
+			Authenticated: true,
+		},
 		{
 			Namespace: "net",
 			Version:   "1.0",
@@ -702,6 +750,26 @@ func (s *Ethereum) StartMining(threads int) error {
 				return crypto.Sign(message, s.signer)
 			})
 		}
+		if aura, ok := s.engine.(*aura.AuRa); ok {
+			if s.signer == nil {
+				log.Error("Etherbase account unavailable locally", "err", err)
+				return fmt.Errorf("signer missing: %v", err)
+			}
+
+			aura.Authorize(eb, func(_ common.Address, message []byte) ([]byte, error) {
+				return crypto.Sign(crypto.Keccak256(message), s.signer)
+			})
+		}
+		if bor, ok := s.engine.(*bor.Bor); ok {
+			if s.signer == nil {
+				log.Error("Etherbase account unavailable locally", "err", err)
+				return fmt.Errorf("signer missing: %v", err)
+			}
+
+			bor.Authorize(eb, func(_ common.Address, message []byte) ([]byte, error) {
+				return crypto.Sign(crypto.Keccak256(message), s.signer)
+			})
+		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
 		atomic.StoreUint32(&s.handler.acceptTxs, 1)
@@ -726,6 +794,20 @@ func (s *Ethereum) StopMining() {
 	}
 }
 
+// BuildBlock assembles the block the miner would build on top of the parent, without sealing or broadcasting it
+func (s *Ethereum) BuildBlock(parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error) {
+	eb, err := s.Etherbase()
+	if err != nil {
+		return nil, nil, fmt.Errorf("etherbase missing: %v", err)
+	}
+	return s.handler.downloader.BuildBlock(s.txPool, eb, parentHash, txHashes)
+}
+
+// InsertBlocks imports the blocks built by an external source through the staged sync, bypassing the p2p network
+func (s *Ethereum) InsertBlocks(blocks []*types.Block) (bool, error) {
+	return s.handler.downloader.InsertBlocks(blocks)
+}
+
 func (s *Ethereum) IsMining() bool      { return s.config.Miner.Enabled }
 func (s *Ethereum) Miner() *miner.Miner { return s.miner }
 
@@ -749,6 +831,9 @@ func (s *Ethereum) ArchiveMode() bool { return !s.config.Pruning }
 func (s *Ethereum) Protocols() []p2p.Protocol {
 	headHeight, _ := stages.GetStageProgress(s.chainDb, stages.Finish)
 	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethDialCandidates, s.chainConfig, s.genesisHash, headHeight)
+	if s.config.ServeSnap {
+		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler))...)
+	}
 	return protos
 }
 
@@ -761,6 +846,22 @@ func (s *Ethereum) Start() error {
 	maxPeers := s.p2pServer.MaxPeers
 	// Start the networking layer and the light server if requested
 	s.handler.Start(maxPeers)
+	if metrics.Enabled {
+		go ethdb.CollectMetricsEvery(s.chainKV, 10*time.Second, s.quitDBMetrics)
+	}
+	if s.config.DBStatsInterval > 0 {
+		go ethdb.PersistDBStatsEvery(s.chainKV, s.config.DBStatsInterval, s.quitDBMetrics)
+	}
+	if s.config.DBSpaceWarn > 0 {
+		opts := ethdb.SpaceWatchOpts{Warn: s.config.DBSpaceWarn, GrowBy: s.config.DBAutoGrow}
+		if tiered, ok := s.chainKV.(*ethdb.TieredKV); ok {
+			// The volumes of the hot and the cold database fill up separately
+			go ethdb.WatchSpaceEvery(tiered.Hot(), time.Minute, opts, s.quitDBMetrics)
+			go ethdb.WatchSpaceEvery(tiered.Cold(), time.Minute, opts, s.quitDBMetrics)
+		} else {
+			go ethdb.WatchSpaceEvery(s.chainKV, time.Minute, opts, s.quitDBMetrics)
+		}
+	}
 	return nil
 }
 
@@ -769,6 +870,8 @@ func (s *Ethereum) Start() error {
 func (s *Ethereum) Stop() error {
 	// Stop all the peer-related stuff first.
 	s.handler.Stop()
+	close(s.quitDBMetrics)
+	s.txLookupRebuild.stop()
 	if s.privateAPI != nil {
 		shutdownDone := make(chan bool)
 		go func() {
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// BuildBlock assembles the block the mining cycle would build on top of the parent, which has to be the head of
+// the executed chain: selects the pending transactions of the pool, executes them and calculates the state root.
+// Only the transactions of txHashes are selected, all the pending ones if it is empty. The block is not sealed,
+// and nothing is written to the database.
+func (d *Downloader) BuildBlock(txPool *core.TxPool, coinbase common.Address, parentHash common.Hash, txHashes []common.Hash) (*types.Block, types.Receipts, error) {
+	if d.miningConfig == nil {
+		return nil, nil, fmt.Errorf("mining is not configured")
+	}
+	pending, err := txPool.Pending()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch pending transactions: %w", err)
+	}
+	if len(txHashes) > 0 {
+		if pending, err = selectPending(pending, txHashes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The mining stages write the state of the block into the overlay on top of the read-only transaction, so the
+	// database is neither changed nor locked for the writes of the sync
+	kv := d.stateDB.(ethdb.HasKV).KV()
+	baseTx, err := kv.Begin(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer baseTx.Rollback()
+	tx, err := ethdb.NewObjectDatabase(ethdb.NewOverlayKV(baseTx, kv.AllBuckets())).Begin(context.Background(), ethdb.RW)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	executionAt, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := rawdb.ReadCanonicalHash(tx, executionAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head != parentHash {
+		return nil, nil, fmt.Errorf("the block can only be built on top of the head of the executed chain %x (%d), not %x", head, executionAt, parentHash)
+	}
+
+	cc := &core.TinyChainContext{}
+	cc.SetDB(tx)
+	cc.SetEngine(d.blockchain.Engine())
+	miningConfig := *d.miningConfig
+	miningConfig.Etherbase = coinbase
+	mining := stagedsync.NewMiningStagesParameters(&miningConfig, true, pending, txPool.Locals())
+	miningState, err := stagedsync.New(stagedsync.MiningStages(), stagedsync.MiningUnwindOrder(), stagedsync.OptionalParameters{}).Prepare(
+		d,
+		d.chainConfig,
+		cc,
+		d.blockchain.GetVMConfig(),
+		nil,
+		tx,
+		"",
+		d.storageMode,
+		d.tmpdir,
+		nil,
+		d.batchSize,
+		d.quitCh,
+		nil,
+		txPool,
+		nil,
+		false,
+		mining,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	miningState.DisableStages(stages.MiningFinish)
+	if err = miningState.Run(tx, tx); err != nil {
+		return nil, nil, err
+	}
+	current := mining.Block
+	return types.NewBlock(current.Header, current.Txs, current.Uncles, current.Receipts), current.Receipts, nil
+}
+
+// selectPending keeps only the given transactions of the pending ones, all of them have to be pending
+func selectPending(pending map[common.Address]types.Transactions, txHashes []common.Hash) (map[common.Address]types.Transactions, error) {
+	selected := make(map[common.Hash]bool, len(txHashes))
+	for _, hash := range txHashes {
+		selected[hash] = true
+	}
+	result := make(map[common.Address]types.Transactions)
+	for sender, txs := range pending {
+		for _, txn := range txs {
+			if selected[txn.Hash()] {
+				result[sender] = append(result[sender], txn)
+				delete(selected, txn.Hash())
+			}
+		}
+	}
+	for hash := range selected {
+		return nil, fmt.Errorf("transaction %x is not pending in the pool", hash)
+	}
+	return result, nil
+}
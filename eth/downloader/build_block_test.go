@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/event"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestBuildBlock(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to, coinbase := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}, common.Address{2}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt().SetUint64(1), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, b *core.BlockGen) {
+		b.AddTx(transfer(b.TxNonce(sender)))
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+	head := blocks[len(blocks)-1]
+
+	config := core.DefaultTxPoolConfig
+	config.Journal = false
+	pool := core.NewTxPool(config, gspec.Config, db, nil)
+	if err = pool.Start(head.GasLimit(), head.NumberU64()); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Stop()
+	tx0, tx1 := transfer(2), transfer(3)
+	if errs := pool.AddLocals([]*types.Transaction{tx0, tx1}); errs[0] != nil || errs[1] != nil {
+		t.Fatal(errs)
+	}
+
+	d := New(0, db, new(event.TypeMux), gspec.Config, &params.MiningConfig{GasFloor: head.GasLimit(), GasCeil: head.GasLimit()}, &stagedSyncTester{}, nil, ethdb.DefaultStorageMode)
+	d.SetTmpDir(t.TempDir())
+	if _, _, err = d.BuildBlock(pool, coinbase, genesis.Hash(), nil); err == nil {
+		t.Fatal("expected the block on top of the parent other than the head to fail")
+	}
+	if _, _, err = d.BuildBlock(pool, coinbase, head.Hash(), []common.Hash{{1}}); err == nil {
+		t.Fatal("expected the selection of the transaction not in the pool to fail")
+	}
+
+	block, receipts, err := d.BuildBlock(pool, coinbase, head.Hash(), []common.Hash{tx0.Hash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.NumberU64() != head.NumberU64()+1 || block.ParentHash() != head.Hash() || block.Coinbase() != coinbase {
+		t.Fatalf("unexpected block %d on top of %x by %x", block.NumberU64(), block.ParentHash(), block.Coinbase())
+	}
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != tx0.Hash() {
+		t.Fatalf("expected only the selected transaction, got %d", len(block.Transactions()))
+	}
+	if len(receipts) != 1 || receipts[0].Status != types.ReceiptStatusSuccessful || block.GasUsed() != params.TxGas {
+		t.Fatalf("unexpected receipts %v, gas used %d", receipts, block.GasUsed())
+	}
+
+	// Nothing is written, the block is the valid successor of the head
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), []*types.Block{block}, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+}
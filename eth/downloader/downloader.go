@@ -167,6 +167,9 @@ type Downloader struct {
 	cacheSize   datasize.ByteSize
 	batchSize   datasize.ByteSize
 
+	durability     ethdb.Durability // Fsync policy of the database near the head
+	bulkDurability ethdb.Durability // Fsync policy of the database far behind the head
+
 	headersState    *stagedsync.StageState
 	headersUnwinder stagedsync.Unwinder
 
@@ -285,6 +288,12 @@ func (d *Downloader) SetBatchSize(cacheSize, batchSize datasize.ByteSize) {
 	d.batchSize = batchSize
 }
 
+// SetDurability sets the fsync policies of the database for the cycles near the head and far behind it
+func (d *Downloader) SetDurability(durability, bulkDurability ethdb.Durability) {
+	d.durability = durability
+	d.bulkDurability = bulkDurability
+}
+
 func (d *Downloader) SetChainConfig(chainConfig *params.ChainConfig) {
 	d.chainConfig = chainConfig
 }
@@ -525,6 +534,15 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, blockNumb
 		canRunCycleInOneTransaction := height-origin < 1024 && height-hashStateStageProgress < 1024
 		syncCycleStart := time.Now()
 
+		// The cycles far behind the head are the bulk sync, which can be redone after a crash
+		durability := d.durability
+		if !canRunCycleInOneTransaction {
+			durability = d.bulkDurability
+		}
+		if err = ethdb.SetDurability(d.stateDB, durability); err != nil {
+			return err
+		}
+
 		var writeDB ethdb.Database // on this variable will run sync cycle.
 
 		// create empty TxDb object, it's not usable before .Begin() call which will use this object
@@ -579,7 +597,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, blockNumb
 
 			var errTx error
 			log.Debug("Begin tx")
-			tx, errTx = tx.Begin(context.Background(), ethdb.RW)
+			tx, errTx = tx.Begin(d.stagedSyncState.Context(), ethdb.RW)
 			return errTx
 		})
 		d.stagedSyncState.OnBeforeUnwind(func(id stages.SyncStage) error {
@@ -594,7 +612,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, blockNumb
 			}
 			var errTx error
 			log.Debug("Begin tx")
-			tx, errTx = tx.Begin(context.Background(), ethdb.RW)
+			tx, errTx = tx.Begin(d.stagedSyncState.Context(), ethdb.RW)
 			return errTx
 		})
 		d.stagedSyncState.BeforeStageUnwind(stages.Bodies, func() error {
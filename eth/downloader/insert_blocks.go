@@ -0,0 +1,40 @@
+package downloader
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+)
+
+// InsertBlocks validates the given contiguous chain of blocks, submitted by an external block source rather than
+// downloaded from the peers, and imports it through the staged sync pipeline. The chain must extend a known block,
+// the headers are verified by the consensus engine, the bodies against the headers, and the blocks are executed
+// checking the state roots. It returns whether the blocks became the canonical chain, and errBusy if a sync
+// cycle is running.
+func (d *Downloader) InsertBlocks(blocks []*types.Block) (bool, error) {
+	if !atomic.CompareAndSwapInt32(&d.synchronising, 0, 1) {
+		return false, errBusy
+	}
+	defer atomic.StoreInt32(&d.synchronising, 0)
+
+	for i, block := range blocks {
+		if i > 0 && (block.NumberU64() != blocks[i-1].NumberU64()+1 || block.ParentHash() != blocks[i-1].Hash()) {
+			return false, fmt.Errorf("non contiguous block %d [%x…] after %d [%x…]", block.NumberU64(), block.Hash().Bytes()[:4],
+				blocks[i-1].NumberU64(), blocks[i-1].Hash().Bytes()[:4])
+		}
+		if hash := types.DeriveSha(block.Transactions()); hash != block.TxHash() {
+			return false, fmt.Errorf("block %d: transaction root hash mismatch: have %x, want %x", block.NumberU64(), hash, block.TxHash())
+		}
+		if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+			return false, fmt.Errorf("block %d: uncle root hash mismatch: have %x, want %x", block.NumberU64(), hash, block.UncleHash())
+		}
+	}
+	if len(blocks) > 0 && rawdb.ReadHeader(d.stateDB, blocks[0].ParentHash(), blocks[0].NumberU64()-1) == nil {
+		return false, fmt.Errorf("block %d: %w", blocks[0].NumberU64(), consensus.ErrUnknownAncestor)
+	}
+	return stagedsync.InsertBlocksInStages(d.stateDB, d.storageMode, d.chainConfig, d.blockchain.GetVMConfig(), d.blockchain.Engine(), blocks, true /* checkRoot */)
+}
@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/event"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestInsertBlocks(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt().SetUint64(1), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := New(0, db, new(event.TypeMux), gspec.Config, nil, &stagedSyncTester{}, nil, ethdb.DefaultStorageMode)
+	if _, err = d.InsertBlocks(blocks[1:]); !errors.Is(err, consensus.ErrUnknownAncestor) {
+		t.Fatalf("expected the unknown ancestor error, got %v", err)
+	}
+	if _, err = d.InsertBlocks([]*types.Block{blocks[0], blocks[2]}); err == nil {
+		t.Fatal("expected the non contiguous blocks to fail")
+	}
+	// The body not matching the header
+	forged := types.NewBlockWithHeader(blocks[0].Header()).WithBody(blocks[1].Transactions(), nil)
+	if _, err = d.InsertBlocks([]*types.Block{forged}); err == nil {
+		t.Fatal("expected the block with the transactions not matching the header to fail")
+	}
+	// The header not matching the state after the execution
+	header := blocks[0].Header()
+	header.Root = common.Hash{1}
+	if _, err = d.InsertBlocks([]*types.Block{types.NewBlockWithHeader(header).WithBody(blocks[0].Transactions(), nil)}); err == nil {
+		t.Fatal("expected the block with the wrong state root to fail")
+	}
+	if hash, _ := rawdb.ReadCanonicalHash(db, 1); hash != (common.Hash{}) {
+		t.Fatalf("nothing is expected to be inserted, got block 1 %x", hash)
+	}
+
+	canonical, err := d.InsertBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canonical {
+		t.Fatal("expected the blocks to become the canonical chain")
+	}
+	head := rawdb.ReadHeadBlockHash(db)
+	if head != blocks[2].Hash() {
+		t.Fatalf("unexpected head %x, want %x", head, blocks[2].Hash())
+	}
+	if progress, _ := stages.GetStageProgress(db, stages.Finish); progress != 3 {
+		t.Fatalf("unexpected sync progress %d", progress)
+	}
+}
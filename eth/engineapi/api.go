@@ -0,0 +1,313 @@
+// Package engineapi implements the engine API, through which a consensus client
+// drives the execution of the chain after the merge: it inserts the execution
+// payloads and chooses the head of the chain.
+package engineapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// The statuses of the payloads and of the fork choice updates
+const (
+	StatusValid            = "VALID"
+	StatusInvalid          = "INVALID"
+	StatusSyncing          = "SYNCING"            // The ancestors of the block are unknown
+	StatusAccepted         = "ACCEPTED"           // The block is on a side chain, executed if it's chosen as the head
+	StatusInvalidBlockHash = "INVALID_BLOCK_HASH" // The hash of the payload doesn't match its fields
+)
+
+// maxPendingBlocks is the number of the side chain blocks kept in memory until the fork choice
+const maxPendingBlocks = 1024
+
+// ExecutionPayload is the block the consensus client inserts, without the fields of the proof-of-work
+type ExecutionPayload struct {
+	ParentHash    common.Hash     `json:"parentHash"`
+	FeeRecipient  common.Address  `json:"feeRecipient"`
+	StateRoot     common.Hash     `json:"stateRoot"`
+	ReceiptsRoot  common.Hash     `json:"receiptsRoot"`
+	LogsBloom     hexutil.Bytes   `json:"logsBloom"`
+	Random        common.Hash     `json:"random"`
+	BlockNumber   hexutil.Uint64  `json:"blockNumber"`
+	GasLimit      hexutil.Uint64  `json:"gasLimit"`
+	GasUsed       hexutil.Uint64  `json:"gasUsed"`
+	Timestamp     hexutil.Uint64  `json:"timestamp"`
+	ExtraData     hexutil.Bytes   `json:"extraData"`
+	BaseFeePerGas *hexutil.Big    `json:"baseFeePerGas"`
+	BlockHash     common.Hash     `json:"blockHash"`
+	Transactions  []hexutil.Bytes `json:"transactions"`
+}
+
+// ForkchoiceState is the head of the chain chosen by the consensus client, with its safe and finalized ancestors
+type ForkchoiceState struct {
+	HeadBlockHash      common.Hash `json:"headBlockHash"`
+	SafeBlockHash      common.Hash `json:"safeBlockHash"`
+	FinalizedBlockHash common.Hash `json:"finalizedBlockHash"`
+}
+
+// PayloadStatus is the result of the insertion of a payload or of a fork choice update. LatestValidHash is the hash
+// of the last valid block of the chain of the payload, ValidationError explains why the payload is invalid
+type PayloadStatus struct {
+	Status          string       `json:"status"`
+	LatestValidHash *common.Hash `json:"latestValidHash"`
+	ValidationError *string      `json:"validationError"`
+}
+
+// ForkchoiceUpdatedResult is the result of a fork choice update
+type ForkchoiceUpdatedResult struct {
+	PayloadStatus PayloadStatus `json:"payloadStatus"`
+}
+
+func validStatus(hash common.Hash) *PayloadStatus {
+	return &PayloadStatus{Status: StatusValid, LatestValidHash: &hash}
+}
+
+func invalidStatus(status string, latestValid common.Hash, err error) *PayloadStatus {
+	msg := err.Error()
+	return &PayloadStatus{Status: status, LatestValidHash: &latestValid, ValidationError: &msg}
+}
+
+// API is the engine API, it is served on the authenticated endpoint only. The payload extending the head is executed
+// by the stages at once and becomes the head, the payloads of the side chains are kept until the consensus client
+// chooses them and the stages are unwound to the fork point. The headers are not verified by the consensus engine of
+// the node and the blocks are finalized by it without the block and uncle rewards, see postMergeEngine
+type API struct {
+	db          ethdb.Database
+	chainConfig *params.ChainConfig
+	engine      consensus.Engine
+	storageMode ethdb.StorageMode
+
+	lock    sync.Mutex
+	pending map[common.Hash]*types.Block // Side chain blocks, executed when they become canonical
+}
+
+// NewAPI creates the engine API inserting the blocks into the database.
+func NewAPI(db ethdb.Database, chainConfig *params.ChainConfig, engine consensus.Engine, storageMode ethdb.StorageMode) *API {
+	return &API{
+		db:          db,
+		chainConfig: chainConfig,
+		engine:      postMergeEngine{engine},
+		storageMode: storageMode,
+		pending:     make(map[common.Hash]*types.Block),
+	}
+}
+
+// NewPayload inserts the payload. It is executed if it extends the head, which it becomes.
+func (api *API) NewPayload(_ context.Context, payload ExecutionPayload) (*PayloadStatus, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	block, err := payloadToBlock(&payload)
+	if err != nil {
+		return invalidStatus(StatusInvalid, payload.ParentHash, err), nil
+	}
+	if hash := block.Hash(); hash != payload.BlockHash {
+		return invalidStatus(StatusInvalidBlockHash, payload.ParentHash, fmt.Errorf("block hash mismatch: %x != %x", hash, payload.BlockHash)), nil
+	}
+	number := block.NumberU64()
+	if rawdb.ReadHeader(api.db, block.Hash(), number) != nil {
+		return validStatus(block.Hash()), nil
+	}
+	if _, ok := api.pending[block.Hash()]; ok {
+		return &PayloadStatus{Status: StatusAccepted}, nil
+	}
+	parent := rawdb.ReadHeader(api.db, block.ParentHash(), number-1)
+	if parent == nil {
+		if pendingParent, ok := api.pending[block.ParentHash()]; ok {
+			parent = pendingParent.Header()
+		}
+	}
+	if parent == nil {
+		return &PayloadStatus{Status: StatusSyncing}, nil
+	}
+	if err = verifyHeader(block.Header(), parent); err != nil {
+		return invalidStatus(StatusInvalid, block.ParentHash(), err), nil
+	}
+	if block.ParentHash() != rawdb.ReadHeadHeaderHash(api.db) {
+		api.addPending(block)
+		return &PayloadStatus{Status: StatusAccepted}, nil
+	}
+	if err = api.insert([]*types.Block{block}); err != nil {
+		log.Warn("Invalid payload", "number", number, "hash", block.Hash(), "err", err)
+		return invalidStatus(StatusInvalid, block.ParentHash(), err), nil
+	}
+	return validStatus(block.Hash()), nil
+}
+
+// ForkchoiceUpdated makes the given block the head, unwinding the stages to the fork point and executing the side
+// chain blocks of the new head. The blocks kept for the side chains up to the finalized one are dropped
+func (api *API) ForkchoiceUpdated(_ context.Context, state ForkchoiceState) (*ForkchoiceUpdatedResult, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	status, err := api.forkchoice(state.HeadBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status == StatusValid && state.FinalizedBlockHash != (common.Hash{}) {
+		if number := rawdb.ReadHeaderNumber(api.db, state.FinalizedBlockHash); number != nil {
+			for hash, block := range api.pending {
+				if block.NumberU64() <= *number {
+					delete(api.pending, hash)
+				}
+			}
+		}
+	}
+	return &ForkchoiceUpdatedResult{PayloadStatus: *status}, nil
+}
+
+func (api *API) forkchoice(head common.Hash) (*PayloadStatus, error) {
+	if head == rawdb.ReadHeadHeaderHash(api.db) {
+		return validStatus(head), nil
+	}
+	// The ancestor of the head becomes the head
+	if number := rawdb.ReadHeaderNumber(api.db, head); number != nil {
+		canonical, err := rawdb.ReadCanonicalHash(api.db, *number)
+		if err != nil {
+			return nil, err
+		}
+		if canonical == head {
+			if err = stagedsync.SetHead(api.db, api.chainConfig, &vm.Config{}, api.engine, *number, true /* checkRoot */); err != nil {
+				return nil, err
+			}
+			return validStatus(head), nil
+		}
+	}
+	// The side chain becomes canonical
+	var blocks []*types.Block
+	for hash := head; ; {
+		block, ok := api.pending[hash]
+		if !ok {
+			if block = api.sideBlock(hash); block == nil {
+				break
+			}
+		}
+		blocks = append([]*types.Block{block}, blocks...)
+		hash = block.ParentHash()
+	}
+	if len(blocks) == 0 {
+		return &PayloadStatus{Status: StatusSyncing}, nil
+	}
+	forkPoint := blocks[0].ParentHash()
+	if rawdb.ReadHeader(api.db, forkPoint, blocks[0].NumberU64()-1) == nil {
+		return &PayloadStatus{Status: StatusSyncing}, nil
+	}
+	if err := api.insert(blocks); err != nil {
+		log.Warn("Invalid fork choice", "number", blocks[len(blocks)-1].NumberU64(), "hash", head, "err", err)
+		return invalidStatus(StatusInvalid, forkPoint, err), nil
+	}
+	for _, block := range blocks {
+		delete(api.pending, block.Hash())
+	}
+	return validStatus(head), nil
+}
+
+// sideBlock reads the block of a side chain inserted earlier, e.g. unwound by a reorg, nil if it's unknown or canonical
+func (api *API) sideBlock(hash common.Hash) *types.Block {
+	number := rawdb.ReadHeaderNumber(api.db, hash)
+	if number == nil {
+		return nil
+	}
+	if canonical, err := rawdb.ReadCanonicalHash(api.db, *number); err != nil || canonical == hash {
+		return nil
+	}
+	return rawdb.ReadBlock(api.db, hash, *number)
+}
+
+// insert makes the blocks canonical and executes them
+func (api *API) insert(blocks []*types.Block) error {
+	return stagedsync.InsertBlocksByForkChoice(api.db, api.storageMode, api.chainConfig, &vm.Config{}, api.engine, blocks, true /* checkRoot */)
+}
+
+// postMergeEngine is the consensus engine of the node finalizing the blocks after the merge, which are not rewarded
+type postMergeEngine struct {
+	consensus.Engine
+}
+
+func (postMergeEngine) Finalize(*params.ChainConfig, *types.Header, *state.IntraBlockState, []*types.Transaction, []*types.Header) {
+}
+
+func (postMergeEngine) FinalizeAndAssemble(_ *params.ChainConfig, header *types.Header, _ *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	return types.NewBlock(header, txs, uncles, receipts), nil
+}
+
+func (api *API) addPending(block *types.Block) {
+	if len(api.pending) >= maxPendingBlocks {
+		// Drop the lowest block, the side chains are expected to be chosen or finalized away quickly
+		var lowest *types.Block
+		for _, b := range api.pending {
+			if lowest == nil || b.NumberU64() < lowest.NumberU64() {
+				lowest = b
+			}
+		}
+		delete(api.pending, lowest.Hash())
+	}
+	api.pending[block.Hash()] = block
+}
+
+// payloadToBlock assembles the block of the payload, with no uncles and the Random in place of the MixDigest
+func payloadToBlock(payload *ExecutionPayload) (*types.Block, error) {
+	txs := make([]*types.Transaction, len(payload.Transactions))
+	for i, enc := range payload.Transactions {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(enc); err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		txs[i] = tx
+	}
+	if len(payload.LogsBloom) != types.BloomByteLength {
+		return nil, fmt.Errorf("invalid logs bloom length %d", len(payload.LogsBloom))
+	}
+	header := &types.Header{
+		ParentHash:  payload.ParentHash,
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    payload.FeeRecipient,
+		Root:        payload.StateRoot,
+		TxHash:      types.DeriveSha(types.Transactions(txs)),
+		ReceiptHash: payload.ReceiptsRoot,
+		Bloom:       types.BytesToBloom(payload.LogsBloom),
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int).SetUint64(uint64(payload.BlockNumber)),
+		GasLimit:    uint64(payload.GasLimit),
+		GasUsed:     uint64(payload.GasUsed),
+		Time:        uint64(payload.Timestamp),
+		Extra:       payload.ExtraData,
+		MixDigest:   payload.Random,
+	}
+	if payload.BaseFeePerGas != nil {
+		header.BaseFee = payload.BaseFeePerGas.ToInt()
+	}
+	return types.NewBlockWithHeader(header).WithBody(txs, nil), nil
+}
+
+// verifyHeader checks the fields of the header which are not checked by the execution
+func verifyHeader(header, parent *types.Header) error {
+	if header.Number.Uint64() != parent.Number.Uint64()+1 {
+		return errors.New("invalid block number")
+	}
+	if header.Time <= parent.Time {
+		return errors.New("timestamp not after the parent")
+	}
+	if len(header.Extra) > int(params.MaximumExtraDataSize) {
+		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), params.MaximumExtraDataSize)
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("invalid gas used: %d > %d", header.GasUsed, header.GasLimit)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package engineapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/stretchr/testify/require"
+)
+
+func blockToPayload(t *testing.T, block *types.Block) ExecutionPayload {
+	payload := ExecutionPayload{
+		ParentHash:   block.ParentHash(),
+		FeeRecipient: block.Coinbase(),
+		StateRoot:    block.Root(),
+		ReceiptsRoot: block.ReceiptHash(),
+		LogsBloom:    block.Bloom().Bytes(),
+		Random:       block.MixDigest(),
+		BlockNumber:  hexutil.Uint64(block.NumberU64()),
+		GasLimit:     hexutil.Uint64(block.GasLimit()),
+		GasUsed:      hexutil.Uint64(block.GasUsed()),
+		Timestamp:    hexutil.Uint64(block.Time()),
+		ExtraData:    block.Extra(),
+		BlockHash:    block.Hash(),
+	}
+	if block.BaseFee() != nil {
+		payload.BaseFeePerGas = (*hexutil.Big)(block.BaseFee())
+	}
+	for _, tx := range block.Transactions() {
+		enc, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		payload.Transactions = append(payload.Transactions, enc)
+	}
+	return payload
+}
+
+// generateChain generates the blocks without the proof-of-work and the rewards on top of the genesis
+func generateChain(t *testing.T, gspec *core.Genesis, genesis *types.Block, n int, gen func(int, *core.BlockGen)) []*types.Block {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	gspec.MustCommit(db)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, postMergeEngine{ethash.NewFaker()}, db, n, func(i int, b *core.BlockGen) {
+		b.SetDifficulty(new(big.Int))
+		gen(i, b)
+	}, false)
+	require.NoError(t, err)
+	return blocks
+}
+
+func TestEngineAPI(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+
+	// The chain A with the transfers and the competing chain B, without the proof-of-work
+	chainA := generateChain(t, gspec, genesis, 2, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), common.Address{1}, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt().SetUint64(1), nil), signer, key)
+		require.NoError(t, err)
+		b.AddTx(tx)
+	})
+	chainB := generateChain(t, gspec, genesis, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.Address{2})
+	})
+
+	api := NewAPI(db, gspec.Config, ethash.NewFaker(), ethdb.DefaultStorageMode)
+	ctx := context.Background()
+	head := func() common.Hash { return rawdb.ReadHeadHeaderHash(db) }
+
+	// The payloads extending the head are executed
+	for _, block := range chainA {
+		status, err := api.NewPayload(ctx, blockToPayload(t, block))
+		require.NoError(t, err)
+		require.Equal(t, StatusValid, status.Status, "block %d", block.NumberU64())
+		require.Equal(t, block.Hash(), head())
+	}
+
+	// The side chain is executed when it's chosen
+	status, err := api.NewPayload(ctx, blockToPayload(t, chainB[0]))
+	require.NoError(t, err)
+	require.Equal(t, StatusAccepted, status.Status)
+	require.Equal(t, chainA[1].Hash(), head())
+
+	result, err := api.ForkchoiceUpdated(ctx, ForkchoiceState{HeadBlockHash: chainB[0].Hash()})
+	require.NoError(t, err)
+	require.Equal(t, StatusValid, result.PayloadStatus.Status)
+	require.Equal(t, chainB[0].Hash(), head())
+	canonical, err := rawdb.ReadCanonicalHash(db, 2)
+	require.NoError(t, err)
+	require.Equal(t, common.Hash{}, canonical)
+
+	// Back to the chain A, which was unwound
+	result, err = api.ForkchoiceUpdated(ctx, ForkchoiceState{HeadBlockHash: chainA[1].Hash()})
+	require.NoError(t, err)
+	require.Equal(t, StatusValid, result.PayloadStatus.Status)
+	require.Equal(t, chainA[1].Hash(), head())
+
+	// The ancestor of the head
+	result, err = api.ForkchoiceUpdated(ctx, ForkchoiceState{HeadBlockHash: chainA[0].Hash()})
+	require.NoError(t, err)
+	require.Equal(t, StatusValid, result.PayloadStatus.Status)
+	require.Equal(t, chainA[0].Hash(), head())
+
+	// The unknown head
+	result, err = api.ForkchoiceUpdated(ctx, ForkchoiceState{HeadBlockHash: common.Hash{3}})
+	require.NoError(t, err)
+	require.Equal(t, StatusSyncing, result.PayloadStatus.Status)
+}
+
+func TestEngineAPIInvalidPayloads(t *testing.T) {
+	gspec := &core.Genesis{Config: params.TestChainConfig}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	chain := generateChain(t, gspec, genesis, 1, func(int, *core.BlockGen) {})
+	api := NewAPI(db, gspec.Config, ethash.NewFaker(), ethdb.DefaultStorageMode)
+	ctx := context.Background()
+
+	payload := blockToPayload(t, chain[0])
+	payload.BlockHash = common.Hash{1}
+	status, err := api.NewPayload(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, StatusInvalidBlockHash, status.Status)
+
+	payload = blockToPayload(t, chain[0])
+	payload.ParentHash = common.Hash{1}
+	block, err := payloadToBlock(&payload)
+	require.NoError(t, err)
+	payload.BlockHash = block.Hash()
+	status, err = api.NewPayload(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, StatusSyncing, status.Status)
+
+	// The state root doesn't match the execution
+	payload = blockToPayload(t, chain[0])
+	payload.StateRoot = common.Hash{1}
+	block, err = payloadToBlock(&payload)
+	require.NoError(t, err)
+	payload.BlockHash = block.Hash()
+	status, err = api.NewPayload(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, StatusInvalid, status.Status)
+	require.Equal(t, genesis.Hash(), *status.LatestValidHash)
+	require.Equal(t, genesis.Hash(), rawdb.ReadHeadHeaderHash(db))
+}
+
+func TestEngineAPINoRewards(t *testing.T) {
+	gspec := &core.Genesis{Config: params.TestChainConfig}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	coinbase := common.Address{9}
+	setCoinbase := func(_ int, b *core.BlockGen) {
+		b.SetDifficulty(new(big.Int))
+		b.SetCoinbase(coinbase)
+	}
+	api := NewAPI(db, gspec.Config, ethash.NewFaker(), ethdb.DefaultStorageMode)
+	ctx := context.Background()
+
+	// The payload rewarded like the proof-of-work block doesn't match the execution
+	rewardedDB := ethdb.NewMemDatabase()
+	defer rewardedDB.Close()
+	gspec.MustCommit(rewardedDB)
+	rewarded, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), rewardedDB, 1, setCoinbase, false)
+	require.NoError(t, err)
+	status, err := api.NewPayload(ctx, blockToPayload(t, rewarded[0]))
+	require.NoError(t, err)
+	require.Equal(t, StatusInvalid, status.Status)
+
+	chain := generateChain(t, gspec, genesis, 1, setCoinbase)
+	status, err = api.NewPayload(ctx, blockToPayload(t, chain[0]))
+	require.NoError(t, err)
+	require.Equal(t, StatusValid, status.Status)
+	account, err := state.NewPlainStateReader(db).ReadAccountData(coinbase)
+	require.NoError(t, err)
+	require.Nil(t, account, "the fee recipient is rewarded")
+}
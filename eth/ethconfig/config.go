@@ -29,6 +29,8 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/aura"
+	"github.com/ledgerwatch/turbo-geth/consensus/bor"
 	"github.com/ledgerwatch/turbo-geth/consensus/clique"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
@@ -84,6 +86,7 @@ var Defaults = Config{
 	RPCGasCap:   25000000,
 	GPO:         FullNodeGPO,
 	RPCTxFeeCap: 1, // 1 ether
+	HeimdallURL: "http://localhost:1317",
 }
 
 func init() {
@@ -157,6 +160,9 @@ type Config struct {
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
 	DatabaseFreezer    string
+	DBStatsInterval    time.Duration     `toml:"-"` // Interval of persisting the sizes of the buckets, 0 disables
+	DBSpaceWarn        datasize.ByteSize `toml:"-"` // Space left to the database below which it's logged, 0 disables the watch
+	DBAutoGrow         datasize.ByteSize `toml:"-"` // Step of raising the max size of the database close to it, 0 disables
 
 	TrieCleanCache          int
 	TrieCleanCacheJournal   string        `toml:",omitempty"` // Disk journal directory for trie cache to survive node restarts
@@ -184,6 +190,16 @@ type Config struct {
 	// Enables the dbg protocol
 	EnableDebugProtocol bool
 
+	// Serves the state of the last block with intermediate hashes over the snap protocol
+	ServeSnap bool
+
+	// Bor options
+	HeimdallURL     string // URL of the REST server of Heimdall the spans and the state sync events are fetched from
+	WithoutHeimdall bool   // Runs bor without Heimdall, with the validators of the genesis
+
+	// Address of the gRPC server of the external consensus engine, replacing the engine of the chain config if set
+	ExternalConsensus string
+
 	// Miscellaneous options
 	DocRoot string `toml:"-"`
 
@@ -200,17 +216,36 @@ type Config struct {
 	// CheckpointOracle is the configuration for checkpoint oracle.
 	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
 
-	// Berlin block override (TODO: remove after the fork)
-	StagedSync     *stagedsync.StagedSync `toml:"-"`
-	OverrideBerlin *big.Int               `toml:",omitempty"`
+	StagedSync *stagedsync.StagedSync `toml:"-"`
+
+	// Ancients is the store of the ancient blocks moved out of the database, the chain database reads them through
+	Ancients ethdb.AncientReader `toml:"-"`
+
+	// Changesets is the archive of the changesets pruned from the database, the lookups of the history read them from it
+	Changesets ethdb.ChangesetArchive `toml:"-"`
+
+	// Overrides reschedules the forks of the chain config, e.g. for the shadow forks
+	Overrides *params.ChainOverrides `toml:",omitempty"`
 }
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
-func CreateConsensusEngine(chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
+// The bor engine fetches the spans and the state sync events from the Heimdall at
+// heimdallURL, it runs without Heimdall when the url is empty.
+func CreateConsensusEngine(chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, heimdallURL string, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
 	if chainConfig.Clique != nil {
 		return clique.New(chainConfig.Clique, db)
 	}
+	if chainConfig.Aura != nil {
+		return aura.New(chainConfig.Aura, db)
+	}
+	if chainConfig.Bor != nil {
+		var heimdall bor.HeimdallClient
+		if heimdallURL != "" {
+			heimdall = bor.NewHeimdallClient(heimdallURL)
+		}
+		return bor.New(chainConfig, db, heimdall)
+	}
 	// Otherwise assume proof-of-work
 	switch config.PowMode {
 	case ethash.ModeFake:
@@ -17,6 +17,7 @@
 package filters
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -112,16 +113,17 @@ func (api *PublicFilterAPI) Close() {
 }
 
 // NewPendingTransactionFilter creates a filter that fetches pending transaction hashes
-// as transactions enter the pending state.
+// as transactions enter the pending state. The optional criteria restrict the filter to
+// the matching transactions, so the client doesn't have to process the whole pool.
 //
 // It is part of the filter package because this filter can be used through the
 // `eth_getFilterChanges` polling method that is also used for log filters.
 //
 // https://eth.wiki/json-rpc/API#eth_newpendingtransactionfilter
-func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
+func (api *PublicFilterAPI) NewPendingTransactionFilter(crit *PendingTxCriteria) rpc.ID {
 	var (
 		pendingTxs   = make(chan []common.Hash)
-		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
+		pendingTxSub = api.events.SubscribePendingTxs(crit, pendingTxs)
 	)
 
 	api.filtersMu.Lock()
@@ -153,7 +155,8 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// The optional criteria restrict the subscription to the matching transactions.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, crit *PendingTxCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -163,7 +166,7 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 
 	go func() {
 		txHashes := make(chan []common.Hash, 128)
-		pendingTxSub := api.events.SubscribePendingTxs(txHashes)
+		pendingTxSub := api.events.SubscribePendingTxs(crit, txHashes)
 
 		for {
 			select {
@@ -301,6 +304,46 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria ethereum.FilterQuery
 
+// PendingTxCriteria restricts the transactions reported by a pending transaction filter
+// or subscription. A transaction matches if it satisfies all the given conditions, empty
+// criteria match every transaction.
+type PendingTxCriteria struct {
+	To          []common.Address `json:"to"`          // recipient is one of the addresses
+	Selector    hexutil.Bytes    `json:"selector"`    // call data starts with the given prefix (e.g. 4-byte method selector)
+	MinValue    *hexutil.Big     `json:"minValue"`    // transferred value is at least the given amount
+	MinGasPrice *hexutil.Big     `json:"minGasPrice"` // gas price (fee cap of dynamic fee transactions) is at least the given amount
+}
+
+// Matches reports whether the transaction satisfies the criteria
+func (crit *PendingTxCriteria) Matches(tx *types.Transaction) bool {
+	if len(crit.To) > 0 {
+		to := tx.To()
+		if to == nil {
+			return false
+		}
+		var found bool
+		for _, addr := range crit.To {
+			if addr == *to {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(crit.Selector) > 0 && !bytes.HasPrefix(tx.Data(), crit.Selector) {
+		return false
+	}
+	if crit.MinValue != nil && tx.Value().ToBig().Cmp(crit.MinValue.ToInt()) < 0 {
+		return false
+	}
+	if crit.MinGasPrice != nil && tx.GasPrice().ToBig().Cmp(crit.MinGasPrice.ToInt()) < 0 {
+		return false
+	}
+	return true
+}
+
 // NewFilter creates a new filter and returns the filter id. It can be
 // used to retrieve logs when the state changes. This method cannot be
 // used to fetch logs that are already stored in the state.
@@ -71,6 +71,7 @@ type subscription struct {
 	typ       Type
 	created   time.Time
 	logsCrit  ethereum.FilterQuery
+	txsCrit   *PendingTxCriteria
 	logs      chan []*types.Log
 	hashes    chan []common.Hash
 	headers   chan *types.Header
@@ -286,12 +287,14 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 }
 
 // SubscribePendingTxs creates a subscription that writes transaction hashes for
-// transactions that enter the transaction pool.
-func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscription {
+// transactions that enter the transaction pool and match the given criteria (all
+// the transactions if crit is nil).
+func (es *EventSystem) SubscribePendingTxs(crit *PendingTxCriteria, hashes chan []common.Hash) *Subscription {
 	sub := &subscription{
 		id:        rpc.NewID(),
 		typ:       PendingTransactionsSubscription,
 		created:   time.Now(),
+		txsCrit:   crit,
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.Header),
@@ -337,12 +340,27 @@ func (es *EventSystem) handleRemovedLogs(filters filterIndex, ev core.RemovedLog
 }
 
 func (es *EventSystem) handleTxsEvent(filters filterIndex, ev core.NewTxsEvent) {
+	if len(filters[PendingTransactionsSubscription]) == 0 {
+		return
+	}
 	hashes := make([]common.Hash, 0, len(ev.Txs))
 	for _, tx := range ev.Txs {
 		hashes = append(hashes, tx.Hash())
 	}
 	for _, f := range filters[PendingTransactionsSubscription] {
-		f.hashes <- hashes
+		if f.txsCrit == nil {
+			f.hashes <- hashes
+			continue
+		}
+		var matched []common.Hash
+		for i, tx := range ev.Txs {
+			if f.txsCrit.Matches(tx) {
+				matched = append(matched, hashes[i])
+			}
+		}
+		if len(matched) > 0 {
+			f.hashes <- matched
+		}
 	}
 }
 
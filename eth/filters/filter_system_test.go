@@ -29,6 +29,7 @@ import (
 	"github.com/holiman/uint256"
 	ethereum "github.com/ledgerwatch/turbo-geth"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/bloombits"
@@ -244,7 +245,7 @@ func TestPendingTxFilter(t *testing.T) {
 		hashes []common.Hash
 	)
 
-	fid0 := api.NewPendingTransactionFilter()
+	fid0 := api.NewPendingTransactionFilter(nil)
 
 	time.Sleep(1 * time.Second)
 	backend.txFeed.Send(core.NewTxsEvent{Txs: transactions})
@@ -280,6 +281,60 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestPendingTxFilterCriteria tests whether pending tx filters with criteria retrieve only the matching transactions.
+func TestPendingTxFilterCriteria(t *testing.T) {
+	t.Parallel()
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	var (
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, deadline)
+
+		target = common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268")
+		other  = common.HexToAddress("0x0000000000000000000000000000000000000001")
+
+		transactions = []*types.Transaction{
+			types.NewTransaction(0, target, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb, 0x01}),
+			types.NewTransaction(1, other, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+			types.NewTransaction(2, target, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0x09, 0x5e, 0xa7, 0xb3}),
+			types.NewTransaction(3, target, uint256.NewInt().SetUint64(1), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+			types.NewTransaction(4, target, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(1), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+			types.NewContractCreation(5, uint256.NewInt().SetUint64(100), 0, uint256.NewInt().SetUint64(10), []byte{0xa9, 0x05, 0x9c, 0xbb}),
+		}
+
+		hashes []common.Hash
+	)
+
+	fid0 := api.NewPendingTransactionFilter(&PendingTxCriteria{
+		To:          []common.Address{target},
+		Selector:    []byte{0xa9, 0x05, 0x9c, 0xbb},
+		MinValue:    (*hexutil.Big)(big.NewInt(50)),
+		MinGasPrice: (*hexutil.Big)(big.NewInt(5)),
+	})
+
+	time.Sleep(1 * time.Second)
+	backend.txFeed.Send(core.NewTxsEvent{Txs: transactions})
+
+	timeout := time.Now().Add(1 * time.Second)
+	for time.Now().Before(timeout) {
+		results, err := api.GetFilterChanges(fid0)
+		if err != nil {
+			t.Fatalf("Unable to retrieve transactions: %v", err)
+		}
+		hashes = append(hashes, results.([]common.Hash)...)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if len(hashes) != 1 {
+		t.Fatalf("invalid number of transactions, want 1 transaction, got %d", len(hashes))
+	}
+	if hashes[0] != transactions[0].Hash() {
+		t.Errorf("invalid transaction, want %x, got %x", transactions[0].Hash(), hashes[0])
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -656,7 +711,7 @@ func TestPendingTxFilterDeadlock(t *testing.T) {
 	// timeout either in 100ms or 200ms
 	fids := make([]rpc.ID, 20)
 	for i := 0; i < len(fids); i++ {
-		fid := api.NewPendingTransactionFilter()
+		fid := api.NewPendingTransactionFilter(nil)
 		fids[i] = fid
 		// Wait for at least one tx to arrive in filter
 		for {
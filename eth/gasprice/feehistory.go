@@ -0,0 +1,203 @@
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// maxFeeHistory is the maximum number of blocks which can be requested by a single FeeHistory call
+const maxFeeHistory = 1024
+
+var (
+	errInvalidPercentile = errors.New("invalid reward percentile")
+	errRequestBeyondHead = errors.New("request beyond head block")
+)
+
+// baseFee returns the base fee of the block. Blocks before the London fork have zero
+// base fee, and the whole gas price of a transaction is the tip paid to the miner.
+func baseFee(header *types.Header) *big.Int {
+	if header.BaseFee == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(header.BaseFee)
+}
+
+// effectiveTip returns the part of the gas price of tx which goes to the miner of a block with the given base fee
+func effectiveTip(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	fee, overflow := uint256.FromBig(baseFee)
+	if overflow {
+		return new(big.Int)
+	}
+	tip, err := tx.EffectiveTip(fee)
+	if err != nil {
+		return new(big.Int)
+	}
+	return tip.ToBig()
+}
+
+type txGasAndReward struct {
+	gasUsed uint64
+	reward  *big.Int
+}
+
+type sortGasAndReward []txGasAndReward
+
+func (s sortGasAndReward) Len() int           { return len(s) }
+func (s sortGasAndReward) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s sortGasAndReward) Less(i, j int) bool { return s[i].reward.Cmp(s[j].reward) < 0 }
+
+// blockRewards calculates the effective tips at the given percentiles of the gas used in the block,
+// the transactions are weighted by the amount of gas they used
+func blockRewards(block *types.Block, receipts types.Receipts, percentiles []float64) ([]*big.Int, error) {
+	reward := make([]*big.Int, len(percentiles))
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		// Return an all zero row if there are no transactions to gather data from
+		for i := range reward {
+			reward[i] = new(big.Int)
+		}
+		return reward, nil
+	}
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("block %d has %d transactions but %d receipts", block.NumberU64(), len(txs), len(receipts))
+	}
+
+	fee := baseFee(block.Header())
+	sorter := make(sortGasAndReward, len(txs))
+	for i, tx := range txs {
+		sorter[i] = txGasAndReward{gasUsed: receipts[i].GasUsed, reward: effectiveTip(tx, fee)}
+	}
+	sort.Sort(sorter)
+
+	var txIndex int
+	sumGasUsed := sorter[0].gasUsed
+	for i, p := range percentiles {
+		thresholdGasUsed := uint64(float64(block.GasUsed()) * p / 100)
+		for sumGasUsed < thresholdGasUsed && txIndex < len(txs)-1 {
+			txIndex++
+			sumGasUsed += sorter[txIndex].gasUsed
+		}
+		reward[i] = sorter[txIndex].reward
+	}
+	return reward, nil
+}
+
+// FeeHistory returns data relevant for fee estimation based on the specified range of blocks.
+// The range can be specified either with absolute block numbers or ending with the latest
+// or pending block. The returned values are:
+// - the number of the oldest block in the range
+// - the effective tips paid at the requested percentiles of gas used in each block, only if percentiles are given
+// - the base fee of each block in the range, plus the base fee of the next block after it
+// - the ratio of gas used to the gas limit of each block
+//
+// Blocks which are not available (e.g. requested too far back) are not returned, the range
+// is shortened instead.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*big.Int, [][]*big.Int, []*big.Int, []float64, error) {
+	if blocks < 1 {
+		return new(big.Int), nil, nil, nil, nil
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	for i, p := range rewardPercentiles {
+		if p < 0 || p > 100 {
+			return nil, nil, nil, nil, fmt.Errorf("%w: %f", errInvalidPercentile, p)
+		}
+		if i > 0 && p < rewardPercentiles[i-1] {
+			return nil, nil, nil, nil, fmt.Errorf("%w: #%d:%f > #%d:%f", errInvalidPercentile, i-1, rewardPercentiles[i-1], i, p)
+		}
+	}
+
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if head == nil {
+		return nil, nil, nil, nil, errors.New("head block not found")
+	}
+	headNumber := head.Number.Uint64()
+	var last uint64
+	switch lastBlock {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		last = headNumber
+	default:
+		if lastBlock < 0 {
+			return nil, nil, nil, nil, fmt.Errorf("invalid block number: %d", lastBlock)
+		}
+		last = uint64(lastBlock)
+		if last > headNumber {
+			return nil, nil, nil, nil, fmt.Errorf("%w: requested %d, head %d", errRequestBeyondHead, last, headNumber)
+		}
+	}
+	if uint64(blocks) > last+1 {
+		blocks = int(last + 1)
+	}
+	oldest := last + 1 - uint64(blocks)
+
+	var (
+		reward       [][]*big.Int
+		baseFees     = make([]*big.Int, 0, blocks+1)
+		gasUsedRatio = make([]float64, 0, blocks)
+		header       *types.Header
+	)
+	if len(rewardPercentiles) != 0 {
+		reward = make([][]*big.Int, 0, blocks)
+	}
+	for number := oldest; number <= last; number++ {
+		if err = ctx.Err(); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if len(rewardPercentiles) != 0 {
+			block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if block == nil {
+				break
+			}
+			receipts, err := gpo.backend.GetReceipts(ctx, block.Hash())
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			rewards, err := blockRewards(block, receipts, rewardPercentiles)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			reward = append(reward, rewards)
+			header = block.Header()
+		} else {
+			h, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if h == nil {
+				break
+			}
+			header = h
+		}
+		baseFees = append(baseFees, baseFee(header))
+		if header.GasLimit > 0 {
+			gasUsedRatio = append(gasUsedRatio, float64(header.GasUsed)/float64(header.GasLimit))
+		} else {
+			gasUsedRatio = append(gasUsedRatio, 0)
+		}
+	}
+	if len(gasUsedRatio) == 0 {
+		return new(big.Int).SetUint64(oldest), nil, nil, nil, nil
+	}
+	// The base fee of the block following the range is derived from the last header of the range
+	if config := gpo.backend.ChainConfig(); config.IsLondon(new(big.Int).Add(header.Number, big.NewInt(1))) {
+		baseFees = append(baseFees, misc.CalcBaseFee(config, header))
+	} else {
+		baseFees = append(baseFees, new(big.Int))
+	}
+	return new(big.Int).SetUint64(oldest), reward, baseFees, gasUsedRatio, nil
+}
@@ -0,0 +1,71 @@
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+func TestFeeHistory(t *testing.T) {
+	var cases = []struct {
+		count       int
+		last        rpc.BlockNumber
+		percent     []float64
+		expFirst    uint64
+		expCount    int
+		expErr      error
+		expRewardGw int64 // reward of the first block in the range, for a single percentile
+	}{
+		{count: 0, last: 0, expFirst: 0, expCount: 0},
+		{count: 1, last: 0, expFirst: 0, expCount: 1},
+		{count: 10, last: 30, expFirst: 21, expCount: 10},
+		{count: 10, last: 30, percent: []float64{50}, expFirst: 21, expCount: 10, expRewardGw: 21},
+		{count: 10, last: rpc.LatestBlockNumber, percent: []float64{0, 100}, expFirst: 23, expCount: 10, expRewardGw: 23},
+		{count: 40, last: 20, expFirst: 0, expCount: 21},
+		{count: 1, last: 33, expErr: errRequestBeyondHead},
+		{count: 1, last: 30, percent: []float64{101}, expErr: errInvalidPercentile},
+		{count: 1, last: 30, percent: []float64{60, 50}, expErr: errInvalidPercentile},
+	}
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(params.GWei)})
+	for i, c := range cases {
+		first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), c.count, c.last, c.percent)
+		if c.expErr != nil {
+			if !errors.Is(err, c.expErr) {
+				t.Fatalf("Test case %d: error mismatch, want %v, got %v", i, c.expErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test case %d: unexpected error %v", i, err)
+		}
+		if first.Uint64() != c.expFirst {
+			t.Fatalf("Test case %d: first block mismatch, want %d, got %d", i, c.expFirst, first)
+		}
+		if len(ratio) != c.expCount {
+			t.Fatalf("Test case %d: gasUsedRatio length mismatch, want %d, got %d", i, c.expCount, len(ratio))
+		}
+		if c.expCount > 0 && len(baseFee) != c.expCount+1 {
+			t.Fatalf("Test case %d: baseFee length mismatch, want %d, got %d", i, c.expCount+1, len(baseFee))
+		}
+		if len(c.percent) == 0 {
+			if reward != nil {
+				t.Fatalf("Test case %d: unexpected rewards", i)
+			}
+			continue
+		}
+		if len(reward) != c.expCount {
+			t.Fatalf("Test case %d: reward length mismatch, want %d, got %d", i, c.expCount, len(reward))
+		}
+		// Every block contains a single transaction, so all the percentiles point to it
+		for _, r := range reward[0] {
+			if want := big.NewInt(c.expRewardGw * params.GWei); r.Cmp(want) != 0 {
+				t.Fatalf("Test case %d: reward mismatch, want %d, got %d", i, want, r)
+			}
+		}
+	}
+}
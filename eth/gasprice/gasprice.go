@@ -44,6 +44,7 @@ type Config struct {
 type OracleBackend interface {
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	ChainConfig() *params.ChainConfig
 }
 
@@ -94,7 +95,23 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 
 // SuggestPrice returns a gasprice so that newly created transaction can
 // have a very high chance to be included in the following blocks.
+// It is the suggested tip on top of the base fee of the latest block.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	tip, err := gpo.SuggestTipCap(ctx)
+	if err != nil || tip == nil {
+		return tip, err
+	}
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Add(tip, baseFee(head)), nil
+}
+
+// SuggestTipCap returns a tip (the part of the gas price exceeding the base fee, which
+// goes to the miner) so that newly created transaction can have a very high chance to
+// be included in the following blocks.
+func (gpo *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 
@@ -173,14 +190,19 @@ type getBlockPricesResult struct {
 	err    error
 }
 
-type transactionsByGasPrice []*types.Transaction
+type txWithTip struct {
+	tx  *types.Transaction
+	tip *big.Int
+}
+
+type transactionsByTip []txWithTip
 
-func (t transactionsByGasPrice) Len() int           { return len(t) }
-func (t transactionsByGasPrice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-func (t transactionsByGasPrice) Less(i, j int) bool { return t[i].GasPriceCmp(t[j]) < 0 }
+func (t transactionsByTip) Len() int           { return len(t) }
+func (t transactionsByTip) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t transactionsByTip) Less(i, j int) bool { return t[i].tip.Cmp(t[j].tip) < 0 }
 
-// getBlockPrices calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty or all transactions
+// getBlockPrices calculates the lowest transaction tips in a given block
+// and sends them to the result channel. If the block is empty or all transactions
 // are sent by the miner itself(it doesn't make any sense to include this kind of
 // transaction prices for sampling), nil gasprice is returned.
 func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, blockNum uint64, limit int, result chan getBlockPricesResult, quit chan struct{}) {
@@ -193,15 +215,18 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 		return
 	}
 	blockTxs := block.Transactions()
-	txs := make([]*types.Transaction, len(blockTxs))
-	copy(txs, blockTxs)
-	sort.Sort(transactionsByGasPrice(txs))
+	fee := baseFee(block.Header())
+	txs := make(transactionsByTip, len(blockTxs))
+	for i, tx := range blockTxs {
+		txs[i] = txWithTip{tx: tx, tip: effectiveTip(tx, fee)}
+	}
+	sort.Sort(txs)
 
 	var prices []*big.Int
 	for _, tx := range txs {
-		sender, err := types.Sender(signer, tx)
+		sender, err := types.Sender(signer, tx.tx)
 		if err == nil && sender != block.Coinbase() {
-			prices = append(prices, tx.GasPrice().ToBig())
+			prices = append(prices, tx.tip)
 			if len(prices) >= limit {
 				break
 			}
@@ -54,6 +54,14 @@ func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber)
 	return b.chain.GetBlockByNumber(uint64(number)), nil
 }
 
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	number := rawdb.ReadHeaderNumber(b.chain.ChainDb(), hash)
+	if number == nil {
+		return nil, nil
+	}
+	return rawdb.ReadReceipts(b.chain.ChainDb(), hash, *number), nil
+}
+
 func (b *testBackend) ChainConfig() *params.ChainConfig {
 	return b.chain.Config()
 }
@@ -125,12 +125,14 @@ type handler struct {
 	wg        sync.WaitGroup
 	peerWG    sync.WaitGroup
 
-	tmpdir        string
-	cacheSize     datasize.ByteSize
-	batchSize     datasize.ByteSize
-	stagedSync    *stagedsync.StagedSync
-	mining        *stagedsync.StagedSync
-	currentHeight uint64 // Atomic variable to contain chain height
+	tmpdir         string
+	cacheSize      datasize.ByteSize
+	batchSize      datasize.ByteSize
+	durability     ethdb.Durability
+	bulkDurability ethdb.Durability
+	stagedSync     *stagedsync.StagedSync
+	mining         *stagedsync.StagedSync
+	currentHeight  uint64 // Atomic variable to contain chain height
 }
 
 // newHandler returns a handler for all Ethereum chain management protocol.
@@ -169,6 +171,7 @@ func newHandler(config *handlerConfig) (*handler, error) { //nolint:unparam
 	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.eventMux, config.Chain.Config(), config.Mining, config.Chain, h.removePeer, sm)
 	h.downloader.SetTmpDir(h.tmpdir)
 	h.downloader.SetBatchSize(h.cacheSize, h.batchSize)
+	h.downloader.SetDurability(h.durability, h.bulkDurability)
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -209,6 +212,14 @@ func (h *handler) SetBatchSize(cacheSize, batchSize datasize.ByteSize) {
 	}
 }
 
+func (h *handler) SetDurability(durability, bulkDurability ethdb.Durability) {
+	h.durability = durability
+	h.bulkDurability = bulkDurability
+	if h.downloader != nil {
+		h.downloader.SetDurability(durability, bulkDurability)
+	}
+}
+
 func (h *handler) SetStagedSync(stagedSync *stagedsync.StagedSync) {
 	h.stagedSync = stagedSync
 	if h.downloader != nil {
@@ -0,0 +1,44 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ledgerwatch/turbo-geth/eth/protocols/snap"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+)
+
+// snapHandler implements the snap.Backend interface to serve the state to the
+// `snap` peers, the node itself doesn't sync over `snap`.
+type snapHandler handler
+
+func (h *snapHandler) DB() ethdb.Database { return h.database }
+
+// RunPeer is invoked when a peer joins on the `snap` protocol.
+func (h *snapHandler) RunPeer(peer *snap.Peer, hand snap.Handler) error {
+	h.peerWG.Add(1)
+	defer h.peerWG.Done()
+
+	peer.Log().Debug("Snapshot peer connected", "name", peer.Name())
+	defer peer.Log().Debug("Snapshot peer disconnected")
+	return hand(peer)
+}
+
+// PeerInfo retrieves all known `snap` information about a peer.
+func (h *snapHandler) PeerInfo(id enode.ID) interface{} {
+	return nil
+}
@@ -0,0 +1,227 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"golang.org/x/sync/errgroup"
+)
+
+// ChangeSetsConfig is the configuration of the re-execution of CheckChangeSets
+type ChangeSetsConfig struct {
+	ChainConfig *params.ChainConfig
+	// Engine finalizes the re-executed blocks, e.g. applies the block rewards. The faker of ethash if nil
+	Engine consensus.Engine
+	// Workers is the number of the goroutines re-executing the blocks, the number of CPUs if zero
+	Workers int
+	// History is the database with the changesets and the history, the database with the blocks if nil
+	History ethdb.Database
+}
+
+// ChangeSetDiff is the change of a key which differs between the changeset generated by the re-execution of the
+// block and the one stored in the database
+type ChangeSetDiff struct {
+	Block    uint64
+	Bucket   string
+	Key      []byte
+	Expected []byte // Value generated by the re-execution, nil if the re-execution doesn't change the key
+	Stored   []byte // Value stored in the database, nil if the stored changeset doesn't have the key
+}
+
+func (d *ChangeSetDiff) String() string {
+	return fmt.Sprintf("block %d, %s, key %x: expected %x, stored %x", d.Block, d.Bucket, d.Key, d.Expected, d.Stored)
+}
+
+// CheckChangeSets re-executes the blocks from..to in read-only mode, each of them against the historical state as of
+// its parent, and compares the changesets generated by the execution with the stored ones. The blocks are spread over
+// the workers, each of them reading in its own read-only transaction. Returns the differences, ordered by block.
+func CheckChangeSets(ctx context.Context, db ethdb.Database, cfg ChangeSetsConfig, from, to uint64) ([]*ChangeSetDiff, error) {
+	if from == 0 {
+		from = 1 // the changes of the genesis are its allocations, they aren't executed
+	}
+	history := cfg.History
+	if history == nil {
+		history = db
+	}
+	engine := cfg.Engine
+	if engine == nil {
+		engine = ethash.NewFaker()
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	for _, stage := range []stages.SyncStage{stages.Execution, stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		progress, err := stages.GetStageProgress(db, stage)
+		if err != nil {
+			return nil, err
+		}
+		if to > progress {
+			return nil, fmt.Errorf("can't check block %d above the progress of %s: %d", to, stage, progress)
+		}
+	}
+	if from > to {
+		return nil, nil
+	}
+
+	diffs := make([][]*ChangeSetDiff, to-from+1)
+	blocks := make(chan uint64)
+	var checked uint64
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(blocks)
+		logEvery := time.NewTicker(30 * time.Second)
+		defer logEvery.Stop()
+		for blockNum := from; blockNum <= to; blockNum++ {
+			select {
+			case blocks <- blockNum:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("[changesets-check] Re-executing", "block", blockNum, "checked", atomic.LoadUint64(&checked), "of", to-from+1)
+			}
+		}
+		return nil
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			tx, err := db.Begin(ctx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			historyTx := tx
+			if history != db {
+				if historyTx, err = history.Begin(ctx, ethdb.RO); err != nil {
+					return err
+				}
+				defer historyTx.Rollback()
+			}
+			cc := &core.TinyChainContext{}
+			cc.SetDB(tx)
+			cc.SetEngine(engine)
+			for blockNum := range blocks {
+				if diffs[blockNum-from], err = reExecute(tx, historyTx, cfg.ChainConfig, cc, blockNum); err != nil {
+					return err
+				}
+				atomic.AddUint64(&checked, 1)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var result []*ChangeSetDiff
+	for _, blockDiffs := range diffs {
+		result = append(result, blockDiffs...)
+	}
+	return result, nil
+}
+
+func reExecute(tx, historyTx ethdb.Database, chainConfig *params.ChainConfig, cc *core.TinyChainContext, blockNum uint64) ([]*ChangeSetDiff, error) {
+	blockHash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlock(tx, blockHash, blockNum)
+	if block == nil {
+		return nil, fmt.Errorf("block %d not found", blockNum)
+	}
+	// The same as core.ExecuteBlockEphemerally, only accumulating the changes in memory
+	ibs := state.New(state.NewPlainDBState(historyTx, blockNum-1))
+	csw := state.NewChangeSetWriterPlain(nil /* db */, blockNum-1)
+	header := block.Header()
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+	noop := state.NewNoopWriter()
+	for i, txn := range block.Transactions() {
+		ibs.Prepare(txn.Hash(), block.Hash(), i)
+		if _, err = core.ApplyTransaction(chainConfig, cc, nil, gp, ibs, noop, header, txn, usedGas, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("re-executing tx %x of block %d: %w", txn.Hash(), blockNum, err)
+		}
+	}
+	if *usedGas != header.GasUsed {
+		return nil, fmt.Errorf("gas used by the re-execution of block %d: %d, in header: %d", blockNum, *usedGas, header.GasUsed)
+	}
+	cc.Engine().Finalize(chainConfig, header, ibs, block.Transactions(), block.Uncles())
+	if err = ibs.CommitBlock(chainConfig.WithEIPsFlags(context.Background(), header.Number), csw); err != nil {
+		return nil, fmt.Errorf("committing block %d: %w", blockNum, err)
+	}
+	return DiffChangeSets(historyTx, blockNum, csw)
+}
+
+// DiffChangeSets compares the changesets accumulated by the writer during the execution of the block with the ones
+// stored in the database, and returns the differences
+func DiffChangeSets(db ethdb.Database, blockNum uint64, csw *state.ChangeSetWriter) ([]*ChangeSetDiff, error) {
+	accountChanges, err := csw.GetAccountChanges()
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := diffChangeSet(db, dbutils.PlainAccountChangeSetBucket, blockNum, accountChanges)
+	if err != nil {
+		return nil, err
+	}
+	storageChanges, err := csw.GetStorageChanges()
+	if err != nil {
+		return nil, err
+	}
+	storageDiffs, err := diffChangeSet(db, dbutils.PlainStorageChangeSetBucket, blockNum, storageChanges)
+	if err != nil {
+		return nil, err
+	}
+	return append(diffs, storageDiffs...), nil
+}
+
+func diffChangeSet(db ethdb.Database, bucket string, blockNum uint64, expected *changeset.ChangeSet) ([]*ChangeSetDiff, error) {
+	sort.Sort(expected)
+	var diffs []*ChangeSetDiff
+	i := 0
+	if err := changeset.Walk(db, bucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, v []byte) (bool, error) {
+		// The changes of both changesets are sorted by key
+		for ; i < len(expected.Changes) && bytes.Compare(expected.Changes[i].Key, k) < 0; i++ {
+			diffs = append(diffs, &ChangeSetDiff{Block: blockNum, Bucket: bucket, Key: expected.Changes[i].Key, Expected: expected.Changes[i].Value})
+		}
+		if i < len(expected.Changes) && bytes.Equal(expected.Changes[i].Key, k) {
+			if !bytes.Equal(expected.Changes[i].Value, v) {
+				diffs = append(diffs, &ChangeSetDiff{Block: blockNum, Bucket: bucket, Key: common.CopyBytes(k), Expected: expected.Changes[i].Value, Stored: common.CopyBytes(v)})
+			}
+			i++
+			return true, nil
+		}
+		diffs = append(diffs, &ChangeSetDiff{Block: blockNum, Bucket: bucket, Key: common.CopyBytes(k), Stored: common.CopyBytes(v)})
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	for ; i < len(expected.Changes); i++ {
+		diffs = append(diffs, &ChangeSetDiff{Block: blockNum, Bucket: bucket, Key: expected.Changes[i].Key, Expected: expected.Changes[i].Value})
+	}
+	return diffs, nil
+}
@@ -0,0 +1,108 @@
+package integrity_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestCheckChangeSets(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, b *core.BlockGen) {
+		var tx *types.Transaction
+		if i%2 == 0 {
+			tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+		} else {
+			// The contract storing 1 in its slot 0, for the changes of the storage
+			tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), common.FromHex("0x600160005500"))
+		}
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := integrity.ChangeSetsConfig{ChainConfig: gspec.Config, Workers: 3}
+	diffs, err := integrity.CheckChangeSets(context.Background(), db, cfg, 0, uint64(len(blocks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected no differences, got %v", diffs)
+	}
+	if _, err = integrity.CheckChangeSets(context.Background(), db, cfg, 0, uint64(len(blocks))+1); err == nil {
+		t.Fatal("expected the check above the executed block to fail")
+	}
+
+	// The stored changesets without the change of the recipient in block 3 and of the contract storage in block 4
+	var accountChange, storageChange []byte
+	if err = changeset.Walk(db, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(3), 8*8, func(_ uint64, k, v []byte) (bool, error) {
+		if common.BytesToAddress(k) == to {
+			accountChange = common.CopyBytes(v)
+		}
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(3), append(to.Bytes(), accountChange...)); err != nil {
+		t.Fatal(err)
+	}
+	var storageKey []byte
+	if err = changeset.Walk(db, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(4), 8*8, func(_ uint64, k, v []byte) (bool, error) {
+		storageKey, storageChange = common.CopyBytes(k), common.CopyBytes(v)
+		return false, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if storageKey == nil {
+		t.Fatal("expected the changes of the storage in block 4")
+	}
+	dbKey := append(dbutils.EncodeBlockNumber(4), storageKey[:common.AddressLength+common.IncarnationLength]...)
+	if err = db.Delete(dbutils.PlainStorageChangeSetBucket, dbKey, append(storageKey[common.AddressLength+common.IncarnationLength:], storageChange...)); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err = integrity.CheckChangeSets(context.Background(), db, cfg, 1, uint64(len(blocks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 differences, got %v", diffs)
+	}
+	if diffs[0].Block != 3 || diffs[0].Bucket != dbutils.PlainAccountChangeSetBucket || common.BytesToAddress(diffs[0].Key) != to || diffs[0].Stored != nil {
+		t.Errorf("unexpected difference %v", diffs[0])
+	}
+	if diffs[1].Block != 4 || diffs[1].Bucket != dbutils.PlainStorageChangeSetBucket || string(diffs[1].Key) != string(storageKey) || diffs[1].Stored != nil {
+		t.Errorf("unexpected difference %v", diffs[1])
+	}
+}
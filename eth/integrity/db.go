@@ -0,0 +1,442 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+)
+
+// Names of the checks of DB
+const (
+	CheckAccountHistory     = "account-history"
+	CheckStorageHistory     = "storage-history"
+	CheckChangeSetsExecuted = "changesets-executed"
+	CheckHashedState        = "hashed-state"
+	CheckTxLookup           = "tx-lookup"
+	CheckIntermediateHashes = "intermediate-hashes"
+)
+
+// maxExamples is the number of the inconsistent records listed by the issue, the rest of them are only counted
+const maxExamples = 10
+
+// Issue is the inconsistency between the buckets found by DB, with the way to repair it
+type Issue struct {
+	Check      string
+	Count      uint64   // Number of the inconsistent records
+	Examples   []string // First of the inconsistent records
+	Suggestion string
+	// Reset lists the stages to rebuild from scratch to repair the inconsistency, the next sync rebuilds them
+	Reset []stages.SyncStage
+	// Fix repairs the inconsistency in place, within the transaction of the database, nil if resetting is the repair
+	Fix func(db ethdb.Database) error
+}
+
+func (i *Issue) add(format string, args ...interface{}) {
+	i.Count++
+	if len(i.Examples) < maxExamples {
+		i.Examples = append(i.Examples, fmt.Sprintf(format, args...))
+	}
+}
+
+func (i *Issue) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d inconsistent records\n", i.Check, i.Count)
+	for _, e := range i.Examples {
+		fmt.Fprintf(&sb, "\t%s\n", e)
+	}
+	if i.Count > uint64(len(i.Examples)) {
+		fmt.Fprintf(&sb, "\t... and %d more\n", i.Count-uint64(len(i.Examples)))
+	}
+	fmt.Fprintf(&sb, "\tsuggestion: %s", i.Suggestion)
+	return sb.String()
+}
+
+// DB cross-validates the buckets of the database, without modifying it:
+//   - every changeset record up to the progress of the history index has its bit in the index, and every bit has the record
+//   - there are no changesets above the executed block, so PlainState is the result of applying all the changesets
+//   - the hashed state mirrors PlainState, once it is hashed up to the executed block
+//   - the transaction lookup entries resolve to the canonical blocks with these transactions
+//   - the intermediate hashes recompute to the state root of the header they are built for
+func DB(db ethdb.Database, quit <-chan struct{}) ([]*Issue, error) {
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	checks := []func(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error){
+		func(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+			return checkHistory(tx, CheckAccountHistory, dbutils.PlainAccountChangeSetBucket, stages.AccountHistoryIndex, quit)
+		},
+		func(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+			return checkHistory(tx, CheckStorageHistory, dbutils.PlainStorageChangeSetBucket, stages.StorageHistoryIndex, quit)
+		},
+		checkChangeSetsExecuted,
+		checkHashedState,
+		checkTxLookup,
+		checkIntermediateHashes,
+	}
+	var issues []*Issue
+	for _, check := range checks {
+		issue, err := check(tx, quit)
+		if err != nil {
+			return nil, err
+		}
+		if issue != nil && issue.Count > 0 {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+func checkHistory(tx ethdb.DbWithPendingMutations, name string, changeSetBucket string, stage stages.SyncStage, quit <-chan struct{}) (*Issue, error) {
+	progress, err := stages.GetStageProgress(tx, stage)
+	if err != nil {
+		return nil, err
+	}
+	if progress == 0 {
+		return nil, nil
+	}
+	log.Info("[db-check] Checking", "check", name, "progress", progress)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	indexBucket := changeset.Mapper[changeSetBucket].IndexBucket
+	issue := &Issue{
+		Check:      name,
+		Suggestion: fmt.Sprintf("rebuild the index %s from the changesets", indexBucket),
+		Reset:      []stages.SyncStage{stage},
+	}
+
+	// Every change up to the progress has its bit in the chunk covering the block
+	ic := tx.(ethdb.HasTx).Tx().Cursor(indexBucket)
+	defer ic.Close()
+	seek := make([]byte, 0, 256)
+	if err = changeset.Walk(tx, changeSetBucket, nil, 0, func(blockN uint64, k, v []byte) (bool, error) {
+		if blockN > progress {
+			return false, nil
+		}
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info("[db-check] Changesets", "check", name, "number", blockN)
+		}
+		k = dbutils.CompositeKeyWithoutIncarnation(k)
+		seek = append(append(seek[:0], k...), dbutils.EncodeBlockNumber(blockN)...)
+		chunkKey, chunk, err := ic.Seek(seek)
+		if err != nil {
+			return false, err
+		}
+		if chunkKey != nil && len(chunkKey) == len(k)+8 && bytes.HasPrefix(chunkKey, k) {
+			bm := roaring64.New()
+			if _, err = bm.ReadFrom(bytes.NewReader(chunk)); err != nil {
+				return false, err
+			}
+			if bm.Contains(blockN) {
+				return true, nil
+			}
+		}
+		issue.add("block %d, key %x: changed, but not in the index", blockN, k)
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Every bit of the index has its change
+	cc := tx.(ethdb.HasTx).Tx().CursorDupSort(changeSetBucket)
+	defer cc.Close()
+	if err = tx.Walk(indexBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info("[db-check] Index", "check", name, "key", fmt.Sprintf("%x", k))
+		}
+		bm := roaring64.New()
+		if _, err := bm.ReadFrom(bytes.NewReader(v)); err != nil {
+			return false, err
+		}
+		key := k[:len(k)-8]
+		for it := bm.Iterator(); it.HasNext(); {
+			blockN := it.Next()
+			found, err := hasChange(cc, blockN, key)
+			if err != nil {
+				return false, err
+			}
+			if !found {
+				issue.add("block %d, key %x: in the index, but has no changeset record", blockN, key)
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// hasChange tells whether the changeset of the block has the record of the key, which is the address of the account,
+// or the address and the location of the storage slot of any incarnation
+func hasChange(c ethdb.CursorDupSort, blockN uint64, key []byte) (bool, error) {
+	if len(key) == common.AddressLength {
+		v, err := c.SeekBothRange(dbutils.EncodeBlockNumber(blockN), key)
+		if err != nil {
+			return false, err
+		}
+		return bytes.HasPrefix(v, key), nil
+	}
+	prefix := append(dbutils.EncodeBlockNumber(blockN), key[:common.AddressLength]...)
+	location := key[common.AddressLength:]
+	for k, _, err := c.Seek(prefix); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return false, err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		v, err := c.SeekBothRange(common.CopyBytes(k), location)
+		if err != nil {
+			return false, err
+		}
+		if bytes.HasPrefix(v, location) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func checkChangeSetsExecuted(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("[db-check] Checking", "check", CheckChangeSetsExecuted, "progress", executed)
+	issue := &Issue{
+		Check:      CheckChangeSetsExecuted,
+		Suggestion: fmt.Sprintf("truncate the changesets above the executed block %d, the execution writes them again", executed),
+		Fix: func(db ethdb.Database) error {
+			return changeset.Truncate(db.(ethdb.HasTx).Tx().(ethdb.RwTx), executed+1)
+		},
+	}
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		c := tx.(ethdb.HasTx).Tx().CursorDupSort(bucket)
+		for k, _, err := c.Seek(dbutils.EncodeBlockNumber(executed + 1)); k != nil; k, _, err = c.NextNoDup() {
+			if err != nil {
+				c.Close()
+				return nil, err
+			}
+			if err = common.Stopped(quit); err != nil {
+				c.Close()
+				return nil, err
+			}
+			issue.add("block %d: changes in %s above the executed block", binary.BigEndian.Uint64(k), bucket)
+		}
+		c.Close()
+	}
+	return issue, nil
+}
+
+func checkHashedState(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := stages.GetStageProgress(tx, stages.HashState)
+	if err != nil {
+		return nil, err
+	}
+	if hashed == 0 || hashed != executed {
+		// The hashed state lags behind PlainState until the stage catches up
+		return nil, nil
+	}
+	log.Info("[db-check] Checking", "check", CheckHashedState, "progress", hashed)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	issue := &Issue{
+		Check:      CheckHashedState,
+		Suggestion: "rebuild the hashed state and the intermediate hashes from PlainState",
+		Reset:      []stages.SyncStage{stages.HashState, stages.IntermediateHashes},
+	}
+	var accounts, storage uint64
+	if err = tx.Walk(dbutils.PlainStateBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info("[db-check] PlainState", "key", fmt.Sprintf("%x", k))
+		}
+		var hashedKey []byte
+		var bucket string
+		switch len(k) {
+		case common.AddressLength:
+			addrHash, err := common.HashData(k)
+			if err != nil {
+				return false, err
+			}
+			hashedKey, bucket = addrHash[:], dbutils.HashedAccountsBucket
+			accounts++
+		case common.AddressLength + common.IncarnationLength + common.HashLength:
+			address, incarnation, location := dbutils.PlainParseCompositeStorageKey(k)
+			addrHash, err := common.HashData(address[:])
+			if err != nil {
+				return false, err
+			}
+			locHash, err := common.HashData(location[:])
+			if err != nil {
+				return false, err
+			}
+			hashedKey, bucket = dbutils.GenerateCompositeStorageKey(addrHash, incarnation, locHash), dbutils.HashedStorageBucket
+			storage++
+		default:
+			issue.add("key %x: unexpected length %d in PlainState", k, len(k))
+			return true, nil
+		}
+		hashedV, err := tx.Get(bucket, hashedKey)
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return false, err
+		}
+		if !bytes.Equal(v, hashedV) {
+			issue.add("key %x: %x in PlainState, %x in %s", k, v, hashedV, bucket)
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Whatever is in the hashed state and not in PlainState is left over
+	for bucket, expected := range map[string]uint64{dbutils.HashedAccountsBucket: accounts, dbutils.HashedStorageBucket: storage} {
+		var count uint64
+		if err = tx.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+			count++
+			return true, common.Stopped(quit)
+		}); err != nil {
+			return nil, err
+		}
+		if count > expected {
+			issue.add("%d records in %s, while there are %d in PlainState", count, bucket, expected)
+		}
+	}
+	return issue, nil
+}
+
+func checkTxLookup(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+	log.Info("[db-check] Checking", "check", CheckTxLookup)
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	var dangling []common.Hash
+	issue := &Issue{
+		Check:      CheckTxLookup,
+		Suggestion: "delete the transaction lookup entries which do not resolve",
+		Fix: func(db ethdb.Database) error {
+			for _, hash := range dangling {
+				if err := rawdb.DeleteTxLookupEntry(db, hash); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	// The transactions of the recently resolved blocks
+	blocks := make(map[uint64]map[common.Hash]struct{})
+	if err := tx.Walk(dbutils.TxLookupPrefix, nil, 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info("[db-check] Transaction lookup", "hash", fmt.Sprintf("%x", k))
+		}
+		txHash, number := common.BytesToHash(k), new(big.Int).SetBytes(v).Uint64()
+		txs, ok := blocks[number]
+		if !ok {
+			if len(blocks) >= 1024 {
+				blocks = make(map[uint64]map[common.Hash]struct{})
+			}
+			hash, err := rawdb.ReadCanonicalHash(tx, number)
+			if err != nil {
+				return false, err
+			}
+			txs = make(map[common.Hash]struct{})
+			if body := rawdb.ReadBody(tx, hash, number); body != nil {
+				for _, t := range body.Transactions {
+					txs[t.Hash()] = struct{}{}
+				}
+			}
+			blocks[number] = txs
+		}
+		if _, ok = txs[txHash]; !ok {
+			issue.add("transaction %x: not in the canonical block %d", txHash, number)
+			dangling = append(dangling, txHash)
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+func checkIntermediateHashes(tx ethdb.DbWithPendingMutations, quit <-chan struct{}) (*Issue, error) {
+	hashed, err := stages.GetStageProgress(tx, stages.HashState)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if progress == 0 || progress != hashed {
+		// The intermediate hashes are built for the hashed state of another block
+		return nil, nil
+	}
+	log.Info("[db-check] Checking", "check", CheckIntermediateHashes, "progress", progress)
+	issue := &Issue{
+		Check:      CheckIntermediateHashes,
+		Suggestion: "regenerate the intermediate hashes from the hashed state",
+		Reset:      []stages.SyncStage{stages.IntermediateHashes},
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, progress)
+	if err != nil {
+		return nil, err
+	}
+	header := rawdb.ReadHeader(tx, hash, progress)
+	if header == nil {
+		issue.add("block %d: no canonical header", progress)
+		return issue, nil
+	}
+	loader := trie.NewFlatDBTrieLoader("db-check")
+	if err = loader.Reset(trie.NewRetainList(0), nil, nil, false); err != nil {
+		return nil, err
+	}
+	root, err := loader.CalcTrieRoot(tx, nil, quit)
+	if err != nil {
+		return nil, err
+	}
+	if root != header.Root {
+		issue.add("block %d: state root %x recomputed, %x in the header", progress, root, header.Root)
+	}
+	return issue, nil
+}
@@ -0,0 +1,111 @@
+package integrity_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestDB(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 5, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+
+	expectIssues := func(checks ...string) []*integrity.Issue {
+		t.Helper()
+		issues, err := integrity.DB(db, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != len(checks) {
+			t.Fatalf("expected issues %v, got %v", checks, issues)
+		}
+		for i, issue := range issues {
+			if issue.Check != checks[i] {
+				t.Fatalf("expected issues %v, got %v", checks, issues)
+			}
+		}
+		return issues
+	}
+	fix := func(issues []*integrity.Issue) {
+		t.Helper()
+		tx, err := db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		for _, issue := range issues {
+			if err = issue.Fix(tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectIssues()
+
+	// The lookup of the transaction which is not in the block
+	if err = db.Put(dbutils.TxLookupPrefix, common.Hash{1}.Bytes(), big.NewInt(3).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	fix(expectIssues(integrity.CheckTxLookup))
+	expectIssues()
+
+	// The history index without the changes of the recipient
+	if err = db.Walk(dbutils.AccountsHistoryBucket, to.Bytes(), 8*common.AddressLength, func(k, v []byte) (bool, error) {
+		return true, db.Delete(dbutils.AccountsHistoryBucket, common.CopyBytes(k), nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	issues := expectIssues(integrity.CheckAccountHistory)
+	if issues[0].Count != uint64(len(blocks)) {
+		t.Errorf("expected changes of %d blocks not in the index, got %d", len(blocks), issues[0].Count)
+	}
+	if len(issues[0].Reset) == 0 || issues[0].Fix != nil {
+		t.Errorf("expected the index to be reset")
+	}
+
+	// The hashed state of another recipient, with the state root not matching the header
+	toHash, _ := common.HashData(to.Bytes())
+	if err = db.Delete(dbutils.HashedAccountsBucket, toHash.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(dbutils.HashedAccountsBucket, common.Hash{2}.Bytes(), []byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	expectIssues(integrity.CheckAccountHistory, integrity.CheckHashedState, integrity.CheckIntermediateHashes)
+}
@@ -0,0 +1,246 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReceiptsConfig is the configuration of RepairReceipts
+type ReceiptsConfig struct {
+	// Engine finalizes the re-executed blocks, e.g. applies the block rewards. The faker of ethash if nil
+	Engine consensus.Engine
+	// Workers is the number of the goroutines re-executing the blocks, the number of CPUs if zero
+	Workers int
+	// CheckOnly reports the blocks with the missing or the corrupt receipts without rewriting them
+	CheckOnly bool
+}
+
+// ReceiptsRepair is the result of RepairReceipts
+type ReceiptsRepair struct {
+	Blocks uint64 // Blocks re-executed
+	// Repaired are the blocks whose stored receipts were missing or differed from the re-executed ones, ordered
+	Repaired []uint64
+}
+
+// blockReceipts are the receipts of the block re-executed by RepairReceipts
+type blockReceipts struct {
+	blockNum uint64
+	receipts types.Receipts
+}
+
+// RepairReceipts re-executes the blocks from..to against the historical state as of their parents, and rewrites the
+// receipts and the logs of the blocks whose stored ones are missing or differ, with their entries in the log index if
+// the blocks are indexed. The re-executed receipts have to match the receipts root (from Byzantium), the bloom and the
+// gas used of the headers, otherwise the repair fails: the state, not the receipts, is corrupt then. The blocks are
+// spread over the workers, each of them reading in its own read-only transaction, the receipts are written in one
+// transaction
+func RepairReceipts(ctx context.Context, db ethdb.Database, cfg ReceiptsConfig, from, to uint64) (*ReceiptsRepair, error) {
+	if from == 0 {
+		from = 1 // the genesis block has no transactions
+	}
+	engine := cfg.Engine
+	if engine == nil {
+		engine = ethash.NewFaker()
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	repair := &ReceiptsRepair{}
+	if from > to {
+		return repair, nil
+	}
+	logIndexAt, err := stages.GetStageProgress(db, stages.LogIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	blocks := make(chan uint64)
+	results := make(chan blockReceipts, workers)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(blocks)
+		logEvery := time.NewTicker(30 * time.Second)
+		defer logEvery.Stop()
+		for blockNum := from; blockNum <= to; blockNum++ {
+			select {
+			case blocks <- blockNum:
+			case <-gCtx.Done():
+				return gCtx.Err()
+			}
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("[receipts-repair] Re-executing", "block", blockNum, "re-executed", atomic.LoadUint64(&repair.Blocks), "of", to-from+1)
+			}
+		}
+		return nil
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			tx, err := db.Begin(gCtx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			for blockNum := range blocks {
+				receipts, err := reExecuteReceipts(tx, engine, blockNum)
+				if err != nil {
+					return err
+				}
+				atomic.AddUint64(&repair.Blocks, 1)
+				if receipts == nil {
+					continue
+				}
+				select {
+				case results <- blockReceipts{blockNum: blockNum, receipts: receipts}:
+				case <-gCtx.Done():
+					return gCtx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	var gErr error
+	go func() {
+		gErr = g.Wait()
+		close(results)
+	}()
+
+	var tx ethdb.DbWithPendingMutations
+	if !cfg.CheckOnly {
+		if tx, err = db.Begin(ctx, ethdb.RW); err != nil {
+			cancel()
+			for range results {
+			}
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+	var writeErr error
+	for r := range results {
+		if writeErr != nil {
+			continue // drained until the workers stop
+		}
+		repair.Repaired = append(repair.Repaired, r.blockNum)
+		if tx == nil {
+			continue
+		}
+		if writeErr = rewriteReceipts(tx, r.blockNum, r.receipts, r.blockNum <= logIndexAt); writeErr != nil {
+			cancel()
+		}
+	}
+	if gErr != nil {
+		return nil, gErr
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	sort.Slice(repair.Repaired, func(i, j int) bool { return repair.Repaired[i] < repair.Repaired[j] })
+	if tx != nil {
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return repair, nil
+}
+
+// reExecuteReceipts re-executes the block and returns its receipts if the stored ones have to be repaired, nil if
+// they match
+func reExecuteReceipts(tx ethdb.Database, engine consensus.Engine, blockNum uint64) (types.Receipts, error) {
+	result, err := core.ReExecuteBlock(tx, engine, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	repair := false
+	for _, diff := range result.Diffs {
+		switch diff.What {
+		case core.DiffReceiptsRoot, core.DiffBloom, core.DiffGasUsed:
+			return nil, fmt.Errorf("the re-execution of block %d doesn't match its header, %s", blockNum, diff)
+		case core.DiffReceipt:
+			repair = true
+		}
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	// The receipts which are missing or can't be decoded aren't diffed
+	if stored := rawdb.ReadRawReceipts(tx, hash, blockNum); len(stored) != len(result.Receipts) {
+		repair = true
+	}
+	if !repair {
+		return nil, nil
+	}
+	return result.Receipts, nil
+}
+
+// rewriteReceipts replaces the stored receipts and logs of the block, and moves the block in the log index from the
+// topics and the addresses of the stored logs to the ones of the new logs
+func rewriteReceipts(tx ethdb.Database, blockNum uint64, receipts types.Receipts, indexed bool) error {
+	if indexed {
+		stale := map[string]map[string]struct{}{dbutils.LogTopicIndex: {}, dbutils.LogAddressIndex: {}}
+		if err := tx.Walk(dbutils.Log, dbutils.LogKey(blockNum, 0), 8*8, func(k, v []byte) (bool, error) {
+			var logs types.Logs
+			if err := cbor.Unmarshal(&logs, bytes.NewReader(v)); err != nil {
+				return true, nil // the corrupt logs can't be unindexed, the index only points at the block in vain
+			}
+			addLogKeys(stale, logs)
+			return true, nil
+		}); err != nil {
+			return err
+		}
+		keys := map[string]map[string]struct{}{dbutils.LogTopicIndex: {}, dbutils.LogAddressIndex: {}}
+		for _, r := range receipts {
+			addLogKeys(keys, r.Logs)
+		}
+		for bucket := range keys {
+			for k := range stale[bucket] {
+				if _, ok := keys[bucket][k]; ok {
+					continue
+				}
+				if err := bitmapdb.Remove(tx, bucket, []byte(k), uint32(blockNum)); err != nil {
+					return err
+				}
+			}
+			for k := range keys[bucket] {
+				if err := bitmapdb.Add(tx, bucket, []byte(k), uint32(blockNum)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := rawdb.DeleteReceipts(tx, blockNum); err != nil {
+		return err
+	}
+	return rawdb.WriteReceipts(tx, blockNum, receipts)
+}
+
+func addLogKeys(keys map[string]map[string]struct{}, logs types.Logs) {
+	for _, l := range logs {
+		for _, topic := range l.Topics {
+			keys[dbutils.LogTopicIndex][string(topic.Bytes())] = struct{}{}
+		}
+		keys[dbutils.LogAddressIndex][string(l.Address.Bytes())] = struct{}{}
+	}
+}
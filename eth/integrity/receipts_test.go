@@ -0,0 +1,86 @@
+package integrity_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairReceipts(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, emitter := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			sender: {Balance: big.NewInt(params.Ether)},
+			// LOG1(0, 0, 1)
+			emitter: {Balance: new(big.Int), Code: common.FromHex("0x600160006000a100")},
+		},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 4, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), emitter, uint256.NewInt(), 50000, uint256.NewInt(), nil), signer, key)
+		require.NoError(t, err)
+		b.AddTx(tx)
+	}, false)
+	require.NoError(t, err)
+	_, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */)
+	require.NoError(t, err)
+	expected := rawdb.ReadRawReceipts(db, blocks[2].Hash(), 3)
+	require.Len(t, expected, 1)
+	require.Len(t, expected[0].Logs, 1)
+
+	repair := func(checkOnly bool) []uint64 {
+		t.Helper()
+		result, err := integrity.RepairReceipts(context.Background(), db, integrity.ReceiptsConfig{Workers: 2, CheckOnly: checkOnly}, 0, 4)
+		require.NoError(t, err)
+		require.Equal(t, uint64(4), result.Blocks)
+		return result.Repaired
+	}
+	indexed := func(address common.Address) []uint32 {
+		t.Helper()
+		bm, err := bitmapdb.Get(db, dbutils.LogAddressIndex, address.Bytes(), 0, 10)
+		require.NoError(t, err)
+		return bm.ToArray()
+	}
+	require.Empty(t, repair(false))
+	require.Equal(t, []uint32{1, 2, 3, 4}, indexed(emitter))
+
+	// The receipts of block 2 pruned, the logs of block 3 of another contract
+	require.NoError(t, rawdb.DeleteReceipts(db, 2))
+	require.NoError(t, bitmapdb.Remove(db, dbutils.LogAddressIndex, emitter.Bytes(), 2))
+	corrupt := rawdb.ReadRawReceipts(db, blocks[2].Hash(), 3)
+	corrupt[0].Logs[0].Address = common.Address{2}
+	require.NoError(t, rawdb.DeleteReceipts(db, 3))
+	require.NoError(t, rawdb.WriteReceipts(db, 3, corrupt))
+	require.NoError(t, bitmapdb.Remove(db, dbutils.LogAddressIndex, emitter.Bytes(), 3))
+	require.NoError(t, bitmapdb.Add(db, dbutils.LogAddressIndex, common.Address{2}.Bytes(), 3))
+
+	require.Equal(t, []uint64{2, 3}, repair(true))
+	require.Nil(t, rawdb.ReadRawReceipts(db, blocks[1].Hash(), 2))
+	require.Equal(t, []uint64{2, 3}, repair(false))
+	require.Empty(t, repair(true))
+
+	require.Equal(t, expected[0].Logs[0].Address, rawdb.ReadRawReceipts(db, blocks[2].Hash(), 3)[0].Logs[0].Address)
+	require.Equal(t, []uint32{1, 2, 3, 4}, indexed(emitter))
+	require.Empty(t, indexed(common.Address{2}))
+}
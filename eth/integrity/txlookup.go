@@ -0,0 +1,123 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// TxLookupSample is the result of VerifyTxLookup
+type TxLookupSample struct {
+	Blocks   uint64   `json:"blocks"`             // Canonical blocks sampled
+	Txs      uint64   `json:"txs"`                // Transactions of the sampled blocks
+	Missing  uint64   `json:"missing"`            // Transactions without the lookup entry
+	Wrong    uint64   `json:"wrong"`              // Transactions with the lookup entry of another block
+	Examples []string `json:"examples,omitempty"` // First of the missing and the wrong entries
+}
+
+// OK tells whether all the sampled transactions have the correct lookup entries
+func (s *TxLookupSample) OK() bool {
+	return s.Missing == 0 && s.Wrong == 0
+}
+
+func (s *TxLookupSample) String() string {
+	return fmt.Sprintf("sampled %d blocks with %d transactions: %d missing, %d wrong", s.Blocks, s.Txs, s.Missing, s.Wrong)
+}
+
+// VerifyTxLookup checks the transaction lookup entries of the given percentage of the canonical blocks up to the
+// progress of the TxLookup stage, picked at random: every transaction of the sampled block has to resolve to it.
+// The blocks are spread over the workers, the number of CPUs if zero, each of them reading in its own read-only
+// transaction. The dangling entries of the non-canonical blocks are checked by DB
+func VerifyTxLookup(ctx context.Context, db ethdb.Database, percent float64, workers int) (*TxLookupSample, error) {
+	if percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("the percentage of the sampled blocks has to be in (0, 100], got %v", percent)
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	to, err := stages.GetStageProgress(db, stages.TxLookup)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := &TxLookupSample{}
+	var examplesLock sync.Mutex
+	addExample := func(format string, args ...interface{}) {
+		examplesLock.Lock()
+		defer examplesLock.Unlock()
+		if len(sample.Examples) < maxExamples {
+			sample.Examples = append(sample.Examples, fmt.Sprintf(format, args...))
+		}
+	}
+	blocks := make(chan uint64)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(blocks)
+		logEvery := time.NewTicker(30 * time.Second)
+		defer logEvery.Stop()
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+		for blockNum := uint64(1); blockNum <= to; blockNum++ {
+			if rnd.Float64()*100 >= percent {
+				continue
+			}
+			select {
+			case blocks <- blockNum:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("[tx-lookup-verify] Sampling", "block", blockNum, "of", to, "txs", atomic.LoadUint64(&sample.Txs))
+			}
+		}
+		return nil
+	})
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			tx, err := db.Begin(ctx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			for blockNum := range blocks {
+				hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+				if err != nil {
+					return err
+				}
+				body := rawdb.ReadBody(tx, hash, blockNum)
+				if body == nil {
+					return fmt.Errorf("empty block body %d, hash %x", blockNum, hash)
+				}
+				atomic.AddUint64(&sample.Blocks, 1)
+				for _, txn := range body.Transactions {
+					atomic.AddUint64(&sample.Txs, 1)
+					entry := rawdb.ReadTxLookupEntry(tx, txn.Hash())
+					switch {
+					case entry == nil:
+						atomic.AddUint64(&sample.Missing, 1)
+						addExample("transaction %x of block %d: no lookup entry", txn.Hash(), blockNum)
+					case *entry != blockNum:
+						atomic.AddUint64(&sample.Wrong, 1)
+						addExample("transaction %x of block %d: lookup entry of block %d", txn.Hash(), blockNum, *entry)
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
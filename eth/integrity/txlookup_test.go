@@ -0,0 +1,82 @@
+package integrity_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestTxLookup(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 5, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(missing, wrong uint64) {
+		t.Helper()
+		sample, err := integrity.VerifyTxLookup(context.Background(), db, 100, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sample.Blocks != uint64(len(blocks)) || sample.Txs != uint64(len(blocks)) {
+			t.Fatalf("expected all blocks and transactions sampled, got %s", sample)
+		}
+		if sample.Missing != missing || sample.Wrong != wrong {
+			t.Fatalf("expected %d missing and %d wrong, got %s", missing, wrong, sample)
+		}
+	}
+	verify(0, 0)
+
+	// The pruned entry, the entry of another block and the dangling one
+	if err = rawdb.DeleteTxLookupEntry(db, blocks[0].Transactions()[0].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(dbutils.TxLookupPrefix, blocks[1].Transactions()[0].Hash().Bytes(), big.NewInt(4).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(dbutils.TxLookupPrefix, common.Hash{1}.Bytes(), big.NewInt(3).Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	verify(1, 1)
+
+	if err = stagedsync.RebuildTxLookup("rebuild", db, 2, t.TempDir(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	verify(0, 0)
+	if entry := rawdb.ReadTxLookupEntry(db, common.Hash{1}); entry != nil {
+		t.Errorf("expected the dangling entry dropped, got block %d", *entry)
+	}
+}
@@ -0,0 +1,267 @@
+package pending
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"github.com/ledgerwatch/turbo-geth/turbo/shards"
+)
+
+// overlayReadsLimit is the size of the state read through the overlay of a pending block, cached until evicted
+const overlayReadsLimit = 16 * datasize.MB
+
+// TxSource returns the pending transactions of the pool grouped by sender, in the nonce order
+type TxSource func(ctx context.Context) (map[common.Address]types.Transactions, error)
+
+// Block is the pending block: the transactions of the pool which would be included on top of the head of the
+// executed chain, with their receipts, and the state after them as the overlay of the writes of the block over the
+// state of the parent. The block is not sealed and its header has no state root, the block rewards are not applied
+type Block struct {
+	Block    *types.Block
+	Receipts types.Receipts
+
+	lock    sync.Mutex // the clones of the overlay modify it
+	overlay *shards.StateCache
+}
+
+// StateReader returns the reader of the state after the pending block. The transaction has to see the parent of the
+// block as the head of the executed chain, which Builder.Pending makes sure of
+func (b *Block) StateReader(tx ethdb.Database) state.StateReader {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return state.NewCachedReader(state.NewPlainStateReader(tx), b.overlay.Clone())
+}
+
+// Builder maintains the pending block independently of the miner: it orders the pending transactions of the pool
+// by the price and the nonce, like the miner does, and executes them on the overlay of the state of the head. The
+// block is rebuilt in the background on the new heads and periodically for the new transactions of the pool, and
+// synchronously when it is requested while being behind the head
+type Builder struct {
+	db       ethdb.Database
+	txs      TxSource
+	coinbase common.Address
+
+	lock    sync.Mutex
+	current *Block
+}
+
+// NewBuilder creates the builder of the pending blocks crediting the fees to the coinbase
+func NewBuilder(db ethdb.Database, txs TxSource, coinbase common.Address) *Builder {
+	return &Builder{db: db, txs: txs, coinbase: coinbase}
+}
+
+// Pending returns the pending block on top of the head of the executed chain seen by the transaction, building it
+// if the last one is built on another block
+func (b *Builder) Pending(ctx context.Context, tx ethdb.Database) (*Block, error) {
+	head, err := headHash(tx)
+	if err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	current := b.current
+	b.lock.Unlock()
+	if current != nil && current.Block.ParentHash() == head {
+		return current, nil
+	}
+	return b.build(ctx, tx)
+}
+
+// Run rebuilds the pending block on every new head and every interval until the quit channel is closed. The heads
+// are drained as they come, so that a slow build doesn't hold up their delivery to the other subscribers, and the
+// heads which come during a build are coalesced into one rebuild on the latest of them
+func (b *Builder) Run(heads <-chan *types.Header, interval time.Duration, quit <-chan struct{}) {
+	newHead := make(chan struct{}, 1)
+	go func() {
+		defer close(newHead)
+		for range heads {
+			select {
+			case newHead <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case _, ok := <-newHead:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+		if err := b.rebuild(context.Background()); err != nil {
+			log.Warn("Could not build the pending block", "err", err)
+		}
+	}
+}
+
+func (b *Builder) rebuild(ctx context.Context) error {
+	tx, err := b.db.Begin(ctx, ethdb.RO)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = b.build(ctx, tx)
+	return err
+}
+
+// build executes the pending transactions on top of the head of the executed chain and makes the result current
+func (b *Builder) build(ctx context.Context, tx ethdb.Database) (*Block, error) {
+	pendingTxs, err := b.txs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading the pending transactions: %w", err)
+	}
+	chainConfig, err := readChainConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	parent := rawdb.ReadHeaderByNumber(tx, executed)
+	if parent == nil {
+		return nil, fmt.Errorf("head %d of the executed chain not found", executed)
+	}
+	header := makeHeader(chainConfig, parent, b.coinbase)
+
+	overlay := shards.NewStateCache(32, overlayReadsLimit)
+	ibs := state.New(state.NewPlainStateReader(tx))
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	var baseFee *uint256.Int
+	if header.BaseFee != nil {
+		baseFee, _ = uint256.FromBig(header.BaseFee)
+	}
+	txs, receipts := applyTransactions(chainConfig, adapter.NewChainContext(tx), header, ibs,
+		types.NewTransactionsByPriceAndNonce(types.LatestSigner(chainConfig), pendingTxs, baseFee))
+	if err = ibs.CommitBlock(chainConfig.WithEIPsFlags(ctx, header.Number), state.NewCachedWriter(state.NewNoopWriter(), overlay)); err != nil {
+		return nil, err
+	}
+
+	block := &Block{Block: types.NewBlock(header, txs, nil, receipts), Receipts: receipts, overlay: overlay}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// Not replacing the block of the newer head built concurrently, unless that head is gone by the reorg to a lower one
+	if b.current == nil || b.current.Block.NumberU64() <= block.Block.NumberU64() || !b.isHead(b.current.Block.ParentHash()) {
+		b.current = block
+	}
+	log.Debug("Built the pending block", "number", header.Number, "txs", len(txs), "gas", header.GasUsed)
+	return block, nil
+}
+
+// makeHeader prepares the header of the pending block on top of the parent, as the miner does with the gas limit
+// of the parent
+func makeHeader(chainConfig *params.ChainConfig, parent *types.Header, coinbase common.Address) *types.Header {
+	timestamp := uint64(time.Now().Unix())
+	if parent.Time >= timestamp {
+		timestamp = parent.Time + 1
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       timestamp,
+		Coinbase:   coinbase,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+	}
+	if chainConfig.Clique == nil && chainConfig.Aura == nil && chainConfig.Bor == nil {
+		header.Difficulty = ethash.CalcDifficulty(chainConfig, timestamp, parent.Time, parent.Difficulty, parent.Number, parent.UncleHash)
+	}
+	if chainConfig.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(chainConfig, parent)
+		if !chainConfig.IsLondon(parent.Number) {
+			header.GasLimit = parent.GasLimit * chainConfig.ElasticityMultiplier(header.Number)
+		}
+	}
+	return header
+}
+
+// applyTransactions executes the transactions while they fit in the gas limit, skipping the ones which fail, the
+// way the miner does
+func applyTransactions(chainConfig *params.ChainConfig, cc core.ChainContext, header *types.Header, ibs *state.IntraBlockState, txs *types.TransactionsByPriceAndNonce) (types.Transactions, types.Receipts) {
+	var (
+		included types.Transactions
+		receipts types.Receipts
+		gasPool  = new(core.GasPool).AddGas(header.GasLimit)
+		noop     = state.NewNoopWriter()
+	)
+	for gasPool.Gas() >= params.TxGas {
+		txn := txs.Peek()
+		if txn == nil {
+			break
+		}
+		if txn.Protected() && !chainConfig.IsEIP155(header.Number) {
+			txs.Pop()
+			continue
+		}
+		ibs.Prepare(txn.Hash(), common.Hash{}, len(included))
+		snap := ibs.Snapshot()
+		receipt, err := core.ApplyTransaction(chainConfig, cc, &header.Coinbase, gasPool, ibs, noop, header, txn, &header.GasUsed, vm.Config{})
+		switch err {
+		case nil:
+			included = append(included, txn)
+			receipts = append(receipts, receipt)
+			txs.Shift()
+		case core.ErrGasLimitReached, core.ErrNonceTooHigh:
+			ibs.RevertToSnapshot(snap)
+			txs.Pop()
+		default:
+			ibs.RevertToSnapshot(snap)
+			txs.Shift()
+		}
+	}
+	return included, receipts
+}
+
+// isHead tells if the block is the head of the executed chain in the latest state of the database
+func (b *Builder) isHead(hash common.Hash) bool {
+	head, err := headHash(b.db)
+	return err == nil && head == hash
+}
+
+func headHash(tx ethdb.Database) (common.Hash, error) {
+	executed, err := stages.GetStageProgress(tx, stages.Execution)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return rawdb.ReadCanonicalHash(tx, executed)
+}
+
+func readChainConfig(tx ethdb.Database) (*params.ChainConfig, error) {
+	genesisHash, err := rawdb.ReadCanonicalHash(tx, 0)
+	if err != nil {
+		return nil, err
+	}
+	chainConfig, err := rawdb.ReadChainConfig(tx, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if chainConfig == nil {
+		return nil, fmt.Errorf("chain config not found")
+	}
+	return chainConfig, nil
+}
@@ -0,0 +1,157 @@
+package pending
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestPendingBlock(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to, coinbase := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}, common.Address{2}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt().SetUint64(1), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, b *core.BlockGen) {
+		b.AddTx(transfer(b.TxNonce(sender)))
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks[:1], true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pool has the nonces 1 and 2, the nonce 1 is mined in the block 2 later
+	pool := types.Transactions{transfer(1), transfer(2)}
+	builder := NewBuilder(db, func(context.Context) (map[common.Address]types.Transactions, error) {
+		return map[common.Address]types.Transactions{sender: pool}, nil
+	}, coinbase)
+	pending, err := builder.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Block.NumberU64() != 2 || pending.Block.ParentHash() != blocks[0].Hash() {
+		t.Fatalf("pending block %d on top of %x, expected 2 on top of %x", pending.Block.NumberU64(), pending.Block.ParentHash(), blocks[0].Hash())
+	}
+	if len(pending.Block.Transactions()) != 2 || len(pending.Receipts) != 2 {
+		t.Fatalf("expected 2 transactions and receipts, got %d and %d", len(pending.Block.Transactions()), len(pending.Receipts))
+	}
+	if pending.Block.GasUsed() != 2*params.TxGas || pending.Block.Coinbase() != coinbase {
+		t.Errorf("unexpected gas used %d or coinbase %x", pending.Block.GasUsed(), pending.Block.Coinbase())
+	}
+	again, err := builder.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != pending {
+		t.Errorf("expected the pending block to be reused while the head is the same")
+	}
+
+	// The state after the pending block
+	reader := pending.StateReader(db)
+	acc, err := reader.ReadAccountData(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc == nil || acc.Balance.Uint64() != 3000 {
+		t.Errorf("expected the balance 3000 after the pending block, got %v", acc)
+	}
+	acc, err = reader.ReadAccountData(sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc == nil || acc.Nonce != 3 {
+		t.Errorf("expected the nonce 3 after the pending block, got %v", acc)
+	}
+
+	// The new head includes the transaction with the nonce 1, the pending block is rebuilt on top of it
+	if _, err = stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks[1:], true /* checkRoot */); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = builder.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Block.ParentHash() != blocks[1].Hash() || len(pending.Block.Transactions()) != 1 || pending.Block.Transactions()[0].Nonce() != 2 {
+		t.Fatalf("expected the pending block with the nonce 2 on top of %x", blocks[1].Hash())
+	}
+
+	// After the reorg to the lower head the block built on it replaces the one of the higher head
+	if err = stages.SaveStageProgress(db, stages.Execution, 1); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = builder.Pending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Block.ParentHash() != blocks[0].Hash() {
+		t.Fatalf("expected the pending block on top of %x after the reorg", blocks[0].Hash())
+	}
+	if again, err = builder.Pending(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if again != pending {
+		t.Errorf("expected the pending block of the lower head to be reused")
+	}
+}
+
+func TestRunDrainsHeads(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	builds := make(chan struct{})
+	builder := NewBuilder(db, func(context.Context) (map[common.Address]types.Transactions, error) {
+		<-builds
+		return nil, errors.New("no pool")
+	}, common.Address{})
+	heads, quit := make(chan *types.Header), make(chan struct{})
+	defer close(quit)
+	go builder.Run(heads, time.Hour, quit)
+
+	// The heads are taken while the build is stuck, and coalesced into a few more builds rather than one per head
+	for i := 0; i < 10; i++ {
+		select {
+		case heads <- &types.Header{}:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("head %d is not taken while building", i)
+		}
+	}
+	var built int
+	for ; ; built++ {
+		select {
+		case builds <- struct{}{}:
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	if built < 1 || built > 3 {
+		t.Errorf("expected the 10 heads to be coalesced into up to 3 builds, got %d", built)
+	}
+}
@@ -78,7 +78,7 @@ func newTestBackendWithGenerator(blocks int, generator func(int, *core.BlockGen)
 		headBlock = bs[len(bs)-1]
 	}
 	txconfig := core.DefaultTxPoolConfig
-	txconfig.Journal = "" // Don't litter the disk with test journals
+	txconfig.Journal = false // Don't litter the database with test journals
 
 	chain, _ := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
 	txCacher := core.NewTxSenderCacher(1)
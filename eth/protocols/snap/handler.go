@@ -0,0 +1,612 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+	"github.com/ledgerwatch/turbo-geth/p2p/enr"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+)
+
+const (
+	// softResponseLimit is the target maximum size of replies to data retrievals.
+	softResponseLimit = 2 * 1024 * 1024
+
+	// maxCodeLookups is the maximum number of bytecodes to serve. This number is
+	// there to limit the number of disk lookups.
+	maxCodeLookups = 1024
+
+	// stateLookupSlack defines the ratio by how much a state response can exceed
+	// the requested limit in order to try and avoid breaking up contracts into
+	// multiple packages and proving them.
+	stateLookupSlack = 0.1
+
+	// maxTrieNodeLookups is the maximum number of state trie nodes to serve. This
+	// number is there to limit the number of disk lookups.
+	maxTrieNodeLookups = 1024
+
+	// maxTrieNodeTimeSpent is the maximum time we should spend on looking up trie nodes.
+	// If we spend too much time, then it's a fairly high chance of timing out
+	// at the remote side, which means all the work is in vain.
+	maxTrieNodeTimeSpent = 5 * time.Second
+)
+
+// Handler is a callback to invoke from an outside runner after the boilerplate
+// exchanges have passed.
+type Handler func(peer *Peer) error
+
+// Backend defines the data retrieval methods to serve remote requests and the
+// callback methods to invoke on remote deliveries.
+type Backend interface {
+	// DB retrieves the database the state is served from. The state is taken from the
+	// hashed state buckets and the proofs are built from the intermediate hashes, so
+	// only the state root of the block reached by the IntermediateHashes stage is served.
+	DB() ethdb.Database
+
+	// RunPeer is invoked when a peer joins on the `snap` protocol. The handler
+	// should do any peer maintenance work, handshakes and validations. If all
+	// is passed, control should be given back to the `handler` to process the
+	// inbound messages going forward.
+	RunPeer(peer *Peer, handler Handler) error
+
+	// PeerInfo retrieves all known `snap` information about a peer.
+	PeerInfo(id enode.ID) interface{}
+}
+
+// MakeProtocols constructs the P2P protocol definitions for `snap`.
+func MakeProtocols(backend Backend) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Generate a closure for the current version
+
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  protocolLengths[version],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return backend.RunPeer(NewPeer(version, p, rw), func(peer *Peer) error {
+					return Handle(backend, peer)
+				})
+			},
+			NodeInfo: func() interface{} {
+				return nodeInfo(backend.DB())
+			},
+			PeerInfo: func(id enode.ID) interface{} {
+				return backend.PeerInfo(id)
+			},
+			Attributes: []enr.Entry{&enrEntry{}},
+		}
+	}
+	return protocols
+}
+
+// Handle is the callback invoked to manage the life cycle of a `snap` peer.
+// When this function terminates, the peer is disconnected.
+func Handle(backend Backend, peer *Peer) error {
+	for {
+		if err := handleMessage(backend, peer); err != nil {
+			peer.Log().Debug("Message handling failed in `snap`", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage is invoked whenever an inbound message is received from a
+// remote peer on the `snap` protocol. The remote connection is torn down upon
+// returning any error.
+func handleMessage(backend Backend, peer *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > maxMessageSize {
+		return fmt.Errorf("%w: %v > %v", errMsgTooLarge, msg.Size, maxMessageSize)
+	}
+	defer msg.Discard()
+	start := time.Now()
+
+	// Handle the message depending on its contents
+	switch {
+	case msg.Code == GetAccountRangeMsg:
+		var req GetAccountRangePacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		accounts, proofs, err := ServiceGetAccountRangeQuery(backend.DB(), &req)
+		if err != nil {
+			peer.Log().Debug("Failed to serve account range", "root", req.Root, "origin", req.Origin, "err", err)
+		}
+		return p2p.Send(peer.rw, AccountRangeMsg, &AccountRangePacket{
+			ID:       req.ID,
+			Accounts: accounts,
+			Proof:    proofs,
+		})
+
+	case msg.Code == GetStorageRangesMsg:
+		var req GetStorageRangesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		slots, proofs, err := ServiceGetStorageRangesQuery(backend.DB(), &req)
+		if err != nil {
+			peer.Log().Debug("Failed to serve storage ranges", "root", req.Root, "accounts", len(req.Accounts), "err", err)
+		}
+		return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{
+			ID:    req.ID,
+			Slots: slots,
+			Proof: proofs,
+		})
+
+	case msg.Code == GetByteCodesMsg:
+		var req GetByteCodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		codes, err := ServiceGetByteCodesQuery(backend.DB(), &req)
+		if err != nil {
+			peer.Log().Debug("Failed to serve bytecodes", "hashes", len(req.Hashes), "err", err)
+		}
+		return p2p.Send(peer.rw, ByteCodesMsg, &ByteCodesPacket{
+			ID:    req.ID,
+			Codes: codes,
+		})
+
+	case msg.Code == GetTrieNodesMsg:
+		var req GetTrieNodesPacket
+		if err := msg.Decode(&req); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		nodes, err := ServiceGetTrieNodesQuery(backend.DB(), &req, start)
+		if errors.Is(err, errBadRequest) {
+			return err
+		}
+		if err != nil {
+			peer.Log().Debug("Failed to serve trie nodes", "root", req.Root, "pathsets", len(req.Paths), "err", err)
+		}
+		return p2p.Send(peer.rw, TrieNodesMsg, &TrieNodesPacket{
+			ID:    req.ID,
+			Nodes: nodes,
+		})
+
+	case msg.Code == AccountRangeMsg, msg.Code == StorageRangesMsg, msg.Code == ByteCodesMsg, msg.Code == TrieNodesMsg:
+		// The state is only served, never synced over `snap`, so nothing was requested
+		peer.Log().Trace("Dropping unrequested `snap` response", "code", msg.Code)
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
+	}
+}
+
+// ServiceGetAccountRangeQuery assembles the response to an account range query.
+// It is exposed to allow external packages to test protocol behavior.
+func ServiceGetAccountRangeQuery(db ethdb.Database, req *GetAccountRangePacket) ([]*AccountData, [][]byte, error) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	if available, err := stateAvailable(tx, req.Root); !available {
+		return nil, nil, err
+	}
+	kvTx := tx.(ethdb.HasTx).Tx()
+
+	// Iterate over the requested range and pile accounts up. The storage roots aren't
+	// in the hashed state, so the size of the slim encoding is estimated with them
+	var (
+		size   uint64
+		hashes []common.Hash
+		accs   []accounts.Account
+	)
+	c := kvTx.Cursor(dbutils.HashedAccountsBucket)
+	defer c.Close()
+	for k, v, err := c.Seek(req.Origin[:]); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, nil, err
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return nil, nil, err
+		}
+		hash := common.BytesToHash(k)
+		hashes = append(hashes, hash)
+		accs = append(accs, acc)
+		size += uint64(common.HashLength + len(v) + common.HashLength)
+		if bytes.Compare(hash[:], req.Limit[:]) >= 0 {
+			break
+		}
+		if size > req.Bytes {
+			break
+		}
+	}
+
+	// The storage roots and the proofs for the first and last account come from the trie
+	keys := make([][]byte, 0, len(hashes)+1)
+	keys = append(keys, req.Origin[:])
+	for i := range hashes {
+		keys = append(keys, hashes[i][:])
+	}
+	t, err := trie.LoadRetainedTrie(kvTx, req.Root, keys, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make([]*AccountData, len(hashes))
+	for i, hash := range hashes {
+		if acc, ok := t.GetAccount(hash[:]); ok && acc != nil {
+			accs[i].Root = acc.Root
+		} else {
+			return nil, nil, fmt.Errorf("account %x is missing in the trie", hash)
+		}
+		body, err := slimAccountRLP(&accs[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		result[i] = &AccountData{Hash: hash, Body: body}
+	}
+	proofKeys := [][]byte{req.Origin[:]}
+	if len(hashes) > 0 {
+		proofKeys = append(proofKeys, hashes[len(hashes)-1][:])
+	}
+	proofs, err := proveKeys(t, proofKeys, 0, false /* storage */)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, proofs, nil
+}
+
+// ServiceGetStorageRangesQuery assembles the response to a storage ranges query.
+// It is exposed to allow external packages to test protocol behavior.
+func ServiceGetStorageRangesQuery(db ethdb.Database, req *GetStorageRangesPacket) ([][]*StorageData, [][]byte, error) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	// Calculate the hard limit at which to abort, even if mid storage trie
+	hardLimit := uint64(float64(req.Bytes) * (1 + stateLookupSlack))
+
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	if available, err := stateAvailable(tx, req.Root); !available {
+		return nil, nil, err
+	}
+	kvTx := tx.(ethdb.HasTx).Tx()
+
+	// Retrieve storage ranges until the packet limit is reached
+	var (
+		slots  [][]*StorageData
+		proofs [][]byte
+		size   uint64
+	)
+	c := kvTx.Cursor(dbutils.HashedStorageBucket)
+	defer c.Close()
+	for _, account := range req.Accounts {
+		// If we've exceeded the requested data limit, abort without opening
+		// a new storage range (that we'd need to prove due to exceeded size)
+		if size >= req.Bytes {
+			break
+		}
+		// The first account might start from a different origin and end sooner
+		var origin common.Hash
+		if len(req.Origin) > 0 {
+			origin, req.Origin = common.BytesToHash(req.Origin), nil
+		}
+		var limit = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+		if len(req.Limit) > 0 {
+			limit, req.Limit = common.BytesToHash(req.Limit), nil
+		}
+		var incarnation uint64
+		enc, err := kvTx.GetOne(dbutils.HashedAccountsBucket, account[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(enc) > 0 {
+			var acc accounts.Account
+			if err = acc.DecodeForStorage(enc); err != nil {
+				return nil, nil, err
+			}
+			incarnation = acc.Incarnation
+		}
+		// Iterate over the requested range and pile slots up
+		var (
+			storage []*StorageData
+			last    common.Hash
+			abort   bool
+		)
+		if incarnation > 0 {
+			prefix := dbutils.GenerateStoragePrefix(account[:], incarnation)
+			seek := make([]byte, len(prefix)+common.HashLength)
+			copy(seek, prefix)
+			copy(seek[len(prefix):], origin[:])
+			for k, v, err := c.Seek(seek); k != nil && bytes.HasPrefix(k, prefix); k, v, err = c.Next() {
+				if err != nil {
+					return nil, nil, err
+				}
+				if size >= hardLimit {
+					abort = true
+					break
+				}
+				// The hashed state keeps the values, the trie keeps them RLP encoded
+				body, err := rlp.EncodeToBytes(v)
+				if err != nil {
+					return nil, nil, err
+				}
+				hash := common.BytesToHash(k[len(prefix):])
+				last = hash
+				storage = append(storage, &StorageData{Hash: hash, Body: body})
+				size += uint64(common.HashLength + len(body))
+				if bytes.Compare(hash[:], limit[:]) >= 0 {
+					break
+				}
+			}
+		}
+		if len(storage) > 0 {
+			slots = append(slots, storage)
+		}
+		// Generate the Merkle proofs for the first and last storage slot, but
+		// only if the response was capped. If the entire storage trie included
+		// in the response, no need for any proofs.
+		if origin != (common.Hash{}) || (abort && len(storage) > 0) {
+			// The empty storage trie of an account without storage has nothing to prove
+			if incarnation > 0 {
+				keys := [][]byte{account[:], dbutils.GenerateCompositeStorageKey(account, incarnation, origin)}
+				proofKeys := [][]byte{dbutils.GenerateCompositeTrieKey(account, origin)}
+				if last != (common.Hash{}) {
+					keys = append(keys, dbutils.GenerateCompositeStorageKey(account, incarnation, last))
+					proofKeys = append(proofKeys, dbutils.GenerateCompositeTrieKey(account, last))
+				}
+				t, err := trie.LoadRetainedTrie(kvTx, req.Root, keys, nil)
+				if err != nil {
+					return nil, nil, err
+				}
+				if proofs, err = proveKeys(t, proofKeys, 64 /* nibbles to get to the storage sub-trie */, true /* storage */); err != nil {
+					return nil, nil, err
+				}
+			}
+			// Proof terminates the reply as proofs are only added if a node
+			// refuses to serve more data (exception when a contract fetch is
+			// finishing, but that's that).
+			break
+		}
+	}
+	return slots, proofs, nil
+}
+
+// ServiceGetByteCodesQuery assembles the response to a byte codes query.
+// It is exposed to allow external packages to test protocol behavior.
+func ServiceGetByteCodesQuery(db ethdb.Database, req *GetByteCodesPacket) ([][]byte, error) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	if len(req.Hashes) > maxCodeLookups {
+		req.Hashes = req.Hashes[:maxCodeLookups]
+	}
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	kvTx := tx.(ethdb.HasTx).Tx()
+
+	// Retrieve bytecodes until the packet size limit is reached
+	var (
+		codes [][]byte
+		size  uint64
+	)
+	for _, hash := range req.Hashes {
+		if hash == trie.EmptyCodeHash {
+			// Peers should not request the empty code, but if they do, at
+			// least sent them back a correct response without db lookups
+			codes = append(codes, []byte{})
+		} else {
+			code, err := kvTx.GetOne(dbutils.CodeBucket, hash[:])
+			if err != nil {
+				return nil, err
+			}
+			if code != nil {
+				codes = append(codes, common.CopyBytes(code))
+				size += uint64(len(code))
+			}
+		}
+		if size > req.Bytes {
+			break
+		}
+	}
+	return codes, nil
+}
+
+// ServiceGetTrieNodesQuery assembles the response to a trie nodes query.
+// It is exposed to allow external packages to test protocol behavior.
+func ServiceGetTrieNodesQuery(db ethdb.Database, req *GetTrieNodesPacket, start time.Time) ([][]byte, error) {
+	if req.Bytes > softResponseLimit {
+		req.Bytes = softResponseLimit
+	}
+	tx, err := db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if available, err := stateAvailable(tx, req.Root); !available {
+		return nil, err
+	}
+	kvTx := tx.(ethdb.HasTx).Tx()
+
+	// The trie nodes don't exist in the database, all the requested ones are built from
+	// the intermediate hashes at once
+	var lookups [][]byte
+	for _, pathset := range req.Paths {
+		switch len(pathset) {
+		case 0:
+			// Ensure we penalize invalid requests
+			return nil, fmt.Errorf("%w: zero-item pathset requested", errBadRequest)
+
+		case 1:
+			// If we're only retrieving an account trie node, fetch it directly
+			lookups = append(lookups, trie.CompactToHex(pathset[0]))
+
+		default:
+			// Storage slots requested, the paths continue the account key
+			if len(pathset[0]) != common.HashLength {
+				return nil, fmt.Errorf("%w: account path of %d bytes", errBadRequest, len(pathset[0]))
+			}
+			accountHex := keybytesToNibbles(pathset[0])
+			for _, path := range pathset[1:] {
+				lookups = append(lookups, concat(accountHex, trie.CompactToHex(path)))
+			}
+		}
+		if len(lookups) >= maxTrieNodeLookups {
+			break
+		}
+	}
+	blobs, err := trie.GetTrieNodesByPaths(kvTx, req.Root, lookups)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nodes [][]byte
+		size  uint64
+	)
+	for _, blob := range blobs {
+		if blob == nil {
+			// The nodes must be in the order of the request, so stop at the first missing one
+			break
+		}
+		nodes = append(nodes, blob)
+		size += uint64(len(blob))
+		if size > req.Bytes || time.Since(start) > maxTrieNodeTimeSpent {
+			break
+		}
+	}
+	return nodes, nil
+}
+
+// stateAvailable returns whether the state with the given root can be served, which is only
+// the case for the state of the block reached by the IntermediateHashes stage
+func stateAvailable(db ethdb.Getter, root common.Hash) (bool, error) {
+	number, err := stages.GetStageProgress(db, stages.IntermediateHashes)
+	if err != nil {
+		return false, err
+	}
+	hash, err := rawdb.ReadCanonicalHash(db, number)
+	if err != nil {
+		return false, err
+	}
+	header := rawdb.ReadHeader(db, hash, number)
+	if header == nil {
+		return false, nil
+	}
+	return header.Root == root, nil
+}
+
+// slimAccountRLP encodes the account in the format of the `snap` protocol
+func slimAccountRLP(acc *accounts.Account) (rlp.RawValue, error) {
+	slim := slimAccount{
+		Nonce:   acc.Nonce,
+		Balance: acc.Balance.ToBig(),
+	}
+	if !acc.IsEmptyRoot() {
+		slim.Root = acc.Root[:]
+	}
+	if !acc.IsEmptyCodeHash() {
+		slim.CodeHash = acc.CodeHash[:]
+	}
+	return rlp.EncodeToBytes(slim)
+}
+
+// proveKeys collects the proofs of the keys, the nodes shared by the proofs are included only once
+func proveKeys(t *trie.Trie, keys [][]byte, fromLevel int, storage bool) ([][]byte, error) {
+	var proofs [][]byte
+	known := make(map[string]struct{})
+	for _, key := range keys {
+		proof, err := t.Prove(key, fromLevel, storage)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range proof {
+			if _, ok := known[string(node)]; !ok {
+				known[string(node)] = struct{}{}
+				proofs = append(proofs, node)
+			}
+		}
+	}
+	return proofs, nil
+}
+
+func keybytesToNibbles(key []byte) []byte {
+	nibbles := make([]byte, 2*len(key))
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	return nibbles
+}
+
+func concat(parts ...[]byte) []byte {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	res := make([]byte, 0, n)
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
+
+// NodeInfo represents a short summary of the `snap` sub-protocol metadata
+// known about the host peer.
+type NodeInfo struct {
+	Root common.Hash `json:"root"` // State root served to the peers
+}
+
+// nodeInfo retrieves some `snap` protocol metadata about the running host node.
+func nodeInfo(db ethdb.Database) *NodeInfo {
+	number, err := stages.GetStageProgress(db, stages.IntermediateHashes)
+	if err != nil {
+		log.Warn("Failed to read the state served over `snap`", "err", err)
+		return &NodeInfo{}
+	}
+	hash, err := rawdb.ReadCanonicalHash(db, number)
+	if err != nil {
+		log.Warn("Failed to read the state served over `snap`", "err", err)
+		return &NodeInfo{}
+	}
+	if header := rawdb.ReadHeader(db, hash, number); header != nil {
+		return &NodeInfo{Root: header.Root}
+	}
+	return &NodeInfo{}
+}
@@ -0,0 +1,196 @@
+package snap
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var maxHash = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+// setupState writes 100 accounts, every 10th of them with 20 storage slots and code, and
+// makes their state root the one of the block reached by the IntermediateHashes stage
+func setupState(t *testing.T) (ethdb.Database, common.Hash, []common.Hash) {
+	db := ethdb.NewMemDatabase()
+	addrHashes := make([]common.Hash, 100)
+	for i := range addrHashes {
+		addrHashes[i] = common.BytesToHash(crypto.Keccak256([]byte{byte(i)}))
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		acc.Balance.SetUint64(uint64(i) * 1000000007)
+		if i%10 == 0 {
+			acc.Incarnation = 1
+			code := []byte{byte(i), 0x60, 0x00}
+			acc.CodeHash = crypto.Keccak256Hash(code)
+			require.NoError(t, db.Put(dbutils.CodeBucket, acc.CodeHash[:], code))
+			for j := 0; j < 20; j++ {
+				keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+				require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 1, keyHash), []byte{byte(j + 1)}))
+			}
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHashes[i][:], enc))
+	}
+	root, err := trie.CalcRoot("test", db)
+	require.NoError(t, err)
+
+	header := &types.Header{Number: common.Big1, Root: root}
+	rawdb.WriteHeader(context.Background(), db, header)
+	require.NoError(t, rawdb.WriteCanonicalHash(db, header.Hash(), 1))
+	require.NoError(t, stages.SaveStageProgress(db, stages.IntermediateHashes, 1))
+
+	sort.Slice(addrHashes, func(i, j int) bool { return bytes.Compare(addrHashes[i][:], addrHashes[j][:]) < 0 })
+	return db, root, addrHashes
+}
+
+func TestServiceGetAccountRange(t *testing.T) {
+	db, root, addrHashes := setupState(t)
+	defer db.Close()
+
+	// The whole state fits in the response
+	accs, proofs, err := ServiceGetAccountRangeQuery(db, &GetAccountRangePacket{Root: root, Limit: maxHash, Bytes: softResponseLimit})
+	require.NoError(t, err)
+	require.Len(t, accs, len(addrHashes))
+	for i := range accs {
+		assert.Equal(t, addrHashes[i], accs[i].Hash)
+	}
+	require.NotEmpty(t, proofs)
+	assert.Equal(t, root, crypto.Keccak256Hash(proofs[0]))
+
+	// The storage roots of the accounts are the roots of their storage tries
+	var withStorage int
+	for _, acc := range accs {
+		var slim slimAccount
+		require.NoError(t, rlp.DecodeBytes(acc.Body, &slim))
+		if len(slim.Root) == 0 {
+			assert.Empty(t, slim.CodeHash)
+			continue
+		}
+		withStorage++
+		nodes, err := ServiceGetTrieNodesQuery(db, &GetTrieNodesPacket{Root: root, Paths: []TrieNodePathSet{{acc.Hash[:], {0x00}}}, Bytes: softResponseLimit}, time.Now())
+		require.NoError(t, err)
+		require.Len(t, nodes, 1)
+		assert.Equal(t, common.BytesToHash(slim.Root), crypto.Keccak256Hash(nodes[0]))
+	}
+	assert.Equal(t, 10, withStorage)
+
+	// The range is cut by the size and starts from the origin
+	accs, proofs, err = ServiceGetAccountRangeQuery(db, &GetAccountRangePacket{Root: root, Origin: addrHashes[10], Limit: maxHash, Bytes: 500})
+	require.NoError(t, err)
+	require.NotEmpty(t, accs)
+	assert.Less(t, len(accs), len(addrHashes)-10)
+	assert.Equal(t, addrHashes[10], accs[0].Hash)
+	require.NotEmpty(t, proofs)
+	assert.Equal(t, root, crypto.Keccak256Hash(proofs[0]))
+
+	// Unknown state is not served
+	accs, proofs, err = ServiceGetAccountRangeQuery(db, &GetAccountRangePacket{Root: common.Hash{1}, Limit: maxHash, Bytes: softResponseLimit})
+	require.NoError(t, err)
+	assert.Empty(t, accs)
+	assert.Empty(t, proofs)
+}
+
+func TestServiceGetStorageRanges(t *testing.T) {
+	db, root, _ := setupState(t)
+	defer db.Close()
+
+	accs, _, err := ServiceGetAccountRangeQuery(db, &GetAccountRangePacket{Root: root, Limit: maxHash, Bytes: softResponseLimit})
+	require.NoError(t, err)
+	var contracts, plain []common.Hash
+	storageRoots := make(map[common.Hash]common.Hash)
+	for _, acc := range accs {
+		var slim slimAccount
+		require.NoError(t, rlp.DecodeBytes(acc.Body, &slim))
+		if len(slim.Root) > 0 {
+			contracts = append(contracts, acc.Hash)
+			storageRoots[acc.Hash] = common.BytesToHash(slim.Root)
+		} else {
+			plain = append(plain, acc.Hash)
+		}
+	}
+	require.Len(t, contracts, 10)
+
+	// Complete storage tries don't need proofs
+	slots, proofs, err := ServiceGetStorageRangesQuery(db, &GetStorageRangesPacket{Root: root, Accounts: contracts, Bytes: softResponseLimit})
+	require.NoError(t, err)
+	require.Len(t, slots, 10)
+	for _, storage := range slots {
+		require.Len(t, storage, 20)
+		for i := 1; i < len(storage); i++ {
+			assert.Equal(t, -1, bytes.Compare(storage[i-1].Hash[:], storage[i].Hash[:]))
+		}
+	}
+	assert.Empty(t, proofs)
+
+	// Storage from the origin is proven up to the storage root of the account
+	origin := slots[0][5].Hash
+	slots, proofs, err = ServiceGetStorageRangesQuery(db, &GetStorageRangesPacket{Root: root, Accounts: contracts[:1], Origin: origin[:], Bytes: softResponseLimit})
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	require.Len(t, slots[0], 15)
+	assert.Equal(t, origin, slots[0][0].Hash)
+	require.NotEmpty(t, proofs)
+	assert.Equal(t, storageRoots[contracts[0]], crypto.Keccak256Hash(proofs[0]))
+
+	// Accounts without storage are skipped
+	slots, proofs, err = ServiceGetStorageRangesQuery(db, &GetStorageRangesPacket{Root: root, Accounts: []common.Hash{plain[0], contracts[1]}, Bytes: softResponseLimit})
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	assert.Len(t, slots[0], 20)
+	assert.Empty(t, proofs)
+}
+
+func TestServiceGetByteCodes(t *testing.T) {
+	db, _, _ := setupState(t)
+	defer db.Close()
+
+	code := []byte{10, 0x60, 0x00}
+	codes, err := ServiceGetByteCodesQuery(db, &GetByteCodesPacket{
+		Hashes: []common.Hash{crypto.Keccak256Hash(code), {1}, trie.EmptyCodeHash},
+		Bytes:  softResponseLimit,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{code, {}}, codes)
+}
+
+func TestServiceGetTrieNodes(t *testing.T) {
+	db, root, _ := setupState(t)
+	defer db.Close()
+
+	nodes, err := ServiceGetTrieNodesQuery(db, &GetTrieNodesPacket{Root: root, Paths: []TrieNodePathSet{{{0x00}}}, Bytes: softResponseLimit}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, root, crypto.Keccak256Hash(nodes[0]))
+
+	// The children of the root are referenced by their hashes in the root node
+	var paths []TrieNodePathSet
+	for i := byte(0); i < 16; i++ {
+		paths = append(paths, TrieNodePathSet{{0x10 | i}})
+	}
+	children, err := ServiceGetTrieNodesQuery(db, &GetTrieNodesPacket{Root: root, Paths: paths, Bytes: softResponseLimit}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, children, 16)
+	for _, child := range children {
+		hash := crypto.Keccak256Hash(child)
+		assert.True(t, bytes.Contains(nodes[0], hash[:]))
+	}
+
+	_, err = ServiceGetTrieNodesQuery(db, &GetTrieNodesPacket{Root: root, Paths: []TrieNodePathSet{{}}, Bytes: softResponseLimit}, time.Now())
+	assert.ErrorIs(t, err, errBadRequest)
+}
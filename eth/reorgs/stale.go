@@ -0,0 +1,78 @@
+package reorgs
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// StaleBlock is a block reorged out of the canonical chain, with its total difficulty
+type StaleBlock struct {
+	Block *types.Block
+	Td    *big.Int
+}
+
+// StaleBlocks keeps the blocks reorged out of the canonical chain within the window of the recent blocks,
+// so that they can still be served to the tools analysing the reorgs, whatever happens to them in the database
+type StaleBlocks struct {
+	lock   sync.RWMutex
+	window uint64
+	head   uint64
+	blocks map[common.Hash]*StaleBlock
+}
+
+// NewStaleBlocks creates the store of the blocks reorged out within the given number of the recent blocks
+func NewStaleBlocks(window uint64) *StaleBlocks {
+	return &StaleBlocks{
+		window: window,
+		blocks: make(map[common.Hash]*StaleBlock),
+	}
+}
+
+// Add keeps the block reorged out, unless it is below the window already
+func (s *StaleBlocks) Add(block *types.Block, td *big.Int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if block.NumberU64()+s.window <= s.head {
+		return
+	}
+	s.blocks[block.Hash()] = &StaleBlock{Block: block, Td: td}
+}
+
+// Remove forgets the block, once it is back in the canonical chain
+func (s *StaleBlocks) Remove(hash common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blocks, hash)
+}
+
+// Get returns the block reorged out, or nil if it is unknown or not recent anymore. The nil store keeps nothing
+func (s *StaleBlocks) Get(hash common.Hash) *StaleBlock {
+	if s == nil {
+		return nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.blocks[hash]
+}
+
+// SetHead moves the window to the new canonical head, forgetting the blocks below it
+func (s *StaleBlocks) SetHead(head uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.head = head
+	for h, b := range s.blocks {
+		if b.Block.NumberU64()+s.window <= head {
+			delete(s.blocks, h)
+		}
+	}
+}
+
+// Len returns the number of the blocks kept
+func (s *StaleBlocks) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.blocks)
+}
@@ -0,0 +1,213 @@
+// Package reorgs tracks the reorganisations of the recent canonical chain as seen by the node, so that
+// the confirmation requirements (e.g. of the exchanges) can be tuned with the data of their own node.
+package reorgs
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// DefaultRecentBlocks is the number of the recent blocks the reorgs are tracked for
+const DefaultRecentBlocks = 1024
+
+const maxReorgs = 10000 // Reorgs kept for the windows, the oldest ones are dropped above this
+
+// Window is a time window the maximum reorg depth is reported for
+type Window struct {
+	Name     string
+	Duration time.Duration
+	gauge    metrics.Gauge
+}
+
+// Windows are the time windows the maximum reorg depth is reported for, as RPC results and as metrics
+var Windows = []*Window{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: 24 * time.Hour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour},
+	{Name: "30d", Duration: 30 * 24 * time.Hour},
+}
+
+var reorgCounter = metrics.NewRegisteredCounter("chain/reorg/count", nil)
+
+func init() {
+	for _, w := range Windows {
+		w.gauge = metrics.NewRegisteredGauge("chain/reorg/maxdepth/"+w.Name, nil)
+	}
+}
+
+// Reorg is a reorganisation of the canonical chain
+type Reorg struct {
+	Time      time.Time
+	ForkBlock uint64 // Highest block shared by the old and the new canonical chains
+	Depth     uint64 // Number of the blocks removed from the canonical chain
+}
+
+// blockStats is how many times a block has been reorged out of the canonical chain, and back into it
+type blockStats struct {
+	number      uint64
+	reorgedOut  int
+	reorgedBack int
+}
+
+// Tracker follows the canonical headers, notified in the order of the block numbers after each sync cycle,
+// and records the reorgs. A header for the height not above the head means that the chain has been
+// reorganised starting from that height
+type Tracker struct {
+	lock      sync.RWMutex
+	recent    uint64
+	head      uint64
+	started   time.Time
+	canonical map[uint64]common.Hash // Canonical hashes of the recent blocks
+	blocks    map[common.Hash]*blockStats
+	reorgs    []Reorg // In the order of time
+	now       func() time.Time
+}
+
+// NewTracker creates the tracker of the reorgs for the given number of the recent blocks
+func NewTracker(recent uint64) *Tracker {
+	return &Tracker{
+		recent:    recent,
+		started:   time.Now(),
+		canonical: make(map[uint64]common.Hash),
+		blocks:    make(map[common.Hash]*blockStats),
+		now:       time.Now,
+	}
+}
+
+// OnNewHeader records the header which has become canonical, and returns the hashes of the blocks it has
+// reorged out of the canonical chain
+func (t *Tracker) OnNewHeader(header *types.Header) (reorgedOut []common.Hash) {
+	number, hash := header.Number.Uint64(), header.Hash()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	if len(t.canonical) > 0 && number <= t.head {
+		if t.canonical[number] == hash {
+			// Notified again, e.g. after the unwind to a lower block, the chain is the same up to here
+			return nil
+		}
+		depth := t.head - number + 1
+		for n := number; n <= t.head; n++ {
+			if h, ok := t.canonical[n]; ok {
+				t.getBlock(h, n).reorgedOut++
+				delete(t.canonical, n)
+				reorgedOut = append(reorgedOut, h)
+			}
+		}
+		t.reorgs = append(t.reorgs, Reorg{Time: now, ForkBlock: number - 1, Depth: depth})
+		if len(t.reorgs) > maxReorgs {
+			t.reorgs = t.reorgs[len(t.reorgs)-maxReorgs:]
+		}
+		reorgCounter.Inc(1)
+		log.Info("Chain reorg", "forkBlock", number-1, "depth", depth)
+	}
+	if b := t.getBlock(hash, number); b.reorgedOut > b.reorgedBack {
+		b.reorgedBack++
+	}
+	t.canonical[number] = hash
+	t.head = number
+	t.prune(now)
+	return reorgedOut
+}
+
+func (t *Tracker) getBlock(hash common.Hash, number uint64) *blockStats {
+	b, ok := t.blocks[hash]
+	if !ok {
+		b = &blockStats{number: number}
+		t.blocks[hash] = b
+	}
+	return b
+}
+
+// prune forgets the blocks which are not recent anymore, and the reorgs older than the longest window
+func (t *Tracker) prune(now time.Time) {
+	// The head can jump by more than one block, e.g. after a sync cycle without the notifications, so all of
+	// the blocks below the recent ones are removed, which is needed only if there are more of them than recent
+	if uint64(len(t.canonical)) > t.recent {
+		for n := range t.canonical {
+			if n+t.recent <= t.head {
+				delete(t.canonical, n)
+			}
+		}
+	}
+	// The blocks reorged out are not removed with the canonical ones, so they are pruned once in a while
+	if uint64(len(t.blocks)) > 2*t.recent {
+		for h, b := range t.blocks {
+			if b.number+t.recent <= t.head {
+				delete(t.blocks, h)
+			}
+		}
+	}
+	longest := Windows[len(Windows)-1].Duration
+	i := sort.Search(len(t.reorgs), func(i int) bool { return now.Sub(t.reorgs[i].Time) <= longest })
+	t.reorgs = t.reorgs[i:]
+	for _, w := range Windows {
+		w.gauge.Update(int64(t.maxDepth(now, w.Duration)))
+	}
+}
+
+func (t *Tracker) maxDepth(now time.Time, window time.Duration) uint64 {
+	var depth uint64
+	for i := len(t.reorgs) - 1; i >= 0 && now.Sub(t.reorgs[i].Time) <= window; i-- {
+		if t.reorgs[i].Depth > depth {
+			depth = t.reorgs[i].Depth
+		}
+	}
+	return depth
+}
+
+// MaxDepth returns the maximum depth of the reorgs in the time window up to now
+func (t *Tracker) MaxDepth(window time.Duration) uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.maxDepth(t.now(), window)
+}
+
+// Reorgs returns the reorgs in the time window up to now
+func (t *Tracker) Reorgs(window time.Duration) []Reorg {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	now := t.now()
+	i := sort.Search(len(t.reorgs), func(i int) bool { return now.Sub(t.reorgs[i].Time) <= window })
+	return append([]Reorg(nil), t.reorgs[i:]...)
+}
+
+// BlockReorgs returns how many times the block has been reorged out of the canonical chain and back into it,
+// and whether it is canonical now. Unknown blocks, or the ones which are not recent anymore, have no reorgs
+func (t *Tracker) BlockReorgs(hash common.Hash) (reorgedOut, reorgedBack int, canonical bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	b, ok := t.blocks[hash]
+	if !ok {
+		return 0, 0, false
+	}
+	return b.reorgedOut, b.reorgedBack, t.canonical[b.number] == hash
+}
+
+// Hashes returns the hashes of the recent blocks at the height, the canonical one and the ones reorged out
+func (t *Tracker) Hashes(number uint64) []common.Hash {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	var hashes []common.Hash
+	for h, b := range t.blocks {
+		if b.number == number {
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+	return hashes
+}
+
+// Head returns the highest canonical block and the time the tracking started at
+func (t *Tracker) Head() (uint64, time.Time) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.head, t.started
+}
@@ -0,0 +1,157 @@
+package reorgs
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// chain makes the headers from..to, the fork byte makes the hashes differ between the forks
+func chain(from, to uint64, fork byte) []*types.Header {
+	var headers []*types.Header
+	for n := from; n <= to; n++ {
+		headers = append(headers, &types.Header{Number: new(big.Int).SetUint64(n), Extra: []byte{fork}})
+	}
+	return headers
+}
+
+func TestTrackReorgs(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tracker := NewTracker(100)
+	tracker.now = func() time.Time { return now }
+	notify := func(headers []*types.Header) {
+		for _, h := range headers {
+			tracker.OnNewHeader(h)
+		}
+	}
+	a, b := chain(1, 10, 'a'), chain(8, 12, 'b')
+	notify(a)
+	if depth := tracker.MaxDepth(time.Hour); depth != 0 {
+		t.Fatalf("expected no reorgs, got depth %d", depth)
+	}
+
+	// Blocks 8..10 are replaced
+	now = now.Add(2 * time.Hour)
+	notify(b)
+	if depth := tracker.MaxDepth(time.Hour); depth != 3 {
+		t.Errorf("expected depth 3, got %d", depth)
+	}
+	if out, back, canonical := tracker.BlockReorgs(a[8].Hash()); out != 1 || back != 0 || canonical {
+		t.Errorf("block 9a: reorged out %d, back %d, canonical %t", out, back, canonical)
+	}
+	if out, back, canonical := tracker.BlockReorgs(b[0].Hash()); out != 0 || back != 0 || !canonical {
+		t.Errorf("block 8b: reorged out %d, back %d, canonical %t", out, back, canonical)
+	}
+
+	// Back to the first fork, blocks 9..12 are replaced
+	now = now.Add(2 * time.Hour)
+	notify(chain(9, 13, 'a'))
+	if depth := tracker.MaxDepth(time.Hour); depth != 4 {
+		t.Errorf("expected depth 4 in the last hour, got %d", depth)
+	}
+	if depth := tracker.MaxDepth(24 * time.Hour); depth != 4 {
+		t.Errorf("expected depth 4 in the last day, got %d", depth)
+	}
+	if out, back, canonical := tracker.BlockReorgs(a[8].Hash()); out != 1 || back != 1 || !canonical {
+		t.Errorf("block 9a: reorged out %d, back %d, canonical %t", out, back, canonical)
+	}
+	if out, back, canonical := tracker.BlockReorgs(b[0].Hash()); out != 0 || back != 0 || !canonical {
+		t.Errorf("block 8b: reorged out %d, back %d, canonical %t", out, back, canonical)
+	}
+	if hashes := tracker.Hashes(10); len(hashes) != 2 {
+		t.Errorf("expected 2 blocks at height 10, got %d", len(hashes))
+	}
+
+	// Notified again after an unwind to the same chain
+	notify(chain(13, 13, 'a'))
+	if reorgs := tracker.Reorgs(30 * 24 * time.Hour); len(reorgs) != 2 || reorgs[0].ForkBlock != 7 || reorgs[1].ForkBlock != 8 {
+		t.Errorf("unexpected reorgs %v", reorgs)
+	}
+
+	// The reorgs leave the windows
+	now = now.Add(2 * time.Hour)
+	if depth := tracker.MaxDepth(time.Hour); depth != 0 {
+		t.Errorf("expected no reorgs in the last hour, got depth %d", depth)
+	}
+	if depth := tracker.MaxDepth(24 * time.Hour); depth != 4 {
+		t.Errorf("expected depth 4 in the last day, got %d", depth)
+	}
+}
+
+func TestPruneOldBlocks(t *testing.T) {
+	tracker := NewTracker(10)
+	for _, h := range chain(1, 5, 'a') {
+		tracker.OnNewHeader(h)
+	}
+	fork := chain(5, 100, 'b')
+	for _, h := range fork {
+		tracker.OnNewHeader(h)
+	}
+	if hashes := tracker.Hashes(5); len(hashes) != 0 {
+		t.Errorf("expected old blocks to be pruned, got %d", len(hashes))
+	}
+	if len(tracker.canonical) > 11 || len(tracker.blocks) > 20 {
+		t.Errorf("too many blocks kept: %d canonical, %d total", len(tracker.canonical), len(tracker.blocks))
+	}
+	if out, _, canonical := tracker.BlockReorgs(fork[len(fork)-1].Hash()); out != 0 || !canonical {
+		t.Errorf("expected the head to be canonical")
+	}
+}
+
+func TestPruneAfterHeadJump(t *testing.T) {
+	tracker := NewTracker(10)
+	for _, h := range chain(1, 5, 'a') {
+		tracker.OnNewHeader(h)
+	}
+	for _, h := range chain(100, 105, 'a') {
+		tracker.OnNewHeader(h)
+	}
+	for n := range tracker.canonical {
+		if n+10 <= 105 {
+			t.Errorf("block %d kept below the recent blocks", n)
+		}
+	}
+	if len(tracker.canonical) != 6 {
+		t.Errorf("expected 6 canonical blocks, got %d", len(tracker.canonical))
+	}
+}
+
+func TestStaleBlocks(t *testing.T) {
+	tracker := NewTracker(100)
+	stale := NewStaleBlocks(10)
+	a := chain(1, 10, 'a')
+	notify := func(headers []*types.Header) {
+		for _, h := range headers {
+			for _, hash := range tracker.OnNewHeader(h) {
+				for _, old := range a {
+					if old.Hash() == hash {
+						stale.Add(types.NewBlockWithHeader(old), big.NewInt(1))
+					}
+				}
+			}
+			stale.SetHead(h.Number.Uint64())
+		}
+	}
+	notify(a)
+	notify(chain(8, 12, 'b'))
+	if stale.Len() != 3 {
+		t.Fatalf("expected 3 stale blocks, got %d", stale.Len())
+	}
+	if b := stale.Get(a[7].Hash()); b == nil || b.Block.NumberU64() != 8 {
+		t.Errorf("block 8a not kept")
+	}
+	if b := stale.Get(a[6].Hash()); b != nil {
+		t.Errorf("canonical block 7a kept as stale")
+	}
+
+	// The stale blocks leave the window
+	notify(chain(13, 18, 'b'))
+	if b := stale.Get(a[7].Hash()); b != nil {
+		t.Errorf("block 8a kept below the window")
+	}
+	if stale.Len() != 2 {
+		t.Errorf("expected 2 stale blocks, got %d", stale.Len())
+	}
+}
@@ -0,0 +1,118 @@
+package eth
+
+import (
+	"errors"
+	"path"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotedbserver"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/node"
+	"google.golang.org/grpc"
+)
+
+// Replica serves the database of a node in the safe read-only mode (see node.Node.SafeMode)
+// to the RPC daemons over the private API. Neither the sync stages nor the transaction pool
+// are started, so nothing is ever written into the database.
+type Replica struct {
+	chainDb    ethdb.Database
+	networkID  uint64
+	privateAPI *grpc.Server
+}
+
+// NewReplica opens the database of the node and registers the replica on the node
+func NewReplica(stack *node.Node, config *ethconfig.Config) (*Replica, error) {
+	chainDb, err := stack.OpenDatabaseWithFreezer("chaindata", path.Join(stack.Config().DataDir, etl.TmpDirName))
+	if err != nil {
+		return nil, err
+	}
+	genesisHash, err := rawdb.ReadCanonicalHash(chainDb, 0)
+	if err != nil {
+		return nil, err
+	}
+	if genesisHash == (common.Hash{}) {
+		return nil, errors.New("database is empty, the safe read-only mode needs a synced datadir")
+	}
+	chainConfig, err := rawdb.ReadChainConfig(chainDb, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	head, err := stages.GetStageProgress(chainDb, stages.Finish)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Serving read-only database", "network", config.NetworkID, "head", head, "config", chainConfig)
+
+	r := &Replica{
+		chainDb:   chainDb,
+		networkID: config.NetworkID,
+	}
+	if stack.Config().PrivateApiAddr != "" {
+		creds, err := privateAPICredentials(stack.Config())
+		if err != nil {
+			return nil, err
+		}
+		r.privateAPI, err = remotedbserver.StartGrpc(chainDb.KV(), r, nil, stack.Config().PrivateApiAddr, stack.Config().PrivateApiRateLimit, creds, remotedbserver.NewEvents())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warn("Private API is disabled, the read-only database is not served to the RPC daemons")
+	}
+	stack.RegisterLifecycle(r)
+	return r, nil
+}
+
+func (r *Replica) ChainKV() ethdb.KV { return r.chainDb.(ethdb.HasKV).KV() }
+
+// Start implements node.Lifecycle, the private API is already serving
+func (r *Replica) Start() error { return nil }
+
+// Stop implements node.Lifecycle, terminating the private API
+func (r *Replica) Stop() error {
+	if r.privateAPI != nil {
+		shutdownDone := make(chan bool)
+		go func() {
+			defer close(shutdownDone)
+			r.privateAPI.GracefulStop()
+		}()
+		select {
+		case <-time.After(1 * time.Second): // shutdown deadline
+			r.privateAPI.Stop()
+		case <-shutdownDone:
+		}
+	}
+	return nil
+}
+
+// TxPool implements core.EthBackend, there is no transaction pool in the read-only mode
+func (r *Replica) TxPool() *core.TxPool { return nil }
+
+// Etherbase implements core.EthBackend, the replica doesn't mine
+func (r *Replica) Etherbase() (common.Address, error) {
+	return common.Address{}, errors.New("etherbase is not available in the safe read-only mode")
+}
+
+// NetVersion implements core.EthBackend
+func (r *Replica) NetVersion() (uint64, error) { return r.networkID, nil }
+
+// IsMining implements core.EthBackend
+func (r *Replica) IsMining() bool { return false }
+
+// BuildBlock implements core.EthBackend, the replica doesn't mine
+func (r *Replica) BuildBlock(common.Hash, []common.Hash) (*types.Block, types.Receipts, error) {
+	return nil, nil, errors.New("building blocks is not available in the safe read-only mode")
+}
+
+// InsertBlocks implements core.EthBackend, the replica doesn't write to the database
+func (r *Replica) InsertBlocks([]*types.Block) (bool, error) {
+	return false, errors.New("inserting blocks is not available in the safe read-only mode")
+}
@@ -48,7 +48,7 @@ func createStageBuilders(blocks []*types.Block, blockNum uint64, checkRoot bool)
 						return s.DoneAndUpdate(world.TX, blockNum)
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
-						return u.Done(world.DB)
+						return UnwindBodyDownloadStage(u, world.DB)
 					},
 				}
 			},
@@ -92,11 +92,14 @@ func createStageBuilders(blocks []*types.Block, blockNum uint64, checkRoot bool)
 							world.QuitCh,
 							ExecuteBlockStageParams{
 								WriteReceipts:         world.storageMode.Receipts,
+								WritePreimages:        world.storageMode.Preimages,
 								Cache:                 world.cache,
 								BatchSize:             world.BatchSize,
 								ReaderBuilder:         world.stateReaderBuilder,
 								WriterBuilder:         world.stateWriterBuilder,
 								SilkwormExecutionFunc: world.silkwormExecutionFunc,
+								DiffChecker:           world.diffChecker,
+								ExecutionProofs:       world.executionProofs,
 							})
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
@@ -112,6 +115,23 @@ func createStageBuilders(blocks []*types.Block, blockNum uint64, checkRoot bool)
 				}
 			},
 		},
+		{
+			ID: stages.BlockWitnesses,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.BlockWitnesses,
+					Description:         "Generate stateless witnesses of the blocks",
+					Disabled:            !world.storageMode.Witnesses,
+					DisabledDescription: "Enable by adding `w` to --storage-mode",
+					ExecFunc: func(s *StageState, u Unwinder) error {
+						return SpawnBlockWitnesses(s, world.TX, world.ChainConfig, world.chainContext, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindBlockWitnesses(u, s, world.TX)
+					},
+				}
+			},
+		},
 		{
 			ID: stages.HashState,
 			Build: func(world StageParameters) *Stage {
@@ -134,10 +154,17 @@ func createStageBuilders(blocks []*types.Block, blockNum uint64, checkRoot bool)
 					ID:          stages.IntermediateHashes,
 					Description: "Generate intermediate hashes and computing state root",
 					ExecFunc: func(s *StageState, u Unwinder) error {
+						if world.ChainConfig.IsVerkle() || world.ChainConfig.IsBinaryTrie() {
+							_, err := SpawnStateRootStage(s, world.TX, world.ChainConfig, checkRoot, world.QuitCh)
+							return err
+						}
 						_, err := SpawnIntermediateHashesStage(s, world.TX, checkRoot, world.cache, world.TmpDir, world.QuitCh)
 						return err
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						if world.ChainConfig.IsVerkle() || world.ChainConfig.IsBinaryTrie() {
+							return UnwindStateRootStage(u, s, world.TX, world.ChainConfig, world.QuitCh)
+						}
 						return UnwindIntermediateHashesStage(u, s, world.TX, world.cache, world.TmpDir, world.QuitCh)
 					},
 				}
@@ -236,6 +263,40 @@ func createStageBuilders(blocks []*types.Block, blockNum uint64, checkRoot bool)
 				}
 			},
 		},
+		{
+			ID: stages.AccountRanks,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.AccountRanks,
+					Description:         "Rank the accounts by the balance and by the code size",
+					Disabled:            !world.storageMode.AccountRanks,
+					DisabledDescription: "Enable by adding `k` to --storage-mode",
+					ExecFunc: func(s *StageState, u Unwinder) error {
+						return SpawnAccountRanksStage(s, world.TX, world.TmpDir, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindAccountRanksStage(u, s, world.TX, world.QuitCh)
+					},
+				}
+			},
+		},
+		{
+			ID: stages.TokenTransfers,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.TokenTransfers,
+					Description:         "Generate token transfers index",
+					Disabled:            !world.storageMode.TokenTransfers || !world.storageMode.Receipts,
+					DisabledDescription: "Enable by adding `e` and `r` to --storage-mode",
+					ExecFunc: func(s *StageState, u Unwinder) error {
+						return SpawnTokenTransfersStage(s, world.TX, world.TmpDir, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindTokenTransfersStage(u, s, world.TX, world.QuitCh)
+					},
+				}
+			},
+		},
 		{
 			ID: stages.Finish,
 			Build: func(world StageParameters) *Stage {
@@ -287,7 +348,7 @@ func SetHead(db ethdb.Database, config *params.ChainConfig, vmConfig *vm.Config,
 	cc := &core.TinyChainContext{}
 	cc.SetDB(nil)
 	cc.SetEngine(engine)
-	stagedSync := New(stageBuilders, []int{0, 1, 2, 3, 5, 4, 6, 7, 8, 9, 10, 11}, OptionalParameters{})
+	stagedSync := New(stageBuilders, []int{0, 1, 2, 3, 4, 6, 5, 7, 8, 9, 10, 11, 12, 13, 14}, OptionalParameters{})
 	var cache *shards.StateCache // Turn off cache for now
 	syncState, err1 := stagedSync.Prepare(
 		nil,
@@ -339,6 +400,18 @@ func InsertHeadersInStages(db ethdb.Database, config *params.ChainConfig, engine
 }
 
 func InsertBlocksInStages(db ethdb.Database, storageMode ethdb.StorageMode, config *params.ChainConfig, vmConfig *vm.Config, engine consensus.Engine, blocks []*types.Block, checkRoot bool) (bool, error) {
+	return insertBlocksInStages(db, storageMode, config, vmConfig, engine, blocks, checkRoot, false)
+}
+
+// InsertBlocksByForkChoice makes the blocks canonical regardless of their total difficulty and runs the stages for them,
+// unwinding the stages to the fork point first. The headers aren't verified by the consensus engine, the blocks are
+// chosen by the consensus client after the merge
+func InsertBlocksByForkChoice(db ethdb.Database, storageMode ethdb.StorageMode, config *params.ChainConfig, vmConfig *vm.Config, engine consensus.Engine, blocks []*types.Block, checkRoot bool) error {
+	_, err := insertBlocksInStages(db, storageMode, config, vmConfig, engine, blocks, checkRoot, true)
+	return err
+}
+
+func insertBlocksInStages(db ethdb.Database, storageMode ethdb.StorageMode, config *params.ChainConfig, vmConfig *vm.Config, engine consensus.Engine, blocks []*types.Block, checkRoot bool, forkChoice bool) (bool, error) {
 	if len(blocks) == 0 {
 		return false, nil
 	}
@@ -347,15 +420,28 @@ func InsertBlocksInStages(db ethdb.Database, storageMode ethdb.StorageMode, conf
 		headers[i] = block.Header()
 	}
 	// Header verification happens outside of the transaction
-	if err := VerifyHeaders(db, headers, config, engine, 1); err != nil {
-		return false, err
+	if !forkChoice {
+		if err := VerifyHeaders(db, headers, config, engine, 1); err != nil {
+			return false, err
+		}
 	}
 	tx, err1 := db.Begin(context.Background(), ethdb.RW)
 	if err1 != nil {
 		return false, fmt.Errorf("starting transaction for importing the blocks: %v", err1)
 	}
 	defer tx.Rollback()
-	newCanonical, reorg, forkblocknumber, err := InsertHeaderChain("Headers", tx, headers)
+	var (
+		newCanonical    bool
+		reorg           bool
+		forkblocknumber uint64
+		err             error
+	)
+	if forkChoice {
+		newCanonical = true
+		reorg, forkblocknumber, err = InsertHeaderChainForkChoice("Headers", tx, headers)
+	} else {
+		newCanonical, reorg, forkblocknumber, err = InsertHeaderChain("Headers", tx, headers)
+	}
 	if err != nil {
 		return false, err
 	}
@@ -376,7 +462,7 @@ func InsertBlocksInStages(db ethdb.Database, storageMode ethdb.StorageMode, conf
 	cc := &core.TinyChainContext{}
 	cc.SetDB(nil)
 	cc.SetEngine(engine)
-	stagedSync := New(stageBuilders, []int{0, 1, 2, 3, 5, 4, 6, 7, 8, 9, 10, 11}, OptionalParameters{})
+	stagedSync := New(stageBuilders, []int{0, 1, 2, 3, 4, 6, 5, 7, 8, 9, 10, 11, 12, 13, 14}, OptionalParameters{})
 	var cache *shards.StateCache // Turn off cache for now
 	syncState, err2 := stagedSync.Prepare(
 		nil,
@@ -0,0 +1,368 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// DerivedTable is a set of the custom buckets derived from the executed blocks by a user-supplied mapper. The table
+// runs as its own stage following the execution: the framework feeds the new blocks to the mapper, batches its writes
+// with ETL, and keeps the undo log of the overwritten values, so the unwinds revert the table without the mapper's help
+//
+// The buckets of the table, including the undo bucket, have to be known to the database, e.g. added with
+// WithBucketsConfig when it's opened
+type DerivedTable struct {
+	// ID is the stage identifier, it is recommended to prefix it with reverse domain `com.example.my-table`
+	ID          stages.SyncStage
+	Description string
+	// Buckets are the buckets the mapper writes to
+	Buckets []string
+	// UndoBucket keeps the undo log of the table: block_num_u64 + seq_u32 -> bucket_index_u8 + key_len_u16 + key + previous value
+	UndoBucket string
+	// UndoDepth is the number of the latest blocks the undo log is kept for, 0 keeps it for all the blocks. A deeper
+	// unwind clears the table, which is rebuilt from the genesis by the next cycle
+	UndoDepth uint64
+	// Receipts and ChangeSets tell which inputs the mapper needs besides the block
+	Receipts   bool
+	ChangeSets bool
+	// Map derives the records of the block. The puts of the whole batch are loaded at once, so Map reads the state of
+	// the buckets before the batch, and has to put the values which don't depend on the other blocks of the batch,
+	// the last put of a key wins. An empty value deletes the key
+	Map func(block *DerivedBlock, put func(bucket string, k, v []byte) error) error
+}
+
+// DerivedBlock is the input of the mapper of a DerivedTable
+type DerivedBlock struct {
+	Block          *types.Block
+	Receipts       types.Receipts       // nil unless DerivedTable.Receipts, the logs are filled in
+	AccountChanges *changeset.ChangeSet // nil unless DerivedTable.ChangeSets, address -> previous account
+	StorageChanges *changeset.ChangeSet // nil unless DerivedTable.ChangeSets, address + incarnation + slot -> previous value
+}
+
+// StageBuilder builds the stage of the table, see WithDerivedTables
+func (t *DerivedTable) StageBuilder() StageBuilder {
+	return StageBuilder{
+		ID: t.ID,
+		Build: func(world StageParameters) *Stage {
+			return &Stage{
+				ID:          t.ID,
+				Description: t.Description,
+				ExecFunc: func(s *StageState, _ Unwinder) error {
+					return SpawnDerivedTableStage(t, s, world.TX, world.TmpDir, world.QuitCh)
+				},
+				UnwindFunc: func(u *UnwindState, s *StageState) error {
+					return UnwindDerivedTableStage(t, u, s, world.TX, world.QuitCh)
+				},
+			}
+		},
+	}
+}
+
+// WithDerivedTables inserts the stages of the tables before the Prune stage, their unwinds go first
+func WithDerivedTables(builders StageBuilders, unwindOrder UnwindOrder, tables ...*DerivedTable) (StageBuilders, UnwindOrder) {
+	at := len(builders)
+	for i, builder := range builders {
+		if string(builder.ID) == string(stages.Prune) {
+			at = i
+			break
+		}
+	}
+	result := make(StageBuilders, 0, len(builders)+len(tables))
+	result = append(result, builders[:at]...)
+	for _, t := range tables {
+		result = append(result, t.StageBuilder())
+	}
+	result = append(result, builders[at:]...)
+
+	order := make(UnwindOrder, 0, len(unwindOrder)+len(tables))
+	for _, i := range unwindOrder {
+		if i >= at {
+			i += len(tables)
+		}
+		order = append(order, i)
+	}
+	for i := range tables {
+		order = append(order, at+i)
+	}
+	return result, order
+}
+
+// SpawnDerivedTableStage maps the blocks executed since the previous cycle into the buckets of the table
+func SpawnDerivedTableStage(t *DerivedTable, s *StageState, db ethdb.Database, tmpdir string, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	endBlock, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	if endBlock <= s.BlockNumber {
+		s.Done()
+		return nil
+	}
+
+	start := s.BlockNumber
+	if start > 0 {
+		start++
+	}
+	if err = promoteDerivedTable(logPrefix, t, tx, start, endBlock, tmpdir, quit); err != nil {
+		return err
+	}
+	if t.UndoDepth > 0 && endBlock >= t.UndoDepth {
+		if err = pruneDerivedTableUndo(t, tx, endBlock-t.UndoDepth); err != nil {
+			return fmt.Errorf("%s: pruning the undo log: %w", logPrefix, err)
+		}
+	}
+
+	if err = s.DoneAndUpdate(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteDerivedTable(logPrefix string, t *DerivedTable, db ethdb.Database, start, end uint64, tmpdir string, quit <-chan struct{}) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	bucketIndices := make(map[string]int, len(t.Buckets))
+	collectors := make([]*etl.Collector, len(t.Buckets))
+	for i, bucket := range t.Buckets {
+		bucketIndices[bucket] = i
+		collectors[i] = etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+		defer collectors[i].Close(logPrefix)
+	}
+
+	for blockNum := start; blockNum <= end; blockNum++ {
+		if err := common.Stopped(quit); err != nil {
+			return err
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		}
+
+		block, err := readDerivedBlock(t, db, blockNum)
+		if err != nil {
+			return fmt.Errorf("%s: %w", logPrefix, err)
+		}
+		// The puts of the block are deduplicated, so the undo log has at most one record of a key per block
+		puts := make([]map[string][]byte, len(t.Buckets))
+		if err = t.Map(block, func(bucket string, k, v []byte) error {
+			i, ok := bucketIndices[bucket]
+			if !ok {
+				return fmt.Errorf("bucket %s is not in the buckets of the table", bucket)
+			}
+			if puts[i] == nil {
+				puts[i] = make(map[string][]byte)
+			}
+			puts[i][string(k)] = common.CopyBytes(v)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("%s: mapping block %d: %w", logPrefix, blockNum, err)
+		}
+		for i, bucketPuts := range puts {
+			for k, v := range bucketPuts {
+				// The block goes after the key, so the puts of a key are loaded in the order of the blocks
+				if err = collectors[i].Collect(append([]byte(k), dbutils.EncodeBlockNumber(blockNum)...), v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	undo := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer undo.Close(logPrefix)
+	var seq uint32
+	for i, bucket := range t.Buckets {
+		index := i
+		if err := collectors[i].Load(logPrefix, db, bucket, func(k, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+			key := k[:len(k)-8]
+			prev, err := table.Get(key)
+			if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+				return err
+			}
+			undoKey := make([]byte, 12)
+			copy(undoKey, k[len(k)-8:])
+			binary.BigEndian.PutUint32(undoKey[8:], seq)
+			seq++
+			if err = undo.Collect(undoKey, encodeDerivedUndo(index, key, prev)); err != nil {
+				return err
+			}
+			return next(k, key, v)
+		}, etl.TransformArgs{Quit: quit}); err != nil {
+			return err
+		}
+	}
+	return undo.Load(logPrefix, db, t.UndoBucket, etl.IdentityLoadFunc, etl.TransformArgs{Quit: quit})
+}
+
+func readDerivedBlock(t *DerivedTable, db ethdb.Database, blockNum uint64) (*DerivedBlock, error) {
+	hash, err := rawdb.ReadCanonicalHash(db, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlock(db, hash, blockNum)
+	if block == nil {
+		return nil, fmt.Errorf("block not found: %d", blockNum)
+	}
+	result := &DerivedBlock{Block: block}
+	if t.Receipts {
+		result.Receipts = rawdb.ReadRawReceipts(db, hash, blockNum)
+	}
+	if t.ChangeSets {
+		result.AccountChanges = changeset.NewAccountChangeSetPlain()
+		if err = changeset.Walk(db, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, v []byte) (bool, error) {
+			return true, result.AccountChanges.Add(common.CopyBytes(k), common.CopyBytes(v))
+		}); err != nil {
+			return nil, err
+		}
+		result.StorageChanges = changeset.NewStorageChangeSetPlain()
+		if err = changeset.Walk(db, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, v []byte) (bool, error) {
+			return true, result.StorageChanges.Add(common.CopyBytes(k), common.CopyBytes(v))
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func encodeDerivedUndo(bucketIndex int, k, prev []byte) []byte {
+	v := make([]byte, 3+len(k)+len(prev))
+	v[0] = byte(bucketIndex)
+	binary.BigEndian.PutUint16(v[1:], uint16(len(k)))
+	copy(v[3:], k)
+	copy(v[3+len(k):], prev)
+	return v
+}
+
+func decodeDerivedUndo(v []byte) (bucketIndex int, k, prev []byte) {
+	keyLen := int(binary.BigEndian.Uint16(v[1:]))
+	return int(v[0]), v[3 : 3+keyLen], v[3+keyLen:]
+}
+
+// pruneDerivedTableUndo deletes the undo log of the blocks up to the given one
+func pruneDerivedTableUndo(t *DerivedTable, db ethdb.Database, to uint64) error {
+	var keys [][]byte
+	if err := db.Walk(t.UndoBucket, nil, 0, func(k, _ []byte) (bool, error) {
+		if binary.BigEndian.Uint64(k) > to {
+			return false, nil
+		}
+		keys = append(keys, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := db.Delete(t.UndoBucket, k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnwindDerivedTableStage replays the undo log of the unwound blocks backwards, restoring the values the mapper
+// overwrote. When the undo log of the unwound blocks is pruned, the table is cleared to be rebuilt
+func UnwindDerivedTableStage(t *DerivedTable, u *UnwindState, s *StageState, db ethdb.Database, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	rebuild := t.UndoDepth > 0 && u.UnwindPoint+t.UndoDepth < s.BlockNumber
+	if rebuild {
+		log.Warn(fmt.Sprintf("[%s] Unwind is deeper than the undo log, clearing the table", logPrefix), "unwindPoint", u.UnwindPoint, "undoDepth", t.UndoDepth)
+		if err := tx.(ethdb.BucketsMigrator).ClearBuckets(append([]string{t.UndoBucket}, t.Buckets...)...); err != nil {
+			return fmt.Errorf("%s: %w", logPrefix, err)
+		}
+	} else if err := unwindDerivedTable(t, tx, u.UnwindPoint, quit); err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+
+	if err := u.Done(tx); err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+	if rebuild {
+		if err := stages.SaveStageProgress(tx, t.ID, 0); err != nil {
+			return fmt.Errorf("%s: %w", logPrefix, err)
+		}
+	}
+	if !useExternalTx {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unwindDerivedTable(t *DerivedTable, db ethdb.Database, to uint64, quit <-chan struct{}) error {
+	var keys, values [][]byte
+	if err := db.Walk(t.UndoBucket, dbutils.EncodeBlockNumber(to+1), 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		keys = append(keys, common.CopyBytes(k))
+		values = append(values, common.CopyBytes(v))
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	// The latest blocks go first, so every key ends up with its value before the earliest unwound block
+	for i := len(keys) - 1; i >= 0; i-- {
+		bucketIndex, k, prev := decodeDerivedUndo(values[i])
+		if bucketIndex >= len(t.Buckets) {
+			return fmt.Errorf("undo record of the unknown bucket %d", bucketIndex)
+		}
+		if len(prev) == 0 {
+			if err := db.Delete(t.Buckets[bucketIndex], k, nil); err != nil {
+				return err
+			}
+		} else if err := db.Put(t.Buckets[bucketIndex], k, prev); err != nil {
+			return err
+		}
+		if err := db.Delete(t.UndoBucket, keys[i], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
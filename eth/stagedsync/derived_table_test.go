@@ -0,0 +1,122 @@
+package stagedsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedTable(t *testing.T) {
+	const touched, undo = "com.example.touched", "com.example.touched_undo"
+	kv := ethdb.NewLMDB().InMem().WithBucketsConfig(func(defaultBuckets dbutils.BucketsCfg) dbutils.BucketsCfg {
+		buckets := dbutils.BucketsCfg{touched: {}, undo: {}}
+		for name, cfg := range defaultBuckets {
+			buckets[name] = cfg
+		}
+		return buckets
+	}).MustOpen()
+	db := ethdb.NewObjectDatabase(kv)
+	defer db.Close()
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// The table keeps the last block which changed the account, the deletions remove the accounts from it
+	a, b := common.Address{0xa}, common.Address{0xb}
+	deletions := map[uint64]common.Address{3: a}
+	table := &DerivedTable{
+		ID:         stages.SyncStage("com.example.touched"),
+		Buckets:    []string{touched},
+		UndoBucket: undo,
+		ChangeSets: true,
+		Map: func(block *DerivedBlock, put func(bucket string, k, v []byte) error) error {
+			for _, change := range block.AccountChanges.Changes {
+				if err := put(touched, change.Key, dbutils.EncodeBlockNumber(block.Block.NumberU64())); err != nil {
+					return err
+				}
+			}
+			if deleted, ok := deletions[block.Block.NumberU64()]; ok {
+				return put(touched, deleted[:], nil)
+			}
+			return nil
+		},
+	}
+
+	addBlock := func(blockNum uint64, changed ...common.Address) {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(blockNum)})
+		require.NoError(t, rawdb.WriteBlock(context.Background(), tx, block))
+		require.NoError(t, rawdb.WriteCanonicalHash(tx, block.Hash(), blockNum))
+		w := state.NewPlainStateWriter(tx, tx, blockNum)
+		for _, address := range changed {
+			acc := accounts.NewAccount()
+			acc.Initialised = true
+			acc.Balance.SetUint64(blockNum)
+			require.NoError(t, w.UpdateAccountData(context.Background(), address, &accounts.Account{}, &acc))
+		}
+		require.NoError(t, w.WriteChangeSets())
+		require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, blockNum))
+	}
+	check := func(expected map[common.Address]uint64) {
+		actual := map[common.Address]uint64{}
+		require.NoError(t, tx.Walk(touched, nil, 0, func(k, v []byte) (bool, error) {
+			actual[common.BytesToAddress(k)] = new(big.Int).SetBytes(v).Uint64()
+			return true, nil
+		}))
+		assert.Equal(t, expected, actual)
+	}
+
+	addBlock(0)
+	addBlock(1, a, b)
+	addBlock(2, a)
+	require.NoError(t, SpawnDerivedTableStage(table, &StageState{Stage: table.ID}, tx, "", nil))
+	check(map[common.Address]uint64{a: 2, b: 1})
+
+	addBlock(3, b)
+	require.NoError(t, SpawnDerivedTableStage(table, &StageState{Stage: table.ID, BlockNumber: 2}, tx, "", nil))
+	check(map[common.Address]uint64{b: 3})
+	progress, err := stages.GetStageProgress(tx, table.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), progress)
+
+	// The unwind replays the undo log, the mapper isn't involved
+	require.NoError(t, UnwindDerivedTableStage(table, &UnwindState{Stage: table.ID, UnwindPoint: 1}, &StageState{Stage: table.ID, BlockNumber: 3}, tx, nil))
+	check(map[common.Address]uint64{a: 1, b: 1})
+	progress, err = stages.GetStageProgress(tx, table.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), progress)
+
+	// The unwind deeper than the undo log clears the table to be rebuilt
+	table.UndoDepth = 1
+	require.NoError(t, SpawnDerivedTableStage(table, &StageState{Stage: table.ID, BlockNumber: 1}, tx, "", nil))
+	check(map[common.Address]uint64{b: 3})
+	require.NoError(t, UnwindDerivedTableStage(table, &UnwindState{Stage: table.ID, UnwindPoint: 2}, &StageState{Stage: table.ID, BlockNumber: 3}, tx, nil))
+	check(map[common.Address]uint64{a: 2, b: 1})
+	require.NoError(t, UnwindDerivedTableStage(table, &UnwindState{Stage: table.ID, UnwindPoint: 0}, &StageState{Stage: table.ID, BlockNumber: 2}, tx, nil))
+	check(map[common.Address]uint64{})
+	progress, err = stages.GetStageProgress(tx, table.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), progress)
+	require.NoError(t, SpawnDerivedTableStage(table, &StageState{Stage: table.ID}, tx, "", nil))
+	check(map[common.Address]uint64{b: 3})
+}
+
+func TestWithDerivedTables(t *testing.T) {
+	table := &DerivedTable{ID: stages.SyncStage("com.example.table")}
+	builders, order := WithDerivedTables(DefaultStages(), DefaultUnwindOrder(), table)
+	require.Len(t, builders, len(DefaultStages())+1)
+	at := len(builders) - 3
+	assert.Equal(t, table.ID, builders[at].ID)
+	assert.Equal(t, stages.Prune, builders[at+1].ID)
+	assert.Equal(t, append(DefaultUnwindOrder(), at), order)
+}
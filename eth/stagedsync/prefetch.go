@@ -0,0 +1,135 @@
+package stagedsync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// prefetcher reads the state the transactions of the next block touch, i.e. the senders, the recipients with their
+// code and the access lists, while the execution stage executes the current block. The prefetcher reads the state
+// committed to the database in a transaction of its own. The state read is kept in the ReadCache if it is the state the
+// current block executes on, which is the case when following the tip, otherwise the prefetch only warms up the pages
+// of the database
+type prefetcher struct {
+	db        ethdb.Database
+	readCache *state.ReadCache
+	blocks    chan *types.Block
+	executing uint64 // the number of the block being executed, the prefetch of it and of the older blocks is abandoned
+	wg        sync.WaitGroup
+}
+
+func newPrefetcher(db ethdb.Database, readCache *state.ReadCache) *prefetcher {
+	p := &prefetcher{db: db, readCache: readCache, blocks: make(chan *types.Block, 1)}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for block := range p.blocks {
+			if err := p.prefetch(block); err != nil {
+				log.Warn("Prefetch of the state failed", "block", block.NumberU64(), "err", err)
+			}
+		}
+	}()
+	return p
+}
+
+// execute marks the start of the execution of the block and queues the prefetch of the next one, skipped if the
+// prefetcher is still busy
+func (p *prefetcher) execute(blockNum uint64, next *types.Block) {
+	atomic.StoreUint64(&p.executing, blockNum)
+	if next == nil {
+		return
+	}
+	select {
+	case p.blocks <- next:
+	default:
+	}
+}
+
+func (p *prefetcher) close() {
+	close(p.blocks)
+	p.wg.Wait()
+}
+
+func (p *prefetcher) prefetch(block *types.Block) error {
+	blockNum := block.NumberU64()
+	if atomic.LoadUint64(&p.executing) >= blockNum {
+		return nil
+	}
+	tx, err := p.db.Begin(context.Background(), ethdb.RO)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var r state.StateReader = state.NewPlainStateReader(tx)
+	if p.readCache != nil {
+		progress, err := stages.GetStageProgress(tx, stages.Execution)
+		if err != nil {
+			return err
+		}
+		if r, err = p.readCache.ReaderAt(tx, r, progress); err != nil {
+			return err
+		}
+	}
+
+	read := make(map[common.Address]*accounts.Account)
+	readAccount := func(address common.Address) (*accounts.Account, error) {
+		if acc, ok := read[address]; ok {
+			return acc, nil
+		}
+		acc, err := r.ReadAccountData(address)
+		if err != nil {
+			return nil, err
+		}
+		read[address] = acc
+		return acc, nil
+	}
+
+	if _, err = readAccount(block.Coinbase()); err != nil {
+		return err
+	}
+	senders := block.Body().SendersFromTxs()
+	for i, txn := range block.Transactions() {
+		if atomic.LoadUint64(&p.executing) >= blockNum {
+			return nil
+		}
+		if _, err = readAccount(senders[i]); err != nil {
+			return err
+		}
+		if to := txn.To(); to != nil {
+			acc, err := readAccount(*to)
+			if err != nil {
+				return err
+			}
+			if acc != nil && !acc.IsEmptyCodeHash() {
+				if _, err = r.ReadAccountCode(*to, acc.Incarnation, acc.CodeHash); err != nil {
+					return err
+				}
+			}
+		}
+		for _, tuple := range txn.AccessList() {
+			acc, err := readAccount(tuple.Address)
+			if err != nil {
+				return err
+			}
+			if acc == nil {
+				continue
+			}
+			for j := range tuple.StorageKeys {
+				if _, err = r.ReadAccountStorage(tuple.Address, acc.Incarnation, &tuple.StorageKeys[j]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
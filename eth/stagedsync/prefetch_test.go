@@ -0,0 +1,96 @@
+package stagedsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestPrefetcher(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	sender, recipient := common.Address{1}, common.Address{2}
+	location := common.Hash{3}
+
+	// The state after block 1, the block the execution of block 2 starts on
+	acc := accounts.NewAccount()
+	acc.Initialised = true
+	acc.Balance = *uint256.NewInt().SetUint64(1000)
+	acc.Incarnation = 1
+	empty := accounts.NewAccount()
+	w := state.NewPlainStateWriter(db, db, 1)
+	for _, address := range []common.Address{sender, recipient} {
+		if err := w.UpdateAccountData(context.Background(), address, &empty, &acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteAccountStorage(context.Background(), recipient, 1, &location, uint256.NewInt(), uint256.NewInt().SetUint64(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteChangeSets(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rawdb.WriteCanonicalHash(db, common.Hash{1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := stages.SaveStageProgress(db, stages.Execution, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	block := types.NewBlock(&types.Header{Number: big.NewInt(3)}, []*types.Transaction{types.NewTx(&types.AccessListTx{
+		To:         &recipient,
+		AccessList: types.AccessList{{Address: recipient, StorageKeys: []common.Hash{location}}},
+	})}, nil, nil)
+	block.Body().SendersToTxs([]common.Address{sender})
+
+	prefetch := func(executing uint64) *state.ReadCache {
+		cache, err := state.NewReadCacheOfAccounts(16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = cache.Reader(db, state.NewPlainStateReader(db), 1); err != nil {
+			t.Fatal(err)
+		}
+		p := newPrefetcher(db, cache)
+		p.execute(executing, block)
+		p.close()
+		return cache
+	}
+	cached := prefetch(2)
+	abandoned := prefetch(3)
+
+	// Read from the caches, the prefetched state is gone from the database
+	if err := db.Delete(dbutils.PlainStateBucket, sender[:], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(dbutils.PlainStateBucket, dbutils.PlainGenerateCompositeStorageKey(recipient.Bytes(), 1, location.Bytes()), nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := cached.Reader(db, state.NewPlainStateReader(db), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err := r.ReadAccountData(sender); err != nil || a == nil {
+		t.Errorf("the sender is not prefetched: %v", err)
+	}
+	if v, err := r.ReadAccountStorage(recipient, 1, &location); err != nil || new(uint256.Int).SetBytes(v).Uint64() != 7 {
+		t.Errorf("the slot of the access list is not prefetched: %x, %v", v, err)
+	}
+
+	if r, err = abandoned.Reader(db, state.NewPlainStateReader(db), 1); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := r.ReadAccountData(sender); err != nil || a != nil {
+		t.Errorf("the block already executing is prefetched: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package stagedsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// SpawnAccountRanksStage maintains the rankings of the accounts of the latest state by the balance and by the code
+// size in the BalanceRank and the CodeSizeRank buckets. The first cycle ranks all the accounts of the plain state,
+// the next ones only re-rank the accounts of the account changesets of the executed blocks.
+func SpawnAccountRanksStage(s *StageState, db ethdb.Database, tmpdir string, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	executionAt, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	if executionAt <= s.BlockNumber {
+		s.Done()
+		return nil
+	}
+
+	if s.BlockNumber == 0 {
+		err = rankAllAccounts(logPrefix, tx, tmpdir, quit)
+	} else {
+		err = rerankAccounts(tx, s.BlockNumber, executionAt, quit)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+
+	if err = s.DoneAndUpdate(tx, executionAt); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnwindAccountRanksStage re-ranks the accounts changed in the unwound blocks by their values at the unwind point
+func UnwindAccountRanksStage(u *UnwindState, s *StageState, db ethdb.Database, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	if u.UnwindPoint < s.BlockNumber {
+		// The execution is unwound after this stage, so the changesets of the unwound blocks are still there
+		executionAt, err := s.ExecutionAt(tx)
+		if err != nil {
+			return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+		}
+		target, err := accountsAt(tx, u.UnwindPoint, executionAt, quit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", logPrefix, err)
+		}
+		current, err := accountsAt(tx, s.BlockNumber, executionAt, quit)
+		if err != nil {
+			return fmt.Errorf("%s: %w", logPrefix, err)
+		}
+		for address, enc := range target {
+			ranked, ok := current[address]
+			if !ok {
+				if ranked, err = latestAccount(tx, address); err != nil {
+					return err
+				}
+			}
+			if err = updateAccountRanks(tx, common.BytesToAddress([]byte(address)), ranked, enc); err != nil {
+				return fmt.Errorf("%s: %w", logPrefix, err)
+			}
+		}
+	}
+
+	if err := u.Done(tx); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rankAllAccounts rebuilds the rankings from all the accounts of the plain state
+func rankAllAccounts(logPrefix string, tx ethdb.DbWithPendingMutations, tmpdir string, quit <-chan struct{}) error {
+	if err := tx.(ethdb.BucketsMigrator).ClearBuckets(dbutils.BalanceRank, dbutils.CodeSizeRank); err != nil {
+		return err
+	}
+	logEvery := time.NewTicker(logInterval)
+	defer logEvery.Stop()
+
+	balances := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	codeSizes := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	if err := tx.Walk(dbutils.PlainStateBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		if len(k) != common.AddressLength {
+			return true, nil
+		}
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Ranking accounts", logPrefix), "address", fmt.Sprintf("%x", k))
+		}
+		address := common.BytesToAddress(k)
+		return true, walkAccountRanks(tx, address, v, func(bucket string, key, value []byte) error {
+			if bucket == dbutils.BalanceRank {
+				return balances.Collect(key, value)
+			}
+			return codeSizes.Collect(key, value)
+		})
+	}); err != nil {
+		return err
+	}
+	if err := balances.Load(logPrefix, tx, dbutils.BalanceRank, etl.IdentityLoadFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
+	return codeSizes.Load(logPrefix, tx, dbutils.CodeSizeRank, etl.IdentityLoadFunc, etl.TransformArgs{Quit: quit})
+}
+
+// rerankAccounts moves the accounts changed in the blocks from+1..to from their ranks at the block from to the
+// ranks of the latest state
+func rerankAccounts(tx ethdb.DbWithPendingMutations, from, to uint64, quit <-chan struct{}) error {
+	changed, err := accountsAt(tx, from, to, quit)
+	if err != nil {
+		return err
+	}
+	for address, ranked := range changed {
+		latest, err := latestAccount(tx, address)
+		if err != nil {
+			return err
+		}
+		if err = updateAccountRanks(tx, common.BytesToAddress([]byte(address)), ranked, latest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountsAt returns the encoded accounts after the block of all the accounts changed in the blocks block+1..to,
+// they are the previous values of their first changes. The accounts which didn't exist are empty.
+func accountsAt(tx ethdb.Database, block, to uint64, quit <-chan struct{}) (map[string][]byte, error) {
+	accs := make(map[string][]byte)
+	if err := changeset.Walk(tx, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(block+1), 0, func(blockN uint64, k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		if blockN > to {
+			return false, nil
+		}
+		if _, ok := accs[string(k)]; !ok {
+			accs[string(k)] = common.CopyBytes(v)
+		}
+		return true, nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking account changesets: %w", err)
+	}
+	return accs, nil
+}
+
+func latestAccount(tx ethdb.Getter, address string) ([]byte, error) {
+	enc, err := tx.Get(dbutils.PlainStateBucket, []byte(address))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// updateAccountRanks replaces the ranks of the account encoded as prev with the ranks of the account encoded as enc
+func updateAccountRanks(tx ethdb.DbWithPendingMutations, address common.Address, prev, enc []byte) error {
+	if err := walkAccountRanks(tx, address, prev, func(bucket string, key, _ []byte) error {
+		return tx.Delete(bucket, key, nil)
+	}); err != nil {
+		return err
+	}
+	return walkAccountRanks(tx, address, enc, tx.Put)
+}
+
+// walkAccountRanks calls walker with the keys and the values of the ranks of the account encoded for the storage,
+// the accounts with the zero balance and without the code have no ranks
+func walkAccountRanks(db ethdb.Getter, address common.Address, enc []byte, walker func(bucket string, key, value []byte) error) error {
+	if len(enc) == 0 {
+		return nil
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return fmt.Errorf("decoding account %x: %w", address, err)
+	}
+	if !acc.Balance.IsZero() {
+		if err := walker(dbutils.BalanceRank, dbutils.BalanceRankKey(&acc.Balance, address), acc.Balance.Bytes()); err != nil {
+			return err
+		}
+	}
+	if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+		// The changesets omit the code hashes, they are restored by the incarnation
+		codeHash, err := db.Get(dbutils.PlainContractCodeBucket, dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation))
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		if len(codeHash) > 0 {
+			copy(acc.CodeHash[:], codeHash)
+		}
+	}
+	if acc.IsEmptyCodeHash() {
+		return nil
+	}
+	code, err := db.Get(dbutils.CodeBucket, acc.CodeHash[:])
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return err
+	}
+	if len(code) == 0 {
+		return nil
+	}
+	return walker(dbutils.CodeSizeRank, dbutils.CodeSizeRankKey(uint64(len(code)), address), acc.CodeHash[:])
+}
@@ -0,0 +1,98 @@
+package stagedsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/eth/stateanalysis"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountRanksStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	a, b, c, d, e := common.Address{0xa}, common.Address{0xb}, common.Address{0xc}, common.Address{0xd}, common.Address{0xe}
+	latest := make(map[common.Address]*accounts.Account)
+	update := func(w *state.PlainStateWriter, address common.Address, balance uint64, code []byte) {
+		acc := accounts.NewAccount()
+		acc.Initialised = true
+		acc.Balance.SetUint64(balance)
+		original := latest[address]
+		if original == nil {
+			original = &accounts.Account{}
+		}
+		if len(code) > 0 {
+			acc.Incarnation = 1
+			acc.CodeHash = crypto.Keccak256Hash(code)
+			require.NoError(t, w.UpdateAccountCode(address, 1, acc.CodeHash, code))
+		}
+		require.NoError(t, w.UpdateAccountData(context.Background(), address, original, &acc))
+		latest[address] = &acc
+	}
+	commit := func(w *state.PlainStateWriter, blockNum uint64) {
+		require.NoError(t, w.WriteChangeSets())
+		require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, blockNum))
+	}
+	check := func(balances []common.Address, codeSizes map[common.Address]uint64, codeOrder []common.Address) {
+		page, err := stateanalysis.TopBalances(tx.(ethdb.HasTx).Tx(), 0, 10)
+		require.NoError(t, err)
+		require.Len(t, page, len(balances))
+		for i, address := range balances {
+			assert.Equal(t, address, page[i].Address)
+			assert.Equal(t, latest[address].Balance.Uint64(), page[i].Balance.Uint64())
+		}
+		codePage, err := stateanalysis.TopCodeSizes(tx.(ethdb.HasTx).Tx(), 0, 10)
+		require.NoError(t, err)
+		require.Len(t, codePage, len(codeOrder))
+		for i, address := range codeOrder {
+			assert.Equal(t, stateanalysis.CodeSizeRank{Address: address, CodeSize: codeSizes[address], CodeHash: latest[address].CodeHash}, codePage[i])
+		}
+	}
+	codeSizes := map[common.Address]uint64{c: 10, d: 20, e: 15}
+
+	w := state.NewPlainStateWriter(tx, tx, 1)
+	update(w, a, 100, nil)
+	update(w, b, 300, nil)
+	update(w, c, 0, make([]byte, 10))
+	update(w, d, 50, make([]byte, 20))
+	commit(w, 1)
+	// The first cycle ranks the whole state
+	require.NoError(t, SpawnAccountRanksStage(&StageState{Stage: stages.AccountRanks}, tx, "", nil))
+	check([]common.Address{b, a, d}, codeSizes, []common.Address{d, c})
+	atBlock1 := map[common.Address]*accounts.Account{a: latest[a], b: latest[b], c: latest[c], d: latest[d]}
+
+	w = state.NewPlainStateWriter(tx, tx, 2)
+	update(w, a, 500, nil)
+	require.NoError(t, w.DeleteAccount(context.Background(), b, latest[b]))
+	delete(latest, b)
+	update(w, e, 0, make([]byte, 15))
+	// The changesets of the updated contracts have no code hashes
+	update(w, d, 60, make([]byte, 20))
+	commit(w, 2)
+	require.NoError(t, SpawnAccountRanksStage(&StageState{Stage: stages.AccountRanks, BlockNumber: 1}, tx, "", nil))
+	check([]common.Address{a, d}, codeSizes, []common.Address{d, e, c})
+	progress, err := stages.GetStageProgress(tx, stages.AccountRanks)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), progress)
+
+	page, err := stateanalysis.TopCodeSizes(tx.(ethdb.HasTx).Tx(), 1, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, e, page[0].Address)
+
+	// The unwind goes before the unwind of the execution, which reverts the state
+	require.NoError(t, UnwindAccountRanksStage(&UnwindState{Stage: stages.AccountRanks, UnwindPoint: 1}, &StageState{Stage: stages.AccountRanks, BlockNumber: 2}, tx, nil))
+	latest = atBlock1
+	check([]common.Address{b, a, d}, codeSizes, []common.Address{d, c})
+}
@@ -0,0 +1,348 @@
+package stagedsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/ledgerwatch/turbo-geth/turbo/verkle"
+)
+
+// SpawnBlockWitnesses generates the stateless witness of the executed block which follows the block the hashed state
+// and the intermediate hashes are at: they are the state before the block, so the stage runs between Execution and
+// HashState. At the tip of the chain every block is executed in its own cycle and gets its witness, the witnesses
+// of the other blocks executed in the same cycle (e.g. during the initial sync) and of the first cycle are skipped.
+func SpawnBlockWitnesses(s *StageState, db ethdb.Database, chainConfig *params.ChainConfig, chainContext core.ChainContext, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	to, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	if to == s.BlockNumber {
+		s.Done()
+		return nil
+	}
+	hashedAt, err := stages.GetStageProgress(tx, stages.HashState)
+	if err != nil {
+		return err
+	}
+	trieAt, err := stages.GetStageProgress(tx, stages.IntermediateHashes)
+	if err != nil {
+		return err
+	}
+
+	// The hashed state is built by the first cycle, the genesis state is only in the plain state before it
+	blockNum := trieAt + 1
+	if trieAt > 0 && hashedAt == trieAt && blockNum > s.BlockNumber && blockNum <= to {
+		if err = common.Stopped(quit); err != nil {
+			return err
+		}
+		witness, err := generateBlockWitness(tx, blockNum, chainConfig, chainContext)
+		if err != nil {
+			return fmt.Errorf("[%s] block %d: %w", logPrefix, blockNum, err)
+		}
+		if err = rawdb.WriteBlockWitness(tx, blockNum, witness); err != nil {
+			return err
+		}
+		log.Debug(fmt.Sprintf("[%s] Block witness", logPrefix), "number", blockNum, "size", common.StorageSize(len(witness)))
+	}
+	if to > s.BlockNumber+1 || blockNum != to {
+		log.Info(fmt.Sprintf("[%s] Witnesses of the blocks are skipped", logPrefix), "from", s.BlockNumber+1, "to", to)
+	}
+
+	if err = s.DoneAndUpdate(tx, to); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func UnwindBlockWitnesses(u *UnwindState, s *StageState, db ethdb.Database) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	if err := rawdb.DeleteNewerBlockWitnesses(tx, u.UnwindPoint+1); err != nil {
+		return fmt.Errorf("[%s] %w", logPrefix, err)
+	}
+	if err := u.Done(tx); err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+	if !useExternalTx {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("[%s] %w", logPrefix, err)
+		}
+	}
+	return nil
+}
+
+// generateBlockWitness re-executes the block on the hashed state, which must be the state before the block, to find
+// the keys it reads, and extracts the witness of them, and of the keys changed by the block, from the trie, or proves
+// them in the verkle tree or in the binary trie on the chains committing to them
+func generateBlockWitness(tx ethdb.Database, blockNum uint64, chainConfig *params.ChainConfig, chainContext core.ChainContext) ([]byte, error) {
+	block, err := rawdb.ReadBlockByNumberWithSenders(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block not found")
+	}
+	parent := rawdb.ReadHeader(tx, block.ParentHash(), blockNum-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent header %x not found", block.ParentHash())
+	}
+
+	reader := newWitnessReader(state.NewDbStateReader(tx))
+	vmConfig := &vm.Config{NoReceipts: true}
+	if _, _, err = core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, chainContext.Engine(), block, reader, state.NewNoopWriter()); err != nil {
+		return nil, err
+	}
+	// The changes not preceded by the reads, e.g. the storage removed by the self-destruction
+	if err = changeset.Walk(tx, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, _ []byte) (bool, error) {
+		return true, reader.touchAccount(common.BytesToAddress(k))
+	}); err != nil {
+		return nil, err
+	}
+	if err = changeset.Walk(tx, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 8*8, func(_ uint64, k, _ []byte) (bool, error) {
+		addr, incarnation, loc := dbutils.PlainParseCompositeStorageKey(k)
+		return true, reader.touchStorage(addr, incarnation, loc)
+	}); err != nil {
+		return nil, err
+	}
+
+	if chainConfig.IsVerkle() {
+		return reader.verkleWitness(tx, blockNum, parent.Root)
+	}
+	if chainConfig.IsBinaryTrie() {
+		return reader.binaryWitness(tx.(ethdb.HasTx).Tx(), parent.Root)
+	}
+	witness, err := reader.witness(tx.(ethdb.HasTx).Tx(), parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err = witness.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// witnessReader records the accounts, the storage items and the codes of the state read through it
+type witnessReader struct {
+	state.StateReader
+	accounts map[common.Hash]struct{}
+	storage  map[string]struct{}    // {addrHash}{incarnation}{keyHash}
+	codes    map[common.Hash][]byte // addrHash -> code
+	// The plain keys, the keys of the verkle tree are derived from them
+	addresses    map[common.Address]struct{}
+	plainStorage map[common.Address]map[common.Hash]struct{}
+	plainCodes   map[common.Address][]byte
+}
+
+func newWitnessReader(r state.StateReader) *witnessReader {
+	return &witnessReader{
+		StateReader:  r,
+		accounts:     make(map[common.Hash]struct{}),
+		storage:      make(map[string]struct{}),
+		codes:        make(map[common.Hash][]byte),
+		addresses:    make(map[common.Address]struct{}),
+		plainStorage: make(map[common.Address]map[common.Hash]struct{}),
+		plainCodes:   make(map[common.Address][]byte),
+	}
+}
+
+func (r *witnessReader) touchAccount(address common.Address) error {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	r.accounts[addrHash] = struct{}{}
+	r.addresses[address] = struct{}{}
+	return nil
+}
+
+func (r *witnessReader) touchStorage(address common.Address, incarnation uint64, key common.Hash) error {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	keyHash, err := common.HashData(key[:])
+	if err != nil {
+		return err
+	}
+	r.accounts[addrHash] = struct{}{}
+	r.storage[string(dbutils.GenerateCompositeStorageKey(addrHash, incarnation, keyHash))] = struct{}{}
+	r.addresses[address] = struct{}{}
+	if r.plainStorage[address] == nil {
+		r.plainStorage[address] = make(map[common.Hash]struct{})
+	}
+	r.plainStorage[address][key] = struct{}{}
+	return nil
+}
+
+func (r *witnessReader) touchCode(address common.Address, code []byte) error {
+	if len(code) == 0 {
+		return nil
+	}
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return err
+	}
+	r.codes[addrHash] = code
+	r.plainCodes[address] = code
+	return nil
+}
+
+func (r *witnessReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	if err := r.touchAccount(address); err != nil {
+		return nil, err
+	}
+	return r.StateReader.ReadAccountData(address)
+}
+
+func (r *witnessReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	if err := r.touchStorage(address, incarnation, *key); err != nil {
+		return nil, err
+	}
+	return r.StateReader.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *witnessReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	code, err := r.StateReader.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	return code, r.touchCode(address, code)
+}
+
+// ReadAccountCodeSize reads the whole code, as the stateless execution can only get its size from the witness
+func (r *witnessReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	code, err := r.ReadAccountCode(address, incarnation, codeHash)
+	return len(code), err
+}
+
+// witness loads the trie of the state with the given root, retaining the recorded keys, and extracts the witness
+func (r *witnessReader) witness(tx ethdb.Tx, root common.Hash) (*trie.Witness, error) {
+	keys := make([][]byte, 0, len(r.accounts)+len(r.storage))
+	rl := trie.NewRetainList(0)
+	for addrHash := range r.accounts {
+		addrHash := addrHash
+		keys = append(keys, addrHash[:])
+		rl.AddKey(addrHash[:])
+	}
+	for k := range r.storage {
+		addrHash, _, keyHash := dbutils.ParseCompositeStorageKey([]byte(k))
+		keys = append(keys, []byte(k))
+		rl.AddKey(dbutils.GenerateCompositeTrieKey(addrHash, keyHash))
+	}
+	t, err := trie.LoadRetainedTrie(tx, root, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	for addrHash, code := range r.codes {
+		if err = t.UpdateAccountCode(addrHash[:], code); err != nil {
+			return nil, err
+		}
+		rl.AddCodeTouch(crypto.Keccak256Hash(code))
+	}
+	return t.ExtractWitness(false, rl)
+}
+
+// verkleWitness is the proof of the recorded keys in the verkle tree of the state before the block, the tree is
+// built from the plain state, which is past the block, and is rewound by the changesets
+func (r *witnessReader) verkleWitness(tx ethdb.Database, blockNum uint64, root common.Hash) ([]byte, error) {
+	tree, err := verkle.BuildTree(tx.(ethdb.HasTx).Tx(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = verkle.RewindTree(tx, tree, blockNum); err != nil {
+		return nil, err
+	}
+	if treeRoot := tree.Root(); treeRoot != root {
+		return nil, fmt.Errorf("verkle root of the rewound state %x, expected %x", treeRoot, root)
+	}
+	var keys [][]byte
+	for address := range r.addresses {
+		keys = append(keys, tree.AccountKeys(address)...)
+	}
+	for address, slots := range r.plainStorage {
+		for slot := range slots {
+			keys = append(keys, tree.StorageKey(address, slot))
+		}
+	}
+	for address, code := range r.plainCodes {
+		for i := range verkle.ChunkifyCode(code) {
+			keys = append(keys, tree.CodeChunkKey(address, uint64(i)))
+		}
+	}
+	proof, err := tree.Prove(keys)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = proof.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// binaryWitness is the proof of the recorded keys, and the codes, in the binary trie of the hashed state
+func (r *witnessReader) binaryWitness(tx ethdb.Tx, root common.Hash) ([]byte, error) {
+	accountKeys := make([]common.Hash, 0, len(r.accounts))
+	for addrHash := range r.accounts {
+		accountKeys = append(accountKeys, addrHash)
+	}
+	storageKeys := make(map[common.Hash][]common.Hash)
+	for k := range r.storage {
+		addrHash, _, keyHash := dbutils.ParseCompositeStorageKey([]byte(k))
+		storageKeys[addrHash] = append(storageKeys[addrHash], keyHash)
+	}
+	codes := make([][]byte, 0, len(r.codes))
+	for _, code := range r.codes {
+		codes = append(codes, code)
+	}
+	return trie.GenerateBinaryProof(tx, root, accountKeys, storageKeys, codes)
+}
@@ -0,0 +1,104 @@
+package stagedsync_test
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockWitnesses(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	contract := crypto.CreateAddress(sender, 0)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	// The contract incrementing its slot 0, called in blocks 2 and 4
+	code := common.FromHex("0x600054600101600055")
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 6, func(i int, b *core.BlockGen) {
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			// The code returned by the constructor
+			initCode := append(common.FromHex("0x6009600c60003960096000f3"), code...)
+			tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), initCode)
+		case 1, 3:
+			tx = types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(), 100000, uint256.NewInt(), nil)
+		default:
+			tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+		}
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	require.NoError(t, err)
+
+	sm := ethdb.DefaultStorageMode
+	sm.Witnesses = true
+	// The blocks executed one per cycle, as at the tip of the chain, then the last two at once
+	for _, block := range blocks[:4] {
+		_, err = stagedsync.InsertBlocksInStages(db, sm, gspec.Config, &vm.Config{}, ethash.NewFaker(), []*types.Block{block}, true /* checkRoot */)
+		require.NoError(t, err)
+	}
+	_, err = stagedsync.InsertBlocksInStages(db, sm, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks[4:], true /* checkRoot */)
+	require.NoError(t, err)
+
+	senderHash, contractHash := crypto.Keccak256(sender[:]), crypto.Keccak256(contract[:])
+	for _, block := range blocks {
+		blockNum := block.NumberU64()
+		enc, err := rawdb.ReadBlockWitness(db, blockNum)
+		require.NoError(t, err)
+		if blockNum == 1 || blockNum == 6 {
+			require.Nil(t, enc, "block %d of the first cycle, or the second of the blocks executed in one cycle", blockNum)
+			continue
+		}
+		require.NotNil(t, enc, "block %d", blockNum)
+		witness, err := trie.NewWitnessFromReader(bytes.NewReader(enc), false)
+		require.NoError(t, err)
+		tr, err := trie.BuildTrieFromWitness(witness, false, false)
+		require.NoError(t, err)
+		parent := rawdb.ReadHeader(db, block.ParentHash(), blockNum-1)
+		require.Equal(t, parent.Root, tr.Hash(), "block %d", blockNum)
+
+		// The sender is in the witness as of before the block
+		acc, ok := tr.GetAccount(senderHash)
+		require.True(t, ok, "block %d", blockNum)
+		require.NotNil(t, acc)
+		require.Equal(t, blockNum-1, acc.Nonce, "block %d", blockNum)
+
+		// The code and the storage of the called contract too
+		if blockNum == 2 || blockNum == 4 {
+			contractCode, ok := tr.GetAccountCode(contractHash)
+			require.True(t, ok)
+			require.Equal(t, code, contractCode)
+			slot, ok := tr.Get(append(common.CopyBytes(contractHash), crypto.Keccak256(common.Hash{}.Bytes())...))
+			require.True(t, ok)
+			if blockNum == 2 {
+				require.Empty(t, slot)
+			} else {
+				require.NotEmpty(t, slot)
+			}
+		}
+	}
+}
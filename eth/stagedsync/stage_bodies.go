@@ -3,6 +3,7 @@ package stagedsync
 import (
 	"fmt"
 
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/turbo/stages/bodydownload"
 )
@@ -20,7 +21,12 @@ func spawnBodyDownloadStage(s *StageState, u Unwinder, d DownloaderGlue, pid str
 
 }
 
-func unwindBodyDownloadStage(u *UnwindState, db ethdb.Database) error {
+// UnwindBodyDownloadStage unwinds the Bodies stage, dropping the unwound blocks from the index of the tx counts
+func UnwindBodyDownloadStage(u *UnwindState, db ethdb.Database) error {
+	// The unwound blocks aren't canonical anymore, the bodies of the new canonical ones re-index them
+	if err := rawdb.DeleteNewerTxCounts(db, u.UnwindPoint+1); err != nil {
+		return fmt.Errorf("unwind Bodies: %w", err)
+	}
 	if err := u.Done(db); err != nil {
 		return fmt.Errorf("unwind Bodies: reset: %w", err)
 	}
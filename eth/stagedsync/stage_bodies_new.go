@@ -118,6 +118,9 @@ func BodiesForward(
 			if err = rawdb.WriteBody(batch, block.Hash(), block.NumberU64(), block.Body()); err != nil {
 				return fmt.Errorf("[%s] writing block body: %w", logPrefix, err)
 			}
+			if err = rawdb.WriteTxCount(batch, block.NumberU64(), uint32(len(block.Transactions()))); err != nil {
+				return fmt.Errorf("[%s] writing tx count: %w", logPrefix, err)
+			}
 			blockHeight := block.NumberU64()
 			if blockHeight > bodyProgress {
 				bodyProgress = blockHeight
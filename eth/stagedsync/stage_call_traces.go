@@ -85,6 +85,9 @@ func promoteCallTraces(logPrefix string, tx ethdb.Database, startBlock, endBlock
 	tos := map[string]*roaring.Bitmap{}
 	collectorFrom := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 	collectorTo := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	fromsMemory, tosMemory := etl.Memory.NewReservation(), etl.Memory.NewReservation()
+	defer fromsMemory.ReleaseAll()
+	defer tosMemory.ReleaseAll()
 
 	checkFlushEvery := time.NewTicker(flushEvery)
 	defer checkFlushEvery.Stop()
@@ -120,20 +123,22 @@ func promoteCallTraces(logPrefix string, tx ethdb.Database, startBlock, endBlock
 				"sys", common.StorageSize(m.Sys),
 				"numGC", int(m.NumGC))
 		case <-checkFlushEvery.C:
-			if needFlush(froms, bufLimit) {
+			if needFlush(froms, bufLimit, fromsMemory) {
 				if err := flushBitmaps(collectorFrom, froms); err != nil {
 					return fmt.Errorf("[%s] %w", logPrefix, err)
 				}
 
 				froms = map[string]*roaring.Bitmap{}
+				fromsMemory.ReleaseAll()
 			}
 
-			if needFlush(tos, bufLimit) {
+			if needFlush(tos, bufLimit, tosMemory) {
 				if err := flushBitmaps(collectorTo, tos); err != nil {
 					return fmt.Errorf("[%s] %w", logPrefix, err)
 				}
 
 				tos = map[string]*roaring.Bitmap{}
+				tosMemory.ReleaseAll()
 			}
 		}
 		blockHash, err2 := rawdb.ReadCanonicalHash(tx, blockNum)
@@ -157,7 +162,7 @@ func promoteCallTraces(logPrefix string, tx ethdb.Database, startBlock, endBlock
 		stateWriter = state.NewCachedWriter(state.NewNoopWriter(), cache)
 		tracer := NewCallTracer()
 		vmConfig := &vm.Config{Debug: true, NoReceipts: true, ReadOnly: false, Tracer: tracer}
-		if _, err := core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter); err != nil {
+		if _, _, err := core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter); err != nil {
 			return fmt.Errorf("[%s] %w", logPrefix, err)
 		}
 		for addr := range tracer.froms {
@@ -304,7 +309,7 @@ func unwindCallTraces(logPrefix string, db ethdb.Database, from, to uint64, chai
 		stateReader := state.NewCachedReader(state.NewPlainDBState(db, blockNum-1), cache)
 		stateWriter := state.NewCachedWriter(state.NewNoopWriter(), cache)
 
-		if _, err = core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter); err != nil {
+		if _, _, err = core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter); err != nil {
 			return fmt.Errorf("exec block: %w", err)
 		}
 		if cache.WriteSize() >= int(params.BatchSize) {
@@ -24,6 +24,8 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+	"github.com/ledgerwatch/turbo-geth/turbo/execproof"
 	"github.com/ledgerwatch/turbo-geth/turbo/shards"
 	"github.com/ledgerwatch/turbo-geth/turbo/silkworm"
 )
@@ -45,12 +47,18 @@ type StateWriterBuilder func(db ethdb.Database, changeSetsDB ethdb.Database, blo
 type ExecuteBlockStageParams struct {
 	ToBlock               uint64 // not setting this params means no limit
 	WriteReceipts         bool
+	WritePreimages        bool // records the preimages of the changed addresses and storage keys
 	Cache                 *shards.StateCache
 	BatchSize             datasize.ByteSize
 	ChangeSetHook         ChangeSetHook
 	ReaderBuilder         StateReaderBuilder
 	WriterBuilder         StateWriterBuilder
 	SilkwormExecutionFunc unsafe.Pointer
+	DiffChecker           *difftest.Checker // cross-checks the execution of every block against another implementation
+	ExecutionProofs       *execproof.Store  // ranges of the blocks to fast-forward by their changesets instead of executing
+	ReadCache             *state.ReadCache  // recently read state, kept between the blocks
+	PrefetchDB            ethdb.Database    // database to prefetch the state of the next block from, nil disables the prefetch
+	ParallelWorkers       int               // number of the workers executing the transactions of the block in parallel, experimental
 }
 
 func readBlock(blockNum uint64, tx ethdb.Database) (*types.Block, error) {
@@ -75,6 +83,7 @@ func executeBlockWithGo(block *types.Block, tx ethdb.Database, cache *shards.Sta
 	blockNum := block.NumberU64()
 	var stateReader state.StateReader
 	var stateWriter state.WriterWithChangeSets
+	var csw *state.ChangeSetWriter
 
 	if params.ReaderBuilder != nil {
 		stateReader = params.ReaderBuilder(batch)
@@ -84,27 +93,69 @@ func executeBlockWithGo(block *types.Block, tx ethdb.Database, cache *shards.Sta
 	if cache != nil {
 		stateReader = state.NewCachedReader(stateReader, cache)
 	}
+	if params.ReadCache != nil {
+		var err error
+		if stateReader, err = params.ReadCache.Reader(tx, stateReader, blockNum-1); err != nil {
+			return fmt.Errorf("state read cache: %w", err)
+		}
+	}
 
 	if params.WriterBuilder != nil {
 		stateWriter = params.WriterBuilder(batch, tx, blockNum)
 	} else if cache == nil {
 		stateWriter = state.NewPlainStateWriter(batch, tx, blockNum)
 	} else {
-		stateWriter = state.NewCachedWriter(state.NewChangeSetWriterPlain(tx, blockNum), cache)
+		csw = state.NewChangeSetWriterPlain(tx, blockNum)
+		stateWriter = state.NewCachedWriter(csw, cache)
+	}
+	if hasChangeSet, ok := stateWriter.(HasChangeSetWriter); ok {
+		csw = hasChangeSet.ChangeSetWriter()
 	}
 
 	engine := chainContext.Engine()
 
+	var recorder *difftest.RecordingReader
+	execReader := stateReader
+	if params.DiffChecker != nil {
+		recorder = difftest.NewRecordingReader(stateReader)
+		execReader = recorder
+	}
+
 	// where the magic happens
-	receipts, err := core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter)
+	var receipts types.Receipts
+	var borReceipt *types.Receipt
+	var err error
+	if params.ParallelWorkers > 1 {
+		receipts, borReceipt, err = core.ExecuteBlockInParallel(chainConfig, vmConfig, chainContext, engine, block, execReader, stateWriter, params.ParallelWorkers)
+	} else {
+		receipts, borReceipt, err = core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, execReader, stateWriter)
+	}
 	if err != nil {
 		return err
 	}
 
+	if params.DiffChecker != nil {
+		if err = params.DiffChecker.CheckBlock(chainConfig, block, chainContext.GetHeader, recorder, stateReader); err != nil {
+			return err
+		}
+	}
+
 	if params.WriteReceipts {
 		if err = rawdb.AppendReceipts(tx, blockNum, receipts); err != nil {
 			return err
 		}
+		if borReceipt != nil {
+			if err = rawdb.WriteBorReceipt(tx, blockNum, block.Hash(), borReceipt.Logs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if params.WritePreimages && csw != nil {
+		// The preimages are not removed by the unwinds, the hashes keep their preimages
+		if err = state.WritePreimages(batch, csw); err != nil {
+			return err
+		}
 	}
 
 	if params.ChangeSetHook != nil {
@@ -153,6 +204,9 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 	if useSilkworm && params.Cache != nil {
 		panic("CacheSize is not supported with Silkworm yet")
 	}
+	if useSilkworm && params.DiffChecker != nil {
+		panic("DiffChecker is not supported with Silkworm")
+	}
 
 	var cache *shards.StateCache
 	var batch ethdb.DbWithPendingMutations
@@ -168,6 +222,23 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 
 	chainContext.SetDB(tx)
 
+	if params.WriteReceipts {
+		// The receipts above the executed blocks, e.g. imported with the blocks, are replaced by the executed ones
+		if err := rawdb.DeleteNewerReceipts(tx, s.BlockNumber+1); err != nil {
+			return fmt.Errorf("%s: deleting receipts: %w", logPrefix, err)
+		}
+		if err := rawdb.DeleteNewerBorReceipts(tx, s.BlockNumber+1); err != nil {
+			return fmt.Errorf("%s: deleting bor receipts: %w", logPrefix, err)
+		}
+	}
+
+	var prefetch *prefetcher
+	if params.PrefetchDB != nil && !useSilkworm {
+		prefetch = newPrefetcher(params.PrefetchDB, params.ReadCache)
+		defer prefetch.close()
+	}
+	var next *types.Block
+
 	logEvery := time.NewTicker(logInterval)
 	defer logEvery.Stop()
 	stageProgress := s.BlockNumber
@@ -185,15 +256,32 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 			if blockNum, err = silkworm.ExecuteBlocks(params.SilkwormExecutionFunc, txn, chainConfig.ChainID, blockNum, to, int(params.BatchSize), params.WriteReceipts); err != nil {
 				return err
 			}
+		} else if a := params.ExecutionProofs.Starting(blockNum); a != nil && a.ToBlock <= to && cache == nil && applicableProof(logPrefix, tx, a) {
+			if err = params.ExecutionProofs.Apply(tx, batch, a); err != nil {
+				return fmt.Errorf("%s: %w", logPrefix, err)
+			}
+			log.Info(fmt.Sprintf("[%s] Fast-forwarded by execution proof", logPrefix), "from", a.FromBlock, "to", a.ToBlock)
+			blockNum = a.ToBlock
 		} else {
 			var block *types.Block
-			if block, err = readBlock(blockNum, tx); err != nil {
+			if next != nil && next.NumberU64() == blockNum {
+				block = next
+			} else if block, err = readBlock(blockNum, tx); err != nil {
 				return err
 			}
 			if block == nil {
 				log.Error(fmt.Sprintf("[%s] Empty block", logPrefix), "blocknum", blockNum)
 				break
 			}
+			if prefetch != nil {
+				next = nil
+				if blockNum < to {
+					if next, err = readBlock(blockNum+1, tx); err != nil {
+						return err
+					}
+				}
+				prefetch.execute(blockNum, next)
+			}
 			if err = executeBlockWithGo(block, tx, cache, batch, chainConfig, chainContext, vmConfig, params); err != nil {
 				return err
 			}
@@ -291,6 +379,16 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 	return nil
 }
 
+// applicableProof tells whether the proof is of the canonical chain
+func applicableProof(logPrefix string, tx ethdb.Getter, a *execproof.Attestation) bool {
+	hash, err := rawdb.ReadCanonicalHash(tx, a.ToBlock)
+	if err != nil || hash != a.ToBlockHash {
+		log.Warn(fmt.Sprintf("[%s] Execution proof is not of the canonical chain", logPrefix), "from", a.FromBlock, "to", a.ToBlock, "hash", a.ToBlockHash, "canonical", hash, "err", err)
+		return false
+	}
+	return true
+}
+
 func commitCache(tx ethdb.DbWithPendingMutations, writes [5]*btree.BTree) error {
 	return shards.WalkWrites(writes,
 		func(address []byte, account *accounts.Account) error { // accountWrite
@@ -446,6 +544,9 @@ func UnwindExecutionStage(u *UnwindState, s *StageState, stateDB ethdb.Database,
 		if err := rawdb.DeleteNewerReceipts(tx, u.UnwindPoint+1); err != nil {
 			return fmt.Errorf("%s: walking receipts: %v", logPrefix, err)
 		}
+		if err := rawdb.DeleteNewerBorReceipts(tx, u.UnwindPoint+1); err != nil {
+			return fmt.Errorf("%s: walking bor receipts: %v", logPrefix, err)
+		}
 	}
 
 	if err := u.Done(tx); err != nil {
@@ -2,11 +2,20 @@ package stagedsync
 
 import (
 	"context"
+	"math/big"
 	"testing"
 
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
 	"github.com/stretchr/testify/require"
 )
 
@@ -127,3 +136,58 @@ func TestUnwindExecutionStagePlainWithCodeChanges(t *testing.T) {
 
 	compareCurrentState(t, db1, db2, dbutils.PlainStateBucket, dbutils.PlainContractCodeBucket)
 }
+
+func TestExecutionPreimages(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	contract := crypto.CreateAddress(sender, 0)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	signer := types.LatestSigner(gspec.Config)
+	// The contract incrementing its slot 0, called in the block 2
+	code := common.FromHex("0x600054600101600055")
+	generate := func(db *ethdb.ObjectDatabase) []*types.Block {
+		genesis := gspec.MustCommit(db)
+		blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+			var tx *types.Transaction
+			switch i {
+			case 0:
+				initCode := append(common.FromHex("0x6009600c60003960096000f3"), code...)
+				tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), initCode)
+			case 1:
+				tx = types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(), 100000, uint256.NewInt(), nil)
+			default:
+				tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+			}
+			tx, err := types.SignTx(tx, signer, key)
+			require.NoError(t, err)
+			b.AddTx(tx)
+		}, false)
+		require.NoError(t, err)
+		return blocks
+	}
+	slot := common.Hash{}
+	hashes := [][]byte{crypto.Keccak256(contract[:]), crypto.Keccak256(to[:]), crypto.Keccak256(slot[:])}
+
+	for _, record := range []bool{true, false} {
+		db := ethdb.NewMemDatabase()
+		blocks := generate(db)
+		sm := ethdb.DefaultStorageMode
+		sm.Preimages = record
+		_, err := InsertBlocksInStages(db, sm, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */)
+		require.NoError(t, err)
+
+		for i, preimage := range [][]byte{contract[:], to[:], slot[:]} {
+			v, err := db.Get(dbutils.PreimagePrefix, hashes[i])
+			if !record {
+				require.Nil(t, v, "preimage %x", preimage)
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, preimage, v)
+		}
+		db.Close()
+	}
+}
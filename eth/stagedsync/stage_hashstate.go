@@ -12,6 +12,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/common/etl"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/turbo/shards"
@@ -76,51 +77,54 @@ func unwindHashStateStageImpl(logPrefix string, u *UnwindState, s *StageState, s
 	return nil
 }
 
+// PromoteHashedStateCleanly hashes the whole plain state in three steps: accounts, storage and codes.
+// Each step commits its result together with a checkpoint, so if the promotion is interrupted
+// (e.g. by a shutdown), the next run skips the steps which were completed.
 func PromoteHashedStateCleanly(logPrefix string, db ethdb.Database, tmpdir string, quit <-chan struct{}) error {
-	err := etl.Transform(
-		logPrefix,
-		db,
-		dbutils.PlainStateBucket,
-		dbutils.HashedAccountsBucket,
-		tmpdir,
-		keyTransformExtractAcc(transformPlainStateKey),
-		etl.IdentityLoadFunc,
-		etl.TransformArgs{
-			Quit: quit,
-		},
-	)
+	checkpoint, err := stages.GetStageCheckpoint(db, stages.HashState)
 	if err != nil {
 		return err
 	}
 
-	err = etl.Transform(
-		logPrefix,
-		db,
-		dbutils.PlainStateBucket,
-		dbutils.HashedStorageBucket,
-		tmpdir,
-		keyTransformExtractStorage(transformPlainStateKey),
-		etl.IdentityLoadFunc,
-		etl.TransformArgs{
-			Quit: quit,
-		},
-	)
-	if err != nil {
-		return err
+	steps := []struct {
+		name       string
+		fromBucket string
+		toBucket   string
+		extract    etl.ExtractFunc
+	}{
+		{"accounts", dbutils.PlainStateBucket, dbutils.HashedAccountsBucket, keyTransformExtractAcc(transformPlainStateKey)},
+		{"storage", dbutils.PlainStateBucket, dbutils.HashedStorageBucket, keyTransformExtractStorage(transformPlainStateKey)},
+		{"codes", dbutils.PlainContractCodeBucket, dbutils.ContractCodeBucket, keyTransformExtractFunc(transformContractCodeKey)},
+	}
+	for i, step := range steps {
+		completed := uint64(i + 1)
+		if completed <= checkpoint {
+			log.Info(fmt.Sprintf("[%s] Skipping promotion completed before the restart", logPrefix), "step", step.name)
+			continue
+		}
+		if err = etl.Transform(
+			logPrefix,
+			db,
+			step.fromBucket,
+			step.toBucket,
+			tmpdir,
+			step.extract,
+			etl.IdentityLoadFunc,
+			etl.TransformArgs{
+				Quit: quit,
+				OnLoadCommit: func(putter ethdb.Putter, _ []byte, isDone bool) error {
+					if !isDone {
+						return nil
+					}
+					return stages.SaveStageCheckpoint(putter, stages.HashState, completed)
+				},
+			},
+		); err != nil {
+			return err
+		}
 	}
 
-	return etl.Transform(
-		logPrefix,
-		db,
-		dbutils.PlainContractCodeBucket,
-		dbutils.ContractCodeBucket,
-		tmpdir,
-		keyTransformExtractFunc(transformContractCodeKey),
-		etl.IdentityLoadFunc,
-		etl.TransformArgs{
-			Quit: quit,
-		},
-	)
+	return stages.SaveStageCheckpoint(db, stages.HashState, 0)
 }
 
 func keyTransformExtractFunc(transformKey func([]byte) ([]byte, error)) etl.ExtractFunc {
@@ -301,18 +305,18 @@ func getExtractCode(db ethdb.Getter, changeSetBucket string) etl.ExtractFunc {
 		if len(value) == 0 {
 			return nil
 		}
-		var a accounts.Account
-		if err = a.DecodeForStorage(value); err != nil {
+		incarnation, err := accounts.StorageView(value).Incarnation()
+		if err != nil {
 			return err
 		}
-		if a.Incarnation == 0 {
+		if incarnation == 0 {
 			return nil
 		}
-		plainKey := dbutils.PlainGenerateStoragePrefix(k, a.Incarnation)
+		plainKey := dbutils.PlainGenerateStoragePrefix(k, incarnation)
 		var codeHash []byte
 		codeHash, err = db.Get(dbutils.PlainContractCodeBucket, plainKey)
 		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
-			return fmt.Errorf("getFromPlainCodesAndLoad for %x, inc %d: %w", plainKey, a.Incarnation, err)
+			return fmt.Errorf("getFromPlainCodesAndLoad for %x, inc %d: %w", plainKey, incarnation, err)
 		}
 		if codeHash == nil {
 			return nil
@@ -348,14 +352,23 @@ func getUnwindExtractAccounts(db ethdb.Getter, changeSetBucket string) etl.Extra
 		if len(v) == 0 {
 			return next(dbKey, newK, v)
 		}
-		var acc accounts.Account
-		if err = acc.DecodeForStorage(v); err != nil {
+		view := accounts.StorageView(v)
+		incarnation, err := view.Incarnation()
+		if err != nil {
+			return err
+		}
+		emptyCodeHash, err := view.IsEmptyCodeHash()
+		if err != nil {
 			return err
 		}
-		if !(acc.Incarnation > 0 && acc.IsEmptyCodeHash()) {
+		if !(incarnation > 0 && emptyCodeHash) {
 			return next(dbKey, newK, v)
 		}
 
+		var acc accounts.Account
+		if err = view.Decode(&acc); err != nil {
+			return err
+		}
 		if codeHash, err := db.Get(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(newK, acc.Incarnation)); err == nil {
 			copy(acc.CodeHash[:], codeHash)
 		} else if !errors.Is(err, ethdb.ErrKeyNotFound) {
@@ -376,18 +389,18 @@ func getCodeUnwindExtractFunc(db ethdb.Getter, changeSetBucket string) etl.Extra
 			return nil
 		}
 		var (
-			a        accounts.Account
-			newK     []byte
-			codeHash []byte
-			err      error
+			incarnation uint64
+			newK        []byte
+			codeHash    []byte
+			err         error
 		)
-		if err = a.DecodeForStorage(v); err != nil {
+		if incarnation, err = accounts.StorageView(v).Incarnation(); err != nil {
 			return err
 		}
-		if a.Incarnation == 0 {
+		if incarnation == 0 {
 			return nil
 		}
-		plainKey := dbutils.PlainGenerateStoragePrefix(k, a.Incarnation)
+		plainKey := dbutils.PlainGenerateStoragePrefix(k, incarnation)
 		codeHash, err = db.Get(dbutils.PlainContractCodeBucket, plainKey)
 		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
 			return fmt.Errorf("getCodeUnwindExtractFunc: %w, key=%x", err, plainKey)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
@@ -54,6 +55,28 @@ func TestPromoteHashedStateClearState(t *testing.T) {
 	compareCurrentState(t, db1, db2, dbutils.HashedAccountsBucket, dbutils.HashedStorageBucket, dbutils.ContractCodeBucket)
 }
 
+func TestPromoteHashedStateCleanlyResume(t *testing.T) {
+	db1 := ethdb.NewMemDatabase()
+	defer db1.Close()
+	db2 := ethdb.NewMemDatabase()
+	defer db2.Close()
+
+	generateBlocks(t, 1, 50, hashedWriterGen(db1), changeCodeWithIncarnations)
+	generateBlocks(t, 1, 50, plainWriterGen(db2), changeCodeWithIncarnations)
+
+	// Simulate a promotion interrupted after the accounts were hashed
+	require.NoError(t, PromoteHashedStateCleanly("logPrefix", db2, getTmpDir(), nil))
+	require.NoError(t, db2.ClearBuckets(dbutils.HashedStorageBucket, dbutils.ContractCodeBucket))
+	require.NoError(t, stages.SaveStageCheckpoint(db2, stages.HashState, 1))
+
+	require.NoError(t, PromoteHashedStateCleanly("logPrefix", db2, getTmpDir(), nil))
+	checkpoint, err := stages.GetStageCheckpoint(db2, stages.HashState)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), checkpoint)
+
+	compareCurrentState(t, db1, db2, dbutils.HashedAccountsBucket, dbutils.HashedStorageBucket, dbutils.ContractCodeBucket)
+}
+
 func TestPromoteHashedStateIncremental(t *testing.T) {
 	db1 := ethdb.NewMemDatabase()
 	defer db1.Close()
@@ -70,6 +70,18 @@ func (cr ChainReader) GetBlock(hash common.Hash, number uint64) *types.Block {
 	return rawdb.ReadBlock(cr.db, hash, number)
 }
 
+// UnwindHeaderDownloadStage unwinds the Headers stage, dropping the clique snapshots of the unwound headers
+func UnwindHeaderDownloadStage(u *UnwindState, db ethdb.Database) error {
+	// The snapshots of the new canonical headers are recomputed by the verification from the older checkpoints
+	if err := rawdb.DeleteNewerCliqueSnapshots(db, u.UnwindPoint+1); err != nil {
+		return fmt.Errorf("unwind Headers: %w", err)
+	}
+	if err := u.Done(db); err != nil {
+		return fmt.Errorf("unwind Headers: reset: %w", err)
+	}
+	return nil
+}
+
 func VerifyHeaders(db ethdb.Database, headers []*types.Header, config *params.ChainConfig, engine consensus.Engine, checkFreq int) error {
 	// Generate the list of seal verification requests, and start the parallel verifier
 	seals := make([]bool, len(headers))
@@ -100,6 +112,17 @@ func VerifyHeaders(db ethdb.Database, headers []*types.Header, config *params.Ch
 }
 
 func InsertHeaderChain(logPrefix string, db ethdb.Database, headers []*types.Header) (bool, bool, uint64, error) {
+	return insertHeaderChain(logPrefix, db, headers, false)
+}
+
+// InsertHeaderChainForkChoice is like InsertHeaderChain, but the headers become canonical regardless of their
+// total difficulty, as chosen by the consensus client after the merge
+func InsertHeaderChainForkChoice(logPrefix string, db ethdb.Database, headers []*types.Header) (bool, uint64, error) {
+	_, reorg, forkBlockNumber, err := insertHeaderChain(logPrefix, db, headers, true)
+	return reorg, forkBlockNumber, err
+}
+
+func insertHeaderChain(logPrefix string, db ethdb.Database, headers []*types.Header, forkChoice bool) (bool, bool, uint64, error) {
 	start := time.Now()
 
 	// ignore headers that we already have
@@ -160,7 +183,7 @@ Error: %v
 	// If the total difficulty is higher than our known, add it to the canonical chain
 	// Second clause in the if statement reduces the vulnerability to selfish mining.
 	// Please refer to http://www.cs.cornell.edu/~ie53/publications/btcProcFC.pdf
-	newCanonical := externTd.Cmp(localTd) > 0
+	newCanonical := forkChoice || externTd.Cmp(localTd) > 0
 
 	if !newCanonical && externTd.Cmp(localTd) == 0 {
 		if lastHeader.Number.Uint64() < *headNumber {
@@ -26,6 +26,7 @@ func HeadersForward(
 	hd *headerdownload.HeaderDownload,
 	chainConfig *params.ChainConfig,
 	headerReqSend func(context.Context, *headerdownload.HeaderRequest) []byte,
+	penalise func(context.Context, []byte),
 	initialCycle bool,
 	wakeUpChan chan struct{},
 	batchSize datasize.ByteSize,
@@ -92,7 +93,7 @@ func HeadersForward(
 		if req != nil {
 			peer = headerReqSend(ctx, req)
 			if peer != nil {
-				hd.SentRequest(req, currentTime, 5 /* timeout */)
+				hd.SentRequest(req, peer, currentTime, 5 /* timeout */)
 				//log.Info("Sent request", "height", req.Number)
 			}
 		}
@@ -102,16 +103,22 @@ func HeadersForward(
 			if req != nil {
 				peer = headerReqSend(ctx, req)
 				if peer != nil {
-					hd.SentRequest(req, currentTime, 5 /*timeout */)
+					hd.SentRequest(req, peer, currentTime, 5 /* timeout */)
 					//log.Info("Sent request", "height", req.Number)
 				}
 			}
 			maxRequests--
 		}
-		// Send skeleton request if required
-		req = hd.RequestSkeleton()
-		if req != nil {
-			peer = headerReqSend(ctx, req)
+		// Send skeleton requests if required, the parts of the skeleton go to different peers
+		for _, skeletonReq := range hd.RequestSkeletons(currentTime) {
+			if skeletonPeer := headerReqSend(ctx, skeletonReq); skeletonPeer != nil {
+				hd.SentRequest(skeletonReq, skeletonPeer, currentTime, 5 /* timeout */)
+			}
+		}
+		// Penalise the peers which keep ignoring the requests for the headers they have
+		hd.ExpireRequests(currentTime)
+		for _, penaltyPeer := range hd.PenaltyPeers() {
+			penalise(ctx, penaltyPeer)
 		}
 		// Load headers into the database
 		if err = hd.InsertHeaders(headerInserter.FeedHeader); err != nil {
@@ -232,6 +239,10 @@ func HeadersUnwind(u *UnwindState, s *StageState, db ethdb.Database) error {
 			return err
 		}
 	}
+	// The clique snapshots of the unwound headers would pile up with every reorg
+	if err = rawdb.DeleteNewerCliqueSnapshots(tx, u.UnwindPoint+1); err != nil {
+		return err
+	}
 	if err = u.Skip(tx); err != nil {
 		return err
 	}
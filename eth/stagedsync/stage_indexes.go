@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
@@ -16,9 +18,11 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/changeset"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"golang.org/x/sync/errgroup"
 )
 
 func SpawnAccountHistoryIndex(s *StageState, db ethdb.Database, tmpdir string, quitCh <-chan struct{}) error {
@@ -124,6 +128,8 @@ func promoteHistory(logPrefix string, db ethdb.Database, changesetBucket string,
 	defer checkFlushEvery.Stop()
 
 	collectorUpdates := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	updatesMemory := etl.Memory.NewReservation()
+	defer updatesMemory.ReleaseAll()
 
 	if err := changeset.Walk(db, changesetBucket, dbutils.EncodeBlockNumber(start), 0, func(blockN uint64, k, v []byte) (bool, error) {
 		if blockN >= stop {
@@ -142,11 +148,12 @@ func promoteHistory(logPrefix string, db ethdb.Database, changesetBucket string,
 			runtime.ReadMemStats(&m)
 			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockN, "alloc", common.StorageSize(m.Alloc), "sys", common.StorageSize(m.Sys))
 		case <-checkFlushEvery.C:
-			if needFlush64(updates, bufLimit) {
+			if needFlush64(updates, bufLimit, updatesMemory) {
 				if err := flushBitmaps64(collectorUpdates, updates); err != nil {
 					return false, err
 				}
 				updates = map[string]*roaring64.Bitmap{}
+				updatesMemory.ReleaseAll()
 			}
 		}
 
@@ -304,13 +311,19 @@ func unwindHistory(logPrefix string, db ethdb.Database, csBucket string, to uint
 	return nil
 }
 
-func needFlush64(bitmaps map[string]*roaring64.Bitmap, memLimit datasize.ByteSize) bool {
+// needFlush64 accounts the memory used by the bitmaps in the reservation and returns whether they
+// must be flushed, either because they outgrew memLimit or because the global memory limit is exceeded
+func needFlush64(bitmaps map[string]*roaring64.Bitmap, memLimit datasize.ByteSize, memory *etl.Reservation) bool {
 	sz := uint64(0)
 	for _, m := range bitmaps {
 		sz += m.GetSizeInBytes()
 	}
 	const memoryNeedsForKey = 32 * 2 // each key stored in RAM: as string ang slice of bytes
-	return uint64(len(bitmaps)*memoryNeedsForKey)+sz > uint64(memLimit)
+	sz += uint64(len(bitmaps) * memoryNeedsForKey)
+	if held := memory.Held(); sz > held {
+		memory.Grow(sz - held)
+	}
+	return sz > uint64(memLimit) || memory.Exceeded()
 }
 
 func flushBitmaps64(c *etl.Collector, inMem map[string]*roaring64.Bitmap) error {
@@ -344,3 +357,207 @@ func truncateBitmaps64(tx ethdb.Database, bucket string, inMem map[string]struct
 
 	return nil
 }
+
+// ReindexHistoryConfig is the configuration of ReindexHistory
+type ReindexHistoryConfig struct {
+	// Shards is the number of the goroutines reading the changesets, each of them its own range of the blocks in
+	// its own read-only transaction. The number of CPUs if zero
+	Shards int
+	// ChunkLimit is the size the bitmaps of the index are cut at, bitmapdb.ChunkLimit if zero
+	ChunkLimit uint64
+}
+
+var historyIndexStages = map[string]stages.SyncStage{
+	dbutils.PlainAccountChangeSetBucket: stages.AccountHistoryIndex,
+	dbutils.PlainStorageChangeSetBucket: stages.StorageHistoryIndex,
+}
+
+// ReindexHistory drops the history index of the changeset bucket (AccountsHistory or StorageHistory) and regenerates
+// it from the changesets of the blocks up to the progress of the Execution stage - to recover the corrupted index or
+// to apply another ChunkLimit. The shards collect the bitmaps of their blocks, the index is then loaded and the
+// progress of its stage is set in one transaction, so the interrupted reindex leaves the old index in place
+func ReindexHistory(logPrefix string, db ethdb.Database, changesetBucket string, cfg ReindexHistoryConfig, tmpdir string, quit <-chan struct{}) error {
+	stage, ok := historyIndexStages[changesetBucket]
+	if !ok {
+		return fmt.Errorf("[%s] not a changeset bucket: %s", logPrefix, changesetBucket)
+	}
+	shards := cfg.Shards
+	if shards <= 0 {
+		shards = runtime.NumCPU()
+	}
+	chunkLimit := cfg.ChunkLimit
+	if chunkLimit == 0 {
+		chunkLimit = bitmapdb.ChunkLimit
+	}
+	executionAt, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return fmt.Errorf("[%s] getting last executed block: %w", logPrefix, err)
+	}
+
+	collector := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close(logPrefix)
+	if err = collectHistoryShards(logPrefix, db, changesetBucket, executionAt+1, shards, collector, quit); err != nil {
+		return fmt.Errorf("[%s] %w", logPrefix, err)
+	}
+
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	indexBucket := changeset.Mapper[changesetBucket].IndexBucket
+	if err = tx.(ethdb.BucketsMigrator).ClearBuckets(indexBucket); err != nil {
+		return err
+	}
+
+	// The keys are collected with the first block of their bitmap as the suffix, so the bitmaps of a key come
+	// ordered by the blocks, whichever shard collected them
+	currentBitmap := roaring64.New()
+	buf := bytes.NewBuffer(nil)
+	lastChunkKey := make([]byte, 128)
+	loaderFunc := func(k []byte, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+		k = k[:len(k)-8]
+		if _, err := currentBitmap.ReadFrom(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		lastChunkKey = lastChunkKey[:len(k)+8]
+		copy(lastChunkKey, k)
+		binary.BigEndian.PutUint64(lastChunkKey[len(k):], ^uint64(0))
+		lastChunkBytes, err := table.Get(lastChunkKey)
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return fmt.Errorf("find last chunk failed: %w", err)
+		}
+		if len(lastChunkBytes) > 0 {
+			lastChunk := roaring64.New()
+			if _, err = lastChunk.ReadFrom(bytes.NewReader(lastChunkBytes)); err != nil {
+				return fmt.Errorf("couldn't read last history index chunk: %w, len(lastChunkBytes)=%d", err, len(lastChunkBytes))
+			}
+			currentBitmap.Or(lastChunk) // merge last existing chunk from db - next loop will overwrite it
+		}
+		if err = bitmapdb.WalkChunkWithKeys64(k, currentBitmap, chunkLimit, func(chunkKey []byte, chunk *roaring64.Bitmap) error {
+			buf.Reset()
+			if _, err = chunk.WriteTo(buf); err != nil {
+				return err
+			}
+			return next(k, chunkKey, buf.Bytes())
+		}); err != nil {
+			return err
+		}
+		currentBitmap.Clear()
+		return nil
+	}
+	if err = collector.Load(logPrefix, tx, indexBucket, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return fmt.Errorf("[%s] %w", logPrefix, err)
+	}
+	if err = stages.SaveStageProgress(tx, stage, executionAt); err != nil {
+		return err
+	}
+	if err = stages.SaveStageUnwind(tx, stage, 0); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("[%s] Reindexed", logPrefix), "bucket", indexBucket, "blocks", executionAt)
+	return nil
+}
+
+// collectHistoryShards splits the blocks below stop into the ranges of the shards, and collects the bitmaps of the
+// keys changed in each range keyed by the key and the first block of the bitmap
+func collectHistoryShards(logPrefix string, db ethdb.Database, changesetBucket string, stop uint64, shards int, collector *etl.Collector, quit <-chan struct{}) error {
+	step := stop/uint64(shards) + 1
+	var walked uint64
+	var collectMu sync.Mutex
+	collect := func(bitmaps map[string]*roaring64.Bitmap) error {
+		collectMu.Lock()
+		defer collectMu.Unlock()
+		for k, bm := range bitmaps {
+			bm.RunOptimize()
+			buf := bytes.NewBuffer(make([]byte, 0, bm.GetSerializedSizeInBytes()))
+			if _, err := bm.WriteTo(buf); err != nil {
+				return err
+			}
+			if err := collector.Collect(append([]byte(k), dbutils.EncodeBlockNumber(bm.Minimum())...), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		logEvery := time.NewTicker(30 * time.Second)
+		defer logEvery.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-logEvery.C:
+				var m runtime.MemStats
+				runtime.ReadMemStats(&m)
+				log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "blocks", atomic.LoadUint64(&walked), "of", stop, "alloc", common.StorageSize(m.Alloc), "sys", common.StorageSize(m.Sys))
+			}
+		}
+	}()
+
+	g, ctx := errgroup.WithContext(context.Background())
+	for from := uint64(0); from < stop; from += step {
+		from, to := from, from+step
+		if to > stop {
+			to = stop
+		}
+		g.Go(func() error {
+			tx, err := db.Begin(ctx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			updates := map[string]*roaring64.Bitmap{}
+			memory := etl.Memory.NewReservation()
+			defer memory.ReleaseAll()
+			checkFlushEvery := time.NewTicker(bitmapsFlushEvery)
+			defer checkFlushEvery.Stop()
+			lastBlock := from
+			if err = changeset.Walk(tx, changesetBucket, dbutils.EncodeBlockNumber(from), 0, func(blockN uint64, k, v []byte) (bool, error) {
+				if blockN >= to {
+					return false, nil
+				}
+				if blockN != lastBlock {
+					if err := common.Stopped(quit); err != nil {
+						return false, err
+					}
+					if err := ctx.Err(); err != nil {
+						return false, err
+					}
+					atomic.AddUint64(&walked, blockN-lastBlock)
+					lastBlock = blockN
+				}
+				select {
+				default:
+				case <-checkFlushEvery.C:
+					if needFlush64(updates, bitmapsBufLimit/datasize.ByteSize(shards), memory) {
+						if err := collect(updates); err != nil {
+							return false, err
+						}
+						updates = map[string]*roaring64.Bitmap{}
+						memory.ReleaseAll()
+					}
+				}
+				kStr := string(dbutils.CompositeKeyWithoutIncarnation(k))
+				m, ok := updates[kStr]
+				if !ok {
+					m = roaring64.New()
+					updates[kStr] = m
+				}
+				m.Add(blockN)
+				return true, nil
+			}); err != nil {
+				return err
+			}
+			atomic.AddUint64(&walked, to-lastBlock)
+			return collect(updates)
+		})
+	}
+	return g.Wait()
+}
@@ -1,6 +1,7 @@
 package stagedsync
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/ledgerwatch/turbo-geth/common/changeset"
 	"github.com/ledgerwatch/turbo-geth/common/math"
 	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
@@ -18,6 +20,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 )
@@ -179,6 +182,61 @@ func TestIndexGenerator_Truncate(t *testing.T) {
 	}
 }
 
+func TestReindexHistory(t *testing.T) {
+	for _, csBucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		db := ethdb.NewMemDatabase()
+		defer db.Close()
+		indexBucket := changeset.Mapper[csBucket].IndexBucket
+
+		addrs, expected := generateTestData(t, db, csBucket, 2100)
+		if err := stages.SaveStageProgress(db, stages.Execution, 2099); err != nil {
+			t.Fatal(err)
+		}
+		// the corrupted index
+		stale := append(common.CopyBytes(dbutils.CompositeKeyWithoutIncarnation(addrs[0])), dbutils.EncodeBlockNumber(7)...)
+		if err := db.Put(indexBucket, stale, []byte{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := ReindexHistoryConfig{Shards: 4, ChunkLimit: 64}
+		if err := ReindexHistory("logPrefix", db, csBucket, cfg, getTmpDir(), nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range addrs {
+			checkIndex(t, db, indexBucket, addr, expected[string(addr)])
+		}
+
+		// the chunks of a key are ordered by the blocks, each keyed by its last block but the last one
+		var prevK []byte
+		var prevMax uint64
+		if err := db.Walk(indexBucket, nil, 0, func(k, v []byte) (bool, error) {
+			chunk := roaring64.New()
+			if _, err := chunk.ReadFrom(bytes.NewReader(v)); err != nil {
+				return false, err
+			}
+			key, suffix := k[:len(k)-8], binary.BigEndian.Uint64(k[len(k)-8:])
+			if bytes.Equal(key, prevK) && chunk.Minimum() <= prevMax {
+				t.Fatalf("chunk %x overlaps the previous one", k)
+			}
+			if suffix != ^uint64(0) && suffix != chunk.Maximum() {
+				t.Fatalf("chunk %x ends at %d", k, chunk.Maximum())
+			}
+			prevK, prevMax = common.CopyBytes(key), chunk.Maximum()
+			return true, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		progress, err := stages.GetStageProgress(db, historyIndexStages[csBucket])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress != 2099 {
+			t.Fatalf("stage progress %d", progress)
+		}
+	}
+}
+
 func generateTestData(t *testing.T, db ethdb.Database, csBucket string, numOfBlocks int) ([][]byte, map[string][]uint64) { //nolint
 	csInfo, ok := changeset.Mapper[csBucket]
 	if !ok {
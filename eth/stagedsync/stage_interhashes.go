@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"math/bits"
 	"os"
 	"sort"
@@ -26,6 +27,11 @@ import (
 	"github.com/ledgerwatch/turbo-geth/turbo/trie"
 )
 
+// ValidateTrieEvery is the period, in blocks, of the validation of the intermediate hashes updated incrementally from
+// the changesets: the trie root is recomputed from the hashed state alone, and the intermediate hashes are regenerated
+// if it differs. 0 disables the validation. var because it is set from the command-line flags
+var ValidateTrieEvery uint64
+
 func SpawnIntermediateHashesStage(s *StageState, db ethdb.Database, checkRoot bool, cache *shards.StateCache, tmpdir string, quit <-chan struct{}) (common.Hash, error) {
 	to, err := s.ExecutionAt(db)
 	if err != nil {
@@ -139,6 +145,7 @@ func RegenerateIntermediateHashes(logPrefix string, db ethdb.Database, checkRoot
 	if err := loader.Reset(trie.NewRetainList(0), accTrieCollectorFunc, stTrieCollectorFunc, false); err != nil {
 		return trie.EmptyRoot, err
 	}
+	loader.SetWorkers(0) // hash the subtries of the first nibbles on all the CPUs
 	calcStart := time.Now()
 	hash, err := loader.CalcTrieRoot(db, []byte{}, quit)
 	if err != nil {
@@ -201,19 +208,19 @@ func (p *HashPromoter) Promote(logPrefix string, s *StageState, from, to uint64,
 				return err
 			}
 			if len(v) > 0 {
-				var oldAccount accounts.Account
-				if err := oldAccount.DecodeForStorage(v); err != nil {
+				oldIncarnation, err := accounts.StorageView(v).Incarnation()
+				if err != nil {
 					return err
 				}
-				if oldAccount.Incarnation > 0 {
+				if oldIncarnation > 0 {
 					if len(newValue) == 0 { // self-destructed
 						deletedAccounts = append(deletedAccounts, newK)
 					} else { // turns incarnation to zero
-						var newAccount accounts.Account
-						if err := newAccount.DecodeForStorage(newValue); err != nil {
+						newIncarnation, err := accounts.StorageView(newValue).Incarnation()
+						if err != nil {
 							return err
 						}
-						if newAccount.Incarnation < oldAccount.Incarnation {
+						if newIncarnation < oldIncarnation {
 							deletedAccounts = append(deletedAccounts, newK)
 						}
 					}
@@ -247,6 +254,9 @@ func (p *HashPromoter) Promote(logPrefix string, s *StageState, from, to uint64,
 	if !storage { // delete Intermediate hashes of deleted accounts
 		sort.Slice(deletedAccounts, func(i, j int) bool { return bytes.Compare(deletedAccounts[i], deletedAccounts[j]) < 0 })
 		for _, k := range deletedAccounts {
+			if err := common.Stopped(p.quitCh); err != nil {
+				return err
+			}
 			if err := p.db.Walk(dbutils.TrieOfStorageBucket, k, 8*len(k), func(k, v []byte) (bool, error) {
 				return true, p.db.Delete(dbutils.TrieOfStorageBucket, k, v)
 			}); err != nil {
@@ -286,19 +296,19 @@ func (p *HashPromoter) Unwind(logPrefix string, s *StageState, u *UnwindState, s
 		}
 
 		if !storage && len(value) > 0 {
-			var oldAccount accounts.Account
-			if err = oldAccount.DecodeForStorage(value); err != nil {
+			oldIncarnation, err := accounts.StorageView(value).Incarnation()
+			if err != nil {
 				return err
 			}
-			if oldAccount.Incarnation > 0 {
+			if oldIncarnation > 0 {
 				if len(v) == 0 { // self-destructed
 					deletedAccounts = append(deletedAccounts, newK)
 				} else {
-					var newAccount accounts.Account
-					if err = newAccount.DecodeForStorage(v); err != nil {
+					newIncarnation, err := accounts.StorageView(v).Incarnation()
+					if err != nil {
 						return err
 					}
-					if newAccount.Incarnation > oldAccount.Incarnation {
+					if newIncarnation > oldIncarnation {
 						deletedAccounts = append(deletedAccounts, newK)
 					}
 				}
@@ -330,6 +340,9 @@ func (p *HashPromoter) Unwind(logPrefix string, s *StageState, u *UnwindState, s
 	if !storage { // delete Intermediate hashes of deleted accounts
 		sort.Slice(deletedAccounts, func(i, j int) bool { return bytes.Compare(deletedAccounts[i], deletedAccounts[j]) < 0 })
 		for _, k := range deletedAccounts {
+			if err := common.Stopped(p.quitCh); err != nil {
+				return err
+			}
 			if err := p.db.Walk(dbutils.TrieOfStorageBucket, k, 8*len(k), func(k, _ []byte) (bool, error) {
 				return true, p.db.Delete(dbutils.TrieOfStorageBucket, k, nil)
 			}); err != nil {
@@ -398,12 +411,24 @@ func incrementIntermediateHashes(logPrefix string, s *StageState, db ethdb.Datab
 	if err := loader.Reset(rl, accTrieCollectorFunc, stTrieCollectorFunc, false); err != nil {
 		return trie.EmptyRoot, err
 	}
+	loader.SetWorkers(0) // hash the subtries of the first nibbles on all the CPUs
 	calcStart := time.Now()
 	hash, err := loader.CalcTrieRoot(db, []byte{}, quit)
 	if err != nil {
 		return trie.EmptyRoot, err
 	}
 
+	if ValidateTrieEvery > 0 && to/ValidateTrieEvery != s.BlockNumber/ValidateTrieEvery {
+		valid, err := validateTrieRoot(logPrefix, db, hash, quit)
+		if err != nil {
+			return trie.EmptyRoot, err
+		}
+		if !valid {
+			accTrieCollector.Close(logPrefix)
+			stTrieCollector.Close(logPrefix)
+			return RegenerateIntermediateHashes(logPrefix, db, checkRoot, nil /* cache */, tmpdir, expectedRootHash, quit)
+		}
+	}
 	if checkRoot && hash != expectedRootHash {
 		return trie.EmptyRoot, fmt.Errorf("%s: wrong trie root: %x, expected (from header): %x", logPrefix, hash, expectedRootHash)
 	}
@@ -420,6 +445,30 @@ func incrementIntermediateHashes(logPrefix string, s *StageState, db ethdb.Datab
 	return hash, nil
 }
 
+// validateTrieRoot recomputes the trie root from the hashed state, none of the intermediate hashes is used, and
+// compares it with the root computed from the intermediate hashes updated incrementally
+func validateTrieRoot(logPrefix string, db ethdb.Database, root common.Hash, quit <-chan struct{}) (bool, error) {
+	log.Info(fmt.Sprintf("[%s] Validating the intermediate hashes", logPrefix), "root", root.Hex())
+	calcStart := time.Now()
+	loader := trie.NewFlatDBTrieLoader(logPrefix)
+	// All the prefixes are retained, so the hashes aren't used, and the collectors aren't called
+	if err := loader.Reset(trie.NewRetainList(math.MaxInt32), nil, nil, false); err != nil {
+		return false, err
+	}
+	loader.SetWorkers(0)
+	recomputed, err := loader.CalcTrieRoot(db, []byte{}, quit)
+	if err != nil {
+		return false, err
+	}
+	if recomputed != root {
+		log.Error(fmt.Sprintf("[%s] Intermediate hashes are inconsistent with the hashed state, regenerating them", logPrefix),
+			"root", root.Hex(), "recomputed", recomputed.Hex(), "in", time.Since(calcStart))
+		return false, nil
+	}
+	log.Info(fmt.Sprintf("[%s] Intermediate hashes are valid", logPrefix), "in", time.Since(calcStart))
+	return true, nil
+}
+
 func UnwindIntermediateHashesStage(u *UnwindState, s *StageState, db ethdb.Database, cache *shards.StateCache, tmpdir string, quit <-chan struct{}) error {
 	cache = nil
 	hash, err := rawdb.ReadCanonicalHash(db, u.UnwindPoint)
@@ -521,6 +570,7 @@ func unwindIntermediateHashesStageImpl(logPrefix string, u *UnwindState, s *Stag
 		if err := loader.Reset(rl, accTrieCollectorFunc, stTrieCollectorFunc, false); err != nil {
 			return err
 		}
+		loader.SetWorkers(0) // hash the subtries of the first nibbles on all the CPUs
 		calcStart := time.Now()
 		hash, err := loader.CalcTrieRoot(db, []byte{}, quit)
 		if err != nil {
@@ -555,6 +605,9 @@ func ResetHashState(db ethdb.Database) error {
 	if err := stages.SaveStageUnwind(batch, stages.HashState, 0); err != nil {
 		return err
 	}
+	if err := stages.SaveStageCheckpoint(batch, stages.HashState, 0); err != nil {
+		return err
+	}
 	if err := batch.Commit(); err != nil {
 		return err
 	}
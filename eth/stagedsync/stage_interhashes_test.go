@@ -6,9 +6,11 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/turbo/trie"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func addTestAccount(db ethdb.Putter, hash common.Hash, balance uint64) error {
@@ -63,3 +65,42 @@ func TestTrieOfAccountsLayout(t *testing.T) {
 	assert.Equal(t, uint16(0b00000), hasTree2)
 	assert.Equal(t, uint16(0b10000), hasHash2)
 }
+
+func TestValidateTrieRoot(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, addTestAccount(db, common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(i >> 8)})), uint64(i+1)))
+	}
+	root, err := RegenerateIntermediateHashes("IH", db, false /* checkRoot */, nil /* cache */, getTmpDir(), common.Hash{} /* expectedRootHash */, nil /* quit */)
+	require.NoError(t, err)
+	valid, err := validateTrieRoot("IH", db, root, nil)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	// Corrupt one of the intermediate hashes, the root computed from them is wrong then
+	var corruptedKey, corrupted []byte
+	require.NoError(t, db.Walk(dbutils.TrieOfAccountsBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if _, _, hasHash, _, _ := trie.UnmarshalTrieNode(v); hasHash == 0 {
+			return true, nil
+		}
+		corruptedKey, corrupted = common.CopyBytes(k), common.CopyBytes(v)
+		corrupted[len(corrupted)-1] ^= 0xff
+		return false, nil
+	}))
+	require.NotNil(t, corruptedKey)
+	require.NoError(t, db.Put(dbutils.TrieOfAccountsBucket, corruptedKey, corrupted))
+	loader := trie.NewFlatDBTrieLoader("IH")
+	require.NoError(t, loader.Reset(trie.NewRetainList(0), nil, nil, false))
+	corruptedRoot, err := loader.CalcTrieRoot(db, []byte{}, nil)
+	require.NoError(t, err)
+	require.NotEqual(t, root, corruptedRoot)
+
+	// The validation doesn't use the intermediate hashes
+	valid, err = validateTrieRoot("IH", db, root, nil)
+	require.NoError(t, err)
+	require.True(t, valid)
+	valid, err = validateTrieRoot("IH", db, corruptedRoot, nil)
+	require.NoError(t, err)
+	require.False(t, valid)
+}
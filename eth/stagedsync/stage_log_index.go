@@ -87,6 +87,9 @@ func promoteLogIndex(logPrefix string, db ethdb.Database, start uint64, bufLimit
 
 	collectorTopics := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
 	collectorAddrs := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	topicsMemory, addrsMemory := etl.Memory.NewReservation(), etl.Memory.NewReservation()
+	defer topicsMemory.ReleaseAll()
+	defer addrsMemory.ReleaseAll()
 
 	reader := bytes.NewReader(nil)
 
@@ -107,18 +110,20 @@ func promoteLogIndex(logPrefix string, db ethdb.Database, start uint64, bufLimit
 			runtime.ReadMemStats(&m)
 			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum, "alloc", common.StorageSize(m.Alloc), "sys", common.StorageSize(m.Sys))
 		case <-checkFlushEvery.C:
-			if needFlush(topics, bufLimit) {
+			if needFlush(topics, bufLimit, topicsMemory) {
 				if err := flushBitmaps(collectorTopics, topics); err != nil {
 					return err
 				}
 				topics = map[string]*roaring.Bitmap{}
+				topicsMemory.ReleaseAll()
 			}
 
-			if needFlush(addresses, bufLimit) {
+			if needFlush(addresses, bufLimit, addrsMemory) {
 				if err := flushBitmaps(collectorAddrs, addresses); err != nil {
 					return err
 				}
 				addresses = map[string]*roaring.Bitmap{}
+				addrsMemory.ReleaseAll()
 			}
 		}
 
@@ -156,11 +161,26 @@ func promoteLogIndex(logPrefix string, db ethdb.Database, start uint64, bufLimit
 		return err
 	}
 
+	loaderFunc := chunkedBitmapsLoadFunc(logPrefix)
+	if err := collectorTopics.Load(logPrefix, db, dbutils.LogTopicIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
+
+	if err := collectorAddrs.Load(logPrefix, db, dbutils.LogAddressIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// chunkedBitmapsLoadFunc merges the collected bitmaps of the blocks with the last chunks of their keys in the bucket
+// and writes them back as the chunks keyed by their last blocks
+func chunkedBitmapsLoadFunc(logPrefix string) etl.LoadFunc {
 	var currentBitmap = roaring.New()
 	var buf = bytes.NewBuffer(nil)
 
 	lastChunkKey := make([]byte, 128)
-	var loaderFunc = func(k []byte, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
+	return func(k []byte, v []byte, table etl.CurrentTableReader, next etl.LoadNextFunc) error {
 		lastChunkKey = lastChunkKey[:len(k)+4]
 		copy(lastChunkKey, k)
 		binary.BigEndian.PutUint32(lastChunkKey[len(k):], ^uint32(0))
@@ -189,16 +209,6 @@ func promoteLogIndex(logPrefix string, db ethdb.Database, start uint64, bufLimit
 			return next(k, chunkKey, buf.Bytes())
 		})
 	}
-
-	if err := collectorTopics.Load(logPrefix, db, dbutils.LogTopicIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
-		return err
-	}
-
-	if err := collectorAddrs.Load(logPrefix, db, dbutils.LogAddressIndex, loaderFunc, etl.TransformArgs{Quit: quit}); err != nil {
-		return err
-	}
-
-	return nil
 }
 
 func UnwindLogIndex(u *UnwindState, s *StageState, db ethdb.Database, quitCh <-chan struct{}) error {
@@ -268,13 +278,19 @@ func unwindLogIndex(logPrefix string, db ethdb.Database, to uint64, quitCh <-cha
 	return nil
 }
 
-func needFlush(bitmaps map[string]*roaring.Bitmap, memLimit datasize.ByteSize) bool {
+// needFlush accounts the memory used by the bitmaps in the reservation and returns whether they
+// must be flushed, either because they outgrew memLimit or because the global memory limit is exceeded
+func needFlush(bitmaps map[string]*roaring.Bitmap, memLimit datasize.ByteSize, memory *etl.Reservation) bool {
 	sz := uint64(0)
 	for _, m := range bitmaps {
 		sz += m.GetSizeInBytes()
 	}
 	const memoryNeedsForKey = 32 * 2 // each key stored in RAM: as string ang slice of bytes
-	return uint64(len(bitmaps)*memoryNeedsForKey)+sz > uint64(memLimit)
+	sz += uint64(len(bitmaps) * memoryNeedsForKey)
+	if held := memory.Held(); sz > held {
+		memory.Grow(sz - held)
+	}
+	return sz > uint64(memLimit) || memory.Exceeded()
 }
 
 func flushBitmaps(c *etl.Collector, inMem map[string]*roaring.Bitmap) error {
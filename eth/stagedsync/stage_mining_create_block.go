@@ -8,10 +8,12 @@ import (
 	"time"
 
 	mapset "github.com/deckarep/golang-set"
+	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
@@ -54,7 +56,7 @@ func SpawnMiningCreateBlockStage(s *StageState, tx ethdb.Database, current *mini
 	if parent == nil { // todo: how to return error and don't stop TG?
 		return fmt.Errorf(fmt.Sprintf("[%s] Empty block", logPrefix), "blocknum", executionAt)
 	}
-	signer := types.NewEIP155Signer(chainConfig.ChainID)
+	signer := types.LatestSigner(chainConfig)
 
 	blockNum := executionAt + 1
 
@@ -98,14 +100,20 @@ func SpawnMiningCreateBlockStage(s *StageState, tx ethdb.Database, current *mini
 	if parent.Time >= uint64(timestamp) {
 		timestamp = int64(parent.Time + 1)
 	}
-	num := parent.Number
 	header := &types.Header{
 		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
 		GasLimit:   core.CalcGasLimit(parent.GasUsed, parent.GasLimit, gasFloor, gasCeil),
 		Extra:      extra,
 		Time:       uint64(timestamp),
 	}
+	// Set the base fee, and double the gas limit at the fork block to keep the gas target
+	if chainConfig.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(chainConfig, parent)
+		if !chainConfig.IsLondon(parent.Number) {
+			header.GasLimit = core.CalcGasLimit(parent.GasUsed, parent.GasLimit*chainConfig.ElasticityMultiplier(header.Number), gasFloor, gasCeil)
+		}
+	}
 
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
 	//if w.isRunning() {
@@ -219,8 +227,12 @@ func SpawnMiningCreateBlockStage(s *StageState, tx ethdb.Database, current *mini
 			localTxs[account] = txs
 		}
 	}
-	current.localTxs = types.NewTransactionsByPriceAndNonce(signer, localTxs)
-	current.remoteTxs = types.NewTransactionsByPriceAndNonce(signer, remoteTxs)
+	var baseFee *uint256.Int
+	if header.BaseFee != nil {
+		baseFee, _ = uint256.FromBig(header.BaseFee)
+	}
+	current.localTxs = types.NewTransactionsByPriceAndNonce(signer, localTxs, baseFee)
+	current.remoteTxs = types.NewTransactionsByPriceAndNonce(signer, remoteTxs, baseFee)
 	s.Done()
 	return nil
 }
@@ -67,7 +67,7 @@ func SpawnMiningExecStage(s *StageState, tx ethdb.Database, current *miningBlock
 		}
 	}
 
-	if err := core.FinalizeBlockExecution(engine, current.Header, current.Txs, current.Uncles, stateWriter, chainConfig, ibs); err != nil {
+	if err := core.FinalizeBlockExecution(engine, cc.GetHeader, current.Header, current.Txs, current.Uncles, stateWriter, chainConfig, ibs); err != nil {
 		return err
 	}
 
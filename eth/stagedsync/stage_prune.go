@@ -0,0 +1,137 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// PruneBatchSize is the maximal number of the records the Prune stage deletes from a bucket in one cycle, the rest is
+// deleted by the next cycles, so that catching up with a new or a shortened retention window doesn't stall the sync
+var PruneBatchSize = 100_000
+
+// Retention makes the Prune stage keep the records of a bucket only for the last Blocks executed blocks
+type Retention struct {
+	Bucket string
+	Blocks uint64
+}
+
+// RetainableBuckets are the buckets a retention window can be declared for: their keys start with the big-endian
+// block number, and the records of the old blocks are not needed by the sync itself
+var RetainableBuckets = map[string]struct{}{
+	dbutils.BlockReceiptsPrefix: {},
+	dbutils.Log:                 {},
+	dbutils.BlockWitness:        {},
+}
+
+// ParseRetentions parses the comma separated list of the retention windows in the form bucket=blocks
+func ParseRetentions(flag string) ([]Retention, error) {
+	var retentions []Retention
+	for _, item := range strings.Split(flag, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retention %q, expected bucket=blocks", item)
+		}
+		if _, ok := RetainableBuckets[parts[0]]; !ok {
+			return nil, fmt.Errorf("retention can not be declared for the bucket %q", parts[0])
+		}
+		blocks, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil || blocks == 0 {
+			return nil, fmt.Errorf("invalid number of blocks to retain in %q", item)
+		}
+		retentions = append(retentions, Retention{Bucket: parts[0], Blocks: blocks})
+	}
+	return retentions, nil
+}
+
+// SpawnPruneStage deletes the records of the blocks outside of the retention windows of the buckets. The progress is
+// tracked per bucket, so the windows can be declared, changed and removed independently.
+func SpawnPruneStage(s *StageState, db ethdb.Database, retentions []Retention, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	executionAt, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	for _, r := range retentions {
+		if executionAt < r.Blocks {
+			continue
+		}
+		if err = pruneBucket(logPrefix, tx, r.Bucket, executionAt-r.Blocks+1, quit); err != nil {
+			return fmt.Errorf("%s: pruning %s: %w", logPrefix, r.Bucket, err)
+		}
+	}
+
+	if err = s.DoneAndUpdate(tx, executionAt); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneBucket deletes up to PruneBatchSize records of the blocks before the given one
+func pruneBucket(logPrefix string, tx ethdb.Database, bucket string, keepFrom uint64, quit <-chan struct{}) error {
+	prunedTo, err := stages.GetPruneProgress(tx, bucket)
+	if err != nil {
+		return err
+	}
+	if prunedTo >= keepFrom {
+		return nil
+	}
+	var keys [][]byte
+	if err = tx.Walk(bucket, dbutils.EncodeBlockNumber(prunedTo), 0, func(k, _ []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		blockNum := binary.BigEndian.Uint64(k)
+		if blockNum >= keepFrom {
+			return false, nil
+		}
+		if len(keys) >= PruneBatchSize {
+			// The rest of the blocks are pruned by the next cycle
+			keepFrom = blockNum
+			return false, nil
+		}
+		keys = append(keys, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = tx.Delete(bucket, k, nil); err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		log.Info(fmt.Sprintf("[%s] Pruned", logPrefix), "bucket", bucket, "records", len(keys), "before block", keepFrom)
+	}
+	return stages.SavePruneProgress(tx, bucket, keepFrom)
+}
@@ -0,0 +1,75 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	for blockNum := uint64(1); blockNum <= 100; blockNum++ {
+		require.NoError(t, tx.Put(dbutils.BlockWitness, dbutils.EncodeBlockNumber(blockNum), []byte{1}))
+		require.NoError(t, tx.Put(dbutils.BlockReceiptsPrefix, dbutils.EncodeBlockNumber(blockNum), []byte{1}))
+	}
+	require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, 100))
+
+	retentions, err := ParseRetentions("block_witness=10, r=95")
+	require.NoError(t, err)
+	defer func(batchSize int) { PruneBatchSize = batchSize }(PruneBatchSize)
+	PruneBatchSize = 50
+
+	count := func(bucket string) (first uint64, n int) {
+		require.NoError(t, tx.Walk(bucket, nil, 0, func(k, _ []byte) (bool, error) {
+			if n == 0 {
+				first = binary.BigEndian.Uint64(k)
+			}
+			n++
+			return true, nil
+		}))
+		return first, n
+	}
+
+	// The witnesses are pruned in two batches, the receipts at once
+	require.NoError(t, SpawnPruneStage(&StageState{Stage: stages.Prune}, tx, retentions, nil))
+	first, n := count(dbutils.BlockWitness)
+	assert.Equal(t, uint64(51), first)
+	assert.Equal(t, 50, n)
+	first, n = count(dbutils.BlockReceiptsPrefix)
+	assert.Equal(t, uint64(6), first)
+	assert.Equal(t, 95, n)
+
+	require.NoError(t, SpawnPruneStage(&StageState{Stage: stages.Prune}, tx, retentions, nil))
+	first, n = count(dbutils.BlockWitness)
+	assert.Equal(t, uint64(91), first)
+	assert.Equal(t, 10, n)
+	prunedTo, err := stages.GetPruneProgress(tx, dbutils.BlockWitness)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(91), prunedTo)
+
+	// The window moves with the executed blocks
+	require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, 105))
+	require.NoError(t, SpawnPruneStage(&StageState{Stage: stages.Prune}, tx, retentions, nil))
+	first, n = count(dbutils.BlockWitness)
+	assert.Equal(t, uint64(96), first)
+	assert.Equal(t, 5, n)
+	progress, err := stages.GetStageProgress(tx, stages.Prune)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(105), progress)
+
+	for _, flag := range []string{"block_witness", "PLAIN-CST2=10", "log=0", "log=x"} {
+		_, err = ParseRetentions(flag)
+		assert.Error(t, err, flag)
+	}
+}
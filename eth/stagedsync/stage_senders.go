@@ -91,17 +91,29 @@ func SpawnRecoverSendersStage(cfg Stage3Config, s *StageState, db ethdb.Database
 	}
 
 	collectorSenders := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	// The bodies waiting for the recovery are accounted in the shared memory budget. When it's
+	// exceeded, new bodies wait for the recovered ones, shrinking the batch down to a single body
+	batchMemory := etl.Memory.NewReservation()
+	defer batchMemory.ReleaseAll()
 
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 	go func() {
 		defer close(errCh)
+		// Keep draining the results after an error, otherwise the recovery goroutines block
+		// on the full channel and wg.Wait() never returns
+		defer func() {
+			for j := range out {
+				batchMemory.Release(j.size)
+			}
+		}()
 		for j := range out {
+			batchMemory.Release(j.size)
 			if j.err != nil {
 				errCh <- j.err
 				return
 			}
 			if err := common.Stopped(quitCh); err != nil {
-				errCh <- j.err
+				errCh <- err
 				return
 			}
 			select {
@@ -114,7 +126,7 @@ func SpawnRecoverSendersStage(cfg Stage3Config, s *StageState, db ethdb.Database
 			binary.BigEndian.PutUint32(k, uint32(j.index))
 			index := int(binary.BigEndian.Uint32(k))
 			if err := collectorSenders.Collect(dbutils.BlockBodyKey(s.BlockNumber+uint64(index)+1, canonical[index]), j.senders); err != nil {
-				errCh <- j.err
+				errCh <- err
 				return
 			}
 		}
@@ -136,13 +148,20 @@ func SpawnRecoverSendersStage(cfg Stage3Config, s *StageState, db ethdb.Database
 			return true, nil
 		}
 		body := rawdb.ReadBody(db, blockHash, blockNumber)
+		size := uint64(len(v) + len(body.Transactions)*common.AddressLength)
+		for _, tx := range body.Transactions {
+			size += uint64(tx.Size())
+		}
+		if err := batchMemory.Wait(size, quitCh); err != nil {
+			return false, err
+		}
 
 		select {
 		case err := <-errCh:
 			if err != nil {
 				return false, err
 			}
-		case jobs <- &senderRecoveryJob{body: body, key: k, blockNumber: blockNumber, index: int(blockNumber - s.BlockNumber - 1)}:
+		case jobs <- &senderRecoveryJob{body: body, key: k, blockNumber: blockNumber, index: int(blockNumber - s.BlockNumber - 1), size: size}:
 		}
 
 		return true, nil
@@ -180,6 +199,7 @@ type senderRecoveryJob struct {
 	key         []byte
 	blockNumber uint64
 	index       int
+	size        uint64 // memory accounted for the job
 	senders     []byte
 	err         error
 }
@@ -0,0 +1,106 @@
+package stagedsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/slotwatch"
+)
+
+// SpawnSlotWatchStage evaluates the watches against the storage changes of the executed blocks. The value of a slot
+// after a block is the previous value recorded by its next change, or the current value for the last change, so
+// neither the history index nor the re-execution is needed.
+func SpawnSlotWatchStage(s *StageState, db ethdb.Database, watcher *slotwatch.Watcher, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	executionAt, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	if executionAt <= s.BlockNumber {
+		s.Done()
+		return nil
+	}
+
+	type slotChange struct {
+		block uint64
+		key   []byte
+	}
+	// Storage keys with the incarnations of the changes of the watched slots, in the order of the blocks
+	var changed []slotChange
+	prevValues := make(map[string][][]byte)
+	if err = changeset.Walk(tx, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(s.BlockNumber+1), 0, func(blockN uint64, k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		if blockN > executionAt {
+			return false, nil
+		}
+		if !watcher.Watched(common.BytesToAddress(k[:common.AddressLength]), common.BytesToHash(k[common.AddressLength+common.IncarnationLength:])) {
+			return true, nil
+		}
+		key := common.CopyBytes(k)
+		changed = append(changed, slotChange{block: blockN, key: key})
+		prevValues[string(key)] = append(prevValues[string(key)], common.CopyBytes(v))
+		return true, nil
+	}); err != nil {
+		return fmt.Errorf("%s: walking storage changesets: %w", logPrefix, err)
+	}
+
+	changes := make([]slotwatch.Change, 0, len(changed))
+	seen := make(map[string]int, len(prevValues))
+	for _, c := range changed {
+		n := seen[string(c.key)] + 1
+		seen[string(c.key)] = n
+		var value []byte
+		if prev := prevValues[string(c.key)]; n < len(prev) {
+			value = prev[n]
+		} else if value, err = tx.Get(dbutils.PlainStateBucket, c.key); err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		changes = append(changes, slotwatch.Change{
+			Block:    c.block,
+			Contract: common.BytesToAddress(c.key[:common.AddressLength]),
+			Slot:     common.BytesToHash(c.key[common.AddressLength+common.IncarnationLength:]),
+			Value:    new(uint256.Int).SetBytes(value),
+		})
+	}
+	if err = watcher.Apply(tx, changes); err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+
+	if err = s.DoneAndUpdate(tx, executionAt); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnwindSlotWatchStage only moves the progress back, the alerts already fired are not retracted and the re-executed
+// blocks are evaluated against the persisted alert states
+func UnwindSlotWatchStage(u *UnwindState, db ethdb.Database) error {
+	return u.Done(db)
+}
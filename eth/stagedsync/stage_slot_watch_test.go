@@ -0,0 +1,59 @@
+package stagedsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/slotwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotWatchStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	contract := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	slot, other := common.HexToHash("0x01"), common.HexToHash("0x02")
+	values := []uint64{0, 150, 50, 80, 120}
+	execute := func(to uint64) {
+		from, err := stages.GetStageProgress(tx, stages.Execution)
+		require.NoError(t, err)
+		for blockNum := from + 1; blockNum <= to; blockNum++ {
+			w := state.NewPlainStateWriter(tx, tx, blockNum)
+			require.NoError(t, w.WriteAccountStorage(context.Background(), contract, 1, &slot, uint256.NewInt().SetUint64(values[blockNum-1]), uint256.NewInt().SetUint64(values[blockNum])))
+			require.NoError(t, w.WriteAccountStorage(context.Background(), contract, 1, &other, uint256.NewInt().SetUint64(blockNum-1), uint256.NewInt().SetUint64(blockNum)))
+			require.NoError(t, w.WriteChangeSets())
+		}
+		require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, to))
+	}
+
+	watches, err := slotwatch.ParseWatches([]byte(`[{"name": "low", "contract": "0x1000000000000000000000000000000000000001", "slot": "0x0000000000000000000000000000000000000000000000000000000000000001", "condition": "below", "value": "100"}]`))
+	require.NoError(t, err)
+	watcher := slotwatch.NewWatcher(watches, "")
+
+	// The value of the slot after the block 2 is 50, and 80 after the block 3
+	execute(3)
+	require.NoError(t, SpawnSlotWatchStage(&StageState{Stage: stages.SlotWatch}, tx, watcher, nil))
+	alert, err := slotwatch.ReadAlertState(tx, "low")
+	require.NoError(t, err)
+	assert.Equal(t, &slotwatch.AlertState{Triggered: true, Block: 2, Value: uint256.NewInt().SetUint64(50)}, alert)
+
+	// The value after the last block is the current one
+	execute(4)
+	require.NoError(t, SpawnSlotWatchStage(&StageState{Stage: stages.SlotWatch, BlockNumber: 3}, tx, watcher, nil))
+	alert, err = slotwatch.ReadAlertState(tx, "low")
+	require.NoError(t, err)
+	assert.Equal(t, &slotwatch.AlertState{Triggered: false, Block: 4, Value: uint256.NewInt().SetUint64(120)}, alert)
+	progress, err := stages.GetStageProgress(tx, stages.SlotWatch)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), progress)
+}
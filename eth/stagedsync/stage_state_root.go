@@ -0,0 +1,118 @@
+package stagedsync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/ledgerwatch/turbo-geth/turbo/verkle"
+)
+
+// SpawnStateRootStage takes the place of the intermediate hashes on the chains whose state root is committed to by
+// one of the experimental schemes (params.VerkleStateCommitment, params.BinaryStateCommitment). There are no
+// intermediate hashes of them, the root is computed from scratch every cycle: the verkle tree is built in memory from
+// the plain state, as its keys are derived from the plain addresses, the binary trie is folded from the hashed state.
+// This is only fit for the small states of the devnets.
+func SpawnStateRootStage(s *StageState, db ethdb.Database, chainConfig *params.ChainConfig, checkRoot bool, quit <-chan struct{}) (common.Hash, error) {
+	to, err := s.ExecutionAt(db)
+	if err != nil {
+		return trie.EmptyRoot, err
+	}
+	if s.BlockNumber == to {
+		s.Done()
+		return trie.EmptyRoot, nil
+	}
+
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return trie.EmptyRoot, err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	log.Info(fmt.Sprintf("[%s] Computing %s root", logPrefix, chainConfig.StateCommitment), "from", s.BlockNumber, "to", to)
+	root, err := checkStateRoot(logPrefix, tx, chainConfig, to, checkRoot, quit)
+	if err != nil {
+		return trie.EmptyRoot, err
+	}
+	if err = s.DoneAndUpdate(tx, to); err != nil {
+		return trie.EmptyRoot, err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return trie.EmptyRoot, err
+		}
+	}
+	return root, nil
+}
+
+// UnwindStateRootStage checks the root of the unwound state, there is nothing stored to unwind
+func UnwindStateRootStage(u *UnwindState, s *StageState, db ethdb.Database, chainConfig *params.ChainConfig, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	if _, err := checkStateRoot(logPrefix, tx, chainConfig, u.UnwindPoint, true, quit); err != nil {
+		return err
+	}
+	if err := u.Done(tx); err != nil {
+		return fmt.Errorf("%s: reset: %w", logPrefix, err)
+	}
+	if !useExternalTx {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkStateRoot(logPrefix string, tx ethdb.Database, chainConfig *params.ChainConfig, blockNum uint64, checkRoot bool, quit <-chan struct{}) (common.Hash, error) {
+	var root common.Hash
+	var err error
+	if chainConfig.IsVerkle() {
+		root, err = verkle.ComputeRoot(tx.(ethdb.HasTx).Tx(), quit)
+	} else {
+		root, err = trie.CalcBinaryRoot(tx.(ethdb.HasTx).Tx(), quit)
+	}
+	if err != nil {
+		return trie.EmptyRoot, fmt.Errorf("%s: %w", logPrefix, err)
+	}
+	if !checkRoot {
+		return root, nil
+	}
+	hash, err := rawdb.ReadCanonicalHash(tx, blockNum)
+	if err != nil {
+		return trie.EmptyRoot, err
+	}
+	header := rawdb.ReadHeader(tx, hash, blockNum)
+	if header == nil {
+		return trie.EmptyRoot, fmt.Errorf("%s: header %d not found", logPrefix, blockNum)
+	}
+	if root != header.Root {
+		return trie.EmptyRoot, fmt.Errorf("%s: wrong %s root: %x, expected (from header): %x", logPrefix, chainConfig.StateCommitment, root, header.Root)
+	}
+	return root, nil
+}
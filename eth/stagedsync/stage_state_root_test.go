@@ -0,0 +1,162 @@
+package stagedsync_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/trie"
+	"github.com/ledgerwatch/turbo-geth/turbo/verkle"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerkleChain(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	contract := crypto.CreateAddress(sender, 0)
+	config := *params.TestChainConfig
+	config.StateCommitment = params.VerkleStateCommitment
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	// The contract incrementing its slot 0, called in block 2
+	code := common.FromHex("0x600054600101600055")
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			initCode := append(common.FromHex("0x6009600c60003960096000f3"), code...)
+			tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), initCode)
+		case 1:
+			tx = types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(), 100000, uint256.NewInt(), nil)
+		default:
+			tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+		}
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	require.NoError(t, err)
+
+	sm := ethdb.DefaultStorageMode
+	sm.Witnesses = true
+	for _, block := range blocks {
+		// The roots of the headers are the verkle roots, checked by the stage
+		_, err = stagedsync.InsertBlocksInStages(db, sm, gspec.Config, &vm.Config{}, ethash.NewFaker(), []*types.Block{block}, true /* checkRoot */)
+		require.NoError(t, err)
+	}
+
+	tree := verkle.NewTree()
+	nonceKey := verkle.TreeKey(sender, new(big.Int), verkle.NonceLeafKey)
+	slotKey := tree.StorageKey(contract, common.Hash{})
+	for _, block := range blocks[1:] {
+		blockNum := block.NumberU64()
+		enc, err := rawdb.ReadBlockWitness(db, blockNum)
+		require.NoError(t, err)
+		require.NotNil(t, enc, "block %d", blockNum)
+		proof, err := verkle.NewProofFromReader(bytes.NewReader(enc))
+		require.NoError(t, err)
+		parent := rawdb.ReadHeader(db, block.ParentHash(), blockNum-1)
+		require.NoError(t, proof.Verify(parent.Root), "block %d", blockNum)
+
+		values := make(map[string][]byte)
+		for i, k := range proof.Keys {
+			values[string(k)] = proof.Values[i]
+		}
+		// The sender is in the witness as of before the block
+		require.NotNil(t, values[string(nonceKey)], "block %d", blockNum)
+		require.Equal(t, blockNum-1, binary.LittleEndian.Uint64(values[string(nonceKey)]))
+		if blockNum == 2 {
+			// The slot incremented by the block is absent before it
+			v, ok := values[string(slotKey)]
+			require.True(t, ok)
+			require.Nil(t, v)
+		}
+	}
+}
+
+func TestBinaryTrieChain(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	contract := crypto.CreateAddress(sender, 0)
+	config := *params.TestChainConfig
+	config.StateCommitment = params.BinaryStateCommitment
+	gspec := &core.Genesis{
+		Config: &config,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	code := common.FromHex("0x600054600101600055")
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			initCode := append(common.FromHex("0x6009600c60003960096000f3"), code...)
+			tx = types.NewContractCreation(b.TxNonce(sender), uint256.NewInt(), 100000, uint256.NewInt(), initCode)
+		case 1:
+			tx = types.NewTransaction(b.TxNonce(sender), contract, uint256.NewInt(), 100000, uint256.NewInt(), nil)
+		default:
+			tx = types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil)
+		}
+		tx, err := types.SignTx(tx, signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	require.NoError(t, err)
+
+	sm := ethdb.DefaultStorageMode
+	sm.Witnesses = true
+	for _, block := range blocks {
+		// The roots of the headers are the binary trie roots, checked by the stage
+		_, err = stagedsync.InsertBlocksInStages(db, sm, gspec.Config, &vm.Config{}, ethash.NewFaker(), []*types.Block{block}, true /* checkRoot */)
+		require.NoError(t, err)
+	}
+
+	senderHash, contractHash := crypto.Keccak256Hash(sender[:]), crypto.Keccak256Hash(contract[:])
+	for _, block := range blocks[1:] {
+		blockNum := block.NumberU64()
+		enc, err := rawdb.ReadBlockWitness(db, blockNum)
+		require.NoError(t, err)
+		require.NotNil(t, enc, "block %d", blockNum)
+		parent := rawdb.ReadHeader(db, block.ParentHash(), blockNum-1)
+		proof, err := trie.VerifyBinaryProof(parent.Root, enc)
+		require.NoError(t, err, "block %d", blockNum)
+
+		// The sender is in the witness as of before the block
+		acc, err := proof.Account(senderHash)
+		require.NoError(t, err)
+		require.NotNil(t, acc, "block %d", blockNum)
+		require.Equal(t, blockNum-1, acc.Nonce)
+		if blockNum == 2 {
+			// The slot incremented by the block is absent before it, the code of the contract is in the witness
+			v, err := proof.Storage(contractHash, crypto.Keccak256Hash(common.Hash{}.Bytes()))
+			require.NoError(t, err)
+			require.Nil(t, v)
+			require.Equal(t, code, proof.Codes[crypto.Keccak256Hash(code)])
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package stagedsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/tokens"
+)
+
+// SpawnTokenTransfersStage indexes the blocks of the ERC-20 and the ERC-721 transfers by the senders and the
+// recipients of the tokens, parsed from the logs the execution writes with the receipts
+func SpawnTokenTransfersStage(s *StageState, db ethdb.Database, tmpdir string, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	endBlock, err := s.ExecutionAt(tx)
+	if err != nil {
+		return fmt.Errorf("%s: getting last executed block: %w", logPrefix, err)
+	}
+	if endBlock <= s.BlockNumber {
+		s.Done()
+		return nil
+	}
+
+	start := s.BlockNumber
+	if start > 0 {
+		start++
+	}
+	if err = promoteTokenTransfers(logPrefix, tx, start, bitmapsBufLimit, bitmapsFlushEvery, tmpdir, quit); err != nil {
+		return err
+	}
+
+	if err = s.DoneAndUpdate(tx, endBlock); err != nil {
+		return err
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteTokenTransfers(logPrefix string, db ethdb.Database, start uint64, bufLimit datasize.ByteSize, flushEvery time.Duration, tmpdir string, quit <-chan struct{}) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	checkFlushEvery := time.NewTicker(flushEvery)
+	defer checkFlushEvery.Stop()
+
+	addresses := map[string]*roaring.Bitmap{}
+	collector := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	memory := etl.Memory.NewReservation()
+	defer memory.ReleaseAll()
+
+	logs := db.(ethdb.HasTx).Tx().Cursor(dbutils.Log)
+	defer logs.Close()
+	reader := bytes.NewReader(nil)
+	for k, v, err := logs.Seek(dbutils.LogKey(start, 0)); k != nil; k, v, err = logs.Next() {
+		if err != nil {
+			return err
+		}
+		if err := common.Stopped(quit); err != nil {
+			return err
+		}
+		blockNum := binary.BigEndian.Uint64(k[:8])
+
+		select {
+		default:
+		case <-logEvery.C:
+			log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "number", blockNum)
+		case <-checkFlushEvery.C:
+			if needFlush(addresses, bufLimit, memory) {
+				if err := flushBitmaps(collector, addresses); err != nil {
+					return err
+				}
+				addresses = map[string]*roaring.Bitmap{}
+				memory.ReleaseAll()
+			}
+		}
+
+		var ll types.Logs
+		reader.Reset(v)
+		if err := cbor.Unmarshal(&ll, reader); err != nil {
+			return fmt.Errorf("%s: receipt unmarshal failed: %w, block=%d", logPrefix, err, blockNum)
+		}
+		for _, l := range ll {
+			transfer := tokens.ParseTransfer(l)
+			if transfer == nil {
+				continue
+			}
+			for _, address := range []common.Address{transfer.From, transfer.To} {
+				m, ok := addresses[string(address[:])]
+				if !ok {
+					m = roaring.New()
+					addresses[string(address[:])] = m
+				}
+				m.Add(uint32(blockNum))
+			}
+		}
+	}
+
+	if err := flushBitmaps(collector, addresses); err != nil {
+		return err
+	}
+	return collector.Load(logPrefix, db, dbutils.TokenTransferIndex, chunkedBitmapsLoadFunc(logPrefix), etl.TransformArgs{Quit: quit})
+}
+
+// UnwindTokenTransfersStage truncates the indices of the addresses of the transfers in the unwound blocks, it goes
+// before the unwind of the execution, which deletes their logs
+func UnwindTokenTransfersStage(u *UnwindState, s *StageState, db ethdb.Database, quit <-chan struct{}) error {
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		var err error
+		tx, err = db.Begin(context.Background(), ethdb.RW)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	logPrefix := s.state.LogPrefix()
+	if err := unwindTokenTransfers(logPrefix, tx, u.UnwindPoint, quit); err != nil {
+		return err
+	}
+
+	if err := u.Done(tx); err != nil {
+		return fmt.Errorf("%s: %w", logPrefix, err)
+	}
+	if !useExternalTx {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unwindTokenTransfers(logPrefix string, db ethdb.Database, to uint64, quit <-chan struct{}) error {
+	addresses := map[string]struct{}{}
+	if err := db.Walk(dbutils.Log, dbutils.EncodeBlockNumber(to+1), 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(quit); err != nil {
+			return false, err
+		}
+		var ll types.Logs
+		if err := cbor.Unmarshal(&ll, bytes.NewReader(v)); err != nil {
+			return false, fmt.Errorf("%s: receipt unmarshal failed: %w, block=%d", logPrefix, err, binary.BigEndian.Uint64(k))
+		}
+		for _, l := range ll {
+			if transfer := tokens.ParseTransfer(l); transfer != nil {
+				addresses[string(transfer.From[:])] = struct{}{}
+				addresses[string(transfer.To[:])] = struct{}{}
+			}
+		}
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	return truncateBitmaps(db, dbutils.TokenTransferIndex, addresses, to)
+}
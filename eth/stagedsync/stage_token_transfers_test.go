@@ -0,0 +1,60 @@
+package stagedsync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/tokens"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenTransfersStage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	token, alice, bob, carol := common.Address{1}, common.Address{0xa}, common.Address{0xb}, common.Address{0xc}
+	erc20 := func(from, to common.Address) *types.Log {
+		return &types.Log{Address: token, Topics: []common.Hash{tokens.TransferTopic, from.Hash(), to.Hash()}, Data: make([]byte, 32)}
+	}
+	erc721 := func(from, to common.Address) *types.Log {
+		return &types.Log{Address: token, Topics: []common.Hash{tokens.TransferTopic, from.Hash(), to.Hash(), common.HexToHash("0x01")}}
+	}
+	for blockNum, logs := range [][]*types.Log{
+		1: {erc20(alice, bob)},
+		// The other events and the malformed transfers are not indexed
+		2: {{Address: token, Topics: []common.Hash{common.HexToHash("0x01"), alice.Hash()}}, {Address: token, Topics: []common.Hash{tokens.TransferTopic, carol.Hash(), bob.Hash()}}},
+		3: {erc721(bob, carol)},
+	} {
+		if blockNum > 0 {
+			require.NoError(t, rawdb.AppendReceipts(tx, uint64(blockNum), types.Receipts{{Logs: logs}}))
+		}
+	}
+	require.NoError(t, stages.SaveStageProgress(tx, stages.Execution, 3))
+
+	blocks := func(address common.Address) []uint32 {
+		m, err := bitmapdb.Get(tx, dbutils.TokenTransferIndex, address[:], 0, 10)
+		require.NoError(t, err)
+		return m.ToArray()
+	}
+	require.NoError(t, SpawnTokenTransfersStage(&StageState{Stage: stages.TokenTransfers}, tx, "", nil))
+	require.Equal(t, []uint32{1}, blocks(alice))
+	require.Equal(t, []uint32{1, 3}, blocks(bob))
+	require.Equal(t, []uint32{3}, blocks(carol))
+
+	require.NoError(t, UnwindTokenTransfersStage(&UnwindState{Stage: stages.TokenTransfers, UnwindPoint: 2}, &StageState{Stage: stages.TokenTransfers, BlockNumber: 3}, tx, nil))
+	require.Equal(t, []uint32{1}, blocks(bob))
+	require.Empty(t, blocks(carol))
+	progress, err := stages.GetStageProgress(tx, stages.TokenTransfers)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), progress)
+}
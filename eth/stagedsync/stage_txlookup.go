@@ -2,17 +2,25 @@ package stagedsync
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/common/etl"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rlp"
+	"golang.org/x/sync/errgroup"
 )
 
 func SpawnTxLookup(s *StageState, db ethdb.Database, tmpdir string, quitCh <-chan struct{}) error {
@@ -103,3 +111,130 @@ func UnwindTxLookup(u *UnwindState, s *StageState, db ethdb.Database, tmpdir str
 	}
 	return u.Done(db)
 }
+
+// RebuildTxLookup drops the transaction lookup index and re-derives it from the bodies of the canonical blocks up to
+// the progress of the Execution stage - to repair the index pruned or corrupted. The blocks are split into the ranges
+// of the workers (the number of CPUs if zero), each of them reading in its own read-only transaction. progress is
+// called with the number of the blocks read of all, at most once a second. The index is loaded and the progress of
+// the TxLookup stage is set in one transaction, the rebuild fails if the chain is reorganized meanwhile
+func RebuildTxLookup(logPrefix string, db ethdb.Database, workers int, tmpdir string, quit <-chan struct{}, progress func(blocks, of uint64)) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	executionAt, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return fmt.Errorf("[%s] getting last executed block: %w", logPrefix, err)
+	}
+	headHash, err := rawdb.ReadCanonicalHash(db, executionAt)
+	if err != nil {
+		return err
+	}
+
+	collector := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer collector.Close(logPrefix)
+	if err = collectTxLookup(logPrefix, db, executionAt+1, workers, collector, quit, progress); err != nil {
+		return fmt.Errorf("[%s] %w", logPrefix, err)
+	}
+
+	tx, err := db.Begin(context.Background(), ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if hash, err := rawdb.ReadCanonicalHash(tx, executionAt); err != nil {
+		return err
+	} else if hash != headHash {
+		return fmt.Errorf("[%s] the canonical block %d changed during the rebuild, try again", logPrefix, executionAt)
+	}
+	if err = tx.(ethdb.BucketsMigrator).ClearBuckets(dbutils.TxLookupPrefix); err != nil {
+		return err
+	}
+	if err = collector.Load(logPrefix, tx, dbutils.TxLookupPrefix, etl.IdentityLoadFunc, etl.TransformArgs{Quit: quit}); err != nil {
+		return fmt.Errorf("[%s] %w", logPrefix, err)
+	}
+	if err = stages.SaveStageProgress(tx, stages.TxLookup, executionAt); err != nil {
+		return err
+	}
+	if err = stages.SaveStageUnwind(tx, stages.TxLookup, 0); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("[%s] Rebuilt the transaction lookup", logPrefix), "blocks", executionAt)
+	return nil
+}
+
+// collectTxLookup collects the lookup entries of the transactions of the canonical blocks below stop
+func collectTxLookup(logPrefix string, db ethdb.Database, stop uint64, workers int, collector *etl.Collector, quit <-chan struct{}, progress func(blocks, of uint64)) error {
+	step := stop/uint64(workers) + 1
+	var read uint64
+	var collectMu sync.Mutex
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped // no progress is reported after the return
+	}()
+	go func() {
+		defer close(stopped)
+		logEvery := time.NewTicker(30 * time.Second)
+		defer logEvery.Stop()
+		progressEvery := time.NewTicker(time.Second)
+		defer progressEvery.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-logEvery.C:
+				log.Info(fmt.Sprintf("[%s] Progress", logPrefix), "blocks", atomic.LoadUint64(&read), "of", stop)
+			case <-progressEvery.C:
+				if progress != nil {
+					progress(atomic.LoadUint64(&read), stop)
+				}
+			}
+		}
+	}()
+
+	g, ctx := errgroup.WithContext(context.Background())
+	for from := uint64(0); from < stop; from += step {
+		from, to := from, from+step
+		if to > stop {
+			to = stop
+		}
+		g.Go(func() error {
+			tx, err := db.Begin(ctx, ethdb.RO)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			return tx.Walk(dbutils.HeaderCanonicalBucket, dbutils.EncodeBlockNumber(from), 0, func(k, v []byte) (bool, error) {
+				blockNum := binary.BigEndian.Uint64(k)
+				if blockNum >= to {
+					return false, nil
+				}
+				if err := common.Stopped(quit); err != nil {
+					return false, err
+				}
+				if err := ctx.Err(); err != nil {
+					return false, err
+				}
+				body := rawdb.ReadBody(tx, common.BytesToHash(v), blockNum)
+				if body == nil {
+					return false, fmt.Errorf("empty block body %d, hash %x", blockNum, v)
+				}
+				blockNumBytes := new(big.Int).SetUint64(blockNum).Bytes()
+				collectMu.Lock()
+				defer collectMu.Unlock()
+				for _, txn := range body.Transactions {
+					if err := collector.Collect(txn.Hash().Bytes(), blockNumBytes); err != nil {
+						return false, err
+					}
+				}
+				atomic.AddUint64(&read, 1)
+				return true, nil
+			})
+		})
+	}
+	return g.Wait()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
@@ -53,7 +54,13 @@ func incrementalTxPoolUpdate(logPrefix string, from, to uint64, pool *core.TxPoo
 	}
 
 	headHeader := rawdb.ReadHeader(db, headHash, to)
-	pool.ResetHead(headHeader.GasLimit, to)
+	// Only the senders whose accounts changed in the new blocks can have their parked transactions
+	// become executable, or their pending ones become invalid, so the rest of the pool isn't rescanned
+	changed, err := changeset.GetModifiedAccounts(db, from+1, to)
+	if err != nil {
+		return fmt.Errorf("%s: reading changed accounts: %w", logPrefix, err)
+	}
+	pool.ResetHeadAccounts(headHeader.GasLimit, to, changed)
 	canonical := make([]common.Hash, to-from)
 	currentHeaderIdx := uint64(0)
 
@@ -9,6 +9,7 @@ import (
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/crypto/secp256k1"
@@ -16,7 +17,12 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/archive"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+	"github.com/ledgerwatch/turbo-geth/turbo/execproof"
+	"github.com/ledgerwatch/turbo-geth/turbo/segments"
 	"github.com/ledgerwatch/turbo-geth/turbo/shards"
+	"github.com/ledgerwatch/turbo-geth/turbo/slotwatch"
 	"github.com/ledgerwatch/turbo-geth/turbo/stages/bodydownload"
 )
 
@@ -52,6 +58,15 @@ type StageParameters struct {
 	stateWriterBuilder    StateWriterBuilder
 	notifier              ChainEventNotifier
 	silkwormExecutionFunc unsafe.Pointer
+	diffChecker           *difftest.Checker
+	executionProofs       *execproof.Store
+	readCache             *state.ReadCache
+	prefetchDB            ethdb.Database
+	parallelWorkers       int
+	freezer               *segments.Freezer
+	archiver              *archive.Archiver
+	retentions            []Retention
+	slotWatcher           *slotwatch.Watcher
 	InitialCycle          bool
 	mining                *MiningStagesParameters
 }
@@ -134,7 +149,7 @@ func DefaultStages() StageBuilders {
 						return SpawnHeaderDownloadStage(s, u, world.d, world.headersFetchers)
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
-						return u.Done(world.DB)
+						return UnwindHeaderDownloadStage(u, world.DB)
 					},
 				}
 			},
@@ -164,7 +179,7 @@ func DefaultStages() StageBuilders {
 						return spawnBodyDownloadStage(s, u, world.d, world.pid, world.prefetchedBlocks)
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
-						return unwindBodyDownloadStage(u, world.DB)
+						return UnwindBodyDownloadStage(u, world.DB)
 					},
 				}
 			},
@@ -208,11 +223,17 @@ func DefaultStages() StageBuilders {
 							world.QuitCh,
 							ExecuteBlockStageParams{
 								WriteReceipts:         world.storageMode.Receipts,
+								WritePreimages:        world.storageMode.Preimages,
 								Cache:                 world.cache,
 								BatchSize:             world.BatchSize,
 								ReaderBuilder:         world.stateReaderBuilder,
 								WriterBuilder:         world.stateWriterBuilder,
 								SilkwormExecutionFunc: world.silkwormExecutionFunc,
+								DiffChecker:           world.diffChecker,
+								ExecutionProofs:       world.executionProofs,
+								ReadCache:             world.readCache,
+								PrefetchDB:            world.prefetchDB,
+								ParallelWorkers:       world.parallelWorkers,
 							})
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
@@ -228,6 +249,23 @@ func DefaultStages() StageBuilders {
 				}
 			},
 		},
+		{
+			ID: stages.BlockWitnesses,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.BlockWitnesses,
+					Description:         "Generate stateless witnesses of the blocks",
+					Disabled:            !world.storageMode.Witnesses,
+					DisabledDescription: "Enable by adding `w` to --storage-mode",
+					ExecFunc: func(s *StageState, u Unwinder) error {
+						return SpawnBlockWitnesses(s, world.TX, world.ChainConfig, world.chainContext, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindBlockWitnesses(u, s, world.TX)
+					},
+				}
+			},
+		},
 		{
 			ID: stages.HashState,
 			Build: func(world StageParameters) *Stage {
@@ -250,10 +288,17 @@ func DefaultStages() StageBuilders {
 					ID:          stages.IntermediateHashes,
 					Description: "Generate intermediate hashes and computing state root",
 					ExecFunc: func(s *StageState, u Unwinder) error {
+						if world.ChainConfig.IsVerkle() || world.ChainConfig.IsBinaryTrie() {
+							_, err := SpawnStateRootStage(s, world.TX, world.ChainConfig, true /* checkRoot */, world.QuitCh)
+							return err
+						}
 						_, err := SpawnIntermediateHashesStage(s, world.TX, true /* checkRoot */, world.cache, world.TmpDir, world.QuitCh)
 						return err
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						if world.ChainConfig.IsVerkle() || world.ChainConfig.IsBinaryTrie() {
+							return UnwindStateRootStage(u, s, world.TX, world.ChainConfig, world.QuitCh)
+						}
 						return UnwindIntermediateHashesStage(u, s, world.TX, world.cache, world.TmpDir, world.QuitCh)
 					},
 				}
@@ -367,6 +412,75 @@ func DefaultStages() StageBuilders {
 				}
 			},
 		},
+		{
+			ID: stages.SlotWatch,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.SlotWatch,
+					Description:         "Evaluate the watches of the storage slots",
+					Disabled:            world.slotWatcher == nil,
+					DisabledDescription: "Enable by setting --slotwatch.config",
+					ExecFunc: func(s *StageState, _ Unwinder) error {
+						return SpawnSlotWatchStage(s, world.TX, world.slotWatcher, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindSlotWatchStage(u, world.TX)
+					},
+				}
+			},
+		},
+		{
+			ID: stages.AccountRanks,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.AccountRanks,
+					Description:         "Rank the accounts by the balance and by the code size",
+					Disabled:            !world.storageMode.AccountRanks,
+					DisabledDescription: "Enable by adding `k` to --storage-mode",
+					ExecFunc: func(s *StageState, _ Unwinder) error {
+						return SpawnAccountRanksStage(s, world.TX, world.TmpDir, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindAccountRanksStage(u, s, world.TX, world.QuitCh)
+					},
+				}
+			},
+		},
+		{
+			ID: stages.TokenTransfers,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.TokenTransfers,
+					Description:         "Generate token transfers index",
+					Disabled:            !world.storageMode.TokenTransfers || !world.storageMode.Receipts,
+					DisabledDescription: "Enable by adding `e` and `r` to --storage-mode",
+					ExecFunc: func(s *StageState, _ Unwinder) error {
+						return SpawnTokenTransfersStage(s, world.TX, world.TmpDir, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						return UnwindTokenTransfersStage(u, s, world.TX, world.QuitCh)
+					},
+				}
+			},
+		},
+		{
+			ID: stages.Prune,
+			Build: func(world StageParameters) *Stage {
+				return &Stage{
+					ID:                  stages.Prune,
+					Description:         "Delete the records outside of the retention windows",
+					Disabled:            len(world.retentions) == 0,
+					DisabledDescription: "Enable by setting --retention or --prune.receipts",
+					ExecFunc: func(s *StageState, _ Unwinder) error {
+						return SpawnPruneStage(s, world.TX, world.retentions, world.QuitCh)
+					},
+					UnwindFunc: func(u *UnwindState, s *StageState) error {
+						// The pruned records are not restored, the windows are only kept by the next cycles
+						return u.Done(world.TX)
+					},
+				}
+			},
+		},
 		{
 			ID: stages.Finish,
 			Build: func(world StageParameters) *Stage {
@@ -387,6 +501,17 @@ func DefaultStages() StageBuilders {
 							return err
 						}
 
+						if world.freezer != nil {
+							if err = world.freezer.Freeze(logPrefix, world.TX, executionAt, world.QuitCh); err != nil {
+								return err
+							}
+						}
+						if world.archiver != nil {
+							if err = world.archiver.Archive(logPrefix, world.TX, executionAt, world.QuitCh); err != nil {
+								return err
+							}
+						}
+
 						return s.DoneAndUpdate(world.TX, executionAt)
 					},
 					UnwindFunc: func(u *UnwindState, s *StageState) error {
@@ -471,7 +596,13 @@ func MiningStages() StageBuilders {
 					ID:          stages.IntermediateHashes,
 					Description: "Generate intermediate hashes and computing state root",
 					ExecFunc: func(s *StageState, u Unwinder) error {
-						stateRoot, err := SpawnIntermediateHashesStage(s, world.TX, false /* checkRoot */, world.cache, world.TmpDir, world.QuitCh)
+						var stateRoot common.Hash
+						var err error
+						if world.ChainConfig.IsVerkle() || world.ChainConfig.IsBinaryTrie() {
+							stateRoot, err = SpawnStateRootStage(s, world.TX, world.ChainConfig, false /* checkRoot */, world.QuitCh)
+						} else {
+							stateRoot, err = SpawnIntermediateHashesStage(s, world.TX, false /* checkRoot */, world.cache, world.TmpDir, world.QuitCh)
+						}
 						if err != nil {
 							return err
 						}
@@ -516,11 +647,13 @@ func DefaultUnwindOrder() UnwindOrder {
 		0, 1, 2,
 		// Unwinding of tx pool (reinjecting transactions into the pool needs to happen after unwinding execution)
 		// also tx pool is before senders because senders unwind is inside cycle transaction
-		12,
-		3, 4,
+		13,
+		3, 4, 5,
 		// Unwinding of IHashes needs to happen after unwinding HashState
-		6, 5,
-		7, 8, 9, 10, 11,
+		7, 6,
+		8, 9, 10, 11, 12,
+		// The watches, the rankings and the token transfers are unwound first, they only follow the execution
+		14, 15, 16,
 	}
 }
 
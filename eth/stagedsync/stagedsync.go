@@ -1,14 +1,21 @@
 package stagedsync
 
 import (
+	"sync"
 	"unsafe"
 
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/archive"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+	"github.com/ledgerwatch/turbo-geth/turbo/execproof"
+	"github.com/ledgerwatch/turbo-geth/turbo/segments"
 	"github.com/ledgerwatch/turbo-geth/turbo/shards"
+	"github.com/ledgerwatch/turbo-geth/turbo/slotwatch"
 	"github.com/ledgerwatch/turbo-geth/turbo/stages/bodydownload"
 )
 
@@ -18,6 +25,8 @@ type StagedSync struct {
 	unwindOrder      UnwindOrder
 	params           OptionalParameters
 	Notifier         ChainEventNotifier
+
+	retentionsLock sync.Mutex // Guards params.Retentions, which can be changed while the node runs
 }
 
 // OptionalParameters contains any non-necessary parateres you can specify to fine-tune
@@ -35,6 +44,37 @@ type OptionalParameters struct {
 	Notifier ChainEventNotifier
 
 	SilkwormExecutionFunc unsafe.Pointer
+
+	// DiffChecker re-executes every block with another EVM implementation and halts the sync
+	// if the results diverge, it is meant for continuous consensus validation.
+	DiffChecker *difftest.Checker
+
+	// ExecutionProofs are the ranges of the blocks the execution stage fast-forwards by applying their attested
+	// changesets instead of executing the blocks
+	ExecutionProofs *execproof.Store
+
+	// ReadCache keeps the recently read accounts and storage between the blocks executed by the execution stage
+	ReadCache *state.ReadCache
+
+	// Prefetch reads the state touched by the transactions of the next block into the ReadCache while the execution
+	// stage executes the current one
+	Prefetch bool
+
+	// ParallelWorkers is the number of the workers the execution stage executes the transactions of the block with in
+	// parallel, the experimental mode is off if it is less than 2
+	ParallelWorkers int
+
+	// Freezer moves the ancient blocks out of the database into the segment files at the end of every cycle
+	Freezer *segments.Freezer
+
+	// Archiver moves the old changesets out of the database into the archive at the end of every cycle
+	Archiver *archive.Archiver
+
+	// Retentions are the windows of the blocks the records of the buckets are kept for, see ParseRetentions
+	Retentions []Retention
+
+	// SlotWatcher alerts on the conditions of the watched storage slots after every executed block
+	SlotWatcher *slotwatch.Watcher
 }
 
 func New(stages StageBuilders, unwindOrder UnwindOrder, params OptionalParameters) *StagedSync {
@@ -46,6 +86,20 @@ func New(stages StageBuilders, unwindOrder UnwindOrder, params OptionalParameter
 	}
 }
 
+// Retentions returns the retention windows the Prune stage of the next cycle applies
+func (stagedSync *StagedSync) Retentions() []Retention {
+	stagedSync.retentionsLock.Lock()
+	defer stagedSync.retentionsLock.Unlock()
+	return stagedSync.params.Retentions
+}
+
+// SetRetentions replaces the retention windows, starting from the next cycle
+func (stagedSync *StagedSync) SetRetentions(retentions []Retention) {
+	stagedSync.retentionsLock.Lock()
+	defer stagedSync.retentionsLock.Unlock()
+	stagedSync.params.Retentions = retentions
+}
+
 func (stagedSync *StagedSync) Prepare(
 	d DownloaderGlue,
 	chainConfig *params.ChainConfig,
@@ -79,6 +133,11 @@ func (stagedSync *StagedSync) Prepare(
 		stagedSync.Notifier = stagedSync.params.Notifier
 	}
 
+	var prefetchDB ethdb.Database
+	if hasTx, ok := db.(ethdb.HasTx); stagedSync.params.Prefetch && (!ok || hasTx.Tx() == nil) {
+		prefetchDB = db
+	}
+
 	stages := stagedSync.stageBuilders.Build(
 		StageParameters{
 			d:                     d,
@@ -101,6 +160,15 @@ func (stagedSync *StagedSync) Prepare(
 			stateWriterBuilder:    writerBuilder,
 			notifier:              stagedSync.Notifier,
 			silkwormExecutionFunc: stagedSync.params.SilkwormExecutionFunc,
+			diffChecker:           stagedSync.params.DiffChecker,
+			executionProofs:       stagedSync.params.ExecutionProofs,
+			readCache:             stagedSync.params.ReadCache,
+			prefetchDB:            prefetchDB,
+			parallelWorkers:       stagedSync.params.ParallelWorkers,
+			freezer:               stagedSync.params.Freezer,
+			archiver:              stagedSync.params.Archiver,
+			retentions:            stagedSync.Retentions(),
+			slotWatcher:           stagedSync.params.SlotWatcher,
 			InitialCycle:          initialCycle,
 			mining:                miningConfig,
 		},
@@ -36,6 +36,7 @@ var (
 	Bodies              SyncStage = []byte("Bodies")              // Block bodies are downloaded, TxHash and UncleHash are getting verified
 	Senders             SyncStage = []byte("Senders")             // "From" recovered from signatures, bodies re-written
 	Execution           SyncStage = []byte("Execution")           // Executing each block w/o buildinf a trie
+	BlockWitnesses      SyncStage = []byte("BlockWitnesses")      // Generating the stateless witnesses of the executed blocks
 	IntermediateHashes  SyncStage = []byte("IntermediateHashes")  // Generate intermediate hashes, calculate the state root hash
 	HashState           SyncStage = []byte("HashState")           // Apply Keccak256 to all the keys in the state
 	AccountHistoryIndex SyncStage = []byte("AccountHistoryIndex") // Generating history index for accounts
@@ -44,6 +45,10 @@ var (
 	CallTraces          SyncStage = []byte("CallTraces")          // Generating call traces index
 	TxLookup            SyncStage = []byte("TxLookup")            // Generating transactions lookup index
 	TxPool              SyncStage = []byte("TxPool")              // Starts Backend
+	SlotWatch           SyncStage = []byte("SlotWatch")           // Evaluating the watches of the storage slots against the changes of the executed blocks
+	AccountRanks        SyncStage = []byte("AccountRanks")        // Ranking the accounts by the balance and by the code size
+	TokenTransfers      SyncStage = []byte("TokenTransfers")      // Generating the index of the ERC-20 and ERC-721 transfers by the addresses (from logs)
+	Prune               SyncStage = []byte("Prune")               // Deleting the records older than the retention windows of the buckets
 	Finish              SyncStage = []byte("Finish")              // Nominal stage after all other stages
 
 	MiningCreateBlock SyncStage = []byte("MiningCreateBlock")
@@ -57,6 +62,7 @@ var AllStages = []SyncStage{
 	Bodies,
 	Senders,
 	Execution,
+	BlockWitnesses,
 	IntermediateHashes,
 	HashState,
 	AccountHistoryIndex,
@@ -65,6 +71,10 @@ var AllStages = []SyncStage{
 	CallTraces,
 	TxLookup,
 	TxPool,
+	SlotWatch,
+	AccountRanks,
+	TokenTransfers,
+	Prune,
 	Finish,
 }
 
@@ -97,6 +107,54 @@ func SaveStageUnwind(db ethdb.Putter, stage SyncStage, invalidation uint64) erro
 	return db.Put(dbutils.SyncStageUnwind, []byte(stage), marshalData(invalidation))
 }
 
+// GetStageCheckpoint retrieves the number of steps completed by an interrupted run of the given stage.
+// Stages which do several long steps before they can save their progress use it to resume the work
+// after a restart instead of redoing it from scratch
+func GetStageCheckpoint(db ethdb.Getter, stage SyncStage) (uint64, error) {
+	v, err := db.Get(dbutils.SyncStageProgress, checkpointKey(stage))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return 0, err
+	}
+	return unmarshalData(v)
+}
+
+// SaveStageCheckpoint saves the number of completed steps of the given stage, 0 means no checkpoint
+func SaveStageCheckpoint(db ethdb.Putter, stage SyncStage, checkpoint uint64) error {
+	return db.Put(dbutils.SyncStageProgress, checkpointKey(stage), marshalData(checkpoint))
+}
+
+// GetPruneProgress retrieves the number of the first block the records of the bucket are kept for, all the records
+// of the older blocks are deleted by the Prune stage
+func GetPruneProgress(db ethdb.Getter, bucket string) (uint64, error) {
+	v, err := db.Get(dbutils.SyncStageProgress, pruneKey(bucket))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return 0, err
+	}
+	return unmarshalData(v)
+}
+
+// ReadPruneProgress is GetPruneProgress of the read-only transaction, e.g. of the historical reads
+func ReadPruneProgress(tx ethdb.Tx, bucket string) (uint64, error) {
+	v, err := tx.GetOne(dbutils.SyncStageProgress, pruneKey(bucket))
+	if err != nil {
+		return 0, err
+	}
+	return unmarshalData(v)
+}
+
+// SavePruneProgress saves the number of the first block the records of the bucket are kept for
+func SavePruneProgress(db ethdb.Putter, bucket string, progress uint64) error {
+	return db.Put(dbutils.SyncStageProgress, pruneKey(bucket), marshalData(progress))
+}
+
+func pruneKey(bucket string) []byte {
+	return append([]byte("prune."), bucket...)
+}
+
+func checkpointKey(stage SyncStage) []byte {
+	return append([]byte("checkpoint."), stage...)
+}
+
 func marshalData(blockNumber uint64) []byte {
 	return encodeBigEndian(blockNumber)
 }
@@ -2,6 +2,7 @@ package stagedsync
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"runtime"
 	"sort"
@@ -9,9 +10,14 @@ import (
 
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type State struct {
@@ -23,6 +29,8 @@ type State struct {
 	beforeStageRun    map[string]func() error
 	onBeforeUnwind    func(stages.SyncStage) error
 	beforeStageUnwind map[string]func() error
+
+	ctx context.Context // carries the span of the running cycle
 }
 
 func (s *State) Len() int {
@@ -149,7 +157,22 @@ func (s *State) StageState(stage stages.SyncStage, db ethdb.Getter) (*StageState
 	return &StageState{s, stage, blockNum}, nil
 }
 
-func (s *State) Run(db ethdb.GetterPutter, tx ethdb.GetterPutter) error {
+// Context carries the span of the running cycle, the transactions begun with it link their commits to the cycle
+func (s *State) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+func (s *State) Run(db ethdb.GetterPutter, tx ethdb.GetterPutter) (err error) {
+	var span trace.Span
+	s.ctx, span = tracing.Start(context.Background(), "stagedsync cycle")
+	defer func() { tracing.End(span, err) }()
+	return s.run(db, tx)
+}
+
+func (s *State) run(db ethdb.GetterPutter, tx ethdb.GetterPutter) error {
 	var timings []interface{}
 	for !s.IsDone() {
 		if !s.unwindStack.Empty() {
@@ -267,9 +290,15 @@ func (s *State) runStage(stage *Stage, db ethdb.Getter, tx ethdb.Getter) error {
 
 	start := time.Now()
 	logPrefix := s.LogPrefix()
-	if err = stage.ExecFunc(stageState, s); err != nil {
+	_, span := tracing.Start(s.Context(), "stage "+string(stage.ID), trace.WithAttributes(attribute.Int64("from", int64(stageState.BlockNumber))))
+	endWork := debug.BeginWork("stage " + string(stage.ID))
+	err = stage.ExecFunc(stageState, s)
+	endWork()
+	endStageSpan(span, stage.ID, db, err)
+	if err != nil {
 		return err
 	}
+	updateStageMetrics(stage.ID, db, "duration", start)
 
 	if time.Since(start) > 30*time.Second {
 		log.Info(fmt.Sprintf("[%s] DONE", logPrefix), "in", time.Since(start))
@@ -303,10 +332,18 @@ func (s *State) UnwindStage(unwind *UnwindState, db ethdb.GetterPutter, tx ethdb
 		return nil
 	}
 
+	_, span := tracing.Start(s.Context(), "unwind "+string(stage.ID), trace.WithAttributes(
+		attribute.Int64("from", int64(stageState.BlockNumber)),
+		attribute.Int64("unwind_point", int64(unwind.UnwindPoint)),
+	))
+	endWork := debug.BeginWork("unwind " + string(stage.ID))
 	err = stage.UnwindFunc(unwind, stageState)
+	endWork()
+	endStageSpan(span, stage.ID, db, err)
 	if err != nil {
 		return err
 	}
+	updateStageMetrics(stage.ID, db, "unwind", start)
 
 	if time.Since(start) > 30*time.Second {
 		log.Info("Unwinding... DONE!", "stage", string(unwind.Stage))
@@ -314,6 +351,30 @@ func (s *State) UnwindStage(unwind *UnwindState, db ethdb.GetterPutter, tx ethdb
 	return nil
 }
 
+// endStageSpan ends the span of the stage run or unwind with the progress the stage saved
+func endStageSpan(span trace.Span, id stages.SyncStage, db ethdb.Getter, err error) {
+	if span.IsRecording() {
+		if progress, err1 := stages.GetStageProgress(db, id); err1 == nil {
+			span.SetAttributes(attribute.Int64("progress", int64(progress)))
+		}
+	}
+	tracing.End(span, err)
+}
+
+// updateStageMetrics updates the stages/<id>/progress gauge and the stages/<id>/<timer> timer of the stage
+func updateStageMetrics(id stages.SyncStage, db ethdb.Getter, timer string, start time.Time) {
+	if !metrics.Enabled {
+		return
+	}
+	metrics.GetOrRegisterTimer(fmt.Sprintf("stages/%s/%s", id, timer), nil).UpdateSince(start)
+	progress, err := stages.GetStageProgress(db, id)
+	if err != nil {
+		log.Warn("Reading the stage progress for the metrics failed", "stage", string(id), "err", err)
+		return
+	}
+	metrics.GetOrRegisterGauge(fmt.Sprintf("stages/%s/progress", id), nil).Update(int64(progress))
+}
+
 func (s *State) DisableAllStages() {
 	for i := range s.stages {
 		s.stages[i].Disabled = true
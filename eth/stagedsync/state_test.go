@@ -6,7 +6,11 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/tracing/tracingtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func TestStateStagesSuccess(t *testing.T) {
@@ -693,3 +697,126 @@ func TestStateSyncInterruptLongUnwind(t *testing.T) {
 func unwindOf(s stages.SyncStage) stages.SyncStage {
 	return append(s, 0xF0)
 }
+
+func TestStateSpans(t *testing.T) {
+	spans := tracingtest.Record(t)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	spans.Reset() // of the creation of the buckets
+	unwound := false
+	var state *State
+	s := []*Stage{
+		{
+			ID:          stages.Headers,
+			Description: "Downloading headers",
+			ExecFunc: func(s *StageState, u Unwinder) error {
+				// The transaction begun with the context of the cycle commits within the cycle
+				tx, err := db.Begin(state.Context(), ethdb.RW)
+				if err != nil {
+					return err
+				}
+				if err = s.DoneAndUpdate(tx, 100); err != nil {
+					tx.Rollback()
+					return err
+				}
+				return tx.Commit()
+			},
+			UnwindFunc: func(u *UnwindState, s *StageState) error {
+				return u.Done(db)
+			},
+		},
+		{
+			ID:          stages.Bodies,
+			Description: "Downloading block bodiess",
+			ExecFunc: func(s *StageState, u Unwinder) error {
+				if !unwound {
+					unwound = true
+					if err := s.Update(db, 100); err != nil {
+						return err
+					}
+					return u.UnwindTo(50, db)
+				}
+				s.Done()
+				return nil
+			},
+			UnwindFunc: func(u *UnwindState, s *StageState) error {
+				return u.Done(db)
+			},
+		},
+	}
+	state = NewState(s)
+	state.unwindOrder = []*Stage{s[0], s[1]}
+	assert.NoError(t, state.Run(db, db))
+
+	cycles := tracingtest.Find(spans, "stagedsync cycle")
+	require.Len(t, cycles, 1)
+	cycle := cycles[0]
+	assert.False(t, cycle.Parent.IsValid())
+	assert.Equal(t, codes.Unset, cycle.StatusCode)
+	childOfCycle := func(span *sdktrace.SpanSnapshot) {
+		assert.Equal(t, cycle.SpanContext.TraceID(), span.SpanContext.TraceID(), span.Name)
+		assert.Equal(t, cycle.SpanContext.SpanID(), span.Parent.SpanID(), span.Name)
+	}
+
+	// The headers run twice, before and after the unwind
+	headers := tracingtest.Find(spans, "stage "+string(stages.Headers))
+	require.Len(t, headers, 2)
+	for i, from := range []int64{0, 50} {
+		childOfCycle(headers[i])
+		value, _ := tracingtest.Attribute(headers[i], "from")
+		assert.Equal(t, from, value)
+		value, _ = tracingtest.Attribute(headers[i], "progress")
+		assert.Equal(t, int64(100), value)
+	}
+	bodies := tracingtest.Find(spans, "stage "+string(stages.Bodies))
+	require.Len(t, bodies, 2)
+	value, _ := tracingtest.Attribute(bodies[0], "progress")
+	assert.Equal(t, int64(100), value)
+
+	for _, id := range []stages.SyncStage{stages.Headers, stages.Bodies} {
+		unwinds := tracingtest.Find(spans, "unwind "+string(id))
+		require.Len(t, unwinds, 1, string(id))
+		childOfCycle(unwinds[0])
+		value, _ := tracingtest.Attribute(unwinds[0], "from")
+		assert.Equal(t, int64(100), value)
+		value, _ = tracingtest.Attribute(unwinds[0], "unwind_point")
+		assert.Equal(t, int64(50), value)
+		value, _ = tracingtest.Attribute(unwinds[0], "progress")
+		assert.Equal(t, int64(50), value)
+	}
+
+	// The commits of the runs of the headers, the other writes go directly to the database
+	var inCycle int
+	for _, commit := range tracingtest.Find(spans, "db commit") {
+		if commit.Parent.IsValid() {
+			childOfCycle(commit)
+			inCycle++
+		}
+	}
+	assert.Equal(t, 2, inCycle)
+}
+
+func TestStateErroredStageSpans(t *testing.T) {
+	spans := tracingtest.Record(t)
+	expectedErr := errors.New("test error")
+	s := []*Stage{
+		{
+			ID:          stages.Headers,
+			Description: "Downloading headers",
+			ExecFunc: func(s *StageState, u Unwinder) error {
+				return expectedErr
+			},
+		},
+	}
+	state := NewState(s)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	assert.Equal(t, expectedErr, state.Run(db, db))
+
+	for _, name := range []string{"stage " + string(stages.Headers), "stagedsync cycle"} {
+		found := tracingtest.Find(spans, name)
+		require.Len(t, found, 1, name)
+		assert.Equal(t, codes.Error, found[0].StatusCode, name)
+		assert.Equal(t, expectedErr.Error(), found[0].StatusMessage, name)
+	}
+}
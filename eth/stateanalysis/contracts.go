@@ -0,0 +1,211 @@
+package stateanalysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/roaring64"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// ContractStats are the metrics of the storage and the code of a contract in the latest state
+type ContractStats struct {
+	Address      common.Address
+	Incarnation  uint64
+	Slots        uint64 // number of the non-empty storage slots
+	StorageBytes uint64 // total size of the storage values, stored without the leading zeroes
+	CodeSize     uint64
+	LastModified uint64 // last block changing the account or its storage, 0 if it isn't in the history index
+}
+
+// WalkContracts calls walker for every contract in the latest state with the address from on, ordered by the
+// address. Only the storage of the current incarnations is counted. The stats passed to the walker are reused,
+// they must be copied to be retained.
+func WalkContracts(tx ethdb.Tx, from common.Address, walker func(stats *ContractStats) (bool, error)) error {
+	c := tx.Cursor(dbutils.PlainStateBucket)
+	defer c.Close()
+	history := tx.Cursor(dbutils.AccountsHistoryBucket)
+	defer history.Close()
+
+	var stats ContractStats
+	contract := false
+	// The keys of the storage go right after the key of its account, so the account is always seen first
+	for k, v, err := c.Seek(from[:]); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if len(k) == common.AddressLength {
+			if contract {
+				if goOn, err := walker(&stats); err != nil || !goOn {
+					return err
+				}
+			}
+			var acc accounts.Account
+			if err = acc.DecodeForStorage(v); err != nil {
+				return fmt.Errorf("decoding account %x: %w", k, err)
+			}
+			// Only the contracts have storage
+			if contract = acc.Incarnation > 0; !contract {
+				continue
+			}
+			stats = ContractStats{Incarnation: acc.Incarnation}
+			copy(stats.Address[:], k)
+			if !acc.IsEmptyCodeHash() {
+				code, err := tx.GetOne(dbutils.CodeBucket, acc.CodeHash[:])
+				if err != nil {
+					return err
+				}
+				stats.CodeSize = uint64(len(code))
+			}
+			if stats.LastModified, err = lastModified(history, stats.Address); err != nil {
+				return err
+			}
+			continue
+		}
+		if !contract || len(v) == 0 || !bytes.Equal(k[:common.AddressLength], stats.Address[:]) {
+			continue
+		}
+		if binary.BigEndian.Uint64(k[common.AddressLength:]) != stats.Incarnation {
+			continue
+		}
+		stats.Slots++
+		stats.StorageBytes += uint64(len(v))
+	}
+	if contract {
+		if _, err := walker(&stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastModified is the last block in the history index of the account. The account is in the changesets of all the
+// blocks changing its storage too
+func lastModified(history ethdb.Cursor, address common.Address) (uint64, error) {
+	// The last chunk of the index has the maximum block number in its key
+	k, v, err := history.Seek(dbutils.IndexChunkKey(address[:], math.MaxUint64))
+	if err != nil || k == nil || !bytes.HasPrefix(k, address[:]) {
+		return 0, err
+	}
+	index := roaring64.New()
+	if _, err = index.ReadFrom(bytes.NewReader(v)); err != nil {
+		return 0, err
+	}
+	if index.IsEmpty() {
+		return 0, nil
+	}
+	return index.Maximum(), nil
+}
+
+// GetContractStats returns the stats of the contract in the latest state, nil if the address isn't a contract
+func GetContractStats(tx ethdb.Tx, address common.Address) (*ContractStats, error) {
+	var result *ContractStats
+	if err := WalkContracts(tx, address, func(stats *ContractStats) (bool, error) {
+		if stats.Address == address {
+			cpy := *stats
+			result = &cpy
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ContractsReport summarises the contracts in the latest state
+type ContractsReport struct {
+	Block        uint64 // latest executed block
+	Contracts    uint64
+	Slots        uint64
+	StorageBytes uint64
+	CodeBytes    uint64
+	Top          []ContractStats // contracts with the largest storage, ordered by the storage size descending
+}
+
+// CollectContracts walks all the contracts in the latest state and passes their stats to the walker ordered by the
+// storage size descending, the largest top of them are kept in the report. The stats are sorted through the ETL
+// collector spilling to tmpdir, so the memory use doesn't depend on the number of the contracts. The walker can be nil.
+func CollectContracts(ctx context.Context, db ethdb.Database, top int, tmpdir string, walker func(stats *ContractStats) error) (*ContractsReport, error) {
+	if top < 0 {
+		return nil, fmt.Errorf("number of the top contracts must not be negative, got %d", top)
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	var report ContractsReport
+	collector := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	var err error
+	if report.Block, err = stages.GetStageProgress(db, stages.Execution); err != nil {
+		return nil, err
+	}
+	if err = db.(ethdb.HasKV).KV().View(ctx, func(tx ethdb.Tx) error {
+		return WalkContracts(tx, common.Address{}, func(stats *ContractStats) (bool, error) {
+			if err := common.Stopped(ctx.Done()); err != nil {
+				return false, err
+			}
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("Collecting contract stats", "address", fmt.Sprintf("%x", stats.Address), "contracts", report.Contracts)
+			}
+			report.Contracts++
+			report.Slots += stats.Slots
+			report.StorageBytes += stats.StorageBytes
+			report.CodeBytes += stats.CodeSize
+			// The key of the collector is {inverted storage size}{address}, the largest storage comes first
+			return true, collector.Collect(contractKey(stats), encodeContractStats(stats))
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = collector.Load("contractStats", db, "" /* no bucket, only sorting */, func(k, v []byte, _ etl.CurrentTableReader, _ etl.LoadNextFunc) error {
+		stats := decodeContractStats(k, v)
+		if len(report.Top) < top {
+			report.Top = append(report.Top, stats)
+		}
+		if walker == nil {
+			return nil
+		}
+		return walker(&stats)
+	}, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func contractKey(stats *ContractStats) []byte {
+	key := make([]byte, 8+common.AddressLength)
+	binary.BigEndian.PutUint64(key, ^stats.StorageBytes)
+	copy(key[8:], stats.Address[:])
+	return key
+}
+
+func encodeContractStats(stats *ContractStats) []byte {
+	v := make([]byte, 8*5)
+	for i, n := range []uint64{stats.Incarnation, stats.Slots, stats.StorageBytes, stats.CodeSize, stats.LastModified} {
+		binary.BigEndian.PutUint64(v[i*8:], n)
+	}
+	return v
+}
+
+func decodeContractStats(k, v []byte) ContractStats {
+	return ContractStats{
+		Address:      common.BytesToAddress(k[8:]),
+		Incarnation:  binary.BigEndian.Uint64(v),
+		Slots:        binary.BigEndian.Uint64(v[8:]),
+		StorageBytes: binary.BigEndian.Uint64(v[16:]),
+		CodeSize:     binary.BigEndian.Uint64(v[24:]),
+		LastModified: binary.BigEndian.Uint64(v[32:]),
+	}
+}
@@ -0,0 +1,81 @@
+package stateanalysis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContractStats(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx := context.Background()
+
+	var (
+		small  = common.HexToAddress("0x0a")
+		wide   = common.HexToAddress("0x0b")
+		wiped  = common.HexToAddress("0x0c")
+		noCode = common.HexToAddress("0x0d")
+	)
+	commit := func(blockNum uint64, change func(ibs *state.IntraBlockState)) {
+		ibs := state.New(state.NewPlainStateReader(db))
+		change(ibs)
+		w := state.NewPlainStateWriter(db, db, blockNum)
+		require.NoError(t, ibs.CommitBlock(ctx, w))
+		require.NoError(t, w.WriteChangeSets())
+		require.NoError(t, w.WriteHistory())
+	}
+	commit(1, func(ibs *state.IntraBlockState) {
+		for _, addr := range []common.Address{small, wide, wiped} {
+			ibs.CreateAccount(addr, true)
+			ibs.SetCode(addr, []byte{0x00, 0x01})
+		}
+		ibs.AddBalance(noCode, uint256.NewInt().SetUint64(1))
+		ibs.SetState(small, &common.Hash{0x01}, *uint256.NewInt().SetUint64(1))
+		for i := byte(1); i <= 3; i++ {
+			ibs.SetState(wide, &common.Hash{i}, *uint256.NewInt().SetUint64(0x1234))
+		}
+		ibs.SetState(wiped, &common.Hash{0x01}, *uint256.NewInt().SetUint64(0xffffffff))
+	})
+	// The storage of the self-destructed contract doesn't count, the change of the storage modifies the contract
+	commit(2, func(ibs *state.IntraBlockState) {
+		ibs.Suicide(wiped)
+		ibs.SetState(wide, &common.Hash{0x04}, *uint256.NewInt().SetUint64(0x12))
+	})
+
+	report, err := CollectContracts(ctx, db, 1, t.TempDir(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), report.Contracts)
+	assert.Equal(t, uint64(5), report.Slots)
+	assert.Equal(t, uint64(1+2*3+1), report.StorageBytes)
+	assert.Equal(t, uint64(4), report.CodeBytes)
+	require.Len(t, report.Top, 1)
+	assert.Equal(t, ContractStats{Address: wide, Incarnation: 1, Slots: 4, StorageBytes: 7, CodeSize: 2, LastModified: 2}, report.Top[0])
+
+	// All the contracts are walked by the storage size
+	var all []common.Address
+	_, err = CollectContracts(ctx, db, 0, t.TempDir(), func(stats *ContractStats) error {
+		all = append(all, stats.Address)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []common.Address{wide, small}, all)
+
+	require.NoError(t, db.KV().View(ctx, func(tx ethdb.Tx) error {
+		stats, err := GetContractStats(tx, small)
+		require.NoError(t, err)
+		assert.Equal(t, &ContractStats{Address: small, Incarnation: 1, Slots: 1, StorageBytes: 1, CodeSize: 2, LastModified: 1}, stats)
+		for _, addr := range []common.Address{wiped, noCode, common.HexToAddress("0x01")} {
+			stats, err = GetContractStats(tx, addr)
+			require.NoError(t, err)
+			assert.Nil(t, stats, "%x", addr)
+		}
+		return nil
+	}))
+}
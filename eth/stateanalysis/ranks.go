@@ -0,0 +1,72 @@
+package stateanalysis
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// BalanceRank is an account of the ranking by the balance
+type BalanceRank struct {
+	Address common.Address
+	Balance *uint256.Int
+}
+
+// CodeSizeRank is a contract of the ranking by the code size
+type CodeSizeRank struct {
+	Address  common.Address
+	CodeSize uint64
+	CodeHash common.Hash
+}
+
+// TopBalances returns the page of the accounts of the latest state ranked by the balance descending, count accounts
+// after skipping offset of them. The ranking is maintained by the AccountRanks stage, the accounts with the zero
+// balance are not in it.
+func TopBalances(tx ethdb.Tx, offset, count uint64) ([]BalanceRank, error) {
+	var page []BalanceRank
+	if err := walkRanking(tx, dbutils.BalanceRank, offset, count, func(k, v []byte) {
+		page = append(page, BalanceRank{
+			Address: common.BytesToAddress(k[32:]),
+			Balance: new(uint256.Int).SetBytes(v),
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// TopCodeSizes returns the page of the contracts of the latest state ranked by the code size descending, count
+// contracts after skipping offset of them. The ranking is maintained by the AccountRanks stage.
+func TopCodeSizes(tx ethdb.Tx, offset, count uint64) ([]CodeSizeRank, error) {
+	var page []CodeSizeRank
+	if err := walkRanking(tx, dbutils.CodeSizeRank, offset, count, func(k, v []byte) {
+		size, address := dbutils.ParseCodeSizeRankKey(k)
+		page = append(page, CodeSizeRank{
+			Address:  address,
+			CodeSize: size,
+			CodeHash: common.BytesToHash(v),
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// walkRanking calls walker with count entries of the ranking after the offset, the skipped entries are only stepped
+// over by the cursor, so the pages far from the top are slower
+func walkRanking(tx ethdb.Tx, bucket string, offset, count uint64, walker func(k, v []byte)) error {
+	c := tx.Cursor(bucket)
+	defer c.Close()
+	var n uint64
+	for k, v, err := c.First(); k != nil && n < offset+count; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if n >= offset {
+			walker(k, v)
+		}
+		n++
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// TxLookupRebuildStatus is the status of the last rebuild of the transaction lookup index started by
+// admin_rebuildTxLookup
+type TxLookupRebuildStatus struct {
+	Running  bool       `json:"running"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Blocks   uint64     `json:"blocks"` // Blocks read
+	Of       uint64     `json:"of"`     // Blocks to read
+}
+
+// txLookupRebuild runs the rebuild of the transaction lookup index, one at a time
+type txLookupRebuild struct {
+	lock   sync.Mutex
+	quit   chan struct{}          // closed to cancel the running rebuild, nil if none is running
+	done   chan struct{}          // closed when the running rebuild is finished
+	status *TxLookupRebuildStatus // status of the last rebuild, nil if none was started
+}
+
+func (r *txLookupRebuild) start(db ethdb.Database, workers int, tmpdir string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.quit != nil {
+		return fmt.Errorf("the rebuild of the transaction lookup started at %s is running already", r.status.Started)
+	}
+	r.quit, r.done = make(chan struct{}), make(chan struct{})
+	r.status = &TxLookupRebuildStatus{Running: true, Started: time.Now()}
+	quit, done := r.quit, r.done
+	log.Info("Rebuilding the transaction lookup", "workers", workers)
+	go func() {
+		defer close(done)
+		err := stagedsync.RebuildTxLookup("rebuild-tx-lookup", db, workers, tmpdir, quit, func(blocks, of uint64) {
+			r.lock.Lock()
+			r.status.Blocks, r.status.Of = blocks, of
+			r.lock.Unlock()
+		})
+		if err != nil {
+			log.Error("Rebuild of the transaction lookup failed", "err", err)
+		}
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		finished := time.Now()
+		r.status.Running, r.status.Finished = false, &finished
+		if err != nil {
+			r.status.Error = err.Error()
+		} else {
+			r.status.Blocks = r.status.Of
+		}
+		r.quit = nil
+	}()
+	return nil
+}
+
+func (r *txLookupRebuild) lastStatus() *TxLookupRebuildStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.status == nil {
+		return nil
+	}
+	status := *r.status
+	return &status
+}
+
+// stop cancels the running rebuild and waits for it to finish
+func (r *txLookupRebuild) stop() {
+	r.lock.Lock()
+	quit, done := r.quit, r.done
+	r.lock.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+}
+
+// PrivateTxLookupAPI is the admin API repairing the transaction lookup index of the nodes which pruned or corrupted it
+type PrivateTxLookupAPI struct {
+	eth *Ethereum
+}
+
+// RebuildTxLookup starts the rebuild of the transaction lookup index from the bodies of the canonical blocks, with
+// the given number of the workers, the number of CPUs if omitted. The node keeps syncing, the lookup of the
+// transactions fails until the rebuilt index replaces the old one. The progress is reported by
+// admin_txLookupRebuildStatus.
+func (api *PrivateTxLookupAPI) RebuildTxLookup(workers *int) (bool, error) {
+	var n int
+	if workers != nil {
+		n = *workers
+	}
+	if err := api.eth.txLookupRebuild.start(api.eth.chainDb, n, api.eth.tmpdir); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// TxLookupRebuildStatus returns the status and the progress of the last rebuild started by admin_rebuildTxLookup,
+// null if none was started.
+func (api *PrivateTxLookupAPI) TxLookupRebuildStatus() *TxLookupRebuildStatus {
+	return api.eth.txLookupRebuild.lastStatus()
+}
+
+// VerifyTxLookup checks the transaction lookup entries of the given percentage of the canonical blocks, picked at
+// random, with the given number of the workers, the number of CPUs if omitted.
+func (api *PrivateTxLookupAPI) VerifyTxLookup(ctx context.Context, percent float64, workers *int) (*integrity.TxLookupSample, error) {
+	var n int
+	if workers != nil {
+		n = *workers
+	}
+	return integrity.VerifyTxLookup(ctx, api.eth.chainDb, percent, n)
+}
@@ -0,0 +1,159 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	backupCommitSize   = 64 * datasize.MB // amount of the data copied into the backup between the commits
+	backupThrottleStep = datasize.MB      // amount of the data copied between the checks of the throttle
+)
+
+// BackupProgress is the progress of Backup, reported after every bucket and every commit of the backup
+type BackupProgress struct {
+	Bucket       string `json:"bucket"`       // bucket being copied
+	BucketsDone  int    `json:"bucketsDone"`  // number of the buckets copied completely
+	BucketsTotal int    `json:"bucketsTotal"` // number of the buckets to copy
+	Keys         uint64 `json:"keys"`         // number of the key/values copied
+	Bytes        uint64 `json:"bytes"`        // size of the key/values copied
+	TotalBytes   uint64 `json:"totalBytes"`   // size of the buckets on the disk, the estimation of Bytes at the end
+}
+
+// Backup copies the database into dst, which has to be empty, while the database is in use. All the buckets are
+// read in one read-only transaction, so the backup is the consistent snapshot of the database as of the start, and
+// the writers aren't blocked. The copy is streamed bucket by bucket through the KV interface, so the backends of
+// the database and of the backup may differ. throttle limits the speed of the reads per second, so that the copy
+// doesn't starve the sync of the disk, not limited if zero. progress is called from the goroutine of Backup, may be nil
+func Backup(ctx context.Context, db KV, dst KV, throttle datasize.ByteSize, progress func(BackupProgress)) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var p BackupProgress
+	var buckets []string
+	for name, cfg := range db.AllBuckets() {
+		if cfg.IsDeprecated {
+			continue
+		}
+		size, err := tx.BucketSize(name)
+		if err != nil {
+			return err
+		}
+		p.TotalBytes += size
+		buckets = append(buckets, name)
+	}
+	sort.Strings(buckets)
+	p.BucketsTotal = len(buckets)
+	report := func() {
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	dstTx, err := dst.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		dstTx.Rollback()
+	}()
+	started := time.Now()
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	var uncommitted, unthrottled datasize.ByteSize
+	for _, name := range buckets {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		p.Bucket = name
+		report()
+		c := tx.Cursor(name)
+		dstC := dstTx.RwCursor(name)
+		dupC, isDupSort := dstC.(RwCursorDupSort)
+		var prevK []byte
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			if isDupSort && bytes.Equal(k, prevK) {
+				err = dupC.AppendDup(k, v)
+			} else {
+				err = dstC.Append(k, v)
+			}
+			if err != nil {
+				return fmt.Errorf("copying %x of %s: %w", k, name, err)
+			}
+			if isDupSort {
+				prevK = common.CopyBytes(k)
+			}
+			p.Keys++
+			p.Bytes += uint64(len(k) + len(v))
+			uncommitted += datasize.ByteSize(len(k) + len(v))
+			unthrottled += datasize.ByteSize(len(k) + len(v))
+			if unthrottled >= backupThrottleStep {
+				if err = throttleBackup(ctx, started, p.Bytes, throttle); err != nil {
+					return err
+				}
+				unthrottled = 0
+			}
+			if uncommitted < backupCommitSize {
+				continue
+			}
+
+			if err = dstTx.Commit(ctx); err != nil {
+				return err
+			}
+			if dstTx, err = dst.BeginRw(ctx); err != nil {
+				return err
+			}
+			dstC = dstTx.RwCursor(name)
+			dupC, isDupSort = dstC.(RwCursorDupSort)
+			uncommitted = 0
+			report()
+			select {
+			default:
+			case <-logEvery.C:
+				log.Info("[backup] Copying", "bucket", name, "copied", datasize.ByteSize(p.Bytes).HR(), "of", datasize.ByteSize(p.TotalBytes).HR())
+			}
+		}
+		c.Close()
+		p.BucketsDone++
+	}
+	if err = dstTx.Commit(ctx); err != nil {
+		return err
+	}
+	p.Bucket = ""
+	report()
+	log.Info("[backup] Done", "keys", p.Keys, "copied", datasize.ByteSize(p.Bytes).HR(), "in", time.Since(started))
+	return nil
+}
+
+// throttleBackup sleeps until the copied amount doesn't exceed the limit per second since the start, fails if the
+// backup is canceled
+func throttleBackup(ctx context.Context, started time.Time, copied uint64, throttle datasize.ByteSize) error {
+	if err := ctx.Err(); err != nil || throttle == 0 {
+		return err
+	}
+	wait := time.Duration(float64(copied)/float64(throttle)*float64(time.Second)) - time.Since(started)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,98 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	db := NewLMDB().InMem().MustOpen()
+	defer db.Close()
+	if err := db.Update(ctx, func(tx RwTx) error {
+		for i := 0; i < 1000; i++ {
+			if err := tx.RwCursor(dbutils.HeadersBucket).Put([]byte(fmt.Sprintf("%08d", i)), bytes.Repeat([]byte{1}, 1024)); err != nil {
+				return err
+			}
+			if i >= 256 {
+				continue
+			}
+			// The keys of the plain state are split into the key and the value of the dupsort bucket
+			for _, k := range [][]byte{bytes.Repeat([]byte{byte(i)}, 20), bytes.Repeat([]byte{byte(i)}, 60)} {
+				if err := tx.RwCursor(dbutils.PlainStateBucket).Put(k, []byte{byte(i), 1}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewLMDB().InMem().MustOpen()
+	defer dst.Close()
+	var reports []BackupProgress
+	const throttle = 4 * datasize.MB
+	started := time.Now()
+	if err := Backup(ctx, db, dst, throttle, func(p BackupProgress) {
+		if len(reports) == 0 {
+			// Written after the start, not in the snapshot
+			if err := db.Update(ctx, func(tx RwTx) error {
+				return tx.RwCursor(dbutils.HeadersBucket).Put([]byte("after"), []byte{1})
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reports = append(reports, p)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	last := reports[len(reports)-1]
+	if last.BucketsDone != last.BucketsTotal || last.Keys != 1000+2*256 {
+		t.Errorf("unexpected progress at the end: %+v", last)
+	}
+	if elapsed, min := time.Since(started), time.Duration(float64(last.Bytes)/float64(throttle)*float64(time.Second))-100*time.Millisecond; elapsed < min {
+		t.Errorf("copied %d bytes in %s, faster than the throttle", last.Bytes, elapsed)
+	}
+
+	for _, bucket := range []string{dbutils.HeadersBucket, dbutils.PlainStateBucket} {
+		var expected, copied [][]byte
+		for kv, list := range map[KV]*[][]byte{db: &expected, dst: &copied} {
+			if err := kv.View(ctx, func(tx Tx) error {
+				c := tx.Cursor(bucket)
+				defer c.Close()
+				for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+					if err != nil {
+						return err
+					}
+					if !bytes.Equal(k, []byte("after")) || kv == dst {
+						*list = append(*list, append(append([]byte{}, k...), v...))
+					}
+				}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(copied) != len(expected) {
+			t.Fatalf("%s: %d key/values copied instead of %d", bucket, len(copied), len(expected))
+		}
+		for i := range expected {
+			if !bytes.Equal(copied[i], expected[i]) {
+				t.Fatalf("%s: copied %x instead of %x", bucket, copied[i], expected[i])
+			}
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := Backup(canceled, db, NewLMDB().InMem().MustOpen(), 0, nil); err == nil {
+		t.Errorf("expected the canceled backup to fail")
+	}
+}
@@ -111,6 +111,54 @@ func TruncateRange(db ethdb.Database, bucket string, key []byte, to uint32) erro
 	})
 }
 
+// Add - adds n to the bitmap of the key, into the chunk covering it, so the chunks stay keyed by their last values.
+// The chunk may outgrow ChunkLimit, the next TruncateRange or the next load by the stage cuts it
+func Add(db ethdb.Database, bucket string, key []byte, n uint32) error {
+	return update(db, bucket, key, n, true)
+}
+
+// Remove - removes n from the bitmap of the key, the chunk left without the values is deleted
+func Remove(db ethdb.Database, bucket string, key []byte, n uint32) error {
+	return update(db, bucket, key, n, false)
+}
+
+func update(db ethdb.Database, bucket string, key []byte, n uint32, add bool) error {
+	fromKey := make([]byte, len(key)+4)
+	copy(fromKey, key)
+	binary.BigEndian.PutUint32(fromKey[len(fromKey)-4:], n)
+
+	var chunkKey []byte
+	bm := roaring.New()
+	if err := db.Walk(bucket, fromKey, len(key)*8, func(k, v []byte) (bool, error) {
+		chunkKey = common.CopyBytes(k)
+		_, err := bm.ReadFrom(bytes.NewReader(v))
+		return false, err
+	}); err != nil {
+		return err
+	}
+	if chunkKey == nil { // n is above the chunks of the key
+		if !add {
+			return nil
+		}
+		chunkKey = fromKey
+		binary.BigEndian.PutUint32(chunkKey[len(chunkKey)-4:], ^uint32(0))
+	}
+	if add {
+		bm.Add(n)
+	} else if !bm.CheckedRemove(n) {
+		return nil
+	}
+	if bm.GetCardinality() == 0 {
+		return db.Delete(bucket, chunkKey, nil)
+	}
+	bm.RunOptimize()
+	buf := bytes.NewBuffer(make([]byte, 0, bm.GetSerializedSizeInBytes()))
+	if _, err := bm.WriteTo(buf); err != nil {
+		return err
+	}
+	return db.Put(bucket, chunkKey, buf.Bytes())
+}
+
 // Get - reading as much chunks as needed to satisfy [from, to] condition
 // join all chunks to 1 bitmap by Or operator
 func Get(db ethdb.Getter, bucket string, key []byte, from, to uint32) (*roaring.Bitmap, error) {
@@ -141,6 +189,30 @@ func Get(db ethdb.Getter, bucket string, key []byte, from, to uint32) (*roaring.
 	return roaring.FastOr(chunks...), nil
 }
 
+// Cardinality - counts the values in [from, to] of the chunks satisfying the condition, without deserializing them.
+// It is the statistic the query planners estimate the selectivity of the indices with
+func Cardinality(db ethdb.Getter, bucket string, key []byte, from, to uint32) (uint64, error) {
+	fromKey := make([]byte, len(key)+4)
+	copy(fromKey, key)
+	binary.BigEndian.PutUint32(fromKey[len(fromKey)-4:], from)
+
+	var cardinality uint64
+	if err := db.Walk(bucket, fromKey, len(key)*8, func(k, v []byte) (bool, error) {
+		bm := roaring.New()
+		if _, err := bm.FromBuffer(v); err != nil {
+			return false, err
+		}
+		cardinality += bm.Rank(to)
+		if from > 0 {
+			cardinality -= bm.Rank(from - 1)
+		}
+		return binary.BigEndian.Uint32(k[len(k)-4:]) < to, nil
+	}); err != nil {
+		return 0, err
+	}
+	return cardinality, nil
+}
+
 // SeekInBitmap - returns value in bitmap which is >= n
 //nolint:deadcode
 func SeekInBitmap(m *roaring.Bitmap, n uint32) (found uint32, ok bool) {
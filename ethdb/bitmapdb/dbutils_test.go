@@ -1,9 +1,13 @@
 package bitmapdb_test
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 
 	"github.com/RoaringBitmap/roaring"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/bitmapdb"
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +57,78 @@ func TestCutLeft(t *testing.T) {
 	require.True(t, lft == nil)
 	require.True(t, bm.GetCardinality() == 0)
 }
+
+func TestCardinality(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	key := []byte{1}
+	bm := roaring.New()
+	for j := 0; j < 100_000; j += 7 {
+		bm.Add(uint32(j))
+	}
+	expected := bm.Clone()
+	require.NoError(t, bitmapdb.WalkChunkWithKeys(key, bm, bitmapdb.ChunkLimit, func(chunkKey []byte, chunk *roaring.Bitmap) error {
+		var buf bytes.Buffer
+		if _, err := chunk.WriteTo(&buf); err != nil {
+			return err
+		}
+		return db.Put(dbutils.LogAddressIndex, chunkKey, buf.Bytes())
+	}))
+	// A neighbouring key doesn't count
+	require.NoError(t, db.Put(dbutils.LogAddressIndex, []byte{2, 0xff, 0xff, 0xff, 0xff}, []byte{}))
+
+	for _, r := range [][2]uint32{{0, 0}, {0, 99_999}, {7, 7}, {8, 13}, {1000, 50_000}, {40_000, 200_000}} {
+		cardinality, err := bitmapdb.Cardinality(db, dbutils.LogAddressIndex, key, r[0], r[1])
+		require.NoError(t, err)
+		inRange := roaring.New()
+		inRange.AddRange(uint64(r[0]), uint64(r[1])+1)
+		require.Equal(t, roaring.And(expected, inRange).GetCardinality(), cardinality, "range %v", r)
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	key := []byte{1}
+	bm := roaring.New()
+	for j := 0; j < 100_000; j += 7 {
+		bm.Add(uint32(j))
+	}
+	expected := bm.Clone()
+	require.NoError(t, bitmapdb.WalkChunkWithKeys(key, bm, bitmapdb.ChunkLimit, func(chunkKey []byte, chunk *roaring.Bitmap) error {
+		var buf bytes.Buffer
+		if _, err := chunk.WriteTo(&buf); err != nil {
+			return err
+		}
+		return db.Put(dbutils.LogAddressIndex, chunkKey, buf.Bytes())
+	}))
+
+	for _, n := range []uint32{0, 1, 7, 50_000, 99_995, 200_000} {
+		require.NoError(t, bitmapdb.Remove(db, dbutils.LogAddressIndex, key, n))
+		expected.Remove(n)
+	}
+	for _, n := range []uint32{3, 50_001, 300_000} {
+		require.NoError(t, bitmapdb.Add(db, dbutils.LogAddressIndex, key, n))
+		expected.Add(n)
+	}
+	actual, err := bitmapdb.Get(db, dbutils.LogAddressIndex, key, 0, ^uint32(0))
+	require.NoError(t, err)
+	require.True(t, expected.Equals(actual))
+
+	// The chunks stay keyed by their last values
+	require.NoError(t, db.Walk(dbutils.LogAddressIndex, key, 8, func(k, v []byte) (bool, error) {
+		chunk := roaring.New()
+		_, err := chunk.FromBuffer(v)
+		require.NoError(t, err)
+		if last := binary.BigEndian.Uint32(k[1:]); last != ^uint32(0) {
+			require.Equal(t, last, chunk.Maximum())
+		}
+		return true, nil
+	}))
+
+	// The value of a new key
+	require.NoError(t, bitmapdb.Add(db, dbutils.LogAddressIndex, []byte{2}, 5))
+	actual, err = bitmapdb.Get(db, dbutils.LogAddressIndex, []byte{2}, 0, ^uint32(0))
+	require.NoError(t, err)
+	require.Equal(t, []uint32{5}, actual.ToArray())
+}
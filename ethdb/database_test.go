@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -288,3 +289,24 @@ func testWalk(db Database, t *testing.T) {
 
 	assert.Equal(t, keysInRange, gotKeys)
 }
+
+func TestOpenReadOnlyBackend(t *testing.T) {
+	for _, name := range Backends() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "chaindata_"+name)
+			db, err := Open(path, false)
+			require.NoError(t, err)
+			require.NoError(t, db.Put(testBucket, []byte("k"), []byte("v")))
+			db.Close()
+
+			db, err = Open(path, true)
+			require.NoError(t, err)
+			defer db.Close()
+			v, err := db.Get(testBucket, []byte("k"))
+			require.NoError(t, err)
+			assert.Equal(t, []byte("v"), v)
+			assert.Error(t, db.Put(testBucket, []byte("k"), []byte("v2")))
+		})
+	}
+}
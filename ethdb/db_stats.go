@@ -0,0 +1,190 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb/cbor"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// BucketStats is the size of a bucket
+type BucketStats struct {
+	Bucket        string `json:"bucket"`
+	Entries       uint64 `json:"entries"`
+	BranchPages   uint64 `json:"branchPages"`
+	LeafPages     uint64 `json:"leafPages"`
+	OverflowPages uint64 `json:"overflowPages"`
+	Size          uint64 `json:"size"` // bytes of all the pages of the bucket
+}
+
+// DBStats is the size breakdown of the database by the buckets. The snapshots of it are persisted into the DBStats
+// bucket by PersistDBStatsEvery to chart which buckets drive the growth of the database
+type DBStats struct {
+	Time      uint64        `json:"time"` // unix seconds
+	PageSize  uint64        `json:"pageSize"`
+	FileSize  uint64        `json:"fileSize"`
+	MaxSize   uint64        `json:"maxSize"`   // the file can't grow beyond it, the writes fail with the map full error
+	UsedSize  uint64        `json:"usedSize"`  // up to the last used page, the rest of the file is preallocated
+	FreePages uint64        `json:"freePages"` // in the freelist, reused by the writes before the file grows
+	DiskFree  uint64        `json:"diskFree"`  // on the filesystem of the database
+	Buckets   []BucketStats `json:"buckets"`   // sorted by the size, the largest first
+}
+
+// ErrBucketsStatNotSupported is returned by BucketsStat for the databases other than LMDB and MDBX, e.g. the remote one
+var ErrBucketsStatNotSupported = errors.New("the stats of the buckets are not supported")
+
+// statTx is the transaction of the databases which know the sizes of their buckets, LMDB and MDBX
+type statTx interface {
+	bucketStats(name string) (BucketStats, error)
+	spaceStats(stats *DBStats) error
+}
+
+// BucketsStat returns the key counts and the sizes of all the existing buckets and the free pages of the database.
+// Only the LMDB and the MDBX transactions know them, the stats of the remote database are read from the DBStats
+// bucket with ReadDBStats
+func BucketsStat(tx Tx) (*DBStats, error) {
+	stats, err := SpaceStat(tx)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := tx.(BucketMigrator).ExistingBuckets()
+	if err != nil {
+		return nil, err
+	}
+	st := tx.(statTx)
+	for _, name := range buckets {
+		bucket, err := st.bucketStats(name)
+		if err != nil {
+			return nil, err
+		}
+		stats.Buckets = append(stats.Buckets, bucket)
+	}
+	sort.SliceStable(stats.Buckets, func(i, j int) bool { return stats.Buckets[i].Size > stats.Buckets[j].Size })
+	return stats, nil
+}
+
+// SpaceStat returns the sizes of the database file and its free pages without the ones of the buckets
+func SpaceStat(tx Tx) (*DBStats, error) {
+	st, ok := tx.(statTx)
+	if !ok {
+		return nil, fmt.Errorf("%w by %T", ErrBucketsStatNotSupported, tx)
+	}
+	stats := &DBStats{Time: uint64(time.Now().Unix())}
+	if err := st.spaceStats(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// freePages returns the number of the pages in a record of the freelist, the list of the pages freed by a transaction
+// which starts with their count in the native (little) endianness, of idSize bytes
+func freePages(v []byte, idSize int) uint64 {
+	switch {
+	case len(v) < idSize:
+		return 0
+	case idSize == 4:
+		return uint64(binary.LittleEndian.Uint32(v))
+	default:
+		return binary.LittleEndian.Uint64(v)
+	}
+}
+
+// WriteDBStats persists the stats into the DBStats bucket under their time
+func WriteDBStats(db Putter, stats *DBStats) error {
+	k, v, err := encodeDBStats(stats)
+	if err != nil {
+		return err
+	}
+	return db.Put(dbutils.DBStats, k, v)
+}
+
+func encodeDBStats(stats *DBStats) ([]byte, []byte, error) {
+	var buf bytes.Buffer
+	if err := cbor.Marshal(&buf, stats); err != nil {
+		return nil, nil, err
+	}
+	return dbutils.EncodeBlockNumber(stats.Time), buf.Bytes(), nil
+}
+
+func decodeDBStats(k, v []byte) (*DBStats, error) {
+	stats := &DBStats{}
+	if err := cbor.Unmarshal(stats, bytes.NewReader(v)); err != nil {
+		return nil, fmt.Errorf("stats of %d: %w", binary.BigEndian.Uint64(k), err)
+	}
+	return stats, nil
+}
+
+// ReadDBStats returns the persisted stats taken from the time to the time, both unix seconds and inclusive
+func ReadDBStats(tx Tx, from, to uint64) ([]*DBStats, error) {
+	c := tx.Cursor(dbutils.DBStats)
+	defer c.Close()
+	var result []*DBStats
+	for k, v, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if binary.BigEndian.Uint64(k) > to {
+			break
+		}
+		stats, err := decodeDBStats(k, v)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+	return result, nil
+}
+
+// ReadLatestDBStats returns the last persisted stats, nil if there are none
+func ReadLatestDBStats(tx Tx) (*DBStats, error) {
+	c := tx.Cursor(dbutils.DBStats)
+	defer c.Close()
+	k, v, err := c.Last()
+	if err != nil || k == nil {
+		return nil, err
+	}
+	return decodeDBStats(k, v)
+}
+
+// PersistDBStatsEvery takes the stats of the database and writes them into the DBStats bucket at the start and
+// then every interval until quit is closed
+func PersistDBStatsEvery(kv KV, interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := persistDBStats(kv); err != nil {
+			log.Warn("Persisting the stats of the database failed", "err", err)
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func persistDBStats(kv KV) error {
+	var stats *DBStats
+	if err := kv.View(context.Background(), func(tx Tx) (err error) {
+		stats, err = BucketsStat(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	k, v, err := encodeDBStats(stats)
+	if err != nil {
+		return err
+	}
+	return kv.Update(context.Background(), func(tx RwTx) error {
+		c := tx.RwCursor(dbutils.DBStats)
+		defer c.Close()
+		return c.Put(k, v)
+	})
+}
@@ -0,0 +1,63 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketsStat(t *testing.T) {
+	ctx := context.Background()
+	db := NewLMDB().InMem().MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx RwTx) error {
+		c := tx.RwCursor(dbutils.HeadersBucket)
+		defer c.Close()
+		for i := 0; i < 1000; i++ {
+			if err := c.Put([]byte(fmt.Sprintf("%08d", i)), bytes.Repeat([]byte{1}, 1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var stats *DBStats
+	require.NoError(t, db.View(ctx, func(tx Tx) (err error) {
+		stats, err = BucketsStat(tx)
+		return err
+	}))
+	require.NotEmpty(t, stats.Buckets)
+	assert.Equal(t, dbutils.HeadersBucket, stats.Buckets[0].Bucket, "the largest bucket is the first")
+	assert.Equal(t, uint64(1000), stats.Buckets[0].Entries)
+	assert.Greater(t, stats.Buckets[0].Size, uint64(1000*1024))
+	assert.NotZero(t, stats.PageSize)
+	assert.NotZero(t, stats.UsedSize)
+
+	// The persisted stats are read back by the time
+	for _, at := range []uint64{100, 200, 300} {
+		stats.Time = at
+		require.NoError(t, db.Update(ctx, func(tx RwTx) error {
+			k, v, err := encodeDBStats(stats)
+			if err != nil {
+				return err
+			}
+			return tx.RwCursor(dbutils.DBStats).Put(k, v)
+		}))
+	}
+	require.NoError(t, db.View(ctx, func(tx Tx) error {
+		persisted, err := ReadDBStats(tx, 150, 300)
+		require.NoError(t, err)
+		require.Len(t, persisted, 2)
+		assert.Equal(t, uint64(200), persisted[0].Time)
+		assert.Equal(t, stats.Buckets, persisted[1].Buckets)
+		latest, err := ReadLatestDBStats(tx)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(300), latest.Time)
+		return nil
+	}))
+}
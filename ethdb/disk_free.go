@@ -0,0 +1,14 @@
+// +build !windows
+
+package ethdb
+
+import "golang.org/x/sys/unix"
+
+// diskFreeSpace returns the bytes available to the process on the filesystem of the path
+func diskFreeSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,16 @@
+package ethdb
+
+import "golang.org/x/sys/windows"
+
+// diskFreeSpace returns the bytes available to the process on the filesystem of the path
+func diskFreeSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err = windows.GetDiskFreeSpaceEx(dir, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,71 @@
+package ethdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Durability is the fsync policy of the commits: the trade-off between the speed of the writes and the commits
+// lost on a crash of the OS or a power loss. A crash of the process alone loses nothing committed at any level,
+// the written pages are in the page cache of the OS already. Only MDBX supports the levels other than the default.
+type Durability uint8
+
+const (
+	// DurabilityParanoid syncs the data and the meta page on every commit, nothing committed is ever lost
+	DurabilityParanoid Durability = iota
+	// DurabilitySafe syncs the data on every commit, and the meta page with the next one. The last commit may be
+	// lost, the database is consistent
+	DurabilitySafe
+	// DurabilityFast doesn't sync the commits, the first commit after every DurabilitySyncPeriod syncs them.
+	// The commits of the last period may be lost, the database is consistent
+	DurabilityFast
+	// DurabilityUnsafe doesn't sync at all, until the level is switched or the database is closed. The database
+	// may be corrupted, so it is only for the bulk sync which can be redone from scratch
+	DurabilityUnsafe
+)
+
+// DefaultDurability is the level of the database which doesn't configure it, the same as before the levels
+const DefaultDurability = DurabilityParanoid
+
+// DurabilitySyncPeriod is the period of the background syncs of DurabilityFast
+const DurabilitySyncPeriod = 5 * time.Second
+
+var durabilityNames = []string{"paranoid", "safe", "fast", "unsafe"}
+
+func (d Durability) String() string {
+	if int(d) < len(durabilityNames) {
+		return durabilityNames[d]
+	}
+	return fmt.Sprintf("durability(%d)", d)
+}
+
+// DurabilityFromString parses the name of the level: paranoid, safe, fast or unsafe
+func DurabilityFromString(s string) (Durability, error) {
+	for i, name := range durabilityNames {
+		if strings.EqualFold(s, name) {
+			return Durability(i), nil
+		}
+	}
+	return DefaultDurability, fmt.Errorf("unknown durability %q, expected one of: %s", s, strings.Join(durabilityNames, ", "))
+}
+
+// DurabilitySetter is the KV which switches the durability of the commits at runtime, e.g. from the level of
+// the bulk sync to the one of the steady state. Switching to a stricter level syncs the commits not synced yet.
+type DurabilitySetter interface {
+	SetDurability(d Durability) error
+	Durability() Durability
+}
+
+// SetDurability switches the durability of the database, if its KV supports it
+func SetDurability(db Database, d Durability) error {
+	hasKV, ok := db.(HasKV)
+	if !ok {
+		return nil
+	}
+	setter, ok := hasKV.KV().(DurabilitySetter)
+	if !ok {
+		return nil
+	}
+	return setter.SetDurability(d)
+}
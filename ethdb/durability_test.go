@@ -0,0 +1,27 @@
+package ethdb
+
+import "testing"
+
+func TestDurabilityFromString(t *testing.T) {
+	for _, d := range []Durability{DurabilityParanoid, DurabilitySafe, DurabilityFast, DurabilityUnsafe} {
+		parsed, err := DurabilityFromString(d.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != d {
+			t.Errorf("parsed %s as %s", d, parsed)
+		}
+	}
+	if d, err := DurabilityFromString("Fast"); err != nil || d != DurabilityFast {
+		t.Errorf("names are case insensitive: %s, %v", d, err)
+	}
+	if _, err := DurabilityFromString("sometimes"); err == nil {
+		t.Errorf("expected error for the unknown level")
+	}
+	// The databases which don't support the levels ignore them
+	db := NewMemDatabase()
+	defer db.Close()
+	if err := SetDurability(db, DurabilityUnsafe); err != nil {
+		t.Fatal(err)
+	}
+}
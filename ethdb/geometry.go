@@ -0,0 +1,124 @@
+package ethdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+const (
+	DefaultGrowthStep = 2 * datasize.GB
+	DefaultPageSize   = 4 * datasize.KB
+	MinPageSize       = 256
+	MaxPageSize       = 64 * datasize.KB
+)
+
+var dbSpaceLeft = metrics.GetOrRegisterGauge("db/space/left", metrics.DefaultRegistry)
+
+// Geometry is the sizes of the database file: it's created of InitialSize, grows by GrowthStep and fails the writes
+// with the map full error beyond MaxSize. The zero fields are the defaults. Only MDBX supports all of them, LMDB only
+// MaxSize (its map size). The page size of the existing database can't be changed, it's applied to the new one only
+type Geometry struct {
+	InitialSize datasize.ByteSize
+	GrowthStep  datasize.ByteSize
+	MaxSize     datasize.ByteSize
+	PageSize    datasize.ByteSize
+}
+
+// Validate checks the sizes are the ones MDBX accepts
+func (g Geometry) Validate() error {
+	if g.PageSize != 0 {
+		if g.PageSize < MinPageSize || g.PageSize > MaxPageSize || g.PageSize&(g.PageSize-1) != 0 {
+			return fmt.Errorf("page size %s is not a power of 2 from %s to %s", g.PageSize.HR(), datasize.ByteSize(MinPageSize).HR(), MaxPageSize.HR())
+		}
+	}
+	if g.MaxSize != 0 && g.InitialSize > g.MaxSize {
+		return fmt.Errorf("initial size %s is over the max size %s", g.InitialSize.HR(), g.MaxSize.HR())
+	}
+	if g.MaxSize != 0 && g.GrowthStep > g.MaxSize {
+		return fmt.Errorf("growth step %s is over the max size %s", g.GrowthStep.HR(), g.MaxSize.HR())
+	}
+	return nil
+}
+
+// MaxSizeGrower is the KV which raises the max size of its file online, without reopening
+type MaxSizeGrower interface {
+	GrowMaxSize(size datasize.ByteSize) error
+}
+
+// SpaceWatchOpts are the thresholds of WatchSpaceEvery
+type SpaceWatchOpts struct {
+	Warn   datasize.ByteSize // the space left below which it's logged, as an error below a fifth of it
+	GrowBy datasize.ByteSize // the step the max size is raised by when the space left to it is below Warn, never if zero
+}
+
+// WatchSpaceEvery checks the space left to the database every interval until quit is closed. Instead of failing the
+// writes with the map full error it raises the max size of the file when the disk has room for it, and it warns
+// when the disk fills up
+func WatchSpaceEvery(kv KV, interval time.Duration, opts SpaceWatchOpts, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := watchSpace(kv, opts); err != nil {
+			log.Warn("Checking the space of the database failed", "err", err)
+		}
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchSpace(kv KV, opts SpaceWatchOpts) error {
+	var stats *DBStats
+	if err := kv.View(context.Background(), func(tx Tx) (err error) {
+		stats, err = SpaceStat(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	limitLeft, diskLeft := spaceLeft(stats)
+
+	if grower, ok := kv.(MaxSizeGrower); ok && opts.GrowBy > 0 && limitLeft < uint64(opts.Warn) && diskLeft > limitLeft {
+		maxSize := datasize.ByteSize(stats.MaxSize) + opts.GrowBy
+		if err := grower.GrowMaxSize(maxSize); err != nil {
+			return fmt.Errorf("growing the max size to %s: %w", maxSize.HR(), err)
+		}
+		log.Info("Database is close to its max size, raised it", "left", datasize.ByteSize(limitLeft).HR(), "maxSize", maxSize.HR())
+		stats.MaxSize = uint64(maxSize)
+		limitLeft, diskLeft = spaceLeft(stats)
+	}
+
+	left, reason := limitLeft, "max size"
+	if diskLeft < limitLeft {
+		left, reason = diskLeft, "disk"
+	}
+	dbSpaceLeft.Update(int64(left))
+	switch {
+	case left < uint64(opts.Warn)/5:
+		log.Error("Database is running out of space, the writes will fail", "left", datasize.ByteSize(left).HR(), "limit", reason, "maxSize", datasize.ByteSize(stats.MaxSize).HR(), "diskFree", datasize.ByteSize(stats.DiskFree).HR())
+	case left < uint64(opts.Warn):
+		log.Warn("Database is running low on space", "left", datasize.ByteSize(left).HR(), "limit", reason, "maxSize", datasize.ByteSize(stats.MaxSize).HR(), "diskFree", datasize.ByteSize(stats.DiskFree).HR())
+	}
+	return nil
+}
+
+// spaceLeft returns the bytes the database can still take before its file hits the max size and before the disk
+// fills up. The free pages and the preallocated tail of the file are reused before the file grows
+func spaceLeft(stats *DBStats) (limitLeft, diskLeft uint64) {
+	free := stats.FreePages * stats.PageSize
+	if stats.MaxSize > stats.UsedSize {
+		limitLeft = stats.MaxSize - stats.UsedSize
+	}
+	limitLeft += free
+	diskLeft = stats.DiskFree + free
+	if stats.FileSize > stats.UsedSize {
+		diskLeft += stats.FileSize - stats.UsedSize
+	}
+	return limitLeft, diskLeft
+}
@@ -0,0 +1,29 @@
+package ethdb
+
+import (
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeometryValidate(t *testing.T) {
+	assert.NoError(t, Geometry{}.Validate())
+	assert.NoError(t, Geometry{InitialSize: datasize.GB, GrowthStep: datasize.GB, MaxSize: datasize.TB, PageSize: 16 * datasize.KB}.Validate())
+	assert.Error(t, Geometry{PageSize: 3 * datasize.KB}.Validate())
+	assert.Error(t, Geometry{PageSize: 128 * datasize.KB}.Validate())
+	assert.Error(t, Geometry{InitialSize: 2 * datasize.GB, MaxSize: datasize.GB}.Validate())
+	assert.Error(t, Geometry{GrowthStep: 2 * datasize.GB, MaxSize: datasize.GB}.Validate())
+}
+
+func TestSpaceLeft(t *testing.T) {
+	stats := &DBStats{PageSize: 4096, FileSize: 1000 * 4096, MaxSize: 2000 * 4096, UsedSize: 900 * 4096, FreePages: 50, DiskFree: 300 * 4096}
+	limitLeft, diskLeft := spaceLeft(stats)
+	assert.Equal(t, uint64((2000-900+50)*4096), limitLeft)
+	assert.Equal(t, uint64((300+50+100)*4096), diskLeft, "the free pages and the tail of the file are reused")
+
+	db := NewLMDB().InMem().MustOpen()
+	defer db.Close()
+	require.NoError(t, watchSpace(db, SpaceWatchOpts{Warn: datasize.GB, GrowBy: datasize.GB}))
+}
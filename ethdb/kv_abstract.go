@@ -3,6 +3,7 @@ package ethdb
 import (
 	"context"
 	"errors"
+	"time"
 	"unsafe"
 
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
@@ -16,6 +17,8 @@ var (
 	ErrUnknownBucket                      = errors.New("unknown bucket. add it to dbutils.Buckets")
 
 	dbSize             = metrics.GetOrRegisterGauge("db/size", metrics.DefaultRegistry)
+	dbLastPage         = metrics.GetOrRegisterGauge("db/pages/last", metrics.DefaultRegistry)
+	dbReaders          = metrics.GetOrRegisterGauge("db/readers", metrics.DefaultRegistry)
 	tableScsLeaf       = metrics.GetOrRegisterGauge("table/scs/leaf", metrics.DefaultRegistry)       //nolint
 	tableScsBranch     = metrics.GetOrRegisterGauge("table/scs/branch", metrics.DefaultRegistry)     //nolint
 	tableScsOverflow   = metrics.GetOrRegisterGauge("table/scs/overflow", metrics.DefaultRegistry)   //nolint
@@ -38,6 +41,27 @@ var (
 	tableGcEntries     = metrics.GetOrRegisterGauge("table/gc/entries", metrics.DefaultRegistry)     //nolint
 )
 
+// updateBucketMetrics updates the db/bucket/<name>/size and the db/bucket/<name>/entries gauges of the bucket
+func updateBucketMetrics(bucket string, pageSize uint, branchPages, leafPages, overflowPages, entries uint64) {
+	size := (branchPages + leafPages + overflowPages) * uint64(pageSize)
+	metrics.GetOrRegisterGauge("db/bucket/"+bucket+"/size", metrics.DefaultRegistry).Update(int64(size))
+	metrics.GetOrRegisterGauge("db/bucket/"+bucket+"/entries", metrics.DefaultRegistry).Update(int64(entries))
+}
+
+// CollectMetricsEvery collects the metrics of the database every refresh until the quit channel is closed
+func CollectMetricsEvery(kv KV, refresh time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		kv.CollectMetrics()
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // KV low-level database interface - main target is - to provide common abstraction over top of LMDB and RemoteKV.
 //
 // Common pattern for short-living transactions:
@@ -0,0 +1,81 @@
+package ethdb
+
+import (
+	"context"
+)
+
+var (
+	_ KV               = &AncientsKV{}
+	_ HasStats         = &AncientsKV{}
+	_ DurabilitySetter = &AncientsKV{}
+	_ AncientReader    = &AncientsKV{}
+	_ AncientReader    = &ancientsTx{}
+)
+
+// AncientReader reads the data of the canonical blocks which are not in the database anymore, moved out of it
+// into the immutable files. It returns nil without error if the block is not there
+type AncientReader interface {
+	Ancient(kind string, number uint64) ([]byte, error)
+}
+
+// AncientsKV - the KV whose read transactions also read the ancient blocks, so that the readers of the headers,
+// the bodies and the receipts fall through to the ancient store when the block is not in the database. The write
+// transactions are the ones of the wrapped KV, the sync doesn't read the ancient blocks
+type AncientsKV struct {
+	KV
+	ancients AncientReader
+}
+
+// NewAncientsKV wraps the KV with the reader of its ancient blocks
+func NewAncientsKV(kv KV, ancients AncientReader) *AncientsKV {
+	return &AncientsKV{KV: kv, ancients: ancients}
+}
+
+func (kv *AncientsKV) Ancient(kind string, number uint64) ([]byte, error) {
+	return kv.ancients.Ancient(kind, number)
+}
+
+func (kv *AncientsKV) View(ctx context.Context, f func(tx Tx) error) error {
+	return kv.KV.View(ctx, func(tx Tx) error {
+		return f(&ancientsTx{Tx: tx, ancients: kv.ancients})
+	})
+}
+
+func (kv *AncientsKV) Begin(ctx context.Context) (Tx, error) {
+	tx, err := kv.KV.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ancientsTx{Tx: tx, ancients: kv.ancients}, nil
+}
+
+func (kv *AncientsKV) DiskSize(ctx context.Context) (uint64, error) {
+	stats, ok := kv.KV.(HasStats)
+	if !ok {
+		return 0, errNotSupported
+	}
+	return stats.DiskSize(ctx)
+}
+
+func (kv *AncientsKV) SetDurability(d Durability) error {
+	if setter, ok := kv.KV.(DurabilitySetter); ok {
+		return setter.SetDurability(d)
+	}
+	return nil
+}
+
+func (kv *AncientsKV) Durability() Durability {
+	if setter, ok := kv.KV.(DurabilitySetter); ok {
+		return setter.Durability()
+	}
+	return DurabilityParanoid
+}
+
+type ancientsTx struct {
+	Tx
+	ancients AncientReader
+}
+
+func (tx *ancientsTx) Ancient(kind string, number uint64) ([]byte, error) {
+	return tx.ancients.Ancient(kind, number)
+}
@@ -0,0 +1,48 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testAncients map[uint64][]byte
+
+func (a testAncients) Ancient(kind string, number uint64) ([]byte, error) {
+	return a[number], nil
+}
+
+func TestAncientsKV(t *testing.T) {
+	kv := NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	ancients := testAncients{1: []byte("header 1")}
+	db := NewObjectDatabase(NewAncientsKV(kv, ancients))
+
+	// The database, its transactions and the batches pass the reads through to the ancient store
+	v, err := db.Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("header 1"), v)
+
+	tx, err := db.Begin(context.Background(), RO)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	v, err = tx.(AncientReader).Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("header 1"), v)
+
+	v, err = db.NewBatch().(AncientReader).Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("header 1"), v)
+
+	require.NoError(t, db.KV().View(context.Background(), func(tx Tx) error {
+		v, err = tx.(AncientReader).Ancient("headers", 1)
+		return err
+	}))
+	require.Equal(t, []byte("header 1"), v)
+
+	// Without the store there are no ancient blocks
+	v, err = NewObjectDatabase(kv).Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Nil(t, v)
+}
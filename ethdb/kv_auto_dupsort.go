@@ -0,0 +1,130 @@
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+var _ RwCursorDupSort = &autoDupCursor{}
+
+// autoDupCursor is the cursor of the bucket with AutoDupSortKeysConversion on top of the cursor of its DupSort
+// layout, for the backends which don't convert the keys themselves, the same way LmdbCursor does: the key of
+// DupFromLen is stored cut at DupToLen, and its tail is the prefix of the value. The moves of the Cursor return
+// the whole keys, the methods of the CursorDupSort work on the layout as stored - the code reading the storage
+// by the account (e.g. the trie) relies on it
+type autoDupCursor struct {
+	RwCursorDupSort
+	bucket   string
+	from, to int
+}
+
+func newAutoDupCursor(c RwCursorDupSort, bucket string, cfg dbutils.BucketConfigItem) *autoDupCursor {
+	return &autoDupCursor{RwCursorDupSort: c, bucket: bucket, from: cfg.DupFromLen, to: cfg.DupToLen}
+}
+
+// join returns the whole key of the key/value as stored
+func (c *autoDupCursor) join(k, v []byte, err error) ([]byte, []byte, error) {
+	if err != nil || len(k) != c.to || len(v) < c.from-c.to {
+		return k, v, err
+	}
+	joined := make([]byte, 0, c.from)
+	joined = append(append(joined, k...), v[:c.from-c.to]...)
+	return joined, v[c.from-c.to:], nil
+}
+
+func (c *autoDupCursor) checkKey(k []byte) error {
+	if len(k) != c.from && len(k) >= c.to {
+		return fmt.Errorf("dupsort bucket: %s, can have keys of len==%d and len<%d. key: %x,%d", c.bucket, c.from, c.to, k, len(k))
+	}
+	return nil
+}
+
+// stored returns the value as stored of the whole key, nil if none
+func (c *autoDupCursor) stored(k []byte) ([]byte, error) {
+	v, err := c.RwCursorDupSort.SeekBothRange(k[:c.to], k[c.to:])
+	if err != nil || v == nil || !bytes.HasPrefix(v, k[c.to:]) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *autoDupCursor) First() ([]byte, []byte, error) {
+	return c.join(c.RwCursorDupSort.First())
+}
+
+func (c *autoDupCursor) Last() ([]byte, []byte, error) {
+	return c.join(c.RwCursorDupSort.Last())
+}
+
+func (c *autoDupCursor) Next() ([]byte, []byte, error) {
+	return c.join(c.RwCursorDupSort.Next())
+}
+
+func (c *autoDupCursor) Prev() ([]byte, []byte, error) {
+	return c.join(c.RwCursorDupSort.Prev())
+}
+
+func (c *autoDupCursor) Current() ([]byte, []byte, error) {
+	return c.join(c.RwCursorDupSort.Current())
+}
+
+func (c *autoDupCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if len(seek) <= c.to {
+		return c.join(c.RwCursorDupSort.Seek(seek))
+	}
+	k, v, err := c.RwCursorDupSort.Seek(seek[:c.to])
+	if err != nil || !bytes.Equal(k, seek[:c.to]) {
+		return c.join(k, v, err)
+	}
+	if v, err = c.RwCursorDupSort.SeekBothRange(k, seek[c.to:]); err != nil {
+		return []byte{}, nil, err
+	}
+	if v == nil { // no more values of the key, the cursor is at the next one
+		return c.join(c.RwCursorDupSort.Current())
+	}
+	return c.join(k, v, nil)
+}
+
+// SeekExact - the key of DupFromLen is returned cut at DupToLen, like by LmdbCursor
+func (c *autoDupCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	if len(key) != c.from {
+		return c.join(c.RwCursorDupSort.SeekExact(key))
+	}
+	v, err := c.stored(key)
+	if err != nil || v == nil {
+		return nil, nil, err
+	}
+	return key[:c.to], v[c.from-c.to:], nil
+}
+
+func (c *autoDupCursor) Put(k, v []byte) error {
+	if err := c.Delete(k, nil); err != nil {
+		return err
+	}
+	if len(k) != c.from {
+		return c.RwCursorDupSort.Put(k, v)
+	}
+	stored := make([]byte, 0, c.from-c.to+len(v))
+	return c.RwCursorDupSort.Put(k[:c.to], append(append(stored, k[c.to:]...), v...))
+}
+
+func (c *autoDupCursor) Append(k, v []byte) error {
+	return c.Put(k, v)
+}
+
+// Delete - the value is ignored, the keys of the bucket have one value each
+func (c *autoDupCursor) Delete(k, _ []byte) error {
+	if err := c.checkKey(k); err != nil {
+		return err
+	}
+	if len(k) != c.from {
+		return c.RwCursorDupSort.Delete(k, nil)
+	}
+	v, err := c.stored(k)
+	if err != nil || v == nil {
+		return err
+	}
+	return c.RwCursorDupSort.Delete(k[:c.to], v)
+}
@@ -0,0 +1,72 @@
+package ethdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// BackendOpts are the options understood by all the KV backends. A backend ignores
+// the options which make no sense for it, e.g. the map size of a remote object store.
+type BackendOpts struct {
+	Path             string
+	InMem            bool
+	ReadOnly         bool
+	Exclusive        bool
+	MapSize          datasize.ByteSize
+	Geometry         Geometry // its MaxSize overrides MapSize
+	MaxFreelistReuse uint
+	Durability       Durability
+	ReadTxWarn       time.Duration // the read transactions older than it are logged, DefaultReadTxWarn if zero
+	ReadTxLimit      time.Duration // the read transactions older than it are aborted, never if zero
+	BucketsCfg       BucketConfigsFunc
+}
+
+// BackendOpenFunc opens the KV of one database implementation
+type BackendOpenFunc func(opts BackendOpts) (KV, error)
+
+// backends are the KV implementations compiled into the binary, by the lowercase name.
+// The backends register themselves from the init functions of their files, so the
+// experimental ones are compiled in with the build tags, e.g. `-tags mdbx`.
+var backends = map[string]BackendOpenFunc{}
+
+// RegisterBackend makes the KV implementation available to --database and to the
+// conformance tests, must be called from an init function
+func RegisterBackend(name string, open BackendOpenFunc) {
+	name = strings.ToLower(name)
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("database backend %s is registered twice", name))
+	}
+	backends[name] = open
+}
+
+// Backends returns the names of the KV implementations compiled into the binary
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasBackend returns whether the KV implementation is compiled into the binary, the name is case insensitive
+func HasBackend(name string) bool {
+	_, ok := backends[strings.ToLower(name)]
+	return ok
+}
+
+// OpenBackend opens the KV with the implementation of the given name, the name is case insensitive
+func OpenBackend(name string, opts BackendOpts) (KV, error) {
+	open, ok := backends[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("database backend %s is not compiled in, available: %s", name, strings.Join(Backends(), ", "))
+	}
+	if opts.BucketsCfg == nil {
+		opts.BucketsCfg = DefaultBucketConfigs
+	}
+	return open(opts)
+}
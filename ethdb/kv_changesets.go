@@ -0,0 +1,119 @@
+package ethdb
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	_ KV               = &ChangesetsKV{}
+	_ HasStats         = &ChangesetsKV{}
+	_ DurabilitySetter = &ChangesetsKV{}
+	_ AncientReader    = &ChangesetsKV{}
+	_ ChangesetsReader = &changesetsTx{}
+	_ AncientReader    = &changesetsTx{}
+)
+
+// ErrChangesetsPruned is returned by the historical reads which need the changesets pruned from the database
+// when there is no archive of them
+var ErrChangesetsPruned = errors.New("the changesets are pruned")
+
+// ChangesetArchive is the store of the changesets pruned from the database
+type ChangesetArchive interface {
+	// Changesets returns the read-only transaction of the archived changesets of the bucket which include the ones
+	// of the block, the caller rolls it back
+	Changesets(bucket string, blockNum uint64) (Tx, error)
+}
+
+// ChangesetsReader - the transaction which knows which changesets are pruned from the database, and reads them from
+// the archive
+type ChangesetsReader interface {
+	// ChangesetsPrunedTo returns the first block whose changesets of the bucket are kept in the database
+	ChangesetsPrunedTo(bucket string) (uint64, error)
+	// ArchivedChangesets returns the transaction of the archived changesets of the bucket which include the ones of
+	// the block, the caller rolls it back. It fails with ErrChangesetsPruned if there is no archive
+	ArchivedChangesets(bucket string, blockNum uint64) (Tx, error)
+}
+
+// PruneProgress reads the first block whose records of the bucket are kept in the database
+type PruneProgress func(tx Tx, bucket string) (uint64, error)
+
+// ChangesetsKV - the KV whose read transactions are ChangesetsReader, so that the lookups of the history tell the
+// pruned changesets and fetch them from the archive. It wraps the AncientsKV, if any, the ancient blocks are read
+// through it
+type ChangesetsKV struct {
+	KV
+	pruneProgress PruneProgress
+	archive       ChangesetArchive
+}
+
+// NewChangesetsKV wraps the KV with the prune progress of its changesets and their archive, nil if there is none
+func NewChangesetsKV(kv KV, pruneProgress PruneProgress, archive ChangesetArchive) *ChangesetsKV {
+	return &ChangesetsKV{KV: kv, pruneProgress: pruneProgress, archive: archive}
+}
+
+func (kv *ChangesetsKV) Ancient(kind string, number uint64) ([]byte, error) {
+	if ancients, ok := kv.KV.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	return nil, nil
+}
+
+func (kv *ChangesetsKV) View(ctx context.Context, f func(tx Tx) error) error {
+	return kv.KV.View(ctx, func(tx Tx) error {
+		return f(&changesetsTx{Tx: tx, kv: kv})
+	})
+}
+
+func (kv *ChangesetsKV) Begin(ctx context.Context) (Tx, error) {
+	tx, err := kv.KV.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &changesetsTx{Tx: tx, kv: kv}, nil
+}
+
+func (kv *ChangesetsKV) DiskSize(ctx context.Context) (uint64, error) {
+	stats, ok := kv.KV.(HasStats)
+	if !ok {
+		return 0, errNotSupported
+	}
+	return stats.DiskSize(ctx)
+}
+
+func (kv *ChangesetsKV) SetDurability(d Durability) error {
+	if setter, ok := kv.KV.(DurabilitySetter); ok {
+		return setter.SetDurability(d)
+	}
+	return nil
+}
+
+func (kv *ChangesetsKV) Durability() Durability {
+	if setter, ok := kv.KV.(DurabilitySetter); ok {
+		return setter.Durability()
+	}
+	return DurabilityParanoid
+}
+
+type changesetsTx struct {
+	Tx
+	kv *ChangesetsKV
+}
+
+func (tx *changesetsTx) ChangesetsPrunedTo(bucket string) (uint64, error) {
+	return tx.kv.pruneProgress(tx.Tx, bucket)
+}
+
+func (tx *changesetsTx) ArchivedChangesets(bucket string, blockNum uint64) (Tx, error) {
+	if tx.kv.archive == nil {
+		return nil, ErrChangesetsPruned
+	}
+	return tx.kv.archive.Changesets(bucket, blockNum)
+}
+
+func (tx *changesetsTx) Ancient(kind string, number uint64) ([]byte, error) {
+	if ancients, ok := tx.Tx.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	return nil, nil
+}
@@ -0,0 +1,34 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangesetsKV(t *testing.T) {
+	kv := NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	pruneProgress := func(tx Tx, bucket string) (uint64, error) { return 10, nil }
+	db := NewObjectDatabase(NewChangesetsKV(NewAncientsKV(kv, testAncients{1: []byte("header 1")}), pruneProgress, nil))
+
+	tx, err := db.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	reader, ok := tx.(ChangesetsReader)
+	require.True(t, ok)
+	prunedTo, err := reader.ChangesetsPrunedTo("changesets")
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), prunedTo)
+	_, err = reader.ArchivedChangesets("changesets", 1)
+	require.ErrorIs(t, err, ErrChangesetsPruned)
+
+	// The ancient blocks are read through the wrapped KV
+	v, err := tx.(AncientReader).Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("header 1"), v)
+	v, err = db.Ancient("headers", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("header 1"), v)
+}
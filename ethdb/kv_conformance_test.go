@@ -0,0 +1,319 @@
+package ethdb_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+// The conformance tests run against every KV backend compiled in. To check an experimental
+// backend, run them with its build tag, e.g. `go test -tags mdbx ./ethdb -run Conformance`
+
+var (
+	conformanceBucket    = dbutils.Buckets[0]
+	conformanceDupBucket = dbutils.Buckets[1]
+)
+
+func conformanceBuckets(defaultBuckets dbutils.BucketsCfg) dbutils.BucketsCfg {
+	return dbutils.BucketsCfg{
+		conformanceBucket:    {},
+		conformanceDupBucket: {Flags: dbutils.DupSort},
+		dbutils.Sequence:     {},
+	}
+}
+
+// forEachBackend runs the test against every backend compiled in, both in memory and on disk
+func forEachBackend(t *testing.T, f func(t *testing.T, kv ethdb.KV)) {
+	for _, name := range ethdb.Backends() {
+		name := name
+		t.Run(name+"/inmem", func(t *testing.T) {
+			kv, err := ethdb.OpenBackend(name, ethdb.BackendOpts{InMem: true, BucketsCfg: conformanceBuckets})
+			require.NoError(t, err)
+			defer kv.Close()
+			f(t, kv)
+		})
+		t.Run(name+"/disk", func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "conformance")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			kv, err := ethdb.OpenBackend(name, ethdb.BackendOpts{Path: dir, BucketsCfg: conformanceBuckets})
+			require.NoError(t, err)
+			defer kv.Close()
+			f(t, kv)
+		})
+	}
+}
+
+func TestConformanceUnknownBackend(t *testing.T) {
+	_, err := ethdb.OpenBackend("no-such-backend", ethdb.BackendOpts{InMem: true})
+	require.Error(t, err)
+	require.False(t, ethdb.HasBackend("no-such-backend"))
+	require.True(t, ethdb.HasBackend("LMDB"))
+}
+
+func TestConformancePutGetDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, kv ethdb.KV) {
+		ctx := context.Background()
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			c := tx.RwCursor(conformanceBucket)
+			for i := 0; i < 10; i++ {
+				if err := c.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i))); err != nil {
+					return err
+				}
+			}
+			return c.Delete([]byte("key3"), nil)
+		}))
+
+		// Rolled back writes are not visible
+		tx, err := kv.BeginRw(ctx)
+		require.NoError(t, err)
+		require.NoError(t, tx.RwCursor(conformanceBucket).Put([]byte("key5"), []byte("changed")))
+		tx.Rollback()
+
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+			v, err := tx.GetOne(conformanceBucket, []byte("key5"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("value5"), v)
+			v, err = tx.GetOne(conformanceBucket, []byte("key3"))
+			require.NoError(t, err)
+			require.Nil(t, v)
+			v, err = tx.GetOne(conformanceBucket, []byte("missing"))
+			require.NoError(t, err)
+			require.Nil(t, v)
+			has, err := tx.HasOne(conformanceBucket, []byte("key9"))
+			require.NoError(t, err)
+			require.True(t, has)
+			has, err = tx.HasOne(conformanceBucket, []byte("key3"))
+			require.NoError(t, err)
+			require.False(t, has)
+			return nil
+		}))
+	})
+}
+
+func TestConformanceCursor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, kv ethdb.KV) {
+		ctx := context.Background()
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			c := tx.RwCursor(conformanceBucket)
+			for _, k := range []string{"b", "d", "f", "h"} {
+				if err := c.Append([]byte(k), []byte("v"+k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+			c := tx.Cursor(conformanceBucket)
+			defer c.Close()
+
+			var keys []string
+			for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+				require.NoError(t, err)
+				keys = append(keys, string(k))
+			}
+			require.Equal(t, []string{"b", "d", "f", "h"}, keys)
+
+			keys = keys[:0]
+			for k, _, err := c.Last(); k != nil; k, _, err = c.Prev() {
+				require.NoError(t, err)
+				keys = append(keys, string(k))
+			}
+			require.Equal(t, []string{"h", "f", "d", "b"}, keys)
+
+			k, v, err := c.Seek([]byte("c"))
+			require.NoError(t, err)
+			require.Equal(t, "d", string(k))
+			require.Equal(t, "vd", string(v))
+			k, v, err = c.Current()
+			require.NoError(t, err)
+			require.Equal(t, "d", string(k))
+			require.Equal(t, "vd", string(v))
+			k, _, err = c.Seek([]byte("i"))
+			require.NoError(t, err)
+			require.Nil(t, k)
+
+			k, v, err = c.SeekExact([]byte("f"))
+			require.NoError(t, err)
+			require.Equal(t, "f", string(k))
+			require.Equal(t, "vf", string(v))
+			k, _, err = c.SeekExact([]byte("e"))
+			require.NoError(t, err)
+			require.Nil(t, k)
+
+			count, err := c.Count()
+			require.NoError(t, err)
+			require.Equal(t, uint64(4), count)
+			return nil
+		}))
+	})
+}
+
+func TestConformanceDupSort(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, kv ethdb.KV) {
+		ctx := context.Background()
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			c := tx.RwCursorDupSort(conformanceDupBucket)
+			for _, kv := range [][2]string{{"a", "3"}, {"a", "1"}, {"a", "2"}, {"b", "1"}, {"c", "2"}, {"c", "1"}} {
+				if err := c.Put([]byte(kv[0]), []byte(kv[1])); err != nil {
+					return err
+				}
+			}
+			return c.AppendDup([]byte("c"), []byte("3"))
+		}))
+
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+			c := tx.CursorDupSort(conformanceDupBucket)
+			defer c.Close()
+
+			var pairs []string
+			for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+				require.NoError(t, err)
+				pairs = append(pairs, string(k)+string(v))
+			}
+			require.Equal(t, []string{"a1", "a2", "a3", "b1", "c1", "c2", "c3"}, pairs)
+
+			v, err := c.SeekBothRange([]byte("a"), []byte("2"))
+			require.NoError(t, err)
+			require.Equal(t, "2", string(v))
+			k, v, err := c.NextDup()
+			require.NoError(t, err)
+			require.Equal(t, "a3", string(k)+string(v))
+			k, _, err = c.NextDup()
+			require.NoError(t, err)
+			require.Nil(t, k)
+
+			k, v, err = c.SeekBothExact([]byte("c"), []byte("2"))
+			require.NoError(t, err)
+			require.Equal(t, "c2", string(k)+string(v))
+			v, err = c.FirstDup()
+			require.NoError(t, err)
+			require.Equal(t, "1", string(v))
+			v, err = c.LastDup()
+			require.NoError(t, err)
+			require.Equal(t, "3", string(v))
+			count, err := c.CountDuplicates()
+			require.NoError(t, err)
+			require.Equal(t, uint64(3), count)
+
+			k, v, err = c.SeekExact([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, "a1", string(k)+string(v))
+			k, v, err = c.NextNoDup()
+			require.NoError(t, err)
+			require.Equal(t, "b1", string(k)+string(v))
+			return nil
+		}))
+
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			c := tx.RwCursorDupSort(conformanceDupBucket)
+			if _, _, err := c.SeekExact([]byte("a")); err != nil {
+				return err
+			}
+			if err := c.DeleteCurrentDuplicates(); err != nil {
+				return err
+			}
+			return c.Delete([]byte("c"), []byte("2"))
+		}))
+
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+			var pairs []string
+			c := tx.Cursor(conformanceDupBucket)
+			defer c.Close()
+			for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+				require.NoError(t, err)
+				pairs = append(pairs, string(k)+string(v))
+			}
+			require.Equal(t, []string{"b1", "c1", "c3"}, pairs)
+			return nil
+		}))
+	})
+}
+
+func TestConformanceSequence(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, kv ethdb.KV) {
+		require.NoError(t, kv.Update(context.Background(), func(tx ethdb.RwTx) error {
+			i, err := tx.ReadSequence(conformanceBucket)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), i)
+			i, err = tx.IncrementSequence(conformanceBucket, 5)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), i)
+			i, err = tx.IncrementSequence(conformanceBucket, 1)
+			require.NoError(t, err)
+			require.Equal(t, uint64(5), i)
+			i, err = tx.ReadSequence(conformanceBucket)
+			require.NoError(t, err)
+			require.Equal(t, uint64(6), i)
+			i, err = tx.ReadSequence(conformanceDupBucket)
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), i)
+			return nil
+		}))
+	})
+}
+
+func TestConformanceIsolation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, kv ethdb.KV) {
+		ctx := context.Background()
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			return tx.RwCursor(conformanceBucket).Put([]byte("k"), []byte("old"))
+		}))
+
+		roTx, err := kv.Begin(ctx)
+		require.NoError(t, err)
+		defer roTx.Rollback()
+
+		require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+			return tx.RwCursor(conformanceBucket).Put([]byte("k"), []byte("new"))
+		}))
+
+		// The read transaction keeps seeing the snapshot it was started on
+		v, err := roTx.GetOne(conformanceBucket, []byte("k"))
+		require.NoError(t, err)
+		require.Equal(t, "old", string(v))
+
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+			v, err := tx.GetOne(conformanceBucket, []byte("k"))
+			require.NoError(t, err)
+			require.Equal(t, "new", string(v))
+			return nil
+		}))
+	})
+}
+
+func TestConformanceReopen(t *testing.T) {
+	for _, name := range ethdb.Backends() {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "conformance")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			ctx := context.Background()
+
+			kv, err := ethdb.OpenBackend(name, ethdb.BackendOpts{Path: dir, BucketsCfg: conformanceBuckets})
+			require.NoError(t, err)
+			require.NoError(t, kv.Update(ctx, func(tx ethdb.RwTx) error {
+				return tx.RwCursor(conformanceBucket).Put([]byte("k"), []byte("v"))
+			}))
+			kv.Close()
+
+			kv, err = ethdb.OpenBackend(name, ethdb.BackendOpts{Path: dir, ReadOnly: true, BucketsCfg: conformanceBuckets})
+			require.NoError(t, err)
+			defer kv.Close()
+			require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+				v, err := tx.GetOne(conformanceBucket, []byte("k"))
+				require.NoError(t, err)
+				require.Equal(t, "v", string(v))
+				return nil
+			}))
+		})
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/ledgerwatch/lmdb-go/lmdb"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/tracing"
 	"github.com/prometheus/tsdb/fileutil"
 )
 
@@ -40,6 +41,27 @@ type LmdbOpts struct {
 	bucketsCfg       BucketConfigsFunc
 	mapSize          datasize.ByteSize
 	maxFreelistReuse uint
+	readTxWarn       time.Duration
+	readTxLimit      time.Duration
+}
+
+func init() {
+	RegisterBackend("lmdb", func(o BackendOpts) (KV, error) {
+		opts := NewLMDB().Path(o.Path).MapSize(o.MapSize).MaxFreelistReuse(o.MaxFreelistReuse).ReadTxLimits(o.ReadTxWarn, o.ReadTxLimit).WithBucketsConfig(o.BucketsCfg)
+		if o.InMem {
+			opts = opts.InMem()
+		}
+		if o.Exclusive {
+			opts = opts.Exclusive()
+		}
+		if o.ReadOnly {
+			opts = opts.ReadOnly()
+		}
+		if o.Geometry.MaxSize != 0 {
+			opts = opts.MapSize(o.Geometry.MaxSize) // LMDB grows its file by itself and uses the page size of the OS
+		}
+		return opts.Open()
+	})
 }
 
 func NewLMDB() LmdbOpts {
@@ -73,6 +95,13 @@ func (opts LmdbOpts) MaxFreelistReuse(pages uint) LmdbOpts {
 	return opts
 }
 
+// ReadTxLimits sets the age of the read transactions after which they are logged, DefaultReadTxWarn if zero,
+// and the one after which they are aborted, never if zero
+func (opts LmdbOpts) ReadTxLimits(warn, limit time.Duration) LmdbOpts {
+	opts.readTxWarn, opts.readTxLimit = warn, limit
+	return opts
+}
+
 func (opts LmdbOpts) Flags(f func(uint) uint) LmdbOpts {
 	opts.flags = f(opts.flags)
 	return opts
@@ -83,6 +112,14 @@ func (opts LmdbOpts) Exclusive() LmdbOpts {
 	return opts
 }
 
+// ReadOnly opens the database without writing anything into its directory, e.g. on a read-only
+// volume or a network filesystem. The lock file isn't used either, so the database must not be
+// written by anyone else meanwhile.
+func (opts LmdbOpts) ReadOnly() LmdbOpts {
+	opts.flags |= lmdb.Readonly | lmdb.NoLock
+	return opts
+}
+
 func (opts LmdbOpts) WithBucketsConfig(f BucketConfigsFunc) LmdbOpts {
 	opts.bucketsCfg = f
 	return opts
@@ -157,7 +194,7 @@ func (opts LmdbOpts) Open() (kv KV, err error) {
 				_ = exclusiveLock.Release()
 			}
 		}()
-	} else { // try exclusive lock (release immediately)
+	} else if opts.flags&lmdb.NoLock == 0 { // try exclusive lock (release immediately), nothing is locked in the NoLock mode
 		exclusiveLock, _, err = fileutil.Flock(path.Join(opts.path, "LOCK"))
 		if err != nil {
 			return nil, fmt.Errorf("failed exclusive Flock for lmdb, path=%s: %w", opts.path, err)
@@ -259,6 +296,7 @@ func (opts LmdbOpts) Open() (kv KV, err error) {
 			db.log.Debug("cleared reader slots from dead processes", "amount", staleReaders)
 		}
 	}
+	db.watchdog = newReadTxWatchdog(db.log, opts.readTxWarn, opts.readTxLimit)
 	return db, nil
 }
 
@@ -277,6 +315,7 @@ type LmdbKV struct {
 	buckets       dbutils.BucketsCfg
 	wg            *sync.WaitGroup
 	exclusiveLock fileutil.Releaser
+	watchdog      *readTxWatchdog
 }
 
 func (db *LmdbKV) NewDbWithTheSameParameters() *ObjectDatabase {
@@ -298,6 +337,7 @@ func (db *LmdbKV) Close() {
 	if db.env != nil {
 		env := db.env
 		db.env = nil
+		db.watchdog.stop()
 		if err := env.Close(); err != nil {
 			db.log.Warn("failed to close DB", "err", err)
 		} else {
@@ -321,8 +361,13 @@ func (db *LmdbKV) DiskSize(_ context.Context) (uint64, error) {
 }
 
 func (db *LmdbKV) CollectMetrics() {
-	fileInfo, _ := os.Stat(path.Join(db.opts.path, "data.mdb"))
-	dbSize.Update(fileInfo.Size())
+	if fileInfo, err := os.Stat(path.Join(db.opts.path, "data.mdb")); err == nil {
+		dbSize.Update(fileInfo.Size())
+	}
+	if info, err := db.env.Info(); err == nil {
+		dbLastPage.Update(info.LastPNO)
+		dbReaders.Update(int64(info.NumReaders))
+	}
 
 	if err := db.View(context.Background(), func(tx Tx) error {
 		stat, _ := tx.(*lmdbTx).BucketStat(dbutils.PlainStorageChangeSetBucket)
@@ -354,6 +399,14 @@ func (db *LmdbKV) CollectMetrics() {
 		tableGcBranch.Update(int64(stat.BranchPages))
 		tableGcOverflow.Update(int64(stat.OverflowPages))
 		tableGcEntries.Update(int64(stat.Entries))
+
+		for _, bucket := range dbutils.Buckets {
+			stat, err := tx.(*lmdbTx).BucketStat(bucket)
+			if err != nil {
+				continue // the bucket isn't created yet
+			}
+			updateBucketMetrics(bucket, stat.PSize, stat.BranchPages, stat.LeafPages, stat.OverflowPages, stat.Entries)
+		}
 		return nil
 	}); err != nil {
 		log.Error("collecting metrics failed", "err", err)
@@ -379,6 +432,7 @@ func (db *LmdbKV) Begin(_ context.Context) (txn Tx, err error) {
 		db:       db,
 		tx:       tx,
 		readOnly: true,
+		watched:  db.watchdog.add(),
 	}, nil
 }
 
@@ -410,6 +464,7 @@ type lmdbTx struct {
 	tx       *lmdb.Txn
 	db       *LmdbKV
 	cursors  []*lmdb.Cursor
+	watched  *watchedTx // nil for the write transaction
 }
 
 type LmdbCursor struct {
@@ -621,6 +676,7 @@ func (tx *lmdbTx) Commit(ctx context.Context) error {
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
+		tx.db.watchdog.remove(tx.watched)
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
@@ -628,7 +684,10 @@ func (tx *lmdbTx) Commit(ctx context.Context) error {
 	tx.closeCursors()
 
 	commitTimer := time.Now()
-	if err := tx.tx.Commit(); err != nil {
+	_, span := tracing.Start(ctx, "db commit")
+	err := tx.tx.Commit()
+	tracing.End(span, err)
+	if err != nil {
 		return err
 	}
 	commitTook := time.Since(commitTimer)
@@ -649,6 +708,7 @@ func (tx *lmdbTx) Rollback() {
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
+		tx.db.watchdog.remove(tx.watched)
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
@@ -658,6 +718,9 @@ func (tx *lmdbTx) Rollback() {
 }
 
 func (tx *lmdbTx) get(dbi lmdb.DBI, key []byte) ([]byte, error) {
+	if tx.watched.expired() {
+		return nil, ErrReadTxExpired
+	}
 	return tx.tx.Get(dbi, key)
 }
 
@@ -796,6 +859,57 @@ func (tx *lmdbTx) BucketStat(name string) (*lmdb.Stat, error) {
 	return tx.tx.Stat(lmdb.DBI(tx.db.buckets[name].DBI))
 }
 
+func (tx *lmdbTx) bucketStats(name string) (BucketStats, error) {
+	st, err := tx.BucketStat(name)
+	if err != nil {
+		return BucketStats{}, fmt.Errorf("bucket: %s, %w", name, err)
+	}
+	return BucketStats{
+		Bucket:        name,
+		Entries:       st.Entries,
+		BranchPages:   st.BranchPages,
+		LeafPages:     st.LeafPages,
+		OverflowPages: st.OverflowPages,
+		Size:          (st.BranchPages + st.LeafPages + st.OverflowPages) * uint64(st.PSize),
+	}, nil
+}
+
+func (tx *lmdbTx) spaceStats(stats *DBStats) error {
+	st, err := tx.BucketStat("freelist")
+	if err != nil {
+		return err
+	}
+	stats.PageSize = uint64(st.PSize)
+	fileInfo, err := os.Stat(path.Join(tx.db.opts.path, "data.mdb"))
+	if err != nil {
+		return err
+	}
+	stats.FileSize = uint64(fileInfo.Size())
+	info, err := tx.db.env.Info()
+	if err != nil {
+		return err
+	}
+	stats.MaxSize = uint64(info.MapSize)
+	if stats.DiskFree, err = diskFreeSpace(tx.db.opts.path); err != nil {
+		return err
+	}
+	stats.UsedSize = uint64(info.LastPNO+1) * stats.PageSize
+
+	// The pages of the freelist are the MDB_IDLs of size_t
+	c, err := tx.tx.OpenCursor(lmdb.DBI(0))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, v, err := c.Get(nil, nil, lmdb.First); !lmdb.IsNotFound(err); _, v, err = c.Get(nil, nil, lmdb.Next) {
+		if err != nil {
+			return err
+		}
+		stats.FreePages += freePages(v, 8)
+	}
+	return nil
+}
+
 func (tx *lmdbTx) RwCursor(bucket string) RwCursor {
 	b := tx.db.buckets[bucket]
 	if b.AutoDupSortKeysConversion {
@@ -832,16 +946,22 @@ func (tx *lmdbTx) CHandle() unsafe.Pointer {
 }
 
 // methods here help to see better pprof picture
-func (c *LmdbCursor) set(k []byte) ([]byte, []byte, error) { return c.c.Get(k, nil, lmdb.Set) }
-func (c *LmdbCursor) getCurrent() ([]byte, []byte, error)  { return c.c.Get(nil, nil, lmdb.GetCurrent) }
-func (c *LmdbCursor) first() ([]byte, []byte, error)       { return c.c.Get(nil, nil, lmdb.First) }
-func (c *LmdbCursor) next() ([]byte, []byte, error)        { return c.c.Get(nil, nil, lmdb.Next) }
-func (c *LmdbCursor) nextDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, lmdb.NextDup) }
-func (c *LmdbCursor) nextNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, lmdb.NextNoDup) }
-func (c *LmdbCursor) prev() ([]byte, []byte, error)        { return c.c.Get(nil, nil, lmdb.Prev) }
-func (c *LmdbCursor) prevDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, lmdb.PrevDup) }
-func (c *LmdbCursor) prevNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, lmdb.PrevNoDup) }
-func (c *LmdbCursor) last() ([]byte, []byte, error)        { return c.c.Get(nil, nil, lmdb.Last) }
+func (c *LmdbCursor) get(k, v []byte, op uint) ([]byte, []byte, error) {
+	if c.tx.watched.expired() {
+		return nil, nil, ErrReadTxExpired
+	}
+	return c.c.Get(k, v, op)
+}
+func (c *LmdbCursor) set(k []byte) ([]byte, []byte, error) { return c.get(k, nil, lmdb.Set) }
+func (c *LmdbCursor) getCurrent() ([]byte, []byte, error)  { return c.get(nil, nil, lmdb.GetCurrent) }
+func (c *LmdbCursor) first() ([]byte, []byte, error)       { return c.get(nil, nil, lmdb.First) }
+func (c *LmdbCursor) next() ([]byte, []byte, error)        { return c.get(nil, nil, lmdb.Next) }
+func (c *LmdbCursor) nextDup() ([]byte, []byte, error)     { return c.get(nil, nil, lmdb.NextDup) }
+func (c *LmdbCursor) nextNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, lmdb.NextNoDup) }
+func (c *LmdbCursor) prev() ([]byte, []byte, error)        { return c.get(nil, nil, lmdb.Prev) }
+func (c *LmdbCursor) prevDup() ([]byte, []byte, error)     { return c.get(nil, nil, lmdb.PrevDup) }
+func (c *LmdbCursor) prevNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, lmdb.PrevNoDup) }
+func (c *LmdbCursor) last() ([]byte, []byte, error)        { return c.get(nil, nil, lmdb.Last) }
 func (c *LmdbCursor) delCurrent() error                    { return c.c.Del(lmdb.Current) }
 func (c *LmdbCursor) delNoDupData() error                  { return c.c.Del(lmdb.NoDupData) }
 func (c *LmdbCursor) put(k, v []byte) error                { return c.c.Put(k, v, 0) }
@@ -851,21 +971,38 @@ func (c *LmdbCursor) putNoDupData(k, v []byte) error       { return c.c.Put(k, v
 func (c *LmdbCursor) append(k, v []byte) error             { return c.c.Put(k, v, lmdb.Append) }
 func (c *LmdbCursor) appendDup(k, v []byte) error          { return c.c.Put(k, v, lmdb.AppendDup) }
 func (c *LmdbCursor) getBoth(k, v []byte) ([]byte, []byte, error) {
-	return c.c.Get(k, v, lmdb.GetBoth)
+	return c.get(k, v, lmdb.GetBoth)
 }
 func (c *LmdbCursor) setRange(k []byte) ([]byte, []byte, error) {
-	return c.c.Get(k, nil, lmdb.SetRange)
+	return c.get(k, nil, lmdb.SetRange)
 }
 func (c *LmdbCursor) getBothRange(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, lmdb.GetBothRange)
+	_, v, err := c.get(k, v, lmdb.GetBothRange)
 	return v, err
 }
+
+// firstDup and lastDup don't use MDB_FIRST_DUP and MDB_LAST_DUP, because they don't return the key
+// and lmdb-go panics on the empty key
 func (c *LmdbCursor) firstDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, lmdb.FirstDup)
+	k, _, err := c.get(nil, nil, lmdb.GetCurrent)
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.get(k, nil, lmdb.SetKey)
 	return v, err
 }
 func (c *LmdbCursor) lastDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, lmdb.LastDup)
+	if _, _, err := c.get(nil, nil, lmdb.GetCurrent); err != nil {
+		return nil, err
+	}
+	if _, _, err := c.get(nil, nil, lmdb.NextNoDup); err != nil {
+		if !lmdb.IsNotFound(err) {
+			return nil, err
+		}
+		_, v, err := c.get(nil, nil, lmdb.Last)
+		return v, err
+	}
+	_, v, err := c.get(nil, nil, lmdb.Prev)
 	return v, err
 }
 
@@ -20,9 +20,19 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/ethdb/mdbx"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var _ DbCopier = &MdbxKV{}
+var _ DurabilitySetter = &MdbxKV{}
+var _ MaxSizeGrower = &MdbxKV{}
+
+var (
+	dbCommitTimer     = metrics.NewRegisteredTimer("db/commit/whole", nil)
+	dbCommitSyncTimer = metrics.NewRegisteredTimer("db/commit/fsync", nil)
+)
 
 type MdbxOpts struct {
 	inMem             bool
@@ -31,8 +41,28 @@ type MdbxOpts struct {
 	path              string
 	bucketsCfg        BucketConfigsFunc
 	mapSize           datasize.ByteSize
+	geometry          Geometry
 	dirtyListMaxPages uint64
 	maxFreelistReuse  uint
+	durability        Durability
+	readTxWarn        time.Duration
+	readTxLimit       time.Duration
+}
+
+func init() {
+	RegisterBackend("mdbx", func(o BackendOpts) (KV, error) {
+		opts := NewMDBX().Path(o.Path).MapSize(o.MapSize).Geometry(o.Geometry).MaxFreelistReuse(o.MaxFreelistReuse).Durability(o.Durability).ReadTxLimits(o.ReadTxWarn, o.ReadTxLimit).WithBucketsConfig(o.BucketsCfg)
+		if o.InMem {
+			opts = opts.InMem()
+		}
+		if o.Exclusive {
+			opts = opts.Exclusive()
+		}
+		if o.ReadOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	})
 }
 
 func NewMDBX() MdbxOpts {
@@ -72,11 +102,41 @@ func (opts MdbxOpts) MapSize(sz datasize.ByteSize) MdbxOpts {
 	return opts
 }
 
+// Geometry sets the sizes of the file, its MaxSize overrides MapSize
+func (opts MdbxOpts) Geometry(g Geometry) MdbxOpts {
+	opts.geometry = g
+	if g.MaxSize != 0 {
+		opts.mapSize = g.MaxSize
+	}
+	return opts
+}
+
 func (opts MdbxOpts) MaxFreelistReuse(pages uint) MdbxOpts {
 	opts.maxFreelistReuse = pages
 	return opts
 }
 
+// ReadTxLimits sets the age of the read transactions after which they are logged, DefaultReadTxWarn if zero,
+// and the one after which they are aborted, never if zero
+func (opts MdbxOpts) ReadTxLimits(warn, limit time.Duration) MdbxOpts {
+	opts.readTxWarn, opts.readTxLimit = warn, limit
+	return opts
+}
+
+// Durability sets the fsync policy of the commits, it can be switched later by MdbxKV.SetDurability
+func (opts MdbxOpts) Durability(d Durability) MdbxOpts {
+	opts.durability = d
+	return opts
+}
+
+// ReadOnly opens the database without writing anything into its directory, e.g. on a read-only
+// volume or a network filesystem. The lock table is kept in memory, so the database must not be
+// written by anyone else meanwhile.
+func (opts MdbxOpts) ReadOnly() MdbxOpts {
+	opts.flags |= mdbx.Readonly | mdbx.Accede | mdbx.Exclusive
+	return opts
+}
+
 func (opts MdbxOpts) WithBucketsConfig(f BucketConfigsFunc) MdbxOpts {
 	opts.bucketsCfg = f
 	return opts
@@ -121,6 +181,8 @@ func (opts MdbxOpts) Open() (KV, error) {
 		flags ^= mdbx.Durable
 		flags |= mdbx.NoMetaSync | mdbx.UtterlyNoSync | mdbx.WriteMap // it's ok for tests
 		opts.dirtyListMaxPages = 8 * 1024
+	} else {
+		flags |= mdbxSyncFlags(opts.durability)
 	}
 
 	if opts.maxFreelistReuse == 0 {
@@ -128,7 +190,17 @@ func (opts MdbxOpts) Open() (KV, error) {
 	}
 
 	if opts.flags&mdbx.Accede == 0 {
-		if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.GB), -1, 4*1024); err != nil {
+		initialSize, growthStep, pageSize := -1, int(DefaultGrowthStep), int(DefaultPageSize)
+		if opts.geometry.InitialSize != 0 {
+			initialSize = int(opts.geometry.InitialSize)
+		}
+		if opts.geometry.GrowthStep != 0 {
+			growthStep = int(opts.geometry.GrowthStep)
+		}
+		if opts.geometry.PageSize != 0 {
+			pageSize = int(opts.geometry.PageSize)
+		}
+		if err = env.SetGeometry(-1, initialSize, int(opts.mapSize), growthStep, -1, pageSize); err != nil {
 			return nil, err
 		}
 		if err = env.SetOption(mdbx.OptRpAugmentLimit, 32*1024*1024); err != nil {
@@ -143,6 +215,11 @@ func (opts MdbxOpts) Open() (KV, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%w, path: %s", err, opts.path)
 	}
+	if !opts.inMem && opts.flags&mdbx.Readonly == 0 {
+		if err = env.SetOption(mdbx.OptSyncPeriod, mdbxSyncPeriod(opts.durability)); err != nil {
+			return nil, err
+		}
+	}
 
 	if opts.flags&mdbx.Accede == 0 {
 		// 1/8 is good for transactions with a lot of modifications - to reduce invalidation size.
@@ -165,11 +242,12 @@ func (opts MdbxOpts) Open() (KV, error) {
 	}
 
 	db := &MdbxKV{
-		opts:    opts,
-		env:     env,
-		log:     logger,
-		wg:      &sync.WaitGroup{},
-		buckets: dbutils.BucketsCfg{},
+		opts:       opts,
+		env:        env,
+		log:        logger,
+		wg:         &sync.WaitGroup{},
+		buckets:    dbutils.BucketsCfg{},
+		durability: opts.durability,
 	}
 	customBuckets := opts.bucketsCfg(dbutils.BucketsConfigs)
 	for name, cfg := range customBuckets { // copy map to avoid changing global variable
@@ -249,6 +327,7 @@ func (opts MdbxOpts) Open() (KV, error) {
 			db.log.Debug("cleared reader slots from dead processes", "amount", staleReaders)
 		}
 	}
+	db.watchdog = newReadTxWatchdog(db.log, opts.readTxWarn, opts.readTxLimit)
 	return db, nil
 }
 
@@ -261,11 +340,85 @@ func (opts MdbxOpts) MustOpen() KV {
 }
 
 type MdbxKV struct {
-	opts    MdbxOpts
-	env     *mdbx.Env
-	log     log.Logger
-	buckets dbutils.BucketsCfg
-	wg      *sync.WaitGroup
+	opts     MdbxOpts
+	env      *mdbx.Env
+	log      log.Logger
+	buckets  dbutils.BucketsCfg
+	wg       *sync.WaitGroup
+	watchdog *readTxWatchdog
+
+	durabilityLock sync.Mutex
+	durability     Durability
+}
+
+// mdbxSyncFlags are the flags of the environment for the durability level
+func mdbxSyncFlags(d Durability) uint {
+	switch d {
+	case DurabilitySafe:
+		return mdbx.NoMetaSync
+	case DurabilityFast:
+		return mdbx.SafeNoSync
+	case DurabilityUnsafe:
+		return mdbx.UtterlyNoSync
+	default:
+		return mdbx.Durable
+	}
+}
+
+// mdbxSyncPeriod is the value of mdbx.OptSyncPeriod for the durability level, in 1/65536 of a second.
+// MDBX syncs by the first commit after the period
+func mdbxSyncPeriod(d Durability) uint64 {
+	if d != DurabilityFast {
+		return 0
+	}
+	return uint64(DurabilitySyncPeriod/time.Second) << 16
+}
+
+// SetDurability switches the fsync policy of the commits. Switching to a stricter level syncs what was
+// committed under the laxer one, so that the crash loss window of the new level holds right away
+func (db *MdbxKV) SetDurability(d Durability) error {
+	db.durabilityLock.Lock()
+	defer db.durabilityLock.Unlock()
+	if d == db.durability || db.opts.inMem || db.opts.flags&mdbx.Readonly != 0 {
+		return nil
+	}
+	if err := db.env.UnsetFlags(mdbx.NoMetaSync | mdbx.UtterlyNoSync); err != nil {
+		return err
+	}
+	if flags := mdbxSyncFlags(d); flags != 0 {
+		if err := db.env.SetFlags(flags); err != nil {
+			return err
+		}
+	}
+	if err := db.env.SetOption(mdbx.OptSyncPeriod, mdbxSyncPeriod(d)); err != nil {
+		return err
+	}
+	if d < db.durability {
+		syncStart := time.Now()
+		if err := db.env.Sync(true, false); err != nil {
+			return err
+		}
+		dbCommitSyncTimer.UpdateSince(syncStart)
+	}
+	db.log.Info("Durability switched", "from", db.durability, "to", d)
+	db.durability = d
+	return nil
+}
+
+func (db *MdbxKV) Durability() Durability {
+	db.durabilityLock.Lock()
+	defer db.durabilityLock.Unlock()
+	return db.durability
+}
+
+// GrowMaxSize raises the max size of the file online. It waits for the running write transaction to finish and
+// fails if the file can't be remapped, e.g. on the 32-bit systems
+func (db *MdbxKV) GrowMaxSize(size datasize.ByteSize) error {
+	if err := db.env.SetGeometry(-1, -1, int(size), -1, -1, -1); err != nil {
+		return err
+	}
+	db.opts.mapSize = size
+	return nil
 }
 
 func (db *MdbxKV) NewDbWithTheSameParameters() *ObjectDatabase {
@@ -283,6 +436,7 @@ func (db *MdbxKV) Close() {
 	if db.env != nil {
 		env := db.env
 		db.env = nil
+		db.watchdog.stop()
 		if err := env.Close(); err != nil {
 			db.log.Warn("failed to close DB", "err", err)
 		} else {
@@ -307,8 +461,11 @@ func (db *MdbxKV) DiskSize(_ context.Context) (uint64, error) {
 }
 
 func (db *MdbxKV) CollectMetrics() {
-	info, _ := db.env.Info()
-	dbSize.Update(int64(info.Geo.Current))
+	if info, err := db.env.Info(); err == nil {
+		dbSize.Update(int64(info.Geo.Current))
+		dbLastPage.Update(info.LastPNO)
+		dbReaders.Update(int64(info.NumReaders))
+	}
 
 	if err := db.View(context.Background(), func(tx Tx) error {
 		stat, _ := tx.(*MdbxTx).BucketStat(dbutils.PlainStorageChangeSetBucket)
@@ -340,6 +497,14 @@ func (db *MdbxKV) CollectMetrics() {
 		tableGcBranch.Update(int64(stat.BranchPages))
 		tableGcOverflow.Update(int64(stat.OverflowPages))
 		tableGcEntries.Update(int64(stat.Entries))
+
+		for _, bucket := range dbutils.Buckets {
+			stat, err := tx.(*MdbxTx).BucketStat(bucket)
+			if err != nil {
+				continue // the bucket isn't created yet
+			}
+			updateBucketMetrics(bucket, stat.PSize, stat.BranchPages, stat.LeafPages, stat.OverflowPages, stat.Entries)
+		}
 		return nil
 	}); err != nil {
 		log.Error("collecting metrics failed", "err", err)
@@ -365,6 +530,7 @@ func (db *MdbxKV) Begin(_ context.Context) (txn Tx, err error) {
 		db:       db,
 		tx:       tx,
 		readOnly: true,
+		watched:  db.watchdog.add(),
 	}, nil
 }
 
@@ -396,6 +562,7 @@ type MdbxTx struct {
 	tx       *mdbx.Txn
 	db       *MdbxKV
 	cursors  []*mdbx.Cursor
+	watched  *watchedTx // nil for the write transaction
 }
 
 type MdbxCursor struct {
@@ -625,6 +792,7 @@ func (tx *MdbxTx) Commit(ctx context.Context) error {
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
+		tx.db.watchdog.remove(tx.watched)
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
@@ -638,10 +806,22 @@ func (tx *MdbxTx) Commit(ctx context.Context) error {
 
 	tx.printDebugInfo()
 
+	_, span := tracing.Start(ctx, "db commit")
 	latency, err := tx.tx.Commit()
 	if err != nil {
+		tracing.End(span, err)
 		return err
 	}
+	span.SetAttributes(
+		attribute.Int64("gc_ms", latency.GC.Milliseconds()),
+		attribute.Int64("write_ms", latency.Write.Milliseconds()),
+		attribute.Int64("fsync_ms", latency.Sync.Milliseconds()),
+	)
+	span.End()
+	if !tx.readOnly {
+		dbCommitTimer.Update(latency.Whole)
+		dbCommitSyncTimer.Update(latency.Sync)
+	}
 
 	if latency.Whole > slowTx {
 		log.Info("Commit",
@@ -668,6 +848,7 @@ func (tx *MdbxTx) Rollback() {
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
+		tx.db.watchdog.remove(tx.watched)
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
@@ -701,6 +882,9 @@ func (tx *MdbxTx) printDebugInfo() {
 }
 
 func (tx *MdbxTx) get(dbi mdbx.DBI, key []byte) ([]byte, error) {
+	if tx.watched.expired() {
+		return nil, ErrReadTxExpired
+	}
 	return tx.tx.Get(dbi, key)
 }
 
@@ -843,6 +1027,53 @@ func (tx *MdbxTx) BucketStat(name string) (*mdbx.Stat, error) {
 	return st, nil
 }
 
+func (tx *MdbxTx) bucketStats(name string) (BucketStats, error) {
+	st, err := tx.BucketStat(name)
+	if err != nil {
+		return BucketStats{}, err
+	}
+	return BucketStats{
+		Bucket:        name,
+		Entries:       st.Entries,
+		BranchPages:   st.BranchPages,
+		LeafPages:     st.LeafPages,
+		OverflowPages: st.OverflowPages,
+		Size:          (st.BranchPages + st.LeafPages + st.OverflowPages) * uint64(st.PSize),
+	}, nil
+}
+
+func (tx *MdbxTx) spaceStats(stats *DBStats) error {
+	st, err := tx.BucketStat("gc")
+	if err != nil {
+		return err
+	}
+	stats.PageSize = uint64(st.PSize)
+	info, err := tx.tx.Info(false)
+	if err != nil {
+		return err
+	}
+	stats.FileSize = info.SpaceLimitSoft
+	stats.MaxSize = info.SpaceLimitHard
+	if stats.DiskFree, err = diskFreeSpace(tx.db.opts.path); err != nil {
+		return err
+	}
+	stats.UsedSize = info.SpaceUsed
+
+	// The pages of the GC are the PNLs of pgno_t
+	c, err := tx.tx.OpenCursor(mdbx.DBI(0))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, v, err := c.Get(nil, nil, mdbx.First); !mdbx.IsNotFound(err); _, v, err = c.Get(nil, nil, mdbx.Next) {
+		if err != nil {
+			return err
+		}
+		stats.FreePages += freePages(v, 4)
+	}
+	return nil
+}
+
 func (tx *MdbxTx) RwCursor(bucket string) RwCursor {
 	b := tx.db.buckets[bucket]
 	if b.AutoDupSortKeysConversion {
@@ -879,16 +1110,22 @@ func (tx *MdbxTx) CHandle() unsafe.Pointer {
 }
 
 // methods here help to see better pprof picture
-func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.c.Get(k, nil, mdbx.Set) }
-func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.c.Get(nil, nil, mdbx.GetCurrent) }
-func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.c.Get(nil, nil, mdbx.First) }
-func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Next) }
-func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.NextDup) }
-func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.NextNoDup) }
-func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Prev) }
-func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.PrevDup) }
-func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.PrevNoDup) }
-func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Last) }
+func (c *MdbxCursor) get(k, v []byte, op uint) ([]byte, []byte, error) {
+	if c.tx.watched.expired() {
+		return nil, nil, ErrReadTxExpired
+	}
+	return c.c.Get(k, v, op)
+}
+func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.get(k, nil, mdbx.Set) }
+func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.get(nil, nil, mdbx.GetCurrent) }
+func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.get(nil, nil, mdbx.First) }
+func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Next) }
+func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.NextDup) }
+func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.NextNoDup) }
+func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Prev) }
+func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.PrevDup) }
+func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.PrevNoDup) }
+func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Last) }
 func (c *MdbxCursor) delCurrent() error                    { return c.c.Del(mdbx.Current) }
 func (c *MdbxCursor) delNoDupData() error                  { return c.c.Del(mdbx.NoDupData) }
 func (c *MdbxCursor) put(k, v []byte) error                { return c.c.Put(k, v, 0) }
@@ -898,22 +1135,39 @@ func (c *MdbxCursor) putNoDupData(k, v []byte) error       { return c.c.Put(k, v
 func (c *MdbxCursor) append(k, v []byte) error             { return c.c.Put(k, v, mdbx.Append) }
 func (c *MdbxCursor) appendDup(k, v []byte) error          { return c.c.Put(k, v, mdbx.AppendDup) }
 func (c *MdbxCursor) getBoth(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBoth)
+	_, v, err := c.get(k, v, mdbx.GetBoth)
 	return v, err
 }
 func (c *MdbxCursor) setRange(k []byte) ([]byte, []byte, error) {
-	return c.c.Get(k, nil, mdbx.SetRange)
+	return c.get(k, nil, mdbx.SetRange)
 }
 func (c *MdbxCursor) getBothRange(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBothRange)
+	_, v, err := c.get(k, v, mdbx.GetBothRange)
 	return v, err
 }
+
+// firstDup and lastDup don't use MDBX_FIRST_DUP and MDBX_LAST_DUP, because they don't return the key
+// and mdbx-go panics on the empty key
 func (c *MdbxCursor) firstDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.FirstDup)
+	k, _, err := c.getCurrent()
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.get(k, nil, mdbx.SetKey)
 	return v, err
 }
 func (c *MdbxCursor) lastDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.LastDup)
+	if _, _, err := c.getCurrent(); err != nil {
+		return nil, err
+	}
+	if _, _, err := c.nextNoDup(); err != nil {
+		if !mdbx.IsNotFound(err) {
+			return nil, err
+		}
+		_, v, err := c.last()
+		return v, err
+	}
+	_, v, err := c.prev()
 	return v, err
 }
 
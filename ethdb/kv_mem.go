@@ -0,0 +1,922 @@
+package ethdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+var (
+	_ KV              = &MemKV{}
+	_ HasStats        = &MemKV{}
+	_ DbCopier        = &MemKV{}
+	_ RwTx            = &memTx{}
+	_ BucketMigrator  = &memTx{}
+	_ statTx          = &memTx{}
+	_ RwCursorDupSort = &memCursor{}
+)
+
+var errMemReadOnly = errors.New("write into the read-only transaction of the mem database")
+
+// MemSnapshotFile is the file of the content of the mem database opened by the path, in the directory of the path
+const MemSnapshotFile = "mem.dat"
+
+var memSnapshotMagic = []byte("tgmem\x01")
+
+type MemOpts struct {
+	snapshotFile string
+	readOnly     bool
+	bucketsCfg   BucketConfigsFunc
+	readTxWarn   time.Duration
+	readTxLimit  time.Duration
+}
+
+func init() {
+	RegisterBackend("mem", func(o BackendOpts) (KV, error) {
+		opts := NewMem().ReadTxLimits(o.ReadTxWarn, o.ReadTxLimit).WithBucketsConfig(o.BucketsCfg)
+		if !o.InMem {
+			if err := os.MkdirAll(o.Path, 0744); err != nil {
+				return nil, err
+			}
+			opts = opts.SnapshotFile(filepath.Join(o.Path, MemSnapshotFile))
+		}
+		if o.ReadOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	})
+}
+
+func NewMem() MemOpts {
+	return MemOpts{bucketsCfg: DefaultBucketConfigs}
+}
+
+// SnapshotFile - the content is loaded from the file at the open, if it exists, and saved into it at the close
+func (opts MemOpts) SnapshotFile(file string) MemOpts {
+	opts.snapshotFile = file
+	return opts
+}
+
+// ReadOnly - no write transactions, and the content isn't saved at the close
+func (opts MemOpts) ReadOnly() MemOpts {
+	opts.readOnly = true
+	return opts
+}
+
+// ReadTxLimits sets the age of the read transactions after which they are logged, DefaultReadTxWarn if zero,
+// and the one after which they are aborted, never if zero
+func (opts MemOpts) ReadTxLimits(warn, limit time.Duration) MemOpts {
+	opts.readTxWarn, opts.readTxLimit = warn, limit
+	return opts
+}
+
+func (opts MemOpts) WithBucketsConfig(f BucketConfigsFunc) MemOpts {
+	opts.bucketsCfg = f
+	return opts
+}
+
+func (opts MemOpts) Open() (KV, error) {
+	db := &MemKV{
+		opts:    opts,
+		buckets: dbutils.BucketsCfg{},
+		data:    map[string]*memBucket{},
+		wg:      &sync.WaitGroup{},
+	}
+	customBuckets := opts.bucketsCfg(dbutils.BucketsConfigs)
+	for name, cfg := range customBuckets { // copy map to avoid changing global variable
+		db.buckets[name] = cfg
+	}
+	for name, cfg := range db.buckets {
+		if !cfg.IsDeprecated {
+			db.data[name] = db.newBucket(name)
+		}
+	}
+	if opts.snapshotFile != "" {
+		if err := db.LoadFile(opts.snapshotFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	logger := log.New("mem", "inMem")
+	if opts.snapshotFile != "" {
+		logger = log.New("mem", opts.snapshotFile)
+	}
+	db.watchdog = newReadTxWatchdog(logger, opts.readTxWarn, opts.readTxLimit)
+	return db, nil
+}
+
+func (opts MemOpts) MustOpen() KV {
+	db, err := opts.Open()
+	if err != nil {
+		panic(fmt.Errorf("fail to open mem db: %w", err))
+	}
+	return db
+}
+
+// MemKV - the KV which keeps everything in memory, in the B-trees of the buckets, so the dev chains and the tests run
+// the real staged sync without the disk. The DupSort buckets keep the values of a key as the separate items, the ones
+// with AutoDupSortKeysConversion have the layout of LMDB (see autoDupCursor). The content can be saved into the file
+// and loaded back, the snapshot file is saved at the close and loaded at the open.
+//
+// The transactions are the copy-on-write clones of the committed trees: the read transactions read the trees as of
+// their start, many at once and while the write transaction is open, only one write transaction is open at a time,
+// like in LMDB. The commit of the write transaction replaces the committed trees
+type MemKV struct {
+	opts     MemOpts
+	buckets  dbutils.BucketsCfg
+	wg       *sync.WaitGroup
+	writer   sync.Mutex // held by the write transaction
+	watchdog *readTxWatchdog
+
+	lock   sync.RWMutex          // guards data and closed
+	data   map[string]*memBucket // committed trees, never written, replaced by the commit
+	closed bool
+}
+
+// memBucket is the tree of the key/values of the bucket, and their size
+type memBucket struct {
+	overlayBucket
+	size uint64 // of the keys and the values
+}
+
+func (b *memBucket) clone() *memBucket {
+	return &memBucket{overlayBucket: overlayBucket{order: b.order, tree: b.tree.Clone()}, size: b.size}
+}
+
+func (db *MemKV) newBucket(name string) *memBucket {
+	cfg := db.buckets[name]
+	order := &overlayOrder{dup: cfg.Flags&dbutils.DupSort != 0}
+	if order.dup {
+		order.cmp = dbutils.DefaultDupCmpFunc
+	}
+	return &memBucket{overlayBucket: overlayBucket{order: order, tree: btree.New(32)}}
+}
+
+// NewDbWithTheSameParameters - the empty mem database with the same buckets, without the snapshot file
+func (db *MemKV) NewDbWithTheSameParameters() *ObjectDatabase {
+	opts := db.opts
+	opts.snapshotFile, opts.readOnly = "", false
+	return NewObjectDatabase(opts.MustOpen())
+}
+
+// committed returns the committed trees, nil after the close
+func (db *MemKV) committed() map[string]*memBucket {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return nil
+	}
+	return db.data
+}
+
+// Close closes db, and saves it into the snapshot file, if any
+// All transactions must be closed before closing the database.
+func (db *MemKV) Close() {
+	db.lock.Lock()
+	if db.closed {
+		db.lock.Unlock()
+		return
+	}
+	db.lock.Unlock()
+	db.wg.Wait()
+	db.watchdog.stop()
+	if db.opts.snapshotFile != "" && !db.opts.readOnly {
+		if err := db.SaveFile(db.opts.snapshotFile); err != nil {
+			log.Error("Saving the mem database failed", "file", db.opts.snapshotFile, "err", err)
+		}
+	}
+	db.lock.Lock()
+	db.closed = true
+	db.data = map[string]*memBucket{}
+	db.lock.Unlock()
+}
+
+func (db *MemKV) DiskSize(_ context.Context) (uint64, error) {
+	var size uint64
+	for _, b := range db.committed() {
+		size += b.size
+	}
+	return size, nil
+}
+
+func (db *MemKV) CollectMetrics() {
+	data := db.committed()
+	var size uint64
+	for name, b := range data {
+		size += b.size
+		updateBucketMetrics(name, 1, 0, b.size, 0, uint64(b.tree.Len()))
+	}
+	dbSize.Update(int64(size))
+}
+
+func (db *MemKV) AllBuckets() dbutils.BucketsCfg {
+	return db.buckets
+}
+
+// Begin - the read transaction reads the trees committed before it started
+func (db *MemKV) Begin(_ context.Context) (Tx, error) {
+	data := db.committed()
+	if data == nil {
+		return nil, fmt.Errorf("db closed")
+	}
+	db.wg.Add(1)
+	return &memTx{db: db, data: data, watched: db.watchdog.add()}, nil
+}
+
+// BeginRw - waits for the write transaction open, if any
+func (db *MemKV) BeginRw(_ context.Context) (RwTx, error) {
+	if db.opts.readOnly {
+		return nil, fmt.Errorf("mem database is open read-only")
+	}
+	db.writer.Lock()
+	committed := db.committed()
+	if committed == nil {
+		db.writer.Unlock()
+		return nil, fmt.Errorf("db closed")
+	}
+	data := make(map[string]*memBucket, len(committed))
+	for name, b := range committed {
+		data[name] = b.clone()
+	}
+	db.wg.Add(1)
+	return &memTx{db: db, data: data, rw: true}, nil
+}
+
+func (db *MemKV) View(ctx context.Context, f func(tx Tx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *MemKV) Update(ctx context.Context, f func(tx RwTx) error) (err error) {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Save writes the content of the database as of the start into w: the magic, then every bucket as its name, the
+// number of its key/values and the key/values, all the lengths are uvarints, and the empty name at the end
+func (db *MemKV) Save(w io.Writer) error {
+	return db.View(context.Background(), func(tx Tx) error {
+		data := tx.(*memTx).data
+		names := make([]string, 0, len(data))
+		for name := range data {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		bw := bufio.NewWriterSize(w, 1024*1024)
+		if _, err := bw.Write(memSnapshotMagic); err != nil {
+			return err
+		}
+		var err error
+		writeBytes := func(b []byte) {
+			if err != nil {
+				return
+			}
+			var l [binary.MaxVarintLen64]byte
+			if _, err = bw.Write(l[:binary.PutUvarint(l[:], uint64(len(b)))]); err == nil {
+				_, err = bw.Write(b)
+			}
+		}
+		for _, name := range names {
+			b := data[name]
+			writeBytes([]byte(name))
+			var l [binary.MaxVarintLen64]byte
+			if err == nil {
+				_, err = bw.Write(l[:binary.PutUvarint(l[:], uint64(b.tree.Len()))])
+			}
+			b.tree.Ascend(func(i btree.Item) bool {
+				writeBytes(i.(*overlayItem).k)
+				writeBytes(i.(*overlayItem).v)
+				return err == nil
+			})
+			if err != nil {
+				return fmt.Errorf("saving %s: %w", name, err)
+			}
+		}
+		writeBytes(nil)
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// Load replaces the content of the database with the one written by Save, the buckets which aren't in it are empty
+func (db *MemKV) Load(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	magic := make([]byte, len(memSnapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("reading the magic of the mem snapshot: %w", err)
+	}
+	if !bytes.Equal(magic, memSnapshotMagic) {
+		return fmt.Errorf("not a mem snapshot, or of another version: %x", magic)
+	}
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+
+	data := map[string]*memBucket{}
+	for name, cfg := range db.buckets {
+		if !cfg.IsDeprecated {
+			data[name] = db.newBucket(name)
+		}
+	}
+	for {
+		name, err := readBytes()
+		if err != nil {
+			return fmt.Errorf("reading the mem snapshot: %w", err)
+		}
+		if len(name) == 0 {
+			break
+		}
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", name, err)
+		}
+		b := db.newBucket(string(name))
+		for i := uint64(0); i < count; i++ {
+			k, err := readBytes()
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", name, err)
+			}
+			v, err := readBytes()
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", name, err)
+			}
+			b.tree.ReplaceOrInsert(&overlayItem{order: b.order, k: k, v: v})
+			b.size += uint64(len(k) + len(v))
+		}
+		data[string(name)] = b
+	}
+
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.closed {
+		return fmt.Errorf("db closed")
+	}
+	db.data = data
+	return nil
+}
+
+// SaveFile saves the content into the file, atomically: into the temporary file first, which then replaces it
+func (db *MemKV) SaveFile(file string) error {
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = db.Save(f); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// LoadFile loads the content saved by SaveFile, the error is os.ErrNotExist if there is no file
+func (db *MemKV) LoadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = db.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+type memTx struct {
+	db      *MemKV
+	data    map[string]*memBucket
+	rw      bool
+	watched *watchedTx // nil for the write transaction
+	done    bool
+}
+
+func (tx *memTx) close() {
+	tx.done = true
+	if tx.rw {
+		tx.db.writer.Unlock()
+	} else {
+		tx.db.watchdog.remove(tx.watched)
+	}
+	tx.db.wg.Done()
+}
+
+// check fails the reads and the writes of the closed and of the aborted transactions
+func (tx *memTx) check() error {
+	if tx.done {
+		return fmt.Errorf("the transaction of the mem database is closed")
+	}
+	if tx.watched.expired() {
+		return ErrReadTxExpired
+	}
+	return nil
+}
+
+func (tx *memTx) bucket(name string) (*memBucket, error) {
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	b, ok := tx.data[name]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s doesn't exist", name)
+	}
+	return b, nil
+}
+
+// Commit - makes the trees of the transaction the committed ones
+func (tx *memTx) Commit(_ context.Context) error {
+	if tx.done {
+		return nil
+	}
+	defer tx.close()
+	if tx.rw {
+		tx.db.lock.Lock()
+		tx.db.data = tx.data
+		tx.db.lock.Unlock()
+	}
+	return nil
+}
+
+func (tx *memTx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.close()
+}
+
+func (tx *memTx) Cursor(bucket string) Cursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *memTx) CursorDupSort(bucket string) CursorDupSort {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *memTx) RwCursor(bucket string) RwCursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *memTx) RwCursorDupSort(bucket string) RwCursorDupSort {
+	c := &memCursor{tx: tx, bucket: bucket}
+	if b, ok := tx.data[bucket]; ok {
+		c.dup = b.order.dup
+	}
+	if cfg := tx.db.buckets[bucket]; cfg.AutoDupSortKeysConversion {
+		return newAutoDupCursor(c, bucket, cfg)
+	}
+	return c
+}
+
+func (tx *memTx) GetOne(bucket string, key []byte) ([]byte, error) {
+	b, err := tx.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if b.order.dup {
+		c := tx.Cursor(bucket)
+		defer c.Close()
+		_, v, err := c.SeekExact(key)
+		return v, err
+	}
+	if item := b.tree.Get(&overlayItem{order: b.order, k: key}); item != nil {
+		return item.(*overlayItem).v, nil
+	}
+	return nil, nil
+}
+
+func (tx *memTx) HasOne(bucket string, key []byte) (bool, error) {
+	b, err := tx.bucket(bucket)
+	if err != nil {
+		return false, err
+	}
+	if b.order.dup {
+		item := b.ge(key, nil, false)
+		return item != nil && bytes.Equal(item.k, key), nil
+	}
+	return b.tree.Has(&overlayItem{order: b.order, k: key}), nil
+}
+
+func (tx *memTx) IncrementSequence(bucket string, amount uint64) (uint64, error) {
+	current, err := tx.ReadSequence(bucket)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	c := tx.RwCursor(dbutils.Sequence)
+	defer c.Close()
+	if err = c.Put([]byte(bucket), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (tx *memTx) ReadSequence(bucket string) (uint64, error) {
+	v, err := tx.GetOne(dbutils.Sequence, []byte(bucket))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// BucketSize - the size of the keys and the values, without the overhead of the trees
+func (tx *memTx) BucketSize(name string) (uint64, error) {
+	b, err := tx.bucket(name)
+	if err != nil {
+		return 0, err
+	}
+	return b.size, nil
+}
+
+func (tx *memTx) bucketStats(name string) (BucketStats, error) {
+	b, err := tx.bucket(name)
+	if err != nil {
+		return BucketStats{}, err
+	}
+	return BucketStats{Bucket: name, Entries: uint64(b.tree.Len()), Size: b.size}, nil
+}
+
+// spaceStats - the mem database has no pages and no max size, the disk it's saved to limits it
+func (tx *memTx) spaceStats(stats *DBStats) error {
+	dir := os.TempDir()
+	if tx.db.opts.snapshotFile != "" {
+		dir = filepath.Dir(tx.db.opts.snapshotFile)
+	}
+	diskFree, err := diskFreeSpace(dir)
+	if err != nil {
+		return err
+	}
+	for _, b := range tx.data {
+		stats.UsedSize += b.size
+	}
+	stats.FileSize = stats.UsedSize
+	stats.DiskFree = diskFree
+	stats.MaxSize = stats.UsedSize + diskFree
+	return nil
+}
+
+// Comparator - the keys and the values of the DupSort buckets are always compared bytewise, the custom comparators
+// of LMDB and MDBX are only set for the deprecated buckets
+func (tx *memTx) Comparator(bucket string) dbutils.CmpFunc {
+	if b, ok := tx.data[bucket]; ok && b.order.dup {
+		return dbutils.DefaultDupCmpFunc
+	}
+	return dbutils.DefaultCmpFunc
+}
+
+// CHandle - the mem database has no C transaction, the code which needs it can't run on top of it
+func (tx *memTx) CHandle() unsafe.Pointer {
+	return nil
+}
+
+func (tx *memTx) DropBucket(name string) error {
+	if !tx.rw {
+		return errMemReadOnly
+	}
+	if cfg, ok := tx.db.buckets[name]; !(ok && cfg.IsDeprecated) {
+		return fmt.Errorf("%w, bucket: %s", ErrAttemptToDeleteNonDeprecatedBucket, name)
+	}
+	delete(tx.data, name)
+	return nil
+}
+
+func (tx *memTx) CreateBucket(name string) error {
+	if !tx.rw {
+		return errMemReadOnly
+	}
+	if _, ok := tx.data[name]; !ok {
+		tx.data[name] = tx.db.newBucket(name)
+	}
+	return nil
+}
+
+func (tx *memTx) ExistsBucket(name string) bool {
+	_, ok := tx.data[name]
+	return ok
+}
+
+func (tx *memTx) ClearBucket(name string) error {
+	if !tx.rw {
+		return errMemReadOnly
+	}
+	if _, ok := tx.data[name]; ok {
+		tx.data[name] = tx.db.newBucket(name)
+	}
+	return nil
+}
+
+func (tx *memTx) ExistingBuckets() ([]string, error) {
+	buckets := make([]string, 0, len(tx.data))
+	for name := range tx.data {
+		buckets = append(buckets, name)
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// memCursor is the position in the tree of the bucket, kept as the key/value it points to. Every move seeks
+// the tree from that position, so the writes through the cursor, or the other cursors of the same transaction,
+// are always visible
+type memCursor struct {
+	tx     *memTx
+	bucket string
+	dup    bool
+
+	k, v []byte // current position, nil if not positioned
+}
+
+// seek moves the cursor to the first (last if backward) key/value at the position (k, v) or after (before) it,
+// strictly after (before) if strict. nil value of the dup bucket stands for all the values of the key, nil k is
+// the start (end) of the bucket
+func (c *memCursor) seek(k, v []byte, strict, backward bool) ([]byte, []byte, error) {
+	b, err := c.tx.bucket(c.bucket)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	var item btree.Item
+	switch {
+	case k == nil && backward:
+		item = b.tree.Max()
+	case k == nil:
+		item = b.tree.Min()
+	case backward:
+		if found := b.le(k, v, strict); found != nil {
+			item = found
+		}
+	default:
+		if found := b.ge(k, v, strict); found != nil {
+			item = found
+		}
+	}
+	if item == nil {
+		c.k, c.v = nil, nil
+		return nil, nil, nil
+	}
+	c.k, c.v = item.(*overlayItem).k, item.(*overlayItem).v
+	return c.k, c.v, nil
+}
+
+// position is the value which stands for the current position in the seeks
+func (c *memCursor) position() []byte {
+	if !c.dup {
+		return nil
+	}
+	return c.v
+}
+
+func (c *memCursor) First() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, false)
+}
+
+func (c *memCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.seek(seek, nil, false, false)
+}
+
+func (c *memCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, nil, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *memCursor) Next() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.seek(c.k, c.position(), true, false)
+}
+
+func (c *memCursor) Prev() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.Last()
+	}
+	return c.seek(c.k, c.position(), true, true)
+}
+
+func (c *memCursor) Last() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, true)
+}
+
+func (c *memCursor) Current() ([]byte, []byte, error) {
+	return c.k, c.v, nil
+}
+
+func (c *memCursor) Count() (uint64, error) {
+	b, err := c.tx.bucket(c.bucket)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(b.tree.Len()), nil
+}
+
+func (c *memCursor) Close() {}
+
+// put writes the key/value and moves the cursor to it
+func (c *memCursor) put(k, v []byte) error {
+	b, err := c.tx.bucket(c.bucket)
+	if err != nil {
+		return err
+	}
+	if !c.tx.rw {
+		return errMemReadOnly
+	}
+	item := &overlayItem{order: b.order, k: common.CopyBytes(k), v: common.CopyBytes(v)}
+	if item.v == nil {
+		item.v = []byte{}
+	}
+	if old := b.tree.ReplaceOrInsert(item); old != nil {
+		b.size -= uint64(len(old.(*overlayItem).k) + len(old.(*overlayItem).v))
+	}
+	b.size += uint64(len(item.k) + len(item.v))
+	c.k, c.v = item.k, item.v
+	return nil
+}
+
+// delete deletes the key/value, any value of the key if not dup
+func (c *memCursor) delete(k, v []byte) error {
+	b, err := c.tx.bucket(c.bucket)
+	if err != nil {
+		return err
+	}
+	if !c.tx.rw {
+		return errMemReadOnly
+	}
+	if old := b.tree.Delete(&overlayItem{order: b.order, k: k, v: v}); old != nil {
+		b.size -= uint64(len(old.(*overlayItem).k) + len(old.(*overlayItem).v))
+	}
+	return nil
+}
+
+func (c *memCursor) Put(k, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *memCursor) Append(k []byte, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *memCursor) AppendDup(k []byte, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *memCursor) Delete(k, v []byte) error {
+	if !c.dup {
+		return c.delete(k, nil)
+	}
+	if v != nil {
+		return c.delete(k, v)
+	}
+	if found, _, err := c.SeekExact(k); err != nil || found == nil {
+		return err
+	}
+	return c.DeleteCurrentDuplicates()
+}
+
+// DeleteCurrent - the cursor stays at the deleted key/value, Next moves to the one after it
+func (c *memCursor) DeleteCurrent() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of the mem database is not positioned")
+	}
+	return c.delete(c.k, c.position())
+}
+
+func (c *memCursor) DeleteCurrentDuplicates() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of the mem database is not positioned")
+	}
+	key := c.k
+	var values [][]byte
+	for k, v, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, v, err = c.seek(k, v, true, false) {
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		if err := c.delete(key, v); err != nil {
+			return err
+		}
+	}
+	c.k = key
+	return nil
+}
+
+func (c *memCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) || !bytes.Equal(v, value) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *memCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *memCursor) FirstDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(c.k, nil, false, false)
+	return v, err
+}
+
+// NextDup - at the last value of the key returns nil and stays there
+func (c *memCursor) NextDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	key, value := c.k, c.v
+	k, v, err := c.seek(key, value, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(k, key) {
+		c.k, c.v = key, value
+		return nil, nil, nil
+	}
+	return k, v, nil
+}
+
+func (c *memCursor) NextNoDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.seek(c.k, nil, true, false)
+}
+
+func (c *memCursor) LastDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(c.k, nil, false, true)
+	return v, err
+}
+
+func (c *memCursor) CountDuplicates() (uint64, error) {
+	if c.k == nil {
+		return 0, nil
+	}
+	key, value := c.k, c.v
+	var count uint64
+	for k, v, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, v, err = c.seek(k, v, true, false) {
+		if err != nil {
+			return 0, err
+		}
+		count++
+		if !c.dup {
+			break
+		}
+	}
+	c.k, c.v = key, value
+	return count, nil
+}
@@ -0,0 +1,97 @@
+package ethdb
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemKV(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(42))
+	file := filepath.Join(t.TempDir(), MemSnapshotFile)
+	mem, expected := NewMem().SnapshotFile(file).MustOpen(), NewLMDB().InMem().MustOpen()
+	defer expected.Close()
+
+	// The read transaction opened before the writes doesn't see them
+	before, err := mem.Begin(ctx)
+	require.NoError(t, err)
+	for round := 0; round < 5; round++ {
+		memTx, err := mem.BeginRw(ctx)
+		require.NoError(t, err)
+		expectedTx, err := expected.BeginRw(ctx)
+		require.NoError(t, err)
+		overlayTestOps(t, rnd, memTx, expectedTx)
+		require.NoError(t, memTx.Commit(ctx))
+		require.NoError(t, expectedTx.Commit(ctx))
+	}
+	for _, bucket := range overlayTestBuckets {
+		require.Empty(t, overlayTestDump(t, before, bucket, false))
+	}
+	before.Rollback()
+
+	check := func(mem KV) {
+		require.NoError(t, expected.View(ctx, func(expectedTx Tx) error {
+			return mem.View(ctx, func(tx Tx) error {
+				for _, bucket := range overlayTestBuckets {
+					require.Equal(t, overlayTestDump(t, expectedTx, bucket, false), overlayTestDump(t, tx, bucket, false), bucket)
+					require.Equal(t, overlayTestDump(t, expectedTx, bucket, true), overlayTestDump(t, tx, bucket, true), bucket)
+
+					var size uint64
+					c := tx.Cursor(bucket)
+					for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+						require.NoError(t, err)
+						size += uint64(len(k) + len(v))
+					}
+					c.Close()
+					bucketSize, err := tx.BucketSize(bucket)
+					require.NoError(t, err)
+					require.Equal(t, size, bucketSize, bucket)
+				}
+
+				// The storage is read by the account in the layout of LMDB
+				to := dbutils.BucketsConfigs[dbutils.PlainStateBucket].DupToLen
+				c1, c2 := expectedTx.CursorDupSort(dbutils.PlainStateBucket), tx.CursorDupSort(dbutils.PlainStateBucket)
+				defer c1.Close()
+				defer c2.Close()
+				for i := 1; i < 64; i += 2 {
+					key := overlayTestKey(dbutils.PlainStateBucket, i)
+					v1, _ := c1.SeekBothRange(key[:to], key[to:])
+					v2, err := c2.SeekBothRange(key[:to], key[to:])
+					require.NoError(t, err)
+					require.Equal(t, v1, v2)
+					if v1 == nil {
+						continue
+					}
+					k1, v1, _ := c1.NextDup()
+					k2, v2, err := c2.NextDup()
+					require.NoError(t, err)
+					require.Equal(t, k1, k2)
+					require.Equal(t, v1, v2)
+				}
+				return nil
+			})
+		}))
+	}
+	check(mem)
+
+	// The content is saved at the close and loaded at the open
+	mem.Close()
+	mem = NewMem().SnapshotFile(file).ReadOnly().MustOpen()
+	defer mem.Close()
+	check(mem)
+	_, err = mem.BeginRw(ctx)
+	require.Error(t, err)
+
+	require.NoError(t, mem.View(ctx, func(tx Tx) error {
+		stats, err := BucketsStat(tx)
+		require.NoError(t, err)
+		require.NotEmpty(t, stats.Buckets)
+		require.NotZero(t, stats.UsedSize)
+		return nil
+	}))
+}
@@ -0,0 +1,709 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+var (
+	_ KV              = &OverlayKV{}
+	_ RwTx            = &overlayTx{}
+	_ BucketMigrator  = &overlayTx{}
+	_ RwCursorDupSort = &overlayCursor{}
+)
+
+var errOverlayReadOnly = errors.New("write into the read-only transaction of the overlay")
+
+// OverlayKV - in-memory KV on top of the read-only transaction of another KV. The writes of the committed transactions
+// of the overlay are kept in memory and shadow the base, the deletions are kept as tombstones. Nothing is ever written
+// into the base, so the overlay can be used to execute blocks speculatively - to build the pending block, to try
+// the reorg - without touching the real buckets, and without holding the write transaction of the database.
+//
+// The overlay is used from one goroutine, like the transaction under it, which has to outlive the overlay.
+// Close of the overlay drops the writes, but doesn't roll back the base transaction.
+type OverlayKV struct {
+	base    Tx
+	buckets dbutils.BucketsCfg
+	data    map[string]*overlayBucket // committed writes, replaced by the commit of the write transaction
+	writer  bool                      // write transaction is open
+}
+
+// NewOverlayKV creates the empty overlay on top of the base transaction, buckets is the configuration of the
+// buckets of the base, usually the AllBuckets of its KV
+func NewOverlayKV(base Tx, buckets dbutils.BucketsCfg) *OverlayKV {
+	return &OverlayKV{base: base, buckets: buckets, data: map[string]*overlayBucket{}}
+}
+
+func (db *OverlayKV) View(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *OverlayKV) Update(ctx context.Context, f func(tx RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *OverlayKV) Close() {
+	db.data = map[string]*overlayBucket{}
+}
+
+func (db *OverlayKV) CollectMetrics() {}
+
+// Begin - the read-only transaction sees the writes committed before it started
+func (db *OverlayKV) Begin(_ context.Context) (Tx, error) {
+	return &overlayTx{db: db, data: db.data}, nil
+}
+
+// BeginRw - the write transaction works on the copy-on-write clone of the committed writes, only one can be open
+func (db *OverlayKV) BeginRw(_ context.Context) (RwTx, error) {
+	if db.writer {
+		return nil, fmt.Errorf("the write transaction of the overlay is open already")
+	}
+	data := make(map[string]*overlayBucket, len(db.data))
+	for name, b := range db.data {
+		data[name] = &overlayBucket{order: b.order, tree: b.tree.Clone(), cleared: b.cleared}
+	}
+	db.writer = true
+	return &overlayTx{db: db, data: data, rw: true}, nil
+}
+
+func (db *OverlayKV) AllBuckets() dbutils.BucketsCfg {
+	return db.buckets
+}
+
+// overlayOrder is the order of the key/values of the bucket
+type overlayOrder struct {
+	dup bool            // the values of the same key are the separate items, like in the DupSort bucket
+	cmp dbutils.CmpFunc // comparator of the values of the same key, if dup
+}
+
+// compare compares the positions in the bucket. nil value of the dup bucket is the position before all the values
+// of the key
+func (o *overlayOrder) compare(k1, v1, k2, v2 []byte) int {
+	if c := bytes.Compare(k1, k2); c != 0 || !o.dup {
+		return c
+	}
+	switch {
+	case v1 == nil && v2 == nil:
+		return 0
+	case v1 == nil:
+		return -1
+	case v2 == nil:
+		return 1
+	}
+	return o.cmp(k1, k2, v1, v2)
+}
+
+// overlayItem is the key/value written into the overlay, or the tombstone of the deleted one
+type overlayItem struct {
+	order   *overlayOrder
+	k, v    []byte
+	deleted bool
+}
+
+func (i *overlayItem) Less(than btree.Item) bool {
+	other := than.(*overlayItem)
+	return i.order.compare(i.k, i.v, other.k, other.v) < 0
+}
+
+type overlayBucket struct {
+	order   *overlayOrder
+	tree    *btree.BTree
+	cleared bool // the bucket was cleared, the base is not visible anymore
+}
+
+// ge returns the first item at the position (k, v) or after it, strictly after if strict. nil value of the dup
+// bucket stands for all the values of the key
+func (b *overlayBucket) ge(k, v []byte, strict bool) *overlayItem {
+	var found *overlayItem
+	b.tree.AscendGreaterOrEqual(&overlayItem{order: b.order, k: k, v: v}, func(i btree.Item) bool {
+		item := i.(*overlayItem)
+		if strict && bytes.Equal(item.k, k) && (v == nil || !b.order.dup || bytes.Equal(item.v, v)) {
+			return true
+		}
+		found = item
+		return false
+	})
+	return found
+}
+
+// le returns the last item at the position (k, v) or before it, strictly before if strict
+func (b *overlayBucket) le(k, v []byte, strict bool) *overlayItem {
+	var found *overlayItem
+	next := b.ge(k, v, !strict)
+	if next == nil {
+		if last := b.tree.Max(); last != nil {
+			found = last.(*overlayItem)
+		}
+		return found
+	}
+	b.tree.DescendLessOrEqual(next, func(i btree.Item) bool {
+		if i == next {
+			return true
+		}
+		found = i.(*overlayItem)
+		return false
+	})
+	return found
+}
+
+type overlayTx struct {
+	db   *OverlayKV
+	data map[string]*overlayBucket
+	rw   bool
+	done bool
+}
+
+func (tx *overlayTx) isDup(bucket string) bool {
+	cfg := tx.db.buckets[bucket]
+	return cfg.Flags&dbutils.DupSort != 0 && !cfg.AutoDupSortKeysConversion
+}
+
+// bucket returns the writes into the bucket, creates the empty ones if create
+func (tx *overlayTx) bucket(name string, create bool) *overlayBucket {
+	b, ok := tx.data[name]
+	if ok || !create {
+		return b
+	}
+	order := &overlayOrder{dup: tx.isDup(name)}
+	if order.dup {
+		order.cmp = tx.db.base.Comparator(name)
+	}
+	b = &overlayBucket{order: order, tree: btree.New(32)}
+	tx.data[name] = b
+	return b
+}
+
+func (tx *overlayTx) Cursor(bucket string) Cursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *overlayTx) CursorDupSort(bucket string) CursorDupSort {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *overlayTx) RwCursor(bucket string) RwCursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *overlayTx) RwCursorDupSort(bucket string) RwCursorDupSort {
+	c := &overlayCursor{tx: tx, bucket: bucket, dup: tx.isDup(bucket)}
+	if b := tx.bucket(bucket, false); b == nil || !b.cleared {
+		if c.dup {
+			c.baseDup = tx.db.base.CursorDupSort(bucket)
+			c.base = c.baseDup
+		} else {
+			c.base = tx.db.base.Cursor(bucket)
+		}
+	}
+	return c
+}
+
+func (tx *overlayTx) GetOne(bucket string, key []byte) ([]byte, error) {
+	if tx.isDup(bucket) {
+		c := tx.Cursor(bucket)
+		defer c.Close()
+		_, v, err := c.SeekExact(key)
+		return v, err
+	}
+	b := tx.bucket(bucket, false)
+	if b != nil {
+		if item := b.tree.Get(&overlayItem{order: b.order, k: key}); item != nil {
+			if item.(*overlayItem).deleted {
+				return nil, nil
+			}
+			return item.(*overlayItem).v, nil
+		}
+		if b.cleared {
+			return nil, nil
+		}
+	}
+	return tx.db.base.GetOne(bucket, key)
+}
+
+func (tx *overlayTx) HasOne(bucket string, key []byte) (bool, error) {
+	if tx.isDup(bucket) {
+		c := tx.Cursor(bucket)
+		defer c.Close()
+		k, _, err := c.SeekExact(key)
+		return k != nil, err
+	}
+	b := tx.bucket(bucket, false)
+	if b != nil {
+		if item := b.tree.Get(&overlayItem{order: b.order, k: key}); item != nil {
+			return !item.(*overlayItem).deleted, nil
+		}
+		if b.cleared {
+			return false, nil
+		}
+	}
+	return tx.db.base.HasOne(bucket, key)
+}
+
+func (tx *overlayTx) IncrementSequence(bucket string, amount uint64) (uint64, error) {
+	current, err := tx.ReadSequence(bucket)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	c := tx.RwCursor(dbutils.Sequence)
+	defer c.Close()
+	if err = c.Put([]byte(bucket), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (tx *overlayTx) ReadSequence(bucket string) (uint64, error) {
+	v, err := tx.GetOne(dbutils.Sequence, []byte(bucket))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// Commit - makes the writes of the transaction visible to the next transactions of the overlay, not to the base
+func (tx *overlayTx) Commit(_ context.Context) error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	if tx.rw {
+		tx.db.data = tx.data
+		tx.db.writer = false
+	}
+	return nil
+}
+
+func (tx *overlayTx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	if tx.rw {
+		tx.db.writer = false
+	}
+}
+
+func (tx *overlayTx) BucketSize(name string) (uint64, error) {
+	return tx.db.base.BucketSize(name)
+}
+
+func (tx *overlayTx) Comparator(bucket string) dbutils.CmpFunc {
+	return tx.db.base.Comparator(bucket)
+}
+
+// CHandle - the overlay has no C transaction under it, the code which needs it can't run on top of the overlay
+func (tx *overlayTx) CHandle() unsafe.Pointer {
+	return nil
+}
+
+func (tx *overlayTx) DropBucket(name string) error {
+	return fmt.Errorf("can't drop the bucket %s of the overlay", name)
+}
+
+func (tx *overlayTx) CreateBucket(name string) error {
+	return fmt.Errorf("can't create the bucket %s of the overlay", name)
+}
+
+func (tx *overlayTx) ExistsBucket(name string) bool {
+	if migrator, ok := tx.db.base.(BucketMigrator); ok {
+		return migrator.ExistsBucket(name)
+	}
+	_, ok := tx.db.buckets[name]
+	return ok
+}
+
+// ClearBucket - hides the base of the bucket, instead of deleting its keys one by one
+func (tx *overlayTx) ClearBucket(name string) error {
+	if !tx.rw {
+		return errOverlayReadOnly
+	}
+	b := tx.bucket(name, true)
+	b.tree = btree.New(32)
+	b.cleared = true
+	return nil
+}
+
+func (tx *overlayTx) ExistingBuckets() ([]string, error) {
+	if migrator, ok := tx.db.base.(BucketMigrator); ok {
+		return migrator.ExistingBuckets()
+	}
+	buckets := make([]string, 0, len(tx.db.buckets))
+	for name, cfg := range tx.db.buckets {
+		if !cfg.IsDeprecated {
+			buckets = append(buckets, name)
+		}
+	}
+	return buckets, nil
+}
+
+// overlayCursor merges the writes of the overlay with the cursor of the base. The position is kept as the key/value
+// it points to, every move seeks both of them from that position, so the writes through the cursor, or the other
+// cursors of the same transaction, are always visible
+type overlayCursor struct {
+	tx      *overlayTx
+	bucket  string
+	dup     bool
+	base    Cursor        // nil if the bucket was cleared
+	baseDup CursorDupSort // base, if dup
+
+	k, v []byte // current position, nil if not positioned
+}
+
+// baseGE is the first key/value of the base at the position or after it, strictly after if strict
+func (c *overlayCursor) baseGE(k, v []byte, strict bool) ([]byte, []byte, error) {
+	if c.base == nil {
+		return nil, nil, nil
+	}
+	if k == nil {
+		return c.base.First()
+	}
+	bk, bv, err := c.base.Seek(k)
+	if err != nil || bk == nil || !bytes.Equal(bk, k) {
+		return bk, bv, err
+	}
+	if !c.dup {
+		if strict {
+			return c.base.Next()
+		}
+		return bk, bv, nil
+	}
+	if v != nil {
+		if bv, err = c.baseDup.SeekBothRange(k, v); err != nil {
+			return nil, nil, err
+		}
+		if bv != nil && strict && bytes.Equal(bv, v) {
+			if _, bv, err = c.baseDup.NextDup(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if bv != nil {
+			return k, bv, nil
+		}
+	} else if !strict {
+		return bk, bv, nil
+	}
+	// No more values of the key
+	if _, _, err = c.base.Seek(k); err != nil {
+		return nil, nil, err
+	}
+	return c.baseDup.NextNoDup()
+}
+
+// baseLE is the last key/value of the base at the position or before it, strictly before if strict
+func (c *overlayCursor) baseLE(k, v []byte, strict bool) ([]byte, []byte, error) {
+	if c.base == nil {
+		return nil, nil, nil
+	}
+	if k == nil {
+		return c.base.Last()
+	}
+	next, _, err := c.baseGE(k, v, !strict)
+	if err != nil {
+		return nil, nil, err
+	}
+	if next == nil {
+		return c.base.Last()
+	}
+	return c.base.Prev()
+}
+
+// seek moves the cursor to the first (last if backward) key/value of the merged view at the position (k, v) or
+// after (before) it, strictly after (before) if strict, skipping the deleted ones. nil k is the start (end)
+// of the bucket
+func (c *overlayCursor) seek(k, v []byte, strict, backward bool) ([]byte, []byte, error) {
+	b := c.tx.bucket(c.bucket, false)
+	for {
+		var bk, bv []byte
+		var err error
+		var item *overlayItem
+		if backward {
+			bk, bv, err = c.baseLE(k, v, strict)
+			if b != nil {
+				if k == nil {
+					if last := b.tree.Max(); last != nil {
+						item = last.(*overlayItem)
+					}
+				} else {
+					item = b.le(k, v, strict)
+				}
+			}
+		} else {
+			bk, bv, err = c.baseGE(k, v, strict)
+			if b != nil {
+				item = b.ge(k, v, strict)
+			}
+		}
+		if err != nil {
+			return []byte{}, nil, err
+		}
+
+		if item == nil && bk == nil {
+			c.k, c.v = nil, nil
+			return nil, nil, nil
+		}
+		if item != nil && bk != nil {
+			cmp := c.order().compare(bk, bv, item.k, item.v)
+			if backward {
+				cmp = -cmp
+			}
+			if cmp < 0 {
+				item = nil // the base is closer
+			}
+		}
+		if item == nil {
+			c.k, c.v = common.CopyBytes(bk), common.CopyBytes(bv)
+			return c.k, c.v, nil
+		}
+		if !item.deleted {
+			c.k, c.v = item.k, item.v
+			return c.k, c.v, nil
+		}
+		k, v, strict = item.k, item.v, true
+		if !c.dup {
+			v = nil
+		}
+	}
+}
+
+func (c *overlayCursor) order() *overlayOrder {
+	if b := c.tx.bucket(c.bucket, false); b != nil {
+		return b.order
+	}
+	return &overlayOrder{dup: c.dup}
+}
+
+// position is the value which stands for the current position in the seeks
+func (c *overlayCursor) position() []byte {
+	if !c.dup {
+		return nil
+	}
+	return c.v
+}
+
+func (c *overlayCursor) First() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, false)
+}
+
+func (c *overlayCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.seek(seek, nil, false, false)
+}
+
+func (c *overlayCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, nil, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *overlayCursor) Next() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.seek(c.k, c.position(), true, false)
+}
+
+func (c *overlayCursor) Prev() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.Last()
+	}
+	return c.seek(c.k, c.position(), true, true)
+}
+
+func (c *overlayCursor) Last() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, true)
+}
+
+func (c *overlayCursor) Current() ([]byte, []byte, error) {
+	return c.k, c.v, nil
+}
+
+// Count - number of the key/values of the merged view, counted one by one
+func (c *overlayCursor) Count() (uint64, error) {
+	counter := c.tx.RwCursorDupSort(c.bucket)
+	defer counter.Close()
+	var count uint64
+	for k, _, err := counter.First(); k != nil; k, _, err = counter.Next() {
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (c *overlayCursor) Close() {
+	if c.base != nil {
+		c.base.Close()
+	}
+}
+
+// put writes the item into the overlay and moves the cursor to it
+func (c *overlayCursor) put(k, v []byte, deleted bool) error {
+	if !c.tx.rw {
+		return errOverlayReadOnly
+	}
+	b := c.tx.bucket(c.bucket, true)
+	item := &overlayItem{order: b.order, k: common.CopyBytes(k), v: common.CopyBytes(v), deleted: deleted}
+	b.tree.ReplaceOrInsert(item)
+	c.k, c.v = item.k, item.v
+	return nil
+}
+
+func (c *overlayCursor) Put(k, v []byte) error {
+	return c.put(k, v, false)
+}
+
+func (c *overlayCursor) Append(k []byte, v []byte) error {
+	return c.put(k, v, false)
+}
+
+func (c *overlayCursor) AppendDup(k []byte, v []byte) error {
+	return c.put(k, v, false)
+}
+
+func (c *overlayCursor) Delete(k, v []byte) error {
+	if !c.dup {
+		return c.put(k, nil, true)
+	}
+	if v != nil {
+		return c.put(k, v, true)
+	}
+	if _, _, err := c.SeekExact(k); err != nil {
+		return err
+	}
+	return c.DeleteCurrentDuplicates()
+}
+
+// DeleteCurrent - the cursor stays at the deleted key/value, Next moves to the one after it
+func (c *overlayCursor) DeleteCurrent() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of the overlay is not positioned")
+	}
+	return c.put(c.k, c.position(), true)
+}
+
+func (c *overlayCursor) DeleteCurrentDuplicates() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of the overlay is not positioned")
+	}
+	key := c.k
+	var values [][]byte
+	for k, v, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, v, err = c.seek(k, v, true, false) {
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		if err := c.put(key, v, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *overlayCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) || !bytes.Equal(v, value) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *overlayCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *overlayCursor) FirstDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(c.k, nil, false, false)
+	return v, err
+}
+
+// NextDup - at the last value of the key returns nil and stays there
+func (c *overlayCursor) NextDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	key, value := c.k, c.v
+	k, v, err := c.seek(key, value, true, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(k, key) {
+		c.k, c.v = key, value
+		return nil, nil, nil
+	}
+	return k, v, nil
+}
+
+func (c *overlayCursor) NextNoDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.seek(c.k, nil, true, false)
+}
+
+func (c *overlayCursor) LastDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	key := c.k
+	_, v, err := c.seek(key, nil, false, true)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *overlayCursor) CountDuplicates() (uint64, error) {
+	if c.k == nil {
+		return 0, nil
+	}
+	key, value := c.k, c.v
+	var count uint64
+	for k, v, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, v, err = c.seek(k, v, true, false) {
+		if err != nil {
+			return 0, err
+		}
+		count++
+		if !c.dup {
+			break
+		}
+	}
+	c.k, c.v = key, value
+	return count, nil
+}
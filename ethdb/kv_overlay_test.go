@@ -0,0 +1,187 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/require"
+)
+
+// overlayTestBuckets are the plain, the DupSort and the auto-converted DupSort buckets
+var overlayTestBuckets = []string{dbutils.HeadersBucket, dbutils.PlainAccountChangeSetBucket, dbutils.PlainStateBucket}
+
+func overlayTestKey(bucket string, i int) []byte {
+	if bucket == dbutils.PlainStateBucket && i%2 == 1 {
+		return bytes.Repeat([]byte{byte(i / 4)}, 60) // the storage keys are split by the bucket
+	}
+	return bytes.Repeat([]byte{byte(i / 4)}, 20)
+}
+
+// overlayTestOps writes the same random changes into both transactions
+func overlayTestOps(t *testing.T, rnd *rand.Rand, txs ...RwTx) {
+	for i := 0; i < 200; i++ {
+		bucket := overlayTestBuckets[rnd.Intn(len(overlayTestBuckets))]
+		k, v := overlayTestKey(bucket, rnd.Intn(64)), []byte{byte(rnd.Intn(8)), 1}
+		op := rnd.Intn(4)
+		for _, tx := range txs {
+			c := tx.RwCursor(bucket)
+			switch {
+			case op == 0 && bucket == dbutils.PlainAccountChangeSetBucket:
+				if k, _, err := c.SeekExact(k); err == nil && k != nil {
+					require.NoError(t, c.(RwCursorDupSort).DeleteCurrentDuplicates())
+				}
+			case op == 0:
+				require.NoError(t, c.Delete(k, v))
+			case op == 1:
+				if k, _, err := c.Seek(k); err == nil && k != nil {
+					require.NoError(t, c.DeleteCurrent())
+				}
+			default:
+				require.NoError(t, c.Put(k, v))
+			}
+			c.Close()
+		}
+	}
+}
+
+func overlayTestDump(t *testing.T, tx Tx, bucket string, backward bool) []string {
+	var dump []string
+	c := tx.Cursor(bucket)
+	defer c.Close()
+	first, next := c.First, c.Next
+	if backward {
+		first, next = c.Last, c.Prev
+	}
+	for k, v, err := first(); k != nil; k, v, err = next() {
+		require.NoError(t, err)
+		dump = append(dump, fmt.Sprintf("%x:%x", k, v))
+	}
+	return dump
+}
+
+func TestOverlayKV(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(42))
+	base, expected := NewLMDB().InMem().MustOpen(), NewLMDB().InMem().MustOpen()
+	defer base.Close()
+	defer expected.Close()
+	for _, db := range []KV{base, expected} {
+		require.NoError(t, db.Update(ctx, func(tx RwTx) error {
+			for i := 0; i < 64; i += 3 {
+				for _, bucket := range overlayTestBuckets {
+					if err := tx.RwCursor(bucket).Put(overlayTestKey(bucket, i), []byte{byte(i % 8), 0}); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}))
+	}
+	baseTx, err := base.Begin(ctx)
+	require.NoError(t, err)
+	defer baseTx.Rollback()
+	var baseDump [][]string
+	for _, bucket := range overlayTestBuckets {
+		baseDump = append(baseDump, overlayTestDump(t, baseTx, bucket, false))
+	}
+
+	overlay := NewOverlayKV(baseTx, base.AllBuckets())
+	for round := 0; round < 5; round++ {
+		overlayTx, err := overlay.BeginRw(ctx)
+		require.NoError(t, err)
+		expectedTx, err := expected.BeginRw(ctx)
+		require.NoError(t, err)
+		overlayTestOps(t, rnd, overlayTx, expectedTx)
+		require.NoError(t, overlayTx.Commit(ctx))
+		require.NoError(t, expectedTx.Commit(ctx))
+
+		require.NoError(t, expected.View(ctx, func(expectedTx Tx) error {
+			return overlay.View(ctx, func(tx Tx) error {
+				for _, bucket := range overlayTestBuckets {
+					require.Equal(t, overlayTestDump(t, expectedTx, bucket, false), overlayTestDump(t, tx, bucket, false), bucket)
+					require.Equal(t, overlayTestDump(t, expectedTx, bucket, true), overlayTestDump(t, tx, bucket, true), bucket)
+					for i := 0; i < 64; i++ {
+						key := overlayTestKey(bucket, i)
+						v1, err1 := expectedTx.GetOne(bucket, key)
+						v2, err2 := tx.GetOne(bucket, key)
+						require.NoError(t, err1)
+						require.NoError(t, err2)
+						require.Equal(t, v1, v2, "%s %x", bucket, key)
+					}
+				}
+
+				// The seeks and the moves between the values of the same key
+				c1, c2 := expectedTx.CursorDupSort(dbutils.PlainAccountChangeSetBucket), tx.CursorDupSort(dbutils.PlainAccountChangeSetBucket)
+				defer c1.Close()
+				defer c2.Close()
+				for i := 0; i < 64; i++ {
+					key, value := overlayTestKey(dbutils.PlainAccountChangeSetBucket, i), []byte{byte(i % 8)}
+					k1, v1, _ := c1.Seek(key)
+					k2, v2, err := c2.Seek(key)
+					require.NoError(t, err)
+					require.Equal(t, k1, k2)
+					require.Equal(t, v1, v2)
+					if k1 == nil {
+						continue
+					}
+					n1, _ := c1.CountDuplicates()
+					n2, err := c2.CountDuplicates()
+					require.NoError(t, err)
+					require.Equal(t, n1, n2)
+					v1, _ = c1.SeekBothRange(k1, value)
+					v2, err = c2.SeekBothRange(k2, value)
+					require.NoError(t, err)
+					require.Equal(t, v1, v2)
+					if v1 == nil {
+						continue
+					}
+					k1, v1, _ = c1.NextDup()
+					k2, v2, err = c2.NextDup()
+					require.NoError(t, err)
+					require.Equal(t, k1, k2)
+					require.Equal(t, v1, v2)
+					k1, v1, _ = c1.NextNoDup()
+					k2, v2, err = c2.NextNoDup()
+					require.NoError(t, err)
+					require.Equal(t, k1, k2)
+					require.Equal(t, v1, v2)
+				}
+				return nil
+			})
+		}))
+	}
+
+	// The rolled back writes are dropped
+	tx, err := overlay.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.RwCursor(dbutils.HeadersBucket).Put([]byte("rolled back"), []byte{1}))
+	_, err = overlay.BeginRw(ctx)
+	require.Error(t, err, "only one write transaction at a time")
+	tx.Rollback()
+	require.NoError(t, overlay.View(ctx, func(tx Tx) error {
+		has, err := tx.HasOne(dbutils.HeadersBucket, []byte("rolled back"))
+		require.False(t, has)
+		return err
+	}))
+
+	// The cleared bucket hides the base
+	require.NoError(t, overlay.Update(ctx, func(tx RwTx) error {
+		if err := tx.(BucketMigrator).ClearBucket(dbutils.HeadersBucket); err != nil {
+			return err
+		}
+		return tx.RwCursor(dbutils.HeadersBucket).Put([]byte("after clear"), []byte{1})
+	}))
+	require.NoError(t, overlay.View(ctx, func(tx Tx) error {
+		require.Equal(t, []string{fmt.Sprintf("%x:01", "after clear")}, overlayTestDump(t, tx, dbutils.HeadersBucket, false))
+		return nil
+	}))
+
+	// Nothing is written into the base
+	for i, bucket := range overlayTestBuckets {
+		require.Equal(t, baseDump[i], overlayTestDump(t, baseTx, bucket, false))
+	}
+}
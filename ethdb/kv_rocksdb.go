@@ -0,0 +1,1051 @@
+//+build rocksdb
+
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"github.com/linxGnu/grocksdb"
+)
+
+var (
+	_ KV              = &RocksKV{}
+	_ HasStats        = &RocksKV{}
+	_ RwTx            = &rocksTx{}
+	_ BucketMigrator  = &rocksTx{}
+	_ statTx          = &rocksTx{}
+	_ RwCursorDupSort = &rocksCursor{}
+)
+
+var (
+	errRocksReadOnly       = errors.New("write into the read-only transaction of rocksdb")
+	rocksPendingCompaction = metrics.GetOrRegisterGauge("db/rocksdb/compaction/pending", metrics.DefaultRegistry)
+)
+
+const rocksDefaultColumnFamily = "default"
+
+type RocksOpts struct {
+	inMem       bool
+	readOnly    bool
+	path        string
+	bucketsCfg  BucketConfigsFunc
+	readTxWarn  time.Duration
+	readTxLimit time.Duration
+}
+
+func init() {
+	RegisterBackend("rocksdb", func(o BackendOpts) (KV, error) {
+		opts := NewRocksDB().Path(o.Path).ReadTxLimits(o.ReadTxWarn, o.ReadTxLimit).WithBucketsConfig(o.BucketsCfg)
+		if o.InMem {
+			opts = opts.InMem()
+		}
+		if o.ReadOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	})
+}
+
+func NewRocksDB() RocksOpts {
+	return RocksOpts{bucketsCfg: DefaultBucketConfigs}
+}
+
+func (opts RocksOpts) Path(path string) RocksOpts {
+	opts.path = path
+	return opts
+}
+
+func (opts RocksOpts) InMem() RocksOpts {
+	opts.inMem = true
+	return opts
+}
+
+// ReadOnly opens the database without the write transactions, it sees the data committed before it was opened
+func (opts RocksOpts) ReadOnly() RocksOpts {
+	opts.readOnly = true
+	return opts
+}
+
+// ReadTxLimits sets the age of the read transactions after which they are logged, DefaultReadTxWarn if zero,
+// and the one after which they are aborted, never if zero
+func (opts RocksOpts) ReadTxLimits(warn, limit time.Duration) RocksOpts {
+	opts.readTxWarn, opts.readTxLimit = warn, limit
+	return opts
+}
+
+func (opts RocksOpts) WithBucketsConfig(f BucketConfigsFunc) RocksOpts {
+	opts.bucketsCfg = f
+	return opts
+}
+
+// Open opens the database with a column family per bucket. The write transactions are the optimistic transactions
+// of RocksDB, only one is open at a time, like in LMDB, so they never conflict. Every commit is synced
+func (opts RocksOpts) Open() (KV, error) {
+	var logger log.Logger
+	var err error
+	if opts.inMem {
+		logger = log.New("rocksdb", "inMem")
+		opts.path, err = ioutil.TempDir(os.TempDir(), "rocksdb")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		logger = log.New("rocksdb", path.Base(opts.path))
+	}
+
+	options := grocksdb.NewDefaultOptions()
+	options.SetCreateIfMissing(true)
+	options.SetCreateIfMissingColumnFamilies(true)
+	options.IncreaseParallelism(runtime.NumCPU())
+	options.OptimizeLevelStyleCompaction(512 * 1024 * 1024)
+	options.SetKeepLogFileNum(5) // the LOG has the compaction stats, with the write amplification, every 10 minutes
+
+	names := []string{rocksDefaultColumnFamily}
+	if _, err = os.Stat(filepath.Join(opts.path, "CURRENT")); err == nil {
+		if names, err = grocksdb.ListColumnFamilies(options, opts.path); err != nil {
+			return nil, err
+		}
+	} else if opts.readOnly {
+		return nil, fmt.Errorf("no database to open read-only at %s: %w", opts.path, err)
+	}
+	cfOpts := make([]*grocksdb.Options, len(names))
+	for i := range cfOpts {
+		cfOpts[i] = options
+	}
+
+	db := &RocksKV{
+		opts:    opts,
+		options: options,
+		log:     logger,
+		buckets: dbutils.BucketsCfg{},
+		handles: map[string]*grocksdb.ColumnFamilyHandle{},
+		wg:      &sync.WaitGroup{},
+	}
+	var handles []*grocksdb.ColumnFamilyHandle
+	if opts.readOnly {
+		db.base, handles, err = grocksdb.OpenDbForReadOnlyColumnFamilies(options, opts.path, names, cfOpts, false)
+	} else {
+		db.txDb, handles, err = grocksdb.OpenOptimisticTransactionDbColumnFamilies(options, opts.path, names, cfOpts)
+		if err == nil {
+			db.base = db.txDb.GetBaseDB()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w, path: %s", err, opts.path)
+	}
+	for i, name := range names {
+		db.handles[name] = handles[i]
+	}
+
+	customBuckets := opts.bucketsCfg(dbutils.BucketsConfigs)
+	for name, cfg := range customBuckets { // copy map to avoid changing global variable
+		db.buckets[name] = cfg
+	}
+	if !opts.readOnly {
+		for name, cfg := range db.buckets {
+			if cfg.IsDeprecated {
+				continue
+			}
+			if err = db.createBucket(name); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+	}
+	db.watchdog = newReadTxWatchdog(db.log, opts.readTxWarn, opts.readTxLimit)
+	return db, nil
+}
+
+func (opts RocksOpts) MustOpen() KV {
+	db, err := opts.Open()
+	if err != nil {
+		panic(fmt.Errorf("fail to open rocksdb: %w", err))
+	}
+	return db
+}
+
+// RocksKV - the KV on RocksDB, an LSM tree: the writes are cheaper than in the B+ trees of LMDB and MDBX, at the
+// price of the compactions in the background, and nothing is mmap-ed. The bucket is the column family, the DupSort
+// bucket keeps every key/value as the key of the column family (see rocksDupKey), the ones with
+// AutoDupSortKeysConversion have the layout of LMDB (see autoDupCursor)
+type RocksKV struct {
+	opts     RocksOpts
+	options  *grocksdb.Options
+	txDb     *grocksdb.OptimisticTransactionDB // nil if read-only
+	base     *grocksdb.DB
+	log      log.Logger
+	buckets  dbutils.BucketsCfg
+	wg       *sync.WaitGroup
+	writer   sync.Mutex // held by the write transaction
+	watchdog *readTxWatchdog
+
+	handlesLock sync.RWMutex
+	handles     map[string]*grocksdb.ColumnFamilyHandle
+}
+
+// Close closes db
+// All transactions must be closed before closing the database.
+func (db *RocksKV) Close() {
+	if db.base != nil {
+		db.wg.Wait()
+		db.watchdog.stop()
+		db.handlesLock.Lock()
+		for _, h := range db.handles {
+			h.Destroy()
+		}
+		db.handles = map[string]*grocksdb.ColumnFamilyHandle{}
+		db.handlesLock.Unlock()
+		if db.txDb != nil {
+			db.txDb.CloseBaseDB(db.base)
+			db.txDb.Close()
+		} else {
+			db.base.Close()
+		}
+		db.base, db.txDb = nil, nil
+		db.log.Info("database closed (RocksDB)")
+	}
+
+	if db.opts.inMem {
+		if err := os.RemoveAll(db.opts.path); err != nil {
+			db.log.Warn("failed to remove in-mem db file", "err", err)
+		}
+	}
+}
+
+func (db *RocksKV) handle(bucket string) (*grocksdb.ColumnFamilyHandle, error) {
+	db.handlesLock.RLock()
+	defer db.handlesLock.RUnlock()
+	h, ok := db.handles[bucket]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s doesn't exist", bucket)
+	}
+	return h, nil
+}
+
+// createBucket creates the column family, right away and not in the transaction
+func (db *RocksKV) createBucket(name string) error {
+	db.handlesLock.Lock()
+	defer db.handlesLock.Unlock()
+	if _, ok := db.handles[name]; ok {
+		return nil
+	}
+	h, err := db.base.CreateColumnFamily(db.options, name)
+	if err != nil {
+		return fmt.Errorf("create bucket %s: %w", name, err)
+	}
+	db.handles[name] = h
+	return nil
+}
+
+// dropBucket drops the column family, right away and not in the transaction
+func (db *RocksKV) dropBucket(name string) error {
+	db.handlesLock.Lock()
+	defer db.handlesLock.Unlock()
+	h, ok := db.handles[name]
+	if !ok {
+		return nil
+	}
+	if err := db.base.DropColumnFamily(h); err != nil {
+		return err
+	}
+	h.Destroy()
+	delete(db.handles, name)
+	return nil
+}
+
+// sumProperty sums the integer property over the column families of the buckets
+func (db *RocksKV) sumProperty(name string) uint64 {
+	db.handlesLock.RLock()
+	defer db.handlesLock.RUnlock()
+	var sum uint64
+	for _, h := range db.handles {
+		v, _ := strconv.ParseUint(db.base.GetPropertyCF(name, h), 10, 64)
+		sum += v
+	}
+	return sum
+}
+
+func (db *RocksKV) DiskSize(_ context.Context) (uint64, error) {
+	return db.sumProperty("rocksdb.total-sst-files-size"), nil
+}
+
+func (db *RocksKV) CollectMetrics() {
+	if db.base == nil {
+		return
+	}
+	dbSize.Update(int64(db.sumProperty("rocksdb.total-sst-files-size")))
+	rocksPendingCompaction.Update(int64(db.sumProperty("rocksdb.estimate-pending-compaction-bytes")))
+	for _, bucket := range dbutils.Buckets {
+		h, err := db.handle(bucket)
+		if err != nil {
+			continue // the bucket isn't created yet
+		}
+		size, _ := strconv.ParseUint(db.base.GetPropertyCF("rocksdb.estimate-live-data-size", h), 10, 64)
+		entries, _ := strconv.ParseUint(db.base.GetPropertyCF("rocksdb.estimate-num-keys", h), 10, 64)
+		updateBucketMetrics(bucket, 1, 0, size, 0, entries)
+	}
+}
+
+func (db *RocksKV) AllBuckets() dbutils.BucketsCfg {
+	return db.buckets
+}
+
+// Begin - the read transaction reads the snapshot taken at its start
+func (db *RocksKV) Begin(_ context.Context) (Tx, error) {
+	if db.base == nil {
+		return nil, fmt.Errorf("db closed")
+	}
+	snapshot := db.base.NewSnapshot()
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetSnapshot(snapshot)
+	db.wg.Add(1)
+	return &rocksTx{
+		db:       db,
+		ro:       ro,
+		snapshot: snapshot,
+		watched:  db.watchdog.add(),
+	}, nil
+}
+
+// BeginRw - waits for the write transaction open, if any
+func (db *RocksKV) BeginRw(_ context.Context) (RwTx, error) {
+	if db.base == nil {
+		return nil, fmt.Errorf("db closed")
+	}
+	if db.txDb == nil {
+		return nil, fmt.Errorf("rocksdb is open read-only")
+	}
+	db.writer.Lock()
+	wo := grocksdb.NewDefaultWriteOptions()
+	wo.SetSync(true)
+	txOpts := grocksdb.NewDefaultOptimisticTransactionOptions()
+	defer txOpts.Destroy()
+	db.wg.Add(1)
+	return &rocksTx{
+		db:  db,
+		ro:  grocksdb.NewDefaultReadOptions(),
+		wo:  wo,
+		txn: db.txDb.TransactionBegin(wo, txOpts, nil),
+	}, nil
+}
+
+func (db *RocksKV) View(ctx context.Context, f func(tx Tx) error) (err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *RocksKV) Update(ctx context.Context, f func(tx RwTx) error) (err error) {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type rocksTx struct {
+	db       *RocksKV
+	ro       *grocksdb.ReadOptions
+	snapshot *grocksdb.Snapshot     // of the read transaction
+	wo       *grocksdb.WriteOptions // of the write transaction
+	txn      *grocksdb.Transaction  // nil for the read transaction
+	watched  *watchedTx             // nil for the write transaction
+	cursors  []*rocksCursor
+	writes   uint64 // the cursors reposition their iterators after the writes
+	done     bool
+}
+
+func (tx *rocksTx) close() {
+	for _, c := range tx.cursors {
+		c.Close()
+	}
+	tx.cursors = nil
+	tx.ro.Destroy()
+	if tx.txn != nil {
+		tx.txn.Destroy()
+		tx.wo.Destroy()
+		tx.db.writer.Unlock()
+	} else {
+		tx.db.base.ReleaseSnapshot(tx.snapshot)
+		tx.db.watchdog.remove(tx.watched)
+	}
+	tx.done = true
+	tx.db.wg.Done()
+}
+
+func (tx *rocksTx) Commit(ctx context.Context) error {
+	if tx.done {
+		return nil
+	}
+	defer tx.close()
+	if tx.txn == nil {
+		return nil
+	}
+	for _, c := range tx.cursors {
+		c.Close() // the iterators must not outlive the transaction
+	}
+	commitTimer := time.Now()
+	_, span := tracing.Start(ctx, "db commit")
+	err := tx.txn.Commit()
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+	if commitTook := time.Since(commitTimer); commitTook > 20*time.Second {
+		log.Info("Batch", "commit", commitTook)
+	}
+	return nil
+}
+
+func (tx *rocksTx) Rollback() {
+	if tx.done {
+		return
+	}
+	defer tx.close()
+	if tx.txn != nil {
+		for _, c := range tx.cursors {
+			c.Close()
+		}
+		if err := tx.txn.Rollback(); err != nil {
+			log.Warn("rocksdb rollback failed", "err", err)
+		}
+	}
+}
+
+func (tx *rocksTx) isDup(bucket string) bool {
+	return tx.db.buckets[bucket].Flags&dbutils.DupSort != 0
+}
+
+func (tx *rocksTx) iterator(h *grocksdb.ColumnFamilyHandle) *grocksdb.Iterator {
+	if tx.txn != nil {
+		return tx.txn.NewIteratorCF(tx.ro, h)
+	}
+	return tx.db.base.NewIteratorCF(tx.ro, h)
+}
+
+func (tx *rocksTx) get(h *grocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
+	if tx.watched.expired() {
+		return nil, ErrReadTxExpired
+	}
+	var s *grocksdb.Slice
+	var err error
+	if tx.txn != nil {
+		s, err = tx.txn.GetWithCF(tx.ro, h, key)
+	} else {
+		s, err = tx.db.base.GetCF(tx.ro, h, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer s.Free()
+	if !s.Exists() {
+		return nil, nil
+	}
+	return common.CopyBytes(s.Data()), nil
+}
+
+func (tx *rocksTx) put(h *grocksdb.ColumnFamilyHandle, k, v []byte) error {
+	if tx.txn == nil {
+		return errRocksReadOnly
+	}
+	tx.writes++
+	return tx.txn.PutCF(h, k, v)
+}
+
+func (tx *rocksTx) delete(h *grocksdb.ColumnFamilyHandle, k []byte) error {
+	if tx.txn == nil {
+		return errRocksReadOnly
+	}
+	tx.writes++
+	return tx.txn.DeleteCF(h, k)
+}
+
+func (tx *rocksTx) Cursor(bucket string) Cursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *rocksTx) CursorDupSort(bucket string) CursorDupSort {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *rocksTx) RwCursor(bucket string) RwCursor {
+	return tx.RwCursorDupSort(bucket)
+}
+
+func (tx *rocksTx) RwCursorDupSort(bucket string) RwCursorDupSort {
+	c := &rocksCursor{tx: tx, bucket: bucket, dup: tx.isDup(bucket)}
+	c.h, c.err = tx.db.handle(bucket)
+	tx.cursors = append(tx.cursors, c)
+	if cfg := tx.db.buckets[bucket]; cfg.AutoDupSortKeysConversion {
+		return newAutoDupCursor(c, bucket, cfg)
+	}
+	return c
+}
+
+func (tx *rocksTx) GetOne(bucket string, key []byte) ([]byte, error) {
+	if tx.isDup(bucket) {
+		c := tx.Cursor(bucket)
+		defer c.Close()
+		_, v, err := c.SeekExact(key)
+		return v, err
+	}
+	h, err := tx.db.handle(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return tx.get(h, key)
+}
+
+func (tx *rocksTx) HasOne(bucket string, key []byte) (bool, error) {
+	if tx.isDup(bucket) {
+		c := tx.Cursor(bucket)
+		defer c.Close()
+		k, _, err := c.SeekExact(key)
+		return k != nil, err
+	}
+	v, err := tx.GetOne(bucket, key)
+	return v != nil, err
+}
+
+func (tx *rocksTx) IncrementSequence(bucket string, amount uint64) (uint64, error) {
+	current, err := tx.ReadSequence(bucket)
+	if err != nil {
+		return 0, err
+	}
+	newV := make([]byte, 8)
+	binary.BigEndian.PutUint64(newV, current+amount)
+	c := tx.RwCursor(dbutils.Sequence)
+	defer c.Close()
+	if err = c.Put([]byte(bucket), newV); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+func (tx *rocksTx) ReadSequence(bucket string) (uint64, error) {
+	v, err := tx.GetOne(dbutils.Sequence, []byte(bucket))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// BucketSize - the estimate of RocksDB, the size of the compressed data in the files, and without the deletions
+// not compacted yet
+func (tx *rocksTx) BucketSize(name string) (uint64, error) {
+	h, err := tx.db.handle(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(tx.db.base.GetPropertyCF("rocksdb.estimate-live-data-size", h), 10, 64)
+}
+
+func (tx *rocksTx) bucketStats(name string) (BucketStats, error) {
+	h, err := tx.db.handle(name)
+	if err != nil {
+		return BucketStats{}, err
+	}
+	entries, _ := strconv.ParseUint(tx.db.base.GetPropertyCF("rocksdb.estimate-num-keys", h), 10, 64)
+	size, _ := strconv.ParseUint(tx.db.base.GetPropertyCF("rocksdb.estimate-live-data-size", h), 10, 64)
+	return BucketStats{Bucket: name, Entries: entries, Size: size}, nil
+}
+
+// spaceStats - RocksDB has no pages and no max size, the files grow until the disk fills up
+func (tx *rocksTx) spaceStats(stats *DBStats) error {
+	diskFree, err := diskFreeSpace(tx.db.opts.path)
+	if err != nil {
+		return err
+	}
+	stats.FileSize = tx.db.sumProperty("rocksdb.total-sst-files-size")
+	stats.UsedSize = stats.FileSize
+	stats.DiskFree = diskFree
+	stats.MaxSize = stats.FileSize + diskFree
+	return nil
+}
+
+// Comparator - the keys and the values of the DupSort buckets are always compared bytewise, the custom comparators
+// of LMDB and MDBX are only set for the deprecated buckets
+func (tx *rocksTx) Comparator(bucket string) dbutils.CmpFunc {
+	if tx.isDup(bucket) {
+		return dbutils.DefaultDupCmpFunc
+	}
+	return dbutils.DefaultCmpFunc
+}
+
+// CHandle - RocksDB has no C transaction compatible with LMDB, the code which needs it can't run on top of it
+func (tx *rocksTx) CHandle() unsafe.Pointer {
+	return nil
+}
+
+// DropBucket - the column family is dropped right away, even if the transaction is rolled back
+func (tx *rocksTx) DropBucket(name string) error {
+	if tx.txn == nil {
+		return errRocksReadOnly
+	}
+	if cfg, ok := tx.db.buckets[name]; ok && !cfg.IsDeprecated {
+		return fmt.Errorf("%w, bucket: %s", ErrAttemptToDeleteNonDeprecatedBucket, name)
+	}
+	return tx.db.dropBucket(name)
+}
+
+// CreateBucket - the column family is created right away, even if the transaction is rolled back
+func (tx *rocksTx) CreateBucket(name string) error {
+	if tx.txn == nil {
+		return errRocksReadOnly
+	}
+	return tx.db.createBucket(name)
+}
+
+func (tx *rocksTx) ExistsBucket(name string) bool {
+	_, err := tx.db.handle(name)
+	return err == nil
+}
+
+// ClearBucket - deletes the keys one by one in the transaction, so it's rolled back with it
+func (tx *rocksTx) ClearBucket(name string) error {
+	h, err := tx.db.handle(name)
+	if err != nil {
+		return nil
+	}
+	it := tx.iterator(h)
+	defer it.Close()
+	var keys [][]byte
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		k := it.Key()
+		keys = append(keys, common.CopyBytes(k.Data()))
+		k.Free()
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = tx.delete(h, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *rocksTx) ExistingBuckets() ([]string, error) {
+	tx.db.handlesLock.RLock()
+	defer tx.db.handlesLock.RUnlock()
+	buckets := make([]string, 0, len(tx.db.handles))
+	for name := range tx.db.handles {
+		if name != rocksDefaultColumnFamily {
+			buckets = append(buckets, name)
+		}
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// rocksDupKey is the key of the column family of the DupSort bucket for the key/value, which sorts like the pairs:
+// the zero bytes of the key are escaped as 0x00 0xff, the key ends with 0x00 0x00 and the value follows. The key
+// which is the prefix of another one sorts first, like in LMDB
+func rocksDupKey(k, v []byte) []byte {
+	buf := make([]byte, 0, len(k)+2+len(v)+bytes.Count(k, []byte{0}))
+	for _, b := range k {
+		buf = append(buf, b)
+		if b == 0 {
+			buf = append(buf, 0xff)
+		}
+	}
+	buf = append(buf, 0, 0)
+	return append(buf, v...)
+}
+
+// rocksSplitDupKey is the key/value of the key of the column family of the DupSort bucket, the value is the tail
+// of the key
+func rocksSplitDupKey(key []byte) ([]byte, []byte, error) {
+	k := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		if key[i] != 0 {
+			k = append(k, key[i])
+			continue
+		}
+		if i+1 == len(key) {
+			break
+		}
+		if key[i+1] == 0 {
+			return k, key[i+2:], nil
+		}
+		k = append(k, 0)
+		i++
+	}
+	return nil, nil, fmt.Errorf("malformed key of the DupSort bucket: %x", key)
+}
+
+// rocksCursor is the iterator of the column family. The position is kept as the key/value it points to, after
+// the writes of the transaction the iterator seeks it again, so the writes through the cursor, or the other cursors
+// of the same transaction, are always visible
+type rocksCursor struct {
+	tx     *rocksTx
+	bucket string
+	dup    bool
+	h      *grocksdb.ColumnFamilyHandle
+	err    error // the bucket doesn't exist
+	it     *grocksdb.Iterator
+
+	k, v   []byte // current position, nil if not positioned
+	synced bool   // the iterator is at the current position
+	writes uint64 // the writes of the transaction when the iterator was positioned
+}
+
+// prepare creates the iterator, the cursors are created by the transactions without the errors
+func (c *rocksCursor) prepare() error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.tx.done {
+		return fmt.Errorf("the transaction of the cursor of %s is closed", c.bucket)
+	}
+	if c.tx.watched.expired() {
+		return ErrReadTxExpired
+	}
+	if c.it == nil {
+		c.it = c.tx.iterator(c.h)
+	}
+	return nil
+}
+
+// current reads the key/value of the iterator into the position
+func (c *rocksCursor) current() ([]byte, []byte, error) {
+	c.synced, c.writes = true, c.tx.writes
+	if !c.it.Valid() {
+		c.k, c.v = nil, nil
+		if err := c.it.Err(); err != nil {
+			return []byte{}, nil, err
+		}
+		return nil, nil, nil
+	}
+	key := c.it.Key()
+	k := common.CopyBytes(key.Data())
+	key.Free()
+	if c.dup {
+		var err error
+		if c.k, c.v, err = rocksSplitDupKey(k); err != nil {
+			return []byte{}, nil, err
+		}
+		return c.k, c.v, nil
+	}
+	value := c.it.Value()
+	c.k, c.v = k, common.CopyBytes(value.Data())
+	value.Free()
+	return c.k, c.v, nil
+}
+
+// seek moves the cursor to the first (last if backward) key/value at the position (k, v) or after (before) it,
+// strictly after (before) if strict. nil value of the dup bucket stands for all the values of the key, nil k is
+// the start (end) of the bucket
+func (c *rocksCursor) seek(k, v []byte, strict, backward bool) ([]byte, []byte, error) {
+	if err := c.prepare(); err != nil {
+		return []byte{}, nil, err
+	}
+	exact := k
+	switch {
+	case k == nil && backward:
+		c.it.SeekToLast()
+		return c.current()
+	case k == nil:
+		c.it.SeekToFirst()
+		return c.current()
+	case c.dup && v == nil:
+		exact = rocksDupKey(k, nil)
+		if strict != backward {
+			// The bound after all the values of the key
+			after := common.CopyBytes(exact)
+			after[len(after)-1] = 1
+			if backward {
+				c.it.SeekForPrev(after)
+			} else {
+				c.it.Seek(after)
+			}
+			return c.current()
+		}
+	case c.dup:
+		exact = rocksDupKey(k, v)
+	}
+	if backward {
+		c.it.SeekForPrev(exact)
+		if strict && c.it.Valid() && c.atKey(exact) {
+			c.it.Prev()
+		}
+	} else {
+		c.it.Seek(exact)
+		if strict && c.it.Valid() && c.atKey(exact) {
+			c.it.Next()
+		}
+	}
+	return c.current()
+}
+
+func (c *rocksCursor) atKey(key []byte) bool {
+	k := c.it.Key()
+	defer k.Free()
+	return bytes.Equal(k.Data(), key)
+}
+
+// step moves the iterator one key/value forward (backward) from the current position
+func (c *rocksCursor) step(backward bool) ([]byte, []byte, error) {
+	if !c.synced || c.writes != c.tx.writes || c.prepare() != nil || !c.it.Valid() {
+		return c.seek(c.k, c.position(), true, backward)
+	}
+	if backward {
+		c.it.Prev()
+	} else {
+		c.it.Next()
+	}
+	return c.current()
+}
+
+// position is the value which stands for the current position in the seeks
+func (c *rocksCursor) position() []byte {
+	if !c.dup {
+		return nil
+	}
+	return c.v
+}
+
+func (c *rocksCursor) First() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, false)
+}
+
+func (c *rocksCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.seek(seek, nil, false, false)
+}
+
+func (c *rocksCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, nil, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *rocksCursor) Next() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.step(false)
+}
+
+func (c *rocksCursor) Prev() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.Last()
+	}
+	return c.step(true)
+}
+
+func (c *rocksCursor) Last() ([]byte, []byte, error) {
+	return c.seek(nil, nil, false, true)
+}
+
+func (c *rocksCursor) Current() ([]byte, []byte, error) {
+	return c.k, c.v, nil
+}
+
+// Count - number of the key/values, counted one by one
+func (c *rocksCursor) Count() (uint64, error) {
+	if err := c.prepare(); err != nil {
+		return 0, err
+	}
+	it := c.tx.iterator(c.h)
+	defer it.Close()
+	var count uint64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		count++
+	}
+	return count, it.Err()
+}
+
+func (c *rocksCursor) Close() {
+	if c.it != nil {
+		c.it.Close()
+		c.it = nil
+	}
+	c.synced = false
+}
+
+// put writes the key/value and moves the cursor to it
+func (c *rocksCursor) put(k, v []byte) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	var err error
+	if c.dup {
+		err = c.tx.put(c.h, rocksDupKey(k, v), nil)
+	} else {
+		err = c.tx.put(c.h, k, v)
+	}
+	if err != nil {
+		return err
+	}
+	c.k, c.v, c.synced = common.CopyBytes(k), common.CopyBytes(v), false
+	return nil
+}
+
+func (c *rocksCursor) Put(k, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *rocksCursor) Append(k []byte, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *rocksCursor) AppendDup(k []byte, v []byte) error {
+	return c.put(k, v)
+}
+
+func (c *rocksCursor) Delete(k, v []byte) error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	if !c.dup {
+		return c.tx.delete(c.h, k)
+	}
+	if v != nil {
+		return c.tx.delete(c.h, rocksDupKey(k, v))
+	}
+	if found, _, err := c.SeekExact(k); err != nil || found == nil {
+		return err
+	}
+	return c.DeleteCurrentDuplicates()
+}
+
+// DeleteCurrent - the cursor stays at the deleted key/value, Next moves to the one after it
+func (c *rocksCursor) DeleteCurrent() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of rocksdb is not positioned")
+	}
+	key, value := c.k, c.v
+	if err := c.Delete(c.k, c.position()); err != nil {
+		return err
+	}
+	c.k, c.v, c.synced = key, value, false
+	return nil
+}
+
+func (c *rocksCursor) DeleteCurrentDuplicates() error {
+	if c.k == nil {
+		return fmt.Errorf("the cursor of rocksdb is not positioned")
+	}
+	key := c.k
+	var values [][]byte
+	for k, v, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, v, err = c.step(false) {
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+	for _, v := range values {
+		if err := c.tx.delete(c.h, rocksDupKey(key, v)); err != nil {
+			return err
+		}
+	}
+	c.k, c.synced = key, false
+	return nil
+}
+
+func (c *rocksCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) || !bytes.Equal(v, value) {
+		return nil, nil, err
+	}
+	return k, v, nil
+}
+
+func (c *rocksCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	k, v, err := c.seek(key, value, false, false)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c *rocksCursor) FirstDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(c.k, nil, false, false)
+	return v, err
+}
+
+// NextDup - at the last value of the key returns nil and stays there
+func (c *rocksCursor) NextDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return nil, nil, nil
+	}
+	key, value := c.k, c.v
+	k, v, err := c.step(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(k, key) {
+		c.k, c.v, c.synced = key, value, false
+		return nil, nil, nil
+	}
+	return k, v, nil
+}
+
+func (c *rocksCursor) NextNoDup() ([]byte, []byte, error) {
+	if c.k == nil {
+		return c.First()
+	}
+	return c.seek(c.k, nil, true, false)
+}
+
+func (c *rocksCursor) LastDup() ([]byte, error) {
+	if c.k == nil {
+		return nil, nil
+	}
+	_, v, err := c.seek(c.k, nil, false, true)
+	return v, err
+}
+
+func (c *rocksCursor) CountDuplicates() (uint64, error) {
+	if c.k == nil {
+		return 0, nil
+	}
+	key, value := c.k, c.v
+	var count uint64
+	for k, _, err := c.seek(key, nil, false, false); bytes.Equal(k, key); k, _, err = c.step(false) {
+		if err != nil {
+			return 0, err
+		}
+		count++
+		if !c.dup {
+			break
+		}
+	}
+	c.k, c.v, c.synced = key, value, false
+	return count, nil
+}
@@ -0,0 +1,65 @@
+//+build rocksdb
+
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRocksDupKey(t *testing.T) {
+	pairs := [][2][]byte{
+		{{}, {1}},
+		{{0}, {}},
+		{{0}, {0}},
+		{{0, 0}, {}},
+		{{0, 1}, {0xff}},
+		{{1}, {}},
+		{{1}, {0, 0}},
+		{{1}, {1}},
+		{{1, 0}, {0}},
+		{{1, 0xff}, {}},
+	}
+	keys := make([][]byte, len(pairs))
+	for i, p := range pairs {
+		keys[i] = rocksDupKey(p[0], p[1])
+		k, v, err := rocksSplitDupKey(keys[i])
+		require.NoError(t, err)
+		require.Equal(t, p[0], k)
+		require.Equal(t, p[1], v)
+	}
+	require.True(t, sort.SliceIsSorted(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 }), "the keys sort like the pairs")
+
+	_, _, err := rocksSplitDupKey([]byte{1, 0, 1})
+	require.Error(t, err)
+}
+
+func TestRocksBucketsStat(t *testing.T) {
+	db := NewRocksDB().InMem().MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(context.Background(), func(tx RwTx) error {
+		c := tx.RwCursor(dbutils.HeadersBucket)
+		defer c.Close()
+		for i := 0; i < 1000; i++ {
+			if err := c.Put([]byte(fmt.Sprintf("%08d", i)), bytes.Repeat([]byte{1}, 1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, db.View(context.Background(), func(tx Tx) error {
+		stats, err := BucketsStat(tx)
+		require.NoError(t, err)
+		require.NotEmpty(t, stats.Buckets)
+		require.NotZero(t, stats.DiskFree)
+		limitLeft, diskLeft := spaceLeft(stats)
+		require.Equal(t, diskLeft, limitLeft, "only the disk limits the database")
+		return nil
+	}))
+}
@@ -0,0 +1,483 @@
+package ethdb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+var (
+	_ KV               = &TieredKV{}
+	_ HasStats         = &TieredKV{}
+	_ DurabilitySetter = &TieredKV{}
+	_ RwTx             = &tieredTx{}
+	_ BucketMigrator   = &tieredTx{}
+	_ statTx           = &tieredTx{}
+)
+
+// DefaultColdBuckets are the buckets of the history which is written once and rarely read, the candidates to be kept
+// on the cheap storage: the bodies, the receipts and the logs of the blocks and the changesets
+var DefaultColdBuckets = []string{
+	dbutils.BlockBodyPrefix,
+	dbutils.BlockReceiptsPrefix,
+	dbutils.Log,
+	dbutils.PlainAccountChangeSetBucket,
+	dbutils.PlainStorageChangeSetBucket,
+}
+
+// TieredKV - the database split over two KVs, usually on the different volumes: the cold buckets are kept in the cold
+// KV, all the others in the hot one, so the state stays on the fast disk and the history goes to the cheap one. The
+// transactions of TieredKV span the transactions of both KVs and route every bucket to its KV, so the code above
+// doesn't know about the split.
+//
+// The commit isn't atomic across the KVs: the cold one is committed first, so a crash between the commits leaves
+// the cold buckets ahead of the hot ones, e.g. with the receipts of the blocks whose stage progress isn't saved, which
+// the sync overwrites. The hot KV records the cold buckets under dbutils.ColdBucketsKey, so it can't be opened with
+// another split, or without the cold KV, and miss the data
+type TieredKV struct {
+	hot, cold KV
+	coldSet   map[string]struct{}
+}
+
+// NewTieredKV combines the hot and the cold KV, coldBuckets are the buckets kept in the cold one. The split has to be
+// the one recorded in the hot KV. If none is recorded, the cold buckets have to be empty in the hot KV, their data is
+// moved to the cold KV by MoveBuckets, and the split is recorded
+func NewTieredKV(ctx context.Context, hot, cold KV, coldBuckets []string) (*TieredKV, error) {
+	coldBuckets = sortedBuckets(coldBuckets)
+	if len(coldBuckets) == 0 {
+		return nil, fmt.Errorf("no cold buckets")
+	}
+	all := hot.AllBuckets()
+	for _, name := range coldBuckets {
+		if _, ok := all[name]; !ok {
+			return nil, fmt.Errorf("unknown cold bucket %s", name)
+		}
+		if name == dbutils.DatabaseInfoBucket {
+			return nil, fmt.Errorf("bucket %s records the split and has to stay in the hot database", name)
+		}
+	}
+
+	var recorded []string
+	var inHot []string
+	if err := hot.View(ctx, func(tx Tx) (err error) {
+		if recorded, err = ReadColdBuckets(tx); err != nil {
+			return err
+		}
+		if recorded != nil {
+			return nil
+		}
+		for _, name := range coldBuckets {
+			c := tx.Cursor(name)
+			k, _, err := c.First()
+			c.Close()
+			if err != nil {
+				return err
+			}
+			if k != nil {
+				inHot = append(inHot, name)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	switch {
+	case recorded != nil && strings.Join(recorded, ",") != strings.Join(coldBuckets, ","):
+		return nil, fmt.Errorf("the database keeps the buckets %s in the cold database, not %s, move them with MoveBuckets", strings.Join(recorded, ","), strings.Join(coldBuckets, ","))
+	case len(inHot) > 0:
+		return nil, fmt.Errorf("the cold buckets %s have data in the hot database, move them with MoveBuckets", strings.Join(inHot, ","))
+	case recorded == nil:
+		if err := hot.Update(ctx, func(tx RwTx) error {
+			return writeColdBuckets(tx, coldBuckets)
+		}); err != nil {
+			return nil, fmt.Errorf("recording the cold buckets: %w", err)
+		}
+	}
+
+	kv := &TieredKV{hot: hot, cold: cold, coldSet: map[string]struct{}{}}
+	for _, name := range coldBuckets {
+		kv.coldSet[name] = struct{}{}
+	}
+	return kv, nil
+}
+
+// ReadColdBuckets returns the buckets the database keeps in the cold database, nil if it isn't split
+func ReadColdBuckets(tx Tx) ([]string, error) {
+	v, err := tx.GetOne(dbutils.DatabaseInfoBucket, dbutils.ColdBucketsKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(v), ","), nil
+}
+
+func writeColdBuckets(tx RwTx, buckets []string) error {
+	c := tx.RwCursor(dbutils.DatabaseInfoBucket)
+	defer c.Close()
+	if len(buckets) == 0 {
+		return c.Delete(dbutils.ColdBucketsKey, nil)
+	}
+	return c.Put(dbutils.ColdBucketsKey, []byte(strings.Join(sortedBuckets(buckets), ",")))
+}
+
+func sortedBuckets(buckets []string) []string {
+	set := map[string]struct{}{}
+	for _, name := range buckets {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(set))
+	for name := range set {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// moveBatchSize is the size of the key/values copied by MoveBuckets in one transaction
+const moveBatchSize = 256 * datasize.MB
+
+// MoveBuckets moves the data of the buckets from the hot KV to the cold one if toCold, back otherwise, and updates
+// the split recorded in the hot KV. The buckets are copied in the batches of moveBatchSize and removed from the source
+// after they are copied completely, so the interrupted move is repeated from the start of the interrupted bucket. The
+// database must not be used while its buckets are moved
+func MoveBuckets(ctx context.Context, hot, cold KV, buckets []string, toCold bool) error {
+	buckets = sortedBuckets(buckets)
+	var recorded []string
+	if err := hot.View(ctx, func(tx Tx) (err error) {
+		recorded, err = ReadColdBuckets(tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	split := map[string]struct{}{}
+	for _, name := range recorded {
+		split[name] = struct{}{}
+	}
+	from, to := hot, cold
+	if !toCold {
+		from, to = cold, hot
+	}
+	for _, name := range buckets {
+		if name == dbutils.DatabaseInfoBucket {
+			return fmt.Errorf("bucket %s records the split and has to stay in the hot database", name)
+		}
+		if _, ok := hot.AllBuckets()[name]; !ok {
+			return fmt.Errorf("unknown bucket %s", name)
+		}
+		if _, ok := split[name]; ok == toCold {
+			continue // moved already
+		}
+		if err := moveBucket(ctx, from, to, name); err != nil {
+			return fmt.Errorf("moving bucket %s: %w", name, err)
+		}
+		if toCold {
+			split[name] = struct{}{}
+		} else {
+			delete(split, name)
+		}
+		moved := make([]string, 0, len(split))
+		for b := range split {
+			moved = append(moved, b)
+		}
+		// The split is switched with the removal of the moved data from the hot KV, in one transaction
+		if err := hot.Update(ctx, func(tx RwTx) error {
+			if toCold {
+				if err := tx.(BucketMigrator).ClearBucket(name); err != nil {
+					return err
+				}
+			}
+			return writeColdBuckets(tx, moved)
+		}); err != nil {
+			return err
+		}
+		if !toCold {
+			if err := cold.Update(ctx, func(tx RwTx) error {
+				return tx.(BucketMigrator).ClearBucket(name)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveBucket copies the bucket into the cleared bucket of the target KV
+func moveBucket(ctx context.Context, from, to KV, bucket string) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	if err := to.Update(ctx, func(tx RwTx) error {
+		return tx.(BucketMigrator).ClearBucket(bucket)
+	}); err != nil {
+		return err
+	}
+	return from.View(ctx, func(fromTx Tx) error {
+		c := fromTx.Cursor(bucket)
+		defer c.Close()
+		k, v, err := c.First()
+		for k != nil {
+			if err = to.Update(ctx, func(tx RwTx) error {
+				dst := tx.RwCursor(bucket)
+				defer dst.Close()
+				var size datasize.ByteSize
+				for ; k != nil && size < moveBatchSize; k, v, err = c.Next() {
+					if err != nil {
+						return err
+					}
+					if err = dst.Put(k, v); err != nil {
+						return err
+					}
+					size += datasize.ByteSize(len(k) + len(v))
+				}
+				return err
+			}); err != nil {
+				return err
+			}
+			select {
+			default:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-logEvery.C:
+				log.Info("Moving bucket", "bucket", bucket, "key", fmt.Sprintf("%x", k))
+			}
+		}
+		return err
+	})
+}
+
+// Hot returns the KV of the hot buckets
+func (db *TieredKV) Hot() KV {
+	return db.hot
+}
+
+// Cold returns the KV of the cold buckets
+func (db *TieredKV) Cold() KV {
+	return db.cold
+}
+
+// IsCold tells whether the bucket is kept in the cold KV
+func (db *TieredKV) IsCold(bucket string) bool {
+	_, ok := db.coldSet[bucket]
+	return ok
+}
+
+func (db *TieredKV) View(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *TieredKV) Update(ctx context.Context, f func(tx RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *TieredKV) Close() {
+	db.hot.Close()
+	db.cold.Close()
+}
+
+func (db *TieredKV) CollectMetrics() {
+	db.hot.CollectMetrics()
+	db.cold.CollectMetrics()
+}
+
+func (db *TieredKV) Begin(ctx context.Context) (Tx, error) {
+	hot, err := db.hot.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := db.cold.Begin(ctx)
+	if err != nil {
+		hot.Rollback()
+		return nil, err
+	}
+	return &tieredTx{db: db, hot: hot, cold: cold}, nil
+}
+
+// BeginRw - the write transactions of both KVs are open for the whole transaction, the cold one is locked
+// after the hot one, as the transactions of the cold KV are only begun by TieredKV
+func (db *TieredKV) BeginRw(ctx context.Context) (RwTx, error) {
+	hot, err := db.hot.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := db.cold.BeginRw(ctx)
+	if err != nil {
+		hot.Rollback()
+		return nil, err
+	}
+	return &tieredTx{db: db, hot: hot, cold: cold}, nil
+}
+
+func (db *TieredKV) AllBuckets() dbutils.BucketsCfg {
+	return db.hot.AllBuckets()
+}
+
+// DiskSize is the size of both KVs
+func (db *TieredKV) DiskSize(ctx context.Context) (uint64, error) {
+	var size uint64
+	for _, kv := range []KV{db.hot, db.cold} {
+		stats, ok := kv.(HasStats)
+		if !ok {
+			continue
+		}
+		sz, err := stats.DiskSize(ctx)
+		if err != nil {
+			return 0, err
+		}
+		size += sz
+	}
+	return size, nil
+}
+
+// SetDurability switches the durability of both KVs, if they support it
+func (db *TieredKV) SetDurability(d Durability) error {
+	for _, kv := range []KV{db.hot, db.cold} {
+		if setter, ok := kv.(DurabilitySetter); ok {
+			if err := setter.SetDurability(d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *TieredKV) Durability() Durability {
+	if setter, ok := db.hot.(DurabilitySetter); ok {
+		return setter.Durability()
+	}
+	return DefaultDurability
+}
+
+type tieredTx struct {
+	db        *TieredKV
+	hot, cold Tx
+}
+
+func (tx *tieredTx) route(bucket string) Tx {
+	if tx.db.IsCold(bucket) {
+		return tx.cold
+	}
+	return tx.hot
+}
+
+func (tx *tieredTx) Cursor(bucket string) Cursor {
+	return tx.route(bucket).Cursor(bucket)
+}
+
+func (tx *tieredTx) CursorDupSort(bucket string) CursorDupSort {
+	return tx.route(bucket).CursorDupSort(bucket)
+}
+
+func (tx *tieredTx) RwCursor(bucket string) RwCursor {
+	return tx.route(bucket).(RwTx).RwCursor(bucket)
+}
+
+func (tx *tieredTx) RwCursorDupSort(bucket string) RwCursorDupSort {
+	return tx.route(bucket).(RwTx).RwCursorDupSort(bucket)
+}
+
+func (tx *tieredTx) GetOne(bucket string, key []byte) ([]byte, error) {
+	return tx.route(bucket).GetOne(bucket, key)
+}
+
+func (tx *tieredTx) HasOne(bucket string, key []byte) (bool, error) {
+	return tx.route(bucket).HasOne(bucket, key)
+}
+
+// Commit commits the cold transaction first, see TieredKV
+func (tx *tieredTx) Commit(ctx context.Context) error {
+	if err := tx.cold.Commit(ctx); err != nil {
+		tx.hot.Rollback()
+		return fmt.Errorf("committing the cold database: %w", err)
+	}
+	if err := tx.hot.Commit(ctx); err != nil {
+		return fmt.Errorf("committing the hot database, the cold one is committed: %w", err)
+	}
+	return nil
+}
+
+func (tx *tieredTx) Rollback() {
+	tx.cold.Rollback()
+	tx.hot.Rollback()
+}
+
+func (tx *tieredTx) BucketSize(name string) (uint64, error) {
+	return tx.route(name).BucketSize(name)
+}
+
+func (tx *tieredTx) Comparator(bucket string) dbutils.CmpFunc {
+	return tx.route(bucket).Comparator(bucket)
+}
+
+func (tx *tieredTx) ReadSequence(bucket string) (uint64, error) {
+	return tx.route(bucket).ReadSequence(bucket)
+}
+
+func (tx *tieredTx) IncrementSequence(bucket string, amount uint64) (uint64, error) {
+	return tx.route(bucket).(RwTx).IncrementSequence(bucket, amount)
+}
+
+// CHandle is the handle of the hot transaction
+func (tx *tieredTx) CHandle() unsafe.Pointer {
+	return tx.hot.CHandle()
+}
+
+func (tx *tieredTx) DropBucket(bucket string) error {
+	return tx.route(bucket).(BucketMigrator).DropBucket(bucket)
+}
+
+func (tx *tieredTx) CreateBucket(bucket string) error {
+	return tx.route(bucket).(BucketMigrator).CreateBucket(bucket)
+}
+
+func (tx *tieredTx) ExistsBucket(bucket string) bool {
+	return tx.route(bucket).(BucketMigrator).ExistsBucket(bucket)
+}
+
+func (tx *tieredTx) ClearBucket(bucket string) error {
+	return tx.route(bucket).(BucketMigrator).ClearBucket(bucket)
+}
+
+// ExistingBuckets are the ones of the hot KV, the cold buckets exist in both
+func (tx *tieredTx) ExistingBuckets() ([]string, error) {
+	return tx.hot.(BucketMigrator).ExistingBuckets()
+}
+
+func (tx *tieredTx) bucketStats(name string) (BucketStats, error) {
+	st, ok := tx.route(name).(statTx)
+	if !ok {
+		return BucketStats{}, fmt.Errorf("%w by %T", ErrBucketsStatNotSupported, tx.route(name))
+	}
+	return st.bucketStats(name)
+}
+
+// spaceStats are the ones of the hot KV, the space of the cold one is watched separately
+func (tx *tieredTx) spaceStats(stats *DBStats) error {
+	st, ok := tx.hot.(statTx)
+	if !ok {
+		return fmt.Errorf("%w by %T", ErrBucketsStatNotSupported, tx.hot)
+	}
+	return st.spaceStats(stats)
+}
@@ -0,0 +1,95 @@
+package ethdb
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredKV(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(42))
+	coldBuckets := []string{dbutils.PlainAccountChangeSetBucket, dbutils.HeadersBucket}
+	hot, cold, expected := NewLMDB().InMem().MustOpen(), NewLMDB().InMem().MustOpen(), NewLMDB().InMem().MustOpen()
+	defer expected.Close()
+
+	// The data written before the split has to be moved
+	require.NoError(t, hot.Update(ctx, func(tx RwTx) error {
+		return tx.RwCursor(dbutils.HeadersBucket).Put([]byte{1}, []byte{1})
+	}))
+	_, err := NewTieredKV(ctx, hot, cold, coldBuckets)
+	require.Error(t, err)
+	require.NoError(t, MoveBuckets(ctx, hot, cold, coldBuckets, true))
+	require.NoError(t, expected.Update(ctx, func(tx RwTx) error {
+		return tx.RwCursor(dbutils.HeadersBucket).Put([]byte{1}, []byte{1})
+	}))
+
+	tiered, err := NewTieredKV(ctx, hot, cold, coldBuckets)
+	require.NoError(t, err)
+	defer tiered.Close()
+	for round := 0; round < 5; round++ {
+		tx, err := tiered.BeginRw(ctx)
+		require.NoError(t, err)
+		expectedTx, err := expected.BeginRw(ctx)
+		require.NoError(t, err)
+		overlayTestOps(t, rnd, tx, expectedTx)
+		require.NoError(t, tx.Commit(ctx))
+		require.NoError(t, expectedTx.Commit(ctx))
+	}
+
+	require.NoError(t, expected.View(ctx, func(expectedTx Tx) error {
+		return tiered.View(ctx, func(tx Tx) error {
+			for _, bucket := range overlayTestBuckets {
+				require.Equal(t, overlayTestDump(t, expectedTx, bucket, false), overlayTestDump(t, tx, bucket, false), bucket)
+				require.Equal(t, overlayTestDump(t, expectedTx, bucket, true), overlayTestDump(t, tx, bucket, true), bucket)
+			}
+			return nil
+		})
+	}))
+	// Every bucket is kept in its KV only
+	for _, bucket := range overlayTestBuckets {
+		in, notIn := hot, cold
+		if tiered.IsCold(bucket) {
+			in, notIn = cold, hot
+		}
+		require.NoError(t, expected.View(ctx, func(expectedTx Tx) error {
+			return in.View(ctx, func(tx Tx) error {
+				require.Equal(t, overlayTestDump(t, expectedTx, bucket, false), overlayTestDump(t, tx, bucket, false), bucket)
+				return nil
+			})
+		}))
+		require.NoError(t, notIn.View(ctx, func(tx Tx) error {
+			require.Empty(t, overlayTestDump(t, tx, bucket, false), bucket)
+			return nil
+		}))
+	}
+
+	// The recorded split is enforced
+	_, err = NewTieredKV(ctx, hot, cold, []string{dbutils.HeadersBucket})
+	require.Error(t, err)
+	require.NoError(t, hot.View(ctx, func(tx Tx) error {
+		buckets, err := ReadColdBuckets(tx)
+		require.NoError(t, err)
+		require.Equal(t, []string{dbutils.PlainAccountChangeSetBucket, dbutils.HeadersBucket}, buckets)
+		return nil
+	}))
+
+	// The moved back bucket is in the hot KV only
+	require.NoError(t, MoveBuckets(ctx, hot, cold, []string{dbutils.HeadersBucket}, false))
+	require.NoError(t, expected.View(ctx, func(expectedTx Tx) error {
+		require.NoError(t, hot.View(ctx, func(tx Tx) error {
+			require.Equal(t, overlayTestDump(t, expectedTx, dbutils.HeadersBucket, false), overlayTestDump(t, tx, dbutils.HeadersBucket, false))
+			buckets, err := ReadColdBuckets(tx)
+			require.NoError(t, err)
+			require.Equal(t, []string{dbutils.PlainAccountChangeSetBucket}, buckets)
+			return nil
+		}))
+		return cold.View(ctx, func(tx Tx) error {
+			require.Empty(t, overlayTestDump(t, tx, dbutils.HeadersBucket, false))
+			return nil
+		})
+	}))
+}
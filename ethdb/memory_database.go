@@ -17,6 +17,8 @@
 package ethdb
 
 import (
+	"fmt"
+
 	"github.com/ledgerwatch/turbo-geth/common/debug"
 )
 
@@ -26,15 +28,15 @@ func NewMemoryDatabase() *ObjectDatabase {
 }
 
 func NewMemDatabase() *ObjectDatabase {
-	switch debug.TestDB() {
-	case "lmdb":
-		return NewObjectDatabase(NewLMDB().InMem().MustOpen())
-	case "mdbx": //nolint:goconst
-		return NewObjectDatabase(NewMDBX().InMem().MustOpen())
-	default:
-		// mdbx is too slow for our tests currently, so we keep
-		// lmdb as our in-mem db
-		// with mdbx tests time out, especially ./tests package
-		return NewObjectDatabase(NewLMDB().InMem().MustOpen())
+	if testDB := debug.TestDB(); testDB != "" {
+		kv, err := OpenBackend(testDB, BackendOpts{InMem: true})
+		if err != nil {
+			panic(fmt.Errorf("fail to open %s: %w", testDB, err))
+		}
+		return NewObjectDatabase(kv)
 	}
+	// mdbx is too slow for our tests currently, so we keep
+	// lmdb as our in-mem db
+	// with mdbx tests time out, especially ./tests package
+	return NewObjectDatabase(NewLMDB().InMem().MustOpen())
 }
@@ -352,6 +352,14 @@ func (m *mutation) SetKV(kv KV) {
 	m.db.(HasKV).SetKV(kv)
 }
 
+// Ancient reads the ancient block from the store of the database, nil if it has none
+func (m *mutation) Ancient(kind string, number uint64) ([]byte, error) {
+	if ancients, ok := m.db.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	return nil, nil
+}
+
 // [TURBO-GETH] Freezer support (not implemented yet)
 // Ancients returns an error as we don't have a backing chain freezer.
 func (m *mutation) Ancients() (uint64, error) {
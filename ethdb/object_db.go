@@ -55,18 +55,14 @@ func MustOpen(path string) *ObjectDatabase {
 	return db
 }
 
-// Open - main method to open database. Choosing driver based on path suffix.
+// Open - main method to open database. Choosing driver based on path suffix, e.g. `chaindata_mdbx`.
 // If env TEST_DB provided - choose driver based on it. Some test using this method to open non-in-memory db
 func Open(path string, readOnly bool) (*ObjectDatabase, error) {
 	var kv KV
 	var err error
-	testDB := debug.TestDB()
-	switch true {
-	case testDB == "lmdb" || strings.HasSuffix(path, "_lmdb"):
-		kv, err = NewLMDB().Path(path).Open()
-	case testDB == "mdbx" || strings.HasSuffix(path, "_mdbx"):
-		kv, err = NewMDBX().Path(path).Open()
-	default:
+	if name := backendOf(path); name != "" {
+		kv, err = OpenBackend(name, BackendOpts{Path: path, ReadOnly: readOnly})
+	} else {
 		opts := NewLMDB().Path(path)
 		if readOnly {
 			opts = opts.Flags(func(flags uint) uint { return flags | lmdb.Readonly })
@@ -80,6 +76,19 @@ func Open(path string, readOnly bool) (*ObjectDatabase, error) {
 	return NewObjectDatabase(kv), nil
 }
 
+// backendOf returns the backend chosen by env TEST_DB or by the suffix of the path, empty for the default one
+func backendOf(path string) string {
+	if testDB := debug.TestDB(); HasBackend(testDB) {
+		return strings.ToLower(testDB)
+	}
+	for _, name := range Backends() {
+		if strings.HasSuffix(path, "_"+name) {
+			return name
+		}
+	}
+	return ""
+}
+
 // Put inserts or updates a single entry.
 func (db *ObjectDatabase) Put(bucket string, key []byte, value []byte) error {
 	err := db.kv.Update(context.Background(), func(tx RwTx) error {
@@ -346,6 +355,14 @@ func (db *ObjectDatabase) Begin(ctx context.Context, flags TxFlags) (DbWithPendi
 	return batch, nil
 }
 
+// Ancient reads the ancient block from the store of the KV, nil if it has none
+func (db *ObjectDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	if ancients, ok := db.kv.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	return nil, nil
+}
+
 // [TURBO-GETH] Freezer support (not implemented yet)
 // Ancients returns an error as we don't have a backing chain freezer.
 func (db *ObjectDatabase) Ancients() (uint64, error) {
@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces/remote"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -20,13 +24,14 @@ import (
 type EthBackendServer struct {
 	remote.UnimplementedETHBACKENDServer // must be embedded to have forward compatible implementations.
 
+	kv     ethdb.KV
 	eth    core.EthBackend
 	events *Events
 	ethash *ethash.API
 }
 
-func NewEthBackendServer(eth core.EthBackend, events *Events, ethashApi *ethash.API) *EthBackendServer {
-	return &EthBackendServer{eth: eth, events: events, ethash: ethashApi}
+func NewEthBackendServer(kv ethdb.KV, eth core.EthBackend, events *Events, ethashApi *ethash.API) *EthBackendServer {
+	return &EthBackendServer{kv: kv, eth: eth, events: events, ethash: ethashApi}
 }
 
 func (s *EthBackendServer) Add(_ context.Context, in *remote.TxRequest) (*remote.AddReply, error) {
@@ -37,7 +42,11 @@ func (s *EthBackendServer) Add(_ context.Context, in *remote.TxRequest) (*remote
 		return out, err
 	}
 
-	if err := s.eth.TxPool().AddLocal(signedTx); err != nil {
+	txPool := s.eth.TxPool()
+	if txPool == nil {
+		return out, errors.New("transaction pool is not available")
+	}
+	if err := txPool.AddLocal(signedTx); err != nil {
 		return out, err
 	}
 
@@ -147,3 +156,146 @@ func (s *EthBackendServer) Mining(_ context.Context, req *remote.MiningRequest)
 	}
 	return &remote.MiningReply{Enabled: s.eth.IsMining(), Running: true}, nil
 }
+
+func (s *EthBackendServer) BuildBlock(_ context.Context, req *remote.BuildBlockRequest) (*remote.BuildBlockReply, error) {
+	txHashes := make([]common.Hash, len(req.TxHashes))
+	for i, hash := range req.TxHashes {
+		txHashes[i] = gointerfaces.ConvertH256ToHash(hash)
+	}
+	block, receipts, err := s.eth.BuildBlock(gointerfaces.ConvertH256ToHash(req.ParentHash), txHashes)
+	if err != nil {
+		return nil, err
+	}
+	out := &remote.BuildBlockReply{}
+	if out.Block, err = rlp.EncodeToBytes(block); err != nil {
+		return nil, err
+	}
+	if out.Receipts, err = rlp.EncodeToBytes(receipts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *EthBackendServer) InsertBlocks(_ context.Context, req *remote.InsertBlocksRequest) (*remote.InsertBlocksReply, error) {
+	if len(req.Blocks) == 0 {
+		return nil, errors.New("no blocks given")
+	}
+	blocks := make([]*types.Block, len(req.Blocks))
+	for i, enc := range req.Blocks {
+		blocks[i] = new(types.Block)
+		if err := rlp.DecodeBytes(enc, blocks[i]); err != nil {
+			return nil, fmt.Errorf("decoding block %d: %w", i, err)
+		}
+	}
+	canonical, err := s.eth.InsertBlocks(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return &remote.InsertBlocksReply{Canonical: canonical}, nil
+}
+
+// blocksBatch is the number of the blocks streamed in one read transaction, so the transaction isn't held open for
+// long while the client applies the backpressure
+const blocksBatch = 1024
+
+// Blocks streams the canonical blocks from the requested one up to the head of the synced chain, and then the new
+// ones as the head moves, notified by the header events
+func (s *EthBackendServer) Blocks(req *remote.BlocksRequest, stream remote.ETHBACKEND_BlocksServer) error {
+	newHead := make(chan struct{}, 1)
+	s.events.AddHeaderSubscription(func(*types.Header) error {
+		if err := stream.Context().Err(); err != nil {
+			return err // removes the subscription
+		}
+		select {
+		case newHead <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	next := req.FromBlock
+	var last common.Hash // hash of the last streamed block, the reorgs below it are detected by it
+	for {
+		more, err := s.streamBlocks(stream, &next, &last)
+		if err != nil {
+			return err
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-newHead:
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// streamBlocks streams the batch of the canonical blocks from next, preceded by the reorg marker if the last streamed
+// block is no longer canonical. It returns whether there are more blocks up to the head
+func (s *EthBackendServer) streamBlocks(stream remote.ETHBACKEND_BlocksServer, next *uint64, last *common.Hash) (bool, error) {
+	tx, err := ethdb.NewObjectDatabase(s.kv).Begin(stream.Context(), ethdb.RO)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	head, err := stages.GetStageProgress(tx, stages.Finish)
+	if err != nil {
+		return false, err
+	}
+	if *last != (common.Hash{}) {
+		ancestor, hash, err := canonicalAncestor(tx, head, *next-1, *last)
+		if err != nil {
+			return false, err
+		}
+		if hash != *last {
+			if err = stream.Send(&remote.BlocksReply{Reorg: true, Number: ancestor, Hash: gointerfaces.ConvertHashToH256(hash)}); err != nil {
+				return false, err
+			}
+			*next, *last = ancestor+1, hash
+		}
+	}
+	for n := 0; *next <= head; n++ {
+		if n == blocksBatch {
+			return true, nil
+		}
+		hash, err := rawdb.ReadCanonicalHash(tx, *next)
+		if err != nil {
+			return false, err
+		}
+		header := rawdb.ReadHeaderRLP(tx, hash, *next)
+		body := rawdb.ReadBody(tx, hash, *next)
+		if header == nil || body == nil {
+			return false, fmt.Errorf("canonical block %d %x not found", *next, hash)
+		}
+		reply := &remote.BlocksReply{Number: *next, Hash: gointerfaces.ConvertHashToH256(hash), Header: header}
+		if reply.Body, err = rlp.EncodeToBytes(body); err != nil {
+			return false, err
+		}
+		if err = stream.Send(reply); err != nil {
+			return false, err
+		}
+		*next, *last = *next+1, hash
+	}
+	return false, nil
+}
+
+// canonicalAncestor follows the parents of the block until the canonical one not above the head, and returns its
+// number and hash. The canonical hashes above the head may be left over by the unwinds
+func canonicalAncestor(db ethdb.Getter, head, number uint64, hash common.Hash) (uint64, common.Hash, error) {
+	for {
+		if number <= head {
+			canonical, err := rawdb.ReadCanonicalHash(db, number)
+			if err != nil {
+				return 0, common.Hash{}, err
+			}
+			if canonical == hash || number == 0 {
+				return number, canonical, nil
+			}
+		}
+		header := rawdb.ReadHeader(db, hash, number)
+		if header == nil {
+			return 0, common.Hash{}, fmt.Errorf("header %d %x not found", number, hash)
+		}
+		number, hash = number-1, header.ParentHash
+	}
+}
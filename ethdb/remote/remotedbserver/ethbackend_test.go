@@ -0,0 +1,95 @@
+package remotedbserver
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/remote"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestBlocksStream(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The chain a, and the chain b forking off it above the block 2
+	makeChain := func(parent *types.Block, n int, extra byte) []*types.Block {
+		var blocks []*types.Block
+		for i := 0; i < n; i++ {
+			header := &types.Header{Number: new(big.Int).Add(parent.Number(), big.NewInt(1)), ParentHash: parent.Hash(), Extra: []byte{extra}, Difficulty: big.NewInt(1)}
+			parent = types.NewBlockWithHeader(header)
+			blocks = append(blocks, parent)
+		}
+		return blocks
+	}
+	genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)})
+	a := append([]*types.Block{genesis}, makeChain(genesis, 5, 'a')...)
+	b := makeChain(a[2], 2, 'b')
+	insert := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			require.NoError(t, rawdb.WriteBlock(ctx, db, block))
+			require.NoError(t, rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64()))
+		}
+		require.NoError(t, stages.SaveStageProgress(db, stages.Finish, blocks[len(blocks)-1].NumberU64()))
+	}
+	insert(a[:4])
+
+	events := NewEvents()
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	remote.RegisterETHBACKENDServer(server, NewEthBackendServer(db.KV(), nil, events, nil))
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stream, err := remote.NewETHBACKENDClient(conn).Blocks(ctx, &remote.BlocksRequest{FromBlock: 1})
+	require.NoError(t, err)
+	expectBlocks := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			reply, err := stream.Recv()
+			require.NoError(t, err)
+			require.False(t, reply.Reorg)
+			assert.Equal(t, block.NumberU64(), reply.Number)
+			assert.Equal(t, block.Hash(), gointerfaces.ConvertH256ToHash(reply.Hash))
+			var header types.Header
+			require.NoError(t, rlp.DecodeBytes(reply.Header, &header))
+			assert.Equal(t, block.Hash(), header.Hash())
+			var body types.Body
+			require.NoError(t, rlp.DecodeBytes(reply.Body, &body))
+		}
+	}
+	expectBlocks(a[1:4])
+
+	// The new head is streamed once notified
+	insert(a[4:])
+	events.OnNewHeader(a[5].Header())
+	expectBlocks(a[4:])
+
+	// The reorg to the shorter chain b is marked by the fork block
+	insert(b)
+	events.OnNewHeader(b[1].Header())
+	reply, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, reply.Reorg)
+	assert.Equal(t, uint64(2), reply.Number)
+	assert.Equal(t, a[2].Hash(), gointerfaces.ConvertH256ToHash(reply.Hash))
+	expectBlocks(b)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/gointerfaces/remote"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/metrics"
 	"google.golang.org/grpc"
@@ -38,7 +39,7 @@ func StartGrpc(kv ethdb.KV, eth core.EthBackend, ethashApi *ethash.API, addr str
 
 	kv2Srv := NewKvServer(kv)
 	dbSrv := NewDBServer(kv)
-	ethBackendSrv := NewEthBackendServer(eth, events, ethashApi)
+	ethBackendSrv := NewEthBackendServer(kv, eth, events, ethashApi)
 	var (
 		streamInterceptors []grpc.StreamServerInterceptor
 		unaryInterceptors  []grpc.UnaryServerInterceptor
@@ -74,6 +75,9 @@ func StartGrpc(kv ethdb.KV, eth core.EthBackend, ethashApi *ethash.API, addr str
 	remote.RegisterDBServer(grpcServer, dbSrv)
 	remote.RegisterETHBACKENDServer(grpcServer, ethBackendSrv)
 	remote.RegisterKVServer(grpcServer, kv2Srv)
+	if txPool := eth.TxPool(); txPool != nil {
+		txpool.RegisterTxpoolServer(grpcServer, NewTxPoolServer(txPool))
+	}
 
 	if metrics.Enabled {
 		grpc_prometheus.Register(grpcServer)
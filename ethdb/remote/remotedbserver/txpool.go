@@ -0,0 +1,214 @@
+package remotedbserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+type TxPoolServer struct {
+	txpool.UnimplementedTxpoolServer // must be embedded to have forward compatible implementations.
+
+	txPool *core.TxPool
+}
+
+func NewTxPoolServer(txPool *core.TxPool) *TxPoolServer {
+	return &TxPoolServer{txPool: txPool}
+}
+
+// FindUnknownTransactions returns the hashes which are not in the pool, so the sentries
+// only request the bodies of the transactions announced by the peers which are not known yet
+func (s *TxPoolServer) FindUnknownTransactions(_ context.Context, in *txpool.TxHashes) (*txpool.TxHashes, error) {
+	reply := &txpool.TxHashes{}
+	for _, h := range in.Hashes {
+		if !s.txPool.Has(gointerfaces.ConvertH256ToHash(h)) {
+			reply.Hashes = append(reply.Hashes, h)
+		}
+	}
+	return reply, nil
+}
+
+// ImportTransactions adds the RLP-encoded transactions received from the network or built
+// externally into the pool, the results are in the order of the transactions
+func (s *TxPoolServer) ImportTransactions(_ context.Context, in *txpool.ImportRequest) (*txpool.ImportReply, error) {
+	reply := &txpool.ImportReply{Imported: make([]txpool.ImportResult, len(in.Txs))}
+	txs := make([]*types.Transaction, 0, len(in.Txs))
+	indices := make([]int, 0, len(in.Txs))
+	for i, enc := range in.Txs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, tx); err != nil {
+			reply.Imported[i] = txpool.ImportResult_INVALID
+			continue
+		}
+		txs = append(txs, tx)
+		indices = append(indices, i)
+	}
+	for i, err := range s.txPool.AddRemotes(txs) {
+		reply.Imported[indices[i]] = importResult(err)
+	}
+	return reply, nil
+}
+
+func importResult(err error) txpool.ImportResult {
+	switch {
+	case err == nil:
+		return txpool.ImportResult_SUCCESS
+	case errors.Is(err, core.ErrAlreadyKnown):
+		return txpool.ImportResult_ALREADY_EXISTS
+	case errors.Is(err, core.ErrUnderpriced), errors.Is(err, core.ErrReplaceUnderpriced), errors.Is(err, core.ErrTxPoolOverflow):
+		return txpool.ImportResult_FEE_TOO_LOW
+	case errors.Is(err, core.ErrNonceTooLow):
+		return txpool.ImportResult_STALE
+	default:
+		return txpool.ImportResult_INVALID
+	}
+}
+
+// GetTransactions returns the RLP-encoded transactions in the order of the hashes,
+// the transactions which are not in the pool are returned empty
+func (s *TxPoolServer) GetTransactions(_ context.Context, in *txpool.GetTransactionsRequest) (*txpool.GetTransactionsReply, error) {
+	reply := &txpool.GetTransactionsReply{Txs: make([][]byte, len(in.Hashes))}
+	for i, h := range in.Hashes {
+		tx := s.txPool.Get(gointerfaces.ConvertH256ToHash(h))
+		if tx == nil {
+			continue
+		}
+		var err error
+		if reply.Txs[i], err = rlp.EncodeToBytes(tx); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+func (s *TxPoolServer) RemoveTransactions(_ context.Context, in *txpool.TxHashes) (*txpool.TxHashes, error) {
+	reply := &txpool.TxHashes{}
+	for _, h := range in.Hashes {
+		hash := gointerfaces.ConvertH256ToHash(h)
+		if !s.txPool.Has(hash) {
+			continue
+		}
+		s.txPool.RemoveTx(hash, true)
+		reply.Hashes = append(reply.Hashes, h)
+	}
+	return reply, nil
+}
+
+func (s *TxPoolServer) OnPending(_ *txpool.OnPendingRequest, stream txpool.Txpool_OnPendingServer) error {
+	ch := make(chan core.NewTxsEvent, 256)
+	sub := s.txPool.SubscribeNewTxsEvent(ch)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case ev := <-ch:
+			reply := &txpool.OnPendingReply{Txs: make([][]byte, len(ev.Txs))}
+			for i, tx := range ev.Txs {
+				var err error
+				if reply.Txs[i], err = rlp.EncodeToBytes(tx); err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+		case err := <-sub.Err(): // closed with nil when the pool stops
+			return err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (s *TxPoolServer) BestTransactions(_ context.Context, in *txpool.BestRequest) (*txpool.BestReply, error) {
+	pending, err := s.txPool.Pending()
+	if err != nil {
+		return nil, err
+	}
+	var baseFee *uint256.Int
+	if in.BaseFee != nil {
+		baseFee = gointerfaces.ConvertH256ToUint256Int(in.BaseFee)
+	}
+	reply := &txpool.BestReply{}
+	txs := types.NewTransactionsByPriceAndNonce(s.txPool.Signer(), pending, baseFee)
+	for tx := txs.Peek(); tx != nil && (in.Limit == 0 || len(reply.Txs) < int(in.Limit)); tx = txs.Peek() {
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return nil, err
+		}
+		reply.Txs = append(reply.Txs, enc)
+		txs.Shift()
+	}
+	return reply, nil
+}
+
+func (s *TxPoolServer) Status(_ context.Context, _ *txpool.StatusRequest) (*txpool.StatusReply, error) {
+	pending, queued := s.txPool.Stats()
+	return &txpool.StatusReply{PendingCount: uint32(pending), QueuedCount: uint32(queued)}, nil
+}
+
+func (s *TxPoolServer) Content(_ context.Context, in *txpool.ContentRequest) (*txpool.ContentReply, error) {
+	reply := &txpool.ContentReply{}
+	if in.Sender != nil {
+		sender := gointerfaces.ConvertH160toAddress(in.Sender)
+		pending, queued := s.txPool.ContentFrom(sender)
+		if len(pending) == 0 && len(queued) == 0 {
+			return reply, nil
+		}
+		txs, err := encodeSenderTransactions(sender, pending, queued)
+		if err != nil {
+			return nil, err
+		}
+		reply.Senders = append(reply.Senders, txs)
+		return reply, nil
+	}
+
+	pending, queued := s.txPool.Content()
+	senders := make([]common.Address, 0, len(pending)+len(queued))
+	for sender := range pending {
+		senders = append(senders, sender)
+	}
+	for sender := range queued {
+		if _, ok := pending[sender]; !ok {
+			senders = append(senders, sender)
+		}
+	}
+	sort.Slice(senders, func(i, j int) bool { return bytes.Compare(senders[i][:], senders[j][:]) < 0 })
+	reply.Senders = make([]*txpool.SenderTransactions, len(senders))
+	for i, sender := range senders {
+		txs, err := encodeSenderTransactions(sender, pending[sender], queued[sender])
+		if err != nil {
+			return nil, err
+		}
+		reply.Senders[i] = txs
+	}
+	return reply, nil
+}
+
+func encodeSenderTransactions(sender common.Address, pending, queued types.Transactions) (*txpool.SenderTransactions, error) {
+	out := &txpool.SenderTransactions{
+		Sender:  gointerfaces.ConvertAddressToH160(sender),
+		Pending: make([][]byte, len(pending)),
+		Queued:  make([][]byte, len(queued)),
+	}
+	var err error
+	for i, tx := range pending {
+		if out.Pending[i], err = rlp.EncodeToBytes(tx); err != nil {
+			return nil, err
+		}
+	}
+	for i, tx := range queued {
+		if out.Queued[i], err = rlp.EncodeToBytes(tx); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package remotedbserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces"
+	"github.com/ledgerwatch/turbo-geth/gointerfaces/txpool"
+	proto_types "github.com/ledgerwatch/turbo-geth/gointerfaces/types"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTxPoolServer(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keyA, _ := crypto.GenerateKey()
+	keyB, _ := crypto.GenerateKey()
+	ibs := state.New(state.NewPlainStateReader(db))
+	ibs.AddBalance(crypto.PubkeyToAddress(keyA.PublicKey), uint256.NewInt().SetUint64(params.Ether))
+	ibs.AddBalance(crypto.PubkeyToAddress(keyB.PublicKey), uint256.NewInt().SetUint64(params.Ether))
+	require.NoError(t, ibs.CommitBlock(ctx, state.NewPlainStateWriter(db, nil, 1)))
+
+	config := core.DefaultTxPoolConfig
+	config.Journal = false
+	pool := core.NewTxPool(config, params.TestChainConfig, db, nil)
+	require.NoError(t, pool.Start(1000000000, 0))
+	defer pool.Stop()
+
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	txpool.RegisterTxpoolServer(server, NewTxPoolServer(pool))
+	go server.Serve(lis) //nolint:errcheck
+	defer server.Stop()
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := txpool.NewTxpoolClient(conn)
+
+	pending, err := client.OnPending(ctx, &txpool.OnPendingRequest{})
+	require.NoError(t, err)
+	// The stream is established by the first message, wait for the subscription to be registered
+	time.Sleep(100 * time.Millisecond)
+
+	a0, a1, b0 := signedTx(t, 0, 1, keyA), signedTx(t, 1, 3, keyA), signedTx(t, 0, 2, keyB)
+	imported, err := client.ImportTransactions(ctx, &txpool.ImportRequest{Txs: [][]byte{encodeTx(t, a0), encodeTx(t, a1), {0x01}, encodeTx(t, b0)}})
+	require.NoError(t, err)
+	assert.Equal(t, []txpool.ImportResult{txpool.ImportResult_SUCCESS, txpool.ImportResult_SUCCESS, txpool.ImportResult_INVALID, txpool.ImportResult_SUCCESS}, imported.Imported)
+	imported, err = client.ImportTransactions(ctx, &txpool.ImportRequest{Txs: [][]byte{encodeTx(t, a0)}})
+	require.NoError(t, err)
+	assert.Equal(t, []txpool.ImportResult{txpool.ImportResult_ALREADY_EXISTS}, imported.Imported)
+
+	// All the imported transactions become executable
+	announced := make(map[common.Hash]bool)
+	for len(announced) < 3 {
+		reply, err := pending.Recv()
+		require.NoError(t, err)
+		for _, enc := range reply.Txs {
+			announced[decodeTx(t, enc).Hash()] = true
+		}
+	}
+	assert.True(t, announced[a0.Hash()] && announced[a1.Hash()] && announced[b0.Hash()])
+
+	unknown := common.HexToHash("0x01")
+	hashes := &txpool.TxHashes{Hashes: []*proto_types.H256{gointerfaces.ConvertHashToH256(a0.Hash()), gointerfaces.ConvertHashToH256(unknown)}}
+	found, err := client.FindUnknownTransactions(ctx, hashes)
+	require.NoError(t, err)
+	require.Len(t, found.Hashes, 1)
+	assert.Equal(t, unknown, gointerfaces.ConvertH256ToHash(found.Hashes[0]))
+
+	txs, err := client.GetTransactions(ctx, &txpool.GetTransactionsRequest{Hashes: hashes.Hashes})
+	require.NoError(t, err)
+	require.Len(t, txs.Txs, 2)
+	assert.Equal(t, a0.Hash(), decodeTx(t, txs.Txs[0]).Hash())
+	assert.Empty(t, txs.Txs[1])
+
+	// The best transaction of A pays less than the one of B, the nonces are still honoured
+	best, err := client.BestTransactions(ctx, &txpool.BestRequest{})
+	require.NoError(t, err)
+	require.Len(t, best.Txs, 3)
+	assert.Equal(t, []common.Hash{b0.Hash(), a0.Hash(), a1.Hash()}, []common.Hash{decodeTx(t, best.Txs[0]).Hash(), decodeTx(t, best.Txs[1]).Hash(), decodeTx(t, best.Txs[2]).Hash()})
+	best, err = client.BestTransactions(ctx, &txpool.BestRequest{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, best.Txs, 1)
+	assert.Equal(t, b0.Hash(), decodeTx(t, best.Txs[0]).Hash())
+
+	removed, err := client.RemoveTransactions(ctx, &txpool.TxHashes{Hashes: []*proto_types.H256{gointerfaces.ConvertHashToH256(b0.Hash()), gointerfaces.ConvertHashToH256(unknown)}})
+	require.NoError(t, err)
+	require.Len(t, removed.Hashes, 1)
+	assert.Equal(t, b0.Hash(), gointerfaces.ConvertH256ToHash(removed.Hashes[0]))
+	assert.False(t, pool.Has(b0.Hash()))
+}
+
+func signedTx(t *testing.T, nonce uint64, gasPrice uint64, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, err := types.SignTx(types.NewTransaction(nonce, common.Address{}, uint256.NewInt().SetUint64(100), params.TxGas, uint256.NewInt().SetUint64(gasPrice), nil), types.HomesteadSigner{}, key)
+	require.NoError(t, err)
+	return tx
+}
+
+func encodeTx(t *testing.T, tx *types.Transaction) []byte {
+	enc, err := rlp.EncodeToBytes(tx)
+	require.NoError(t, err)
+	return enc
+}
+
+func decodeTx(t *testing.T, enc []byte) *types.Transaction {
+	tx := new(types.Transaction)
+	require.NoError(t, rlp.DecodeBytes(enc, tx))
+	return tx
+}
@@ -8,10 +8,14 @@ import (
 )
 
 type StorageMode struct {
-	History    bool
-	Receipts   bool
-	TxIndex    bool
-	CallTraces bool
+	History        bool
+	Receipts       bool
+	TxIndex        bool
+	CallTraces     bool
+	Witnesses      bool
+	Preimages      bool
+	AccountRanks   bool
+	TokenTransfers bool
 }
 
 var DefaultStorageMode = StorageMode{History: true, Receipts: true, TxIndex: true, CallTraces: false}
@@ -30,6 +34,18 @@ func (m StorageMode) ToString() string {
 	if m.CallTraces {
 		modeString += "c"
 	}
+	if m.Witnesses {
+		modeString += "w"
+	}
+	if m.Preimages {
+		modeString += "p"
+	}
+	if m.AccountRanks {
+		modeString += "k"
+	}
+	if m.TokenTransfers {
+		modeString += "e"
+	}
 	return modeString
 }
 
@@ -45,6 +61,14 @@ func StorageModeFromString(flags string) (StorageMode, error) {
 			mode.TxIndex = true
 		case 'c':
 			mode.CallTraces = true
+		case 'w':
+			mode.Witnesses = true
+		case 'p':
+			mode.Preimages = true
+		case 'k':
+			mode.AccountRanks = true
+		case 'e':
+			mode.TokenTransfers = true
 		default:
 			return mode, fmt.Errorf("unexpected flag found: %c", flag)
 		}
@@ -83,6 +107,30 @@ func GetStorageModeFromDB(db Database) (StorageMode, error) {
 	}
 	sm.CallTraces = len(v) == 1 && v[0] == 1
 
+	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeBlockWitnesses)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return StorageMode{}, err
+	}
+	sm.Witnesses = len(v) == 1 && v[0] == 1
+
+	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModePreimages)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return StorageMode{}, err
+	}
+	sm.Preimages = len(v) == 1 && v[0] == 1
+
+	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeAccountRanks)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return StorageMode{}, err
+	}
+	sm.AccountRanks = len(v) == 1 && v[0] == 1
+
+	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeTokenTransfers)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return StorageMode{}, err
+	}
+	sm.TokenTransfers = len(v) == 1 && v[0] == 1
+
 	return sm, nil
 }
 
@@ -110,6 +158,26 @@ func SetStorageModeIfNotExist(db Database, sm StorageMode) error {
 		return err
 	}
 
+	err = setModeOnEmpty(db, dbutils.StorageModeBlockWitnesses, sm.Witnesses)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, dbutils.StorageModePreimages, sm.Preimages)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, dbutils.StorageModeAccountRanks, sm.AccountRanks)
+	if err != nil {
+		return err
+	}
+
+	err = setModeOnEmpty(db, dbutils.StorageModeTokenTransfers, sm.TokenTransfers)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
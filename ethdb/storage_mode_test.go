@@ -23,6 +23,10 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		true,
 		true,
 		true,
+		true,
+		true,
+		true,
+		true,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -38,6 +42,10 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		true,
 		true,
 		true,
+		true,
+		true,
+		true,
+		true,
 	}) {
 		spew.Dump(sm)
 		t.Fatal("not equal")
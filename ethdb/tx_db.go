@@ -23,6 +23,7 @@ type TxDb struct {
 	txFlags TxFlags
 	cursors map[string]Cursor
 	len     uint64
+	ctx     context.Context // of the Begin, it carries the span the commit belongs to
 }
 
 func (m *TxDb) Close() {
@@ -106,6 +107,7 @@ func (m *TxDb) begin(ctx context.Context, flags TxFlags) error {
 		return err
 	}
 	m.tx = tx
+	m.ctx = ctx
 	m.cursors = make(map[string]Cursor, 16)
 	return nil
 }
@@ -356,7 +358,7 @@ func (m *TxDb) Commit() error {
 	if m.tx == nil {
 		return fmt.Errorf("second call .Commit() on same transaction")
 	}
-	if err := m.tx.Commit(context.Background()); err != nil {
+	if err := m.tx.Commit(m.ctx); err != nil {
 		return err
 	}
 	m.tx = nil
@@ -389,6 +391,17 @@ func (m *TxDb) panicOnEmptyDB() {
 	}
 }
 
+// Ancient reads the ancient block from the store of the transaction or of the database, nil if they have none
+func (m *TxDb) Ancient(kind string, number uint64) ([]byte, error) {
+	if ancients, ok := m.tx.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	if ancients, ok := m.db.(AncientReader); ok {
+		return ancients.Ancient(kind, number)
+	}
+	return nil, nil
+}
+
 // [TURBO-GETH] Freezer support (not implemented yet)
 // Ancients returns an error as we don't have a backing chain freezer.
 func (m *TxDb) Ancients() (uint64, error) {
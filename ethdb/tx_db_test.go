@@ -0,0 +1,43 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"github.com/ledgerwatch/turbo-geth/tracing/tracingtest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestTxDbCommitSpan(t *testing.T) {
+	spans := tracingtest.Record(t)
+	db := NewObjectDatabase(NewLMDB().InMem().MustOpen())
+	defer db.Close()
+	spans.Reset() // of the creation of the buckets
+
+	// The commit is the child of the span of the context the transaction was begun with
+	ctx, parent := tracing.Start(context.Background(), "cycle")
+	tx, err := db.Begin(ctx, RW)
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(dbutils.HeadersBucket, []byte{1}, []byte{2}))
+	require.NoError(t, tx.Commit())
+	parent.End()
+
+	commits := tracingtest.Find(spans, "db commit")
+	require.Len(t, commits, 1)
+	require.Equal(t, parent.SpanContext().TraceID(), commits[0].SpanContext.TraceID())
+	require.Equal(t, parent.SpanContext().SpanID(), commits[0].Parent.SpanID())
+	require.Equal(t, codes.Unset, commits[0].StatusCode)
+
+	// Without a span in the context the commit starts a trace
+	tx, err = db.Begin(context.Background(), RW)
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(dbutils.HeadersBucket, []byte{1}, []byte{3}))
+	require.NoError(t, tx.Commit())
+	commits = tracingtest.Find(spans, "db commit")
+	require.Len(t, commits, 2)
+	require.False(t, commits[1].Parent.IsValid())
+	require.NotEqual(t, parent.SpanContext().TraceID(), commits[1].SpanContext.TraceID())
+}
@@ -0,0 +1,154 @@
+package ethdb
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+const (
+	// DefaultReadTxWarn is the age of the read transaction after which it is logged with the stack of its holder
+	DefaultReadTxWarn = 5 * time.Minute
+
+	readTxCheckEvery = 10 * time.Second // period of the checks of the watchdog
+	readTxStackDepth = 32               // frames of the stack of the holder kept for the log
+)
+
+// ErrReadTxExpired is returned by the read transaction aborted by the watchdog, its holder has to roll it back
+var ErrReadTxExpired = errors.New("read transaction is open for too long, aborted")
+
+var (
+	readTxOpen    = metrics.GetOrRegisterGauge("db/readtx/open", metrics.DefaultRegistry)
+	readTxOldest  = metrics.GetOrRegisterGauge("db/readtx/oldest", metrics.DefaultRegistry) // seconds
+	readTxAborted = metrics.GetOrRegisterCounter("db/readtx/aborted", metrics.DefaultRegistry)
+)
+
+// readTxWatchdog tracks the age of the read transactions of the database. The pages freed after the start of
+// the oldest read transaction can't be reused until it is closed, so the forgotten or stuck transactions, e.g. of
+// the hanging RPC calls, make the database grow. The number of the open transactions and the age of the oldest one
+// are in the metrics, the ones older than warn are logged with the stack of their holder, and the ones older than
+// limit, if set, are aborted: all their reads fail with ErrReadTxExpired, so their holder rolls them back.
+// The transaction is not closed by the watchdog, the holder stuck outside of the database still keeps it open.
+type readTxWatchdog struct {
+	warn, limit time.Duration
+	log         log.Logger
+
+	lock sync.Mutex
+	txs  map[*watchedTx]struct{}
+	quit chan struct{}
+}
+
+// watchedTx is the read transaction tracked by the watchdog
+type watchedTx struct {
+	started time.Time
+	stack   []uintptr // stack of the holder, where the transaction was started
+	aborted int32     // set atomically by the watchdog, checked by the reads
+	warned  bool      // guarded by the lock of the watchdog
+}
+
+// newReadTxWatchdog starts the watchdog, warn is DefaultReadTxWarn if zero, the transactions are never aborted
+// if limit is zero
+func newReadTxWatchdog(logger log.Logger, warn, limit time.Duration) *readTxWatchdog {
+	if warn == 0 {
+		warn = DefaultReadTxWarn
+	}
+	w := &readTxWatchdog{warn: warn, limit: limit, log: logger, txs: map[*watchedTx]struct{}{}, quit: make(chan struct{})}
+	go w.loop()
+	return w
+}
+
+// add starts tracking the read transaction started by the caller, nil watchdog tracks nothing
+func (w *readTxWatchdog) add() *watchedTx {
+	if w == nil {
+		return nil
+	}
+	tx := &watchedTx{started: time.Now(), stack: make([]uintptr, readTxStackDepth)}
+	tx.stack = tx.stack[:runtime.Callers(3, tx.stack)] // skip runtime.Callers, add and Begin of the backend
+	w.lock.Lock()
+	w.txs[tx] = struct{}{}
+	w.lock.Unlock()
+	return tx
+}
+
+func (w *readTxWatchdog) remove(tx *watchedTx) {
+	if w == nil || tx == nil {
+		return
+	}
+	w.lock.Lock()
+	delete(w.txs, tx)
+	w.lock.Unlock()
+}
+
+func (w *readTxWatchdog) stop() {
+	if w != nil {
+		close(w.quit)
+	}
+}
+
+func (w *readTxWatchdog) loop() {
+	ticker := time.NewTicker(readTxCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.quit:
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check updates the metrics, logs the transactions older than warn once, and aborts the ones older than limit
+func (w *readTxWatchdog) check(now time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var oldest time.Duration
+	for tx := range w.txs {
+		age := now.Sub(tx.started)
+		if age > oldest {
+			oldest = age
+		}
+		if w.limit > 0 && age > w.limit && atomic.CompareAndSwapInt32(&tx.aborted, 0, 1) {
+			readTxAborted.Inc(1)
+			w.log.Warn("Aborting the long read transaction", "age", age.Round(time.Second), "limit", w.limit, "holder", tx.holder())
+			continue
+		}
+		if age > w.warn && !tx.warned {
+			tx.warned = true
+			w.log.Warn("Long read transaction prevents the reuse of the freed pages", "age", age.Round(time.Second), "holder", tx.holder())
+		}
+	}
+	readTxOpen.Update(int64(len(w.txs)))
+	readTxOldest.Update(int64(oldest / time.Second))
+}
+
+// expired is true if the transaction was aborted by the watchdog
+func (tx *watchedTx) expired() bool {
+	return tx != nil && atomic.LoadInt32(&tx.aborted) == 1
+}
+
+// holder is the stack where the transaction was started, from the caller of Begin
+func (tx *watchedTx) holder() string {
+	if len(tx.stack) == 0 {
+		return "unknown"
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(tx.stack)
+	for {
+		frame, more := frames.Next()
+		if sb.Len() > 0 {
+			sb.WriteString(" <- ")
+		}
+		fmt.Fprintf(&sb, "%s (%s:%d)", frame.Function, frame.File, frame.Line)
+		if !more {
+			return sb.String()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTxWatchdog(t *testing.T) {
+	ctx := context.Background()
+	kv := NewLMDB().InMem().ReadTxLimits(time.Minute, time.Hour).MustOpen()
+	defer kv.Close()
+	db := kv.(*LmdbKV)
+	require.NoError(t, kv.Update(ctx, func(tx RwTx) error {
+		return tx.RwCursor(dbutils.HeadersBucket).Put([]byte{1}, []byte{1})
+	}))
+
+	old, err := kv.Begin(ctx)
+	require.NoError(t, err)
+	defer old.Rollback()
+	c := old.Cursor(dbutils.HeadersBucket)
+	defer c.Close()
+	_, _, err = c.First()
+	require.NoError(t, err)
+
+	fresh, err := kv.Begin(ctx)
+	require.NoError(t, err)
+	defer fresh.Rollback()
+	freshWatched := fresh.(*lmdbTx).watched
+	require.NotNil(t, freshWatched)
+	oldWatched := old.(*lmdbTx).watched
+	require.Contains(t, oldWatched.holder(), "TestReadTxWatchdog")
+
+	// Only the read transactions are tracked
+	require.NoError(t, kv.Update(ctx, func(tx RwTx) error {
+		require.Nil(t, tx.(*lmdbTx).watched)
+		return nil
+	}))
+	require.Len(t, db.watchdog.txs, 2)
+
+	// The old transaction is past the limit, the fresh one only past the warning
+	oldWatched.started = oldWatched.started.Add(-2 * time.Hour)
+	freshWatched.started = freshWatched.started.Add(-2 * time.Minute)
+	db.watchdog.check(time.Now())
+	require.True(t, oldWatched.expired())
+	require.False(t, freshWatched.expired())
+	require.True(t, freshWatched.warned)
+
+	_, _, err = c.Next()
+	require.ErrorIs(t, err, ErrReadTxExpired)
+	_, err = old.GetOne(dbutils.HeadersBucket, []byte{1})
+	require.ErrorIs(t, err, ErrReadTxExpired)
+	v, err := fresh.GetOne(dbutils.HeadersBucket, []byte{1})
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, v)
+
+	old.Rollback()
+	fresh.Rollback()
+	require.Empty(t, db.watchdog.txs)
+}
@@ -45,6 +45,17 @@ type ETHBACKENDClient interface {
 	GetHashRate(ctx context.Context, in *GetHashRateRequest, opts ...grpc.CallOption) (*GetHashRateReply, error)
 	// Mining returns an indication if this node is currently mining and it's mining configuration
 	Mining(ctx context.Context, in *MiningRequest, opts ...grpc.CallOption) (*MiningReply, error)
+	// BuildBlock assembles the block the miner would build on top of the parent: selects the transactions
+	// of the pool, executes them and calculates the state root. The block is neither sealed nor broadcast.
+	BuildBlock(ctx context.Context, in *BuildBlockRequest, opts ...grpc.CallOption) (*BuildBlockReply, error)
+	// InsertBlocks imports the blocks built by an external source (e.g. a sequencer or a private consensus) through
+	// the staged sync, bypassing the p2p network. The blocks have to form a chain extending a known block, they are
+	// fully validated and executed.
+	InsertBlocks(ctx context.Context, in *InsertBlocksRequest, opts ...grpc.CallOption) (*InsertBlocksReply, error)
+	// Blocks streams the canonical headers and bodies from the requested block onward, following the head of the
+	// chain. When the chain is reorganised below the last streamed block, the reorg marker of the highest block
+	// shared by the old and the new canonical chains is streamed, and the new canonical blocks above it follow.
+	Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (ETHBACKEND_BlocksClient, error)
 }
 
 type eTHBACKENDClient struct {
@@ -159,6 +170,56 @@ func (c *eTHBACKENDClient) Mining(ctx context.Context, in *MiningRequest, opts .
 	return out, nil
 }
 
+func (c *eTHBACKENDClient) BuildBlock(ctx context.Context, in *BuildBlockRequest, opts ...grpc.CallOption) (*BuildBlockReply, error) {
+	out := new(BuildBlockReply)
+	err := c.cc.Invoke(ctx, "/remote.ETHBACKEND/BuildBlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eTHBACKENDClient) InsertBlocks(ctx context.Context, in *InsertBlocksRequest, opts ...grpc.CallOption) (*InsertBlocksReply, error) {
+	out := new(InsertBlocksReply)
+	err := c.cc.Invoke(ctx, "/remote.ETHBACKEND/InsertBlocks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eTHBACKENDClient) Blocks(ctx context.Context, in *BlocksRequest, opts ...grpc.CallOption) (ETHBACKEND_BlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ETHBACKEND_ServiceDesc.Streams[1], "/remote.ETHBACKEND/Blocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eTHBACKENDBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ETHBACKEND_BlocksClient interface {
+	Recv() (*BlocksReply, error)
+	grpc.ClientStream
+}
+
+type eTHBACKENDBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *eTHBACKENDBlocksClient) Recv() (*BlocksReply, error) {
+	m := new(BlocksReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ETHBACKENDServer is the server API for ETHBACKEND service.
 // All implementations must embed UnimplementedETHBACKENDServer
 // for forward compatibility
@@ -190,6 +251,17 @@ type ETHBACKENDServer interface {
 	GetHashRate(context.Context, *GetHashRateRequest) (*GetHashRateReply, error)
 	// Mining returns an indication if this node is currently mining and it's mining configuration
 	Mining(context.Context, *MiningRequest) (*MiningReply, error)
+	// BuildBlock assembles the block the miner would build on top of the parent: selects the transactions
+	// of the pool, executes them and calculates the state root. The block is neither sealed nor broadcast.
+	BuildBlock(context.Context, *BuildBlockRequest) (*BuildBlockReply, error)
+	// InsertBlocks imports the blocks built by an external source (e.g. a sequencer or a private consensus) through
+	// the staged sync, bypassing the p2p network. The blocks have to form a chain extending a known block, they are
+	// fully validated and executed.
+	InsertBlocks(context.Context, *InsertBlocksRequest) (*InsertBlocksReply, error)
+	// Blocks streams the canonical headers and bodies from the requested block onward, following the head of the
+	// chain. When the chain is reorganised below the last streamed block, the reorg marker of the highest block
+	// shared by the old and the new canonical chains is streamed, and the new canonical blocks above it follow.
+	Blocks(*BlocksRequest, ETHBACKEND_BlocksServer) error
 	mustEmbedUnimplementedETHBACKENDServer()
 }
 
@@ -224,6 +296,15 @@ func (UnimplementedETHBACKENDServer) GetHashRate(context.Context, *GetHashRateRe
 func (UnimplementedETHBACKENDServer) Mining(context.Context, *MiningRequest) (*MiningReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Mining not implemented")
 }
+func (UnimplementedETHBACKENDServer) BuildBlock(context.Context, *BuildBlockRequest) (*BuildBlockReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BuildBlock not implemented")
+}
+func (UnimplementedETHBACKENDServer) InsertBlocks(context.Context, *InsertBlocksRequest) (*InsertBlocksReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InsertBlocks not implemented")
+}
+func (UnimplementedETHBACKENDServer) Blocks(*BlocksRequest, ETHBACKEND_BlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method Blocks not implemented")
+}
 func (UnimplementedETHBACKENDServer) mustEmbedUnimplementedETHBACKENDServer() {}
 
 // UnsafeETHBACKENDServer may be embedded to opt out of forward compatibility for this service.
@@ -402,6 +483,63 @@ func _ETHBACKEND_Mining_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ETHBACKEND_BuildBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BuildBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ETHBACKENDServer).BuildBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.ETHBACKEND/BuildBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ETHBACKENDServer).BuildBlock(ctx, req.(*BuildBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ETHBACKEND_InsertBlocks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InsertBlocksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ETHBACKENDServer).InsertBlocks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.ETHBACKEND/InsertBlocks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ETHBACKENDServer).InsertBlocks(ctx, req.(*InsertBlocksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ETHBACKEND_Blocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ETHBACKENDServer).Blocks(m, &eTHBACKENDBlocksServer{stream})
+}
+
+type ETHBACKEND_BlocksServer interface {
+	Send(*BlocksReply) error
+	grpc.ServerStream
+}
+
+type eTHBACKENDBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *eTHBACKENDBlocksServer) Send(m *BlocksReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ETHBACKEND_ServiceDesc is the grpc.ServiceDesc for ETHBACKEND service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -441,6 +579,14 @@ var ETHBACKEND_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Mining",
 			Handler:    _ETHBACKEND_Mining_Handler,
 		},
+		{
+			MethodName: "BuildBlock",
+			Handler:    _ETHBACKEND_BuildBlock_Handler,
+		},
+		{
+			MethodName: "InsertBlocks",
+			Handler:    _ETHBACKEND_InsertBlocks_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -448,6 +594,11 @@ var ETHBACKEND_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ETHBACKEND_Subscribe_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Blocks",
+			Handler:       _ETHBACKEND_Blocks_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "remote/ethbackend.proto",
 }
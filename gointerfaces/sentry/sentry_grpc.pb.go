@@ -506,3 +506,167 @@ var Sentry_ServiceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "p2psentry/sentry.proto",
 }
+
+// SentryControlClient is the client API for SentryControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SentryControlClient interface {
+	// AttachSentry connects to the sentry at the address and starts exchanging the messages with it
+	AttachSentry(ctx context.Context, in *SentryAddress, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// DetachSentry disconnects from the sentry, its peers are not used for the downloads anymore
+	DetachSentry(ctx context.Context, in *SentryAddress, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Sentries returns the addresses of the attached sentries
+	Sentries(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SentryAddresses, error)
+}
+
+type sentryControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSentryControlClient(cc grpc.ClientConnInterface) SentryControlClient {
+	return &sentryControlClient{cc}
+}
+
+func (c *sentryControlClient) AttachSentry(ctx context.Context, in *SentryAddress, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/sentry.SentryControl/AttachSentry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sentryControlClient) DetachSentry(ctx context.Context, in *SentryAddress, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/sentry.SentryControl/DetachSentry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sentryControlClient) Sentries(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*SentryAddresses, error) {
+	out := new(SentryAddresses)
+	err := c.cc.Invoke(ctx, "/sentry.SentryControl/Sentries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SentryControlServer is the server API for SentryControl service.
+// All implementations must embed UnimplementedSentryControlServer
+// for forward compatibility
+type SentryControlServer interface {
+	// AttachSentry connects to the sentry at the address and starts exchanging the messages with it
+	AttachSentry(context.Context, *SentryAddress) (*emptypb.Empty, error)
+	// DetachSentry disconnects from the sentry, its peers are not used for the downloads anymore
+	DetachSentry(context.Context, *SentryAddress) (*emptypb.Empty, error)
+	// Sentries returns the addresses of the attached sentries
+	Sentries(context.Context, *emptypb.Empty) (*SentryAddresses, error)
+	mustEmbedUnimplementedSentryControlServer()
+}
+
+// UnimplementedSentryControlServer must be embedded to have forward compatible implementations.
+type UnimplementedSentryControlServer struct {
+}
+
+func (UnimplementedSentryControlServer) AttachSentry(context.Context, *SentryAddress) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AttachSentry not implemented")
+}
+func (UnimplementedSentryControlServer) DetachSentry(context.Context, *SentryAddress) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DetachSentry not implemented")
+}
+func (UnimplementedSentryControlServer) Sentries(context.Context, *emptypb.Empty) (*SentryAddresses, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Sentries not implemented")
+}
+func (UnimplementedSentryControlServer) mustEmbedUnimplementedSentryControlServer() {}
+
+// UnsafeSentryControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SentryControlServer will
+// result in compilation errors.
+type UnsafeSentryControlServer interface {
+	mustEmbedUnimplementedSentryControlServer()
+}
+
+func RegisterSentryControlServer(s grpc.ServiceRegistrar, srv SentryControlServer) {
+	s.RegisterService(&SentryControl_ServiceDesc, srv)
+}
+
+func _SentryControl_AttachSentry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SentryAddress)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentryControlServer).AttachSentry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sentry.SentryControl/AttachSentry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentryControlServer).AttachSentry(ctx, req.(*SentryAddress))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SentryControl_DetachSentry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SentryAddress)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentryControlServer).DetachSentry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sentry.SentryControl/DetachSentry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentryControlServer).DetachSentry(ctx, req.(*SentryAddress))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SentryControl_Sentries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentryControlServer).Sentries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sentry.SentryControl/Sentries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentryControlServer).Sentries(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SentryControl_ServiceDesc is the grpc.ServiceDesc for SentryControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SentryControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentry.SentryControl",
+	HandlerType: (*SentryControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AttachSentry",
+			Handler:    _SentryControl_AttachSentry_Handler,
+		},
+		{
+			MethodName: "DetachSentry",
+			Handler:    _SentryControl_DetachSentry_Handler,
+		},
+		{
+			MethodName: "Sentries",
+			Handler:    _SentryControl_Sentries_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2psentry/sentry.proto",
+}
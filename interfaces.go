@@ -119,6 +119,8 @@ type CallMsg struct {
 	To       *common.Address // the destination contract (nil for contract creation)
 	Gas      uint64          // if 0, the call executes with near-infinite gas
 	GasPrice *uint256.Int    // wei <-> gas exchange ratio
+	FeeCap   *uint256.Int    // EIP-1559 fee cap per gas, the gas price is used if nil
+	Tip      *uint256.Int    // EIP-1559 tip per gas, the gas price is used if nil
 	Value    *uint256.Int    // amount of wei sent along with the call
 	Data     []byte          // input data, usually an ABI-encoded contract method invocation
 
@@ -57,12 +57,22 @@ func (*HandlerT) Verbosity(level int) {
 	glogger.Verbosity(log.Lvl(level))
 }
 
+// CurrentVerbosity returns the log verbosity ceiling.
+func CurrentVerbosity() int {
+	return int(glogger.Level())
+}
+
 // Vmodule sets the log verbosity pattern. See package log for details on the
 // pattern syntax.
 func (*HandlerT) Vmodule(pattern string) error {
 	return glogger.Vmodule(pattern)
 }
 
+// CurrentVmodule returns the log verbosity pattern.
+func CurrentVmodule() string {
+	return glogger.VmoduleRuleset()
+}
+
 // BacktraceAt sets the log backtrace location. See package log for details on
 // the pattern syntax.
 func (*HandlerT) BacktraceAt(location string) error {
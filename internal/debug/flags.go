@@ -17,12 +17,13 @@
 package debug
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"time"
@@ -30,8 +31,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/metrics"
 	"github.com/ledgerwatch/turbo-geth/metrics/exp"
-	"github.com/mattn/go-colorable"
-	"github.com/mattn/go-isatty"
+	"github.com/ledgerwatch/turbo-geth/tracing"
 	"github.com/spf13/cobra"
 	"github.com/urfave/cli"
 )
@@ -44,7 +44,7 @@ var (
 	}
 	logjsonFlag = cli.BoolFlag{
 		Name:  "log.json",
-		Usage: "Format logs with JSON",
+		Usage: "Format logs with JSON, the [stage] prefixes of the messages become the stage and module fields",
 	}
 	vmoduleFlag = cli.StringFlag{
 		Name:  "vmodule",
@@ -98,6 +98,15 @@ var (
 		Name:  "trace",
 		Usage: "Write execution trace to the given file",
 	}
+	tracingEndpointFlag = cli.StringFlag{
+		Name:  "tracing.endpoint",
+		Usage: "Export the OpenTelemetry spans of the sync cycles, the stages, the DB commits and the RPC calls to the OTLP gRPC endpoint (e.g. localhost:4317)",
+	}
+	tracingRatioFlag = cli.Float64Flag{
+		Name:  "tracing.ratio",
+		Usage: "Fraction of the traces started by the node to export",
+		Value: 1,
+	}
 	// (Deprecated April 2020)
 	legacyMemprofilerateFlag = cli.IntFlag{
 		Name:  "memprofilerate",
@@ -119,6 +128,7 @@ var Flags = []cli.Flag{
 	verbosityFlag, logjsonFlag, vmoduleFlag, backtraceAtFlag, debugFlag,
 	pprofFlag, pprofAddrFlag, pprofPortFlag, memprofilerateFlag,
 	blockprofilerateFlag, cpuprofileFlag, traceFlag,
+	tracingEndpointFlag, tracingRatioFlag,
 }
 
 var DeprecatedFlags = []cli.Flag{
@@ -128,6 +138,9 @@ var DeprecatedFlags = []cli.Flag{
 
 var glogger *log.GlogHandler
 
+// stopTracing flushes the spans and stops their export, nil when the tracing isn't set up
+var stopTracing func(context.Context) error
+
 func init() {
 	glogger = log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
 	glogger.Verbosity(log.LvlInfo)
@@ -154,7 +167,12 @@ func SetupCobra(cmd *cobra.Command) error {
 		return err
 	}
 
-	_, glogger = log.SetupDefaultTerminalLogger(log.Lvl(lvl), vmodule, backtrace)
+	logjson, err := flags.GetBool(logjsonFlag.Name)
+	if err != nil {
+		return err
+	}
+
+	_, glogger = setupLogger(logjson)(log.Lvl(lvl), vmodule, backtrace)
 	log.PrintOrigins(dbg)
 
 	memprofilerate, err := flags.GetInt(memprofilerateFlag.Name)
@@ -188,6 +206,18 @@ func SetupCobra(cmd *cobra.Command) error {
 		}
 	}
 
+	tracingEndpoint, err := flags.GetString(tracingEndpointFlag.Name)
+	if err != nil {
+		return err
+	}
+	tracingRatio, err := flags.GetFloat64(tracingRatioFlag.Name)
+	if err != nil {
+		return err
+	}
+	if err = setupTracing(tracingEndpoint, tracingRatio); err != nil {
+		return err
+	}
+
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -236,21 +266,9 @@ func SetupCobra(cmd *cobra.Command) error {
 // Setup initializes profiling and logging based on the CLI flags.
 // It should be called as early as possible in the program.
 func Setup(ctx *cli.Context) error {
-	var ostream log.Handler
-	output := io.Writer(os.Stderr)
-	if ctx.GlobalBool(logjsonFlag.Name) {
-		ostream = log.StreamHandler(output, log.JSONFormat())
-	} else {
-		usecolor := (isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())) && os.Getenv("TERM") != "dumb"
-		if usecolor {
-			output = colorable.NewColorableStderr()
-		}
-		ostream = log.StreamHandler(output, log.TerminalFormat(usecolor))
-	}
-	glogger.SetHandler(ostream)
 	// logging
 	log.PrintOrigins(ctx.GlobalBool(debugFlag.Name))
-	ostream, glogger = log.SetupDefaultTerminalLogger(
+	_, glogger = setupLogger(ctx.GlobalBool(logjsonFlag.Name))(
 		log.Lvl(ctx.GlobalInt(verbosityFlag.Name)),
 		ctx.GlobalString(vmoduleFlag.Name),
 		ctx.GlobalString(backtraceAtFlag.Name),
@@ -287,6 +305,10 @@ func Setup(ctx *cli.Context) error {
 		}
 	}
 
+	if err := setupTracing(ctx.GlobalString(tracingEndpointFlag.Name), ctx.GlobalFloat64(tracingRatioFlag.Name)); err != nil {
+		return err
+	}
+
 	if metrics.Enabled {
 		go metrics.CollectProcessMetrics(10 * time.Second) // Start system runtime metrics collection
 	}
@@ -317,7 +339,7 @@ func StartPProf(address string, withMetrics bool) {
 	// Hook go-metrics into expvar on any /debug/metrics request, load all vars
 	// from the registry into expvar, and execute regular expvar handler.
 	if withMetrics {
-		exp.Exp(metrics.DefaultRegistry, http.NewServeMux())
+		exp.Exp(metrics.DefaultRegistry, http.DefaultServeMux) // the pprof server serves the default mux
 	}
 	cpuMsg := fmt.Sprintf("go tool pprof -lines -http=: http://%s/%s", address, "debug/pprof/profile?seconds=20")
 	heapMsg := fmt.Sprintf("go tool pprof -lines -http=: http://%s/%s", address, "debug/pprof/heap")
@@ -329,9 +351,39 @@ func StartPProf(address string, withMetrics bool) {
 	}()
 }
 
+// setupLogger returns the setup of the root logger writing the JSON records for --log.json and the terminal ones otherwise
+func setupLogger(json bool) func(lvl log.Lvl, vmodule string, backtraceAt string) (log.Handler, *log.GlogHandler) {
+	if json {
+		return log.SetupDefaultJSONLogger
+	}
+	return log.SetupDefaultTerminalLogger
+}
+
+// setupTracing starts the export of the OpenTelemetry spans if the endpoint is set
+func setupTracing(endpoint string, ratio float64) error {
+	if endpoint == "" {
+		return nil
+	}
+	stop, err := tracing.Setup(context.Background(), endpoint, filepath.Base(os.Args[0]), ratio)
+	if err != nil {
+		return err
+	}
+	stopTracing = stop
+	log.Info("Exporting the traces", "endpoint", endpoint, "ratio", ratio)
+	return nil
+}
+
 // Exit stops all running profiles, flushing their output to the
-// respective file.
+// respective file, and flushes the buffered spans.
 func Exit() {
 	Handler.StopCPUProfile()
 	Handler.StopGoTrace()
+	if stop := stopTracing; stop != nil {
+		stopTracing = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stop(ctx); err != nil {
+			log.Warn("Flushing the traces failed", "err", err)
+		}
+	}
 }
@@ -60,6 +60,55 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*hexutil.Big, error)
 	return (*hexutil.Big)(price), err
 }
 
+// MaxPriorityFeePerGas returns a suggestion for a gas tip cap for dynamic fee transactions.
+func (s *PublicEthereumAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	tipcap, err := s.b.SuggestTipCap(ctx)
+	return (*hexutil.Big)(tipcap), err
+}
+
+type FeeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// NewFeeHistoryResult converts the output of the gas price oracle into the RPC representation
+func NewFeeHistoryResult(oldest *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsed []float64) *FeeHistoryResult {
+	results := &FeeHistoryResult{
+		OldestBlock:  (*hexutil.Big)(oldest),
+		GasUsedRatio: gasUsed,
+	}
+	if gasUsed == nil {
+		results.GasUsedRatio = []float64{}
+	}
+	if reward != nil {
+		results.Reward = make([][]*hexutil.Big, len(reward))
+		for i, w := range reward {
+			results.Reward[i] = make([]*hexutil.Big, len(w))
+			for j, v := range w {
+				results.Reward[i][j] = (*hexutil.Big)(v)
+			}
+		}
+	}
+	if baseFee != nil {
+		results.BaseFee = make([]*hexutil.Big, len(baseFee))
+		for i, v := range baseFee {
+			results.BaseFee[i] = (*hexutil.Big)(v)
+		}
+	}
+	return results
+}
+
+// FeeHistory returns the fee market history, see gasprice.Oracle.FeeHistory
+func (s *PublicEthereumAPI) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*FeeHistoryResult, error) {
+	oldest, reward, baseFee, gasUsed, err := s.b.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	return NewFeeHistoryResult(oldest, reward, baseFee, gasUsed), nil
+}
+
 // Syncing returns false in case the node is currently not syncing with the network. It can be up to date or has not
 // yet received the latest block headers from its pears. In case it is synchronizing:
 // - startingBlock: block number this node started to synchronise from
@@ -331,11 +380,13 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
-	From     *common.Address `json:"from"`
-	To       *common.Address `json:"to"`
-	Gas      *hexutil.Uint64 `json:"gas"`
-	GasPrice *hexutil.Big    `json:"gasPrice"`
-	Value    *hexutil.Big    `json:"value"`
+	From                 *common.Address `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
 	// We accept "data" and "input" for backwards-compatibility reasons. "input" is the
 	// newer name and should be preferred by clients.
 	Data       *hexutil.Bytes    `json:"data"`
@@ -343,8 +394,39 @@ type CallArgs struct {
 	AccessList *types.AccessList `json:"accessList"`
 }
 
-// ToMessage converts CallArgs to the Message type used by the core evm
-func (args *CallArgs) ToMessage(globalGasCap uint64) types.Message {
+// CallFees derives the gas price, fee cap and tip of a call message from the call arguments.
+// Legacy calls set only the gas price, EIP-1559 calls set the fee cap and the tip, then the
+// gas price is the effective one at the given base fee (nil before London). Zero-priced
+// calls are allowed, the EVM is expected to skip the base fee checks for them.
+func CallFees(gasPrice, maxFeePerGas, maxPriorityFeePerGas *hexutil.Big, baseFee *big.Int) (*uint256.Int, *uint256.Int, *uint256.Int) {
+	price, feeCap, tip := new(uint256.Int), new(uint256.Int), new(uint256.Int)
+	if gasPrice != nil {
+		price.SetFromBig(gasPrice.ToInt())
+		return price, new(uint256.Int).Set(price), new(uint256.Int).Set(price)
+	}
+	if maxFeePerGas != nil {
+		feeCap.SetFromBig(maxFeePerGas.ToInt())
+	}
+	if maxPriorityFeePerGas != nil {
+		tip.SetFromBig(maxPriorityFeePerGas.ToInt())
+	}
+	if feeCap.IsZero() && tip.IsZero() {
+		return price, feeCap, tip
+	}
+	price.Set(tip)
+	if baseFee != nil {
+		fee, _ := uint256.FromBig(baseFee)
+		price.Add(price, fee)
+		if feeCap.Lt(price) {
+			price.Set(feeCap)
+		}
+	}
+	return price, feeCap, tip
+}
+
+// ToMessage converts CallArgs to the Message type used by the core evm.
+// baseFee is the EIP-1559 base fee of the block the call is executed on, nil before London.
+func (args *CallArgs) ToMessage(globalGasCap uint64, baseFee *big.Int) types.Message {
 	// Set sender address or use zero address if none specified.
 	var addr common.Address
 	if args.From != nil {
@@ -363,10 +445,7 @@ func (args *CallArgs) ToMessage(globalGasCap uint64) types.Message {
 		log.Warn("Caller gas above allowance, capping", "requested", gas, "cap", globalGasCap)
 		gas = globalGasCap
 	}
-	gasPrice := new(uint256.Int)
-	if args.GasPrice != nil {
-		gasPrice.SetFromBig(args.GasPrice.ToInt())
-	}
+	gasPrice, feeCap, tip := CallFees(args.GasPrice, args.MaxFeePerGas, args.MaxPriorityFeePerGas, baseFee)
 	value := new(uint256.Int)
 	if args.Value != nil {
 		value.SetFromBig(args.Value.ToInt())
@@ -382,7 +461,7 @@ func (args *CallArgs) ToMessage(globalGasCap uint64) types.Message {
 		input = *args.Data
 	}
 
-	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, input, accessList, false)
+	msg := types.NewMessage(addr, args.To, 0, value, gas, gasPrice, feeCap, tip, input, accessList, false)
 	return msg
 }
 
@@ -450,8 +529,9 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 	defer cancel()
 
 	// Get a new instance of the EVM.
-	msg := args.ToMessage(globalGasCap)
-	evm, vmError, err := b.GetEVM(ctx, msg, state, header)
+	msg := args.ToMessage(globalGasCap, header.BaseFee)
+	vmCfg.NoBaseFee = true
+	evm, vmError, err := b.GetEVM(ctx, msg, state, header, &vmCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -678,42 +758,48 @@ type StructLogRes struct {
 func FormatLogs(logs []vm.StructLog) []StructLogRes {
 	formatted := make([]StructLogRes, len(logs))
 	for index, trace := range logs {
-		formatted[index] = StructLogRes{
-			Pc:      trace.Pc,
-			Op:      trace.Op.String(),
-			Gas:     trace.Gas,
-			GasCost: trace.GasCost,
-			Depth:   trace.Depth,
-			Error:   trace.Err,
-		}
-		if trace.Stack != nil {
-			stack := make([]string, len(trace.Stack))
-			for i, stackValue := range trace.Stack {
-				stack[i] = fmt.Sprintf("%x", math.PaddedBigBytes(stackValue, 32))
-			}
-			formatted[index].Stack = &stack
+		formatted[index] = FormatLog(&trace)
+	}
+	return formatted
+}
+
+// FormatLog formats a single EVM structured log for json output
+func FormatLog(trace *vm.StructLog) StructLogRes {
+	formatted := StructLogRes{
+		Pc:      trace.Pc,
+		Op:      trace.Op.String(),
+		Gas:     trace.Gas,
+		GasCost: trace.GasCost,
+		Depth:   trace.Depth,
+		Error:   trace.Err,
+	}
+	if trace.Stack != nil {
+		stack := make([]string, len(trace.Stack))
+		for i, stackValue := range trace.Stack {
+			stack[i] = fmt.Sprintf("%x", math.PaddedBigBytes(stackValue, 32))
 		}
-		if trace.Memory != nil {
-			memory := make([]string, 0, (len(trace.Memory)+31)/32)
-			for i := 0; i+32 <= len(trace.Memory); i += 32 {
-				memory = append(memory, fmt.Sprintf("%x", trace.Memory[i:i+32]))
-			}
-			formatted[index].Memory = &memory
+		formatted.Stack = &stack
+	}
+	if trace.Memory != nil {
+		memory := make([]string, 0, (len(trace.Memory)+31)/32)
+		for i := 0; i+32 <= len(trace.Memory); i += 32 {
+			memory = append(memory, fmt.Sprintf("%x", trace.Memory[i:i+32]))
 		}
-		if trace.Storage != nil {
-			storage := make(map[string]string)
-			for i, storageValue := range trace.Storage {
-				storage[fmt.Sprintf("%x", i)] = fmt.Sprintf("%x", storageValue)
-			}
-			formatted[index].Storage = &storage
+		formatted.Memory = &memory
+	}
+	if trace.Storage != nil {
+		storage := make(map[string]string)
+		for i, storageValue := range trace.Storage {
+			storage[fmt.Sprintf("%x", i)] = fmt.Sprintf("%x", storageValue)
 		}
+		formatted.Storage = &storage
 	}
 	return formatted
 }
 
 // RPCMarshalHeader converts the given header to the RPC output .
 func RPCMarshalHeader(head *types.Header) map[string]interface{} {
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"number":           (*hexutil.Big)(head.Number),
 		"hash":             head.Hash(),
 		"parentHash":       head.ParentHash,
@@ -732,6 +818,10 @@ func RPCMarshalHeader(head *types.Header) map[string]interface{} {
 		"transactionsRoot": head.TxHash,
 		"receiptsRoot":     head.ReceiptHash,
 	}
+	if head.BaseFee != nil {
+		result["baseFeePerGas"] = (*hexutil.Big)(head.BaseFee)
+	}
+	return result
 }
 
 // RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
@@ -798,6 +888,8 @@ type RPCTransaction struct {
 	From             common.Address    `json:"from"`
 	Gas              hexutil.Uint64    `json:"gas"`
 	GasPrice         *hexutil.Big      `json:"gasPrice"`
+	FeeCap           *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	Tip              *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
 	Hash             common.Hash       `json:"hash"`
 	Input            hexutil.Bytes     `json:"input"`
 	Nonce            hexutil.Uint64    `json:"nonce"`
@@ -814,7 +906,9 @@ type RPCTransaction struct {
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
 // representation, with the given location metadata set (if available).
-func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64) *RPCTransaction {
+// The base fee of the block, if known, is used to report the effective gas
+// price of dynamic fee transactions.
+func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber uint64, index uint64, baseFee *big.Int) *RPCTransaction {
 	// Determine the signer. For replay-protected transactions, use the most permissive
 	// signer, because we assume that signers are backwards-compatible with old
 	// transactions. For non-protected transactions, the homestead signer signer is used
@@ -847,17 +941,32 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
 		result.TransactionIndex = (*hexutil.Uint64)(&index)
 	}
-	if tx.Type() == types.AccessListTxType {
+	switch tx.Type() {
+	case types.AccessListTxType:
+		al := tx.AccessList()
+		result.Accesses = &al
+		result.ChainID = (*hexutil.Big)(tx.ChainId().ToBig())
+	case types.DynamicFeeTxType:
 		al := tx.AccessList()
 		result.Accesses = &al
 		result.ChainID = (*hexutil.Big)(tx.ChainId().ToBig())
+		result.FeeCap = (*hexutil.Big)(tx.FeeCap().ToBig())
+		result.Tip = (*hexutil.Big)(tx.Tip().ToBig())
+		// The effective gas price is only known for included transactions
+		if baseFee != nil && blockHash != (common.Hash{}) {
+			price := new(big.Int).Add(tx.Tip().ToBig(), baseFee)
+			if price.Cmp(result.FeeCap.ToInt()) > 0 {
+				price.Set(result.FeeCap.ToInt())
+			}
+			result.GasPrice = (*hexutil.Big)(price)
+		}
 	}
 	return result
 }
 
 // newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
 func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
-	return newRPCTransaction(tx, common.Hash{}, 0, 0)
+	return newRPCTransaction(tx, common.Hash{}, 0, 0, nil)
 }
 
 // newRPCTransactionFromBlockIndex returns a transaction that will serialize to the RPC representation.
@@ -866,7 +975,7 @@ func newRPCTransactionFromBlockIndex(b *types.Block, index uint64) *RPCTransacti
 	if index >= uint64(len(txs)) {
 		return nil
 	}
-	return newRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index)
+	return newRPCTransaction(txs[index], b.Hash(), b.NumberU64(), index, b.BaseFee())
 }
 
 // newRPCRawTransactionFromBlockIndex returns the bytes of a transaction given a block and a transaction index.
@@ -981,7 +1090,15 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 		return nil, err
 	}
 	if tx != nil {
-		return newRPCTransaction(tx, blockHash, blockNumber, index), nil
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		var baseFee *big.Int
+		if header != nil {
+			baseFee = header.BaseFee
+		}
+		return newRPCTransaction(tx, blockHash, blockNumber, index, baseFee), nil
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
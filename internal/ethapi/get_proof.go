@@ -3,7 +3,6 @@ package ethapi
 import (
 	"bytes"
 	"context"
-	"math/big"
 	"sort"
 
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -32,7 +31,71 @@ type StorageResult struct {
 	Proof []string     `json:"proof"`
 }
 
+// ProofRequest selects an account and the storage slots to prove, see GetProofBinary
+type ProofRequest struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []string       `json:"storageKeys"`
+}
+
 func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	requests := []ProofRequest{{Address: address, StorageKeys: storageKeys}}
+	tr, err := s.loadProofTrie(requests, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := proveAccount(tr, address, storageKeys)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		storageProof[i] = StorageResult{key, (*hexutil.Big)(p.StorageProofs[i].Value.ToBig()), toHexSlice(p.StorageProofs[i].Proof)}
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(p.Proof),
+		Balance:      (*hexutil.Big)(p.Balance.ToBig()),
+		CodeHash:     p.CodeHash,
+		Nonce:        hexutil.Uint64(p.Nonce),
+		StorageHash:  p.StorageHash,
+		StorageProof: storageProof,
+	}, nil
+}
+
+// PublicTgAPI provides the turbo-geth extensions of the public blockchain API, in the tg namespace
+type PublicTgAPI struct {
+	chain *PublicBlockChainAPI
+}
+
+// NewPublicTgAPI creates a new turbo-geth extensions API.
+func NewPublicTgAPI(b Backend) *PublicTgAPI {
+	return &PublicTgAPI{chain: NewPublicBlockChainAPI(b)}
+}
+
+// GetProofBinary implements tg_getProofBinary. It returns proofs for a batch of accounts (and their
+// storage slots) in the compact binary encoding produced by trie.EncodeProofs. All accounts are proven
+// against a single trie loaded once for the whole batch, and trie nodes shared between the proofs are
+// sent only once. Accounts which don't exist at the given block are omitted from the result.
+func (s *PublicTgAPI) GetProofBinary(ctx context.Context, requests []ProofRequest, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
+	tr, err := s.chain.loadProofTrie(requests, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]*trie.AccountProof, 0, len(requests))
+	for _, req := range requests {
+		p, err := proveAccount(tr, req.Address, req.StorageKeys)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			proofs = append(proofs, p)
+		}
+	}
+	return trie.EncodeProofs(proofs), nil
+}
+
+// loadProofTrie resolves the parts of the state trie at blockNr which are needed to prove the requested keys
+func (s *PublicBlockChainAPI) loadProofTrie(requests []ProofRequest, blockNr rpc.BlockNumber) (*trie.Trie, error) {
 	block := uint64(blockNr.Int64()) + 1
 	db := s.b.ChainDb()
 	ts := dbutils.EncodeBlockNumber(block)
@@ -102,25 +165,27 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 		unfurl.AddKey(sk[:])
 	}
 	rl := trie.NewRetainList(0)
-	addrHash, err := common.HashData(address[:])
-	if err != nil {
-		return nil, err
-	}
-	rl.AddKey(addrHash[:])
-	unfurl.AddKey(addrHash[:])
-	for _, key := range storageKeys {
-		keyAsHash := common.HexToHash(key)
-		if keyHash, err1 := common.HashData(keyAsHash[:]); err1 == nil {
-			trieKey := append(addrHash[:], keyHash[:]...)
-			rl.AddKey(trieKey)
-			unfurl.AddKey(trieKey)
-		} else {
-			return nil, err1
+	for _, req := range requests {
+		addrHash, err := common.HashData(req.Address[:])
+		if err != nil {
+			return nil, err
+		}
+		rl.AddKey(addrHash[:])
+		unfurl.AddKey(addrHash[:])
+		for _, key := range req.StorageKeys {
+			keyAsHash := common.HexToHash(key)
+			if keyHash, err1 := common.HashData(keyAsHash[:]); err1 == nil {
+				trieKey := append(addrHash[:], keyHash[:]...)
+				rl.AddKey(trieKey)
+				unfurl.AddKey(trieKey)
+			} else {
+				return nil, err1
+			}
 		}
 	}
 	sort.Strings(unfurlList)
 	loader := trie.NewFlatDbSubTrieLoader()
-	if err = loader.Reset(db, unfurl, unfurl, nil /* hashCollector */, [][]byte{nil}, []int{0}, false); err != nil {
+	if err := loader.Reset(db, unfurl, unfurl, nil /* hashCollector */, [][]byte{nil}, []int{0}, false); err != nil {
 		return nil, err
 	}
 	r := &Receiver{defaultReceiver: trie.NewDefaultReceiver(), unfurlList: unfurlList, accountMap: accountMap, storageMap: storageMap}
@@ -139,39 +204,49 @@ func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Addre
 	if err = tr.HookSubTries(subTries, [][]byte{nil}); err != nil {
 		return nil, err
 	}
-	accountProof, err2 := tr.Prove(addrHash[:], 0, false /* storage */)
-	if err2 != nil {
-		return nil, err2
+	return tr, nil
+}
+
+// proveAccount extracts the account and storage proofs from a trie loaded by loadProofTrie.
+// It returns nil if the account doesn't exist.
+func proveAccount(tr *trie.Trie, address common.Address, storageKeys []string) (*trie.AccountProof, error) {
+	addrHash, err := common.HashData(address[:])
+	if err != nil {
+		return nil, err
+	}
+	accountProof, err := tr.Prove(addrHash[:], 0, false /* storage */)
+	if err != nil {
+		return nil, err
 	}
-	storageProof := make([]StorageResult, len(storageKeys))
+	storageProofs := make([]trie.StorageProof, len(storageKeys))
 	for i, key := range storageKeys {
 		keyAsHash := common.HexToHash(key)
-		if keyHash, err1 := common.HashData(keyAsHash[:]); err1 == nil {
-			trieKey := append(addrHash[:], keyHash[:]...)
-			if proof, err3 := tr.Prove(trieKey, 64 /* nibbles to get to the storage sub-trie */, true /* storage */); err3 == nil {
-				v, _ := tr.Get(trieKey)
-				bv := new(big.Int)
-				bv.SetBytes(v)
-				storageProof[i] = StorageResult{key, (*hexutil.Big)(bv), toHexSlice(proof)}
-			} else {
-				return nil, err3
-			}
-		} else {
-			return nil, err1
+		keyHash, err := common.HashData(keyAsHash[:])
+		if err != nil {
+			return nil, err
+		}
+		trieKey := append(addrHash[:], keyHash[:]...)
+		proof, err := tr.Prove(trieKey, 64 /* nibbles to get to the storage sub-trie */, true /* storage */)
+		if err != nil {
+			return nil, err
 		}
+		v, _ := tr.Get(trieKey)
+		storageProofs[i].Key = keyAsHash
+		storageProofs[i].Value.SetBytes(v)
+		storageProofs[i].Proof = proof
 	}
 	acc, found := tr.GetAccount(addrHash[:])
 	if !found {
 		return nil, nil
 	}
-	return &AccountResult{
-		Address:      address,
-		AccountProof: toHexSlice(accountProof),
-		Balance:      (*hexutil.Big)(acc.Balance.ToBig()),
-		CodeHash:     acc.CodeHash,
-		Nonce:        hexutil.Uint64(acc.Nonce),
-		StorageHash:  acc.Root,
-		StorageProof: storageProof,
+	return &trie.AccountProof{
+		Address:       address,
+		Nonce:         acc.Nonce,
+		Balance:       acc.Balance,
+		CodeHash:      acc.CodeHash,
+		StorageHash:   acc.Root,
+		Proof:         accountProof,
+		StorageProofs: storageProofs,
 	}, nil
 }
 
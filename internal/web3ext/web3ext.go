@@ -206,6 +206,24 @@ web3._extend({
 			name: 'stopWS',
 			call: 'admin_stopWS'
 		}),
+		new web3._extend.Method({
+			name: 'backup',
+			call: 'admin_backup',
+			params: 3,
+			inputFormatter: [null, null, null]
+		}),
+		new web3._extend.Method({
+			name: 'rebuildTxLookup',
+			call: 'admin_rebuildTxLookup',
+			params: 1,
+			inputFormatter: [null]
+		}),
+		new web3._extend.Method({
+			name: 'verifyTxLookup',
+			call: 'admin_verifyTxLookup',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -220,6 +238,14 @@ web3._extend({
 			name: 'datadir',
 			getter: 'admin_datadir'
 		}),
+		new web3._extend.Property({
+			name: 'backupStatus',
+			getter: 'admin_backupStatus'
+		}),
+		new web3._extend.Property({
+			name: 'txLookupRebuildStatus',
+			getter: 'admin_txLookupRebuildStatus'
+		}),
 	]
 });
 `
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"reflect"
+	"regexp"
 	"sync"
 
 	"github.com/go-stack/stack"
@@ -387,7 +388,22 @@ func SetupDefaultTerminalLogger(lvl Lvl, verbosityPerModule string, backtraceAt
 		output = colorable.NewColorableStderr()
 	}
 	ostream = StreamHandler(output, TerminalFormat(usecolor))
-	glogger = NewGlogHandler(ostream)
+	return ostream, setupDefaultLogger(ostream, lvl, verbosityPerModule, backtraceAt)
+}
+
+// SetupDefaultJSONLogger is the SetupDefaultTerminalLogger writing the records to stderr as the JSON objects, one
+// per line, for the log aggregation. The "[prefix]" of the message becomes a field, see PrefixFieldsHandler
+func SetupDefaultJSONLogger(lvl Lvl, verbosityPerModule string, backtraceAt string) (ostream Handler, glogger *GlogHandler) {
+	return setupDefaultJSONLogger(os.Stderr, lvl, verbosityPerModule, backtraceAt)
+}
+
+func setupDefaultJSONLogger(output io.Writer, lvl Lvl, verbosityPerModule string, backtraceAt string) (ostream Handler, glogger *GlogHandler) {
+	ostream = PrefixFieldsHandler(StreamHandler(output, JSONFormat()))
+	return ostream, setupDefaultLogger(ostream, lvl, verbosityPerModule, backtraceAt)
+}
+
+func setupDefaultLogger(ostream Handler, lvl Lvl, verbosityPerModule string, backtraceAt string) *GlogHandler {
+	glogger := NewGlogHandler(ostream)
 	Root().SetHandler(glogger)
 	glogger.Verbosity(lvl)
 	if err := glogger.Vmodule(verbosityPerModule); err != nil {
@@ -399,5 +415,28 @@ func SetupDefaultTerminalLogger(lvl Lvl, verbosityPerModule string, backtraceAt
 		}
 	}
 
-	return ostream, glogger
+	return glogger
+}
+
+// stagePrefix matches the "[5/14 Execution] " prefix of the messages of the sync stages and the "[backup] " prefix
+// of the other components
+var stagePrefix = regexp.MustCompile(`^\[(\d+/\d+ )?([^\]]+)\] `)
+
+// PrefixFieldsHandler moves the "[prefix]" of the messages into the fields of the records: the name of the sync stage
+// into "stage" and the other prefixes into "module", so the structured logs can be filtered by them
+func PrefixFieldsHandler(h Handler) Handler {
+	return FuncHandler(func(r *Record) error {
+		m := stagePrefix.FindStringSubmatchIndex(r.Msg)
+		if m == nil {
+			return h.Log(r)
+		}
+		key := "module"
+		if m[2] >= 0 {
+			key = "stage"
+		}
+		rec := *r
+		rec.Msg = r.Msg[m[1]:]
+		rec.Ctx = append([]interface{}{key, r.Msg[m[4]:m[5]]}, r.Ctx...)
+		return h.Log(&rec)
+	})
 }
@@ -0,0 +1,120 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefixFieldsHandler(t *testing.T) {
+	tests := []struct {
+		msg     string
+		wantMsg string
+		wantCtx []interface{}
+	}{
+		{"[5/14 Execution] Completed on", "Completed on", []interface{}{"stage", "Execution", "block", 1}},
+		{"[1/14 Headers] Wrote block headers", "Wrote block headers", []interface{}{"stage", "Headers", "block", 1}},
+		{"[backup] Snapshot written", "Snapshot written", []interface{}{"module", "backup", "block", 1}},
+		{"[Block Witnesses] Started", "Started", []interface{}{"module", "Block Witnesses", "block", 1}},
+		// Not a prefix
+		{"Imported new chain segment", "Imported new chain segment", []interface{}{"block", 1}},
+		{"[unterminated prefix", "[unterminated prefix", []interface{}{"block", 1}},
+		{"[5/14 Execution]no space", "[5/14 Execution]no space", []interface{}{"block", 1}},
+		{"Sync [5/14 Execution] ", "Sync [5/14 Execution] ", []interface{}{"block", 1}},
+	}
+	for _, test := range tests {
+		var got *Record
+		h := PrefixFieldsHandler(FuncHandler(func(r *Record) error {
+			got = r
+			return nil
+		}))
+		r := &Record{Msg: test.msg, Ctx: []interface{}{"block", 1}}
+		if err := h.Log(r); err != nil {
+			t.Fatal(err)
+		}
+		if got.Msg != test.wantMsg {
+			t.Errorf("%q: message %q, want %q", test.msg, got.Msg, test.wantMsg)
+		}
+		if !reflect.DeepEqual(got.Ctx, test.wantCtx) {
+			t.Errorf("%q: fields %v, want %v", test.msg, got.Ctx, test.wantCtx)
+		}
+		// The record of the caller is not modified, it may go to the other handlers
+		if r.Msg != test.msg || len(r.Ctx) != 2 {
+			t.Errorf("%q: the original record is modified: %q %v", test.msg, r.Msg, r.Ctx)
+		}
+	}
+}
+
+// setupTestJSONLogger sets up the default JSON logger writing to the buffer until the end of the test
+func setupTestJSONLogger(t *testing.T, lvl Lvl, vmodule string) (*bytes.Buffer, *GlogHandler) {
+	root := Root().GetHandler()
+	t.Cleanup(func() { Root().SetHandler(root) })
+	var buf bytes.Buffer
+	_, glogger := setupDefaultJSONLogger(&buf, lvl, vmodule, "")
+	return &buf, glogger
+}
+
+// decodeRecords decodes the JSON objects, one per line
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line %q is not a JSON object: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSetupDefaultJSONLogger(t *testing.T) {
+	buf, _ := setupTestJSONLogger(t, LvlInfo, "")
+	Info("[5/14 Execution] Completed on", "block", 100)
+	Info("[backup] Snapshot written", "path", "/tmp/snapshot")
+	Debug("Filtered by the verbosity")
+
+	records := decodeRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %s", len(records), buf)
+	}
+	want := []map[string]interface{}{
+		{"lvl": "info", "msg": "Completed on", "stage": "Execution", "block": float64(100)},
+		{"lvl": "info", "msg": "Snapshot written", "module": "backup", "path": "/tmp/snapshot"},
+	}
+	for i, record := range records {
+		if _, ok := record["t"]; !ok {
+			t.Errorf("record %d has no time: %v", i, record)
+		}
+		delete(record, "t")
+		if !reflect.DeepEqual(record, want[i]) {
+			t.Errorf("record %d: got %v, want %v", i, record, want[i])
+		}
+	}
+}
+
+func TestVmoduleLive(t *testing.T) {
+	buf, glogger := setupTestJSONLogger(t, LvlInfo, "")
+	Debug("Before the change")
+	if err := glogger.Vmodule("handler_test.go=4"); err != nil {
+		t.Fatal(err)
+	}
+	if glogger.VmoduleRuleset() != "handler_test.go=4" {
+		t.Errorf("ruleset %q, want %q", glogger.VmoduleRuleset(), "handler_test.go=4")
+	}
+	Debug("After the change")
+	Trace("Above the module verbosity")
+	if err := glogger.Vmodule(""); err != nil {
+		t.Fatal(err)
+	}
+	Debug("After the reset")
+
+	records := decodeRecords(t, buf)
+	if len(records) != 1 || records[0]["msg"] != "After the change" {
+		t.Fatalf("got %v, want only the debug record logged after the change", records)
+	}
+}
@@ -47,6 +47,7 @@ func Exp(r metrics.Registry, mux *http.ServeMux) {
 	// haven't found an elegant way, so just use a different endpoint
 	mux.Handle("/debug/metrics", h)
 	mux.Handle("/debug/metrics/prometheus", prometheus.Handler(r))
+	mux.Handle("/metrics", prometheus.Handler(r))
 	mux.Handle("/debug/metrics/prometheus2", promhttp.HandlerFor(prometheus2.DefaultGatherer, promhttp.HandlerOpts{
 		EnableOpenMetrics: true,
 	}))
@@ -64,10 +65,12 @@ func Setup(address string) {
 	m := http.NewServeMux()
 	m.Handle("/debug/metrics", ExpHandler(metrics.DefaultRegistry))
 	m.Handle("/debug/metrics/prometheus", prometheus.Handler(metrics.DefaultRegistry))
+	// The conventional path of the Prometheus scrapers, the same as /debug/metrics/prometheus
+	m.Handle("/metrics", prometheus.Handler(metrics.DefaultRegistry))
 	m.Handle("/debug/metrics/prometheus2", promhttp.HandlerFor(prometheus2.DefaultGatherer, promhttp.HandlerOpts{
 		EnableOpenMetrics: true,
 	}))
-	log.Info("Starting metrics server", "addr", fmt.Sprintf("http://%s/debug/metrics", address))
+	log.Info("Starting metrics server", "addr", fmt.Sprintf("http://%s/debug/metrics", address), "prometheus", fmt.Sprintf("http://%s/metrics", address))
 	go func() {
 		if err := http.ListenAndServe(address, m); err != nil {
 			log.Error("Failure in running metrics server", "err", err)
@@ -19,8 +19,8 @@ package prometheus
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/ledgerwatch/turbo-geth/metrics"
 )
@@ -115,6 +115,10 @@ func (c *collector) writeSummaryPercentile(name, p string, value interface{}) {
 	c.buff.WriteString(fmt.Sprintf(keyQuantileTagValueTpl, name, p, value))
 }
 
+// invalidNameChars are the characters Prometheus doesn't allow in the metric names, e.g. the dashes and the dots of
+// the bucket names and the slashes of the go-metrics names
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
 func mutateKey(key string) string {
-	return strings.Replace(key, "/", "_", -1)
+	return invalidNameChars.ReplaceAllString(key, "_")
 }
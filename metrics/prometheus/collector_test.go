@@ -108,3 +108,16 @@ test_resetting_timer {quantile="0.99"} 120000000
 		t.Fatal("unexpected collector output")
 	}
 }
+
+func TestMutateKey(t *testing.T) {
+	for key, expected := range map[string]string{
+		"db/bucket/PLAIN-CST2/size":         "db_bucket_PLAIN_CST2_size",
+		"stages/com.example.table/progress": "stages_com_example_table_progress",
+		"rpc/duration/eth_call/success":     "rpc_duration_eth_call_success",
+		"table/scs/leaf":                    "table_scs_leaf",
+	} {
+		if actual := mutateKey(key); actual != expected {
+			t.Errorf("mutateKey(%q) = %q, expected %q", key, actual, expected)
+		}
+	}
+}
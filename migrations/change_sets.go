@@ -16,7 +16,8 @@ import (
 )
 
 var accChangeSetDupSort = Migration{
-	Name: "acc_change_set_dup_sort_18",
+	Name:  "acc_change_set_dup_sort_18",
+	Reads: []string{dbutils.PlainAccountChangeSetBucket},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		logEvery := time.NewTicker(30 * time.Second)
 		defer logEvery.Stop()
@@ -121,7 +122,8 @@ var accChangeSetDupSort = Migration{
 }
 
 var storageChangeSetDupSort = Migration{
-	Name: "storage_change_set_dup_sort_22",
+	Name:  "storage_change_set_dup_sort_22",
+	Reads: []string{dbutils.PlainStorageChangeSetBucket},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		logEvery := time.NewTicker(30 * time.Second)
 		defer logEvery.Stop()
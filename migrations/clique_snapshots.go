@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// cliqueSnapshotsByNumber moves the clique voting snapshots keyed by the hash to the bucket keyed by the number and
+// the hash, which the unwind of the headers deletes from. The number is read from the snapshot itself
+var cliqueSnapshotsByNumber = Migration{
+	Name:  "clique_snapshots_by_number",
+	Reads: []string{dbutils.CliqueBucketOld1},
+	Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+		if exists, err := db.(ethdb.BucketsMigrator).BucketExists(dbutils.CliqueBucketOld1); err != nil {
+			return err
+		} else if !exists {
+			return OnLoadCommit(db, nil, true)
+		}
+
+		if err := db.(ethdb.BucketsMigrator).ClearBuckets(dbutils.CliqueSnapshot); err != nil {
+			return err
+		}
+
+		extractFunc := func(k []byte, v []byte, next etl.ExtractNextFunc) error {
+			var snap struct {
+				Number uint64 `json:"number"`
+			}
+			if err := json.Unmarshal(v, &snap); err != nil {
+				return err
+			}
+			return next(k, dbutils.HeaderKey(snap.Number, common.BytesToHash(k)), v)
+		}
+
+		if err := etl.Transform(
+			"clique_snapshots_by_number",
+			db,
+			dbutils.CliqueBucketOld1,
+			dbutils.CliqueSnapshot,
+			tmpdir,
+			extractFunc,
+			etl.IdentityLoadFunc,
+			etl.TransformArgs{OnLoadCommit: OnLoadCommit},
+		); err != nil {
+			return err
+		}
+
+		if err := db.(ethdb.BucketsMigrator).DropBuckets(dbutils.CliqueBucketOld1); err != nil {
+			return err
+		}
+		return nil
+	},
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCliqueSnapshotsByNumber(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	defer db.Close()
+
+	err := db.KV().Update(context.Background(), func(tx ethdb.RwTx) error {
+		return tx.(ethdb.BucketMigrator).CreateBucket(dbutils.CliqueBucketOld1)
+	})
+	require.NoError(err)
+
+	snaps := map[common.Hash][]byte{
+		{1}: []byte(`{"number":0,"hash":"0x0100000000000000000000000000000000000000000000000000000000000000"}`),
+		{2}: []byte(`{"number":1024,"hash":"0x0200000000000000000000000000000000000000000000000000000000000000"}`),
+	}
+	for hash, blob := range snaps {
+		require.NoError(db.Put(dbutils.CliqueBucketOld1, hash[:], blob))
+	}
+
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{cliqueSnapshotsByNumber}
+	require.NoError(migrator.Apply(db, os.TempDir()))
+
+	v, err := db.Get(dbutils.CliqueSnapshot, dbutils.HeaderKey(0, common.Hash{1}))
+	require.NoError(err)
+	require.Equal(snaps[common.Hash{1}], v)
+	v, err = db.Get(dbutils.CliqueSnapshot, dbutils.HeaderKey(1024, common.Hash{2}))
+	require.NoError(err)
+	require.Equal(snaps[common.Hash{2}], v)
+
+	exists, err := db.BucketExists(dbutils.CliqueBucketOld1)
+	require.NoError(err)
+	require.False(exists)
+
+	// apply migration again
+	require.NoError(migrator.Apply(db, os.TempDir()))
+}
@@ -15,7 +15,8 @@ import (
 )
 
 var dupSortHashState = Migration{
-	Name: "dupsort_hash_state",
+	Name:  "dupsort_hash_state",
+	Reads: []string{dbutils.CurrentStateBucketOld1},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 		if exists, err := db.(ethdb.BucketsMigrator).BucketExists(dbutils.CurrentStateBucketOld1); err != nil {
 			return err
@@ -51,7 +52,8 @@ var dupSortHashState = Migration{
 }
 
 var dupSortPlainState = Migration{
-	Name: "dupsort_plain_state",
+	Name:  "dupsort_plain_state",
+	Reads: []string{dbutils.PlainStateBucketOld1},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 		if exists, err := db.(ethdb.BucketsMigrator).BucketExists(dbutils.PlainStateBucketOld1); err != nil {
 			return err
@@ -10,7 +10,8 @@ import (
 )
 
 var headerPrefixToSeparateBuckets = Migration{
-	Name: "header_prefix_to_separate_buckets",
+	Name:  "header_prefix_to_separate_buckets",
+	Reads: []string{dbutils.HeaderPrefixOld},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		exists, err := db.(ethdb.BucketsMigrator).BucketExists(dbutils.HeaderPrefixOld)
 		if err != nil {
@@ -14,7 +14,8 @@ import (
 )
 
 var historyAccBitmap = Migration{
-	Name: "history_account_bitmap",
+	Name:  "history_account_bitmap",
+	Reads: []string{dbutils.AccountsHistoryBucket},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		logEvery := time.NewTicker(30 * time.Second)
 		defer logEvery.Stop()
@@ -131,7 +132,8 @@ var historyAccBitmap = Migration{
 }
 
 var historyStorageBitmap = Migration{
-	Name: "history_storage_bitmap",
+	Name:  "history_storage_bitmap",
+	Reads: []string{dbutils.StorageHistoryBucket},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		logEvery := time.NewTicker(30 * time.Second)
 		defer logEvery.Stop()
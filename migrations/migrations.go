@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
@@ -54,6 +57,7 @@ import (
 //	},
 // - if you need migrate multiple buckets - create separate migration for each bucket
 // - write test where apply migration twice
+// - list the buckets the migration rewrites in Reads, so `integration run_migrations --dry-run` estimates it
 var migrations = []Migration{
 	stagesToUseNamedKeys,
 	unwindStagesToUseNamedKeys,
@@ -75,19 +79,40 @@ var migrations = []Migration{
 	splitIHBucket,
 	deleteExtensionHashesFromTrieBucket,
 	headerPrefixToSeparateBuckets,
+	txCountIndex,
+	cliqueSnapshotsByNumber,
+}
+
+// optionalMigrations are applied on demand, not by NewMigrator, so they may be in the database too
+var optionalMigrations = []Migration{
+	PreimagesBackfill,
 }
 
 type Migration struct {
-	Name string
-	Up   func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommitOnLoadCommit etl.LoadCommitHandler) error
+	Name  string
+	Reads []string // the buckets the migration rewrites, DryRun estimates it by their size
+	Up    func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommitOnLoadCommit etl.LoadCommitHandler) error
 }
 
 var (
 	ErrMigrationNonUniqueName   = fmt.Errorf("please provide unique migration name")
 	ErrMigrationCommitNotCalled = fmt.Errorf("migraion commit function was not called")
 	ErrMigrationETLFilesDeleted = fmt.Errorf("db migration progress was interrupted after extraction step and ETL files was deleted, please contact development team for help or re-sync from scratch")
+	ErrMigrationUnknown         = fmt.Errorf("the database was migrated by a newer version, its format can't be read by this one, please upgrade (or remove the retired migration with `integration remove_migration`)")
 )
 
+// etlCostFactor is the time of a migration through ETL relative to the time of reading the buckets it rewrites:
+// the extraction, the sort of the files and the load with the commits
+const etlCostFactor = 3
+
+// MigrationEstimate is the amount of the data a pending migration rewrites, see DryRun
+type MigrationEstimate struct {
+	Name  string
+	Rows  uint64        // key/values of the buckets it rewrites
+	Bytes uint64        // of their keys and values
+	Time  time.Duration // to apply it, estimated by the time of reading the buckets
+}
+
 func NewMigrator() *Migrator {
 	return &Migrator{
 		Migrations: migrations,
@@ -122,11 +147,16 @@ func (m *Migrator) HasPendingMigrations(db ethdb.Database) (bool, error) {
 	return len(pending) > 0, nil
 }
 
+// PendingMigrations returns the migrations not applied yet, fails with ErrMigrationUnknown if the database has
+// the migrations of a newer version
 func (m *Migrator) PendingMigrations(db ethdb.Database) ([]Migration, error) {
 	applied, err := AppliedMigrations(db, false)
 	if err != nil {
 		return nil, err
 	}
+	if err = m.checkUnknown(applied); err != nil {
+		return nil, err
+	}
 
 	counter := 0
 	for i := range m.Migrations {
@@ -148,6 +178,74 @@ func (m *Migrator) PendingMigrations(db ethdb.Database) ([]Migration, error) {
 	return pending, nil
 }
 
+// checkUnknown fails if some of the applied migrations are neither in the list of the migrator nor known to this
+// version at all - the database was migrated by a newer one, the names of the migrations are the versions of its format
+func (m *Migrator) checkUnknown(applied map[string][]byte) error {
+	known := map[string]struct{}{}
+	for _, list := range [][]Migration{m.Migrations, migrations, optionalMigrations} {
+		for i := range list {
+			known[list[i].Name] = struct{}{}
+		}
+	}
+	var unknown []string
+	for name := range applied {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("%w: %s", ErrMigrationUnknown, strings.Join(unknown, ", "))
+}
+
+// DryRun estimates the pending migrations without applying them: it reads the buckets each of them rewrites
+// (see Migration.Reads) and times the reads. The migrations without Reads touch a few keys only
+func (m *Migrator) DryRun(db ethdb.Database) ([]MigrationEstimate, error) {
+	pending, err := m.PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	measured := map[string]MigrationEstimate{}
+	estimates := make([]MigrationEstimate, 0, len(pending))
+	for i := range pending {
+		estimate := MigrationEstimate{Name: pending[i].Name}
+		for _, bucket := range pending[i].Reads {
+			size, ok := measured[bucket]
+			if !ok {
+				if size, err = measureBucket(db, bucket); err != nil {
+					return nil, fmt.Errorf("estimating %s: %w", pending[i].Name, err)
+				}
+				measured[bucket] = size
+			}
+			estimate.Rows += size.Rows
+			estimate.Bytes += size.Bytes
+			estimate.Time += size.Time * etlCostFactor
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates, nil
+}
+
+// measureBucket counts the key/values of the bucket and times the read, the missing bucket is empty
+func measureBucket(db ethdb.Database, bucket string) (MigrationEstimate, error) {
+	size := MigrationEstimate{Name: bucket}
+	if exists, err := db.(ethdb.BucketsMigrator).BucketExists(bucket); err != nil || !exists {
+		return size, err
+	}
+	started := time.Now()
+	if err := db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		size.Rows++
+		size.Bytes += uint64(len(k) + len(v))
+		return true, nil
+	}); err != nil {
+		return size, err
+	}
+	size.Time = time.Since(started)
+	return size, nil
+}
+
 func (m *Migrator) Apply(db ethdb.Database, tmpdir string) error {
 	if len(m.Migrations) == 0 {
 		return nil
@@ -157,6 +255,9 @@ func (m *Migrator) Apply(db ethdb.Database, tmpdir string) error {
 	if err1 != nil {
 		return err1
 	}
+	if err := m.checkUnknown(applied); err != nil {
+		return err
+	}
 
 	// migration names must be unique, protection against people's mistake
 	uniqueNameCheck := map[string]bool{}
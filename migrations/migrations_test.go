@@ -16,14 +16,14 @@ func TestApplyWithInit(t *testing.T) {
 	require, db := require.New(t), ethdb.NewMemDatabase()
 	migrations = []Migration{
 		{
-			"one",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "one",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				return OnLoadCommit(db, nil, true)
 			},
 		},
 		{
-			"two",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "two",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				return OnLoadCommit(db, nil, true)
 			},
 		},
@@ -55,15 +55,15 @@ func TestApplyWithoutInit(t *testing.T) {
 	require, db := require.New(t), ethdb.NewMemDatabase()
 	migrations = []Migration{
 		{
-			"one",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "one",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				t.Fatal("shouldn't been executed")
 				return nil
 			},
 		},
 		{
-			"two",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "two",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				return OnLoadCommit(db, nil, true)
 			},
 		},
@@ -98,14 +98,14 @@ func TestWhenNonFirstMigrationAlreadyApplied(t *testing.T) {
 	require, db := require.New(t), ethdb.NewMemDatabase()
 	migrations = []Migration{
 		{
-			"one",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "one",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				return OnLoadCommit(db, nil, true)
 			},
 		},
 		{
-			"two",
-			func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+			Name: "two",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 				t.Fatal("shouldn't been executed")
 				return nil
 			},
@@ -200,3 +200,64 @@ func TestCommitCallRequired(t *testing.T) {
 	require.NoError(err)
 	require.Equal(0, len(applied))
 }
+
+func TestUnknownMigration(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	migrations = []Migration{
+		{
+			Name: "one",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+				t.Fatal("shouldn't been executed")
+				return nil
+			},
+		},
+	}
+	// applied by a newer version
+	err := db.Put(dbutils.Migrations, []byte("from_the_future"), []byte{1})
+	require.NoError(err)
+
+	migrator := NewMigrator()
+	migrator.Migrations = migrations
+	_, err = migrator.PendingMigrations(db)
+	require.True(errors.Is(err, ErrMigrationUnknown))
+	err = migrator.Apply(db, "")
+	require.True(errors.Is(err, ErrMigrationUnknown))
+}
+
+func TestDryRun(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	migrations = []Migration{
+		{
+			Name:  "one",
+			Reads: []string{dbutils.HeadersBucket},
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+				t.Fatal("shouldn't been executed")
+				return nil
+			},
+		},
+		{
+			Name: "two",
+			Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
+				t.Fatal("shouldn't been executed")
+				return nil
+			},
+		},
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(db.Put(dbutils.HeadersBucket, []byte{byte(i)}, []byte{1, 2, 3}))
+	}
+
+	migrator := NewMigrator()
+	migrator.Migrations = migrations
+	estimates, err := migrator.DryRun(db)
+	require.NoError(err)
+	require.Equal(2, len(estimates))
+	require.Equal("one", estimates[0].Name)
+	require.Equal(uint64(10), estimates[0].Rows)
+	require.Equal(uint64(40), estimates[0].Bytes)
+	require.Equal(MigrationEstimate{Name: "two"}, estimates[1])
+
+	applied, err := AppliedMigrations(db, false)
+	require.NoError(err)
+	require.Equal(0, len(applied))
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"bytes"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// PreimagesBackfill saves the preimages of the addresses and the storage keys of the PlainState, which were written
+// before the Execution stage recorded the preimages, e.g. by the genesis or the state snapshots. It isn't one of the
+// migrations applied to every database, the node applies it to the databases with the p storage mode
+var PreimagesBackfill = Migration{
+	Name:  "preimages_backfill",
+	Reads: []string{dbutils.PlainStateBucket},
+	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) error {
+		extractFunc := func(k []byte, v []byte, next etl.ExtractNextFunc) error {
+			var preimage []byte
+			switch len(k) {
+			case common.AddressLength:
+				preimage = k
+			case common.AddressLength + common.IncarnationLength + common.HashLength:
+				preimage = k[common.AddressLength+common.IncarnationLength:]
+			default:
+				return nil
+			}
+			hash, err := common.HashData(preimage)
+			if err != nil {
+				return err
+			}
+			return next(k, hash[:], preimage)
+		}
+		// The same storage keys of many contracts have the same hash
+		var prevHash []byte
+		loadFunc := func(k []byte, v []byte, _ etl.CurrentTableReader, next etl.LoadNextFunc) error {
+			if bytes.Equal(k, prevHash) {
+				return nil
+			}
+			prevHash = append(prevHash[:0], k...)
+			return next(k, k, v)
+		}
+
+		if err := etl.Transform(
+			"preimages_backfill",
+			db,
+			dbutils.PlainStateBucket,
+			dbutils.PreimagePrefix,
+			tmpdir,
+			extractFunc,
+			loadFunc,
+			etl.TransformArgs{OnLoadCommit: CommitProgress},
+		); err != nil {
+			return err
+		}
+		return nil
+	},
+}
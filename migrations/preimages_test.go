@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreimagesBackfill(t *testing.T) {
+	require := require.New(t)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	addresses := []common.Address{{1}, {2}, {3}}
+	key1, key2 := common.Hash{0xa}, common.Hash{0xb}
+	for _, address := range addresses {
+		require.NoError(db.Put(dbutils.PlainStateBucket, address[:], []byte{0x02, 0x01, 0x01}))
+	}
+	// Both of the contracts have the first key
+	require.NoError(db.Put(dbutils.PlainStateBucket, dbutils.PlainGenerateCompositeStorageKey(addresses[1][:], 1, key1[:]), []byte{1}))
+	require.NoError(db.Put(dbutils.PlainStateBucket, dbutils.PlainGenerateCompositeStorageKey(addresses[2][:], 1, key1[:]), []byte{2}))
+	require.NoError(db.Put(dbutils.PlainStateBucket, dbutils.PlainGenerateCompositeStorageKey(addresses[2][:], 1, key2[:]), []byte{3}))
+
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{PreimagesBackfill}
+	require.NoError(migrator.Apply(db, os.TempDir()))
+
+	preimages := map[string][]byte{}
+	require.NoError(db.Walk(dbutils.PreimagePrefix, nil, 0, func(k, v []byte) (bool, error) {
+		preimages[string(k)] = common.CopyBytes(v)
+		return true, nil
+	}))
+	require.Len(preimages, len(addresses)+2)
+	for _, address := range addresses {
+		require.Equal(address[:], preimages[string(crypto.Keccak256(address[:]))])
+	}
+	require.Equal(key1[:], preimages[string(crypto.Keccak256(key1[:]))])
+	require.Equal(key2[:], preimages[string(crypto.Keccak256(key2[:]))])
+
+	// apply migration again
+	require.NoError(migrator.Apply(db, os.TempDir()))
+}
@@ -23,7 +23,8 @@ var dbKeys = []stages.SyncStage{
 }
 
 var stagesToUseNamedKeys = Migration{
-	Name: "stages_to_use_named_keys",
+	Name:  "stages_to_use_named_keys",
+	Reads: []string{dbutils.SyncStageProgressOld1},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, OnLoadCommit etl.LoadCommitHandler) error {
 
 		if exists, err := db.(ethdb.BucketsMigrator).BucketExists(dbutils.SyncStageProgressOld1); err != nil {
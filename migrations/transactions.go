@@ -15,7 +15,8 @@ import (
 )
 
 var transactionsTable = Migration{
-	Name: "tx_table_4",
+	Name:  "tx_table_4",
+	Reads: []string{dbutils.BlockBodyPrefix},
 	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) (err error) {
 		logEvery := time.NewTicker(30 * time.Second)
 		defer logEvery.Stop()
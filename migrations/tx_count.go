@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"encoding/binary"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// txCountIndex indexes the numbers of the transactions of the canonical blocks downloaded before the index existed.
+// The blocks the bodies of which are frozen already aren't indexed, they are counted from the bodies
+var txCountIndex = Migration{
+	Name:  "tx_count_index",
+	Reads: []string{dbutils.HeaderCanonicalBucket},
+	Up: func(db ethdb.Database, tmpdir string, progress []byte, CommitProgress etl.LoadCommitHandler) error {
+		if err := db.(ethdb.BucketsMigrator).ClearBuckets(dbutils.BlockTxCount); err != nil {
+			return err
+		}
+		bodiesProgress, err := stages.GetStageProgress(db, stages.Bodies)
+		if err != nil {
+			return err
+		}
+		bodyForStorage := new(types.BodyForStorage)
+		extractFunc := func(k []byte, v []byte, next etl.ExtractNextFunc) error {
+			blockNum := binary.BigEndian.Uint64(k)
+			if blockNum > bodiesProgress {
+				return nil
+			}
+			data := rawdb.ReadStorageBodyRLP(db, common.BytesToHash(v), blockNum)
+			if len(data) == 0 {
+				return nil
+			}
+			if err := rlp.DecodeBytes(data, bodyForStorage); err != nil {
+				return err
+			}
+			count := make([]byte, 4)
+			binary.BigEndian.PutUint32(count, bodyForStorage.TxAmount)
+			return next(k, k, count)
+		}
+
+		if err := etl.Transform(
+			"tx_count_index",
+			db,
+			dbutils.HeaderCanonicalBucket,
+			dbutils.BlockTxCount,
+			tmpdir,
+			extractFunc,
+			etl.IdentityLoadFunc,
+			etl.TransformArgs{OnLoadCommit: CommitProgress},
+		); err != nil {
+			return err
+		}
+		return nil
+	},
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxCountIndex(t *testing.T) {
+	require := require.New(t)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	for i := uint64(0); i < 10; i++ {
+		hash := common.Hash{uint8(i)}
+		require.NoError(rawdb.WriteCanonicalHash(db, hash, i))
+		data, err := rlp.EncodeToBytes(types.BodyForStorage{BaseTxId: i * 10, TxAmount: uint32(i)})
+		require.NoError(err)
+		rawdb.WriteBodyRLP(db, hash, i, data)
+	}
+	// The non-canonical body and the canonical header above the bodies progress aren't indexed
+	rawdb.WriteBodyRLP(db, common.Hash{0xff}, 3, []byte{0xc0})
+	require.NoError(rawdb.WriteCanonicalHash(db, common.Hash{10}, 10))
+	require.NoError(stages.SaveStageProgress(db, stages.Bodies, 9))
+
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{txCountIndex}
+	require.NoError(migrator.Apply(db, os.TempDir()))
+
+	counts, err := rawdb.ReadTxCounts(db, 0, 100)
+	require.NoError(err)
+	require.Equal([]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, counts)
+
+	// apply migration again
+	require.NoError(migrator.Apply(db, os.TempDir()))
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	mapset "github.com/deckarep/golang-set"
+	"github.com/holiman/uint256"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/consensus"
@@ -53,6 +54,18 @@ func (e *environment) ParentHash() common.Hash {
 	return e.header.ParentHash
 }
 
+// baseFee returns the base fee of the block being built, or nil before the London fork
+func (e *environment) baseFee() *uint256.Int {
+	e.RLock()
+	defer e.RUnlock()
+
+	if e.header.BaseFee == nil {
+		return nil
+	}
+	baseFee, _ := uint256.FromBig(e.header.BaseFee)
+	return baseFee
+}
+
 func (e *environment) SetHeader(h *types.Header) {
 	e.Lock()
 	defer e.Unlock()
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/internal/debug"
@@ -280,6 +281,30 @@ func (api *privateAdminAPI) StopWS() (bool, error) {
 	return true, nil
 }
 
+// Backup starts the hot backup of the database with the given name, e.g. chaindata, into the new directory dst,
+// resolved against the instance directory if relative. The node keeps running, the backup is the snapshot of the
+// database as of the start. throttle limits the reads of the backup in megabytes per second, not limited if omitted.
+// The progress is reported by admin_backupStatus.
+func (api *privateAdminAPI) Backup(name string, dst string, throttle *int) (bool, error) {
+	var limit datasize.ByteSize
+	if throttle != nil {
+		if *throttle <= 0 {
+			return false, fmt.Errorf("throttle has to be positive, got %d", *throttle)
+		}
+		limit = datasize.ByteSize(*throttle) * datasize.MB
+	}
+	if err := api.node.Backup(name, dst, limit); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BackupStatus returns the status and the progress of the last backup started by admin_backup, null if none was
+// started.
+func (api *privateAdminAPI) BackupStatus() *BackupStatus {
+	return api.node.BackupStatus()
+}
+
 // publicAdminAPI is the collection of administrative API methods exposed over
 // both secure and unsecure RPC channels.
 type publicAdminAPI struct {
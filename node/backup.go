@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// BackupStatus is the status of the last backup started by admin_backup
+type BackupStatus struct {
+	Database string               `json:"database"`
+	Path     string               `json:"path"`
+	Running  bool                 `json:"running"`
+	Started  time.Time            `json:"started"`
+	Finished *time.Time           `json:"finished,omitempty"`
+	Error    string               `json:"error,omitempty"`
+	Progress ethdb.BackupProgress `json:"progress"`
+}
+
+// backups runs the backups of the databases of the node, one at a time
+type backups struct {
+	lock   sync.Mutex
+	cancel context.CancelFunc // cancels the running backup, nil if none is running
+	done   chan struct{}      // closed when the running backup is finished
+	status *BackupStatus      // status of the last backup, nil if none was started
+}
+
+// Backup starts the hot backup of the database opened by OpenDatabaseWithFreezer with the given name into the new
+// directory dst, resolved against the instance directory if relative. The backup is opened with the backend of the
+// node. throttle limits the speed of the reads, not limited if zero. The progress is reported by BackupStatus
+func (n *Node) Backup(name, dst string, throttle datasize.ByteSize) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.state == closedState {
+		return ErrNodeStopped
+	}
+	db, ok := n.namedDatabases[name]
+	if !ok {
+		return fmt.Errorf("database %s is not open", name)
+	}
+	path, err := n.config.ResolvePath(dst)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("the path of the backup has to be absolute without the datadir")
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("the backup can't overwrite %s", path)
+	}
+	backend := n.config.Database
+	if backend == "" {
+		backend = "lmdb"
+	}
+	return n.backups.start(name, db.KV(), path, func() (ethdb.KV, error) {
+		return ethdb.OpenBackend(backend, ethdb.BackendOpts{Path: path, Exclusive: true, MapSize: n.config.LMDBMapSize, Geometry: n.config.DBGeometry})
+	}, throttle)
+}
+
+// BackupStatus returns the status of the last backup started by Backup, nil if none was started
+func (n *Node) BackupStatus() *BackupStatus {
+	return n.backups.lastStatus()
+}
+
+func (b *backups) start(name string, db ethdb.KV, path string, open func() (ethdb.KV, error), throttle datasize.ByteSize) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.cancel != nil {
+		return fmt.Errorf("the backup of %s into %s is running already", b.status.Database, b.status.Path)
+	}
+	dst, err := open()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel, b.done = cancel, make(chan struct{})
+	b.status = &BackupStatus{Database: name, Path: path, Running: true, Started: time.Now()}
+	log.Info("Backing up the database", "name", name, "path", path, "throttle", throttle.HR())
+	go func() {
+		defer close(b.done)
+		err := ethdb.Backup(ctx, db, dst, throttle, func(p ethdb.BackupProgress) {
+			b.lock.Lock()
+			b.status.Progress = p
+			b.lock.Unlock()
+		})
+		dst.Close()
+		if err != nil {
+			log.Error("Backup failed, removing it", "name", name, "path", path, "err", err)
+			if err1 := os.RemoveAll(path); err1 != nil {
+				log.Error("Failed to remove the backup", "path", path, "err", err1)
+			}
+		}
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		finished := time.Now()
+		b.status.Running, b.status.Finished = false, &finished
+		if err != nil {
+			b.status.Error = err.Error()
+		}
+		b.cancel()
+		b.cancel = nil
+	}()
+	return nil
+}
+
+func (b *backups) lastStatus() *BackupStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.status == nil {
+		return nil
+	}
+	status := *b.status
+	return &status
+}
+
+// stop cancels the running backup and waits for it to finish
+func (b *backups) stop() {
+	b.lock.Lock()
+	cancel, done := b.cancel, b.done
+	b.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,65 @@
+package node
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Tests that admin_backup copies the database while it is open, and reports the progress.
+func TestBackup(t *testing.T) {
+	config := testNodeConfig()
+	config.DataDir = t.TempDir()
+	stack, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stack.Close()
+	db, err := stack.OpenDatabaseWithFreezer("mydb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Put(dbutils.HeadersBucket, []byte("testK"), []byte("testV")); err != nil {
+		t.Fatal(err)
+	}
+
+	api := &privateAdminAPI{stack}
+	if api.BackupStatus() != nil {
+		t.Fatal("expected no status before the first backup")
+	}
+	if _, err = api.Backup("otherdb", "backup", nil); err == nil {
+		t.Error("expected the backup of the database which is not open to fail")
+	}
+	if _, err = api.Backup("mydb", "backup", nil); err != nil {
+		t.Fatal(err)
+	}
+	status := api.BackupStatus()
+	for deadline := time.Now().Add(10 * time.Second); status.Running && time.Now().Before(deadline); status = api.BackupStatus() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Running || status.Error != "" || status.Finished == nil {
+		t.Fatalf("unexpected status of the backup: %+v", status)
+	}
+	if status.Progress.BucketsDone != status.Progress.BucketsTotal || status.Progress.Keys == 0 {
+		t.Errorf("unexpected progress of the backup: %+v", status.Progress)
+	}
+	if _, err = api.Backup("mydb", "backup", nil); err == nil {
+		t.Error("expected the backup not to overwrite the existing one")
+	}
+
+	// The database is still in use
+	if err = db.Put(dbutils.HeadersBucket, []byte("testK2"), []byte("testV2")); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ethdb.Open(filepath.Join(config.instanceDir(), "backup"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if v, err := backup.Get(dbutils.HeadersBucket, []byte("testK")); err != nil || string(v) != "testV" {
+		t.Errorf("unexpected value in the backup: %q, %v", v, err)
+	}
+}
@@ -24,11 +24,13 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/c2h5oh/datasize"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/p2p"
 	"github.com/ledgerwatch/turbo-geth/p2p/enode"
@@ -126,6 +128,19 @@ type Config struct {
 	// cannot verify the validity of the request header.
 	WSOrigins []string `toml:",omitempty"`
 
+	// AuthHost is the host interface on which to start the authenticated HTTP RPC server,
+	// serving only the APIs requiring the authentication, e.g. the engine API of the
+	// consensus client. If this field is empty, no authenticated endpoint will be started.
+	AuthHost string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated HTTP RPC server.
+	AuthPort int `toml:",omitempty"`
+
+	// JWTSecret is the path of the file with the hex encoded secret the tokens of the
+	// authenticated requests are signed with, generated if the file doesn't exist. The
+	// file is "jwt.hex" in the instance directory if empty.
+	JWTSecret string `toml:",omitempty"`
+
 	// WSModules is a list of API modules to expose via the websocket RPC interface.
 	// If the module list is empty, all RPC API endpoints designated public will be
 	// exposed.
@@ -141,11 +156,38 @@ type Config struct {
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
+	// ShutdownTimeout is the maximum time Close waits for the services to stop (i.e. for
+	// the running sync stage to finish or checkpoint its work) and for the databases to
+	// close. The services get 3/4 of it, if they don't stop in time, the databases are
+	// still closed once their transactions end, within the rest of the timeout. Zero means
+	// waiting indefinitely.
+	ShutdownTimeout time.Duration `toml:",omitempty"`
+
+	// Database is the name of the KV backend, one of ethdb.Backends(). Empty means LMDB.
+	Database string
+
 	// Whether to use LMDB.
 	LMDB                 bool
 	LMDBMapSize          datasize.ByteSize
 	LMDBMaxFreelistReuse uint
-	MDBX                 bool
+
+	// ColdDataDir is the directory of the cold databases keeping the ColdBuckets, usually on another volume than
+	// DataDir, see ethdb.TieredKV. Empty means all the buckets are kept in DataDir.
+	ColdDataDir string
+	ColdBuckets []string
+
+	// DBGeometry is the sizes of the database file, its MaxSize overrides LMDBMapSize
+	DBGeometry ethdb.Geometry
+
+	// Durability is the fsync policy of the commits of the database in the steady state, BulkDurability is the one
+	// of the sync far behind the head. Only MDBX supports the levels other than ethdb.DefaultDurability.
+	Durability     ethdb.Durability
+	BulkDurability ethdb.Durability
+
+	// The read transactions older than ReadTxWarn are logged with the stack of their holder, the ones older than
+	// ReadTxLimit are aborted, never if zero
+	ReadTxWarn  time.Duration
+	ReadTxLimit time.Duration
 
 	// Address to listen to when launchig listener for remote database access
 	// empty string means not to start the listener
@@ -266,6 +308,15 @@ func (c *Config) name() string {
 	return c.Name
 }
 
+// JWTSecretPath returns the path of the file with the secret of the authenticated
+// HTTP RPC server, empty for the ephemeral nodes.
+func (c *Config) JWTSecretPath() (string, error) {
+	if c.JWTSecret != "" {
+		return c.JWTSecret, nil
+	}
+	return c.ResolvePath("jwt.hex")
+}
+
 // ResolvePath resolves path in the instance directory.
 func (c *Config) ResolvePath(path string) (string, error) {
 	if filepath.IsAbs(path) {
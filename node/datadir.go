@@ -0,0 +1,35 @@
+package node
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// checkDataDir reports whether the datadir is on a read-only volume and the name of its
+// filesystem if it is a network one. The databases can't be safely written in either case,
+// so the node has to start in the safe mode, see Node.SafeMode.
+func checkDataDir(dir string) (readOnly bool, networkFS string, err error) {
+	if _, err = os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			// A new datadir gets created
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	probe, err := ioutil.TempFile(dir, ".probe")
+	switch {
+	case err == nil:
+		probe.Close()
+		os.Remove(probe.Name())
+	case errors.Is(err, syscall.EROFS) || os.IsPermission(err):
+		readOnly = true
+	default:
+		return false, "", err
+	}
+	if networkFS, err = networkFileSystem(dir); err != nil {
+		return false, "", err
+	}
+	return readOnly, networkFS, nil
+}
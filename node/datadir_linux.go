@@ -0,0 +1,27 @@
+// +build linux
+
+package node
+
+import "golang.org/x/sys/unix"
+
+// networkFileSystems are the magic numbers of the network filesystems, see statfs(2)
+var networkFileSystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xfe534d42: "smb2",
+	0xff534d42: "cifs",
+	0x00c36400: "ceph",
+	0x5346414f: "afs",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+	0x01021997: "9p",
+}
+
+// networkFileSystem returns the name of the filesystem of the dir if it's a network one
+func networkFileSystem(dir string) (string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return "", err
+	}
+	return networkFileSystems[uint32(st.Type)], nil
+}
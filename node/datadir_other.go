@@ -0,0 +1,9 @@
+// +build !linux
+
+package node
+
+// networkFileSystem returns the name of the filesystem of the dir if it's a network one,
+// the network filesystems are only detected on Linux
+func networkFileSystem(dir string) (string, error) {
+	return "", nil
+}
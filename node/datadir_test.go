@@ -0,0 +1,62 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+func TestCheckDataDir(t *testing.T) {
+	dir := t.TempDir()
+	if readOnly, _, err := checkDataDir(dir); err != nil || readOnly {
+		t.Fatalf("writable datadir: readonly %t, err %v", readOnly, err)
+	}
+	if readOnly, _, err := checkDataDir(filepath.Join(dir, "new")); err != nil || readOnly {
+		t.Fatalf("missing datadir: readonly %t, err %v", readOnly, err)
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700) //nolint:errcheck
+	if readOnly, _, err := checkDataDir(dir); err != nil || !readOnly {
+		t.Fatalf("read-only datadir: readonly %t, err %v", readOnly, err)
+	}
+}
+
+// Tests that the databases are opened read-only in the safe mode.
+func TestSafeModeDatabase(t *testing.T) {
+	dir := t.TempDir()
+	stack, err := New(&Config{DataDir: dir, P2P: testNodeConfig().P2P})
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	db, err := stack.OpenDatabase("chaindata", dir)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err = db.Put(dbutils.DatabaseInfoBucket, []byte("key"), []byte("value")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	stack.Close()
+
+	stack, err = New(&Config{DataDir: dir, P2P: testNodeConfig().P2P})
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	stack.safeMode = true
+	if db, err = stack.OpenDatabase("chaindata", dir); err != nil {
+		t.Fatalf("failed to open database in the safe mode: %v", err)
+	}
+	if v, err := db.Get(dbutils.DatabaseInfoBucket, []byte("key")); err != nil || string(v) != "value" {
+		t.Fatalf("failed to read in the safe mode: %q, %v", v, err)
+	}
+	if err = db.Put(dbutils.DatabaseInfoBucket, []byte("key"), []byte("other")); err == nil {
+		t.Fatalf("write succeeded in the safe mode")
+	}
+}
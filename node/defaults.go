@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/p2p"
 	"github.com/ledgerwatch/turbo-geth/p2p/nat"
@@ -33,6 +34,10 @@ const (
 	DefaultHTTPPort = 8545        // Default TCP port for the HTTP RPC server
 	DefaultWSHost   = "localhost" // Default host interface for the websocket RPC server
 	DefaultWSPort   = 8546        // Default TCP port for the websocket RPC server
+	DefaultAuthHost = "localhost" // Default host interface for the authenticated HTTP RPC server
+	DefaultAuthPort = 8550        // Default TCP port for the authenticated HTTP RPC server
+
+	DefaultShutdownTimeout = 2 * time.Minute // Default time to wait for the services to stop
 )
 
 // DefaultConfig contains reasonable default settings.
@@ -44,6 +49,8 @@ var DefaultConfig = Config{
 	HTTPTimeouts:     rpc.DefaultHTTPTimeouts,
 	WSPort:           DefaultWSPort,
 	WSModules:        []string{"net", "web3"},
+	AuthPort:         DefaultAuthPort,
+	ShutdownTimeout:  DefaultShutdownTimeout,
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
 		MaxPeers:   50,
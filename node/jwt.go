@@ -0,0 +1,129 @@
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	jwtSecretLength = 32               // Length of the secret the tokens are signed with
+	jwtMaxClockSkew = 60 * time.Second // Maximum difference between the issuance time of a token and the local time
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+// obtainJWTSecret reads the hex encoded secret from the file, it generates the secret and writes it to the file if
+// the file doesn't exist. The secret generated for the empty path, e.g. of the node without the data directory, is
+// written to a new temporary file, only the path of the file is logged
+func obtainJWTSecret(path string) ([]byte, error) {
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			secret := common.FromHex(strings.TrimSpace(string(data)))
+			if len(secret) != jwtSecretLength {
+				return nil, fmt.Errorf("invalid JWT secret in %s: expected %d bytes, got %d", path, jwtSecretLength, len(secret))
+			}
+			return secret, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	secret := make([]byte, jwtSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		f, err := ioutil.TempFile("", "jwt-*.hex")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err = f.WriteString(hexutil.Encode(secret)); err != nil {
+			return nil, err
+		}
+		log.Warn("Generated the JWT secret of the authenticated RPC in a temporary file", "path", f.Name())
+		return secret, nil
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Generated the JWT secret of the authenticated RPC", "path", path)
+	return secret, nil
+}
+
+// jwtHandler serves the requests bearing a token signed with the secret (HS256) and issued recently, to protect
+// against the replays
+type jwtHandler struct {
+	secret []byte
+	next   http.Handler
+	now    func() time.Time
+}
+
+func newJWTHandler(secret []byte, next http.Handler) http.Handler {
+	return &jwtHandler{secret: secret, next: next, now: time.Now}
+}
+
+func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if err := h.verify(token); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// verify checks the signature of the token and its issuance time
+func (h *jwtHandler) verify(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return errInvalidToken
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errInvalidToken
+	}
+	var claims struct {
+		IssuedAt *int64 `json:"iat"`
+	}
+	if err = decodeJWTPart(parts[1], &claims); err != nil || claims.IssuedAt == nil {
+		return errInvalidToken
+	}
+	if skew := h.now().Sub(time.Unix(*claims.IssuedAt, 0)); skew > jwtMaxClockSkew || skew < -jwtMaxClockSkew {
+		return errors.New("stale token")
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,87 @@
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func signJWT(secret []byte, header, claims string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTHandler(t *testing.T) {
+	secret := make([]byte, jwtSecretLength)
+	now := time.Unix(1600000000, 0)
+	handler := newJWTHandler(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).(*jwtHandler)
+	handler.now = func() time.Time { return now }
+
+	header := `{"alg":"HS256","typ":"JWT"}`
+	for _, tt := range []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"valid", signJWT(secret, header, fmt.Sprintf(`{"iat":%d}`, now.Unix()-5)), http.StatusOK},
+		{"missing", "", http.StatusForbidden},
+		{"other secret", signJWT([]byte("other"), header, fmt.Sprintf(`{"iat":%d}`, now.Unix())), http.StatusForbidden},
+		{"other algorithm", signJWT(secret, `{"alg":"none"}`, fmt.Sprintf(`{"iat":%d}`, now.Unix())), http.StatusForbidden},
+		{"no issuance time", signJWT(secret, header, `{}`), http.StatusForbidden},
+		{"stale", signJWT(secret, header, fmt.Sprintf(`{"iat":%d}`, now.Unix()-61)), http.StatusForbidden},
+		{"future", signJWT(secret, header, fmt.Sprintf(`{"iat":%d}`, now.Unix()+61)), http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.name)
+	}
+}
+
+func TestObtainJWTSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwt.hex")
+	secret, err := obtainJWTSecret(path)
+	require.NoError(t, err)
+	require.Len(t, secret, jwtSecretLength)
+
+	// The generated secret is persisted
+	again, err := obtainJWTSecret(path)
+	require.NoError(t, err)
+	require.Equal(t, secret, again)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("0x1234\n"), 0600))
+	_, err = obtainJWTSecret(path)
+	require.Error(t, err)
+
+	// Without the path the secret is written to a temporary file
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	secret, err = obtainJWTSecret("")
+	require.NoError(t, err)
+	files, err := filepath.Glob(filepath.Join(tmp, "jwt-*.hex"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	info, err := os.Stat(files[0])
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	again, err = obtainJWTSecret(files[0])
+	require.NoError(t, err)
+	require.Equal(t, secret, again)
+}
@@ -17,6 +17,7 @@
 package node
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -26,6 +27,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/event"
@@ -42,6 +44,7 @@ type Node struct {
 	config        *Config
 	log           log.Logger
 	dirLock       fileutil.Releaser // prevents concurrent use of instance directory
+	safeMode      bool              // datadir can't be written, only the read-only serving is possible
 	stop          chan struct{}     // Channel to wait for termination notifications
 	server        *p2p.Server       // Currently running P2P networking layer
 	startStopLock sync.Mutex        // Start/Stop are protected by an additional lock
@@ -52,12 +55,15 @@ type Node struct {
 	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
 	http          *httpServer //
 	ws            *httpServer //
+	auth          *httpServer // Serves the authenticated APIs
 	ipc           *ipcServer  // Stores information about the ipc http server
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 
 	rpcAllowList rpc.AllowList // list of RPC methods explicitly allowed for this RPC node
 
-	databases []ethdb.Closer
+	databases      []ethdb.Closer
+	namedDatabases map[string]*ethdb.ObjectDatabase // Databases opened by OpenDatabaseWithFreezer, by the name
+	backups        backups                          // Backup of a database started by admin_backup
 }
 
 const (
@@ -93,18 +99,31 @@ func New(conf *Config) (*Node, error) {
 	}
 
 	node := &Node{
-		config:        conf,
-		inprocHandler: rpc.NewServer(),
-		eventmux:      new(event.TypeMux),
-		log:           conf.Logger,
-		stop:          make(chan struct{}),
-		server:        &p2p.Server{Config: conf.P2P},
-		databases:     make([]ethdb.Closer, 0),
+		config:         conf,
+		inprocHandler:  rpc.NewServer(),
+		eventmux:       new(event.TypeMux),
+		log:            conf.Logger,
+		stop:           make(chan struct{}),
+		server:         &p2p.Server{Config: conf.P2P},
+		databases:      make([]ethdb.Closer, 0),
+		namedDatabases: make(map[string]*ethdb.ObjectDatabase),
 	}
 
 	// Register built-in APIs.
 	node.rpcAPIs = append(node.rpcAPIs, node.apis()...)
 
+	// Fall back to the safe mode instead of failing on the first write into the datadir
+	if conf.DataDir != "" {
+		readOnly, networkFS, err := checkDataDir(conf.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		if readOnly || networkFS != "" {
+			node.log.Warn("Datadir can't be written safely, starting in the safe read-only mode", "datadir", conf.DataDir, "readonly", readOnly, "fs", networkFS)
+			node.safeMode = true
+		}
+	}
+
 	// Acquire the instance directory lock.
 	if err := node.openDataDir(); err != nil {
 		return nil, err
@@ -136,6 +155,14 @@ func New(conf *Config) (*Node, error) {
 			return nil, err
 		}
 	}
+	if node.safeMode {
+		// Nothing can be downloaded into the read-only database
+		node.server.Config.MaxPeers = 0
+		node.server.Config.NoDiscovery = true
+		node.server.Config.NoDial = true
+		node.server.Config.ListenAddr = ""
+		node.server.Config.NodeDatabase = "" // in-memory
+	}
 
 	// Check HTTP/WS prefixes are valid.
 	if err := validatePrefix("HTTP", conf.HTTPPathPrefix); err != nil {
@@ -148,6 +175,7 @@ func New(conf *Config) (*Node, error) {
 	// Configure RPC servers.
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
+	node.auth = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
 
 	return node, nil
@@ -181,7 +209,7 @@ func (n *Node) Start() error {
 
 	// Check if endpoint startup failed.
 	if err != nil {
-		n.doClose(nil)
+		n.doClose(nil, 0)
 		return err
 	}
 	// Start all registered lifecycles.
@@ -195,8 +223,8 @@ func (n *Node) Start() error {
 	}
 	// Check if any lifecycle failed to start.
 	if err != nil {
-		n.stopServices(started) //nolint:errcheck
-		n.doClose(nil)
+		n.stopServices(started, 0) //nolint:errcheck
+		n.doClose(nil, 0)
 	}
 	return err
 }
@@ -213,14 +241,20 @@ func (n *Node) Close() error {
 	switch state {
 	case initializingState:
 		// The node was never started.
-		return n.doClose(nil)
+		return n.doClose(nil, 0)
 	case runningState:
-		// The node was started, release resources acquired by Start().
+		// The node was started, release resources acquired by Start(). The services get a part
+		// of the shutdown timeout, the rest is left to close the databases, which waits for the
+		// transactions of the services that didn't stop in time to be committed or rolled back.
 		var errs []error
-		if err := n.stopServices(n.lifecycles); err != nil {
+		servicesTimeout := n.config.ShutdownTimeout * shutdownServicesShare / 100
+		if err := n.stopServices(n.lifecycles, servicesTimeout); err != nil {
+			if errors.Is(err, ErrStopTimeout) {
+				n.log.Error("Services did not stop within the shutdown timeout, closing databases", "timeout", servicesTimeout)
+			}
 			errs = append(errs, err)
 		}
-		return n.doClose(errs)
+		return n.doClose(errs, n.config.ShutdownTimeout-servicesTimeout)
 	case closedState:
 		return ErrNodeStopped
 	default:
@@ -228,16 +262,28 @@ func (n *Node) Close() error {
 	}
 }
 
-// doClose releases resources acquired by New(), collecting errors.
-func (n *Node) doClose(errs []error) error {
+// shutdownServicesShare is the percentage of the shutdown timeout given to the services to stop,
+// the rest is given to closing the databases
+const shutdownServicesShare = 75
+
+// doClose releases resources acquired by New(), collecting errors. The databases are closed
+// within the timeout, zero means waiting for them indefinitely.
+func (n *Node) doClose(errs []error, timeout time.Duration) error {
+	// The backup reads the database until it is canceled
+	n.backups.stop()
+
 	// Close databases. This needs the lock because it needs to
 	// synchronize with OpenDatabase*.
 	n.lock.Lock()
 	n.state = closedState
-	for _, closer := range n.databases {
-		closer.Close()
-	}
+	databases := n.databases
 	n.lock.Unlock()
+	if err := closeDatabases(databases, timeout); err != nil {
+		n.log.Error("Databases were not closed within the shutdown timeout, still in use by the services", "timeout", timeout)
+		if len(errs) == 0 || !errors.Is(errs[0], ErrStopTimeout) {
+			errs = append(errs, err)
+		}
+	}
 
 	// Release instance directory lock.
 	n.closeDataDir()
@@ -256,6 +302,30 @@ func (n *Node) doClose(errs []error) error {
 	}
 }
 
+// closeDatabases closes the databases, which waits for their open transactions. ErrStopTimeout
+// is returned if they are not closed within the timeout, they are left closing in the background.
+func closeDatabases(databases []ethdb.Closer, timeout time.Duration) error {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for _, closer := range databases {
+			closer.Close()
+		}
+	}()
+	if timeout <= 0 {
+		<-closed
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-closed:
+		return nil
+	case <-timer.C:
+		return ErrStopTimeout
+	}
+}
+
 // openEndpoints starts all network and RPC endpoints.
 func (n *Node) openEndpoints() error {
 	// start networking endpoints
@@ -282,21 +352,37 @@ func containsLifecycle(lfs []Lifecycle, l Lifecycle) bool {
 	return false
 }
 
-// stopServices terminates running services, RPC and p2p networking.
-// It is the inverse of Start.
-func (n *Node) stopServices(running []Lifecycle) error {
+// stopServices terminates running services, RPC and p2p networking, waiting for them
+// within the timeout, zero means waiting indefinitely. It is the inverse of Start.
+func (n *Node) stopServices(running []Lifecycle, timeout time.Duration) error {
+	// Stop serving RPC first, so no new requests start reading the databases
 	n.stopRPC()
 
-	// Stop running lifecycles in reverse order.
+	// Stop running lifecycles in reverse order, within the shutdown timeout.
 	failure := &StopError{Services: make(map[reflect.Type]error)}
-	for i := len(running) - 1; i >= 0; i-- {
-		if err := running[i].Stop(); err != nil {
-			failure.Services[reflect.TypeOf(running[i])] = err
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := len(running) - 1; i >= 0; i-- {
+			if err := running[i].Stop(); err != nil {
+				failure.Services[reflect.TypeOf(running[i])] = err
+			}
 		}
-	}
 
-	// Stop p2p networking.
-	n.server.Stop()
+		// Stop p2p networking.
+		n.server.Stop()
+	}()
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-stopped:
+		case <-timer.C:
+			return ErrStopTimeout
+		}
+	} else {
+		<-stopped
+	}
 
 	if len(failure.Services) > 0 {
 		return failure
@@ -308,6 +394,9 @@ func (n *Node) openDataDir() error {
 	if n.config.DataDir == "" {
 		return nil // ephemeral
 	}
+	if n.safeMode {
+		return nil // nothing is written, so there are no conflicts with other instances
+	}
 
 	instdir := n.config.instanceDir()
 	if err := os.MkdirAll(instdir, 0700); err != nil {
@@ -385,9 +474,30 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Configure the authenticated HTTP endpoint.
+	if n.config.AuthHost != "" {
+		path, err := n.config.JWTSecretPath()
+		if err != nil {
+			return err
+		}
+		secret, err := obtainJWTSecret(path)
+		if err != nil {
+			return err
+		}
+		if err := n.auth.setListenAddr(n.config.AuthHost, n.config.AuthPort); err != nil {
+			return err
+		}
+		if err := n.auth.enableRPC(n.rpcAPIs, httpConfig{jwtSecret: secret}, n.rpcAllowList); err != nil {
+			return err
+		}
+	}
+
 	if err := n.http.start(); err != nil {
 		return err
 	}
+	if err := n.auth.start(); err != nil {
+		return err
+	}
 	return n.ws.start()
 }
 
@@ -401,6 +511,7 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
+	n.auth.stop()
 	n.ipc.stop() //nolint:errcheck
 	n.stopInProc()
 }
@@ -575,33 +686,34 @@ func (n *Node) OpenDatabaseWithFreezer(name string, tmpdir string) (*ethdb.Objec
 			return nil, err
 		}
 
-		var openFunc func(exclusive bool) (*ethdb.ObjectDatabase, error)
-		if n.config.MDBX {
-			log.Info("Opening Database (MDBX)", "mapSize", n.config.LMDBMapSize.HR())
-			openFunc = func(exclusive bool) (*ethdb.ObjectDatabase, error) {
-				opts := ethdb.NewMDBX().Path(dbPath).MapSize(n.config.LMDBMapSize)
-				if exclusive {
-					opts = opts.Exclusive()
-				}
-				kv, err1 := opts.Open()
-				if err1 != nil {
-					return nil, err1
-				}
-				return ethdb.NewObjectDatabase(kv), nil
+		backend := n.config.Database
+		if backend == "" {
+			backend = "lmdb"
+		}
+		log.Info("Opening Database", "backend", backend, "mapSize", n.config.LMDBMapSize.HR(), "maxSize", n.config.DBGeometry.MaxSize.HR(), "maxFreelistReuse", n.config.LMDBMaxFreelistReuse, "durability", n.config.Durability, "readTxLimit", n.config.ReadTxLimit, "readonly", n.safeMode)
+		if n.config.ColdDataDir != "" {
+			log.Info("Opening the cold database", "dir", n.config.ColdDataDir, "buckets", strings.Join(n.config.ColdBuckets, ","))
+		}
+		openFunc := func(exclusive bool) (*ethdb.ObjectDatabase, error) {
+			opts := ethdb.BackendOpts{
+				Path:             dbPath,
+				ReadOnly:         n.safeMode,
+				Exclusive:        exclusive,
+				MapSize:          n.config.LMDBMapSize,
+				Geometry:         n.config.DBGeometry,
+				MaxFreelistReuse: n.config.LMDBMaxFreelistReuse,
+				Durability:       n.config.Durability,
+				ReadTxWarn:       n.config.ReadTxWarn,
+				ReadTxLimit:      n.config.ReadTxLimit,
+			}
+			kv, err1 := ethdb.OpenBackend(backend, opts)
+			if err1 != nil {
+				return nil, err1
 			}
-		} else {
-			log.Info("Opening Database (LMDB)", "mapSize", n.config.LMDBMapSize.HR(), "maxFreelistReuse", n.config.LMDBMaxFreelistReuse)
-			openFunc = func(exclusive bool) (*ethdb.ObjectDatabase, error) {
-				opts := ethdb.NewLMDB().Path(dbPath).MapSize(n.config.LMDBMapSize).MaxFreelistReuse(n.config.LMDBMaxFreelistReuse)
-				if exclusive {
-					opts = opts.Exclusive()
-				}
-				kv, err1 := opts.Open()
-				if err1 != nil {
-					return nil, err1
-				}
-				return ethdb.NewObjectDatabase(kv), nil
+			if kv, err1 = n.openColdDatabase(name, backend, opts, kv); err1 != nil {
+				return nil, err1
 			}
+			return ethdb.NewObjectDatabase(kv), nil
 		}
 
 		db, err = openFunc(false)
@@ -613,6 +725,10 @@ func (n *Node) OpenDatabaseWithFreezer(name string, tmpdir string) (*ethdb.Objec
 		if err != nil {
 			return nil, err
 		}
+		if has && n.safeMode {
+			db.Close()
+			return nil, fmt.Errorf("database %s has pending migrations, which can't be applied in the safe read-only mode", dbPath)
+		}
 		if has {
 			log.Info("Re-Opening DB in exclusive mode to apply migrations")
 			db.Close()
@@ -632,9 +748,50 @@ func (n *Node) OpenDatabaseWithFreezer(name string, tmpdir string) (*ethdb.Objec
 	}
 
 	n.databases = append(n.databases, db)
+	n.namedDatabases[name] = db
 	return db, nil
 }
 
+// openColdDatabase opens the cold database of the ColdBuckets in ColdDataDir with the options of the hot one and
+// combines them, if ColdDataDir is set. Otherwise it checks the hot database doesn't keep buckets in a cold one
+func (n *Node) openColdDatabase(name string, backend string, opts ethdb.BackendOpts, hot ethdb.KV) (ethdb.KV, error) {
+	if n.config.ColdDataDir == "" {
+		var cold []string
+		if err := hot.View(context.Background(), func(tx ethdb.Tx) (err error) {
+			cold, err = ethdb.ReadColdBuckets(tx)
+			return err
+		}); err != nil {
+			hot.Close()
+			return nil, err
+		}
+		if cold != nil {
+			hot.Close()
+			return nil, fmt.Errorf("database %s keeps the buckets %s in a cold database, set --datadir.cold", opts.Path, strings.Join(cold, ","))
+		}
+		return hot, nil
+	}
+	opts.Path = filepath.Join(n.config.ColdDataDir, name)
+	cold, err := ethdb.OpenBackend(backend, opts)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	tiered, err := ethdb.NewTieredKV(context.Background(), hot, cold, n.config.ColdBuckets)
+	if err != nil {
+		hot.Close()
+		cold.Close()
+		return nil, err
+	}
+	return tiered, nil
+}
+
+// SafeMode reports whether the node is in the safe read-only mode, which is the case when
+// the datadir is on a read-only volume or a network filesystem, e.g. in the snapshot based
+// replica deployments. The databases are opened read-only and the networking is disabled.
+func (n *Node) SafeMode() bool {
+	return n.safeMode
+}
+
 // ResolvePath returns the absolute path of a resource in the instance directory.
 func (n *Node) ResolvePath(x string) (string, error) {
 	return n.config.ResolvePath(x)
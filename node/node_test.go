@@ -27,6 +27,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/crypto"
@@ -390,6 +391,91 @@ func TestLifecycleTerminationGuarantee(t *testing.T) {
 	stack.server.PrivateKey = testNodeKey
 }
 
+// Tests that Close gives up on the services which don't stop within the shutdown timeout.
+func TestLifecycleShutdownTimeout(t *testing.T) {
+	config := testNodeConfig()
+	config.ShutdownTimeout = 100 * time.Millisecond
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	stack.RegisterLifecycle(&InstrumentedService{stopHook: func() { <-release }})
+	db := &closeRecorder{closed: make(chan struct{})}
+	stack.databases = append(stack.databases, db)
+	if err = stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+
+	start := time.Now()
+	if err = stack.Close(); !errors.Is(err, ErrStopTimeout) {
+		t.Fatalf("termination failure mismatch: have %v, want %v", err, ErrStopTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Close took %v despite the shutdown timeout", elapsed)
+	}
+	select {
+	case <-db.closed:
+	default:
+		t.Fatal("database is not closed despite the shutdown timeout")
+	}
+	select {
+	case <-stack.stop:
+	default:
+		t.Fatal("node is not marked as stopped")
+	}
+}
+
+// Tests that Close returns within the shutdown timeout even if a database can't be closed
+// because a service which didn't stop still uses it.
+func TestLifecycleShutdownTimeoutDatabaseInUse(t *testing.T) {
+	config := testNodeConfig()
+	config.ShutdownTimeout = 100 * time.Millisecond
+	stack, err := New(config)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+
+	release := make(chan struct{})
+	stack.RegisterLifecycle(&InstrumentedService{stopHook: func() { <-release }})
+	db := &closeRecorder{closed: make(chan struct{}), release: release}
+	stack.databases = append(stack.databases, db)
+	if err = stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+
+	start := time.Now()
+	if err = stack.Close(); !errors.Is(err, ErrStopTimeout) {
+		t.Fatalf("termination failure mismatch: have %v, want %v", err, ErrStopTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Close took %v despite the shutdown timeout", elapsed)
+	}
+	// The database is closed in the background once the service is done with it
+	close(release)
+	select {
+	case <-db.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("database is not closed after the service stopped")
+	}
+}
+
+// closeRecorder is a database which records being closed. If release is set, Close waits
+// for it, like a database waiting for the open transactions.
+type closeRecorder struct {
+	closed  chan struct{}
+	release chan struct{}
+}
+
+func (c *closeRecorder) Close() {
+	if c.release != nil {
+		<-c.release
+	}
+	close(c.closed)
+}
+
 // Tests whether a handler can be successfully mounted on the canonical HTTP server
 // on the given prefix
 func TestRegisterHandler_Successful(t *testing.T) {
@@ -0,0 +1,79 @@
+package node
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+)
+
+// MsgpackContentType is the content type of the JSON-RPC responses transcoded to MessagePack
+const MsgpackContentType = "application/msgpack"
+
+var (
+	rpcJsonHandle    codec.JsonHandle
+	rpcMsgpackHandle codec.MsgpackHandle
+)
+
+func init() {
+	rpcJsonHandle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	rpcMsgpackHandle.WriteExt = true // str8 and bin types of the current MessagePack spec
+}
+
+// acceptsMsgpack returns whether the Accept header of the request asks for MessagePack
+func acceptsMsgpack(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, params, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && params["q"] != "0" {
+			if mt == MsgpackContentType || mt == "application/x-msgpack" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter keeps the response in memory, so it can be transcoded before it is sent
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferedResponseWriter) WriteHeader(status int) { w.status = status }
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+// NewMsgpackHandler transcodes the JSON-RPC responses to MessagePack for the clients that send
+// `Accept: application/msgpack`. MessagePack is more compact than JSON for the large results, e.g. of
+// eth_getLogs or trace_filter, and cheaper to parse. The requests are always JSON, and the other
+// clients keep getting JSON responses
+func NewMsgpackHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !acceptsMsgpack(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		// Only the JSON-RPC responses are transcoded, the errors of the http layer are sent as they are
+		var result interface{}
+		mt, _, _ := mime.ParseMediaType(buf.header.Get("Content-Type"))
+		if buf.status != http.StatusOK || mt != "application/json" ||
+			codec.NewDecoderBytes(buf.body.Bytes(), &rpcJsonHandle).Decode(&result) != nil {
+			w.WriteHeader(buf.status)
+			_, _ = w.Write(buf.body.Bytes())
+			return
+		}
+		w.Header().Set("Content-Type", MsgpackContentType)
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusOK)
+		_ = codec.NewEncoder(w, &rpcMsgpackHandle).Encode(result)
+	})
+}
@@ -18,6 +18,7 @@ package node
 
 import (
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"fmt"
 	"io"
@@ -25,6 +26,7 @@ import (
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -40,6 +42,7 @@ type httpConfig struct {
 	CorsAllowedOrigins []string
 	Vhosts             []string
 	prefix             string // path prefix on which to mount http handler
+	jwtSecret          []byte // if set, only the authenticated APIs are served, to the requests signed with it
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
@@ -283,12 +286,26 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig, allowList rpc.
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
 	srv.SetAllowList(allowList)
-	if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
-		return err
+	var handler http.Handler
+	if config.jwtSecret != nil {
+		for _, api := range apis {
+			if !api.Authenticated {
+				continue
+			}
+			if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
+				return err
+			}
+		}
+		handler = newJWTHandler(config.jwtSecret, srv)
+	} else {
+		if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
+			return err
+		}
+		handler = NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts)
 	}
 	h.httpConfig = config
 	h.httpHandler.Store(&rpcHandler{
-		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
+		Handler: handler,
 		server:  srv,
 	})
 	return nil
@@ -370,7 +387,7 @@ func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string) http.
 	// Wrap the CORS-handler within a host-handler
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
-	return newGzipHandler(handler)
+	return newCompressionHandler(handler)
 }
 
 func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
@@ -441,36 +458,86 @@ var gzPool = sync.Pool{
 	},
 }
 
-type gzipResponseWriter struct {
+var zlibPool = sync.Pool{
+	New: func() interface{} {
+		w := zlib.NewWriter(ioutil.Discard)
+		return w
+	},
+}
+
+type compressResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
 }
 
-func (w *gzipResponseWriter) WriteHeader(status int) {
+func (w *compressResponseWriter) WriteHeader(status int) {
 	w.Header().Del("Content-Length")
 	w.ResponseWriter.WriteHeader(status)
 }
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-func newGzipHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
+// negotiateEncoding picks the response compression out of the Accept-Encoding header of the request,
+// respecting the quality values. It returns an empty string if the response must not be compressed
+func negotiateEncoding(acceptEncoding string) string {
+	var best string
+	var bestQ float64
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		encoding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if encoding == "*" {
+			encoding = "gzip"
+		}
+		if encoding != "gzip" && encoding != "deflate" {
+			continue
 		}
+		// gzip wins the ties, since it is listed first by the most clients anyway
+		if q > bestQ || (q == bestQ && q > 0 && encoding == "gzip") {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
 
-		w.Header().Set("Content-Encoding", "gzip")
+func newCompressionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+		case "gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+
+			gz := gzPool.Get().(*gzip.Writer)
+			defer gzPool.Put(gz)
+
+			gz.Reset(w)
+			defer gz.Close()
+
+			next.ServeHTTP(&compressResponseWriter{ResponseWriter: w, Writer: gz}, r)
+		case "deflate":
+			w.Header().Set("Content-Encoding", "deflate")
 
-		gz := gzPool.Get().(*gzip.Writer)
-		defer gzPool.Put(gz)
+			zw := zlibPool.Get().(*zlib.Writer)
+			defer zlibPool.Put(zw)
 
-		gz.Reset(w)
-		defer gz.Close()
+			zw.Reset(w)
+			defer zw.Close()
 
-		next.ServeHTTP(&gzipResponseWriter{ResponseWriter: w, Writer: gz}, r)
+			next.ServeHTTP(&compressResponseWriter{ResponseWriter: w, Writer: zw}, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
 	})
 }
 
@@ -532,6 +599,10 @@ func RegisterApisFromWhitelist(apis []rpc.API, modules []string, srv *rpc.Server
 	}
 	// Register all the APIs exposed by the services
 	for _, api := range apis {
+		// The authenticated APIs are served on the authenticated endpoint only
+		if api.Authenticated && !exposeAll {
+			continue
+		}
 		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
 				return err
@@ -18,9 +18,13 @@ package node
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
@@ -30,6 +34,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/internal/testlog"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ugorji/go/codec"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -231,6 +236,79 @@ func Test_checkPath(t *testing.T) {
 	}
 }
 
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip":                      "gzip",
+		"deflate":                   "deflate",
+		"gzip, deflate, br":         "gzip",
+		"deflate, gzip":             "gzip",
+		"gzip;q=0.5, deflate":       "deflate",
+		"gzip;q=0, deflate;q=0":     "",
+		"*":                         "gzip",
+		"br;q=1.0, DEFLATE;q=0.8":   "deflate",
+		"gzip;q=0.2,deflate;q=0.3 ": "deflate",
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, negotiateEncoding(header), header)
+	}
+}
+
+// TestCompressionHandler makes sure the responses are compressed as negotiated with the client.
+func TestCompressionHandler(t *testing.T) {
+	srv := createAndStartServer(t, &httpConfig{}, false, &wsConfig{})
+	defer srv.stop()
+	url := "http://" + srv.listenAddr()
+
+	for _, encoding := range []string{"gzip", "deflate", "identity"} {
+		resp := rpcRequest(t, url, "accept-encoding", encoding)
+		var body io.Reader = resp.Body
+		switch encoding {
+		case "gzip":
+			assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+			gz, err := gzip.NewReader(resp.Body)
+			assert.NoError(t, err)
+			body = gz
+		case "deflate":
+			assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+			zr, err := zlib.NewReader(resp.Body)
+			assert.NoError(t, err)
+			body = zr
+		default:
+			assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+		}
+		respBody, err := ioutil.ReadAll(body)
+		assert.NoError(t, err)
+		assert.Contains(t, string(respBody), `"jsonrpc":"2.0"`, encoding)
+		resp.Body.Close()
+	}
+}
+
+// TestMsgpackHandler makes sure the responses are transcoded to MessagePack only for the clients asking for it.
+func TestMsgpackHandler(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPHandlerStack(NewMsgpackHandler(rpc.NewServer()), nil, nil))
+	defer srv.Close()
+
+	resp := rpcRequest(t, srv.URL, "accept", "application/json")
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	resp.Body.Close()
+
+	resp = rpcRequest(t, srv.URL, "accept", "application/msgpack", "accept-encoding", "gzip")
+	defer resp.Body.Close()
+	assert.Equal(t, MsgpackContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	gz, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	var result map[string]interface{}
+	assert.NoError(t, codec.NewDecoder(gz, &rpcMsgpackHandle).Decode(&result))
+	assert.Equal(t, "2.0", result["jsonrpc"])
+	assert.EqualValues(t, 1, result["id"])
+	modules, ok := result["result"].(map[interface{}]interface{})
+	assert.True(t, ok, "%T", result["result"])
+	assert.Equal(t, "1.0", modules["rpc"])
+}
+
 func createAndStartServer(t *testing.T, conf *httpConfig, ws bool, wsConf *wsConfig) *httpServer {
 	t.Helper()
 
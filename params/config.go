@@ -18,13 +18,26 @@ package params
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/crypto"
 )
 
+// The names of the preset networks, as selected by --chain
+const (
+	MainnetChainName    = "mainnet"
+	RopstenChainName    = "ropsten"
+	RinkebyChainName    = "rinkeby"
+	GoerliChainName     = "goerli"
+	YoloV3ChainName     = "yolov3"
+	BorMainnetChainName = "bor-mainnet"
+	MumbaiChainName     = "mumbai"
+)
+
 // Genesis hashes to enforce below configs on.
 var (
 	MainnetGenesisHash = common.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
@@ -32,6 +45,9 @@ var (
 	RinkebyGenesisHash = common.HexToHash("0x6341fd3daf94b748c72ced5a5b26028f2474f5f00d824504e4fa37a75767e177")
 	GoerliGenesisHash  = common.HexToHash("0xbf7e331f7f7c1dd2e05159666b3bf8bc7a8a3a9eb1d518969eab529dd9b88c1a")
 	YoloV3GenesisHash  = common.HexToHash("0x374f07cc7fa7c251fc5f36849f574b43db43600526410349efdca2bcea14101a")
+
+	BorMainnetGenesisHash = common.HexToHash("0xa9c28ce2141b56c474f1dc504bee9b01eb1bd7d1a507580d5519d4437a97de1b")
+	MumbaiGenesisHash     = common.HexToHash("0x7b66506a9ebdbf30d32b43c5f15a3b1216269a1ec3a75aa3182b86176a2b1ca7")
 )
 
 // TrustedCheckpoints associates each known checkpoint with the genesis hash of
@@ -239,21 +255,85 @@ var (
 		},
 	}
 
+	// BorMainnetChainConfig contains the chain parameters to run a node on the Polygon main network.
+	BorMainnetChainConfig = &ChainConfig{
+		ChainID:             big.NewInt(137),
+		HomesteadBlock:      big.NewInt(0),
+		DAOForkBlock:        nil,
+		DAOForkSupport:      true,
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(3_395_000),
+		MuirGlacierBlock:    big.NewInt(3_395_000),
+		BerlinBlock:         big.NewInt(14_750_000),
+		LondonBlock:         big.NewInt(23_850_000),
+		Bor: &BorConfig{
+			Period:                2,
+			ProducerDelay:         6,
+			Sprint:                64,
+			BackupMultiplier:      2,
+			ValidatorContract:     common.HexToAddress("0x0000000000000000000000000000000000001000"),
+			StateReceiverContract: common.HexToAddress("0x0000000000000000000000000000000000001001"),
+			// The sprints around the block 14,950,000 committed fewer state sync events than Heimdall has
+			OverrideStateSyncRecords: map[string]int{
+				"14949120": 8,
+				"14949184": 0,
+				"14953472": 0,
+				"14953536": 5,
+				"14953600": 0,
+				"14953664": 0,
+				"14953728": 0,
+				"14953792": 0,
+				"14953856": 0,
+			},
+		},
+	}
+
+	// MumbaiChainConfig contains the chain parameters to run a node on the Mumbai test network of Polygon.
+	MumbaiChainConfig = &ChainConfig{
+		ChainID:             big.NewInt(80001),
+		HomesteadBlock:      big.NewInt(0),
+		DAOForkBlock:        nil,
+		DAOForkSupport:      true,
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(2_722_000),
+		MuirGlacierBlock:    big.NewInt(2_722_000),
+		BerlinBlock:         big.NewInt(13_996_000),
+		LondonBlock:         big.NewInt(22_640_000),
+		Bor: &BorConfig{
+			Period:                2,
+			ProducerDelay:         6,
+			Sprint:                64,
+			BackupMultiplier:      2,
+			ValidatorContract:     common.HexToAddress("0x0000000000000000000000000000000000001000"),
+			StateReceiverContract: common.HexToAddress("0x0000000000000000000000000000000000001001"),
+		},
+	}
+
 	// AllEthashProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Ethash consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, "", new(EthashConfig), nil, nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, "", nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, "", new(EthashConfig), nil, nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -325,14 +405,34 @@ type ChainConfig struct {
 	IstanbulBlock       *big.Int `json:"istanbulBlock,omitempty"`       // Istanbul switch block (nil = no fork, 0 = already on istanbul)
 	MuirGlacierBlock    *big.Int `json:"muirGlacierBlock,omitempty"`    // Eip-2384 (bomb delay) switch block (nil = no fork, 0 = already activated)
 	BerlinBlock         *big.Int `json:"berlinBlock,omitempty"`         // Berlin switch block (nil = no fork, 0 = already on berlin)
+	LondonBlock         *big.Int `json:"londonBlock,omitempty"`         // London switch block (nil = no fork, 0 = already on london)
 
 	YoloV3Block *big.Int `json:"yoloV3Block,omitempty"` // YOLO v3: Gas repricings TODO @holiman add EIP references
 
+	// ExtraEIPs activates the EIPs out of the forks at the given blocks, e.g. to test them on the devnets
+	ExtraEIPs map[int]*big.Int `json:"extraEips,omitempty"`
+
+	// FeeMarket overrides the parameters of the EIP-1559 base fee (nil = the mainnet ones)
+	FeeMarket *FeeMarketConfig `json:"feeMarket,omitempty"`
+
+	// StateCommitment selects the commitment scheme of the state root ("" = the hexary Merkle Patricia trie),
+	// the other schemes are experimental, for the devnets testing them
+	StateCommitment string `json:"stateCommitment,omitempty"`
+
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+	Aura   *AuRaConfig   `json:"aura,omitempty"`
+	Bor    *BorConfig    `json:"bor,omitempty"`
 }
 
+const (
+	// VerkleStateCommitment is the state root committed to by the verkle tree of Pedersen commitments
+	VerkleStateCommitment = "verkle"
+	// BinaryStateCommitment is the state root committed to by the binary trie of the hashed state
+	BinaryStateCommitment = "binary"
+)
+
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
 type EthashConfig struct{}
 
@@ -341,6 +441,21 @@ func (c *EthashConfig) String() string {
 	return "ethash"
 }
 
+// FeeMarketConfig is the EIP-1559 fee market of the chains whose fee market differs from the mainnet one,
+// e.g. L2s and private chains. The parameters left unset are the mainnet ones.
+type FeeMarketConfig struct {
+	Block                    *big.Int `json:"block,omitempty"`                    // Switch block of the parameters, the mainnet ones are used before it (nil = from the London block)
+	ElasticityMultiplier     uint64   `json:"elasticityMultiplier,omitempty"`     // Ratio of the gas limit to the gas target of the block
+	BaseFeeChangeDenominator uint64   `json:"baseFeeChangeDenominator,omitempty"` // Bounds the change of the base fee between blocks to 1/denominator
+	InitialBaseFee           *big.Int `json:"initialBaseFee,omitempty"`           // Base fee of the London block
+}
+
+// String implements the stringer interface.
+func (c *FeeMarketConfig) String() string {
+	return fmt.Sprintf("{Block: %v ElasticityMultiplier: %d BaseFeeChangeDenominator: %d InitialBaseFee: %v}",
+		c.Block, c.ElasticityMultiplier, c.BaseFeeChangeDenominator, c.InitialBaseFee)
+}
+
 // CliqueConfig is the consensus engine configs for proof-of-authority based sealing.
 type CliqueConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
@@ -352,6 +467,67 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// AuRaConfig is the consensus engine configs for the Authority Round of OpenEthereum, the proof-of-authority with
+// the validators taking turns to seal the blocks in the steps of a fixed duration.
+type AuRaConfig struct {
+	StepDuration uint64              `json:"stepDuration"`          // Duration of the step in seconds
+	Validators   *ValidatorSetConfig `json:"validators"`            // Validators taking turns to seal the blocks
+	BlockReward  *big.Int            `json:"blockReward,omitempty"` // Reward of the author of the block (nil = no reward)
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *AuRaConfig) String() string {
+	return "aura"
+}
+
+// BorConfig is the consensus engine configs for Bor of Polygon, the proof-of-stake sealing by the validators of the
+// spans committed from Heimdall, with the producer of the sprint sealing in turn and the others backing it up.
+type BorConfig struct {
+	Period           uint64 `json:"period"`           // Number of seconds between the blocks of a sprint
+	ProducerDelay    uint64 `json:"producerDelay"`    // Number of seconds before the first block of a sprint
+	Sprint           uint64 `json:"sprint"`           // Number of the blocks sealed by the producer in turn
+	BackupMultiplier uint64 `json:"backupMultiplier"` // Number of seconds added to the delay per the succession of a backup producer
+
+	ValidatorContract     common.Address `json:"validatorContract"`     // Genesis contract committing the spans
+	StateReceiverContract common.Address `json:"stateReceiverContract"` // Genesis contract committing the state sync events
+
+	// Number of the state sync events committed by the blocks, overriding the events fetched from Heimdall, by the
+	// block number. They are the records of the chain as it was sealed
+	OverrideStateSyncRecords map[string]int `json:"overrideStateSyncRecords,omitempty"`
+	// Accounts replaced at the blocks, e.g. by the upgrades of the genesis contracts, by the block number
+	BlockAlloc map[string]json.RawMessage `json:"blockAlloc,omitempty"`
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *BorConfig) String() string {
+	return "bor"
+}
+
+// IsSprintStart returns whether the block is the first block of a sprint
+func (c *BorConfig) IsSprintStart(number uint64) bool {
+	return number%c.Sprint == 0
+}
+
+// ValidatorSetConfig is the set of the AuRa validators: the fixed list, the contract returning the list with
+// getValidators(), the contract which also takes the reports of the misbehaviour, or the sets switched to at the
+// blocks. Exactly one of the fields is set
+type ValidatorSetConfig struct {
+	List         []common.Address               `json:"list,omitempty"`
+	SafeContract *common.Address                `json:"safeContract,omitempty"`
+	Contract     *common.Address                `json:"contract,omitempty"`
+	Multi        map[uint64]*ValidatorSetConfig `json:"multi,omitempty"` // Sets by the block after which they apply
+}
+
+// IsVerkle returns whether the state root of the chain is the root of the verkle tree
+func (c *ChainConfig) IsVerkle() bool {
+	return c.StateCommitment == VerkleStateCommitment
+}
+
+// IsBinaryTrie returns whether the state root of the chain is the root of the binary trie
+func (c *ChainConfig) IsBinaryTrie() bool {
+	return c.StateCommitment == BinaryStateCommitment
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -360,10 +536,14 @@ func (c *ChainConfig) String() string {
 		engine = c.Ethash
 	case c.Clique != nil:
 		engine = c.Clique
+	case c.Aura != nil:
+		engine = c.Aura
+	case c.Bor != nil:
+		engine = c.Bor
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, YOLO v3: %v, Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, YOLO v3: %v, Extra EIPs: %v, Fee market: %v, Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -377,7 +557,10 @@ func (c *ChainConfig) String() string {
 		c.IstanbulBlock,
 		c.MuirGlacierBlock,
 		c.BerlinBlock,
+		c.LondonBlock,
 		c.YoloV3Block,
+		c.ExtraEIPs,
+		c.FeeMarket,
 		engine,
 	)
 }
@@ -439,6 +622,66 @@ func (c *ChainConfig) IsBerlin(num *big.Int) bool {
 	return isForked(c.BerlinBlock, num) || isForked(c.YoloV3Block, num)
 }
 
+// IsLondon returns whether num is either equal to the London fork block or greater.
+func (c *ChainConfig) IsLondon(num *big.Int) bool {
+	return isForked(c.LondonBlock, num)
+}
+
+// ActiveExtraEIPs returns the extra EIPs active at block num, in ascending order.
+func (c *ChainConfig) ActiveExtraEIPs(num *big.Int) []int {
+	var eips []int
+	for eip, block := range c.ExtraEIPs {
+		if isForked(block, num) {
+			eips = append(eips, eip)
+		}
+	}
+	sort.Ints(eips)
+	return eips
+}
+
+// feeMarket returns the fee market config in effect at block num, nil if the mainnet parameters are
+func (c *ChainConfig) feeMarket(num *big.Int) *FeeMarketConfig {
+	if c.FeeMarket == nil || (c.FeeMarket.Block != nil && !isForked(c.FeeMarket.Block, num)) {
+		return nil
+	}
+	return c.FeeMarket
+}
+
+// feeMarketBlock returns the switch block of the fee market parameters, nil if the mainnet ones are always used
+func (c *ChainConfig) feeMarketBlock() *big.Int {
+	if c.FeeMarket == nil {
+		return nil
+	}
+	if c.FeeMarket.Block != nil {
+		return c.FeeMarket.Block
+	}
+	return c.LondonBlock
+}
+
+// ElasticityMultiplier returns the ratio of the gas limit to the gas target of block num.
+func (c *ChainConfig) ElasticityMultiplier(num *big.Int) uint64 {
+	if fm := c.feeMarket(num); fm != nil && fm.ElasticityMultiplier != 0 {
+		return fm.ElasticityMultiplier
+	}
+	return ElasticityMultiplier
+}
+
+// BaseFeeChangeDenominator returns the bound of the change of the base fee of block num from the parent one.
+func (c *ChainConfig) BaseFeeChangeDenominator(num *big.Int) uint64 {
+	if fm := c.feeMarket(num); fm != nil && fm.BaseFeeChangeDenominator != 0 {
+		return fm.BaseFeeChangeDenominator
+	}
+	return BaseFeeChangeDenominator
+}
+
+// InitialBaseFee returns the base fee of the London block.
+func (c *ChainConfig) InitialBaseFee() *big.Int {
+	if fm := c.feeMarket(c.LondonBlock); fm != nil && fm.InitialBaseFee != nil {
+		return new(big.Int).Set(fm.InitialBaseFee)
+	}
+	return new(big.Int).SetUint64(InitialBaseFee)
+}
+
 // CheckCompatible checks whether scheduled fork transitions have been imported
 // with a mismatching chain configuration.
 func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
@@ -478,6 +721,7 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		{name: "istanbulBlock", block: c.IstanbulBlock},
 		{name: "muirGlacierBlock", block: c.MuirGlacierBlock, optional: true},
 		{name: "berlinBlock", block: c.BerlinBlock},
+		{name: "londonBlock", block: c.LondonBlock},
 	} {
 		if lastFork.name != "" {
 			// Next one must be higher number
@@ -497,6 +741,14 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.FeeMarket != nil {
+		if c.LondonBlock == nil {
+			return fmt.Errorf("unsupported fee market: londonBlock not enabled")
+		}
+		if c.FeeMarket.Block != nil && c.FeeMarket.Block.Cmp(c.LondonBlock) < 0 {
+			return fmt.Errorf("unsupported fee market: switched at %v, but londonBlock enabled at %v", c.FeeMarket.Block, c.LondonBlock)
+		}
+	}
 	return nil
 }
 
@@ -544,9 +796,34 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.BerlinBlock, newcfg.BerlinBlock, head) {
 		return newCompatError("Berlin fork block", c.BerlinBlock, newcfg.BerlinBlock)
 	}
+	if isForkIncompatible(c.LondonBlock, newcfg.LondonBlock, head) {
+		return newCompatError("London fork block", c.LondonBlock, newcfg.LondonBlock)
+	}
 	if isForkIncompatible(c.YoloV3Block, newcfg.YoloV3Block, head) {
 		return newCompatError("YOLOv3 fork block", c.YoloV3Block, newcfg.YoloV3Block)
 	}
+	eips := make([]int, 0, len(c.ExtraEIPs)+len(newcfg.ExtraEIPs))
+	for eip := range c.ExtraEIPs {
+		eips = append(eips, eip)
+	}
+	for eip := range newcfg.ExtraEIPs {
+		if _, ok := c.ExtraEIPs[eip]; !ok {
+			eips = append(eips, eip)
+		}
+	}
+	sort.Ints(eips)
+	for _, eip := range eips {
+		if isForkIncompatible(c.ExtraEIPs[eip], newcfg.ExtraEIPs[eip], head) {
+			return newCompatError(fmt.Sprintf("EIP%d activation block", eip), c.ExtraEIPs[eip], newcfg.ExtraEIPs[eip])
+		}
+	}
+	// The base fees of the past blocks change if the fee market parameters are switched before the head
+	for _, num := range []*big.Int{c.feeMarketBlock(), newcfg.feeMarketBlock()} {
+		if isForked(num, head) && (c.ElasticityMultiplier(num) != newcfg.ElasticityMultiplier(num) ||
+			c.BaseFeeChangeDenominator(num) != newcfg.BaseFeeChangeDenominator(num) || c.InitialBaseFee().Cmp(newcfg.InitialBaseFee()) != 0) {
+			return newCompatError("Fee market", c.feeMarketBlock(), newcfg.feeMarketBlock())
+		}
+	}
 	return nil
 }
 
@@ -614,7 +891,7 @@ type Rules struct {
 	ChainID                                                 *big.Int
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158               bool
 	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
-	IsBerlin                                                bool
+	IsBerlin, IsLondon                                      bool
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -634,5 +911,6 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 		IsPetersburg:     c.IsPetersburg(num),
 		IsIstanbul:       c.IsIstanbul(num),
 		IsBerlin:         c.IsBerlin(num),
+		IsLondon:         c.IsLondon(num),
 	}
 }
@@ -87,6 +87,50 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{LondonBlock: big.NewInt(10)},
+			new:     &ChainConfig{LondonBlock: big.NewInt(10), FeeMarket: &FeeMarketConfig{Block: big.NewInt(20), ElasticityMultiplier: 4}},
+			head:    15,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{LondonBlock: big.NewInt(10)},
+			new:    &ChainConfig{LondonBlock: big.NewInt(10), FeeMarket: &FeeMarketConfig{Block: big.NewInt(20), ElasticityMultiplier: 4}},
+			head:   25,
+			wantErr: &ConfigCompatError{
+				What:         "Fee market",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(20),
+				RewindTo:     19,
+			},
+		},
+		{
+			stored: &ChainConfig{LondonBlock: big.NewInt(10), FeeMarket: &FeeMarketConfig{BaseFeeChangeDenominator: 16}},
+			new:    &ChainConfig{LondonBlock: big.NewInt(10), FeeMarket: &FeeMarketConfig{BaseFeeChangeDenominator: 32}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "Fee market",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{ExtraEIPs: map[int]*big.Int{2929: big.NewInt(10)}},
+			new:    &ChainConfig{ExtraEIPs: map[int]*big.Int{2929: big.NewInt(20)}},
+			head:   9,
+		},
+		{
+			stored: &ChainConfig{ExtraEIPs: map[int]*big.Int{2929: big.NewInt(10)}},
+			new:    &ChainConfig{ExtraEIPs: map[int]*big.Int{1884: big.NewInt(12), 2929: big.NewInt(10)}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "EIP1884 activation block",
+				StoredConfig: nil,
+				NewConfig:    big.NewInt(12),
+				RewindTo:     11,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,46 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// ChainOverrides reschedules the forks of the chain config at startup, without a custom genesis, to run
+// the shadow forks of the existing chains and the devnets
+type ChainOverrides struct {
+	Config    json.RawMessage  // JSON object with the fields of the chain config to replace, e.g. {"londonBlock": 100}
+	Berlin    *big.Int         // Berlin switch block, applied over Config
+	London    *big.Int         // London switch block, applied over Config
+	ExtraEIPs map[int]*big.Int // Activation blocks of the EIPs out of the forks, added to the configured ones
+}
+
+// Apply returns the copy of the chain config with the overrides, the config itself isn't modified.
+func (o *ChainOverrides) Apply(c *ChainConfig) (*ChainConfig, error) {
+	enc, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(ChainConfig)
+	if err = json.Unmarshal(enc, cfg); err != nil {
+		return nil, err
+	}
+	if len(o.Config) > 0 {
+		if err = json.Unmarshal(o.Config, cfg); err != nil {
+			return nil, fmt.Errorf("invalid chain config overrides: %w", err)
+		}
+	}
+	if o.Berlin != nil {
+		cfg.BerlinBlock = new(big.Int).Set(o.Berlin)
+	}
+	if o.London != nil {
+		cfg.LondonBlock = new(big.Int).Set(o.London)
+	}
+	for eip, block := range o.ExtraEIPs {
+		if cfg.ExtraEIPs == nil {
+			cfg.ExtraEIPs = make(map[int]*big.Int)
+		}
+		cfg.ExtraEIPs[eip] = new(big.Int).Set(block)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,39 @@
+package params
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestChainOverrides(t *testing.T) {
+	overrides := &ChainOverrides{
+		Config:    []byte(`{"berlinBlock": 5, "londonBlock": 7, "extraEips": {"2929": 3}}`),
+		London:    big.NewInt(10),
+		ExtraEIPs: map[int]*big.Int{1884: big.NewInt(4)},
+	}
+	cfg, err := overrides.Apply(MainnetChainConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BerlinBlock.Uint64() != 5 || cfg.LondonBlock.Uint64() != 10 {
+		t.Errorf("forks not overridden: berlin %v, london %v", cfg.BerlinBlock, cfg.LondonBlock)
+	}
+	if cfg.IstanbulBlock.Cmp(MainnetChainConfig.IstanbulBlock) != 0 || cfg.Ethash == nil {
+		t.Errorf("unrelated fields changed: %v", cfg)
+	}
+	if eips := cfg.ActiveExtraEIPs(big.NewInt(4)); !reflect.DeepEqual(eips, []int{1884, 2929}) {
+		t.Errorf("active EIPs mismatch: %v", eips)
+	}
+	if eips := cfg.ActiveExtraEIPs(big.NewInt(3)); !reflect.DeepEqual(eips, []int{2929}) {
+		t.Errorf("active EIPs mismatch: %v", eips)
+	}
+	// The overridden config is a copy
+	if MainnetChainConfig.BerlinBlock.Uint64() == 5 || MainnetChainConfig.ExtraEIPs != nil {
+		t.Errorf("mainnet config modified: %v", MainnetChainConfig)
+	}
+
+	if _, err = (&ChainOverrides{Config: []byte(`{"berlinBlock": "x"}`)}).Apply(MainnetChainConfig); err == nil {
+		t.Errorf("invalid overrides accepted")
+	}
+}
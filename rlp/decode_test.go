@@ -348,6 +348,23 @@ type tailRaw struct {
 	Tail []RawValue `rlp:"tail"`
 }
 
+type optionalFields struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint `rlp:"optional"`
+}
+
+type optionalPtrField struct {
+	A uint
+	B *[3]byte `rlp:"optional"`
+}
+
+type nonOptionalAfterOptional struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint
+}
+
 type tailUint struct {
 	A    uint
 	Tail []uint `rlp:"tail"`
@@ -545,6 +562,42 @@ var decodeTests = []decodeTest{
 		ptr:   new(tailRaw),
 		value: tailRaw{A: 1, Tail: []RawValue{}},
 	},
+	// struct tag "optional"
+	{
+		input: "C101",
+		ptr:   new(optionalFields),
+		value: optionalFields{A: 1},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalFields),
+		value: optionalFields{A: 1, B: 2},
+	},
+	{
+		input: "C3010203",
+		ptr:   new(optionalFields),
+		value: optionalFields{A: 1, B: 2, C: 3},
+	},
+	{
+		input: "C401020304",
+		ptr:   new(optionalFields),
+		error: "rlp: input list has too many elements for rlp.optionalFields",
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalPtrField),
+		value: optionalPtrField{A: 1},
+	},
+	{
+		input: "C50183010203",
+		ptr:   new(optionalPtrField),
+		value: optionalPtrField{A: 1, B: &[3]byte{1, 2, 3}},
+	},
+	{
+		input: "C101",
+		ptr:   new(nonOptionalAfterOptional),
+		error: `rlp: invalid struct tag "" for rlp.nonOptionalAfterOptional.C (must be optional because preceding field is optional)`,
+	},
 	{
 		input: "C3010203",
 		ptr:   new(tailPrivateFields),
@@ -17,6 +17,7 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"reflect"
@@ -25,7 +26,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // handler handles JSON-RPC messages. There is one handler per connection. Note that
@@ -139,6 +144,9 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 		return
 	}
 	h.startCallProc(func(cp *callProc) {
+		if h.handleStreamedCall(cp, msg) {
+			return
+		}
 		answer := h.handleCallMsg(cp, msg)
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
@@ -343,21 +351,15 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
-	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
-
-	// Collect the statistics for RPC calls if metrics is enabled.
+	var answer *jsonrpcMessage
 	// We only care about pure rpc call. Filter out subscription.
-	if callb != h.unsubscribeCb {
-		rpcRequestGauge.Inc(1)
+	h.instrumentCall(cp.ctx, msg.Method, callb != h.unsubscribeCb, func(ctx context.Context) error {
+		answer = h.runMethod(ctx, msg, callb, args)
 		if answer.Error != nil {
-			failedReqeustGauge.Inc(1)
-		} else {
-			successfulRequestGauge.Inc(1)
+			return answer.Error
 		}
-		rpcServingTimer.UpdateSince(start)
-		newRPCServingTimer(msg.Method, answer.Error == nil).UpdateSince(start)
-	}
+		return nil
+	})
 	return answer
 }
 
@@ -394,8 +396,75 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	return h.runMethod(ctx, msg, callb, args)
 }
 
+// handleStreamedCall serves a call to a streaming method by writing its result directly
+// to the connection. It returns false if the message has to be handled the regular way.
+func (h *handler) handleStreamedCall(cp *callProc, msg *jsonrpcMessage) bool {
+	sw, ok := h.conn.(streamWriter)
+	if !ok || !sw.canStream() || !msg.isCall() || msg.isSubscribe() || msg.isUnsubscribe() {
+		return false
+	}
+	if !h.isMethodAllowedByGranularControl(msg.Method) {
+		return false
+	}
+	callb := h.reg.callback(msg.Method)
+	if callb == nil || !callb.streamable {
+		return false
+	}
+	args, err := parsePositionalArguments(msg.Params, callb.argTypes)
+	if err != nil {
+		return false // let the regular path report invalid params
+	}
+	start := time.Now()
+	var callErr, writeErr error
+	h.instrumentCall(cp.ctx, msg.Method, true, func(ctx context.Context) error {
+		writeErr = sw.writeStream(ctx, msg.ID, func(stream *Stream) error {
+			_, callErr = callb.call(ctx, msg.Method, append(args, reflect.ValueOf(stream)))
+			return callErr
+		})
+		if callErr != nil {
+			return callErr
+		}
+		return writeErr
+	})
+	if callErr != nil {
+		h.log.Warn("Served", "method", msg.Method, "reqid", idForLog{msg.ID}, "t", time.Since(start), "err", callErr)
+	} else if writeErr != nil {
+		h.log.Warn("Failed to write streamed response", "method", msg.Method, "reqid", idForLog{msg.ID}, "err", writeErr)
+	}
+	h.log.Debug("Served", "t", time.Since(start), "method", msg.Method, "reqid", idForLog{msg.ID}, "params", string(msg.Params))
+	return true
+}
+
+// instrumentCall runs the call of the method in its trace span and, if collectStats is set,
+// collects the statistics of the call if metrics is enabled.
+func (h *handler) instrumentCall(ctx context.Context, method string, collectStats bool, call func(ctx context.Context) error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "rpc "+method, trace.WithSpanKind(trace.SpanKindServer))
+	endWork := debug.BeginWork("rpc " + method)
+	err := call(ctx)
+	endWork()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	if collectStats {
+		rpcRequestGauge.Inc(1)
+		if err != nil {
+			failedReqeustGauge.Inc(1)
+		} else {
+			successfulRequestGauge.Inc(1)
+		}
+		rpcServingTimer.UpdateSince(start)
+		newRPCServingTimer(method, err == nil).UpdateSince(start)
+	}
+}
+
 // runMethod runs the Go callback for an RPC method.
 func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+	if callb.streamable {
+		return h.runStreamingMethod(ctx, msg, callb, args)
+	}
 	result, err := callb.call(ctx, msg.Method, args)
 	if err != nil {
 		return msg.errorResponse(err)
@@ -403,6 +472,22 @@ func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *cal
 	return msg.response(result)
 }
 
+// runStreamingMethod runs a streaming method when the response can't be written directly
+// to the connection (batches, websocket) and collects the whole result in memory.
+func (h *handler) runStreamingMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+	var buf bytes.Buffer
+	stream := NewStream(&buf)
+	_, err := callb.call(ctx, msg.Method, append(args, reflect.ValueOf(stream)))
+	if err == nil {
+		stream.closeAll()
+		err = stream.Flush()
+	}
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: buf.Bytes()}
+}
+
 // unsubscribe is the callback function for all *_unsubscribe calls.
 func (h *handler) unsubscribe(ctx context.Context, id ID) (bool, error) {
 	h.subLock.Lock()
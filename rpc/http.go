@@ -29,6 +29,8 @@ import (
 	"net/url"
 	"sync"
 	"time"
+
+	"github.com/ledgerwatch/turbo-geth/tracing"
 )
 
 const (
@@ -237,7 +239,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// All checks passed, create a codec that reads directly from the request body
 	// until EOF, writes the response to w, and orders the server to process a
 	// single request.
-	ctx := r.Context()
+	ctx := tracing.Extract(r.Context(), r.Header)
 	ctx = context.WithValue(ctx, "remote", r.RemoteAddr)
 	ctx = context.WithValue(ctx, "scheme", r.Proto)
 	ctx = context.WithValue(ctx, "local", r.Host)
@@ -252,6 +254,10 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	codec := newHTTPServerConn(r, w)
 	defer codec.close()
 	s.serveSingleRequest(ctx, codec)
+	if c, ok := codec.(*jsonCodec); ok && c.aborted() {
+		// The streamed response failed midway, don't let it look complete
+		panic(http.ErrAbortHandler)
+	}
 }
 
 // validateRequest returns a non-zero response code and error message if the
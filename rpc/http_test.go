@@ -21,6 +21,10 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/tracing/tracingtest"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func confirmStatusCode(t *testing.T, got, want int) {
@@ -125,3 +129,102 @@ func TestHTTPRespBodyUnlimited(t *testing.T) {
 		t.Fatalf("response has wrong length %d, want %d", len(r), respLength)
 	}
 }
+
+// This checks that the spans of the calls join the trace propagated in the traceparent header.
+func TestHTTPTraceparent(t *testing.T) {
+	spans := tracingtest.Record(t)
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"test_echo","params":["x",1,{"S":"y"}]}`,
+		`{"jsonrpc":"2.0","id":2,"method":"test_returnError","params":[]}`,
+	} {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		confirmStatusCode(t, resp.StatusCode, http.StatusOK)
+	}
+
+	for _, test := range []struct {
+		name   string
+		status codes.Code
+	}{{"rpc test_echo", codes.Unset}, {"rpc test_returnError", codes.Error}} {
+		found := tracingtest.Find(spans, test.name)
+		if len(found) != 1 {
+			t.Fatalf("%s: got %d spans, want 1", test.name, len(found))
+		}
+		span := found[0]
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("%s: trace id %s, want %s", test.name, span.SpanContext.TraceID(), traceID)
+		}
+		if span.Parent.SpanID().String() != parentID || !span.Parent.IsRemote() {
+			t.Errorf("%s: parent %s (remote %v), want the remote %s", test.name, span.Parent.SpanID(), span.Parent.IsRemote(), parentID)
+		}
+		if span.SpanKind != trace.SpanKindServer {
+			t.Errorf("%s: kind %v, want %v", test.name, span.SpanKind, trace.SpanKindServer)
+		}
+		if span.StatusCode != test.status {
+			t.Errorf("%s: status %v, want %v", test.name, span.StatusCode, test.status)
+		}
+	}
+}
+
+// This checks that the calls without a traceparent header start their own traces.
+func TestHTTPWithoutTraceparent(t *testing.T) {
+	spans := tracingtest.Record(t)
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal(err)
+	}
+	found := tracingtest.Find(spans, "rpc test_noArgsRets")
+	if len(found) != 1 {
+		t.Fatalf("got %d spans, want 1", len(found))
+	}
+	if found[0].Parent.IsValid() {
+		t.Errorf("span has the parent %s, want a root span", found[0].Parent.SpanID())
+	}
+}
+
+// This checks that the calls streamed directly to the connection have their spans too.
+func TestHTTPStreamedTrace(t *testing.T) {
+	spans := tracingtest.Record(t)
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	postJSON(t, ts.URL, `{"jsonrpc":"2.0","id":1,"method":"test_items","params":[3,-1]}`)
+	postJSON(t, ts.URL, `{"jsonrpc":"2.0","id":2,"method":"test_items","params":[3,1]}`)
+
+	found := tracingtest.Find(spans, "rpc test_items")
+	if len(found) != 2 {
+		t.Fatalf("got %d spans, want 2", len(found))
+	}
+	if found[0].StatusCode != codes.Unset {
+		t.Errorf("status %v, want %v", found[0].StatusCode, codes.Unset)
+	}
+	if found[1].StatusCode != codes.Error {
+		t.Errorf("status %v, want %v", found[1].StatusCode, codes.Error)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -164,13 +165,15 @@ type ConnRemoteAddr interface {
 // jsonCodec reads and writes JSON-RPC messages to the underlying connection. It also has
 // support for parsing arguments and serializing (result) objects.
 type jsonCodec struct {
-	remote  string
-	closer  sync.Once                 // close closed channel once
-	closeCh chan interface{}          // closed on Close
-	decode  func(v interface{}) error // decoder to allow multiple transports
-	encMu   sync.Mutex                // guards the encoder
-	encode  func(v interface{}) error // encoder to allow multiple transports
-	conn    deadlineCloser
+	remote   string
+	closer   sync.Once                 // close closed channel once
+	closeCh  chan interface{}          // closed on Close
+	decode   func(v interface{}) error // decoder to allow multiple transports
+	encMu    sync.Mutex                // guards the encoder
+	encode   func(v interface{}) error // encoder to allow multiple transports
+	conn     deadlineCloser
+	w        io.Writer // raw writer for streamed responses, nil if the transport doesn't support them
+	aborting int32     // set when a streamed response is aborted
 }
 
 // NewFuncCodec creates a codec which uses the given functions to read and write. If conn
@@ -195,7 +198,9 @@ func NewCodec(conn Conn) ServerCodec {
 	enc := json.NewEncoder(conn)
 	dec := json.NewDecoder(conn)
 	dec.UseNumber()
-	return NewFuncCodec(conn, enc.Encode, dec.Decode)
+	codec := NewFuncCodec(conn, enc.Encode, dec.Decode).(*jsonCodec)
+	codec.w = conn
+	return codec
 }
 
 func (c *jsonCodec) remoteAddr() string {
@@ -232,6 +237,83 @@ func (c *jsonCodec) writeJSON(ctx context.Context, v interface{}) error {
 	return c.encode(v)
 }
 
+func (c *jsonCodec) canStream() bool {
+	return c.w != nil
+}
+
+// writeStream writes the response to request id, letting fn produce the result directly
+// on the connection. fn runs without holding the encoder, it is acquired only when the
+// first chunk of the response reaches the connection and held until the response is
+// complete. If fn fails before anything reached the connection, a regular error response
+// is sent. Otherwise the response can't be turned into an error response anymore, it is
+// aborted and the connection is closed, so the client doesn't take the partial result
+// for a complete one.
+func (c *jsonCodec) writeStream(ctx context.Context, id json.RawMessage, fn func(*Stream) error) error {
+	w := &streamConnWriter{c: c, ctx: ctx}
+	defer w.release()
+
+	stream := NewStream(w)
+	stream.write([]byte(`{"jsonrpc":"2.0","id":`))
+	stream.write(id)
+	stream.write([]byte(`,"result":`))
+	err := fn(stream)
+	if err == nil {
+		err = stream.Err()
+	}
+	if err != nil && !stream.flushed() {
+		resp := errorMessage(err)
+		resp.ID = id
+		return c.writeJSON(ctx, resp)
+	}
+	if err != nil {
+		c.abort()
+		return err
+	}
+	stream.closeAll()
+	stream.write([]byte("}\n"))
+	return stream.Flush()
+}
+
+// streamConnWriter writes the streamed response to the connection, acquiring the encoder
+// of the codec on the first write
+type streamConnWriter struct {
+	c      *jsonCodec
+	ctx    context.Context
+	locked bool
+}
+
+func (w *streamConnWriter) Write(p []byte) (int, error) {
+	if !w.locked {
+		w.c.encMu.Lock()
+		w.locked = true
+		deadline, ok := w.ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(defaultWriteTimeout)
+		}
+		w.c.conn.SetWriteDeadline(deadline)
+	}
+	return w.c.w.Write(p)
+}
+
+func (w *streamConnWriter) release() {
+	if w.locked {
+		w.c.encMu.Unlock()
+		w.locked = false
+	}
+}
+
+// abort closes the connection in the middle of a response, see aborted
+func (c *jsonCodec) abort() {
+	atomic.StoreInt32(&c.aborting, 1)
+	c.close()
+}
+
+// aborted reports whether a response was aborted. The HTTP server aborts the whole HTTP
+// response then, closing the connection doesn't interrupt it.
+func (c *jsonCodec) aborted() bool {
+	return atomic.LoadInt32(&c.aborting) == 1
+}
+
 func (c *jsonCodec) close() {
 	c.closer.Do(func() {
 		close(c.closeCh)
@@ -56,6 +56,7 @@ type callback struct {
 	hasCtx      bool           // method's first argument is a context (not included in argTypes)
 	errPos      int            // err return idx, of -1 when method cannot return error
 	isSubscribe bool           // true if this is a subscription callback
+	streamable  bool           // method's last argument is a *Stream (not included in argTypes)
 }
 
 func (r *serviceRegistry) registerName(name string, rcvr interface{}) error {
@@ -173,9 +174,14 @@ func (c *callback) makeArgTypes() {
 		c.hasCtx = true
 		firstArg++
 	}
+	lastArg := fntype.NumIn()
+	if lastArg > firstArg && fntype.In(lastArg-1) == streamType {
+		c.streamable = true
+		lastArg--
+	}
 	// Add all remaining parameters.
-	c.argTypes = make([]reflect.Type, fntype.NumIn()-firstArg)
-	for i := firstArg; i < fntype.NumIn(); i++ {
+	c.argTypes = make([]reflect.Type, lastArg-firstArg)
+	for i := firstArg; i < lastArg; i++ {
 		c.argTypes[i-firstArg] = fntype.In(i)
 	}
 }
@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+const streamBufferSize = 64 * 1024
+
+var streamType = reflect.TypeOf((*Stream)(nil))
+
+// Stream is an incremental JSON writer for the results of RPC methods which produce
+// very large responses (logs, traces, state dumps).
+//
+// A method opts in by declaring `*rpc.Stream` as its last argument and returning only
+// an error. Instead of materialising the whole result, the method writes it piece by
+// piece while iterating over its cursors:
+//
+//	func (api *MyAPI) Items(ctx context.Context, from uint64, stream *rpc.Stream) error {
+//		stream.BeginArray()
+//		for ... {
+//			if err := stream.Value(item); err != nil {
+//				return err
+//			}
+//		}
+//		stream.EndArray()
+//		return nil
+//	}
+//
+// On connections which support it (HTTP, IPC, in-process) the result is written to the
+// wire as soon as the internal buffer fills up. On other connections (websocket) and for
+// batch requests the result is collected into memory and sent as a regular response.
+type Stream struct {
+	w       *bufio.Writer
+	counter *countingWriter
+	frames  []streamFrame
+	keyed   bool // key of an object field was written, its value is expected next
+	written bool // a top-level value was written
+	err     error
+}
+
+type streamFrame struct {
+	object bool
+	first  bool
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// NewStream creates a stream writing into w. RPC methods receive their streams from the
+// server, this constructor is meant for in-process callers and tests.
+func NewStream(w io.Writer) *Stream {
+	counter := &countingWriter{w: w}
+	return &Stream{w: bufio.NewWriterSize(counter, streamBufferSize), counter: counter}
+}
+
+// BeginArray opens a JSON array as the next value
+func (s *Stream) BeginArray() { s.begin('[', false) }
+
+// EndArray closes the innermost JSON array
+func (s *Stream) EndArray() { s.end(']') }
+
+// BeginObject opens a JSON object as the next value
+func (s *Stream) BeginObject() { s.begin('{', true) }
+
+// EndObject closes the innermost JSON object
+func (s *Stream) EndObject() { s.end('}') }
+
+// Key writes the name of the next field of the innermost object, it must be followed by a value
+func (s *Stream) Key(name string) {
+	s.separate()
+	enc, err := json.Marshal(name)
+	if err != nil {
+		s.setErr(err)
+		return
+	}
+	s.write(enc)
+	s.writeByte(':')
+	s.keyed = true
+}
+
+// Field writes a complete field of the innermost object
+func (s *Stream) Field(name string, v interface{}) error {
+	s.Key(name)
+	return s.Value(v)
+}
+
+// Value writes a JSON-encoded value as the next array element, field value or top-level result
+func (s *Stream) Value(v interface{}) error {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		s.setErr(err)
+		return err
+	}
+	s.separate()
+	s.write(enc)
+	return s.err
+}
+
+// Flush writes the buffered data to the underlying writer
+func (s *Stream) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.setErr(s.w.Flush())
+	return s.err
+}
+
+// Err returns the first error which happened while writing the stream
+func (s *Stream) Err() error { return s.err }
+
+func (s *Stream) begin(c byte, object bool) {
+	s.separate()
+	s.writeByte(c)
+	s.frames = append(s.frames, streamFrame{object: object, first: true})
+}
+
+func (s *Stream) end(c byte) {
+	if len(s.frames) == 0 {
+		return
+	}
+	s.frames = s.frames[:len(s.frames)-1]
+	s.writeByte(c)
+}
+
+// separate writes a comma before every array element or object field except the first one
+func (s *Stream) separate() {
+	if s.keyed {
+		s.keyed = false
+		return
+	}
+	if len(s.frames) == 0 {
+		s.written = true
+		return
+	}
+	top := &s.frames[len(s.frames)-1]
+	if !top.first {
+		s.writeByte(',')
+	}
+	top.first = false
+}
+
+// closeAll terminates all the open containers, so the written data stays a valid JSON value
+func (s *Stream) closeAll() {
+	if s.keyed {
+		s.write(null)
+		s.keyed = false
+	}
+	for len(s.frames) > 0 {
+		if s.frames[len(s.frames)-1].object {
+			s.EndObject()
+		} else {
+			s.EndArray()
+		}
+	}
+	if !s.written {
+		s.Value(nil) //nolint:errcheck
+	}
+}
+
+// flushed reports whether any part of the stream has reached the underlying writer
+func (s *Stream) flushed() bool { return s.counter.n > 0 }
+
+func (s *Stream) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	_, err := s.w.Write(p)
+	s.setErr(err)
+}
+
+func (s *Stream) writeByte(c byte) {
+	if s.err != nil {
+		return
+	}
+	s.setErr(s.w.WriteByte(c))
+}
+
+func (s *Stream) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type itemsResult struct {
+	Items []echoResult `json:"items"`
+	Count int          `json:"count"`
+}
+
+func postJSON(t *testing.T, url, body string) []byte {
+	t.Helper()
+	resp, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStream(&buf)
+	s.BeginObject()
+	s.Field("a", 1) //nolint:errcheck
+	s.Key("b")
+	s.BeginArray()
+	s.Value("x") //nolint:errcheck
+	s.BeginObject()
+	s.EndObject()
+	s.Value(nil) //nolint:errcheck
+	s.EndArray()
+	s.Field("c", true) //nolint:errcheck
+	s.EndObject()
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":1,"b":["x",{},null],"c":true}`; buf.String() != want {
+		t.Fatalf("wrong output: got %s, want %s", buf.String(), want)
+	}
+
+	buf.Reset()
+	s = NewStream(&buf)
+	s.BeginArray()
+	s.BeginObject()
+	s.Key("open")
+	s.closeAll()
+	s.Flush() //nolint:errcheck
+	if want := `[{"open":null}]`; buf.String() != want {
+		t.Fatalf("wrong output after closeAll: got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestStreamedHTTPResponse(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// Large enough to be flushed several times while being produced
+	n := 20000
+	resp := postJSON(t, ts.URL, `{"jsonrpc":"2.0","id":1,"method":"test_items","params":[20000,-1]}`)
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if msg.Error != nil {
+		t.Fatalf("unexpected error: %v", msg.Error)
+	}
+	var res itemsResult
+	if err := json.Unmarshal(msg.Result, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != n || len(res.Items) != n || res.Items[n-1].Int != n-1 {
+		t.Fatalf("wrong result: count %d, items %d", res.Count, len(res.Items))
+	}
+
+	// Failure before anything was flushed produces a regular error response
+	resp = postJSON(t, ts.URL, `{"jsonrpc":"2.0","id":2,"method":"test_items","params":[10,5]}`)
+	msg = jsonrpcMessage{}
+	if err := json.Unmarshal(resp, &msg); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if msg.Error == nil || msg.Error.Code != 444 || msg.Result != nil {
+		t.Fatalf("expected error response, got %s", resp)
+	}
+
+	// Failure after part of the result was sent aborts the response
+	httpResp, err := http.Post(ts.URL, contentType, strings.NewReader(`{"jsonrpc":"2.0","id":3,"method":"test_items","params":[20000,15000]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if _, err = ioutil.ReadAll(httpResp.Body); err == nil {
+		t.Fatal("the aborted response is read completely")
+	}
+}
+
+func TestStreamedBatchAndClient(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp := postJSON(t, ts.URL, `[{"jsonrpc":"2.0","id":1,"method":"test_items","params":[3,-1]},{"jsonrpc":"2.0","id":2,"method":"test_items","params":[3,1]}]`)
+	var msgs []jsonrpcMessage
+	if err := json.Unmarshal(resp, &msgs); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Error != nil || msgs[1].Error == nil {
+		t.Fatalf("wrong batch response: %s", resp)
+	}
+
+	client := DialInProc(server)
+	defer client.Close()
+	var res itemsResult
+	if err := client.Call(&res, "test_items", 100, -1); err != nil {
+		t.Fatal(err)
+	}
+	if res.Count != 100 || len(res.Items) != 100 {
+		t.Fatalf("wrong result: count %d, items %d", res.Count, len(res.Items))
+	}
+	if err := client.Call(&res, "test_items", 100, 50); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestStreamedCallDoesNotBlockConnection(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	go client.Call(nil, "test_stall") //nolint:errcheck
+	<-stalled
+	done := make(chan error, 1)
+	go func() {
+		var res echoResult
+		done <- client.Call(&res, "test_echo", "x", 1)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response is blocked by the streamed call")
+	}
+}
+
+func TestStreamedClientAborted(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var res json.RawMessage
+	if err := client.Call(&res, "test_items", 20000, 15000); err == nil {
+		t.Fatalf("expected error, got %d bytes", len(res))
+	}
+}
@@ -110,6 +110,41 @@ func (s *testService) ReturnError() error {
 	return testError{}
 }
 
+// Items streams n items, failing after failAt items if failAt is not negative
+func (s *testService) Items(n, failAt int, stream *Stream) error {
+	stream.BeginObject()
+	stream.Key("items")
+	stream.BeginArray()
+	for i := 0; i < n; i++ {
+		if i == failAt {
+			return testError{}
+		}
+		if err := stream.Value(echoResult{String: "item", Int: i}); err != nil {
+			return err
+		}
+	}
+	stream.EndArray()
+	if err := stream.Field("count", n); err != nil {
+		return err
+	}
+	stream.EndObject()
+	return nil
+}
+
+// stalled receives a value when Stall begins streaming its result
+var stalled = make(chan struct{}, 1)
+
+// Stall begins streaming its result and blocks until the context is canceled
+func (s *testService) Stall(ctx context.Context, stream *Stream) error {
+	stream.BeginArray()
+	select {
+	case stalled <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 func (s *testService) CallMeBack(ctx context.Context, method string, args []interface{}) (interface{}, error) {
 	c, ok := ClientFromContext(ctx)
 	if !ok {
@@ -34,6 +34,8 @@ type API struct {
 	Version   string      // api version for DApp's
 	Service   interface{} // receiver instance which holds the methods
 	Public    bool        // indication if the methods must be considered safe for public use
+	// indication if the methods are served only on the authenticated endpoint, e.g. the engine API
+	Authenticated bool
 }
 
 // Error wraps RPC errors, which contain an error code in addition to the message.
@@ -67,6 +69,12 @@ type jsonWriter interface {
 	remoteAddr() string
 }
 
+// streamWriter is implemented by connections which can write a response while it is produced
+type streamWriter interface {
+	canStream() bool
+	writeStream(ctx context.Context, id json.RawMessage, fn func(*Stream) error) error
+}
+
 type BlockNumber int64
 
 const (
@@ -220,3 +228,24 @@ func BlockNumberOrHashWithHash(hash common.Hash, canonical bool) BlockNumberOrHa
 		RequireCanonical: canonical,
 	}
 }
+
+// DecimalOrHex unmarshals a non-negative decimal or hex parameter into a uint64.
+type DecimalOrHex uint64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (dh *DecimalOrHex) UnmarshalJSON(data []byte) error {
+	input := strings.TrimSpace(string(data))
+	if len(input) >= 2 && input[0] == '"' && input[len(input)-1] == '"' {
+		input = input[1 : len(input)-1]
+	}
+
+	value, err := strconv.ParseUint(input, 10, 64)
+	if err != nil {
+		value, err = hexutil.DecodeUint64(input)
+	}
+	if err != nil {
+		return err
+	}
+	*dh = DecimalOrHex(value)
+	return nil
+}
@@ -0,0 +1,177 @@
+package dbutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// Fuzz implements a go-fuzz fuzzer method to test the encoding and the parsing of the composite keys against the
+// dbutils.KeyLayouts. The first byte selects the helper, the rest is its input
+func Fuzz(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	input := data[1:]
+	switch data[0] % 5 {
+	case 0:
+		return fuzzPlainStorageKey(input)
+	case 1:
+		return fuzzHashedStorageKey(input)
+	case 2:
+		return fuzzStorageChangeSet(input)
+	case 3:
+		return fuzzTimestamp(input)
+	default:
+		return fuzzSplit(input)
+	}
+}
+
+func split(key []byte, bucket, kind string) [][]byte {
+	fields, err := dbutils.FindKeyLayout(bucket, kind).Split(key)
+	if err != nil {
+		panic(err)
+	}
+	return fields
+}
+
+// fuzzPlainStorageKey checks the round trip of the storage keys of the plain state, and their history chunk keys
+func fuzzPlainStorageKey(input []byte) int {
+	if len(input) < common.AddressLength+common.IncarnationLength+common.HashLength+8 {
+		return 0
+	}
+	address := common.BytesToAddress(input[:common.AddressLength])
+	incarnation := binary.BigEndian.Uint64(input[common.AddressLength:])
+	slot := common.BytesToHash(input[common.AddressLength+common.IncarnationLength : common.AddressLength+common.IncarnationLength+common.HashLength])
+	blockNum := binary.BigEndian.Uint64(input[common.AddressLength+common.IncarnationLength+common.HashLength:])
+
+	key := dbutils.PlainGenerateCompositeStorageKey(address[:], incarnation, slot[:])
+	a, inc, s := dbutils.PlainParseCompositeStorageKey(key)
+	if a != address || inc != incarnation || s != slot {
+		panic(fmt.Sprintf("plain storage key %x parsed as %x %d %x", key, a, inc, s))
+	}
+	fields := split(key, dbutils.PlainStateBucket, "storage")
+	if !bytes.Equal(fields[0], address[:]) || binary.BigEndian.Uint64(fields[1]) != incarnation || !bytes.Equal(fields[2], slot[:]) {
+		panic(fmt.Sprintf("plain storage key %x does not match its layout", key))
+	}
+	chunkKey := dbutils.IndexChunkKey(key, blockNum)
+	fields = split(chunkKey, dbutils.StorageHistoryBucket, "")
+	if !bytes.Equal(fields[0], address[:]) || !bytes.Equal(fields[1], slot[:]) || binary.BigEndian.Uint64(fields[2]) != blockNum {
+		panic(fmt.Sprintf("storage history chunk key %x does not match its layout", chunkKey))
+	}
+	if !bytes.HasPrefix(chunkKey, dbutils.CompositeKeyWithoutIncarnation(key)) {
+		panic(fmt.Sprintf("storage history chunk key %x is not prefixed by the key without the incarnation", chunkKey))
+	}
+	return 1
+}
+
+// fuzzHashedStorageKey checks the round trip of the storage keys of the hashed state
+func fuzzHashedStorageKey(input []byte) int {
+	if len(input) < common.HashLength+common.IncarnationLength+common.HashLength {
+		return 0
+	}
+	addrHash := common.BytesToHash(input[:common.HashLength])
+	incarnation := binary.BigEndian.Uint64(input[common.HashLength:])
+	slotHash := common.BytesToHash(input[common.HashLength+common.IncarnationLength : common.HashLength+common.IncarnationLength+common.HashLength])
+
+	key := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, slotHash)
+	h, inc, s := dbutils.ParseCompositeStorageKey(key)
+	if h != addrHash || inc != incarnation || s != slotHash {
+		panic(fmt.Sprintf("hashed storage key %x parsed as %x %d %x", key, h, inc, s))
+	}
+	fields := split(key, dbutils.HashedStorageBucket, "")
+	if !bytes.Equal(fields[0], addrHash[:]) || binary.BigEndian.Uint64(fields[1]) != incarnation || !bytes.Equal(fields[2], slotHash[:]) {
+		panic(fmt.Sprintf("hashed storage key %x does not match its layout", key))
+	}
+	return 1
+}
+
+// fuzzStorageChangeSet checks the round trip of the storage changes through the database format of the changesets
+func fuzzStorageChangeSet(input []byte) int {
+	const keySize = common.AddressLength + common.IncarnationLength + common.HashLength
+	if len(input) < 8+keySize {
+		return 0
+	}
+	blockNum := binary.BigEndian.Uint64(input)
+	input = input[8:]
+	cs := changeset.NewStorageChangeSetPlain()
+	expected := make(map[string][]byte)
+	for len(input) >= keySize+1 {
+		key := input[:keySize]
+		valueLen := int(input[keySize]) % (common.HashLength + 1)
+		input = input[keySize+1:]
+		if valueLen > len(input) {
+			valueLen = len(input)
+		}
+		value := input[:valueLen]
+		input = input[valueLen:]
+		if _, ok := expected[string(key)]; ok {
+			continue
+		}
+		if err := cs.Add(key, value); err != nil {
+			panic(err)
+		}
+		expected[string(key)] = value
+	}
+	fromDBFormat := changeset.FromDBFormat(common.AddressLength)
+	decoded := 0
+	if err := changeset.EncodeStoragePlain(blockNum, cs, func(k, v []byte) error {
+		fields := split(k, dbutils.PlainStorageChangeSetBucket, "")
+		if binary.BigEndian.Uint64(fields[0]) != blockNum {
+			panic(fmt.Sprintf("storage changeset key %x of block %d", k, blockNum))
+		}
+		n, key, value := fromDBFormat(k, v)
+		if n != blockNum {
+			panic(fmt.Sprintf("storage change %x decoded at block %d instead of %d", key, n, blockNum))
+		}
+		if !bytes.Equal(value, expected[string(key)]) {
+			panic(fmt.Sprintf("storage change %x decoded as %x instead of %x", key, value, expected[string(key)]))
+		}
+		decoded++
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+	if decoded != len(expected) {
+		panic(fmt.Sprintf("%d storage changes decoded instead of %d", decoded, len(expected)))
+	}
+	return 1
+}
+
+// fuzzTimestamp checks the round trip and the order of the encoded timestamps
+func fuzzTimestamp(input []byte) int {
+	if len(input) < 16 {
+		return 0
+	}
+	// The timestamps are below 2^53
+	a, b := binary.BigEndian.Uint64(input)>>11, binary.BigEndian.Uint64(input[8:])>>11
+	encA, encB := dbutils.EncodeTimestamp(a), dbutils.EncodeTimestamp(b)
+	if decoded, rest := dbutils.DecodeTimestamp(append(encA, input[16:]...)); decoded != a || !bytes.Equal(rest, input[16:]) {
+		panic(fmt.Sprintf("timestamp %d decoded as %d", a, decoded))
+	}
+	if c := bytes.Compare(encA, encB); (a < b && c >= 0) || (a == b && c != 0) || (a > b && c <= 0) {
+		panic(fmt.Sprintf("the encodings of the timestamps %d and %d are not in their order", a, b))
+	}
+	return 1
+}
+
+// fuzzSplit checks that the fields of the keys of every layout join back into the key
+func fuzzSplit(input []byte) int {
+	for _, l := range dbutils.KeyLayouts {
+		fields, err := l.Split(input)
+		if err != nil {
+			if len(input) == l.Size() {
+				panic(err)
+			}
+			continue
+		}
+		if joined := bytes.Join(fields, nil); !bytes.Equal(joined, input) {
+			panic(fmt.Sprintf("key %x of %s split into %x", input, l.Bucket, fields))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,17 @@
+package dbutils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestFuzzRandomInputs runs the fuzzer on the random inputs of all its helpers, replicate a crasher by passing
+// its data to Fuzz
+func TestFuzzRandomInputs(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		data := make([]byte, 1+rnd.Intn(256))
+		rnd.Read(data)
+		Fuzz(data)
+	}
+}
@@ -0,0 +1,67 @@
+// Package tracing exports the OpenTelemetry spans of the node to an OTLP collector. Until Setup is called the spans
+// are no-ops, so the instrumented code doesn't pay for the tracing it doesn't export
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ledgerwatch/turbo-geth"
+
+// Tracer is the tracer of the node, it follows the provider installed by Setup
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span, the child of the span of the context if there is one
+func Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// Setup exports the spans to the OTLP gRPC endpoint (host:port), sampling the given fraction of the traces the node
+// starts, the traces started by the callers which propagate their context (e.g. with the traceparent header of the
+// RPC requests) follow the decision of the caller. The returned function flushes the buffered spans and stops the export
+func Setup(ctx context.Context, endpoint string, serviceName string, ratio float64) (func(context.Context) error, error) {
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(otlpgrpc.WithEndpoint(endpoint), otlpgrpc.WithInsecure()))
+	if err != nil {
+		return nil, fmt.Errorf("creating the OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// End ends the span, marking it failed with the error if there is one
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Extract returns the context with the remote span propagated in the headers of the request, e.g. in traceparent
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
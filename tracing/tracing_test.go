@@ -0,0 +1,49 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/tracing"
+	"github.com/ledgerwatch/turbo-geth/tracing/tracingtest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExtract(t *testing.T) {
+	tracingtest.Record(t)
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	remote := trace.SpanContextFromContext(tracing.Extract(context.Background(), header))
+	require.True(t, remote.IsValid())
+	require.True(t, remote.IsRemote())
+	require.True(t, remote.IsSampled())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", remote.TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", remote.SpanID().String())
+
+	// A malformed header is ignored, the spans start their own traces
+	header.Set("traceparent", "00-not-a-trace-01")
+	require.False(t, trace.SpanContextFromContext(tracing.Extract(context.Background(), header)).IsValid())
+}
+
+func TestEnd(t *testing.T) {
+	spans := tracingtest.Record(t)
+	_, span := tracing.Start(context.Background(), "ok")
+	tracing.End(span, nil)
+	_, span = tracing.Start(context.Background(), "failed")
+	tracing.End(span, errors.New("boom"))
+
+	ok := tracingtest.Find(spans, "ok")
+	require.Len(t, ok, 1)
+	require.Equal(t, codes.Unset, ok[0].StatusCode)
+	require.Empty(t, ok[0].MessageEvents)
+
+	failed := tracingtest.Find(spans, "failed")
+	require.Len(t, failed, 1)
+	require.Equal(t, codes.Error, failed[0].StatusCode)
+	require.Equal(t, "boom", failed[0].StatusMessage)
+	require.Len(t, failed[0].MessageEvents, 1) // the recorded error
+}
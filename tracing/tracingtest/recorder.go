@@ -0,0 +1,49 @@
+// Package tracingtest records the spans of the node in memory for the tests of the instrumented code
+package tracingtest
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Record installs a provider sampling and recording every span until the end of the test, the spans are in the
+// returned exporter as soon as they end
+func Record(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		// The global provider can't be reinstalled, the spans started after the test are dropped instead
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagator)
+	})
+	return exporter
+}
+
+// Find returns the recorded spans with the name, in the order they ended
+func Find(exporter *tracetest.InMemoryExporter, name string) []*sdktrace.SpanSnapshot {
+	var spans []*sdktrace.SpanSnapshot
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// Attribute returns the value of the attribute of the span, and whether the span has it
+func Attribute(span *sdktrace.SpanSnapshot, key string) (interface{}, bool) {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.AsInterface(), true
+		}
+	}
+	return nil, false
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/codecache"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
@@ -97,12 +98,16 @@ func (r *StateReader) ReadAccountCode(address common.Address, incarnation uint64
 	if bytes.Equal(codeHash[:], crypto.Keccak256(nil)) {
 		return nil, nil
 	}
+	if code, ok := codecache.Shared.Code(codeHash); ok {
+		return code, nil
+	}
 	var val []byte
 	v, err := r.tx.GetOne(dbutils.CodeBucket, codeHash[:])
 	if err != nil {
 		return nil, err
 	}
 	val = common.CopyBytes(v)
+	codecache.Shared.AddCode(codeHash, val)
 	return val, nil
 }
 
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// writeChangesets writes the changesets of the account and of its storage slot changed in every block, whose
+// values are the number of the block
+func writeChangesets(t *testing.T, db ethdb.Database, blocks uint64) (addr, slot []byte) {
+	addr = common.HexToAddress("0x1000").Bytes()
+	slot = dbutils.PlainGenerateCompositeStorageKey(addr, 1, common.HexToHash("0x01").Bytes())
+	for n := uint64(0); n < blocks; n++ {
+		value := dbutils.EncodeBlockNumber(n)
+		for bucket, key := range map[string][]byte{dbutils.PlainAccountChangeSetBucket: addr, dbutils.PlainStorageChangeSetBucket: slot} {
+			csInfo := changeset.Mapper[bucket]
+			cs := csInfo.New()
+			if err := cs.Add(key, value); err != nil {
+				t.Fatal(err)
+			}
+			if err := csInfo.Encode(n, cs, func(k, v []byte) error {
+				return db.Put(bucket, k, v)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return addr, slot
+}
+
+func TestArchive(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	addr, slot := writeChangesets(t, db, ChunkBlocks+10)
+
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiver := &Archiver{store: store, threshold: 5}
+	// The second chunk isn't older than the threshold yet
+	for i := 0; i < 2; i++ {
+		if err = archiver.Archive("test", db, ChunkBlocks+9, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, bucket := range Buckets {
+		if progress, _ := stages.GetPruneProgress(db, bucket); progress != ChunkBlocks {
+			t.Errorf("%s: prune progress %d instead of %d", bucket, progress, ChunkBlocks)
+		}
+		var first uint64
+		if err = db.Walk(bucket, nil, 0, func(k, _ []byte) (bool, error) {
+			first = binary.BigEndian.Uint64(k)
+			return false, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if first != ChunkBlocks {
+			t.Errorf("%s: the first kept changeset is of block %d instead of %d", bucket, first, ChunkBlocks)
+		}
+	}
+
+	reader, err := NewReader(store, t.TempDir(), 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for _, n := range []uint64{0, 1, ChunkBlocks / 2, ChunkBlocks - 1} {
+		for bucket, key := range map[string][]byte{dbutils.PlainAccountChangeSetBucket: addr, dbutils.PlainStorageChangeSetBucket: slot} {
+			tx, err := reader.Changesets(bucket, n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := tx.CursorDupSort(bucket)
+			var v []byte
+			if bucket == dbutils.PlainStorageChangeSetBucket {
+				v, err = changeset.Mapper[bucket].WalkerAdapter(c).(changeset.StorageChangeSetPlain).FindWithIncarnation(n, key)
+			} else {
+				v, err = changeset.Mapper[bucket].WalkerAdapter(c).Find(n, key)
+			}
+			c.Close()
+			tx.Rollback()
+			if err != nil {
+				t.Fatalf("%s of block %d: %v", bucket, n, err)
+			}
+			if !bytes.Equal(v, dbutils.EncodeBlockNumber(n)) {
+				t.Errorf("%s of block %d: archived %x", bucket, n, v)
+			}
+		}
+	}
+	if _, err = reader.Changesets(dbutils.PlainAccountChangeSetBucket, ChunkBlocks); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the chunk not archived, got %v", err)
+	}
+}
+
+func TestNewArchiverThreshold(t *testing.T) {
+	store, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewArchiver(store, 10); err == nil {
+		t.Error("expected the threshold lower than the immutability threshold to be refused")
+	}
+}
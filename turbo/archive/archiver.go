@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// ChunkBlocks is the number of the blocks whose changesets are archived in one object
+const ChunkBlocks = 10_000
+
+// Buckets are the buckets of the changesets the archiver moves into the store
+var Buckets = []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket}
+
+// ChunkName is the name of the object of the changesets of the bucket of the chunk of the blocks from the given one
+func ChunkName(bucket string, from uint64) string {
+	return fmt.Sprintf("%s/%012d.gz", bucket, from)
+}
+
+// chunkFrom is the first block of the chunk of the block
+func chunkFrom(blockNum uint64) uint64 {
+	return blockNum - blockNum%ChunkBlocks
+}
+
+// chunkBuckets is the configuration of the buckets of the chunk, only the one of its changesets
+func chunkBuckets(bucket string) ethdb.BucketConfigsFunc {
+	return func(defaultBuckets dbutils.BucketsCfg) dbutils.BucketsCfg {
+		return dbutils.BucketsCfg{bucket: defaultBuckets[bucket]}
+	}
+}
+
+// Archiver moves the changesets of the blocks older than the threshold out of the database into the store, in the
+// chunks of ChunkBlocks blocks. The history indices keep pointing at the archived changesets, the lookups of the
+// history fetch them with Reader
+type Archiver struct {
+	store     Store
+	threshold uint64
+}
+
+// NewArchiver creates the archiver of the changesets older than threshold blocks. The threshold can not be lower
+// than params.FullImmutabilityThreshold, the changesets are needed by the unwinds
+func NewArchiver(store Store, threshold uint64) (*Archiver, error) {
+	if threshold < params.FullImmutabilityThreshold {
+		return nil, fmt.Errorf("changesets archive threshold %d is lower than the immutability threshold %d", threshold, params.FullImmutabilityThreshold)
+	}
+	return &Archiver{store: store, threshold: threshold}, nil
+}
+
+// Archive uploads the changesets of the next chunk of the blocks if all of them are older than the threshold relative
+// to the head, and deletes them from the database. At most one chunk is archived per call, so that the sync cycle is
+// not held for long. The chunk is uploaded before the changesets are deleted, the deletion and the prune progress of
+// the buckets are committed with the transaction of the database. If they are lost, the chunk is uploaded again by
+// the next call
+func (a *Archiver) Archive(logPrefix string, db ethdb.Database, head uint64, quit <-chan struct{}) error {
+	from, err := stages.GetPruneProgress(db, dbutils.PlainAccountChangeSetBucket)
+	if err != nil {
+		return err
+	}
+	if from+ChunkBlocks-1+a.threshold > head {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	var size int
+	for _, bucket := range Buckets {
+		data, err := encodeChunk(db, bucket, from, quit)
+		if err != nil {
+			return fmt.Errorf("[%s] encoding %s of blocks %d-%d: %w", logPrefix, bucket, from, from+ChunkBlocks, err)
+		}
+		if err = a.store.Put(ctx, ChunkName(bucket, from), data); err != nil {
+			return fmt.Errorf("[%s] uploading %s of blocks %d-%d: %w", logPrefix, bucket, from, from+ChunkBlocks, err)
+		}
+		size += len(data)
+	}
+	var tx ethdb.DbWithPendingMutations
+	var useExternalTx bool
+	if hasTx, ok := db.(ethdb.HasTx); ok && hasTx.Tx() != nil {
+		tx = db.(ethdb.DbWithPendingMutations)
+		useExternalTx = true
+	} else {
+		if tx, err = db.Begin(context.Background(), ethdb.RW); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+	for _, bucket := range Buckets {
+		if err = deleteChunk(tx.(ethdb.HasTx).Tx().(ethdb.RwTx), bucket, from, quit); err != nil {
+			return err
+		}
+		if err = stages.SavePruneProgress(tx, bucket, from+ChunkBlocks); err != nil {
+			return err
+		}
+	}
+	if !useExternalTx {
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	log.Info(fmt.Sprintf("[%s] Archived changesets", logPrefix), "from", from, "to", from+ChunkBlocks, "size", common.StorageSize(size), "in", time.Since(start))
+	return nil
+}
+
+// encodeChunk returns the changesets of the bucket of the chunk of the blocks, as the gzipped content of the mem
+// database saved by MemKV.Save
+func encodeChunk(db ethdb.Database, bucket string, from uint64, quit <-chan struct{}) ([]byte, error) {
+	mem, err := ethdb.NewMem().WithBucketsConfig(chunkBuckets(bucket)).Open()
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+	if err = mem.Update(context.Background(), func(tx ethdb.RwTx) error {
+		c := tx.RwCursorDupSort(bucket)
+		defer c.Close()
+		return db.Walk(bucket, dbutils.EncodeBlockNumber(from), 0, func(k, v []byte) (bool, error) {
+			if err := common.Stopped(quit); err != nil {
+				return false, err
+			}
+			if binary.BigEndian.Uint64(k) >= from+ChunkBlocks {
+				return false, nil
+			}
+			return true, c.Put(common.CopyBytes(k), common.CopyBytes(v))
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err = mem.(*ethdb.MemKV).Save(w); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeChunk loads the chunk encoded by encodeChunk into the mem database
+func decodeChunk(bucket string, data []byte) (ethdb.KV, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	mem, err := ethdb.NewMem().WithBucketsConfig(chunkBuckets(bucket)).ReadOnly().Open()
+	if err != nil {
+		return nil, err
+	}
+	if err = mem.(*ethdb.MemKV).Load(r); err != nil {
+		mem.Close()
+		return nil, err
+	}
+	return mem, nil
+}
+
+// deleteChunk deletes the changesets of the bucket of the chunk of the blocks from the database
+func deleteChunk(tx ethdb.RwTx, bucket string, from uint64, quit <-chan struct{}) error {
+	c := tx.RwCursorDupSort(bucket)
+	defer c.Close()
+	for k, _, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil; k, _, err = c.NextNoDup() {
+		if err != nil {
+			return err
+		}
+		if err = common.Stopped(quit); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint64(k) >= from+ChunkBlocks {
+			break
+		}
+		if err = c.DeleteCurrentDuplicates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// DefaultMemChunks is the number of the decoded chunks the reader keeps in memory by default
+const DefaultMemChunks = 16
+
+// fetchTimeout bounds the download of a chunk, the historical query waits for it
+const fetchTimeout = 5 * time.Minute
+
+// Reader fetches the chunks of the changesets archived by Archiver lazily, when a lookup of the history needs the
+// changesets of a pruned block. The downloaded chunks are cached in the directory up to its size limit, the least
+// recently used ones are removed beyond it, and the last decoded chunks are kept in memory. It implements
+// ethdb.ChangesetArchive
+type Reader struct {
+	store    Store
+	dir      string            // the cache of the downloaded chunks, none if empty
+	dirLimit datasize.ByteSize // the size of the cache directory
+
+	chunks *lru.Cache // ChunkName -> the decoded chunk, ethdb.KV
+
+	lock     sync.Mutex
+	fetching map[string]*fetch // the chunks being fetched, so that the concurrent lookups download them once
+}
+
+// fetch is the download of a chunk, shared by the lookups which need it
+type fetch struct {
+	done chan struct{}
+	kv   ethdb.KV
+	err  error
+}
+
+// NewReader creates the reader of the store, with the cache of the downloaded chunks in the directory of the given
+// size, none if dir is empty, and memChunks decoded chunks in memory, DefaultMemChunks if zero
+func NewReader(store Store, dir string, dirLimit datasize.ByteSize, memChunks int) (*Reader, error) {
+	if memChunks <= 0 {
+		memChunks = DefaultMemChunks
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	chunks, err := lru.NewWithEvict(memChunks, func(_, kv interface{}) {
+		go kv.(ethdb.KV).Close() // waits for the transactions of the chunk
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{store: store, dir: dir, dirLimit: dirLimit, chunks: chunks, fetching: map[string]*fetch{}}, nil
+}
+
+// Changesets returns the read-only transaction of the archived changesets of the bucket which include the ones of
+// the block, the caller rolls it back
+func (r *Reader) Changesets(bucket string, blockNum uint64) (ethdb.Tx, error) {
+	name := ChunkName(bucket, chunkFrom(blockNum))
+	kv, err := r.chunk(name, bucket)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := kv.Begin(context.Background())
+	if err != nil {
+		// The chunk was evicted and closed meanwhile, it's fetched again
+		if kv, err = r.chunk(name, bucket); err != nil {
+			return nil, err
+		}
+		return kv.Begin(context.Background())
+	}
+	return tx, nil
+}
+
+// Close drops the decoded chunks, the cache directory is kept
+func (r *Reader) Close() {
+	r.chunks.Purge()
+}
+
+func (r *Reader) chunk(name, bucket string) (ethdb.KV, error) {
+	if kv, ok := r.chunks.Get(name); ok {
+		return kv.(ethdb.KV), nil
+	}
+	r.lock.Lock()
+	f, ok := r.fetching[name]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		r.fetching[name] = f
+	}
+	r.lock.Unlock()
+	if ok {
+		<-f.done
+		return f.kv, f.err
+	}
+
+	f.kv, f.err = r.fetch(name, bucket)
+	if f.err == nil {
+		r.chunks.Add(name, f.kv)
+	}
+	r.lock.Lock()
+	delete(r.fetching, name)
+	r.lock.Unlock()
+	close(f.done)
+	return f.kv, f.err
+}
+
+// fetch reads the chunk from the cache directory, or downloads it from the store into the cache
+func (r *Reader) fetch(name, bucket string) (ethdb.KV, error) {
+	if data, ok := r.readCached(name); ok {
+		kv, err := decodeChunk(bucket, data)
+		if err == nil {
+			return kv, nil
+		}
+		log.Warn("Cached changesets chunk is corrupt, downloading it again", "chunk", name, "err", err)
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	data, err := r.store.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	kv, err := decodeChunk(bucket, data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding the archived chunk %s: %w", name, err)
+	}
+	log.Debug("Fetched archived changesets", "chunk", name, "size", datasize.ByteSize(len(data)).HR(), "in", time.Since(start))
+	r.writeCached(name, data)
+	return kv, nil
+}
+
+func (r *Reader) cachePath(name string) string {
+	return filepath.Join(r.dir, strings.ReplaceAll(name, "/", "_"))
+}
+
+func (r *Reader) readCached(name string) ([]byte, bool) {
+	if r.dir == "" {
+		return nil, false
+	}
+	path := r.cachePath(name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now) // the modification time orders the eviction
+	return data, true
+}
+
+// writeCached saves the downloaded chunk into the cache directory and removes the least recently used chunks
+// beyond its size limit. The cache is best effort, its failures are only logged
+func (r *Reader) writeCached(name string, data []byte) {
+	if r.dir == "" || datasize.ByteSize(len(data)) > r.dirLimit {
+		return
+	}
+	path := r.cachePath(name)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		log.Warn("Caching the changesets chunk failed", "chunk", name, "err", err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		log.Warn("Caching the changesets chunk failed", "chunk", name, "err", err)
+		return
+	}
+
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		log.Warn("Listing the cached changesets chunks failed", "err", err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	var size datasize.ByteSize
+	for _, f := range files {
+		if size += datasize.ByteSize(f.Size()); size > r.dirLimit {
+			_ = os.Remove(filepath.Join(r.dir, f.Name()))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// defaultS3Region is the region of the S3 compatible storage which doesn't have the regions, e.g. MinIO
+const defaultS3Region = "us-east-1"
+
+// s3Store keeps the objects in the bucket of the S3 compatible storage, under the prefix
+type s3Store struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func newS3Store(u *url.URL) (*s3Store, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("no bucket in the archive %s", u)
+	}
+	q := u.Query()
+	cfg := aws.NewConfig().WithRegion(defaultS3Region)
+	if region := q.Get("region"); region != "" {
+		cfg = cfg.WithRegion(region)
+	}
+	if endpoint := q.Get("endpoint"); endpoint != "" {
+		cfg = cfg.WithEndpoint(endpoint)
+	}
+	if q.Get("pathStyle") == "true" {
+		cfg = cfg.WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{client: s3.New(sess), bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+func (s *s3Store) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *s3Store) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, name string) ([]byte, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Store.Get if there is no object of the name
+var ErrNotFound = errors.New("archived object not found")
+
+// Store is the object storage the chunks of the changesets are archived into
+type Store interface {
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// OpenStore opens the store of the URL: s3://bucket/prefix for the S3 compatible storage, with the optional
+// endpoint, region and pathStyle parameters, e.g. s3://chain/mainnet?endpoint=http://minio:9000&pathStyle=true, or
+// file:///path, or just the path, for a directory, e.g. on a network filesystem. The credentials of S3 are read
+// by the default chain of the AWS SDK: the environment, the shared credentials file, the role of the instance
+func OpenStore(rawurl string) (Store, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		return newS3Store(u)
+	case "file":
+		return newDirStore(u.Path)
+	case "":
+		return newDirStore(rawurl)
+	}
+	return nil, fmt.Errorf("unsupported archive %s, expected s3://bucket/prefix or a directory", rawurl)
+}
+
+// dirStore keeps the objects in the files of the directory
+type dirStore struct {
+	dir string
+}
+
+func newDirStore(dir string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func (s *dirStore) path(name string) (string, error) {
+	if strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid object name %s", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+// Put writes the file atomically: into the temporary file first, which then replaces it
+func (s *dirStore) Put(_ context.Context, name string, data []byte) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *dirStore) Get(_ context.Context, name string) ([]byte, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return data, err
+}
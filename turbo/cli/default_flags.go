@@ -9,6 +9,7 @@ import (
 // DefaultFlags contains all flags that are used and supported by turbo-geth binary.
 var DefaultFlags = []cli.Flag{
 	utils.DataDirFlag,
+	utils.ShutdownTimeoutFlag,
 	utils.EthashDatasetDirFlag,
 	utils.TxPoolLocalsFlag,
 	utils.TxPoolNoLocalsFlag,
@@ -20,6 +21,7 @@ var DefaultFlags = []cli.Flag{
 	utils.TxPoolGlobalSlotsFlag,
 	utils.TxPoolAccountQueueFlag,
 	utils.TxPoolGlobalQueueFlag,
+	utils.TxPoolAccountQueueSizeFlag,
 	utils.TxPoolLifetimeFlag,
 	utils.TxLookupLimitFlag,
 	StorageModeFlag,
@@ -30,9 +32,27 @@ var DefaultFlags = []cli.Flag{
 	BatchSizeFlag,
 	DatabaseFlag,
 	PrivateApiAddr,
+	AuthRPCAddrFlag,
+	AuthRPCPortFlag,
+	JWTSecretFlag,
 	EtlBufferSizeFlag,
+	MemLimitFlag,
+	TrieValidateEveryFlag,
 	LMDBMapSizeFlag,
 	LMDBMaxFreelistReuseFlag,
+	DBDurabilityFlag,
+	DBBulkDurabilityFlag,
+	DBReadTxWarnFlag,
+	DBStatsIntervalFlag,
+	DBMaxSizeFlag,
+	DBInitialSizeFlag,
+	DBGrowthStepFlag,
+	DBPageSizeFlag,
+	DBSpaceWarnFlag,
+	DBAutoGrowFlag,
+	DBReadTxLimitFlag,
+	DBColdDirFlag,
+	DBColdBucketsFlag,
 	TLSFlag,
 	TLSCertFlag,
 	TLSKeyFlag,
@@ -45,6 +65,15 @@ var DefaultFlags = []cli.Flag{
 	utils.NodeKeyFileFlag,
 	utils.NodeKeyHexFlag,
 	utils.DNSDiscoveryFlag,
+	utils.SnapServeFlag,
+	utils.HeimdallURLFlag,
+	utils.WithoutHeimdallFlag,
+	utils.ExternalConsensusFlag,
+	utils.OverrideBerlinFlag,
+	utils.OverrideLondonFlag,
+	utils.OverrideEIPsFlag,
+	utils.OverrideConfigFlag,
+	utils.ChainFlag,
 	utils.RopstenFlag,
 	utils.RinkebyFlag,
 	utils.GoerliFlag,
@@ -61,6 +90,24 @@ var DefaultFlags = []cli.Flag{
 	utils.MetricsPortFlag,
 	utils.IdentityFlag,
 	SilkwormFlag,
+	DiffT8nFlag,
+	ExecutionProofsFlag,
+	ExecutionProofSignersFlag,
+	StateReadCacheFlag,
+	StatePrefetchFlag,
+	ExecutionParallelFlag,
+	CodeCacheSizeFlag,
+	AncientThresholdFlag,
+	ChangesetsArchiveFlag,
+	ChangesetsArchiveThresholdFlag,
+	ChangesetsArchiveCacheFlag,
+	RetentionFlag,
+	PruneReceiptsFlag,
+	SlotWatchConfigFlag,
+	SlotWatchWebhookFlag,
+	StallThresholdFlag,
+	StallKeepFlag,
+	LiveConfigFlag,
 	utils.MiningEnabledFlag,
 	utils.MinerNotifyFlag,
 	utils.MinerGasTargetFlag,
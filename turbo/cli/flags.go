@@ -3,11 +3,13 @@ package cli
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/c2h5oh/datasize"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/common/etl"
 	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/node"
@@ -19,7 +21,7 @@ import (
 var (
 	DatabaseFlag = cli.StringFlag{
 		Name:  "database",
-		Usage: "Which database software to use? Currently supported values: lmdb|mdbx",
+		Usage: "Which database software to use? Currently supported values: lmdb|mdbx|rocksdb|mem, mdbx and rocksdb are compiled in with the build tags of their names, mem keeps the chain in memory and saves it into chaindata/mem.dat at the exit",
 		Value: "lmdb",
 	}
 	CacheSizeFlag = cli.StringFlag{
@@ -37,6 +39,15 @@ var (
 		Usage: "Buffer size for ETL operations.",
 		Value: etl.BufferOptimalSize.String(),
 	}
+	MemLimitFlag = cli.StringFlag{
+		Name:  "mem.limit",
+		Usage: "Memory limit for the buffers of the sync stages, when exceeded they are spilled to disk or shrunk. 0 means no limit",
+		Value: "0",
+	}
+	TrieValidateEveryFlag = cli.Uint64Flag{
+		Name:  "trie.validateEvery",
+		Usage: "Recompute the state root without the intermediate hashes every that many blocks, and regenerate them if it differs. 0 means never",
+	}
 
 	PrivateApiAddr = cli.StringFlag{
 		Name:  "private.api.addr",
@@ -50,12 +61,34 @@ var (
 		Value: 500,
 	}
 
+	AuthRPCAddrFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Host interface of the authenticated HTTP RPC server serving the engine API to the consensus client, empty string means not to start the server",
+		Value: "",
+	}
+
+	AuthRPCPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Port of the authenticated HTTP RPC server",
+		Value: node.DefaultAuthPort,
+	}
+
+	JWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path of the hex encoded secret the tokens of the authenticated HTTP RPC requests are signed with, generated if it doesn't exist. jwt.hex in the data directory by default",
+		Value: "",
+	}
+
 	StorageModeFlag = cli.StringFlag{
 		Name: "storage-mode",
 		Usage: `Configures the storage mode of the app:
 * h - write history to the DB
 * r - write receipts to the DB
-* t - write tx lookup index to the DB`,
+* t - write tx lookup index to the DB
+* w - write the stateless witnesses of the blocks to the DB
+* p - write the keccak preimages of the addresses and the storage keys to the DB, for debug_preimage
+* k - maintain the rankings of the accounts by the balance and by the code size, for tg_accountsByBalance and tg_accountsByCodeSize
+* e - index the ERC-20 and ERC-721 transfers of the addresses, for tg_getTokenTransfers, needs r`,
 		Value: ethdb.DefaultStorageMode.ToString(),
 	}
 	SnapshotModeFlag = cli.StringFlag{
@@ -90,6 +123,72 @@ var (
 		Value: ethdb.LMDBDefaultMaxFreelistReuse,
 	}
 
+	DBDurabilityFlag = cli.StringFlag{
+		Name: "db.durability",
+		Usage: `Fsync policy of the database commits, only MDBX supports the levels other than paranoid:
+* paranoid - every commit is synced, nothing committed is lost on a crash of the OS or a power loss
+* safe - the data is synced on every commit, the meta page with the next one: the last commit may be lost
+* fast - the commits are synced every 5 seconds: the commits of the last 5 seconds may be lost
+* unsafe - nothing is synced until the database is closed: the database may be corrupted
+A crash of the process alone loses nothing at any level`,
+		Value: ethdb.DefaultDurability.String(),
+	}
+	DBBulkDurabilityFlag = cli.StringFlag{
+		Name:  "db.durability.bulk",
+		Usage: "Fsync policy of the database commits while the sync is far behind the head, e.g. fast or unsafe for the initial sync (default = the same as --db.durability)",
+	}
+	DBReadTxWarnFlag = cli.DurationFlag{
+		Name:  "db.readtx.warn",
+		Usage: "Log the read transactions of the database open for longer, with the stack of their holder",
+		Value: ethdb.DefaultReadTxWarn,
+	}
+	DBStatsIntervalFlag = cli.DurationFlag{
+		Name:  "db.stats.interval",
+		Usage: "Interval of persisting the key counts and the sizes of the buckets of the database, served by debug_dbStats and printed by `integration db_stats` to chart the growth of the database (0 disables)",
+		Value: time.Hour,
+	}
+	DBMaxSizeFlag = cli.StringFlag{
+		Name:  "db.maxSize",
+		Usage: "Max size of the database file, the writes fail beyond it unless --db.autoGrow raises it (default = --lmdb.mapSize)",
+	}
+	DBInitialSizeFlag = cli.StringFlag{
+		Name:  "db.initialSize",
+		Usage: "Size the new database file is created of, only MDBX supports it",
+	}
+	DBGrowthStepFlag = cli.StringFlag{
+		Name:  "db.growthStep",
+		Usage: "Step the database file grows by, only MDBX supports it",
+		Value: ethdb.DefaultGrowthStep.String(),
+	}
+	DBPageSizeFlag = cli.StringFlag{
+		Name:  "db.pageSize",
+		Usage: "Page size of the new database, a power of 2 from 256B to 64KB, only MDBX supports it. The page size of the existing database can't be changed",
+		Value: ethdb.DefaultPageSize.String(),
+	}
+	DBSpaceWarnFlag = cli.StringFlag{
+		Name:  "db.space.warn",
+		Usage: "Log the space left to the database (before its max size or before the disk fills up) below it, as an error below a fifth of it (0 disables)",
+		Value: "32GB",
+	}
+	DBAutoGrowFlag = cli.StringFlag{
+		Name:  "db.autoGrow",
+		Usage: "Step of raising the max size of the database online when the space left to it is below --db.space.warn and the disk has room, only MDBX supports it (0 disables)",
+		Value: "256GB",
+	}
+	DBReadTxLimitFlag = cli.DurationFlag{
+		Name:  "db.readtx.limit",
+		Usage: "Abort the read transactions of the database open for longer, their reads fail (default = never)",
+	}
+	DBColdDirFlag = cli.StringFlag{
+		Name:  "datadir.cold",
+		Usage: "Directory of the cold databases keeping the history buckets of --datadir.cold.buckets, e.g. on the cheap storage while the state stays on NVMe in --datadir. The buckets written before have to be moved with `integration move_buckets`",
+	}
+	DBColdBucketsFlag = cli.StringFlag{
+		Name:  "datadir.cold.buckets",
+		Usage: "Comma separated buckets kept in --datadir.cold",
+		Value: strings.Join(ethdb.DefaultColdBuckets, ","),
+	}
+
 	// mTLS flags
 	TLSFlag = cli.BoolFlag{
 		Name:  "tls",
@@ -115,6 +214,95 @@ var (
 		Usage: "File path of libsilkworm_tg_api dynamic library (default = do not use Silkworm)",
 		Value: "",
 	}
+	DiffT8nFlag = cli.StringFlag{
+		Name:  "diff.t8n",
+		Usage: "File path of an `evm t8n` compatible binary (e.g. go-ethereum's evm) to re-execute every block with, the sync halts if the results diverge (default = no differential checks)",
+		Value: "",
+	}
+	ExecutionProofsFlag = cli.StringFlag{
+		Name:  "execution.proofs",
+		Usage: "Directory of the execution proofs, the ranges of the blocks they cover are fast-forwarded by applying their changesets instead of executing the blocks, the receipts of those blocks are not written. Import the proofs with the `execution_proof_import` command of the snapshots generator (default = execute all the blocks)",
+		Value: "",
+	}
+	StateReadCacheFlag = cli.IntFlag{
+		Name:  "state.readcache",
+		Usage: "Number of the accounts the execution stage keeps in the cache of the recently read state between the blocks, with the room for 4 times as many storage slots. The cache hits are counted in the state/readcache/* metrics (default = no cache)",
+		Value: 0,
+	}
+	StatePrefetchFlag = cli.BoolFlag{
+		Name:  "state.prefetch",
+		Usage: "Read the accounts, the code and the storage touched by the transactions of the next block (the senders, the recipients and the access lists) while the execution stage executes the current one, into the cache of --state.readcache when following the tip",
+	}
+	ExecutionParallelFlag = cli.IntFlag{
+		Name:  "execution.parallel",
+		Usage: "Experimental: number of the workers executing the transactions of every block in parallel, the transactions reading the accounts changed by the earlier ones in the block are executed again serially. The merged and the re-executed transactions are counted in the chain/execution/parallel/* metrics (default = serial execution)",
+		Value: 0,
+	}
+	CodeCacheSizeFlag = cli.StringFlag{
+		Name:  "codecache.size",
+		Usage: "Size of the cache of the contract code and its JUMPDEST analysis shared by the execution, the tracing and the calls, keyed by the code hash. The cache hits are counted in the codecache/* metrics (0 disables the cache)",
+		Value: "64MB",
+	}
+	ExecutionProofSignersFlag = cli.StringFlag{
+		Name:  "execution.proofs.signers",
+		Usage: "Comma separated list of the addresses of the trusted signers of the execution proofs",
+		Value: "",
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "ancient.threshold",
+		Usage: "Move the blocks older than this number of blocks out of the database into the immutable segment files in <datadir>/tg/ancient, it can not be lower than 90000 (default = 0, keep all the blocks in the database)",
+		Value: 0,
+	}
+	ChangesetsArchiveFlag = cli.StringFlag{
+		Name:  "changesets.archive",
+		Usage: "Archive of the old changesets: s3://bucket/prefix for the S3 compatible storage (the optional parameters: endpoint, region, pathStyle=true, the credentials are read by the AWS SDK from the environment), or a directory. The lookups of the history fetch the archived changesets lazily (default = no archive)",
+		Value: "",
+	}
+	ChangesetsArchiveThresholdFlag = cli.Uint64Flag{
+		Name:  "changesets.archive.threshold",
+		Usage: "Move the changesets older than this number of blocks out of the database into --changesets.archive, in the chunks of 10000 blocks, it can not be lower than 90000 (default = 0, only read the archive)",
+		Value: 0,
+	}
+	ChangesetsArchiveCacheFlag = cli.StringFlag{
+		Name:  "changesets.archive.cache",
+		Usage: "Size of the cache of the changesets fetched from --changesets.archive, in <datadir>/tg/changesets-cache",
+		Value: "4GB",
+	}
+	RetentionFlag = cli.StringFlag{
+		Name:  "retention",
+		Usage: "Comma separated list of the retention windows in the form bucket=blocks, only the records of the last blocks are kept in the buckets, the older ones are deleted at the end of every cycle. Supported buckets: r (receipts), log, block_witness (default = keep everything)",
+		Value: "",
+	}
+	PruneReceiptsFlag = cli.Uint64Flag{
+		Name:  "prune.receipts",
+		Usage: "Keep the receipts and the logs of only this number of the last blocks, the same as --retention r=N,log=N. The rpcdaemon regenerates the pruned receipts by re-executing their blocks, which needs the history of the state (default = 0, keep all the receipts)",
+		Value: 0,
+	}
+	SlotWatchConfigFlag = cli.StringFlag{
+		Name:  "slotwatch.config",
+		Usage: "JSON file of the watched storage slots: [{\"name\", \"contract\", \"slot\", \"condition\": \"above|below|equals|notEquals\", \"value\"}]. The alerts are logged, counted in the slotwatch/* metrics and posted to --slotwatch.webhook when the conditions start or stop holding (default = no watches)",
+		Value: "",
+	}
+	SlotWatchWebhookFlag = cli.StringFlag{
+		Name:  "slotwatch.webhook",
+		Usage: "URL the alerts of the storage slot watches are posted to as JSON",
+		Value: "",
+	}
+	StallThresholdFlag = cli.DurationFlag{
+		Name:  "stall.threshold",
+		Usage: "Capture the goroutine, heap and CPU profiles into <datadir>/tg/stalls when a stage run, an unwind or an RPC call takes longer than this. During the initial sync the stages legitimately run for hours, so set it above that or once the node is synced, e.g. with --config.live (default = 0, disabled)",
+		Value: 0,
+	}
+	StallKeepFlag = cli.IntFlag{
+		Name:  "stall.keep",
+		Usage: "Number of the last stalls the profiles are kept of in <datadir>/tg/stalls",
+		Value: 10,
+	}
+	LiveConfigFlag = cli.StringFlag{
+		Name:  "config.live",
+		Usage: "JSON file of the settings changed while the node runs, e.g. {\"verbosity\": 4, \"txpool.globalslots\": 8192}. It is applied at the start, on SIGHUP and on admin_reloadConfig, the changes are logged and appended to <datadir>/tg/live_config_audit.log. Settings: verbosity, vmodule, stall.threshold, retention, rpc.gascap, rpc.txfeecap, txpool.pricelimit, txpool.accountslots, txpool.globalslots, txpool.accountqueue, txpool.globalqueue, txpool.lifetime",
+		Value: "",
+	}
 )
 
 func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -129,6 +317,9 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 	}
 	cfg.SnapshotMode = snMode
 	cfg.SnapshotSeeding = ctx.GlobalBool(SeedSnapshotsFlag.Name)
+	cfg.DBStatsInterval = ctx.GlobalDuration(DBStatsIntervalFlag.Name)
+	cfg.DBSpaceWarn = sizeFlag(ctx, DBSpaceWarnFlag)
+	cfg.DBAutoGrow = sizeFlag(ctx, DBAutoGrowFlag)
 
 	if ctx.GlobalString(CacheSizeFlag.Name) != "" {
 		err := cfg.CacheSize.UnmarshalText([]byte(ctx.GlobalString(CacheSizeFlag.Name)))
@@ -155,6 +346,10 @@ func ApplyFlagsForEthConfig(ctx *cli.Context, cfg *ethconfig.Config) {
 		}
 		etl.BufferOptimalSize = *size
 	}
+	if ctx.GlobalString(MemLimitFlag.Name) != "" {
+		setMemLimit(ctx.GlobalString(MemLimitFlag.Name))
+	}
+	stagedsync.ValidateTrieEvery = ctx.GlobalUint64(TrieValidateEveryFlag.Name)
 
 	cfg.ExternalSnapshotDownloaderAddr = ctx.GlobalString(ExternalSnapshotDownloaderAddrFlag.Name)
 }
@@ -200,19 +395,41 @@ func ApplyFlagsForEthConfigCobra(f *pflag.FlagSet, cfg *ethconfig.Config) {
 		}
 		etl.BufferOptimalSize = *size
 	}
+	if v := f.String(MemLimitFlag.Name, MemLimitFlag.Value, MemLimitFlag.Usage); v != nil {
+		setMemLimit(*v)
+	}
+	if v := f.Uint64(TrieValidateEveryFlag.Name, TrieValidateEveryFlag.Value, TrieValidateEveryFlag.Usage); v != nil {
+		stagedsync.ValidateTrieEvery = *v
+	}
 
 	if v := f.String(ExternalSnapshotDownloaderAddrFlag.Name, ExternalSnapshotDownloaderAddrFlag.Value, ExternalSnapshotDownloaderAddrFlag.Usage); v != nil {
 		cfg.ExternalSnapshotDownloaderAddr = *v
 	}
 }
 
+// setMemLimit sets the limit of the memory shared by the buffers of the stages
+func setMemLimit(limit string) {
+	var size datasize.ByteSize
+	if err := size.UnmarshalText([]byte(limit)); err != nil {
+		utils.Fatalf("Invalid mem.limit provided: %v", err)
+	}
+	if size != 0 && size < etl.BufferOptimalSize {
+		log.Warn("Memory limit is lower than the ETL buffer size, the buffers will be spilled to disk early", "mem.limit", size.HumanReadable(), "etl.bufferSize", etl.BufferOptimalSize.HumanReadable())
+	}
+	etl.Memory.SetLimit(size)
+}
+
 func ApplyFlagsForNodeConfig(ctx *cli.Context, cfg *node.Config) {
 
 	setPrivateApi(ctx, cfg)
+	setAuthRPC(ctx, cfg)
 
 	databaseFlag := ctx.GlobalString(DatabaseFlag.Name)
-	cfg.MDBX = strings.EqualFold(databaseFlag, "mdbx") //case insensitive
-	cfg.LMDB = strings.EqualFold(databaseFlag, "lmdb") //case insensitive
+	if !ethdb.HasBackend(databaseFlag) {
+		utils.Fatalf("Database %s is not compiled in, available: %s", databaseFlag, strings.Join(ethdb.Backends(), ", "))
+	}
+	cfg.Database = strings.ToLower(databaseFlag)
+	cfg.LMDB = cfg.Database == "lmdb"
 	if cfg.LMDB && ctx.GlobalString(LMDBMapSizeFlag.Name) != "" {
 		err := cfg.LMDBMapSize.UnmarshalText([]byte(ctx.GlobalString(LMDBMapSizeFlag.Name)))
 		if err != nil {
@@ -230,6 +447,15 @@ func ApplyFlagsForNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		}
 	}
 
+	setDurability(ctx, cfg)
+	setGeometry(ctx, cfg)
+	cfg.ReadTxWarn = ctx.GlobalDuration(DBReadTxWarnFlag.Name)
+	cfg.ReadTxLimit = ctx.GlobalDuration(DBReadTxLimitFlag.Name)
+	if cold := ctx.GlobalString(DBColdDirFlag.Name); cold != "" {
+		cfg.ColdDataDir = cold
+		cfg.ColdBuckets = strings.Split(ctx.GlobalString(DBColdBucketsFlag.Name), ",")
+	}
+
 	if cfg.LMDB {
 		cfg.LMDBMaxFreelistReuse = ctx.GlobalUint(LMDBMaxFreelistReuseFlag.Name)
 		if cfg.LMDBMaxFreelistReuse < 16 {
@@ -241,6 +467,57 @@ func ApplyFlagsForNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setDurability populates the fsync policies of the database
+func setDurability(ctx *cli.Context, cfg *node.Config) {
+	var err error
+	if cfg.Durability, err = ethdb.DurabilityFromString(ctx.GlobalString(DBDurabilityFlag.Name)); err != nil {
+		utils.Fatalf("Invalid %s: %v", DBDurabilityFlag.Name, err)
+	}
+	cfg.BulkDurability = cfg.Durability
+	if bulk := ctx.GlobalString(DBBulkDurabilityFlag.Name); bulk != "" {
+		if cfg.BulkDurability, err = ethdb.DurabilityFromString(bulk); err != nil {
+			utils.Fatalf("Invalid %s: %v", DBBulkDurabilityFlag.Name, err)
+		}
+	}
+	if cfg.Database != "mdbx" && (cfg.Durability != ethdb.DefaultDurability || cfg.BulkDurability != ethdb.DefaultDurability) {
+		log.Warn("Durability levels are only supported by MDBX, ignoring them", "database", cfg.Database)
+	}
+}
+
+// setGeometry populates the sizes of the database file
+func setGeometry(ctx *cli.Context, cfg *node.Config) {
+	cfg.DBGeometry = ethdb.Geometry{
+		InitialSize: sizeFlag(ctx, DBInitialSizeFlag),
+		GrowthStep:  sizeFlag(ctx, DBGrowthStepFlag),
+		MaxSize:     sizeFlag(ctx, DBMaxSizeFlag),
+		PageSize:    sizeFlag(ctx, DBPageSizeFlag),
+	}
+	if err := cfg.DBGeometry.Validate(); err != nil {
+		utils.Fatalf("Invalid database geometry: %v", err)
+	}
+	if cfg.Database != "mdbx" && (ctx.GlobalIsSet(DBInitialSizeFlag.Name) || ctx.GlobalIsSet(DBGrowthStepFlag.Name) || ctx.GlobalIsSet(DBPageSizeFlag.Name)) {
+		log.Warn("Initial size, growth step and page size of the database are only supported by MDBX, ignoring them", "database", cfg.Database)
+	}
+}
+
+// sizeFlag parses the datasize flag, 0 if it's empty
+func sizeFlag(ctx *cli.Context, flag cli.StringFlag) datasize.ByteSize {
+	var size datasize.ByteSize
+	if value := ctx.GlobalString(flag.Name); value != "" {
+		if err := size.UnmarshalText([]byte(value)); err != nil {
+			utils.Fatalf("Invalid %s: %v", flag.Name, err)
+		}
+	}
+	return size
+}
+
+// setAuthRPC populates the configuration of the authenticated HTTP RPC server
+func setAuthRPC(ctx *cli.Context, cfg *node.Config) {
+	cfg.AuthHost = ctx.GlobalString(AuthRPCAddrFlag.Name)
+	cfg.AuthPort = ctx.GlobalInt(AuthRPCPortFlag.Name)
+	cfg.JWTSecret = ctx.GlobalString(JWTSecretFlag.Name)
+}
+
 // setPrivateApi populates configuration fields related to the remote
 // read-only interface to the databae
 func setPrivateApi(ctx *cli.Context, cfg *node.Config) {
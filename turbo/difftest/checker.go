@@ -0,0 +1,218 @@
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/math"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// Checker re-executes blocks with a reference implementation and compares the results
+// (receipts, gas used and the post-state of all the touched accounts) with the results
+// of the block execution stage.
+type Checker struct {
+	ref     Reference
+	dumpDir string
+}
+
+// NewChecker creates a checker using ref. The inputs of the diverging blocks are saved
+// into dumpDir, so the divergence can be reproduced with the t8n tools.
+func NewChecker(ref Reference, dumpDir string) *Checker {
+	return &Checker{ref: ref, dumpDir: dumpDir}
+}
+
+// CheckBlock executes the block with the reference implementation, pre must be the reader
+// which recorded the pre-state during the execution of the block, and post must read the
+// state after it. It returns an error describing the differences if the results diverge.
+func (c *Checker) CheckBlock(config *params.ChainConfig, block *types.Block, getHeader func(common.Hash, uint64) *types.Header,
+	pre *RecordingReader, post state.StateReader) error {
+	header := block.Header()
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(header.Number) == 0 {
+		log.Warn("Skipping differential check of the DAO fork block", "number", header.Number)
+		return nil
+	}
+	in, err := makeInput(config, block, getHeader, pre)
+	if err != nil {
+		return err
+	}
+	out, err := c.ref.Transition(in)
+	if err != nil {
+		return fmt.Errorf("reference execution of block %d failed: %w", block.NumberU64(), err)
+	}
+	diffs, err := compare(config, block, pre, post, out)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+	dir := filepath.Join(c.dumpDir, fmt.Sprintf("block-%d", block.NumberU64()))
+	if err = in.WriteTo(dir); err != nil {
+		log.Warn("Failed to save the inputs of the diverging block", "dir", dir, "err", err)
+	}
+	return fmt.Errorf("block %d diverges from the reference implementation, reproduce with `evm %s`:\n%s",
+		block.NumberU64(), strings.Join(in.Args(dir), " "), strings.Join(diffs, "\n"))
+}
+
+func makeInput(config *params.ChainConfig, block *types.Block, getHeader func(common.Hash, uint64) *types.Header, pre *RecordingReader) (*Input, error) {
+	header := block.Header()
+	alloc, err := pre.Alloc()
+	if err != nil {
+		return nil, err
+	}
+	env := &Env{
+		Coinbase:    header.Coinbase,
+		Difficulty:  (*math.HexOrDecimal256)(header.Difficulty),
+		GasLimit:    math.HexOrDecimal64(header.GasLimit),
+		Number:      math.HexOrDecimal64(header.Number.Uint64()),
+		Timestamp:   math.HexOrDecimal64(header.Time),
+		BlockHashes: make(map[math.HexOrDecimal64]common.Hash),
+		BaseFee:     (*math.HexOrDecimal256)(header.BaseFee),
+	}
+	// The BLOCKHASH opcode can access the hashes of the 256 most recent blocks
+	hash, number := header.ParentHash, header.Number.Uint64()
+	for i := 0; i < 256 && number > 0; i++ {
+		number--
+		env.BlockHashes[math.HexOrDecimal64(number)] = hash
+		h := getHeader(hash, number)
+		if h == nil {
+			break
+		}
+		hash = h.ParentHash
+	}
+	for _, uncle := range block.Uncles() {
+		env.Ommers = append(env.Ommers, Ommer{Delta: header.Number.Uint64() - uncle.Number.Uint64(), Address: uncle.Coinbase})
+	}
+	return &Input{
+		Fork:    forkName(config, header.Number),
+		ChainID: config.ChainID,
+		Reward:  blockReward(config, header.Number),
+		Alloc:   alloc,
+		Env:     env,
+		Txs:     block.Transactions(),
+	}, nil
+}
+
+// forkName returns the name of the fork active at the given block, as understood by the t8n tools
+func forkName(config *params.ChainConfig, num *big.Int) string {
+	switch {
+	case config.IsLondon(num):
+		return "London"
+	case config.IsBerlin(num):
+		return "Berlin"
+	case config.IsIstanbul(num):
+		return "Istanbul"
+	case config.IsPetersburg(num):
+		return "ConstantinopleFix"
+	case config.IsConstantinople(num):
+		return "Constantinople"
+	case config.IsByzantium(num):
+		return "Byzantium"
+	case config.IsEIP158(num):
+		return "EIP158"
+	case config.IsEIP150(num):
+		return "EIP150"
+	case config.IsHomestead(num):
+		return "Homestead"
+	default:
+		return "Frontier"
+	}
+}
+
+// blockReward returns the reward of the miner of the given block, or nil if there are no rewards
+func blockReward(config *params.ChainConfig, num *big.Int) *big.Int {
+	if config.Ethash == nil {
+		return nil
+	}
+	switch {
+	case config.IsConstantinople(num):
+		return ethash.ConstantinopleBlockReward.ToBig()
+	case config.IsByzantium(num):
+		return ethash.ByzantiumBlockReward.ToBig()
+	default:
+		return ethash.FrontierBlockReward.ToBig()
+	}
+}
+
+// compare returns the differences between the execution results of the block and the reference output
+func compare(config *params.ChainConfig, block *types.Block, pre *RecordingReader, post state.StateReader, out *Output) ([]string, error) {
+	var diffs []string
+	for _, rejected := range out.Result.Rejected {
+		diffs = append(diffs, fmt.Sprintf("tx %d rejected by the reference: %s", rejected.Index, rejected.Err))
+	}
+	if uint64(out.Result.GasUsed) != block.GasUsed() {
+		diffs = append(diffs, fmt.Sprintf("gas used: have %d, reference %d", block.GasUsed(), uint64(out.Result.GasUsed)))
+	}
+	// Pre-Byzantium receipts contain intermediate state roots, which the reference can't
+	// compute from a partial state, the post-state of the accounts is compared instead
+	if config.IsByzantium(block.Number()) && out.Result.ReceiptRoot != block.ReceiptHash() {
+		diffs = append(diffs, fmt.Sprintf("receipts root: have %x, reference %x", block.ReceiptHash(), out.Result.ReceiptRoot))
+	}
+	if out.Result.LogsBloom != block.Bloom() {
+		diffs = append(diffs, fmt.Sprintf("logs bloom: have %x, reference %x", block.Bloom(), out.Result.LogsBloom))
+	}
+
+	addrs := pre.Addresses()
+	for addr := range out.Alloc {
+		if _, ok := pre.accounts[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	for _, addr := range addrs {
+		acc, err := post.ReadAccountData(addr)
+		if err != nil {
+			return nil, err
+		}
+		ref, refExists := out.Alloc[addr]
+		if acc == nil || !refExists {
+			if acc != nil || refExists {
+				diffs = append(diffs, fmt.Sprintf("account %x: exists %t, reference %t", addr, acc != nil, refExists))
+			}
+			continue
+		}
+		if acc.Nonce != ref.Nonce {
+			diffs = append(diffs, fmt.Sprintf("account %x: nonce %d, reference %d", addr, acc.Nonce, ref.Nonce))
+		}
+		if balance := acc.Balance.ToBig(); ref.Balance == nil || balance.Cmp(ref.Balance) != 0 {
+			diffs = append(diffs, fmt.Sprintf("account %x: balance %d, reference %d", addr, balance, ref.Balance))
+		}
+		var code []byte
+		if !acc.IsEmptyCodeHash() {
+			if code, err = post.ReadAccountCode(addr, acc.Incarnation, acc.CodeHash); err != nil {
+				return nil, err
+			}
+		}
+		if !bytes.Equal(code, ref.Code) {
+			diffs = append(diffs, fmt.Sprintf("account %x: code %x, reference %x", addr, code, ref.Code))
+		}
+
+		keys := pre.StorageKeys(addr)
+		for key := range ref.Storage {
+			if _, ok := pre.storage[addr][key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		for i := range keys {
+			enc, err := post.ReadAccountStorage(addr, acc.Incarnation, &keys[i])
+			if err != nil {
+				return nil, err
+			}
+			if value := common.BytesToHash(enc); value != ref.Storage[keys[i]] {
+				diffs = append(diffs, fmt.Sprintf("account %x: storage %x = %x, reference %x", addr, keys[i], value, ref.Storage[keys[i]]))
+			}
+		}
+	}
+	return diffs, nil
+}
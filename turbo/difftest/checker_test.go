@@ -0,0 +1,95 @@
+package difftest
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReference struct {
+	in  *Input
+	out *Output
+}
+
+func (f *fakeReference) Transition(in *Input) (*Output, error) {
+	f.in = in
+	return f.out, nil
+}
+
+func TestCheckBlock(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	var (
+		addrA    = common.HexToAddress("0x0a")
+		addrB    = common.HexToAddress("0x0b")
+		contract = common.HexToAddress("0x0c")
+		slot     = common.HexToHash("0x01")
+		code     = []byte{0x60, 0x00, 0x54}
+		ctx      = context.Background()
+	)
+
+	// Pre-state
+	ibs := state.New(state.NewPlainStateReader(db))
+	ibs.AddBalance(addrA, uint256.NewInt().SetUint64(100))
+	ibs.SetNonce(addrA, 1)
+	ibs.CreateAccount(contract, true)
+	ibs.SetCode(contract, code)
+	ibs.SetState(contract, &slot, *uint256.NewInt().SetUint64(5))
+	require.NoError(t, ibs.CommitBlock(ctx, state.NewPlainStateWriter(db, db, 0)))
+
+	// Execution of the block, which moves some funds and updates the storage
+	reader := state.NewPlainStateReader(db)
+	recorder := NewRecordingReader(reader)
+	ibs = state.New(recorder)
+	ibs.SubBalance(addrA, uint256.NewInt().SetUint64(10))
+	ibs.AddBalance(addrB, uint256.NewInt().SetUint64(10))
+	ibs.SetState(contract, &slot, *uint256.NewInt().SetUint64(6))
+	require.NoError(t, ibs.CommitBlock(ctx, state.NewPlainStateWriter(db, db, 1)))
+
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), GasLimit: 1000000}, nil, nil, nil)
+	ref := &fakeReference{out: &Output{
+		Result: Result{ReceiptRoot: block.ReceiptHash(), LogsBloom: block.Bloom()},
+		Alloc: core.GenesisAlloc{
+			addrA:    {Balance: big.NewInt(90), Nonce: 1},
+			addrB:    {Balance: big.NewInt(10)},
+			contract: {Balance: new(big.Int), Code: code, Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x06")}},
+		},
+	}}
+	dumpDir := t.TempDir()
+	checker := NewChecker(ref, dumpDir)
+	getHeader := func(common.Hash, uint64) *types.Header { return nil }
+
+	require.NoError(t, checker.CheckBlock(params.TestChainConfig, block, getHeader, recorder, reader))
+
+	// The reference gets the pre-state of the touched accounts
+	assert.Equal(t, "Berlin", ref.in.Fork)
+	assert.Equal(t, big.NewInt(100), ref.in.Alloc[addrA].Balance)
+	assert.Equal(t, code, ref.in.Alloc[contract].Code)
+	assert.Equal(t, common.HexToHash("0x05"), ref.in.Alloc[contract].Storage[slot])
+	_, exists := ref.in.Alloc[addrB]
+	assert.False(t, exists)
+
+	// Divergence of the post-state halts with the diff, the inputs are saved
+	ref.out.Alloc[addrB] = core.GenesisAccount{Balance: big.NewInt(11)}
+	ref.out.Alloc[contract].Storage[slot] = common.HexToHash("0x07")
+	err := checker.CheckBlock(params.TestChainConfig, block, getHeader, recorder, reader)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "balance 10, reference 11"), err.Error())
+	assert.True(t, strings.Contains(err.Error(), "reference 0000000000000000000000000000000000000000000000000000000000000007"), err.Error())
+	_, statErr := os.Stat(filepath.Join(dumpDir, "block-1", "alloc.json"))
+	assert.NoError(t, statErr)
+}
@@ -0,0 +1,129 @@
+package difftest
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+// RecordingReader is a state reader which remembers the state items as they were at the
+// first read. Wrapped around the reader of a block execution, it collects the part of the
+// pre-state the block depends on, which is enough for another implementation to re-execute it.
+type RecordingReader struct {
+	state.StateReader
+	accounts map[common.Address]*accounts.Account // nil for accounts which don't exist
+	codes    map[common.Address][]byte
+	storage  map[common.Address]map[common.Hash]common.Hash
+}
+
+// NewRecordingReader creates a recording reader on top of r
+func NewRecordingReader(r state.StateReader) *RecordingReader {
+	return &RecordingReader{
+		StateReader: r,
+		accounts:    make(map[common.Address]*accounts.Account),
+		codes:       make(map[common.Address][]byte),
+		storage:     make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+func (r *RecordingReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	acc, err := r.StateReader.ReadAccountData(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := r.accounts[address]; !ok {
+		var cpy *accounts.Account
+		if acc != nil {
+			cpy = acc.SelfCopy()
+		}
+		r.accounts[address] = cpy
+	}
+	return acc, nil
+}
+
+func (r *RecordingReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	enc, err := r.StateReader.ReadAccountStorage(address, incarnation, key)
+	if err != nil {
+		return nil, err
+	}
+	// Only the storage of the pre-state incarnation belongs to the pre-state
+	if acc, ok := r.accounts[address]; ok && acc != nil && acc.Incarnation == incarnation {
+		m, ok := r.storage[address]
+		if !ok {
+			m = make(map[common.Hash]common.Hash)
+			r.storage[address] = m
+		}
+		if _, ok := m[*key]; !ok {
+			m[*key] = common.BytesToHash(enc)
+		}
+	}
+	return enc, nil
+}
+
+func (r *RecordingReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	code, err := r.StateReader.ReadAccountCode(address, incarnation, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if acc, ok := r.accounts[address]; ok && acc != nil && acc.Incarnation == incarnation {
+		if _, ok := r.codes[address]; !ok {
+			r.codes[address] = common.CopyBytes(code)
+		}
+	}
+	return code, nil
+}
+
+// Addresses returns the addresses of all the accounts read so far, including the non-existent ones
+func (r *RecordingReader) Addresses() []common.Address {
+	addrs := make([]common.Address, 0, len(r.accounts))
+	for addr := range r.accounts {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// StorageKeys returns the keys of the storage items of the account read so far
+func (r *RecordingReader) StorageKeys(address common.Address) []common.Hash {
+	keys := make([]common.Hash, 0, len(r.storage[address]))
+	for key := range r.storage[address] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Alloc returns the recorded pre-state in the genesis allocation format, which is the format
+// of the state input of the t8n tools. The code of the contracts which was not read during
+// the execution (e.g. only its hash was used) is loaded from the underlying reader.
+func (r *RecordingReader) Alloc() (core.GenesisAlloc, error) {
+	alloc := make(core.GenesisAlloc, len(r.accounts))
+	for addr, acc := range r.accounts {
+		if acc == nil {
+			continue
+		}
+		code, ok := r.codes[addr]
+		if !ok && !acc.IsEmptyCodeHash() {
+			var err error
+			if code, err = r.StateReader.ReadAccountCode(addr, acc.Incarnation, acc.CodeHash); err != nil {
+				return nil, err
+			}
+		}
+		var storage map[common.Hash]common.Hash
+		for key, value := range r.storage[addr] {
+			if value == (common.Hash{}) {
+				continue
+			}
+			if storage == nil {
+				storage = make(map[common.Hash]common.Hash)
+			}
+			storage[key] = value
+		}
+		alloc[addr] = core.GenesisAccount{
+			Code:    code,
+			Storage: storage,
+			Balance: acc.Balance.ToBig(),
+			Nonce:   acc.Nonce,
+		}
+	}
+	return alloc, nil
+}
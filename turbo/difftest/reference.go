@@ -0,0 +1,148 @@
+package difftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/math"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// Env is the block environment in the format of the t8n tools
+type Env struct {
+	Coinbase    common.Address                      `json:"currentCoinbase"`
+	Difficulty  *math.HexOrDecimal256               `json:"currentDifficulty"`
+	GasLimit    math.HexOrDecimal64                 `json:"currentGasLimit"`
+	Number      math.HexOrDecimal64                 `json:"currentNumber"`
+	Timestamp   math.HexOrDecimal64                 `json:"currentTimestamp"`
+	BlockHashes map[math.HexOrDecimal64]common.Hash `json:"blockHashes,omitempty"`
+	Ommers      []Ommer                             `json:"ommers,omitempty"`
+	BaseFee     *math.HexOrDecimal256               `json:"currentBaseFee,omitempty"`
+}
+
+// Ommer is an uncle of the block in the format of the t8n tools
+type Ommer struct {
+	Delta   uint64         `json:"delta"`
+	Address common.Address `json:"address"`
+}
+
+// Input is everything the reference implementation needs to execute a block
+type Input struct {
+	Fork    string
+	ChainID *big.Int
+	Reward  *big.Int // nil if the consensus engine doesn't pay block rewards
+	Alloc   core.GenesisAlloc
+	Env     *Env
+	Txs     types.Transactions
+}
+
+// RejectedTx is a transaction which the reference implementation failed to apply
+type RejectedTx struct {
+	Index int    `json:"index"`
+	Err   string `json:"error"`
+}
+
+// Result is the summary of the execution by the reference implementation
+type Result struct {
+	ReceiptRoot common.Hash         `json:"receiptRoot"`
+	LogsBloom   types.Bloom         `json:"logsBloom"`
+	GasUsed     math.HexOrDecimal64 `json:"gasUsed"`
+	Rejected    []RejectedTx        `json:"rejected,omitempty"`
+}
+
+// Output is the result of the execution by the reference implementation, Alloc is the
+// post-state of the accounts of the input allocation and of the accounts created by the block
+type Output struct {
+	Result Result
+	Alloc  core.GenesisAlloc
+}
+
+// Reference executes blocks with another EVM implementation
+type Reference interface {
+	Transition(in *Input) (*Output, error)
+}
+
+// WriteTo saves the input files of the t8n tools into dir
+func (in *Input) WriteTo(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, v := range map[string]interface{}{"alloc.json": in.Alloc, "env.json": in.Env, "txs.json": in.Txs} {
+		enc, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, name), enc, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Args returns the command line arguments of the t8n tools for the input saved into dir
+func (in *Input) Args(dir string) []string {
+	reward := "-1"
+	if in.Reward != nil {
+		reward = in.Reward.String()
+	}
+	return []string{
+		"t8n",
+		"--input.alloc", filepath.Join(dir, "alloc.json"),
+		"--input.env", filepath.Join(dir, "env.json"),
+		"--input.txs", filepath.Join(dir, "txs.json"),
+		"--output.basedir", dir,
+		"--output.result", "result.json",
+		"--output.alloc", "alloc-out.json",
+		"--state.fork", in.Fork,
+		"--state.chainid", in.ChainID.String(),
+		"--state.reward", reward,
+	}
+}
+
+// T8n is a reference implementation running an external binary compatible with the
+// `evm t8n` tool of go-ethereum, e.g. go-ethereum's evm itself
+type T8n struct {
+	Path string
+}
+
+func (t *T8n) Transition(in *Input) (*Output, error) {
+	dir, err := ioutil.TempDir("", "difftest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err = in.WriteTo(dir); err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(t.Path, in.Args(dir)...)
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", t.Path, err, stderr.String())
+	}
+
+	var out Output
+	enc, err := ioutil.ReadFile(filepath.Join(dir, "result.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(enc, &out.Result); err != nil {
+		return nil, fmt.Errorf("parsing result: %w", err)
+	}
+	if enc, err = ioutil.ReadFile(filepath.Join(dir, "alloc-out.json")); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(enc, &out.Alloc); err != nil {
+		return nil, fmt.Errorf("parsing alloc: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,92 @@
+package execproof
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// Apply verifies the data file of the proof against the attestation, and writes its changesets into
+// changeSetsDB and the state after the last block of the proof into stateDB, the same way the execution of the
+// blocks writes them. The data file is only verified to be the attested one, its changesets are not
+// re-executed, the state root check of the last block is what catches a wrong proof of a trusted signer.
+func (s *Store) Apply(changeSetsDB, stateDB ethdb.Database, a *Attestation) error {
+	path := filepath.Join(s.dir, a.Name()+".dat")
+	if err := verifyData(path, a); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stream := rlp.NewStream(bufio.NewReader(f), 0)
+	var prevBucket string
+	var prevK []byte
+	for {
+		var e Entry
+		if err = stream.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decoding execution proof %s: %w", a.Name(), err)
+		}
+		switch e.Bucket {
+		case dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket:
+			if len(e.Key) < 8 {
+				return fmt.Errorf("execution proof %s: changeset key %x", a.Name(), e.Key)
+			}
+			if blockNum := binary.BigEndian.Uint64(e.Key); blockNum < a.FromBlock || blockNum > a.ToBlock {
+				return fmt.Errorf("execution proof %s: changeset of block %d", a.Name(), blockNum)
+			}
+			// The changesets are in the order of the database
+			if e.Bucket == prevBucket && bytes.Equal(e.Key, prevK) {
+				err = changeSetsDB.AppendDup(e.Bucket, e.Key, e.Value)
+			} else {
+				err = changeSetsDB.Append(e.Bucket, e.Key, e.Value)
+			}
+			prevBucket, prevK = e.Bucket, e.Key
+		case dbutils.PlainStateBucket:
+			if len(e.Value) == 0 {
+				err = stateDB.Delete(e.Bucket, e.Key, nil)
+			} else {
+				err = stateDB.Put(e.Bucket, e.Key, e.Value)
+			}
+		case dbutils.PlainContractCodeBucket, dbutils.CodeBucket, dbutils.IncarnationMapBucket:
+			err = stateDB.Put(e.Bucket, e.Key, e.Value)
+		default:
+			return fmt.Errorf("execution proof %s: unexpected bucket %s", a.Name(), e.Bucket)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// verifyData checks that the data file is the one the attestation commits to
+func verifyData(path string, a *Attestation) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hasher := sha3.NewLegacyKeccak256()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return err
+	}
+	if hash := common.BytesToHash(hasher.Sum(nil)); hash != a.DataHash {
+		return fmt.Errorf("data of execution proof %s has hash %x, attested %x", a.Name(), hash, a.DataHash)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package execproof
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// Export writes the proof of the execution of the blocks from..to into the directory, signed with the key. The
+// blocks must be executed, and if there are executed blocks after them, the history must be indexed up to those,
+// as the state after the last block of the range is read from it.
+func Export(ctx context.Context, db ethdb.Database, from, to uint64, key *ecdsa.PrivateKey, dir string) (*Attestation, error) {
+	if from == 0 || from > to {
+		return nil, fmt.Errorf("invalid range of blocks %d-%d", from, to)
+	}
+	executed, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+	if executed < to {
+		return nil, fmt.Errorf("blocks are executed up to %d", executed)
+	}
+	if executed > to {
+		for _, stage := range []stages.SyncStage{stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+			progress, err := stages.GetStageProgress(db, stage)
+			if err != nil {
+				return nil, err
+			}
+			if progress < executed {
+				return nil, fmt.Errorf("%s is at %d, behind the execution at %d", stage, progress, executed)
+			}
+		}
+	}
+	hash, err := rawdb.ReadCanonicalHash(db, to)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tx, err := db.(ethdb.HasKV).KV().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a := &Attestation{FromBlock: from, ToBlock: to, ToBlockHash: hash}
+	f, err := os.Create(filepath.Join(dir, a.Name()+".dat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hasher := sha3.NewLegacyKeccak256()
+	w := bufio.NewWriter(io.MultiWriter(f, hasher))
+	if err = writeData(w, tx, from, to); err != nil {
+		return nil, err
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	a.DataHash = common.BytesToHash(hasher.Sum(nil))
+	if err = a.Sign(key); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, a.Name()+".json"), data, 0644); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func writeData(w io.Writer, tx ethdb.Tx, from, to uint64) error {
+	write := func(bucket string, k, v []byte) error {
+		return rlp.Encode(w, &Entry{Bucket: bucket, Key: k, Value: v})
+	}
+	// The values of the accounts before every block they changed in, to tell the destructed contracts
+	before := make(map[common.Address][][]byte)
+	storageKeys := make(map[string]struct{})
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		fromDBFormat := changeset.FromDBFormat(common.AddressLength)
+		c := tx.Cursor(bucket)
+		for k, v, err := c.Seek(dbutils.EncodeBlockNumber(from)); k != nil && binary.BigEndian.Uint64(k) <= to; k, v, err = c.Next() {
+			if err != nil {
+				c.Close()
+				return err
+			}
+			if err = write(bucket, k, v); err != nil {
+				c.Close()
+				return err
+			}
+			_, key, value := fromDBFormat(k, v)
+			if bucket == dbutils.PlainAccountChangeSetBucket {
+				address := common.BytesToAddress(key)
+				before[address] = append(before[address], common.CopyBytes(value))
+			} else {
+				storageKeys[string(key)] = struct{}{}
+			}
+		}
+		c.Close()
+	}
+
+	// The state after the last block, and the codes and the incarnations of the contracts
+	after := func(storage bool, key []byte) ([]byte, error) {
+		v, err := state.GetAsOf(tx, storage, key, to+1)
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return nil, err
+		}
+		return v, nil
+	}
+	addresses := make([]common.Address, 0, len(before))
+	for address := range before {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+	var contractCodes, incarnations []Entry
+	for _, address := range addresses {
+		v, err := after(false, address[:])
+		if err != nil {
+			return err
+		}
+		if err = write(dbutils.PlainStateBucket, address[:], v); err != nil {
+			return err
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return fmt.Errorf("decoding account %x: %w", address, err)
+		}
+		if acc.Incarnation > 0 && !acc.IsEmptyCodeHash() {
+			codeKey := dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation)
+			contractCodes = append(contractCodes, Entry{Bucket: dbutils.PlainContractCodeBucket, Key: codeKey, Value: acc.CodeHash[:]})
+		}
+		if incarnation := destructedIncarnation(before[address], &acc); incarnation > 0 {
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], incarnation)
+			incarnations = append(incarnations, Entry{Bucket: dbutils.IncarnationMapBucket, Key: common.CopyBytes(address[:]), Value: b[:]})
+		}
+	}
+	keys := make([]string, 0, len(storageKeys))
+	for k := range storageKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := after(true, []byte(k))
+		if err != nil {
+			return err
+		}
+		if err = write(dbutils.PlainStateBucket, []byte(k), v); err != nil {
+			return err
+		}
+	}
+	for _, e := range contractCodes {
+		code, err := tx.GetOne(dbutils.CodeBucket, e.Value)
+		if err != nil {
+			return err
+		}
+		if err = write(e.Bucket, e.Key, e.Value); err != nil {
+			return err
+		}
+		if err = write(dbutils.CodeBucket, e.Value, code); err != nil {
+			return err
+		}
+	}
+	for _, e := range incarnations {
+		if err := write(e.Bucket, e.Key, e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// destructedIncarnation is the last incarnation of the contract destructed in the range, 0 if there is none. The
+// values are those before every block the account changed in, and the one after the range.
+func destructedIncarnation(values [][]byte, last *accounts.Account) uint64 {
+	var destructed uint64
+	for i, v := range values {
+		if len(v) == 0 {
+			continue
+		}
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(v); err != nil || acc.Incarnation == 0 {
+			continue
+		}
+		next := last
+		if i+1 < len(values) {
+			next = &accounts.Account{}
+			if len(values[i+1]) > 0 {
+				if err := next.DecodeForStorage(values[i+1]); err != nil {
+					continue
+				}
+			}
+		}
+		// Either gone or re-created with the next incarnation
+		if next.Incarnation != acc.Incarnation && acc.Incarnation > destructed {
+			destructed = acc.Incarnation
+		}
+	}
+	return destructed
+}
@@ -0,0 +1,236 @@
+// Package execproof implements the execution proofs: the signed attestations that the execution of a range of
+// blocks resulted in the given changesets, which let the Execution stage fast-forward the range by applying the
+// changesets instead of re-executing the blocks, e.g. when cloning many nodes of a fleet from one of them.
+//
+// The proof of the blocks from..to is a pair of files in the proofs directory:
+//
+//	execution-<from>-<to>.json
+//	execution-<from>-<to>.dat
+//
+// The data file is the stream of the RLP encoded Entry: the changesets of the blocks as they are in the database,
+// followed by the state of the changed keys after the last block with the codes of the contracts, and the
+// incarnations of the destructed ones. The attestation in the json file commits to the data file by its
+// Keccak256 hash, and to the chain by the hash of the last block, and is signed by the exporting node.
+// The receipts are not in the proofs, they aren't written for the fast-forwarded blocks.
+package execproof
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+var ErrUntrustedSigner = errors.New("execution proof is not signed by a trusted signer")
+
+// Attestation is the signed statement that the execution of the blocks FromBlock..ToBlock, the last of which is
+// ToBlockHash, resulted in the changesets and the state of the data file with the hash DataHash
+type Attestation struct {
+	FromBlock   uint64        `json:"fromBlock"`
+	ToBlock     uint64        `json:"toBlock"`
+	ToBlockHash common.Hash   `json:"toBlockHash"`
+	DataHash    common.Hash   `json:"dataHash"`
+	Signature   hexutil.Bytes `json:"signature"`
+}
+
+// SigningHash is the hash of the attested fields the signature is made over
+func (a *Attestation) SigningHash() (common.Hash, error) {
+	enc, err := rlp.EncodeToBytes([]interface{}{a.FromBlock, a.ToBlock, a.ToBlockHash, a.DataHash})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(enc), nil
+}
+
+// Sign signs the attestation with the key
+func (a *Attestation) Sign(key *ecdsa.PrivateKey) error {
+	hash, err := a.SigningHash()
+	if err != nil {
+		return err
+	}
+	a.Signature, err = crypto.Sign(hash[:], key)
+	return err
+}
+
+// Signer recovers the address of the signer of the attestation
+func (a *Attestation) Signer() (common.Address, error) {
+	hash, err := a.SigningHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	pub, err := crypto.SigToPub(hash[:], a.Signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid signature of execution proof %d-%d: %w", a.FromBlock, a.ToBlock, err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// Name is the name of the files of the proof without the extension
+func (a *Attestation) Name() string {
+	return fmt.Sprintf("execution-%09d-%09d", a.FromBlock, a.ToBlock)
+}
+
+// Entry is the record of the data file, the Key and Value of the bucket. The empty values of PlainStateBucket
+// are the deletions.
+type Entry struct {
+	Bucket string
+	Key    []byte
+	Value  []byte
+}
+
+// Store is the directory of the proofs the node accepts, the attestations of the trusted signers are loaded
+// into memory, the data files are only read when the proofs are applied
+type Store struct {
+	dir     string
+	signers map[common.Address]struct{}
+	byFrom  map[uint64]*Attestation
+}
+
+// OpenStore loads the attestations of the proofs in the directory signed by one of the signers, the others
+// are skipped with a warning
+func OpenStore(dir string, signers []common.Address) (*Store, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("no trusted signers of the execution proofs")
+	}
+	s := &Store{dir: dir, signers: make(map[common.Address]struct{}), byFrom: make(map[uint64]*Attestation)}
+	for _, signer := range signers {
+		s.signers[signer] = struct{}{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		a, err := readAttestation(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkSigner(a); err != nil {
+			log.Warn("Skipping execution proof", "file", f.Name(), "err", err)
+			continue
+		}
+		if prev, ok := s.byFrom[a.FromBlock]; !ok || prev.ToBlock < a.ToBlock {
+			s.byFrom[a.FromBlock] = a
+		}
+	}
+	log.Info("Loaded execution proofs", "dir", dir, "proofs", len(s.byFrom))
+	return s, nil
+}
+
+func readAttestation(path string) (*Attestation, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var a Attestation
+	if err = json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("decoding execution proof %s: %w", path, err)
+	}
+	if a.FromBlock == 0 || a.FromBlock > a.ToBlock {
+		return nil, fmt.Errorf("execution proof %s has invalid range %d-%d", path, a.FromBlock, a.ToBlock)
+	}
+	return &a, nil
+}
+
+func (s *Store) checkSigner(a *Attestation) error {
+	signer, err := a.Signer()
+	if err != nil {
+		return err
+	}
+	if _, ok := s.signers[signer]; !ok {
+		return fmt.Errorf("%w: %x", ErrUntrustedSigner, signer)
+	}
+	return nil
+}
+
+// Starting returns the proof of the longest range starting at the block, nil if there is none
+func (s *Store) Starting(block uint64) *Attestation {
+	if s == nil {
+		return nil
+	}
+	return s.byFrom[block]
+}
+
+// Proofs lists the attestations of the store ordered by their ranges
+func (s *Store) Proofs() []*Attestation {
+	proofs := make([]*Attestation, 0, len(s.byFrom))
+	for _, a := range s.byFrom {
+		proofs = append(proofs, a)
+	}
+	sort.Slice(proofs, func(i, j int) bool { return proofs[i].FromBlock < proofs[j].FromBlock })
+	return proofs
+}
+
+// Import verifies the proof in the files of the source directory, and copies it into the store
+func (s *Store) Import(srcDir string, a *Attestation) error {
+	if err := s.checkSigner(a); err != nil {
+		return err
+	}
+	if err := verifyData(filepath.Join(srcDir, a.Name()+".dat"), a); err != nil {
+		return err
+	}
+	for _, ext := range []string{".dat", ".json"} {
+		if err := copyFile(filepath.Join(srcDir, a.Name()+ext), filepath.Join(s.dir, a.Name()+ext)); err != nil {
+			return err
+		}
+	}
+	if prev, ok := s.byFrom[a.FromBlock]; !ok || prev.ToBlock < a.ToBlock {
+		s.byFrom[a.FromBlock] = a
+	}
+	return nil
+}
+
+// ReadAttestations reads the attestations of the proofs in the directory, signed by anyone
+func ReadAttestations(dir string) ([]*Attestation, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "execution-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	attestations := make([]*Attestation, 0, len(files))
+	for _, file := range files {
+		a, err := readAttestation(file)
+		if err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, a)
+	}
+	return attestations, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = out.ReadFrom(in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,151 @@
+package execproof
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	eoa       = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	newEOA    = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	contract  = common.HexToAddress("0x2000000000000000000000000000000000000001")
+	contract2 = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	slot      = common.HexToHash("0x01")
+)
+
+func newAccount(balance uint64, incarnation uint64, code []byte) *accounts.Account {
+	acc := accounts.NewAccount()
+	acc.Initialised = true
+	acc.Balance.SetUint64(balance)
+	if code != nil {
+		acc.Incarnation = incarnation
+		acc.CodeHash = crypto.Keccak256Hash(code)
+	}
+	return &acc
+}
+
+// writeGenesis writes the state both of the databases start with
+func writeGenesis(t *testing.T, db ethdb.Database) {
+	ctx := context.Background()
+	w := state.NewPlainStateWriter(db, db, 0)
+	code := []byte{0x60, 0x01}
+	require.NoError(t, w.UpdateAccountData(ctx, eoa, &accounts.Account{}, newAccount(100, 0, nil)))
+	require.NoError(t, w.UpdateAccountData(ctx, contract, &accounts.Account{}, newAccount(0, 1, code)))
+	require.NoError(t, w.UpdateAccountCode(contract, 1, crypto.Keccak256Hash(code), code))
+	require.NoError(t, w.WriteAccountStorage(ctx, contract, 1, &slot, uint256.NewInt(), uint256.NewInt().SetUint64(1)))
+}
+
+// executeBlocks writes the state changes of the blocks 1..3 the way the Execution stage does
+func executeBlocks(t *testing.T, db ethdb.Database) {
+	ctx := context.Background()
+	code := []byte{0x60, 0x02}
+
+	w := state.NewPlainStateWriter(db, db, 1)
+	require.NoError(t, w.UpdateAccountData(ctx, eoa, newAccount(100, 0, nil), newAccount(90, 0, nil)))
+	require.NoError(t, w.UpdateAccountData(ctx, newEOA, &accounts.Account{}, newAccount(10, 0, nil)))
+	require.NoError(t, w.WriteChangeSets())
+
+	w = state.NewPlainStateWriter(db, db, 2)
+	require.NoError(t, w.WriteAccountStorage(ctx, contract, 1, &slot, uint256.NewInt().SetUint64(1), uint256.NewInt().SetUint64(2)))
+	require.NoError(t, w.CreateContract(contract2))
+	require.NoError(t, w.UpdateAccountData(ctx, contract2, &accounts.Account{}, newAccount(0, 1, code)))
+	require.NoError(t, w.UpdateAccountCode(contract2, 1, crypto.Keccak256Hash(code), code))
+	require.NoError(t, w.WriteChangeSets())
+
+	w = state.NewPlainStateWriter(db, db, 3)
+	require.NoError(t, w.DeleteAccount(ctx, contract, newAccount(0, 1, []byte{0x60, 0x01})))
+	require.NoError(t, w.WriteChangeSets())
+
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, rawdb.WriteCanonicalHash(db, common.Hash{byte(i)}, i))
+	}
+	require.NoError(t, stages.SaveStageProgress(db, stages.Execution, 3))
+}
+
+func readBucket(t *testing.T, db ethdb.Database, bucket string) map[string][]byte {
+	m := make(map[string][]byte)
+	require.NoError(t, db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		m[string(k)] = v
+		return true, nil
+	}))
+	return m
+}
+
+func TestExportApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execproof")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	db1 := ethdb.NewMemDatabase()
+	defer db1.Close()
+	writeGenesis(t, db1)
+	executeBlocks(t, db1)
+
+	a, err := Export(context.Background(), db1, 1, 3, key, dir)
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash{3}, a.ToBlockHash)
+	recovered, err := a.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, signer, recovered)
+
+	store, err := OpenStore(dir, []common.Address{signer})
+	require.NoError(t, err)
+	require.NotNil(t, store.Starting(1))
+	assert.Nil(t, store.Starting(2))
+
+	db2 := ethdb.NewMemDatabase()
+	defer db2.Close()
+	writeGenesis(t, db2)
+	require.NoError(t, store.Apply(db2, db2, store.Starting(1)))
+	for _, bucket := range []string{
+		dbutils.PlainStateBucket,
+		dbutils.PlainContractCodeBucket,
+		dbutils.CodeBucket,
+		dbutils.IncarnationMapBucket,
+		dbutils.PlainAccountChangeSetBucket,
+		dbutils.PlainStorageChangeSetBucket,
+	} {
+		assert.Equal(t, readBucket(t, db1, bucket), readBucket(t, db2, bucket), bucket)
+	}
+
+	// The proofs of the other signers are skipped
+	other, err := OpenStore(dir, []common.Address{common.HexToAddress("0x01")})
+	require.NoError(t, err)
+	assert.Nil(t, other.Starting(1))
+	assert.True(t, errors.Is(other.Import(dir, a), ErrUntrustedSigner))
+
+	// Neither imported nor applied when the data is not the attested one
+	dst, err := ioutil.TempDir("", "execproof")
+	require.NoError(t, err)
+	defer os.RemoveAll(dst)
+	imported, err := OpenStore(dst, []common.Address{signer})
+	require.NoError(t, err)
+	require.NoError(t, imported.Import(dir, a))
+	require.NotNil(t, imported.Starting(1))
+	f, err := os.OpenFile(filepath.Join(dst, a.Name()+".dat"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xc0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Error(t, imported.Apply(db2, db2, a))
+	assert.Error(t, store.Import(dst, a))
+}
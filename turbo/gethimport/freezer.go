@@ -0,0 +1,162 @@
+package gethimport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/snappy"
+)
+
+// Tables of the go-ethereum freezer, the ancient blocks of which are moved out of its LevelDB
+const (
+	freezerHeaders  = "headers"
+	freezerHashes   = "hashes"
+	freezerBodies   = "bodies"
+	freezerReceipts = "receipts"
+	freezerDiffs    = "diffs"
+)
+
+var freezerTables = []string{freezerHeaders, freezerHashes, freezerBodies, freezerReceipts, freezerDiffs}
+
+// indexEntrySize is the size of the entry of the freezer index: the number of the data file (uint16), and the offset
+// of the end of the item in it (uint32)
+const indexEntrySize = 6
+
+// freezerTable reads a table of the go-ethereum freezer. The index has an entry per item, preceded by the entry
+// with the number of the first data file and the number of the items deleted from the tail. The items are
+// snappy compressed, except the tables with the raw index (.ridx) and data (.rdat) files
+type freezerTable struct {
+	dir        string
+	name       string
+	compressed bool
+	index      []byte
+	deleted    uint64 // Number of the items deleted from the tail
+	files      map[uint32]*os.File
+}
+
+func openFreezerTable(dir, name string) (*freezerTable, error) {
+	t := &freezerTable{dir: dir, name: name, compressed: true, files: make(map[uint32]*os.File)}
+	index, err := ioutil.ReadFile(filepath.Join(dir, name+".cidx"))
+	if os.IsNotExist(err) {
+		t.compressed = false
+		index, err = ioutil.ReadFile(filepath.Join(dir, name+".ridx"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The entries are appended, the partially written one is ignored
+	t.index = index[:len(index)/indexEntrySize*indexEntrySize]
+	if len(t.index) == 0 {
+		return nil, fmt.Errorf("freezer table %s has no index entries", name)
+	}
+	t.deleted = uint64(binary.BigEndian.Uint32(t.index[2:6]))
+	return t, nil
+}
+
+// items returns the number of the items in the table, including the ones deleted from the tail
+func (t *freezerTable) items() uint64 {
+	return t.deleted + uint64(len(t.index)/indexEntrySize) - 1
+}
+
+func (t *freezerTable) entry(i uint64) (filenum, offset uint32) {
+	e := t.index[i*indexEntrySize:]
+	return uint32(binary.BigEndian.Uint16(e)), binary.BigEndian.Uint32(e[2:6])
+}
+
+// get returns the item, or nil if it is not in the table
+func (t *freezerTable) get(item uint64) ([]byte, error) {
+	if item < t.deleted || item >= t.items() {
+		return nil, nil
+	}
+	i := item - t.deleted
+	startFile, start := t.entry(i)
+	filenum, end := t.entry(i + 1)
+	if i == 0 || startFile != filenum {
+		// The item is the first one of its data file
+		start = 0
+	}
+	if end < start {
+		return nil, fmt.Errorf("freezer table %s: item %d ends at %d before its start %d", t.name, item, end, start)
+	}
+	file, err := t.file(filenum)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, end-start)
+	if _, err = file.ReadAt(data, int64(start)); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("freezer table %s: reading item %d: %w", t.name, item, err)
+	}
+	if !t.compressed {
+		return data, nil
+	}
+	if data, err = snappy.Decode(nil, data); err != nil {
+		return nil, fmt.Errorf("freezer table %s: decompressing item %d: %w", t.name, item, err)
+	}
+	return data, nil
+}
+
+func (t *freezerTable) file(filenum uint32) (*os.File, error) {
+	if file, ok := t.files[filenum]; ok {
+		return file, nil
+	}
+	ext := "cdat"
+	if !t.compressed {
+		ext = "rdat"
+	}
+	file, err := os.Open(filepath.Join(t.dir, fmt.Sprintf("%s.%04d.%s", t.name, filenum, ext)))
+	if err != nil {
+		return nil, err
+	}
+	t.files[filenum] = file
+	return file, nil
+}
+
+func (t *freezerTable) close() {
+	for _, file := range t.files {
+		file.Close()
+	}
+}
+
+// freezer reads the ancient blocks of go-ethereum, which are in all the tables
+type freezer struct {
+	tables map[string]*freezerTable
+	frozen uint64
+}
+
+// openFreezer opens the freezer in the directory, the missing directory is the freezer without the blocks
+func openFreezer(dir string) (*freezer, error) {
+	f := &freezer{tables: make(map[string]*freezerTable)}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return f, nil
+	}
+	for i, name := range freezerTables {
+		t, err := openFreezerTable(dir, name)
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+		f.tables[name] = t
+		if i == 0 || t.items() < f.frozen {
+			f.frozen = t.items()
+		}
+	}
+	return f, nil
+}
+
+// get returns the item of the block from the table, or nil if the block is not frozen
+func (f *freezer) get(table string, number uint64) ([]byte, error) {
+	if number >= f.frozen {
+		return nil, nil
+	}
+	return f.tables[table].get(number)
+}
+
+func (f *freezer) close() {
+	for _, t := range f.tables {
+		t.close()
+	}
+}
@@ -0,0 +1,397 @@
+// Package gethimport converts the chain of a go-ethereum datadir into the turbo-geth database, so that the users
+// of go-ethereum can migrate without downloading the chain again. The headers, the bodies and the receipts are
+// read from the LevelDB of go-ethereum and from its freezer of the ancient blocks. The state of go-ethereum is
+// not imported, it is the hashed trie which the flat state of turbo-geth cannot be made from, instead the state
+// is built by the execution of the imported blocks, either right after the import, or by the next sync of the node.
+package gethimport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/aura"
+	"github.com/ledgerwatch/turbo-geth/consensus/bor"
+	"github.com/ledgerwatch/turbo-geth/consensus/clique"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// GethImport is the stage of the import, its progress is the highest block imported, so that the interrupted
+// import continues from it
+var GethImport = stages.SyncStage("geth_import")
+
+// DefaultBatchBlocks is the number of the blocks imported in one transaction
+const DefaultBatchBlocks = 10000
+
+// Config of the import
+type Config struct {
+	ToBlock     uint64        // Highest block to import, 0 means the head block of go-ethereum
+	Genesis     *core.Genesis // Genesis of the chain, nil means the one of the known network with the same hash
+	BatchBlocks uint64        // Number of the blocks imported in one transaction, 0 means DefaultBatchBlocks
+}
+
+// Keys of go-ethereum's LevelDB
+var (
+	gethHeadBlockKey = []byte("LastBlock")
+	gethConfigPrefix = []byte("ethereum-config-")
+)
+
+func gethBlockKey(prefix byte, number uint64, hash common.Hash) []byte {
+	key := make([]byte, 1+8+common.HashLength)
+	key[0] = prefix
+	binary.BigEndian.PutUint64(key[1:], number)
+	copy(key[9:], hash[:])
+	return key
+}
+
+func gethCanonicalKey(number uint64) []byte {
+	key := make([]byte, 1+8+1)
+	key[0] = 'h'
+	binary.BigEndian.PutUint64(key[1:], number)
+	key[9] = 'n'
+	return key
+}
+
+// gethChain reads the blocks of go-ethereum, the ancient ones from the freezer and the rest from LevelDB
+type gethChain struct {
+	db      *leveldb.DB
+	freezer *freezer
+}
+
+// openGethChain opens the chaindata directory of go-ethereum, usually <datadir>/geth/chaindata, read-only.
+// The freezer is in its ancient subdirectory
+func openGethChain(chaindata string) (*gethChain, error) {
+	db, err := leveldb.OpenFile(chaindata, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening LevelDB of go-ethereum: %w", err)
+	}
+	f, err := openFreezer(filepath.Join(chaindata, "ancient"))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening the freezer of go-ethereum: %w", err)
+	}
+	return &gethChain{db: db, freezer: f}, nil
+}
+
+func (c *gethChain) close() {
+	c.freezer.close()
+	c.db.Close()
+}
+
+func (c *gethChain) get(key []byte) ([]byte, error) {
+	v, err := c.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// read returns the item of the block from the freezer table if the block is frozen, or from LevelDB otherwise
+func (c *gethChain) read(table string, number uint64, key []byte) ([]byte, error) {
+	if v, err := c.freezer.get(table, number); err != nil || v != nil {
+		return v, err
+	}
+	return c.get(key)
+}
+
+func (c *gethChain) canonicalHash(number uint64) (common.Hash, error) {
+	v, err := c.read(freezerHashes, number, gethCanonicalKey(number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(v) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("canonical hash of block %d not found", number)
+	}
+	return common.BytesToHash(v), nil
+}
+
+// head returns the number of the head block, which go-ethereum has the body and the receipts of
+func (c *gethChain) head() (uint64, error) {
+	hash, err := c.get(gethHeadBlockKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(hash) != common.HashLength {
+		return 0, fmt.Errorf("head block not found")
+	}
+	v, err := c.get(append([]byte("H"), hash...))
+	if err != nil {
+		return 0, err
+	}
+	if len(v) != 8 {
+		return 0, fmt.Errorf("number of the head block %x not found", hash)
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+// block reads the canonical block with its total difficulty and the receipts
+func (c *gethChain) block(number uint64) (*types.Header, *types.Body, *big.Int, types.Receipts, error) {
+	hash, err := c.canonicalHash(number)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	header := new(types.Header)
+	if err = c.decode(freezerHeaders, number, gethBlockKey('h', number, hash), header); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("header of block %d: %w", number, err)
+	}
+	if header.Hash() != hash {
+		return nil, nil, nil, nil, fmt.Errorf("header of block %d has hash %x instead of %x", number, header.Hash(), hash)
+	}
+	body := new(types.Body)
+	if err = c.decode(freezerBodies, number, gethBlockKey('b', number, hash), body); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("body of block %d: %w", number, err)
+	}
+	if txHash := types.DeriveSha(types.Transactions(body.Transactions)); txHash != header.TxHash {
+		return nil, nil, nil, nil, fmt.Errorf("transactions of block %d have root %x instead of %x", number, txHash, header.TxHash)
+	}
+	td := new(big.Int)
+	if err = c.decode(freezerDiffs, number, append(gethBlockKey('h', number, hash), 't'), td); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("total difficulty of block %d: %w", number, err)
+	}
+	var stored []*types.ReceiptForStorage
+	if err = c.decode(freezerReceipts, number, gethBlockKey('r', number, hash), &stored); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("receipts of block %d: %w", number, err)
+	}
+	receipts := make(types.Receipts, len(stored))
+	for i, r := range stored {
+		receipts[i] = (*types.Receipt)(r)
+	}
+	return header, body, td, receipts, nil
+}
+
+func (c *gethChain) decode(table string, number uint64, key []byte, val interface{}) error {
+	v, err := c.read(table, number, key)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("not found")
+	}
+	return rlp.DecodeBytes(v, val)
+}
+
+// Import imports the canonical chain of go-ethereum from its chaindata directory into the database. The genesis
+// is written with its state first, the blocks after it are imported without the state, with the progress of the
+// headers and the bodies stages set to the highest of them, so that the sync executes them next. Returns the
+// highest block imported
+func Import(ctx context.Context, gethChaindata string, db ethdb.Database, cfg Config) (uint64, error) {
+	chain, err := openGethChain(gethChaindata)
+	if err != nil {
+		return 0, err
+	}
+	defer chain.close()
+	sm, err := ethdb.GetStorageModeFromDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if err = importGenesis(chain, db, cfg.Genesis, sm); err != nil {
+		return 0, err
+	}
+
+	to := cfg.ToBlock
+	if head, err := chain.head(); err != nil {
+		return 0, err
+	} else if to == 0 || to > head {
+		to = head
+	}
+	batchBlocks := cfg.BatchBlocks
+	if batchBlocks == 0 {
+		batchBlocks = DefaultBatchBlocks
+	}
+	progress, err := stages.GetStageProgress(db, GethImport)
+	if err != nil {
+		return 0, err
+	}
+	if headers, err := stages.GetStageProgress(db, stages.Headers); err != nil {
+		return 0, err
+	} else if headers > progress {
+		return 0, fmt.Errorf("the database has the headers up to %d already, above the imported %d", headers, progress)
+	}
+
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for from := progress + 1; from <= to; from += batchBlocks {
+		batchTo := from + batchBlocks - 1
+		if batchTo > to {
+			batchTo = to
+		}
+		if err = importBlocks(ctx, chain, db, from, batchTo, sm, logEvery.C); err != nil {
+			return 0, err
+		}
+	}
+	log.Info("Imported the chain of go-ethereum", "to", to)
+	return to, nil
+}
+
+// importGenesis writes the genesis with its state, unless it is in the database already. The chain config
+// of go-ethereum is preferred over the one of the genesis, it may have the forks overridden
+func importGenesis(chain *gethChain, db ethdb.Database, genesis *core.Genesis, sm ethdb.StorageMode) error {
+	hash, err := chain.canonicalHash(0)
+	if err != nil {
+		return err
+	}
+	if have, err := rawdb.ReadCanonicalHash(db, 0); err != nil {
+		return err
+	} else if have != (common.Hash{}) {
+		if have != hash {
+			return fmt.Errorf("database has genesis %x, go-ethereum has %x", have, hash)
+		}
+		return nil
+	}
+	if genesis == nil {
+		if genesis = knownGenesis(hash); genesis == nil {
+			return fmt.Errorf("genesis %x is not of a known network, the genesis spec has to be given", hash)
+		}
+	}
+	block, _, err := genesis.Commit(db, sm.History)
+	if err != nil {
+		return err
+	}
+	if block.Hash() != hash {
+		return fmt.Errorf("genesis spec has hash %x, go-ethereum has %x", block.Hash(), hash)
+	}
+	data, err := chain.get(append(gethConfigPrefix, hash[:]...))
+	if err != nil || data == nil {
+		return err
+	}
+	var config params.ChainConfig
+	if err = json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid chain config of go-ethereum: %w", err)
+	}
+	return rawdb.WriteChainConfig(db, hash, &config)
+}
+
+func knownGenesis(hash common.Hash) *core.Genesis {
+	switch hash {
+	case params.MainnetGenesisHash:
+		return core.DefaultGenesisBlock()
+	case params.RopstenGenesisHash:
+		return core.DefaultRopstenGenesisBlock()
+	case params.RinkebyGenesisHash:
+		return core.DefaultRinkebyGenesisBlock()
+	case params.GoerliGenesisHash:
+		return core.DefaultGoerliGenesisBlock()
+	default:
+		return nil
+	}
+}
+
+// importBlocks imports the blocks in one transaction, and moves the progress to the last of them
+func importBlocks(ctx context.Context, chain *gethChain, db ethdb.Database, from, to uint64, sm ethdb.StorageMode, logEvery <-chan time.Time) error {
+	tx, err := db.Begin(ctx, ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The blocks have to follow the ones imported before, or the genesis
+	parent, err := rawdb.ReadCanonicalHash(tx, from-1)
+	if err != nil {
+		return err
+	}
+	for number := from; number <= to; number++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		header, body, td, receipts, err := chain.block(number)
+		if err != nil {
+			return err
+		}
+		if header.ParentHash != parent {
+			return fmt.Errorf("block %d is not the child of block %x", number, parent)
+		}
+		hash := header.Hash()
+		rawdb.WriteHeader(ctx, tx, header)
+		if err = rawdb.WriteTd(tx, hash, number, td); err != nil {
+			return err
+		}
+		if err = rawdb.WriteCanonicalHash(tx, hash, number); err != nil {
+			return err
+		}
+		if err = rawdb.WriteBody(tx, hash, number, body); err != nil {
+			return err
+		}
+		if sm.Receipts {
+			if err = rawdb.WriteReceipts(tx, number, receipts); err != nil {
+				return err
+			}
+		}
+		parent = hash
+
+		select {
+		case <-logEvery:
+			log.Info("Importing the chain of go-ethereum", "block", number)
+		default:
+		}
+	}
+	if err = rawdb.WriteHeadHeaderHash(tx, parent); err != nil {
+		return err
+	}
+	for _, stage := range []stages.SyncStage{stages.Headers, stages.BlockHashes, stages.Bodies, GethImport} {
+		if err = stages.SaveStageProgress(tx, stage, to); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Execute runs the stages of the sync after the bodies on the imported blocks, which builds the state and
+// the indices of turbo-geth. The seals are not verified, go-ethereum has verified them
+func Execute(ctx context.Context, db ethdb.Database, tmpdir string, batchSize datasize.ByteSize) error {
+	sm, err := ethdb.GetStorageModeFromDB(db)
+	if err != nil {
+		return err
+	}
+	genesis, err := rawdb.ReadCanonicalHash(db, 0)
+	if err != nil {
+		return err
+	}
+	chainConfig, err := rawdb.ReadChainConfig(db, genesis)
+	if err != nil {
+		return err
+	}
+	var engine consensus.Engine
+	if chainConfig.Clique != nil {
+		engine = clique.New(chainConfig.Clique, db)
+	} else if chainConfig.Aura != nil {
+		engine = aura.New(chainConfig.Aura, db)
+	} else if chainConfig.Bor != nil {
+		engine = bor.New(chainConfig, db, bor.NewHeimdallClient(ethconfig.Defaults.HeimdallURL))
+	} else {
+		engine = ethash.NewFaker()
+	}
+	cc := &core.TinyChainContext{}
+	cc.SetDB(db)
+	cc.SetEngine(engine)
+	st, err := stagedsync.New(
+		stagedsync.DefaultStages(),
+		stagedsync.DefaultUnwindOrder(),
+		stagedsync.OptionalParameters{},
+	).Prepare(nil, chainConfig, cc, &vm.Config{NoReceipts: !sm.Receipts}, db, db, "geth_import", sm, tmpdir, nil, batchSize, ctx.Done(), nil, nil, func() error { return nil }, true, nil)
+	if err != nil {
+		return err
+	}
+	// The headers and the bodies are imported, there is nothing to download
+	st.DisableStages(stages.Headers, stages.BlockHashes, stages.Bodies, stages.TxPool)
+	return st.Run(db, db)
+}
@@ -0,0 +1,213 @@
+package gethimport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	testBlocks = 10
+	testFrozen = 5 // Blocks 0..4 are in the freezer, the rest in LevelDB
+)
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender, to := crypto.PubkeyToAddress(key.PublicKey), common.Address{1}
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	source := ethdb.NewMemDatabase()
+	defer source.Close()
+	genesis := gspec.MustCommit(source)
+	signer := types.LatestSigner(gspec.Config)
+	blocks, receipts, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), source, testBlocks, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), to, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt(), nil), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.AddTx(tx)
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chaindata := filepath.Join(t.TempDir(), "chaindata")
+	writeGethChain(t, chaindata, gspec, append([]*types.Block{genesis}, blocks...), append([]types.Receipts{nil}, receipts...))
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	if err = ethdb.SetStorageModeIfNotExist(db, ethdb.DefaultStorageMode); err != nil {
+		t.Fatal(err)
+	}
+	// Interrupted in the middle, and continued
+	if head, err := Import(ctx, chaindata, db, Config{ToBlock: 7, Genesis: gspec, BatchBlocks: 3}); err != nil || head != 7 {
+		t.Fatalf("imported up to %d: %v", head, err)
+	}
+	if head, err := Import(ctx, chaindata, db, Config{Genesis: gspec, BatchBlocks: 3}); err != nil || head != testBlocks {
+		t.Fatalf("imported up to %d: %v", head, err)
+	}
+	for i, block := range blocks {
+		number := block.NumberU64()
+		if hash, _ := rawdb.ReadCanonicalHash(db, number); hash != block.Hash() {
+			t.Fatalf("block %d: canonical hash %x instead of %x", number, hash, block.Hash())
+		}
+		imported := rawdb.ReadBlock(db, block.Hash(), number)
+		if imported == nil || len(imported.Transactions()) != 1 || imported.Transactions()[0].Hash() != block.Transactions()[0].Hash() {
+			t.Fatalf("block %d not imported", number)
+		}
+		if td, _ := rawdb.ReadTd(db, block.Hash(), number); td == nil || td.Sign() == 0 {
+			t.Errorf("block %d: total difficulty %v", number, td)
+		}
+		if r := rawdb.ReadRawReceipts(db, block.Hash(), number); len(r) != 1 || r[0].CumulativeGasUsed != receipts[i][0].CumulativeGasUsed {
+			t.Errorf("block %d: receipts not imported", number)
+		}
+	}
+	if progress, _ := stages.GetStageProgress(db, stages.Bodies); progress != testBlocks {
+		t.Errorf("bodies progress %d", progress)
+	}
+
+	// The state is built by the execution, the state roots are checked against the headers
+	if err = Execute(ctx, db, t.TempDir(), 1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ := stages.GetStageProgress(db, stages.IntermediateHashes); progress != testBlocks {
+		t.Errorf("intermediate hashes progress %d", progress)
+	}
+	for i, block := range blocks {
+		if r := rawdb.ReadReceipts(db, block.Hash(), block.NumberU64()); len(r) != 1 || r[0].TxHash != receipts[i][0].TxHash {
+			t.Errorf("block %d: receipts not replaced by the executed ones", block.NumberU64())
+		}
+	}
+	acc, err := state.NewPlainStateReader(db).ReadAccountData(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc == nil || acc.Balance.Uint64() != 1000*testBlocks {
+		t.Errorf("balance of the recipient %v", acc)
+	}
+}
+
+// writeGethChain writes the blocks in the layout of go-ethereum, the first ones into the freezer
+func writeGethChain(t *testing.T, chaindata string, gspec *core.Genesis, blocks []*types.Block, receipts []types.Receipts) {
+	ldb, err := leveldb.OpenFile(chaindata, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ldb.Close()
+	put := func(key []byte, val interface{}) {
+		enc, ok := val.([]byte)
+		if !ok {
+			if enc, err = rlp.EncodeToBytes(val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = ldb.Put(key, enc, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frozen := make(map[string][][]byte)
+	freeze := func(table string, val interface{}) {
+		enc, ok := val.([]byte)
+		if !ok {
+			if enc, err = rlp.EncodeToBytes(val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		frozen[table] = append(frozen[table], enc)
+	}
+	td := new(big.Int)
+	for i, block := range blocks {
+		number, hash := block.NumberU64(), block.Hash()
+		td.Add(td, block.Difficulty())
+		stored := make([]*types.ReceiptForStorage, len(receipts[i]))
+		for j, r := range receipts[i] {
+			stored[j] = (*types.ReceiptForStorage)(r)
+		}
+		enc := make([]byte, 8)
+		binary.BigEndian.PutUint64(enc, number)
+		put(append([]byte("H"), hash[:]...), enc)
+		if number < testFrozen {
+			freeze(freezerHashes, hash[:])
+			freeze(freezerHeaders, block.Header())
+			freeze(freezerBodies, block.Body())
+			freeze(freezerReceipts, stored)
+			freeze(freezerDiffs, td)
+			continue
+		}
+		put(gethCanonicalKey(number), hash[:])
+		put(gethBlockKey('h', number, hash), block.Header())
+		put(gethBlockKey('b', number, hash), block.Body())
+		put(gethBlockKey('r', number, hash), stored)
+		put(append(gethBlockKey('h', number, hash), 't'), td)
+	}
+	put(gethHeadBlockKey, blocks[len(blocks)-1].Hash().Bytes())
+	config, err := json.Marshal(gspec.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(append(gethConfigPrefix, blocks[0].Hash().Bytes()...), config)
+
+	ancient := filepath.Join(chaindata, "ancient")
+	if err = os.MkdirAll(ancient, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for table, items := range frozen {
+		writeFreezerTable(t, ancient, table, table != freezerHashes, items)
+	}
+}
+
+// writeFreezerTable writes the items in the format of go-ethereum, two of them per data file to cross the files
+func writeFreezerTable(t *testing.T, dir, name string, compressed bool, items [][]byte) {
+	idxExt, datExt := "ridx", "rdat"
+	if compressed {
+		idxExt, datExt = "cidx", "cdat"
+	}
+	index := make([]byte, indexEntrySize) // Starts with the data file 0 and no items deleted
+	var data []byte
+	var filenum uint16
+	for i, item := range items {
+		if compressed {
+			item = snappy.Encode(nil, item)
+		}
+		if i > 0 && i%2 == 0 {
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.%04d.%s", name, filenum, datExt)), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			data, filenum = nil, filenum+1
+		}
+		data = append(data, item...)
+		entry := make([]byte, indexEntrySize)
+		binary.BigEndian.PutUint16(entry, filenum)
+		binary.BigEndian.PutUint32(entry[2:], uint32(len(data)))
+		index = append(index, entry...)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.%04d.%s", name, filenum, datExt)), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+"."+idxExt), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
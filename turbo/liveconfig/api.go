@@ -0,0 +1,34 @@
+package liveconfig
+
+import (
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// PrivateAdminAPI is the admin API changing the live settings of the node
+type PrivateAdminAPI struct {
+	s *Service
+}
+
+// APIs returns the admin_reloadConfig, admin_setConfig and admin_config methods of the service
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{{
+		Namespace: "admin",
+		Version:   "1.0",
+		Service:   &PrivateAdminAPI{s: s},
+	}}
+}
+
+// ReloadConfig reloads the live settings from the file of --config.live
+func (api *PrivateAdminAPI) ReloadConfig() ([]Change, error) {
+	return api.s.Reload("rpc")
+}
+
+// SetConfig changes one live setting
+func (api *PrivateAdminAPI) SetConfig(name, value string) ([]Change, error) {
+	return api.s.Apply(map[string]string{name: value}, "rpc")
+}
+
+// Config returns the current values of the live settings
+func (api *PrivateAdminAPI) Config() map[string]string {
+	return api.s.Settings()
+}
@@ -0,0 +1,189 @@
+// Package liveconfig changes a defined subset of the settings of the running node, so that the operators don't have
+// to restart a node in the middle of a multi-day sync to flip a knob. The settings are reloaded from a JSON file on
+// SIGHUP or on admin_reloadConfig, or changed one by one with admin_setConfig, and every change is audited.
+package liveconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// Setting is a setting of the node which can be changed while it runs
+type Setting struct {
+	Name string
+	// Get returns the current value
+	Get func() string
+	// Parse validates the value and returns the function applying it, so that all the values of a reload are
+	// validated before any of them is applied
+	Parse func(value string) (apply func(), err error)
+}
+
+// Change is a record of the audit log
+type Change struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Setting string    `json:"setting"`
+	Old     string    `json:"old"`
+	New     string    `json:"new"`
+}
+
+// Service holds the settings which can be changed while the node runs
+type Service struct {
+	path      string // JSON file of the settings, empty if they are only changed through the RPC
+	auditPath string // JSON lines file the changes are appended to, empty to only log them
+
+	lock     sync.Mutex
+	settings map[string]*Setting
+}
+
+// New creates the service reloading the settings from the JSON object in the file at the path
+func New(path, auditPath string) *Service {
+	return &Service{path: path, auditPath: auditPath, settings: make(map[string]*Setting)}
+}
+
+// Register adds the settings to the service, their names have to be unique
+func (s *Service) Register(settings ...*Setting) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, setting := range settings {
+		if _, ok := s.settings[setting.Name]; ok {
+			panic(fmt.Sprintf("live setting %s is registered twice", setting.Name))
+		}
+		s.settings[setting.Name] = setting
+	}
+}
+
+// Settings returns the current values of the settings
+func (s *Service) Settings() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	values := make(map[string]string, len(s.settings))
+	for name, setting := range s.settings {
+		values[name] = setting.Get()
+	}
+	return values
+}
+
+// Reload applies the settings of the file. The settings missing from the file keep their current values
+func (s *Service) Reload(source string) ([]Change, error) {
+	if s.path == "" {
+		return nil, fmt.Errorf("no live config file, see --config.live")
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := ParseValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return s.Apply(values, source)
+}
+
+// ParseValues parses the JSON object of the values of the settings, the values can be strings, numbers or booleans
+func ParseValues(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		if v = bytes.TrimSpace(v); len(v) == 0 || v[0] == '{' || v[0] == '[' || string(v) == "null" {
+			return nil, fmt.Errorf("invalid value of %s: %s", name, v)
+		}
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			values[name] = str
+			continue
+		}
+		values[name] = string(v)
+	}
+	return values, nil
+}
+
+// Apply validates all the values and applies them only if they are all valid, the changes are returned and audited
+func (s *Service) Apply(values map[string]string, source string) ([]Change, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	applies := make([]func(), len(names))
+	for i, name := range names {
+		setting, ok := s.settings[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown live setting %s", name)
+		}
+		apply, err := setting.Parse(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		applies[i] = apply
+	}
+
+	var changes []Change
+	now := time.Now().UTC()
+	for i, name := range names {
+		old := s.settings[name].Get()
+		applies[i]()
+		if current := s.settings[name].Get(); current != old {
+			changes = append(changes, Change{Time: now, Source: source, Setting: name, Old: old, New: current})
+		}
+	}
+	s.audit(changes)
+	return changes, nil
+}
+
+func (s *Service) audit(changes []Change) {
+	for _, c := range changes {
+		log.Info("Live setting changed", "setting", c.Setting, "old", c.Old, "new", c.New, "source", c.Source)
+	}
+	if s.auditPath == "" || len(changes) == 0 {
+		return
+	}
+	f, err := os.OpenFile(s.auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Warn("Failed to write the audit log of the live settings", "path", s.auditPath, "err", err)
+		return
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, c := range changes {
+		if err = enc.Encode(c); err != nil {
+			log.Warn("Failed to write the audit log of the live settings", "path", s.auditPath, "err", err)
+			return
+		}
+	}
+}
+
+// ReloadOnSignal reloads the settings on every SIGHUP until the quit channel is closed
+func (s *Service) ReloadOnSignal(quit <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-sighup:
+				if _, err := s.Reload("sighup"); err != nil {
+					log.Error("Failed to reload the live settings", "err", err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,89 @@
+package liveconfig
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intSetting(name string, value *int) *Setting {
+	return &Setting{
+		Name: name,
+		Get:  func() string { return strconv.Itoa(*value) },
+		Parse: func(s string) (func(), error) {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("expected a non-negative integer")
+			}
+			return func() { *value = v }, nil
+		},
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "liveconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path, auditPath := filepath.Join(dir, "live.json"), filepath.Join(dir, "audit.log")
+
+	verbosity, slots := 3, 16
+	s := New(path, auditPath)
+	s.Register(intSetting("verbosity", &verbosity), intSetting("txpool.globalslots", &slots))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"verbosity": 4, "txpool.globalslots": "16"}`), 0600))
+	changes, err := s.Reload("sighup")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "verbosity", changes[0].Setting)
+	assert.Equal(t, "3", changes[0].Old)
+	assert.Equal(t, "4", changes[0].New)
+	assert.Equal(t, "sighup", changes[0].Source)
+	assert.Equal(t, 4, verbosity)
+	assert.Equal(t, map[string]string{"verbosity": "4", "txpool.globalslots": "16"}, s.Settings())
+
+	// Nothing is applied if any of the values is invalid
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"verbosity": 5, "txpool.globalslots": -1}`), 0600))
+	_, err = s.Reload("sighup")
+	assert.Error(t, err)
+	assert.Equal(t, 4, verbosity)
+	_, err = s.Apply(map[string]string{"verbosity": "5", "rpc.unknown": "1"}, "rpc")
+	assert.Error(t, err)
+	assert.Equal(t, 4, verbosity)
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"verbosity": [5]}`), 0600))
+	_, err = s.Reload("sighup")
+	assert.Error(t, err)
+
+	changes, err = s.Apply(map[string]string{"txpool.globalslots": "8192"}, "rpc")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, 8192, slots)
+
+	// The audit log has all the changes
+	f, err := os.Open(auditPath)
+	require.NoError(t, err)
+	defer f.Close()
+	var audited []Change
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c Change
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &c))
+		audited = append(audited, c)
+	}
+	require.Len(t, audited, 2)
+	assert.Equal(t, "verbosity", audited[0].Setting)
+	assert.Equal(t, "txpool.globalslots", audited[1].Setting)
+	assert.Equal(t, "16", audited[1].Old)
+	assert.Equal(t, "8192", audited[1].New)
+	assert.Equal(t, "rpc", audited[1].Source)
+
+	_, err = New("", "").Reload("rpc")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package node
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/holiman/uint256"
+	tgdebug "github.com/ledgerwatch/turbo-geth/common/debug"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/internal/debug"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/liveconfig"
+)
+
+// liveSettings are the settings of the node which can be changed while it runs, they are named after their flags
+func liveSettings(sync *stagedsync.StagedSync, ethereum *eth.Ethereum, watchdog *tgdebug.StallWatchdog) []*liveconfig.Setting {
+	settings := []*liveconfig.Setting{
+		{
+			Name: "verbosity",
+			Get:  func() string { return strconv.Itoa(debug.CurrentVerbosity()) },
+			Parse: func(value string) (func(), error) {
+				level, err := strconv.Atoi(value)
+				if err != nil || level < int(log.LvlCrit) || level > int(log.LvlTrace) {
+					return nil, fmt.Errorf("expected a level from %d to %d", log.LvlCrit, log.LvlTrace)
+				}
+				return func() { debug.Handler.Verbosity(level) }, nil
+			},
+		},
+		{
+			Name: "vmodule",
+			Get:  debug.CurrentVmodule,
+			Parse: func(value string) (func(), error) {
+				// Validated on a scratch handler, so the applied ruleset always parses
+				if err := log.NewGlogHandler(nil).Vmodule(value); err != nil {
+					return nil, err
+				}
+				return func() { _ = debug.Handler.Vmodule(value) }, nil
+			},
+		},
+		{
+			Name: "stall.threshold",
+			Get:  func() string { return watchdog.Threshold().String() },
+			Parse: func(value string) (func(), error) {
+				threshold, err := time.ParseDuration(value)
+				if err != nil || threshold < 0 {
+					return nil, fmt.Errorf("expected a non-negative duration")
+				}
+				return func() { watchdog.SetThreshold(threshold) }, nil
+			},
+		},
+		{
+			Name: "retention",
+			Get: func() string {
+				var items []string
+				for _, r := range sync.Retentions() {
+					items = append(items, fmt.Sprintf("%s=%d", r.Bucket, r.Blocks))
+				}
+				return strings.Join(items, ",")
+			},
+			Parse: func(value string) (func(), error) {
+				retentions, err := stagedsync.ParseRetentions(value)
+				if err != nil {
+					return nil, err
+				}
+				return func() { sync.SetRetentions(retentions) }, nil
+			},
+		},
+		{
+			Name: "rpc.gascap",
+			Get:  func() string { return strconv.FormatUint(ethereum.APIBackend.RPCGasCap(), 10) },
+			Parse: func(value string) (func(), error) {
+				gasCap, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				return func() { ethereum.APIBackend.SetRPCGasCap(gasCap) }, nil
+			},
+		},
+		{
+			Name: "rpc.txfeecap",
+			Get:  func() string { return strconv.FormatFloat(ethereum.APIBackend.RPCTxFeeCap(), 'f', -1, 64) },
+			Parse: func(value string) (func(), error) {
+				feeCap, err := strconv.ParseFloat(value, 64)
+				if err != nil || feeCap < 0 {
+					return nil, fmt.Errorf("expected a non-negative number of ethers")
+				}
+				return func() { ethereum.APIBackend.SetRPCTxFeeCap(feeCap) }, nil
+			},
+		},
+		{
+			Name: "txpool.pricelimit",
+			Get:  func() string { return ethereum.TxPool().GasPrice().ToBig().String() },
+			Parse: func(value string) (func(), error) {
+				bigPrice, ok := new(big.Int).SetString(value, 10)
+				if !ok || bigPrice.Sign() <= 0 {
+					return nil, fmt.Errorf("expected a positive number of wei")
+				}
+				price, overflow := uint256.FromBig(bigPrice)
+				if overflow {
+					return nil, fmt.Errorf("price overflows 256 bits")
+				}
+				return func() { ethereum.TxPool().SetGasPrice(price) }, nil
+			},
+		},
+		{
+			Name: "txpool.lifetime",
+			Get:  func() string { return ethereum.TxPool().Limits().Lifetime.String() },
+			Parse: func(value string) (func(), error) {
+				lifetime, err := time.ParseDuration(value)
+				if err != nil || lifetime <= 0 {
+					return nil, fmt.Errorf("expected a positive duration")
+				}
+				return func() {
+					limits := ethereum.TxPool().Limits()
+					limits.Lifetime = lifetime
+					ethereum.TxPool().SetLimits(limits)
+				}, nil
+			},
+		},
+	}
+	slotLimits := map[string]func(*core.TxPoolLimits) *uint64{
+		"txpool.accountslots": func(l *core.TxPoolLimits) *uint64 { return &l.AccountSlots },
+		"txpool.globalslots":  func(l *core.TxPoolLimits) *uint64 { return &l.GlobalSlots },
+		"txpool.accountqueue": func(l *core.TxPoolLimits) *uint64 { return &l.AccountQueue },
+		"txpool.globalqueue":  func(l *core.TxPoolLimits) *uint64 { return &l.GlobalQueue },
+	}
+	for name, field := range slotLimits {
+		field := field
+		settings = append(settings, &liveconfig.Setting{
+			Name: name,
+			Get: func() string {
+				limits := ethereum.TxPool().Limits()
+				return strconv.FormatUint(*field(&limits), 10)
+			},
+			Parse: func(value string) (func(), error) {
+				slots, err := strconv.ParseUint(value, 10, 64)
+				if err != nil || slots == 0 {
+					return nil, fmt.Errorf("expected a positive number of slots")
+				}
+				return func() {
+					limits := ethereum.TxPool().Limits()
+					*field(&limits) = slots
+					ethereum.TxPool().SetLimits(limits)
+				}, nil
+			},
+		})
+	}
+	return settings
+}
@@ -0,0 +1,54 @@
+package node
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/internal/debug"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/turbo/liveconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVmoduleLiveSetting(t *testing.T) {
+	// The records reaching the root handler of the debug package, filtered by its verbosity
+	glogger, ok := log.Root().GetHandler().(*log.GlogHandler)
+	require.True(t, ok)
+	var logged []string
+	glogger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		logged = append(logged, r.Msg)
+		return nil
+	}))
+	defer glogger.SetHandler(log.DiscardHandler())
+	defer debug.Handler.Vmodule("") //nolint:errcheck
+	glogger.Verbosity(log.LvlInfo)
+
+	var settings []*liveconfig.Setting
+	for _, setting := range liveSettings(nil, nil, nil) {
+		if setting.Name == "vmodule" {
+			settings = append(settings, setting)
+		}
+	}
+	require.Len(t, settings, 1)
+	dir := t.TempDir()
+	s := liveconfig.New(filepath.Join(dir, "live.json"), filepath.Join(dir, "audit.log"))
+	s.Register(settings...)
+
+	log.Debug("Before the change")
+	changes, err := s.Apply(map[string]string{"vmodule": "live_settings_test.go=4"}, "rpc")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "", changes[0].Old)
+	assert.Equal(t, "live_settings_test.go=4", changes[0].New)
+	assert.Equal(t, "live_settings_test.go=4", debug.CurrentVmodule())
+	log.Debug("After the change")
+
+	// An invalid ruleset is rejected and the current one stays
+	_, err = s.Apply(map[string]string{"vmodule": "live_settings_test.go=x"}, "rpc")
+	assert.Error(t, err)
+	assert.Equal(t, "live_settings_test.go=4", debug.CurrentVmodule())
+	log.Debug("After the rejected change")
+
+	assert.Equal(t, []string{"Live setting changed", "After the change", "After the rejected change"}, logged)
+}
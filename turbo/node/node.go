@@ -4,20 +4,23 @@ package node
 import (
 	"math"
 	"net"
-	"runtime/debug"
+	godebug "runtime/debug"
 	"strconv"
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/eth"
 	"github.com/ledgerwatch/turbo-geth/eth/ethconfig"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/metrics"
 	"github.com/ledgerwatch/turbo-geth/node"
 	"github.com/ledgerwatch/turbo-geth/params"
 	turbocli "github.com/ledgerwatch/turbo-geth/turbo/cli"
+	"github.com/ledgerwatch/turbo-geth/turbo/liveconfig"
 
 	"github.com/urfave/cli"
 
@@ -27,8 +30,10 @@ import (
 // TurboGethNode represents a single node, that runs sync and p2p network.
 // it also can export the private endpoint for RPC daemon, etc.
 type TurboGethNode struct {
-	stack   *node.Node
-	backend *eth.Ethereum
+	stack      *node.Node
+	backend    *eth.Ethereum       // nil in the safe read-only mode
+	liveConfig *liveconfig.Service // nil in the safe read-only mode
+	watchdog   *debug.StallWatchdog
 }
 
 func (tg *TurboGethNode) SetP2PListenFunc(listenFunc func(network, addr string) (net.Listener, error)) {
@@ -41,6 +46,16 @@ func (tg *TurboGethNode) Serve() error {
 
 	tg.run()
 
+	quitWatchdog := make(chan struct{})
+	defer close(quitWatchdog)
+	go tg.watchdog.Run(quitWatchdog)
+
+	if tg.liveConfig != nil {
+		quit := make(chan struct{})
+		defer close(quit)
+		tg.liveConfig.ReloadOnSignal(quit)
+	}
+
 	tg.stack.Wait()
 
 	return nil
@@ -62,6 +77,8 @@ type Params struct {
 	GitCommit     string
 	GitBranch     string
 	CustomBuckets dbutils.BucketsCfg
+	Ancients      ethdb.AncientReader    // the store of the ancient blocks moved out of the database, if any
+	Changesets    ethdb.ChangesetArchive // the archive of the changesets pruned from the database, if any
 }
 
 // New creates a new `TurboGethNode`.
@@ -80,12 +97,44 @@ func New(
 	ethConfig := makeEthConfig(ctx, node)
 
 	ethConfig.StagedSync = sync
+	ethConfig.Ancients = optionalParams.Ancients
+	ethConfig.Changesets = optionalParams.Changesets
+
+	stallsDir, err := node.ResolvePath("stalls")
+	if err != nil {
+		utils.Fatalf("Failed to resolve the directory of the stall profiles: %v", err)
+	}
+	watchdog := debug.NewStallWatchdog(stallsDir, ctx.GlobalDuration(turbocli.StallThresholdFlag.Name), ctx.GlobalInt(turbocli.StallKeepFlag.Name))
+	debug.SetStallWatchdog(watchdog)
+
+	if node.SafeMode() {
+		// Nothing can be synced into the datadir, only its database is served
+		replica, err := eth.NewReplica(node, ethConfig)
+		if err != nil {
+			utils.Fatalf("Failed to serve the read-only database: %v", err)
+		}
+		metrics.AddCallback(replica.ChainKV().CollectMetrics)
+		return &TurboGethNode{stack: node, watchdog: watchdog}
+	}
 
 	ethereum := utils.RegisterEthService(node, ethConfig)
 
 	metrics.AddCallback(ethereum.ChainKV().CollectMetrics)
 
-	return &TurboGethNode{stack: node, backend: ethereum}
+	auditPath, err := node.ResolvePath("live_config_audit.log")
+	if err != nil {
+		utils.Fatalf("Failed to resolve the audit log of the live settings: %v", err)
+	}
+	liveConfig := liveconfig.New(ctx.GlobalString(turbocli.LiveConfigFlag.Name), auditPath)
+	liveConfig.Register(liveSettings(sync, ethereum, watchdog)...)
+	node.RegisterAPIs(liveConfig.APIs())
+	if ctx.GlobalIsSet(turbocli.LiveConfigFlag.Name) {
+		if _, err := liveConfig.Reload("startup"); err != nil {
+			utils.Fatalf("Failed to apply the live settings: %v", err)
+		}
+	}
+
+	return &TurboGethNode{stack: node, backend: ethereum, liveConfig: liveConfig, watchdog: watchdog}
 }
 
 func makeEthConfig(ctx *cli.Context, node *node.Node) *ethconfig.Config {
@@ -125,16 +174,23 @@ func makeConfigNode(config *node.Config) *node.Node {
 // This function should be called before launching devp2p stack.
 func prepare(ctx *cli.Context) {
 	// If we're running a known preset, log it for convenience.
+	chain := utils.ChainName(ctx)
 	switch {
-	case ctx.GlobalIsSet(utils.RopstenFlag.Name):
+	case chain == params.RopstenChainName:
 		log.Info("Starting Turbo-Geth on Ropsten testnet...")
 
-	case ctx.GlobalIsSet(utils.RinkebyFlag.Name):
+	case chain == params.RinkebyChainName:
 		log.Info("Starting Turbo-Geth on Rinkeby testnet...")
 
-	case ctx.GlobalIsSet(utils.GoerliFlag.Name):
+	case chain == params.GoerliChainName:
 		log.Info("Starting Turbo-Geth on Görli testnet...")
 
+	case chain == params.BorMainnetChainName:
+		log.Info("Starting Turbo-Geth on Polygon mainnet...")
+
+	case chain == params.MumbaiChainName:
+		log.Info("Starting Turbo-Geth on Mumbai testnet...")
+
 	case ctx.GlobalIsSet(utils.DeveloperFlag.Name):
 		log.Info("Starting Turbo-Geth in ephemeral dev mode...")
 
@@ -144,7 +200,7 @@ func prepare(ctx *cli.Context) {
 	// If we're a full node on mainnet without --cache specified, bump default cache allowance
 	if !ctx.GlobalIsSet(utils.CacheFlag.Name) && !ctx.GlobalIsSet(utils.NetworkIdFlag.Name) {
 		// Make sure we're not on any supported preconfigured testnet either
-		if !ctx.GlobalIsSet(utils.RopstenFlag.Name) && !ctx.GlobalIsSet(utils.RinkebyFlag.Name) && !ctx.GlobalIsSet(utils.GoerliFlag.Name) && !ctx.GlobalIsSet(utils.DeveloperFlag.Name) {
+		if (chain == "" || chain == params.MainnetChainName) && !ctx.GlobalIsSet(utils.DeveloperFlag.Name) {
 			// Nope, we're really on mainnet. Bump that cache up!
 			log.Info("Bumping default cache on mainnet", "provided", ctx.GlobalInt(utils.CacheFlag.Name), "updated", 4096)
 			ctx.GlobalSet(utils.CacheFlag.Name, strconv.Itoa(4096)) //nolint:errcheck
@@ -175,7 +231,7 @@ func prepare(ctx *cli.Context) {
 	gogc := math.Max(20, math.Min(100, 100/(float64(cache)/1024)))
 
 	log.Debug("Sanitizing Go's GC trigger", "percent", int(gogc))
-	debug.SetGCPercent(int(gogc))
+	godebug.SetGCPercent(int(gogc))
 
 	// Start system runtime metrics collection
 	go metrics.CollectProcessMetrics(10 * time.Second)
@@ -0,0 +1,154 @@
+package segments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// Freezer moves the canonical blocks older than the threshold out of the database into the segments of the store.
+// The headers, the bodies with their transactions and the receipts are moved, the canonical hashes, the hash to
+// number mappings, the total difficulties, the senders and the logs stay in the database
+type Freezer struct {
+	store     *Store
+	threshold uint64
+}
+
+// NewFreezer creates the freezer of the blocks older than threshold blocks. The threshold can not be lower
+// than params.FullImmutabilityThreshold, the frozen blocks can not be unwound
+func NewFreezer(store *Store, threshold uint64) (*Freezer, error) {
+	if threshold < params.FullImmutabilityThreshold {
+		return nil, fmt.Errorf("ancient threshold %d is lower than the immutability threshold %d", threshold, params.FullImmutabilityThreshold)
+	}
+	return &Freezer{store: store, threshold: threshold}, nil
+}
+
+// Freeze moves the next segment of the blocks out of the database if all of them are older than the threshold
+// relative to the head. At most one segment is frozen per call, so that the sync cycle is not held for long.
+// The segment files are synced before the blocks are deleted, the deletion is committed with the transaction
+// of the database. If it is lost, the blocks of the last segment are deleted again by the next call
+func (f *Freezer) Freeze(logPrefix string, db ethdb.Database, head uint64, quit <-chan struct{}) error {
+	from := f.store.Frozen()
+	if from > 0 {
+		hash, err := rawdb.ReadCanonicalHash(db, from-1)
+		if err != nil {
+			return err
+		}
+		if has, err := db.Has(dbutils.HeadersBucket, dbutils.HeaderKey(from-1, hash)); err != nil {
+			return err
+		} else if has {
+			if err = deleteBlocks(db, from-segmentSize, from, quit); err != nil {
+				return err
+			}
+		}
+	}
+	if from+segmentSize-1+f.threshold > head {
+		return nil
+	}
+	start := time.Now()
+	for _, kind := range Kinds {
+		if err := writeSegment(db, f.store.dir, kind, from, quit); err != nil {
+			return fmt.Errorf("[%s] freezing %s of blocks %d-%d: %w", logPrefix, kind, from, from+segmentSize, err)
+		}
+	}
+	if err := f.store.add(from); err != nil {
+		return err
+	}
+	if err := deleteBlocks(db, from, from+segmentSize, quit); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("[%s] Froze ancient blocks", logPrefix), "from", from, "to", from+segmentSize, "in", time.Since(start))
+	return nil
+}
+
+func writeSegment(db ethdb.Database, dir, kind string, from uint64, quit <-chan struct{}) error {
+	w, err := NewWriter(SegmentPath(dir, kind, from), from)
+	if err != nil {
+		return err
+	}
+	for number := from; number < from+segmentSize; number++ {
+		if err = common.Stopped(quit); err != nil {
+			w.Abort()
+			return err
+		}
+		var record []byte
+		if record, err = readRecord(db, kind, number); err == nil {
+			err = w.Append(record)
+		}
+		if err != nil {
+			w.Abort()
+			return err
+		}
+	}
+	return w.Finish()
+}
+
+// readRecord reads the data of the canonical block from the database, the body is stored with its transactions
+func readRecord(db ethdb.Database, kind string, number uint64) ([]byte, error) {
+	hash, err := rawdb.ReadCanonicalHash(db, number)
+	if err != nil {
+		return nil, err
+	}
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("canonical hash of block %d not found", number)
+	}
+	switch kind {
+	case rawdb.AncientHeaders:
+		data, err := db.Get(dbutils.HeadersBucket, dbutils.HeaderKey(number, hash))
+		if err != nil {
+			return nil, fmt.Errorf("header of block %d: %w", number, err)
+		}
+		return data, nil
+	case rawdb.AncientBodies:
+		body := rawdb.ReadBody(db, hash, number)
+		if body == nil {
+			return nil, fmt.Errorf("body of block %d not found", number)
+		}
+		return rlp.EncodeToBytes(body)
+	case rawdb.AncientReceipts:
+		data, err := db.Get(dbutils.BlockReceiptsPrefix, dbutils.ReceiptsKey(number))
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return nil, err
+		}
+		return data, nil // Empty if the receipts are not stored
+	}
+	return nil, fmt.Errorf("unknown kind %s", kind)
+}
+
+// deleteBlocks deletes the frozen data of the canonical blocks from the database
+func deleteBlocks(db ethdb.Database, from, to uint64, quit <-chan struct{}) error {
+	for number := from; number < to; number++ {
+		if err := common.Stopped(quit); err != nil {
+			return err
+		}
+		hash, err := rawdb.ReadCanonicalHash(db, number)
+		if err != nil {
+			return err
+		}
+		if _, baseTxId, txAmount := rawdb.ReadBodyWithoutTransactions(db, hash, number); txAmount > 0 {
+			for id := baseTxId; id < baseTxId+uint64(txAmount); id++ {
+				if err = db.Delete(dbutils.EthTx, dbutils.EncodeBlockNumber(id), nil); err != nil {
+					return err
+				}
+			}
+		}
+		if err = db.Delete(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(number, hash), nil); err != nil {
+			return err
+		}
+		if err = db.Delete(dbutils.HeadersBucket, dbutils.HeaderKey(number, hash), nil); err != nil {
+			return err
+		}
+		if err = db.Delete(dbutils.BlockReceiptsPrefix, dbutils.ReceiptsKey(number), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package segments keeps the data of the ancient blocks in the immutable, memory-mapped segment files
+// outside of the database. Every segment file holds the records of one kind (headers, bodies or receipts)
+// for SegmentSize consecutive blocks:
+//
+//	record 0 | record 1 | ... | index | footer
+//
+// The index holds the offset and the CRC32 checksum of every record, the footer holds the first block
+// of the segment, the number of the records, the offset and the checksum of the index
+package segments
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+const (
+	// SegmentSize is the number of the blocks in one segment file
+	SegmentSize = 100_000
+
+	indexEntrySize = 8 + 4 // offset, checksum
+	footerSize     = 8 + 8 + 8 + 4 + 4
+	magic          = 0x54475347 // "TGSG"
+)
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	segmentSize uint64 = SegmentSize // Lowered by the tests
+
+	ErrCorrupted = errors.New("segment file is corrupted")
+)
+
+// Segment is a memory-mapped segment file, it is safe for the concurrent use until closed
+type Segment struct {
+	path  string
+	from  uint64
+	count uint64
+	file  *os.File
+	data  mmap.MMap
+	index []byte // Slice of data
+	end   uint64 // Offset of the index, the end of the last record
+}
+
+// OpenSegment maps the segment file into the memory and checks its footer and its index
+func OpenSegment(path string) (*Segment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() < footerSize {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w: %d bytes is too short", path, ErrCorrupted, info.Size())
+	}
+	data, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s := &Segment{path: path, file: file, data: data}
+	if err = s.readFooter(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *Segment) readFooter() error {
+	footer := s.data[len(s.data)-footerSize:]
+	if binary.BigEndian.Uint32(footer[28:]) != magic {
+		return fmt.Errorf("%w: bad magic", ErrCorrupted)
+	}
+	s.from = binary.BigEndian.Uint64(footer)
+	s.count = binary.BigEndian.Uint64(footer[8:])
+	s.end = binary.BigEndian.Uint64(footer[16:])
+	if s.end+s.count*indexEntrySize != uint64(len(s.data)-footerSize) {
+		return fmt.Errorf("%w: index of %d records at %d does not fit", ErrCorrupted, s.count, s.end)
+	}
+	s.index = s.data[s.end : len(s.data)-footerSize]
+	if crc32.Checksum(s.index, castagnoli) != binary.BigEndian.Uint32(footer[24:]) {
+		return fmt.Errorf("%w: index checksum mismatch", ErrCorrupted)
+	}
+	return nil
+}
+
+// From returns the first block of the segment
+func (s *Segment) From() uint64 { return s.from }
+
+// To returns the block after the last one of the segment
+func (s *Segment) To() uint64 { return s.from + s.count }
+
+// Path returns the path of the segment file
+func (s *Segment) Path() string { return s.path }
+
+// Get returns the copy of the record of the block, checking its checksum. Empty records are stored for
+// the blocks without the data, e.g. the receipts when they were not written
+func (s *Segment) Get(number uint64) ([]byte, error) {
+	if number < s.from || number >= s.To() {
+		return nil, fmt.Errorf("block %d is out of the segment %d-%d", number, s.from, s.To())
+	}
+	i := (number - s.from) * indexEntrySize
+	start := binary.BigEndian.Uint64(s.index[i:])
+	sum := binary.BigEndian.Uint32(s.index[i+8:])
+	end := s.end
+	if number+1 < s.To() {
+		end = binary.BigEndian.Uint64(s.index[i+indexEntrySize:])
+	}
+	if start > end || end > s.end {
+		return nil, fmt.Errorf("%s: %w: record of block %d at %d-%d", s.path, ErrCorrupted, number, start, end)
+	}
+	record := s.data[start:end]
+	if crc32.Checksum(record, castagnoli) != sum {
+		return nil, fmt.Errorf("%s: %w: checksum mismatch of block %d", s.path, ErrCorrupted, number)
+	}
+	if len(record) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), record...), nil
+}
+
+// Close unmaps the segment file, the records returned before stay valid
+func (s *Segment) Close() error {
+	err := s.data.Unmap()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Writer appends the records to the new segment file. The file only appears at its path, read-only,
+// once it is completely written and synced to the disk
+type Writer struct {
+	path   string
+	from   uint64
+	file   *os.File
+	w      *bufio.Writer
+	offset uint64
+	index  []byte
+}
+
+// NewWriter creates the segment file starting at the block from
+func NewWriter(path string, from uint64) (*Writer, error) {
+	file, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, from: from, file: file, w: bufio.NewWriterSize(file, 1<<20)}, nil
+}
+
+// Append writes the record of the next block
+func (w *Writer) Append(record []byte) error {
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], w.offset)
+	binary.BigEndian.PutUint32(entry[8:], crc32.Checksum(record, castagnoli))
+	w.index = append(w.index, entry[:]...)
+	if _, err := w.w.Write(record); err != nil {
+		return err
+	}
+	w.offset += uint64(len(record))
+	return nil
+}
+
+// Finish writes the index and the footer, and moves the synced file to its path
+func (w *Writer) Finish() error {
+	var footer [footerSize]byte
+	binary.BigEndian.PutUint64(footer[:], w.from)
+	binary.BigEndian.PutUint64(footer[8:], uint64(len(w.index)/indexEntrySize))
+	binary.BigEndian.PutUint64(footer[16:], w.offset)
+	binary.BigEndian.PutUint32(footer[24:], crc32.Checksum(w.index, castagnoli))
+	binary.BigEndian.PutUint32(footer[28:], magic)
+	if _, err := w.w.Write(w.index); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(footer[:]); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(w.path+".tmp", 0444); err != nil {
+		return err
+	}
+	return os.Rename(w.path+".tmp", w.path)
+}
+
+// Abort removes the unfinished segment file
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.path + ".tmp")
+}
@@ -0,0 +1,193 @@
+package segments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/u256"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestSegment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.seg")
+	records := [][]byte{[]byte("first"), nil, []byte("third"), bytes.Repeat([]byte{1}, 1000)}
+	w, err := NewWriter(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err = w.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenSegment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.From() != 10 || s.To() != 14 {
+		t.Fatalf("segment has blocks %d-%d", s.From(), s.To())
+	}
+	for i, record := range records {
+		have, err := s.Get(10 + uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, record) {
+			t.Errorf("record %d: have %x, want %x", i, have, record)
+		}
+	}
+	if _, err = s.Get(14); err == nil {
+		t.Errorf("expected an error for the block out of the segment")
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A flipped bit of a record is only detected when the record is read
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len("first")+1] ^= 1
+	broken := filepath.Join(t.TempDir(), "broken.seg")
+	if err = os.WriteFile(broken, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenSegment(broken); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err = s.Get(10); err != nil {
+		t.Errorf("unexpected error for the intact record: %v", err)
+	}
+	if _, err = s.Get(12); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected the corrupted record, got %v", err)
+	}
+
+	// A flipped bit of the index is detected when the segment is opened
+	data[len(data)-footerSize-1] ^= 1
+	if err = os.WriteFile(broken, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenSegment(broken); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected the corrupted index, got %v", err)
+	}
+}
+
+func TestFreezer(t *testing.T) {
+	defer func(size uint64) { segmentSize = size }(segmentSize)
+	segmentSize = 10
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	blocks := writeChain(t, db, 30)
+
+	dir := t.TempDir()
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	kv := db.KV()
+	db.SetKV(ethdb.NewAncientsKV(kv, store))
+	freezer := &Freezer{store: store, threshold: 5}
+
+	for i := 0; i < 3; i++ {
+		if err = freezer.Freeze("test", db, 29, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if frozen := store.Frozen(); frozen != 20 {
+		t.Fatalf("frozen %d blocks instead of 20", frozen)
+	}
+	for _, block := range blocks {
+		n, hash := block.NumberU64(), block.Hash()
+		if has, _ := db.Has(dbutils.HeadersBucket, dbutils.HeaderKey(n, hash)); has != (n >= 20) {
+			t.Errorf("block %d: header in the database %t", n, has)
+		}
+		have := rawdb.ReadBlock(db, hash, n)
+		if have == nil {
+			t.Fatalf("block %d not found", n)
+		}
+		if have.Hash() != hash || types.DeriveSha(have.Transactions()) != block.TxHash() {
+			t.Errorf("block %d: read %x with %d transactions", n, have.Hash(), len(have.Transactions()))
+		}
+		if !rawdb.HasHeader(db, hash, n) || !rawdb.HasBody(db, hash, n) {
+			t.Errorf("block %d: not found by HasHeader or HasBody", n)
+		}
+		receipts := rawdb.ReadRawReceipts(db, hash, n)
+		if len(receipts) != 1 || receipts[0].CumulativeGasUsed != n {
+			t.Errorf("block %d: read receipts %v", n, receipts)
+		}
+	}
+	var txs int
+	if err = db.Walk(dbutils.EthTx, nil, 0, func(k, v []byte) (bool, error) {
+		txs++
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if txs != 10 {
+		t.Errorf("%d transactions left in the database instead of 10", txs)
+	}
+	if header := rawdb.ReadHeader(db, common.Hash{1}, 5); header != nil {
+		t.Errorf("frozen header read by the non-canonical hash")
+	}
+	if header := rawdb.ReadHeaderByNumber(ethdb.NewObjectDatabase(kv), 5); header != nil {
+		t.Errorf("frozen header read from the database without the ancient store")
+	}
+
+	// The segments written by another process are picked up
+	store.Close()
+	if store, err = OpenStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	db.SetKV(ethdb.NewAncientsKV(kv, store))
+	if frozen := store.Frozen(); frozen != 20 {
+		t.Fatalf("reopened with %d blocks instead of 20", frozen)
+	}
+	if header := rawdb.ReadHeaderByNumber(db, 15); header == nil || header.Hash() != blocks[15].Hash() {
+		t.Errorf("frozen header not read after reopening")
+	}
+}
+
+func writeChain(t *testing.T, db ethdb.Database, n int) []*types.Block {
+	var blocks []*types.Block
+	parent := common.Hash{}
+	for i := 0; i < n; i++ {
+		txs := []*types.Transaction{types.NewTransaction(uint64(i), common.Address{byte(i)}, u256.Num1, 21000, u256.Num1, nil)}
+		header := &types.Header{
+			Number:     big.NewInt(int64(i)),
+			ParentHash: parent,
+			Difficulty: big.NewInt(1),
+			TxHash:     types.DeriveSha(types.Transactions(txs)),
+			UncleHash:  types.EmptyUncleHash,
+		}
+		block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+		if err := rawdb.WriteBlock(context.Background(), db, block); err != nil {
+			t.Fatal(err)
+		}
+		if err := rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatal(err)
+		}
+		receipts := types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: uint64(i)}}
+		if err := rawdb.WriteReceipts(db, block.NumberU64(), receipts); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+		parent = block.Hash()
+	}
+	return blocks
+}
@@ -0,0 +1,138 @@
+package segments
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// Kinds are the kinds of the data frozen into the segments, every block is frozen with all of them
+var Kinds = []string{rawdb.AncientHeaders, rawdb.AncientBodies, rawdb.AncientReceipts}
+
+const reloadInterval = time.Second
+
+// Store is the directory of the segment files, it implements rawdb.AncientReader.
+// The segments of every kind are contiguous from the block 0, so the segment of a block is found by its number
+type Store struct {
+	dir        string
+	lock       sync.RWMutex
+	segments   map[string][]*Segment
+	lastReload time.Time
+}
+
+// OpenStore opens the segment files of the directory, creating it if needed
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, segments: make(map[string][]*Segment)}
+	if err := s.reload(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SegmentPath returns the path of the segment file of the kind starting at the block from
+func SegmentPath(dir, kind string, from uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%09d-%09d.seg", kind, from, from+segmentSize))
+}
+
+// reload opens the segment files which appeared in the directory since the last time, e.g. frozen by
+// the node while the store is used by another process
+func (s *Store) reload() error {
+	s.lastReload = time.Now()
+	for _, kind := range Kinds {
+		for {
+			from := uint64(len(s.segments[kind])) * segmentSize
+			path := SegmentPath(s.dir, kind, from)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				break
+			}
+			segment, err := OpenSegment(path)
+			if err != nil {
+				return err
+			}
+			if segment.From() != from || segment.To() != from+segmentSize {
+				segment.Close()
+				return fmt.Errorf("%s: %w: has blocks %d-%d", path, ErrCorrupted, segment.From(), segment.To())
+			}
+			s.segments[kind] = append(s.segments[kind], segment)
+		}
+	}
+	return nil
+}
+
+// Ancient returns the record of the block, or nil if it is not frozen
+func (s *Store) Ancient(kind string, number uint64) ([]byte, error) {
+	i := int(number / segmentSize)
+	s.lock.RLock()
+	segments := s.segments[kind]
+	reload := i >= len(segments) && time.Since(s.lastReload) > reloadInterval
+	s.lock.RUnlock()
+	if reload {
+		s.lock.Lock()
+		if err := s.reload(); err != nil {
+			log.Warn("Failed to reload the ancient segments", "dir", s.dir, "err", err)
+		}
+		segments = s.segments[kind]
+		s.lock.Unlock()
+	}
+	if i >= len(segments) {
+		return nil, nil
+	}
+	return segments[i].Get(number)
+}
+
+// Frozen returns the number of the blocks frozen with all the kinds of the data, they are from 0 to Frozen()-1
+func (s *Store) Frozen() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.frozen()
+}
+
+func (s *Store) frozen() uint64 {
+	n := -1
+	for _, kind := range Kinds {
+		if n == -1 || len(s.segments[kind]) < n {
+			n = len(s.segments[kind])
+		}
+	}
+	return uint64(n) * segmentSize
+}
+
+// add makes the freshly written segment files of all the kinds visible to the readers at once
+func (s *Store) add(from uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, kind := range Kinds {
+		if uint64(len(s.segments[kind]))*segmentSize != from {
+			continue // Reloaded already
+		}
+		segment, err := OpenSegment(SegmentPath(s.dir, kind, from))
+		if err != nil {
+			return err
+		}
+		s.segments[kind] = append(s.segments[kind], segment)
+	}
+	return nil
+}
+
+// Close unmaps all the segment files
+func (s *Store) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for kind, segments := range s.segments {
+		for _, segment := range segments {
+			if err := segment.Close(); err != nil {
+				log.Warn("Failed to close the segment", "path", segment.Path(), "err", err)
+			}
+		}
+		delete(s.segments, kind)
+	}
+}
@@ -0,0 +1,102 @@
+package slotwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// Condition of the value of a storage slot, the alert of the watch is triggered while it holds
+type Condition string
+
+const (
+	Above     Condition = "above"
+	Below     Condition = "below"
+	Equals    Condition = "equals"
+	NotEquals Condition = "notEquals"
+)
+
+// Watch is a storage slot of a contract with the condition its value is alerted on, e.g. an oracle price below
+// a threshold or a governance parameter changed from its expected value
+type Watch struct {
+	Name      string         `json:"name"`
+	Contract  common.Address `json:"contract"`
+	Slot      common.Hash    `json:"slot"`
+	Condition Condition      `json:"condition"`
+	// Value is the threshold or the expected value, decimal or 0x prefixed hex
+	Value string `json:"value"`
+
+	value *uint256.Int
+}
+
+// Holds reports whether the condition of the watch holds for the value of the slot
+func (w *Watch) Holds(value *uint256.Int) bool {
+	switch w.Condition {
+	case Above:
+		return value.Gt(w.value)
+	case Below:
+		return value.Lt(w.value)
+	case Equals:
+		return value.Eq(w.value)
+	case NotEquals:
+		return !value.Eq(w.value)
+	}
+	return false
+}
+
+func (w *Watch) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("watch of the slot %x of %x has no name", w.Slot, w.Contract)
+	}
+	switch w.Condition {
+	case Above, Below, Equals, NotEquals:
+	default:
+		return fmt.Errorf("watch %s: unknown condition %q, expected one of %s, %s, %s, %s", w.Name, w.Condition, Above, Below, Equals, NotEquals)
+	}
+	b, ok := new(big.Int).SetString(w.Value, 0)
+	if !ok {
+		return fmt.Errorf("watch %s: invalid value %q", w.Name, w.Value)
+	}
+	var overflow bool
+	if w.value, overflow = uint256.FromBig(b); overflow || b.Sign() < 0 {
+		return fmt.Errorf("watch %s: value %q is not a 256 bits unsigned integer", w.Name, w.Value)
+	}
+	return nil
+}
+
+// ParseWatches parses the JSON list of the watches
+func ParseWatches(data []byte) ([]*Watch, error) {
+	var watches []*Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(watches))
+	for _, w := range watches {
+		if err := w.validate(); err != nil {
+			return nil, err
+		}
+		// The alert states are persisted by the names of the watches
+		if _, ok := names[w.Name]; ok {
+			return nil, fmt.Errorf("duplicate watch %s", w.Name)
+		}
+		names[w.Name] = struct{}{}
+	}
+	return watches, nil
+}
+
+// LoadWatches reads the JSON list of the watches from the file
+func LoadWatches(path string) ([]*Watch, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	watches, err := ParseWatches(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return watches, nil
+}
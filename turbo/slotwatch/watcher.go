@@ -0,0 +1,245 @@
+package slotwatch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+var (
+	triggeredCounter = metrics.NewRegisteredCounter("slotwatch/triggered", nil)
+	resolvedCounter  = metrics.NewRegisteredCounter("slotwatch/resolved", nil)
+	droppedCounter   = metrics.NewRegisteredCounter("slotwatch/webhook/dropped", nil)
+	failedCounter    = metrics.NewRegisteredCounter("slotwatch/webhook/failed", nil)
+)
+
+// webhookQueue is the number of the alerts waiting to be posted, the alerts are dropped when it is full
+const webhookQueue = 1024
+
+// Change is the value of a watched slot after the block
+type Change struct {
+	Block    uint64
+	Contract common.Address
+	Slot     common.Hash
+	Value    *uint256.Int
+}
+
+// AlertState is the persisted state of the alert of a watch: whether its condition holds, since which block and
+// for which value. The alerts are fired only when the state flips, so they are not repeated after the restarts
+type AlertState struct {
+	Triggered bool
+	Block     uint64
+	Value     *uint256.Int
+}
+
+// Alert is posted to the webhook when the condition of a watch starts or stops holding
+type Alert struct {
+	Watch     string         `json:"watch"`
+	Contract  common.Address `json:"contract"`
+	Slot      common.Hash    `json:"slot"`
+	Condition Condition      `json:"condition"`
+	Threshold string         `json:"threshold"`
+	Value     string         `json:"value"`
+	Block     uint64         `json:"block"`
+	Triggered bool           `json:"triggered"`
+}
+
+// Watcher evaluates the watches against the changes of the storage slots, persists their alert states in the
+// SlotWatchState bucket, and fires the alerts as the metrics and the webhook posts
+type Watcher struct {
+	watches  []*Watch
+	bySlot   map[string][]*Watch
+	gauges   map[string]metrics.Gauge
+	restored bool
+
+	webhook string
+	client  *http.Client
+	alerts  chan Alert
+	done    chan struct{}
+}
+
+// NewWatcher creates the watcher of the watches, the alerts are posted to the webhook URL unless it is empty
+func NewWatcher(watches []*Watch, webhook string) *Watcher {
+	w := &Watcher{
+		watches: watches,
+		bySlot:  make(map[string][]*Watch),
+		gauges:  make(map[string]metrics.Gauge),
+		webhook: webhook,
+	}
+	for _, watch := range watches {
+		key := slotKey(watch.Contract, watch.Slot)
+		w.bySlot[key] = append(w.bySlot[key], watch)
+		w.gauges[watch.Name] = metrics.NewRegisteredGauge("slotwatch/active/"+watch.Name, nil)
+	}
+	if webhook != "" {
+		w.client = &http.Client{Timeout: 10 * time.Second}
+		w.alerts = make(chan Alert, webhookQueue)
+		w.done = make(chan struct{})
+		go w.post()
+	}
+	return w
+}
+
+func slotKey(contract common.Address, slot common.Hash) string {
+	return string(contract[:]) + string(slot[:])
+}
+
+// Watched reports whether any of the watches is on the slot
+func (w *Watcher) Watched(contract common.Address, slot common.Hash) bool {
+	_, ok := w.bySlot[slotKey(contract, slot)]
+	return ok
+}
+
+// Apply evaluates the watches against the changes and persists the flipped alert states into db
+func (w *Watcher) Apply(db ethdb.Database, changes []Change) error {
+	if !w.restored {
+		// The gauges reflect the persisted states since the start of the node
+		for _, watch := range w.watches {
+			state, err := ReadAlertState(db, watch.Name)
+			if err != nil {
+				return err
+			}
+			w.updateGauge(watch.Name, state != nil && state.Triggered)
+		}
+		w.restored = true
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Block < changes[j].Block })
+	for _, change := range changes {
+		for _, watch := range w.bySlot[slotKey(change.Contract, change.Slot)] {
+			if err := w.check(db, watch, change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) check(db ethdb.Database, watch *Watch, change Change) error {
+	state, err := ReadAlertState(db, watch.Name)
+	if err != nil {
+		return err
+	}
+	triggered := watch.Holds(change.Value)
+	if state == nil {
+		if !triggered {
+			// Nothing to resolve
+			return nil
+		}
+	} else if state.Triggered == triggered {
+		return nil
+	}
+	if err = WriteAlertState(db, watch.Name, &AlertState{Triggered: triggered, Block: change.Block, Value: change.Value}); err != nil {
+		return err
+	}
+	if triggered {
+		triggeredCounter.Inc(1)
+		log.Warn("Slot watch triggered", "watch", watch.Name, "block", change.Block, "value", change.Value.Hex())
+	} else {
+		resolvedCounter.Inc(1)
+		log.Info("Slot watch resolved", "watch", watch.Name, "block", change.Block, "value", change.Value.Hex())
+	}
+	w.updateGauge(watch.Name, triggered)
+	w.notify(Alert{
+		Watch:     watch.Name,
+		Contract:  watch.Contract,
+		Slot:      watch.Slot,
+		Condition: watch.Condition,
+		Threshold: watch.value.Hex(),
+		Value:     change.Value.Hex(),
+		Block:     change.Block,
+		Triggered: triggered,
+	})
+	return nil
+}
+
+func (w *Watcher) updateGauge(name string, triggered bool) {
+	if triggered {
+		w.gauges[name].Update(1)
+	} else {
+		w.gauges[name].Update(0)
+	}
+}
+
+func (w *Watcher) notify(alert Alert) {
+	if w.alerts == nil {
+		return
+	}
+	select {
+	case w.alerts <- alert:
+	default:
+		droppedCounter.Inc(1)
+		log.Warn("Slot watch webhook is lagging, alert dropped", "watch", alert.Watch, "block", alert.Block)
+	}
+}
+
+func (w *Watcher) post() {
+	defer close(w.done)
+	for alert := range w.alerts {
+		body, err := json.Marshal(alert)
+		if err != nil {
+			log.Error("Failed to encode slot watch alert", "watch", alert.Watch, "err", err)
+			continue
+		}
+		resp, err := w.client.Post(w.webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			failedCounter.Inc(1)
+			log.Warn("Failed to post slot watch alert", "watch", alert.Watch, "err", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			failedCounter.Inc(1)
+			log.Warn("Slot watch webhook rejected the alert", "watch", alert.Watch, "status", resp.Status)
+		}
+	}
+}
+
+// Close waits for the queued alerts to be posted
+func (w *Watcher) Close() {
+	if w.alerts == nil {
+		return
+	}
+	close(w.alerts)
+	<-w.done
+}
+
+// ReadAlertState reads the persisted alert state of the watch, nil if it has never been triggered
+func ReadAlertState(db ethdb.Getter, name string) (*AlertState, error) {
+	v, err := db.Get(dbutils.SlotWatchState, []byte(name))
+	if err != nil {
+		if errors.Is(err, ethdb.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(v) < 9 {
+		return nil, errors.New("invalid slot watch state")
+	}
+	return &AlertState{
+		Triggered: v[0] == 1,
+		Block:     binary.BigEndian.Uint64(v[1:9]),
+		Value:     new(uint256.Int).SetBytes(v[9:]),
+	}, nil
+}
+
+// WriteAlertState persists the alert state of the watch
+func WriteAlertState(db ethdb.Putter, name string, state *AlertState) error {
+	v := make([]byte, 9, 9+32)
+	if state.Triggered {
+		v[0] = 1
+	}
+	binary.BigEndian.PutUint64(v[1:9], state.Block)
+	v = append(v, state.Value.Bytes()...)
+	return db.Put(dbutils.SlotWatchState, []byte(name), v)
+}
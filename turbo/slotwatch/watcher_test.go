@@ -0,0 +1,102 @@
+package slotwatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oracle = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	price  = common.HexToHash("0x01")
+	owner  = common.HexToHash("0x02")
+)
+
+const watchesJSON = `[
+	{"name": "price-low", "contract": "0x1000000000000000000000000000000000000001", "slot": "0x0000000000000000000000000000000000000000000000000000000000000001", "condition": "below", "value": "100"},
+	{"name": "owner", "contract": "0x1000000000000000000000000000000000000001", "slot": "0x0000000000000000000000000000000000000000000000000000000000000002", "condition": "notEquals", "value": "0xabcd"}
+]`
+
+func TestParseWatches(t *testing.T) {
+	watches, err := ParseWatches([]byte(watchesJSON))
+	require.NoError(t, err)
+	require.Len(t, watches, 2)
+	assert.Equal(t, oracle, watches[0].Contract)
+	assert.Equal(t, price, watches[0].Slot)
+	assert.True(t, watches[0].Holds(uint256.NewInt().SetUint64(99)))
+	assert.False(t, watches[0].Holds(uint256.NewInt().SetUint64(100)))
+	assert.False(t, watches[1].Holds(uint256.NewInt().SetUint64(0xabcd)))
+	assert.True(t, watches[1].Holds(uint256.NewInt()))
+
+	for _, invalid := range []string{
+		`[{"name": "a", "condition": "between", "value": "1"}]`,
+		`[{"name": "a", "condition": "above", "value": "x"}]`,
+		`[{"name": "a", "condition": "above", "value": "-1"}]`,
+		`[{"condition": "above", "value": "1"}]`,
+		`[{"name": "a", "condition": "above", "value": "1"}, {"name": "a", "condition": "below", "value": "1"}]`,
+	} {
+		_, err = ParseWatches([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWatcherAlerts(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	watches, err := ParseWatches([]byte(watchesJSON))
+	require.NoError(t, err)
+	change := func(block uint64, slot common.Hash, value uint64) Change {
+		return Change{Block: block, Contract: oracle, Slot: slot, Value: uint256.NewInt().SetUint64(value)}
+	}
+
+	watcher := NewWatcher(watches, server.URL)
+	assert.True(t, watcher.Watched(oracle, price))
+	assert.False(t, watcher.Watched(oracle, common.HexToHash("0x03")))
+	require.NoError(t, watcher.Apply(db, []Change{
+		change(2, price, 50), // triggered
+		change(1, price, 150),
+		change(3, price, 60), // still triggered
+		change(3, owner, 0xabcd),
+	}))
+	state, err := ReadAlertState(db, "price-low")
+	require.NoError(t, err)
+	assert.Equal(t, &AlertState{Triggered: true, Block: 2, Value: uint256.NewInt().SetUint64(50)}, state)
+	state, err = ReadAlertState(db, "owner")
+	require.NoError(t, err)
+	assert.Nil(t, state)
+	watcher.Close()
+
+	// The persisted state is not triggered again by the restarted node
+	watcher = NewWatcher(watches, server.URL)
+	require.NoError(t, watcher.Apply(db, []Change{change(4, price, 70), change(5, price, 100), change(5, owner, 1)}))
+	watcher.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, alerts, 3)
+	assert.Equal(t, Alert{Watch: "price-low", Contract: oracle, Slot: price, Condition: Below, Threshold: "0x64", Value: "0x32", Block: 2, Triggered: true}, alerts[0])
+	assert.Equal(t, "price-low", alerts[1].Watch)
+	assert.Equal(t, uint64(5), alerts[1].Block)
+	assert.False(t, alerts[1].Triggered)
+	assert.Equal(t, "owner", alerts[2].Watch)
+	assert.True(t, alerts[2].Triggered)
+}
@@ -0,0 +1,40 @@
+package snapshotsync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// EpochSize is the distance between the blocks the snapshots are produced at. The snapshots of the same epoch
+// produced by different nodes are byte to byte identical, so they share the torrent and are seeded together
+const EpochSize = 500_000
+
+// EpochBlock returns the highest epoch boundary not above the block
+func EpochBlock(block uint64) uint64 {
+	return block - block%EpochSize
+}
+
+// IsEpochBlock returns whether the block is at an epoch boundary
+func IsEpochBlock(block uint64) bool {
+	return block > 0 && block%EpochSize == 0
+}
+
+// SegmentPath is the directory of the snapshot of the given type in the snapshots directory
+func SegmentPath(snapshotDir string, tp SnapshotType) string {
+	return filepath.Join(snapshotDir, tp.String())
+}
+
+// MakeImmutable finalises the snapshot directory: the lock file of the database is removed, and the data file is made
+// read only, so the snapshot is not changed after its info hash has been published
+func MakeImmutable(snapshotPath string) error {
+	if err := os.Remove(filepath.Join(snapshotPath, "lock.mdb")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing lock file of %s: %w", snapshotPath, err)
+	}
+	return filepath.Walk(snapshotPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return os.Chmod(path, 0444)
+	})
+}
@@ -26,14 +26,22 @@ var (
 
 func PostProcessing(db ethdb.Database, mode SnapshotMode, downloadedSnapshots map[SnapshotType]*SnapshotsInfo) error {
 	if mode.Headers {
-		err := GenerateHeaderIndexes(context.Background(), db)
+		err := verifyOnce(db, HeaderNumber, VerifyHeadersSnapshot)
+		if err != nil {
+			return err
+		}
+		err = GenerateHeaderIndexes(context.Background(), db)
 		if err != nil {
 			return err
 		}
 	}
 
 	if mode.Bodies {
-		err := PostProcessBodies(db)
+		err := verifyOnce(db, stages.Bodies, VerifyBodiesSnapshot)
+		if err != nil {
+			return err
+		}
+		err = PostProcessBodies(db)
 		if err != nil {
 			return err
 		}
@@ -48,6 +56,18 @@ func PostProcessing(db ethdb.Database, mode SnapshotMode, downloadedSnapshots ma
 	return nil
 }
 
+// verifyOnce verifies the snapshot before its post-processing, which sets the progress of the stage
+func verifyOnce(db ethdb.Database, stage stages.SyncStage, verify func(context.Context, ethdb.Database) error) error {
+	v, err := stages.GetStageProgress(db, stage)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return err
+	}
+	if v > 0 {
+		return nil
+	}
+	return verify(context.Background(), db)
+}
+
 func PostProcessBodies(db ethdb.Database) error {
 	v, err := stages.GetStageProgress(db, stages.Bodies)
 	if err != nil {
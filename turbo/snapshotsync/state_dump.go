@@ -0,0 +1,289 @@
+package snapshotsync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// The state dump is the flat state at a block, split into the chunk files for the distribution out of band:
+//
+//	manifest.json
+//	state-000000.chunk
+//	state-000001.chunk
+//	...
+//
+// The chunks are the streams of the RLP encoded DumpEntry in the order of PlainStateBucket, every account is
+// followed by its storage. The manifest lists the Keccak256 hashes of the chunks, and the state root of the block,
+// which the state of the chunks is checked against when they are imported
+
+const (
+	DumpManifestFile = "manifest.json"
+	// DefaultDumpChunkSize is the size after which the next chunk file is started
+	DefaultDumpChunkSize = 256 * 1024 * 1024
+)
+
+// DumpManifest describes the state dump
+type DumpManifest struct {
+	Block        uint64      `json:"block"`
+	BlockHash    common.Hash `json:"blockHash"`
+	StateRoot    common.Hash `json:"stateRoot"`
+	Accounts     uint64      `json:"accounts"`
+	StorageSlots uint64      `json:"storageSlots"`
+	Chunks       []DumpChunk `json:"chunks"`
+}
+
+// DumpChunk is the chunk file of the state dump with its Keccak256 hash
+type DumpChunk struct {
+	File string      `json:"file"`
+	Size uint64      `json:"size"`
+	Hash common.Hash `json:"hash"`
+}
+
+// DumpEntry is either the account with its code, or the storage slot of the account preceding it
+type DumpEntry struct {
+	Address  common.Address
+	Storage  bool
+	Location common.Hash // Only for the storage
+	Value    []byte      // Account encoded for storage, or the value of the storage slot
+	Code     []byte      // Only for the contracts
+}
+
+// ExportState writes the state dump of the canonical block into the new directory. The state is read as of
+// the block from the history, so the block can be older than the head
+func ExportState(ctx context.Context, db ethdb.Database, block uint64, dir string, chunkSize uint64) (*DumpManifest, error) {
+	hash, err := rawdb.ReadCanonicalHash(db, block)
+	if err != nil {
+		return nil, err
+	}
+	header := rawdb.ReadHeader(db, hash, block)
+	if header == nil {
+		return nil, fmt.Errorf("header of block %d not found", block)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil {
+		return nil, err
+	} else if len(files) > 0 {
+		return nil, fmt.Errorf("directory %s is not empty", dir)
+	}
+	tx, err := db.(ethdb.HasKV).KV().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	m := &DumpManifest{Block: block, BlockHash: hash, StateRoot: header.Root}
+	w := &chunkWriter{dir: dir, chunkSize: chunkSize, manifest: m}
+	defer w.close()
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	if err = state.WalkAsOfAccounts(tx, common.Address{}, block+1, func(k, v []byte) (bool, error) {
+		if len(k) != common.AddressLength {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-logEvery.C:
+			log.Info("Exporting state", "block", block, "address", common.BytesToAddress(k), "accounts", m.Accounts, "storage", m.StorageSlots, "chunks", len(m.Chunks)+1)
+		default:
+		}
+		view := accounts.StorageView(v)
+		incarnation, err := view.Incarnation()
+		if err != nil {
+			return false, fmt.Errorf("decoding account %x: %w", k, err)
+		}
+		address := common.BytesToAddress(k)
+		entry := DumpEntry{Address: address, Value: common.CopyBytes(v)}
+		if incarnation > 0 {
+			codeHash, err := view.CodeHash()
+			if err != nil {
+				return false, fmt.Errorf("decoding account %x: %w", k, err)
+			}
+			if empty, _ := view.IsEmptyCodeHash(); !empty {
+				code, err := tx.GetOne(dbutils.CodeBucket, codeHash[:])
+				if err != nil {
+					return false, err
+				}
+				if len(code) == 0 {
+					return false, fmt.Errorf("code %x of account %x not found", codeHash, k)
+				}
+				entry.Code = common.CopyBytes(code)
+			}
+		}
+		if err := w.write(&entry); err != nil {
+			return false, err
+		}
+		m.Accounts++
+		if incarnation == 0 {
+			return true, nil
+		}
+		return true, state.WalkAsOfStorage(tx, address, incarnation, common.Hash{}, block+1, func(_, location, value []byte) (bool, error) {
+			m.StorageSlots++
+			return true, w.write(&DumpEntry{Address: address, Storage: true, Location: common.BytesToHash(location), Value: common.CopyBytes(value)})
+		})
+	}); err != nil {
+		return nil, err
+	}
+	if err = w.finish(); err != nil {
+		return nil, err
+	}
+	if err = writeDumpManifest(dir, m); err != nil {
+		return nil, err
+	}
+	log.Info("Exported state", "block", block, "root", m.StateRoot, "accounts", m.Accounts, "storage", m.StorageSlots, "chunks", len(m.Chunks))
+	return m, nil
+}
+
+// chunkWriter writes the entries into the chunk files, starting the next one when the current one is big enough
+type chunkWriter struct {
+	dir       string
+	chunkSize uint64
+	manifest  *DumpManifest
+	file      *os.File
+	w         *bufio.Writer
+	hasher    hash.Hash
+	size      uint64
+}
+
+func (w *chunkWriter) write(entry *DumpEntry) error {
+	if w.file != nil && w.size >= w.chunkSize {
+		if err := w.finish(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		name := fmt.Sprintf("state-%06d.chunk", len(w.manifest.Chunks))
+		file, err := os.Create(filepath.Join(w.dir, name))
+		if err != nil {
+			return err
+		}
+		w.file, w.hasher, w.size = file, sha3.NewLegacyKeccak256(), 0
+		w.w = bufio.NewWriter(io.MultiWriter(file, w.hasher))
+		w.manifest.Chunks = append(w.manifest.Chunks, DumpChunk{File: name})
+	}
+	enc, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = w.w.Write(enc); err != nil {
+		return err
+	}
+	w.size += uint64(len(enc))
+	return nil
+}
+
+// finish completes the current chunk file, if any
+func (w *chunkWriter) finish() error {
+	if w.file == nil {
+		return nil
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	chunk := &w.manifest.Chunks[len(w.manifest.Chunks)-1]
+	chunk.Size = w.size
+	chunk.Hash = common.BytesToHash(w.hasher.Sum(nil))
+	w.file = nil
+	return nil
+}
+
+func (w *chunkWriter) close() {
+	if w.file != nil {
+		w.file.Close()
+	}
+}
+
+func writeDumpManifest(dir string, m *DumpManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, DumpManifestFile), data, 0644)
+}
+
+// ReadDumpManifest reads the manifest of the state dump in the directory
+func ReadDumpManifest(dir string) (*DumpManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, DumpManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m := new(DumpManifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, nil
+}
+
+// ErrDumpChunkHash is returned when the chunk of the state dump does not match its hash in the manifest
+var ErrDumpChunkHash = errors.New("chunk hash mismatch")
+
+// readDumpChunks reads the entries of all the chunks in order. The chunks are checked against their hashes once
+// read, so the entries of a broken chunk are passed to the walker before the error is returned
+func readDumpChunks(ctx context.Context, dir string, m *DumpManifest, walker func(*DumpEntry) error) error {
+	for _, chunk := range m.Chunks {
+		if err := readDumpChunk(ctx, filepath.Join(dir, chunk.File), chunk.Hash, walker); err != nil {
+			return fmt.Errorf("%s: %w", chunk.File, err)
+		}
+	}
+	return nil
+}
+
+func readDumpChunk(ctx context.Context, path string, want common.Hash, walker func(*DumpEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hasher := sha3.NewLegacyKeccak256()
+	r := io.TeeReader(bufio.NewReader(file), hasher)
+	stream := rlp.NewStream(r, 0)
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		var entry DumpEntry
+		if err = stream.Decode(&entry); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			// The undecodable chunk is reported as broken if it does not match its hash
+			if _, copyErr := io.Copy(ioutil.Discard, r); copyErr == nil && common.BytesToHash(hasher.Sum(nil)) != want {
+				return ErrDumpChunkHash
+			}
+			return err
+		}
+		if err = walker(&entry); err != nil {
+			return err
+		}
+	}
+	if have := common.BytesToHash(hasher.Sum(nil)); have != want {
+		return fmt.Errorf("%w: %x instead of %x", ErrDumpChunkHash, have, want)
+	}
+	return nil
+}
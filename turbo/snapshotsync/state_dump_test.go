@@ -0,0 +1,102 @@
+package snapshotsync
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestExportImportState(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	alloc := core.GenesisAlloc{}
+	for i := 0; i < 50; i++ {
+		account := core.GenesisAccount{Balance: big.NewInt(int64(i + 1)), Nonce: uint64(i)}
+		if i%10 == 0 {
+			account.Code = []byte{0x60, byte(i), 0x60, 0x00, 0x55}
+			account.Storage = map[common.Hash]common.Hash{{1}: {byte(i + 1)}, {2}: {byte(i + 2)}}
+		}
+		alloc[common.Address{byte(i), 1}] = account
+	}
+	genesis, _, err := (&core.Genesis{Config: params.TestChainConfig, Alloc: alloc}).Commit(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "dump")
+	m, err := ExportState(ctx, db, 0, dir, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Accounts != 50 || m.StorageSlots != 10 || len(m.Chunks) < 2 {
+		t.Fatalf("exported %d accounts and %d storage slots into %d chunks", m.Accounts, m.StorageSlots, len(m.Chunks))
+	}
+	if m.StateRoot != genesis.Root() {
+		t.Fatalf("manifest root %x, genesis root %x", m.StateRoot, genesis.Root())
+	}
+	if err = VerifyStateDump(ctx, dir, genesis.Root(), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyStateDump(ctx, dir, common.Hash{1}, t.TempDir()); !errors.Is(err, ErrStateRoot) {
+		t.Errorf("expected the state root mismatch, got %v", err)
+	}
+
+	// The state is imported into the database with the headers only
+	db2 := ethdb.NewMemDatabase()
+	defer db2.Close()
+	rawdb.WriteHeader(ctx, db2, genesis.Header())
+	if err = rawdb.WriteCanonicalHash(db2, genesis.Hash(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = ImportState(ctx, db2, dir, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for _, bucket := range []string{dbutils.PlainStateBucket, dbutils.PlainContractCodeBucket, dbutils.CodeBucket} {
+		if have, want := bucketContents(t, db2, bucket), bucketContents(t, db, bucket); len(have) != len(want) {
+			t.Errorf("%s: imported %d entries instead of %d", bucket, len(have), len(want))
+		} else {
+			for k, v := range want {
+				if have[k] != v {
+					t.Errorf("%s: %x imported as %x instead of %x", bucket, k, have[k], v)
+				}
+			}
+		}
+	}
+
+	// A flipped bit of a chunk is detected
+	path := filepath.Join(dir, m.Chunks[1].File)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyStateDump(ctx, dir, genesis.Root(), os.TempDir()); !errors.Is(err, ErrDumpChunkHash) {
+		t.Errorf("expected the chunk hash mismatch, got %v", err)
+	}
+}
+
+func bucketContents(t *testing.T, db ethdb.Database, bucket string) map[string]string {
+	contents := make(map[string]string)
+	if err := db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		contents[string(k)] = string(v)
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
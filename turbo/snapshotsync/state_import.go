@@ -0,0 +1,160 @@
+package snapshotsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// StateImport is the stage of the import of the state dump, it is done once on the database without the state
+var StateImport = stages.SyncStage("snapshot_state_import")
+
+// ImportState imports the state dump as the state after its block. The root of the imported state is checked
+// against the header of the block, which must be in the database already, the manifest itself is not trusted.
+// The progress of the execution, the hashed state and the intermediate hashes stages is set to the block, so
+// that the sync executes the blocks after it
+func ImportState(ctx context.Context, db ethdb.Database, dir, tmpdir string) error {
+	if v, err := stages.GetStageProgress(db, StateImport); err != nil {
+		return err
+	} else if v > 0 {
+		return nil
+	}
+	if v, err := stages.GetStageProgress(db, stages.Execution); err != nil {
+		return err
+	} else if v > 0 {
+		return fmt.Errorf("the state is executed up to block %d already", v)
+	}
+	m, err := ReadDumpManifest(dir)
+	if err != nil {
+		return err
+	}
+	hash, err := rawdb.ReadCanonicalHash(db, m.Block)
+	if err != nil {
+		return err
+	}
+	header := rawdb.ReadHeader(db, hash, m.Block)
+	if header == nil {
+		return fmt.Errorf("header of block %d not found, the headers have to be imported before the state", m.Block)
+	}
+	if hash != m.BlockHash {
+		return fmt.Errorf("state dump is of block %x, the canonical block %d is %x", m.BlockHash, m.Block, hash)
+	}
+
+	tx, err := db.Begin(ctx, ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = loadStateDump(ctx, tx, dir, m, header.Root, tmpdir); err != nil {
+		return err
+	}
+	for _, stage := range []stages.SyncStage{stages.Execution, stages.HashState, stages.IntermediateHashes, StateImport} {
+		if err = stages.SaveStageProgress(tx, stage, m.Block); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Info("Imported state", "block", m.Block, "root", header.Root, "accounts", m.Accounts, "storage", m.StorageSlots)
+	return nil
+}
+
+// VerifyStateDump checks the chunks of the state dump against the hashes of the manifest, and the state against
+// the root by importing it into a temporary database
+func VerifyStateDump(ctx context.Context, dir string, root common.Hash, tmpdir string) error {
+	m, err := ReadDumpManifest(dir)
+	if err != nil {
+		return err
+	}
+	tmpPath, err := ioutil.TempDir(tmpdir, "statedump")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpPath)
+	kv := ethdb.NewLMDB().Path(tmpPath).MustOpen()
+	defer kv.Close()
+	tx, err := ethdb.NewObjectDatabase(kv).Begin(ctx, ethdb.RW)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return loadStateDump(ctx, tx, dir, m, root, tmpdir)
+}
+
+// loadStateDump writes the plain state of the dump, and computes the hashed state and the intermediate hashes
+// to check the state root
+func loadStateDump(ctx context.Context, tx ethdb.DbWithPendingMutations, dir string, m *DumpManifest, root common.Hash, tmpdir string) error {
+	plainState := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer plainState.Close("StateImport")
+	contractCode := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer contractCode.Close("StateImport")
+	code := etl.NewCollector(tmpdir, etl.NewSortableBuffer(etl.BufferOptimalSize))
+	defer code.Close("StateImport")
+
+	var address common.Address
+	var incarnation uint64
+	if err := readDumpChunks(ctx, dir, m, func(entry *DumpEntry) error {
+		if entry.Storage {
+			if entry.Address != address || incarnation == 0 {
+				return fmt.Errorf("storage of %x does not follow its contract", entry.Address)
+			}
+			return plainState.Collect(dbutils.PlainGenerateCompositeStorageKey(address.Bytes(), incarnation, entry.Location.Bytes()), entry.Value)
+		}
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(entry.Value); err != nil {
+			return fmt.Errorf("decoding account %x: %w", entry.Address, err)
+		}
+		address, incarnation = entry.Address, acc.Incarnation
+		if len(entry.Code) > 0 {
+			if codeHash := crypto.Keccak256Hash(entry.Code); codeHash != acc.CodeHash {
+				return fmt.Errorf("code of %x has hash %x instead of %x", address, codeHash, acc.CodeHash)
+			}
+			if err := code.Collect(acc.CodeHash.Bytes(), entry.Code); err != nil {
+				return err
+			}
+			if err := contractCode.Collect(dbutils.PlainGenerateStoragePrefix(address.Bytes(), incarnation), acc.CodeHash.Bytes()); err != nil {
+				return err
+			}
+		}
+		return plainState.Collect(address.Bytes(), entry.Value)
+	}); err != nil {
+		return err
+	}
+	for bucket, collector := range map[string]*etl.Collector{
+		dbutils.PlainStateBucket:        plainState,
+		dbutils.PlainContractCodeBucket: contractCode,
+		dbutils.CodeBucket:              code,
+	} {
+		if err := collector.Load("StateImport", tx, bucket, etl.IdentityLoadFunc, etl.TransformArgs{Quit: ctx.Done()}); err != nil {
+			return err
+		}
+	}
+	if err := stagedsync.PromoteHashedStateCleanly("StateImport", tx, tmpdir, ctx.Done()); err != nil {
+		return err
+	}
+	hash, err := stagedsync.RegenerateIntermediateHashes("StateImport", tx, false, nil, tmpdir, root, ctx.Done())
+	if err != nil {
+		return err
+	}
+	if hash != root {
+		return fmt.Errorf("%w: %x instead of %x", ErrStateRoot, hash, root)
+	}
+	return nil
+}
+
+// ErrStateRoot is returned when the state of the dump does not match the state root of its block
+var ErrStateRoot = errors.New("state root mismatch")
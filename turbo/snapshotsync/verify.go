@@ -0,0 +1,130 @@
+package snapshotsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// The torrent pieces are checked against the info hashes, which are hardcoded, so the downloaded segments are the
+// ones which have been published. The verification below checks that the segments are consistent with each other and
+// with the local genesis before the stages continue from them. The state segment is checked by the Intermediate Hashes
+// stage, which computes the state root and compares it with the root of the header.
+
+// VerifyHeadersSnapshot checks that the headers of the snapshot make the chain from the local genesis up to the head
+// of the snapshot, each header referring the previous one
+func VerifyHeadersSnapshot(ctx context.Context, db ethdb.Database) error {
+	headNumber, headHash, err := snapshotHead(db, dbutils.HeadersSnapshotInfoBucket, dbutils.SnapshotHeadersHeadNumber, dbutils.SnapshotHeadersHeadHash)
+	if err != nil {
+		return err
+	}
+	log.Info("Verifying headers snapshot", "head", headNumber)
+	var parent *types.Header
+	err = db.Walk(dbutils.HeadersBucket, dbutils.EncodeBlockNumber(0), 0, func(k, v []byte) (bool, error) {
+		if common.IsCanceled(ctx) {
+			return false, common.ErrStopped
+		}
+		number := binary.BigEndian.Uint64(k[:8])
+		if number > headNumber {
+			return false, nil
+		}
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(v, header); err != nil {
+			return false, fmt.Errorf("invalid header %d: %w", number, err)
+		}
+		hash := header.Hash()
+		if !bytes.Equal(k[8:], hash[:]) || header.Number.Uint64() != number {
+			return false, fmt.Errorf("header %d %x is stored under the key %x", header.Number, hash, k)
+		}
+		if parent != nil {
+			if number != parent.Number.Uint64()+1 {
+				return false, fmt.Errorf("headers %d..%d are missing or duplicated", parent.Number.Uint64()+1, number)
+			}
+			if header.ParentHash != parent.Hash() {
+				return false, fmt.Errorf("header %d %x does not refer the parent %x", number, hash, parent.Hash())
+			}
+		}
+		parent = header
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if parent == nil || parent.Number.Uint64() != headNumber || parent.Hash() != headHash {
+		return fmt.Errorf("headers snapshot does not reach its head %d %x", headNumber, headHash)
+	}
+	return nil
+}
+
+// VerifyBodiesSnapshot checks that the bodies of the snapshot match the transaction and uncle roots of the headers
+func VerifyBodiesSnapshot(ctx context.Context, db ethdb.Database) error {
+	headNumber, headHash, err := snapshotHead(db, dbutils.BodiesSnapshotInfoBucket, dbutils.SnapshotBodyHeadNumber, dbutils.SnapshotBodyHeadHash)
+	if err != nil {
+		return err
+	}
+	log.Info("Verifying bodies snapshot", "head", headNumber)
+	var last uint64
+	err = db.Walk(dbutils.BlockBodyPrefix, dbutils.EncodeBlockNumber(1), 0, func(k, v []byte) (bool, error) {
+		if common.IsCanceled(ctx) {
+			return false, common.ErrStopped
+		}
+		number := binary.BigEndian.Uint64(k[:8])
+		if number > headNumber {
+			return false, nil
+		}
+		if number != last+1 {
+			return false, fmt.Errorf("bodies %d..%d are missing or duplicated", last+1, number)
+		}
+		headerRLP, err := db.Get(dbutils.HeadersBucket, k)
+		if err != nil {
+			return false, fmt.Errorf("no header for the body %d: %w", number, err)
+		}
+		header := new(types.Header)
+		if err = rlp.DecodeBytes(headerRLP, header); err != nil {
+			return false, fmt.Errorf("invalid header %d: %w", number, err)
+		}
+		body := new(types.Body)
+		if err = rlp.DecodeBytes(v, body); err != nil {
+			return false, fmt.Errorf("invalid body %d: %w", number, err)
+		}
+		if hash := types.DeriveSha(types.Transactions(body.Transactions)); hash != header.TxHash {
+			return false, fmt.Errorf("body %d: transactions root %x, header has %x", number, hash, header.TxHash)
+		}
+		if hash := types.CalcUncleHash(body.Uncles); hash != header.UncleHash {
+			return false, fmt.Errorf("body %d: uncles hash %x, header has %x", number, hash, header.UncleHash)
+		}
+		last = number
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if last != headNumber {
+		return fmt.Errorf("bodies snapshot does not reach its head %d %x", headNumber, headHash)
+	}
+	if has, err := db.Has(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(headNumber, headHash)); err != nil || !has {
+		return fmt.Errorf("bodies snapshot does not have its head %d %x", headNumber, headHash)
+	}
+	return nil
+}
+
+func snapshotHead(db ethdb.Getter, bucket, numberKey, hashKey string) (uint64, common.Hash, error) {
+	numberBytes, err := db.Get(bucket, []byte(numberKey))
+	if err != nil {
+		return 0, common.Hash{}, fmt.Errorf("reading snapshot head number: %w", err)
+	}
+	hashBytes, err := db.Get(bucket, []byte(hashKey))
+	if err != nil {
+		return 0, common.Hash{}, fmt.Errorf("reading snapshot head hash: %w", err)
+	}
+	return big.NewInt(0).SetBytes(numberBytes).Uint64(), common.BytesToHash(hashBytes), nil
+}
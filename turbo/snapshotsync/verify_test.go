@@ -0,0 +1,105 @@
+package snapshotsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// writeSnapshot writes the chained headers 0..n and the bodies 1..n with the snapshot infos, as they are seen after
+// the snapshots are downloaded. The modify function can corrupt the block before it is written
+func writeSnapshot(t *testing.T, db ethdb.Database, n uint64, modify func(*types.Header, *types.Body)) {
+	parent := common.Hash{}
+	for i := uint64(0); i <= n; i++ {
+		txs := types.Transactions{types.NewTransaction(i, common.Address{}, uint256.NewInt(), 21000, uint256.NewInt(), nil)}
+		header := &types.Header{ParentHash: parent, Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1), UncleHash: types.EmptyUncleHash, TxHash: types.DeriveSha(txs)}
+		body := &types.Body{Transactions: txs}
+		if modify != nil {
+			modify(header, body)
+		}
+		hash := header.Hash()
+		headerBytes, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Put(dbutils.HeadersBucket, dbutils.HeaderKey(i, hash), headerBytes); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			bodyBytes, err := rlp.EncodeToBytes(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = db.Put(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(i, hash), bodyBytes); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parent = hash
+	}
+	for _, info := range []struct{ bucket, numberKey, hashKey string }{
+		{dbutils.HeadersSnapshotInfoBucket, dbutils.SnapshotHeadersHeadNumber, dbutils.SnapshotHeadersHeadHash},
+		{dbutils.BodiesSnapshotInfoBucket, dbutils.SnapshotBodyHeadNumber, dbutils.SnapshotBodyHeadHash},
+	} {
+		if err := db.Put(info.bucket, []byte(info.numberKey), new(big.Int).SetUint64(n).Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(info.bucket, []byte(info.hashKey), parent.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifySnapshots(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	writeSnapshot(t, db, 10, nil)
+	if err := VerifyHeadersSnapshot(context.Background(), db); err != nil {
+		t.Errorf("headers: %v", err)
+	}
+	if err := VerifyBodiesSnapshot(context.Background(), db); err != nil {
+		t.Errorf("bodies: %v", err)
+	}
+}
+
+func TestVerifyBrokenSnapshots(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	writeSnapshot(t, db, 10, func(header *types.Header, _ *types.Body) {
+		if header.Number.Uint64() == 5 {
+			header.ParentHash = common.Hash{1}
+		}
+	})
+	if err := VerifyHeadersSnapshot(context.Background(), db); err == nil {
+		t.Errorf("expected broken headers chain to fail the verification")
+	}
+
+	db2 := ethdb.NewMemDatabase()
+	defer db2.Close()
+	writeSnapshot(t, db2, 10, func(header *types.Header, body *types.Body) {
+		if header.Number.Uint64() == 7 {
+			body.Transactions = body.Transactions[:0]
+		}
+	})
+	if err := VerifyHeadersSnapshot(context.Background(), db2); err != nil {
+		t.Errorf("headers: %v", err)
+	}
+	if err := VerifyBodiesSnapshot(context.Background(), db2); err == nil {
+		t.Errorf("expected body not matching the header to fail the verification")
+	}
+}
+
+func TestEpochBlock(t *testing.T) {
+	if b := EpochBlock(11_234_567); b != 11_000_000 {
+		t.Errorf("expected epoch block 11000000, got %d", b)
+	}
+	if !IsEpochBlock(11_000_000) || IsEpochBlock(11_000_001) || IsEpochBlock(0) {
+		t.Errorf("unexpected epoch boundaries")
+	}
+}
@@ -3478,3 +3478,52 @@ func TestEIP2718Transition(t *testing.T) {
 
 	}
 }
+
+// Tests that the transaction counts of the blocks of the old chain don't survive the reorg
+func TestTxCountIndexReorg(t *testing.T) {
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+	}
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.LatestSigner(gspec.Config)
+	generate := func(n int, txsPerBlock int) []*types.Block {
+		blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n, func(i int, b *core.BlockGen) {
+			for j := 0; j < txsPerBlock; j++ {
+				tx, err := types.SignTx(types.NewTransaction(b.TxNonce(sender), common.Address{1}, uint256.NewInt().SetUint64(1000), params.TxGas, uint256.NewInt().SetUint64(1), nil), signer, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b.AddTx(tx)
+			}
+		}, false /* intermediateHashes */)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blocks
+	}
+	short, long := generate(5, 1), generate(6, 2)
+	// The first blocks of the long chain are the side chain, until the rest of them makes it canonical
+	for _, blocks := range [][]*types.Block{short, long[:3], long[3:]} {
+		if _, err := stagedsync.InsertBlocksInStages(db, ethdb.DefaultStorageMode, gspec.Config, &vm.Config{}, ethash.NewFaker(), blocks, true /* checkRoot */); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, block := range long {
+		count, ok, err := rawdb.ReadTxCount(db, block.NumberU64())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && int(count) != len(block.Transactions()) {
+			t.Errorf("block %d: count %d of the old chain instead of %d", block.NumberU64(), count, len(block.Transactions()))
+		}
+		if !ok && block.NumberU64() > 3 {
+			t.Errorf("block %d of the new chain is not indexed", block.NumberU64())
+		}
+	}
+}
@@ -123,6 +123,9 @@ func (bd *BodyDownload) RequestMoreBodies(db ethdb.Database, blockNum uint64, cu
 		if header == nil {
 			log.Error("Header not found", "block number", blockNum)
 			panic("")
+		} else if request && bd.prefetching(blockNum, currentTime) {
+			// The body is being prefetched, it will be delivered to the Bodies stage when it arrives
+			continue
 		} else if request {
 			blockNums = append(blockNums, blockNum)
 			hashes = append(hashes, hash)
@@ -179,6 +182,9 @@ func (bd *BodyDownload) DeliverBodies(bodies []*types.Body) (int, int) {
 				}
 			}
 			delete(bd.requestedMap, doubleHash) // Delivered, cleaning up
+			bd.deliverPrefetched(doubleHash, body, true /* toStage */)
+			delivered++
+		} else if bd.deliverPrefetched(doubleHash, body, false /* toStage */) {
 			delivered++
 		} else {
 			undelivered++
@@ -29,6 +29,9 @@ type BodyDownload struct {
 	outstandingLimit uint64 // Limit of number of outstanding blocks for body requests
 	peerMap          map[string]int
 	prefetchedBlocks *PrefetchedBlocks
+	lookahead        uint64                      // How far ahead of the execution the bodies are prefetched, prefetching is off if zero
+	prefetchRequests map[uint64]*prefetchRequest // Blocks considered for prefetching, by block number
+	prefetchMap      map[DoubleHash]uint64       // Block numbers of the outstanding prefetch requests, by the double hash of the body
 }
 
 // BodyRequest is a sketch of the request for block bodies, meaning that access to the database is required to convert it to the actual BlockBodies request (look up hashes of canonical blocks)
@@ -49,6 +52,8 @@ func NewBodyDownload(outstandingLimit int) *BodyDownload {
 		requests:         make([]*BodyRequest, outstandingLimit+MaxBodiesInRequest),
 		peerMap:          make(map[string]int),
 		prefetchedBlocks: NewPrefetchedBlocks(),
+		prefetchRequests: make(map[uint64]*prefetchRequest),
+		prefetchMap:      make(map[DoubleHash]uint64),
 	}
 	return bd
 }
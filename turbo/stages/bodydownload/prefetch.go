@@ -0,0 +1,143 @@
+package bodydownload
+
+import (
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// prefetchRequest is a block the body of which is prefetched. The header is only kept while the body
+// is being downloaded, it is nil once the body is delivered, or if the block has no body to download
+type prefetchRequest struct {
+	header    *types.Header
+	hash      common.Hash
+	waitUntil uint64
+}
+
+func doubleHashOf(header *types.Header) DoubleHash {
+	var doubleHash DoubleHash
+	copy(doubleHash[:], header.UncleHash.Bytes())
+	copy(doubleHash[common.HashLength:], header.TxHash.Bytes())
+	return doubleHash
+}
+
+// SetPrefetchLimits turns on prefetching of the bodies of up to lookahead blocks ahead of the execution,
+// while the other stages are running. The prefetched bodies are kept in memory up to the memoryLimit
+func (bd *BodyDownload) SetPrefetchLimits(lookahead int, memoryLimit datasize.ByteSize) {
+	bd.lock.Lock()
+	defer bd.lock.Unlock()
+	bd.lookahead = uint64(lookahead)
+	maxCount := DefaultPrefetchedBlocks
+	if lookahead > maxCount {
+		maxCount = lookahead
+	}
+	bd.prefetchedBlocks.SetLimits(maxCount, common.StorageSize(memoryLimit.Bytes()))
+}
+
+// Prefetching returns whether the bodies are prefetched ahead of the execution
+func (bd *BodyDownload) Prefetching() bool {
+	bd.lock.RLock()
+	defer bd.lock.RUnlock()
+	return bd.lookahead > 0
+}
+
+// RequestPrefetch produces the request for the bodies of the blocks above the Bodies stage progress, and no
+// more than lookahead blocks ahead of the execution. The blocks the Bodies stage is downloading itself are
+// skipped, as well as the ones already prefetched. Returns nil when there is nothing to request, or when
+// the prefetched bodies would exceed the memory limit
+func (bd *BodyDownload) RequestPrefetch(db ethdb.Database, executionProgress uint64, currentTime uint64) *BodyRequest {
+	bd.lock.Lock()
+	defer bd.lock.Unlock()
+	if bd.lookahead == 0 || bd.maxProgress == 0 {
+		return nil
+	}
+	// Forget the blocks already processed by the Bodies stage
+	for blockNum, p := range bd.prefetchRequests {
+		if blockNum < bd.requestedLow {
+			if p.header != nil {
+				delete(bd.prefetchMap, doubleHashOf(p.header))
+			}
+			delete(bd.prefetchRequests, blockNum)
+		}
+	}
+	to := executionProgress + bd.lookahead
+	if to >= bd.maxProgress {
+		to = bd.maxProgress - 1
+	}
+	if !bd.prefetchedBlocks.HasRoom(len(bd.prefetchMap)) {
+		return nil
+	}
+	blockNums := make([]uint64, 0, BlockBufferSize)
+	hashes := make([]common.Hash, 0, BlockBufferSize)
+	for blockNum := bd.requestedLow; blockNum <= to && len(blockNums) < BlockBufferSize; blockNum++ {
+		if i := blockNum - bd.requestedLow; i < uint64(len(bd.deliveries)) && (bd.deliveries[i] != nil || bd.delivered.Contains(blockNum)) {
+			// Taken by the Bodies stage
+			continue
+		}
+		p, ok := bd.prefetchRequests[blockNum]
+		if !ok {
+			hash, err := rawdb.ReadCanonicalHash(db, blockNum)
+			if err != nil || hash == (common.Hash{}) {
+				break
+			}
+			header := rawdb.ReadHeader(db, hash, blockNum)
+			if header == nil {
+				break
+			}
+			p = &prefetchRequest{hash: hash}
+			bd.prefetchRequests[blockNum] = p
+			if header.UncleHash == types.EmptyUncleHash && header.TxHash == types.EmptyRootHash {
+				// Nothing to download
+				continue
+			}
+			p.header = header
+			bd.prefetchMap[doubleHashOf(header)] = blockNum
+		}
+		if p.header == nil || currentTime < p.waitUntil {
+			// Already delivered, or still being downloaded
+			continue
+		}
+		blockNums = append(blockNums, blockNum)
+		hashes = append(hashes, p.hash)
+	}
+	if len(blockNums) == 0 {
+		return nil
+	}
+	return &BodyRequest{BlockNums: blockNums, Hashes: hashes}
+}
+
+// PrefetchSent records that the prefetch request has been sent to a peer, and when it times out
+func (bd *BodyDownload) PrefetchSent(req *BodyRequest, timeWithTimeout uint64) {
+	bd.lock.Lock()
+	defer bd.lock.Unlock()
+	for _, blockNum := range req.BlockNums {
+		if p, ok := bd.prefetchRequests[blockNum]; ok && p.header != nil {
+			p.waitUntil = timeWithTimeout
+		}
+	}
+}
+
+// prefetching returns whether the body of the block is being prefetched, so the Bodies stage does not need to request it
+func (bd *BodyDownload) prefetching(blockNum uint64, currentTime uint64) bool {
+	p, ok := bd.prefetchRequests[blockNum]
+	return ok && p.header != nil && currentTime < p.waitUntil
+}
+
+// deliverPrefetched puts the body of the prefetch request into the prefetched blocks, returns false if
+// there is no prefetch request for it. If the body has been delivered to the Bodies stage instead, it
+// is only marked as delivered
+func (bd *BodyDownload) deliverPrefetched(doubleHash DoubleHash, body *types.Body, toStage bool) bool {
+	blockNum, ok := bd.prefetchMap[doubleHash]
+	if !ok {
+		return false
+	}
+	delete(bd.prefetchMap, doubleHash)
+	p := bd.prefetchRequests[blockNum]
+	if !toStage {
+		bd.prefetchedBlocks.Add(types.NewBlockWithHeader(p.header).WithBody(body.Transactions, body.Uncles))
+	}
+	p.header = nil
+	return true
+}
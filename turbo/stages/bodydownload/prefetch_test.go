@@ -0,0 +1,110 @@
+package bodydownload
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// writeChain writes the canonical headers of the blocks 0..n, block 3 has an empty body
+func writeChain(t *testing.T, db ethdb.Database, n uint64) map[uint64]*types.Body {
+	bodies := make(map[uint64]*types.Body)
+	parent := common.Hash{}
+	for i := uint64(0); i <= n; i++ {
+		header := &types.Header{ParentHash: parent, Number: new(big.Int).SetUint64(i), Difficulty: big.NewInt(1), UncleHash: types.EmptyUncleHash, TxHash: types.EmptyRootHash}
+		if i > 0 && i != 3 {
+			txs := types.Transactions{types.NewTransaction(i, common.Address{}, uint256.NewInt(), 21000, uint256.NewInt(), nil)}
+			header.TxHash = types.DeriveSha(txs)
+			bodies[i] = &types.Body{Transactions: txs}
+		}
+		rawdb.WriteHeader(context.Background(), db, header)
+		if err := rawdb.WriteCanonicalHash(db, header.Hash(), i); err != nil {
+			t.Fatal(err)
+		}
+		if err := rawdb.WriteTd(db, header.Hash(), i, big.NewInt(int64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+		parent = header.Hash()
+	}
+	if err := stages.SaveStageProgress(db, stages.Headers, n); err != nil {
+		t.Fatal(err)
+	}
+	return bodies
+}
+
+func TestPrefetchBodies(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	bodies := writeChain(t, db, 10)
+	bd := NewBodyDownload(100)
+	bd.SetPrefetchLimits(5, datasize.MB)
+	if _, _, _, err := bd.UpdateFromDb(db); err != nil {
+		t.Fatalf("update from db: %v", err)
+	}
+
+	// Only 5 blocks ahead of the execution, the empty block is not requested
+	req := bd.RequestPrefetch(db, 0, 100)
+	if req == nil || !reflect.DeepEqual(req.BlockNums, []uint64{1, 2, 4, 5}) {
+		t.Fatalf("unexpected prefetch request %v", req)
+	}
+	bd.PrefetchSent(req, 110)
+	if req = bd.RequestPrefetch(db, 0, 100); req != nil {
+		t.Fatalf("expected no request while the bodies are being prefetched, got %v", req.BlockNums)
+	}
+	if delivered, undelivered := bd.DeliverBodies([]*types.Body{bodies[1], bodies[2]}); delivered != 2 || undelivered != 0 {
+		t.Fatalf("expected 2 prefetched bodies delivered, got %d delivered, %d undelivered", delivered, undelivered)
+	}
+
+	// The Bodies stage takes the prefetched blocks, and waits for the ones still being prefetched
+	req, _ = bd.RequestMoreBodies(db, 0, 100)
+	if req == nil || !reflect.DeepEqual(req.BlockNums, []uint64{6, 7, 8, 9, 10}) {
+		t.Fatalf("unexpected bodies request %v", req)
+	}
+	if d := bd.GetDeliveries(); len(d) != 3 || len(d[0].Transactions()) != 1 || len(d[1].Transactions()) != 1 || len(d[2].Transactions()) != 0 {
+		t.Fatalf("expected blocks 1-3 to be delivered, got %d", len(d))
+	}
+	// The prefetched body which arrives while the Bodies stage is running goes to the stage
+	if delivered, _ := bd.DeliverBodies([]*types.Body{bodies[4]}); delivered != 1 {
+		t.Fatalf("expected the prefetched body delivered")
+	}
+	if d := bd.GetDeliveries(); len(d) != 1 || d[0].NumberU64() != 4 || len(d[0].Transactions()) != 1 {
+		t.Fatalf("expected block 4 to be delivered, got %d", len(d))
+	}
+}
+
+func TestPrefetchedBlocksMemoryLimit(t *testing.T) {
+	pb := NewPrefetchedBlocks()
+	block := func(i uint64) *types.Block {
+		txs := types.Transactions{types.NewTransaction(i, common.Address{}, uint256.NewInt(), 21000, uint256.NewInt(), make([]byte, 1000))}
+		return types.NewBlock(&types.Header{Number: new(big.Int).SetUint64(i)}, txs, nil, nil)
+	}
+	limit := 3.5 * block(0).Size()
+	pb.SetLimits(100, limit)
+	for i := uint64(1); i <= 5; i++ {
+		pb.Add(block(i))
+	}
+	if pb.Size() > limit {
+		t.Errorf("prefetched blocks %v exceed the limit", pb.Size())
+	}
+	if !pb.HasRoom(0) || pb.HasRoom(1) {
+		t.Errorf("unexpected room for %v of %v", pb.Size(), limit)
+	}
+	if pb.Pop(block(1).Hash()) != nil {
+		t.Errorf("expected the oldest block to be evicted")
+	}
+	if pb.Pop(block(5).Hash()) == nil {
+		t.Errorf("expected the newest block to be kept")
+	}
+	if !pb.HasRoom(1) {
+		t.Errorf("expected room after the block is taken")
+	}
+}
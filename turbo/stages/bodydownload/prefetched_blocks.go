@@ -1,25 +1,61 @@
 package bodydownload
 
 import (
+	"sync"
+
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/golang-lru/simplelru"
 )
 
+// DefaultPrefetchedBlocks is the number of the prefetched blocks kept in memory when the body prefetching is off
+const DefaultPrefetchedBlocks = 1000
+
 type PrefetchedBlocks struct {
-	blocks *lru.Cache
+	lock     sync.Mutex
+	blocks   *simplelru.LRU     // Guarded by the lock
+	size     common.StorageSize // Total size of the blocks in the cache
+	maxSize  common.StorageSize // The oldest blocks are evicted above this size, no limit if zero
+	maxCount int
 }
 
 func NewPrefetchedBlocks() *PrefetchedBlocks {
-	cache, err := lru.New(1000)
+	pb := &PrefetchedBlocks{maxCount: DefaultPrefetchedBlocks}
+	cache, err := simplelru.NewLRU(DefaultPrefetchedBlocks, pb.onEvict)
 	if err != nil {
 		panic("error creating prefetching cache for blocks")
 	}
-	return &PrefetchedBlocks{blocks: cache}
+	pb.blocks = cache
+	return pb
+}
+
+// onEvict is called by the cache with pb.lock held, for the blocks removed from the cache in any way
+func (pb *PrefetchedBlocks) onEvict(_ interface{}, val interface{}) {
+	if block, ok := val.(*types.Block); ok {
+		pb.size -= block.Size()
+	}
+}
+
+// SetLimits changes the maximum number and the maximum total size of the blocks kept in the cache
+func (pb *PrefetchedBlocks) SetLimits(maxCount int, maxSize common.StorageSize) {
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
+	pb.maxCount = maxCount
+	pb.maxSize = maxSize
+	pb.blocks.Resize(maxCount)
+	pb.shrink()
+}
+
+func (pb *PrefetchedBlocks) shrink() {
+	for pb.maxSize > 0 && pb.size > pb.maxSize && pb.blocks.Len() > 0 {
+		pb.blocks.RemoveOldest()
+	}
 }
 
 func (pb *PrefetchedBlocks) Pop(hash common.Hash) *types.Block {
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
 	if val, ok := pb.blocks.Get(hash); ok && val != nil {
 		pb.blocks.Remove(hash)
 		if block, ok := val.(*types.Block); ok {
@@ -33,6 +69,34 @@ func (pb *PrefetchedBlocks) Add(b *types.Block) {
 	if b == nil {
 		return
 	}
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
 	hash := b.Hash()
-	pb.blocks.ContainsOrAdd(hash, b)
+	if !pb.blocks.Contains(hash) {
+		pb.blocks.Add(hash, b)
+		pb.size += b.Size()
+		pb.shrink()
+	}
+}
+
+// Size returns the total size of the blocks in the cache
+func (pb *PrefetchedBlocks) Size() common.StorageSize {
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
+	return pb.size
+}
+
+// HasRoom returns whether the cache can take the given number of blocks more, without evicting the older ones.
+// The size of the blocks not delivered yet is estimated from the average size of the blocks in the cache
+func (pb *PrefetchedBlocks) HasRoom(pending int) bool {
+	pb.lock.Lock()
+	defer pb.lock.Unlock()
+	count := pb.blocks.Len()
+	if count+pending >= pb.maxCount {
+		return false
+	}
+	if pb.maxSize == 0 || count == 0 {
+		return pb.maxSize == 0 || pb.size < pb.maxSize
+	}
+	return pb.size+pb.size/common.StorageSize(count)*common.StorageSize(pending) < pb.maxSize
 }
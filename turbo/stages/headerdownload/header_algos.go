@@ -7,6 +7,7 @@ import (
 	"math/big"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
@@ -495,9 +496,21 @@ func (hd *HeaderDownload) RequestMoreHeaders(currentTime uint64) *HeaderRequest
 	return nil
 }
 
-func (hd *HeaderDownload) SentRequest(req *HeaderRequest, currentTime, timeout uint64) {
+// SentRequest records the request sent to the peer, so that the request is not repeated until the timeout,
+// and the response of the peer can be scored
+func (hd *HeaderDownload) SentRequest(req *HeaderRequest, peer []byte, currentTime, timeout uint64) {
 	hd.lock.Lock()
 	defer hd.lock.Unlock()
+	ps := hd.getPeer(peer)
+	if minBlock := req.MinBlock(); minBlock > ps.height {
+		// The sentries only send the requests to the peers which have the headers
+		ps.height = minBlock
+	}
+	ps.pending = append(ps.pending, &pendingRequest{req: req, sent: time.Now(), deadline: currentTime + timeout})
+	if req.Skip > 0 {
+		hd.skeletons[skeletonWindow(req.Number)] = currentTime + timeout
+		return
+	}
 	anchor, ok := hd.anchors[req.Hash]
 	if !ok {
 		return
@@ -507,23 +520,6 @@ func (hd *HeaderDownload) SentRequest(req *HeaderRequest, currentTime, timeout u
 	heap.Fix(hd.anchorQueue, 0)
 }
 
-func (hd *HeaderDownload) RequestSkeleton() *HeaderRequest {
-	hd.lock.RLock()
-	defer hd.lock.RUnlock()
-	if len(hd.anchors) > 16 {
-		return nil // Need to be below anchor threshold to produce skeleton request
-	}
-	stride := uint64(8 * 192)
-	if hd.topSeenHeight < hd.highestInDb+stride {
-		return nil
-	}
-	length := (hd.topSeenHeight - hd.highestInDb) / stride
-	if length > 192 {
-		length = 192
-	}
-	return &HeaderRequest{Number: hd.highestInDb + stride, Length: length, Skip: stride, Reverse: false}
-}
-
 func (hd *HeaderDownload) InsertHeaders(hf func(header *types.Header, blockHeight uint64) error) error {
 	hd.lock.Lock()
 	defer hd.lock.Unlock()
@@ -177,10 +177,13 @@ type HeaderDownload struct {
 	stageReadyCh           chan struct{}
 	stageHeight            uint64
 	topSeenHeight          uint64
-	insertList             []*Link      // List of non-persisted links that can be inserted (their parent is persisted)
-	persistedLinkQueue     *LinkQueue   // Priority queue of persisted links used to limit their number
-	linkQueue              *LinkQueue   // Priority queue of non-persisted links used to limit their number
-	anchorQueue            *AnchorQueue // Priority queue of anchors used to sequence the header requests
+	insertList             []*Link               // List of non-persisted links that can be inserted (their parent is persisted)
+	persistedLinkQueue     *LinkQueue            // Priority queue of persisted links used to limit their number
+	linkQueue              *LinkQueue            // Priority queue of non-persisted links used to limit their number
+	anchorQueue            *AnchorQueue          // Priority queue of anchors used to sequence the header requests
+	peers                  map[string]*peerScore // Scores of the peers the header requests were sent to
+	penaltyPeers           [][]byte              // Peers found to be withholding headers, to be penalised
+	skeletons              map[uint64]uint64     // Deadlines of the skeleton requests by the skeleton window
 }
 
 // HeaderRecord encapsulates two forms of the same header - raw RLP encoding (to avoid duplicated decodings and encodings), and parsed value types.Header
@@ -207,6 +210,8 @@ func NewHeaderDownload(
 		persistedLinkQueue: &LinkQueue{},
 		linkQueue:          &LinkQueue{},
 		anchorQueue:        &AnchorQueue{},
+		peers:              make(map[string]*peerScore),
+		skeletons:          make(map[uint64]uint64),
 	}
 	heap.Init(hd.persistedLinkQueue)
 	heap.Init(hd.linkQueue)
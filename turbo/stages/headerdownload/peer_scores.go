@@ -0,0 +1,231 @@
+package headerdownload
+
+import (
+	"math"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	skeletonStride      = 192 // One request of 192 headers going down from a skeleton header fills the gap to the previous one
+	skeletonLength      = 64  // Skeleton headers in one request, so that the skeleton is fetched from several peers in parallel
+	maxSkeletonRequests = 8   // Skeleton requests produced per round
+	withholdingLimit    = 3   // Strikes in a row after which the peer is considered to be withholding headers
+	latencySmoothing    = 0.2 // Weight of the latest response time in the moving average
+)
+
+// skeletonDelivered is the deadline of the skeleton windows which don't need to be requested again
+const skeletonDelivered = math.MaxUint64
+
+// pendingRequest is a header request sent to a peer and not answered yet
+type pendingRequest struct {
+	req      *HeaderRequest
+	sent     time.Time
+	deadline uint64
+}
+
+// peerScore is what the downloader learned about a peer from the header requests sent to it
+type peerScore struct {
+	height    uint64        // Highest header the peer claims to have
+	latency   time.Duration // Moving average of the response time, zero until the first delivery
+	delivered int           // Requests answered with the requested headers
+	strikes   int           // Requests in a row that timed out or were answered empty, reset by a delivery
+	pending   []*pendingRequest
+}
+
+// score is lower for the better peers. Faster peers are preferred, and each strike counts as a slower response.
+// The peers without deliveries yet have zero latency, so they are tried before the known ones
+func (ps *peerScore) score() float64 {
+	return float64(ps.latency) * float64(1+ps.strikes)
+}
+
+// MinBlock is the height a peer needs to have to answer the request
+func (req *HeaderRequest) MinBlock() uint64 {
+	if req.Reverse || req.Length == 0 {
+		return req.Number
+	}
+	return req.Number + (req.Length-1)*(req.Skip+1)
+}
+
+// matches returns whether the headers are the response to the request
+func (req *HeaderRequest) matches(headers []*types.Header) bool {
+	if len(headers) == 0 {
+		return false
+	}
+	if req.Hash != (common.Hash{}) {
+		return headers[0].Hash() == req.Hash
+	}
+	return headers[0].Number.Uint64() == req.Number
+}
+
+// skeletonWindow is the window of the skeleton requests the height belongs to. The windows are aligned to
+// the absolute heights, so that they stay the same while the headers are being inserted into the database
+func skeletonWindow(height uint64) uint64 {
+	return height / (skeletonLength * skeletonStride)
+}
+
+func (hd *HeaderDownload) getPeer(peer []byte) *peerScore {
+	ps, ok := hd.peers[string(peer)]
+	if !ok {
+		ps = &peerScore{}
+		hd.peers[string(peer)] = ps
+	}
+	return ps
+}
+
+// UpdatePeerHeight records the height the peer has shown to have, e.g. by announcing a new block
+func (hd *HeaderDownload) UpdatePeerHeight(peer []byte, height uint64) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	if ps := hd.getPeer(peer); height > ps.height {
+		ps.height = height
+	}
+}
+
+// RemovePeer forgets the peer, e.g. after it has been penalised for sending bad headers
+func (hd *HeaderDownload) RemovePeer(peer []byte) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	delete(hd.peers, string(peer))
+}
+
+// SelectPeer returns the peer with the best score out of the ones which have the headers of the request
+// and have no request outstanding, or nil if there is no such peer
+func (hd *HeaderDownload) SelectPeer(req *HeaderRequest) []byte {
+	hd.lock.RLock()
+	defer hd.lock.RUnlock()
+	minBlock := req.MinBlock()
+	var best string
+	var bestScore *peerScore
+	for peer, ps := range hd.peers {
+		if ps.height < minBlock || len(ps.pending) > 0 {
+			continue
+		}
+		if bestScore == nil || ps.score() < bestScore.score() || (ps.score() == bestScore.score() && peer < best) {
+			best, bestScore = peer, ps
+		}
+	}
+	if bestScore == nil {
+		return nil
+	}
+	return []byte(best)
+}
+
+// DeliveredHeaders matches the response of the peer with the requests sent to it, to score the peer.
+// Peers only answer a request for the headers they claimed to have with nothing when they withhold them
+func (hd *HeaderDownload) DeliveredHeaders(peer []byte, headers []*types.Header) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	ps := hd.getPeer(peer)
+	for _, header := range headers {
+		if header.Number.Uint64() > ps.height {
+			ps.height = header.Number.Uint64()
+		}
+	}
+	for i, p := range ps.pending {
+		if !p.req.matches(headers) {
+			continue
+		}
+		sample := time.Since(p.sent)
+		if ps.delivered == 0 {
+			ps.latency = sample
+		} else {
+			ps.latency = time.Duration((1-latencySmoothing)*float64(ps.latency) + latencySmoothing*float64(sample))
+		}
+		ps.delivered++
+		ps.strikes = 0
+		ps.pending = append(ps.pending[:i], ps.pending[i+1:]...)
+		if p.req.Skip > 0 {
+			hd.skeletons[skeletonWindow(p.req.Number)] = skeletonDelivered
+		}
+		return
+	}
+	if len(headers) == 0 && len(ps.pending) > 0 {
+		// The peers answer in order, so the empty response is for the oldest request
+		p := ps.pending[0]
+		ps.pending = ps.pending[1:]
+		if ps.height >= p.req.MinBlock() {
+			hd.strike(peer, ps, "empty response")
+		}
+	}
+}
+
+// ExpireRequests gives a strike to the peers which did not answer the requests in time
+func (hd *HeaderDownload) ExpireRequests(currentTime uint64) {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	for peer, ps := range hd.peers {
+		var expired int
+		for len(ps.pending) > 0 && ps.pending[0].deadline < currentTime {
+			ps.pending = ps.pending[1:]
+			expired++
+		}
+		for i := 0; i < expired && hd.peers[peer] != nil; i++ {
+			hd.strike([]byte(peer), ps, "timeout")
+		}
+	}
+}
+
+func (hd *HeaderDownload) strike(peer []byte, ps *peerScore, reason string) {
+	ps.strikes++
+	if ps.strikes >= withholdingLimit {
+		log.Debug("Peer is withholding headers", "peer", string(peer), "height", ps.height, "reason", reason)
+		hd.penaltyPeers = append(hd.penaltyPeers, peer)
+		delete(hd.peers, string(peer))
+	}
+}
+
+// PenaltyPeers returns the peers found to be withholding headers since the last call, they need to be penalised
+func (hd *HeaderDownload) PenaltyPeers() [][]byte {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	peers := hd.penaltyPeers
+	hd.penaltyPeers = nil
+	return peers
+}
+
+// RequestSkeletons returns the requests for the skeleton headers between the highest header in the database
+// and the highest seen one. The skeleton is split into the windows, and each window goes to a different peer,
+// so the skeleton headers are fetched in parallel. Every skeleton header becomes an anchor, and the gaps
+// between the anchors are then filled by the disjoint requests of RequestMoreHeaders
+func (hd *HeaderDownload) RequestSkeletons(currentTime uint64) []*HeaderRequest {
+	hd.lock.Lock()
+	defer hd.lock.Unlock()
+	// Forget the windows which are already in the database, and let the timed out ones be requested again
+	for w, deadline := range hd.skeletons {
+		if (w+1)*skeletonLength*skeletonStride <= hd.highestInDb+1 || deadline < currentTime {
+			delete(hd.skeletons, w)
+		}
+	}
+	// Every skeleton header turns into an anchor, so the outstanding windows must not exceed the anchor limit
+	capacity := hd.anchorLimit/2 - len(hd.anchors)
+	for _, deadline := range hd.skeletons {
+		if deadline != skeletonDelivered {
+			capacity -= skeletonLength
+		}
+	}
+	var reqs []*HeaderRequest
+	for w := skeletonWindow(hd.highestInDb + 1); len(reqs) < maxSkeletonRequests && capacity >= skeletonLength; w++ {
+		from := w * skeletonLength * skeletonStride
+		if from <= hd.highestInDb {
+			from = (hd.highestInDb/skeletonStride + 1) * skeletonStride
+		}
+		if from > hd.topSeenHeight {
+			break
+		}
+		if _, requested := hd.skeletons[w]; requested {
+			continue
+		}
+		to := (w+1)*skeletonLength*skeletonStride - 1
+		if to > hd.topSeenHeight {
+			to = hd.topSeenHeight
+		}
+		length := (to-from)/skeletonStride + 1
+		reqs = append(reqs, &HeaderRequest{Number: from, Length: length, Skip: skeletonStride - 1, Reverse: false})
+		capacity -= skeletonLength
+	}
+	return reqs
+}
@@ -0,0 +1,136 @@
+package headerdownload
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+func TestSelectPeer(t *testing.T) {
+	hd := NewHeaderDownload(100, 100, ethash.NewFaker())
+	req := &HeaderRequest{Number: 1000, Length: 192, Reverse: true}
+
+	if peer := hd.SelectPeer(req); peer != nil {
+		t.Errorf("expected no peer, got %s", peer)
+	}
+	hd.UpdatePeerHeight([]byte("low"), 999)
+	hd.UpdatePeerHeight([]byte("slow"), 2000)
+	hd.UpdatePeerHeight([]byte("fast"), 2000)
+	hd.peers["slow"].latency = 2 * time.Second
+	hd.peers["fast"].latency = 100 * time.Millisecond
+	if peer := hd.SelectPeer(req); string(peer) != "fast" {
+		t.Errorf("expected fast peer, got %s", peer)
+	}
+
+	// Busy peers are skipped
+	hd.SentRequest(req, []byte("fast"), 100, 5)
+	if peer := hd.SelectPeer(req); string(peer) != "slow" {
+		t.Errorf("expected slow peer, got %s", peer)
+	}
+	hd.SentRequest(req, []byte("slow"), 100, 5)
+	if peer := hd.SelectPeer(req); peer != nil {
+		t.Errorf("expected no peer, got %s", peer)
+	}
+
+	// Delivery of the requested headers frees the peer
+	h := &types.Header{Number: big.NewInt(1000)}
+	hd.DeliveredHeaders([]byte("fast"), []*types.Header{h})
+	if peer := hd.SelectPeer(&HeaderRequest{Number: 1000, Length: 1}); string(peer) != "fast" {
+		t.Errorf("expected fast peer, got %s", peer)
+	}
+	if ps := hd.peers["fast"]; ps.delivered != 1 || len(ps.pending) != 0 {
+		t.Errorf("expected 1 delivery and no pending requests, got %d and %d", ps.delivered, len(ps.pending))
+	}
+}
+
+func TestWithholdingPeer(t *testing.T) {
+	hd := NewHeaderDownload(100, 100, ethash.NewFaker())
+	peer := []byte("peer")
+	req := &HeaderRequest{Number: 1000, Length: 192, Reverse: true}
+
+	// Empty responses for the headers the peer claimed to have
+	for i := 0; i < withholdingLimit-1; i++ {
+		hd.SentRequest(req, peer, 100, 5)
+		hd.DeliveredHeaders(peer, nil)
+	}
+	if penalties := hd.PenaltyPeers(); len(penalties) != 0 {
+		t.Errorf("expected no penalties yet, got %d", len(penalties))
+	}
+	// Timeout
+	hd.SentRequest(req, peer, 100, 5)
+	hd.ExpireRequests(105)
+	if penalties := hd.PenaltyPeers(); len(penalties) != 0 {
+		t.Errorf("expected no penalties before the deadline, got %d", len(penalties))
+	}
+	hd.ExpireRequests(106)
+	penalties := hd.PenaltyPeers()
+	if len(penalties) != 1 || string(penalties[0]) != "peer" {
+		t.Errorf("expected the peer to be penalised, got %q", penalties)
+	}
+	if _, ok := hd.peers["peer"]; ok {
+		t.Errorf("expected the penalised peer to be forgotten")
+	}
+
+	// A delivery resets the strikes
+	for i := 0; i < 2*withholdingLimit; i++ {
+		hd.SentRequest(req, peer, 100, 5)
+		if i%2 == 0 {
+			hd.DeliveredHeaders(peer, nil)
+		} else {
+			hd.DeliveredHeaders(peer, []*types.Header{{Number: big.NewInt(1000)}})
+		}
+	}
+	if penalties := hd.PenaltyPeers(); len(penalties) != 0 {
+		t.Errorf("expected no penalties, got %d", len(penalties))
+	}
+}
+
+func TestRequestSkeletons(t *testing.T) {
+	hd := NewHeaderDownload(512, 100, ethash.NewFaker())
+	window := uint64(skeletonLength * skeletonStride)
+	hd.highestInDb = 100
+	hd.topSeenHeight = 3*window + 1000
+
+	reqs := hd.RequestSkeletons(100)
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 skeleton requests, got %d", len(reqs))
+	}
+	if reqs[0].Number != skeletonStride || reqs[0].Length != skeletonLength-1 {
+		t.Errorf("unexpected first request %+v", reqs[0])
+	}
+	for i, req := range reqs[1:] {
+		if req.Number != uint64(i+1)*window || req.Skip != skeletonStride-1 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if req.MinBlock() > hd.topSeenHeight {
+			t.Errorf("request %+v goes beyond the top seen height", req)
+		}
+	}
+	// Disjoint parts of the skeleton go to different peers
+	for i, req := range reqs {
+		hd.SentRequest(req, []byte{byte(i)}, 100, 5)
+	}
+	if reqs := hd.RequestSkeletons(100); len(reqs) != 0 {
+		t.Errorf("expected no requests while the skeleton is being fetched, got %d", len(reqs))
+	}
+	hd.DeliveredHeaders([]byte{1}, []*types.Header{{Number: big.NewInt(int64(window))}})
+	reqs = hd.RequestSkeletons(106)
+	if len(reqs) != 3 {
+		t.Fatalf("expected the timed out requests to be repeated, got %d", len(reqs))
+	}
+	for _, req := range reqs {
+		if req.Number == window {
+			t.Errorf("delivered part of the skeleton requested again")
+		}
+	}
+
+	// The anchor limit caps the skeleton
+	hd = NewHeaderDownload(2*skeletonLength, 100, ethash.NewFaker())
+	hd.topSeenHeight = 3 * window
+	if reqs := hd.RequestSkeletons(100); len(reqs) != 1 {
+		t.Errorf("expected 1 skeleton request, got %d", len(reqs))
+	}
+}
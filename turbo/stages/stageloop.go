@@ -2,6 +2,7 @@ package stages
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -41,6 +42,9 @@ func StageLoop(
 		ReplacementUnwindOrder(),
 		stagedsync.OptionalParameters{},
 	)
+	if bd.Prefetching() {
+		go PrefetchBodies(ctx, db, bd, bodyReqSend, timeout)
+	}
 	initialCycle := true
 	stopped := false
 	for !stopped {
@@ -78,7 +82,7 @@ func StageLoop(
 		cc := &core.TinyChainContext{}
 		cc.SetDB(tx)
 		//cc.SetEngine(d.blockchain.Engine())
-		st, err1 := sync.Prepare(nil, chainConfig, cc, &vm.Config{}, db, writeDB, "downloader", ethdb.DefaultStorageMode, ".", nil, 512*1024*1024, make(chan struct{}), nil, nil, func() error { return nil }, initialCycle, nil)
+		st, err1 := sync.Prepare(nil, chainConfig, cc, &vm.Config{}, db, writeDB, "downloader", ethdb.DefaultStorageMode, ".", nil, 512*1024*1024, ctx.Done(), nil, nil, func() error { return nil }, initialCycle, nil)
 		if err1 != nil {
 			return fmt.Errorf("prepare staged sync: %w", err1)
 		}
@@ -92,7 +96,7 @@ func StageLoop(
 
 			var errTx error
 			log.Debug("Begin tx")
-			tx, errTx = tx.Begin(context.Background(), ethdb.RW)
+			tx, errTx = tx.Begin(st.Context(), ethdb.RW)
 			return errTx
 		})
 		st.OnBeforeUnwind(func(id stages.SyncStage) error {
@@ -107,7 +111,7 @@ func StageLoop(
 			}
 			var errTx error
 			log.Debug("Begin tx")
-			tx, errTx = tx.Begin(context.Background(), ethdb.RW)
+			tx, errTx = tx.Begin(st.Context(), ethdb.RW)
 			return errTx
 		})
 		st.BeforeStageUnwind(stages.Bodies, func() error {
@@ -123,6 +127,12 @@ func StageLoop(
 		})
 
 		err = st.Run(db, writeDB)
+		if errors.Is(err, common.ErrStopped) {
+			// Interrupted by the shutdown, the stages checkpointed what they could and the
+			// uncommitted part of the cycle is rolled back
+			log.Info("Sync cycle interrupted")
+			return nil
+		}
 		if err != nil {
 			return err
 		}
@@ -147,6 +157,43 @@ func StageLoop(
 	return nil
 }
 
+// PrefetchBodies keeps downloading the block bodies ahead of the execution while the stages are running, so that
+// the Bodies stage finds them in memory, and the execution does not wait for the network between the cycles
+func PrefetchBodies(
+	ctx context.Context,
+	db ethdb.Database,
+	bd *bodydownload.BodyDownload,
+	bodyReqSend func(context.Context, *bodydownload.BodyRequest) []byte,
+	timeout int,
+) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		executionProgress, err := stages.GetStageProgress(db, stages.Execution)
+		if err != nil {
+			log.Error("Prefetching bodies", "error", err)
+			continue
+		}
+		for {
+			currentTime := uint64(time.Now().Unix())
+			req := bd.RequestPrefetch(db, executionProgress, currentTime)
+			if req == nil {
+				break
+			}
+			peer := bodyReqSend(ctx, req)
+			if peer == nil {
+				break
+			}
+			bd.PrefetchSent(req, currentTime+uint64(timeout))
+		}
+	}
+}
+
 func ReplacementStages(ctx context.Context,
 	hd *headerdownload.HeaderDownload,
 	bd *bodydownload.BodyDownload,
@@ -165,7 +212,7 @@ func ReplacementStages(ctx context.Context,
 					ID:          stages.Headers,
 					Description: "Download headers",
 					ExecFunc: func(s *stagedsync.StageState, u stagedsync.Unwinder) error {
-						return stagedsync.HeadersForward(s, u, ctx, world.TX, hd, world.ChainConfig, headerReqSend, world.InitialCycle, wakeUpChan, world.BatchSize)
+						return stagedsync.HeadersForward(s, u, ctx, world.TX, hd, world.ChainConfig, headerReqSend, penalise, world.InitialCycle, wakeUpChan, world.BatchSize)
 					},
 					UnwindFunc: func(u *stagedsync.UnwindState, s *stagedsync.StageState) error {
 						return stagedsync.HeadersUnwind(u, s, world.TX)
@@ -198,7 +245,7 @@ func ReplacementStages(ctx context.Context,
 						return stagedsync.BodiesForward(s, ctx, world.TX, bd, bodyReqSend, penalise, updateHead, wakeUpChan, timeout, world.BatchSize)
 					},
 					UnwindFunc: func(u *stagedsync.UnwindState, s *stagedsync.StageState) error {
-						return u.Done(world.DB)
+						return stagedsync.UnwindBodyDownloadStage(u, world.DB)
 					},
 				}
 			},
@@ -0,0 +1,64 @@
+package tokens
+
+import (
+	"bytes"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+)
+
+// TransferTopic is the topic of the Transfer(address,address,uint256) events of both the ERC-20 and the ERC-721
+// tokens. The ERC-721 transfers index the third argument, the id of the token, the ERC-20 ones keep the value in the data
+var TransferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+// Standard of the token emitting the transfer
+const (
+	ERC20  = "erc20"
+	ERC721 = "erc721"
+)
+
+// Transfer is a token transfer parsed from its event
+type Transfer struct {
+	Token    common.Address
+	Standard string
+	From     common.Address // zero for the minted tokens
+	To       common.Address // zero for the burnt tokens
+	Value    *uint256.Int   // amount of the ERC-20 tokens, id of the ERC-721 token
+}
+
+// ParseTransfer parses the ERC-20 or the ERC-721 transfer from the log, nil if the log isn't a well-formed transfer
+func ParseTransfer(l *types.Log) *Transfer {
+	if len(l.Topics) < 3 || l.Topics[0] != TransferTopic {
+		return nil
+	}
+	from, ok := topicAddress(l.Topics[1])
+	if !ok {
+		return nil
+	}
+	to, ok := topicAddress(l.Topics[2])
+	if !ok {
+		return nil
+	}
+	transfer := &Transfer{Token: l.Address, From: from, To: to}
+	switch {
+	case len(l.Topics) == 3 && len(l.Data) == 32:
+		transfer.Standard = ERC20
+		transfer.Value = new(uint256.Int).SetBytes(l.Data)
+	case len(l.Topics) == 4 && len(l.Data) == 0:
+		transfer.Standard = ERC721
+		transfer.Value = new(uint256.Int).SetBytes(l.Topics[3][:])
+	default:
+		return nil
+	}
+	return transfer
+}
+
+// topicAddress is the address of the indexed argument, which has to be padded with the zeroes
+func topicAddress(topic common.Hash) (common.Address, bool) {
+	padding := common.HashLength - common.AddressLength
+	if !bytes.Equal(topic[:padding], make([]byte, padding)) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(topic[padding:]), true
+}
@@ -0,0 +1,34 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTransfer(t *testing.T) {
+	token, from, to := common.Address{1}, common.Address{0xa}, common.Address{0xb}
+	value := common.LeftPadBytes([]byte{42}, 32)
+	for _, tt := range []struct {
+		name     string
+		log      *types.Log
+		expected *Transfer
+	}{
+		{"erc20", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, from.Hash(), to.Hash()}, Data: value},
+			&Transfer{Token: token, Standard: ERC20, From: from, To: to, Value: uint256.NewInt().SetUint64(42)}},
+		{"erc721", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, from.Hash(), to.Hash(), common.BytesToHash(value)}},
+			&Transfer{Token: token, Standard: ERC721, From: from, To: to, Value: uint256.NewInt().SetUint64(42)}},
+		{"mint", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, {}, to.Hash()}, Data: value},
+			&Transfer{Token: token, Standard: ERC20, To: to, Value: uint256.NewInt().SetUint64(42)}},
+		{"other event", &types.Log{Address: token, Topics: []common.Hash{{1}, from.Hash(), to.Hash()}, Data: value}, nil},
+		{"unindexed arguments", &types.Log{Address: token, Topics: []common.Hash{TransferTopic}, Data: append(append(from.Hash().Bytes(), to.Hash().Bytes()...), value...)}, nil},
+		{"erc20 without value", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, from.Hash(), to.Hash()}}, nil},
+		{"erc721 with data", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, from.Hash(), to.Hash(), common.BytesToHash(value)}, Data: value}, nil},
+		{"not an address", &types.Log{Address: token, Topics: []common.Hash{TransferTopic, common.BytesToHash(value), {0xff}}, Data: value}, nil},
+	} {
+		assert.Equal(t, tt.expected, ParseTransfer(tt.log), tt.name)
+	}
+}
@@ -0,0 +1,106 @@
+// Package tracetest replays recorded transactions through the tracers and compares the output
+// with the golden traces saved with them, so that the changes of the tracers and of the EVM
+// which alter the traces are noticed.
+//
+// A fixture is recorded from the database of a synced node: the pre-state the block read up to
+// the traced transaction is captured with the recording reader of the differential checks, so
+// the transaction is replayed without the database. The fixtures are checked by the tests built
+// with the golden tag:
+//
+//	go test -tags golden ./turbo/tracetest -golden.dir <dir>
+//
+// and by the checkTraces command of the state tool, which users can run against the fixtures
+// recorded by their own node.
+package tracetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+)
+
+// StructLogger is the name the traces of the default struct logger are saved under
+const StructLogger = "structLogger"
+
+// DefaultTracers are the tracers the fixtures are recorded with by default
+var DefaultTracers = []string{StructLogger, "callTracer", "prestateTracer", "4byteTracer"}
+
+// Fixture is a recorded transaction with its golden traces. The last transaction is traced, the
+// ones before it precede it in the block and are replayed to reach its pre-state
+type Fixture struct {
+	Config *params.ChainConfig        `json:"config"`
+	Env    *difftest.Env              `json:"env"`
+	Alloc  core.GenesisAlloc          `json:"alloc"`
+	Txs    types.Transactions         `json:"txs"`
+	Traces map[string]json.RawMessage `json:"traces"`
+}
+
+// Hash is the hash of the traced transaction
+func (f *Fixture) Hash() string {
+	if len(f.Txs) == 0 {
+		return ""
+	}
+	return f.Txs[len(f.Txs)-1].Hash().Hex()
+}
+
+// Tracers returns the names of the tracers with the golden traces, in the alphabetical order
+func (f *Fixture) Tracers() []string {
+	names := make([]string, 0, len(f.Traces))
+	for name := range f.Traces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFixture reads the fixture from the file
+func ReadFixture(path string) (*Fixture, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := new(Fixture)
+	if err = json.Unmarshal(blob, f); err != nil {
+		return nil, fmt.Errorf("parsing fixture %s: %w", path, err)
+	}
+	if len(f.Txs) == 0 {
+		return nil, fmt.Errorf("fixture %s has no transactions", path)
+	}
+	return f, nil
+}
+
+// WriteFixture writes the fixture into the file, indented to keep the diffs of the golden traces readable
+func WriteFixture(path string, f *Fixture) error {
+	blob, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(blob, '\n'), 0644)
+}
+
+// FixturePaths returns the paths of the fixtures in the directory
+func FixturePaths(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	return paths, nil
+}
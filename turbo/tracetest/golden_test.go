@@ -0,0 +1,54 @@
+// +build golden
+
+package tracetest
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	goldenDir    = flag.String("golden.dir", "testdata", "directory of the recorded transactions")
+	goldenUpdate = flag.Bool("golden.update", false, "replace the golden traces with the output of the current tracers")
+)
+
+// TestGoldenTraces replays the recorded transactions through the tracers. After an intended change of the traces,
+// the golden files are rewritten with -golden.update and the change is reviewed in their diff
+func TestGoldenTraces(t *testing.T) {
+	paths, err := FixturePaths(*goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skipf("no recorded transactions in %s", *goldenDir)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			t.Parallel()
+			f, err := ReadFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *goldenUpdate {
+				if err = f.Update(context.Background(), f.Tracers()); err != nil {
+					t.Fatal(err)
+				}
+				if err = WriteFixture(path, f); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			diffs, err := f.Check(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(diffs) > 0 {
+				t.Errorf("transaction %s differs from the golden traces:\n%s", f.Hash(), strings.Join(diffs, "\n"))
+			}
+		})
+	}
+}
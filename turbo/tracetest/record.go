@@ -0,0 +1,127 @@
+package tracetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/math"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/turbo/difftest"
+)
+
+// RecordFromDB records the fixture of the transaction from the database of the node, the state before the block of the
+// transaction is read from the history
+func RecordFromDB(ctx context.Context, db ethdb.Database, txHash common.Hash, tracerNames []string) (*Fixture, error) {
+	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(db, txHash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %x not found", txHash)
+	}
+	block := rawdb.ReadBlock(db, blockHash, blockNumber)
+	if block == nil {
+		return nil, fmt.Errorf("block %d %x of transaction %x not found", blockNumber, blockHash, txHash)
+	}
+	genesisHash, err := rawdb.ReadCanonicalHash(db, 0)
+	if err != nil {
+		return nil, err
+	}
+	config, err := rawdb.ReadChainConfig(db, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	getHeader := func(hash common.Hash, number uint64) *types.Header { return rawdb.ReadHeader(db, hash, number) }
+	return Record(ctx, config, block, int(txIndex), state.NewPlainDBState(db, blockNumber-1), getHeader, tracerNames)
+}
+
+// Record executes the transactions of the block up to the one at txIndex on top of the state read by the reader,
+// which must be the state after the parent block, and makes the fixture of the transaction with the golden traces
+// of the tracers. The fixture is replayed while recorded, and rejected if the replay does not use the same gas as
+// the execution on the real state, which would mean that the recorded pre-state is incomplete
+func Record(ctx context.Context, config *params.ChainConfig, block *types.Block, txIndex int, reader state.StateReader,
+	getHeader func(common.Hash, uint64) *types.Header, tracerNames []string) (*Fixture, error) {
+	if txIndex < 0 || txIndex >= len(block.Transactions()) {
+		return nil, fmt.Errorf("transaction index %d out of range for block %d", txIndex, block.NumberU64())
+	}
+	header := block.Header()
+	hashes := make(map[math.HexOrDecimal64]common.Hash)
+	blockCtx := core.NewEVMContextByHeader(nil, header, func(n uint64) common.Hash {
+		hash := blockHash(header, n, getHeader)
+		hashes[math.HexOrDecimal64(n)] = hash
+		return hash
+	})
+	pre := difftest.NewRecordingReader(reader)
+	ibs := state.New(pre)
+	signer := types.MakeSigner(config, header.Number)
+	var gasUsed uint64
+	for i, tx := range block.Transactions()[:txIndex+1] {
+		ibs.Prepare(tx.Hash(), block.Hash(), i)
+		msg, err := tx.AsMessage(signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		vmenv := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), ibs, config, vm.Config{})
+		result, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas()), true /* refunds */, false /* gasBailout */)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		if err = ibs.FinalizeTx(config.WithEIPsFlags(ctx, header.Number), state.NewNoopWriter()); err != nil {
+			return nil, err
+		}
+		gasUsed = result.UsedGas
+	}
+	alloc, err := pre.Alloc()
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{
+		Config: config,
+		Env: &difftest.Env{
+			Coinbase:    header.Coinbase,
+			Difficulty:  (*math.HexOrDecimal256)(header.Difficulty),
+			GasLimit:    math.HexOrDecimal64(header.GasLimit),
+			Number:      math.HexOrDecimal64(header.Number.Uint64()),
+			Timestamp:   math.HexOrDecimal64(header.Time),
+			BlockHashes: hashes,
+			BaseFee:     (*math.HexOrDecimal256)(header.BaseFee),
+		},
+		Alloc: alloc,
+		Txs:   append(types.Transactions(nil), block.Transactions()[:txIndex+1]...),
+	}
+	if err = f.Update(ctx, tracerNames); err != nil {
+		return nil, err
+	}
+	trace, err := f.Replay(ctx, StructLogger)
+	if err != nil {
+		return nil, err
+	}
+	var replayed struct {
+		Gas uint64 `json:"gas"`
+	}
+	if err = json.Unmarshal(trace, &replayed); err != nil {
+		return nil, err
+	}
+	if replayed.Gas != gasUsed {
+		return nil, fmt.Errorf("replay of transaction %x used %d gas instead of %d, the recorded pre-state is incomplete", f.Hash(), replayed.Gas, gasUsed)
+	}
+	return f, nil
+}
+
+// blockHash returns the hash of the ancestor of the header, as the BLOCKHASH opcode sees it
+func blockHash(header *types.Header, n uint64, getHeader func(common.Hash, uint64) *types.Header) common.Hash {
+	hash, number := header.ParentHash, header.Number.Uint64()-1
+	for number > n {
+		h := getHeader(hash, number)
+		if h == nil {
+			return common.Hash{}
+		}
+		hash, number = h.ParentHash, number-1
+	}
+	return hash
+}
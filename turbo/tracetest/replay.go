@@ -0,0 +1,231 @@
+package tracetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/math"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/tracers"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/turbo/transactions"
+)
+
+const maxDiffs = 10 // Differences reported per trace, the rest is usually the consequence of the first ones
+
+// Replay executes the transactions of the fixture on top of its pre-state, and traces the last one with the tracer.
+// The trace is produced by the same code as the debug_traceTransaction results
+func (f *Fixture) Replay(ctx context.Context, tracer string) (json.RawMessage, error) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ibs, err := preState(ctx, db, f.Alloc)
+	if err != nil {
+		return nil, err
+	}
+	header := f.header()
+	blockCtx := core.NewEVMContextByHeader(nil, header, func(n uint64) common.Hash {
+		return f.Env.BlockHashes[math.HexOrDecimal64(n)]
+	})
+	signer := types.MakeSigner(f.Config, header.Number)
+	for i, tx := range f.Txs {
+		ibs.Prepare(tx.Hash(), common.Hash{}, i)
+		msg, err := tx.AsMessage(signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		txCtx := core.NewEVMTxContext(msg)
+		if i < len(f.Txs)-1 {
+			vmenv := vm.NewEVM(blockCtx, txCtx, ibs, f.Config, vm.Config{})
+			if _, err = core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas()), true /* refunds */, false /* gasBailout */); err != nil {
+				return nil, fmt.Errorf("transaction %d: %w", i, err)
+			}
+			if err = ibs.FinalizeTx(f.Config.WithEIPsFlags(ctx, header.Number), state.NewNoopWriter()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var config *tracers.TraceConfig
+		if tracer != StructLogger {
+			config = &tracers.TraceConfig{Tracer: &tracer}
+		}
+		result, err := transactions.TraceTx(ctx, msg, blockCtx, txCtx, ibs, config, f.Config)
+		if err != nil {
+			return nil, err
+		}
+		if raw, ok := result.(json.RawMessage); ok {
+			return raw, nil
+		}
+		return json.Marshal(result)
+	}
+	return nil, fmt.Errorf("no transactions to trace")
+}
+
+// Check replays the transaction with the tracers of the golden traces and returns the differences from them
+func (f *Fixture) Check(ctx context.Context) ([]string, error) {
+	var diffs []string
+	for _, name := range f.Tracers() {
+		have, err := f.Replay(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		d, err := compareTraces(have, f.Traces[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, diff := range d {
+			diffs = append(diffs, name+": "+diff)
+		}
+	}
+	return diffs, nil
+}
+
+// Update replaces the golden traces with the output of the current tracers
+func (f *Fixture) Update(ctx context.Context, tracerNames []string) error {
+	traces := make(map[string]json.RawMessage, len(tracerNames))
+	for _, name := range tracerNames {
+		trace, err := f.Replay(ctx, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if traces[name], err = withoutTimes(trace); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	f.Traces = traces
+	return nil
+}
+
+func (f *Fixture) header() *types.Header {
+	header := &types.Header{
+		Coinbase:   f.Env.Coinbase,
+		Number:     new(big.Int).SetUint64(uint64(f.Env.Number)),
+		Time:       uint64(f.Env.Timestamp),
+		GasLimit:   uint64(f.Env.GasLimit),
+		Difficulty: new(big.Int),
+	}
+	if f.Env.Difficulty != nil {
+		header.Difficulty.Set((*big.Int)(f.Env.Difficulty))
+	}
+	if f.Env.BaseFee != nil {
+		header.BaseFee = new(big.Int).Set((*big.Int)(f.Env.BaseFee))
+	}
+	return header
+}
+
+// preState writes the allocation into the database the same way the genesis state is written, and returns the state on top of it
+func preState(ctx context.Context, db ethdb.Database, alloc core.GenesisAlloc) (*state.IntraBlockState, error) {
+	r, w := state.NewDbStateReader(db), state.NewDbStateWriter(db, 0)
+	ibs := state.New(r)
+	for addr, account := range alloc {
+		balance, _ := uint256.FromBig(account.Balance)
+		ibs.AddBalance(addr, balance)
+		ibs.SetCode(addr, account.Code)
+		ibs.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			key := key
+			val := uint256.NewInt().SetBytes(value.Bytes())
+			ibs.SetState(addr, &key, *val)
+		}
+		if len(account.Code) > 0 || len(account.Storage) > 0 {
+			ibs.SetIncarnation(addr, state.FirstContractIncarnation)
+		}
+	}
+	if err := ibs.FinalizeTx(ctx, w); err != nil {
+		return nil, err
+	}
+	return state.New(r), nil
+}
+
+// withoutTimes removes the execution times reported by the JavaScript tracers, so that the golden traces only change
+// with the output of the tracers
+func withoutTimes(trace json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(trace, &v); err != nil {
+		return nil, err
+	}
+	var strip func(v interface{})
+	strip = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			delete(v, "time")
+			for _, item := range v {
+				strip(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				strip(item)
+			}
+		}
+	}
+	strip(v)
+	return json.Marshal(v)
+}
+
+// compareTraces compares the traces as the JSON values, ignoring the execution times reported by the JavaScript tracers
+func compareTraces(have, want json.RawMessage) ([]string, error) {
+	var h, w interface{}
+	if err := json.Unmarshal(have, &h); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		return nil, fmt.Errorf("invalid golden trace: %w", err)
+	}
+	var diffs []string
+	diffValues("", h, w, &diffs)
+	return diffs, nil
+}
+
+func diffValues(path string, have, want interface{}, diffs *[]string) {
+	if len(*diffs) >= maxDiffs {
+		return
+	}
+	switch w := want.(type) {
+	case map[string]interface{}:
+		h, ok := have.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]struct{})
+		for k := range h {
+			keys[k] = struct{}{}
+		}
+		for k := range w {
+			keys[k] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			if k != "time" {
+				sorted = append(sorted, k)
+			}
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(path+"."+k, h[k], w[k], diffs)
+		}
+		return
+	case []interface{}:
+		h, ok := have.([]interface{})
+		if !ok {
+			break
+		}
+		if len(h) != len(w) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: have %d items, want %d", path, len(h), len(w)))
+		}
+		for i := 0; i < len(h) && i < len(w); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), h[i], w[i], diffs)
+		}
+		return
+	}
+	if !reflect.DeepEqual(have, want) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: have %v, want %v", path, have, want))
+	}
+}
@@ -0,0 +1,114 @@
+package tracetest
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	callerAddr = common.HexToAddress("0xaa")
+	revertAddr = common.HexToAddress("0xbb")
+)
+
+// testBlock makes the block with two transactions calling the contract, which stores a value, logs it and calls
+// the contract which reverts. The second transaction sees the storage written by the first one
+func testBlock(t *testing.T) (core.GenesisAlloc, *types.Block) {
+	alloc := core.GenesisAlloc{
+		testAddr: {Balance: big.NewInt(params.Ether)},
+		// SSTORE(0, SLOAD(0)+1), LOG0 of the value, CALL 0xbb
+		callerAddr: {Code: common.FromHex("60016000540160005560005460005260206000a06020600060006000600060bb61fffff15000"), Balance: new(big.Int)},
+		// MSTORE(0, 1), REVERT(0, 32)
+		revertAddr: {Code: common.FromHex("600160005260206000fd"), Balance: new(big.Int)},
+	}
+	signer := types.LatestSignerForChainID(params.AllEthashProtocolChanges.ChainID)
+	var txs types.Transactions
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx, err := types.SignTx(types.NewTransaction(nonce, callerAddr, uint256.NewInt(), 100000, uint256.NewInt().SetUint64(params.GWei), nil), signer, testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	header := &types.Header{Number: big.NewInt(10), Time: 1000, GasLimit: 10000000, Difficulty: big.NewInt(1), Coinbase: common.HexToAddress("0xc0")}
+	return alloc, types.NewBlock(header, txs, nil, nil)
+}
+
+func recordTestFixture(t *testing.T) *Fixture {
+	alloc, block := testBlock(t)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	if _, err := preState(context.Background(), db, alloc); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Record(context.Background(), params.AllEthashProtocolChanges, block, 1, state.NewDbStateReader(db), func(common.Hash, uint64) *types.Header { return nil }, DefaultTracers)
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+	return f
+}
+
+func TestRecordAndCheck(t *testing.T) {
+	f := recordTestFixture(t)
+	if len(f.Txs) != 2 || len(f.Traces) != len(DefaultTracers) {
+		t.Fatalf("expected 2 transactions and %d traces, got %d and %d", len(DefaultTracers), len(f.Txs), len(f.Traces))
+	}
+	if _, ok := f.Alloc[revertAddr]; !ok {
+		t.Errorf("expected the called contract in the pre-state")
+	}
+	var call struct {
+		GasUsed string `json:"gasUsed"`
+		Calls   []struct {
+			Error string `json:"error"`
+		} `json:"calls"`
+	}
+	if err := json.Unmarshal(f.Traces["callTracer"], &call); err != nil {
+		t.Fatal(err)
+	}
+	if len(call.Calls) != 1 || call.Calls[0].Error != "execution reverted" {
+		t.Errorf("unexpected call trace %s", f.Traces["callTracer"])
+	}
+
+	// The fixture survives the round trip through the file
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := WriteFixture(path, f); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ReadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := f.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("unexpected differences from the golden traces:\n%s", strings.Join(diffs, "\n"))
+	}
+}
+
+func TestCheckReportsDifferences(t *testing.T) {
+	f := recordTestFixture(t)
+	f.Traces["callTracer"] = json.RawMessage(strings.Replace(string(f.Traces["callTracer"]), `"execution reverted"`, `"out of gas"`, 1))
+	diffs, err := f.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || !strings.HasPrefix(diffs[0], "callTracer: .calls[0].error: have execution reverted") {
+		t.Errorf("unexpected differences %v", diffs)
+	}
+}
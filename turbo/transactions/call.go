@@ -24,13 +24,7 @@ import (
 const callTimeout = 5 * time.Minute
 
 func DoCall(ctx context.Context, args ethapi.CallArgs, tx ethdb.Database, blockNrOrHash rpc.BlockNumberOrHash, overrides *map[common.Address]ethapi.Account, GasCap uint64, chainConfig *params.ChainConfig) (*core.ExecutionResult, error) {
-	// todo: Pending state is only known by the miner
-	/*
-		if blockNrOrHash.BlockNumber != nil && *blockNrOrHash.BlockNumber == rpc.PendingBlockNumber {
-			block, state, _ := b.eth.miner.Pending()
-			return state, block.Header(), nil
-		}
-	*/
+	// Pending state is only known by the miner, or by the pending block builder of the rpcdaemon, see DoCallOnState
 	blockNumber, hash, err := rpchelper.GetBlockNumber(blockNrOrHash, tx)
 	if err != nil {
 		return nil, err
@@ -41,12 +35,18 @@ func DoCall(ctx context.Context, args ethapi.CallArgs, tx ethdb.Database, blockN
 	} else {
 		stateReader = state.NewPlainDBState(tx, blockNumber)
 	}
-	state := state.New(stateReader)
 
 	header := rawdb.ReadHeader(tx, hash, blockNumber)
 	if header == nil {
 		return nil, fmt.Errorf("block %d(%x) not found", blockNumber, hash)
 	}
+	return DoCallOnState(ctx, args, tx, stateReader, header, blockNrOrHash.RequireCanonical, overrides, GasCap, chainConfig)
+}
+
+// DoCallOnState executes the call on top of the state of the reader in the context of the header, e.g. of the
+// pending block which is not in the database
+func DoCallOnState(ctx context.Context, args ethapi.CallArgs, tx ethdb.Database, stateReader state.StateReader, header *types.Header, requireCanonical bool, overrides *map[common.Address]ethapi.Account, GasCap uint64, chainConfig *params.ChainConfig) (*core.ExecutionResult, error) {
+	state := state.New(stateReader)
 
 	// Override the fields of specified contracts before execution.
 	if overrides != nil {
@@ -95,11 +95,11 @@ func DoCall(ctx context.Context, args ethapi.CallArgs, tx ethdb.Database, blockN
 	defer cancel()
 
 	// Get a new instance of the EVM.
-	msg := args.ToMessage(GasCap)
+	msg := args.ToMessage(GasCap, header.BaseFee)
 
-	blockCtx, txCtx := GetEvmContext(msg, header, blockNrOrHash.RequireCanonical, tx)
+	blockCtx, txCtx := GetEvmContext(msg, header, requireCanonical, tx)
 
-	evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, vm.Config{})
+	evm := vm.NewEVM(blockCtx, txCtx, state, chainConfig, vm.Config{NoBaseFee: true})
 
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
@@ -122,6 +122,10 @@ func DoCall(ctx context.Context, args ethapi.CallArgs, tx ethdb.Database, blockN
 }
 
 func GetEvmContext(msg core.Message, header *types.Header, requireCanonical bool, db ethdb.Database) (vm.BlockContext, vm.TxContext) {
+	var baseFee *big.Int
+	if header.BaseFee != nil {
+		baseFee = new(big.Int).Set(header.BaseFee)
+	}
 	return vm.BlockContext{
 			CanTransfer: core.CanTransfer,
 			Transfer:    core.Transfer,
@@ -131,6 +135,7 @@ func GetEvmContext(msg core.Message, header *types.Header, requireCanonical bool
 			Time:        new(big.Int).SetUint64(header.Time),
 			Difficulty:  new(big.Int).Set(header.Difficulty),
 			GasLimit:    header.GasLimit,
+			BaseFee:     baseFee,
 		},
 		vm.TxContext{
 			Origin:   msg.From(),
@@ -15,7 +15,11 @@ import (
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+	"github.com/ledgerwatch/turbo-geth/tracing"
 	state2 "github.com/ledgerwatch/turbo-geth/turbo/adapter"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -34,6 +38,9 @@ type BlockGetter interface {
 
 // computeTxEnv returns the execution environment of a certain transaction.
 func ComputeTxEnv(ctx context.Context, blockGetter BlockGetter, cfg *params.ChainConfig, chain core.ChainContext, dbtx ethdb.Tx, blockHash common.Hash, txIndex uint64) (core.Message, vm.BlockContext, vm.TxContext, *state.IntraBlockState, *state2.StateReader, error) {
+	// The span shows how long the transactions before the traced one take to replay
+	ctx, span := tracing.Start(ctx, "replay block", trace.WithAttributes(attribute.Int64("tx_index", int64(txIndex))))
+	defer span.End()
 	// Create the parent state database
 	block, err := blockGetter.GetBlockByHash(blockHash)
 	if err != nil {
@@ -42,6 +49,7 @@ func ComputeTxEnv(ctx context.Context, blockGetter BlockGetter, cfg *params.Chai
 	if block == nil {
 		return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, fmt.Errorf("block %x not found", blockHash)
 	}
+	span.SetAttributes(attribute.Int64("block", int64(block.NumberU64())))
 	parent := blockGetter.GetBlock(block.ParentHash(), block.NumberU64()-1)
 	if parent == nil {
 		return nil, vm.BlockContext{}, vm.TxContext{}, nil, nil, fmt.Errorf("parent %x not found", block.ParentHash())
@@ -64,7 +72,7 @@ func ComputeTxEnv(ctx context.Context, blockGetter BlockGetter, cfg *params.Chai
 		statedb.Prepare(tx.Hash(), blockHash, idx)
 
 		// Assemble the transaction call message and return if the requested offset
-		msg, _ := tx.AsMessage(signer)
+		msg, _ := tx.AsMessage(signer, block.BaseFee())
 		BlockContext := core.NewEVMBlockContext(block.Header(), chain, nil)
 		TxContext := core.NewEVMTxContext(msg)
 		if idx == int(txIndex) {
@@ -86,6 +94,8 @@ func ComputeTxEnv(ctx context.Context, blockGetter BlockGetter, cfg *params.Chai
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
 func TraceTx(ctx context.Context, message core.Message, blockCtx vm.BlockContext, txCtx vm.TxContext, ibs vm.IntraBlockState, config *tracers.TraceConfig, chainConfig *params.ChainConfig) (interface{}, error) {
+	ctx, span := tracing.Start(ctx, "trace tx")
+	defer span.End()
 	// Assemble the structured logger or the JavaScript tracer
 	var (
 		tracer vm.Tracer
@@ -119,13 +129,9 @@ func TraceTx(ctx context.Context, message core.Message, blockCtx vm.BlockContext
 		tracer = vm.NewStructLogger(config.LogConfig)
 	}
 	// Run the transaction with tracing enabled.
-	vmenv := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer})
+	vmenv := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
 
-	var refunds bool = true
-	if config != nil && config.NoRefunds != nil && *config.NoRefunds {
-		refunds = false
-	}
-	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()), refunds, false /* gasBailout */)
+	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()), refundsEnabled(config), false /* gasBailout */)
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
@@ -146,3 +152,50 @@ func TraceTx(ctx context.Context, message core.Message, blockCtx vm.BlockContext
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
 	}
 }
+
+// TraceTxStream is the streaming counterpart of TraceTx. With the default struct logger,
+// every log is written to the stream while the transaction is being executed, so the
+// memory usage doesn't depend on the length of the trace. JavaScript tracers write their
+// result once the execution is finished.
+func TraceTxStream(ctx context.Context, message core.Message, blockCtx vm.BlockContext, txCtx vm.TxContext, ibs vm.IntraBlockState, config *tracers.TraceConfig, chainConfig *params.ChainConfig, stream *rpc.Stream) error {
+	if config != nil && config.Tracer != nil {
+		result, err := TraceTx(ctx, message, blockCtx, txCtx, ibs, config, chainConfig)
+		if err != nil {
+			return err
+		}
+		return stream.Value(result)
+	}
+	_, span := tracing.Start(ctx, "trace tx")
+	defer span.End()
+	var logConfig *vm.LogConfig
+	if config != nil {
+		logConfig = config.LogConfig
+	}
+	stream.BeginObject()
+	stream.Key("structLogs")
+	stream.BeginArray()
+	tracer := vm.NewStreamingStructLogger(logConfig, func(log *vm.StructLog) error {
+		return stream.Value(ethapi.FormatLog(log))
+	})
+	vmenv := vm.NewEVM(blockCtx, txCtx, ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
+	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()), refundsEnabled(config), false /* gasBailout */)
+	if err != nil {
+		return fmt.Errorf("tracing failed: %v", err)
+	}
+	stream.EndArray()
+	if err = stream.Field("gas", result.UsedGas); err != nil {
+		return err
+	}
+	if err = stream.Field("failed", result.Failed()); err != nil {
+		return err
+	}
+	if err = stream.Field("returnValue", fmt.Sprintf("%x", result.Return())); err != nil {
+		return err
+	}
+	stream.EndObject()
+	return stream.Err()
+}
+
+func refundsEnabled(config *tracers.TraceConfig) bool {
+	return config == nil || config.NoRefunds == nil || !*config.NoRefunds
+}
@@ -0,0 +1,467 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// The binary trie is the experimental alternative to the hexary trie (EIP-3102 style) for the chains selecting it
+// by the stateCommitment of the chain config. It is the binary Patricia trie of the same hashed keys as the hexary
+// trie: the leaves are placed at the shallowest depth their key is unique at, and the branches commit to the depth
+// of the bit they split on in place of the extension nodes:
+//
+//	leaf   = keccak256(0x00 || key || value)
+//	branch = keccak256(0x01 || depth || left || right)
+//
+// The empty trie is the zero hash. The values of the accounts are their RLP for hashing with the root of their
+// binary storage trie, the values of the storage items are the stored values.
+//
+// There are no intermediate hashes of the binary trie, the root is computed from the whole hashed state,
+// which is only fit for the small states of the research networks.
+
+// ErrKeyNotProven is returned for the keys the binary proof proves neither the value nor the absence of
+var ErrKeyNotProven = errors.New("key not proven")
+
+// The opcodes of the binary proofs, the proof is the pre-order of the nodes of the trie on the paths to the proven
+// keys, the subtries off the paths are replaced by their hashes:
+//
+//	binaryLeafOp    key uvarint(len(value)) value
+//	binaryBranchOp  depth left right
+//	binaryHashOp    hash
+//	binaryAccountOp key uvarint(len(value)) value storage
+//
+// followed by uvarint(number of codes) and uvarint(len(code)) code of each code.
+const (
+	binaryLeafOp byte = iota
+	binaryBranchOp
+	binaryHashOp
+	binaryAccountOp // account leaf followed by the proof of its storage trie
+)
+
+// CalcBinaryRoot computes the root of the binary trie of the hashed state
+func CalcBinaryRoot(tx ethdb.Tx, quit <-chan struct{}) (common.Hash, error) {
+	root, _, err := binaryRoot(tx, nil, nil, quit)
+	return root, err
+}
+
+// GenerateBinaryProof builds the proof of the given hashed account keys, and of the hashed storage keys of the
+// accounts in storageKeysByAccount, in the binary trie of the hashed state, with the given codes appended.
+// The absent keys are proven by the leaves next to them. The hashed state must correspond to blockRoot, otherwise
+// an error is returned.
+func GenerateBinaryProof(tx ethdb.Tx, blockRoot common.Hash, accountKeys []common.Hash, storageKeysByAccount map[common.Hash][]common.Hash, codes [][]byte) ([]byte, error) {
+	var queries [][]byte
+	for _, addrHash := range accountKeys {
+		queries = append(queries, common.CopyBytes(addrHash[:]))
+	}
+	for addrHash := range storageKeysByAccount {
+		queries = append(queries, common.CopyBytes(addrHash[:]))
+	}
+	root, proof, err := binaryRoot(tx, sortedKeys(queries), storageKeysByAccount, nil)
+	if err != nil {
+		return nil, err
+	}
+	if root != blockRoot {
+		return nil, fmt.Errorf("binary root of the hashed state %x, expected %x", root, blockRoot)
+	}
+	var buf [binary.MaxVarintLen64]byte
+	proof = append(proof, buf[:binary.PutUvarint(buf[:], uint64(len(codes)))]...)
+	for _, code := range codes {
+		proof = append(proof, buf[:binary.PutUvarint(buf[:], uint64(len(code)))]...)
+		proof = append(proof, code...)
+	}
+	return proof, nil
+}
+
+// binaryRoot computes the root of the binary trie of the hashed state, and the proof of the queried accounts and
+// storage items when there are any
+func binaryRoot(tx ethdb.Tx, accountQueries [][]byte, storageQueries map[common.Hash][]common.Hash, quit <-chan struct{}) (common.Hash, []byte, error) {
+	withProof := accountQueries != nil
+	accTrie := newBinaryBuilder(withProof, accountQueries)
+	accC := tx.Cursor(dbutils.HashedAccountsBucket)
+	defer accC.Close()
+	stC := tx.Cursor(dbutils.HashedStorageBucket)
+	defer stC.Close()
+	value := make([]byte, 128)
+	for k, v, err := accC.First(); k != nil; k, v, err = accC.Next() {
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+		if err = common.Stopped(quit); err != nil {
+			return common.Hash{}, nil, err
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return common.Hash{}, nil, fmt.Errorf("decoding account %x: %w", k, err)
+		}
+		addrHash := common.BytesToHash(k)
+		var keys [][]byte
+		keyHashes, queried := storageQueries[addrHash]
+		if queried {
+			keys = make([][]byte, 0, len(keyHashes))
+			for _, keyHash := range keyHashes {
+				keys = append(keys, common.CopyBytes(keyHash[:]))
+			}
+			keys = sortedKeys(keys)
+		}
+		storageTrie := newBinaryBuilder(queried, keys)
+		if acc.Incarnation > 0 {
+			prefix := dbutils.GenerateStoragePrefix(k, acc.Incarnation)
+			if err = ethdb.Walk(stC, prefix, 8*len(prefix), func(sk, sv []byte) (bool, error) {
+				storageTrie.addLeaf(sk[len(prefix):], sv, nil)
+				return true, nil
+			}); err != nil {
+				return common.Hash{}, nil, err
+			}
+		}
+		storageRoot, storageProof := storageTrie.root()
+		acc.Root = storageRoot
+		if l := int(acc.EncodingLengthForHashing()); l > len(value) {
+			value = make([]byte, l)
+		}
+		value = value[:acc.EncodingLengthForHashing()]
+		acc.EncodeForHashing(value)
+		accTrie.addLeaf(k, value, storageProof)
+	}
+	root, proof := accTrie.root()
+	return root, proof, nil
+}
+
+func sortedKeys(keys [][]byte) [][]byte {
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// binaryBuilder folds the sorted leaves into the binary trie, keeping the stack of the subtries of the right edge
+// of the trie built so far
+type binaryBuilder struct {
+	stack     []binaryItem
+	prevKey   []byte
+	withProof bool
+	queries   [][]byte // sorted keys to prove, the ones not reached yet
+}
+
+type binaryItem struct {
+	hash  common.Hash
+	lcp   int         // bits in common with the key of the previous leaf, -1 for the first leaf
+	proof []byte      // proof of the subtrie, nil when nothing in it is proven
+	leaf  *binaryLeaf // set until the leaf is folded, it may still be proven as the neighbour of an absent key
+}
+
+type binaryLeaf struct {
+	key, value   []byte
+	storageProof []byte // proof of the storage trie of the account, nil unless its storage is proven
+	proven       bool
+}
+
+func newBinaryBuilder(withProof bool, queries [][]byte) *binaryBuilder {
+	return &binaryBuilder{withProof: withProof, queries: queries}
+}
+
+// addLeaf adds the leaf following the leaves added before, the key and the value are copied when they are needed
+// for the proof. The leaves are folded into the branches once the next leaf diverges from them at a lower depth.
+func (b *binaryBuilder) addLeaf(key, value []byte, storageProof []byte) {
+	item := binaryItem{hash: binaryLeafHash(key, value), lcp: -1}
+	if b.prevKey != nil {
+		item.lcp = commonBits(b.prevKey, key)
+	}
+	if b.withProof {
+		leaf := &binaryLeaf{key: common.CopyBytes(key), value: common.CopyBytes(value), storageProof: storageProof, proven: storageProof != nil}
+		for len(b.queries) > 0 && bytes.Compare(b.queries[0], key) <= 0 {
+			if !bytes.Equal(b.queries[0], key) && len(b.stack) > 0 {
+				// The absent key is between the previous leaf and this one, the top of the stack yet to be folded
+				b.stack[len(b.stack)-1].leaf.proven = true
+			}
+			leaf.proven = true
+			b.queries = b.queries[1:]
+		}
+		item.leaf = leaf
+	}
+	// Merge the subtries which share more bits with the previous leaf than the new leaf does
+	for len(b.stack) > 1 && b.stack[len(b.stack)-1].lcp > item.lcp {
+		b.fold()
+	}
+	b.prevKey = append(b.prevKey[:0], key...)
+	b.stack = append(b.stack, item)
+}
+
+// fold replaces the two subtries on the top of the stack with the branch of them
+func (b *binaryBuilder) fold() {
+	left, right := b.stack[len(b.stack)-2], b.stack[len(b.stack)-1]
+	depth := byte(right.lcp)
+	branch := binaryItem{hash: binaryBranchHash(depth, left.hash, right.hash), lcp: left.lcp}
+	if b.withProof {
+		leftProof, rightProof := left.subProof(), right.subProof()
+		if leftProof != nil || rightProof != nil {
+			if leftProof == nil {
+				leftProof = binaryHashProof(left.hash)
+			}
+			if rightProof == nil {
+				rightProof = binaryHashProof(right.hash)
+			}
+			branch.proof = make([]byte, 0, 2+len(leftProof)+len(rightProof))
+			branch.proof = append(branch.proof, binaryBranchOp, depth)
+			branch.proof = append(append(branch.proof, leftProof...), rightProof...)
+		}
+	}
+	b.stack = append(b.stack[:len(b.stack)-2], branch)
+}
+
+// root folds the whole stack and returns the root of the trie and its proof
+func (b *binaryBuilder) root() (common.Hash, []byte) {
+	// The absent keys past the last leaf are proven by it
+	if b.withProof && len(b.queries) > 0 && len(b.stack) > 0 && b.stack[len(b.stack)-1].leaf != nil {
+		b.stack[len(b.stack)-1].leaf.proven = true
+	}
+	for len(b.stack) > 1 {
+		b.fold()
+	}
+	if len(b.stack) == 0 {
+		if !b.withProof {
+			return common.Hash{}, nil
+		}
+		return common.Hash{}, binaryHashProof(common.Hash{})
+	}
+	top := b.stack[0]
+	if !b.withProof {
+		return top.hash, nil
+	}
+	proof := top.subProof()
+	if proof == nil {
+		proof = binaryHashProof(top.hash)
+	}
+	return top.hash, proof
+}
+
+func (item *binaryItem) subProof() []byte {
+	if item.proof != nil || item.leaf == nil || !item.leaf.proven {
+		return item.proof
+	}
+	var buf [binary.MaxVarintLen64]byte
+	l := item.leaf
+	op := binaryLeafOp
+	if l.storageProof != nil {
+		op = binaryAccountOp
+	}
+	proof := append([]byte{op}, l.key...)
+	proof = append(proof, buf[:binary.PutUvarint(buf[:], uint64(len(l.value)))]...)
+	proof = append(proof, l.value...)
+	return append(proof, l.storageProof...)
+}
+
+func binaryHashProof(hash common.Hash) []byte {
+	return append([]byte{binaryHashOp}, hash[:]...)
+}
+
+func binaryLeafHash(key, value []byte) common.Hash {
+	return crypto.Keccak256Hash([]byte{binaryLeafOp}, key, value)
+}
+
+func binaryBranchHash(depth byte, left, right common.Hash) common.Hash {
+	return crypto.Keccak256Hash([]byte{binaryBranchOp, depth}, left[:], right[:])
+}
+
+// commonBits is the length of the common prefix of the keys in bits
+func commonBits(a, b []byte) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return 8*i + bits.LeadingZeros8(x)
+		}
+	}
+	return 8 * len(a)
+}
+
+// BinaryProof is the verified proof of the accounts and storage items of the binary trie, see GenerateBinaryProof
+type BinaryProof struct {
+	Root  common.Hash
+	Codes map[common.Hash][]byte
+
+	accounts binarySpan
+}
+
+// binarySpan is the in-order sequence of the leaves and the hashed subtries of the proof, the key is absent
+// if the leaves next to it are adjacent
+type binarySpan []binarySpanItem
+
+type binarySpanItem struct {
+	key, value []byte // nil key for the hashed subtries
+	storage    *binarySpan
+}
+
+// VerifyBinaryProof checks the proof against the root and returns the proven content of it
+func VerifyBinaryProof(root common.Hash, proof []byte) (*BinaryProof, error) {
+	r := bytes.NewReader(proof)
+	p := &BinaryProof{Root: root, Codes: make(map[common.Hash][]byte)}
+	hash, err := readBinaryNode(r, &p.accounts, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProofNode, err)
+	}
+	if hash != root {
+		return nil, fmt.Errorf("%w: root %x, expected %x", ErrInvalidProofNode, hash, root)
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: codes: %v", ErrInvalidProofNode, err)
+	}
+	for i := uint64(0); i < n; i++ {
+		code, err := readBinaryBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: code %d: %v", ErrInvalidProofNode, i, err)
+		}
+		p.Codes[crypto.Keccak256Hash(code)] = code
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidProofNode, r.Len())
+	}
+	return p, nil
+}
+
+func readBinaryNode(r *bytes.Reader, span *binarySpan, level int) (common.Hash, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	switch op {
+	case binaryHashOp:
+		var hash common.Hash
+		if _, err = io.ReadFull(r, hash[:]); err != nil {
+			return common.Hash{}, err
+		}
+		// The zero hash is only the empty trie, there is nothing hidden in it
+		if hash != (common.Hash{}) {
+			*span = append(*span, binarySpanItem{})
+		}
+		return hash, nil
+	case binaryBranchOp:
+		depth, err := r.ReadByte()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		left, err := readBinaryNode(r, span, level)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		right, err := readBinaryNode(r, span, level)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return binaryBranchHash(depth, left, right), nil
+	case binaryLeafOp, binaryAccountOp:
+		key := make([]byte, common.HashLength)
+		if _, err = io.ReadFull(r, key); err != nil {
+			return common.Hash{}, err
+		}
+		value, err := readBinaryBytes(r)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		item := binarySpanItem{key: key, value: value}
+		if op == binaryAccountOp {
+			if level > 0 {
+				return common.Hash{}, fmt.Errorf("account leaf %x in the storage trie", key)
+			}
+			var acc accounts.Account
+			if err = acc.DecodeForHashing(value); err != nil {
+				return common.Hash{}, fmt.Errorf("account %x: %v", key, err)
+			}
+			item.storage = &binarySpan{}
+			storageRoot, err := readBinaryNode(r, item.storage, level+1)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if storageRoot != acc.Root {
+				return common.Hash{}, fmt.Errorf("storage root of account %x: %x, expected %x", key, storageRoot, acc.Root)
+			}
+		}
+		*span = append(*span, item)
+		return binaryLeafHash(key, value), nil
+	default:
+		return common.Hash{}, fmt.Errorf("unknown opcode %d", op)
+	}
+}
+
+func readBinaryBytes(r *bytes.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// lookup returns the leaf of the key, nil if the span proves that the key is absent
+func (s binarySpan) lookup(key []byte) (*binarySpanItem, error) {
+	hidden := false // whether there is a hashed subtrie between the previous leaf and the key
+	for i := range s {
+		if s[i].key == nil {
+			hidden = true
+			continue
+		}
+		switch c := bytes.Compare(s[i].key, key); {
+		case c == 0:
+			return &s[i], nil
+		case c > 0:
+			if hidden {
+				return nil, fmt.Errorf("%w: %x", ErrKeyNotProven, key)
+			}
+			return nil, nil
+		}
+		hidden = false
+	}
+	if hidden {
+		return nil, fmt.Errorf("%w: %x", ErrKeyNotProven, key)
+	}
+	return nil, nil
+}
+
+// Account returns the account with the given hashed address, its Root is the root of its binary storage trie.
+// It returns nil if the proof shows that the account doesn't exist, and ErrKeyNotProven if it proves neither.
+func (p *BinaryProof) Account(addrHash common.Hash) (*accounts.Account, error) {
+	item, err := p.accounts.lookup(addrHash[:])
+	if err != nil || item == nil {
+		return nil, err
+	}
+	var acc accounts.Account
+	if err = acc.DecodeForHashing(item.value); err != nil {
+		return nil, fmt.Errorf("%w: account %x: %v", ErrInvalidProofNode, addrHash, err)
+	}
+	return &acc, nil
+}
+
+// Storage returns the value of the storage item with the given hashed key of the account with the given hashed
+// address. It returns nil if the item (or the account) doesn't exist.
+func (p *BinaryProof) Storage(addrHash, keyHash common.Hash) ([]byte, error) {
+	item, err := p.accounts.lookup(addrHash[:])
+	if err != nil || item == nil {
+		return nil, err
+	}
+	if item.storage == nil {
+		var acc accounts.Account
+		if err = acc.DecodeForHashing(item.value); err != nil {
+			return nil, fmt.Errorf("%w: account %x: %v", ErrInvalidProofNode, addrHash, err)
+		}
+		if acc.Root == (common.Hash{}) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: storage of %x", ErrKeyNotProven, addrHash)
+	}
+	item, err = item.storage.lookup(keyHash[:])
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.value, nil
+}
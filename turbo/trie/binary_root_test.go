@@ -0,0 +1,166 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// naiveBinaryRoot is the root of the binary trie of the sorted leaves by the recursive definition
+func naiveBinaryRoot(keys, values [][]byte) common.Hash {
+	switch len(keys) {
+	case 0:
+		return common.Hash{}
+	case 1:
+		return binaryLeafHash(keys[0], values[0])
+	}
+	depth := commonBits(keys[0], keys[len(keys)-1])
+	split := sort.Search(len(keys), func(i int) bool { return keys[i][depth/8]&(0x80>>(depth%8)) != 0 })
+	return binaryBranchHash(byte(depth), naiveBinaryRoot(keys[:split], values[:split]), naiveBinaryRoot(keys[split:], values[split:]))
+}
+
+func TestBinaryRoot(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	addrHashes := make([]common.Hash, 100)
+	keyHashes := make(map[int][]common.Hash)
+	leaves := make(map[common.Hash][]byte)
+	for i := range addrHashes {
+		addr := getAddressForIndex(i)
+		addrHashes[i] = common.BytesToHash(crypto.Keccak256(addr[:]))
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		acc.Balance.SetUint64(uint64(i) * 1000000007)
+		if i%10 == 0 {
+			acc.Incarnation = 1
+			for j := 0; j < 20; j++ {
+				keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+				require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 1, keyHash), []byte{byte(j + 1)}))
+				keyHashes[i] = append(keyHashes[i], keyHash)
+			}
+			// The storage of the previous incarnation isn't in the trie
+			require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 0, keyHashes[i][0]), []byte{0xff}))
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHashes[i][:], enc))
+		acc.Root = leavesRoot(t, keyHashes[i])
+		value := make([]byte, acc.EncodingLengthForHashing())
+		acc.EncodeForHashing(value)
+		leaves[addrHashes[i]] = value
+	}
+
+	var keys, values [][]byte
+	for k, v := range leaves {
+		keys, values = append(keys, common.CopyBytes(k[:])), append(values, v)
+	}
+	sort.Sort(keysAndValues{keys, values})
+
+	tx, err := db.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	root, err := CalcBinaryRoot(tx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, naiveBinaryRoot(keys, values), root)
+
+	// The binary trie of the empty state is the zero hash
+	empty := ethdb.NewMemDatabase()
+	defer empty.Close()
+	emptyTx, err := empty.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer emptyTx.Rollback()
+	emptyRoot, err := CalcBinaryRoot(emptyTx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash{}, emptyRoot)
+
+	missing := common.BytesToHash(crypto.Keccak256([]byte("missing")))
+	accountKeys := []common.Hash{addrHashes[1], addrHashes[2], addrHashes[50], missing}
+	storageKeys := map[common.Hash][]common.Hash{
+		addrHashes[10]: keyHashes[10][:5],
+		addrHashes[20]: {keyHashes[20][3], missing},
+		missing:        {keyHashes[0][0]},
+	}
+	code := []byte{0x60, 0x00}
+	proof, err := GenerateBinaryProof(tx, root, accountKeys, storageKeys, [][]byte{code})
+	require.NoError(t, err)
+	_, err = GenerateBinaryProof(tx, common.Hash{1}, accountKeys, storageKeys, nil)
+	require.Error(t, err)
+
+	p, err := VerifyBinaryProof(root, proof)
+	require.NoError(t, err)
+	assert.Equal(t, code, p.Codes[crypto.Keccak256Hash(code)])
+	for _, i := range []int{1, 2, 10, 20, 50} {
+		acc, err := p.Account(addrHashes[i])
+		require.NoError(t, err)
+		require.NotNil(t, acc, "account %d", i)
+		assert.Equal(t, uint64(i), acc.Nonce)
+	}
+	acc, err := p.Account(missing)
+	require.NoError(t, err)
+	assert.Nil(t, acc)
+	for j, keyHash := range keyHashes[10][:5] {
+		v, err := p.Storage(addrHashes[10], keyHash)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{byte(j + 1)}, v)
+	}
+	v, err := p.Storage(addrHashes[20], missing)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	v, err = p.Storage(missing, keyHashes[0][0])
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	// The account without storage proves its storage empty
+	v, err = p.Storage(addrHashes[1], missing)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	_, err = p.Account(addrHashes[3])
+	assert.True(t, errors.Is(err, ErrKeyNotProven))
+	// Only the storage items next to the proven ones are in the proof
+	var notProven int
+	for _, keyHash := range keyHashes[20] {
+		if _, err = p.Storage(addrHashes[20], keyHash); errors.Is(err, ErrKeyNotProven) {
+			notProven++
+		}
+	}
+	assert.Greater(t, notProven, 10)
+	_, err = p.Storage(addrHashes[50], keyHashes[0][1])
+	assert.True(t, errors.Is(err, ErrKeyNotProven))
+
+	_, err = VerifyBinaryProof(common.Hash{1}, proof)
+	assert.True(t, errors.Is(err, ErrInvalidProofNode))
+	tampered := common.CopyBytes(proof)
+	tampered[len(tampered)/2] ^= 1
+	_, err = VerifyBinaryProof(root, tampered)
+	assert.Error(t, err)
+}
+
+func leavesRoot(t *testing.T, keyHashes []common.Hash) common.Hash {
+	t.Helper()
+	var keys, values [][]byte
+	for j, keyHash := range keyHashes {
+		keys, values = append(keys, common.CopyBytes(keyHash[:])), append(values, []byte{byte(j + 1)})
+	}
+	sort.Sort(keysAndValues{keys, values})
+	return naiveBinaryRoot(keys, values)
+}
+
+type keysAndValues struct{ keys, values [][]byte }
+
+func (kv keysAndValues) Len() int           { return len(kv.keys) }
+func (kv keysAndValues) Less(i, j int) bool { return bytes.Compare(kv.keys[i], kv.keys[j]) < 0 }
+func (kv keysAndValues) Swap(i, j int) {
+	kv.keys[i], kv.keys[j] = kv.keys[j], kv.keys[i]
+	kv.values[i], kv.values[j] = kv.values[j], kv.values[i]
+}
@@ -217,3 +217,9 @@ func prefixLen(a, b []byte) int {
 func hasTerm(s []byte) bool {
 	return len(s) > 0 && s[len(s)-1] == 16
 }
+
+// CompactToHex converts the path in the compact encoding, e.g. from the trie node requests
+// of the snap protocol, into the HEX encoding
+func CompactToHex(compact []byte) []byte {
+	return compactToHex(compact)
+}
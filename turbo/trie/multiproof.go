@@ -0,0 +1,290 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+var ErrInvalidProofNode = errors.New("invalid proof node")
+
+// Multiproof proves the values (or the absence) of a set of accounts and storage items against
+// a single state root. Trie nodes shared by the paths to several keys are included only once,
+// so a multiproof is much smaller than the equivalent set of single-key proofs.
+type Multiproof struct {
+	Root  common.Hash
+	Nodes [][]byte // RLP-encoded trie nodes, in the order of first appearance on the paths to the keys
+
+	nodesByHash map[common.Hash][]byte
+}
+
+// GenerateMultiproof builds a multiproof for the given hashed account keys, and for the hashed
+// storage keys of the accounts in storageKeysByAccount (the accounts themselves are proven too).
+// The proof is generated from the current hashed state and intermediate hashes in tx, which must
+// correspond to blockRoot, otherwise an error is returned.
+func GenerateMultiproof(tx ethdb.Tx, blockRoot common.Hash, accountKeys []common.Hash, storageKeysByAccount map[common.Hash][]common.Hash) (*Multiproof, error) {
+	allAccounts := make([]common.Hash, 0, len(accountKeys)+len(storageKeysByAccount))
+	seen := make(map[common.Hash]struct{}, len(accountKeys))
+	for _, addrHash := range accountKeys {
+		if _, ok := seen[addrHash]; !ok {
+			seen[addrHash] = struct{}{}
+			allAccounts = append(allAccounts, addrHash)
+		}
+	}
+	var extra []common.Hash
+	for addrHash := range storageKeysByAccount {
+		if _, ok := seen[addrHash]; !ok {
+			extra = append(extra, addrHash)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return bytes.Compare(extra[i][:], extra[j][:]) < 0 })
+	allAccounts = append(allAccounts, extra...)
+
+	keys := make([][]byte, 0, len(allAccounts))
+	for _, addrHash := range allAccounts {
+		keys = append(keys, common.CopyBytes(addrHash[:]))
+		storageKeys := storageKeysByAccount[addrHash]
+		if len(storageKeys) == 0 {
+			continue
+		}
+		enc, err := tx.GetOne(dbutils.HashedAccountsBucket, addrHash[:])
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) == 0 {
+			continue
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(enc); err != nil {
+			return nil, err
+		}
+		if acc.Incarnation == 0 {
+			continue
+		}
+		for _, keyHash := range storageKeys {
+			keys = append(keys, dbutils.GenerateCompositeStorageKey(addrHash, acc.Incarnation, keyHash))
+		}
+	}
+
+	t, err := LoadRetainedTrie(tx, blockRoot, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	mp := &Multiproof{Root: blockRoot}
+	known := make(map[string]struct{})
+	add := func(proof [][]byte) {
+		for _, n := range proof {
+			if _, ok := known[string(n)]; !ok {
+				known[string(n)] = struct{}{}
+				mp.Nodes = append(mp.Nodes, n)
+			}
+		}
+	}
+	for _, addrHash := range allAccounts {
+		proof, err := t.Prove(addrHash[:], 0, false /* storage */)
+		if err != nil {
+			return nil, err
+		}
+		add(proof)
+		for _, keyHash := range storageKeysByAccount[addrHash] {
+			proof, err = t.Prove(dbutils.GenerateCompositeTrieKey(addrHash, keyHash), 64 /* nibbles to get to the storage sub-trie */, true /* storage */)
+			if err != nil {
+				return nil, err
+			}
+			add(proof)
+		}
+	}
+	return mp, nil
+}
+
+// LoadRetainedTrie builds the state trie at blockRoot from the hashed state and the intermediate hashes
+// in tx, which must correspond to blockRoot, otherwise an error is returned. Only the nodes on the paths
+// to the given keys are built, the rest is folded into hash nodes. The keys are in KEY encoding, the
+// storage ones in the form {addrHash}{incarnation}{keyHash}, the hexes are the paths in HEX encoding,
+// the storage ones in the form {addrHash nibbles}{incarnation nibbles}{path in the storage trie}.
+func LoadRetainedTrie(tx ethdb.Tx, blockRoot common.Hash, keys [][]byte, hexes [][]byte) (*Trie, error) {
+	// The loader and the aggregator walk the retain list independently, so each gets its own copy
+	loaderRl, receiverRl := NewRetainList(0), NewRetainList(0)
+	for _, key := range keys {
+		loaderRl.AddKey(key)
+		receiverRl.AddKey(key)
+	}
+	for _, hex := range hexes {
+		loaderRl.AddHex(hex)
+		receiverRl.AddHex(hex)
+	}
+
+	return loadTrie(tx, blockRoot, loaderRl, receiverRl)
+}
+
+// loadTrie builds the state trie at blockRoot with the nodes retained by the deciders of the loader
+// and of the receiver, which have to retain the same prefixes
+func loadTrie(tx ethdb.Tx, blockRoot common.Hash, loaderRd RetainDeciderWithMarker, receiverRd RetainDecider) (*Trie, error) {
+	loader := NewFlatDBTrieLoader("retained")
+	if err := loader.Reset(loaderRd, nil, nil, false); err != nil {
+		return nil, err
+	}
+	loader.defaultReceiver.SetRetainDecider(receiverRd)
+	root, err := loader.calcTrieRoot(tx, []byte{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if root != blockRoot {
+		return nil, fmt.Errorf("state root mismatch: expected %x, got %x", blockRoot, root)
+	}
+	t := New(blockRoot)
+	t.root = loader.defaultReceiver.RootNode()
+	return t, nil
+}
+
+// Account verifies the proof of the account with the given hashed address and returns the account.
+// It returns nil if the proof shows that the account doesn't exist, and an error if the multiproof
+// doesn't contain the nodes required to prove either.
+func (mp *Multiproof) Account(addrHash common.Hash) (*accounts.Account, error) {
+	v, err := mp.lookup(mp.Root, addrHash[:])
+	if err != nil || v == nil {
+		return nil, err
+	}
+	var acc accounts.Account
+	if err = acc.DecodeForHashing(v); err != nil {
+		return nil, fmt.Errorf("%w: account %x: %v", ErrInvalidProofNode, addrHash, err)
+	}
+	return &acc, nil
+}
+
+// Storage verifies the proof of the storage item with the given hashed key of the account with
+// the given hashed address, and returns its value. It returns nil if the item (or the account) doesn't exist.
+func (mp *Multiproof) Storage(addrHash, keyHash common.Hash) ([]byte, error) {
+	acc, err := mp.Account(addrHash)
+	if err != nil || acc == nil {
+		return nil, err
+	}
+	v, err := mp.lookup(acc.Root, keyHash[:])
+	if err != nil || v == nil {
+		return nil, err
+	}
+	value, _, err := rlp.SplitString(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: storage %x %x: %v", ErrInvalidProofNode, addrHash, keyHash, err)
+	}
+	return value, nil
+}
+
+// VerifyMultiproof checks that mp proves all the given accounts and storage items, and returns
+// the number of the proven items which exist in the state.
+func VerifyMultiproof(mp *Multiproof, accountKeys []common.Hash, storageKeysByAccount map[common.Hash][]common.Hash) (int, error) {
+	var found int
+	for _, addrHash := range accountKeys {
+		acc, err := mp.Account(addrHash)
+		if err != nil {
+			return 0, err
+		}
+		if acc != nil {
+			found++
+		}
+	}
+	for addrHash, storageKeys := range storageKeysByAccount {
+		for _, keyHash := range storageKeys {
+			v, err := mp.Storage(addrHash, keyHash)
+			if err != nil {
+				return 0, err
+			}
+			if v != nil {
+				found++
+			}
+		}
+	}
+	return found, nil
+}
+
+// lookup walks the proof nodes from the node with the given hash along the key, and returns the
+// value of the leaf, or nil if the nodes prove that the key is absent
+func (mp *Multiproof) lookup(root common.Hash, key []byte) ([]byte, error) {
+	if root == EmptyRoot {
+		return nil, nil
+	}
+	if mp.nodesByHash == nil {
+		mp.nodesByHash = make(map[common.Hash][]byte, len(mp.Nodes))
+		for _, n := range mp.Nodes {
+			mp.nodesByHash[common.BytesToHash(crypto.Keccak256(n))] = n
+		}
+	}
+	hex := keybytesToHex(key)
+	hex = hex[:len(hex)-1] // Remove terminator
+	pos := 0
+	enc, ok := mp.nodesByHash[root]
+	if !ok {
+		return nil, &MissingNodeError{NodeHash: root, Path: hex[:pos]}
+	}
+	for {
+		content, _, err := rlp.SplitList(enc)
+		if err != nil {
+			return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex[:pos], err)
+		}
+		var child []byte
+		switch items, _ := rlp.CountValues(content); items {
+		case 17:
+			if pos == len(hex) {
+				return nil, fmt.Errorf("%w at path %x: branch node at the end of the key", ErrInvalidProofNode, hex[:pos])
+			}
+			rest := content
+			for i := byte(0); i <= hex[pos]; i++ {
+				_, _, next, err := rlp.Split(rest)
+				if err != nil {
+					return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex[:pos], err)
+				}
+				child, rest = rest[:len(rest)-len(next)], next
+			}
+			pos++
+		case 2:
+			compactKey, rest, err := rlp.SplitString(content)
+			if err != nil {
+				return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex[:pos], err)
+			}
+			nKey := compactToHex(compactKey)
+			if hasTerm(nKey) {
+				if !bytes.Equal(nKey[:len(nKey)-1], hex[pos:]) {
+					return nil, nil
+				}
+				value, _, err := rlp.SplitString(rest)
+				if err != nil {
+					return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex[:pos], err)
+				}
+				return value, nil
+			}
+			if !bytes.HasPrefix(hex[pos:], nKey) {
+				return nil, nil
+			}
+			child = rest
+			pos += len(nKey)
+		default:
+			return nil, fmt.Errorf("%w at path %x: %d items", ErrInvalidProofNode, hex[:pos], items)
+		}
+
+		kind, ref, _, err := rlp.Split(child)
+		if err != nil {
+			return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex[:pos], err)
+		}
+		switch {
+		case kind == rlp.List: // embedded node
+			enc = child
+		case len(ref) == 0:
+			return nil, nil
+		case len(ref) == common.HashLength:
+			hash := common.BytesToHash(ref)
+			if enc, ok = mp.nodesByHash[hash]; !ok {
+				return nil, &MissingNodeError{NodeHash: hash, Path: hex[:pos]}
+			}
+		default:
+			return nil, fmt.Errorf("%w at path %x: child reference of %d bytes", ErrInvalidProofNode, hex[:pos], len(ref))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package trie
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateMultiproof(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	addrHashes := make([]common.Hash, 100)
+	keyHashes := make(map[int][]common.Hash)
+	for i := range addrHashes {
+		addr := getAddressForIndex(i)
+		addrHashes[i] = common.BytesToHash(crypto.Keccak256(addr[:]))
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		acc.Balance.SetUint64(uint64(i) * 1000000007)
+		if i%10 == 0 {
+			acc.Incarnation = 1
+			for j := 0; j < 20; j++ {
+				keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+				require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 1, keyHash), []byte{byte(j + 1)}))
+				if j%4 == 0 {
+					keyHashes[i] = append(keyHashes[i], keyHash)
+				}
+			}
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHashes[i][:], enc))
+	}
+	root, err := CalcRoot("test", db)
+	require.NoError(t, err)
+
+	missing := common.BytesToHash(crypto.Keccak256([]byte("missing")))
+	accountKeys := []common.Hash{addrHashes[1], addrHashes[2], addrHashes[50], missing}
+	storageKeys := map[common.Hash][]common.Hash{
+		addrHashes[10]: keyHashes[10],
+		addrHashes[20]: append(keyHashes[20], missing),
+		missing:        {keyHashes[0][0]},
+	}
+
+	tx, err := db.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	mp, err := GenerateMultiproof(tx, root, accountKeys, storageKeys)
+	require.NoError(t, err)
+
+	for _, i := range []int{1, 2, 10, 20, 50} {
+		acc, err := mp.Account(addrHashes[i])
+		require.NoError(t, err)
+		require.NotNil(t, acc, "account %d", i)
+		assert.Equal(t, uint64(i), acc.Nonce)
+		assert.Equal(t, uint64(i)*1000000007, acc.Balance.Uint64())
+	}
+	acc, err := mp.Account(missing)
+	require.NoError(t, err)
+	assert.Nil(t, acc)
+
+	for _, i := range []int{10, 20} {
+		for j := 0; j < 20; j += 4 {
+			keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+			v, err := mp.Storage(addrHashes[i], keyHash)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{byte(j + 1)}, v)
+		}
+	}
+	v, err := mp.Storage(addrHashes[20], missing)
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	found, err := VerifyMultiproof(mp, accountKeys, storageKeys)
+	require.NoError(t, err)
+	assert.Equal(t, 3+10, found)
+
+	// Keys which were not requested can't be proven
+	_, err = mp.Account(addrHashes[77])
+	var missingNode *MissingNodeError
+	assert.True(t, errors.As(err, &missingNode), "%v", err)
+
+	// Shared nodes are included only once
+	single := 0
+	for _, addrHash := range accountKeys {
+		p, err := GenerateMultiproof(tx, root, []common.Hash{addrHash}, nil)
+		require.NoError(t, err)
+		single += len(p.Nodes)
+	}
+	accountsOnly, err := GenerateMultiproof(tx, root, accountKeys, nil)
+	require.NoError(t, err)
+	assert.Less(t, len(accountsOnly.Nodes), single)
+
+	_, err = GenerateMultiproof(tx, common.Hash{1}, accountKeys, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// TrieNode is a node of the state trie exported with its path
+type TrieNode struct {
+	Path []byte // in HEX encoding, the paths in the storage tries continue the 64 nibbles of the account key
+	RLP  []byte // the children below the exported subtree are referred to by their hashes
+}
+
+// GetTrieNodeByPath returns the RLP encoding of the node at the given path (in HEX encoding) of the state
+// trie at blockRoot, built from the hashed state and the intermediate hashes in tx, which must correspond
+// to blockRoot. The paths in the storage tries continue the 64 nibbles of the account key. It returns nil
+// if there is no node at the path.
+func GetTrieNodeByPath(tx ethdb.Tx, blockRoot common.Hash, hex []byte) ([]byte, error) {
+	nodes, err := GetTrieNodesByPaths(tx, blockRoot, [][]byte{hex})
+	if err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// GetTrieNodesByPaths is GetTrieNodeByPath for many paths at once, the trie is only loaded once.
+// The nodes are returned in the order of the paths, nil for the paths without a node.
+func GetTrieNodesByPaths(tx ethdb.Tx, blockRoot common.Hash, hexes [][]byte) ([][]byte, error) {
+	retain := make([][]byte, len(hexes))
+	for i, hex := range hexes {
+		var err error
+		if retain[i], err = retainedPath(tx, hex); err != nil {
+			return nil, err
+		}
+	}
+	t, err := LoadRetainedTrie(tx, blockRoot, nil, retain)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([][]byte, len(hexes))
+	for i, hex := range hexes {
+		if nodes[i], err = t.NodeByPath(hex); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// ExportSubTrie returns the nodes of the state trie at blockRoot located at most depth nibbles below the
+// given path (in HEX encoding, as in GetTrieNodeByPath), the node at the path first, the rest in pre-order.
+// It returns no nodes if there is no node at the path. The subtree of an account leaf doesn't include its
+// storage trie, which is exported by the paths continuing the account key.
+func ExportSubTrie(tx ethdb.Tx, blockRoot common.Hash, hex []byte, depth int) ([]TrieNode, error) {
+	retain, err := retainedPath(tx, hex)
+	if err != nil {
+		return nil, err
+	}
+	// The deepest nodes are only hashed, the storage prefixes include the incarnation
+	bound := len(retain) + depth
+	t, err := loadTrie(tx, blockRoot, &subTrieRetainDecider{hex: retain, bound: bound}, &subTrieRetainDecider{hex: retain, bound: bound})
+	if err != nil {
+		return nil, err
+	}
+	nd, _, found, _ := t.getNode(hex, false)
+	if !found {
+		return nil, nil
+	}
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+	var nodes []TrieNode
+	if err = exportNode(hasher, nd, common.CopyBytes(hex), len(hex)+depth, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+func exportNode(hasher *hasher, nd node, hex []byte, bound int, nodes *[]TrieNode) error {
+	if len(hex) > bound {
+		return nil
+	}
+	switch nd.(type) {
+	case nil, valueNode, *accountNode:
+		return nil
+	case hashNode:
+		if len(*nodes) == 0 {
+			return fmt.Errorf("node at path %x is not loaded", hex)
+		}
+		return nil
+	}
+	enc, err := hasher.hashChildren(nd, 0)
+	if err != nil {
+		return err
+	}
+	*nodes = append(*nodes, TrieNode{Path: hex, RLP: common.CopyBytes(enc)})
+
+	switch n := nd.(type) {
+	case *shortNode:
+		if len(n.Key) > 0 && n.Key[len(n.Key)-1] == 16 {
+			return nil
+		}
+		return exportNode(hasher, n.Val, concatNibbles(hex, n.Key...), bound, nodes)
+	case *duoNode:
+		i1, i2 := n.childrenIdx()
+		if err = exportNode(hasher, n.child1, concatNibbles(hex, i1), bound, nodes); err != nil {
+			return err
+		}
+		return exportNode(hasher, n.child2, concatNibbles(hex, i2), bound, nodes)
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			if err = exportNode(hasher, child, concatNibbles(hex, byte(i)), bound, nodes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func concatNibbles(hex []byte, nibbles ...byte) []byte {
+	res := make([]byte, 0, len(hex)+len(nibbles))
+	return append(append(res, hex...), nibbles...)
+}
+
+// retainedPath inserts the incarnation of the account into the path in a storage trie (or to its root), as
+// the storage prefixes are retained in the form {addrHash nibbles}{incarnation nibbles}{path in the storage trie}
+func retainedPath(tx ethdb.Tx, hex []byte) ([]byte, error) {
+	if len(hex) < 2*common.HashLength {
+		return hex, nil
+	}
+	var addrHash []byte
+	hexutil.CompressNibbles(hex[:2*common.HashLength], &addrHash)
+	enc, err := tx.GetOne(dbutils.HashedAccountsBucket, addrHash)
+	if err != nil {
+		return nil, err
+	}
+	var acc accounts.Account
+	if len(enc) > 0 {
+		if err = acc.DecodeForStorage(enc); err != nil {
+			return nil, err
+		}
+	}
+	var inc [common.IncarnationLength]byte
+	binary.BigEndian.PutUint64(inc[:], acc.Incarnation)
+	var incHex []byte
+	hexutil.DecompressNibbles(inc[:], &incHex)
+	return concatNibbles(concatNibbles(hex[:2*common.HashLength], incHex...), hex[2*common.HashLength:]...), nil
+}
+
+// subTrieRetainDecider retains the nodes on the path to the root of a subtree, and the nodes of the subtree
+// at the paths not longer than the bound
+type subTrieRetainDecider struct {
+	hex   []byte
+	bound int
+}
+
+func (rd *subTrieRetainDecider) Retain(prefix []byte) bool {
+	if len(prefix) <= len(rd.hex) {
+		return bytes.HasPrefix(rd.hex, prefix)
+	}
+	return len(prefix) <= rd.bound && bytes.HasPrefix(prefix, rd.hex)
+}
+
+func (rd *subTrieRetainDecider) IsCodeTouched(common.Hash) bool {
+	return false
+}
+
+func (rd *subTrieRetainDecider) AddKeyWithMarker([]byte, bool) {}
+
+func (rd *subTrieRetainDecider) RetainWithMarker(prefix []byte) (bool, []byte) {
+	return rd.Retain(prefix), nil
+}
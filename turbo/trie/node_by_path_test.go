@@ -0,0 +1,94 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTrieNodeByPath(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	addrHashes := make([]common.Hash, 100)
+	for i := range addrHashes {
+		addr := getAddressForIndex(i)
+		addrHashes[i] = common.BytesToHash(crypto.Keccak256(addr[:]))
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		if i%10 == 0 {
+			acc.Incarnation = 1
+			for j := 0; j < 20; j++ {
+				keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+				require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 1, keyHash), []byte{byte(j + 1)}))
+			}
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHashes[i][:], enc))
+	}
+	root, err := CalcRoot("test", db)
+	require.NoError(t, err)
+
+	tx, err := db.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	rootNode, err := GetTrieNodeByPath(tx, root, []byte{})
+	require.NoError(t, err)
+	assert.Equal(t, root, crypto.Keccak256Hash(rootNode))
+
+	// The root of the storage trie is at the end of the account key
+	mp, err := GenerateMultiproof(tx, root, []common.Hash{addrHashes[10]}, nil)
+	require.NoError(t, err)
+	acc, err := mp.Account(addrHashes[10])
+	require.NoError(t, err)
+	var accountHex []byte
+	for _, b := range addrHashes[10] {
+		accountHex = append(accountHex, b/16, b%16)
+	}
+	storageRoot, err := GetTrieNodeByPath(tx, root, accountHex)
+	require.NoError(t, err)
+	assert.Equal(t, acc.Root, crypto.Keccak256Hash(storageRoot))
+
+	missing, err := GetTrieNodeByPath(tx, root, append(accountHex[:2*common.HashLength:2*common.HashLength], 0xf, 0xf, 0xf, 0xf))
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// Every exported node is referred to by its parent, and is the same as the one fetched by its path
+	for _, hex := range [][]byte{{}, {addrHashes[0][0] / 16}, accountHex} {
+		nodes, err := ExportSubTrie(tx, root, hex, 2)
+		require.NoError(t, err)
+		require.NotEmpty(t, nodes)
+		assert.Equal(t, hex, nodes[0].Path)
+		for i, n := range nodes {
+			assert.LessOrEqual(t, len(n.Path), len(hex)+2)
+			blobs, err := GetTrieNodesByPaths(tx, root, [][]byte{n.Path})
+			require.NoError(t, err)
+			assert.Equal(t, blobs[0], n.RLP, "node %x", n.Path)
+			if i == 0 || len(n.RLP) < 32 {
+				continue
+			}
+			var referred bool
+			for _, parent := range nodes[:i] {
+				if bytes.HasPrefix(n.Path, parent.Path) && bytes.Contains(parent.RLP, crypto.Keccak256(n.RLP)) {
+					referred = true
+				}
+			}
+			assert.True(t, referred, "node %x", n.Path)
+		}
+	}
+
+	nodes, err := ExportSubTrie(tx, root, []byte{}, 0)
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, rootNode, nodes[0].RLP)
+}
@@ -95,3 +95,26 @@ func (t *Trie) Prove(key []byte, fromLevel int, storage bool) ([][]byte, error)
 	}
 	return proof, nil
 }
+
+// NodeByPath returns the RLP encoding of the node at the given path in HEX encoding, the paths in
+// the storage tries continue the 64 nibbles of the account key. It returns nil if there is no node
+// at the path, and an error if the node is folded into its hash.
+func (t *Trie) NodeByPath(hex []byte) ([]byte, error) {
+	nd, _, found, _ := t.getNode(hex, false)
+	if !found || nd == nil {
+		return nil, nil
+	}
+	switch nd.(type) {
+	case hashNode:
+		return nil, fmt.Errorf("node at path %x is not loaded", hex)
+	case valueNode:
+		return nil, nil
+	}
+	hasher := newHasher(false)
+	defer returnHasherToPool(hasher)
+	enc, err := hasher.hashChildren(nd, 0)
+	if err != nil {
+		return nil, err
+	}
+	return common.CopyBytes(enc), nil
+}
@@ -0,0 +1,234 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// ProofEncodingVersion is the first byte of every binary-encoded proof batch
+const ProofEncodingVersion byte = 1
+
+var ErrUnsupportedProofEncoding = errors.New("unsupported proof encoding version")
+
+// AccountProof is the binary-friendly counterpart of the EIP-1186 account result.
+// Proof nodes are kept as raw RLP, exactly as returned by (*Trie).Prove
+type AccountProof struct {
+	Address       common.Address
+	Nonce         uint64
+	Balance       uint256.Int
+	CodeHash      common.Hash
+	StorageHash   common.Hash
+	Proof         [][]byte
+	StorageProofs []StorageProof
+}
+
+// StorageProof is the binary-friendly counterpart of the EIP-1186 storage result
+type StorageProof struct {
+	Key   common.Hash
+	Value uint256.Int
+	Proof [][]byte
+}
+
+// EncodeProofs serializes a batch of account proofs into a compact deterministic binary form.
+// Every distinct trie node is written only once into a node table (in order of first appearance),
+// and the individual proofs refer to the nodes by their index in that table. Batches of proofs
+// requested for the same block share most of the upper trie levels, so this removes the bulk of
+// the redundancy present in the EIP-1186 JSON representation.
+//
+// Layout (all integers are unsigned varints):
+//	version(1 byte) | nodeCount | {len | node}... | accountCount | {account}...
+//	account: address(20) | nonce | len | balance | codeHash(32) | storageHash(32) | proof | storageCount | {storage}...
+//	storage: key(32) | len | value | proof
+//	proof: count | {nodeIdx}...
+func EncodeProofs(proofs []*AccountProof) []byte {
+	nodeIdx := make(map[string]uint64)
+	var nodes [][]byte
+	indexOf := func(node []byte) uint64 {
+		if idx, ok := nodeIdx[string(node)]; ok {
+			return idx
+		}
+		idx := uint64(len(nodes))
+		nodeIdx[string(node)] = idx
+		nodes = append(nodes, node)
+		return idx
+	}
+	var body bytes.Buffer
+	var num [binary.MaxVarintLen64]byte
+	putUvarint := func(w *bytes.Buffer, v uint64) {
+		n := binary.PutUvarint(num[:], v)
+		w.Write(num[:n])
+	}
+	putProof := func(proof [][]byte) {
+		putUvarint(&body, uint64(len(proof)))
+		for _, node := range proof {
+			putUvarint(&body, indexOf(node))
+		}
+	}
+	putUvarint(&body, uint64(len(proofs)))
+	for _, p := range proofs {
+		body.Write(p.Address[:])
+		putUvarint(&body, p.Nonce)
+		balance := p.Balance.Bytes()
+		putUvarint(&body, uint64(len(balance)))
+		body.Write(balance)
+		body.Write(p.CodeHash[:])
+		body.Write(p.StorageHash[:])
+		putProof(p.Proof)
+		putUvarint(&body, uint64(len(p.StorageProofs)))
+		for i := range p.StorageProofs {
+			sp := &p.StorageProofs[i]
+			body.Write(sp.Key[:])
+			value := sp.Value.Bytes()
+			putUvarint(&body, uint64(len(value)))
+			body.Write(value)
+			putProof(sp.Proof)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteByte(ProofEncodingVersion)
+	putUvarint(&out, uint64(len(nodes)))
+	for _, node := range nodes {
+		putUvarint(&out, uint64(len(node)))
+		out.Write(node)
+	}
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// DecodeProofs is the inverse of EncodeProofs. Proof nodes shared between several proofs
+// are decoded into the same underlying slice, so callers must not modify them.
+func DecodeProofs(data []byte) ([]*AccountProof, error) {
+	r := bytes.NewReader(data)
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("reading proof encoding version: %w", err)
+	}
+	if version != ProofEncodingVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedProofEncoding, version)
+	}
+	readBytes := func(n uint64) ([]byte, error) {
+		if n > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	// Every element takes at least one byte, which bounds all the counts by the remaining input
+	readCount := func() (uint64, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return 0, err
+		}
+		if n > uint64(r.Len()) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	}
+
+	nodeCount, err := readCount()
+	if err != nil {
+		return nil, fmt.Errorf("reading node count: %w", err)
+	}
+	nodes := make([][]byte, nodeCount)
+	for i := range nodes {
+		l, err := readCount()
+		if err != nil {
+			return nil, fmt.Errorf("reading node %d: %w", i, err)
+		}
+		if nodes[i], err = readBytes(l); err != nil {
+			return nil, fmt.Errorf("reading node %d: %w", i, err)
+		}
+	}
+	readProof := func() ([][]byte, error) {
+		n, err := readCount()
+		if err != nil {
+			return nil, err
+		}
+		proof := make([][]byte, n)
+		for i := range proof {
+			idx, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if idx >= uint64(len(nodes)) {
+				return nil, fmt.Errorf("node index %d out of range [0, %d)", idx, len(nodes))
+			}
+			proof[i] = nodes[idx]
+		}
+		return proof, nil
+	}
+	readUint256 := func(v *uint256.Int) error {
+		l, err := readCount()
+		if err != nil {
+			return err
+		}
+		if l > 32 {
+			return fmt.Errorf("integer too long: %d bytes", l)
+		}
+		b, err := readBytes(l)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(b)
+		return nil
+	}
+
+	accountCount, err := readCount()
+	if err != nil {
+		return nil, fmt.Errorf("reading account count: %w", err)
+	}
+	proofs := make([]*AccountProof, accountCount)
+	for i := range proofs {
+		p := &AccountProof{}
+		if _, err = io.ReadFull(r, p.Address[:]); err != nil {
+			return nil, fmt.Errorf("reading account %d: %w", i, err)
+		}
+		if p.Nonce, err = binary.ReadUvarint(r); err != nil {
+			return nil, fmt.Errorf("reading account %d nonce: %w", i, err)
+		}
+		if err = readUint256(&p.Balance); err != nil {
+			return nil, fmt.Errorf("reading account %d balance: %w", i, err)
+		}
+		if _, err = io.ReadFull(r, p.CodeHash[:]); err != nil {
+			return nil, fmt.Errorf("reading account %d code hash: %w", i, err)
+		}
+		if _, err = io.ReadFull(r, p.StorageHash[:]); err != nil {
+			return nil, fmt.Errorf("reading account %d storage hash: %w", i, err)
+		}
+		if p.Proof, err = readProof(); err != nil {
+			return nil, fmt.Errorf("reading account %d proof: %w", i, err)
+		}
+		storageCount, err := readCount()
+		if err != nil {
+			return nil, fmt.Errorf("reading account %d storage count: %w", i, err)
+		}
+		p.StorageProofs = make([]StorageProof, storageCount)
+		for j := range p.StorageProofs {
+			sp := &p.StorageProofs[j]
+			if _, err = io.ReadFull(r, sp.Key[:]); err != nil {
+				return nil, fmt.Errorf("reading account %d storage %d: %w", i, j, err)
+			}
+			if err = readUint256(&sp.Value); err != nil {
+				return nil, fmt.Errorf("reading account %d storage %d value: %w", i, j, err)
+			}
+			if sp.Proof, err = readProof(); err != nil {
+				return nil, fmt.Errorf("reading account %d storage %d proof: %w", i, j, err)
+			}
+		}
+		proofs[i] = p
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after proofs", r.Len())
+	}
+	return proofs, nil
+}
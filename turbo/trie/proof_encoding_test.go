@@ -0,0 +1,82 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProofEncodingRoundTrip(t *testing.T) {
+	trie := newEmpty()
+	addresses := make([][20]byte, 50)
+	for i := range addresses {
+		addresses[i] = getAddressForIndex(i)
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		acc.Balance.SetUint64(uint64(i) * 1000000007)
+		acc.Root = EmptyRoot
+		trie.UpdateAccount(crypto.Keccak256(addresses[i][:]), &acc)
+	}
+
+	var proofs []*AccountProof
+	var jsonSize int
+	for i := 0; i < len(addresses); i += 3 {
+		proof, err := trie.Prove(crypto.Keccak256(addresses[i][:]), 0, false)
+		require.NoError(t, err)
+		p := &AccountProof{
+			Address:     common.Address(addresses[i]),
+			Nonce:       uint64(i),
+			CodeHash:    emptyState,
+			StorageHash: EmptyRoot,
+			Proof:       proof,
+		}
+		p.Balance.SetUint64(uint64(i) * 1000000007)
+		p.StorageProofs = []StorageProof{{Key: common.HexToHash("0x01"), Proof: [][]byte{proof[0]}}}
+		p.StorageProofs[0].Value.SetUint64(uint64(i))
+		for _, node := range proof {
+			jsonSize += 2 * len(node)
+		}
+		proofs = append(proofs, p)
+	}
+
+	enc := EncodeProofs(proofs)
+	assert.Less(t, len(enc), jsonSize/2, "shared nodes must be deduplicated")
+	assert.Equal(t, enc, EncodeProofs(proofs), "encoding must be deterministic")
+
+	dec, err := DecodeProofs(enc)
+	require.NoError(t, err)
+	require.Equal(t, len(proofs), len(dec))
+	for i := range proofs {
+		assert.Equal(t, proofs[i].Address, dec[i].Address)
+		assert.Equal(t, proofs[i].Nonce, dec[i].Nonce)
+		assert.Equal(t, proofs[i].Balance, dec[i].Balance)
+		assert.Equal(t, proofs[i].CodeHash, dec[i].CodeHash)
+		assert.Equal(t, proofs[i].StorageHash, dec[i].StorageHash)
+		assert.Equal(t, proofs[i].Proof, dec[i].Proof)
+		assert.Equal(t, proofs[i].StorageProofs, dec[i].StorageProofs)
+	}
+}
+
+func TestProofDecodingRejectsMalformed(t *testing.T) {
+	p := &AccountProof{Proof: [][]byte{{0xc0}}}
+	enc := EncodeProofs([]*AccountProof{p})
+
+	_, err := DecodeProofs(nil)
+	assert.Error(t, err)
+
+	bad := append([]byte{ProofEncodingVersion + 1}, enc[1:]...)
+	_, err = DecodeProofs(bad)
+	assert.ErrorIs(t, err, ErrUnsupportedProofEncoding)
+
+	for i := 1; i < len(enc); i++ {
+		_, err = DecodeProofs(enc[:i])
+		assert.Error(t, err, "truncated at %d", i)
+	}
+
+	_, err = DecodeProofs(append(common.CopyBytes(enc), 0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,358 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+var ErrInvalidRangeProof = errors.New("invalid range proof")
+
+// RangeProof proves the accounts with the hashed addresses in the range [From, To] of the state trie at Root:
+// it holds all the accounts of the range and the boundary proof, the trie nodes on the paths to From and To.
+// The verifier rebuilds the trie from the accounts and the hashes of the subtries outside of the range found
+// in the boundary proof, so no account of the range can be left out or added.
+type RangeProof struct {
+	Root     common.Hash
+	From, To common.Hash
+	Keys     []common.Hash       // hashed addresses of the accounts in the range, ascending
+	Accounts []*accounts.Account // with their storage roots
+	Proof    [][]byte            // RLP-encoded trie nodes on the paths to From and To
+}
+
+// ProveRange builds the range proof of the accounts with the hashed addresses from fromHash to toHash inclusive,
+// in the state trie of the block. The proof is generated from the current hashed state and intermediate hashes
+// in tx, which must correspond to the block, otherwise an error is returned.
+func ProveRange(tx ethdb.Tx, fromHash, toHash common.Hash, blockNum uint64) (*RangeProof, error) {
+	if bytes.Compare(fromHash[:], toHash[:]) > 0 {
+		return nil, fmt.Errorf("%w: range %x - %x is reversed", ErrInvalidRangeProof, fromHash, toHash)
+	}
+	root, err := stateRootAt(tx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	rp := &RangeProof{Root: root, From: fromHash, To: toHash}
+
+	keys := [][]byte{common.CopyBytes(fromHash[:])}
+	c := tx.Cursor(dbutils.HashedAccountsBucket)
+	defer c.Close()
+	for k, v, err := c.Seek(fromHash[:]); k != nil && bytes.Compare(k, toHash[:]) <= 0; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		var acc accounts.Account
+		if err = acc.DecodeForStorage(v); err != nil {
+			return nil, fmt.Errorf("decoding account %x: %w", k, err)
+		}
+		rp.Keys = append(rp.Keys, common.BytesToHash(k))
+		rp.Accounts = append(rp.Accounts, &acc)
+		keys = append(keys, common.CopyBytes(k))
+	}
+	keys = append(keys, common.CopyBytes(toHash[:]))
+
+	// The storage roots aren't in the hashed state, they come from the trie
+	t, err := LoadRetainedTrie(tx, root, keys, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range rp.Keys {
+		acc, ok := t.GetAccount(key[:])
+		if !ok || acc == nil {
+			return nil, fmt.Errorf("account %x is missing in the trie", key)
+		}
+		rp.Accounts[i].Root = acc.Root
+	}
+	known := make(map[string]struct{})
+	for _, key := range []common.Hash{fromHash, toHash} {
+		proof, err := t.Prove(key[:], 0, false /* storage */)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range proof {
+			if _, ok := known[string(n)]; !ok {
+				known[string(n)] = struct{}{}
+				rp.Proof = append(rp.Proof, n)
+			}
+		}
+	}
+	return rp, nil
+}
+
+// stateRootAt reads the state root from the header of the canonical block
+func stateRootAt(tx ethdb.Tx, blockNum uint64) (common.Hash, error) {
+	hash, err := tx.GetOne(dbutils.HeaderCanonicalBucket, dbutils.EncodeBlockNumber(blockNum))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(hash) == 0 {
+		return common.Hash{}, fmt.Errorf("canonical hash of block %d not found", blockNum)
+	}
+	enc, err := tx.GetOne(dbutils.HeadersBucket, dbutils.HeaderKey(blockNum, common.BytesToHash(hash)))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(enc) == 0 {
+		return common.Hash{}, fmt.Errorf("header %d %x not found", blockNum, hash)
+	}
+	// Only the fields up to the state root are of interest, the header type can't be imported here
+	var header struct {
+		ParentHash common.Hash
+		UncleHash  common.Hash
+		Coinbase   common.Address
+		Root       common.Hash
+		Rest       []rlp.RawValue `rlp:"tail"`
+	}
+	if err = rlp.DecodeBytes(enc, &header); err != nil {
+		return common.Hash{}, fmt.Errorf("decoding header %d %x: %w", blockNum, hash, err)
+	}
+	return header.Root, nil
+}
+
+// VerifyRangeProof checks that rp holds all the accounts of its range in the state trie at its root
+func VerifyRangeProof(rp *RangeProof) error {
+	if len(rp.Keys) != len(rp.Accounts) {
+		return fmt.Errorf("%w: %d keys for %d accounts", ErrInvalidRangeProof, len(rp.Keys), len(rp.Accounts))
+	}
+	if bytes.Compare(rp.From[:], rp.To[:]) > 0 {
+		return fmt.Errorf("%w: range %x - %x is reversed", ErrInvalidRangeProof, rp.From, rp.To)
+	}
+	for i, key := range rp.Keys {
+		if bytes.Compare(key[:], rp.From[:]) < 0 || bytes.Compare(key[:], rp.To[:]) > 0 {
+			return fmt.Errorf("%w: account %x is out of the range", ErrInvalidRangeProof, key)
+		}
+		if i > 0 && bytes.Compare(rp.Keys[i-1][:], key[:]) >= 0 {
+			return fmt.Errorf("%w: accounts are not in ascending order at %x", ErrInvalidRangeProof, key)
+		}
+	}
+
+	var hashes []rangeHash
+	if rp.Root != EmptyRoot {
+		nodes := make(map[common.Hash][]byte, len(rp.Proof))
+		for _, n := range rp.Proof {
+			nodes[common.BytesToHash(crypto.Keccak256(n))] = n
+		}
+		enc, ok := nodes[rp.Root]
+		if !ok {
+			return &MissingNodeError{NodeHash: rp.Root}
+		}
+		left, right := keybytesToHex(rp.From[:]), keybytesToHex(rp.To[:])
+		b := rangeBounds{nodes: nodes, left: left[:len(left)-1], right: right[:len(right)-1]}
+		var err error
+		if hashes, err = b.outsideHashes(enc, []byte{}, nil); err != nil {
+			return err
+		}
+	}
+	root, err := rangeRoot(hashes, rp.Keys, rp.Accounts)
+	if err != nil {
+		return err
+	}
+	if root != rp.Root {
+		return fmt.Errorf("%w: root %x, expected %x", ErrInvalidRangeProof, root, rp.Root)
+	}
+	return nil
+}
+
+// rangeHash is the hash of the subtrie at the path in HEX encoding
+type rangeHash struct {
+	hex  []byte
+	hash common.Hash
+}
+
+// rangeBounds are the paths to the bounds of the range and the nodes of the boundary proof
+type rangeBounds struct {
+	nodes       map[common.Hash][]byte
+	left, right []byte
+}
+
+const (
+	beforeRange = iota
+	insideRange
+	afterRange
+	crossingRange
+)
+
+// position tells where the subtrie at the path is relative to the range, crossingRange if it holds a bound
+func (b *rangeBounds) position(hex []byte) int {
+	switch l, r := bytes.Compare(hex, b.left[:len(hex)]), bytes.Compare(hex, b.right[:len(hex)]); {
+	case l < 0:
+		return beforeRange
+	case r > 0:
+		return afterRange
+	case l == 0 || r == 0:
+		return crossingRange
+	default:
+		return insideRange
+	}
+}
+
+// outsideHashes collects the hashes of the subtries outside of the range under the node at the path, in the order
+// of the paths. The nodes on the paths to the bounds are resolved from the proof, the subtries inside the range are
+// left to be rebuilt from the accounts.
+func (b *rangeBounds) outsideHashes(enc []byte, hex []byte, hashes []rangeHash) ([]rangeHash, error) {
+	content, _, err := rlp.SplitList(enc)
+	if err != nil {
+		return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex, err)
+	}
+	switch items, _ := rlp.CountValues(content); items {
+	case 17:
+		if len(hex) >= len(b.left) {
+			return nil, fmt.Errorf("%w at path %x: branch node at the end of the key", ErrInvalidProofNode, hex)
+		}
+		rest := content
+		for i := byte(0); i < 16; i++ {
+			var ref []byte
+			var kind rlp.Kind
+			if kind, ref, rest, err = rlp.Split(rest); err != nil {
+				return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex, err)
+			}
+			if len(ref) == 0 {
+				continue
+			}
+			if kind == rlp.List || len(ref) != common.HashLength {
+				// The nodes of the state trie are never short enough to be embedded
+				return nil, fmt.Errorf("%w at path %x: embedded child %x", ErrInvalidProofNode, hex, i)
+			}
+			childHex := append(common.CopyBytes(hex), i)
+			switch b.position(childHex) {
+			case beforeRange, afterRange:
+				hashes = append(hashes, rangeHash{hex: childHex, hash: common.BytesToHash(ref)})
+			case crossingRange:
+				child, ok := b.nodes[common.BytesToHash(ref)]
+				if !ok {
+					return nil, &MissingNodeError{NodeHash: common.BytesToHash(ref), Path: childHex}
+				}
+				if hashes, err = b.outsideHashes(child, childHex, hashes); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return hashes, nil
+	case 2:
+		compactKey, rest, err := rlp.SplitString(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex, err)
+		}
+		nKey := compactToHex(compactKey)
+		outside := func() []rangeHash {
+			return append(hashes, rangeHash{hex: hex, hash: common.BytesToHash(crypto.Keccak256(enc))})
+		}
+		if hasTerm(nKey) {
+			key := append(common.CopyBytes(hex), nKey[:len(nKey)-1]...)
+			if len(key) != len(b.left) {
+				return nil, fmt.Errorf("%w at path %x: leaf key of %d nibbles", ErrInvalidProofNode, hex, len(key))
+			}
+			if bytes.Compare(key, b.left) < 0 || bytes.Compare(key, b.right) > 0 {
+				return outside(), nil
+			}
+			return hashes, nil
+		}
+		childHex := append(common.CopyBytes(hex), nKey...)
+		if len(childHex) >= len(b.left) {
+			return nil, fmt.Errorf("%w at path %x: extension to %d nibbles", ErrInvalidProofNode, hex, len(childHex))
+		}
+		switch b.position(childHex) {
+		case beforeRange, afterRange:
+			return outside(), nil
+		case insideRange:
+			return hashes, nil
+		}
+		kind, ref, _, err := rlp.Split(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w at path %x: %v", ErrInvalidProofNode, hex, err)
+		}
+		if kind == rlp.List || len(ref) != common.HashLength {
+			return nil, fmt.Errorf("%w at path %x: embedded child", ErrInvalidProofNode, hex)
+		}
+		child, ok := b.nodes[common.BytesToHash(ref)]
+		if !ok {
+			return nil, &MissingNodeError{NodeHash: common.BytesToHash(ref), Path: childHex}
+		}
+		return b.outsideHashes(child, childHex, hashes)
+	default:
+		return nil, fmt.Errorf("%w at path %x: %d items", ErrInvalidProofNode, hex, items)
+	}
+}
+
+// rangeRoot is the root of the trie of the subtrie hashes and the accounts, both in the order of their paths
+func rangeRoot(hashes []rangeHash, keys []common.Hash, accs []*accounts.Account) (common.Hash, error) {
+	// The whole trie is a single node outside of the range
+	if len(hashes) == 1 && len(hashes[0].hex) == 0 && len(keys) == 0 {
+		return hashes[0].hash, nil
+	}
+	hb := NewHashBuilder(false)
+	var groups, hasTree, hasHash []uint16
+	var hashData GenStructStepHashData
+	var accData GenStructStepAccountData
+	retain := func(_ []byte) bool { return false }
+
+	// The accounts go between the hashes of the subtries before and after the range
+	before := len(hashes)
+	if len(keys) > 0 {
+		first := keybytesToHex(keys[0][:])
+		for before = 0; before < len(hashes) && bytes.Compare(hashes[before].hex, first) < 0; before++ {
+		}
+	}
+	total := len(hashes) + len(keys)
+	at := func(i int) ([]byte, *rangeHash, *accounts.Account) {
+		switch {
+		case i < before:
+			return hashes[i].hex, &hashes[i], nil
+		case i < before+len(keys):
+			return keybytesToHex(keys[i-before][:]), nil, accs[i-before]
+		default:
+			return hashes[i-len(keys)].hex, &hashes[i-len(keys)], nil
+		}
+	}
+	for i := 0; i < total; i++ {
+		curr, h, acc := at(i)
+		var succ []byte
+		if i+1 < total {
+			succ, _, _ = at(i + 1)
+		}
+		var data GenStructStepData
+		if h != nil {
+			hashData.Hash = h.hash
+			data = &hashData
+		} else {
+			// The code hash goes deeper on the stack than the storage root
+			accData.FieldSet = 0
+			if acc.Balance.Sign() != 0 {
+				accData.FieldSet |= AccountFieldBalanceOnly
+			}
+			if acc.Nonce != 0 {
+				accData.FieldSet |= AccountFieldNonceOnly
+			}
+			if !acc.IsEmptyCodeHash() {
+				accData.FieldSet |= AccountFieldCodeOnly
+				if err := hb.hash(acc.CodeHash[:]); err != nil {
+					return common.Hash{}, err
+				}
+			}
+			if !acc.IsEmptyRoot() {
+				accData.FieldSet |= AccountFieldStorageOnly
+				if err := hb.hash(acc.Root[:]); err != nil {
+					return common.Hash{}, err
+				}
+			}
+			accData.Balance.Set(&acc.Balance)
+			accData.Nonce = acc.Nonce
+			accData.Incarnation = acc.Incarnation
+			data = &accData
+		}
+		var err error
+		if groups, hasTree, hasHash, err = GenStructStep(retain, curr, succ, hb, nil /* hashCollector */, data, groups, hasTree, hasHash, false); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if hb.hasRoot() {
+		return hb.rootHash(), nil
+	}
+	return EmptyRoot, nil
+}
@@ -0,0 +1,114 @@
+package trie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProveRange(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	addrHashes := make([]common.Hash, 200)
+	for i := range addrHashes {
+		addr := getAddressForIndex(i)
+		addrHashes[i] = common.BytesToHash(crypto.Keccak256(addr[:]))
+		acc := accounts.NewAccount()
+		acc.Nonce = uint64(i)
+		acc.Balance.SetUint64(uint64(i) * 1000000007)
+		if i%10 == 0 {
+			acc.Incarnation = 1
+			acc.CodeHash = crypto.Keccak256Hash([]byte{byte(i)})
+			for j := 0; j < 5; j++ {
+				keyHash := common.BytesToHash(crypto.Keccak256([]byte{byte(i), byte(j)}))
+				require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHashes[i], 1, keyHash), []byte{byte(j + 1)}))
+			}
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHashes[i][:], enc))
+	}
+	sort.Slice(addrHashes, func(i, j int) bool { return bytes.Compare(addrHashes[i][:], addrHashes[j][:]) < 0 })
+	root, err := CalcRoot("test", db)
+	require.NoError(t, err)
+
+	// The header of the block 5 with just the fields up to the state root
+	header, err := rlp.EncodeToBytes([]interface{}{common.Hash{}, common.Hash{}, common.Address{}, root, uint64(5)})
+	require.NoError(t, err)
+	headerHash := crypto.Keccak256Hash(header)
+	require.NoError(t, db.Put(dbutils.HeaderCanonicalBucket, dbutils.EncodeBlockNumber(5), headerHash[:]))
+	require.NoError(t, db.Put(dbutils.HeadersBucket, dbutils.HeaderKey(5, headerHash), header))
+
+	tx, err := db.KV().Begin(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	var max common.Hash
+	for i := range max {
+		max[i] = 0xff
+	}
+	between := func(a, b common.Hash) common.Hash {
+		h := a
+		h[common.HashLength-1]++
+		require.True(t, bytes.Compare(h[:], b[:]) < 0)
+		return h
+	}
+	for _, tc := range []struct {
+		name     string
+		from, to common.Hash
+		accounts int
+	}{
+		{"whole state", common.Hash{}, max, len(addrHashes)},
+		{"existing bounds", addrHashes[10], addrHashes[59], 50},
+		{"missing bounds", between(addrHashes[10], addrHashes[11]), between(addrHashes[59], addrHashes[60]), 49},
+		{"single account", addrHashes[100], addrHashes[100], 1},
+		{"empty range", between(addrHashes[100], addrHashes[101]), between(addrHashes[100], addrHashes[101]), 0},
+		{"last account", addrHashes[len(addrHashes)-1], max, 1},
+	} {
+		rp, err := ProveRange(tx, tc.from, tc.to, 5)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, root, rp.Root, tc.name)
+		require.Len(t, rp.Accounts, tc.accounts, tc.name)
+		require.NoError(t, VerifyRangeProof(rp), tc.name)
+		if tc.accounts == 0 {
+			continue
+		}
+
+		// Neither an account can be left out, nor any of them changed
+		omitted := *rp
+		omitted.Keys, omitted.Accounts = rp.Keys[1:], rp.Accounts[1:]
+		assert.True(t, errors.Is(VerifyRangeProof(&omitted), ErrInvalidRangeProof), tc.name)
+		changed := *rp
+		changed.Accounts = append([]*accounts.Account{}, rp.Accounts...)
+		changed.Accounts[len(changed.Accounts)-1] = rp.Accounts[len(rp.Accounts)-1].SelfCopy()
+		changed.Accounts[len(changed.Accounts)-1].Nonce++
+		assert.True(t, errors.Is(VerifyRangeProof(&changed), ErrInvalidRangeProof), tc.name)
+	}
+
+	rp, err := ProveRange(tx, addrHashes[10], addrHashes[59], 5)
+	require.NoError(t, err)
+	truncated := *rp
+	truncated.Proof = rp.Proof[:len(rp.Proof)-1]
+	var missingNode *MissingNodeError
+	assert.True(t, errors.As(VerifyRangeProof(&truncated), &missingNode))
+	outOfRange := *rp
+	outOfRange.To = addrHashes[58]
+	assert.True(t, errors.Is(VerifyRangeProof(&outOfRange), ErrInvalidRangeProof))
+
+	_, err = ProveRange(tx, addrHashes[59], addrHashes[10], 5)
+	assert.True(t, errors.Is(err, ErrInvalidRangeProof))
+	_, err = ProveRange(tx, addrHashes[10], addrHashes[59], 6)
+	assert.Error(t, err)
+}
@@ -96,6 +96,7 @@ type FlatDBTrieLoader struct {
 	defaultReceiver *RootHashAggregator
 	hc              HashCollector2
 	shc             StorageHashCollector2
+	workers         int // see SetWorkers
 }
 
 // RootHashAggregator - calculates Merkle trie root hash from incoming data stream
@@ -128,6 +129,9 @@ type RootHashAggregator struct {
 	a              accounts.Account
 	leafData       GenStructStepLeafData
 	accData        GenStructStepAccountData
+	rl             RetainDecider // if set, nodes on the paths to retained keys are built, see RootNode
+	rootNode       node
+	retainBuf      []byte
 }
 
 func NewRootHashAggregator() *RootHashAggregator {
@@ -208,6 +212,27 @@ func (l *FlatDBTrieLoader) CalcTrieRoot(db ethdb.Database, prefix []byte, quit <
 		tx = txDB.(ethdb.HasTx).Tx()
 	}
 
+	var root common.Hash
+	var err error
+	if l.parallel(prefix) {
+		root, err = l.calcTrieRootParallel(tx, quit)
+	} else {
+		root, err = l.calcTrieRoot(tx, prefix, quit)
+	}
+	if err != nil {
+		return EmptyRoot, err
+	}
+
+	if !useExternalTx {
+		err := txDB.Commit()
+		if err != nil {
+			return EmptyRoot, err
+		}
+	}
+	return root, nil
+}
+
+func (l *FlatDBTrieLoader) calcTrieRoot(tx ethdb.Tx, prefix []byte, quit <-chan struct{}) (common.Hash, error) {
 	accC := tx.Cursor(dbutils.HashedAccountsBucket)
 	defer accC.Close()
 	accs := NewStateCursor(accC, quit)
@@ -308,13 +333,6 @@ func (l *FlatDBTrieLoader) CalcTrieRoot(db ethdb.Database, prefix []byte, quit <
 	if err := l.receiver.Receive(CutoffStreamItem, nil, nil, nil, nil, nil, false, len(prefix)); err != nil {
 		return EmptyRoot, err
 	}
-
-	if !useExternalTx {
-		err := txDB.Commit()
-		if err != nil {
-			return EmptyRoot, err
-		}
-	}
 	return l.receiver.Root(), nil
 }
 
@@ -349,6 +367,7 @@ func (r *RootHashAggregator) Reset(hc HashCollector2, shc StorageHashCollector2,
 	r.valueStorage = nil
 	r.wasIHStorage = false
 	r.root = common.Hash{}
+	r.rootNode = nil
 	r.trace = trace
 	r.hb.trace = trace
 }
@@ -498,6 +517,9 @@ func (r *RootHashAggregator) Receive(itemType StreamItem,
 		}
 		if r.hb.hasRoot() {
 			r.root = r.hb.rootHash()
+			if r.rl != nil {
+				r.rootNode = r.hb.root()
+			}
 		} else {
 			r.root = EmptyRoot
 		}
@@ -535,6 +557,35 @@ func (r *RootHashAggregator) Root() common.Hash {
 	return r.root
 }
 
+// RootNode returns the root of the trie built during the last calculation, only nodes on the paths
+// to the keys retained by the RetainDecider are present in it, the rest is folded into hash nodes.
+// It is nil if no RetainDecider was set.
+func (r *RootHashAggregator) RootNode() node {
+	return r.rootNode
+}
+
+// SetRetainDecider makes the aggregator build (instead of only hashing) the trie nodes on the paths
+// to the keys retained by rl. Storage keys are expected in the form {addrHash}{incarnation}{keyHash}
+func (r *RootHashAggregator) SetRetainDecider(rl RetainDecider) {
+	r.rl = rl
+}
+
+func (r *RootHashAggregator) retainAccount(prefix []byte) bool {
+	if r.rl == nil {
+		return false
+	}
+	return r.rl.Retain(prefix)
+}
+
+func (r *RootHashAggregator) retainStorage(prefix []byte) bool {
+	if r.rl == nil {
+		return false
+	}
+	hexutil.DecompressNibbles(r.currAccK, &r.retainBuf)
+	r.retainBuf = append(r.retainBuf, prefix...)
+	return r.rl.Retain(r.retainBuf)
+}
+
 func (r *RootHashAggregator) advanceKeysStorage(k []byte, terminator bool) {
 	r.currStorage.Reset()
 	r.currStorage.Write(r.succStorage.Bytes())
@@ -568,7 +619,7 @@ func (r *RootHashAggregator) genStructStorage() error {
 		r.leafData.Value = rlphacks.RlpSerializableBytes(r.valueStorage)
 		data = &r.leafData
 	}
-	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.RetainNothing, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	r.groupsStorage, r.hasTreeStorage, r.hasHashStorage, err = GenStructStep(r.retainStorage, r.currStorage.Bytes(), r.succStorage.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.shc == nil {
 			return nil
 		}
@@ -636,7 +687,7 @@ func (r *RootHashAggregator) genStructAccount() error {
 	r.currStorage.Reset()
 	r.succStorage.Reset()
 	var err error
-	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.RetainNothing, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+	if r.groups, r.hasTree, r.hasHash, err = GenStructStep(r.retainAccount, r.curr.Bytes(), r.succ.Bytes(), r.hb, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
 		if r.hc == nil {
 			return nil
 		}
@@ -0,0 +1,256 @@
+package trie
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	shardBatchSize = 1024 // items sent to the hashing goroutine at once
+	shardBatches   = 16   // batches buffered for the hashing goroutine
+)
+
+// SetWorkers makes CalcTrieRoot of the whole trie hash the subtries of the 16 first nibbles of the keys in up to
+// workers goroutines, the number of CPUs if zero. The database is still read by the calling goroutine, in the same
+// order, so the root and the collected hashes are the same as of the sequential calculation. The sequential one is
+// used for 1 worker (the default), for the subtries of the prefixes and for the custom stream receivers.
+func (l *FlatDBTrieLoader) SetWorkers(workers int) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	l.workers = workers
+}
+
+func (l *FlatDBTrieLoader) parallel(prefix []byte) bool {
+	return l.workers > 1 && len(prefix) == 0 && l.receiver == l.defaultReceiver && l.defaultReceiver.rl == nil
+}
+
+// shardItem is the copy of the item of the stream, the loader reuses the buffers of the ones it sends
+type shardItem struct {
+	itemType     StreamItem
+	accountKey   []byte
+	storageKey   []byte
+	accountValue *accounts.Account
+	storageValue []byte
+	hash         []byte
+	hasTree      bool
+}
+
+// shardReceiver forwards the stream of the subtrie of one first nibble to the goroutine hashing it
+type shardReceiver struct {
+	ctx   context.Context
+	batch []shardItem
+	items chan []shardItem
+}
+
+func (r *shardReceiver) Receive(itemType StreamItem, accountKey []byte, storageKey []byte, accountValue *accounts.Account, storageValue []byte, hash []byte, hasTree bool, _ int) error {
+	if itemType == CutoffStreamItem { // the subtrie is closed by the hashing goroutine itself
+		return r.flush()
+	}
+	item := shardItem{
+		itemType:     itemType,
+		accountKey:   common.CopyBytes(accountKey),
+		storageKey:   common.CopyBytes(storageKey),
+		storageValue: common.CopyBytes(storageValue),
+		hash:         common.CopyBytes(hash),
+		hasTree:      hasTree,
+	}
+	if accountValue != nil {
+		item.accountValue = accountValue.SelfCopy()
+	}
+	r.batch = append(r.batch, item)
+	if len(r.batch) < shardBatchSize {
+		return nil
+	}
+	return r.flush()
+}
+
+func (r *shardReceiver) flush() error {
+	if len(r.batch) == 0 {
+		return nil
+	}
+	select {
+	case r.items <- r.batch:
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+	r.batch = make([]shardItem, 0, shardBatchSize)
+	return nil
+}
+
+func (r *shardReceiver) Result() SubTries {
+	panic("don't call me")
+}
+
+func (r *shardReceiver) Root() common.Hash {
+	return common.Hash{}
+}
+
+// subTrie is the result of the hashing of the subtrie of one first nibble
+type subTrie struct {
+	hash             common.Hash
+	hasTree, hasHash bool // bits of the nibble in the root node
+}
+
+// hashSubTrie hashes the stream of the subtrie of the nibble, closing it as if the next key started with nibble+1,
+// so the branch node of the root is left for the merge
+func hashSubTrie(nibble byte, items <-chan []shardItem, hc HashCollector2, shc StorageHashCollector2) (subTrie, error) {
+	r := NewRootHashAggregator()
+	r.Reset(hc, shc, false)
+	var err error
+	for batch := range items {
+		for i := range batch {
+			if err != nil {
+				break // drain the channel, the loader stops after the next batch
+			}
+			item := &batch[i]
+			err = r.Receive(item.itemType, item.accountKey, item.storageKey, item.accountValue, item.storageValue, item.hash, item.hasTree, 0)
+		}
+	}
+	if err != nil {
+		return subTrie{}, err
+	}
+	if err = r.Receive(AHashStreamItem, []byte{nibble + 1}, nil, nil, nil, EmptyRoot[:], false, 0); err != nil {
+		return subTrie{}, err
+	}
+	var st subTrie
+	copy(st.hash[:], r.hb.topHash())
+	if len(r.hasTree) > 0 {
+		st.hasTree = r.hasTree[0]&(1<<nibble) != 0
+		st.hasHash = r.hasHash[0]&(1<<nibble) != 0
+	}
+	return st, nil
+}
+
+// calcTrieRootParallel reads the subtries of the first nibbles one after another, each of them is hashed in its own
+// goroutine, then the 16 sub-roots are merged into the root node
+func (l *FlatDBTrieLoader) calcTrieRootParallel(tx ethdb.Tx, quit <-chan struct{}) (common.Hash, error) {
+	nibbles, err := firstNibbles(tx)
+	if err != nil {
+		return EmptyRoot, err
+	}
+	if len(nibbles) < 2 { // the root is not a branch node, or the subtrie of a nibble is removed
+		return l.calcTrieRoot(tx, []byte{}, quit)
+	}
+
+	// The collectors are called by the loader, for the deleted hashes, and by the hashing goroutines
+	var lock sync.Mutex
+	hc, shc := l.hc, l.shc
+	if hc != nil {
+		l.hc = func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+			lock.Lock()
+			defer lock.Unlock()
+			return hc(keyHex, hasState, hasTree, hasHash, hashes, rootHash)
+		}
+	}
+	if shc != nil {
+		l.shc = func(accWithInc []byte, keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+			lock.Lock()
+			defer lock.Unlock()
+			return shc(accWithInc, keyHex, hasState, hasTree, hasHash, hashes, rootHash)
+		}
+	}
+	defer func() {
+		l.hc, l.shc, l.receiver = hc, shc, l.defaultReceiver
+	}()
+
+	subTries := make([]subTrie, len(nibbles))
+	sem := make(chan struct{}, l.workers)
+	g, ctx := errgroup.WithContext(context.Background())
+	read := func() error {
+		for i, nibble := range nibbles {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			i, nibble := i, nibble
+			receiver := &shardReceiver{ctx: ctx, batch: make([]shardItem, 0, shardBatchSize), items: make(chan []shardItem, shardBatches)}
+			g.Go(func() error {
+				defer func() { <-sem }()
+				st, err := hashSubTrie(nibble, receiver.items, l.hc, l.shc)
+				subTries[i] = st
+				return err
+			})
+			l.receiver = receiver
+			_, err := l.calcTrieRoot(tx, []byte{nibble}, quit)
+			close(receiver.items)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err = read(); err != nil {
+		_ = g.Wait()
+		return EmptyRoot, err
+	}
+	if err = g.Wait(); err != nil {
+		return EmptyRoot, err
+	}
+
+	// The root node, the collector is called for it here, as the sequential calculation does
+	merge := NewRootHashAggregator()
+	merge.Reset(nil, nil, false)
+	var hasState, hasTree, hasHash uint16
+	var hashes []byte
+	for i, nibble := range nibbles {
+		st := &subTries[i]
+		hasState |= 1 << nibble
+		if st.hasTree {
+			hasTree |= 1 << nibble
+		}
+		if st.hasHash {
+			hasHash |= 1 << nibble
+			hashes = append(hashes, st.hash[:]...)
+		}
+		if err = merge.Receive(AHashStreamItem, []byte{nibble}, nil, nil, nil, st.hash[:], st.hasTree, 0); err != nil {
+			return EmptyRoot, err
+		}
+	}
+	if err = merge.Receive(CutoffStreamItem, nil, nil, nil, nil, nil, false, 0); err != nil {
+		return EmptyRoot, err
+	}
+	root := merge.Root()
+	if hc != nil && (hasTree != 0 || hasHash != 0) {
+		if err = hc([]byte{}, hasState, hasTree, hasHash, hashes, root[:]); err != nil {
+			return EmptyRoot, err
+		}
+	}
+	l.defaultReceiver.root = root
+	return root, nil
+}
+
+// firstNibbles returns the first nibbles of the hashed keys of the accounts, nil if the hashes of the subtries of the
+// other nibbles are still in the database: the loader of the shard of the nibble removes them
+func firstNibbles(tx ethdb.Tx) ([]byte, error) {
+	accs := tx.Cursor(dbutils.HashedAccountsBucket)
+	defer accs.Close()
+	trieAccs := tx.Cursor(dbutils.TrieOfAccountsBucket)
+	defer trieAccs.Close()
+	var nibbles []byte
+	for nibble := byte(0); nibble < 16; nibble++ {
+		k, _, err := accs.Seek([]byte{nibble << 4})
+		if err != nil {
+			return nil, err
+		}
+		if k != nil && k[0]>>4 == nibble {
+			nibbles = append(nibbles, nibble)
+			continue
+		}
+		if k, _, err = trieAccs.Seek([]byte{nibble}); err != nil {
+			return nil, err
+		}
+		if k != nil && k[0] == nibble {
+			return nil, nil
+		}
+	}
+	return nibbles, nil
+}
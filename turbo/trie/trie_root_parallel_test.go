@@ -0,0 +1,108 @@
+package trie
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcTrieRootParallel(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	rnd := rand.New(rand.NewSource(1))
+	var addrHashes []common.Hash
+	putAccount := func(addrHash common.Hash, balance uint64, storage int) {
+		acc := accounts.NewAccount()
+		acc.Balance.SetUint64(balance)
+		if storage > 0 {
+			acc.Incarnation = 1
+		}
+		encoded := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(encoded)
+		require.NoError(t, db.Put(dbutils.HashedAccountsBucket, addrHash[:], encoded))
+		for i := 0; i < storage; i++ {
+			var loc common.Hash
+			rnd.Read(loc[:])
+			require.NoError(t, db.Put(dbutils.HashedStorageBucket, dbutils.GenerateCompositeStorageKey(addrHash, acc.Incarnation, loc), []byte{byte(i + 1)}))
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		var addrHash common.Hash
+		rnd.Read(addrHash[:])
+		if i%100 == 0 {
+			addrHash[0] &= 0x0f // the first nibble 0 is more dense
+		}
+		addrHashes = append(addrHashes, addrHash)
+		putAccount(addrHash, uint64(i+1), rnd.Intn(3)*rnd.Intn(40))
+	}
+
+	// calc returns the root and the collected hashes, the same as the hashing stage collects and writes them
+	calc := func(rl *RetainList, workers int) (common.Hash, map[string][]byte, map[string][]byte) {
+		accTrie, storageTrie := map[string][]byte{}, map[string][]byte{}
+		loader := NewFlatDBTrieLoader("test")
+		require.NoError(t, loader.Reset(rl, func(keyHex []byte, hasState, hasTree, hasHash uint16, hashes, _ []byte) error {
+			if hasState == 0 {
+				accTrie[string(keyHex)] = nil
+			} else if len(keyHex) > 0 {
+				accTrie[string(keyHex)] = MarshalTrieNode(hasState, hasTree, hasHash, hashes, nil, make([]byte, len(hashes)+6))
+			}
+			return nil
+		}, func(accWithInc []byte, keyHex []byte, hasState, hasTree, hasHash uint16, hashes, rootHash []byte) error {
+			k := string(accWithInc) + string(keyHex)
+			if hasState == 0 {
+				storageTrie[k] = nil
+			} else if len(keyHex) == 0 || hasHash != 0 || hasTree != 0 {
+				storageTrie[k] = MarshalTrieNode(hasState, hasTree, hasHash, hashes, rootHash, make([]byte, len(hashes)+len(rootHash)+6))
+			}
+			return nil
+		}, false))
+		loader.SetWorkers(workers)
+		root, err := loader.CalcTrieRoot(db, []byte{}, nil)
+		require.NoError(t, err)
+		return root, accTrie, storageTrie
+	}
+	write := func(bucket string, trie map[string][]byte) {
+		for k, v := range trie {
+			if v == nil {
+				require.NoError(t, db.Delete(bucket, []byte(k), nil))
+			} else {
+				require.NoError(t, db.Put(bucket, []byte(k), v))
+			}
+		}
+	}
+
+	root, accTrie, storageTrie := calc(NewRetainList(0), 1)
+	for _, workers := range []int{2, 5, 16} {
+		parallelRoot, parallelAccTrie, parallelStorageTrie := calc(NewRetainList(0), workers)
+		require.Equal(t, root, parallelRoot, "workers %d", workers)
+		require.Equal(t, accTrie, parallelAccTrie, "workers %d", workers)
+		require.Equal(t, storageTrie, parallelStorageTrie, "workers %d", workers)
+	}
+	write(dbutils.TrieOfAccountsBucket, accTrie)
+	write(dbutils.TrieOfStorageBucket, storageTrie)
+
+	// The incremental calculation, using the hashes of the unchanged subtries
+	rl := func() *RetainList {
+		rl := NewRetainList(0)
+		for _, addrHash := range addrHashes[:50] {
+			rl.AddKey(addrHash[:])
+		}
+		return rl
+	}
+	for i, addrHash := range addrHashes[:50] {
+		putAccount(addrHash, uint64(i+10000), 0)
+	}
+	root, accTrie, storageTrie = calc(rl(), 1)
+	parallelRoot, parallelAccTrie, parallelStorageTrie := calc(rl(), 4)
+	require.Equal(t, root, parallelRoot)
+	require.Equal(t, accTrie, parallelAccTrie)
+	require.Equal(t, storageTrie, parallelStorageTrie)
+	require.NoError(t, db.ClearBuckets(dbutils.TrieOfAccountsBucket, dbutils.TrieOfStorageBucket))
+	regeneratedRoot, _, _ := calc(NewRetainList(0), 4)
+	require.Equal(t, regeneratedRoot, root)
+}
@@ -90,31 +90,13 @@ func NewWitnessFromReader(input io.Reader, trace bool) (*Witness, error) {
 		if err != nil {
 			return nil, err
 		}
-		var op WitnessOperator
-		switch OperatorKindCode(opcode[0]) {
-		case OpHash:
-			op = &OperatorHash{}
-		case OpLeaf:
-			op = &OperatorLeafValue{}
-		case OpAccountLeaf:
-			op = &OperatorLeafAccount{}
-		case OpCode:
-			op = &OperatorCode{}
-		case OpBranch:
-			op = &OperatorBranch{}
-		case OpEmptyRoot:
-			op = &OperatorEmptyRoot{}
-		case OpExtension:
-			op = &OperatorExtension{}
-		case OpNewTrie:
+		if OperatorKindCode(opcode[0]) == OpNewTrie {
 			/* end of the current trie, end the function */
 			break
-		default:
-			return nil, fmt.Errorf("unexpected opcode while reading witness: %x", opcode[0])
 		}
-
+		op := newWitnessOperator(OperatorKindCode(opcode[0]))
 		if op == nil {
-			break
+			return nil, fmt.Errorf("unexpected opcode while reading witness: %x", opcode[0])
 		}
 
 		err = op.LoadFrom(operatorLoader)
@@ -0,0 +1,269 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/bits"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ugorji/go/codec"
+)
+
+// CompressedWitnessVersion is the version of the witnesses written by CompressedWitnessWriter, in which the subtrees
+// repeated across the consecutive witnesses are replaced with the references to the rolling dictionary
+const CompressedWitnessVersion = uint8(2)
+
+// DefaultWitnessDictionarySize is the number of the recent subtrees the compressed witnesses can refer to
+const DefaultWitnessDictionarySize = 1 << 16
+
+// minDictionarySubtreeSize is the size of the smallest subtree worth a reference, which takes few bytes. The hashes
+// and everything bigger are remembered
+const minDictionarySubtreeSize = 1 + common.HashLength
+
+// witnessDictionary is the rolling dictionary of the subtrees of the witnesses (the operators a node of the trie
+// is built from), shared by the writer and the reader of a stream: both add the same subtrees in the same order,
+// so that a subtree is referred to by its distance back from the last added one.
+type witnessDictionary struct {
+	entries []dictionaryEntry      // ring buffer, the subtree with id i is at i % len(entries)
+	next    uint64                 // id of the next added subtree
+	ids     map[common.Hash]uint64 // digest of the encoding -> id, only maintained by the writer
+}
+
+type dictionaryEntry struct {
+	operators []WitnessOperator
+	digest    common.Hash
+}
+
+func newWitnessDictionary(size int, withIds bool) *witnessDictionary {
+	d := &witnessDictionary{entries: make([]dictionaryEntry, size)}
+	if withIds {
+		d.ids = make(map[common.Hash]uint64)
+	}
+	return d
+}
+
+func (d *witnessDictionary) add(operators []WitnessOperator, digest common.Hash) {
+	entry := &d.entries[d.next%uint64(len(d.entries))]
+	if d.ids != nil {
+		if d.next >= uint64(len(d.entries)) && d.ids[entry.digest] == d.next-uint64(len(d.entries)) {
+			delete(d.ids, entry.digest)
+		}
+		d.ids[digest] = d.next
+	}
+	entry.operators, entry.digest = operators, digest
+	d.next++
+}
+
+// distance returns how far back the subtree with the digest was added, false if it is not in the dictionary
+func (d *witnessDictionary) distance(digest common.Hash) (uint64, bool) {
+	id, ok := d.ids[digest]
+	if !ok {
+		return 0, false
+	}
+	return d.next - 1 - id, true
+}
+
+func (d *witnessDictionary) get(distance uint64) ([]WitnessOperator, error) {
+	if distance >= d.next || distance >= uint64(len(d.entries)) {
+		return nil, fmt.Errorf("reference %d is outside of the dictionary", distance)
+	}
+	return d.entries[(d.next-1-distance)%uint64(len(d.entries))].operators, nil
+}
+
+// operatorArity is the number of the nodes the operator takes from the stack of the machine building the trie
+func operatorArity(op WitnessOperator) int {
+	switch o := op.(type) {
+	case *OperatorExtension:
+		return 1
+	case *OperatorBranch:
+		return bits.OnesCount32(o.Mask)
+	case *OperatorLeafAccount:
+		if o.HasCode && o.HasStorage {
+			return 2
+		}
+	}
+	return 0
+}
+
+// witnessSubtree is a node of the trie built by the witness, with the subtrees of its children
+type witnessSubtree struct {
+	children  []*witnessSubtree
+	operators []WitnessOperator // of the whole subtree, the ones of the node itself is the last one
+	encoding  []byte            // of the operators
+}
+
+// parseSubtrees splits the operators into the subtrees the roots of the witness are built from
+func parseSubtrees(operators []WitnessOperator) ([]*witnessSubtree, error) {
+	var stack []*witnessSubtree
+	for i, op := range operators {
+		n := operatorArity(op)
+		if n > len(stack) {
+			n = len(stack) // malformed witness, both ends split it the same way anyway
+		}
+		node := &witnessSubtree{children: append([]*witnessSubtree{}, stack[len(stack)-n:]...)}
+		start := i
+		for _, child := range node.children {
+			start -= len(child.operators)
+		}
+		node.operators = operators[start : i+1]
+		var buf bytes.Buffer
+		for _, child := range node.children {
+			buf.Write(child.encoding)
+		}
+		if err := op.WriteTo(NewOperatorMarshaller(&buf)); err != nil {
+			return nil, err
+		}
+		node.encoding = buf.Bytes()
+		stack = append(stack[:len(stack)-n], node)
+	}
+	return stack, nil
+}
+
+// CompressedWitnessWriter writes the witnesses of the consecutive blocks into a stream, deduplicating the subtrees
+// against the ones of the previous witnesses (and of the same one).
+type CompressedWitnessWriter struct {
+	out  *OperatorMarshaller
+	dict *witnessDictionary
+}
+
+// NewCompressedWitnessWriter creates the writer remembering the given number of the recent subtrees, the reader of
+// the stream has to be created with the same number.
+func NewCompressedWitnessWriter(out io.Writer, dictionarySize int) *CompressedWitnessWriter {
+	return &CompressedWitnessWriter{out: NewOperatorMarshaller(out), dict: newWitnessDictionary(dictionarySize, true)}
+}
+
+// Write writes the next witness of the stream. The returned stats are the cumulative ones of the stream.
+func (w *CompressedWitnessWriter) Write(witness *Witness) (*BlockWitnessStats, error) {
+	roots, err := parseSubtrees(witness.Operators)
+	if err != nil {
+		return nil, err
+	}
+	header := WitnessHeader{Version: CompressedWitnessVersion}
+	if err = header.WriteTo(w.out); err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		if err = w.writeSubtree(root); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.out.WriteOpCode(OpNewTrie); err != nil {
+		return nil, err
+	}
+	return w.out.GetStats(), nil
+}
+
+func (w *CompressedWitnessWriter) writeSubtree(node *witnessSubtree) error {
+	var digest common.Hash
+	if len(node.encoding) >= minDictionarySubtreeSize {
+		digest = crypto.Keccak256Hash(node.encoding)
+		if distance, ok := w.dict.distance(digest); ok {
+			if err := w.out.WriteOpCode(OpDictionaryRef); err != nil {
+				return err
+			}
+			return codec.NewEncoder(w.out.WithColumn(ColumnStructure), &cbor).Encode(distance)
+		}
+	}
+	for _, child := range node.children {
+		if err := w.writeSubtree(child); err != nil {
+			return err
+		}
+	}
+	if err := node.operators[len(node.operators)-1].WriteTo(w.out); err != nil {
+		return err
+	}
+	if len(node.encoding) >= minDictionarySubtreeSize {
+		w.dict.add(node.operators, digest)
+	}
+	return nil
+}
+
+// CompressedWitnessReader reads the witnesses written by CompressedWitnessWriter one by one, as they arrive.
+type CompressedWitnessReader struct {
+	input  io.Reader
+	loader *OperatorUnmarshaller
+	dict   *witnessDictionary
+}
+
+// NewCompressedWitnessReader creates the reader of the stream written with the given size of the dictionary.
+func NewCompressedWitnessReader(input io.Reader, dictionarySize int) *CompressedWitnessReader {
+	return &CompressedWitnessReader{input: input, loader: NewOperatorUnmarshaller(input), dict: newWitnessDictionary(dictionarySize, false)}
+}
+
+// decodedSubtree is the span of the operators of a node, with the size of their plain encoding
+type decodedSubtree struct {
+	start, size int
+}
+
+// Read reads the next witness of the stream with the references to the dictionary expanded, io.EOF at the end
+// of the stream.
+func (r *CompressedWitnessReader) Read() (*Witness, error) {
+	var header WitnessHeader
+	if err := header.LoadFrom(r.input); err != nil {
+		return nil, err
+	}
+	if header.Version != CompressedWitnessVersion {
+		return nil, fmt.Errorf("unexpected compressed witness version: expected %d, got %d", CompressedWitnessVersion, header.Version)
+	}
+
+	var operators []WitnessOperator
+	var stack []decodedSubtree
+	for {
+		opcode, err := r.loader.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch OperatorKindCode(opcode) {
+		case OpNewTrie:
+			return &Witness{Header: defaultWitnessHeader(), Operators: operators}, nil
+		case OpDictionaryRef:
+			distance, err := r.loader.ReadUInt64()
+			if err != nil {
+				return nil, err
+			}
+			subtree, err := r.dict.get(distance)
+			if err != nil {
+				return nil, err
+			}
+			// Only compared with the minimal size, which the referred subtree has at least
+			stack = append(stack, decodedSubtree{start: len(operators), size: minDictionarySubtreeSize})
+			operators = append(operators, subtree...)
+			continue
+		}
+
+		op := newWitnessOperator(OperatorKindCode(opcode))
+		if op == nil {
+			return nil, fmt.Errorf("unexpected opcode while reading compressed witness: %x", opcode)
+		}
+		if err = op.LoadFrom(r.loader); err != nil {
+			return nil, err
+		}
+		n := operatorArity(op)
+		if n > len(stack) {
+			n = len(stack)
+		}
+		node := decodedSubtree{start: len(operators)}
+		for _, child := range stack[len(stack)-n:] {
+			node.size += child.size
+		}
+		if n > 0 {
+			node.start = stack[len(stack)-n].start
+		}
+		size := NewOperatorMarshaller(ioutil.Discard)
+		if err = op.WriteTo(size); err != nil {
+			return nil, err
+		}
+		node.size += int(size.GetStats().BlockWitnessSize())
+		operators = append(operators, op)
+		if node.size >= minDictionarySubtreeSize {
+			r.dict.add(operators[node.start:], common.Hash{})
+		}
+		stack = append(stack[:len(stack)-n], node)
+	}
+}
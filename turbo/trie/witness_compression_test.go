@@ -0,0 +1,124 @@
+package trie
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+func TestCompressedWitnesses(t *testing.T) {
+	tr := New(common.Hash{})
+	keys := make([][]byte, 1000)
+	for i := range keys {
+		keys[i] = crypto.Keccak256([]byte{byte(i >> 8), byte(i)})
+		account := accounts.NewAccount()
+		account.Initialised = true
+		account.Nonce = uint64(i)
+		account.Balance.SetUint64(uint64(i) * 1000)
+		tr.UpdateAccount(keys[i], &account)
+	}
+	// The witnesses of the consecutive blocks, touching the overlapping sets of the accounts
+	var witnesses []*Witness
+	var roots []common.Hash
+	for block := 0; block < 4; block++ {
+		rl := NewRetainList(0)
+		for _, key := range keys[block*20 : block*20+50] {
+			rl.AddKey(key)
+		}
+		witness, err := tr.ExtractWitness(false, rl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		witnesses = append(witnesses, witness)
+		roots = append(roots, tr.Hash())
+
+		account := accounts.NewAccount()
+		account.Initialised = true
+		account.Nonce = uint64(block)
+		tr.UpdateAccount(keys[block*20], &account)
+	}
+	// The malformed one too, with the operators not forming a trie
+	witnesses = append(witnesses, NewWitness(generateOperands()), NewWitness(generateOperands()))
+
+	for _, size := range []int{DefaultWitnessDictionarySize, 4} {
+		var buf bytes.Buffer
+		writer := NewCompressedWitnessWriter(&buf, size)
+		var compressed, plain []uint64
+		for _, witness := range witnesses {
+			before := uint64(buf.Len())
+			if _, err := writer.Write(witness); err != nil {
+				t.Fatal(err)
+			}
+			compressed = append(compressed, uint64(buf.Len())-before)
+			stats, err := witness.WriteTo(ioutil.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain = append(plain, stats.BlockWitnessSize())
+		}
+		if size == DefaultWitnessDictionarySize {
+			for i := 1; i < 4; i++ {
+				if compressed[i]*2 > plain[i] {
+					t.Errorf("witness %d is expected to be at least halved, plain %d, compressed %d", i, plain[i], compressed[i])
+				}
+			}
+			if compressed[5] >= plain[5] {
+				t.Errorf("the repeated witness is expected to be compressed, plain %d, compressed %d", plain[5], compressed[5])
+			}
+		}
+
+		reader := NewCompressedWitnessReader(bytes.NewReader(buf.Bytes()), size)
+		for i, expected := range witnesses {
+			witness, err := reader.Read()
+			if err != nil {
+				t.Fatalf("dictionary size %d, witness %d: %v", size, i, err)
+			}
+			if !witnessesEqual(expected, witness) {
+				t.Fatalf("dictionary size %d, witness %d differs", size, i)
+			}
+			if i < len(roots) {
+				tr1, err := BuildTrieFromWitness(witness, false, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tr1.Hash() != roots[i] {
+					t.Errorf("dictionary size %d, witness %d: root %x, expected %x", size, i, tr1.Hash(), roots[i])
+				}
+			}
+		}
+		if _, err := reader.Read(); err != io.EOF {
+			t.Errorf("expected the end of the stream, got %v", err)
+		}
+
+		// The stream cut in the middle of a witness
+		reader = NewCompressedWitnessReader(bytes.NewReader(buf.Bytes()[:compressed[0]-1]), size)
+		if _, err := reader.Read(); err != io.ErrUnexpectedEOF {
+			t.Errorf("expected the unexpected end of the stream, got %v", err)
+		}
+	}
+
+	// The dictionary has to be the same on both ends
+	var buf bytes.Buffer
+	writer := NewCompressedWitnessWriter(&buf, DefaultWitnessDictionarySize)
+	for _, witness := range witnesses[:2] {
+		if _, err := writer.Write(witness); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := NewWitnessFromReader(bytes.NewReader(buf.Bytes()), false); err == nil {
+		t.Error("expected the compressed witness to be rejected as the plain one")
+	}
+	reader := NewCompressedWitnessReader(bytes.NewReader(buf.Bytes()), 1)
+	var err error
+	for i := 0; i < 2 && err == nil; i++ {
+		_, err = reader.Read()
+	}
+	if err == nil {
+		t.Error("expected the reference outside of the smaller dictionary to fail")
+	}
+}
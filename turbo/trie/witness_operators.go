@@ -37,6 +37,9 @@ const (
 
 	// OpNewTrie stops the processing, because another trie is encoded into the witness.
 	OpNewTrie = OperatorKindCode(0xBB)
+	// OpDictionaryRef has operand, which is the distance back to a subtree of the rolling dictionary of the compressed
+	// witnesses, and stands for the operators of that subtree.
+	OpDictionaryRef = OperatorKindCode(0xBC)
 )
 
 // WitnessOperator is a single operand in the block witness. It knows how to serialize/deserialize itself.
@@ -47,6 +50,27 @@ type WitnessOperator interface {
 	LoadFrom(*OperatorUnmarshaller) error
 }
 
+// newWitnessOperator creates the empty operator of the kind to load it, nil if the opcode is not of an operator
+func newWitnessOperator(opcode OperatorKindCode) WitnessOperator {
+	switch opcode {
+	case OpHash:
+		return &OperatorHash{}
+	case OpLeaf:
+		return &OperatorLeafValue{}
+	case OpAccountLeaf:
+		return &OperatorLeafAccount{}
+	case OpCode:
+		return &OperatorCode{}
+	case OpBranch:
+		return &OperatorBranch{}
+	case OpEmptyRoot:
+		return &OperatorEmptyRoot{}
+	case OpExtension:
+		return &OperatorExtension{}
+	}
+	return nil
+}
+
 type OperatorHash struct {
 	Hash common.Hash
 }
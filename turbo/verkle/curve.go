@@ -0,0 +1,205 @@
+package verkle
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Bandersnatch is the twisted Edwards curve a*x^2 + y^2 = 1 + d*x^2*y^2 over fp, a = -5.
+// The points are kept in the extended coordinates (X:Y:T:Z), x = X/Z, y = Y/Z, x*y = T/Z.
+// The commitments are the elements of Banderwagon, the prime order quotient group of the curve,
+// in which (x, y) and (-x, -y) are the same element.
+var (
+	curveA = *new(fp).neg(new(fp).setUint64(5))
+	curveD = computeD()
+	// rBig is the order of Banderwagon, the scalars of the commitments are reduced modulo it
+	rBig, _ = new(big.Int).SetString("1cfb69d4ca675f520cce760202687600ff8f87007419047174fd06b52876e7e1", 16)
+)
+
+func computeD() fp {
+	num, _ := new(big.Int).SetString("138827208126141220649022263972958607803", 10)
+	den, _ := new(big.Int).SetString("171449701953573178309673572579671231137", 10)
+	var n, d fp
+	n.setBig(num)
+	d.setBig(den)
+	return *n.mul(&n, d.inverse(&d))
+}
+
+// generator is the generator of Bandersnatch and Banderwagon, the inner products of the opening proofs are committed to
+// by its multiples
+func generator() point {
+	xb, _ := new(big.Int).SetString("29c132cc2c0b34c5743711777bbe42f32b79c022ad998465e1e71866a252ae18", 16)
+	yb, _ := new(big.Int).SetString("2a6c669eda123e0f157d8b50badcd586358cad81eee464605e3167b6cc974166", 16)
+	var g point
+	g.x.setBig(xb)
+	g.y.setBig(yb)
+	g.z = fpOne
+	g.t.mul(&g.x, &g.y)
+	return g
+}
+
+var errNotOnCurve = errors.New("not a Banderwagon element")
+
+type point struct {
+	x, y, t, z fp
+}
+
+func identity() point {
+	return point{y: fpOne, z: fpOne}
+}
+
+// add is the unified addition of the extended coordinates (add-2008-hwcd)
+func (p *point) add(p1, p2 *point) *point {
+	var a, b, c, d, e, f, g, h, t fp
+	a.mul(&p1.x, &p2.x)
+	b.mul(&p1.y, &p2.y)
+	c.mul(&p1.t, &p2.t)
+	c.mul(&c, &curveD)
+	d.mul(&p1.z, &p2.z)
+	e.add(&p1.x, &p1.y)
+	t.add(&p2.x, &p2.y)
+	e.mul(&e, &t)
+	e.sub(&e, &a)
+	e.sub(&e, &b)
+	f.sub(&d, &c)
+	g.add(&d, &c)
+	t.mul(&curveA, &a)
+	h.sub(&b, &t)
+	p.x.mul(&e, &f)
+	p.y.mul(&g, &h)
+	p.t.mul(&e, &h)
+	p.z.mul(&f, &g)
+	return p
+}
+
+// double is the doubling of the extended coordinates (dbl-2008-hwcd)
+func (p *point) double(p1 *point) *point {
+	var a, b, c, d, e, f, g, h fp
+	a.square(&p1.x)
+	b.square(&p1.y)
+	c.square(&p1.z)
+	c.add(&c, &c)
+	d.mul(&curveA, &a)
+	e.add(&p1.x, &p1.y)
+	e.square(&e)
+	e.sub(&e, &a)
+	e.sub(&e, &b)
+	g.add(&d, &b)
+	f.sub(&g, &c)
+	h.sub(&d, &b)
+	p.x.mul(&e, &f)
+	p.y.mul(&g, &h)
+	p.t.mul(&e, &h)
+	p.z.mul(&f, &g)
+	return p
+}
+
+func (p *point) neg(p1 *point) *point {
+	p.x.neg(&p1.x)
+	p.y = p1.y
+	p.t.neg(&p1.t)
+	p.z = p1.z
+	return p
+}
+
+func (p *point) sub(p1, p2 *point) *point {
+	var n point
+	n.neg(p2)
+	return p.add(p1, &n)
+}
+
+// scalarMul sets p to s*p1, s is reduced modulo the group order
+func (p *point) scalarMul(p1 *point, s *big.Int) *point {
+	k := s
+	if k.Sign() < 0 || k.Cmp(rBig) >= 0 {
+		k = new(big.Int).Mod(s, rBig)
+	}
+	res := identity()
+	base := *p1
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		res.double(&res)
+		if k.Bit(i) == 1 {
+			res.add(&res, &base)
+		}
+	}
+	*p = res
+	return p
+}
+
+// equal compares Banderwagon elements: (x1, y1) ~ (x2, y2) iff x1*y2 == x2*y1
+func (p *point) equal(p1 *point) bool {
+	var l, r fp
+	l.mul(&p.x, &p1.y)
+	r.mul(&p1.x, &p.y)
+	return l.equal(&r)
+}
+
+func (p *point) affine() (x, y fp) {
+	var zInv fp
+	zInv.inverse(&p.z)
+	x.mul(&p.x, &zInv)
+	y.mul(&p.y, &zInv)
+	return x, y
+}
+
+// bytes serializes the element as the big-endian x of its representative with the lexicographically largest y
+func (p *point) bytes() [32]byte {
+	x, y := p.affine()
+	if !y.lexicographicallyLargest() {
+		x.neg(&x)
+	}
+	var out [32]byte
+	x.big().FillBytes(out[:])
+	return out
+}
+
+// setBytes deserializes the element, checking that it is on the curve and in the subgroup
+func (p *point) setBytes(b []byte) error {
+	if len(b) != 32 {
+		return errNotOnCurve
+	}
+	xb := new(big.Int).SetBytes(b)
+	if xb.Cmp(pBig) >= 0 {
+		return errNotOnCurve
+	}
+	var x, y fp
+	x.setBig(xb)
+	if !y.yFromX(&x) {
+		return errNotOnCurve
+	}
+	if !y.lexicographicallyLargest() {
+		y.neg(&y)
+	}
+	p.x, p.y, p.z = x, y, fpOne
+	p.t.mul(&x, &y)
+	return nil
+}
+
+// yFromX sets z to a y of the point with the given x, false if x is not the x of a Banderwagon element
+func (z *fp) yFromX(x *fp) bool {
+	var x2, num, den, t fp
+	x2.square(x)
+	// 1 - a*x^2 must be a square for the point to be in the subgroup
+	t.mul(&curveA, &x2)
+	num.sub(&fpOne, &t)
+	if !new(fp).sqrt(&num) {
+		return false
+	}
+	t.mul(&curveD, &x2)
+	den.sub(&fpOne, &t)
+	if den.isZero() {
+		return false
+	}
+	den.inverse(&den)
+	num.mul(&num, &den)
+	return z.sqrt(&num)
+}
+
+// mapToScalar maps the element to the scalar x/y, which is the same for both representatives,
+// the children are committed to by their scalars
+func (p *point) mapToScalar() *big.Int {
+	var yInv, s fp
+	yInv.inverse(&p.y)
+	s.mul(&p.x, &yInv)
+	return s.big().Mod(s.big(), rBig)
+}
@@ -0,0 +1,193 @@
+package verkle
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// fp is an element of the base field of Bandersnatch (the scalar field of BLS12-381) in the Montgomery form,
+// the limbs are little-endian
+type fp [4]uint64
+
+var (
+	// pBig is the modulus of the base field
+	pBig, _ = new(big.Int).SetString("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001", 16)
+	p       = limbs(pBig)
+	pInvNeg = computePInvNeg()                                                    // -p^-1 mod 2^64
+	r2      = limbs(new(big.Int).Mod(new(big.Int).Lsh(big.NewInt(1), 512), pBig)) // 2^512 mod p, converts into the Montgomery form
+	fpOne   = limbs(new(big.Int).Mod(new(big.Int).Lsh(big.NewInt(1), 256), pBig)) // 1 in the Montgomery form
+)
+
+func computePInvNeg() uint64 {
+	two64 := new(big.Int).Lsh(big.NewInt(1), 64)
+	inv := new(big.Int).ModInverse(new(big.Int).Mod(pBig, two64), two64)
+	return new(big.Int).Sub(two64, inv).Uint64()
+}
+
+// limbs splits x < 2^256 into the little-endian limbs, without the conversion into the Montgomery form
+func limbs(x *big.Int) fp {
+	var b [32]byte
+	x.FillBytes(b[:])
+	var z fp
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			z[i] |= uint64(b[31-i*8-j]) << (8 * j)
+		}
+	}
+	return z
+}
+
+func (z *fp) setBig(x *big.Int) *fp {
+	l := limbs(new(big.Int).Mod(x, pBig))
+	return z.mul(&l, &r2)
+}
+
+func (z *fp) setUint64(x uint64) *fp {
+	l := fp{x}
+	return z.mul(&l, &r2)
+}
+
+func (z *fp) big() *big.Int {
+	var l fp
+	l.mul(z, &fp{1})
+	var b [32]byte
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 8; j++ {
+			b[31-i*8-j] = byte(l[i] >> (8 * j))
+		}
+	}
+	return new(big.Int).SetBytes(b[:])
+}
+
+func (z *fp) isZero() bool {
+	return z[0]|z[1]|z[2]|z[3] == 0
+}
+
+func (z *fp) equal(x *fp) bool {
+	return *z == *x
+}
+
+func (z *fp) add(x, y *fp) *fp {
+	var c uint64
+	z[0], c = bits.Add64(x[0], y[0], 0)
+	z[1], c = bits.Add64(x[1], y[1], c)
+	z[2], c = bits.Add64(x[2], y[2], c)
+	z[3], _ = bits.Add64(x[3], y[3], c)
+	// p < 2^255, so the sum doesn't overflow
+	return z.reduce()
+}
+
+func (z *fp) sub(x, y *fp) *fp {
+	var b uint64
+	z[0], b = bits.Sub64(x[0], y[0], 0)
+	z[1], b = bits.Sub64(x[1], y[1], b)
+	z[2], b = bits.Sub64(x[2], y[2], b)
+	z[3], b = bits.Sub64(x[3], y[3], b)
+	if b != 0 {
+		var c uint64
+		z[0], c = bits.Add64(z[0], p[0], 0)
+		z[1], c = bits.Add64(z[1], p[1], c)
+		z[2], c = bits.Add64(z[2], p[2], c)
+		z[3], _ = bits.Add64(z[3], p[3], c)
+	}
+	return z
+}
+
+func (z *fp) neg(x *fp) *fp {
+	var zero fp
+	return z.sub(&zero, x)
+}
+
+// reduce subtracts p if z >= p
+func (z *fp) reduce() *fp {
+	var t fp
+	var b uint64
+	t[0], b = bits.Sub64(z[0], p[0], 0)
+	t[1], b = bits.Sub64(z[1], p[1], b)
+	t[2], b = bits.Sub64(z[2], p[2], b)
+	t[3], b = bits.Sub64(z[3], p[3], b)
+	if b == 0 {
+		*z = t
+	}
+	return z
+}
+
+// mul is the Montgomery multiplication (CIOS)
+func (z *fp) mul(x, y *fp) *fp {
+	var t [6]uint64
+	var c, c1, hi, lo uint64
+	for i := 0; i < 4; i++ {
+		c = 0
+		for j := 0; j < 4; j++ {
+			hi, lo = bits.Mul64(x[j], y[i])
+			lo, c1 = bits.Add64(lo, t[j], 0)
+			hi += c1
+			lo, c1 = bits.Add64(lo, c, 0)
+			hi += c1
+			t[j], c = lo, hi
+		}
+		t[4], c1 = bits.Add64(t[4], c, 0)
+		t[5] = c1
+
+		m := t[0] * pInvNeg
+		hi, lo = bits.Mul64(m, p[0])
+		_, c1 = bits.Add64(lo, t[0], 0)
+		c = hi + c1
+		for j := 1; j < 4; j++ {
+			hi, lo = bits.Mul64(m, p[j])
+			lo, c1 = bits.Add64(lo, t[j], 0)
+			hi += c1
+			lo, c1 = bits.Add64(lo, c, 0)
+			hi += c1
+			t[j-1], c = lo, hi
+		}
+		t[3], c1 = bits.Add64(t[4], c, 0)
+		t[4] = t[5] + c1
+	}
+	*z = fp{t[0], t[1], t[2], t[3]}
+	if t[4] != 0 {
+		var b uint64
+		z[0], b = bits.Sub64(z[0], p[0], 0)
+		z[1], b = bits.Sub64(z[1], p[1], b)
+		z[2], b = bits.Sub64(z[2], p[2], b)
+		z[3], _ = bits.Sub64(z[3], p[3], b)
+		return z
+	}
+	return z.reduce()
+}
+
+func (z *fp) square(x *fp) *fp {
+	return z.mul(x, x)
+}
+
+// inverse sets z to 1/x by the Fermat's little theorem, the inverse of 0 is 0
+func (z *fp) inverse(x *fp) *fp {
+	e := new(big.Int).Sub(pBig, big.NewInt(2))
+	res := fpOne
+	base := *x
+	for i := 0; i < e.BitLen(); i++ {
+		if e.Bit(i) == 1 {
+			res.mul(&res, &base)
+		}
+		base.square(&base)
+	}
+	*z = res
+	return z
+}
+
+// sqrt sets z to a square root of x, false if there is none
+func (z *fp) sqrt(x *fp) bool {
+	root := new(big.Int).ModSqrt(x.big(), pBig)
+	if root == nil {
+		return false
+	}
+	z.setBig(root)
+	return true
+}
+
+// lexicographicallyLargest is whether x > (p-1)/2, which tells x and -x apart
+func (z *fp) lexicographicallyLargest() bool {
+	return z.big().Cmp(pHalf) > 0
+}
+
+var pHalf = new(big.Int).Rsh(pBig, 1)
@@ -0,0 +1,385 @@
+package verkle
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// ipaRounds is log2(NodeWidth), each round of the inner product argument halves the vectors
+const ipaRounds = 8
+
+var errInvalidProof = errors.New("invalid verkle proof")
+
+// transcript is the Fiat-Shamir transcript the challenges of the proofs are drawn from, in the format of go-ipa:
+// the labels precede the appended values, the scalars are little-endian
+type transcript struct {
+	buf []byte
+}
+
+func newTranscript(label string) *transcript {
+	return &transcript{buf: []byte(label)}
+}
+
+func (t *transcript) domainSep(label string) {
+	t.buf = append(t.buf, label...)
+}
+
+func (t *transcript) appendPoint(label string, p *point) {
+	b := p.bytes()
+	t.buf = append(t.buf, label...)
+	t.buf = append(t.buf, b[:]...)
+}
+
+func (t *transcript) appendScalar(label string, s *big.Int) {
+	b := scalarBytes(s)
+	t.buf = append(t.buf, label...)
+	t.buf = append(t.buf, b[:]...)
+}
+
+// challenge draws the scalar from everything appended so far, the transcript continues from the challenge
+func (t *transcript) challenge(label string) *big.Int {
+	t.buf = append(t.buf, label...)
+	h := sha256.Sum256(t.buf)
+	c := new(big.Int).Mod(leToInt(h[:]), rBig)
+	t.buf = t.buf[:0]
+	t.appendScalar(label, c)
+	return c
+}
+
+// scalarBytes serializes the scalar little-endian
+func scalarBytes(s *big.Int) [32]byte {
+	var b [32]byte
+	new(big.Int).Mod(s, rBig).FillBytes(b[:])
+	for i := 0; i < 16; i++ {
+		b[i], b[31-i] = b[31-i], b[i]
+	}
+	return b
+}
+
+func frMul(a, b *big.Int) *big.Int {
+	z := new(big.Int).Mul(a, b)
+	return z.Mod(z, rBig)
+}
+
+func frAdd(a, b *big.Int) *big.Int {
+	z := new(big.Int).Add(a, b)
+	return z.Mod(z, rBig)
+}
+
+func frSub(a, b *big.Int) *big.Int {
+	z := new(big.Int).Sub(a, b)
+	return z.Mod(z, rBig)
+}
+
+func frInv(a *big.Int) *big.Int {
+	return new(big.Int).ModInverse(a, rBig)
+}
+
+func innerProduct(a, b []*big.Int) *big.Int {
+	res := new(big.Int)
+	for i := range a {
+		if a[i] != nil && b[i] != nil {
+			res.Add(res, new(big.Int).Mul(a[i], b[i]))
+		}
+	}
+	return res.Mod(res, rBig)
+}
+
+// The vectors are the evaluations of the polynomials on the domain 0..255
+var (
+	domainOnce sync.Once
+	aPrime     []*big.Int // A'(i) of A(X) = prod(X - i)
+	aPrimeInv  []*big.Int
+	diffInv    []*big.Int // 1/d of the differences d in -255..255 (shifted by 255), 1/0 is nil
+)
+
+func domain() {
+	domainOnce.Do(func() {
+		aPrime = make([]*big.Int, NodeWidth)
+		aPrimeInv = make([]*big.Int, NodeWidth)
+		for i := 0; i < NodeWidth; i++ {
+			p := big.NewInt(1)
+			for j := 0; j < NodeWidth; j++ {
+				if j != i {
+					p = frMul(p, new(big.Int).Mod(big.NewInt(int64(i-j)), rBig))
+				}
+			}
+			aPrime[i], aPrimeInv[i] = p, frInv(p)
+		}
+		diffInv = make([]*big.Int, 2*NodeWidth-1)
+		for d := -(NodeWidth - 1); d < NodeWidth; d++ {
+			if d != 0 {
+				diffInv[d+NodeWidth-1] = frInv(new(big.Int).Mod(big.NewInt(int64(d)), rBig))
+			}
+		}
+	})
+}
+
+func invDiff(d int) *big.Int {
+	return diffInv[d+NodeWidth-1]
+}
+
+// quotient is (f(X) - f(z)) / (X - z) in the evaluation form, for the point z of the domain
+func quotient(f []*big.Int, z int) []*big.Int {
+	domain()
+	q := make([]*big.Int, NodeWidth)
+	qz := new(big.Int)
+	for j := 0; j < NodeWidth; j++ {
+		if j == z {
+			continue
+		}
+		q[j] = frMul(frSub(f[j], f[z]), invDiff(j-z))
+		// q(z) = f'(z) = -sum(q(j) * A'(z) / A'(j))
+		qz.Sub(qz, frMul(q[j], frMul(aPrime[z], aPrimeInv[j])))
+	}
+	q[z] = qz.Mod(qz, rBig)
+	return q
+}
+
+// lagrangeAt are the Lagrange basis polynomials of the domain evaluated at t outside of it,
+// L_i(t) = A(t) / (A'(i) * (t - i)), so that f(t) = <f, lagrangeAt(t)>
+func lagrangeAt(t *big.Int) ([]*big.Int, error) {
+	domain()
+	at := big.NewInt(1)
+	diffs := make([]*big.Int, NodeWidth)
+	for i := 0; i < NodeWidth; i++ {
+		diffs[i] = frSub(t, big.NewInt(int64(i)))
+		if diffs[i].Sign() == 0 {
+			return nil, errInvalidProof
+		}
+		at = frMul(at, diffs[i])
+	}
+	b := make([]*big.Int, NodeWidth)
+	for i := 0; i < NodeWidth; i++ {
+		b[i] = frMul(at, frMul(aPrimeInv[i], frInv(diffs[i])))
+	}
+	return b, nil
+}
+
+// ipaProof is the inner product argument that the vector a committed by c has <a, b> = y for the Lagrange
+// basis b at the point z outside of the domain, so that y is the value of the polynomial at z
+type ipaProof struct {
+	l, r [ipaRounds]point
+	a    *big.Int
+}
+
+// ipaStart appends the claim to the transcript and returns the generator of the inner products scaled by
+// the challenge drawn from it
+func ipaStart(tr *transcript, c *point, z, y *big.Int) point {
+	tr.domainSep("ipa")
+	tr.appendPoint("C", c)
+	tr.appendScalar("input point", z)
+	tr.appendScalar("output point", y)
+	w := tr.challenge("w")
+	var q point
+	q.scalarMul(&crsQ, w)
+	return q
+}
+
+func proveIPA(tr *transcript, c *point, a []*big.Int, z *big.Int) (ipaProof, error) {
+	b, err := lagrangeAt(z)
+	if err != nil {
+		return ipaProof{}, err
+	}
+	g := append([]point{}, crs()...)
+	a = append([]*big.Int{}, a...)
+	q := ipaStart(tr, c, z, innerProduct(a, b))
+	var proof ipaProof
+	var t point
+	for round := 0; round < ipaRounds; round++ {
+		n := len(a) / 2
+		aL, aR, bL, bR, gL, gR := a[:n], a[n:], b[:n], b[n:], g[:n], g[n:]
+		l := msm(gL, aR)
+		l.add(&l, t.scalarMul(&q, innerProduct(aR, bL)))
+		r := msm(gR, aL)
+		r.add(&r, t.scalarMul(&q, innerProduct(aL, bR)))
+		tr.appendPoint("L", &l)
+		tr.appendPoint("R", &r)
+		x := tr.challenge("x")
+		xInv := frInv(x)
+		proof.l[round], proof.r[round] = l, r
+		for i := 0; i < n; i++ {
+			aL[i] = frAdd(orZero(aL[i]), frMul(orZero(aR[i]), x))
+			bL[i] = frAdd(orZero(bL[i]), frMul(orZero(bR[i]), xInv))
+			gL[i].add(&gL[i], t.scalarMul(&gR[i], xInv))
+		}
+		a, b, g = aL, bL, gL
+	}
+	proof.a = orZero(a[0])
+	return proof, nil
+}
+
+// verifyIPA checks the proof that the polynomial committed by c has the value y at z
+func verifyIPA(tr *transcript, c *point, z, y *big.Int, proof *ipaProof) bool {
+	b, err := lagrangeAt(z)
+	if err != nil {
+		return false
+	}
+	q := ipaStart(tr, c, z, y)
+	var t point
+	acc := *c
+	acc.add(&acc, t.scalarMul(&q, y))
+	xs := make([]*big.Int, ipaRounds)
+	for round := 0; round < ipaRounds; round++ {
+		tr.appendPoint("L", &proof.l[round])
+		tr.appendPoint("R", &proof.r[round])
+		x := tr.challenge("x")
+		if x.Sign() == 0 {
+			return false
+		}
+		xs[round] = x
+		acc.add(&acc, t.scalarMul(&proof.l[round], x))
+		acc.add(&acc, t.scalarMul(&proof.r[round], frInv(x)))
+	}
+	// The folded generator and b are the vectors weighted by the products of the inverses of the challenges
+	// of the rounds whose upper half the index is in
+	s := make([]*big.Int, NodeWidth)
+	for i := 0; i < NodeWidth; i++ {
+		s[i] = big.NewInt(1)
+		for round := 0; round < ipaRounds; round++ {
+			if i&(1<<(ipaRounds-1-round)) != 0 {
+				s[i] = frMul(s[i], frInv(xs[round]))
+			}
+		}
+	}
+	g0 := msm(crs(), s)
+	b0 := innerProduct(s, b)
+	var expected point
+	expected.scalarMul(&g0, proof.a)
+	expected.add(&expected, t.scalarMul(&q, frMul(proof.a, b0)))
+	return acc.equal(&expected)
+}
+
+func orZero(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return x
+}
+
+// opening is the claim that the vector committed by c has the value y at the index z,
+// the prover also knows the vector f
+type opening struct {
+	c *point
+	f []*big.Int
+	z int
+	y *big.Int
+}
+
+// multiProof proves a batch of the openings at once: the openings are combined by the powers of the random r into
+// g(X) = sum(r^i * (f_i(X) - y_i) / (X - z_i)), which is a polynomial only if all of them hold, and the committed
+// D = [g] is checked at the random t outside of the domain by the inner product argument of [h] - D,
+// h(X) = sum(r^i * f_i(X) / (t - z_i)), whose value at t the verifier computes from the y_i alone
+type multiProof struct {
+	d   point
+	ipa ipaProof
+}
+
+func proveMulti(tr *transcript, openings []opening) (*multiProof, error) {
+	tr.domainSep("multiproof")
+	for _, o := range openings {
+		appendOpening(tr, &o)
+	}
+	r := tr.challenge("r")
+	// The openings at the same z share the quotient
+	powers := rPowers(r, len(openings))
+	byZ := make(map[int][]*big.Int)
+	for i, o := range openings {
+		agg, ok := byZ[o.z]
+		if !ok {
+			agg = make([]*big.Int, NodeWidth)
+			for j := range agg {
+				agg[j] = new(big.Int)
+			}
+			byZ[o.z] = agg
+		}
+		for j := 0; j < NodeWidth; j++ {
+			if o.f[j] != nil && o.f[j].Sign() != 0 {
+				agg[j] = frAdd(agg[j], frMul(powers[i], o.f[j]))
+			}
+		}
+	}
+	g := make([]*big.Int, NodeWidth)
+	for j := range g {
+		g[j] = new(big.Int)
+	}
+	for z, agg := range byZ {
+		for j, q := range quotient(agg, z) {
+			g[j] = frAdd(g[j], q)
+		}
+	}
+	proof := &multiProof{d: commit(g)}
+	tr.appendPoint("D", &proof.d)
+	t := tr.challenge("t")
+	h := make([]*big.Int, NodeWidth)
+	for j := range h {
+		h[j] = new(big.Int)
+	}
+	for z, agg := range byZ {
+		tz := frSub(t, big.NewInt(int64(z)))
+		if tz.Sign() == 0 {
+			return nil, errInvalidProof
+		}
+		inv := frInv(tz)
+		for j := 0; j < NodeWidth; j++ {
+			h[j] = frAdd(h[j], frMul(agg[j], inv))
+		}
+	}
+	e := commit(h)
+	tr.appendPoint("E", &e)
+	e.sub(&e, &proof.d)
+	hMinusG := make([]*big.Int, NodeWidth)
+	for j := range hMinusG {
+		hMinusG[j] = frSub(h[j], g[j])
+	}
+	var err error
+	if proof.ipa, err = proveIPA(tr, &e, hMinusG, t); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+func verifyMulti(tr *transcript, openings []opening, proof *multiProof) bool {
+	tr.domainSep("multiproof")
+	for _, o := range openings {
+		appendOpening(tr, &o)
+	}
+	r := tr.challenge("r")
+	tr.appendPoint("D", &proof.d)
+	t := tr.challenge("t")
+	powers := rPowers(r, len(openings))
+	points := make([]point, len(openings))
+	coeffs := make([]*big.Int, len(openings))
+	y := new(big.Int)
+	for i, o := range openings {
+		tz := frSub(t, big.NewInt(int64(o.z)))
+		if tz.Sign() == 0 {
+			return false
+		}
+		coeffs[i] = frMul(powers[i], frInv(tz))
+		points[i] = *o.c
+		y = frAdd(y, frMul(coeffs[i], o.y))
+	}
+	e := msm(points, coeffs)
+	tr.appendPoint("E", &e)
+	e.sub(&e, &proof.d)
+	return verifyIPA(tr, &e, t, y, &proof.ipa)
+}
+
+func appendOpening(tr *transcript, o *opening) {
+	tr.appendPoint("C", o.c)
+	tr.appendScalar("z", big.NewInt(int64(o.z)))
+	tr.appendScalar("y", o.y)
+}
+
+func rPowers(r *big.Int, n int) []*big.Int {
+	powers := make([]*big.Int, n)
+	p := big.NewInt(1)
+	for i := range powers {
+		powers[i] = p
+		p = frMul(p, r)
+	}
+	return powers
+}
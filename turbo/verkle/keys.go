@@ -0,0 +1,176 @@
+package verkle
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// The layout of the accounts in the tree: the header of the account, the first storage slots and the first code
+// chunks share the stem of the tree index 0, the rest of the storage and the code is spread over the other stems
+const (
+	VersionLeafKey    = 0
+	BalanceLeafKey    = 1
+	NonceLeafKey      = 2
+	CodeKeccakLeafKey = 3
+	CodeSizeLeafKey   = 4
+
+	headerStorageOffset = 64
+	codeOffset          = 128
+	codeChunkSize       = 31
+)
+
+// mainStorageOffset is 256^31, the storage slots past the header ones start at it
+var mainStorageOffset = new(big.Int).Lsh(big.NewInt(1), 8*StemSize)
+
+type stemID struct {
+	address   common.Address
+	treeIndex common.Hash
+}
+
+// TreeKey is the key of the value of the account at the sub index of the tree index:
+// the first 31 bytes of the Pedersen hash of the address and the tree index, followed by the sub index
+func TreeKey(address common.Address, treeIndex *big.Int, subIndex byte) []byte {
+	var input [64]byte
+	copy(input[12:32], address[:])
+	var idx [32]byte
+	treeIndex.FillBytes(idx[:])
+	for i := 0; i < 32; i++ {
+		input[32+i] = idx[31-i]
+	}
+	h := pedersenHash(input[:])
+	key := make([]byte, KeySize)
+	copy(key, h[:StemSize])
+	key[StemSize] = subIndex
+	return key
+}
+
+// treeKey is TreeKey memoizing the stems of the tree
+func (t *Tree) treeKey(address common.Address, treeIndex *big.Int, subIndex byte) []byte {
+	id := stemID{address: address}
+	treeIndex.FillBytes(id.treeIndex[:])
+	stem, ok := t.stems[id]
+	if !ok {
+		copy(stem[:], TreeKey(address, treeIndex, subIndex))
+		t.stems[id] = stem
+	}
+	key := make([]byte, KeySize)
+	copy(key, stem[:])
+	key[StemSize] = subIndex
+	return key
+}
+
+func (t *Tree) headerKey(address common.Address, leafKey byte) []byte {
+	return t.treeKey(address, new(big.Int), leafKey)
+}
+
+// StorageKey is the tree key of the storage slot of the account
+func (t *Tree) StorageKey(address common.Address, slot common.Hash) []byte {
+	pos := new(big.Int).SetBytes(slot[:])
+	if pos.Cmp(big.NewInt(codeOffset-headerStorageOffset)) < 0 {
+		pos.Add(pos, big.NewInt(headerStorageOffset))
+	} else {
+		pos.Add(pos, mainStorageOffset)
+	}
+	subIndex := new(big.Int).Mod(pos, big.NewInt(NodeWidth))
+	return t.treeKey(address, new(big.Int).Rsh(pos, 8), byte(subIndex.Uint64()))
+}
+
+// CodeChunkKey is the tree key of the code chunk of the account
+func (t *Tree) CodeChunkKey(address common.Address, chunk uint64) []byte {
+	pos := codeOffset + chunk
+	return t.treeKey(address, new(big.Int).SetUint64(pos/NodeWidth), byte(pos%NodeWidth))
+}
+
+// AccountKeys are the tree keys of the header of the account
+func (t *Tree) AccountKeys(address common.Address) [][]byte {
+	return [][]byte{
+		t.headerKey(address, VersionLeafKey),
+		t.headerKey(address, BalanceLeafKey),
+		t.headerKey(address, NonceLeafKey),
+		t.headerKey(address, CodeKeccakLeafKey),
+		t.headerKey(address, CodeSizeLeafKey),
+	}
+}
+
+// UpdateAccount sets the header of the account, the balance, the nonce and the code size are little-endian
+func (t *Tree) UpdateAccount(address common.Address, nonce uint64, balance *uint256.Int, codeHash common.Hash, codeSize int) {
+	var v [32]byte
+	t.Insert(t.headerKey(address, VersionLeafKey), v[:])
+	b := balance.Bytes32()
+	for i := 0; i < 32; i++ {
+		v[i] = b[31-i]
+	}
+	t.Insert(t.headerKey(address, BalanceLeafKey), v[:])
+	v = [32]byte{}
+	binary.LittleEndian.PutUint64(v[:], nonce)
+	t.Insert(t.headerKey(address, NonceLeafKey), v[:])
+	t.Insert(t.headerKey(address, CodeKeccakLeafKey), codeHash[:])
+	v = [32]byte{}
+	binary.LittleEndian.PutUint64(v[:], uint64(codeSize))
+	t.Insert(t.headerKey(address, CodeSizeLeafKey), v[:])
+}
+
+// DeleteAccount removes the header and the code of the account
+func (t *Tree) DeleteAccount(address common.Address) {
+	chunks := (t.codeSize(address) + codeChunkSize - 1) / codeChunkSize
+	for _, k := range t.AccountKeys(address) {
+		t.Delete(k)
+	}
+	for i := 0; i < chunks; i++ {
+		t.Delete(t.CodeChunkKey(address, uint64(i)))
+	}
+}
+
+func (t *Tree) codeSize(address common.Address) int {
+	v := t.Get(t.headerKey(address, CodeSizeLeafKey))
+	if v == nil {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint64(v))
+}
+
+// UpdateCode sets the code chunks of the account
+func (t *Tree) UpdateCode(address common.Address, code []byte) {
+	for i, chunk := range ChunkifyCode(code) {
+		t.Insert(t.CodeChunkKey(address, uint64(i)), chunk[:])
+	}
+}
+
+// UpdateStorage sets the storage slot of the account to the big-endian value, the empty value removes it
+func (t *Tree) UpdateStorage(address common.Address, slot common.Hash, value []byte) {
+	key := t.StorageKey(address, slot)
+	if len(value) == 0 {
+		t.Delete(key)
+		return
+	}
+	var v common.Hash
+	v.SetBytes(value)
+	t.Insert(key, v[:])
+}
+
+// ChunkifyCode splits the code into the chunks of 31 bytes, each prefixed by the number of the leading bytes
+// of the chunk which are the data of a PUSH started in a previous chunk
+func ChunkifyCode(code []byte) [][32]byte {
+	chunks := make([][32]byte, (len(code)+codeChunkSize-1)/codeChunkSize)
+	pushData := 0 // bytes of the data of the current PUSH left
+	for i, b := range code {
+		if i%codeChunkSize == 0 {
+			if pushData < codeChunkSize {
+				chunks[i/codeChunkSize][0] = byte(pushData)
+			} else {
+				chunks[i/codeChunkSize][0] = codeChunkSize
+			}
+		}
+		chunks[i/codeChunkSize][1+i%codeChunkSize] = b
+		if pushData > 0 {
+			pushData--
+		} else if op := vm.OpCode(b); op >= vm.PUSH1 && op <= vm.PUSH32 {
+			pushData = int(op-vm.PUSH1) + 1
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,88 @@
+package verkle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"sync"
+)
+
+// NodeWidth is the number of the children of the internal nodes and of the values of the leaves
+const NodeWidth = 256
+
+// crsSeed is the seed the generators of the commitments are derived from
+const crsSeed = "eth_verkle_oct_2021"
+
+var (
+	crsOnce sync.Once
+	crsG    []point // the generators of the vector commitments
+	crsQ    point   // the generator of the inner products in the opening proofs
+)
+
+// crs derives the generators by hashing the seed with an increasing counter, the hashes are reduced modulo p
+// and those which are the x of a Banderwagon element become generators, until there are enough of them.
+// The generators are the ones of go-ipa, and so of the other implementations of the verkle trees.
+func crs() []point {
+	crsOnce.Do(func() {
+		points := make([]point, 0, NodeWidth)
+		var buf [len(crsSeed) + 8]byte
+		copy(buf[:], crsSeed)
+		for counter := uint64(0); len(points) < NodeWidth; counter++ {
+			binary.BigEndian.PutUint64(buf[len(crsSeed):], counter)
+			h := sha256.Sum256(buf[:])
+			var x, y fp
+			x.setBig(new(big.Int).SetBytes(h[:]))
+			if !y.yFromX(&x) {
+				continue
+			}
+			if !y.lexicographicallyLargest() {
+				y.neg(&y)
+			}
+			p := point{x: x, y: y, z: fpOne}
+			p.t.mul(&x, &y)
+			points = append(points, p)
+		}
+		crsG, crsQ = points, generator()
+	})
+	return crsG
+}
+
+// commit is the Pedersen commitment of the vector of scalars, sum(values[i] * G[i]), the nil values are zeros
+func commit(values []*big.Int) point {
+	return msm(crs(), values)
+}
+
+// msm is the multi-scalar multiplication sum(scalars[i] * points[i])
+func msm(points []point, scalars []*big.Int) point {
+	res := identity()
+	var t point
+	for i, s := range scalars {
+		if s == nil || s.Sign() == 0 {
+			continue
+		}
+		res.add(&res, t.scalarMul(&points[i], s))
+	}
+	return res
+}
+
+// pedersenHash hashes up to 255*16 bytes by committing to their 16-byte little-endian chunks,
+// prefixed by the domain separator 2 + 256*len(input)
+func pedersenHash(input []byte) [32]byte {
+	scalars := make([]*big.Int, 1+(len(input)+15)/16)
+	scalars[0] = big.NewInt(int64(2 + 256*len(input)))
+	for i := 0; i*16 < len(input); i++ {
+		var chunk [16]byte
+		copy(chunk[:], input[i*16:])
+		scalars[i+1] = leToInt(chunk[:])
+	}
+	c := commit(scalars)
+	return c.bytes()
+}
+
+func leToInt(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
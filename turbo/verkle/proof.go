@@ -0,0 +1,344 @@
+package verkle
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// proofLabel starts the transcript of the proofs, as in go-verkle
+const proofLabel = "vt"
+
+// Proof is the witness of the values of a set of keys, present or absent, in the tree with the given root:
+// the commitments on the paths of their stems and a single multiproof opening all of them
+type Proof struct {
+	Keys   [][]byte
+	Values [][]byte // nil for the absent keys
+	stems  []stemProof
+	multi  *multiProof
+}
+
+// stemProof is the path of the stem from the root: the commitments of the internal nodes below the root,
+// and of the leaf the path ends in, if any. The leaf is of the stem or, when the stem is absent, of another
+// stem sharing the path.
+type stemProof struct {
+	stem     [StemSize]byte
+	path     []point
+	leaf     *point
+	leafStem [StemSize]byte
+	c1, c2   *point // the commitments of the halves of the values holding the queried suffixes
+	suffixes []byte
+}
+
+// Prove builds the proof of the values of the keys in the current tree
+func (t *Tree) Prove(keys [][]byte) (*Proof, error) {
+	keys = append([][]byte{}, keys...)
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	p := &Proof{}
+	var openings []opening
+	seen := make(map[string]struct{})
+	add := func(o opening) {
+		id := openingID(o.c, o.z, o.y)
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		openings = append(openings, o)
+	}
+	for i := 0; i < len(keys); {
+		if len(keys[i]) != KeySize {
+			return nil, fmt.Errorf("verkle key of size %d", len(keys[i]))
+		}
+		// The keys of the same stem
+		j := i
+		var suffixes []byte
+		for ; j < len(keys) && bytes.Equal(keys[j][:StemSize], keys[i][:StemSize]); j++ {
+			if j > i && keys[j][StemSize] == keys[j-1][StemSize] {
+				continue
+			}
+			suffixes = append(suffixes, keys[j][StemSize])
+			p.Keys = append(p.Keys, common.CopyBytes(keys[j]))
+			p.Values = append(p.Values, common.CopyBytes(t.Get(keys[j])))
+		}
+		sp := stemProof{suffixes: suffixes}
+		copy(sp.stem[:], keys[i][:StemSize])
+		n := t.root
+		for depth := 0; ; depth++ {
+			f := n.scalars()
+			idx := int(sp.stem[depth])
+			add(opening{c: n.commitment(), f: f, z: idx, y: orZero(f[idx])})
+			child, ok := n.children[idx].(*internalNode)
+			if !ok {
+				break
+			}
+			sp.path = append(sp.path, *child.commitment())
+			n = child
+		}
+		if leaf, ok := n.children[sp.stem[len(sp.path)]].(*leafNode); ok {
+			sp.leaf = leaf.commitment()
+			sp.leafStem = leaf.stem
+			f := leaf.scalars()
+			add(opening{c: sp.leaf, f: f, z: 0, y: f[0]})
+			add(opening{c: sp.leaf, f: f, z: 1, y: f[1]})
+			if leaf.stem == sp.stem {
+				c1, c2 := leaf.suffixCommitments()
+				for _, s := range suffixes {
+					c, half := c1, 0
+					if s >= NodeWidth/2 {
+						c, half = c2, 1
+					}
+					if half == 0 {
+						sp.c1 = c1
+					} else {
+						sp.c2 = c2
+					}
+					add(opening{c: sp.leaf, f: f, z: 2 + half, y: f[2+half]})
+					vf := leaf.suffixScalars(half)
+					idx := 2 * (int(s) % (NodeWidth / 2))
+					add(opening{c: c, f: vf, z: idx, y: vf[idx]})
+					add(opening{c: c, f: vf, z: idx + 1, y: vf[idx+1]})
+				}
+			}
+		}
+		p.stems = append(p.stems, sp)
+		i = j
+	}
+	multi, err := proveMulti(newTranscript(proofLabel), openings)
+	if err != nil {
+		return nil, err
+	}
+	p.multi = multi
+	return p, nil
+}
+
+// Verify checks the proof against the root hash of the tree
+func (p *Proof) Verify(root common.Hash) error {
+	var rootC point
+	if err := rootC.setBytes(root[:]); err != nil {
+		return err
+	}
+	if len(p.Keys) != len(p.Values) {
+		return errInvalidProof
+	}
+	values := make(map[string][]byte, len(p.Keys))
+	for i, k := range p.Keys {
+		if len(k) != KeySize || (p.Values[i] != nil && len(p.Values[i]) != 32) {
+			return errInvalidProof
+		}
+		values[string(k)] = p.Values[i]
+	}
+	var openings []opening
+	seen := make(map[string]struct{})
+	add := func(c *point, z int, y *big.Int) {
+		id := openingID(c, z, y)
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		openings = append(openings, opening{c: c, z: z, y: y})
+	}
+	proven := make(map[string]struct{}, len(p.Keys))
+	for i := range p.stems {
+		sp := &p.stems[i]
+		if len(sp.path) >= StemSize {
+			return errInvalidProof
+		}
+		parent := &rootC
+		for depth := range sp.path {
+			add(parent, int(sp.stem[depth]), sp.path[depth].mapToScalar())
+			parent = &sp.path[depth]
+		}
+		depth := len(sp.path)
+		if sp.leaf == nil {
+			add(parent, int(sp.stem[depth]), new(big.Int))
+		} else {
+			add(parent, int(sp.stem[depth]), sp.leaf.mapToScalar())
+			add(sp.leaf, 0, big.NewInt(1))
+			add(sp.leaf, 1, leToInt(sp.leafStem[:]))
+			if !bytes.Equal(sp.leafStem[:depth+1], sp.stem[:depth+1]) {
+				return errInvalidProof
+			}
+		}
+		for _, s := range sp.suffixes {
+			key := append(append([]byte{}, sp.stem[:]...), s)
+			v, ok := values[string(key)]
+			if !ok {
+				return errInvalidProof
+			}
+			proven[string(key)] = struct{}{}
+			if sp.leaf == nil || sp.leafStem != sp.stem {
+				if v != nil {
+					return errInvalidProof
+				}
+				continue
+			}
+			c, half := sp.c1, 0
+			if s >= NodeWidth/2 {
+				c, half = sp.c2, 1
+			}
+			if c == nil {
+				return errInvalidProof
+			}
+			add(sp.leaf, 2+half, c.mapToScalar())
+			lo, hi := valueScalars(v)
+			idx := 2 * (int(s) % (NodeWidth / 2))
+			add(c, idx, lo)
+			add(c, idx+1, hi)
+		}
+	}
+	if len(proven) != len(values) {
+		return errInvalidProof
+	}
+	if p.multi == nil || !verifyMulti(newTranscript(proofLabel), openings, p.multi) {
+		return errInvalidProof
+	}
+	return nil
+}
+
+// openingID identifies the openings shared by the paths, the conflicting claims of the same opening
+// are kept apart, so the proof can't satisfy only one of them
+func openingID(c *point, z int, y *big.Int) string {
+	b := c.bytes()
+	var yb [32]byte
+	y.FillBytes(yb[:])
+	return string(b[:]) + string([]byte{byte(z)}) + string(yb[:])
+}
+
+type proofRLP struct {
+	Keys   [][]byte
+	Values [][]byte
+	Stems  []stemRLP
+	D      []byte
+	L, R   [][]byte
+	A      []byte
+}
+
+type stemRLP struct {
+	Stem     []byte
+	Suffixes []byte
+	Path     [][]byte
+	Leaf     []byte
+	LeafStem []byte
+	C1, C2   []byte
+}
+
+// Encode serializes the proof
+func (p *Proof) Encode(out io.Writer) error {
+	enc := proofRLP{Keys: p.Keys, Values: make([][]byte, len(p.Values))}
+	for i, v := range p.Values {
+		if v == nil {
+			v = []byte{}
+		}
+		enc.Values[i] = v
+	}
+	for _, sp := range p.stems {
+		s := stemRLP{Stem: common.CopyBytes(sp.stem[:]), Suffixes: sp.suffixes}
+		for i := range sp.path {
+			s.Path = append(s.Path, pointBytes(&sp.path[i]))
+		}
+		if sp.leaf != nil {
+			s.Leaf, s.LeafStem = pointBytes(sp.leaf), common.CopyBytes(sp.leafStem[:])
+		}
+		if sp.c1 != nil {
+			s.C1 = pointBytes(sp.c1)
+		}
+		if sp.c2 != nil {
+			s.C2 = pointBytes(sp.c2)
+		}
+		enc.Stems = append(enc.Stems, s)
+	}
+	enc.D = pointBytes(&p.multi.d)
+	for i := 0; i < ipaRounds; i++ {
+		enc.L = append(enc.L, pointBytes(&p.multi.ipa.l[i]))
+		enc.R = append(enc.R, pointBytes(&p.multi.ipa.r[i]))
+	}
+	a := scalarBytes(p.multi.ipa.a)
+	enc.A = a[:]
+	return rlp.Encode(out, &enc)
+}
+
+// NewProofFromReader deserializes the proof, the commitments are checked to be Banderwagon elements
+func NewProofFromReader(input io.Reader) (*Proof, error) {
+	var dec proofRLP
+	if err := rlp.Decode(input, &dec); err != nil {
+		return nil, err
+	}
+	if len(dec.Keys) != len(dec.Values) || len(dec.L) != ipaRounds || len(dec.R) != ipaRounds || len(dec.A) != 32 {
+		return nil, errInvalidProof
+	}
+	p := &Proof{Keys: dec.Keys, Values: make([][]byte, len(dec.Values)), multi: &multiProof{}}
+	for i, v := range dec.Values {
+		if len(v) > 0 {
+			p.Values[i] = v
+		}
+	}
+	for _, s := range dec.Stems {
+		var sp stemProof
+		if len(s.Stem) != StemSize {
+			return nil, errInvalidProof
+		}
+		copy(sp.stem[:], s.Stem)
+		sp.suffixes = s.Suffixes
+		sp.path = make([]point, len(s.Path))
+		for i, b := range s.Path {
+			if err := sp.path[i].setBytes(b); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		if len(s.Leaf) > 0 {
+			if len(s.LeafStem) != StemSize {
+				return nil, errInvalidProof
+			}
+			if sp.leaf, err = parsePoint(s.Leaf); err != nil {
+				return nil, err
+			}
+			copy(sp.leafStem[:], s.LeafStem)
+		}
+		if len(s.C1) > 0 {
+			if sp.c1, err = parsePoint(s.C1); err != nil {
+				return nil, err
+			}
+		}
+		if len(s.C2) > 0 {
+			if sp.c2, err = parsePoint(s.C2); err != nil {
+				return nil, err
+			}
+		}
+		p.stems = append(p.stems, sp)
+	}
+	if err := p.multi.d.setBytes(dec.D); err != nil {
+		return nil, err
+	}
+	for i := 0; i < ipaRounds; i++ {
+		if err := p.multi.ipa.l[i].setBytes(dec.L[i]); err != nil {
+			return nil, err
+		}
+		if err := p.multi.ipa.r[i].setBytes(dec.R[i]); err != nil {
+			return nil, err
+		}
+	}
+	p.multi.ipa.a = leToInt(dec.A)
+	if p.multi.ipa.a.Cmp(rBig) >= 0 {
+		return nil, errInvalidProof
+	}
+	return p, nil
+}
+
+func pointBytes(p *point) []byte {
+	b := p.bytes()
+	return b[:]
+}
+
+func parsePoint(b []byte) (*point, error) {
+	var p point
+	if err := p.setBytes(b); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,63 @@
+package verkle
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProof(t *testing.T) {
+	tree := NewTree()
+	for i := 0; i < 4; i++ {
+		address := common.BytesToAddress([]byte{byte(i + 1)})
+		tree.UpdateAccount(address, uint64(i), uint256.NewInt().SetUint64(uint64(i)*1000), common.Hash{}, 0)
+		tree.UpdateStorage(address, common.HexToHash("0x01"), []byte{byte(i + 1)})
+		tree.UpdateStorage(address, common.HexToHash("0x1000"), []byte{byte(i + 1)})
+	}
+	root := tree.Root()
+
+	present := common.BytesToAddress([]byte{2})
+	absent := common.BytesToAddress([]byte{0xff})
+	keys := append(tree.AccountKeys(present), tree.AccountKeys(absent)...)
+	keys = append(keys,
+		tree.StorageKey(present, common.HexToHash("0x1000")),
+		tree.StorageKey(present, common.HexToHash("0x2000")), // absent slot of a present account
+		tree.StorageKey(present, common.HexToHash("0x02")),   // absent slot of the header stem
+	)
+	proof, err := tree.Prove(keys)
+	require.NoError(t, err)
+	require.Len(t, proof.Keys, len(keys))
+
+	var buf bytes.Buffer
+	require.NoError(t, proof.Encode(&buf))
+	decoded, err := NewProofFromReader(&buf)
+	require.NoError(t, err)
+	require.NoError(t, decoded.Verify(root))
+
+	values := make(map[string][]byte)
+	for i, k := range decoded.Keys {
+		values[string(k)] = decoded.Values[i]
+	}
+	assert.Equal(t, tree.Get(keys[NonceLeafKey]), values[string(keys[NonceLeafKey])])
+	for _, k := range tree.AccountKeys(absent) {
+		assert.Nil(t, values[string(k)])
+	}
+	assert.Equal(t, common.HexToHash("0x02").Bytes(), values[string(tree.StorageKey(present, common.HexToHash("0x1000")))])
+	assert.Nil(t, values[string(tree.StorageKey(present, common.HexToHash("0x2000")))])
+	assert.Nil(t, values[string(tree.StorageKey(present, common.HexToHash("0x02")))])
+
+	// A forged value or a stale root doesn't verify
+	for i, k := range decoded.Keys {
+		if bytes.Equal(k, keys[NonceLeafKey]) {
+			decoded.Values[i] = common.HexToHash("0x07").Bytes()
+		}
+	}
+	assert.Error(t, decoded.Verify(root))
+	tree.UpdateStorage(present, common.HexToHash("0x01"), []byte{0x42})
+	assert.Error(t, proof.Verify(tree.Root()))
+	assert.NoError(t, proof.Verify(root))
+}
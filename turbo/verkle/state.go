@@ -0,0 +1,129 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// BuildTree loads the latest state of the plain state into the tree. The tree keys are derived from the plain
+// addresses and storage locations, so unlike the hexary trie it isn't built from the hashed state.
+func BuildTree(tx ethdb.Tx, quit <-chan struct{}) (*Tree, error) {
+	t := NewTree()
+	c := tx.Cursor(dbutils.PlainStateBucket)
+	defer c.Close()
+	var address common.Address
+	var incarnation uint64
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if err = common.Stopped(quit); err != nil {
+			return nil, err
+		}
+		if len(k) == common.AddressLength {
+			var acc accounts.Account
+			if err = acc.DecodeForStorage(v); err != nil {
+				return nil, fmt.Errorf("decoding account %x: %w", k, err)
+			}
+			copy(address[:], k)
+			incarnation = acc.Incarnation
+			var code []byte
+			if !acc.IsEmptyCodeHash() {
+				if code, err = tx.GetOne(dbutils.CodeBucket, acc.CodeHash[:]); err != nil {
+					return nil, err
+				}
+			}
+			t.UpdateAccount(address, acc.Nonce, &acc.Balance, acc.CodeHash, len(code))
+			t.UpdateCode(address, code)
+			continue
+		}
+		// Storage of the old incarnations can still be in the plain state
+		if len(v) == 0 || !bytes.Equal(k[:common.AddressLength], address[:]) ||
+			binary.BigEndian.Uint64(k[common.AddressLength:]) != incarnation {
+			continue
+		}
+		t.UpdateStorage(address, common.BytesToHash(k[common.AddressLength+common.IncarnationLength:]), v)
+	}
+	return t, nil
+}
+
+// ComputeRoot is the root of the verkle tree of the latest state
+func ComputeRoot(tx ethdb.Tx, quit <-chan struct{}) (common.Hash, error) {
+	t, err := BuildTree(tx, quit)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return t.Root(), nil
+}
+
+// RewindTree reverts the tree of the latest state to the state before the block by the changesets of the block
+// and of the blocks after it, the earliest change of each key holds its value before the block
+func RewindTree(db ethdb.Database, t *Tree, blockNum uint64) error {
+	seen := make(map[string]struct{})
+	if err := changeset.Walk(db, dbutils.PlainAccountChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 0, func(_ uint64, k, v []byte) (bool, error) {
+		if _, ok := seen[string(k)]; ok {
+			return true, nil
+		}
+		seen[string(k)] = struct{}{}
+		return true, t.revertAccount(db, common.BytesToAddress(k), v)
+	}); err != nil {
+		return err
+	}
+	// The tree has no incarnations, the storage of the accounts is keyed by the address alone
+	seen = make(map[string]struct{})
+	return changeset.Walk(db, dbutils.PlainStorageChangeSetBucket, dbutils.EncodeBlockNumber(blockNum), 0, func(_ uint64, k, v []byte) (bool, error) {
+		address, _, location := dbutils.PlainParseCompositeStorageKey(k)
+		id := string(address[:]) + string(location[:])
+		if _, ok := seen[id]; ok {
+			return true, nil
+		}
+		seen[id] = struct{}{}
+		t.UpdateStorage(address, location, v)
+		return true, nil
+	})
+}
+
+// revertAccount sets the account to its encoded previous value, empty if it didn't exist
+func (t *Tree) revertAccount(db ethdb.Database, address common.Address, enc []byte) error {
+	if len(enc) == 0 {
+		t.DeleteAccount(address)
+		return nil
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return fmt.Errorf("decoding account %x: %w", address, err)
+	}
+	// The changesets omit the code hashes of the contracts
+	if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+		codeHash, err := db.Get(dbutils.PlainContractCodeBucket, dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation))
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		if err == nil {
+			copy(acc.CodeHash[:], codeHash)
+		}
+	}
+	var code []byte
+	if !acc.IsEmptyCodeHash() {
+		var err error
+		if code, err = db.Get(dbutils.CodeBucket, acc.CodeHash[:]); err != nil {
+			return fmt.Errorf("code of account %x: %w", address, err)
+		}
+	}
+	// The chunks of the code the account has now which the previous one didn't have
+	chunks := len(ChunkifyCode(code))
+	for i := chunks; i < (t.codeSize(address)+codeChunkSize-1)/codeChunkSize; i++ {
+		t.Delete(t.CodeChunkKey(address, uint64(i)))
+	}
+	t.UpdateAccount(address, acc.Nonce, &acc.Balance, acc.CodeHash, len(code))
+	t.UpdateCode(address, code)
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package verkle implements the verkle tree of Pedersen commitments over Bandersnatch, with the IPA multiproofs as
+// the witnesses, the experimental alternative to the hexary Merkle Patricia trie for the devnets selecting it by
+// the stateCommitment of the chain config
+package verkle
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+const (
+	// KeySize is the size of the tree keys, the stem followed by the suffix
+	KeySize = 32
+	// StemSize is the size of the stems, the keys sharing a stem are the values of the same leaf
+	StemSize = 31
+)
+
+var two128 = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// Tree is the in-memory verkle tree: the internal nodes have 256 children indexed by the bytes of the stems,
+// the leaves hold up to 256 values of the keys sharing their stem. The leaves are placed at the shallowest depth
+// their stem is unique at. The commitments are computed lazily and cached until the subtree changes.
+type Tree struct {
+	root  *internalNode
+	stems map[stemID][StemSize]byte // cache of the stems of the keys of the accounts
+}
+
+type node interface {
+	commitment() *point
+}
+
+type internalNode struct {
+	children [NodeWidth]node // nil, *internalNode or *leafNode
+	comm     *point
+}
+
+type leafNode struct {
+	stem   [StemSize]byte
+	values [NodeWidth][]byte // nil when absent, 32 bytes otherwise
+	c1, c2 *point            // commitments of the values 0..127 and 128..255
+	comm   *point
+}
+
+func NewTree() *Tree {
+	return &Tree{root: &internalNode{}, stems: make(map[stemID][StemSize]byte)}
+}
+
+// Root is the root hash of the tree, the serialized commitment of the root node
+func (t *Tree) Root() common.Hash {
+	c := t.root.commitment()
+	return c.bytes()
+}
+
+// Get returns the value of the key, nil if it is absent
+func (t *Tree) Get(key []byte) []byte {
+	n := t.root
+	for depth := 0; depth < StemSize; depth++ {
+		switch child := n.children[key[depth]].(type) {
+		case nil:
+			return nil
+		case *leafNode:
+			if !bytes.Equal(child.stem[:], key[:StemSize]) {
+				return nil
+			}
+			return child.values[key[StemSize]]
+		case *internalNode:
+			n = child
+		}
+	}
+	return nil
+}
+
+// Insert sets the value of the key, the value must be 32 bytes
+func (t *Tree) Insert(key []byte, value []byte) {
+	v := make([]byte, 32)
+	copy(v, value)
+	n := t.root
+	for depth := 0; depth < StemSize; depth++ {
+		n.comm = nil
+		idx := key[depth]
+		switch child := n.children[idx].(type) {
+		case nil:
+			leaf := &leafNode{}
+			copy(leaf.stem[:], key[:StemSize])
+			leaf.values[key[StemSize]] = v
+			n.children[idx] = leaf
+			return
+		case *leafNode:
+			if bytes.Equal(child.stem[:], key[:StemSize]) {
+				child.values[key[StemSize]] = v
+				child.c1, child.c2, child.comm = nil, nil, nil
+				return
+			}
+			// Push the leaf down until the stems diverge
+			next := &internalNode{}
+			next.children[child.stem[depth+1]] = child
+			n.children[idx] = next
+			n = next
+		case *internalNode:
+			n = child
+		}
+	}
+}
+
+// Delete makes the key absent, the leaves left without values are removed and the internal nodes left with
+// a single leaf are replaced by it, so the shape of the tree doesn't depend on the order of the updates
+func (t *Tree) Delete(key []byte) {
+	t.root.delete(key, 0)
+}
+
+func (n *internalNode) delete(key []byte, depth int) bool {
+	idx := key[depth]
+	switch child := n.children[idx].(type) {
+	case nil:
+		return false
+	case *leafNode:
+		if !bytes.Equal(child.stem[:], key[:StemSize]) || child.values[key[StemSize]] == nil {
+			return false
+		}
+		child.values[key[StemSize]] = nil
+		child.c1, child.c2, child.comm = nil, nil, nil
+		if child.empty() {
+			n.children[idx] = nil
+		}
+	case *internalNode:
+		if !child.delete(key, depth+1) {
+			return false
+		}
+		if only := child.onlyChild(); only != nil {
+			if leaf, ok := only.(*leafNode); ok {
+				n.children[idx] = leaf
+			}
+		} else if child.empty() {
+			n.children[idx] = nil
+		}
+	}
+	n.comm = nil
+	return true
+}
+
+func (l *leafNode) empty() bool {
+	for _, v := range l.values {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *internalNode) empty() bool {
+	for _, c := range n.children {
+		if c != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyChild returns the child of the node which has exactly one, nil otherwise
+func (n *internalNode) onlyChild() node {
+	var only node
+	for _, c := range n.children {
+		if c == nil {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = c
+	}
+	return only
+}
+
+func (n *internalNode) scalars() []*big.Int {
+	scalars := make([]*big.Int, NodeWidth)
+	for i, c := range n.children {
+		if c != nil {
+			scalars[i] = c.commitment().mapToScalar()
+		}
+	}
+	return scalars
+}
+
+func (n *internalNode) commitment() *point {
+	if n.comm == nil {
+		c := commit(n.scalars())
+		n.comm = &c
+	}
+	return n.comm
+}
+
+// scalars are the committed vector of the leaf: the marker 1, the stem and the commitments of the values
+func (l *leafNode) scalars() []*big.Int {
+	c1, c2 := l.suffixCommitments()
+	scalars := make([]*big.Int, NodeWidth)
+	scalars[0], scalars[1], scalars[2], scalars[3] = big.NewInt(1), leToInt(l.stem[:]), c1.mapToScalar(), c2.mapToScalar()
+	return scalars
+}
+
+func (l *leafNode) commitment() *point {
+	if l.comm == nil {
+		c := commit(l.scalars())
+		l.comm = &c
+	}
+	return l.comm
+}
+
+func (l *leafNode) suffixCommitments() (*point, *point) {
+	if l.c1 == nil {
+		c1, c2 := commit(l.suffixScalars(0)), commit(l.suffixScalars(1))
+		l.c1, l.c2 = &c1, &c2
+	}
+	return l.c1, l.c2
+}
+
+// suffixScalars are the committed vector of the half of the values: each value is split into its lower
+// and upper 16 bytes, the lower one is marked by 2^128 to tell the present zero values from the absent ones
+func (l *leafNode) suffixScalars(half int) []*big.Int {
+	scalars := make([]*big.Int, NodeWidth)
+	for i := 0; i < NodeWidth/2; i++ {
+		lo, hi := valueScalars(l.values[half*NodeWidth/2+i])
+		scalars[2*i], scalars[2*i+1] = lo, hi
+	}
+	return scalars
+}
+
+func valueScalars(v []byte) (lo, hi *big.Int) {
+	if v == nil {
+		return new(big.Int), new(big.Int)
+	}
+	lo = leToInt(v[:16])
+	lo.Add(lo, two128)
+	return lo, leToInt(v[16:])
+}
@@ -0,0 +1,102 @@
+package verkle
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupOrder(t *testing.T) {
+	for _, g := range crs()[:4] {
+		g := g
+		var p point
+		p.scalarMul(&g, new(big.Int).Sub(rBig, big.NewInt(1)))
+		p.add(&p, &g)
+		id := identity()
+		assert.True(t, p.equal(&id))
+
+		var q point
+		b := g.bytes()
+		require.NoError(t, q.setBytes(b[:]))
+		assert.True(t, q.equal(&g))
+	}
+}
+
+func testKey(stem byte, depth int, suffix byte) []byte {
+	key := make([]byte, KeySize)
+	key[0] = stem
+	key[depth] = stem
+	key[StemSize] = suffix
+	return key
+}
+
+func TestTreeShapeIndependentOfOrder(t *testing.T) {
+	value := common.HexToHash("0x01").Bytes()
+	keys := [][]byte{testKey(1, 0, 0), testKey(1, 2, 5), testKey(2, 0, 7), testKey(1, 2, 200)}
+
+	t1 := NewTree()
+	for _, k := range keys {
+		t1.Insert(k, value)
+	}
+	t2 := NewTree()
+	for i := len(keys) - 1; i >= 0; i-- {
+		t2.Insert(keys[i], value)
+	}
+	assert.Equal(t, t1.Root(), t2.Root())
+	assert.Equal(t, value, t1.Get(keys[1]))
+	assert.Nil(t, t1.Get(testKey(1, 2, 6)))
+
+	// Deleting the keys of the stem pushed down lifts the other leaf back
+	t3 := NewTree()
+	t3.Insert(keys[0], value)
+	t3.Insert(keys[2], value)
+	t1.Delete(keys[1])
+	assert.NotEqual(t, t3.Root(), t1.Root())
+	t1.Delete(keys[3])
+	assert.Equal(t, t3.Root(), t1.Root())
+
+	t1.Delete(keys[0])
+	t1.Delete(keys[2])
+	assert.Equal(t, common.Hash{}, t1.Root())
+}
+
+func TestAccountLayout(t *testing.T) {
+	tree := NewTree()
+	address := common.HexToAddress("0x1234")
+	tree.UpdateAccount(address, 3, uint256.NewInt().SetUint64(1000), common.HexToHash("0xc0de"), 40)
+	keys := tree.AccountKeys(address)
+	for _, k := range keys[1:] {
+		// The header shares the stem
+		assert.Equal(t, keys[0][:StemSize], k[:StemSize])
+	}
+	assert.Equal(t, []byte{0xe8, 0x03}, tree.Get(keys[BalanceLeafKey])[:2])
+	assert.Equal(t, byte(3), tree.Get(keys[NonceLeafKey])[0])
+
+	// The first storage slots are in the header stem, the rest are not
+	assert.Equal(t, keys[0][:StemSize], tree.StorageKey(address, common.HexToHash("0x3f"))[:StemSize])
+	assert.Equal(t, byte(headerStorageOffset+0x3f), tree.StorageKey(address, common.HexToHash("0x3f"))[StemSize])
+	assert.NotEqual(t, keys[0][:StemSize], tree.StorageKey(address, common.HexToHash("0x40"))[:StemSize])
+	assert.Equal(t, TreeKey(address, new(big.Int), CodeSizeLeafKey), keys[CodeSizeLeafKey])
+
+	tree.UpdateStorage(address, common.HexToHash("0x01"), []byte{0x05})
+	assert.Equal(t, common.HexToHash("0x05").Bytes(), tree.Get(tree.StorageKey(address, common.HexToHash("0x01"))))
+	tree.UpdateStorage(address, common.HexToHash("0x01"), nil)
+	assert.Nil(t, tree.Get(tree.StorageKey(address, common.HexToHash("0x01"))))
+}
+
+func TestChunkifyCode(t *testing.T) {
+	code := make([]byte, 70)
+	code[29] = byte(vm.PUSH4) // the data spills over into the second chunk by 3 bytes
+	code[40] = byte(vm.PUSH32)
+	chunks := ChunkifyCode(code)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, byte(0), chunks[0][0])
+	assert.Equal(t, byte(3), chunks[1][0])
+	assert.Equal(t, byte(11), chunks[2][0])
+	assert.Equal(t, code[31:62], chunks[1][1:])
+}
@@ -0,0 +1,165 @@
+package verkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The vectors are the ones of crate-crypto/go-ipa, which go-verkle and the other implementations are checked against
+
+func pointHex(p *point) string {
+	b := p.bytes()
+	return hex.EncodeToString(b[:])
+}
+
+func scalarHex(s *big.Int) string {
+	b := scalarBytes(s)
+	return hex.EncodeToString(b[:])
+}
+
+// testPoly is the vector 1..32 repeated up to the width, or 32..1 when reversed
+func testPoly(reversed bool) []*big.Int {
+	f := make([]*big.Int, NodeWidth)
+	for i := range f {
+		if reversed {
+			f[i] = big.NewInt(int64(32 - i%32))
+		} else {
+			f[i] = big.NewInt(int64(i%32 + 1))
+		}
+	}
+	return f
+}
+
+// bytes serializes the proof as go-ipa does: D, the L and R of the rounds and the final scalar
+func (p *multiProof) bytes() []byte {
+	out := make([]byte, 0, 32*(2+2*ipaRounds))
+	d := p.d.bytes()
+	out = append(out, d[:]...)
+	for i := range p.ipa.l {
+		l := p.ipa.l[i].bytes()
+		out = append(out, l[:]...)
+	}
+	for i := range p.ipa.r {
+		r := p.ipa.r[i].bytes()
+		out = append(out, r[:]...)
+	}
+	a := scalarBytes(p.ipa.a)
+	return append(out, a[:]...)
+}
+
+func TestCRSVectors(t *testing.T) {
+	g := crs()
+	require.Len(t, g, NodeWidth)
+	assert.Equal(t, "01587ad1336675eb912550ec2a28eb8923b824b490dd2ba82e48f14590a298a0", pointHex(&g[0]))
+	assert.Equal(t, "3de2be346b539395b0c0de56a5ccca54a317f1b5c80107b0802af9a62276a4d8", pointHex(&g[NodeWidth-1]))
+	h := sha256.New()
+	for i := range g {
+		b := g[i].bytes()
+		h.Write(b[:])
+	}
+	assert.Equal(t, "1fcaea10bf24f750200e06fa473c76ff0468007291fa548e2d99f09ba9256fdb", hex.EncodeToString(h.Sum(nil)))
+}
+
+func TestEncodingVectors(t *testing.T) {
+	expected := []string{
+		"4a2c7486fd924882bf02c6908de395122843e3e05264d7991e18e7985dad51e9",
+		"43aa74ef706605705989e8fd38df46873b7eae5921fbed115ac9d937399ce4d5",
+		"5e5f550494159f38aa54d2ed7f11a7e93e4968617990445cc93ac8e59808c126",
+		"0e7e3748db7c5c999a7bcd93d71d671f1f40090423792266f94cb27ca43fce5c",
+		"14ddaa48820cb6523b9ae5fe9fe257cbbd1f3d598a28e670a40da5d1159d864a",
+		"6989d1c82b2d05c74b62fb0fbdf8843adae62ff720d370e209a7b84e14548a7d",
+		"26b8df6fa414bf348a3dc780ea53b70303ce49f3369212dec6fbe4b349b832bf",
+		"37e46072db18f038f2cc7d3d5b5d1374c0eb86ca46f869d6a95fc2fb092c0d35",
+		"2c1ce64f26e1c772282a6633fac7ca73067ae820637ce348bb2c8477d228dc7d",
+		"297ab0f5a8336a7a4e2657ad7a33a66e360fb6e50812d4be3326fab73d6cee07",
+		"5b285811efa7a965bd6ef5632151ebf399115fcc8f5b9b8083415ce533cc39ce",
+		"1f939fa2fd457b3effb82b25d3fe8ab965f54015f108f8c09d67e696294ab626",
+		"3088dcb4d3f4bacd706487648b239e0be3072ed2059d981fe04ce6525af6f1b8",
+		"35fbc386a16d0227ff8673bc3760ad6b11009f749bb82d4facaea67f58fc60ed",
+		"00f29b4f3255e318438f0a31e058e4c081085426adb0479f14c64985d0b956e0",
+		"3fa4384b2fa0ecc3c0582223602921daaa893a97b64bdf94dcaa504e8b7b9e5f",
+	}
+	p := generator()
+	for _, e := range expected {
+		assert.Equal(t, e, pointHex(&p))
+		b, err := hex.DecodeString(e)
+		require.NoError(t, err)
+		var q point
+		require.NoError(t, q.setBytes(b))
+		assert.True(t, q.equal(&p))
+		p.double(&p)
+	}
+}
+
+func TestTranscriptVectors(t *testing.T) {
+	tr := newTranscript("simple_protocol")
+	c1 := tr.challenge("simple_challenge")
+	assert.Equal(t, "c2aa02607cbdf5595f00ee0dd94a2bbff0bed6a2bf8452ada9011eadb538d003", scalarHex(c1))
+	assert.NotEqual(t, c1, tr.challenge("simple_challenge"))
+
+	tr = newTranscript("simple_protocol")
+	tr.appendScalar("five", big.NewInt(5))
+	tr.appendScalar("five again", big.NewInt(5))
+	assert.Equal(t, "498732b694a8ae1622d4a9347535be589e4aee6999ffc0181d13fe9e4d037b0b", scalarHex(tr.challenge("simple_challenge")))
+
+	minusOne := new(big.Int).Sub(rBig, big.NewInt(1))
+	tr = newTranscript("simple_protocol")
+	tr.appendScalar("-1", minusOne)
+	tr.domainSep("separate me")
+	tr.appendScalar("-1 again", minusOne)
+	tr.domainSep("separate me again")
+	tr.appendScalar("now 1", big.NewInt(1))
+	assert.Equal(t, "14f59938e9e9b1389e74311a464f45d3d88d8ac96adf1c1129ac466de088d618", scalarHex(tr.challenge("simple_challenge")))
+
+	g := generator()
+	tr = newTranscript("simple_protocol")
+	tr.appendPoint("generator", &g)
+	assert.Equal(t, "8c2dafe7c0aabfa9ed542bb2cbf0568399ae794fc44fdfd7dff6cc0e6144921c", scalarHex(tr.challenge("simple_challenge")))
+}
+
+func TestIPAVector(t *testing.T) {
+	f := testPoly(false)
+	z := big.NewInt(2101)
+	c := commit(f)
+	assert.Equal(t, "1b9dff8f5ebbac250d291dfe90e36283a227c64b113c37f1bfb9e7a743cdb128", pointHex(&c))
+
+	prover := newTranscript("test")
+	proof, err := proveIPA(prover, &c, f, z)
+	require.NoError(t, err)
+	b, err := lagrangeAt(z)
+	require.NoError(t, err)
+	y := innerProduct(f, b)
+	assert.Equal(t, "4a353e70b03c89f161de002e8713beec0d740a5e20722fd5bd68b30540a33208", scalarHex(y))
+	challenge := prover.challenge("state")
+	assert.Equal(t, "0a81881cbfd7d7197a54ebd67ed6a68b5867f3c783706675b34ece43e85e7306", scalarHex(challenge))
+
+	verifier := newTranscript("test")
+	require.True(t, verifyIPA(verifier, &c, z, y, &proof))
+	assert.Equal(t, challenge, verifier.challenge("state"))
+
+	// The multiproof serialization without D is the one of the inner product argument
+	enc := (&multiProof{ipa: proof}).bytes()[32:]
+	assert.Equal(t, "273395a8febdaed38e94c3d874e99c911a47dd84616d54c55021d5c4131b507e46a4ec2c7e82b77ec2f533994c91ca7edaef212c666a1169b29c323eabb0cf690e0146638d0e2d543f81da4bd597bf3013e1663f340a8f87b845495598d0a3951590b6417f868edaeb3424ff174901d1185a53a3ee127fb7be0af42dda44bf992885bde279ef821a298087717ef3f2b78b2ede7f5d2ea1b60a4195de86a530eb247fd7e456012ae9a070c61635e55d1b7a340dfab8dae991d6273d099d9552815434cc1ba7bcdae341cf7928c6f25102370bdf4b26aad3af654d9dff4b3735661db3177342de5aad774a59d3e1b12754aee641d5f9cd1ecd2751471b308d2d8410add1c9fcc5a2b7371259f0538270832a98d18151f653efbc60895fab8be9650510449081626b5cd24671d1a3253487d44f589c2ff0da3557e307e520cf4e0054bbf8bdffaa24b7e4cce5092ccae5a08281ee24758374f4e65f126cacce64051905b5e2038060ad399c69ca6cb1d596d7c9cb5e161c7dcddc1a7ad62660dd4a5f69b31229b80e6b3df520714e4ea2b5896ebd48d14c7455e91c1ecf4acc5ffb36937c49413b7d1005dd6efbd526f5af5d61131ca3fcdae1218ce81c75e62b39100ec7f474b48a2bee6cef453fa1bc3db95c7c6575bc2d5927cbf7413181ac905766a4038a7b422a8ef2bf7b5059b5c546c19a33c1049482b9a9093f864913ca82290decf6e9a65bf3f66bc3ba4a8ed17b56d890a83bcbe74435a42499dec115", hex.EncodeToString(enc))
+}
+
+func TestMultiProofVector(t *testing.T) {
+	fa, fb := testPoly(false), testPoly(true)
+	ca, cb := commit(fa), commit(fb)
+	openings := []opening{
+		{c: &ca, f: fa, z: 0, y: big.NewInt(1)},
+		{c: &cb, f: fb, z: 0, y: big.NewInt(32)},
+	}
+
+	prover := newTranscript("test")
+	proof, err := proveMulti(prover, openings)
+	require.NoError(t, err)
+	assert.Equal(t, "eee8a80357ff74b766eba39db90797d022e8d6dee426ded71234241be504d519", scalarHex(prover.challenge("state")))
+
+	require.True(t, verifyMulti(newTranscript("test"), openings, proof))
+	assert.Equal(t, "4f53588244efaf07a370ee3f9c467f933eed360d4fbf7a19dfc8bc49b67df4711bf1d0a720717cd6a8c75f1a668cb7cbdd63b48c676b89a7aee4298e71bd7f4013d7657146aa9736817da47051ed6a45fc7b5a61d00eb23e5df82a7f285cc10e67d444e91618465ca68d8ae4f2c916d1942201b7e2aae491ef0f809867d00e83468fb7f9af9b42ede76c1e90d89dd789ff22eb09e8b1d062d8a58b6f88b3cbe80136fc68331178cd45a1df9496ded092d976911b5244b85bc3de41e844ec194256b39aeee4ea55538a36139211e9910ad6b7a74e75d45b869d0a67aa4bf600930a5f760dfb8e4df9938d1f47b743d71c78ba8585e3b80aba26d24b1f50b36fa1458e79d54c05f58049245392bc3e2b5c5f9a1b99d43ed112ca82b201fb143d401741713188e47f1d6682b0bf496a5d4182836121efff0fd3b030fc6bfb5e21d6314a200963fe75cb856d444a813426b2084dfdc49dca2e649cb9da8bcb47859a4c629e97898e3547c591e39764110a224150d579c33fb74fa5eb96427036899c04154feab5344873d36a53a5baefd78c132be419f3f3a8dd8f60f72eb78dd5f43c53226f5ceb68947da3e19a750d760fb31fa8d4c7f53bfef11c4b89158aa56b1f4395430e16a3128f88e234ce1df7ef865f2d2c4975e8c82225f578310c31fd41d265fd530cbfa2b8895b228a510b806c31dff3b1fa5c08bffad443d567ed0e628febdd22775776e0cc9cebcaea9c6df9279a5d91dd0ee5e7a0434e989a160005321c97026cb559f71db23360105460d959bcdf74bee22c4ad8805a1d497507", hex.EncodeToString(proof.bytes()))
+}